@@ -0,0 +1,134 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pxapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"px.dev/pixie/src/api/go/pxapi/errdefs"
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+// QueryBudget limits how much data a script can pull from Vizier. A zero limit is unlimited.
+type QueryBudget struct {
+	// MaxBytes is the maximum number of bytes of results that the script can return.
+	MaxBytes int64
+	// MaxRows is the maximum number of rows of results that the script can return.
+	MaxRows int64
+}
+
+func (b QueryBudget) enabled() bool {
+	return b.MaxBytes > 0 || b.MaxRows > 0
+}
+
+// QueryCost is the cost of a script, as reported by Vizier while the script runs.
+type QueryCost struct {
+	// The progress of the query across the agents and tables that it reads from.
+	AgentsTotal     int64
+	AgentsCompleted int64
+	TablesTotal     int64
+	TablesCompleted int64
+
+	// RowsReceived and BytesReceived are the size of the results received so far, including the
+	// results of tables which are ignored by the TableMuxer.
+	RowsReceived  int64
+	BytesReceived int64
+
+	// Done is set once the script has finished, at which point the execution stats are filled in.
+	Done             bool
+	ExecutionTime    time.Duration
+	CompilationTime  time.Duration
+	BytesProcessed   int64
+	RecordsProcessed int64
+}
+
+// QueryCostCallback is called whenever the cost of a script changes. The cost must not be modified or
+// retained after the callback returns.
+type QueryCostCallback func(ctx context.Context, cost *QueryCost)
+
+// WithQueryBudget is the option to abort scripts once their results exceed the budget.
+func WithQueryBudget(budget QueryBudget) ClientOption {
+	return func(c *Client) {
+		c.queryBudget = budget
+	}
+}
+
+// WithQueryCostCallback is the option to receive the cost of scripts as they run.
+func WithQueryCostCallback(cb QueryCostCallback) ClientOption {
+	return func(c *Client) {
+		c.costCallback = cb
+	}
+}
+
+// tracksCost returns whether Vizier should stream the progress of scripts to the client.
+func (c *Client) tracksCost() bool {
+	return c != nil && (c.queryBudget.enabled() || c.costCallback != nil)
+}
+
+func (s *ScriptResults) handleReceivedBatch(ctx context.Context, b *vizierpb.RowBatchData) error {
+	s.rowsReceived += b.NumRows
+	s.bytesReceived += int64(b.Size())
+	if s.rowsReceived > s.cost.RowsReceived {
+		s.cost.RowsReceived = s.rowsReceived
+	}
+	if s.bytesReceived > s.cost.BytesReceived {
+		s.cost.BytesReceived = s.bytesReceived
+	}
+	if !s.budget.enabled() && s.costCallback == nil {
+		return nil
+	}
+	return s.updateCost(ctx)
+}
+
+func (s *ScriptResults) handleProgress(ctx context.Context, p *vizierpb.QueryProgress) error {
+	s.cost.AgentsTotal = p.AgentsTotal
+	s.cost.AgentsCompleted = p.AgentsCompleted
+	s.cost.TablesTotal = p.TablesTotal
+	s.cost.TablesCompleted = p.TablesCompleted
+	// Vizier counts the results that it has sent, which may be ahead of the results that the client has
+	// processed.
+	if p.RowsReceived > s.cost.RowsReceived {
+		s.cost.RowsReceived = p.RowsReceived
+	}
+	if p.BytesReceived > s.cost.BytesReceived {
+		s.cost.BytesReceived = p.BytesReceived
+	}
+	return s.updateCost(ctx)
+}
+
+// updateCost reports the cost of the script to the callback, and checks it against the budget.
+func (s *ScriptResults) updateCost(ctx context.Context) error {
+	if s.costCallback != nil {
+		s.costCallback(ctx, &s.cost)
+	}
+	if s.budget.MaxBytes > 0 && s.cost.BytesReceived > s.budget.MaxBytes {
+		return fmt.Errorf("%w: received %d bytes, budget is %d bytes", errdefs.ErrQueryBudgetExceeded, s.cost.BytesReceived, s.budget.MaxBytes)
+	}
+	if s.budget.MaxRows > 0 && s.cost.RowsReceived > s.budget.MaxRows {
+		return fmt.Errorf("%w: received %d rows, budget is %d rows", errdefs.ErrQueryBudgetExceeded, s.cost.RowsReceived, s.budget.MaxRows)
+	}
+	return nil
+}
+
+// Cost returns the cost of the script so far.
+func (s *ScriptResults) Cost() *QueryCost {
+	return &s.cost
+}
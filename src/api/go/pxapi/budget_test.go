@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pxapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/go/pxapi/errdefs"
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+func makeProgressResponse(agentsCompleted, rows, bytes int64) *vizierpb.ExecuteScriptResponse {
+	return &vizierpb.ExecuteScriptResponse{
+		Status: okStatus(),
+		Progress: &vizierpb.QueryProgress{
+			AgentsTotal:     2,
+			AgentsCompleted: agentsCompleted,
+			TablesTotal:     1,
+			RowsReceived:    rows,
+			BytesReceived:   bytes,
+		},
+	}
+}
+
+func TestQueryBudget_MaxRows(t *testing.T) {
+	results := newScriptResults()
+	results.tm = newTableMux()
+	results.budget = QueryBudget{MaxRows: 4}
+
+	relation := &vizierpb.Relation{
+		Columns: []*vizierpb.Relation_ColumnInfo{
+			noSemTypeColInfo("http_status", vizierpb.INT64),
+		},
+	}
+	table := NewFakeTable("http_table", "abc", relation)
+
+	ctx := context.Background()
+	require.NoError(t, results.handleGRPCMsg(ctx, table.MetadataResponse()))
+	require.NoError(t, results.handleGRPCMsg(ctx, table.RowBatchResponse([]*vizierpb.Column{
+		makeInt64Column([]int64{1, 2, 3}),
+	}, 3)))
+	err := results.handleGRPCMsg(ctx, table.RowBatchResponse([]*vizierpb.Column{
+		makeInt64Column([]int64{4, 5}),
+	}, 2))
+	require.ErrorIs(t, err, errdefs.ErrQueryBudgetExceeded)
+	assert.Equal(t, int64(5), results.Cost().RowsReceived)
+}
+
+func TestQueryBudget_ProgressExceedsMaxBytes(t *testing.T) {
+	results := newScriptResults()
+	results.budget = QueryBudget{MaxBytes: 1024}
+
+	ctx := context.Background()
+	require.NoError(t, results.handleGRPCMsg(ctx, makeProgressResponse(1, 10, 512)))
+	err := results.handleGRPCMsg(ctx, makeProgressResponse(1, 20, 2048))
+	require.ErrorIs(t, err, errdefs.ErrQueryBudgetExceeded)
+}
+
+func TestQueryCostCallback(t *testing.T) {
+	results := newScriptResults()
+	var costs []QueryCost
+	results.costCallback = func(ctx context.Context, cost *QueryCost) {
+		costs = append(costs, *cost)
+	}
+
+	ctx := context.Background()
+	require.NoError(t, results.handleGRPCMsg(ctx, makeProgressResponse(1, 10, 512)))
+	require.NoError(t, results.handleGRPCMsg(ctx, &vizierpb.ExecuteScriptResponse{
+		Status: okStatus(),
+		Result: &vizierpb.ExecuteScriptResponse_Data{
+			Data: &vizierpb.QueryData{
+				ExecutionStats: &vizierpb.QueryExecutionStats{
+					Timing:           &vizierpb.QueryTimingInfo{ExecutionTimeNs: 10, CompilationTimeNs: 5},
+					BytesProcessed:   4096,
+					RecordsProcessed: 100,
+				},
+			},
+		},
+	}))
+
+	require.Len(t, costs, 2)
+	assert.Equal(t, QueryCost{
+		AgentsTotal:     2,
+		AgentsCompleted: 1,
+		TablesTotal:     1,
+		RowsReceived:    10,
+		BytesReceived:   512,
+	}, costs[0])
+	assert.True(t, costs[1].Done)
+	assert.Equal(t, int64(4096), costs[1].BytesProcessed)
+	assert.Equal(t, int64(100), costs[1].RecordsProcessed)
+}
@@ -64,6 +64,9 @@ type Client struct {
 	disableTLSVerification bool
 	insecureDirect         bool
 
+	queryBudget  QueryBudget
+	costCallback QueryCostCallback
+
 	grpcConn *grpc.ClientConn
 	cmClient cloudpb.VizierClusterInfoClient
 	vizier   vizierpb.VizierServiceClient
@@ -108,6 +111,11 @@ func (c *Client) init(ctx context.Context) error {
 	return nil
 }
 
+// Close closes the connection of the client. Vizier clients created by the client can't be used afterwards.
+func (c *Client) Close() error {
+	return c.grpcConn.Close()
+}
+
 func (c *Client) cloudCtxWithMD(ctx context.Context) context.Context {
 	ctx = metadata.AppendToOutgoingContext(ctx,
 		"pixie-api-client", "go")
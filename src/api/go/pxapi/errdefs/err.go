@@ -56,6 +56,9 @@ var (
 
 	// ErrMissingArtifact occurs when an artifact could not be found.
 	ErrMissingArtifact = errors.New("missing artifact")
+
+	// ErrQueryBudgetExceeded occurs when the results of a script exceed the budget of the client.
+	ErrQueryBudgetExceeded = errors.New("query budget exceeded")
 )
 
 // MultiError is an interface to allow access to groups of errors.
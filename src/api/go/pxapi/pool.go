@@ -0,0 +1,248 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pxapi
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	defaultPoolMaxSize = 100
+	defaultPoolMaxIdle = 30 * time.Minute
+)
+
+// VizierClientFactory creates the client of a cluster, for a VizierClientPool.
+type VizierClientFactory func(ctx context.Context, clusterID string) (*VizierClient, error)
+
+// PoolOption configures options on the Vizier client pool.
+type PoolOption func(pool *VizierClientPool)
+
+// WithPoolMaxSize is the option to specify how many clients the pool keeps. When the pool is full, the least
+// recently used client is evicted.
+func WithPoolMaxSize(size int) PoolOption {
+	return func(p *VizierClientPool) {
+		p.maxSize = size
+	}
+}
+
+// WithPoolMaxIdle is the option to specify how long a client may go unused before it is evicted.
+func WithPoolMaxIdle(d time.Duration) PoolOption {
+	return func(p *VizierClientPool) {
+		p.maxIdle = d
+	}
+}
+
+// WithPoolOnEvict is the option to specify a function that is called with every client that the pool evicts.
+// When the factory creates a Client per cluster, such as for direct connections, it should close that Client.
+func WithPoolOnEvict(onEvict func(clusterID string, v *VizierClient)) PoolOption {
+	return func(p *VizierClientPool) {
+		p.onEvict = onEvict
+	}
+}
+
+type poolEntry struct {
+	clusterID string
+	// ready is closed once the client is created, or failed to be created.
+	ready    chan struct{}
+	client   *VizierClient
+	err      error
+	lastUsed time.Time
+	// elem is the element of the entry in the LRU list of the pool, once the client is created.
+	elem *list.Element
+}
+
+// VizierClientPool lazily creates and caches the Vizier clients of many clusters. It is safe for concurrent
+// use, and concurrent requests for the client of a cluster share a single client. Clients whose connection has
+// failed are evicted, as are clients that have gone unused, and the least recently used clients when the pool is
+// full. A client that is evicted should not be used for new queries.
+type VizierClientPool struct {
+	newClient VizierClientFactory
+	maxSize   int
+	maxIdle   time.Duration
+	onEvict   func(clusterID string, v *VizierClient)
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+	// lru holds the created entries, with the most recently used at the front.
+	lru *list.List
+	// evicted holds the entries that were evicted while the lock was held, so that onEvict is called after the
+	// lock is released.
+	evicted []*poolEntry
+}
+
+// NewVizierClientPool creates a pool that creates clients with the given factory.
+func NewVizierClientPool(newClient VizierClientFactory, opts ...PoolOption) *VizierClientPool {
+	p := &VizierClientPool{
+		newClient: newClient,
+		maxSize:   defaultPoolMaxSize,
+		maxIdle:   defaultPoolMaxIdle,
+		now:       time.Now,
+		entries:   make(map[string]*poolEntry),
+		lru:       list.New(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// NewVizierClientPool creates a pool of the clients of the clusters that are reached through this client.
+func (c *Client) NewVizierClientPool(opts ...PoolOption) *VizierClientPool {
+	return NewVizierClientPool(c.NewVizierClient, opts...)
+}
+
+// Get returns the client of the cluster, creating it if the pool doesn't have a healthy client for it.
+func (p *VizierClientPool) Get(ctx context.Context, clusterID string) (*VizierClient, error) {
+	for {
+		p.mu.Lock()
+		p.evictIdleLocked()
+		e, ok := p.entries[clusterID]
+		if !ok {
+			e = &poolEntry{clusterID: clusterID, ready: make(chan struct{})}
+			p.entries[clusterID] = e
+			p.unlock()
+			return p.create(ctx, e)
+		}
+		p.unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-e.ready:
+		}
+		if e.err != nil {
+			return nil, e.err
+		}
+
+		p.mu.Lock()
+		if p.entries[clusterID] != e {
+			// The client was evicted while this request waited for it.
+			p.unlock()
+			continue
+		}
+		if !e.client.healthy() {
+			p.evictLocked(e)
+			p.unlock()
+			continue
+		}
+		e.lastUsed = p.now()
+		p.lru.MoveToFront(e.elem)
+		p.unlock()
+		return e.client, nil
+	}
+}
+
+func (p *VizierClientPool) create(ctx context.Context, e *poolEntry) (*VizierClient, error) {
+	client, err := p.newClient(ctx, e.clusterID)
+
+	p.mu.Lock()
+	defer p.unlock()
+	defer close(e.ready)
+	if err != nil {
+		e.err = err
+		delete(p.entries, e.clusterID)
+		return nil, err
+	}
+	e.client = client
+	e.lastUsed = p.now()
+	e.elem = p.lru.PushFront(e)
+	for p.maxSize > 0 && p.lru.Len() > p.maxSize {
+		p.evictLocked(p.lru.Back().Value.(*poolEntry))
+	}
+	return client, nil
+}
+
+// Evict removes the client of the cluster from the pool, for example after a query on it failed. The next Get
+// creates a new client.
+func (p *VizierClientPool) Evict(clusterID string) {
+	p.mu.Lock()
+	defer p.unlock()
+	if e, ok := p.entries[clusterID]; ok && e.elem != nil {
+		p.evictLocked(e)
+	}
+}
+
+// Len returns the number of clients in the pool.
+func (p *VizierClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lru.Len()
+}
+
+// Close evicts all clients from the pool.
+func (p *VizierClientPool) Close() {
+	p.mu.Lock()
+	defer p.unlock()
+	for p.lru.Len() > 0 {
+		p.evictLocked(p.lru.Back().Value.(*poolEntry))
+	}
+}
+
+func (p *VizierClientPool) evictIdleLocked() {
+	if p.maxIdle <= 0 {
+		return
+	}
+	now := p.now()
+	for p.lru.Len() > 0 {
+		e := p.lru.Back().Value.(*poolEntry)
+		if now.Sub(e.lastUsed) < p.maxIdle {
+			return
+		}
+		p.evictLocked(e)
+	}
+}
+
+// evictLocked removes a created entry from the pool. The pool's lock must be held.
+func (p *VizierClientPool) evictLocked(e *poolEntry) {
+	delete(p.entries, e.clusterID)
+	p.lru.Remove(e.elem)
+	p.evicted = append(p.evicted, e)
+}
+
+// unlock releases the pool's lock, and then calls onEvict with the entries that were evicted while it was held.
+func (p *VizierClientPool) unlock() {
+	evicted := p.evicted
+	p.evicted = nil
+	p.mu.Unlock()
+	if p.onEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		p.onEvict(e.clusterID, e.client)
+	}
+}
+
+// healthy returns whether the connection of the client can still be used.
+func (v *VizierClient) healthy() bool {
+	if v.cloud == nil || v.cloud.grpcConn == nil {
+		return true
+	}
+	switch v.cloud.grpcConn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pxapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type fakeFactory struct {
+	created int32
+	err     error
+	release chan struct{}
+}
+
+func (f *fakeFactory) newClient(ctx context.Context, clusterID string) (*VizierClient, error) {
+	atomic.AddInt32(&f.created, 1)
+	if f.release != nil {
+		<-f.release
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &VizierClient{vizierID: clusterID}, nil
+}
+
+func TestVizierClientPool_SharesClients(t *testing.T) {
+	f := &fakeFactory{release: make(chan struct{})}
+	p := NewVizierClientPool(f.newClient)
+
+	var wg sync.WaitGroup
+	clients := make([]*VizierClient, 10)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := p.Get(context.Background(), "cluster-1")
+			assert.NoError(t, err)
+			clients[i] = v
+		}(i)
+	}
+	// Let the requests pile up on the client that is being created.
+	time.Sleep(10 * time.Millisecond)
+	close(f.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&f.created))
+	for _, v := range clients {
+		assert.Same(t, clients[0], v)
+	}
+	assert.Equal(t, 1, p.Len())
+}
+
+func TestVizierClientPool_FactoryError(t *testing.T) {
+	f := &fakeFactory{err: errors.New("cluster unreachable")}
+	p := NewVizierClientPool(f.newClient)
+
+	_, err := p.Get(context.Background(), "cluster-1")
+	assert.EqualError(t, err, "cluster unreachable")
+	_, err = p.Get(context.Background(), "cluster-1")
+	assert.Error(t, err)
+	// Failures aren't cached, so every request tries to create the client again.
+	assert.Equal(t, int32(2), f.created)
+	assert.Equal(t, 0, p.Len())
+}
+
+func TestVizierClientPool_EvictsLeastRecentlyUsed(t *testing.T) {
+	f := &fakeFactory{}
+	var evicted []string
+	p := NewVizierClientPool(f.newClient, WithPoolMaxSize(2), WithPoolOnEvict(func(clusterID string, v *VizierClient) {
+		assert.Equal(t, clusterID, v.vizierID)
+		evicted = append(evicted, clusterID)
+	}))
+	ctx := context.Background()
+
+	for _, id := range []string{"cluster-1", "cluster-2", "cluster-1", "cluster-3"} {
+		_, err := p.Get(ctx, id)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"cluster-2"}, evicted)
+	assert.Equal(t, 2, p.Len())
+
+	p.Evict("cluster-1")
+	assert.Equal(t, []string{"cluster-2", "cluster-1"}, evicted)
+
+	p.Close()
+	assert.Equal(t, []string{"cluster-2", "cluster-1", "cluster-3"}, evicted)
+	assert.Equal(t, 0, p.Len())
+	assert.Equal(t, int32(3), f.created)
+}
+
+func TestVizierClientPool_EvictsIdle(t *testing.T) {
+	f := &fakeFactory{}
+	p := NewVizierClientPool(f.newClient, WithPoolMaxIdle(time.Minute))
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	first, err := p.Get(ctx, "cluster-1")
+	require.NoError(t, err)
+	now = now.Add(30 * time.Second)
+	v, err := p.Get(ctx, "cluster-1")
+	require.NoError(t, err)
+	assert.Same(t, first, v)
+
+	now = now.Add(2 * time.Minute)
+	v, err = p.Get(ctx, "cluster-1")
+	require.NoError(t, err)
+	assert.NotSame(t, first, v)
+	assert.Equal(t, int32(2), f.created)
+}
+
+func TestVizierClientPool_EvictsUnhealthy(t *testing.T) {
+	conn, err := grpc.Dial("localhost:0", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	var created int32
+	p := NewVizierClientPool(func(ctx context.Context, clusterID string) (*VizierClient, error) {
+		atomic.AddInt32(&created, 1)
+		return &VizierClient{vizierID: clusterID, cloud: &Client{grpcConn: conn}}, nil
+	})
+	ctx := context.Background()
+
+	first, err := p.Get(ctx, "cluster-1")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	v, err := p.Get(ctx, "cluster-1")
+	require.NoError(t, err)
+	assert.NotSame(t, first, v)
+	assert.Equal(t, int32(2), created)
+}
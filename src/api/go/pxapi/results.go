@@ -66,6 +66,13 @@ type ScriptResults struct {
 
 	stats *ResultsStats
 
+	budget       QueryBudget
+	costCallback QueryCostCallback
+	cost         QueryCost
+	// The number of rows and bytes of results which the client has received.
+	rowsReceived  int64
+	bytesReceived int64
+
 	v       *VizierClient
 	queryID string
 	origCtx context.Context
@@ -123,6 +130,9 @@ func (s *ScriptResults) handleGRPCMsg(ctx context.Context, resp *vizierpb.Execut
 	if err := errdefs.ParseStatus(resp.Status); err != nil {
 		return err
 	}
+	if resp.Progress != nil {
+		return s.handleProgress(ctx, resp.Progress)
+	}
 	switch v := resp.Result.(type) {
 	case *vizierpb.ExecuteScriptResponse_MetaData:
 		return s.handleTableMetadata(ctx, v)
@@ -165,6 +175,7 @@ func (s *ScriptResults) reconnect() error {
 		ClusterID:         s.v.vizierID,
 		QueryID:           s.queryID,
 		EncryptionOptions: s.v.encOpts,
+		StreamProgress:    s.v.cloud.tracksCost(),
 	}
 	ctx, cancel := context.WithCancel(s.origCtx)
 	res, err := s.v.vzClient.ExecuteScript(s.v.cloud.cloudCtxWithMD(ctx), req)
@@ -205,6 +216,10 @@ func (s *ScriptResults) run() error {
 			s.queryID = resp.QueryID
 		}
 		if err := s.handleGRPCMsg(ctx, resp); err != nil {
+			if errors.Is(err, errdefs.ErrQueryBudgetExceeded) {
+				// Stop the script from running any further on Vizier.
+				s.cancel()
+			}
 			return err
 		}
 	}
@@ -277,6 +292,9 @@ func (s *ScriptResults) handleTableRowbatch(ctx context.Context, b *vizierpb.Row
 		return errdefs.ErrInternalMissingTableMetadata
 	}
 	s.stats.AcceptedBytes += int64(b.Size())
+	if err := s.handleReceivedBatch(ctx, b); err != nil {
+		return err
+	}
 	if tracker.handler == nil {
 		// No handler specified for this table, skip it.
 		return nil
@@ -387,6 +405,15 @@ func (s *ScriptResults) handleStats(ctx context.Context, qes *vizierpb.QueryExec
 	s.stats.RecordsProcessed += qes.RecordsProcessed
 	s.stats.CompilationTime = time.Duration(qes.Timing.CompilationTimeNs) * time.Nanosecond
 	s.stats.ExecutionTime = time.Duration(qes.Timing.ExecutionTimeNs) * time.Nanosecond
+
+	s.cost.Done = true
+	s.cost.BytesProcessed = s.stats.BytesProcessed
+	s.cost.RecordsProcessed = s.stats.RecordsProcessed
+	s.cost.CompilationTime = s.stats.CompilationTime
+	s.cost.ExecutionTime = s.stats.ExecutionTime
+	if s.costCallback != nil {
+		s.costCallback(ctx, &s.cost)
+	}
 	return nil
 }
 
@@ -41,6 +41,7 @@ func (v *VizierClient) ExecuteScript(ctx context.Context, pxl string, mux TableM
 		ClusterID:         v.vizierID,
 		QueryStr:          pxl,
 		EncryptionOptions: v.encOpts,
+		StreamProgress:    v.cloud.tracksCost(),
 	}
 	origCtx := ctx
 	ctx, cancel := context.WithCancel(ctx)
@@ -57,6 +58,8 @@ func (v *VizierClient) ExecuteScript(ctx context.Context, pxl string, mux TableM
 	sr.decOpts = v.decOpts
 	sr.v = v
 	sr.origCtx = origCtx
+	sr.budget = v.cloud.queryBudget
+	sr.costCallback = v.cloud.costCallback
 
 	return sr, nil
 }
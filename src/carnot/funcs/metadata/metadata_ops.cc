@@ -59,6 +59,8 @@ void RegisterMetadataOpsOrDie(px::carnot::udf::Registry* registry) {
   registry->RegisterOrDie<PodIDToServiceNameUDF>("pod_id_to_service_name");
   registry->RegisterOrDie<PodIDToServiceIDUDF>("pod_id_to_service_id");
   registry->RegisterOrDie<PodIDToOwnerReferencesUDF>("pod_id_to_owner_references");
+  registry->RegisterOrDie<PodIDToWorkloadNameUDF>("pod_id_to_workload_name");
+  registry->RegisterOrDie<PodIDToWorkloadKindUDF>("pod_id_to_workload_kind");
   registry->RegisterOrDie<IPToServiceIDUDF>("ip_to_service_id");
   registry->RegisterOrDie<PodNameToNamespaceUDF>("pod_name_to_namespace");
   registry->RegisterOrDie<PodNameToReplicaSetNameUDF>("pod_name_to_replicaset_name");
@@ -124,6 +126,8 @@ void RegisterMetadataOpsOrDie(px::carnot::udf::Registry* registry) {
   registry->RegisterOrDie<UPIDToReplicaSetIDUDF>("upid_to_replicaset_id");
   registry->RegisterOrDie<UPIDToDeploymentNameUDF>("upid_to_deployment_name");
   registry->RegisterOrDie<UPIDToDeploymentIDUDF>("upid_to_deployment_id");
+  registry->RegisterOrDie<UPIDToWorkloadNameUDF>("upid_to_workload_name");
+  registry->RegisterOrDie<UPIDToWorkloadKindUDF>("upid_to_workload_kind");
   registry->RegisterOrDie<UPIDToStringUDF>("upid_to_string");
   registry->RegisterOrDie<HostnameUDF>("_exec_hostname");
   registry->RegisterOrDie<HostNumCPUsUDF>("_exec_host_num_cpus");
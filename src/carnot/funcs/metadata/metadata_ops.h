@@ -1855,6 +1855,116 @@ class PodIDToServiceIDUDF : public ScalarUDF {
   }
 };
 
+/**
+ * @brief Returns the name of the top-level workload that manages the pod with the given pod ID.
+ */
+class PodIDToWorkloadNameUDF : public ScalarUDF {
+ public:
+  StringValue Exec(FunctionContext* ctx, StringValue pod_id) {
+    auto md = GetMetadataState(ctx);
+
+    const auto* pod_info = md->k8s_metadata_state().PodInfoByID(pod_id);
+    if (pod_info == nullptr || pod_info->workload().uid.empty()) {
+      return "";
+    }
+    return absl::Substitute("$0/$1", pod_info->ns(), pod_info->workload().name);
+  }
+
+  static udf::ScalarUDFDocBuilder Doc() {
+    return udf::ScalarUDFDocBuilder(
+               "Get the name of the top-level workload which manages the pod with pod ID.")
+        .Details(
+            "Gets the Kubernetes name of the top-level workload, such as a Deployment, "
+            "StatefulSet, DaemonSet, CronJob or custom resource, that manages the Pod (specified "
+            "by Pod ID). The workload is found by following the owner references of the Pod. "
+            "If this pod has no owners, returns an empty string.")
+        .Example("df.workload_name = px.pod_id_to_workload_name(df.pod_id)")
+        .Arg("pod_id", "The Pod ID of the Pod to get the workload name for.")
+        .Returns("The k8s workload name which manages the Pod with the Pod ID.");
+  }
+};
+
+/**
+ * @brief Returns the kind of the top-level workload that manages the pod with the given pod ID.
+ */
+class PodIDToWorkloadKindUDF : public ScalarUDF {
+ public:
+  StringValue Exec(FunctionContext* ctx, StringValue pod_id) {
+    auto md = GetMetadataState(ctx);
+
+    const auto* pod_info = md->k8s_metadata_state().PodInfoByID(pod_id);
+    if (pod_info == nullptr) {
+      return "";
+    }
+    return pod_info->workload().kind;
+  }
+
+  static udf::ScalarUDFDocBuilder Doc() {
+    return udf::ScalarUDFDocBuilder(
+               "Get the kind of the top-level workload which manages the pod with pod ID.")
+        .Details(
+            "Gets the Kubernetes kind of the top-level workload, such as Deployment, StatefulSet, "
+            "DaemonSet, CronJob or the kind of a custom resource, that manages the Pod (specified "
+            "by Pod ID). If this pod has no owners, returns an empty string.")
+        .Example("df.workload_kind = px.pod_id_to_workload_kind(df.pod_id)")
+        .Arg("pod_id", "The Pod ID of the Pod to get the workload kind for.")
+        .Returns("The k8s workload kind which manages the Pod with the Pod ID.");
+  }
+};
+
+/**
+ * @brief Returns the name of the top-level workload that manages the process with the given UPID.
+ */
+class UPIDToWorkloadNameUDF : public ScalarUDF {
+ public:
+  StringValue Exec(FunctionContext* ctx, UInt128Value upid_value) {
+    auto md = GetMetadataState(ctx);
+    auto pod_info = UPIDtoPod(md, upid_value);
+    if (pod_info == nullptr || pod_info->workload().uid.empty()) {
+      return "";
+    }
+    return absl::Substitute("$0/$1", pod_info->ns(), pod_info->workload().name);
+  }
+
+  static udf::ScalarUDFDocBuilder Doc() {
+    return udf::ScalarUDFDocBuilder("Get the top-level workload name from a UPID.")
+        .Details(
+            "Gets the Kubernetes name of the top-level workload, such as a Deployment, "
+            "StatefulSet, DaemonSet, CronJob or custom resource, that manages the process with "
+            "the given Unique Process ID (UPID). If the process doesn't belong to a pod with "
+            "owners, this function returns an empty string.")
+        .Example("df.workload_name = px.upid_to_workload_name(df.upid)")
+        .Arg("upid", "The UPID of the process to get the workload name for.")
+        .Returns("The Kubernetes workload name for the UPID passed in.");
+  }
+};
+
+/**
+ * @brief Returns the kind of the top-level workload that manages the process with the given UPID.
+ */
+class UPIDToWorkloadKindUDF : public ScalarUDF {
+ public:
+  StringValue Exec(FunctionContext* ctx, UInt128Value upid_value) {
+    auto md = GetMetadataState(ctx);
+    auto pod_info = UPIDtoPod(md, upid_value);
+    if (pod_info == nullptr) {
+      return "";
+    }
+    return pod_info->workload().kind;
+  }
+
+  static udf::ScalarUDFDocBuilder Doc() {
+    return udf::ScalarUDFDocBuilder("Get the top-level workload kind from a UPID.")
+        .Details(
+            "Gets the Kubernetes kind of the top-level workload that manages the process with "
+            "the given Unique Process ID (UPID). If the process doesn't belong to a pod with "
+            "owners, this function returns an empty string.")
+        .Example("df.workload_kind = px.upid_to_workload_kind(df.upid)")
+        .Arg("upid", "The UPID of the process to get the workload kind for.")
+        .Returns("The Kubernetes workload kind for the UPID passed in.");
+  }
+};
+
 /**
  * @brief Returns the owner references for the given pod ID.
  */
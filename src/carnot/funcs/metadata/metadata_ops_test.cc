@@ -270,6 +270,27 @@ TEST_F(MetadataOpsTest, upid_to_deployment_name_test) {
   udf_tester.ForInput(upid2).Expect("");
 }
 
+TEST_F(MetadataOpsTest, upid_to_workload_name_test) {
+  auto function_ctx = std::make_unique<FunctionContext>(metadata_state_, nullptr);
+  auto udf_tester = px::carnot::udf::UDFTester<UPIDToWorkloadNameUDF>(std::move(function_ctx));
+  auto upid1 = types::UInt128Value(528280977975, 89101);
+  udf_tester.ForInput(upid1).Expect("pl/deployment1");
+  // This pod has owners, but no resolved workload.
+  auto upid2 = types::UInt128Value(528280977975, 468);
+  udf_tester.ForInput(upid2).Expect("");
+  auto upid3 = types::UInt128Value(528280977975, 123);
+  udf_tester.ForInput(upid3).Expect("");
+}
+
+TEST_F(MetadataOpsTest, upid_to_workload_kind_test) {
+  auto function_ctx = std::make_unique<FunctionContext>(metadata_state_, nullptr);
+  auto udf_tester = px::carnot::udf::UDFTester<UPIDToWorkloadKindUDF>(std::move(function_ctx));
+  auto upid1 = types::UInt128Value(528280977975, 89101);
+  udf_tester.ForInput(upid1).Expect("Deployment");
+  auto upid3 = types::UInt128Value(528280977975, 123);
+  udf_tester.ForInput(upid3).Expect("");
+}
+
 TEST_F(MetadataOpsTest, upid_to_deployment_id_test) {
   auto function_ctx = std::make_unique<FunctionContext>(metadata_state_, nullptr);
   auto udf_tester = px::carnot::udf::UDFTester<UPIDToDeploymentIDUDF>(std::move(function_ctx));
@@ -327,6 +348,25 @@ TEST_F(MetadataOpsTest, pod_id_to_replicaset_id_test) {
   udf_tester.ForInput("123_uid").Expect("");
 }
 
+TEST_F(MetadataOpsTest, pod_id_to_workload_name_test) {
+  auto function_ctx = std::make_unique<FunctionContext>(metadata_state_, nullptr);
+  auto udf_tester = px::carnot::udf::UDFTester<PodIDToWorkloadNameUDF>(std::move(function_ctx));
+  udf_tester.ForInput("1_uid").Expect("pl/deployment1");
+  // This pod has owners, but no resolved workload.
+  udf_tester.ForInput("2_uid").Expect("");
+  // This pod is not available, should return empty.
+  udf_tester.ForInput("123_uid").Expect("");
+}
+
+TEST_F(MetadataOpsTest, pod_id_to_workload_kind_test) {
+  auto function_ctx = std::make_unique<FunctionContext>(metadata_state_, nullptr);
+  auto udf_tester = px::carnot::udf::UDFTester<PodIDToWorkloadKindUDF>(std::move(function_ctx));
+  udf_tester.ForInput("1_uid").Expect("Deployment");
+  udf_tester.ForInput("2_uid").Expect("");
+  // This pod is not available, should return empty.
+  udf_tester.ForInput("123_uid").Expect("");
+}
+
 TEST_F(MetadataOpsTest, pod_id_to_deployment_name_test) {
   auto function_ctx = std::make_unique<FunctionContext>(metadata_state_, nullptr);
   auto udf_tester = px::carnot::udf::UDFTester<PodIDToDeploymentNameUDF>(std::move(function_ctx));
@@ -27,10 +27,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	"github.com/gorilla/handlers"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/vizierpb"
@@ -38,7 +40,9 @@ import (
 	"px.dev/pixie/src/cloud/api/controllers"
 	"px.dev/pixie/src/cloud/api/ptproxy"
 	"px.dev/pixie/src/cloud/autocomplete"
+	"px.dev/pixie/src/cloud/shared/audit"
 	"px.dev/pixie/src/cloud/shared/esutils"
+	"px.dev/pixie/src/cloud/shared/idempotency"
 	"px.dev/pixie/src/cloud/shared/idprovider"
 	"px.dev/pixie/src/cloud/shared/vzshard"
 	"px.dev/pixie/src/shared/services"
@@ -53,6 +57,15 @@ import (
 const defaultBundleFile = "https://storage.googleapis.com/pixie-prod-artifacts/script-bundles/bundle-core.json"
 const ossBundleFile = "https://artifacts.px.dev/pxl_scripts/bundle.json"
 
+// idempotentMethods are the mutating methods that deduplicate retries with the same idempotency key.
+var idempotentMethods = []string{
+	"/px.cloudapi.APIKeyManager/Create",
+	"/px.cloudapi.OrganizationService/CreateOrg",
+	"/px.cloudapi.PluginService/CreateRetentionScript",
+	"/px.cloudapi.VizierClusterInfo/CreateCluster",
+	"/px.cloudapi.VizierDeploymentKeyManager/Create",
+}
+
 func init() {
 	pflag.String("domain_name", "dev.withpixie.dev", "The domain name of Pixie Cloud")
 	pflag.String("elastic_service", "https://pl-elastic-es-http.plc-dev.svc.cluster.local:9200", "The url of the elasticsearch cluster")
@@ -66,10 +79,12 @@ func init() {
 
 	pflag.String("auth_connector_name", "", "If any, the name of the auth connector to be used with Pixie")
 	pflag.String("auth_connector_callback_url", "", "If any, the callback URL for the auth connector")
+	pflag.Duration("idempotency_window", 24*time.Hour, "How long retries of a request with the same idempotency key are deduplicated")
 }
 
 func main() {
 	services.SetupService("api-service", 51200)
+	audit.SetupFlags()
 	services.SetupSSLClientFlags()
 	vzshard.SetupFlags()
 	services.PostFlagSetupAndParse()
@@ -80,6 +95,11 @@ func main() {
 	flush := services.InitDefaultSentry()
 	defer flush()
 
+	if err := audit.Init(); err != nil {
+		log.WithError(err).Fatal("Failed to set up the audit log")
+	}
+	defer audit.Close()
+
 	ac, err := controllers.NewAuthClient()
 	if err != nil {
 		log.WithError(err).Fatal("Failed to init auth client")
@@ -115,6 +135,11 @@ func main() {
 		log.WithError(err).Fatal("Failed to init API key client")
 	}
 
+	pat, err := controllers.NewPersonalAccessTokenClient()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to init personal access token client")
+	}
+
 	oa, err := idprovider.NewHydraKratosClient()
 	if err != nil {
 		log.WithError(err).Fatal("Failed to init Hydra + Kratos idprovider client")
@@ -132,6 +157,13 @@ func main() {
 
 	// Connect to NATS.
 	nc := msgbus.MustConnectNATS()
+	js := msgbus.MustConnectJetStream(nc)
+
+	idem, err := idempotency.NewInterceptor(js, viper.GetDuration("idempotency_window"),
+		viper.GetInt("jetstream_cluster_size"), idempotentMethods...)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create idempotency key store")
+	}
 
 	esConfig := &esutils.Config{
 		URL:        []string{viper.GetString("elastic_service")},
@@ -151,6 +183,11 @@ func main() {
 	mux.Handle("/api/auth/logout", handler.New(env, controllers.AuthLogoutHandler))
 	mux.Handle("/api/auth/refetch", handler.New(env, controllers.AuthRefetchHandler))
 	mux.Handle("/api/auth/oauth/login", handler.New(env, controllers.AuthOAuthLoginHandler))
+	// Serves the SAML service provider endpoints of the orgs, at /api/auth/saml/<orgID>/<endpoint>.
+	mux.Handle("/api/auth/saml/", handler.New(env, controllers.AuthSAMLHandler))
+	// Serves the SCIM 2.0 endpoints that identity providers use to provision the users and groups of an org.
+	// These are authenticated with an API key of the org.
+	mux.Handle("/api/scim/v2/", handler.New(env, controllers.SCIMHandler))
 	// This is an unauthenticated path that will check and validate if a particular domain
 	// is available for registration. This need to be unauthenticated because we need to check this before
 	// the user registers.
@@ -175,6 +212,7 @@ func main() {
 			}
 			return controllers.GetAugmentedTokenGRPC(ctx, apiEnv)
 		},
+		Authorize: controllers.AuthorizeGRPC,
 		DisableAuth: map[string]bool{
 			"/px.cloudapi.ArtifactTracker/GetArtifactList":    true,
 			"/px.cloudapi.ArtifactTracker/GetDownloadLink":    true,
@@ -184,6 +222,11 @@ func main() {
 			"/px.cloudapi.ConfigService/GetConfigForOperator": true,
 			"/px.cloudapi.AuthService/Login":                  true,
 		},
+		// Browsers talk to the API service with gRPC-Web.
+		EnableGRPCWeb:     true,
+		EnableRESTGateway: true,
+		// Runs after the default middleware, so that idempotency keys can be scoped to the authenticated user.
+		GRPCServerOpts: []grpc.ServerOption{grpc.ChainUnaryInterceptor(idem.UnaryServerInterceptor())},
 	}
 
 	domainName := viper.GetString("domain_name")
@@ -210,10 +253,49 @@ func main() {
 	aks := &controllers.APIKeyServer{APIKeyClient: ak}
 	cloudpb.RegisterAPIKeyManagerServer(s.GRPCServer(), aks)
 
+	// The stored responses of the created keys only identify them, and retries look up their values.
+	idem.SetSecretResponse("/px.cloudapi.APIKeyManager/Create", idempotency.SecretResponse{
+		Redact: func(resp proto.Message) proto.Message {
+			key := *resp.(*cloudpb.APIKey)
+			key.Key = ""
+			return &key
+		},
+		Restore: func(ctx context.Context, redacted proto.Message) (proto.Message, error) {
+			resp, err := aks.Get(ctx, &cloudpb.GetAPIKeyRequest{ID: redacted.(*cloudpb.APIKey).ID})
+			if err != nil {
+				return nil, err
+			}
+			return resp.Key, nil
+		},
+	})
+	idem.SetSecretResponse("/px.cloudapi.VizierDeploymentKeyManager/Create", idempotency.SecretResponse{
+		Redact: func(resp proto.Message) proto.Message {
+			key := *resp.(*cloudpb.DeploymentKey)
+			key.Key = ""
+			return &key
+		},
+		Restore: func(ctx context.Context, redacted proto.Message) (proto.Message, error) {
+			resp, err := vdks.Get(ctx, &cloudpb.GetDeploymentKeyRequest{ID: redacted.(*cloudpb.DeploymentKey).ID})
+			if err != nil {
+				return nil, err
+			}
+			return resp.Key, nil
+		},
+	})
+
+	pats := &controllers.PersonalAccessTokenServer{PersonalAccessTokenClient: pat}
+	cloudpb.RegisterPersonalAccessTokenManagerServer(s.GRPCServer(), pats)
+
 	authServer := &controllers.AuthServer{AuthClient: ac}
 	cloudpb.RegisterAuthServiceServer(s.GRPCServer(), authServer)
 
-	vpt := ptproxy.NewVizierPassThroughProxy(nc, vc)
+	mc, err := apienv.NewMeteringServiceClient()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to init metering client")
+	}
+
+	vpt := ptproxy.NewVizierPassThroughProxy(nc, vc, oc)
+	vpt.SetMeteringClient(mc)
 	vizierpb.RegisterVizierServiceServer(s.GRPCServer(), vpt)
 	vizierpb.RegisterVizierDebugServiceServer(s.GRPCServer(), vpt)
 
@@ -224,6 +306,13 @@ func main() {
 	sms := &controllers.ScriptMgrServer{ScriptMgr: sm}
 	cloudpb.RegisterScriptMgrServer(s.GRPCServer(), sms)
 
+	sq, err := apienv.NewSavedQueryServiceClient()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to init saved query client.")
+	}
+	sqs := &controllers.SavedQueryServer{SavedQueryClient: sq}
+	cloudpb.RegisterSavedQueryServiceServer(s.GRPCServer(), sqs)
+
 	mdIndexName := viper.GetString("md_index_name")
 	if mdIndexName == "" {
 		log.Fatal("Must specify a name for the elastic index.")
@@ -232,6 +321,7 @@ func main() {
 	if err != nil {
 		log.WithError(err).Fatal("Failed to start elastic suggester")
 	}
+	vpt.SetEntitySuggester(esSuggester)
 
 	var br *script.BundleManager
 	var bundleErr error
@@ -287,6 +377,8 @@ func main() {
 		OrgServer:             os,
 		UserServer:            us,
 		PluginServer:          pss,
+		SavedQueryServer:      sqs,
+		NATSConn:              nc,
 	}
 
 	mux.Handle("/api/graphql", controllers.WithAugmentedAuthMiddleware(env, controllers.NewGraphQLHandler(gqlEnv)))
@@ -45,3 +45,19 @@ func NewScriptMgrServiceClient() (scriptmgrpb.ScriptMgrServiceClient, error) {
 
 	return scriptmgrpb.NewScriptMgrServiceClient(authChannel), nil
 }
+
+// NewSavedQueryServiceClient creates a new saved query RPC client stub. Saved queries are served by
+// the scriptmgr service.
+func NewSavedQueryServiceClient() (scriptmgrpb.SavedQueryServiceClient, error) {
+	dialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	authChannel, err := grpc.Dial(viper.GetString("scriptmgr_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scriptmgrpb.NewSavedQueryServiceClient(authChannel), nil
+}
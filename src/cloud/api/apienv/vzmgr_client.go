@@ -45,3 +45,18 @@ func NewVZMgrServiceClients() (vzmgrpb.VZMgrServiceClient, vzmgrpb.VZDeploymentK
 
 	return vzmgrpb.NewVZMgrServiceClient(vzMgrChan), vzmgrpb.NewVZDeploymentKeyServiceClient(vzMgrChan), nil
 }
+
+// NewMeteringServiceClient creates the metering RPC client stub, which is served by vzmgr.
+func NewMeteringServiceClient() (vzmgrpb.MeteringServiceClient, error) {
+	dialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	vzMgrChan, err := grpc.Dial(viper.GetString("vzmgr_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return vzmgrpb.NewMeteringServiceClient(vzMgrChan), nil
+}
@@ -35,22 +35,28 @@ type APIKeyServer struct {
 
 func apiKeyToCloudAPI(key *authpb.APIKey) *cloudpb.APIKey {
 	return &cloudpb.APIKey{
-		ID:        key.ID,
-		OrgID:     key.OrgID,
-		UserID:    key.UserID,
-		Key:       key.Key,
-		CreatedAt: key.CreatedAt,
-		Desc:      key.Desc,
+		ID:         key.ID,
+		OrgID:      key.OrgID,
+		UserID:     key.UserID,
+		Key:        key.Key,
+		CreatedAt:  key.CreatedAt,
+		Desc:       key.Desc,
+		Scopes:     key.Scopes,
+		ClusterIDs: key.ClusterIDs,
+		ExpiresAt:  key.ExpiresAt,
 	}
 }
 
 func apiKeyMetadataToCloudAPI(key *authpb.APIKeyMetadata) *cloudpb.APIKeyMetadata {
 	return &cloudpb.APIKeyMetadata{
-		ID:        key.ID,
-		OrgID:     key.OrgID,
-		UserID:    key.UserID,
-		CreatedAt: key.CreatedAt,
-		Desc:      key.Desc,
+		ID:         key.ID,
+		OrgID:      key.OrgID,
+		UserID:     key.UserID,
+		CreatedAt:  key.CreatedAt,
+		Desc:       key.Desc,
+		Scopes:     key.Scopes,
+		ClusterIDs: key.ClusterIDs,
+		ExpiresAt:  key.ExpiresAt,
 	}
 }
 
@@ -61,7 +67,12 @@ func (v *APIKeyServer) Create(ctx context.Context, req *cloudpb.CreateAPIKeyRequ
 		return nil, err
 	}
 
-	resp, err := v.APIKeyClient.Create(ctx, &authpb.CreateAPIKeyRequest{Desc: req.Desc})
+	resp, err := v.APIKeyClient.Create(ctx, &authpb.CreateAPIKeyRequest{
+		Desc:       req.Desc,
+		Scopes:     req.Scopes,
+		ClusterIDs: req.ClusterIDs,
+		ExpiresAt:  req.ExpiresAt,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -108,11 +119,53 @@ func (v *APIKeyServer) Get(ctx context.Context, req *cloudpb.GetAPIKeyRequest) (
 
 // Delete deletes a specific API key.
 func (v *APIKeyServer) Delete(ctx context.Context, uuid *uuidpb.UUID) (*types.Empty, error) {
+	_, err := v.Revoke(ctx, &cloudpb.RevokeAPIKeyRequest{ID: uuid})
+	if err != nil {
+		return nil, err
+	}
+	return &types.Empty{}, nil
+}
+
+// Revoke deletes a specific API key. For a dry run, the key is only looked up, and returned.
+func (v *APIKeyServer) Revoke(ctx context.Context, req *cloudpb.RevokeAPIKeyRequest) (*cloudpb.RevokeAPIKeyResponse, error) {
 	ctx, err := contextWithAuthToken(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return v.APIKeyClient.Delete(ctx, uuid)
+
+	if req.DryRun {
+		resp, err := v.APIKeyClient.Get(ctx, &authpb.GetAPIKeyRequest{
+			ID: req.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &cloudpb.RevokeAPIKeyResponse{
+			AffectedResources: []*cloudpb.AffectedResource{
+				affectedResource(affectedKindAPIKey, resp.Key.ID, resp.Key.Desc, affectedActionDelete),
+			},
+		}, nil
+	}
+
+	_, err = v.APIKeyClient.Delete(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudpb.RevokeAPIKeyResponse{}, nil
+}
+
+// Rotate replaces the value of a specific API key.
+func (v *APIKeyServer) Rotate(ctx context.Context, uuid *uuidpb.UUID) (*cloudpb.APIKey, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.APIKeyClient.Rotate(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return apiKeyToCloudAPI(resp), nil
 }
 
 // LookupAPIKey gets the complete API key information using just the Key.
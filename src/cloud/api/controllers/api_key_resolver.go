@@ -108,6 +108,9 @@ func apiKeyMetadatasToResolver(mds []*cloudpb.APIKeyMetadata) ([]*APIKeyMetadata
 
 // APIKeys lists all of the API keys.
 func (q *QueryResolver) APIKeys(ctx context.Context) ([]*APIKeyMetadataResolver, error) {
+	if err := checkOrgRoleForMethod(ctx, "/px.cloudapi.APIKeyManager/List"); err != nil {
+		return nil, err
+	}
 	grpcAPI := q.Env.APIKeyMgr
 	res, err := grpcAPI.List(ctx, &cloudpb.ListAPIKeyRequest{})
 	if err != nil {
@@ -123,6 +126,9 @@ type getOrDeleteAPIKeyArgs struct {
 
 // APIKey gets a specific API key.
 func (q *QueryResolver) APIKey(ctx context.Context, args *getOrDeleteAPIKeyArgs) (*APIKeyResolver, error) {
+	if err := checkOrgRoleForMethod(ctx, "/px.cloudapi.APIKeyManager/Get"); err != nil {
+		return nil, err
+	}
 	grpcAPI := q.Env.APIKeyMgr
 	res, err := grpcAPI.Get(ctx, &cloudpb.GetAPIKeyRequest{
 		ID: utils.ProtoFromUUIDStrOrNil(string(args.ID)),
@@ -28,6 +28,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/api/controllers"
 	"px.dev/pixie/src/cloud/api/controllers/testutils"
 	"px.dev/pixie/src/cloud/auth/authpb"
@@ -226,3 +227,85 @@ func TestAPIKeyServer_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIKeyServer_Revoke_DryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	id := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	mockClients.MockAPIKey.EXPECT().
+		Get(gomock.Any(), &authpb.GetAPIKeyRequest{ID: id}).
+		Return(&authpb.GetAPIKeyResponse{Key: &authpb.APIKey{ID: id, Desc: "ci key"}}, nil)
+
+	vzAPIKeyServer := &controllers.APIKeyServer{
+		APIKeyClient: mockClients.MockAPIKey,
+	}
+	resp, err := vzAPIKeyServer.Revoke(CreateTestContext(), &cloudpb.RevokeAPIKeyRequest{ID: id, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.RevokeAPIKeyResponse{
+		AffectedResources: []*cloudpb.AffectedResource{
+			{Kind: "api_key", ID: id, Name: "ci key", Action: "delete"},
+		},
+	}, resp)
+}
+
+func TestAPIKeyServer_Create_Scoped(t *testing.T) {
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	clusterID := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	expiresAt := types.TimestampNow()
+	expiresAt.Seconds += 3600
+	mockClients.MockAPIKey.EXPECT().
+		Create(gomock.Any(), &authpb.CreateAPIKeyRequest{
+			Desc:       "ci",
+			Scopes:     []string{"script:read"},
+			ClusterIDs: []*uuidpb.UUID{clusterID},
+			ExpiresAt:  expiresAt,
+		}).
+		Return(&authpb.APIKey{
+			ID:         utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+			Key:        "foobar",
+			Scopes:     []string{"script:read"},
+			ClusterIDs: []*uuidpb.UUID{clusterID},
+			ExpiresAt:  expiresAt,
+		}, nil)
+
+	vzAPIKeyServer := &controllers.APIKeyServer{
+		APIKeyClient: mockClients.MockAPIKey,
+	}
+
+	resp, err := vzAPIKeyServer.Create(CreateTestContext(), &cloudpb.CreateAPIKeyRequest{
+		Desc:       "ci",
+		Scopes:     []string{"script:read"},
+		ClusterIDs: []*uuidpb.UUID{clusterID},
+		ExpiresAt:  expiresAt,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"script:read"}, resp.Scopes)
+	assert.Equal(t, []*uuidpb.UUID{clusterID}, resp.ClusterIDs)
+	assert.Equal(t, expiresAt, resp.ExpiresAt)
+}
+
+func TestAPIKeyServer_Rotate(t *testing.T) {
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	id := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	mockClients.MockAPIKey.EXPECT().
+		Rotate(gomock.Any(), id).
+		Return(&authpb.APIKey{ID: id, Key: "px-api-new", Desc: "test key"}, nil)
+
+	vzAPIKeyServer := &controllers.APIKeyServer{
+		APIKeyClient: mockClients.MockAPIKey,
+	}
+
+	resp, err := vzAPIKeyServer.Rotate(CreateTestContext(), id)
+	require.NoError(t, err)
+	assert.Equal(t, id, resp.ID)
+	assert.Equal(t, "px-api-new", resp.Key)
+	assert.Equal(t, "test key", resp.Desc)
+}
@@ -620,7 +620,8 @@ func loginWithAPIKey(ctx context.Context, env commonenv.Env, r *http.Request, w
 	}
 
 	apiKeyResp, err := env.(apienv.APIEnv).AuthClient().GetAugmentedTokenForAPIKey(ctx, &authpb.GetAugmentedTokenForAPIKeyRequest{
-		APIKey: apiKey,
+		APIKey:   apiKey,
+		ClientIP: clientIP(r),
 	})
 	if err != nil {
 		return "", 0, services.HTTPStatusFromError(err, "Failed to login using API key")
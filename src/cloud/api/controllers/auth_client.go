@@ -60,3 +60,18 @@ func NewAPIKeyClient() (authpb.APIKeyServiceClient, error) {
 
 	return authpb.NewAPIKeyServiceClient(authChannel), nil
 }
+
+// NewPersonalAccessTokenClient creates a new personal access token client.
+func NewPersonalAccessTokenClient() (authpb.PersonalAccessTokenServiceClient, error) {
+	dialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	authChannel, err := grpc.Dial(viper.GetString("auth_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return authpb.NewPersonalAccessTokenServiceClient(authChannel), nil
+}
@@ -63,7 +63,8 @@ func (a *AuthServer) Login(ctx context.Context, req *cloudpb.LoginRequest) (*clo
 	// If API key is in headers, try to login with API key.
 	if token == "" && mdOK && len(apiKey) == 1 {
 		apiKeyResp, err := a.AuthClient.GetAugmentedTokenForAPIKey(aCtx, &authpb.GetAugmentedTokenForAPIKeyRequest{
-			APIKey: apiKey[0],
+			APIKey:   apiKey[0],
+			ClientIP: clientIPGRPC(ctx),
 		})
 		if err == nil {
 			token = apiKeyResp.Token
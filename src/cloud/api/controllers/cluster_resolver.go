@@ -271,3 +271,114 @@ func (q *QueryResolver) ClusterByName(ctx context.Context, args *clusterNameArgs
 	}
 	return nil, errors.New("Could not find cluster with name")
 }
+
+type clusterStatusesArgs struct {
+	Statuses      *[]string
+	VizierVersion *string
+	NameContains  *string
+	PageSize      *int32
+	Cursor        *string
+}
+
+// ClusterStatusSummaryResolver is the resolver responsible for the status of a cluster in a fleet.
+type ClusterStatusSummaryResolver struct {
+	clusterID            uuid.UUID
+	Status               string
+	LastHeartbeatMs      float64
+	VizierVersion        string
+	OperatorVersion      string
+	ClusterVersion       string
+	ClusterName          string
+	ClusterUID           string
+	NumNodes             int32
+	NumInstrumentedNodes int32
+}
+
+// ID returns cluster ID.
+func (c *ClusterStatusSummaryResolver) ID() graphql.ID {
+	return graphql.ID(c.clusterID.String())
+}
+
+// ClusterStatusCountResolver is the resolver for the number of clusters with a status.
+type ClusterStatusCountResolver struct {
+	Status string
+	Count  int32
+}
+
+// ClusterVersionCountResolver is the resolver for the number of clusters running a Vizier version.
+type ClusterVersionCountResolver struct {
+	VizierVersion string
+	Count         int32
+}
+
+// ClusterStatusPageResolver is the resolver for a page of cluster statuses.
+type ClusterStatusPageResolver struct {
+	Clusters      []*ClusterStatusSummaryResolver
+	NextCursor    string
+	TotalCount    int32
+	StatusCounts  []*ClusterStatusCountResolver
+	VersionCounts []*ClusterVersionCountResolver
+}
+
+// ClusterStatuses lists the status of the org's clusters a page at a time.
+func (q *QueryResolver) ClusterStatuses(ctx context.Context, args *clusterStatusesArgs) (*ClusterStatusPageResolver, error) {
+	req := &cloudpb.ListClusterStatusesRequest{}
+	if args.Statuses != nil {
+		for _, s := range *args.Statuses {
+			req.Statuses = append(req.Statuses, cloudpb.ClusterStatus(cloudpb.ClusterStatus_value[s]))
+		}
+	}
+	if args.VizierVersion != nil {
+		req.VizierVersion = *args.VizierVersion
+	}
+	if args.NameContains != nil {
+		req.ClusterNameContains = *args.NameContains
+	}
+	if args.PageSize != nil {
+		req.PageSize = *args.PageSize
+	}
+	if args.Cursor != nil {
+		req.Cursor = *args.Cursor
+	}
+
+	resp, err := q.Env.VizierClusterInfo.ListClusterStatuses(ctx, req)
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+
+	page := &ClusterStatusPageResolver{
+		NextCursor: resp.NextCursor,
+		TotalCount: int32(resp.TotalCount),
+	}
+	for _, c := range resp.Clusters {
+		clusterID, err := utils.UUIDFromProto(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		page.Clusters = append(page.Clusters, &ClusterStatusSummaryResolver{
+			clusterID:            clusterID,
+			Status:               c.Status.String(),
+			LastHeartbeatMs:      float64(c.LastHeartbeatNs) / 1e6,
+			VizierVersion:        c.VizierVersion,
+			OperatorVersion:      c.OperatorVersion,
+			ClusterVersion:       c.ClusterVersion,
+			ClusterName:          c.ClusterName,
+			ClusterUID:           c.ClusterUID,
+			NumNodes:             c.NumNodes,
+			NumInstrumentedNodes: c.NumInstrumentedNodes,
+		})
+	}
+	for _, c := range resp.StatusCounts {
+		page.StatusCounts = append(page.StatusCounts, &ClusterStatusCountResolver{
+			Status: c.Status.String(),
+			Count:  int32(c.Count),
+		})
+	}
+	for _, c := range resp.VersionCounts {
+		page.VersionCounts = append(page.VersionCounts, &ClusterVersionCountResolver{
+			VizierVersion: c.VizierVersion,
+			Count:         int32(c.Count),
+		})
+	}
+	return page, nil
+}
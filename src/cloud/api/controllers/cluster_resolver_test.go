@@ -255,3 +255,86 @@ func TestClusterInfoByName(t *testing.T) {
 		})
 	}
 }
+
+func TestClusterStatuses(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	mockClients.MockVizierClusterInfo.EXPECT().
+		ListClusterStatuses(gomock.Any(), &cloudpb.ListClusterStatusesRequest{
+			Statuses: []cloudpb.ClusterStatus{cloudpb.CS_UNHEALTHY, cloudpb.CS_DEGRADED},
+			PageSize: 1,
+		}).
+		Return(&cloudpb.ListClusterStatusesResponse{
+			Clusters: []*cloudpb.ClusterStatusSummary{{
+				ID:              utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+				Status:          cloudpb.CS_DEGRADED,
+				LastHeartbeatNs: 4 * 1000 * 1000,
+				VizierVersion:   "0.14.1",
+				ClusterName:     "prod-us-east",
+			}},
+			NextCursor: "abc",
+			TotalCount: 3,
+			StatusCounts: []*cloudpb.ListClusterStatusesResponse_StatusCount{
+				{Status: cloudpb.CS_UNHEALTHY, Count: 1},
+				{Status: cloudpb.CS_DEGRADED, Count: 2},
+			},
+			VersionCounts: []*cloudpb.ListClusterStatusesResponse_VersionCount{
+				{VizierVersion: "0.14.1", Count: 3},
+			},
+		}, nil)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:  gqlSchema,
+			Context: ctx,
+			Query: `
+				query {
+					clusterStatuses(statuses: [CS_UNHEALTHY, CS_DEGRADED], pageSize: 1) {
+						clusters {
+							id
+							status
+							lastHeartbeatMs
+							vizierVersion
+							clusterName
+						}
+						nextCursor
+						totalCount
+						statusCounts {
+							status
+							count
+						}
+						versionCounts {
+							vizierVersion
+							count
+						}
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"clusterStatuses": {
+						"clusters": [{
+							"id": "7ba7b810-9dad-11d1-80b4-00c04fd430c8",
+							"status": "CS_DEGRADED",
+							"lastHeartbeatMs": 4,
+							"vizierVersion": "0.14.1",
+							"clusterName": "prod-us-east"
+						}],
+						"nextCursor": "abc",
+						"totalCount": 3,
+						"statusCounts": [
+							{"status": "CS_UNHEALTHY", "count": 1},
+							{"status": "CS_DEGRADED", "count": 2}
+						],
+						"versionCounts": [
+							{"vizierVersion": "0.14.1", "count": 3}
+						]
+					}
+				}
+			`,
+		},
+	})
+}
@@ -147,6 +147,15 @@ func (v *VizierDeploymentKeyServer) Get(ctx context.Context, req *cloudpb.GetDep
 
 // Delete deletes a specific deploy key in vzmgr.
 func (v *VizierDeploymentKeyServer) Delete(ctx context.Context, uuid *uuidpb.UUID) (*types.Empty, error) {
+	_, err := v.Revoke(ctx, &cloudpb.RevokeDeploymentKeyRequest{ID: uuid})
+	if err != nil {
+		return nil, err
+	}
+	return &types.Empty{}, nil
+}
+
+// Revoke deletes a specific deploy key in vzmgr. For a dry run, the key is only looked up, and returned.
+func (v *VizierDeploymentKeyServer) Revoke(ctx context.Context, req *cloudpb.RevokeDeploymentKeyRequest) (*cloudpb.RevokeDeploymentKeyResponse, error) {
 	ctx, err := contextWithAuthToken(ctx)
 	if err != nil {
 		return nil, err
@@ -160,13 +169,29 @@ func (v *VizierDeploymentKeyServer) Delete(ctx context.Context, uuid *uuidpb.UUI
 		return nil, status.Error(codes.Internal, "error parsing org ID as UUID")
 	}
 
-	if err != nil {
-		return nil, err
+	if req.DryRun {
+		resp, err := v.VzDeploymentKey.Get(ctx, &vzmgrpb.GetDeploymentKeyRequest{
+			ID:    req.ID,
+			OrgID: orgID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &cloudpb.RevokeDeploymentKeyResponse{
+			AffectedResources: []*cloudpb.AffectedResource{
+				affectedResource(affectedKindDeploymentKey, resp.Key.ID, resp.Key.Desc, affectedActionDelete),
+			},
+		}, nil
 	}
-	return v.VzDeploymentKey.Delete(ctx, &vzmgrpb.DeleteDeploymentKeyRequest{
+
+	_, err = v.VzDeploymentKey.Delete(ctx, &vzmgrpb.DeleteDeploymentKeyRequest{
 		OrgID: orgID,
-		ID:    uuid,
+		ID:    req.ID,
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &cloudpb.RevokeDeploymentKeyResponse{}, nil
 }
 
 // LookupDeploymentKey gets the complete API key information using just the Key.
@@ -111,6 +111,9 @@ func deploymentKeyMetadatasToResolver(mds []*cloudpb.DeploymentKeyMetadata) ([]*
 
 // DeploymentKeys lists all of the deployment keys.
 func (q *QueryResolver) DeploymentKeys(ctx context.Context) ([]*DeploymentKeyMetadataResolver, error) {
+	if err := checkOrgRoleForMethod(ctx, "/px.cloudapi.VizierDeploymentKeyManager/List"); err != nil {
+		return nil, err
+	}
 	grpcAPI := q.Env.VizierDeployKeyMgr
 	res, err := grpcAPI.List(ctx, &cloudpb.ListDeploymentKeyRequest{})
 	if err != nil {
@@ -125,6 +128,9 @@ type getOrDeleteDeployKeyArgs struct {
 
 // DeploymentKey gets a specific deployment key.
 func (q *QueryResolver) DeploymentKey(ctx context.Context, args *getOrDeleteDeployKeyArgs) (*DeploymentKeyResolver, error) {
+	if err := checkOrgRoleForMethod(ctx, "/px.cloudapi.VizierDeploymentKeyManager/Get"); err != nil {
+		return nil, err
+	}
 	grpcAPI := q.Env.VizierDeployKeyMgr
 	res, err := grpcAPI.Get(ctx, &cloudpb.GetDeploymentKeyRequest{
 		ID: utils.ProtoFromUUIDStrOrNil(string(args.ID)),
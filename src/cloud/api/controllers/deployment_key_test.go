@@ -243,6 +243,32 @@ func TestVizierDeploymentKeyServer_Delete(t *testing.T) {
 	}
 }
 
+func TestVizierDeploymentKeyServer_Revoke_DryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	id := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9")
+	mockClients.MockVzDeployKey.EXPECT().
+		Get(gomock.Any(), &vzmgrpb.GetDeploymentKeyRequest{
+			ID:    id,
+			OrgID: utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		}).Return(&vzmgrpb.GetDeploymentKeyResponse{Key: &vzmgrpb.DeploymentKey{ID: id, Desc: "prod clusters"}}, nil)
+
+	vzDeployKeyServer := &controllers.VizierDeploymentKeyServer{
+		VzDeploymentKey: mockClients.MockVzDeployKey,
+	}
+	resp, err := vzDeployKeyServer.Revoke(CreateTestContext(), &cloudpb.RevokeDeploymentKeyRequest{ID: id, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.RevokeDeploymentKeyResponse{
+		AffectedResources: []*cloudpb.AffectedResource{
+			{Kind: "deployment_key", ID: id, Name: "prod clusters", Action: "delete"},
+		},
+	}, resp)
+}
+
 func TestVizierDeploymentKeyServer_LookupDeploymentKeyAuthorized(t *testing.T) {
 	tests := []struct {
 		name string
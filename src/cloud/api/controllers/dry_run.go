@@ -0,0 +1,48 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
+)
+
+// The kinds of resources that dry runs of destructive operations report.
+const (
+	affectedKindUser            = "user"
+	affectedKindOrg             = "org"
+	affectedKindDeploymentKey   = "deployment_key"
+	affectedKindAPIKey          = "api_key"
+	affectedKindRetentionScript = "retention_script"
+)
+
+// The actions that destructive operations take on the resources they affect.
+const (
+	affectedActionDelete        = "delete"
+	affectedActionRemoveFromOrg = "remove_from_org"
+)
+
+func affectedResource(kind string, id *uuidpb.UUID, name string, action string) *cloudpb.AffectedResource {
+	return &cloudpb.AffectedResource{
+		Kind:   kind,
+		ID:     id,
+		Name:   name,
+		Action: action,
+	}
+}
@@ -21,9 +21,11 @@ package controllers
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/graph-gophers/graphql-go"
 	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/nats-io/nats.go"
 	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
@@ -42,6 +44,12 @@ type GraphQLEnv struct {
 	OrgServer             cloudpb.OrganizationServiceServer
 	UserServer            cloudpb.UserServiceServer
 	PluginServer          cloudpb.PluginServiceServer
+	SavedQueryServer      cloudpb.SavedQueryServiceServer
+	// NATSConn is used to subscribe to script executions. If nil, script executions can't be subscribed to.
+	NATSConn *nats.Conn
+	// ClusterPollInterval is how often the cluster subscriptions check the clusters for changes.
+	// Defaults to 2s.
+	ClusterPollInterval time.Duration
 }
 
 // QueryResolver resolves queries for GQL.
@@ -75,12 +83,13 @@ func (q *QueryResolver) Noop(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
-// NewGraphQLHandler is the HTTP handler used for handling GraphQL requests.
+// NewGraphQLHandler is the HTTP handler used for handling GraphQL requests. Subscriptions are served over
+// WebSockets.
 func NewGraphQLHandler(graphqlEnv GraphQLEnv) http.Handler {
 	schemaData := complete.MustLoadSchema()
 	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.MaxParallelism(20)}
 	gqlSchema := graphql.MustParseSchema(schemaData, &QueryResolver{graphqlEnv}, opts...)
-	return &relay.Handler{Schema: gqlSchema}
+	return newGraphQLHandler(gqlSchema, withGraphQLOrgRoleCheck(&relay.Handler{Schema: gqlSchema}))
 }
 
 // NewUnauthenticatedGraphQLHandler is the HTTP handler used for handling unauthenticated GraphQL requests.
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/shared/services/authcontext"
+)
+
+// graphQLMutationMethods are the Pixie Cloud API methods that the GraphQL mutations call. The GraphQL resolvers
+// call the API servers directly, so the roles of the user are checked against these methods instead.
+var graphQLMutationMethods = map[string]string{
+	"CreateCluster":               "/px.cloudapi.VizierClusterInfo/CreateCluster",
+	"CreateDeploymentKey":         "/px.cloudapi.VizierDeploymentKeyManager/Create",
+	"DeleteDeploymentKey":         "/px.cloudapi.VizierDeploymentKeyManager/Delete",
+	"CreateAPIKey":                "/px.cloudapi.APIKeyManager/Create",
+	"DeleteAPIKey":                "/px.cloudapi.APIKeyManager/Delete",
+	"UpdateUserSettings":          "/px.cloudapi.UserService/UpdateUserSettings",
+	"SetUserAttributes":           "/px.cloudapi.UserService/SetUserAttributes",
+	"DeleteUser":                  "/px.cloudapi.UserService/DeleteUser",
+	"InviteUser":                  "/px.cloudapi.OrganizationService/InviteUser",
+	"UpdateUserPermissions":       "/px.cloudapi.UserService/UpdateUser",
+	"CreateOrg":                   "/px.cloudapi.OrganizationService/CreateOrg",
+	"UpdateOrgSettings":           "/px.cloudapi.OrganizationService/UpdateOrg",
+	"UpdateOrgBranding":           "/px.cloudapi.OrganizationService/UpdateOrgBranding",
+	"CreateInviteToken":           "/px.cloudapi.OrganizationService/CreateInviteToken",
+	"RevokeAllInviteTokens":       "/px.cloudapi.OrganizationService/RevokeAllInviteTokens",
+	"RemoveUserFromOrg":           "/px.cloudapi.OrganizationService/RemoveUserFromOrg",
+	"UpdateRetentionPluginConfig": "/px.cloudapi.PluginService/UpdateRetentionPluginConfig",
+	"UpdateRetentionScript":       "/px.cloudapi.PluginService/UpdateRetentionScript",
+	"CreateRetentionScript":       "/px.cloudapi.PluginService/CreateRetentionScript",
+	"DeleteRetentionScript":       "/px.cloudapi.PluginService/DeleteRetentionScript",
+	"CreateSavedQuery":            "/px.cloudapi.SavedQueryService/CreateSavedQuery",
+	"UpdateSavedQuery":            "/px.cloudapi.SavedQueryService/UpdateSavedQuery",
+	"DeleteSavedQuery":            "/px.cloudapi.SavedQueryService/DeleteSavedQuery",
+}
+
+// fragmentSpreadField stands in for the fields selected by a fragment in a mutation, which aren't resolved.
+const fragmentSpreadField = "..."
+
+// checkGraphQLOrgRole makes sure that the role of the user allows all of the mutations in the GraphQL document.
+// Mutations that can't be mapped to a Pixie Cloud API method are only allowed for admins.
+func checkGraphQLOrgRole(ctx context.Context, query string) error {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return ErrOrgRoleInsufficient
+	}
+	scopes := sCtx.Claims.GetScopes()
+	if !orgrole.IsRoleScoped(scopes) {
+		return nil
+	}
+	for _, field := range graphQLMutationFields(query) {
+		method, ok := graphQLMutationMethods[field]
+		if (ok && !orgrole.Allows(scopes, method)) || (!ok && !orgrole.IsAdmin(scopes)) {
+			return ErrOrgRoleInsufficient
+		}
+	}
+	return nil
+}
+
+// checkOrgRoleForMethod makes sure that the role of the user allows the Pixie Cloud API method, for the GraphQL
+// queries that call the API servers directly and aren't checked with the mutations.
+func checkOrgRoleForMethod(ctx context.Context, method string) error {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return ErrOrgRoleInsufficient
+	}
+	if !orgrole.Allows(sCtx.Claims.GetScopes(), method) {
+		return ErrOrgRoleInsufficient
+	}
+	return nil
+}
+
+// withGraphQLOrgRoleCheck rejects GraphQL requests over HTTP with mutations that the role of the user doesn't allow.
+func withGraphQLOrgRoleCheck(next http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var params struct {
+			Query string `json:"query"`
+		}
+		// Malformed requests are rejected by the GraphQL handler.
+		if json.Unmarshal(body, &params) == nil {
+			if err := checkGraphQLOrgRole(r.Context(), params.Query); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(f)
+}
+
+// graphQLMutationFields returns the names of the top-level fields of all of the mutations in the GraphQL document.
+// The document isn't validated, since the GraphQL schema rejects invalid documents before running them.
+func graphQLMutationFields(query string) []string {
+	tokens := lexGraphQL(query)
+	var fields []string
+	for i := 0; i < len(tokens); {
+		switch tokens[i] {
+		case "{":
+			// A query in the shorthand form.
+			i = skipGraphQLSelectionSet(tokens, i)
+		case "query", "mutation", "subscription", "fragment":
+			// Skip the name, variables, type condition and directives of the definition, up to its selection set.
+			start := i + 1
+			for parens := 0; start < len(tokens) && (tokens[start] != "{" || parens > 0); start++ {
+				if tokens[start] == "(" {
+					parens++
+				} else if tokens[start] == ")" {
+					parens--
+				}
+			}
+			if tokens[i] == "mutation" {
+				fields = append(fields, graphQLSelectionFields(tokens, start)...)
+			}
+			i = skipGraphQLSelectionSet(tokens, start)
+		default:
+			i++
+		}
+	}
+	return fields
+}
+
+// graphQLSelectionFields returns the names of the fields in the selection set that starts at tokens[start].
+func graphQLSelectionFields(tokens []string, start int) []string {
+	var fields []string
+	depth, parens := 0, 0
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t == "(":
+			parens++
+		case t == ")":
+			parens--
+		case parens > 0:
+			// Arguments may contain object values, which aren't selections.
+		case t == "{":
+			depth++
+		case t == "}":
+			depth--
+			if depth == 0 {
+				return fields
+			}
+		case depth != 1:
+		case t == "@":
+			// Skip the name of the directive.
+			i++
+		case t == "...":
+			fields = append(fields, fragmentSpreadField)
+			// Skip the name of the fragment, or the type condition of the inline fragment.
+			if i+1 < len(tokens) && tokens[i+1] == "on" {
+				i += 2
+			} else if i+1 < len(tokens) && isGraphQLName(tokens[i+1]) {
+				i++
+			}
+		case isGraphQLName(t):
+			// The name of an aliased field follows the alias.
+			if i+2 < len(tokens) && tokens[i+1] == ":" {
+				i += 2
+				t = tokens[i]
+			}
+			fields = append(fields, t)
+		}
+	}
+	return fields
+}
+
+// skipGraphQLSelectionSet returns the index of the token after the selection set that starts at tokens[start].
+func skipGraphQLSelectionSet(tokens []string, start int) int {
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(tokens)
+}
+
+// lexGraphQL splits the GraphQL document into its names and punctuators. Strings and numbers are replaced by
+// placeholders, since their values don't matter, and comments and insignificant characters are dropped.
+func lexGraphQL(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '#':
+			for i < len(s) && s[i] != '\n' && s[i] != '\r' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(s[i:], `"""`):
+			i += 3
+			for i < len(s) && !strings.HasPrefix(s[i:], `"""`) {
+				if strings.HasPrefix(s[i:], `\"""`) {
+					i += 4
+					continue
+				}
+				i++
+			}
+			i += 3
+			tokens = append(tokens, `""`)
+		case c == '"':
+			i++
+			for i < len(s) && s[i] != '"' && s[i] != '\n' {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+			tokens = append(tokens, `""`)
+		case strings.HasPrefix(s[i:], "..."):
+			i += 3
+			tokens = append(tokens, "...")
+		case isGraphQLNameStart(c):
+			j := i + 1
+			for j < len(s) && (isGraphQLNameStart(s[j]) || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case c == '-' || (c >= '0' && c <= '9'):
+			i++
+			for i < len(s) && (isGraphQLNameStart(s[i]) || (s[i] >= '0' && s[i] <= '9') || s[i] == '.' || s[i] == '+' || s[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, "0")
+		case c < 0x80:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			// Byte order marks, and other characters that aren't valid outside of strings and comments.
+			i++
+		}
+	}
+	return tokens
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLName(t string) bool {
+	return t != "" && isGraphQLNameStart(t[0])
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/shared/services/authcontext"
+	svcutils "px.dev/pixie/src/shared/services/utils"
+)
+
+func TestGraphQLHandler_OrgRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		role         string
+		query        string
+		expForbidden bool
+	}{
+		{
+			name:  "viewer query",
+			role:  orgrole.Viewer,
+			query: `{ __typename }`,
+		},
+		{
+			name:         "viewer mutation",
+			role:         orgrole.Viewer,
+			query:        `mutation { CreateDeploymentKey(desc: "test") { id } }`,
+			expForbidden: true,
+		},
+		{
+			name:  "viewer self service mutation",
+			role:  orgrole.Viewer,
+			query: `mutation Update { UpdateUserSettings(settings: { analyticsOptout: true }) }`,
+		},
+		{
+			name:         "viewer aliased mutation after query",
+			role:         orgrole.Viewer,
+			query:        `query { user { id } } mutation { key: CreateAPIKey(desc: "{ not a selection }") { id } }`,
+			expForbidden: true,
+		},
+		{
+			name:         "viewer fragment in mutation",
+			role:         orgrole.Viewer,
+			query:        `mutation { ...f } fragment f on MutationRoot { DeleteAPIKey(id: "test") }`,
+			expForbidden: true,
+		},
+		{
+			name:  "editor mutation",
+			role:  orgrole.Editor,
+			query: `mutation { CreateCluster(unknownArg: true) { id } }`,
+		},
+		{
+			name:         "editor credential mutation",
+			role:         orgrole.Editor,
+			query:        `mutation { CreateAPIKey(desc: "test") { id } }`,
+			expForbidden: true,
+		},
+		{
+			name:         "editor org mutation",
+			role:         orgrole.Editor,
+			query:        `mutation { UpdateOrgSettings(orgID: "test", orgSettings: { enableApprovals: true }) { id } }`,
+			expForbidden: true,
+		},
+		{
+			name:  "admin org mutation",
+			role:  orgrole.Admin,
+			query: `mutation { UpdateOrgSettings(unknownArg: true) { id } }`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gqlEnv, _, cleanup := testutils.CreateTestGraphQLEnv(t)
+			defer cleanup()
+
+			sCtx := authcontext.New()
+			sCtx.Claims = svcutils.GenerateJWTForUser("6ba7b810-9dad-11d1-80b4-00c04fd430c9", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "test@test.com", time.Now().Add(time.Hour), "pixie")
+			sCtx.Claims.Scopes = append(sCtx.Claims.Scopes, orgrole.TokenScopes([]orgrole.Binding{{Role: test.role}})...)
+			ctx := authcontext.NewContext(context.Background(), sCtx)
+
+			body, err := json.Marshal(map[string]string{"query": test.query})
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(string(body))).WithContext(ctx)
+			w := httptest.NewRecorder()
+			controllers.NewGraphQLHandler(gqlEnv).ServeHTTP(w, req)
+
+			if test.expForbidden {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+			} else {
+				assert.NotEqual(t, http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
+
+func TestGraphQLHandler_OrgRole_CredentialQueries(t *testing.T) {
+	queries := []string{
+		`{ apiKey(id: "7ba7b810-9dad-11d1-80b4-00c04fd430c8") { key } }`,
+		`{ apiKeys { id } }`,
+		`{ deploymentKey(id: "7ba7b810-9dad-11d1-80b4-00c04fd430c8") { key } }`,
+		`{ deploymentKeys { id } }`,
+	}
+
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			// The key managers aren't expected to be called.
+			gqlEnv, _, cleanup := testutils.CreateTestGraphQLEnv(t)
+			defer cleanup()
+
+			sCtx := authcontext.New()
+			sCtx.Claims = svcutils.GenerateJWTForUser("6ba7b810-9dad-11d1-80b4-00c04fd430c9", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "test@test.com", time.Now().Add(time.Hour), "pixie")
+			sCtx.Claims.Scopes = append(sCtx.Claims.Scopes, orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Viewer}})...)
+			ctx := authcontext.NewContext(context.Background(), sCtx)
+
+			body, err := json.Marshal(map[string]string{"query": query})
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(string(body))).WithContext(ctx)
+			w := httptest.NewRecorder()
+			controllers.NewGraphQLHandler(gqlEnv).ServeHTTP(w, req)
+
+			assert.Contains(t, w.Body.String(), controllers.ErrOrgRoleInsufficient.Error())
+		})
+	}
+}
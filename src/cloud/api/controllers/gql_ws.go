@@ -0,0 +1,343 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/shared/services/authcontext"
+)
+
+// This file serves GraphQL over WebSockets, using the graphql-transport-ws protocol:
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+
+const (
+	graphQLWSProtocol = "graphql-transport-ws"
+
+	wsConnectionInit = "connection_init"
+	wsConnectionAck  = "connection_ack"
+	wsPing           = "ping"
+	wsPong           = "pong"
+	wsSubscribe      = "subscribe"
+	wsNext           = "next"
+	wsError          = "error"
+	wsComplete       = "complete"
+
+	// Close codes defined by the protocol.
+	wsCloseBadRequest        = 4400
+	wsCloseUnauthorized      = 4401
+	wsCloseInitTimeout       = 4408
+	wsCloseSubscriberExists  = 4409
+	wsCloseTooManyInitialize = 4429
+
+	// wsInitTimeout is how long clients have to initialize the connection.
+	wsInitTimeout = 10 * time.Second
+	// wsWriteTimeout is how long writing a message may take.
+	wsWriteTimeout = 10 * time.Second
+	// maxSubscriptionsPerConn is how many operations a connection may run at once.
+	maxSubscriptionsPerConn = 100
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type wsSubscribePayload struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type gqlError struct {
+	Message string `json:"message"`
+}
+
+// graphQLHandler serves GraphQL queries and mutations over HTTP, and all operations, including subscriptions,
+// over WebSockets.
+type graphQLHandler struct {
+	schema   *graphql.Schema
+	http     http.Handler
+	upgrader websocket.Upgrader
+}
+
+func newGraphQLHandler(schema *graphql.Schema, httpHandler http.Handler) *graphQLHandler {
+	return &graphQLHandler{
+		schema: schema,
+		http:   httpHandler,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{graphQLWSProtocol},
+			CheckOrigin:  checkWebSocketOrigin,
+		},
+	}
+}
+
+// checkWebSocketOrigin only accepts WebSockets opened by the Pixie UI, or by clients that aren't browsers.
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return checkOrigin(u)
+}
+
+func (h *graphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		h.http.ServeHTTP(w, r)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an error.
+		return
+	}
+	if conn.Subprotocol() != graphQLWSProtocol {
+		closeWebSocket(conn, websocket.CloseProtocolError, "Subprotocol not acceptable")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	c := &wsConn{
+		conn:   conn,
+		schema: h.schema,
+		ctx:    ctx,
+		subs:   make(map[string]context.CancelFunc),
+	}
+	c.run()
+}
+
+// wsConn is a single WebSocket connection, which runs the operations the client subscribes to.
+type wsConn struct {
+	conn   *websocket.Conn
+	schema *graphql.Schema
+	ctx    context.Context
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	initialized bool
+	subs        map[string]context.CancelFunc
+}
+
+func (c *wsConn) run() {
+	defer c.conn.Close()
+
+	// The connection is closed once the credentials it was opened with expire, so that the client reconnects
+	// with fresh ones.
+	if aCtx, err := authcontext.FromContext(c.ctx); err == nil && aCtx.Claims != nil && aCtx.Claims.ExpiresAt > 0 {
+		t := time.AfterFunc(time.Until(time.Unix(aCtx.Claims.ExpiresAt, 0)), func() {
+			c.close(websocket.CloseGoingAway, "Credentials expired")
+		})
+		defer t.Stop()
+	}
+
+	if err := c.conn.SetReadDeadline(time.Now().Add(wsInitTimeout)); err != nil {
+		return
+	}
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				c.close(wsCloseInitTimeout, "Connection initialisation timeout")
+			}
+			return
+		}
+		msg := &wsMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			c.close(wsCloseBadRequest, "Invalid message received")
+			return
+		}
+		if !c.handleMessage(msg) {
+			return
+		}
+	}
+}
+
+// handleMessage handles a message from the client, and returns whether the connection is still open.
+func (c *wsConn) handleMessage(msg *wsMessage) bool {
+	switch msg.Type {
+	case wsConnectionInit:
+		c.mu.Lock()
+		initialized := c.initialized
+		c.initialized = true
+		c.mu.Unlock()
+		if initialized {
+			c.close(wsCloseTooManyInitialize, "Too many initialisation requests")
+			return false
+		}
+		if err := c.conn.SetReadDeadline(time.Time{}); err != nil {
+			return false
+		}
+		c.write(&wsMessage{Type: wsConnectionAck})
+	case wsPing:
+		c.write(&wsMessage{Type: wsPong})
+	case wsPong:
+	case wsSubscribe:
+		return c.subscribe(msg)
+	case wsComplete:
+		c.mu.Lock()
+		if cancel, ok := c.subs[msg.ID]; ok {
+			cancel()
+			delete(c.subs, msg.ID)
+		}
+		c.mu.Unlock()
+	default:
+		c.close(wsCloseBadRequest, fmt.Sprintf("Invalid message type %q", msg.Type))
+		return false
+	}
+	return true
+}
+
+func (c *wsConn) subscribe(msg *wsMessage) bool {
+	payload := &wsSubscribePayload{}
+	if msg.ID == "" || json.Unmarshal(msg.Payload, payload) != nil {
+		c.close(wsCloseBadRequest, "Invalid subscribe message")
+		return false
+	}
+
+	c.mu.Lock()
+	if !c.initialized {
+		c.mu.Unlock()
+		c.close(wsCloseUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, ok := c.subs[msg.ID]; ok {
+		c.mu.Unlock()
+		c.close(wsCloseSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+		return false
+	}
+	if len(c.subs) >= maxSubscriptionsPerConn {
+		c.mu.Unlock()
+		c.writeErrors(msg.ID, []*gqlError{{Message: "too many subscriptions on this connection"}})
+		return true
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.subs[msg.ID] = cancel
+	c.mu.Unlock()
+
+	if err := checkGraphQLOrgRole(ctx, payload.Query); err != nil {
+		c.finish(ctx, msg.ID, cancel)
+		c.writeErrors(msg.ID, []*gqlError{{Message: err.Error()}})
+		return true
+	}
+
+	responses, err := c.schema.Subscribe(ctx, payload.Query, payload.OperationName, payload.Variables)
+	if err != nil {
+		c.finish(ctx, msg.ID, cancel)
+		c.writeErrors(msg.ID, []*gqlError{{Message: err.Error()}})
+		return true
+	}
+
+	go func() {
+		failed := false
+		// The responses are drained even after the client completed the operation, so that the
+		// resolvers don't block.
+		for r := range responses {
+			resp, ok := r.(*graphql.Response)
+			if !ok || ctx.Err() != nil || failed {
+				continue
+			}
+			if resp.Data == nil && len(resp.Errors) > 0 {
+				errs := make([]*gqlError, len(resp.Errors))
+				for i, e := range resp.Errors {
+					errs[i] = &gqlError{Message: e.Message}
+				}
+				c.writeErrors(msg.ID, errs)
+				failed = true
+				continue
+			}
+			b, err := json.Marshal(resp)
+			if err != nil {
+				log.WithError(err).Error("Failed to marshal GraphQL response")
+				continue
+			}
+			c.write(&wsMessage{ID: msg.ID, Type: wsNext, Payload: b})
+		}
+		if c.finish(ctx, msg.ID, cancel) && !failed {
+			c.write(&wsMessage{ID: msg.ID, Type: wsComplete})
+		}
+	}()
+	return true
+}
+
+// finish cleans up after an operation, and returns whether the client still expects it to complete.
+func (c *wsConn) finish(ctx context.Context, id string, cancel context.CancelFunc) bool {
+	expected := ctx.Err() == nil
+	cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if expected {
+		delete(c.subs, id)
+	}
+	return expected
+}
+
+func (c *wsConn) writeErrors(id string, errs []*gqlError) {
+	b, err := json.Marshal(errs)
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal GraphQL errors")
+		return
+	}
+	c.write(&wsMessage{ID: id, Type: wsError, Payload: b})
+}
+
+func (c *wsConn) write(msg *wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return
+	}
+	if err := c.conn.WriteJSON(msg); err != nil {
+		log.WithError(err).Trace("Failed to write to GraphQL WebSocket")
+	}
+}
+
+func (c *wsConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	closeWebSocket(c.conn, code, reason)
+}
+
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout)); err != nil {
+		log.WithError(err).Trace("Failed to close GraphQL WebSocket")
+	}
+	conn.Close()
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+	"px.dev/pixie/src/shared/services/authcontext"
+	svcutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func dialGraphQLWS(t *testing.T, gqlEnv controllers.GraphQLEnv) *websocket.Conn {
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForUser("6ba7b810-9dad-11d1-80b4-00c04fd430c9", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "test@test.com", time.Now().Add(time.Hour), "pixie")
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+
+	handler := controllers.NewGraphQLHandler(gqlEnv)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(s.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	assert.Equal(t, "graphql-transport-ws", conn.Subprotocol())
+	return conn
+}
+
+func readWSMessage(t *testing.T, conn *websocket.Conn) *wsMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	msg := &wsMessage{}
+	require.NoError(t, conn.ReadJSON(msg))
+	return msg
+}
+
+func TestGraphQLWebSocket_Subscription(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	gqlEnv.ClusterPollInterval = time.Millisecond
+
+	mockClients.MockVizierClusterInfo.EXPECT().
+		GetClusterInfo(gomock.Any(), &cloudpb.GetClusterInfoRequest{ID: utils.ProtoFromUUIDStrOrNil(testClusterID)}).
+		Return(clusterWithStatus(cloudpb.CS_HEALTHY, 1), nil).AnyTimes()
+
+	conn := dialGraphQLWS(t, gqlEnv)
+	require.NoError(t, conn.WriteJSON(&wsMessage{Type: "connection_init"}))
+	assert.Equal(t, "connection_ack", readWSMessage(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(&wsMessage{Type: "ping"}))
+	assert.Equal(t, "pong", readWSMessage(t, conn).Type)
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":     `subscription ($id: ID!) { clusterStatus(id: $id) { status } }`,
+		"variables": map[string]interface{}{"id": testClusterID},
+	})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteJSON(&wsMessage{ID: "1", Type: "subscribe", Payload: payload}))
+
+	msg := readWSMessage(t, conn)
+	assert.Equal(t, "1", msg.ID)
+	assert.Equal(t, "next", msg.Type)
+	assert.JSONEq(t, `{"data":{"clusterStatus":{"status":"CS_HEALTHY"}}}`, string(msg.Payload))
+
+	// Queries run over the WebSocket too, and complete after their single result.
+	payload, err = json.Marshal(map[string]interface{}{"query": `query { noop }`})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteJSON(&wsMessage{ID: "2", Type: "subscribe", Payload: payload}))
+	msg = readWSMessage(t, conn)
+	assert.Equal(t, "2", msg.ID)
+	assert.Equal(t, "next", msg.Type)
+	assert.JSONEq(t, `{"data":{"noop":true}}`, string(msg.Payload))
+	msg = readWSMessage(t, conn)
+	assert.Equal(t, "2", msg.ID)
+	assert.Equal(t, "complete", msg.Type)
+
+	// Invalid operations fail with an error.
+	payload, err = json.Marshal(map[string]interface{}{"query": `subscription { unknown }`})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteJSON(&wsMessage{ID: "3", Type: "subscribe", Payload: payload}))
+	msg = readWSMessage(t, conn)
+	assert.Equal(t, "3", msg.ID)
+	assert.Equal(t, "error", msg.Type)
+
+	require.NoError(t, conn.WriteJSON(&wsMessage{ID: "1", Type: "complete"}))
+}
+
+func TestGraphQLWebSocket_SubscribeBeforeInit(t *testing.T) {
+	gqlEnv, _, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+
+	conn := dialGraphQLWS(t, gqlEnv)
+	payload, err := json.Marshal(map[string]interface{}{"query": `query { noop }`})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteJSON(&wsMessage{ID: "1", Type: "subscribe", Payload: payload}))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = conn.ReadMessage()
+	require.Error(t, err)
+	assert.True(t, websocket.IsCloseError(err, 4401))
+}
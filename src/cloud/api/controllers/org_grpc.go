@@ -31,6 +31,7 @@ import (
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/auth/authpb"
 	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/orgrole"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/events"
 	"px.dev/pixie/src/utils"
@@ -104,6 +105,7 @@ func (o *OrganizationServiceServer) GetOrg(ctx context.Context, req *uuidpb.UUID
 		OrgName:         resp.OrgName,
 		DomainName:      resp.DomainName.GetValue(),
 		EnableApprovals: resp.EnableApprovals,
+		DataResidency:   resp.DataResidency,
 	}, nil
 }
 
@@ -170,6 +172,7 @@ func (o *OrganizationServiceServer) UpdateOrg(ctx context.Context, req *cloudpb.
 	resp, err := o.OrgServiceClient.UpdateOrg(ctx, &profilepb.UpdateOrgRequest{
 		ID:              req.ID,
 		EnableApprovals: req.EnableApprovals,
+		DataResidency:   req.DataResidency,
 	})
 	if err != nil {
 		return nil, err
@@ -180,6 +183,7 @@ func (o *OrganizationServiceServer) UpdateOrg(ctx context.Context, req *cloudpb.
 		OrgName:         resp.OrgName,
 		DomainName:      resp.DomainName.GetValue(),
 		EnableApprovals: resp.EnableApprovals,
+		DataResidency:   resp.DataResidency,
 	}, nil
 }
 
@@ -246,6 +250,14 @@ func (o *OrganizationServiceServer) RemoveUserFromOrg(ctx context.Context, req *
 		return nil, status.Errorf(codes.PermissionDenied, "User may only remove users from their own org")
 	}
 
+	if req.DryRun {
+		return &cloudpb.RemoveUserFromOrgResponse{
+			AffectedResources: []*cloudpb.AffectedResource{
+				affectedResource(affectedKindUser, userInfo.ID, userInfo.Email, affectedActionRemoveFromOrg),
+			},
+		}, nil
+	}
+
 	_, err = o.ProfileServiceClient.UpdateUser(ctx, &profilepb.UpdateUserRequest{
 		ID:    req.UserID,
 		OrgID: &uuidpb.UUID{},
@@ -257,6 +269,32 @@ func (o *OrganizationServiceServer) RemoveUserFromOrg(ctx context.Context, req *
 	return &cloudpb.RemoveUserFromOrgResponse{Success: true}, nil
 }
 
+// DeactivateUser deactivates the given user of this org and transfers their resources to another user.
+func (o *OrganizationServiceServer) DeactivateUser(ctx context.Context, req *cloudpb.DeactivateUserRequest) (*cloudpb.DeactivateUserResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The profile service checks that the caller is an admin of the org of the user, and that the new
+	// owner belongs to the same org.
+	resp, err := o.ProfileServiceClient.DeactivateUser(ctx, &profilepb.DeactivateUserRequest{
+		UserID:     req.UserID,
+		NewOwnerID: req.NewOwnerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudpb.DeactivateUserResponse{
+		NewOwnerID:       resp.NewOwnerID,
+		NumAPIKeys:       resp.NumAPIKeys,
+		NumCronScripts:   resp.NumCronScripts,
+		NumSavedQueries:  resp.NumSavedQueries,
+		NumTokensRevoked: resp.NumTokensRevoked,
+	}, nil
+}
+
 // AddOrgIDEConfig adds the IDE config for the given org.
 func (o *OrganizationServiceServer) AddOrgIDEConfig(ctx context.Context, req *cloudpb.AddOrgIDEConfigRequest) (*cloudpb.AddOrgIDEConfigResponse, error) {
 	ctx, err := contextWithAuthToken(ctx)
@@ -406,3 +444,345 @@ func (o *OrganizationServiceServer) VerifyInviteToken(ctx context.Context, req *
 	}
 	return &cloudpb.VerifyInviteTokenResponse{Valid: resp.Valid}, nil
 }
+
+func orgSAMLConfigFromAuthPb(cfg *authpb.OrgSAMLConfig) *cloudpb.OrgSAMLConfig {
+	resp := &cloudpb.OrgSAMLConfig{
+		OrgID:              cfg.OrgID,
+		Enabled:            cfg.Enabled,
+		IdPEntityID:        cfg.IdPEntityID,
+		IdPSSOURL:          cfg.IdPSSOURL,
+		IdPCertificate:     cfg.IdPCertificate,
+		EmailAttribute:     cfg.EmailAttribute,
+		FirstNameAttribute: cfg.FirstNameAttribute,
+		LastNameAttribute:  cfg.LastNameAttribute,
+		GroupsAttribute:    cfg.GroupsAttribute,
+		GroupRoles:         make([]*cloudpb.OrgSAMLConfig_GroupRoleMapping, len(cfg.GroupRoles)),
+		DefaultRole:        cloudpb.SAMLOrgRole(cfg.DefaultRole),
+		UpdatedAt:          cfg.UpdatedAt,
+		UpdatedBy:          cfg.UpdatedBy,
+	}
+	for i, gr := range cfg.GroupRoles {
+		resp.GroupRoles[i] = &cloudpb.OrgSAMLConfig_GroupRoleMapping{Group: gr.Group, Role: cloudpb.SAMLOrgRole(gr.Role)}
+	}
+	return resp
+}
+
+// GetOrgSAMLConfig gets the SAML identity provider config of the given org.
+func (o *OrganizationServiceServer) GetOrgSAMLConfig(ctx context.Context, req *cloudpb.GetOrgSAMLConfigRequest) (*cloudpb.OrgSAMLConfig, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not get SAML config for org")
+	}
+
+	resp, err := o.AuthServiceClient.GetOrgSAMLConfig(ctx, &authpb.GetOrgSAMLConfigRequest{OrgID: req.OrgID})
+	if err != nil {
+		return nil, err
+	}
+	return orgSAMLConfigFromAuthPb(resp), nil
+}
+
+// UpdateOrgSAMLConfig creates or replaces the SAML identity provider config of the given org.
+func (o *OrganizationServiceServer) UpdateOrgSAMLConfig(ctx context.Context, req *cloudpb.OrgSAMLConfig) (*cloudpb.OrgSAMLConfig, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not update SAML config for org")
+	}
+	// The config decides who can log in to the org and with which roles, so only admins may change it.
+	if !orgrole.IsAdmin(sCtx.Claims.Scopes) {
+		return nil, status.Error(codes.PermissionDenied, "only admins of the org may update its SAML config")
+	}
+
+	authReq := &authpb.OrgSAMLConfig{
+		OrgID:              req.OrgID,
+		Enabled:            req.Enabled,
+		IdPEntityID:        req.IdPEntityID,
+		IdPSSOURL:          req.IdPSSOURL,
+		IdPCertificate:     req.IdPCertificate,
+		EmailAttribute:     req.EmailAttribute,
+		FirstNameAttribute: req.FirstNameAttribute,
+		LastNameAttribute:  req.LastNameAttribute,
+		GroupsAttribute:    req.GroupsAttribute,
+		GroupRoles:         make([]*authpb.OrgSAMLConfig_GroupRoleMapping, len(req.GroupRoles)),
+		DefaultRole:        authpb.SAMLOrgRole(req.DefaultRole),
+	}
+	for i, gr := range req.GroupRoles {
+		authReq.GroupRoles[i] = &authpb.OrgSAMLConfig_GroupRoleMapping{Group: gr.Group, Role: authpb.SAMLOrgRole(gr.Role)}
+	}
+	resp, err := o.AuthServiceClient.UpdateOrgSAMLConfig(ctx, authReq)
+	if err != nil {
+		return nil, err
+	}
+	return orgSAMLConfigFromAuthPb(resp), nil
+}
+
+// DeleteOrgSAMLConfig deletes the SAML identity provider config of the given org.
+func (o *OrganizationServiceServer) DeleteOrgSAMLConfig(ctx context.Context, req *cloudpb.DeleteOrgSAMLConfigRequest) (*types.Empty, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not delete SAML config for org")
+	}
+	if !orgrole.IsAdmin(sCtx.Claims.Scopes) {
+		return nil, status.Error(codes.PermissionDenied, "only admins of the org may delete its SAML config")
+	}
+
+	return o.AuthServiceClient.DeleteOrgSAMLConfig(ctx, &authpb.DeleteOrgSAMLConfigRequest{OrgID: req.OrgID})
+}
+
+func orgBrandingFromProfilePb(b *profilepb.OrgBranding) *cloudpb.OrgBranding {
+	return &cloudpb.OrgBranding{
+		OrgID:       b.OrgID,
+		ProductName: b.ProductName,
+		LogoURL:     b.LogoURL,
+	}
+}
+
+func emailTemplateFromProfilePb(t *profilepb.EmailTemplate) *cloudpb.EmailTemplate {
+	return &cloudpb.EmailTemplate{
+		Name:      t.Name,
+		Subject:   t.Subject,
+		Body:      t.Body,
+		IsDefault: t.IsDefault,
+	}
+}
+
+// GetOrgBranding gets the branding of the given org.
+func (o *OrganizationServiceServer) GetOrgBranding(ctx context.Context, req *cloudpb.GetOrgBrandingRequest) (*cloudpb.OrgBranding, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not get branding for org")
+	}
+
+	resp, err := o.OrgServiceClient.GetOrgBranding(ctx, &profilepb.GetOrgBrandingRequest{OrgID: req.OrgID})
+	if err != nil {
+		return nil, err
+	}
+	return orgBrandingFromProfilePb(resp), nil
+}
+
+// UpdateOrgBranding updates the branding of the given org.
+func (o *OrganizationServiceServer) UpdateOrgBranding(ctx context.Context, req *cloudpb.UpdateOrgBrandingRequest) (*cloudpb.OrgBranding, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not update branding for org")
+	}
+
+	resp, err := o.OrgServiceClient.UpdateOrgBranding(ctx, &profilepb.UpdateOrgBrandingRequest{
+		OrgID:       req.OrgID,
+		ProductName: req.ProductName,
+		LogoURL:     req.LogoURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orgBrandingFromProfilePb(resp), nil
+}
+
+// GetOrgEmailTemplates gets the email templates of the given org.
+func (o *OrganizationServiceServer) GetOrgEmailTemplates(ctx context.Context, req *cloudpb.GetOrgEmailTemplatesRequest) (*cloudpb.GetOrgEmailTemplatesResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not get email templates for org")
+	}
+
+	resp, err := o.OrgServiceClient.GetOrgEmailTemplates(ctx, &profilepb.GetOrgEmailTemplatesRequest{OrgID: req.OrgID})
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]*cloudpb.EmailTemplate, len(resp.Templates))
+	for i, t := range resp.Templates {
+		templates[i] = emailTemplateFromProfilePb(t)
+	}
+	return &cloudpb.GetOrgEmailTemplatesResponse{Templates: templates}, nil
+}
+
+// SetOrgEmailTemplate creates or replaces a custom email template of the given org.
+func (o *OrganizationServiceServer) SetOrgEmailTemplate(ctx context.Context, req *cloudpb.SetOrgEmailTemplateRequest) (*cloudpb.EmailTemplate, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not set email template for org")
+	}
+	if req.Template == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "missing template")
+	}
+
+	resp, err := o.OrgServiceClient.SetOrgEmailTemplate(ctx, &profilepb.SetOrgEmailTemplateRequest{
+		OrgID: req.OrgID,
+		Template: &profilepb.EmailTemplate{
+			Name:    req.Template.Name,
+			Subject: req.Template.Subject,
+			Body:    req.Template.Body,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return emailTemplateFromProfilePb(resp), nil
+}
+
+// DeleteOrgEmailTemplate deletes a custom email template of the given org.
+func (o *OrganizationServiceServer) DeleteOrgEmailTemplate(ctx context.Context, req *cloudpb.DeleteOrgEmailTemplateRequest) (*types.Empty, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not delete email template for org")
+	}
+
+	return o.OrgServiceClient.DeleteOrgEmailTemplate(ctx, &profilepb.DeleteOrgEmailTemplateRequest{
+		OrgID: req.OrgID,
+		Name:  req.Name,
+	})
+}
+
+func scriptArgPolicyFromProfilePb(p *profilepb.ScriptArgPolicy) *cloudpb.ScriptArgPolicy {
+	return &cloudpb.ScriptArgPolicy{
+		ArgName:         p.ArgName,
+		DefaultValue:    p.DefaultValue,
+		MaxLookbackNS:   p.MaxLookbackNS,
+		ForbiddenValues: p.ForbiddenValues,
+	}
+}
+
+// GetOrgScriptArgPolicies gets the script argument policies of the given org.
+func (o *OrganizationServiceServer) GetOrgScriptArgPolicies(ctx context.Context, req *cloudpb.GetOrgScriptArgPoliciesRequest) (*cloudpb.GetOrgScriptArgPoliciesResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not get script argument policies for org")
+	}
+
+	resp, err := o.OrgServiceClient.GetOrgScriptArgPolicies(ctx, &profilepb.GetOrgScriptArgPoliciesRequest{OrgID: req.OrgID})
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]*cloudpb.ScriptArgPolicy, len(resp.Policies))
+	for i, p := range resp.Policies {
+		policies[i] = scriptArgPolicyFromProfilePb(p)
+	}
+	return &cloudpb.GetOrgScriptArgPoliciesResponse{Policies: policies}, nil
+}
+
+// SetOrgScriptArgPolicy creates or replaces the given org's policy for a script argument.
+func (o *OrganizationServiceServer) SetOrgScriptArgPolicy(ctx context.Context, req *cloudpb.SetOrgScriptArgPolicyRequest) (*cloudpb.ScriptArgPolicy, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not set script argument policy for org")
+	}
+	if req.Policy == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "missing policy")
+	}
+
+	resp, err := o.OrgServiceClient.SetOrgScriptArgPolicy(ctx, &profilepb.SetOrgScriptArgPolicyRequest{
+		OrgID: req.OrgID,
+		Policy: &profilepb.ScriptArgPolicy{
+			ArgName:         req.Policy.ArgName,
+			DefaultValue:    req.Policy.DefaultValue,
+			MaxLookbackNS:   req.Policy.MaxLookbackNS,
+			ForbiddenValues: req.Policy.ForbiddenValues,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scriptArgPolicyFromProfilePb(resp), nil
+}
+
+// DeleteOrgScriptArgPolicy deletes the given org's policy for a script argument.
+func (o *OrganizationServiceServer) DeleteOrgScriptArgPolicy(ctx context.Context, req *cloudpb.DeleteOrgScriptArgPolicyRequest) (*types.Empty, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != utils.UUIDFromProtoOrNil(req.OrgID) {
+		return nil, status.Errorf(codes.PermissionDenied, "Could not delete script argument policy for org")
+	}
+
+	return o.OrgServiceClient.DeleteOrgScriptArgPolicy(ctx, &profilepb.DeleteOrgScriptArgPolicyRequest{
+		OrgID:   req.OrgID,
+		ArgName: req.ArgName,
+	})
+}
@@ -171,6 +171,22 @@ func (u *OrgInfoResolver) IDEPaths() []IDEPathResolver {
 	return configResolvers
 }
 
+// OrgBrandingResolver resolves the branding of an org.
+type OrgBrandingResolver struct {
+	ProductName string
+	LogoURL     string
+}
+
+// Branding returns the branding of the org, which is shown in the UI and in emails. Empty fields use the
+// Pixie defaults.
+func (u *OrgInfoResolver) Branding() *OrgBrandingResolver {
+	resp, err := u.gqlEnv.OrgServer.GetOrgBranding(u.ctx, &cloudpb.GetOrgBrandingRequest{OrgID: u.OrgInfo.ID})
+	if err != nil {
+		return &OrgBrandingResolver{}
+	}
+	return &OrgBrandingResolver{ProductName: resp.ProductName, LogoURL: resp.LogoURL}
+}
+
 // Org resolves org information.
 func (q *QueryResolver) Org(ctx context.Context) (*OrgInfoResolver, error) {
 	sCtx, err := authcontext.FromContext(ctx)
@@ -226,6 +242,35 @@ func (q *QueryResolver) UpdateOrgSettings(ctx context.Context, args updateOrgSet
 	return &OrgInfoResolver{ctx, orgInfo, &q.Env}, nil
 }
 
+type updateOrgBrandingArgs struct {
+	OrgID    graphql.ID
+	Branding editableOrgBranding
+}
+
+type editableOrgBranding struct {
+	ProductName *string
+	LogoURL     *string
+}
+
+// UpdateOrgBranding updates the branding of the given org.
+func (q *QueryResolver) UpdateOrgBranding(ctx context.Context, args updateOrgBrandingArgs) (*OrgBrandingResolver, error) {
+	req := &cloudpb.UpdateOrgBrandingRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(string(args.OrgID)),
+	}
+	if args.Branding.ProductName != nil {
+		req.ProductName = &types.StringValue{Value: *args.Branding.ProductName}
+	}
+	if args.Branding.LogoURL != nil {
+		req.LogoURL = &types.StringValue{Value: *args.Branding.LogoURL}
+	}
+
+	resp, err := q.Env.OrgServer.UpdateOrgBranding(ctx, req)
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+	return &OrgBrandingResolver{ProductName: resp.ProductName, LogoURL: resp.LogoURL}, nil
+}
+
 type createInviteTokenArgs struct {
 	OrgID graphql.ID
 }
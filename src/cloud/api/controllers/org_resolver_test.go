@@ -573,3 +573,42 @@ func TestOrgSettingsResolver_RemoveUserFromOrg(t *testing.T) {
 		})
 	}
 }
+
+func TestOrgSettingsResolver_UpdateOrgBranding(t *testing.T) {
+	gqlEnv, mockClients, cleanup := gqltestutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	mockClients.MockOrg.EXPECT().UpdateOrgBranding(gomock.Any(), &cloudpb.UpdateOrgBrandingRequest{
+		OrgID:   utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		LogoURL: &types.StringValue{Value: "https://acme.com/logo.png"},
+	}).Return(&cloudpb.OrgBranding{
+		OrgID:       utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		ProductName: "Acme Observability",
+		LogoURL:     "https://acme.com/logo.png",
+	}, nil)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:  gqlSchema,
+			Context: ctx,
+			Query: `
+				mutation {
+					UpdateOrgBranding(orgID: "` + testingutils.TestOrgID + `", branding: { logoURL: "https://acme.com/logo.png" }) {
+						productName
+						logoURL
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"UpdateOrgBranding": {
+						"productName": "Acme Observability",
+						"logoURL": "https://acme.com/logo.png"
+					}
+				}
+			`,
+		},
+	})
+}
@@ -21,6 +21,7 @@ package controllers_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
@@ -36,6 +37,9 @@ import (
 	"px.dev/pixie/src/cloud/api/controllers/testutils"
 	"px.dev/pixie/src/cloud/auth/authpb"
 	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/shared/services/authcontext"
+	svcutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
 )
 
@@ -191,6 +195,38 @@ func TestOrganizationServiceServer_RemoveUserFromOrg(t *testing.T) {
 	assert.Equal(t, &cloudpb.RemoveUserFromOrgResponse{Success: true}, resp)
 }
 
+func TestOrganizationServiceServer_RemoveUserFromOrg_DryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	userID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd43000")
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	mockClients.MockProfile.EXPECT().GetUser(gomock.Any(), userID).Return(&profilepb.UserInfo{
+		ID:    userID,
+		OrgID: orgID,
+		Email: "bob@test.com",
+	}, nil)
+
+	resp, err := os.RemoveUserFromOrg(ctx, &cloudpb.RemoveUserFromOrgRequest{
+		UserID: userID,
+		DryRun: true,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.RemoveUserFromOrgResponse{
+		AffectedResources: []*cloudpb.AffectedResource{
+			{Kind: "user", ID: userID, Name: "bob@test.com", Action: "remove_from_org"},
+		},
+	}, resp)
+}
+
 func TestOrganizationServiceServer_RemoveUserFromOrg_UserNotInOrg(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -218,6 +254,45 @@ func TestOrganizationServiceServer_RemoveUserFromOrg_UserNotInOrg(t *testing.T)
 	assert.Equal(t, "User may only remove users from their own org", status.Convert(err).Message())
 }
 
+func TestOrganizationServiceServer_DeactivateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	userID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd43000")
+	newOwnerID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd43001")
+
+	mockClients.MockProfile.EXPECT().DeactivateUser(gomock.Any(), &profilepb.DeactivateUserRequest{
+		UserID:     userID,
+		NewOwnerID: newOwnerID,
+	}).Return(&profilepb.DeactivateUserResponse{
+		NewOwnerID:       newOwnerID,
+		NumAPIKeys:       2,
+		NumCronScripts:   1,
+		NumSavedQueries:  3,
+		NumTokensRevoked: 1,
+	}, nil)
+
+	resp, err := os.DeactivateUser(ctx, &cloudpb.DeactivateUserRequest{
+		UserID:     userID,
+		NewOwnerID: newOwnerID,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.DeactivateUserResponse{
+		NewOwnerID:       newOwnerID,
+		NumAPIKeys:       2,
+		NumCronScripts:   1,
+		NumSavedQueries:  3,
+		NumTokensRevoked: 1,
+	}, resp)
+}
+
 func TestOrganizationServiceServer_AddOrgIDEConfig(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -322,6 +397,42 @@ func (*fakeOrg) GetOrgIDEConfigs(ctx context.Context, _ *profilepb.GetOrgIDEConf
 	return &profilepb.GetOrgIDEConfigsResponse{}, nil
 }
 
+func (*fakeOrg) GetOrgBranding(ctx context.Context, _ *profilepb.GetOrgBrandingRequest, _ ...grpc.CallOption) (*profilepb.OrgBranding, error) {
+	return &profilepb.OrgBranding{}, nil
+}
+
+func (*fakeOrg) UpdateOrgBranding(ctx context.Context, _ *profilepb.UpdateOrgBrandingRequest, _ ...grpc.CallOption) (*profilepb.OrgBranding, error) {
+	return &profilepb.OrgBranding{}, nil
+}
+
+func (*fakeOrg) GetOrgEmailTemplates(ctx context.Context, _ *profilepb.GetOrgEmailTemplatesRequest, _ ...grpc.CallOption) (*profilepb.GetOrgEmailTemplatesResponse, error) {
+	return &profilepb.GetOrgEmailTemplatesResponse{}, nil
+}
+
+func (*fakeOrg) SetOrgEmailTemplate(ctx context.Context, _ *profilepb.SetOrgEmailTemplateRequest, _ ...grpc.CallOption) (*profilepb.EmailTemplate, error) {
+	return &profilepb.EmailTemplate{}, nil
+}
+
+func (*fakeOrg) DeleteOrgEmailTemplate(ctx context.Context, _ *profilepb.DeleteOrgEmailTemplateRequest, _ ...grpc.CallOption) (*types.Empty, error) {
+	return &types.Empty{}, nil
+}
+
+func (*fakeOrg) GetOrgScriptArgPolicies(ctx context.Context, _ *profilepb.GetOrgScriptArgPoliciesRequest, _ ...grpc.CallOption) (*profilepb.GetOrgScriptArgPoliciesResponse, error) {
+	return &profilepb.GetOrgScriptArgPoliciesResponse{}, nil
+}
+
+func (*fakeOrg) SetOrgScriptArgPolicy(ctx context.Context, _ *profilepb.SetOrgScriptArgPolicyRequest, _ ...grpc.CallOption) (*profilepb.ScriptArgPolicy, error) {
+	return &profilepb.ScriptArgPolicy{}, nil
+}
+
+func (*fakeOrg) DeleteOrgScriptArgPolicy(ctx context.Context, _ *profilepb.DeleteOrgScriptArgPolicyRequest, _ ...grpc.CallOption) (*types.Empty, error) {
+	return &types.Empty{}, nil
+}
+
+func (*fakeOrg) RenderOrgEmail(ctx context.Context, _ *profilepb.RenderOrgEmailRequest, _ ...grpc.CallOption) (*profilepb.RenderOrgEmailResponse, error) {
+	return &profilepb.RenderOrgEmailResponse{}, nil
+}
+
 func (*fakeOrg) CreateInviteToken(ctx context.Context, _ *profilepb.CreateInviteTokenRequest, _ ...grpc.CallOption) (*profilepb.InviteToken, error) {
 	return &profilepb.InviteToken{}, nil
 }
@@ -334,6 +445,42 @@ func (*fakeOrg) VerifyInviteToken(ctx context.Context, _ *profilepb.InviteToken,
 	return &profilepb.VerifyInviteTokenResponse{}, nil
 }
 
+func (*fakeOrg) CreateGroup(ctx context.Context, _ *profilepb.CreateGroupRequest, _ ...grpc.CallOption) (*profilepb.GroupInfo, error) {
+	return &profilepb.GroupInfo{}, nil
+}
+
+func (*fakeOrg) GetGroup(ctx context.Context, _ *uuidpb.UUID, _ ...grpc.CallOption) (*profilepb.GroupInfo, error) {
+	return &profilepb.GroupInfo{}, nil
+}
+
+func (*fakeOrg) GetGroupsInOrg(ctx context.Context, _ *profilepb.GetGroupsInOrgRequest, _ ...grpc.CallOption) (*profilepb.GetGroupsInOrgResponse, error) {
+	return &profilepb.GetGroupsInOrgResponse{}, nil
+}
+
+func (*fakeOrg) UpdateGroup(ctx context.Context, _ *profilepb.UpdateGroupRequest, _ ...grpc.CallOption) (*profilepb.GroupInfo, error) {
+	return &profilepb.GroupInfo{}, nil
+}
+
+func (*fakeOrg) DeleteGroup(ctx context.Context, _ *uuidpb.UUID, _ ...grpc.CallOption) (*types.Empty, error) {
+	return &types.Empty{}, nil
+}
+
+func (*fakeOrg) GetUserRoles(ctx context.Context, _ *profilepb.GetUserRolesRequest, _ ...grpc.CallOption) (*profilepb.UserRoles, error) {
+	return &profilepb.UserRoles{}, nil
+}
+
+func (*fakeOrg) SetUserRoles(ctx context.Context, _ *profilepb.SetUserRolesRequest, _ ...grpc.CallOption) (*profilepb.UserRoles, error) {
+	return &profilepb.UserRoles{}, nil
+}
+
+func (*fakeOrg) GetOrgRoles(ctx context.Context, _ *profilepb.GetOrgRolesRequest, _ ...grpc.CallOption) (*profilepb.GetOrgRolesResponse, error) {
+	return &profilepb.GetOrgRolesResponse{}, nil
+}
+
+func (*fakeOrg) SetOrgDefaultRole(ctx context.Context, _ *profilepb.SetOrgDefaultRoleRequest, _ ...grpc.CallOption) (*types.Empty, error) {
+	return &types.Empty{}, nil
+}
+
 func TestOrganizationServiceServer_CorrectOrgPermissions(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -471,3 +618,185 @@ func TestOrganizationServiceServer_GetOrgIDEConfigs(t *testing.T) {
 		},
 	}, resp.Configs)
 }
+
+func TestOrganizationServiceServer_UpdateOrgSAMLConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateAPIUserTestContext()
+
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	authCfg := &authpb.OrgSAMLConfig{
+		OrgID:           orgID,
+		Enabled:         true,
+		IdPEntityID:     "http://www.okta.com/exk123",
+		IdPSSOURL:       "https://corp.okta.com/app/exk123/sso/saml",
+		IdPCertificate:  "cert",
+		GroupsAttribute: "groups",
+		GroupRoles: []*authpb.OrgSAMLConfig_GroupRoleMapping{
+			{Group: "eng", Role: authpb.SAML_ORG_ROLE_MEMBER},
+		},
+		DefaultRole: authpb.SAML_ORG_ROLE_PENDING_APPROVAL,
+	}
+	mockClients.MockAuth.EXPECT().UpdateOrgSAMLConfig(gomock.Any(), authCfg).Return(authCfg, nil)
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	resp, err := os.UpdateOrgSAMLConfig(ctx, &cloudpb.OrgSAMLConfig{
+		OrgID:           orgID,
+		Enabled:         true,
+		IdPEntityID:     "http://www.okta.com/exk123",
+		IdPSSOURL:       "https://corp.okta.com/app/exk123/sso/saml",
+		IdPCertificate:  "cert",
+		GroupsAttribute: "groups",
+		GroupRoles: []*cloudpb.OrgSAMLConfig_GroupRoleMapping{
+			{Group: "eng", Role: cloudpb.SAML_ORG_ROLE_MEMBER},
+		},
+		DefaultRole: cloudpb.SAML_ORG_ROLE_PENDING_APPROVAL,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, cloudpb.SAML_ORG_ROLE_PENDING_APPROVAL, resp.DefaultRole)
+	require.Len(t, resp.GroupRoles, 1)
+	assert.Equal(t, cloudpb.SAML_ORG_ROLE_MEMBER, resp.GroupRoles[0].Role)
+}
+
+func TestOrganizationServiceServer_UpdateOrgSAMLConfig_NotAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// No SAML config is expected to be updated.
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForUser("6ba7b810-9dad-11d1-80b4-00c04fd430c9", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "test@test.com", time.Now(), "pixie")
+	sCtx.Claims.Scopes = append(sCtx.Claims.Scopes, orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Editor}})...)
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	_, err := os.UpdateOrgSAMLConfig(ctx, &cloudpb.OrgSAMLConfig{
+		OrgID:       utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Enabled:     true,
+		IdPEntityID: "http://www.okta.com/exk123",
+		DefaultRole: cloudpb.SAML_ORG_ROLE_MEMBER,
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestOrganizationServiceServer_GetOrgSAMLConfig_OtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateAPIUserTestContext()
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	_, err := os.GetOrgSAMLConfig(ctx, &cloudpb.GetOrgSAMLConfigRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestOrganizationServiceServer_UpdateOrgBranding(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateAPIUserTestContext()
+
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	mockClients.MockOrg.EXPECT().UpdateOrgBranding(gomock.Any(), &profilepb.UpdateOrgBrandingRequest{
+		OrgID:       orgID,
+		ProductName: &types.StringValue{Value: "Acme Observability"},
+	}).Return(&profilepb.OrgBranding{
+		OrgID:       orgID,
+		ProductName: "Acme Observability",
+		LogoURL:     "https://acme.com/logo.png",
+	}, nil)
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	resp, err := os.UpdateOrgBranding(ctx, &cloudpb.UpdateOrgBrandingRequest{
+		OrgID:       orgID,
+		ProductName: &types.StringValue{Value: "Acme Observability"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.OrgBranding{
+		OrgID:       orgID,
+		ProductName: "Acme Observability",
+		LogoURL:     "https://acme.com/logo.png",
+	}, resp)
+}
+
+func TestOrganizationServiceServer_SetOrgEmailTemplate_OtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateAPIUserTestContext()
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	_, err := os.SetOrgEmailTemplate(ctx, &cloudpb.SetOrgEmailTemplateRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		Template: &cloudpb.EmailTemplate{Name: "invite", Subject: "a", Body: "b"},
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestOrganizationServiceServer_SetOrgScriptArgPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateAPIUserTestContext()
+
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	policy := &profilepb.ScriptArgPolicy{
+		ArgName:         "namespace",
+		ForbiddenValues: []string{"kube-system"},
+	}
+	mockClients.MockOrg.EXPECT().SetOrgScriptArgPolicy(gomock.Any(), &profilepb.SetOrgScriptArgPolicyRequest{
+		OrgID:  orgID,
+		Policy: policy,
+	}).Return(policy, nil)
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	resp, err := os.SetOrgScriptArgPolicy(ctx, &cloudpb.SetOrgScriptArgPolicyRequest{
+		OrgID: orgID,
+		Policy: &cloudpb.ScriptArgPolicy{
+			ArgName:         "namespace",
+			ForbiddenValues: []string{"kube-system"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.ScriptArgPolicy{
+		ArgName:         "namespace",
+		ForbiddenValues: []string{"kube-system"},
+	}, resp)
+}
+
+func TestOrganizationServiceServer_GetOrgScriptArgPolicies_OtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateAPIUserTestContext()
+
+	os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+
+	_, err := os.GetOrgScriptArgPolicies(ctx, &cloudpb.GetOrgScriptArgPoliciesRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/gogo/protobuf/types"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/auth/authpb"
+)
+
+// PersonalAccessTokenServer is the server that implements the PersonalAccessTokenManager gRPC service.
+type PersonalAccessTokenServer struct {
+	PersonalAccessTokenClient authpb.PersonalAccessTokenServiceClient
+}
+
+func personalAccessTokenToCloudAPI(t *authpb.PersonalAccessToken) *cloudpb.PersonalAccessToken {
+	return &cloudpb.PersonalAccessToken{
+		ID:         t.ID,
+		Token:      t.Token,
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+	}
+}
+
+// Create creates a new personal access token for the user.
+func (p *PersonalAccessTokenServer) Create(ctx context.Context, req *cloudpb.CreatePersonalAccessTokenRequest) (*cloudpb.PersonalAccessToken, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.PersonalAccessTokenClient.Create(ctx, &authpb.CreatePersonalAccessTokenRequest{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return personalAccessTokenToCloudAPI(resp), nil
+}
+
+// List lists the personal access tokens of the user.
+func (p *PersonalAccessTokenServer) List(ctx context.Context, req *cloudpb.ListPersonalAccessTokensRequest) (*cloudpb.ListPersonalAccessTokensResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.PersonalAccessTokenClient.List(ctx, &authpb.ListPersonalAccessTokensRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*cloudpb.PersonalAccessToken
+	for _, t := range resp.Tokens {
+		tokens = append(tokens, personalAccessTokenToCloudAPI(t))
+	}
+	return &cloudpb.ListPersonalAccessTokensResponse{
+		Tokens: tokens,
+	}, nil
+}
+
+// Delete deletes a personal access token of the user.
+func (p *PersonalAccessTokenServer) Delete(ctx context.Context, id *uuidpb.UUID) (*types.Empty, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.PersonalAccessTokenClient.Delete(ctx, id)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	mock_auth "px.dev/pixie/src/cloud/auth/authpb/mock"
+	"px.dev/pixie/src/utils"
+)
+
+func TestPersonalAccessTokenServer_Create(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPAT := mock_auth.NewMockPersonalAccessTokenServiceClient(ctrl)
+	expiresAt := types.TimestampNow()
+	mockPAT.EXPECT().Create(gomock.Any(), &authpb.CreatePersonalAccessTokenRequest{
+		Name:      "laptop",
+		Scopes:    []string{"cloud:read"},
+		ExpiresAt: expiresAt,
+	}).Return(&authpb.PersonalAccessToken{
+		ID:        utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Token:     "px-pat-abc",
+		Name:      "laptop",
+		Scopes:    []string{"cloud:read"},
+		ExpiresAt: expiresAt,
+	}, nil)
+
+	s := &controllers.PersonalAccessTokenServer{PersonalAccessTokenClient: mockPAT}
+	resp, err := s.Create(CreateTestContext(), &cloudpb.CreatePersonalAccessTokenRequest{
+		Name:      "laptop",
+		Scopes:    []string{"cloud:read"},
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "px-pat-abc", resp.Token)
+	assert.Equal(t, "laptop", resp.Name)
+	assert.Equal(t, []string{"cloud:read"}, resp.Scopes)
+	assert.Equal(t, expiresAt, resp.ExpiresAt)
+}
+
+func TestPersonalAccessTokenServer_List(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPAT := mock_auth.NewMockPersonalAccessTokenServiceClient(ctrl)
+	lastUsedAt := types.TimestampNow()
+	mockPAT.EXPECT().List(gomock.Any(), &authpb.ListPersonalAccessTokensRequest{}).
+		Return(&authpb.ListPersonalAccessTokensResponse{
+			Tokens: []*authpb.PersonalAccessToken{
+				{
+					ID:         utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+					Name:       "laptop",
+					Scopes:     []string{"vizier:exec"},
+					LastUsedAt: lastUsedAt,
+					LastUsedIP: "10.0.0.1",
+				},
+			},
+		}, nil)
+
+	s := &controllers.PersonalAccessTokenServer{PersonalAccessTokenClient: mockPAT}
+	resp, err := s.List(CreateTestContext(), &cloudpb.ListPersonalAccessTokensRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Tokens))
+	assert.Equal(t, "laptop", resp.Tokens[0].Name)
+	assert.Equal(t, lastUsedAt, resp.Tokens[0].LastUsedAt)
+	assert.Equal(t, "10.0.0.1", resp.Tokens[0].LastUsedIP)
+}
+
+func TestPersonalAccessTokenServer_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPAT := mock_auth.NewMockPersonalAccessTokenServiceClient(ctrl)
+	id := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	mockPAT.EXPECT().Delete(gomock.Any(), id).Return(&types.Empty{}, nil)
+
+	s := &controllers.PersonalAccessTokenServer{PersonalAccessTokenClient: mockPAT}
+	_, err := s.Delete(CreateTestContext(), id)
+	require.NoError(t, err)
+}
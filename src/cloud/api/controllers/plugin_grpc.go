@@ -21,6 +21,9 @@ package controllers
 import (
 	"context"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/cloud/plugin/pluginpb"
 	"px.dev/pixie/src/shared/services/authcontext"
@@ -335,6 +338,25 @@ func (p *PluginServiceServer) DeleteRetentionScript(ctx context.Context, req *cl
 		return nil, err
 	}
 
+	if req.DryRun {
+		resp, err := p.DataRetentionPluginServiceClient.GetRetentionScript(ctx, &pluginpb.GetRetentionScriptRequest{
+			OrgID:    orgID,
+			ScriptID: req.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		script := resp.Script.Script
+		if script.IsPreset {
+			return nil, status.Error(codes.FailedPrecondition, "preset retention scripts can't be deleted")
+		}
+		return &cloudpb.DeleteRetentionScriptResponse{
+			AffectedResources: []*cloudpb.AffectedResource{
+				affectedResource(affectedKindRetentionScript, script.ScriptID, script.ScriptName, affectedActionDelete),
+			},
+		}, nil
+	}
+
 	_, err = p.DataRetentionPluginServiceClient.DeleteRetentionScript(ctx, &pluginpb.DeleteRetentionScriptRequest{
 		ID:    req.ID,
 		OrgID: orgID,
@@ -26,6 +26,8 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/uuidpb"
@@ -608,3 +610,53 @@ func TestDeleteRetentionScript(t *testing.T) {
 
 	assert.Equal(t, &cloudpb.DeleteRetentionScriptResponse{}, resp)
 }
+
+func TestDeleteRetentionScript_DryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	scriptID := utils.ProtoFromUUIDStrOrNil("1ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	presetID := utils.ProtoFromUUIDStrOrNil("2ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	mockClients.MockDataRetentionPlugin.EXPECT().GetRetentionScript(gomock.Any(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	}).Return(&pluginpb.GetRetentionScriptResponse{
+		Script: &pluginpb.DetailedRetentionScript{
+			Script: &pluginpb.RetentionScript{ScriptID: scriptID, ScriptName: "Test Script"},
+		},
+	}, nil)
+	mockClients.MockDataRetentionPlugin.EXPECT().GetRetentionScript(gomock.Any(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    orgID,
+		ScriptID: presetID,
+	}).Return(&pluginpb.GetRetentionScriptResponse{
+		Script: &pluginpb.DetailedRetentionScript{
+			Script: &pluginpb.RetentionScript{ScriptID: presetID, ScriptName: "Preset Script", IsPreset: true},
+		},
+	}, nil)
+
+	pServer := &controllers.PluginServiceServer{mockClients.MockPlugin, mockClients.MockDataRetentionPlugin}
+
+	resp, err := pServer.DeleteRetentionScript(ctx, &cloudpb.DeleteRetentionScriptRequest{
+		ID:     scriptID,
+		DryRun: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.DeleteRetentionScriptResponse{
+		AffectedResources: []*cloudpb.AffectedResource{
+			{Kind: "retention_script", ID: scriptID, Name: "Test Script", Action: "delete"},
+		},
+	}, resp)
+
+	_, err = pServer.DeleteRetentionScript(ctx, &cloudpb.DeleteRetentionScriptRequest{
+		ID:     presetID,
+		DryRun: true,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/segmentio/analytics-go/v3"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/cloud/api/apienv"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/shared/services"
+	commonenv "px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/events"
+	"px.dev/pixie/src/shared/services/handler"
+	"px.dev/pixie/src/utils"
+)
+
+// samlPathPrefix is the path that the SAML service provider endpoints of the orgs are served under, as
+// <prefix><orgID>/<endpoint>.
+const samlPathPrefix = "/api/auth/saml/"
+
+// safeRelayState returns the path to send the user to after a SAML login. Only local paths are allowed, so that
+// the relay state can't be used to redirect users to other sites.
+func safeRelayState(relayState string) string {
+	if !strings.HasPrefix(relayState, "/") || strings.HasPrefix(relayState, "//") || strings.Contains(relayState, `\`) {
+		return "/"
+	}
+	return relayState
+}
+
+// AuthSAMLHandler serves the SAML service provider endpoints of an org:
+//   - GET <orgID>/metadata returns the service provider metadata to register with the identity provider.
+//   - GET <orgID>/login redirects the user to the identity provider.
+//   - POST <orgID>/acs is the assertion consumer service, which logs the user in and redirects them to the relay state.
+func AuthSAMLHandler(env commonenv.Env, w http.ResponseWriter, r *http.Request) error {
+	apiEnv, ok := env.(apienv.APIEnv)
+	if !ok {
+		return handler.NewStatusError(http.StatusInternalServerError, "failed to get environment")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, samlPathPrefix), "/")
+	if len(parts) != 2 {
+		return handler.NewStatusError(http.StatusNotFound, "not found")
+	}
+	orgID, err := uuid.FromString(parts[0])
+	if err != nil {
+		return handler.NewStatusError(http.StatusBadRequest, "invalid org id")
+	}
+
+	ctxWithCreds, err := attachCredentialsToContext(env, r)
+	if err != nil {
+		return &handler.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+
+	switch parts[1] {
+	case "metadata":
+		if r.Method != http.MethodGet {
+			return handler.NewStatusError(http.StatusMethodNotAllowed, "not a get request")
+		}
+		resp, err := apiEnv.AuthClient().GetSAMLServiceProviderMetadata(ctxWithCreds,
+			&authpb.GetSAMLServiceProviderMetadataRequest{OrgID: utils.ProtoFromUUID(orgID)})
+		if err != nil {
+			return services.HTTPStatusFromError(err, "Failed to get SAML metadata")
+		}
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		_, err = w.Write([]byte(resp.Metadata))
+		return err
+	case "login":
+		if r.Method != http.MethodGet {
+			return handler.NewStatusError(http.StatusMethodNotAllowed, "not a get request")
+		}
+		resp, err := apiEnv.AuthClient().GetSAMLAuthURL(ctxWithCreds, &authpb.GetSAMLAuthURLRequest{
+			OrgID:      utils.ProtoFromUUID(orgID),
+			RelayState: safeRelayState(r.URL.Query().Get("redirect_uri")),
+		})
+		if err != nil {
+			return services.HTTPStatusFromError(err, "Failed to start SAML login")
+		}
+		http.Redirect(w, r, resp.URL, http.StatusFound)
+		return nil
+	case "acs":
+		if r.Method != http.MethodPost {
+			return handler.NewStatusError(http.StatusMethodNotAllowed, "not a post request")
+		}
+		return samlACS(apiEnv, w, r, orgID)
+	default:
+		return handler.NewStatusError(http.StatusNotFound, "not found")
+	}
+}
+
+func samlACS(env apienv.APIEnv, w http.ResponseWriter, r *http.Request, orgID uuid.UUID) error {
+	// GetDefaultSession, will always return a valid session, even if it is empty.
+	session, _ := GetDefaultSession(env, r)
+	if session == nil {
+		return handler.NewStatusError(http.StatusInternalServerError, "failed to get session cookie")
+	}
+	if err := r.ParseForm(); err != nil {
+		return handler.NewStatusError(http.StatusBadRequest, "failed to parse form")
+	}
+
+	ctxWithCreds, err := attachCredentialsToContext(env, r)
+	if err != nil {
+		return &handler.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+	resp, err := env.AuthClient().LoginSAML(ctxWithCreds, &authpb.LoginSAMLRequest{
+		OrgID:        utils.ProtoFromUUID(orgID),
+		SAMLResponse: r.PostForm.Get("SAMLResponse"),
+	})
+	if err != nil {
+		log.WithError(err).Errorf("RPC request to authpb service failed")
+		return services.HTTPStatusFromError(err, "Failed to login")
+	}
+
+	userID := utils.UUIDFromProtoOrNil(resp.UserInfo.UserID).String()
+	event := events.UserLoggedIn
+	if resp.UserCreated {
+		event = events.UserSignedUp
+	}
+	events.Client().Enqueue(&analytics.Track{
+		UserId: userID,
+		Event:  event,
+		Properties: analytics.NewProperties().
+			Set("org_id", resp.OrgInfo.OrgID).
+			Set("identity_provider", resp.IdentityProvider),
+	})
+
+	// The identity provider posts the response from its own site, so the cookie can't be SameSite=Strict.
+	setSessionCookie(session, resp.Token, resp.ExpiresAt, r, w, http.SameSiteNoneMode)
+
+	log.WithField("host", r.Host).
+		WithField("timestamp", time.Now()).
+		WithField("user", userID).
+		Info("User logged in with SAML")
+
+	http.Redirect(w, r, safeRelayState(r.PostForm.Get("RelayState")), http.StatusSeeOther)
+	return nil
+}
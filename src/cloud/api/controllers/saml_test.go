@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/shared/services/handler"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const samlTestOrgID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+func TestAuthSAMLHandler_Metadata(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	mockClients.MockAuth.EXPECT().GetSAMLServiceProviderMetadata(gomock.Any(), &authpb.GetSAMLServiceProviderMetadataRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(samlTestOrgID),
+	}).Return(&authpb.GetSAMLServiceProviderMetadataResponse{Metadata: "<EntityDescriptor/>"}, nil)
+
+	req, err := http.NewRequest("GET", "/api/auth/saml/"+samlTestOrgID+"/metadata", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler.New(env, controllers.AuthSAMLHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/samlmetadata+xml", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "<EntityDescriptor/>", rr.Body.String())
+}
+
+func TestAuthSAMLHandler_Login(t *testing.T) {
+	tests := []struct {
+		name               string
+		redirectURI        string
+		expectedRelayState string
+	}{
+		{
+			name:               "local path",
+			redirectURI:        "/live/clusters",
+			expectedRelayState: "/live/clusters",
+		},
+		{
+			name:               "other site",
+			redirectURI:        "//evil.com/live",
+			expectedRelayState: "/",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+			defer cleanup()
+
+			mockClients.MockAuth.EXPECT().GetSAMLAuthURL(gomock.Any(), &authpb.GetSAMLAuthURLRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil(samlTestOrgID),
+				RelayState: tc.expectedRelayState,
+			}).Return(&authpb.GetSAMLAuthURLResponse{URL: "https://corp.okta.com/sso?SAMLRequest=abc"}, nil)
+
+			req, err := http.NewRequest("GET", "/api/auth/saml/"+samlTestOrgID+"/login?redirect_uri="+url.QueryEscape(tc.redirectURI), nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.New(env, controllers.AuthSAMLHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusFound, rr.Code)
+			assert.Equal(t, "https://corp.okta.com/sso?SAMLRequest=abc", rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestAuthSAMLHandler_ACS(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	testReplyToken := testingutils.GenerateTestJWTToken(t, "jwt-key")
+	mockClients.MockAuth.EXPECT().LoginSAML(gomock.Any(), &authpb.LoginSAMLRequest{
+		OrgID:        utils.ProtoFromUUIDStrOrNil(samlTestOrgID),
+		SAMLResponse: "PHNhbWxwOlJlc3BvbnNlLz4=",
+	}).Return(&authpb.LoginReply{
+		Token:     testReplyToken,
+		ExpiresAt: time.Now().Add(1 * time.Minute).Unix(),
+		UserInfo: &authpb.AuthenticatedUserInfo{
+			UserID: utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+			Email:  "abc@corp.com",
+		},
+		OrgInfo:          &authpb.LoginReply_OrgInfo{OrgID: samlTestOrgID, OrgName: "corp"},
+		IdentityProvider: "saml",
+	}, nil)
+
+	form := url.Values{"SAMLResponse": {"PHNhbWxwOlJlc3BvbnNlLz4="}, "RelayState": {"/live"}}
+	req, err := http.NewRequest("POST", "/api/auth/saml/"+samlTestOrgID+"/acs", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.New(env, controllers.AuthSAMLHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(t, "/live", rr.Header().Get("Location"))
+
+	header := http.Header{}
+	header.Add("Cookie", rr.Header().Get("Set-Cookie"))
+	sess, err := controllers.GetDefaultSession(env, &http.Request{Header: header})
+	require.NoError(t, err)
+	assert.Equal(t, testReplyToken, sess.Values["_at"])
+}
+
+func TestAuthSAMLHandler_ACSDenied(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	mockClients.MockAuth.EXPECT().LoginSAML(gomock.Any(), gomock.Any()).
+		Return(nil, status.Error(codes.PermissionDenied, "not in any group"))
+
+	form := url.Values{"SAMLResponse": {"abc"}}
+	req, err := http.NewRequest("POST", "/api/auth/saml/"+samlTestOrgID+"/acs", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.New(env, controllers.AuthSAMLHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, rr.Header().Get("Set-Cookie"))
+}
+
+func TestAuthSAMLHandler_BadPath(t *testing.T) {
+	env, _, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	for _, path := range []string{"/api/auth/saml/not-a-uuid/metadata", "/api/auth/saml/" + samlTestOrgID + "/other", "/api/auth/saml/" + samlTestOrgID} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.New(env, controllers.AuthSAMLHandler).ServeHTTP(rr, req)
+		assert.NotEqual(t, http.StatusOK, rr.Code, path)
+	}
+}
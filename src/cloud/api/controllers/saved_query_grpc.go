@@ -0,0 +1,165 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/gogo/protobuf/types"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+)
+
+// SavedQueryServer is the server that implements the SavedQueryService gRPC service.
+type SavedQueryServer struct {
+	SavedQueryClient scriptmgrpb.SavedQueryServiceClient
+}
+
+func savedQueryToCloudProto(q *scriptmgrpb.SavedQuery) *cloudpb.SavedQuery {
+	return &cloudpb.SavedQuery{
+		ID:          q.ID,
+		OrgID:       q.OrgID,
+		OwnerID:     q.OwnerID,
+		Name:        q.Name,
+		Description: q.Description,
+		Pxl:         q.Pxl,
+		Args:        q.Args,
+		Vis:         q.Vis,
+		Scope:       cloudpb.SavedQueryScope(q.Scope),
+		MemberIDs:   q.MemberIDs,
+		AllowEdit:   q.AllowEdit,
+		CreatedAt:   q.CreatedAt,
+		UpdatedAt:   q.UpdatedAt,
+	}
+}
+
+func savedQueryFromCloudProto(q *cloudpb.SavedQuery) *scriptmgrpb.SavedQuery {
+	if q == nil {
+		return nil
+	}
+	return &scriptmgrpb.SavedQuery{
+		ID:          q.ID,
+		OrgID:       q.OrgID,
+		OwnerID:     q.OwnerID,
+		Name:        q.Name,
+		Description: q.Description,
+		Pxl:         q.Pxl,
+		Args:        q.Args,
+		Vis:         q.Vis,
+		Scope:       scriptmgrpb.SavedQueryScope(q.Scope),
+		MemberIDs:   q.MemberIDs,
+		AllowEdit:   q.AllowEdit,
+		CreatedAt:   q.CreatedAt,
+		UpdatedAt:   q.UpdatedAt,
+	}
+}
+
+// CreateSavedQuery saves a new query, owned by the requesting user.
+func (s *SavedQueryServer) CreateSavedQuery(ctx context.Context, req *cloudpb.CreateSavedQueryReq) (*cloudpb.SavedQuery, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.SavedQueryClient.CreateSavedQuery(ctx, &scriptmgrpb.CreateSavedQueryReq{
+		Query: savedQueryFromCloudProto(req.Query),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return savedQueryToCloudProto(resp), nil
+}
+
+// GetSavedQuery returns a saved query that the requesting user can see.
+func (s *SavedQueryServer) GetSavedQuery(ctx context.Context, req *cloudpb.GetSavedQueryReq) (*cloudpb.SavedQuery, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.SavedQueryClient.GetSavedQuery(ctx, &scriptmgrpb.GetSavedQueryReq{ID: req.ID})
+	if err != nil {
+		return nil, err
+	}
+	return savedQueryToCloudProto(resp), nil
+}
+
+// GetSavedQueries returns the saved queries that the requesting user can see.
+func (s *SavedQueryServer) GetSavedQueries(ctx context.Context, req *cloudpb.GetSavedQueriesReq) (*cloudpb.GetSavedQueriesResp, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.SavedQueryClient.GetSavedQueries(ctx, &scriptmgrpb.GetSavedQueriesReq{Name: req.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	queries := make([]*cloudpb.SavedQuery, len(resp.Queries))
+	for i, q := range resp.Queries {
+		queries[i] = savedQueryToCloudProto(q)
+	}
+	return &cloudpb.GetSavedQueriesResp{Queries: queries}, nil
+}
+
+// UpdateSavedQuery updates a saved query that the requesting user can edit.
+func (s *SavedQueryServer) UpdateSavedQuery(ctx context.Context, req *cloudpb.UpdateSavedQueryReq) (*cloudpb.SavedQuery, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	smReq := &scriptmgrpb.UpdateSavedQueryReq{
+		ID:          req.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		Pxl:         req.Pxl,
+		Vis:         req.Vis,
+		Scope:       scriptmgrpb.SavedQueryScope(req.Scope),
+		AllowEdit:   req.AllowEdit,
+	}
+	if req.Args != nil {
+		smReq.Args = &scriptmgrpb.SavedQueryArgs{Args: req.Args.Args}
+	}
+	if req.Members != nil {
+		smReq.Members = &scriptmgrpb.SavedQueryMembers{MemberIDs: req.Members.MemberIDs}
+	}
+
+	resp, err := s.SavedQueryClient.UpdateSavedQuery(ctx, smReq)
+	if err != nil {
+		return nil, err
+	}
+	return savedQueryToCloudProto(resp), nil
+}
+
+// DeleteSavedQuery deletes a saved query owned by the requesting user.
+func (s *SavedQueryServer) DeleteSavedQuery(ctx context.Context, req *cloudpb.DeleteSavedQueryReq) (*types.Empty, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.SavedQueryClient.DeleteSavedQuery(ctx, &scriptmgrpb.DeleteSavedQueryReq{ID: req.ID})
+	if err != nil {
+		return nil, err
+	}
+	return &types.Empty{}, nil
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	"github.com/graph-gophers/graphql-go"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/api/proto/vispb"
+	"px.dev/pixie/src/utils"
+)
+
+// SavedQueryArgResolver resolves a single argument of a saved query.
+type SavedQueryArgResolver struct {
+	Name  string
+	Value string
+}
+
+// SavedQueryResolver resolves a saved query.
+type SavedQueryResolver struct {
+	query   *cloudpb.SavedQuery
+	visJSON string
+}
+
+func newSavedQueryResolver(q *cloudpb.SavedQuery) (*SavedQueryResolver, error) {
+	visJSON := ""
+	if q.Vis != nil {
+		m := jsonpb.Marshaler{}
+		var err error
+		visJSON, err = m.MarshalToString(q.Vis)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &SavedQueryResolver{query: q, visJSON: visJSON}, nil
+}
+
+// ID returns the saved query ID.
+func (r *SavedQueryResolver) ID() graphql.ID {
+	return graphql.ID(utils.UUIDFromProtoOrNil(r.query.ID).String())
+}
+
+// OwnerID returns the ID of the user that owns the saved query.
+func (r *SavedQueryResolver) OwnerID() graphql.ID {
+	return graphql.ID(utils.UUIDFromProtoOrNil(r.query.OwnerID).String())
+}
+
+// Name returns the name of the saved query.
+func (r *SavedQueryResolver) Name() string {
+	return r.query.Name
+}
+
+// Description returns the description of the saved query.
+func (r *SavedQueryResolver) Description() string {
+	return r.query.Description
+}
+
+// Pxl returns the script of the saved query.
+func (r *SavedQueryResolver) Pxl() string {
+	return r.query.Pxl
+}
+
+// Args returns the arguments of the saved query, sorted by name.
+func (r *SavedQueryResolver) Args() []*SavedQueryArgResolver {
+	args := make([]*SavedQueryArgResolver, 0, len(r.query.Args))
+	for k, v := range r.query.Args {
+		args = append(args, &SavedQueryArgResolver{Name: k, Value: v})
+	}
+	sort.Slice(args, func(i, j int) bool { return args[i].Name < args[j].Name })
+	return args
+}
+
+// VisJSON returns the vis spec of the saved query, as JSON.
+func (r *SavedQueryResolver) VisJSON() string {
+	return r.visJSON
+}
+
+// Scope returns who the saved query is shared with.
+func (r *SavedQueryResolver) Scope() string {
+	return r.query.Scope.String()
+}
+
+// MemberIDs returns the IDs of the team members that the saved query is shared with.
+func (r *SavedQueryResolver) MemberIDs() []graphql.ID {
+	ids := make([]graphql.ID, len(r.query.MemberIDs))
+	for i, id := range r.query.MemberIDs {
+		ids[i] = graphql.ID(utils.UUIDFromProtoOrNil(id).String())
+	}
+	return ids
+}
+
+// AllowEdit returns whether users other than the owner can edit the saved query.
+func (r *SavedQueryResolver) AllowEdit() bool {
+	return r.query.AllowEdit
+}
+
+func timestampToMs(ts *types.Timestamp) float64 {
+	if ts == nil {
+		return 0
+	}
+	return float64(ts.Seconds)*1e3 + float64(ts.Nanos)/1e6
+}
+
+// CreatedAtMs returns the time at which the saved query was created.
+func (r *SavedQueryResolver) CreatedAtMs() float64 {
+	return timestampToMs(r.query.CreatedAt)
+}
+
+// UpdatedAtMs returns the time at which the saved query was last updated.
+func (r *SavedQueryResolver) UpdatedAtMs() float64 {
+	return timestampToMs(r.query.UpdatedAt)
+}
+
+type savedQueryArgInput struct {
+	Name  string
+	Value string
+}
+
+type editableSavedQuery struct {
+	Name        *string
+	Description *string
+	Pxl         *string
+	Args        *[]*savedQueryArgInput
+	VisJSON     *string
+	Scope       *string
+	MemberIDs   *[]graphql.ID
+	AllowEdit   *bool
+}
+
+func (e *editableSavedQuery) args() map[string]string {
+	args := make(map[string]string)
+	for _, a := range *e.Args {
+		args[a.Name] = a.Value
+	}
+	return args
+}
+
+func (e *editableSavedQuery) memberIDs() []*uuidpb.UUID {
+	ids := make([]*uuidpb.UUID, len(*e.MemberIDs))
+	for i, id := range *e.MemberIDs {
+		ids[i] = utils.ProtoFromUUIDStrOrNil(string(id))
+	}
+	return ids
+}
+
+func (e *editableSavedQuery) vis() (*vispb.Vis, error) {
+	if *e.VisJSON == "" {
+		return nil, nil
+	}
+	vis := &vispb.Vis{}
+	if err := jsonpb.UnmarshalString(*e.VisJSON, vis); err != nil {
+		return nil, err
+	}
+	return vis, nil
+}
+
+type savedQueriesArgs struct {
+	Name *string
+}
+
+type savedQueryArgs struct {
+	ID graphql.ID
+}
+
+type createSavedQueryArgs struct {
+	Query *editableSavedQuery
+}
+
+type updateSavedQueryArgs struct {
+	ID    graphql.ID
+	Query *editableSavedQuery
+}
+
+type deleteSavedQueryArgs struct {
+	ID graphql.ID
+}
+
+// SavedQueries lists the saved queries that the user can see, optionally filtered by name.
+func (q *QueryResolver) SavedQueries(ctx context.Context, args savedQueriesArgs) ([]*SavedQueryResolver, error) {
+	req := &cloudpb.GetSavedQueriesReq{}
+	if args.Name != nil {
+		req.Name = *args.Name
+	}
+	resp, err := q.Env.SavedQueryServer.GetSavedQueries(ctx, req)
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+
+	queries := make([]*SavedQueryResolver, len(resp.Queries))
+	for i, sq := range resp.Queries {
+		queries[i], err = newSavedQueryResolver(sq)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return queries, nil
+}
+
+// SavedQuery returns a single saved query.
+func (q *QueryResolver) SavedQuery(ctx context.Context, args savedQueryArgs) (*SavedQueryResolver, error) {
+	resp, err := q.Env.SavedQueryServer.GetSavedQuery(ctx, &cloudpb.GetSavedQueryReq{
+		ID: utils.ProtoFromUUIDStrOrNil(string(args.ID)),
+	})
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+	return newSavedQueryResolver(resp)
+}
+
+// CreateSavedQuery saves a new query.
+func (q *QueryResolver) CreateSavedQuery(ctx context.Context, args createSavedQueryArgs) (*SavedQueryResolver, error) {
+	e := args.Query
+	sq := &cloudpb.SavedQuery{}
+	if e.Name != nil {
+		sq.Name = *e.Name
+	}
+	if e.Description != nil {
+		sq.Description = *e.Description
+	}
+	if e.Pxl != nil {
+		sq.Pxl = *e.Pxl
+	}
+	if e.Args != nil {
+		sq.Args = e.args()
+	}
+	if e.VisJSON != nil {
+		vis, err := e.vis()
+		if err != nil {
+			return nil, err
+		}
+		sq.Vis = vis
+	}
+	if e.Scope != nil {
+		sq.Scope = cloudpb.SavedQueryScope(cloudpb.SavedQueryScope_value[*e.Scope])
+	}
+	if e.MemberIDs != nil {
+		sq.MemberIDs = e.memberIDs()
+	}
+	if e.AllowEdit != nil {
+		sq.AllowEdit = *e.AllowEdit
+	}
+
+	resp, err := q.Env.SavedQueryServer.CreateSavedQuery(ctx, &cloudpb.CreateSavedQueryReq{Query: sq})
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+	return newSavedQueryResolver(resp)
+}
+
+// UpdateSavedQuery updates the given fields of a saved query.
+func (q *QueryResolver) UpdateSavedQuery(ctx context.Context, args updateSavedQueryArgs) (*SavedQueryResolver, error) {
+	e := args.Query
+	req := &cloudpb.UpdateSavedQueryReq{
+		ID: utils.ProtoFromUUIDStrOrNil(string(args.ID)),
+	}
+	if e.Name != nil {
+		req.Name = &types.StringValue{Value: *e.Name}
+	}
+	if e.Description != nil {
+		req.Description = &types.StringValue{Value: *e.Description}
+	}
+	if e.Pxl != nil {
+		req.Pxl = &types.StringValue{Value: *e.Pxl}
+	}
+	if e.Args != nil {
+		req.Args = &cloudpb.SavedQueryArgs{Args: e.args()}
+	}
+	if e.VisJSON != nil {
+		vis, err := e.vis()
+		if err != nil {
+			return nil, err
+		}
+		// An empty vis can't be told apart from an unset one, so clearing the vis isn't supported.
+		req.Vis = vis
+	}
+	if e.Scope != nil {
+		req.Scope = cloudpb.SavedQueryScope(cloudpb.SavedQueryScope_value[*e.Scope])
+	}
+	if e.MemberIDs != nil {
+		req.Members = &cloudpb.SavedQueryMembers{MemberIDs: e.memberIDs()}
+	}
+	if e.AllowEdit != nil {
+		req.AllowEdit = &types.BoolValue{Value: *e.AllowEdit}
+	}
+
+	resp, err := q.Env.SavedQueryServer.UpdateSavedQuery(ctx, req)
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+	return newSavedQueryResolver(resp)
+}
+
+// DeleteSavedQuery deletes a saved query.
+func (q *QueryResolver) DeleteSavedQuery(ctx context.Context, args deleteSavedQueryArgs) (bool, error) {
+	_, err := q.Env.SavedQueryServer.DeleteSavedQuery(ctx, &cloudpb.DeleteSavedQueryReq{
+		ID: utils.ProtoFromUUIDStrOrNil(string(args.ID)),
+	})
+	if err != nil {
+		return false, rpcErrorHelper(err)
+	}
+	return true, nil
+}
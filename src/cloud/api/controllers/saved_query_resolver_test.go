@@ -0,0 +1,153 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/graph-gophers/graphql-go/gqltesting"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+	"px.dev/pixie/src/utils"
+)
+
+func TestSavedQueries(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	mockClients.MockSavedQuery.EXPECT().
+		GetSavedQueries(gomock.Any(), &cloudpb.GetSavedQueriesReq{Name: "http_errors"}).
+		Return(&cloudpb.GetSavedQueriesResp{
+			Queries: []*cloudpb.SavedQuery{
+				{
+					ID:        utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+					OwnerID:   utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+					Name:      "http_errors",
+					Pxl:       "px.display()",
+					Args:      map[string]string{"start_time": "-5m", "namespace": "default"},
+					Scope:     cloudpb.SQS_TEAM,
+					MemberIDs: []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9")},
+					CreatedAt: &types.Timestamp{Seconds: 1583776060},
+				},
+			},
+		}, nil)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:  gqlSchema,
+			Context: ctx,
+			Query: `
+				query {
+					savedQueries(name: "http_errors") {
+						id
+						ownerID
+						name
+						pxl
+						args {
+							name
+							value
+						}
+						visJSON
+						scope
+						memberIDs
+						allowEdit
+						createdAtMs
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"savedQueries": [{
+						"id": "7ba7b810-9dad-11d1-80b4-00c04fd430c8",
+						"ownerID": "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+						"name": "http_errors",
+						"pxl": "px.display()",
+						"args": [
+							{"name": "namespace", "value": "default"},
+							{"name": "start_time", "value": "-5m"}
+						],
+						"visJSON": "",
+						"scope": "SQS_TEAM",
+						"memberIDs": ["6ba7b810-9dad-11d1-80b4-00c04fd430c9"],
+						"allowEdit": false,
+						"createdAtMs": 1583776060000
+					}]
+				}
+			`,
+		},
+	})
+}
+
+func TestUpdateSavedQuery(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	queryID := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	mockClients.MockSavedQuery.EXPECT().
+		UpdateSavedQuery(gomock.Any(), &cloudpb.UpdateSavedQueryReq{
+			ID:        queryID,
+			Pxl:       &types.StringValue{Value: "px.display()"},
+			Scope:     cloudpb.SQS_ORG,
+			AllowEdit: &types.BoolValue{Value: true},
+		}).
+		Return(&cloudpb.SavedQuery{
+			ID:        queryID,
+			Name:      "http_errors",
+			Pxl:       "px.display()",
+			Scope:     cloudpb.SQS_ORG,
+			AllowEdit: true,
+		}, nil)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:  gqlSchema,
+			Context: ctx,
+			Query: `
+				mutation {
+					UpdateSavedQuery(id: "7ba7b810-9dad-11d1-80b4-00c04fd430c8", query: {
+						pxl: "px.display()",
+						scope: SQS_ORG,
+						allowEdit: true
+					}) {
+						id
+						scope
+						allowEdit
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"UpdateSavedQuery": {
+						"id": "7ba7b810-9dad-11d1-80b4-00c04fd430c8",
+						"scope": "SQS_ORG",
+						"allowEdit": true
+					}
+				}
+			`,
+		},
+	})
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	mock_scriptmgr "px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb/mock"
+	"px.dev/pixie/src/utils"
+)
+
+func TestSavedQueryServer_CreateSavedQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_scriptmgr.NewMockSavedQueryServiceClient(ctrl)
+	queryID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	memberID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9")
+
+	mockClient.EXPECT().CreateSavedQuery(gomock.Any(), &scriptmgrpb.CreateSavedQueryReq{
+		Query: &scriptmgrpb.SavedQuery{
+			Name:      "http_errors",
+			Pxl:       "px.display()",
+			Args:      map[string]string{"start_time": "-5m"},
+			Scope:     scriptmgrpb.SQS_TEAM,
+			MemberIDs: []*uuidpb.UUID{memberID},
+		},
+	}).Return(&scriptmgrpb.SavedQuery{
+		ID:        queryID,
+		Name:      "http_errors",
+		Pxl:       "px.display()",
+		Args:      map[string]string{"start_time": "-5m"},
+		Scope:     scriptmgrpb.SQS_TEAM,
+		MemberIDs: []*uuidpb.UUID{memberID},
+	}, nil)
+
+	s := &controllers.SavedQueryServer{SavedQueryClient: mockClient}
+	resp, err := s.CreateSavedQuery(CreateTestContext(), &cloudpb.CreateSavedQueryReq{
+		Query: &cloudpb.SavedQuery{
+			Name:      "http_errors",
+			Pxl:       "px.display()",
+			Args:      map[string]string{"start_time": "-5m"},
+			Scope:     cloudpb.SQS_TEAM,
+			MemberIDs: []*uuidpb.UUID{memberID},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.SavedQuery{
+		ID:        queryID,
+		Name:      "http_errors",
+		Pxl:       "px.display()",
+		Args:      map[string]string{"start_time": "-5m"},
+		Scope:     cloudpb.SQS_TEAM,
+		MemberIDs: []*uuidpb.UUID{memberID},
+	}, resp)
+}
+
+func TestSavedQueryServer_GetSavedQueries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_scriptmgr.NewMockSavedQueryServiceClient(ctrl)
+	mockClient.EXPECT().GetSavedQueries(gomock.Any(), &scriptmgrpb.GetSavedQueriesReq{Name: "http_errors"}).
+		Return(&scriptmgrpb.GetSavedQueriesResp{
+			Queries: []*scriptmgrpb.SavedQuery{
+				{Name: "http_errors", Scope: scriptmgrpb.SQS_ORG},
+			},
+		}, nil)
+
+	s := &controllers.SavedQueryServer{SavedQueryClient: mockClient}
+	resp, err := s.GetSavedQueries(CreateTestContext(), &cloudpb.GetSavedQueriesReq{Name: "http_errors"})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.GetSavedQueriesResp{
+		Queries: []*cloudpb.SavedQuery{
+			{Name: "http_errors", Scope: cloudpb.SQS_ORG},
+		},
+	}, resp)
+}
+
+func TestSavedQueryServer_UpdateSavedQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_scriptmgr.NewMockSavedQueryServiceClient(ctrl)
+	queryID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	mockClient.EXPECT().UpdateSavedQuery(gomock.Any(), &scriptmgrpb.UpdateSavedQueryReq{
+		ID:        queryID,
+		Pxl:       &types.StringValue{Value: "px.display()"},
+		Args:      &scriptmgrpb.SavedQueryArgs{Args: map[string]string{"start_time": "-1h"}},
+		AllowEdit: &types.BoolValue{Value: true},
+	}).Return(&scriptmgrpb.SavedQuery{
+		ID:        queryID,
+		Pxl:       "px.display()",
+		Args:      map[string]string{"start_time": "-1h"},
+		AllowEdit: true,
+	}, nil)
+
+	s := &controllers.SavedQueryServer{SavedQueryClient: mockClient}
+	resp, err := s.UpdateSavedQuery(CreateTestContext(), &cloudpb.UpdateSavedQueryReq{
+		ID:        queryID,
+		Pxl:       &types.StringValue{Value: "px.display()"},
+		Args:      &cloudpb.SavedQueryArgs{Args: map[string]string{"start_time": "-1h"}},
+		AllowEdit: &types.BoolValue{Value: true},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "px.display()", resp.Pxl)
+	assert.True(t, resp.AllowEdit)
+}
+
+func TestSavedQueryServer_DeleteSavedQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_scriptmgr.NewMockSavedQueryServiceClient(ctrl)
+	queryID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	mockClient.EXPECT().DeleteSavedQuery(gomock.Any(), &scriptmgrpb.DeleteSavedQueryReq{ID: queryID}).
+		Return(&scriptmgrpb.DeleteSavedQueryResp{}, nil)
+
+	s := &controllers.SavedQueryServer{SavedQueryClient: mockClient}
+	_, err := s.DeleteSavedQuery(CreateTestContext(), &cloudpb.DeleteSavedQueryReq{ID: queryID})
+	require.NoError(t, err)
+}
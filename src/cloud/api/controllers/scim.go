@@ -0,0 +1,752 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/api/apienv"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/cloud/shared/samlid"
+	"px.dev/pixie/src/shared/services"
+	"px.dev/pixie/src/shared/services/authcontext"
+	commonenv "px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/handler"
+	"px.dev/pixie/src/shared/services/httpmiddleware"
+	"px.dev/pixie/src/utils"
+)
+
+// scimPathPrefix is the path that the SCIM 2.0 endpoints are served under.
+const scimPathPrefix = "/api/scim/v2/"
+
+const (
+	scimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema         = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSPConfigSchema     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType        = "application/scim+json"
+	scimMaxResultsPerQuery = 200
+)
+
+type scimName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type scimUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id,omitempty"`
+	UserName string      `json:"userName"`
+	Name     *scimName   `json:"name,omitempty"`
+	Emails   []scimEmail `json:"emails,omitempty"`
+	Active   *bool       `json:"active,omitempty"`
+	Meta     *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimMember struct {
+	Value string `json:"value"`
+}
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	Members     []scimMember `json:"members"`
+	Meta        *scimMeta    `json:"meta,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimPatchOp struct {
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimError struct {
+	Schemas []string `json:"schemas"`
+	Status  string   `json:"status"`
+	Detail  string   `json:"detail"`
+}
+
+// scimServiceProviderConfig describes the SCIM features that are supported.
+var scimServiceProviderConfig = map[string]interface{}{
+	"schemas":        []string{scimSPConfigSchema},
+	"patch":          map[string]bool{"supported": true},
+	"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+	"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxResultsPerQuery},
+	"changePassword": map[string]bool{"supported": false},
+	"sort":           map[string]bool{"supported": false},
+	"etag":           map[string]bool{"supported": false},
+	"authenticationSchemes": []map[string]string{{
+		"type":        "oauthbearertoken",
+		"name":        "API Key",
+		"description": "Authentication with a Pixie API key of the org, as a bearer token.",
+	}},
+}
+
+// scimServer serves the SCIM requests of an org.
+type scimServer struct {
+	env   apienv.APIEnv
+	ctx   context.Context
+	orgID uuid.UUID
+}
+
+// SCIMHandler serves the SCIM 2.0 endpoints that let the identity provider of an org provision its users and
+// groups. Requests are authenticated with an API key of the org, passed as a bearer token:
+//   - /Users creates, lists, updates, deactivates and deletes the users of the org.
+//   - /Groups creates, lists, updates and deletes the groups of users in the org.
+//   - /ServiceProviderConfig describes the supported SCIM features.
+//
+// Users are provisioned as SAML users of the org, so that they are matched when they log in with SAML.
+func SCIMHandler(env commonenv.Env, w http.ResponseWriter, r *http.Request) error {
+	apiEnv, ok := env.(apienv.APIEnv)
+	if !ok {
+		return handler.NewStatusError(http.StatusInternalServerError, "failed to get environment")
+	}
+	if err := serveSCIM(apiEnv, w, r); err != nil {
+		writeSCIMError(w, err)
+	}
+	return nil
+}
+
+func serveSCIM(env apienv.APIEnv, w http.ResponseWriter, r *http.Request) error {
+	ctx, orgID, err := scimAuth(env, r)
+	if err != nil {
+		return err
+	}
+	s := &scimServer{env: env, ctx: ctx, orgID: orgID}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, scimPathPrefix), "/"), "/")
+	if len(parts) > 2 {
+		return handler.NewStatusError(http.StatusNotFound, "not found")
+	}
+	var id uuid.UUID
+	if len(parts) == 2 {
+		if id, err = uuid.FromString(parts[1]); err != nil {
+			return handler.NewStatusError(http.StatusNotFound, "not found")
+		}
+	}
+
+	switch {
+	case parts[0] == "ServiceProviderConfig" && len(parts) == 1 && r.Method == http.MethodGet:
+		return writeSCIMJSON(w, http.StatusOK, scimServiceProviderConfig)
+	case parts[0] == "Users" && len(parts) == 1 && r.Method == http.MethodGet:
+		return s.listUsers(w, r)
+	case parts[0] == "Users" && len(parts) == 1 && r.Method == http.MethodPost:
+		return s.createUser(w, r)
+	case parts[0] == "Users" && len(parts) == 2 && r.Method == http.MethodGet:
+		return s.getUser(w, id)
+	case parts[0] == "Users" && len(parts) == 2 && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		return s.updateUser(w, r, id)
+	case parts[0] == "Users" && len(parts) == 2 && r.Method == http.MethodDelete:
+		return s.deleteUser(w, id)
+	case parts[0] == "Groups" && len(parts) == 1 && r.Method == http.MethodGet:
+		return s.listGroups(w, r)
+	case parts[0] == "Groups" && len(parts) == 1 && r.Method == http.MethodPost:
+		return s.createGroup(w, r)
+	case parts[0] == "Groups" && len(parts) == 2 && r.Method == http.MethodGet:
+		return s.getGroup(w, id)
+	case parts[0] == "Groups" && len(parts) == 2 && r.Method == http.MethodPut:
+		return s.replaceGroup(w, r, id)
+	case parts[0] == "Groups" && len(parts) == 2 && r.Method == http.MethodPatch:
+		return s.patchGroup(w, r, id)
+	case parts[0] == "Groups" && len(parts) == 2 && r.Method == http.MethodDelete:
+		return s.deleteGroup(w, id)
+	case parts[0] == "ServiceProviderConfig" || parts[0] == "Users" || parts[0] == "Groups":
+		return handler.NewStatusError(http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		return handler.NewStatusError(http.StatusNotFound, "not found")
+	}
+}
+
+// scimAuth authenticates the API key of the request, and returns the context to make requests with on behalf of
+// its org.
+func scimAuth(env apienv.APIEnv, r *http.Request) (context.Context, uuid.UUID, error) {
+	apiKey, ok := httpmiddleware.GetTokenFromBearer(r)
+	if !ok || apiKey == "" {
+		return nil, uuid.Nil, handler.NewStatusError(http.StatusUnauthorized, "missing bearer token")
+	}
+	ctxWithCreds, err := attachCredentialsToContext(env, r)
+	if err != nil {
+		return nil, uuid.Nil, &handler.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+	resp, err := env.AuthClient().GetAugmentedTokenForAPIKey(ctxWithCreds, &authpb.GetAugmentedTokenForAPIKeyRequest{
+		APIKey:   apiKey,
+		ClientIP: clientIP(r),
+	})
+	if err != nil {
+		return nil, uuid.Nil, handler.NewStatusError(http.StatusUnauthorized, "invalid API key")
+	}
+
+	aCtx := authcontext.New()
+	if err := aCtx.UseJWTAuth(env.JWTSigningKey(), resp.Token, viper.GetString("domain_name")); err != nil {
+		return nil, uuid.Nil, handler.NewStatusError(http.StatusUnauthorized, "invalid API key")
+	}
+	claims := aCtx.Claims.GetUserClaims()
+	if claims == nil || !claims.IsAPIUser {
+		return nil, uuid.Nil, handler.NewStatusError(http.StatusForbidden, "SCIM requests must be authenticated with an API key of the org")
+	}
+	if apikeyscope.IsScoped(aCtx.Claims.Scopes) {
+		return nil, uuid.Nil, handler.NewStatusError(http.StatusForbidden, "SCIM requests must be authenticated with an unrestricted API key")
+	}
+	// SCIM requests manage the users and roles of the whole org, so only keys of admins may make them.
+	if !orgrole.IsAdmin(aCtx.Claims.Scopes) {
+		return nil, uuid.Nil, handler.NewStatusError(http.StatusForbidden, "SCIM requests must be authenticated with an API key of an org admin")
+	}
+	orgID := uuid.FromStringOrNil(claims.OrgID)
+	if orgID == uuid.Nil {
+		return nil, uuid.Nil, handler.NewStatusError(http.StatusForbidden, "the API key does not belong to an org")
+	}
+
+	ctx := authcontext.NewContext(r.Context(), aCtx)
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", resp.Token))
+	return ctx, orgID, nil
+}
+
+func writeSCIMJSON(w http.ResponseWriter, code int, v interface{}) error {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func writeSCIMError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	detail := http.StatusText(code)
+	if e, ok := err.(handler.Error); ok {
+		code = e.Status()
+		detail = e.Error()
+	} else {
+		log.WithError(err).Error("Failed to serve SCIM request")
+	}
+	_ = writeSCIMJSON(w, code, &scimError{
+		Schemas: []string{scimErrorSchema},
+		Status:  strconv.Itoa(code),
+		Detail:  detail,
+	})
+}
+
+// scimStatusFromError converts the error of a request to the profile service. Resources of other orgs are
+// reported as missing, so that their existence isn't leaked.
+func scimStatusFromError(err error, message string) error {
+	switch status.Code(err) {
+	case codes.NotFound, codes.PermissionDenied:
+		return handler.NewStatusError(http.StatusNotFound, "not found")
+	case codes.AlreadyExists:
+		return handler.NewStatusError(http.StatusConflict, status.Convert(err).Message())
+	default:
+		return services.HTTPStatusFromError(err, message)
+	}
+}
+
+func decodeSCIMBody(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return handler.NewStatusError(http.StatusBadRequest, "invalid request body")
+	}
+	return nil
+}
+
+// parseSCIMFilter parses the filter of a list request. Only equality filters on the given attribute are
+// supported, which is what identity providers use to look up resources.
+func parseSCIMFilter(filter string, attr string) (string, bool, error) {
+	if filter == "" {
+		return "", false, nil
+	}
+	parts := strings.SplitN(strings.TrimSpace(filter), " ", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[0], attr) || !strings.EqualFold(parts[1], "eq") {
+		return "", false, handler.NewStatusError(http.StatusBadRequest, fmt.Sprintf("only filters of the form '%s eq \"value\"' are supported", attr))
+	}
+	value, err := strconv.Unquote(parts[2])
+	if err != nil {
+		return "", false, handler.NewStatusError(http.StatusBadRequest, "the filter value must be a quoted string")
+	}
+	return value, true, nil
+}
+
+// writeSCIMList writes the page of the resources that was requested with the startIndex and count parameters.
+func writeSCIMList(w http.ResponseWriter, r *http.Request, resources []interface{}) error {
+	startIndex, err := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 0 || count > scimMaxResultsPerQuery {
+		count = scimMaxResultsPerQuery
+	}
+
+	page := make([]interface{}, 0)
+	if startIndex <= len(resources) {
+		end := startIndex - 1 + count
+		if end > len(resources) {
+			end = len(resources)
+		}
+		page = resources[startIndex-1 : end]
+	}
+	return writeSCIMJSON(w, http.StatusOK, &scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// parseSCIMBool parses a boolean value. Some identity providers send booleans as strings.
+func parseSCIMBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if b, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return b, nil
+		}
+	}
+	return false, handler.NewStatusError(http.StatusBadRequest, "invalid boolean value")
+}
+
+func (s *scimServer) userToSCIM(u *profilepb.UserInfo) *scimUser {
+	userName, ok := samlid.NameID(s.orgID, u.AuthProviderID)
+	if !ok {
+		userName = u.Email
+	}
+	id := utils.ProtoToUUIDStr(u.ID)
+	active := !u.IsDeactivated
+	return &scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       id,
+		UserName: userName,
+		Name:     &scimName{GivenName: u.FirstName, FamilyName: u.LastName},
+		Emails:   []scimEmail{{Value: u.Email, Primary: true}},
+		Active:   &active,
+		Meta:     &scimMeta{ResourceType: "User", Location: scimPathPrefix + "Users/" + id},
+	}
+}
+
+// getOrgUser gets the user, given that they belong to the org.
+func (s *scimServer) getOrgUser(id uuid.UUID) (*profilepb.UserInfo, error) {
+	u, err := s.env.ProfileClient().GetUser(s.ctx, utils.ProtoFromUUID(id))
+	if err != nil {
+		return nil, scimStatusFromError(err, "Failed to get user")
+	}
+	if utils.UUIDFromProtoOrNil(u.OrgID) != s.orgID {
+		return nil, handler.NewStatusError(http.StatusNotFound, "not found")
+	}
+	return u, nil
+}
+
+func (s *scimServer) listUsers(w http.ResponseWriter, r *http.Request) error {
+	userName, filtered, err := parseSCIMFilter(r.URL.Query().Get("filter"), "userName")
+	if err != nil {
+		return err
+	}
+	resp, err := s.env.OrgClient().GetUsersInOrg(s.ctx, &profilepb.GetUsersInOrgRequest{OrgID: utils.ProtoFromUUID(s.orgID)})
+	if err != nil {
+		return scimStatusFromError(err, "Failed to list users")
+	}
+
+	resources := make([]interface{}, 0)
+	for _, u := range resp.Users {
+		user := s.userToSCIM(u)
+		if filtered && !strings.EqualFold(user.UserName, userName) {
+			continue
+		}
+		resources = append(resources, user)
+	}
+	return writeSCIMList(w, r, resources)
+}
+
+func (s *scimServer) createUser(w http.ResponseWriter, r *http.Request) error {
+	var req scimUser
+	if err := decodeSCIMBody(r, &req); err != nil {
+		return err
+	}
+	if req.UserName == "" {
+		return handler.NewStatusError(http.StatusBadRequest, "userName is required")
+	}
+	email := req.UserName
+	for i, e := range req.Emails {
+		if i == 0 || e.Primary {
+			email = e.Value
+		}
+	}
+	createReq := &profilepb.CreateUserRequest{
+		OrgID:            utils.ProtoFromUUID(s.orgID),
+		Email:            email,
+		IdentityProvider: samlid.IdentityProvider,
+		AuthProviderID:   samlid.AuthProviderID(s.orgID, req.UserName),
+	}
+	if req.Name != nil {
+		createReq.FirstName = req.Name.GivenName
+		createReq.LastName = req.Name.FamilyName
+	}
+	id, err := s.env.ProfileClient().CreateUser(s.ctx, createReq)
+	if err != nil {
+		return scimStatusFromError(err, "Failed to create user")
+	}
+
+	// The identity provider decides who may use the org, so provisioned users don't need the approval of an admin.
+	u, err := s.env.ProfileClient().UpdateUser(s.ctx, &profilepb.UpdateUserRequest{
+		ID:            id,
+		IsApproved:    &types.BoolValue{Value: true},
+		IsDeactivated: &types.BoolValue{Value: req.Active != nil && !*req.Active},
+	})
+	if err != nil {
+		return scimStatusFromError(err, "Failed to create user")
+	}
+	return writeSCIMJSON(w, http.StatusCreated, s.userToSCIM(u))
+}
+
+func (s *scimServer) getUser(w http.ResponseWriter, id uuid.UUID) error {
+	u, err := s.getOrgUser(id)
+	if err != nil {
+		return err
+	}
+	return writeSCIMJSON(w, http.StatusOK, s.userToSCIM(u))
+}
+
+// userActiveUpdate returns whether the user should be active, according to a PUT or PATCH request. Only the
+// active attribute can be changed, since the rest of the profile comes from the identity provider on login.
+func userActiveUpdate(r *http.Request) (*bool, error) {
+	if r.Method == http.MethodPut {
+		var req scimUser
+		if err := decodeSCIMBody(r, &req); err != nil {
+			return nil, err
+		}
+		return req.Active, nil
+	}
+
+	var req scimPatchOp
+	if err := decodeSCIMBody(r, &req); err != nil {
+		return nil, err
+	}
+	var active *bool
+	for _, op := range req.Operations {
+		if o := strings.ToLower(op.Op); o != "replace" && o != "add" {
+			continue
+		}
+		raw := op.Value
+		if op.Path == "" {
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return nil, handler.NewStatusError(http.StatusBadRequest, "invalid patch value")
+			}
+			raw = values["active"]
+		} else if !strings.EqualFold(op.Path, "active") {
+			continue
+		}
+		if raw == nil {
+			continue
+		}
+		b, err := parseSCIMBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		active = &b
+	}
+	return active, nil
+}
+
+func (s *scimServer) updateUser(w http.ResponseWriter, r *http.Request, id uuid.UUID) error {
+	u, err := s.getOrgUser(id)
+	if err != nil {
+		return err
+	}
+	active, err := userActiveUpdate(r)
+	if err != nil {
+		return err
+	}
+	if active != nil && *active == u.IsDeactivated {
+		u, err = s.env.ProfileClient().UpdateUser(s.ctx, &profilepb.UpdateUserRequest{
+			ID:            u.ID,
+			IsDeactivated: &types.BoolValue{Value: !*active},
+		})
+		if err != nil {
+			return scimStatusFromError(err, "Failed to update user")
+		}
+	}
+	return writeSCIMJSON(w, http.StatusOK, s.userToSCIM(u))
+}
+
+func (s *scimServer) deleteUser(w http.ResponseWriter, id uuid.UUID) error {
+	u, err := s.getOrgUser(id)
+	if err != nil {
+		return err
+	}
+	// Deleting the last user of an org deletes the org as well, which is never what the identity provider wants.
+	resp, err := s.env.OrgClient().GetUsersInOrg(s.ctx, &profilepb.GetUsersInOrgRequest{OrgID: utils.ProtoFromUUID(s.orgID)})
+	if err != nil {
+		return scimStatusFromError(err, "Failed to delete user")
+	}
+	if len(resp.Users) <= 1 {
+		return handler.NewStatusError(http.StatusConflict, "cannot delete the last user of the org")
+	}
+	if _, err := s.env.ProfileClient().DeleteUser(s.ctx, &profilepb.DeleteUserRequest{ID: u.ID}); err != nil {
+		return scimStatusFromError(err, "Failed to delete user")
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func groupToSCIM(g *profilepb.GroupInfo) *scimGroup {
+	id := utils.ProtoToUUIDStr(g.ID)
+	members := make([]scimMember, len(g.MemberIDs))
+	for i, m := range g.MemberIDs {
+		members[i] = scimMember{Value: utils.ProtoToUUIDStr(m)}
+	}
+	return &scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          id,
+		DisplayName: g.DisplayName,
+		ExternalID:  g.ExternalID,
+		Members:     members,
+		Meta:        &scimMeta{ResourceType: "Group", Location: scimPathPrefix + "Groups/" + id},
+	}
+}
+
+func scimMemberIDs(members []scimMember) ([]*uuidpb.UUID, error) {
+	ids := make([]*uuidpb.UUID, len(members))
+	for i, m := range members {
+		id, err := uuid.FromString(m.Value)
+		if err != nil {
+			return nil, handler.NewStatusError(http.StatusBadRequest, fmt.Sprintf("invalid member '%s'", m.Value))
+		}
+		ids[i] = utils.ProtoFromUUID(id)
+	}
+	return ids, nil
+}
+
+func (s *scimServer) listGroups(w http.ResponseWriter, r *http.Request) error {
+	displayName, filtered, err := parseSCIMFilter(r.URL.Query().Get("filter"), "displayName")
+	if err != nil {
+		return err
+	}
+	resp, err := s.env.OrgClient().GetGroupsInOrg(s.ctx, &profilepb.GetGroupsInOrgRequest{OrgID: utils.ProtoFromUUID(s.orgID)})
+	if err != nil {
+		return scimStatusFromError(err, "Failed to list groups")
+	}
+
+	resources := make([]interface{}, 0)
+	for _, g := range resp.Groups {
+		if filtered && g.DisplayName != displayName {
+			continue
+		}
+		resources = append(resources, groupToSCIM(g))
+	}
+	return writeSCIMList(w, r, resources)
+}
+
+func (s *scimServer) createGroup(w http.ResponseWriter, r *http.Request) error {
+	var req scimGroup
+	if err := decodeSCIMBody(r, &req); err != nil {
+		return err
+	}
+	if req.DisplayName == "" {
+		return handler.NewStatusError(http.StatusBadRequest, "displayName is required")
+	}
+	memberIDs, err := scimMemberIDs(req.Members)
+	if err != nil {
+		return err
+	}
+	g, err := s.env.OrgClient().CreateGroup(s.ctx, &profilepb.CreateGroupRequest{
+		OrgID:       utils.ProtoFromUUID(s.orgID),
+		DisplayName: req.DisplayName,
+		ExternalID:  req.ExternalID,
+		MemberIDs:   memberIDs,
+	})
+	if err != nil {
+		return scimStatusFromError(err, "Failed to create group")
+	}
+	return writeSCIMJSON(w, http.StatusCreated, groupToSCIM(g))
+}
+
+func (s *scimServer) getGroup(w http.ResponseWriter, id uuid.UUID) error {
+	g, err := s.env.OrgClient().GetGroup(s.ctx, utils.ProtoFromUUID(id))
+	if err != nil {
+		return scimStatusFromError(err, "Failed to get group")
+	}
+	return writeSCIMJSON(w, http.StatusOK, groupToSCIM(g))
+}
+
+func (s *scimServer) updateGroup(w http.ResponseWriter, req *profilepb.UpdateGroupRequest) error {
+	g, err := s.env.OrgClient().UpdateGroup(s.ctx, req)
+	if err != nil {
+		return scimStatusFromError(err, "Failed to update group")
+	}
+	return writeSCIMJSON(w, http.StatusOK, groupToSCIM(g))
+}
+
+func (s *scimServer) replaceGroup(w http.ResponseWriter, r *http.Request, id uuid.UUID) error {
+	var req scimGroup
+	if err := decodeSCIMBody(r, &req); err != nil {
+		return err
+	}
+	if req.DisplayName == "" {
+		return handler.NewStatusError(http.StatusBadRequest, "displayName is required")
+	}
+	memberIDs, err := scimMemberIDs(req.Members)
+	if err != nil {
+		return err
+	}
+	return s.updateGroup(w, &profilepb.UpdateGroupRequest{
+		ID:             utils.ProtoFromUUID(id),
+		DisplayName:    &types.StringValue{Value: req.DisplayName},
+		ExternalID:     &types.StringValue{Value: req.ExternalID},
+		ReplaceMembers: true,
+		MemberIDs:      memberIDs,
+	})
+}
+
+// applyGroupPatchValues applies the attributes of a patch operation without a path.
+func applyGroupPatchValues(update *profilepb.UpdateGroupRequest, op string, raw json.RawMessage) error {
+	var values scimGroup
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return handler.NewStatusError(http.StatusBadRequest, "invalid patch value")
+	}
+	if values.DisplayName != "" {
+		update.DisplayName = &types.StringValue{Value: values.DisplayName}
+	}
+	if values.ExternalID != "" {
+		update.ExternalID = &types.StringValue{Value: values.ExternalID}
+	}
+	if values.Members == nil {
+		return nil
+	}
+	memberIDs, err := scimMemberIDs(values.Members)
+	if err != nil {
+		return err
+	}
+	if op == "replace" {
+		update.ReplaceMembers = true
+		update.MemberIDs = memberIDs
+	} else {
+		update.AddMemberIDs = append(update.AddMemberIDs, memberIDs...)
+	}
+	return nil
+}
+
+func (s *scimServer) patchGroup(w http.ResponseWriter, r *http.Request, id uuid.UUID) error {
+	var req scimPatchOp
+	if err := decodeSCIMBody(r, &req); err != nil {
+		return err
+	}
+
+	update := &profilepb.UpdateGroupRequest{ID: utils.ProtoFromUUID(id)}
+	for _, patch := range req.Operations {
+		op := strings.ToLower(patch.Op)
+		path := strings.ToLower(patch.Path)
+		var members []scimMember
+		if path == "members" && patch.Value != nil {
+			if err := json.Unmarshal(patch.Value, &members); err != nil {
+				return handler.NewStatusError(http.StatusBadRequest, "invalid members")
+			}
+		}
+		memberIDs, err := scimMemberIDs(members)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case path == "" && (op == "add" || op == "replace"):
+			if err := applyGroupPatchValues(update, op, patch.Value); err != nil {
+				return err
+			}
+		case path == "displayname" && op == "replace":
+			var name string
+			if err := json.Unmarshal(patch.Value, &name); err != nil {
+				return handler.NewStatusError(http.StatusBadRequest, "invalid displayName")
+			}
+			update.DisplayName = &types.StringValue{Value: name}
+		case path == "externalid" && op == "replace":
+			var externalID string
+			if err := json.Unmarshal(patch.Value, &externalID); err != nil {
+				return handler.NewStatusError(http.StatusBadRequest, "invalid externalId")
+			}
+			update.ExternalID = &types.StringValue{Value: externalID}
+		case path == "members" && op == "add":
+			update.AddMemberIDs = append(update.AddMemberIDs, memberIDs...)
+		case path == "members" && op == "replace":
+			update.ReplaceMembers = true
+			update.MemberIDs = memberIDs
+		case path == "members" && op == "remove" && patch.Value == nil:
+			// Removing the members attribute removes all of the members.
+			update.ReplaceMembers = true
+			update.MemberIDs = nil
+		case path == "members" && op == "remove":
+			update.RemoveMemberIDs = append(update.RemoveMemberIDs, memberIDs...)
+		case strings.HasPrefix(path, "members[value eq ") && op == "remove":
+			value := strings.Trim(strings.TrimSuffix(patch.Path[len("members[value eq "):], "]"), `"`)
+			memberIDs, err := scimMemberIDs([]scimMember{{Value: value}})
+			if err != nil {
+				return err
+			}
+			update.RemoveMemberIDs = append(update.RemoveMemberIDs, memberIDs...)
+		default:
+			return handler.NewStatusError(http.StatusBadRequest, fmt.Sprintf("unsupported patch operation '%s %s'", patch.Op, patch.Path))
+		}
+	}
+	return s.updateGroup(w, update)
+}
+
+func (s *scimServer) deleteGroup(w http.ResponseWriter, id uuid.UUID) error {
+	if _, err := s.env.OrgClient().DeleteGroup(s.ctx, utils.ProtoFromUUID(id)); err != nil {
+		return scimStatusFromError(err, "Failed to delete group")
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
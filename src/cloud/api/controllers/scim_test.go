@@ -0,0 +1,275 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/shared/services/handler"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const scimTestUserID = "7ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+func expectSCIMAPIKey(t *testing.T, mockClients *testutils.MockAPIClients, isAPIUser bool) {
+	claims := testingutils.GenerateTestClaims(t)
+	claims.GetUserClaims().IsAPIUser = isAPIUser
+	mockClients.MockAuth.EXPECT().GetAugmentedTokenForAPIKey(gomock.Any(), &authpb.GetAugmentedTokenForAPIKeyRequest{
+		APIKey:   "test-api-key",
+		ClientIP: "10.0.0.1",
+	}).Return(&authpb.GetAugmentedTokenForAPIKeyResponse{Token: testingutils.SignPBClaims(t, claims, "jwt-key")}, nil)
+}
+
+func serveSCIM(t *testing.T, env http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer test-api-key")
+	req.RemoteAddr = "10.0.0.1:1234"
+	rr := httptest.NewRecorder()
+	env.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSCIMHandler_RequiresAPIKey(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	expectSCIMAPIKey(t, mockClients, false)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "GET", "/api/scim/v2/Users", "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "application/scim+json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "urn:ietf:params:scim:api:messages:2.0:Error")
+}
+
+func TestSCIMHandler_RejectsScopedAPIKey(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	claims := testingutils.GenerateTestClaims(t)
+	claims.GetUserClaims().IsAPIUser = true
+	claims.Scopes = append(claims.Scopes, apikeyscope.TokenScope, apikeyscope.ScriptWrite)
+	mockClients.MockAuth.EXPECT().GetAugmentedTokenForAPIKey(gomock.Any(), gomock.Any()).
+		Return(&authpb.GetAugmentedTokenForAPIKeyResponse{Token: testingutils.SignPBClaims(t, claims, "jwt-key")}, nil)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "GET", "/api/scim/v2/Users", "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestSCIMHandler_RejectsNonAdminAPIKey(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	claims := testingutils.GenerateTestClaims(t)
+	claims.GetUserClaims().IsAPIUser = true
+	claims.Scopes = append(claims.Scopes, orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Viewer}})...)
+	mockClients.MockAuth.EXPECT().GetAugmentedTokenForAPIKey(gomock.Any(), gomock.Any()).
+		Return(&authpb.GetAugmentedTokenForAPIKeyResponse{Token: testingutils.SignPBClaims(t, claims, "jwt-key")}, nil)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "GET", "/api/scim/v2/Users", "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "org admin")
+}
+
+func TestSCIMHandler_CreateUser(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	expectSCIMAPIKey(t, mockClients, true)
+	mockClients.MockProfile.EXPECT().CreateUser(gomock.Any(), &profilepb.CreateUserRequest{
+		OrgID:            utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		FirstName:        "Alice",
+		LastName:         "Smith",
+		Email:            "alice@example.com",
+		IdentityProvider: "saml",
+		AuthProviderID:   "saml|" + testingutils.TestOrgID + "|alice",
+	}).Return(utils.ProtoFromUUIDStrOrNil(scimTestUserID), nil)
+	mockClients.MockProfile.EXPECT().UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+		ID:            utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+		IsApproved:    &types.BoolValue{Value: true},
+		IsDeactivated: &types.BoolValue{Value: false},
+	}).Return(&profilepb.UserInfo{
+		ID:             utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+		OrgID:          utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		FirstName:      "Alice",
+		LastName:       "Smith",
+		Email:          "alice@example.com",
+		AuthProviderID: "saml|" + testingutils.TestOrgID + "|alice",
+		IsApproved:     true,
+	}, nil)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "POST", "/api/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "alice",
+		"name": {"givenName": "Alice", "familyName": "Smith"},
+		"emails": [{"value": "alice@example.com", "primary": true}],
+		"active": true
+	}`)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var user map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &user))
+	assert.Equal(t, scimTestUserID, user["id"])
+	assert.Equal(t, "alice", user["userName"])
+	assert.Equal(t, true, user["active"])
+}
+
+func TestSCIMHandler_ListUsersWithFilter(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	expectSCIMAPIKey(t, mockClients, true)
+	mockClients.MockOrg.EXPECT().GetUsersInOrg(gomock.Any(), &profilepb.GetUsersInOrgRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+	}).Return(&profilepb.GetUsersInOrgResponse{Users: []*profilepb.UserInfo{
+		{
+			ID:             utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+			Email:          "alice@example.com",
+			AuthProviderID: "saml|" + testingutils.TestOrgID + "|alice",
+		},
+		{
+			ID:             utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
+			Email:          "bob@example.com",
+			AuthProviderID: "google-oauth2|123",
+		},
+	}}, nil)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "GET", `/api/scim/v2/Users?filter=userName+eq+"Alice"`, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp struct {
+		TotalResults int                      `json:"totalResults"`
+		Resources    []map[string]interface{} `json:"Resources"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.TotalResults)
+	require.Len(t, resp.Resources, 1)
+	assert.Equal(t, scimTestUserID, resp.Resources[0]["id"])
+}
+
+func TestSCIMHandler_DeactivateUser(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	userInfo := &profilepb.UserInfo{
+		ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+		OrgID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		Email: "alice@example.com",
+	}
+	expectSCIMAPIKey(t, mockClients, true)
+	mockClients.MockProfile.EXPECT().GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).Return(userInfo, nil)
+	mockClients.MockProfile.EXPECT().UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+		ID:            utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+		IsDeactivated: &types.BoolValue{Value: true},
+	}).Return(&profilepb.UserInfo{
+		ID:            userInfo.ID,
+		OrgID:         userInfo.OrgID,
+		Email:         userInfo.Email,
+		IsDeactivated: true,
+	}, nil)
+
+	// Some identity providers send booleans as strings.
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "PATCH", "/api/scim/v2/Users/"+scimTestUserID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "path": "active", "value": "False"}]
+	}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"active":false`)
+}
+
+func TestSCIMHandler_GetUserInOtherOrg(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	expectSCIMAPIKey(t, mockClients, true)
+	mockClients.MockProfile.EXPECT().GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).Return(&profilepb.UserInfo{
+		ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+		OrgID: utils.ProtoFromUUIDStrOrNil("9ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+	}, nil)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "GET", "/api/scim/v2/Users/"+scimTestUserID, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestSCIMHandler_DeleteLastUser(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	userInfo := &profilepb.UserInfo{
+		ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+		OrgID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+	}
+	expectSCIMAPIKey(t, mockClients, true)
+	mockClients.MockProfile.EXPECT().GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).Return(userInfo, nil)
+	mockClients.MockOrg.EXPECT().GetUsersInOrg(gomock.Any(), gomock.Any()).
+		Return(&profilepb.GetUsersInOrgResponse{Users: []*profilepb.UserInfo{userInfo}}, nil)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "DELETE", "/api/scim/v2/Users/"+scimTestUserID, "")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestSCIMHandler_PatchGroupMembers(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	groupID := "8ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	expectSCIMAPIKey(t, mockClients, true)
+	mockClients.MockOrg.EXPECT().UpdateGroup(gomock.Any(), &profilepb.UpdateGroupRequest{
+		ID:              utils.ProtoFromUUIDStrOrNil(groupID),
+		DisplayName:     &types.StringValue{Value: "platform"},
+		AddMemberIDs:    []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(scimTestUserID)},
+		RemoveMemberIDs: []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)},
+	}).Return(&profilepb.GroupInfo{
+		ID:          utils.ProtoFromUUIDStrOrNil(groupID),
+		OrgID:       utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		DisplayName: "platform",
+		MemberIDs:   []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(scimTestUserID)},
+	}, nil)
+
+	rr := serveSCIM(t, handler.New(env, controllers.SCIMHandler), "PATCH", "/api/scim/v2/Groups/"+groupID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "replace", "path": "displayName", "value": "platform"},
+			{"op": "add", "path": "members", "value": [{"value": "`+scimTestUserID+`"}]},
+			{"op": "remove", "path": "members[value eq \"`+testingutils.TestUserID+`\"]"}
+		]
+	}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var group map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &group))
+	assert.Equal(t, "platform", group["displayName"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"value": scimTestUserID}}, group["members"])
+}
@@ -21,8 +21,12 @@ package controllers
 import (
 	"context"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	"px.dev/pixie/src/shared/services/fieldmask"
 	"px.dev/pixie/src/utils"
 )
 
@@ -83,6 +87,10 @@ func (s *ScriptMgrServer) GetLiveViewContents(ctx context.Context, req *cloudpb.
 
 // GetScripts returns a list of all available scripts.
 func (s *ScriptMgrServer) GetScripts(ctx context.Context, req *cloudpb.GetScriptsReq) (*cloudpb.GetScriptsResp, error) {
+	if err := fieldmask.Validate(req.ReadMask, &cloudpb.ScriptMetadata{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+
 	ctx, err := contextWithAuthToken(ctx)
 	if err != nil {
 		return nil, err
@@ -104,6 +112,9 @@ func (s *ScriptMgrServer) GetScripts(ctx context.Context, req *cloudpb.GetScript
 			HasLiveView: script.HasLiveView,
 		}
 	}
+	if err := fieldmask.Apply(req.ReadMask, resp.Scripts); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
 	return resp, nil
 }
 
@@ -174,6 +174,30 @@ func TestScriptMgr(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "GetScripts only returns the fields in the read mask.",
+			endpoint: "GetScripts",
+			ctx:      CreateTestContext(),
+			smReq:    &scriptmgrpb.GetScriptsReq{},
+			smResp: &scriptmgrpb.GetScriptsResp{
+				Scripts: []*scriptmgrpb.ScriptMetadata{
+					{
+						ID:          utils.ProtoFromUUID(ID1),
+						Name:        "script1",
+						Desc:        "script1 desc",
+						HasLiveView: true,
+					},
+				},
+			},
+			req: &cloudpb.GetScriptsReq{ReadMask: &types.FieldMask{Paths: []string{"name"}}},
+			expectedResp: &cloudpb.GetScriptsResp{
+				Scripts: []*cloudpb.ScriptMetadata{
+					{
+						Name: "script1",
+					},
+				},
+			},
+		},
 		{
 			name:     "GetScriptContents correctly translates between scriptmgr and cloudpb.",
 			endpoint: "GetScriptContents",
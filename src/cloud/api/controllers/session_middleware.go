@@ -22,6 +22,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -29,10 +30,14 @@ import (
 	"github.com/spf13/viper"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/cloud/api/apienv"
 	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/cloud/shared/patscope"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/httpmiddleware"
 	"px.dev/pixie/src/shared/services/utils"
@@ -47,6 +52,11 @@ var (
 	ErrFetchAugmentedTokenFailedUnauthenticated = errors.New("failed to fetch token - unauthenticated")
 	// ErrParseAuthToken occurs when we are unable to parse the augmented token with the signing key.
 	ErrParseAuthToken = errors.New("Failed to parse token")
+	// ErrTokenScopeInsufficient occurs when a personal access token or scoped API key is used for a call that its
+	// scopes don't allow.
+	ErrTokenScopeInsufficient = errors.New("the scopes of the token don't allow this request")
+	// ErrOrgRoleInsufficient occurs when the role of the user in their org doesn't allow the request.
+	ErrOrgRoleInsufficient = errors.New("the role of the user doesn't allow this request")
 	// ErrCSRFOriginCheckFailed occurs when a request with seesion cookie is missing the origin field, or is invalid.
 	ErrCSRFOriginCheckFailed = errors.New("CSRF check missing origin")
 	// TODO(zasgar): enable after we add this in the UI.
@@ -78,6 +88,8 @@ func WithAugmentedAuthMiddleware(env apienv.APIEnv, next http.Handler) http.Hand
 			if err == ErrFetchAugmentedTokenFailedUnauthenticated || err == ErrGetAuthTokenFailed ||
 				err == ErrCSRFOriginCheckFailed {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
+			} else if err == ErrTokenScopeInsufficient || err == ErrOrgRoleInsufficient {
+				http.Error(w, err.Error(), http.StatusForbidden)
 			} else {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 			}
@@ -127,6 +139,84 @@ func getTokenFromRequest(env apienv.APIEnv, r *http.Request) (string, error) {
 }
 
 func getAugmentedToken(env apienv.APIEnv, r *http.Request) (string, error) {
+	token, err := fetchAugmentedToken(env, r)
+	if err != nil {
+		return "", err
+	}
+	if err := checkTokenScopes(env, token, r); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkTokenScopes makes sure that tokens issued for personal access tokens and scoped API keys are only
+// used for the requests that their scopes allow, and that the role of the user allows the request.
+func checkTokenScopes(env apienv.APIEnv, token string, r *http.Request) error {
+	aCtx := authcontext.New()
+	if err := aCtx.UseJWTAuth(env.JWTSigningKey(), token, viper.GetString("domain_name")); err != nil {
+		return ErrParseAuthToken
+	}
+
+	path := ""
+	if r.URL != nil {
+		path = r.URL.Path
+	}
+	return checkScopes(aCtx.Claims.Scopes, path)
+}
+
+func checkScopes(scopes []string, path string) error {
+	if patscope.IsPersonalAccessToken(scopes) && !patscope.Allows(scopes, path) {
+		return ErrTokenScopeInsufficient
+	}
+	if apikeyscope.IsScoped(scopes) && !apikeyscope.Allows(scopes, path) {
+		return ErrTokenScopeInsufficient
+	}
+	if !orgrole.Allows(scopes, path) {
+		return ErrOrgRoleInsufficient
+	}
+	return nil
+}
+
+// AuthorizeGRPC checks that the scopes of the augmented token allow the GRPC method that is called.
+// It is run by the GRPC server for every authenticated call.
+func AuthorizeGRPC(sCtx *authcontext.AuthContext) error {
+	if sCtx.Claims == nil {
+		return status.Error(codes.Unauthenticated, "missing auth claims")
+	}
+	if err := checkScopes(sCtx.Claims.Scopes, sCtx.Path); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+// clientIP returns the IP of the client that made the request, preferring the IP that the load
+// balancer forwarded.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIPGRPC returns the IP of the client that made the gRPC request.
+func clientIPGRPC(ctx context.Context) string {
+	r := &http.Request{Header: http.Header{}}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("x-forwarded-for") {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+	}
+	return clientIP(r)
+}
+
+func fetchAugmentedToken(env apienv.APIEnv, r *http.Request) (string, error) {
 	referer, err := url.Parse(r.Referer())
 	if err != nil {
 		return "", err
@@ -155,7 +245,8 @@ func getAugmentedToken(env apienv.APIEnv, r *http.Request) (string, error) {
 			fmt.Sprintf("bearer %s", svcClaims))
 
 		apiKeyResp, err := env.AuthClient().GetAugmentedTokenForAPIKey(ctxWithCreds, &authpb.GetAugmentedTokenForAPIKeyRequest{
-			APIKey: apiHeader,
+			APIKey:   apiHeader,
+			ClientIP: clientIP(r),
 		})
 		if err == nil {
 			// Get user/org info from augmented token.
@@ -246,12 +337,16 @@ func GetAugmentedTokenGRPC(ctx context.Context, env apienv.APIEnv) (string, erro
 	}
 
 	r := &http.Request{Header: http.Header{}, URL: urlPath}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
 	for k, v := range md {
 		for _, val := range v {
 			r.Header.Add(k, val)
 		}
 	}
-	return getAugmentedToken(env, r)
+	// The scopes of the token are checked by AuthorizeGRPC once the server has authenticated the call.
+	return fetchAugmentedToken(env, r)
 }
 
 // sameOrigin returns true if URLs a and b share the same origin (but not subdomain). The same
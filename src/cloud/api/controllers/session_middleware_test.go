@@ -37,6 +37,7 @@ import (
 	"px.dev/pixie/src/cloud/api/controllers/testutils"
 	"px.dev/pixie/src/cloud/auth/authpb"
 	mock_auth "px.dev/pixie/src/cloud/auth/authpb/mock"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/utils/testingutils"
 )
@@ -293,3 +294,113 @@ func TestWithAugmentedAuthMiddlewareWithAPIKey(t *testing.T) {
 	handler.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
 }
+
+func TestWithAugmentedAuthMiddlewareWithPersonalAccessToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		expectCode int
+	}{
+		{
+			name:       "allowed",
+			scopes:     []string{"cloud:write"},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "scope doesn't allow the request",
+			scopes:     []string{"cloud:read"},
+			expectCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+			defer cleanup()
+
+			claims := testingutils.GenerateTestClaims(t)
+			claims.Scopes = append(claims.Scopes, "pat")
+			claims.Scopes = append(claims.Scopes, test.scopes...)
+			testAugmentedToken := testingutils.SignPBClaims(t, claims, "jwt-key")
+
+			mockClients.MockAuth.EXPECT().GetAugmentedTokenForAPIKey(
+				gomock.Any(), gomock.Any()).Do(
+				func(c context.Context, request *authpb.GetAugmentedTokenForAPIKeyRequest) {
+					assert.Equal(t, "px-pat-abc", request.APIKey)
+					assert.Equal(t, "10.0.0.1", request.ClientIP)
+				}).Return(
+				&authpb.GetAugmentedTokenForAPIKeyResponse{
+					Token: testAugmentedToken,
+				}, nil)
+
+			req, err := http.NewRequest("POST", "https://pixie.dev.pixielabs.dev/api/graphql", nil)
+			require.NoError(t, err)
+			req.Header.Add("pixie-api-key", "px-pat-abc")
+			req.Header.Add("X-Forwarded-For", "10.0.0.1, 10.1.0.1")
+
+			rr := httptest.NewRecorder()
+			handler := controllers.WithAugmentedAuthMiddleware(env, callOKTestHandler(t))
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, test.expectCode, rr.Code)
+		})
+	}
+}
+
+func TestWithAugmentedAuthMiddlewareWithScopedAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		scopes     []string
+		expectCode int
+	}{
+		{
+			name:       "unscoped key",
+			path:       "/api/graphql",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "script scope allows running scripts",
+			path:       "/px.api.vizierpb.VizierService/ExecuteScript",
+			scopes:     []string{apikeyscope.TokenScope, apikeyscope.ScriptRead},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "script scope doesn't allow graphql",
+			path:       "/api/graphql",
+			scopes:     []string{apikeyscope.TokenScope, apikeyscope.ScriptRead},
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "deploy scope doesn't allow running scripts",
+			path:       "/px.api.vizierpb.VizierService/ExecuteScript",
+			scopes:     []string{apikeyscope.TokenScope, apikeyscope.Deploy},
+			expectCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+			defer cleanup()
+
+			claims := testingutils.GenerateTestClaims(t)
+			claims.GetUserClaims().IsAPIUser = true
+			claims.Scopes = append(claims.Scopes, test.scopes...)
+			testAugmentedToken := testingutils.SignPBClaims(t, claims, "jwt-key")
+
+			mockClients.MockAuth.EXPECT().GetAugmentedTokenForAPIKey(gomock.Any(), gomock.Any()).Return(
+				&authpb.GetAugmentedTokenForAPIKeyResponse{
+					Token: testAugmentedToken,
+				}, nil)
+
+			req, err := http.NewRequest("POST", "https://pixie.dev.pixielabs.dev"+test.path, nil)
+			require.NoError(t, err)
+			req.Header.Add("pixie-api-key", "px-api-abc")
+
+			rr := httptest.NewRecorder()
+			handler := controllers.WithAugmentedAuthMiddleware(env, callOKTestHandler(t))
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, test.expectCode, rr.Code)
+		})
+	}
+}
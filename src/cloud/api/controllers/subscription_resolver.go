@@ -0,0 +1,315 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+// defaultClusterPollInterval is how often the cluster subscriptions check the clusters for changes, unless
+// the GraphQLEnv specifies otherwise.
+const defaultClusterPollInterval = 2 * time.Second
+
+// ClusterStatus emits the cluster, and again whenever its status changes.
+func (q *QueryResolver) ClusterStatus(ctx context.Context, args *clusterArgs) (<-chan *ClusterInfoResolver, error) {
+	req := &cloudpb.GetClusterInfoRequest{ID: utils.ProtoFromUUIDStrOrNil(string(args.ID))}
+	resp, err := q.Env.VizierClusterInfo.GetClusterInfo(ctx, req)
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+	if len(resp.Clusters) != 1 {
+		return nil, errors.New("org has no matching clusters")
+	}
+	return q.watchClusters(ctx, req, resp.Clusters), nil
+}
+
+// ClusterUpdates emits each cluster of the org, and again whenever its status changes.
+func (q *QueryResolver) ClusterUpdates(ctx context.Context) (<-chan *ClusterInfoResolver, error) {
+	req := &cloudpb.GetClusterInfoRequest{}
+	resp, err := q.Env.VizierClusterInfo.GetClusterInfo(ctx, req)
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+	return q.watchClusters(ctx, req, resp.Clusters), nil
+}
+
+// watchClusters polls the clusters, and emits each cluster whenever it changed since it was last emitted. The
+// initial clusters are emitted first.
+func (q *QueryResolver) watchClusters(ctx context.Context, req *cloudpb.GetClusterInfoRequest, initial []*cloudpb.ClusterInfo) <-chan *ClusterInfoResolver {
+	interval := q.Env.ClusterPollInterval
+	if interval == 0 {
+		interval = defaultClusterPollInterval
+	}
+
+	ch := make(chan *ClusterInfoResolver)
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		last := make(map[string]*cloudpb.ClusterInfo)
+		clusters := initial
+		for {
+			for _, cluster := range clusters {
+				if !clusterChanged(last, cluster) {
+					continue
+				}
+				resolver, err := clusterInfoToResolver(cluster)
+				if err != nil {
+					log.WithError(err).Error("Failed to convert cluster info")
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- resolver:
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			resp, err := q.Env.VizierClusterInfo.GetClusterInfo(ctx, req)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.WithError(err).Info("Failed to poll clusters for subscription")
+				}
+				clusters = nil
+				continue
+			}
+			clusters = resp.Clusters
+		}
+	}()
+	return ch
+}
+
+// clusterChanged returns whether the cluster changed since it was last seen, and records it. The heartbeats of
+// the cluster don't count as changes.
+func clusterChanged(last map[string]*cloudpb.ClusterInfo, cluster *cloudpb.ClusterInfo) bool {
+	c := proto.Clone(cluster).(*cloudpb.ClusterInfo)
+	c.LastHeartbeatNs = 0
+	id := utils.UUIDFromProtoOrNil(c.ID).String()
+	if prev, ok := last[id]; ok && proto.Equal(prev, c) {
+		return false
+	}
+	last[id] = c
+	return true
+}
+
+// DeploymentProgressResolver resolves the progress of the deployment or update of a cluster.
+type DeploymentProgressResolver struct {
+	clusterID            uuid.UUID
+	Status               string
+	StatusMessage        string
+	VizierVersion        string
+	NumNodes             int32
+	NumInstrumentedNodes int32
+	Done                 bool
+}
+
+// ClusterID returns the ID of the cluster.
+func (d *DeploymentProgressResolver) ClusterID() graphql.ID {
+	return graphql.ID(d.clusterID.String())
+}
+
+func deploymentInProgress(status string) bool {
+	return status == cloudpb.CS_UPDATING.String() || status == cloudpb.CS_CONNECTED.String()
+}
+
+func deploymentDone(status string) bool {
+	return status == cloudpb.CS_HEALTHY.String() || status == cloudpb.CS_DEGRADED.String() ||
+		status == cloudpb.CS_UPDATE_FAILED.String()
+}
+
+// DeploymentProgress emits the progress of the deployment or update of the cluster whenever it changes. It ends
+// once a deployment or update that was in progress ends.
+func (q *QueryResolver) DeploymentProgress(ctx context.Context, args *clusterArgs) (<-chan *DeploymentProgressResolver, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	clusters, err := q.ClusterStatus(ctx, args)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	ch := make(chan *DeploymentProgressResolver)
+	go func() {
+		defer close(ch)
+		// Stops watching the cluster once the deployment ends.
+		defer cancel()
+		var last DeploymentProgressResolver
+		inProgress := false
+		for cluster := range clusters {
+			progress := DeploymentProgressResolver{
+				clusterID:            cluster.clusterID,
+				Status:               cluster.Status,
+				StatusMessage:        cluster.StatusMessage,
+				VizierVersion:        cluster.VizierVersion,
+				NumNodes:             cluster.NumNodes,
+				NumInstrumentedNodes: cluster.NumInstrumentedNodes,
+				Done:                 deploymentDone(cluster.Status),
+			}
+			if progress == last {
+				continue
+			}
+			last = progress
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- &progress:
+			}
+			if inProgress && progress.Done {
+				return
+			}
+			inProgress = inProgress || deploymentInProgress(progress.Status)
+		}
+	}()
+	return ch, nil
+}
+
+// ScriptExecutionResolver resolves a script run on a cluster through Pixie Cloud.
+type ScriptExecutionResolver struct {
+	requestID    uuid.UUID
+	clusterID    uuid.UUID
+	userID       uuid.UUID
+	State        string
+	Mutation     bool
+	ErrorMessage string
+	StartTimeMs  float64
+	EndTimeMs    *float64
+}
+
+// RequestID returns the ID of the request that ran the script.
+func (s *ScriptExecutionResolver) RequestID() graphql.ID {
+	return graphql.ID(s.requestID.String())
+}
+
+// ClusterID returns the ID of the cluster the script ran on.
+func (s *ScriptExecutionResolver) ClusterID() graphql.ID {
+	return graphql.ID(s.clusterID.String())
+}
+
+// UserID returns the ID of the user who ran the script.
+func (s *ScriptExecutionResolver) UserID() graphql.ID {
+	return graphql.ID(s.userID.String())
+}
+
+func scriptExecutionToResolver(exec *messagespb.ScriptExecution) *ScriptExecutionResolver {
+	resolver := &ScriptExecutionResolver{
+		requestID:    utils.UUIDFromProtoOrNil(exec.RequestID),
+		clusterID:    utils.UUIDFromProtoOrNil(exec.VizierID),
+		userID:       utils.UUIDFromProtoOrNil(exec.UserID),
+		State:        "SES_" + strings.TrimPrefix(exec.State.String(), "STATE_"),
+		Mutation:     exec.Mutation,
+		ErrorMessage: exec.ErrorMessage,
+		StartTimeMs:  float64(exec.StartTimeNs) / 1e6,
+	}
+	if exec.EndTimeNs != 0 {
+		endTimeMs := float64(exec.EndTimeNs) / 1e6
+		resolver.EndTimeMs = &endTimeMs
+	}
+	return resolver
+}
+
+type scriptExecutionsArgs struct {
+	ClusterID *graphql.ID
+}
+
+// ScriptExecutions emits the scripts that are run on the clusters of the org through Pixie Cloud, when they
+// start and when they end.
+func (q *QueryResolver) ScriptExecutions(ctx context.Context, args *scriptExecutionsArgs) (<-chan *ScriptExecutionResolver, error) {
+	if q.Env.NATSConn == nil {
+		return nil, errors.New("script executions are not available")
+	}
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgID, err := uuid.FromString(sCtx.Claims.GetUserClaims().GetOrgID())
+	if err != nil || orgID == uuid.Nil {
+		return nil, errors.New("user does not belong to an org")
+	}
+	var clusterID uuid.UUID
+	if args.ClusterID != nil {
+		clusterID, err = uuid.FromString(string(*args.ClusterID))
+		if err != nil {
+			return nil, errors.New("invalid cluster ID")
+		}
+	}
+	scopes := sCtx.Claims.GetScopes()
+
+	natsCh := make(chan *nats.Msg, 64)
+	sub, err := q.Env.NATSConn.ChanSubscribe(messages.ScriptExecutionTopic(orgID), natsCh)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *ScriptExecutionResolver)
+	go func() {
+		defer close(ch)
+		defer func() {
+			if err := sub.Unsubscribe(); err != nil {
+				log.WithError(err).Error("Failed to unsubscribe from script executions")
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-natsCh:
+				exec := &messagespb.ScriptExecution{}
+				if err := exec.Unmarshal(msg.Data); err != nil {
+					log.WithError(err).Error("Failed to unmarshal script execution")
+					continue
+				}
+				vizierID := utils.UUIDFromProtoOrNil(exec.VizierID)
+				if clusterID != uuid.Nil && vizierID != clusterID {
+					continue
+				}
+				if !apikeyscope.AllowsCluster(scopes, vizierID) || !orgrole.AllowsCluster(scopes, vizierID) {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- scriptExecutionToResolver(exec):
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const testClusterID = "7ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+func clusterWithStatus(status cloudpb.ClusterStatus, heartbeatNs int64) *cloudpb.GetClusterInfoResponse {
+	return &cloudpb.GetClusterInfoResponse{
+		Clusters: []*cloudpb.ClusterInfo{
+			{
+				ID:              utils.ProtoFromUUIDStrOrNil(testClusterID),
+				Status:          status,
+				LastHeartbeatNs: heartbeatNs,
+				VizierVersion:   "0.14.0",
+				NumNodes:        3,
+			},
+		},
+	}
+}
+
+// nextResponse returns the data of the next response of the subscription, or nil if the subscription ended.
+func nextResponse(t *testing.T, ch <-chan interface{}) map[string]interface{} {
+	select {
+	case r, ok := <-ch:
+		if !ok {
+			return nil
+		}
+		resp := r.(*graphql.Response)
+		require.Empty(t, resp.Errors)
+		data := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(resp.Data, &data))
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for subscription response")
+	}
+	return nil
+}
+
+func TestClusterStatusSubscription(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	gqlEnv.ClusterPollInterval = time.Millisecond
+	ctx, cancel := context.WithCancel(CreateTestContext())
+	defer cancel()
+
+	req := &cloudpb.GetClusterInfoRequest{ID: utils.ProtoFromUUIDStrOrNil(testClusterID)}
+	gomock.InOrder(
+		mockClients.MockVizierClusterInfo.EXPECT().GetClusterInfo(gomock.Any(), req).
+			Return(clusterWithStatus(cloudpb.CS_HEALTHY, 1), nil),
+		// Only the heartbeat changed, so nothing is emitted.
+		mockClients.MockVizierClusterInfo.EXPECT().GetClusterInfo(gomock.Any(), req).
+			Return(clusterWithStatus(cloudpb.CS_HEALTHY, 2), nil),
+		mockClients.MockVizierClusterInfo.EXPECT().GetClusterInfo(gomock.Any(), req).
+			Return(clusterWithStatus(cloudpb.CS_UNHEALTHY, 3), nil).AnyTimes(),
+	)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	ch, err := gqlSchema.Subscribe(ctx, `
+		subscription {
+			clusterStatus(id: "7ba7b810-9dad-11d1-80b4-00c04fd430c8") {
+				id
+				status
+			}
+		}
+	`, "", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"clusterStatus": map[string]interface{}{"id": testClusterID, "status": "CS_HEALTHY"},
+	}, nextResponse(t, ch))
+	assert.Equal(t, map[string]interface{}{
+		"clusterStatus": map[string]interface{}{"id": testClusterID, "status": "CS_UNHEALTHY"},
+	}, nextResponse(t, ch))
+}
+
+func TestDeploymentProgressSubscription(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	gqlEnv.ClusterPollInterval = time.Millisecond
+	ctx, cancel := context.WithCancel(CreateTestContext())
+	defer cancel()
+
+	req := &cloudpb.GetClusterInfoRequest{ID: utils.ProtoFromUUIDStrOrNil(testClusterID)}
+	gomock.InOrder(
+		mockClients.MockVizierClusterInfo.EXPECT().GetClusterInfo(gomock.Any(), req).
+			Return(clusterWithStatus(cloudpb.CS_HEALTHY, 1), nil),
+		mockClients.MockVizierClusterInfo.EXPECT().GetClusterInfo(gomock.Any(), req).
+			Return(clusterWithStatus(cloudpb.CS_UPDATING, 2), nil),
+		mockClients.MockVizierClusterInfo.EXPECT().GetClusterInfo(gomock.Any(), req).
+			Return(clusterWithStatus(cloudpb.CS_HEALTHY, 3), nil).AnyTimes(),
+	)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	ch, err := gqlSchema.Subscribe(ctx, `
+		subscription {
+			deploymentProgress(id: "7ba7b810-9dad-11d1-80b4-00c04fd430c8") {
+				clusterID
+				status
+				numNodes
+				done
+			}
+		}
+	`, "", nil)
+	require.NoError(t, err)
+
+	progress := func(status string, done bool) map[string]interface{} {
+		return map[string]interface{}{
+			"deploymentProgress": map[string]interface{}{
+				"clusterID": testClusterID, "status": status, "numNodes": float64(3), "done": done,
+			},
+		}
+	}
+	// The subscription only ends once an update that was in progress ends.
+	assert.Equal(t, progress("CS_HEALTHY", true), nextResponse(t, ch))
+	assert.Equal(t, progress("CS_UPDATING", false), nextResponse(t, ch))
+	assert.Equal(t, progress("CS_HEALTHY", true), nextResponse(t, ch))
+	assert.Nil(t, nextResponse(t, ch))
+}
+
+func TestScriptExecutionsSubscription(t *testing.T) {
+	gqlEnv, _, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+	gqlEnv.NATSConn = nc
+	ctx, cancel := context.WithCancel(CreateTestContext())
+	defer cancel()
+
+	gqlSchema := LoadSchema(gqlEnv)
+	ch, err := gqlSchema.Subscribe(ctx, `
+		subscription {
+			scriptExecutions(clusterID: "7ba7b810-9dad-11d1-80b4-00c04fd430c8") {
+				clusterID
+				state
+				errorMessage
+				endTimeMs
+			}
+		}
+	`, "", nil)
+	require.NoError(t, err)
+
+	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	publish := func(clusterID string, state messagespb.ScriptExecution_State, errorMessage string, endTimeNs int64) {
+		b, err := (&messagespb.ScriptExecution{
+			RequestID:    utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+			VizierID:     utils.ProtoFromUUIDStrOrNil(clusterID),
+			OrgID:        utils.ProtoFromUUID(orgID),
+			State:        state,
+			ErrorMessage: errorMessage,
+			StartTimeNs:  1e6,
+			EndTimeNs:    endTimeNs,
+		}).Marshal()
+		require.NoError(t, err)
+		require.NoError(t, nc.Publish(messages.ScriptExecutionTopic(orgID), b))
+	}
+
+	// The subscription is set up asynchronously, so keep publishing until it is received.
+	var data map[string]interface{}
+	require.Eventually(t, func() bool {
+		// Executions on other clusters are filtered out.
+		publish("8ba7b810-9dad-11d1-80b4-00c04fd430c8", messagespb.STATE_RUNNING, "", 0)
+		publish(testClusterID, messagespb.STATE_FAILED, "script failed", 2e6)
+		select {
+		case r := <-ch:
+			resp := r.(*graphql.Response)
+			require.Empty(t, resp.Errors)
+			require.NoError(t, json.Unmarshal(resp.Data, &data))
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+
+	assert.Equal(t, map[string]interface{}{
+		"scriptExecutions": map[string]interface{}{
+			"clusterID": testClusterID, "state": "SES_FAILED", "errorMessage": "script failed", "endTimeMs": float64(2),
+		},
+	}, data)
+}
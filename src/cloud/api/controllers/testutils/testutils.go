@@ -46,6 +46,7 @@ type MockCloudClients struct {
 	MockUser              *mock_cloudpb.MockUserServiceServer
 	MockAPIKey            *mock_cloudpb.MockAPIKeyManagerServer
 	MockPlugin            *mock_cloudpb.MockPluginServiceServer
+	MockSavedQuery        *mock_cloudpb.MockSavedQueryServiceServer
 }
 
 // CreateTestGraphQLEnv creates a test graphql environment and mock clients.
@@ -60,6 +61,7 @@ func CreateTestGraphQLEnv(t *testing.T) (controllers.GraphQLEnv, *MockCloudClien
 	os := mock_cloudpb.NewMockOrganizationServiceServer(ctrl)
 	us := mock_cloudpb.NewMockUserServiceServer(ctrl)
 	ps := mock_cloudpb.NewMockPluginServiceServer(ctrl)
+	sqs := mock_cloudpb.NewMockSavedQueryServiceServer(ctrl)
 	gqlEnv := controllers.GraphQLEnv{
 		APIKeyMgr:             aps,
 		ArtifactTrackerServer: ats,
@@ -70,6 +72,7 @@ func CreateTestGraphQLEnv(t *testing.T) (controllers.GraphQLEnv, *MockCloudClien
 		OrgServer:             os,
 		UserServer:            us,
 		PluginServer:          ps,
+		SavedQueryServer:      sqs,
 	}
 	return gqlEnv, &MockCloudClients{
 		MockAPIKey:            aps,
@@ -81,6 +84,7 @@ func CreateTestGraphQLEnv(t *testing.T) (controllers.GraphQLEnv, *MockCloudClien
 		MockOrg:               os,
 		MockUser:              us,
 		MockPlugin:            ps,
+		MockSavedQuery:        sqs,
 	}, ctrl.Finish
 }
 
@@ -220,6 +220,14 @@ func (u *UserServiceServer) DeleteUser(ctx context.Context, req *cloudpb.DeleteU
 		return nil, errors.New("Unauthorized")
 	}
 
+	if req.DryRun {
+		affected, err := u.userDeletionResources(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &cloudpb.DeleteUserResponse{AffectedResources: affected}, nil
+	}
+
 	_, err = u.ProfileServiceClient.DeleteUser(ctx, &profilepb.DeleteUserRequest{
 		ID: req.ID,
 	})
@@ -229,3 +237,33 @@ func (u *UserServiceServer) DeleteUser(ctx context.Context, req *cloudpb.DeleteU
 
 	return &cloudpb.DeleteUserResponse{}, nil
 }
+
+// userDeletionResources returns the resources that are deleted along with the user. The org is deleted too if the
+// user is the last user in it.
+func (u *UserServiceServer) userDeletionResources(ctx context.Context, userID *uuidpb.UUID) ([]*cloudpb.AffectedResource, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, err := u.ProfileServiceClient.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	affected := []*cloudpb.AffectedResource{
+		affectedResource(affectedKindUser, userInfo.ID, userInfo.Email, affectedActionDelete),
+	}
+
+	users, err := u.OrgServiceClient.GetUsersInOrg(ctx, &profilepb.GetUsersInOrgRequest{OrgID: userInfo.OrgID})
+	if err != nil {
+		return nil, err
+	}
+	if len(users.Users) > 1 {
+		return affected, nil
+	}
+	orgInfo, err := u.OrgServiceClient.GetOrg(ctx, userInfo.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	return append(affected, affectedResource(affectedKindOrg, orgInfo.ID, orgInfo.OrgName, affectedActionDelete)), nil
+}
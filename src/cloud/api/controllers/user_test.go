@@ -278,3 +278,55 @@ func TestServer_DeleteUser(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_DeleteUser_DryRun(t *testing.T) {
+	userID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9")
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	tests := []struct {
+		name             string
+		usersInOrg       int
+		expectedAffected []*cloudpb.AffectedResource
+	}{
+		{
+			name:       "other users in org",
+			usersInOrg: 2,
+			expectedAffected: []*cloudpb.AffectedResource{
+				{Kind: "user", ID: userID, Name: "bob@test.com", Action: "delete"},
+			},
+		},
+		{
+			name:       "last user in org",
+			usersInOrg: 1,
+			expectedAffected: []*cloudpb.AffectedResource{
+				{Kind: "user", ID: userID, Name: "bob@test.com", Action: "delete"},
+				{Kind: "org", ID: orgID, Name: "test.com", Action: "delete"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+			defer cleanup()
+
+			mockClients.MockProfile.EXPECT().GetUser(gomock.Any(), userID).
+				Return(&profilepb.UserInfo{ID: userID, OrgID: orgID, Email: "bob@test.com"}, nil)
+			users := make([]*profilepb.UserInfo, tc.usersInOrg)
+			mockClients.MockOrg.EXPECT().GetUsersInOrg(gomock.Any(), &profilepb.GetUsersInOrgRequest{OrgID: orgID}).
+				Return(&profilepb.GetUsersInOrgResponse{Users: users}, nil)
+			if tc.usersInOrg == 1 {
+				mockClients.MockOrg.EXPECT().GetOrg(gomock.Any(), orgID).
+					Return(&profilepb.OrgInfo{ID: orgID, OrgName: "test.com"}, nil)
+			}
+
+			userServer := &controllers.UserServiceServer{mockClients.MockProfile, mockClients.MockOrg}
+			resp, err := userServer.DeleteUser(CreateTestContext(), &cloudpb.DeleteUserRequest{ID: userID, DryRun: true})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedAffected, resp.AffectedResources)
+		})
+	}
+}
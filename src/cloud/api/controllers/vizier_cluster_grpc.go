@@ -31,11 +31,14 @@ import (
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/orgrole"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/artifacts/versionspb"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/k8s/metadatapb"
 	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/fieldmask"
 	"px.dev/pixie/src/utils"
 )
 
@@ -71,6 +74,10 @@ func (v *VizierClusterInfo) GetClusterInfo(ctx context.Context, request *cloudpb
 		return nil, err
 	}
 
+	if err := fieldmask.Validate(request.ReadMask, &cloudpb.ClusterInfo{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+
 	ctx, err = contextWithAuthToken(ctx)
 	if err != nil {
 		return nil, err
@@ -87,7 +94,14 @@ func (v *VizierClusterInfo) GetClusterInfo(ctx context.Context, request *cloudpb
 		vzIDs = viziers.VizierIDs
 	}
 
-	return v.getClusterInfoForViziers(ctx, vzIDs)
+	resp, err := v.getClusterInfoForViziers(ctx, vzIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := fieldmask.Apply(request.ReadMask, resp.Clusters); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+	return resp, nil
 }
 
 func convertContainerState(cs metadatapb.ContainerState) cloudpb.ContainerState {
@@ -214,6 +228,9 @@ func (v *VizierClusterInfo) getClusterInfoForViziers(ctx context.Context, ids []
 			NumInstrumentedNodes:          vzInfo.NumInstrumentedNodes,
 			PreviousStatus:                prevS,
 			PreviousStatusTime:            vzInfo.PreviousStatusTime,
+			BridgeRTTNs:                   vzInfo.BridgeRTTNs,
+			NumBridgeReconnectsLastHour:   vzInfo.NumBridgeReconnectsLastHour,
+			NumDroppedMessagesLastHour:    vzInfo.NumDroppedMessagesLastHour,
 		})
 	}
 
@@ -230,7 +247,19 @@ func (v *VizierClusterInfo) getClusterInfoForViziers(ctx context.Context, ids []
 // GetClusterConnectionInfo returns information about connections to Vizier cluster.
 func (v *VizierClusterInfo) GetClusterConnectionInfo(ctx context.Context, request *cloudpb.GetClusterConnectionInfoRequest) (*cloudpb.GetClusterConnectionInfoResponse, error) {
 	id := request.ID
-	ctx, err := contextWithAuthToken(ctx)
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The token gives full access to the cluster, so only admins of the cluster may get it.
+	clusterID := utils.UUIDFromProtoOrNil(id)
+	if orgrole.ClusterRole(sCtx.Claims.Scopes, clusterID) != orgrole.Admin {
+		return nil, status.Error(codes.PermissionDenied, "only admins of the cluster may connect to it directly")
+	}
+	if !apikeyscope.AllowsCluster(sCtx.Claims.Scopes, clusterID) {
+		return nil, status.Error(codes.PermissionDenied, "the API key may not access the cluster")
+	}
+	ctx, err = contextWithAuthToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -266,6 +295,7 @@ func (v *VizierClusterInfo) UpdateOrInstallCluster(ctx context.Context, req *clo
 		ArtifactName: "vizier",
 		VersionStr:   req.Version,
 		ArtifactType: versionspb.AT_CONTAINER_SET_YAMLS,
+		ValidateOnly: true,
 	}
 
 	_, err = v.ArtifactTrackerClient.GetDownloadLink(ctx, atReq)
@@ -287,6 +317,125 @@ func (v *VizierClusterInfo) UpdateOrInstallCluster(ctx context.Context, req *clo
 	}, nil
 }
 
+// ExportClusterInventory exports all of the clusters of the current org.
+func (v *VizierClusterInfo) ExportClusterInventory(ctx context.Context, req *cloudpb.ExportClusterInventoryRequest) (*cloudpb.ExportClusterInventoryResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgID := utils.ProtoFromUUIDStrOrNil(sCtx.Claims.GetUserClaims().OrgID)
+
+	ctx, err = contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.VzMgr.ExportClusterInventory(ctx, &vzmgrpb.ExportClusterInventoryRequest{
+		OrgID:  orgID,
+		Format: vzmgrpb.ClusterInventoryFormat(req.Format),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cloudpb.ExportClusterInventoryResponse{Inventory: resp.Inventory}, nil
+}
+
+// ImportClusterInventory pre-registers the clusters in the inventory with the current org.
+func (v *VizierClusterInfo) ImportClusterInventory(ctx context.Context, req *cloudpb.ImportClusterInventoryRequest) (*cloudpb.ImportClusterInventoryResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgID := utils.ProtoFromUUIDStrOrNil(sCtx.Claims.GetUserClaims().OrgID)
+
+	ctx, err = contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.VzMgr.ImportClusterInventory(ctx, &vzmgrpb.ImportClusterInventoryRequest{
+		OrgID:     orgID,
+		Format:    vzmgrpb.ClusterInventoryFormat(req.Format),
+		Inventory: req.Inventory,
+		DryRun:    req.DryRun,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cloudpb.ImportClusterInventoryResponse{Created: resp.Created, Updated: resp.Updated}, nil
+}
+
+// ListClusterStatuses lists the status of the current org's clusters a page at a time, along with the number of
+// matching clusters per status and Vizier version.
+func (v *VizierClusterInfo) ListClusterStatuses(ctx context.Context, req *cloudpb.ListClusterStatusesRequest) (*cloudpb.ListClusterStatusesResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgID := utils.ProtoFromUUIDStrOrNil(sCtx.Claims.GetUserClaims().OrgID)
+
+	if err := fieldmask.Validate(req.ReadMask, &cloudpb.ClusterStatusSummary{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+
+	ctx, err = contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []cvmsgspb.VizierStatus
+	for _, s := range req.Statuses {
+		statuses = append(statuses, clusterStatusToVzStatus(s))
+	}
+	vzResp, err := v.VzMgr.ListVizierStatuses(ctx, &vzmgrpb.ListVizierStatusesRequest{
+		OrgID:               orgID,
+		Statuses:            statuses,
+		VizierVersion:       req.VizierVersion,
+		ClusterNameContains: req.ClusterNameContains,
+		PageSize:            req.PageSize,
+		Cursor:              req.Cursor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &cloudpb.ListClusterStatusesResponse{
+		NextCursor: vzResp.NextCursor,
+		TotalCount: vzResp.TotalCount,
+	}
+	for _, vz := range vzResp.Viziers {
+		resp.Clusters = append(resp.Clusters, &cloudpb.ClusterStatusSummary{
+			ID:                   vz.VizierID,
+			ClusterName:          vz.ClusterName,
+			ClusterUID:           vz.ClusterUID,
+			Status:               vzStatusToClusterStatus(vz.Status),
+			VizierVersion:        vz.VizierVersion,
+			OperatorVersion:      vz.OperatorVersion,
+			ClusterVersion:       vz.ClusterVersion,
+			LastHeartbeatNs:      vz.LastHeartbeatNs,
+			NumNodes:             vz.NumNodes,
+			NumInstrumentedNodes: vz.NumInstrumentedNodes,
+		})
+	}
+	for _, c := range vzResp.StatusCounts {
+		resp.StatusCounts = append(resp.StatusCounts, &cloudpb.ListClusterStatusesResponse_StatusCount{
+			Status: vzStatusToClusterStatus(c.Status),
+			Count:  c.Count,
+		})
+	}
+	for _, c := range vzResp.VersionCounts {
+		resp.VersionCounts = append(resp.VersionCounts, &cloudpb.ListClusterStatusesResponse_VersionCount{
+			VizierVersion: c.VizierVersion,
+			Count:         c.Count,
+		})
+	}
+
+	if err := fieldmask.Apply(req.ReadMask, resp.Clusters); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+	return resp, nil
+}
+
 func vzStatusToClusterStatus(s cvmsgspb.VizierStatus) cloudpb.ClusterStatus {
 	switch s {
 	case cvmsgspb.VZ_ST_HEALTHY:
@@ -307,3 +456,24 @@ func vzStatusToClusterStatus(s cvmsgspb.VizierStatus) cloudpb.ClusterStatus {
 		return cloudpb.CS_UNKNOWN
 	}
 }
+
+func clusterStatusToVzStatus(s cloudpb.ClusterStatus) cvmsgspb.VizierStatus {
+	switch s {
+	case cloudpb.CS_HEALTHY:
+		return cvmsgspb.VZ_ST_HEALTHY
+	case cloudpb.CS_UNHEALTHY:
+		return cvmsgspb.VZ_ST_UNHEALTHY
+	case cloudpb.CS_DISCONNECTED:
+		return cvmsgspb.VZ_ST_DISCONNECTED
+	case cloudpb.CS_UPDATING:
+		return cvmsgspb.VZ_ST_UPDATING
+	case cloudpb.CS_CONNECTED:
+		return cvmsgspb.VZ_ST_CONNECTED
+	case cloudpb.CS_UPDATE_FAILED:
+		return cvmsgspb.VZ_ST_UPDATE_FAILED
+	case cloudpb.CS_DEGRADED:
+		return cvmsgspb.VZ_ST_DEGRADED
+	default:
+		return cvmsgspb.VZ_ST_UNKNOWN
+	}
+}
@@ -21,21 +21,29 @@ package controllers_test
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/api/controllers"
 	"px.dev/pixie/src/cloud/api/controllers/testutils"
 	"px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/orgrole"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/artifacts/versionspb"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/k8s/metadatapb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	svcutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
 )
 
@@ -80,6 +88,60 @@ func TestVizierClusterInfo_GetClusterConnectionInfo(t *testing.T) {
 	}
 }
 
+func TestVizierClusterInfo_GetClusterConnectionInfo_NotClusterAdmin(t *testing.T) {
+	clusterID := uuid.Must(uuid.NewV4())
+	otherClusterID := uuid.Must(uuid.NewV4())
+
+	tests := []struct {
+		name     string
+		bindings []orgrole.Binding
+		scopes   []string
+	}{
+		{
+			name:     "viewer",
+			bindings: []orgrole.Binding{{Role: orgrole.Viewer}},
+		},
+		{
+			name:     "editor",
+			bindings: []orgrole.Binding{{Role: orgrole.Editor}},
+		},
+		{
+			name:     "admin of another cluster",
+			bindings: []orgrole.Binding{{Role: orgrole.Viewer}, {Role: orgrole.Admin, ClusterID: otherClusterID}},
+		},
+		{
+			name:     "read-only key of an admin for another cluster",
+			bindings: []orgrole.Binding{{Role: orgrole.Admin}},
+			scopes:   []string{apikeyscope.TokenScope, apikeyscope.ScriptRead, apikeyscope.ClusterScope(otherClusterID)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// No connection info is expected to be fetched.
+			_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+			defer cleanup()
+
+			sCtx := authcontext.New()
+			sCtx.Claims = svcutils.GenerateJWTForUser("6ba7b810-9dad-11d1-80b4-00c04fd430c9", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "test@test.com", time.Now(), "pixie")
+			sCtx.Claims.Scopes = append(sCtx.Claims.Scopes, orgrole.TokenScopes(test.bindings)...)
+			sCtx.Claims.Scopes = append(sCtx.Claims.Scopes, test.scopes...)
+			ctx := authcontext.NewContext(context.Background(), sCtx)
+
+			vzClusterInfoServer := &controllers.VizierClusterInfo{
+				VzMgr: mockClients.MockVzMgr,
+			}
+			_, err := vzClusterInfoServer.GetClusterConnectionInfo(ctx, &cloudpb.GetClusterConnectionInfoRequest{
+				ID: utils.ProtoFromUUID(clusterID),
+			})
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+	}
+}
+
 func TestVizierClusterInfo_GetClusterInfo(t *testing.T) {
 	tests := []struct {
 		name string
@@ -155,8 +217,11 @@ func TestVizierClusterInfo_GetClusterInfo(t *testing.T) {
 							Status: metadatapb.RUNNING,
 						},
 					},
-					NumNodes:             5,
-					NumInstrumentedNodes: 3,
+					NumNodes:                    5,
+					NumInstrumentedNodes:        3,
+					BridgeRTTNs:                 20000000,
+					NumBridgeReconnectsLastHour: 2,
+					NumDroppedMessagesLastHour:  7,
 				}},
 			}, nil)
 
@@ -213,6 +278,9 @@ func TestVizierClusterInfo_GetClusterInfo(t *testing.T) {
 			assert.Equal(t, expectedPodStatuses, cluster.ControlPlanePodStatuses)
 			assert.Equal(t, int32(5), cluster.NumNodes)
 			assert.Equal(t, int32(3), cluster.NumInstrumentedNodes)
+			assert.Equal(t, int64(20000000), cluster.BridgeRTTNs)
+			assert.Equal(t, int64(2), cluster.NumBridgeReconnectsLastHour)
+			assert.Equal(t, int64(7), cluster.NumDroppedMessagesLastHour)
 		})
 	}
 }
@@ -432,6 +500,54 @@ func TestVizierClusterInfo_GetClusterInfoWithID(t *testing.T) {
 	}
 }
 
+func TestVizierClusterInfo_GetClusterInfoWithReadMask(t *testing.T) {
+	clusterID := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	assert.NotNil(t, clusterID)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	mockClients.MockVzMgr.EXPECT().GetVizierInfos(gomock.Any(), &vzmgrpb.GetVizierInfosRequest{
+		VizierIDs: []*uuidpb.UUID{clusterID},
+	}).Return(&vzmgrpb.GetVizierInfosResponse{
+		VizierInfos: []*cvmsgspb.VizierInfo{{
+			VizierID:        clusterID,
+			Status:          cvmsgspb.VZ_ST_HEALTHY,
+			LastHeartbeatNs: int64(1305646598000000000),
+			Config:          &cvmsgspb.VizierConfig{},
+			VizierVersion:   "1.2.3",
+			ClusterUID:      "a UID",
+			ClusterName:     "some cluster",
+			ClusterVersion:  "5.6.7",
+		}},
+	}, nil)
+
+	vzClusterInfoServer := &controllers.VizierClusterInfo{
+		VzMgr: mockClients.MockVzMgr,
+	}
+
+	resp, err := vzClusterInfoServer.GetClusterInfo(ctx, &cloudpb.GetClusterInfoRequest{
+		ID:       clusterID,
+		ReadMask: &types.FieldMask{Paths: []string{"id", "status", "cluster_name"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*cloudpb.ClusterInfo{{
+		ID:          clusterID,
+		Status:      cloudpb.CS_HEALTHY,
+		ClusterName: "some cluster",
+	}}, resp.Clusters)
+
+	_, err = vzClusterInfoServer.GetClusterInfo(ctx, &cloudpb.GetClusterInfoRequest{
+		ID:       clusterID,
+		ReadMask: &types.FieldMask{Paths: []string{"not_a_field"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 func TestVizierClusterInfo_UpdateClusterVizierConfig(t *testing.T) {
 	tests := []struct {
 		name string
@@ -513,6 +629,7 @@ func TestVizierClusterInfo_UpdateOrInstallCluster(t *testing.T) {
 					ArtifactName: "vizier",
 					VersionStr:   "0.1.30",
 					ArtifactType: versionspb.AT_CONTAINER_SET_YAMLS,
+					ValidateOnly: true,
 				}).
 				Return(nil, nil)
 
@@ -531,3 +648,127 @@ func TestVizierClusterInfo_UpdateOrInstallCluster(t *testing.T) {
 		})
 	}
 }
+
+func TestVizierClusterInfo_ExportClusterInventory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	inventory := []byte("id,cluster_name\n7ba7b810-9dad-11d1-80b4-00c04fd430c8,test_cluster\n")
+	mockClients.MockVzMgr.EXPECT().ExportClusterInventory(gomock.Any(), &vzmgrpb.ExportClusterInventoryRequest{
+		OrgID:  utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Format: vzmgrpb.CLUSTER_INVENTORY_FORMAT_CSV,
+	}).Return(&vzmgrpb.ExportClusterInventoryResponse{Inventory: inventory}, nil)
+
+	vzClusterInfoServer := &controllers.VizierClusterInfo{
+		VzMgr: mockClients.MockVzMgr,
+	}
+
+	resp, err := vzClusterInfoServer.ExportClusterInventory(ctx, &cloudpb.ExportClusterInventoryRequest{
+		Format: cloudpb.CLUSTER_INVENTORY_FORMAT_CSV,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, inventory, resp.Inventory)
+}
+
+func TestVizierClusterInfo_ImportClusterInventory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	inventory := []byte(`[{"cluster_name": "prod-us-east", "labels": {"env": "prod"}}]`)
+	mockClients.MockVzMgr.EXPECT().ImportClusterInventory(gomock.Any(), &vzmgrpb.ImportClusterInventoryRequest{
+		OrgID:     utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Format:    vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON,
+		Inventory: inventory,
+		DryRun:    true,
+	}).Return(&vzmgrpb.ImportClusterInventoryResponse{Created: []string{"prod-us-east"}}, nil)
+
+	vzClusterInfoServer := &controllers.VizierClusterInfo{
+		VzMgr: mockClients.MockVzMgr,
+	}
+
+	resp, err := vzClusterInfoServer.ImportClusterInventory(ctx, &cloudpb.ImportClusterInventoryRequest{
+		Format:    cloudpb.CLUSTER_INVENTORY_FORMAT_JSON,
+		Inventory: inventory,
+		DryRun:    true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.ImportClusterInventoryResponse{Created: []string{"prod-us-east"}}, resp)
+}
+
+func TestVizierClusterInfo_ListClusterStatuses(t *testing.T) {
+	clusterID := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	mockClients.MockVzMgr.EXPECT().ListVizierStatuses(gomock.Any(), &vzmgrpb.ListVizierStatusesRequest{
+		OrgID:               utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Statuses:            []cvmsgspb.VizierStatus{cvmsgspb.VZ_ST_HEALTHY, cvmsgspb.VZ_ST_DEGRADED},
+		ClusterNameContains: "prod",
+		PageSize:            1,
+		Cursor:              "abc",
+	}).Return(&vzmgrpb.ListVizierStatusesResponse{
+		Viziers: []*vzmgrpb.VizierStatusSummary{{
+			VizierID:      clusterID,
+			ClusterName:   "prod-us-east",
+			ClusterUID:    "a UID",
+			Status:        cvmsgspb.VZ_ST_DEGRADED,
+			VizierVersion: "0.14.1",
+			NumNodes:      4,
+		}},
+		NextCursor: "def",
+		TotalCount: 3,
+		StatusCounts: []*vzmgrpb.ListVizierStatusesResponse_StatusCount{
+			{Status: cvmsgspb.VZ_ST_HEALTHY, Count: 2},
+			{Status: cvmsgspb.VZ_ST_DEGRADED, Count: 1},
+		},
+		VersionCounts: []*vzmgrpb.ListVizierStatusesResponse_VersionCount{
+			{VizierVersion: "0.14.1", Count: 3},
+		},
+	}, nil)
+
+	vzClusterInfoServer := &controllers.VizierClusterInfo{
+		VzMgr: mockClients.MockVzMgr,
+	}
+
+	resp, err := vzClusterInfoServer.ListClusterStatuses(ctx, &cloudpb.ListClusterStatusesRequest{
+		Statuses:            []cloudpb.ClusterStatus{cloudpb.CS_HEALTHY, cloudpb.CS_DEGRADED},
+		ClusterNameContains: "prod",
+		PageSize:            1,
+		Cursor:              "abc",
+		ReadMask:            &types.FieldMask{Paths: []string{"id", "status"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.ListClusterStatusesResponse{
+		Clusters: []*cloudpb.ClusterStatusSummary{{
+			ID:     clusterID,
+			Status: cloudpb.CS_DEGRADED,
+		}},
+		NextCursor: "def",
+		TotalCount: 3,
+		StatusCounts: []*cloudpb.ListClusterStatusesResponse_StatusCount{
+			{Status: cloudpb.CS_HEALTHY, Count: 2},
+			{Status: cloudpb.CS_DEGRADED, Count: 1},
+		},
+		VersionCounts: []*cloudpb.ListClusterStatusesResponse_VersionCount{
+			{VizierVersion: "0.14.1", Count: 3},
+		},
+	}, resp)
+
+	_, err = vzClusterInfoServer.ListClusterStatuses(ctx, &cloudpb.ListClusterStatusesRequest{
+		ReadMask: &types.FieldMask{Paths: []string{"control_plane_pod_statuses"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
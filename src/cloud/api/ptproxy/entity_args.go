@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package ptproxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/cloud/autocomplete"
+	"px.dev/pixie/src/shared/scripts"
+)
+
+// entityArgKinds are the kinds of entities that the PxL types of script arguments refer to.
+var entityArgKinds = map[string]cloudpb.AutocompleteEntityKind{
+	"px.Pod":       cloudpb.AEK_POD,
+	"px.Service":   cloudpb.AEK_SVC,
+	"px.Namespace": cloudpb.AEK_NAMESPACE,
+	"px.Node":      cloudpb.AEK_NODE,
+}
+
+var entityKindNames = map[cloudpb.AutocompleteEntityKind]string{
+	cloudpb.AEK_POD:       "pod",
+	cloudpb.AEK_SVC:       "service",
+	cloudpb.AEK_NAMESPACE: "namespace",
+	cloudpb.AEK_NODE:      "node",
+}
+
+// maxEntitySuggestions is how many of the closest entities are suggested for an argument that doesn't exist.
+const maxEntitySuggestions = 3
+
+// SetEntitySuggester makes the proxy check the entity arguments of scripts, such as pod and service names, against
+// the entities that are indexed for the cluster, so that typos are caught before the script runs.
+func (v *VizierPassThroughProxy) SetEntitySuggester(s autocomplete.Suggester) {
+	v.es = s
+}
+
+// entityArg is an argument of a script function that names an entity of the cluster.
+type entityArg struct {
+	funcName string
+	name     string
+	value    string
+	kind     cloudpb.AutocompleteEntityKind
+}
+
+// scriptEntityArgs returns the arguments of the functions that the script executes, whose PxL type is an entity.
+func scriptEntityArgs(req *vizierpb.ExecuteScriptRequest) []*entityArg {
+	var args []*entityArg
+	for _, f := range req.ExecFuncs {
+		types := scripts.FuncArgTypes(req.QueryStr, f.FuncName)
+		for _, arg := range f.ArgValues {
+			kind, ok := entityArgKinds[types[arg.Name]]
+			if !ok || arg.Value == "" {
+				continue
+			}
+			args = append(args, &entityArg{funcName: f.FuncName, name: arg.Name, value: arg.Value, kind: kind})
+		}
+	}
+	return args
+}
+
+// validateEntityArgs rejects the script if any of its entity arguments don't name an entity of the cluster, and
+// suggests the closest entities instead, rather than running a script that returns no rows. Failing to look up
+// the entities doesn't fail the script, since the index may be unavailable or behind the cluster.
+func (v *VizierPassThroughProxy) validateEntityArgs(orgID uuid.UUID, clusterUID string, req *vizierpb.ExecuteScriptRequest) error {
+	if v.es == nil || orgID == uuid.Nil || clusterUID == "" {
+		return nil
+	}
+	args := scriptEntityArgs(req)
+	if len(args) == 0 {
+		return nil
+	}
+
+	reqs := make([]*autocomplete.SuggestionRequest, len(args))
+	for i, arg := range args {
+		reqs[i] = &autocomplete.SuggestionRequest{
+			OrgID:        orgID,
+			ClusterUID:   clusterUID,
+			Input:        arg.value,
+			AllowedKinds: []cloudpb.AutocompleteEntityKind{arg.kind},
+		}
+	}
+	results, err := v.es.GetSuggestions(reqs)
+	if err != nil || len(results) != len(args) {
+		log.WithError(err).WithField("clusterUID", clusterUID).Error("Failed to look up the entity arguments of the script")
+		return nil
+	}
+
+	var invalid []string
+	for i, arg := range args {
+		if results[i] == nil || results[i].ExactMatch {
+			continue
+		}
+		invalid = append(invalid, entityNotFoundMessage(arg, results[i].Suggestions))
+	}
+	if len(invalid) > 0 {
+		return status.Error(codes.InvalidArgument, strings.Join(invalid, "; "))
+	}
+	return nil
+}
+
+func entityNotFoundMessage(arg *entityArg, suggestions []*autocomplete.Suggestion) string {
+	msg := fmt.Sprintf("argument %s of %s: %s %q was not found in the cluster", arg.name, arg.funcName, entityKindNames[arg.kind], arg.value)
+	var names []string
+	for _, s := range suggestions {
+		if s.Kind != arg.kind {
+			continue
+		}
+		names = append(names, s.Name)
+		if len(names) == maxEntitySuggestions {
+			break
+		}
+	}
+	if len(names) > 0 {
+		msg += fmt.Sprintf(", did you mean %s?", strings.Join(names, ", "))
+	}
+	return msg
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package ptproxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/utils"
+)
+
+// ErrQueryQuotaExceeded occurs when the org used up its quota of query execution time.
+var ErrQueryQuotaExceeded = status.Error(codes.ResourceExhausted, "the org has used up its quota of query execution time")
+
+type meteringClient interface {
+	CheckQuota(ctx context.Context, in *vzmgrpb.CheckQuotaRequest, opts ...grpc.CallOption) (*vzmgrpb.CheckQuotaResponse, error)
+	RecordUsage(ctx context.Context, in *vzmgrpb.RecordUsageRequest, opts ...grpc.CallOption) (*types.Empty, error)
+}
+
+// SetMeteringClient makes the proxy meter the time spent executing scripts, and deny scripts to the orgs that used
+// up their quota of it.
+func (v *VizierPassThroughProxy) SetMeteringClient(mc meteringClient) {
+	v.mc = mc
+}
+
+// checkQueryQuota returns an error if the org may not execute any more queries. Failing to check the quota doesn't
+// fail the script, so that an outage of the metering service doesn't take querying down with it.
+func (v *VizierPassThroughProxy) checkQueryQuota(ctx context.Context, token string, orgID uuid.UUID) error {
+	if v.mc == nil || orgID == uuid.Nil {
+		return nil
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", token))
+	resp, err := v.mc.CheckQuota(ctx, &vzmgrpb.CheckQuotaRequest{
+		OrgID:  utils.ProtoFromUUID(orgID),
+		Metric: vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS,
+	})
+	if err != nil {
+		log.WithError(err).WithField("orgID", orgID).Error("Failed to check query quota")
+		return nil
+	}
+	switch resp.State {
+	case vzmgrpb.QUOTA_STATE_HARD_LIMIT_EXCEEDED:
+		return ErrQueryQuotaExceeded
+	case vzmgrpb.QUOTA_STATE_SOFT_LIMIT_EXCEEDED:
+		log.WithField("orgID", orgID).WithField("usage", resp.Usage).Warn("Org is over the soft limit of its query quota")
+	}
+	return nil
+}
+
+// recordQueryUsage adds the time spent executing a script to the usage of the org.
+func (v *VizierPassThroughProxy) recordQueryUsage(token string, orgID uuid.UUID, d time.Duration) {
+	if v.mc == nil || orgID == uuid.Nil {
+		return
+	}
+
+	// The script's context is likely done by now, so the usage is recorded with a fresh one.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", token))
+	_, err := v.mc.RecordUsage(ctx, &vzmgrpb.RecordUsageRequest{
+		OrgID:  utils.ProtoFromUUID(orgID),
+		Metric: vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS,
+		Amount: d.Seconds(),
+	})
+	if err != nil {
+		log.WithError(err).WithField("orgID", orgID).Error("Failed to record query usage")
+	}
+}
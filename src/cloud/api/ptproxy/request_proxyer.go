@@ -34,8 +34,12 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/orgrole"
 	"px.dev/pixie/src/cloud/shared/vzshard"
 	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/tracing"
 	"px.dev/pixie/src/utils"
 )
 
@@ -48,11 +52,16 @@ var (
 	ErrCredentialGenerate = status.Error(codes.Internal, "failed to generate creds for cluster")
 	// ErrPermissionDenied occurs when permission is denied to the cluster.
 	ErrPermissionDenied = status.Error(codes.PermissionDenied, "permission denied for access to cluster")
+	// ErrMutationDenied occurs when the scopes of the API key don't allow running mutations.
+	ErrMutationDenied = status.Error(codes.PermissionDenied, "the scopes of the API key don't allow mutations")
+	// ErrOrgRoleMutationDenied occurs when the role of the user doesn't allow running mutations on the cluster.
+	ErrOrgRoleMutationDenied = status.Error(codes.PermissionDenied, "the role of the user doesn't allow mutations on the cluster")
 )
 
 // requestProxyer manages a single proxy request.
 type requestProxyer struct {
 	clusterID         uuid.UUID
+	clusterUID        string
 	requestID         uuid.UUID
 	signedVizierToken string
 	sub               *nats.Subscription
@@ -79,8 +88,9 @@ func newRequestProxyer(vzmgr vzmgrClient, nc *nats.Conn, debugMode bool, r Clust
 	if err != nil {
 		return nil, err
 	}
-	ctx := s.Context()
-	token, _, err := getCredsFromCtx(ctx)
+	// The request ID follows the request to the vizier, so that its logs can be found from the trace.
+	ctx := tracing.WithRequestID(s.Context(), requestID.String())
+	token, claims, err := getCredsFromCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +103,9 @@ func newRequestProxyer(vzmgr vzmgrClient, nc *nats.Conn, debugMode bool, r Clust
 	if clusterID, err = uuid.FromString(r.GetClusterID()); err != nil {
 		return nil, status.Error(codes.InvalidArgument, "missing/malformed cluster_id")
 	}
+	if !apikeyscope.AllowsCluster(claims.GetScopes(), clusterID) || !orgrole.AllowsCluster(claims.GetScopes(), clusterID) {
+		return nil, ErrPermissionDenied
+	}
 	p.clusterID = clusterID
 
 	signedToken, err := p.validateRequestAndFetchCreds(ctx, debugMode, vzmgr)
@@ -124,7 +137,7 @@ func newRequestProxyer(vzmgr vzmgrClient, nc *nats.Conn, debugMode bool, r Clust
 	return p, nil
 }
 
-func (p requestProxyer) validateRequestAndFetchCreds(ctx context.Context, debugMode bool, vzmgr vzmgrClient) (string, error) {
+func (p *requestProxyer) validateRequestAndFetchCreds(ctx context.Context, debugMode bool, vzmgr vzmgrClient) (string, error) {
 	var signingKey string
 	clusterIDProto := utils.ProtoFromUUID(p.clusterID)
 
@@ -146,6 +159,7 @@ func (p requestProxyer) validateRequestAndFetchCreds(ctx context.Context, debugM
 				return ErrNotAvailable
 			}
 		}
+		p.clusterUID = resp.ClusterUID
 
 		return nil
 	})
@@ -257,7 +271,7 @@ func (p requestProxyer) sendMessageToVizier(req *cvmsgspb.C2VAPIStreamRequest) e
 	}
 
 	topic := p.getSendTopic()
-	return p.nc.Publish(topic, b)
+	return msgbus.PublishWithContext(p.ctx, p.nc, topic, b)
 }
 
 func (p *requestProxyer) processNatsMsg(msg *nats.Msg) error {
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package ptproxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/shared/scripts"
+	"px.dev/pixie/src/utils"
+)
+
+type orgClient interface {
+	GetOrgScriptArgPolicies(ctx context.Context, in *profilepb.GetOrgScriptArgPoliciesRequest, opts ...grpc.CallOption) (*profilepb.GetOrgScriptArgPoliciesResponse, error)
+}
+
+// resolveScriptArgs applies the org's script argument policies to the functions that the script executes.
+func (v *VizierPassThroughProxy) resolveScriptArgs(ctx context.Context, token string, orgID uuid.UUID, req *vizierpb.ExecuteScriptRequest) error {
+	if orgID == uuid.Nil || len(req.ExecFuncs) == 0 {
+		return nil
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", token))
+	resp, err := v.oc.GetOrgScriptArgPolicies(ctx, &profilepb.GetOrgScriptArgPoliciesRequest{
+		OrgID: utils.ProtoFromUUID(orgID),
+	})
+	if err != nil {
+		return err
+	}
+
+	policies := make(map[string]*scripts.ArgPolicy, len(resp.Policies))
+	for _, p := range resp.Policies {
+		policies[p.ArgName] = &scripts.ArgPolicy{
+			ArgName:         p.ArgName,
+			DefaultValue:    p.DefaultValue,
+			MaxLookback:     time.Duration(p.MaxLookbackNS),
+			ForbiddenValues: p.ForbiddenValues,
+		}
+	}
+	return applyScriptArgPolicies(policies, req.ExecFuncs, time.Now())
+}
+
+// applyScriptArgPolicies fills in the defaults of the empty arguments, and rejects the script if any of
+// its arguments aren't allowed by the policies. Arguments are never added, since the functions would fail
+// to compile with arguments that they don't take.
+func applyScriptArgPolicies(policies map[string]*scripts.ArgPolicy, funcs []*vizierpb.ExecuteScriptRequest_FuncToExecute, now time.Time) error {
+	if len(policies) == 0 {
+		return nil
+	}
+	for _, f := range funcs {
+		for _, arg := range f.ArgValues {
+			policy, ok := policies[arg.Name]
+			if !ok {
+				continue
+			}
+			if arg.Value == "" {
+				arg.Value = policy.DefaultValue
+			}
+			if arg.Value == "" {
+				continue
+			}
+			if err := policy.CheckValue(arg.Value, now); err != nil {
+				return status.Errorf(codes.InvalidArgument, "argument of %s is not allowed by the org: %s", f.FuncName, err.Error())
+			}
+		}
+	}
+	return nil
+}
@@ -20,15 +20,30 @@ package ptproxy
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/cloud/autocomplete"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/audit"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/cloud/shared/orgrole"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/jwtpb"
+	"px.dev/pixie/src/utils"
 )
 
 type vzmgrClient interface {
@@ -41,27 +56,125 @@ type vzmgrClient interface {
 type VizierPassThroughProxy struct {
 	nc *nats.Conn
 	vc vzmgrClient
+	oc orgClient
+	mc meteringClient
+	es autocomplete.Suggester
 }
 
 // NewVizierPassThroughProxy creates a new passthrough proxy.
-func NewVizierPassThroughProxy(nc *nats.Conn, vc vzmgrClient) *VizierPassThroughProxy {
-	return &VizierPassThroughProxy{nc: nc, vc: vc}
+func NewVizierPassThroughProxy(nc *nats.Conn, vc vzmgrClient, oc orgClient) *VizierPassThroughProxy {
+	return &VizierPassThroughProxy{nc: nc, vc: vc, oc: oc}
 }
 
 // ExecuteScript is the GRPC stream method.
 func (v *VizierPassThroughProxy) ExecuteScript(req *vizierpb.ExecuteScriptRequest, srv vizierpb.VizierService_ExecuteScriptServer) error {
+	err := v.executeScript(req, srv)
+	recordScriptExecution(srv.Context(), req, err)
+	return err
+}
+
+// recordScriptExecution writes the script execution to the audit log. The script itself isn't recorded, since
+// it can be large, but the name of the script and the functions that it executed are.
+func recordScriptExecution(ctx context.Context, req *vizierpb.ExecuteScriptRequest, err error) {
+	funcs := make([]string, len(req.ExecFuncs))
+	for i, f := range req.ExecFuncs {
+		funcs[i] = f.FuncName
+	}
+	e := &audit.Event{
+		Category: audit.CategoryScript,
+		Action:   "execute_script",
+		Outcome:  audit.OutcomeOf(err),
+		Resource: req.ClusterID,
+		Details: map[string]string{
+			"query_name": req.QueryName,
+			"exec_funcs": strings.Join(funcs, ","),
+			"mutation":   strconv.FormatBool(req.Mutation),
+		},
+	}
+	if err != nil {
+		e.Details["error"] = status.Convert(err).Message()
+	}
+	if _, claims, credsErr := getCredsFromCtx(ctx); credsErr == nil {
+		e.OrgID = claims.GetUserClaims().GetOrgID()
+		e.UserID = claims.GetUserClaims().GetUserID()
+	}
+	audit.Record(e)
+}
+
+func (v *VizierPassThroughProxy) executeScript(req *vizierpb.ExecuteScriptRequest, srv vizierpb.VizierService_ExecuteScriptServer) error {
+	token, claims, err := getCredsFromCtx(srv.Context())
+	if err != nil {
+		return err
+	}
+	if req.Mutation && !apikeyscope.AllowsMutation(claims.GetScopes()) {
+		return ErrMutationDenied
+	}
+	if req.Mutation && !orgrole.AllowsMutation(claims.GetScopes(), uuid.FromStringOrNil(req.ClusterID)) {
+		return ErrOrgRoleMutationDenied
+	}
 	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
 	if err != nil {
 		return err
 	}
 	defer rp.Finish()
+	orgID := uuid.FromStringOrNil(claims.GetUserClaims().GetOrgID())
+	if err := v.resolveScriptArgs(srv.Context(), token, orgID, req); err != nil {
+		return err
+	}
+	if err := v.validateEntityArgs(orgID, rp.clusterUID, req); err != nil {
+		return err
+	}
+	if err := v.checkQueryQuota(srv.Context(), token, orgID); err != nil {
+		return err
+	}
 	vizReq := rp.prepareVizierRequest()
 	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_ExecReq{ExecReq: req}
 	if err := rp.sendMessageToVizier(vizReq); err != nil {
 		return err
 	}
 
-	return rp.Run()
+	exec := &messagespb.ScriptExecution{
+		RequestID:   utils.ProtoFromUUID(rp.requestID),
+		VizierID:    utils.ProtoFromUUID(rp.clusterID),
+		OrgID:       utils.ProtoFromUUIDStrOrNil(claims.GetUserClaims().GetOrgID()),
+		UserID:      utils.ProtoFromUUIDStrOrNil(claims.GetUserClaims().GetUserID()),
+		State:       messagespb.STATE_RUNNING,
+		Mutation:    req.Mutation,
+		StartTimeNs: time.Now().UnixNano(),
+	}
+	v.publishScriptExecution(exec)
+
+	err = rp.Run()
+	exec.EndTimeNs = time.Now().UnixNano()
+	v.recordQueryUsage(token, orgID, time.Duration(exec.EndTimeNs-exec.StartTimeNs))
+	switch {
+	case err == nil:
+		exec.State = messagespb.STATE_SUCCEEDED
+	case errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled:
+		exec.State = messagespb.STATE_CANCELLED
+	default:
+		exec.State = messagespb.STATE_FAILED
+		exec.ErrorMessage = status.Convert(err).Message()
+	}
+	v.publishScriptExecution(exec)
+	return err
+}
+
+// publishScriptExecution lets the subscribers of the org know that a script started or ended. Failing to
+// publish doesn't fail the script.
+func (v *VizierPassThroughProxy) publishScriptExecution(exec *messagespb.ScriptExecution) {
+	orgID, err := utils.UUIDFromProto(exec.OrgID)
+	if err != nil || orgID == uuid.Nil {
+		return
+	}
+	b, err := exec.Marshal()
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal script execution")
+		return
+	}
+	if err := v.nc.Publish(messages.ScriptExecutionTopic(orgID), b); err != nil {
+		log.WithError(err).Error("Failed to publish script execution")
+	}
 }
 
 // HealthCheck is the GRPC stream method.
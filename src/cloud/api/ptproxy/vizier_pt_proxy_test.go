@@ -41,9 +41,15 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
+	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/api/proto/vizierpb"
 	"px.dev/pixie/src/cloud/api/ptproxy"
+	"px.dev/pixie/src/cloud/autocomplete"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
 	"px.dev/pixie/src/cloud/shared/vzshard"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/services/env"
@@ -72,8 +78,10 @@ func createTestState(t *testing.T) (*testState, func(t *testing.T)) {
 
 	nc, natsCleanup := testingutils.MustStartTestNATS(t)
 
-	vizierpb.RegisterVizierServiceServer(s, ptproxy.NewVizierPassThroughProxy(nc, &fakeVzMgr{}))
-	vizierpb.RegisterVizierDebugServiceServer(s, ptproxy.NewVizierPassThroughProxy(nc, &fakeVzMgr{}))
+	vpt := ptproxy.NewVizierPassThroughProxy(nc, &fakeVzMgr{}, &fakeOrg{})
+	vpt.SetEntitySuggester(&fakeSuggester{})
+	vizierpb.RegisterVizierServiceServer(s, vpt)
+	vizierpb.RegisterVizierDebugServiceServer(s, ptproxy.NewVizierPassThroughProxy(nc, &fakeVzMgr{}, &fakeOrg{}))
 
 	eg := errgroup.Group{}
 	eg.Go(func() error { return s.Serve(lis) })
@@ -118,15 +126,24 @@ func TestVizierPassThroughProxy_ExecuteScript(t *testing.T) {
 	client := vizierpb.NewVizierServiceClient(ts.conn)
 	validTestToken := testingutils.GenerateTestJWTToken(t, viper.GetString("jwt_signing_key"))
 
+	readOnlyClaims := testingutils.GenerateTestClaims(t)
+	readOnlyClaims.Scopes = append(readOnlyClaims.Scopes, apikeyscope.TokenScope, apikeyscope.ScriptRead,
+		apikeyscope.ClusterScope(uuid.FromStringOrNil("00000000-1111-2222-2222-333333333333")))
+	readOnlyToken := testingutils.SignPBClaims(t, readOnlyClaims, viper.GetString("jwt_signing_key"))
+
 	testCases := []struct {
 		name string
 
 		clusterID      string
 		authToken      string
+		mutation       bool
+		queryStr       string
+		execFuncs      []*vizierpb.ExecuteScriptRequest_FuncToExecute
 		respFromVizier []*cvmsgspb.V2CAPIStreamResponse
 
-		expGRPCError     error
-		expGRPCResponses []*vizierpb.ExecuteScriptResponse
+		expGRPCError      error
+		expGRPCResponses  []*vizierpb.ExecuteScriptResponse
+		expExecutionState []messagespb.ScriptExecution_State
 	}{
 		{
 			name: "Missing auth token",
@@ -160,6 +177,74 @@ func TestVizierPassThroughProxy_ExecuteScript(t *testing.T) {
 
 			expGRPCError: status.Error(codes.InvalidArgument, "clusterID"),
 		},
+		{
+			name: "Mutation with read only API key",
+
+			clusterID: "00000000-1111-2222-2222-333333333333",
+			authToken: readOnlyToken,
+			mutation:  true,
+
+			expGRPCError: ptproxy.ErrMutationDenied,
+		},
+		{
+			name: "Argument forbidden by org",
+
+			clusterID: "00000000-1111-2222-2222-333333333333",
+			authToken: validTestToken,
+			execFuncs: []*vizierpb.ExecuteScriptRequest_FuncToExecute{
+				{
+					FuncName: "pods",
+					ArgValues: []*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{
+						{Name: "start_time", Value: "-5m"},
+						{Name: "namespace", Value: "kube-system"},
+					},
+				},
+			},
+
+			expGRPCError: status.Error(codes.InvalidArgument, "namespace"),
+		},
+		{
+			name: "Start time beyond org lookback",
+
+			clusterID: "00000000-1111-2222-2222-333333333333",
+			authToken: validTestToken,
+			execFuncs: []*vizierpb.ExecuteScriptRequest_FuncToExecute{
+				{
+					FuncName: "pods",
+					ArgValues: []*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{
+						{Name: "start_time", Value: "-1d"},
+					},
+				},
+			},
+
+			expGRPCError: status.Error(codes.InvalidArgument, "start_time"),
+		},
+		{
+			name: "Pod that doesn't exist",
+
+			clusterID: "00000000-1111-2222-2222-333333333333",
+			authToken: validTestToken,
+			queryStr:  testPodScript,
+			execFuncs: []*vizierpb.ExecuteScriptRequest_FuncToExecute{
+				{
+					FuncName: "pod_stats",
+					ArgValues: []*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{
+						{Name: "start_time", Value: "-5m"},
+						{Name: "pod", Value: "pl/kelvn"},
+					},
+				},
+			},
+
+			expGRPCError: status.Error(codes.InvalidArgument, `pod "pl/kelvn" was not found in the cluster, did you mean pl/kelvin`),
+		},
+		{
+			name: "Cluster not allowed by API key",
+
+			clusterID: "20000000-1111-2222-2222-333333333333",
+			authToken: readOnlyToken,
+
+			expGRPCError: ptproxy.ErrPermissionDenied,
+		},
 		{
 			name: "Disconnected cluster",
 
@@ -181,6 +266,16 @@ func TestVizierPassThroughProxy_ExecuteScript(t *testing.T) {
 
 			clusterID: "00000000-1111-2222-2222-333333333333",
 			authToken: validTestToken,
+			queryStr:  testPodScript,
+			execFuncs: []*vizierpb.ExecuteScriptRequest_FuncToExecute{
+				{
+					FuncName: "pod_stats",
+					ArgValues: []*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{
+						{Name: "start_time", Value: "-5m"},
+						{Name: "pod", Value: "pl/kelvin"},
+					},
+				},
+			},
 			respFromVizier: []*cvmsgspb.V2CAPIStreamResponse{
 				{
 					Msg: &cvmsgspb.V2CAPIStreamResponse_ExecResp{ExecResp: &vizierpb.ExecuteScriptResponse{QueryID: "abc"}},
@@ -199,6 +294,7 @@ func TestVizierPassThroughProxy_ExecuteScript(t *testing.T) {
 					QueryID: "abc",
 				},
 			},
+			expExecutionState: []messagespb.ScriptExecution_State{messagespb.STATE_RUNNING, messagespb.STATE_SUCCEEDED},
 		},
 	}
 
@@ -210,10 +306,17 @@ func TestVizierPassThroughProxy_ExecuteScript(t *testing.T) {
 					fmt.Sprintf("bearer %s", tc.authToken))
 			}
 
+			execCh := make(chan *nats.Msg, 10)
+			sub, err := ts.nc.ChanSubscribe(messages.ScriptExecutionTopic(uuid.FromStringOrNil(testingutils.TestOrgID)), execCh)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, sub.Unsubscribe())
+			}()
+
 			ctx, cancel := context.WithCancel(ctx)
 			defer cancel()
 			resp, err := client.ExecuteScript(ctx,
-				&vizierpb.ExecuteScriptRequest{ClusterID: tc.clusterID})
+				&vizierpb.ExecuteScriptRequest{ClusterID: tc.clusterID, Mutation: tc.mutation, QueryStr: tc.queryStr, ExecFuncs: tc.execFuncs})
 			require.NoError(t, err)
 
 			fv := newFakeVizier(t, uuid.FromStringOrNil(tc.clusterID), ts.nc)
@@ -271,6 +374,9 @@ func TestVizierPassThroughProxy_ExecuteScript(t *testing.T) {
 					t.Fatal("Expected to get GRPC error")
 				}
 				assert.Equal(t, status.Code(tc.expGRPCError), status.Code(gotReadErr))
+				if tc.queryStr != "" {
+					assert.Contains(t, status.Convert(gotReadErr).Message(), status.Convert(tc.expGRPCError).Message())
+				}
 			}
 			if tc.expGRPCResponses == nil {
 				if len(responses) != 0 {
@@ -279,6 +385,19 @@ func TestVizierPassThroughProxy_ExecuteScript(t *testing.T) {
 			} else {
 				assert.Equal(t, tc.expGRPCResponses, responses)
 			}
+
+			for _, state := range tc.expExecutionState {
+				select {
+				case msg := <-execCh:
+					exec := &messagespb.ScriptExecution{}
+					require.NoError(t, exec.Unmarshal(msg.Data))
+					assert.Equal(t, state, exec.State)
+					assert.Equal(t, tc.clusterID, utils.UUIDFromProtoOrNil(exec.VizierID).String())
+					assert.Equal(t, testingutils.TestUserID, utils.UUIDFromProtoOrNil(exec.UserID).String())
+				case <-time.After(defaultTimeout):
+					t.Fatal("Timed out waiting for script execution")
+				}
+			}
 		})
 	}
 }
@@ -719,6 +838,44 @@ func TestVizierPassThroughProxy_DebugPods(t *testing.T) {
 	}
 }
 
+type fakeOrg struct{}
+
+func (o *fakeOrg) GetOrgScriptArgPolicies(ctx context.Context, in *profilepb.GetOrgScriptArgPoliciesRequest, opts ...grpc.CallOption) (*profilepb.GetOrgScriptArgPoliciesResponse, error) {
+	return &profilepb.GetOrgScriptArgPoliciesResponse{
+		Policies: []*profilepb.ScriptArgPolicy{
+			{ArgName: "start_time", DefaultValue: "-5m", MaxLookbackNS: int64(time.Hour)},
+			{ArgName: "namespace", ForbiddenValues: []string{"kube-system"}},
+		},
+	}, nil
+}
+
+const testPodScript = `
+import px
+
+def pod_stats(start_time: str, pod: px.Pod):
+    df = px.DataFrame('process_stats', start_time=start_time)
+    return df[df.ctx['pod'] == pod]
+`
+
+// fakeSuggester knows of the pods of the test cluster.
+type fakeSuggester struct{}
+
+func (f *fakeSuggester) GetSuggestions(reqs []*autocomplete.SuggestionRequest) ([]*autocomplete.SuggestionResult, error) {
+	pods := []string{"pl/kelvin", "pl/vizier-pem"}
+	results := make([]*autocomplete.SuggestionResult, len(reqs))
+	for i, r := range reqs {
+		results[i] = &autocomplete.SuggestionResult{}
+		if r.ClusterUID != "test-cluster-uid" || len(r.AllowedKinds) != 1 || r.AllowedKinds[0] != cloudpb.AEK_POD {
+			continue
+		}
+		for _, pod := range pods {
+			results[i].Suggestions = append(results[i].Suggestions, &autocomplete.Suggestion{Name: pod, Kind: cloudpb.AEK_POD})
+			results[i].ExactMatch = results[i].ExactMatch || pod == r.Input
+		}
+	}
+	return results, nil
+}
+
 type fakeVzMgr struct{}
 
 func (v *fakeVzMgr) GetVizierInfo(ctx context.Context, in *uuidpb.UUID, opts ...grpc.CallOption) (*cvmsgspb.VizierInfo, error) {
@@ -729,6 +886,7 @@ func (v *fakeVzMgr) GetVizierInfo(ctx context.Context, in *uuidpb.UUID, opts ...
 		"00000000-1111-2222-2222-333333333333": {
 			&cvmsgspb.VizierInfo{
 				VizierID:        utils.ProtoFromUUIDStrOrNil("00000000-1111-2222-2222-333333333333"),
+				ClusterUID:      "test-cluster-uid",
 				Status:          cvmsgspb.VZ_ST_HEALTHY,
 				LastHeartbeatNs: 0,
 				Config:          &cvmsgspb.VizierConfig{},
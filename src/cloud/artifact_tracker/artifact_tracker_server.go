@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
 	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -37,9 +38,13 @@ import (
 	"px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerenv"
 	atpb "px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
 	"px.dev/pixie/src/cloud/artifact_tracker/controllers"
+	"px.dev/pixie/src/cloud/artifact_tracker/datastore"
+	"px.dev/pixie/src/cloud/artifact_tracker/schema"
+	"px.dev/pixie/src/cloud/shared/pgmigrate"
 	"px.dev/pixie/src/shared/artifacts/manifest"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/healthz"
+	"px.dev/pixie/src/shared/services/pg"
 	"px.dev/pixie/src/shared/services/server"
 )
 
@@ -53,6 +58,9 @@ func init() {
 	pflag.String("artifact_manifest_sha_url", "", "The url to the sha of the artifact manifest, "+
 		"if not set the server will use the manifest url with '.sha256' appended.")
 	pflag.Duration("manifest_poll_period", 1*time.Minute, "Specify how often to poll for manifest changes")
+	pflag.String("artifact_mirrors_path", "", "The path to a YAML config of alternative mirrors to serve artifacts from.")
+	pflag.String("bundle_signing_key_path", "", "The path to a PEM encoded private key used to sign offline bundles. "+
+		"If not set, offline bundles are disabled.")
 }
 
 func loadServiceAccountConfig() *jwt.Config {
@@ -101,6 +109,32 @@ func main() {
 	bucket := viper.GetString("artifact_bucket")
 	svr := controllers.NewServer(stiface.AdaptClient(client), bucket, saCfg)
 
+	db := pg.MustConnectDefaultPostgresDB()
+	err = pgmigrate.PerformMigrationsUsingBindata(db, "artifact_tracker_service_migrations",
+		bindata.Resource(schema.AssetNames(), schema.Asset))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to apply migrations")
+	}
+	svr.EnableUsageTracking(datastore.NewDatastore(db))
+
+	if mirrorsPath := viper.GetString("artifact_mirrors_path"); mirrorsPath != "" {
+		mirrors, defaultMirror, err := controllers.LoadArtifactMirrors(mirrorsPath)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load artifact mirrors.")
+		}
+		if err := svr.SetArtifactMirrors(mirrors, defaultMirror); err != nil {
+			log.WithError(err).Fatal("Invalid artifact mirrors.")
+		}
+	}
+
+	if keyPath := viper.GetString("bundle_signing_key_path"); keyPath != "" {
+		key, err := controllers.LoadBundleSigningKey(keyPath)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load bundle signing key.")
+		}
+		svr.SetBundleSigningKey(key)
+	}
+
 	// If any versions are not hardcoded, then we need to poll for the artifact manifest.
 	if (viper.GetString("vizier_version") == "") || (viper.GetString("cli_version") == "") || (viper.GetString("operator_version") == "") {
 		manifestURL := viper.GetString("artifact_manifest_url")
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apb "px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	vpb "px.dev/pixie/src/shared/artifacts/versionspb"
+)
+
+const (
+	// BundleManifestFile is the name of the manifest file in an offline bundle.
+	BundleManifestFile = "manifest.json"
+	// BundleSignatureFile is the name of the file holding the manifest's signature in an offline bundle.
+	// The signature is over the SHA256 digest of the manifest, and can be verified with:
+	// openssl dgst -sha256 -verify <public_key.pem> -signature manifest.json.sig manifest.json
+	BundleSignatureFile = BundleManifestFile + ".sig"
+
+	bundleChunkSize = 1024 * 1024
+)
+
+// bundleArtifactTypes are the artifact types that are included in an offline bundle for each artifact.
+var bundleArtifactTypes = map[string][]vpb.ArtifactType{
+	vizierArtifactName:   {vpb.AT_CONTAINER_SET_YAMLS, vpb.AT_CONTAINER_SET_TEMPLATE_YAMLS},
+	operatorArtifactName: {vpb.AT_CONTAINER_SET_TEMPLATE_YAMLS},
+	cliArtifactName:      {vpb.AT_LINUX_AMD64, vpb.AT_DARWIN_AMD64},
+}
+
+// BundleManifest describes the contents of an offline bundle.
+type BundleManifest struct {
+	CreatedAt time.Time              `json:"createdAt"`
+	Artifacts []*BundleManifestEntry `json:"artifacts"`
+}
+
+// BundleManifestEntry describes a single artifact in an offline bundle.
+type BundleManifestEntry struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	ArtifactType string `json:"artifactType"`
+	// Path is the path of the artifact within the bundle.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// LoadBundleSigningKey reads a PEM encoded RSA or ECDSA private key used to sign offline bundles.
+func LoadBundleSigningKey(p string) (crypto.Signer, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("bundle signing key is not PEM encoded")
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundle signing key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	}
+	return nil, errors.New("bundle signing key must be an RSA or ECDSA key")
+}
+
+// SetBundleSigningKey sets the key used to sign offline bundles. Offline bundles are disabled until a key is set.
+func (s *Server) SetBundleSigningKey(key crypto.Signer) {
+	s.bundleSigner = key
+}
+
+type bundleArtifact struct {
+	name    string
+	version string
+	at      vpb.ArtifactType
+	loc     *artifactLocation
+}
+
+// GetOfflineBundle streams a tar.gz bundle of all the downloadable artifacts for the requested versions, along with a
+// signed manifest of their checksums. Container images are not included and need to be mirrored to a registry separately.
+func (s *Server) GetOfflineBundle(in *apb.GetOfflineBundleRequest, srv apb.ArtifactTracker_GetOfflineBundleServer) error {
+	ctx := srv.Context()
+
+	if s.bundleSigner == nil {
+		return status.Error(codes.FailedPrecondition, "offline bundles are not enabled")
+	}
+
+	versions := map[string]string{
+		vizierArtifactName:   in.VizierVersion,
+		operatorArtifactName: in.OperatorVersion,
+		cliArtifactName:      in.CliVersion,
+	}
+	mirror, err := s.selectMirror(in.Mirror)
+	if err != nil {
+		return err
+	}
+
+	// Locate all of the artifacts before sending anything, so that a missing artifact fails the request
+	// rather than producing a partial bundle.
+	var artifacts []*bundleArtifact
+	for _, name := range []string{vizierArtifactName, operatorArtifactName, cliArtifactName} {
+		version := versions[name]
+		if version == "" {
+			continue
+		}
+		found := false
+		for _, at := range bundleArtifactTypes[name] {
+			loc, err := s.locateArtifact(ctx, name, version, at, mirror)
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			found = true
+			artifacts = append(artifacts, &bundleArtifact{name: name, version: version, at: at, loc: loc})
+		}
+		if !found {
+			return status.Errorf(codes.NotFound, "no downloadable artifacts found for %s %s", name, version)
+		}
+	}
+	if len(artifacts) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one artifact version must be specified")
+	}
+
+	w := &bundleChunkWriter{srv: srv}
+	if err := s.writeBundle(ctx, w, artifacts); err != nil {
+		log.WithError(err).Error("Failed to create offline bundle")
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.Internal, "failed to create offline bundle")
+	}
+	return w.flush()
+}
+
+func (s *Server) writeBundle(ctx context.Context, w io.Writer, artifacts []*bundleArtifact) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	m := &BundleManifest{
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, a := range artifacts {
+		contents, err := s.fetchArtifact(ctx, a.loc)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(contents)
+		if a.loc.sha256 != "" && hex.EncodeToString(sum[:]) != a.loc.sha256 {
+			return status.Errorf(codes.DataLoss, "checksum mismatch for %s %s %s", a.name, a.version, a.at.String())
+		}
+
+		p := artifactObjectPath(a.name, a.version, a.at)
+		if err := writeTarFile(tw, p, contents); err != nil {
+			return err
+		}
+		s.recordDownload(a.name, a.version, a.at, nil, nil)
+		m.Artifacts = append(m.Artifacts, &BundleManifestEntry{
+			Name:         a.name,
+			Version:      a.version,
+			ArtifactType: a.at.String(),
+			Path:         p,
+			SHA256:       hex.EncodeToString(sum[:]),
+		})
+	}
+
+	manifestBytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(manifestBytes)
+	sig, err := s.bundleSigner.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, BundleManifestFile, manifestBytes); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, BundleSignatureFile, sig); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, contents []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(contents)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(contents)
+	return err
+}
+
+func (s *Server) fetchArtifact(ctx context.Context, loc *artifactLocation) ([]byte, error) {
+	if loc.objectPath != "" {
+		r, err := s.sc.Bucket(s.artifactBucket).Object(loc.objectPath).NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loc.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: status %d", loc.url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// bundleChunkWriter buffers the bundle and sends it to the client in fixed size chunks.
+type bundleChunkWriter struct {
+	srv apb.ArtifactTracker_GetOfflineBundleServer
+	buf bytes.Buffer
+}
+
+func (w *bundleChunkWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for w.buf.Len() >= bundleChunkSize {
+		if err := w.send(w.buf.Next(bundleChunkSize)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *bundleChunkWriter) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	return w.send(w.buf.Next(w.buf.Len()))
+}
+
+func (w *bundleChunkWriter) send(b []byte) error {
+	data := make([]byte, len(b))
+	copy(data, b)
+	return w.srv.Send(&apb.OfflineBundleChunk{Data: data})
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apb "px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	"px.dev/pixie/src/cloud/artifact_tracker/controllers"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+type fakeBundleStream struct {
+	grpc.ServerStream
+	buf bytes.Buffer
+}
+
+func (f *fakeBundleStream) Context() context.Context {
+	return context.Background()
+}
+
+func (f *fakeBundleStream) Send(c *apb.OfflineBundleChunk) error {
+	f.buf.Write(c.Data)
+	return nil
+}
+
+func shaHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func readBundle(t *testing.T, r io.Reader) map[string][]byte {
+	gr, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		b, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = b
+	}
+	return files
+}
+
+func setupBundleServer(t *testing.T, cliSHA string) *controllers.Server {
+	sc := testingutils.NewMockGCSClient(map[string]*testingutils.MockGCSBucket{
+		"test-bucket": testingutils.NewMockGCSBucket(
+			map[string]*testingutils.MockGCSObject{
+				"cli/1.2.1-pre.3/cli_linux_amd64.sha256": testingutils.NewMockGCSObject([]byte(cliSHA), nil),
+				"cli/1.2.1-pre.3/cli_linux_amd64": testingutils.NewMockGCSObject([]byte("mybin"), &storage.ObjectAttrs{
+					MediaLink: "the-url",
+				}),
+			},
+			nil,
+		),
+	})
+	server := controllers.NewServer(sc, "test-bucket", nil)
+
+	ts := startTestHTTPServer(t)
+	t.Cleanup(ts.Close)
+	require.NoError(t, loadTestManifest(server, ts))
+	return server
+}
+
+func TestServer_GetOfflineBundle(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	mirror := startTestMirror(t, map[string]string{
+		"/vizier/0.1.1/vizier_yamls.tar":                 "yamls",
+		"/vizier/0.1.1/vizier_yamls.tar.sha256":          shaHex([]byte("yamls")),
+		"/vizier/0.1.1/vizier_template_yamls.tar":        "templates",
+		"/vizier/0.1.1/vizier_template_yamls.tar.sha256": shaHex([]byte("templates")),
+	})
+	defer mirror.Close()
+
+	server := setupBundleServer(t, shaHex([]byte("mybin")))
+	server.SetBundleSigningKey(key)
+
+	// The CLI is served from the bucket, and vizier from the registered mirror.
+	require.NoError(t, server.SetArtifactMirrors([]*controllers.ArtifactMirror{
+		{Name: "internal", BaseURL: mirror.URL},
+	}, ""))
+	stream := &fakeBundleStream{}
+	err = server.GetOfflineBundle(&apb.GetOfflineBundleRequest{
+		CliVersion: "1.2.1-pre.3",
+	}, stream)
+	require.NoError(t, err)
+	files := readBundle(t, &stream.buf)
+	assert.Equal(t, []byte("mybin"), files["cli/1.2.1-pre.3/cli_linux_amd64"])
+
+	stream = &fakeBundleStream{}
+	err = server.GetOfflineBundle(&apb.GetOfflineBundleRequest{
+		VizierVersion: "0.1.1",
+		Mirror:        "internal",
+	}, stream)
+	require.NoError(t, err)
+
+	files = readBundle(t, &stream.buf)
+	assert.Equal(t, []byte("yamls"), files["vizier/0.1.1/vizier_yamls.tar"])
+	assert.Equal(t, []byte("templates"), files["vizier/0.1.1/vizier_template_yamls.tar"])
+
+	manifestBytes := files[controllers.BundleManifestFile]
+	digest := sha256.Sum256(manifestBytes)
+	assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], files[controllers.BundleSignatureFile]))
+
+	m := &controllers.BundleManifest{}
+	require.NoError(t, json.Unmarshal(manifestBytes, m))
+	assert.Equal(t, []*controllers.BundleManifestEntry{
+		{
+			Name:         "vizier",
+			Version:      "0.1.1",
+			ArtifactType: "AT_CONTAINER_SET_YAMLS",
+			Path:         "vizier/0.1.1/vizier_yamls.tar",
+			SHA256:       shaHex([]byte("yamls")),
+		},
+		{
+			Name:         "vizier",
+			Version:      "0.1.1",
+			ArtifactType: "AT_CONTAINER_SET_TEMPLATE_YAMLS",
+			Path:         "vizier/0.1.1/vizier_template_yamls.tar",
+			SHA256:       shaHex([]byte("templates")),
+		},
+	}, m.Artifacts)
+}
+
+func TestServer_GetOfflineBundle_Errors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		cliSHA  string
+		signed  bool
+		req     *apb.GetOfflineBundleRequest
+		errCode codes.Code
+	}{
+		{
+			name:    "no signing key",
+			req:     &apb.GetOfflineBundleRequest{CliVersion: "1.2.1-pre.3"},
+			errCode: codes.FailedPrecondition,
+		},
+		{
+			name:    "no versions",
+			signed:  true,
+			req:     &apb.GetOfflineBundleRequest{},
+			errCode: codes.InvalidArgument,
+		},
+		{
+			name:    "unknown version",
+			signed:  true,
+			req:     &apb.GetOfflineBundleRequest{CliVersion: "0.0.1"},
+			errCode: codes.NotFound,
+		},
+		{
+			name:    "checksum mismatch",
+			cliSHA:  "the-sha256",
+			signed:  true,
+			req:     &apb.GetOfflineBundleRequest{CliVersion: "1.2.1-pre.3"},
+			errCode: codes.DataLoss,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := setupBundleServer(t, tc.cliSHA)
+			if tc.signed {
+				server.SetBundleSigningKey(key)
+			}
+			err := server.GetOfflineBundle(tc.req, &fakeBundleStream{})
+			assert.Equal(t, tc.errCode, status.Code(err))
+		})
+	}
+}
+
+func TestLoadBundleSigningKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	signer, err := controllers.LoadBundleSigningKey(p)
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(signer.Public()))
+
+	require.NoError(t, os.WriteFile(p, []byte("not a key"), 0600))
+	_, err = controllers.LoadBundleSigningKey(p)
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+
+	apb "px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	vpb "px.dev/pixie/src/shared/artifacts/versionspb"
+)
+
+// ArtifactMirror is an operator registered endpoint that serves artifacts using the same
+// layout as the artifact bucket.
+type ArtifactMirror struct {
+	Name    string `yaml:"name"`
+	BaseURL string `yaml:"baseURL"`
+}
+
+type mirrorConfig struct {
+	Mirrors []*ArtifactMirror `yaml:"mirrors"`
+	Default string            `yaml:"default"`
+}
+
+// LoadArtifactMirrors reads the mirror config at the given path. The config is a YAML file of the form:
+//
+//	mirrors:
+//	- name: internal
+//	  baseURL: https://artifacts.internal.example.com/pixie
+//	default: internal
+func LoadArtifactMirrors(p string) ([]*ArtifactMirror, string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg := &mirrorConfig{}
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, "", fmt.Errorf("invalid artifact mirror config: %w", err)
+	}
+	return cfg.Mirrors, cfg.Default, nil
+}
+
+// SetArtifactMirrors registers the mirrors that artifacts can be downloaded from. If defaultMirror is
+// non-empty, requests that don't specify a mirror are served from it instead of the artifact bucket.
+func (s *Server) SetArtifactMirrors(mirrors []*ArtifactMirror, defaultMirror string) error {
+	byName := make(map[string]*ArtifactMirror)
+	for _, m := range mirrors {
+		if m.Name == "" {
+			return errors.New("artifact mirror must have a name")
+		}
+		if _, ok := byName[m.Name]; ok {
+			return fmt.Errorf("duplicate artifact mirror %q", m.Name)
+		}
+		u, err := url.Parse(m.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("artifact mirror %q has invalid base URL %q", m.Name, m.BaseURL)
+		}
+		byName[m.Name] = m
+	}
+	if _, ok := byName[defaultMirror]; defaultMirror != "" && !ok {
+		return fmt.Errorf("default artifact mirror %q is not registered", defaultMirror)
+	}
+
+	s.mirrors = mirrors
+	s.mirrorsByName = byName
+	s.defaultMirror = defaultMirror
+	return nil
+}
+
+// ListArtifactMirrors lists the registered artifact mirrors.
+func (s *Server) ListArtifactMirrors(ctx context.Context, in *apb.ListArtifactMirrorsRequest) (*apb.ListArtifactMirrorsResponse, error) {
+	resp := &apb.ListArtifactMirrorsResponse{
+		Mirrors: make([]*apb.ArtifactMirror, len(s.mirrors)),
+	}
+	for i, m := range s.mirrors {
+		resp.Mirrors[i] = &apb.ArtifactMirror{
+			Name:    m.Name,
+			BaseURL: m.BaseURL,
+			Default: m.Name == s.defaultMirror,
+		}
+	}
+	return resp, nil
+}
+
+// selectMirror returns the mirror that a request should be served from, or nil if it should be
+// served from the artifact bucket or the manifest.
+func (s *Server) selectMirror(name string) (*ArtifactMirror, error) {
+	if name == "" {
+		name = s.defaultMirror
+	}
+	if name == "" {
+		return nil, nil
+	}
+	m, ok := s.mirrorsByName[name]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown artifact mirror %q", name)
+	}
+	return m, nil
+}
+
+func (s *Server) locateArtifactInMirror(ctx context.Context, m *ArtifactMirror, objectPath string) (*artifactLocation, error) {
+	u := strings.TrimSuffix(m.BaseURL, "/") + "/" + objectPath
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u+".sha256", nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create sha256 request")
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to reach artifact mirror %q", m.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, status.Error(codes.NotFound, "artifact not found in mirror")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, status.Errorf(codes.Unavailable, "artifact mirror %q returned status %d", m.Name, resp.StatusCode)
+	}
+	sha256Bytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to read sha256 file")
+	}
+
+	return &artifactLocation{
+		url:    u,
+		sha256: strings.TrimSpace(string(sha256Bytes)),
+	}, nil
+}
+
+func artifactObjectPath(name string, versionStr string, at vpb.ArtifactType) string {
+	return path.Join(name, versionStr, fmt.Sprintf("%s_%s", name, downloadSuffix(at)))
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apb "px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	"px.dev/pixie/src/cloud/artifact_tracker/controllers"
+	vpb "px.dev/pixie/src/shared/artifacts/versionspb"
+)
+
+func startTestMirror(t *testing.T, files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, err := w.Write([]byte(contents))
+		assert.NoError(t, err)
+	}))
+}
+
+func TestServer_SetArtifactMirrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mirrors       []*controllers.ArtifactMirror
+		defaultMirror string
+		valid         bool
+	}{
+		{
+			name: "valid",
+			mirrors: []*controllers.ArtifactMirror{
+				{Name: "a", BaseURL: "https://a.example.com/pixie"},
+				{Name: "b", BaseURL: "http://b.example.com"},
+			},
+			defaultMirror: "b",
+			valid:         true,
+		},
+		{
+			name: "missing name",
+			mirrors: []*controllers.ArtifactMirror{
+				{BaseURL: "https://a.example.com"},
+			},
+		},
+		{
+			name: "duplicate name",
+			mirrors: []*controllers.ArtifactMirror{
+				{Name: "a", BaseURL: "https://a.example.com"},
+				{Name: "a", BaseURL: "https://b.example.com"},
+			},
+		},
+		{
+			name: "invalid url",
+			mirrors: []*controllers.ArtifactMirror{
+				{Name: "a", BaseURL: "gs://a/pixie"},
+			},
+		},
+		{
+			name: "unknown default",
+			mirrors: []*controllers.ArtifactMirror{
+				{Name: "a", BaseURL: "https://a.example.com"},
+			},
+			defaultMirror: "b",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := controllers.NewServer(nil, "bucket", nil)
+			err := server.SetArtifactMirrors(tc.mirrors, tc.defaultMirror)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			resp, err := server.ListArtifactMirrors(context.Background(), &apb.ListArtifactMirrorsRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, []*apb.ArtifactMirror{
+				{Name: "a", BaseURL: "https://a.example.com/pixie"},
+				{Name: "b", BaseURL: "http://b.example.com", Default: true},
+			}, resp.Mirrors)
+		})
+	}
+}
+
+func TestLoadArtifactMirrors(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "mirrors.yaml")
+	err := os.WriteFile(p, []byte(`
+mirrors:
+- name: internal
+  baseURL: https://artifacts.internal.example.com/pixie
+default: internal
+`), 0600)
+	require.NoError(t, err)
+
+	mirrors, defaultMirror, err := controllers.LoadArtifactMirrors(p)
+	require.NoError(t, err)
+	assert.Equal(t, []*controllers.ArtifactMirror{
+		{Name: "internal", BaseURL: "https://artifacts.internal.example.com/pixie"},
+	}, mirrors)
+	assert.Equal(t, "internal", defaultMirror)
+
+	err = os.WriteFile(p, []byte("mirrors:\n- name: internal\n  url: https://example.com\n"), 0600)
+	require.NoError(t, err)
+	_, _, err = controllers.LoadArtifactMirrors(p)
+	assert.Error(t, err)
+}
+
+func TestServer_GetDownloadLink_Mirror(t *testing.T) {
+	mirror := startTestMirror(t, map[string]string{
+		"/pixie/cli/1.2.3/cli_linux_amd64.sha256":              "mirror-sha\n",
+		"/pixie/vizier/0.1.1/vizier_yamls.tar.sha256":          "mirror-vizier-sha",
+		"/pixie/vizier/0.1.1/vizier_template_yamls.tar.sha256": "mirror-template-sha",
+	})
+	defer mirror.Close()
+
+	ts := startTestHTTPServer(t)
+	defer ts.Close()
+
+	server := controllers.NewServer(mustSetupFakeBucket(t), "test-bucket", nil)
+	require.NoError(t, loadTestManifest(server, ts))
+	require.NoError(t, server.SetArtifactMirrors([]*controllers.ArtifactMirror{
+		{Name: "internal", BaseURL: mirror.URL + "/pixie/"},
+	}, ""))
+
+	testCases := []struct {
+		name         string
+		req          apb.GetDownloadLinkRequest
+		expectedResp *apb.GetDownloadLinkResponse
+		errCode      codes.Code
+	}{
+		{
+			name: "no mirror uses the bucket",
+			req: apb.GetDownloadLinkRequest{
+				ArtifactName: "cli",
+				VersionStr:   "1.2.1-pre.3",
+				ArtifactType: vpb.AT_LINUX_AMD64,
+			},
+			expectedResp: &apb.GetDownloadLinkResponse{
+				Url:    "the-url",
+				SHA256: "the-sha256",
+			},
+		},
+		{
+			name: "registered mirror",
+			req: apb.GetDownloadLinkRequest{
+				ArtifactName: "cli",
+				VersionStr:   "1.2.3",
+				ArtifactType: vpb.AT_LINUX_AMD64,
+				Mirror:       "internal",
+			},
+			expectedResp: &apb.GetDownloadLinkResponse{
+				Url:    mirror.URL + "/pixie/cli/1.2.3/cli_linux_amd64",
+				SHA256: "mirror-sha",
+			},
+		},
+		{
+			name: "registered mirror takes precedence over manifest mirrors",
+			req: apb.GetDownloadLinkRequest{
+				ArtifactName: "vizier",
+				VersionStr:   "0.1.1",
+				ArtifactType: vpb.AT_CONTAINER_SET_YAMLS,
+				Mirror:       "internal",
+			},
+			expectedResp: &apb.GetDownloadLinkResponse{
+				Url:    mirror.URL + "/pixie/vizier/0.1.1/vizier_yamls.tar",
+				SHA256: "mirror-vizier-sha",
+			},
+		},
+		{
+			name: "artifact missing from mirror",
+			req: apb.GetDownloadLinkRequest{
+				ArtifactName: "cli",
+				VersionStr:   "1.1.5",
+				ArtifactType: vpb.AT_LINUX_AMD64,
+				Mirror:       "internal",
+			},
+			errCode: codes.NotFound,
+		},
+		{
+			name: "artifact missing from manifest",
+			req: apb.GetDownloadLinkRequest{
+				ArtifactName: "cli",
+				VersionStr:   "1.2.1-pre.3",
+				ArtifactType: vpb.AT_DARWIN_AMD64,
+				Mirror:       "internal",
+			},
+			errCode: codes.NotFound,
+		},
+		{
+			name: "unknown mirror",
+			req: apb.GetDownloadLinkRequest{
+				ArtifactName: "cli",
+				VersionStr:   "1.2.3",
+				ArtifactType: vpb.AT_LINUX_AMD64,
+				Mirror:       "other",
+			},
+			errCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := server.GetDownloadLink(context.Background(), &tc.req)
+			if tc.errCode != codes.OK {
+				assert.Equal(t, tc.errCode, status.Code(err))
+				assert.Nil(t, resp)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedResp.Url, resp.Url)
+			assert.Equal(t, tc.expectedResp.SHA256, resp.SHA256)
+		})
+	}
+
+	t.Run("default mirror", func(t *testing.T) {
+		require.NoError(t, server.SetArtifactMirrors([]*controllers.ArtifactMirror{
+			{Name: "internal", BaseURL: mirror.URL + "/pixie"},
+		}, "internal"))
+		resp, err := server.GetDownloadLink(context.Background(), &apb.GetDownloadLinkRequest{
+			ArtifactName: "cli",
+			VersionStr:   "1.2.3",
+			ArtifactType: vpb.AT_LINUX_AMD64,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, mirror.URL+"/pixie/cli/1.2.3/cli_linux_amd64", resp.Url)
+		assert.Equal(t, "mirror-sha", resp.SHA256)
+	})
+}
@@ -20,9 +20,9 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	"crypto"
 	"io"
-	"path"
+	"net/http"
 	"strings"
 	"time"
 
@@ -55,11 +55,27 @@ type Server struct {
 	artifactBucket string
 	gcsSA          *jwt.Config
 	m              *manifest.ArtifactManifest
+	httpClient     *http.Client
+
+	mirrors       []*ArtifactMirror
+	mirrorsByName map[string]*ArtifactMirror
+	defaultMirror string
+
+	bundleSigner crypto.Signer
+
+	// usage is where artifact downloads are recorded, if usage tracking is enabled.
+	usage UsageDatastore
 }
 
 // NewServer creates a new artifact tracker server.
 func NewServer(client stiface.Client, bucket string, gcsSA *jwt.Config) *Server {
-	return &Server{sc: client, artifactBucket: bucket, gcsSA: gcsSA}
+	return &Server{
+		sc:             client,
+		artifactBucket: bucket,
+		gcsSA:          gcsSA,
+		httpClient:     &http.Client{},
+		mirrorsByName:  make(map[string]*ArtifactMirror),
+	}
 }
 
 func (s *Server) getArtifactListSpecifiedVizier() (*vpb.ArtifactSet, error) {
@@ -155,6 +171,14 @@ func downloadSuffix(at vpb.ArtifactType) string {
 	return "unknown"
 }
 
+// artifactLocation is where a downloadable artifact can be fetched from.
+type artifactLocation struct {
+	url    string
+	sha256 string
+	// objectPath is the path of the artifact in the artifact bucket, if it is served from there.
+	objectPath string
+}
+
 // GetDownloadLink returns a signed download link that can be used to download the artifact.
 func (s *Server) GetDownloadLink(ctx context.Context, in *apb.GetDownloadLinkRequest) (*apb.GetDownloadLinkResponse, error) {
 	versionStr := in.VersionStr
@@ -173,10 +197,42 @@ func (s *Server) GetDownloadLink(ctx context.Context, in *apb.GetDownloadLinkReq
 		return nil, status.Error(codes.InvalidArgument, "artifact type cannot be unknown")
 	}
 
-	if !(at == vpb.AT_DARWIN_AMD64 || at == vpb.AT_LINUX_AMD64 || at == vpb.AT_CONTAINER_SET_YAMLS || at == vpb.AT_CONTAINER_SET_TEMPLATE_YAMLS) {
+	if !isDownloadable(at) {
 		return nil, status.Error(codes.InvalidArgument, "artifact type cannot be downloaded")
 	}
 
+	mirror, err := s.selectMirror(in.Mirror)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := s.locateArtifact(ctx, name, versionStr, at, mirror)
+	if err != nil {
+		return nil, err
+	}
+	if !in.ValidateOnly {
+		s.recordDownload(name, versionStr, at, in.OrgID, in.ClusterID)
+	}
+
+	return &apb.GetDownloadLinkResponse{
+		Url:        loc.url,
+		SHA256:     loc.sha256,
+		ValidUntil: validUntil(),
+	}, nil
+}
+
+func validUntil() *types.Timestamp {
+	tpb, _ := types.TimestampProto(time.Now().Add(60 * time.Minute))
+	return tpb
+}
+
+func isDownloadable(at vpb.ArtifactType) bool {
+	return at == vpb.AT_DARWIN_AMD64 || at == vpb.AT_LINUX_AMD64 || at == vpb.AT_CONTAINER_SET_YAMLS || at == vpb.AT_CONTAINER_SET_TEMPLATE_YAMLS
+}
+
+// locateArtifact finds where the given artifact can be downloaded from. Registered mirrors take
+// precedence over the manifest's mirrors, which in turn take precedence over the artifact bucket.
+func (s *Server) locateArtifact(ctx context.Context, name string, versionStr string, at vpb.ArtifactType, mirror *ArtifactMirror) (*artifactLocation, error) {
 	// If a specific vizier or CLI version is specified, check that the requested version matches. Otherwise, if no version is specified
 	// then we check the DB to see if the version exists.
 	if name == vizierArtifactName && (at == vpb.AT_CONTAINER_SET_YAMLS || at == vpb.AT_CONTAINER_SET_TEMPLATE_YAMLS) && viper.GetString("vizier_version") != "" {
@@ -197,9 +253,11 @@ func (s *Server) GetDownloadLink(ctx context.Context, in *apb.GetDownloadLinkReq
 			return nil, status.Error(codes.NotFound, "artifact not found")
 		}
 
-		for _, am := range a.AvailableArtifactMirrors {
-			if am.ArtifactType == at && len(am.URLs) > 0 {
-				return s.getDownloadLinkForMirrors(ctx, am)
+		if mirror == nil {
+			for _, am := range a.AvailableArtifactMirrors {
+				if am.ArtifactType == at && len(am.URLs) > 0 {
+					return s.locateArtifactForMirrors(am), nil
+				}
 			}
 		}
 		// Fallthrough to the legacy method.
@@ -211,26 +269,32 @@ func (s *Server) GetDownloadLink(ctx context.Context, in *apb.GetDownloadLinkReq
 				break
 			}
 		}
+		for _, am := range a.AvailableArtifactMirrors {
+			if am.ArtifactType == at {
+				hasAT = true
+				break
+			}
+		}
 		if !hasAT {
 			return nil, status.Error(codes.NotFound, "artifact with given artifact_type not found")
 		}
 	}
 
-	expires := time.Now().Add(time.Minute * 60)
+	// location: gs://<artifact_bucket>/cli/2019.10.03-1/cli_linux_amd64
+	objectPath := artifactObjectPath(name, versionStr, at)
+	if mirror != nil {
+		return s.locateArtifactInMirror(ctx, mirror, objectPath)
+	}
 
 	// Artifact found, generate the download link.
-	// location: gs://<artifact_bucket>/cli/2019.10.03-1/cli_linux_amd64
 	bucket := s.artifactBucket
 
-	objectPath := path.Join(name, versionStr, fmt.Sprintf("%s_%s", name, downloadSuffix(at)))
 	attr, err := s.sc.Bucket(bucket).Object(objectPath).Attrs(ctx)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to get URL")
 	}
 	url := attr.MediaLink
 
-	tpb, _ := types.TimestampProto(expires)
-
 	sha256ObjectPath := objectPath + ".sha256"
 	r, err := s.sc.Bucket(bucket).Object(sha256ObjectPath).NewReader(ctx)
 
@@ -244,27 +308,20 @@ func (s *Server) GetDownloadLink(ctx context.Context, in *apb.GetDownloadLinkReq
 		return nil, status.Error(codes.Internal, "failed to read sha256 file")
 	}
 
-	return &apb.GetDownloadLinkResponse{
-		Url:        url,
-		SHA256:     strings.TrimSpace(string(sha256bytes)),
-		ValidUntil: tpb,
+	return &artifactLocation{
+		url:        url,
+		sha256:     strings.TrimSpace(string(sha256bytes)),
+		objectPath: objectPath,
 	}, nil
 }
 
-func (s *Server) getDownloadLinkForMirrors(ctx context.Context, am *vpb.ArtifactMirrors) (*apb.GetDownloadLinkResponse, error) {
+func (s *Server) locateArtifactForMirrors(am *vpb.ArtifactMirrors) *artifactLocation {
 	// For now we return a download link to the first mirror.
 	// In the future, the API will change to support returning multiple mirrors.
-	url := am.URLs[0]
-	sha256Bytes := am.SHA256
-	valid, err := types.TimestampProto(time.Now().Add(60 * time.Minute))
-	if err != nil {
-		return nil, err
+	return &artifactLocation{
+		url:    am.URLs[0],
+		sha256: strings.TrimSpace(am.SHA256),
 	}
-	return &apb.GetDownloadLinkResponse{
-		Url:        url,
-		SHA256:     strings.TrimSpace(string(sha256Bytes)),
-		ValidUntil: valid,
-	}, nil
 }
 
 // UpdateManifest switches the server's manifest to use the one given.
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	apb "px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	"px.dev/pixie/src/cloud/artifact_tracker/datastore"
+	vpb "px.dev/pixie/src/shared/artifacts/versionspb"
+	"px.dev/pixie/src/utils"
+)
+
+// defaultAdoptionReportPeriod is the period that adoption reports cover if no start time is given.
+const defaultAdoptionReportPeriod = 30 * 24 * time.Hour
+
+// UsageDatastore is the interface used to record and report on artifact downloads.
+type UsageDatastore interface {
+	RecordDownload(*datastore.ArtifactDownload) error
+	GetVersionAdoption(artifactName string, since time.Time) ([]*datastore.VersionAdoption, error)
+	GetLatestClusterDownloads(artifactName string) ([]*datastore.ClusterDownload, error)
+}
+
+// EnableUsageTracking records artifact downloads to the given datastore, which adoption reports are computed from.
+func (s *Server) EnableUsageTracking(ds UsageDatastore) {
+	s.usage = ds
+}
+
+func uuidPtrFromProto(pb *uuidpb.UUID) *uuid.UUID {
+	u := utils.UUIDFromProtoOrNil(pb)
+	if u == uuid.Nil {
+		return nil
+	}
+	return &u
+}
+
+func protoFromUUIDPtr(u *uuid.UUID) *uuidpb.UUID {
+	if u == nil {
+		return nil
+	}
+	return utils.ProtoFromUUID(*u)
+}
+
+// recordDownload records a download of the given artifact. Failures are logged rather than returned, since
+// usage tracking shouldn't prevent artifacts from being downloaded.
+func (s *Server) recordDownload(name string, versionStr string, at vpb.ArtifactType, orgID *uuidpb.UUID, clusterID *uuidpb.UUID) {
+	if s.usage == nil {
+		return
+	}
+	err := s.usage.RecordDownload(&datastore.ArtifactDownload{
+		ArtifactName: name,
+		VersionStr:   versionStr,
+		ArtifactType: at.String(),
+		OrgID:        uuidPtrFromProto(orgID),
+		ClusterID:    uuidPtrFromProto(clusterID),
+	})
+	if err != nil {
+		log.WithError(err).WithField("artifact", name).WithField("version", versionStr).Error("Failed to record artifact download")
+	}
+}
+
+// compareVersions orders versions by semver, falling back to string comparison for versions that can't be parsed.
+func compareVersions(a string, b string) int {
+	av, aErr := semver.Parse(a)
+	bv, bErr := semver.Parse(b)
+	if aErr == nil && bErr == nil {
+		return av.Compare(bv)
+	}
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// GetArtifactAdoptionReport summarizes the downloads of each version of an artifact.
+func (s *Server) GetArtifactAdoptionReport(ctx context.Context, in *apb.GetArtifactAdoptionReportRequest) (*apb.ArtifactAdoptionReport, error) {
+	if s.usage == nil {
+		return nil, status.Error(codes.FailedPrecondition, "usage tracking is not enabled")
+	}
+	if in.ArtifactName == "" {
+		return nil, status.Error(codes.InvalidArgument, "artifact name cannot be empty")
+	}
+
+	since := time.Now().Add(-defaultAdoptionReportPeriod)
+	if in.Since != nil {
+		t, err := types.TimestampFromProto(in.Since)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid start time")
+		}
+		since = t
+	}
+
+	versions, err := s.usage.GetVersionAdoption(in.ArtifactName, since)
+	if err != nil {
+		log.WithError(err).Error("Failed to get artifact adoption")
+		return nil, status.Error(codes.Internal, "failed to get artifact adoption")
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i].VersionStr, versions[j].VersionStr) > 0
+	})
+
+	resp := &apb.ArtifactAdoptionReport{
+		ArtifactName: in.ArtifactName,
+		Versions:     make([]*apb.VersionAdoption, len(versions)),
+	}
+	for i, v := range versions {
+		last, _ := types.TimestampProto(v.LastDownloaded)
+		resp.Versions[i] = &apb.VersionAdoption{
+			VersionStr:     v.VersionStr,
+			NumDownloads:   v.NumDownloads,
+			NumOrgs:        v.NumOrgs,
+			NumClusters:    v.NumClusters,
+			LastDownloaded: last,
+		}
+	}
+	return resp, nil
+}
+
+// ListLaggingClusters lists the clusters whose most recently downloaded version of an artifact is older than the given version.
+func (s *Server) ListLaggingClusters(ctx context.Context, in *apb.ListLaggingClustersRequest) (*apb.ListLaggingClustersResponse, error) {
+	if s.usage == nil {
+		return nil, status.Error(codes.FailedPrecondition, "usage tracking is not enabled")
+	}
+	if in.ArtifactName == "" {
+		return nil, status.Error(codes.InvalidArgument, "artifact name cannot be empty")
+	}
+	if _, err := semver.Parse(in.MinVersion); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "min version must be a valid semver")
+	}
+
+	downloads, err := s.usage.GetLatestClusterDownloads(in.ArtifactName)
+	if err != nil {
+		log.WithError(err).Error("Failed to get cluster downloads")
+		return nil, status.Error(codes.Internal, "failed to get cluster downloads")
+	}
+
+	resp := &apb.ListLaggingClustersResponse{
+		Clusters: []*apb.LaggingCluster{},
+	}
+	for _, d := range downloads {
+		if compareVersions(d.VersionStr, in.MinVersion) >= 0 {
+			continue
+		}
+		last, _ := types.TimestampProto(d.DownloadedAt)
+		resp.Clusters = append(resp.Clusters, &apb.LaggingCluster{
+			ClusterID:      utils.ProtoFromUUID(d.ClusterID),
+			OrgID:          protoFromUUIDPtr(d.OrgID),
+			VersionStr:     d.VersionStr,
+			LastDownloaded: last,
+		})
+	}
+	return resp, nil
+}
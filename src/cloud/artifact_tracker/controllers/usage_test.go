@@ -0,0 +1,164 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apb "px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	"px.dev/pixie/src/cloud/artifact_tracker/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/artifact_tracker/controllers/mock"
+	"px.dev/pixie/src/cloud/artifact_tracker/datastore"
+	vpb "px.dev/pixie/src/shared/artifacts/versionspb"
+	"px.dev/pixie/src/utils"
+)
+
+func TestServer_GetDownloadLink_RecordsDownload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockUsage := mock_controllers.NewMockUsageDatastore(ctrl)
+
+	ts := startTestHTTPServer(t)
+	defer ts.Close()
+
+	server := controllers.NewServer(mustSetupFakeBucket(t), "test-bucket", nil)
+	require.NoError(t, loadTestManifest(server, ts))
+	server.EnableUsageTracking(mockUsage)
+
+	orgID := uuid.Must(uuid.NewV4())
+	clusterID := uuid.Must(uuid.NewV4())
+	mockUsage.EXPECT().RecordDownload(&datastore.ArtifactDownload{
+		ArtifactName: "cli",
+		VersionStr:   "1.2.1-pre.3",
+		ArtifactType: "AT_LINUX_AMD64",
+		OrgID:        &orgID,
+		ClusterID:    &clusterID,
+	}).Return(nil)
+
+	_, err := server.GetDownloadLink(context.Background(), &apb.GetDownloadLinkRequest{
+		ArtifactName: "cli",
+		VersionStr:   "1.2.1-pre.3",
+		ArtifactType: vpb.AT_LINUX_AMD64,
+		OrgID:        utils.ProtoFromUUID(orgID),
+		ClusterID:    utils.ProtoFromUUID(clusterID),
+	})
+	require.NoError(t, err)
+
+	// Failures to record downloads don't fail the request.
+	mockUsage.EXPECT().RecordDownload(&datastore.ArtifactDownload{
+		ArtifactName: "cli",
+		VersionStr:   "1.2.1-pre.3",
+		ArtifactType: "AT_LINUX_AMD64",
+	}).Return(errors.New("db is down"))
+	_, err = server.GetDownloadLink(context.Background(), &apb.GetDownloadLinkRequest{
+		ArtifactName: "cli",
+		VersionStr:   "1.2.1-pre.3",
+		ArtifactType: vpb.AT_LINUX_AMD64,
+	})
+	require.NoError(t, err)
+
+	// Validation requests aren't recorded.
+	_, err = server.GetDownloadLink(context.Background(), &apb.GetDownloadLinkRequest{
+		ArtifactName: "cli",
+		VersionStr:   "1.2.1-pre.3",
+		ArtifactType: vpb.AT_LINUX_AMD64,
+		ValidateOnly: true,
+	})
+	require.NoError(t, err)
+}
+
+func TestServer_GetArtifactAdoptionReport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockUsage := mock_controllers.NewMockUsageDatastore(ctrl)
+
+	server := controllers.NewServer(nil, "bucket", nil)
+	_, err := server.GetArtifactAdoptionReport(context.Background(), &apb.GetArtifactAdoptionReportRequest{ArtifactName: "vizier"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	server.EnableUsageTracking(mockUsage)
+	_, err = server.GetArtifactAdoptionReport(context.Background(), &apb.GetArtifactAdoptionReportRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	last := time.Unix(1650000000, 0).UTC()
+	mockUsage.EXPECT().GetVersionAdoption("vizier", gomock.Any()).DoAndReturn(func(name string, since time.Time) ([]*datastore.VersionAdoption, error) {
+		assert.WithinDuration(t, time.Now().Add(-30*24*time.Hour), since, time.Minute)
+		return []*datastore.VersionAdoption{
+			{VersionStr: "0.9.0", NumDownloads: 5, NumOrgs: 2, NumClusters: 3, LastDownloaded: last},
+			{VersionStr: "0.10.0", NumDownloads: 7, NumOrgs: 3, NumClusters: 4, LastDownloaded: last},
+			{VersionStr: "0.10.0-pre.1", NumDownloads: 1, NumOrgs: 1, NumClusters: 1, LastDownloaded: last},
+		}, nil
+	})
+
+	resp, err := server.GetArtifactAdoptionReport(context.Background(), &apb.GetArtifactAdoptionReportRequest{ArtifactName: "vizier"})
+	require.NoError(t, err)
+	assert.Equal(t, "vizier", resp.ArtifactName)
+	versions := make([]string, len(resp.Versions))
+	for i, v := range resp.Versions {
+		versions[i] = v.VersionStr
+	}
+	assert.Equal(t, []string{"0.10.0", "0.10.0-pre.1", "0.9.0"}, versions)
+	assert.Equal(t, int64(7), resp.Versions[0].NumDownloads)
+	assert.Equal(t, int64(3), resp.Versions[0].NumOrgs)
+	assert.Equal(t, int64(4), resp.Versions[0].NumClusters)
+	assert.Equal(t, int64(1650000000), resp.Versions[0].LastDownloaded.Seconds)
+}
+
+func TestServer_ListLaggingClusters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockUsage := mock_controllers.NewMockUsageDatastore(ctrl)
+
+	server := controllers.NewServer(nil, "bucket", nil)
+	server.EnableUsageTracking(mockUsage)
+
+	_, err := server.ListLaggingClusters(context.Background(), &apb.ListLaggingClustersRequest{
+		ArtifactName: "vizier",
+		MinVersion:   "latest",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	orgID := uuid.Must(uuid.NewV4())
+	lagging := uuid.Must(uuid.NewV4())
+	upToDate := uuid.Must(uuid.NewV4())
+	mockUsage.EXPECT().GetLatestClusterDownloads("vizier").Return([]*datastore.ClusterDownload{
+		{ClusterID: lagging, OrgID: &orgID, VersionStr: "0.9.5", DownloadedAt: time.Unix(1650000000, 0)},
+		{ClusterID: upToDate, VersionStr: "0.10.1", DownloadedAt: time.Unix(1650000000, 0)},
+	}, nil)
+
+	resp, err := server.ListLaggingClusters(context.Background(), &apb.ListLaggingClustersRequest{
+		ArtifactName: "vizier",
+		MinVersion:   "0.10.0",
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Clusters, 1)
+	assert.Equal(t, utils.ProtoFromUUID(lagging), resp.Clusters[0].ClusterID)
+	assert.Equal(t, utils.ProtoFromUUID(orgID), resp.Clusters[0].OrgID)
+	assert.Equal(t, "0.9.5", resp.Clusters[0].VersionStr)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package datastore
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ArtifactDownload is a single download of an artifact.
+type ArtifactDownload struct {
+	ArtifactName string `db:"artifact_name"`
+	VersionStr   string `db:"version_str"`
+	ArtifactType string `db:"artifact_type"`
+	// The org and cluster that downloaded the artifact, if known.
+	OrgID     *uuid.UUID `db:"org_id"`
+	ClusterID *uuid.UUID `db:"cluster_id"`
+}
+
+// VersionAdoption summarizes the downloads of a single version of an artifact.
+type VersionAdoption struct {
+	VersionStr     string    `db:"version_str"`
+	NumDownloads   int64     `db:"num_downloads"`
+	NumOrgs        int64     `db:"num_orgs"`
+	NumClusters    int64     `db:"num_clusters"`
+	LastDownloaded time.Time `db:"last_downloaded"`
+}
+
+// ClusterDownload is the latest download of an artifact by a cluster.
+type ClusterDownload struct {
+	ClusterID    uuid.UUID  `db:"cluster_id"`
+	OrgID        *uuid.UUID `db:"org_id"`
+	VersionStr   string     `db:"version_str"`
+	DownloadedAt time.Time  `db:"downloaded_at"`
+}
+
+// Datastore implements the artifact usage datastore.
+type Datastore struct {
+	db *sqlx.DB
+}
+
+// NewDatastore creates a new artifact usage datastore.
+func NewDatastore(db *sqlx.DB) *Datastore {
+	return &Datastore{db: db}
+}
+
+// RecordDownload records a download of an artifact.
+func (d *Datastore) RecordDownload(download *ArtifactDownload) error {
+	query := `INSERT INTO artifact_downloads(artifact_name, version_str, artifact_type, org_id, cluster_id)
+		VALUES (:artifact_name, :version_str, :artifact_type, :org_id, :cluster_id)`
+	_, err := d.db.NamedExec(query, download)
+	return err
+}
+
+// GetVersionAdoption summarizes the downloads of each version of the given artifact since the given time.
+func (d *Datastore) GetVersionAdoption(artifactName string, since time.Time) ([]*VersionAdoption, error) {
+	query := `SELECT version_str, COUNT(*) AS num_downloads, COUNT(DISTINCT org_id) AS num_orgs,
+		COUNT(DISTINCT cluster_id) AS num_clusters, MAX(downloaded_at) AS last_downloaded
+		FROM artifact_downloads WHERE artifact_name = $1 AND downloaded_at >= $2 GROUP BY version_str`
+	var versions []*VersionAdoption
+	err := d.db.Select(&versions, query, artifactName, since)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetLatestClusterDownloads gets the latest download of the given artifact by each cluster.
+func (d *Datastore) GetLatestClusterDownloads(artifactName string) ([]*ClusterDownload, error) {
+	query := `SELECT DISTINCT ON (cluster_id) cluster_id, org_id, version_str, downloaded_at
+		FROM artifact_downloads WHERE artifact_name = $1 AND cluster_id IS NOT NULL
+		ORDER BY cluster_id, downloaded_at DESC`
+	var downloads []*ClusterDownload
+	err := d.db.Select(&downloads, query, artifactName)
+	if err != nil {
+		return nil, err
+	}
+	return downloads, nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package datastore_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/artifact_tracker/datastore"
+	"px.dev/pixie/src/cloud/artifact_tracker/schema"
+	"px.dev/pixie/src/shared/services/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+var db *sqlx.DB
+
+func testMain(m *testing.M) error {
+	s := bindata.Resource(schema.AssetNames(), schema.Asset)
+	testDB, teardown, err := pgtest.SetupTestDB(s)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+var (
+	org1     = uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+	org2     = uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")
+	cluster1 = uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+	cluster2 = uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440002")
+	cluster3 = uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440001")
+)
+
+func mustLoadTestData(db *sqlx.DB) {
+	db.MustExec(`DELETE FROM artifact_downloads`)
+
+	insertDownload := `INSERT INTO artifact_downloads(artifact_name, version_str, artifact_type, org_id, cluster_id, downloaded_at)
+		VALUES ($1, $2, $3, $4, $5, NOW() - $6::interval)`
+	db.MustExec(insertDownload, "vizier", "0.1.0", "AT_CONTAINER_SET_TEMPLATE_YAMLS", org1, cluster1, "10 days")
+	db.MustExec(insertDownload, "vizier", "0.2.0", "AT_CONTAINER_SET_TEMPLATE_YAMLS", org1, cluster1, "2 days")
+	db.MustExec(insertDownload, "vizier", "0.1.0", "AT_CONTAINER_SET_TEMPLATE_YAMLS", org1, cluster2, "9 days")
+	db.MustExec(insertDownload, "vizier", "0.1.0", "AT_CONTAINER_SET_TEMPLATE_YAMLS", org2, cluster3, "40 days")
+	db.MustExec(insertDownload, "cli", "0.3.0", "AT_LINUX_AMD64", nil, nil, "1 day")
+}
+
+func TestDatastore_RecordDownload(t *testing.T) {
+	mustLoadTestData(db)
+
+	d := datastore.NewDatastore(db)
+	err := d.RecordDownload(&datastore.ArtifactDownload{
+		ArtifactName: "cli",
+		VersionStr:   "0.3.1",
+		ArtifactType: "AT_DARWIN_AMD64",
+	})
+	require.NoError(t, err)
+	err = d.RecordDownload(&datastore.ArtifactDownload{
+		ArtifactName: "vizier",
+		VersionStr:   "0.2.0",
+		ArtifactType: "AT_CONTAINER_SET_TEMPLATE_YAMLS",
+		OrgID:        &org2,
+		ClusterID:    &cluster3,
+	})
+	require.NoError(t, err)
+
+	var downloads []*datastore.ArtifactDownload
+	err = db.Select(&downloads, `SELECT artifact_name, version_str, artifact_type, org_id, cluster_id FROM artifact_downloads WHERE version_str IN ('0.3.1', '0.2.0') ORDER BY id`)
+	require.NoError(t, err)
+	require.Len(t, downloads, 3)
+	assert.Equal(t, "0.3.1", downloads[1].VersionStr)
+	assert.Nil(t, downloads[1].OrgID)
+	assert.Nil(t, downloads[1].ClusterID)
+	assert.Equal(t, org2, *downloads[2].OrgID)
+	assert.Equal(t, cluster3, *downloads[2].ClusterID)
+}
+
+func TestDatastore_GetVersionAdoption(t *testing.T) {
+	mustLoadTestData(db)
+
+	d := datastore.NewDatastore(db)
+	versions, err := d.GetVersionAdoption("vizier", time.Now().Add(-30*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	byVersion := make(map[string]*datastore.VersionAdoption)
+	for _, v := range versions {
+		byVersion[v.VersionStr] = v
+	}
+	assert.Equal(t, int64(2), byVersion["0.1.0"].NumDownloads)
+	assert.Equal(t, int64(1), byVersion["0.1.0"].NumOrgs)
+	assert.Equal(t, int64(2), byVersion["0.1.0"].NumClusters)
+	assert.Equal(t, int64(1), byVersion["0.2.0"].NumDownloads)
+	assert.Equal(t, int64(1), byVersion["0.2.0"].NumClusters)
+
+	// Anonymous downloads aren't counted as orgs or clusters.
+	versions, err = d.GetVersionAdoption("cli", time.Now().Add(-30*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, int64(1), versions[0].NumDownloads)
+	assert.Equal(t, int64(0), versions[0].NumOrgs)
+	assert.Equal(t, int64(0), versions[0].NumClusters)
+}
+
+func TestDatastore_GetLatestClusterDownloads(t *testing.T) {
+	mustLoadTestData(db)
+
+	d := datastore.NewDatastore(db)
+	downloads, err := d.GetLatestClusterDownloads("vizier")
+	require.NoError(t, err)
+	require.Len(t, downloads, 3)
+
+	byCluster := make(map[uuid.UUID]string)
+	for _, dl := range downloads {
+		byCluster[dl.ClusterID] = dl.VersionStr
+	}
+	assert.Equal(t, map[uuid.UUID]string{
+		cluster1: "0.2.0",
+		cluster2: "0.1.0",
+		cluster3: "0.1.0",
+	}, byCluster)
+
+	downloads, err = d.GetLatestClusterDownloads("cli")
+	require.NoError(t, err)
+	assert.Empty(t, downloads)
+}
@@ -0,0 +1,15 @@
+-- This table contains a record of every artifact download, which artifact adoption reports are computed from.
+CREATE TABLE artifact_downloads (
+  id bigserial PRIMARY KEY,
+  artifact_name varchar(1024) NOT NULL,
+  version_str varchar(1024) NOT NULL,
+  artifact_type varchar(1024) NOT NULL,
+  -- The org and cluster that downloaded the artifact, if known. Anonymous downloads, such as CLI
+  -- downloads, have neither.
+  org_id UUID,
+  cluster_id UUID,
+  downloaded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX artifact_downloads_name_downloaded_at_idx ON artifact_downloads (artifact_name, downloaded_at);
+CREATE INDEX artifact_downloads_cluster_id_idx ON artifact_downloads (cluster_id, downloaded_at);
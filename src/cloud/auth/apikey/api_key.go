@@ -21,6 +21,7 @@ package apikey
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -35,7 +36,10 @@ import (
 
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/auth/controllers"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
 	"px.dev/pixie/src/shared/services/authcontext"
+	srvutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
 )
 
@@ -63,6 +67,104 @@ func New(db *sqlx.DB, dbKey string) *Service {
 	}
 }
 
+type keyRow struct {
+	ID         uuid.UUID    `db:"id"`
+	OrgID      uuid.UUID    `db:"org_id"`
+	UserID     uuid.UUID    `db:"user_id"`
+	CreatedAt  time.Time    `db:"created_at"`
+	Desc       string       `db:"description"`
+	Scopes     []byte       `db:"scopes"`
+	ClusterIDs []byte       `db:"cluster_ids"`
+	ExpiresAt  sql.NullTime `db:"expires_at"`
+}
+
+// keyColumns are the columns of keyRow, which excludes the value of the key.
+const keyColumns = `id, org_id, user_id, created_at, description, scopes, cluster_ids, expires_at`
+
+func (r *keyRow) restrictions() ([]string, []uuid.UUID, error) {
+	var scopes []string
+	if err := json.Unmarshal(r.Scopes, &scopes); err != nil {
+		return nil, nil, err
+	}
+	var clusterIDs []uuid.UUID
+	if err := json.Unmarshal(r.ClusterIDs, &clusterIDs); err != nil {
+		return nil, nil, err
+	}
+	return scopes, clusterIDs, nil
+}
+
+func (r *keyRow) toProto(key string) (*authpb.APIKey, error) {
+	scopes, clusterIDs, err := r.restrictions()
+	if err != nil {
+		return nil, err
+	}
+	k := &authpb.APIKey{
+		ID:     utils.ProtoFromUUID(r.ID),
+		OrgID:  utils.ProtoFromUUID(r.OrgID),
+		UserID: utils.ProtoFromUUID(r.UserID),
+		Key:    key,
+		Desc:   r.Desc,
+		Scopes: scopes,
+	}
+	for _, id := range clusterIDs {
+		k.ClusterIDs = append(k.ClusterIDs, utils.ProtoFromUUID(id))
+	}
+	k.CreatedAt, _ = types.TimestampProto(r.CreatedAt)
+	if r.ExpiresAt.Valid {
+		k.ExpiresAt, _ = types.TimestampProto(r.ExpiresAt.Time)
+	}
+	return k, nil
+}
+
+func newKey() (string, error) {
+	keyID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + keyID.String(), nil
+}
+
+// validateRestrictions checks the scopes, clusters and expiry of a new key, and returns the JSON encoded
+// scopes and clusters to store.
+func validateRestrictions(req *authpb.CreateAPIKeyRequest) ([]byte, []byte, *time.Time, error) {
+	if err := apikeyscope.Validate(req.Scopes); err != nil {
+		return nil, nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	clusterIDs := make([]uuid.UUID, 0, len(req.ClusterIDs))
+	for _, id := range req.ClusterIDs {
+		clusterID, err := utils.UUIDFromProto(id)
+		if err != nil {
+			return nil, nil, nil, status.Error(codes.InvalidArgument, "invalid cluster id format")
+		}
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	if len(clusterIDs) > 0 && !apikeyscope.AllowsScripts(req.Scopes) {
+		return nil, nil, nil, status.Error(codes.InvalidArgument, "restricting a key to clusters requires a script scope")
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t, err := types.TimestampFromProto(req.ExpiresAt)
+		if err != nil {
+			return nil, nil, nil, status.Error(codes.InvalidArgument, "invalid expiry")
+		}
+		if !t.After(time.Now()) {
+			return nil, nil, nil, status.Error(codes.InvalidArgument, "expiry must be in the future")
+		}
+		expiresAt = &t
+	}
+
+	scopes, err := json.Marshal(req.Scopes)
+	if err != nil {
+		return nil, nil, nil, status.Error(codes.Internal, "failed to encode scopes")
+	}
+	clusters, err := json.Marshal(clusterIDs)
+	if err != nil {
+		return nil, nil, nil, status.Error(codes.Internal, "failed to encode clusters")
+	}
+	return scopes, clusters, expiresAt, nil
+}
+
 // Create a key with the org/user as an owner.
 func (s *Service) Create(ctx context.Context, req *authpb.CreateAPIKeyRequest) (*authpb.APIKey, error) {
 	sCtx, err := authcontext.FromContext(ctx)
@@ -70,36 +172,41 @@ func (s *Service) Create(ctx context.Context, req *authpb.CreateAPIKeyRequest) (
 		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
 
-	var id uuid.UUID
-	var ts time.Time
+	scopes, clusterIDs, expiresAt, err := validateRestrictions(req)
+	if err != nil {
+		return nil, err
+	}
+
 	// We store a version of the key in hashed_key that is salted using a constant salt (dbKey),
 	// to allow us to an associative lookup. This is secure since the API key is a UUID and won't collide.
-	query := `INSERT INTO api_keys(org_id, user_id, hashed_key, encrypted_key, description)
-                VALUES($1, $2, sha256($3), PGP_SYM_ENCRYPT($3::text, $4::text), $5)
-                RETURNING id, created_at`
-	keyID, err := uuid.NewV4()
+	query := `INSERT INTO api_keys(org_id, user_id, hashed_key, encrypted_key, description, scopes, cluster_ids, expires_at)
+                VALUES($1, $2, sha256($3), PGP_SYM_ENCRYPT($3::text, $4::text), $5, $6, $7, $8)
+                RETURNING ` + keyColumns
+	key, err := newKey()
 	if err != nil {
 		return nil, err
 	}
-	key := apiKeyPrefix + keyID.String()
+	var row keyRow
 	err = s.db.QueryRowxContext(ctx, query,
 		sCtx.Claims.GetUserClaims().OrgID,
 		sCtx.Claims.GetUserClaims().UserID,
 		key,
 		s.dbKey,
-		req.Desc).
-		Scan(&id, &ts)
+		req.Desc,
+		scopes,
+		clusterIDs,
+		expiresAt).
+		StructScan(&row)
 	if err != nil {
 		log.WithError(err).Error("Failed to insert API keys")
 		return nil, status.Error(codes.Internal, "Failed to insert API keys")
 	}
 
-	tp, _ := types.TimestampProto(ts)
-	return &authpb.APIKey{
-		ID:        utils.ProtoFromUUID(id),
-		Key:       key,
-		CreatedAt: tp,
-	}, nil
+	resp, err := row.toProto(key)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to read API key")
+	}
+	return resp, nil
 }
 
 // List returns all the keys belonging to an org.
@@ -110,7 +217,7 @@ func (s *Service) List(ctx context.Context, req *authpb.ListAPIKeyRequest) (*aut
 	}
 
 	// Return all keys when the OrgID matches.
-	query := `SELECT id, org_id, user_id, created_at, description
+	query := `SELECT ` + keyColumns + `
                 FROM api_keys
                 WHERE org_id=$1
                 ORDER BY created_at`
@@ -126,23 +233,26 @@ func (s *Service) List(ctx context.Context, req *authpb.ListAPIKeyRequest) (*aut
 
 	var keys []*authpb.APIKeyMetadata
 	for rows.Next() {
-		var id string
-		var orgID uuid.UUID
-		var userID uuid.UUID
-		var createdAt time.Time
-		var desc string
-		err = rows.Scan(&id, &orgID, &userID, &createdAt, &desc)
+		var row keyRow
+		err = rows.StructScan(&row)
+		if err != nil {
+			log.WithError(err).Error("Failed to read data from postgres")
+			return nil, status.Error(codes.Internal, "failed to read data")
+		}
+		k, err := row.toProto("")
 		if err != nil {
 			log.WithError(err).Error("Failed to read data from postgres")
 			return nil, status.Error(codes.Internal, "failed to read data")
 		}
-		tProto, _ := types.TimestampProto(createdAt)
 		keys = append(keys, &authpb.APIKeyMetadata{
-			ID:        utils.ProtoFromUUIDStrOrNil(id),
-			OrgID:     utils.ProtoFromUUID(orgID),
-			UserID:    utils.ProtoFromUUID(userID),
-			CreatedAt: tProto,
-			Desc:      desc,
+			ID:         k.ID,
+			OrgID:      k.OrgID,
+			UserID:     k.UserID,
+			CreatedAt:  k.CreatedAt,
+			Desc:       k.Desc,
+			Scopes:     k.Scopes,
+			ClusterIDs: k.ClusterIDs,
+			ExpiresAt:  k.ExpiresAt,
 		})
 	}
 	return &authpb.ListAPIKeyResponse{
@@ -161,15 +271,16 @@ func (s *Service) Get(ctx context.Context, req *authpb.GetAPIKeyRequest) (*authp
 		return nil, status.Error(codes.InvalidArgument, "invalid id format")
 	}
 
-	var orgID uuid.UUID
-	var userID uuid.UUID
-	var key string
-	var createdAt time.Time
-	var desc string
-	query := `SELECT CONVERT_FROM(PGP_SYM_DECRYPT(encrypted_key, $3::text)::bytea, 'UTF8'), org_id, user_id, created_at, description
+	var row struct {
+		keyRow
+		Key string `db:"key"`
+	}
+	// The value of a key lets anyone act as the user that owns it, so users may only get their own keys.
+	query := `SELECT CONVERT_FROM(PGP_SYM_DECRYPT(encrypted_key, $3::text)::bytea, 'UTF8') AS key, ` + keyColumns + `
                 FROM api_keys
-                WHERE org_id=$1 AND id=$2`
-	err = s.db.QueryRowxContext(ctx, query, sCtx.Claims.GetUserClaims().OrgID, tokenID, s.dbKey).Scan(&key, &orgID, &userID, &createdAt, &desc)
+                WHERE org_id=$1 AND id=$2 AND user_id=$4`
+	err = s.db.QueryRowxContext(ctx, query, sCtx.Claims.GetUserClaims().OrgID, tokenID, s.dbKey,
+		sCtx.Claims.GetUserClaims().UserID).StructScan(&row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, status.Error(codes.NotFound, "No such API key")
@@ -177,15 +288,11 @@ func (s *Service) Get(ctx context.Context, req *authpb.GetAPIKeyRequest) (*authp
 		return nil, status.Error(codes.Internal, "Failed to query database for API key")
 	}
 
-	createdAtProto, _ := types.TimestampProto(createdAt)
-	return &authpb.GetAPIKeyResponse{Key: &authpb.APIKey{
-		ID:        req.ID,
-		OrgID:     utils.ProtoFromUUID(orgID),
-		UserID:    utils.ProtoFromUUID(userID),
-		Key:       key,
-		CreatedAt: createdAtProto,
-		Desc:      desc,
-	}}, nil
+	key, err := row.toProto(row.Key)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to read API key")
+	}
+	return &authpb.GetAPIKeyResponse{Key: key}, nil
 }
 
 // Delete will remove the key.
@@ -221,21 +328,59 @@ func (s *Service) Delete(ctx context.Context, req *uuidpb.UUID) (*types.Empty, e
 	return &types.Empty{}, nil
 }
 
-// FetchOrgUserIDUsingAPIKey gets the org and user ID based on the API key.
-func (s *Service) FetchOrgUserIDUsingAPIKey(ctx context.Context, key string) (uuid.UUID, uuid.UUID, error) {
-	resp, err := s.fetchAPIKeyUsingKeyFromDB(ctx, key)
+// Rotate replaces the value of the key, keeping its description, scopes and expiry.
+func (s *Service) Rotate(ctx context.Context, req *uuidpb.UUID) (*authpb.APIKey, error) {
+	sCtx, err := authcontext.FromContext(ctx)
 	if err != nil {
-		return uuid.Nil, uuid.Nil, err
+		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
-	oid, err := utils.UUIDFromProto(resp.OrgID)
+
+	tokenID, err := utils.UUIDFromProto(req)
 	if err != nil {
-		return uuid.Nil, uuid.Nil, err
+		return nil, status.Error(codes.InvalidArgument, "invalid id format")
 	}
-	uid, err := utils.UUIDFromProto(resp.UserID)
+
+	key, err := newKey()
 	if err != nil {
-		return uuid.Nil, uuid.Nil, err
+		return nil, err
 	}
-	return oid, uid, nil
+	query := `UPDATE api_keys
+                SET hashed_key=sha256($3), encrypted_key=PGP_SYM_ENCRYPT($3::text, $4::text)
+                WHERE org_id=$1 AND id=$2
+                RETURNING ` + keyColumns
+	var row keyRow
+	err = s.db.QueryRowxContext(ctx, query, sCtx.Claims.GetUserClaims().OrgID, tokenID, key, s.dbKey).StructScan(&row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "no such token to rotate")
+		}
+		log.WithError(err).Error("Failed to rotate API token")
+		return nil, status.Error(codes.Internal, "failed to rotate API token")
+	}
+
+	resp, err := row.toProto(key)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to read API token")
+	}
+	return resp, nil
+}
+
+// FetchAPIKeyUsingKey gets the owner and restrictions of the unexpired API key.
+func (s *Service) FetchAPIKeyUsingKey(ctx context.Context, key string) (*controllers.APIKey, error) {
+	row, err := s.fetchAPIKeyUsingKeyFromDB(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	scopes, clusterIDs, err := row.restrictions()
+	if err != nil {
+		return nil, err
+	}
+	return &controllers.APIKey{
+		OrgID:      row.OrgID,
+		UserID:     row.UserID,
+		Scopes:     scopes,
+		ClusterIDs: clusterIDs,
+	}, nil
 }
 
 // LookupAPIKey gets the complete API key information using just the Key.
@@ -245,47 +390,75 @@ func (s *Service) LookupAPIKey(ctx context.Context, req *authpb.LookupAPIKeyRequ
 		return nil, err
 	}
 	orgID := aCtx.Claims.GetUserClaims().OrgID
-	resp, err := s.fetchAPIKeyUsingKeyFromDB(ctx, req.Key)
+	row, err := s.fetchAPIKeyUsingKeyFromDB(ctx, req.Key)
 	if err != nil {
 		if err == ErrAPIKeyNotFound {
 			return nil, status.Error(codes.NotFound, err.Error())
 		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-	if utils.UUIDFromProtoOrNil(resp.OrgID).String() != orgID {
+	if row.OrgID.String() != orgID {
 		return nil, status.Error(codes.PermissionDenied, "permission denied deleting API key")
 	}
+	resp, err := row.toProto(withPrefix(req.Key))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
 	return &authpb.LookupAPIKeyResponse{Key: resp}, nil
 }
 
-func (s *Service) fetchAPIKeyUsingKeyFromDB(ctx context.Context, key string) (*authpb.APIKey, error) {
-	// For backwards compatibility add in apiKeyPrefix the front of the keys.
+// TransferOwnership moves the keys of a user to another user of the org. Only services may move keys.
+func (s *Service) TransferOwnership(ctx context.Context, req *authpb.TransferAPIKeysRequest) (*authpb.TransferAPIKeysResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if srvutils.GetClaimsType(sCtx.Claims) != srvutils.ServiceClaimType {
+		return nil, status.Error(codes.PermissionDenied, "only services may transfer API keys")
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	fromUserID := utils.UUIDFromProtoOrNil(req.FromUserID)
+	toUserID := utils.UUIDFromProtoOrNil(req.ToUserID)
+	if orgID == uuid.Nil || fromUserID == uuid.Nil || toUserID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "org, from and to users are required")
+	}
+
+	query := `UPDATE api_keys SET user_id=$3 WHERE org_id=$1 AND user_id=$2`
+	res, err := s.db.ExecContext(ctx, query, orgID, fromUserID, toUserID)
+	if err != nil {
+		log.WithError(err).Error("Failed to transfer API keys")
+		return nil, status.Error(codes.Internal, "failed to transfer API keys")
+	}
+	c, err := res.RowsAffected()
+	if err != nil {
+		log.WithError(err).Error("Failed to transfer API keys")
+		return nil, status.Error(codes.Internal, "failed to transfer API keys")
+	}
+	return &authpb.TransferAPIKeysResponse{NumKeys: c}, nil
+}
+
+// withPrefix adds apiKeyPrefix to the front of keys that were created before keys had a prefix.
+func withPrefix(key string) string {
 	if !strings.HasPrefix(key, apiKeyPrefix) {
-		key = apiKeyPrefix + key
-	}
-	var id uuid.UUID
-	var orgID uuid.UUID
-	var userID uuid.UUID
-	var createdAt time.Time
-	var desc string
-	query := `SELECT id, org_id, user_id, created_at, description
+		return apiKeyPrefix + key
+	}
+	return key
+}
+
+func (s *Service) fetchAPIKeyUsingKeyFromDB(ctx context.Context, key string) (*keyRow, error) {
+	key = withPrefix(key)
+	var row keyRow
+	query := `SELECT ` + keyColumns + `
                 FROM api_keys
-                WHERE hashed_key=sha256($1) and PGP_SYM_DECRYPT(encrypted_key::bytea, $2::text)::bytea=$1`
-	err := s.db.QueryRowxContext(ctx, query, key, s.dbKey).Scan(&id, &orgID, &userID, &createdAt, &desc)
+                WHERE hashed_key=sha256($1) and PGP_SYM_DECRYPT(encrypted_key::bytea, $2::text)::bytea=$1
+                  AND (expires_at IS NULL OR expires_at > NOW())`
+	err := s.db.QueryRowxContext(ctx, query, key, s.dbKey).StructScan(&row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrAPIKeyNotFound
 		}
 		return nil, fmt.Errorf("failed to query database for API key")
 	}
-
-	createdAtProto, _ := types.TimestampProto(createdAt)
-	return &authpb.APIKey{
-		ID:        utils.ProtoFromUUID(id),
-		OrgID:     utils.ProtoFromUUID(orgID),
-		UserID:    utils.ProtoFromUUID(userID),
-		Key:       key,
-		CreatedAt: createdAtProto,
-		Desc:      desc,
-	}, nil
+	return &row, nil
 }
@@ -35,8 +35,10 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/auth/authpb"
 	"px.dev/pixie/src/cloud/auth/schema"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/pgtest"
 	jwtutils "px.dev/pixie/src/shared/services/utils"
@@ -287,6 +289,19 @@ func TestAPIKeyService_Get_UnownedID(t *testing.T) {
 	}
 }
 
+func TestAPIKeyService_Get_OtherUsersKey(t *testing.T) {
+	mustLoadTestData(db)
+	svc := New(db, testDBKey)
+
+	sCtx := authcontext.New()
+	sCtx.Claims = jwtutils.GenerateJWTForUser(uuid.Must(uuid.NewV4()).String(), testAuthOrgID.String(), "other@test.com", time.Now(), "pixie")
+	resp, err := svc.Get(authcontext.NewContext(context.Background(), sCtx), &authpb.GetAPIKeyRequest{
+		ID: utils.ProtoFromUUID(testKey1ID),
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
 func TestAPIKeyService_Get_NonExistentID(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -427,7 +442,7 @@ func TestAPIKeyService_Delete_NonExistentKey(t *testing.T) {
 	}
 }
 
-func TestService_FetchOrgUserIDUsingAPIKey(t *testing.T) {
+func TestService_FetchAPIKeyUsingKey(t *testing.T) {
 	mustLoadTestData(db)
 
 	tests := []struct {
@@ -449,15 +464,17 @@ func TestService_FetchOrgUserIDUsingAPIKey(t *testing.T) {
 			ctx := test.ctx
 			svc := New(db, testDBKey)
 
-			orgID, userID, err := svc.FetchOrgUserIDUsingAPIKey(ctx, "px-api-key1")
+			key, err := svc.FetchAPIKeyUsingKey(ctx, "px-api-key1")
 			require.NoError(t, err)
-			assert.Equal(t, testAuthOrgID, orgID)
-			assert.Equal(t, testAuthUserID, userID)
+			assert.Equal(t, testAuthOrgID, key.OrgID)
+			assert.Equal(t, testAuthUserID, key.UserID)
+			assert.Empty(t, key.Scopes)
+			assert.Empty(t, key.ClusterIDs)
 		})
 	}
 }
 
-func TestService_FetchOrgUserIDUsingAPIKey_BadKey(t *testing.T) {
+func TestService_FetchAPIKeyUsingKey_BadKey(t *testing.T) {
 	mustLoadTestData(db)
 	tests := []struct {
 		name string
@@ -478,15 +495,105 @@ func TestService_FetchOrgUserIDUsingAPIKey_BadKey(t *testing.T) {
 			ctx := test.ctx
 			svc := New(db, testDBKey)
 
-			orgID, userID, err := svc.FetchOrgUserIDUsingAPIKey(ctx, "some rando key that does not exist")
+			key, err := svc.FetchAPIKeyUsingKey(ctx, "some rando key that does not exist")
 			assert.NotNil(t, err)
 			assert.Equal(t, ErrAPIKeyNotFound, err)
-			assert.Equal(t, uuid.Nil, orgID)
-			assert.Equal(t, uuid.Nil, userID)
+			assert.Nil(t, key)
+		})
+	}
+}
+
+func TestService_FetchAPIKeyUsingKey_Expired(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE api_keys SET expires_at=NOW() - INTERVAL '1 hour' WHERE id=$1`, testKey1ID)
+
+	svc := New(db, testDBKey)
+	_, err := svc.FetchAPIKeyUsingKey(createTestContext(), "px-api-key1")
+	assert.Equal(t, ErrAPIKeyNotFound, err)
+}
+
+func TestAPIKeyService_CreateAPIKey_Scoped(t *testing.T) {
+	mustLoadTestData(db)
+
+	clusterID := uuid.Must(uuid.NewV4())
+	expiresAt := time.Now().Add(time.Hour)
+	svc := New(db, testDBKey)
+	expiresAtPb, _ := types.TimestampProto(expiresAt)
+	resp, err := svc.Create(createTestContext(), &authpb.CreateAPIKeyRequest{
+		Desc:       "read only",
+		Scopes:     []string{apikeyscope.ScriptRead},
+		ClusterIDs: []*uuidpb.UUID{utils.ProtoFromUUID(clusterID)},
+		ExpiresAt:  expiresAtPb,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{apikeyscope.ScriptRead}, resp.Scopes)
+	assert.Equal(t, []*uuidpb.UUID{utils.ProtoFromUUID(clusterID)}, resp.ClusterIDs)
+	assert.NotNil(t, resp.ExpiresAt)
+
+	key, err := svc.FetchAPIKeyUsingKey(createTestContext(), resp.Key)
+	require.NoError(t, err)
+	assert.Equal(t, []string{apikeyscope.ScriptRead}, key.Scopes)
+	assert.Equal(t, []uuid.UUID{clusterID}, key.ClusterIDs)
+}
+
+func TestAPIKeyService_CreateAPIKey_InvalidRestrictions(t *testing.T) {
+	mustLoadTestData(db)
+
+	tests := []struct {
+		name string
+		req  *authpb.CreateAPIKeyRequest
+	}{
+		{
+			name: "unknown scope",
+			req:  &authpb.CreateAPIKeyRequest{Scopes: []string{"admin"}},
+		},
+		{
+			name: "clusters without script scope",
+			req: &authpb.CreateAPIKeyRequest{
+				Scopes:     []string{apikeyscope.Deploy},
+				ClusterIDs: []*uuidpb.UUID{utils.ProtoFromUUID(uuid.Must(uuid.NewV4()))},
+			},
+		},
+		{
+			name: "expiry in the past",
+			req: &authpb.CreateAPIKeyRequest{
+				ExpiresAt: &types.Timestamp{Seconds: time.Now().Add(-time.Hour).Unix()},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := New(db, testDBKey)
+			resp, err := svc.Create(createTestContext(), test.req)
+			assert.Nil(t, resp)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
 		})
 	}
 }
 
+func TestAPIKeyService_Rotate(t *testing.T) {
+	mustLoadTestData(db)
+
+	svc := New(db, testDBKey)
+	resp, err := svc.Rotate(createTestContext(), utils.ProtoFromUUID(testKey1ID))
+	require.NoError(t, err)
+	assert.Equal(t, testKey1ID, utils.UUIDFromProtoOrNil(resp.ID))
+	assert.Equal(t, "here is a desc", resp.Desc)
+	assert.True(t, strings.HasPrefix(resp.Key, "px-api-"))
+	assert.NotEqual(t, "px-api-key1", resp.Key)
+
+	_, err = svc.FetchAPIKeyUsingKey(createTestContext(), "px-api-key1")
+	assert.Equal(t, ErrAPIKeyNotFound, err)
+	key, err := svc.FetchAPIKeyUsingKey(createTestContext(), resp.Key)
+	require.NoError(t, err)
+	assert.Equal(t, testAuthOrgID, key.OrgID)
+
+	// Keys of other orgs can't be rotated.
+	_, err = svc.Rotate(createTestContext(), utils.ProtoFromUUID(testKey3ID))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
 func TestService_LookupAPIKey(t *testing.T) {
 	mustLoadTestData(db)
 	tests := []struct {
@@ -543,3 +650,45 @@ func TestService_LookupAPIKey_NonAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIKeyService_TransferOwnership(t *testing.T) {
+	mustLoadTestData(db)
+
+	sCtx := authcontext.New()
+	sCtx.Claims = jwtutils.GenerateJWTForService("ProfileService", "pixie")
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+
+	svc := New(db, testDBKey)
+	newOwnerID := uuid.Must(uuid.NewV4())
+	resp, err := svc.TransferOwnership(ctx, &authpb.TransferAPIKeysRequest{
+		OrgID:      utils.ProtoFromUUID(testAuthOrgID),
+		FromUserID: utils.ProtoFromUUID(testAuthUserID),
+		ToUserID:   utils.ProtoFromUUID(newOwnerID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), resp.NumKeys)
+
+	var owners []uuid.UUID
+	err = db.Select(&owners, `SELECT user_id FROM api_keys WHERE org_id=$1`, testAuthOrgID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{newOwnerID, newOwnerID}, owners)
+
+	// Keys in other orgs are untouched.
+	var otherOwner uuid.UUID
+	err = db.Get(&otherOwner, `SELECT user_id FROM api_keys WHERE id=$1`, testKey3ID)
+	require.NoError(t, err)
+	assert.Equal(t, testNonAuthUserID, otherOwner)
+}
+
+func TestAPIKeyService_TransferOwnership_NotService(t *testing.T) {
+	mustLoadTestData(db)
+
+	svc := New(db, testDBKey)
+	resp, err := svc.TransferOwnership(createTestContext(), &authpb.TransferAPIKeysRequest{
+		OrgID:      utils.ProtoFromUUID(testAuthOrgID),
+		FromUserID: utils.ProtoFromUUID(testAuthUserID),
+		ToUserID:   utils.ProtoFromUUID(testNonAuthUserID),
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
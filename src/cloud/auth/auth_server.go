@@ -21,6 +21,8 @@ package main
 import (
 	"net/http"
 	_ "net/http/pprof"
+	"strings"
+	"time"
 
 	bindata "github.com/golang-migrate/migrate/source/go_bindata"
 	"github.com/jmoiron/sqlx"
@@ -32,7 +34,11 @@ import (
 	"px.dev/pixie/src/cloud/auth/authenv"
 	"px.dev/pixie/src/cloud/auth/authpb"
 	"px.dev/pixie/src/cloud/auth/controllers"
+	"px.dev/pixie/src/cloud/auth/jitapproval"
+	"px.dev/pixie/src/cloud/auth/pat"
+	"px.dev/pixie/src/cloud/auth/samlconfig"
 	"px.dev/pixie/src/cloud/auth/schema"
+	"px.dev/pixie/src/cloud/shared/audit"
 	"px.dev/pixie/src/cloud/shared/pgmigrate"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/healthz"
@@ -44,6 +50,39 @@ func init() {
 	pflag.String("database_key", "", "The encryption key to use for the database")
 	pflag.String("oauth_provider", "auth0", "The auth provider to use. Supported values are 'oidc', 'auth0' or 'hydra'")
 	pflag.String("domain_name", "dev.withpixie.dev", "The domain name of Pixie Cloud")
+	pflag.String("jit_org_policy", "allow", "What happens when a user without an account, invite or matching org logs in. Supported values are 'allow', 'reject', 'personal_org' or 'approval'")
+	pflag.String("jit_admin_emails", "", "Comma-separated emails of the Pixie Cloud admins that may review JIT approval requests")
+	pflag.String("jit_notification_webhook_url", "", "If set, JIT approval requests and reviews are posted to this webhook")
+	pflag.String("saml_base_url", "", "The URL that the SAML service provider endpoints are served under. Defaults to https://work.<domain_name>")
+	pflag.Duration("pat_max_lifetime", 365*24*time.Hour, "The maximum lifetime of personal access tokens")
+}
+
+func jitServerOption(db *sqlx.DB) controllers.ServerOption {
+	policy, err := controllers.ParseJITOrgPolicy(viper.GetString("jit_org_policy"))
+	if err != nil {
+		log.WithError(err).Fatal("Invalid JIT org policy")
+	}
+
+	var admins []string
+	for _, email := range strings.Split(viper.GetString("jit_admin_emails"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			admins = append(admins, email)
+		}
+	}
+
+	var notifier controllers.JITNotifier
+	if url := viper.GetString("jit_notification_webhook_url"); url != "" {
+		notifier = controllers.NewWebhookJITNotifier(url)
+	}
+	return controllers.WithJITOrgPolicy(policy, jitapproval.New(db), notifier, admins)
+}
+
+func samlServerOption(db *sqlx.DB) controllers.ServerOption {
+	baseURL := viper.GetString("saml_base_url")
+	if baseURL == "" {
+		baseURL = "https://work." + viper.GetString("domain_name")
+	}
+	return controllers.WithSAML(samlconfig.New(db), baseURL)
 }
 
 func connectToPostgres() (*sqlx.DB, string) {
@@ -64,6 +103,7 @@ func connectToPostgres() (*sqlx.DB, string) {
 
 func main() {
 	services.SetupService("auth-service", 50100)
+	audit.SetupFlags()
 	services.PostFlagSetupAndParse()
 	services.CheckServiceFlags()
 	services.SetupServiceLogging()
@@ -71,6 +111,11 @@ func main() {
 	flush := services.InitDefaultSentry()
 	defer flush()
 
+	if err := audit.Init(); err != nil {
+		log.WithError(err).Fatal("Failed to set up the audit log")
+	}
+	defer audit.Close()
+
 	mux := http.NewServeMux()
 	// This handles all the pprof endpoints.
 	mux.Handle("/debug/", http.DefaultServeMux)
@@ -108,8 +153,10 @@ func main() {
 
 	db, dbKey := connectToPostgres()
 	apiKeyMgr := apikey.New(db, dbKey)
+	patMgr := pat.New(db, viper.GetDuration("pat_max_lifetime"))
 
-	svr, err := controllers.NewServer(env, a, apiKeyMgr)
+	svr, err := controllers.NewServer(env, a, apiKeyMgr, jitServerOption(db), samlServerOption(db),
+		controllers.WithPersonalAccessTokens(patMgr))
 	if err != nil {
 		log.WithError(err).Fatal("Failed to initialize GRPC server funcs")
 	}
@@ -117,6 +164,7 @@ func main() {
 	s := server.NewPLServer(env, mux)
 	authpb.RegisterAuthServiceServer(s.GRPCServer(), svr)
 	authpb.RegisterAPIKeyServiceServer(s.GRPCServer(), apiKeyMgr)
+	authpb.RegisterPersonalAccessTokenServiceServer(s.GRPCServer(), patMgr)
 
 	s.Start()
 	s.StopOnInterrupt()
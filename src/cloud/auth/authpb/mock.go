@@ -18,4 +18,4 @@
 
 package authpb
 
-//go:generate mockgen -source=auth.pb.go -destination=mock/auth_mock.gen.go AuthServiceClient,APIKeyServiceClient
+//go:generate mockgen -source=auth.pb.go -destination=mock/auth_mock.gen.go AuthServiceClient,APIKeyServiceClient,PersonalAccessTokenServiceClient
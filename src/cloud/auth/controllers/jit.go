@@ -0,0 +1,345 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+// JITOrgPolicy decides what happens when a user authenticates for the first time without an invite or an
+// org that matches their identity. JIT stands for just-in-time, as the user's org is decided on their first login.
+type JITOrgPolicy string
+
+const (
+	// JITOrgPolicyAllow lets the user in without an org, or creates the org of their hosted domain on signup.
+	JITOrgPolicyAllow JITOrgPolicy = "allow"
+	// JITOrgPolicyReject rejects the user. They can only join through an invite.
+	JITOrgPolicyReject JITOrgPolicy = "reject"
+	// JITOrgPolicyPersonalOrg creates an org for the user. Users of a hosted domain get the org of that domain.
+	JITOrgPolicyPersonalOrg JITOrgPolicy = "personal_org"
+	// JITOrgPolicyApproval queues the user for review by an admin. Once approved, the user joins the org
+	// chosen by the admin, or gets an org created like with JITOrgPolicyPersonalOrg.
+	JITOrgPolicyApproval JITOrgPolicy = "approval"
+)
+
+// ParseJITOrgPolicy parses the name of a JIT org policy.
+func ParseJITOrgPolicy(policy string) (JITOrgPolicy, error) {
+	switch p := JITOrgPolicy(policy); p {
+	case JITOrgPolicyAllow, JITOrgPolicyReject, JITOrgPolicyPersonalOrg, JITOrgPolicyApproval:
+		return p, nil
+	case "":
+		return JITOrgPolicyAllow, nil
+	default:
+		return "", fmt.Errorf("unknown JIT org policy '%s'", policy)
+	}
+}
+
+// jitOrgForUser applies the JIT org policy to a user that authenticated without an account, an invite or a
+// matching org. It returns the org that the user should be created in, and whether that org was just created.
+func (s *Server) jitOrgForUser(ctx context.Context, userInfo *UserInfo) (*profilepb.OrgInfo, bool, error) {
+	switch s.jitPolicy {
+	case JITOrgPolicyReject:
+		return nil, false, status.Error(codes.PermissionDenied, "Signups are restricted to invited users. Please ask your org admin for an invite.")
+	case JITOrgPolicyPersonalOrg:
+		return s.createJITOrg(ctx, userInfo)
+	case JITOrgPolicyApproval:
+		return s.jitOrgForApproval(ctx, userInfo)
+	default:
+		return nil, false, status.Errorf(codes.Internal, "unsupported JIT org policy '%s'", s.jitPolicy)
+	}
+}
+
+// createJITOrg creates the org of the user's hosted domain, or a personal org named after their email.
+func (s *Server) createJITOrg(ctx context.Context, userInfo *UserInfo) (*profilepb.OrgInfo, bool, error) {
+	req := &profilepb.CreateOrgRequest{OrgName: userInfo.Email}
+	if userInfo.HostedDomain != "" {
+		req.OrgName = userInfo.HostedDomain
+		req.DomainName = &types.StringValue{Value: userInfo.HostedDomain}
+	}
+
+	orgID, err := s.env.OrgClient().CreateOrg(ctx, req)
+	if status.Code(err) == codes.AlreadyExists {
+		// The org outlived its users, so the user takes it over instead.
+		orgInfo, err := s.env.OrgClient().GetOrgByName(ctx, &profilepb.GetOrgByNameRequest{Name: req.OrgName})
+		return orgInfo, false, err
+	}
+	if err != nil {
+		return nil, false, status.Errorf(codes.Internal, "failed to create org: %v", err)
+	}
+	orgInfo, err := s.env.OrgClient().GetOrg(ctx, orgID)
+	if err != nil {
+		return nil, false, err
+	}
+	return orgInfo, true, nil
+}
+
+func (s *Server) jitOrgForApproval(ctx context.Context, userInfo *UserInfo) (*profilepb.OrgInfo, bool, error) {
+	req, err := s.jitStore.GetJITApprovalRequest(ctx, userInfo.AuthProviderID)
+	if err != nil {
+		log.WithError(err).Error("Failed to get JIT approval request")
+		return nil, false, status.Error(codes.Internal, "failed to get approval request")
+	}
+
+	if req == nil {
+		req, err = s.jitStore.CreateJITApprovalRequest(ctx, &JITApprovalRequest{
+			AuthProviderID:   userInfo.AuthProviderID,
+			Email:            userInfo.Email,
+			FirstName:        userInfo.FirstName,
+			LastName:         userInfo.LastName,
+			IdentityProvider: userInfo.IdentityProvider,
+			HostedDomain:     userInfo.HostedDomain,
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed to create JIT approval request")
+			return nil, false, status.Error(codes.Internal, "failed to create approval request")
+		}
+		if s.jitNotifier != nil {
+			if err := s.jitNotifier.NotifyJITApprovalRequested(ctx, req); err != nil {
+				log.WithError(err).WithField("email", req.Email).Error("Failed to notify admins of JIT approval request")
+			}
+		}
+	}
+
+	switch req.Status {
+	case JITApprovalApproved:
+		if req.OrgID == uuid.Nil {
+			return s.createJITOrg(ctx, userInfo)
+		}
+		orgInfo, err := s.env.OrgClient().GetOrg(ctx, utils.ProtoFromUUID(req.OrgID))
+		if err != nil {
+			return nil, false, err
+		}
+		return orgInfo, false, nil
+	case JITApprovalDenied:
+		return nil, false, status.Error(codes.PermissionDenied, "Your request to join Pixie was denied. Please contact your Pixie admin.")
+	default:
+		return nil, false, status.Error(codes.PermissionDenied, "Your request to join Pixie is pending approval from an admin. Please try again once it's approved.")
+	}
+}
+
+// loginJIT logs in a user that has no account and wasn't invited to an org.
+func (s *Server) loginJIT(ctx context.Context, userInfo *UserInfo) (*authpb.LoginReply, error) {
+	if userInfo.HostedDomain != "" {
+		orgInfo, err := s.getMatchingOrgForUser(ctx, userInfo)
+		if err == nil {
+			return s.loginUser(ctx, userInfo, orgInfo, true)
+		}
+		if status.Code(err) != codes.NotFound {
+			return nil, err
+		}
+	}
+
+	orgInfo, _, err := s.jitOrgForUser(ctx, userInfo)
+	if err != nil {
+		return nil, err
+	}
+	return s.loginUser(ctx, userInfo, orgInfo, true)
+}
+
+// signupJIT signs up a user that wasn't invited to an org.
+func (s *Server) signupJIT(ctx context.Context, userInfo *UserInfo) (*authpb.SignupReply, error) {
+	if userInfo.HostedDomain != "" {
+		orgInfo, err := s.getMatchingOrgForUser(ctx, userInfo)
+		if err == nil {
+			updatedUserInfo, err := s.createUser(ctx, userInfo, orgInfo.ID)
+			if err != nil {
+				return nil, err
+			}
+			return s.signupUser(ctx, updatedUserInfo, orgInfo, false /* newOrg */)
+		}
+		if status.Code(err) != codes.NotFound {
+			return nil, err
+		}
+	}
+
+	orgInfo, newOrg, err := s.jitOrgForUser(ctx, userInfo)
+	if err != nil {
+		return nil, err
+	}
+	updatedUserInfo, err := s.createUser(ctx, userInfo, orgInfo.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.signupUser(ctx, updatedUserInfo, orgInfo, newOrg)
+}
+
+// checkJITAdmin makes sure that the JIT approvals are enabled and the caller is allowed to review them. It
+// returns the email of the admin.
+func (s *Server) checkJITAdmin(ctx context.Context) (string, error) {
+	if s.jitStore == nil {
+		return "", status.Error(codes.FailedPrecondition, "JIT approvals are not enabled")
+	}
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	claims := sCtx.Claims.GetUserClaims()
+	if claims == nil || !s.jitAdmins[claims.Email] {
+		return "", status.Error(codes.PermissionDenied, "only Pixie Cloud admins can review JIT approval requests")
+	}
+	return claims.Email, nil
+}
+
+func jitApprovalRequestToProto(req *JITApprovalRequest) *authpb.JITApprovalRequest {
+	pb := &authpb.JITApprovalRequest{
+		ID:               utils.ProtoFromUUID(req.ID),
+		Email:            req.Email,
+		FirstName:        req.FirstName,
+		LastName:         req.LastName,
+		IdentityProvider: req.IdentityProvider,
+		HostedDomain:     req.HostedDomain,
+		ReviewedBy:       req.ReviewedBy,
+	}
+	switch req.Status {
+	case JITApprovalApproved:
+		pb.Status = authpb.JIT_APPROVAL_STATUS_APPROVED
+	case JITApprovalDenied:
+		pb.Status = authpb.JIT_APPROVAL_STATUS_DENIED
+	default:
+		pb.Status = authpb.JIT_APPROVAL_STATUS_PENDING
+	}
+	if req.OrgID != uuid.Nil {
+		pb.OrgID = utils.ProtoFromUUID(req.OrgID)
+	}
+	pb.CreatedAt, _ = types.TimestampProto(req.CreatedAt)
+	if !req.ReviewedAt.IsZero() {
+		pb.ReviewedAt, _ = types.TimestampProto(req.ReviewedAt)
+	}
+	return pb
+}
+
+// ListJITApprovalRequests lists the requests of users that are waiting for approval to join Pixie Cloud.
+func (s *Server) ListJITApprovalRequests(ctx context.Context, req *authpb.ListJITApprovalRequestsRequest) (*authpb.ListJITApprovalRequestsResponse, error) {
+	if _, err := s.checkJITAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	reqs, err := s.jitStore.ListJITApprovalRequests(ctx, req.PendingOnly)
+	if err != nil {
+		log.WithError(err).Error("Failed to list JIT approval requests")
+		return nil, status.Error(codes.Internal, "failed to list approval requests")
+	}
+	resp := &authpb.ListJITApprovalRequestsResponse{
+		Requests: make([]*authpb.JITApprovalRequest, len(reqs)),
+	}
+	for i, r := range reqs {
+		resp.Requests[i] = jitApprovalRequestToProto(r)
+	}
+	return resp, nil
+}
+
+// ReviewJITApprovalRequest approves or denies the request of a user to join Pixie Cloud.
+func (s *Server) ReviewJITApprovalRequest(ctx context.Context, req *authpb.ReviewJITApprovalRequestRequest) (*authpb.JITApprovalRequest, error) {
+	admin, err := s.checkJITAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := utils.UUIDFromProto(req.ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid id format")
+	}
+
+	var orgID uuid.UUID
+	if req.Approve && !utils.IsNilUUIDProto(req.OrgID) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		orgInfo, err := s.env.OrgClient().GetOrg(metadata.NewOutgoingContext(ctx, md), req.OrgID)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid org: %v", err)
+		}
+		orgID = utils.UUIDFromProtoOrNil(orgInfo.ID)
+	}
+
+	reviewed, err := s.jitStore.ReviewJITApprovalRequest(ctx, id, req.Approve, orgID, admin)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("email", reviewed.Email).WithField("approved", req.Approve).WithField("admin", admin).Info("Reviewed JIT approval request")
+	if s.jitNotifier != nil {
+		if err := s.jitNotifier.NotifyJITApprovalReviewed(ctx, reviewed); err != nil {
+			log.WithError(err).WithField("email", reviewed.Email).Error("Failed to send JIT approval review notification")
+		}
+	}
+	return jitApprovalRequestToProto(reviewed), nil
+}
+
+// WebhookJITNotifier posts JIT approval notifications to a webhook, using the message format of Slack's
+// incoming webhooks.
+type WebhookJITNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookJITNotifier creates a WebhookJITNotifier that posts to the given URL.
+func NewWebhookJITNotifier(url string) *WebhookJITNotifier {
+	return &WebhookJITNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *WebhookJITNotifier) post(ctx context.Context, text string) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{Text: text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NotifyJITApprovalRequested notifies the admins of a new request.
+func (w *WebhookJITNotifier) NotifyJITApprovalRequested(ctx context.Context, req *JITApprovalRequest) error {
+	return w.post(ctx, fmt.Sprintf("%s (%s %s) is waiting for approval to join Pixie Cloud. Request ID: %s",
+		req.Email, req.FirstName, req.LastName, req.ID))
+}
+
+// NotifyJITApprovalReviewed records the decision of an admin on a request.
+func (w *WebhookJITNotifier) NotifyJITApprovalReviewed(ctx context.Context, req *JITApprovalRequest) error {
+	return w.post(ctx, fmt.Sprintf("%s %s the request of %s to join Pixie Cloud.", req.ReviewedBy, req.Status, req.Email))
+}
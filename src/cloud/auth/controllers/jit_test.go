@@ -0,0 +1,360 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authenv"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/auth/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/auth/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	mock_profile "px.dev/pixie/src/cloud/profile/profilepb/mock"
+	"px.dev/pixie/src/shared/services/authcontext"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	jitUserID  = "7ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	jitOrgID   = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	jitAdmin   = "admin@pixie.dev"
+	jitAuthPID = "github|abc123"
+)
+
+type jitTestMocks struct {
+	a        *mock_controllers.MockAuthProvider
+	profile  *mock_profile.MockProfileServiceClient
+	org      *mock_profile.MockOrgServiceClient
+	store    *mock_controllers.MockJITApprovalStore
+	notifier *mock_controllers.MockJITNotifier
+}
+
+func setupJITServer(t *testing.T, ctrl *gomock.Controller, policy controllers.JITOrgPolicy) (*controllers.Server, *jitTestMocks) {
+	m := &jitTestMocks{
+		a:        mock_controllers.NewMockAuthProvider(ctrl),
+		profile:  mock_profile.NewMockProfileServiceClient(ctrl),
+		org:      mock_profile.NewMockOrgServiceClient(ctrl),
+		store:    mock_controllers.NewMockJITApprovalStore(ctrl),
+		notifier: mock_controllers.NewMockJITNotifier(ctrl),
+	}
+
+	viper.Set("jwt_signing_key", "jwtkey")
+	viper.Set("domain_name", "withpixie.ai")
+
+	env, err := authenv.New(m.profile, m.org)
+	require.NoError(t, err)
+	s, err := controllers.NewServer(env, m.a, nil,
+		controllers.WithJITOrgPolicy(policy, m.store, m.notifier, []string{jitAdmin}))
+	require.NoError(t, err)
+	return s, m
+}
+
+func (m *jitTestMocks) expectNewUser(hostedDomain string) {
+	m.a.EXPECT().GetUserInfoFromAccessToken("tokenabc").Return(&controllers.UserInfo{
+		Email:          "abc@gmail.com",
+		EmailVerified:  true,
+		FirstName:      "first",
+		LastName:       "last",
+		AuthProviderID: jitAuthPID,
+		Picture:        "something",
+		HostedDomain:   hostedDomain,
+	}, nil)
+	m.profile.EXPECT().
+		GetUserByAuthProviderID(gomock.Any(), &profilepb.GetUserByAuthProviderIDRequest{AuthProviderID: jitAuthPID}).
+		Return(nil, status.Error(codes.NotFound, "user not found"))
+}
+
+func (m *jitTestMocks) expectUserCreated(orgID string) {
+	userPb := utils.ProtoFromUUIDStrOrNil(jitUserID)
+	m.profile.EXPECT().CreateUser(gomock.Any(), &profilepb.CreateUserRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil(orgID),
+		FirstName:      "first",
+		LastName:       "last",
+		Email:          "abc@gmail.com",
+		AuthProviderID: jitAuthPID,
+	}).Return(userPb, nil)
+	m.profile.EXPECT().
+		GetUserByAuthProviderID(gomock.Any(), &profilepb.GetUserByAuthProviderIDRequest{AuthProviderID: jitAuthPID}).
+		Return(&profilepb.UserInfo{ID: userPb, OrgID: utils.ProtoFromUUIDStrOrNil(orgID), IsApproved: true}, nil)
+	m.profile.EXPECT().
+		UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+			ID:             userPb,
+			DisplayPicture: &types.StringValue{Value: "something"},
+		}).
+		Return(nil, nil)
+}
+
+func TestParseJITOrgPolicy(t *testing.T) {
+	p, err := controllers.ParseJITOrgPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, controllers.JITOrgPolicyAllow, p)
+
+	p, err = controllers.ParseJITOrgPolicy("personal_org")
+	require.NoError(t, err)
+	assert.Equal(t, controllers.JITOrgPolicyPersonalOrg, p)
+
+	_, err = controllers.ParseJITOrgPolicy("anything")
+	assert.Error(t, err)
+}
+
+func TestNewServer_ApprovalPolicyRequiresStore(t *testing.T) {
+	_, err := controllers.NewServer(nil, nil, nil, controllers.WithJITOrgPolicy(controllers.JITOrgPolicyApproval, nil, nil, nil))
+	assert.Error(t, err)
+}
+
+func TestServer_Login_JITReject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyReject)
+	m.expectNewUser("")
+
+	_, err := doLoginRequest(getTestContext(), t, s)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_Login_JITRejectJoinsMatchingHostedDomainOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyReject)
+	m.expectNewUser("pixie.dev")
+
+	orgPb := utils.ProtoFromUUIDStrOrNil(jitOrgID)
+	m.org.EXPECT().
+		GetOrgByDomain(gomock.Any(), &profilepb.GetOrgByDomainRequest{DomainName: "pixie.dev"}).
+		Return(&profilepb.OrgInfo{ID: orgPb, OrgName: "pixie.dev"}, nil)
+	m.org.EXPECT().
+		UpdateOrg(gomock.Any(), &profilepb.UpdateOrgRequest{ID: orgPb, DomainName: &types.StringValue{Value: "pixie.dev"}}).
+		Return(nil, nil)
+	m.expectUserCreated(jitOrgID)
+
+	resp, err := doLoginRequest(getTestContext(), t, s)
+	require.NoError(t, err)
+	assert.True(t, resp.UserCreated)
+	assert.Equal(t, jitOrgID, resp.OrgInfo.OrgID)
+}
+
+func TestServer_Signup_JITPersonalOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyPersonalOrg)
+	m.expectNewUser("")
+
+	orgPb := utils.ProtoFromUUIDStrOrNil(jitOrgID)
+	m.org.EXPECT().
+		CreateOrg(gomock.Any(), &profilepb.CreateOrgRequest{OrgName: "abc@gmail.com"}).
+		Return(orgPb, nil)
+	m.org.EXPECT().GetOrg(gomock.Any(), orgPb).Return(&profilepb.OrgInfo{ID: orgPb, OrgName: "abc@gmail.com"}, nil)
+	m.expectUserCreated(jitOrgID)
+
+	resp, err := doSignupRequest(getTestContext(), t, s)
+	require.NoError(t, err)
+	assert.True(t, resp.OrgCreated)
+	assert.Equal(t, orgPb, resp.OrgID)
+	assert.Equal(t, "abc@gmail.com", resp.OrgName)
+}
+
+func TestServer_Login_JITApprovalQueuesRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyApproval)
+	m.expectNewUser("")
+
+	m.store.EXPECT().GetJITApprovalRequest(gomock.Any(), jitAuthPID).Return(nil, nil)
+	req := &controllers.JITApprovalRequest{
+		ID:             uuid.Must(uuid.NewV4()),
+		AuthProviderID: jitAuthPID,
+		Email:          "abc@gmail.com",
+		Status:         controllers.JITApprovalPending,
+	}
+	m.store.EXPECT().
+		CreateJITApprovalRequest(gomock.Any(), &controllers.JITApprovalRequest{
+			AuthProviderID: jitAuthPID,
+			Email:          "abc@gmail.com",
+			FirstName:      "first",
+			LastName:       "last",
+		}).
+		Return(req, nil)
+	m.notifier.EXPECT().NotifyJITApprovalRequested(gomock.Any(), req).Return(nil)
+
+	_, err := doLoginRequest(getTestContext(), t, s)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "pending")
+}
+
+func TestServer_Login_JITApprovalDenied(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyApproval)
+	m.expectNewUser("")
+	m.store.EXPECT().GetJITApprovalRequest(gomock.Any(), jitAuthPID).Return(&controllers.JITApprovalRequest{
+		AuthProviderID: jitAuthPID,
+		Status:         controllers.JITApprovalDenied,
+	}, nil)
+
+	_, err := doLoginRequest(getTestContext(), t, s)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "denied")
+}
+
+func TestServer_Login_JITApprovalApprovedJoinsOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyApproval)
+	m.expectNewUser("")
+
+	orgPb := utils.ProtoFromUUIDStrOrNil(jitOrgID)
+	m.store.EXPECT().GetJITApprovalRequest(gomock.Any(), jitAuthPID).Return(&controllers.JITApprovalRequest{
+		AuthProviderID: jitAuthPID,
+		Status:         controllers.JITApprovalApproved,
+		OrgID:          uuid.FromStringOrNil(jitOrgID),
+	}, nil)
+	m.org.EXPECT().GetOrg(gomock.Any(), orgPb).Return(&profilepb.OrgInfo{ID: orgPb, OrgName: "pixie"}, nil)
+	m.org.EXPECT().
+		UpdateOrg(gomock.Any(), &profilepb.UpdateOrgRequest{ID: orgPb, DomainName: &types.StringValue{Value: ""}}).
+		Return(nil, nil)
+	m.expectUserCreated(jitOrgID)
+
+	resp, err := doLoginRequest(getTestContext(), t, s)
+	require.NoError(t, err)
+	assert.True(t, resp.UserCreated)
+	assert.Equal(t, jitOrgID, resp.OrgInfo.OrgID)
+	assert.Equal(t, "pixie", resp.OrgInfo.OrgName)
+}
+
+func jitContextForUser(email string) context.Context {
+	sCtx := authcontext.New()
+	sCtx.Claims = srvutils.GenerateJWTForUser(jitUserID, jitOrgID, email, time.Now().Add(time.Hour), "withpixie.ai")
+	return authcontext.NewContext(context.Background(), sCtx)
+}
+
+func TestServer_ListJITApprovalRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyApproval)
+
+	_, err := s.ListJITApprovalRequests(jitContextForUser("abc@gmail.com"), &authpb.ListJITApprovalRequestsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	id := uuid.Must(uuid.NewV4())
+	createdAt := time.Unix(1700000000, 0).UTC()
+	m.store.EXPECT().ListJITApprovalRequests(gomock.Any(), true).Return([]*controllers.JITApprovalRequest{
+		{ID: id, Email: "abc@gmail.com", Status: controllers.JITApprovalPending, CreatedAt: createdAt},
+	}, nil)
+
+	resp, err := s.ListJITApprovalRequests(jitContextForUser(jitAdmin), &authpb.ListJITApprovalRequestsRequest{PendingOnly: true})
+	require.NoError(t, err)
+	require.Len(t, resp.Requests, 1)
+	assert.Equal(t, utils.ProtoFromUUID(id), resp.Requests[0].ID)
+	assert.Equal(t, authpb.JIT_APPROVAL_STATUS_PENDING, resp.Requests[0].Status)
+	assert.Nil(t, resp.Requests[0].OrgID)
+	assert.Nil(t, resp.Requests[0].ReviewedAt)
+	assert.Equal(t, createdAt.Unix(), resp.Requests[0].CreatedAt.Seconds)
+}
+
+func TestServer_ReviewJITApprovalRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := setupJITServer(t, ctrl, controllers.JITOrgPolicyApproval)
+
+	id := uuid.Must(uuid.NewV4())
+	orgPb := utils.ProtoFromUUIDStrOrNil(jitOrgID)
+	m.org.EXPECT().GetOrg(gomock.Any(), orgPb).Return(&profilepb.OrgInfo{ID: orgPb}, nil)
+	reviewed := &controllers.JITApprovalRequest{
+		ID:         id,
+		Email:      "abc@gmail.com",
+		Status:     controllers.JITApprovalApproved,
+		OrgID:      uuid.FromStringOrNil(jitOrgID),
+		ReviewedAt: time.Now(),
+		ReviewedBy: jitAdmin,
+	}
+	m.store.EXPECT().
+		ReviewJITApprovalRequest(gomock.Any(), id, true, uuid.FromStringOrNil(jitOrgID), jitAdmin).
+		Return(reviewed, nil)
+	m.notifier.EXPECT().NotifyJITApprovalReviewed(gomock.Any(), reviewed).Return(nil)
+
+	resp, err := s.ReviewJITApprovalRequest(jitContextForUser(jitAdmin), &authpb.ReviewJITApprovalRequestRequest{
+		ID:      utils.ProtoFromUUID(id),
+		Approve: true,
+		OrgID:   orgPb,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, authpb.JIT_APPROVAL_STATUS_APPROVED, resp.Status)
+	assert.Equal(t, orgPb, resp.OrgID)
+	assert.Equal(t, jitAdmin, resp.ReviewedBy)
+	assert.NotNil(t, resp.ReviewedAt)
+}
+
+func TestServer_ReviewJITApprovalRequest_NotEnabled(t *testing.T) {
+	s, err := controllers.NewServer(nil, nil, nil)
+	require.NoError(t, err)
+	_, err = s.ReviewJITApprovalRequest(jitContextForUser(jitAdmin), &authpb.ReviewJITApprovalRequestRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestWebhookJITNotifier(t *testing.T) {
+	var texts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		texts = append(texts, body.Text)
+	}))
+	defer srv.Close()
+
+	n := controllers.NewWebhookJITNotifier(srv.URL)
+	req := &controllers.JITApprovalRequest{
+		ID:         uuid.Must(uuid.NewV4()),
+		Email:      "abc@gmail.com",
+		FirstName:  "first",
+		LastName:   "last",
+		Status:     controllers.JITApprovalDenied,
+		ReviewedBy: jitAdmin,
+	}
+	require.NoError(t, n.NotifyJITApprovalRequested(context.Background(), req))
+	require.NoError(t, n.NotifyJITApprovalReviewed(context.Background(), req))
+	require.Len(t, texts, 2)
+	assert.Contains(t, texts[0], "abc@gmail.com")
+	assert.Contains(t, texts[0], req.ID.String())
+	assert.Equal(t, "admin@pixie.dev denied the request of abc@gmail.com to join Pixie Cloud.", texts[1])
+}
@@ -22,6 +22,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,6 +36,9 @@ import (
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/auth/authpb"
 	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/audit"
+	"px.dev/pixie/src/cloud/shared/orgrole"
 	"px.dev/pixie/src/shared/services/authcontext"
 	srvutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
@@ -94,6 +98,27 @@ func (s *Server) reconcileOrgAndLogin(ctx context.Context, userInfo *UserInfo, u
 
 // Login uses the AuthProvider to authenticate and login the user. Errors out if their org doesn't exist.
 func (s *Server) Login(ctx context.Context, in *authpb.LoginRequest) (*authpb.LoginReply, error) {
+	resp, err := s.login(ctx, in)
+	e := &audit.Event{
+		Category: audit.CategoryAuth,
+		Action:   "login",
+		Outcome:  audit.OutcomeOf(err),
+	}
+	if err != nil {
+		e.Details = map[string]string{"error": status.Convert(err).Message()}
+	} else {
+		e.UserID = utils.UUIDFromProtoOrNil(resp.UserInfo.GetUserID()).String()
+		e.OrgID = resp.OrgInfo.GetOrgID()
+		e.Details = map[string]string{
+			"identity_provider": resp.IdentityProvider,
+			"user_created":      strconv.FormatBool(resp.UserCreated),
+		}
+	}
+	audit.Record(e)
+	return resp, err
+}
+
+func (s *Server) login(ctx context.Context, in *authpb.LoginRequest) (*authpb.LoginReply, error) {
 	md, _ := metadata.FromIncomingContext(ctx)
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
@@ -123,6 +148,10 @@ func (s *Server) Login(ctx context.Context, in *authpb.LoginRequest) (*authpb.Lo
 		return s.loginInvited(ctx, userInfo, user, inviteOrgID)
 	}
 
+	if user == nil && s.jitPolicy != JITOrgPolicyAllow {
+		return s.loginJIT(ctx, userInfo)
+	}
+
 	if userInfo.HostedDomain != "" {
 		return s.loginHostedDomain(ctx, userInfo, user)
 	}
@@ -218,7 +247,10 @@ func (s *Server) loginUser(ctx context.Context, userInfo *UserInfo, orgInfo *pro
 	if err != nil {
 		return nil, err
 	}
+	return loginReply(tkn, userInfo, orgName, orgIDStr, newUser), nil
+}
 
+func loginReply(tkn *tokenData, userInfo *UserInfo, orgName string, orgIDStr string, newUser bool) *authpb.LoginReply {
 	return &authpb.LoginReply{
 		Token:       tkn.token,
 		ExpiresAt:   tkn.expiresAt.Unix(),
@@ -234,7 +266,7 @@ func (s *Server) loginUser(ctx context.Context, userInfo *UserInfo, orgInfo *pro
 			OrgID:   orgIDStr,
 		},
 		IdentityProvider: userInfo.IdentityProvider,
-	}, nil
+	}
 }
 
 type tokenData struct {
@@ -266,6 +298,9 @@ func (s *Server) completeUserLogin(ctx context.Context, userInfo *UserInfo, orgI
 			return nil, status.Error(codes.PermissionDenied, "You are not approved to log in to the org. Please request approval from your org admin")
 		}
 	}
+	if user.IsDeactivated {
+		return nil, status.Error(codes.PermissionDenied, "Your account has been deactivated. Please contact your org admin")
+	}
 
 	// Update user's profile photo.
 	_, err = pc.UpdateUser(ctx, &profilepb.UpdateUserRequest{
@@ -359,6 +394,27 @@ func (s *Server) getInviteOrgID(ctx context.Context, inviteToken string) (*uuidp
 
 // Signup uses the AuthProvider to authenticate and sign up the user. It autocreates the org if the org doesn't exist.
 func (s *Server) Signup(ctx context.Context, in *authpb.SignupRequest) (*authpb.SignupReply, error) {
+	resp, err := s.signup(ctx, in)
+	e := &audit.Event{
+		Category: audit.CategoryAuth,
+		Action:   "signup",
+		Outcome:  audit.OutcomeOf(err),
+	}
+	if err != nil {
+		e.Details = map[string]string{"error": status.Convert(err).Message()}
+	} else {
+		e.UserID = utils.UUIDFromProtoOrNil(resp.UserInfo.GetUserID()).String()
+		e.OrgID = utils.UUIDFromProtoOrNil(resp.OrgID).String()
+		e.Details = map[string]string{
+			"identity_provider": resp.IdentityProvider,
+			"org_created":       strconv.FormatBool(resp.OrgCreated),
+		}
+	}
+	audit.Record(e)
+	return resp, err
+}
+
+func (s *Server) signup(ctx context.Context, in *authpb.SignupRequest) (*authpb.SignupReply, error) {
 	inviteOrgID, err := s.getInviteOrgID(ctx, in.InviteToken)
 	if err != nil {
 		return nil, err
@@ -397,6 +453,11 @@ func (s *Server) Signup(ctx context.Context, in *authpb.SignupRequest) (*authpb.
 		return s.signupUser(ctx, updatedUserInfo, orgInfoPb, false /* newOrg */)
 	}
 
+	// Users that weren't invited are subject to the JIT org policy, if there is one.
+	if s.jitPolicy != JITOrgPolicyAllow {
+		return s.signupJIT(ctx, userInfo)
+	}
+
 	// Case 2: An empty HostedDomain means this user will be created without an org.
 	if userInfo.HostedDomain == "" {
 		updatedUserInfo, err := s.createUser(ctx, userInfo, nil)
@@ -484,13 +545,30 @@ func (s *Server) createUser(ctx context.Context, userInfo *UserInfo, orgID *uuid
 	return userInfo, nil
 }
 
-// GetAugmentedTokenForAPIKey produces an augmented token for the user given a API key.
+// GetAugmentedTokenForAPIKey produces an augmented token for the user given a API key or personal access token.
 func (s *Server) GetAugmentedTokenForAPIKey(ctx context.Context, in *authpb.GetAugmentedTokenForAPIKeyRequest) (*authpb.GetAugmentedTokenForAPIKeyResponse, error) {
+	if s.patMgr != nil && strings.HasPrefix(in.APIKey, PersonalAccessTokenPrefix) {
+		resp, err := s.getAugmentedTokenForPersonalAccessToken(ctx, in)
+		audit.Record(&audit.Event{
+			Category: audit.CategoryAPIKey,
+			Action:   "use_personal_access_token",
+			Outcome:  audit.OutcomeOf(err),
+		})
+		return resp, err
+	}
+
 	// Find the org/user associated with the token.
-	orgID, userID, err := s.apiKeyMgr.FetchOrgUserIDUsingAPIKey(ctx, in.APIKey)
+	apiKey, err := s.apiKeyMgr.FetchAPIKeyUsingKey(ctx, in.APIKey)
 	if err != nil {
+		audit.Record(&audit.Event{
+			Category: audit.CategoryAPIKey,
+			Action:   "use_api_key",
+			Outcome:  audit.OutcomeFailure,
+			Details:  map[string]string{"error": "invalid API key"},
+		})
 		return nil, status.Errorf(codes.Unauthenticated, "Invalid API key")
 	}
+	orgID, userID := apiKey.OrgID, apiKey.UserID
 
 	// Generate service token, so that we can make a call to the Profile service.
 	svcJWT := srvutils.GenerateJWTForService("AuthService", viper.GetString("domain_name"))
@@ -506,14 +584,36 @@ func (s *Server) GetAugmentedTokenForAPIKey(ctx context.Context, in *authpb.GetA
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to generate auth token")
 	}
+	roleScopes, err := s.orgRoleScopes(ctxWithSvcCreds, userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to fetch the roles of the user")
+	}
 
 	// Create JWT for user/org.
 	claims := srvutils.GenerateJWTForAPIUser(userID.String(), orgID.String(), time.Now().Add(AugmentedTokenValidDuration), viper.GetString("domain_name"))
+	// The scopes of scoped keys are added to the token so that they are enforced wherever the token is used.
+	if len(apiKey.Scopes) > 0 {
+		claims.Scopes = append(claims.Scopes, apikeyscope.TokenScope)
+		claims.Scopes = append(claims.Scopes, apiKey.Scopes...)
+		for _, clusterID := range apiKey.ClusterIDs {
+			claims.Scopes = append(claims.Scopes, apikeyscope.ClusterScope(clusterID))
+		}
+	}
+	claims.Scopes = append(claims.Scopes, roleScopes...)
 	token, err := srvutils.SignJWTClaims(claims, s.env.JWTSigningKey())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to generate auth token")
 	}
 
+	audit.Record(&audit.Event{
+		Category: audit.CategoryAPIKey,
+		Action:   "use_api_key",
+		Outcome:  audit.OutcomeSuccess,
+		OrgID:    orgID.String(),
+		UserID:   userID.String(),
+		Details:  map[string]string{"scoped": strconv.FormatBool(len(apiKey.Scopes) > 0)},
+	})
+
 	resp := &authpb.GetAugmentedTokenForAPIKeyResponse{
 		Token:     token,
 		ExpiresAt: claims.ExpiresAt,
@@ -536,6 +636,8 @@ func (s *Server) GetAugmentedToken(
 		return nil, status.Error(codes.Unauthenticated, "Invalid auth/user")
 	}
 
+	// The roles of the user are looked up again, in case they changed since the token was issued.
+	var roleScopes []string
 	// We perform extra checks for user tokens.
 	if srvutils.GetClaimsType(aCtx.Claims) == srvutils.UserClaimType {
 		// Check to make sure that the org and user exist in the system.
@@ -564,11 +666,26 @@ func (s *Server) GetAugmentedToken(
 			if uuid.FromStringOrNil(orgIDstr) != utils.UUIDFromProtoOrNil(userInfo.OrgID) {
 				return nil, status.Error(codes.Unauthenticated, "Mismatched org")
 			}
+
+			// The api service augments the session token on every request, so this also ends the
+			// sessions that a user already has when they are deactivated.
+			if userInfo.IsDeactivated {
+				return nil, status.Error(codes.Unauthenticated, "Deactivated user")
+			}
+		}
+
+		if uuid.FromStringOrNil(orgIDstr) != uuid.Nil {
+			var err error
+			roleScopes, err = s.orgRoleScopes(ctx, uuid.FromStringOrNil(aCtx.Claims.GetUserClaims().UserID))
+			if err != nil {
+				return nil, status.Error(codes.Internal, "failed to fetch the roles of the user")
+			}
 		}
 	}
 
 	// TODO(zasgar): This step should be to generate a new token base on what we get from a database.
 	claims := *aCtx.Claims
+	claims.Scopes = append(orgrole.WithoutRoleScopes(claims.Scopes), roleScopes...)
 	claims.IssuedAt = time.Now().Unix()
 	claims.ExpiresAt = time.Now().Add(AugmentedTokenValidDuration).Unix()
 
@@ -758,6 +875,9 @@ func (s *Server) RefetchToken(ctx context.Context, in *authpb.RefetchTokenReques
 	if err != nil || user == nil {
 		return nil, status.Error(codes.Unauthenticated, "Invalid auth/user")
 	}
+	if user.IsDeactivated {
+		return nil, status.Error(codes.Unauthenticated, "Deactivated user")
+	}
 	orgIDStr := ""
 	if !utils.IsNilUUIDProto(user.OrgID) {
 		orgIDStr = utils.UUIDFromProtoOrNil(user.OrgID).String()
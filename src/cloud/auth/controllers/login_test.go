@@ -39,6 +39,8 @@ import (
 	mock_controllers "px.dev/pixie/src/cloud/auth/controllers/mock"
 	"px.dev/pixie/src/cloud/profile/profilepb"
 	mock_profile "px.dev/pixie/src/cloud/profile/profilepb/mock"
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+	"px.dev/pixie/src/cloud/shared/orgrole"
 	"px.dev/pixie/src/shared/services/authcontext"
 	srvutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
@@ -779,6 +781,15 @@ func TestServer_GetAugmentedToken(t *testing.T) {
 	mockOrg.EXPECT().
 		GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
 		Return(mockOrgInfo, nil)
+	clusterID := uuid.Must(uuid.NewV4())
+	mockOrg.EXPECT().
+		GetUserRoles(gomock.Any(), &profilepb.GetUserRolesRequest{UserID: utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)}).
+		Return(&profilepb.UserRoles{
+			Bindings: []*profilepb.RoleBinding{
+				{Role: profilepb.ORG_ROLE_VIEWER},
+				{Role: profilepb.ORG_ROLE_EDITOR, ClusterID: utils.ProtoFromUUID(clusterID)},
+			},
+		}, nil)
 
 	viper.Set("jwt_signing_key", "jwtkey")
 
@@ -788,6 +799,8 @@ func TestServer_GetAugmentedToken(t *testing.T) {
 	require.NoError(t, err)
 
 	claims := testingutils.GenerateTestClaims(t)
+	// Roles in the incoming token are replaced by the current roles of the user.
+	claims.Scopes = append(claims.Scopes, orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Admin}})...)
 	token := testingutils.SignPBClaims(t, claims, "jwtkey")
 	req := &authpb.GetAugmentedAuthTokenRequest{
 		Token: token,
@@ -806,6 +819,13 @@ func TestServer_GetAugmentedToken(t *testing.T) {
 	assert.True(t, resp.ExpiresAt > 0)
 
 	verifyToken(t, resp.Token, testingutils.TestUserID, testingutils.TestOrgID, resp.ExpiresAt, "jwtkey")
+
+	parsed, err := srvutils.ParseToken(resp.Token, "jwtkey", "withpixie.ai")
+	require.NoError(t, err)
+	scopes := srvutils.GetScopes(parsed)
+	assert.Equal(t, orgrole.Viewer, orgrole.OrgRole(scopes))
+	assert.True(t, orgrole.AllowsMutation(scopes, clusterID))
+	assert.False(t, orgrole.AllowsMutation(scopes, uuid.Must(uuid.NewV4())))
 }
 
 func TestServer_GetAugmentedToken_Service(t *testing.T) {
@@ -1005,6 +1025,87 @@ func TestServer_GetAugmentedToken_MismatchedOrg(t *testing.T) {
 	assert.Equal(t, e.Code(), codes.Unauthenticated)
 }
 
+func TestServer_GetAugmentedToken_DeactivatedUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	a := mock_controllers.NewMockAuthProvider(ctrl)
+
+	mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
+	mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
+
+	mockUserInfo := &profilepb.UserInfo{
+		ID:            utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
+		OrgID:         utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		IsDeactivated: true,
+	}
+	mockOrgInfo := &profilepb.OrgInfo{
+		ID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+	}
+	mockProfile.EXPECT().
+		GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)).
+		Return(mockUserInfo, nil)
+	mockOrg.EXPECT().
+		GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
+		Return(mockOrgInfo, nil)
+
+	viper.Set("jwt_signing_key", "jwtkey")
+	viper.Set("domain_name", "withpixie.ai")
+
+	env, err := authenv.New(mockProfile, mockOrg)
+	require.NoError(t, err)
+	s, err := controllers.NewServer(env, a, nil)
+	require.NoError(t, err)
+
+	claims := testingutils.GenerateTestClaims(t)
+	token := testingutils.SignPBClaims(t, claims, "jwtkey")
+	req := &authpb.GetAugmentedAuthTokenRequest{
+		Token: token,
+	}
+	sCtx := authcontext.New()
+	sCtx.Claims = claims
+	resp, err := s.GetAugmentedToken(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.NotNil(t, err)
+
+	e, ok := status.FromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, e.Code(), codes.Unauthenticated)
+}
+
+func TestServer_RefetchToken_DeactivatedUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	a := mock_controllers.NewMockAuthProvider(ctrl)
+
+	mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
+	mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
+
+	mockUserInfo := &profilepb.UserInfo{
+		ID:            utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
+		OrgID:         utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		IsDeactivated: true,
+	}
+	mockProfile.EXPECT().
+		GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)).
+		Return(mockUserInfo, nil)
+
+	viper.Set("jwt_signing_key", "jwtkey")
+	viper.Set("domain_name", "withpixie.ai")
+
+	env, err := authenv.New(mockProfile, mockOrg)
+	require.NoError(t, err)
+	s, err := controllers.NewServer(env, a, nil)
+	require.NoError(t, err)
+
+	claims := testingutils.GenerateTestClaims(t)
+	token := testingutils.SignPBClaims(t, claims, "jwtkey")
+	resp, err := s.RefetchToken(context.Background(), &authpb.RefetchTokenRequest{
+		Token: token,
+	})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
 func TestServer_GetAugmentedTokenBadSigningKey(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	a := mock_controllers.NewMockAuthProvider(ctrl)
@@ -1078,6 +1179,10 @@ func TestServer_GetAugmentedTokenAPIUser(t *testing.T) {
 		GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
 		Return(mockOrgInfo, nil)
 
+	mockOrg.EXPECT().
+		GetUserRoles(gomock.Any(), &profilepb.GetUserRolesRequest{UserID: utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)}).
+		Return(&profilepb.UserRoles{Bindings: []*profilepb.RoleBinding{{Role: profilepb.ORG_ROLE_ADMIN}}}, nil)
+
 	viper.Set("jwt_signing_key", "jwtkey")
 	viper.Set("domain_name", "withpixie.ai")
 
@@ -1116,7 +1221,10 @@ func TestServer_GetAugmentedTokenFromAPIKey(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	a := mock_controllers.NewMockAuthProvider(ctrl)
 	apiKeyServer := mock_controllers.NewMockAPIKeyMgr(ctrl)
-	apiKeyServer.EXPECT().FetchOrgUserIDUsingAPIKey(gomock.Any(), "test_api").Return(uuid.FromStringOrNil(testingutils.TestOrgID), uuid.FromStringOrNil(testingutils.TestUserID), nil)
+	apiKeyServer.EXPECT().FetchAPIKeyUsingKey(gomock.Any(), "test_api").Return(&controllers.APIKey{
+		OrgID:  uuid.FromStringOrNil(testingutils.TestOrgID),
+		UserID: uuid.FromStringOrNil(testingutils.TestUserID),
+	}, nil)
 
 	mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
 	mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
@@ -1127,6 +1235,10 @@ func TestServer_GetAugmentedTokenFromAPIKey(t *testing.T) {
 		GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
 		Return(mockOrgInfo, nil)
 
+	mockOrg.EXPECT().
+		GetUserRoles(gomock.Any(), &profilepb.GetUserRolesRequest{UserID: utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)}).
+		Return(&profilepb.UserRoles{Bindings: []*profilepb.RoleBinding{{Role: profilepb.ORG_ROLE_ADMIN}}}, nil)
+
 	viper.Set("jwt_signing_key", "jwtkey")
 	viper.Set("domain_name", "withpixie.ai")
 
@@ -1157,6 +1269,52 @@ func TestServer_GetAugmentedTokenFromAPIKey(t *testing.T) {
 	assert.True(t, srvutils.GetIsAPIUser(parsed))
 }
 
+func TestServer_GetAugmentedTokenFromAPIKey_Scoped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	a := mock_controllers.NewMockAuthProvider(ctrl)
+	clusterID := uuid.Must(uuid.NewV4())
+	apiKeyServer := mock_controllers.NewMockAPIKeyMgr(ctrl)
+	apiKeyServer.EXPECT().FetchAPIKeyUsingKey(gomock.Any(), "test_api").Return(&controllers.APIKey{
+		OrgID:      uuid.FromStringOrNil(testingutils.TestOrgID),
+		UserID:     uuid.FromStringOrNil(testingutils.TestUserID),
+		Scopes:     []string{apikeyscope.ScriptRead},
+		ClusterIDs: []uuid.UUID{clusterID},
+	}, nil)
+
+	mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
+	mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
+	mockOrg.EXPECT().
+		GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
+		Return(&profilepb.OrgInfo{ID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)}, nil)
+
+	mockOrg.EXPECT().
+		GetUserRoles(gomock.Any(), &profilepb.GetUserRolesRequest{UserID: utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)}).
+		Return(&profilepb.UserRoles{Bindings: []*profilepb.RoleBinding{{Role: profilepb.ORG_ROLE_ADMIN}}}, nil)
+
+	viper.Set("jwt_signing_key", "jwtkey")
+	viper.Set("domain_name", "withpixie.ai")
+
+	env, err := authenv.New(mockProfile, mockOrg)
+	require.NoError(t, err)
+	s, err := controllers.NewServer(env, a, apiKeyServer)
+	require.NoError(t, err)
+
+	resp, err := s.GetAugmentedTokenForAPIKey(context.Background(), &authpb.GetAugmentedTokenForAPIKeyRequest{
+		APIKey: "test_api",
+	})
+	require.NoError(t, err)
+
+	parsed, err := srvutils.ParseToken(resp.Token, "jwtkey", "withpixie.ai")
+	require.NoError(t, err)
+	assert.True(t, srvutils.GetIsAPIUser(parsed))
+	scopes := srvutils.GetScopes(parsed)
+	assert.Contains(t, scopes, apikeyscope.TokenScope)
+	assert.Contains(t, scopes, apikeyscope.ScriptRead)
+	assert.True(t, apikeyscope.AllowsCluster(scopes, clusterID))
+	assert.False(t, apikeyscope.AllowsCluster(scopes, uuid.Must(uuid.NewV4())))
+	assert.False(t, apikeyscope.AllowsMutation(scopes))
+}
+
 func TestServer_Signup_LookupHostedDomain(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -18,4 +18,4 @@
 
 package controllers
 
-//go:generate mockgen -source=server.go -destination=mock/mock_apikeymgr.gen.go APIKeyMgr,AuthProvider
+//go:generate mockgen -source=server.go -destination=mock/mock_apikeymgr.gen.go APIKeyMgr,AuthProvider,JITApprovalStore,JITNotifier,SAMLConfigStore,PersonalAccessTokenMgr
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/shared/patscope"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+// getAugmentedTokenForPersonalAccessToken issues a token for the owner of the personal access token, limited
+// to the scopes of the personal access token.
+func (s *Server) getAugmentedTokenForPersonalAccessToken(ctx context.Context, in *authpb.GetAugmentedTokenForAPIKeyRequest) (*authpb.GetAugmentedTokenForAPIKeyResponse, error) {
+	pat, err := s.patMgr.UsePersonalAccessToken(ctx, in.APIKey, in.ClientIP)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid personal access token")
+	}
+
+	svcJWT := srvutils.GenerateJWTForService("AuthService", viper.GetString("domain_name"))
+	svcClaims, err := srvutils.SignJWTClaims(svcJWT, s.env.JWTSigningKey())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to generate auth token")
+	}
+	ctxWithSvcCreds := metadata.AppendToOutgoingContext(ctx, "authorization",
+		fmt.Sprintf("bearer %s", svcClaims))
+
+	// Tokens are only valid as long as their owner is an approved member of the org that they were created in.
+	userInfo, err := s.env.ProfileClient().GetUser(ctxWithSvcCreds, utils.ProtoFromUUID(pat.UserID))
+	if err != nil || userInfo == nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid personal access token")
+	}
+	if utils.UUIDFromProtoOrNil(userInfo.OrgID) != pat.OrgID || !userInfo.IsApproved || userInfo.IsDeactivated {
+		return nil, status.Error(codes.Unauthenticated, "Invalid personal access token")
+	}
+
+	expiresAt := time.Now().Add(AugmentedTokenValidDuration)
+	if pat.ExpiresAt.Before(expiresAt) {
+		expiresAt = pat.ExpiresAt
+	}
+	roleScopes, err := s.orgRoleScopes(ctxWithSvcCreds, pat.UserID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to fetch the roles of the user")
+	}
+	claims := srvutils.GenerateJWTForUser(pat.UserID.String(), pat.OrgID.String(), userInfo.Email, expiresAt, viper.GetString("domain_name"))
+	claims.Scopes = append(claims.Scopes, patscope.TokenScope)
+	claims.Scopes = append(claims.Scopes, pat.Scopes...)
+	claims.Scopes = append(claims.Scopes, roleScopes...)
+	token, err := srvutils.SignJWTClaims(claims, s.env.JWTSigningKey())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to generate auth token")
+	}
+
+	return &authpb.GetAugmentedTokenForAPIKeyResponse{
+		Token:     token,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
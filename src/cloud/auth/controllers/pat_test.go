@@ -0,0 +1,160 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authenv"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/auth/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/auth/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	mock_profile "px.dev/pixie/src/cloud/profile/profilepb/mock"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const testPAT = "px-pat-abc"
+
+func setupPATServer(t *testing.T, ctrl *gomock.Controller) (*controllers.Server, *mock_profile.MockProfileServiceClient, *mock_profile.MockOrgServiceClient, *mock_controllers.MockPersonalAccessTokenMgr) {
+	viper.Set("jwt_signing_key", "jwtkey")
+	viper.Set("domain_name", "withpixie.ai")
+
+	mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
+	mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
+	patMgr := mock_controllers.NewMockPersonalAccessTokenMgr(ctrl)
+
+	env, err := authenv.New(mockProfile, mockOrg)
+	require.NoError(t, err)
+	s, err := controllers.NewServer(env, mock_controllers.NewMockAuthProvider(ctrl), mock_controllers.NewMockAPIKeyMgr(ctrl),
+		controllers.WithPersonalAccessTokens(patMgr))
+	require.NoError(t, err)
+	return s, mockProfile, mockOrg, patMgr
+}
+
+func TestServer_GetAugmentedTokenForAPIKey_PersonalAccessToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, mockProfile, mockOrg, patMgr := setupPATServer(t, ctrl)
+
+	orgID := uuid.FromStringOrNil(testingutils.TestOrgID)
+	userID := uuid.FromStringOrNil(testingutils.TestUserID)
+	expiresAt := time.Now().Add(10 * time.Minute)
+	patMgr.EXPECT().UsePersonalAccessToken(gomock.Any(), testPAT, "10.0.0.1").Return(&controllers.PersonalAccessToken{
+		OrgID:     orgID,
+		UserID:    userID,
+		Scopes:    []string{"cloud:read"},
+		ExpiresAt: expiresAt,
+	}, nil)
+	mockProfile.EXPECT().GetUser(gomock.Any(), utils.ProtoFromUUID(userID)).Return(&profilepb.UserInfo{
+		ID:         utils.ProtoFromUUID(userID),
+		OrgID:      utils.ProtoFromUUID(orgID),
+		Email:      "abc@abc.com",
+		IsApproved: true,
+	}, nil)
+	mockOrg.EXPECT().GetUserRoles(gomock.Any(), &profilepb.GetUserRolesRequest{UserID: utils.ProtoFromUUID(userID)}).
+		Return(&profilepb.UserRoles{Bindings: []*profilepb.RoleBinding{{Role: profilepb.ORG_ROLE_VIEWER}}}, nil)
+
+	resp, err := s.GetAugmentedTokenForAPIKey(context.Background(), &authpb.GetAugmentedTokenForAPIKeyRequest{
+		APIKey:   testPAT,
+		ClientIP: "10.0.0.1",
+	})
+	require.NoError(t, err)
+	// The token shouldn't outlive the personal access token.
+	assert.Equal(t, expiresAt.Unix(), resp.ExpiresAt)
+
+	parsed, err := srvutils.ParseToken(resp.Token, "jwtkey", "withpixie.ai")
+	require.NoError(t, err)
+	assert.Equal(t, testingutils.TestUserID, srvutils.GetUserID(parsed))
+	assert.Equal(t, testingutils.TestOrgID, srvutils.GetOrgID(parsed))
+	assert.Equal(t, "abc@abc.com", srvutils.GetEmail(parsed))
+	assert.False(t, srvutils.GetIsAPIUser(parsed))
+	assert.Equal(t, []string{"user", "pat", "cloud:read", "roles", "role:viewer"}, srvutils.GetScopes(parsed))
+}
+
+func TestServer_GetAugmentedTokenForAPIKey_InvalidPersonalAccessToken(t *testing.T) {
+	orgID := uuid.FromStringOrNil(testingutils.TestOrgID)
+	userID := uuid.FromStringOrNil(testingutils.TestUserID)
+	pat := &controllers.PersonalAccessToken{
+		OrgID:     orgID,
+		UserID:    userID,
+		Scopes:    []string{"cloud:read"},
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	tests := []struct {
+		name     string
+		pat      *controllers.PersonalAccessToken
+		patErr   error
+		userInfo *profilepb.UserInfo
+	}{
+		{
+			name:   "unknown or expired token",
+			patErr: errors.New("invalid personal access token"),
+		},
+		{
+			name: "user left the org",
+			pat:  pat,
+			userInfo: &profilepb.UserInfo{
+				ID:         utils.ProtoFromUUID(userID),
+				OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+				IsApproved: true,
+			},
+		},
+		{
+			name: "user not approved",
+			pat:  pat,
+			userInfo: &profilepb.UserInfo{
+				ID:    utils.ProtoFromUUID(userID),
+				OrgID: utils.ProtoFromUUID(orgID),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s, mockProfile, _, patMgr := setupPATServer(t, ctrl)
+
+			patMgr.EXPECT().UsePersonalAccessToken(gomock.Any(), testPAT, "").Return(test.pat, test.patErr)
+			if test.userInfo != nil {
+				mockProfile.EXPECT().GetUser(gomock.Any(), utils.ProtoFromUUID(userID)).Return(test.userInfo, nil)
+			}
+
+			_, err := s.GetAugmentedTokenForAPIKey(context.Background(), &authpb.GetAugmentedTokenForAPIKeyRequest{
+				APIKey: testPAT,
+			})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+}
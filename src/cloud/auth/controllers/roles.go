@@ -0,0 +1,55 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/utils"
+)
+
+// orgRoleNames are the names of the roles in the scopes of tokens.
+var orgRoleNames = map[profilepb.OrgRole]string{
+	profilepb.ORG_ROLE_ADMIN:  orgrole.Admin,
+	profilepb.ORG_ROLE_EDITOR: orgrole.Editor,
+	profilepb.ORG_ROLE_VIEWER: orgrole.Viewer,
+}
+
+// orgRoleScopes returns the JWT scopes that enforce the roles of the user in their org. ctx must carry
+// credentials that may read the roles of the user.
+func (s *Server) orgRoleScopes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	resp, err := s.env.OrgClient().GetUserRoles(ctx, &profilepb.GetUserRolesRequest{
+		UserID: utils.ProtoFromUUID(userID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]orgrole.Binding, 0, len(resp.Bindings))
+	for _, b := range resp.Bindings {
+		role, ok := orgRoleNames[b.Role]
+		if !ok {
+			continue
+		}
+		bindings = append(bindings, orgrole.Binding{Role: role, ClusterID: utils.UUIDFromProtoOrNil(b.ClusterID)})
+	}
+	return orgrole.TokenScopes(bindings), nil
+}
@@ -0,0 +1,453 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	saml2 "github.com/russellhaering/gosaml2"
+	samltypes "github.com/russellhaering/gosaml2/types"
+	dsig "github.com/russellhaering/goxmldsig"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/samlid"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+// samlOrgPath is the path under which the API service serves the SAML service provider endpoints of an org.
+func (s *Server) samlOrgPath(orgID uuid.UUID) string {
+	return fmt.Sprintf("%s/api/auth/saml/%s", s.samlBaseURL, orgID)
+}
+
+// newSAMLServiceProvider creates the service provider of the org. If cfg is nil, the service provider can only
+// be used to generate the metadata.
+func (s *Server) newSAMLServiceProvider(orgID uuid.UUID, cfg *SAMLConfig) (*saml2.SAMLServiceProvider, error) {
+	sp := &saml2.SAMLServiceProvider{
+		// The metadata URL doubles as the entity ID, which is the recommended practice.
+		ServiceProviderIssuer:       s.samlOrgPath(orgID) + "/metadata",
+		AssertionConsumerServiceURL: s.samlOrgPath(orgID) + "/acs",
+		AudienceURI:                 s.samlOrgPath(orgID) + "/metadata",
+		NameIdFormat:                saml2.NameIdFormatUnspecified,
+		Clock:                       dsig.NewRealClock(),
+	}
+	if cfg == nil {
+		return sp, nil
+	}
+
+	certs, err := parseSAMLCertificates(cfg.IdPCertificate)
+	if err != nil {
+		return nil, err
+	}
+	sp.IdentityProviderIssuer = cfg.IdPEntityID
+	sp.IdentityProviderSSOURL = cfg.IdPSSOURL
+	sp.IDPCertificateStore = &dsig.MemoryX509CertificateStore{Roots: certs}
+	sp.AllowMissingAttributes = cfg.EmailAttribute == "" && cfg.GroupsAttribute == ""
+	return sp, nil
+}
+
+// parseSAMLCertificates parses the PEM encoded certificates of an identity provider. Several certificates are
+// allowed, so that the identity provider can rotate its signing key without downtime.
+func parseSAMLCertificates(certPEM string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity provider certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("the identity provider certificate must be PEM encoded")
+	}
+	return certs, nil
+}
+
+// getEnabledSAMLConfig returns the SAML config of the org, if the org may log in with SAML.
+func (s *Server) getEnabledSAMLConfig(ctx context.Context, orgIDPb *uuidpb.UUID) (*SAMLConfig, error) {
+	if s.samlStore == nil {
+		return nil, status.Error(codes.FailedPrecondition, "SAML logins are not enabled")
+	}
+	orgID, err := utils.UUIDFromProto(orgIDPb)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+	cfg, err := s.samlStore.GetSAMLConfig(ctx, orgID)
+	if err != nil {
+		log.WithError(err).Error("Failed to get SAML config")
+		return nil, status.Error(codes.Internal, "failed to get SAML config")
+	}
+	if cfg == nil || !cfg.Enabled {
+		return nil, status.Error(codes.NotFound, "the org has no SAML identity provider")
+	}
+	return cfg, nil
+}
+
+// GetSAMLServiceProviderMetadata returns the SAML metadata of Pixie Cloud for the org.
+func (s *Server) GetSAMLServiceProviderMetadata(ctx context.Context, req *authpb.GetSAMLServiceProviderMetadataRequest) (*authpb.GetSAMLServiceProviderMetadataResponse, error) {
+	if s.samlStore == nil {
+		return nil, status.Error(codes.FailedPrecondition, "SAML logins are not enabled")
+	}
+	orgID, err := utils.UUIDFromProto(req.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+
+	// The metadata doesn't depend on the identity provider, so that it is available before the org configures it.
+	sp, _ := s.newSAMLServiceProvider(orgID, nil)
+	md, err := sp.Metadata()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate metadata: %v", err)
+	}
+	out, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate metadata: %v", err)
+	}
+	return &authpb.GetSAMLServiceProviderMetadataResponse{Metadata: xml.Header + string(out)}, nil
+}
+
+// GetSAMLAuthURL returns the URL that starts a login with the org's identity provider.
+func (s *Server) GetSAMLAuthURL(ctx context.Context, req *authpb.GetSAMLAuthURLRequest) (*authpb.GetSAMLAuthURLResponse, error) {
+	cfg, err := s.getEnabledSAMLConfig(ctx, req.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := s.newSAMLServiceProvider(cfg.OrgID, cfg)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	url, err := sp.BuildAuthURL(req.RelayState)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to build auth request: %v", err)
+	}
+	return &authpb.GetSAMLAuthURLResponse{URL: url}, nil
+}
+
+// samlRoleForGroups returns the org role of a user in the given groups.
+func samlRoleForGroups(cfg *SAMLConfig, groups []string) SAMLOrgRole {
+	memberOf := make(map[string]bool)
+	for _, g := range groups {
+		memberOf[g] = true
+	}
+	for _, gr := range cfg.GroupRoles {
+		if memberOf[gr.Group] {
+			return gr.Role
+		}
+	}
+	return cfg.DefaultRole
+}
+
+// consumeSAMLAssertions makes sure that the assertions of a SAML response are only used to log in once. Otherwise,
+// anyone who gets hold of a response, such as from the browser history, could log in with it until it expires.
+func (s *Server) consumeSAMLAssertions(ctx context.Context, orgID uuid.UUID, assertions []samltypes.Assertion) error {
+	if len(assertions) == 0 {
+		return status.Error(codes.Unauthenticated, "the SAML response has no assertion")
+	}
+	for _, a := range assertions {
+		if a.ID == "" || a.Conditions == nil {
+			return status.Error(codes.Unauthenticated, "the SAML assertion has no ID or conditions")
+		}
+		// gosaml2 already checked that the assertion hasn't expired.
+		expiresAt, err := time.Parse(time.RFC3339, a.Conditions.NotOnOrAfter)
+		if err != nil {
+			return status.Error(codes.Unauthenticated, "the SAML assertion has an invalid expiry")
+		}
+		ok, err := s.samlStore.ConsumeSAMLAssertion(ctx, orgID, a.ID, expiresAt)
+		if err != nil {
+			log.WithError(err).Error("Failed to record SAML assertion")
+			return status.Error(codes.Internal, "failed to record SAML assertion")
+		}
+		if !ok {
+			log.WithField("orgID", orgID).WithField("assertionID", a.ID).Info("Replayed SAML assertion")
+			return status.Error(codes.Unauthenticated, "the SAML assertion was already used")
+		}
+	}
+	return nil
+}
+
+// samlUserInfo validates the SAML response and returns the user that it authenticates, along with their groups.
+func (s *Server) samlUserInfo(ctx context.Context, cfg *SAMLConfig, samlResponse string) (*UserInfo, []string, error) {
+	sp, err := s.newSAMLServiceProvider(cfg.OrgID, cfg)
+	if err != nil {
+		return nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	info, err := sp.RetrieveAssertionInfo(samlResponse)
+	if err != nil {
+		log.WithError(err).WithField("orgID", cfg.OrgID).Info("Invalid SAML response")
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid SAML response")
+	}
+	// gosaml2 only reports these as warnings, since some service providers choose to accept them.
+	if info.WarningInfo.InvalidTime || info.WarningInfo.NotInAudience {
+		return nil, nil, status.Error(codes.Unauthenticated, "the SAML assertion is expired or meant for another service provider")
+	}
+	if err := s.consumeSAMLAssertions(ctx, cfg.OrgID, info.Assertions); err != nil {
+		return nil, nil, err
+	}
+
+	userInfo := &UserInfo{
+		Email: info.NameID,
+		// The identity provider is trusted by the org to have verified the emails of its users.
+		EmailVerified:    true,
+		IdentityProvider: samlid.IdentityProvider,
+		AuthProviderID:   samlid.AuthProviderID(cfg.OrgID, info.NameID),
+	}
+	if cfg.EmailAttribute != "" {
+		userInfo.Email = info.Values.Get(cfg.EmailAttribute)
+	}
+	if cfg.FirstNameAttribute != "" {
+		userInfo.FirstName = info.Values.Get(cfg.FirstNameAttribute)
+	}
+	if cfg.LastNameAttribute != "" {
+		userInfo.LastName = info.Values.Get(cfg.LastNameAttribute)
+	}
+	userInfo.Name = strings.TrimSpace(userInfo.FirstName + " " + userInfo.LastName)
+	if userInfo.Email == "" {
+		return nil, nil, status.Error(codes.Unauthenticated, "the SAML assertion has no email for the user")
+	}
+
+	var groups []string
+	if cfg.GroupsAttribute != "" {
+		groups = info.Values.GetAll(cfg.GroupsAttribute)
+	}
+	return userInfo, groups, nil
+}
+
+// LoginSAML logs in the user of a SAML response from the org's identity provider. Users are created in the
+// org on their first login, with the role that their groups map to.
+func (s *Server) LoginSAML(ctx context.Context, req *authpb.LoginSAMLRequest) (*authpb.LoginReply, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	cfg, err := s.getEnabledSAMLConfig(ctx, req.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	userInfo, groups, err := s.samlUserInfo(ctx, cfg, req.SAMLResponse)
+	if err != nil {
+		return nil, err
+	}
+	role := samlRoleForGroups(cfg, groups)
+	if role == SAMLOrgRoleNone {
+		return nil, status.Error(codes.PermissionDenied, "You are not in any group that may log in to the org. Please contact your org admin.")
+	}
+
+	orgInfo, err := s.env.OrgClient().GetOrg(ctx, utils.ProtoFromUUID(cfg.OrgID))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(ctx, userInfo)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	newUser := err != nil || user == nil
+	if newUser {
+		if _, err := s.createUser(ctx, userInfo, orgInfo.ID); err != nil {
+			return nil, err
+		}
+		if user, err = s.getUser(ctx, userInfo); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	update := &profilepb.UpdateUserRequest{ID: user.ID}
+	if utils.IsNilUUIDProto(user.OrgID) {
+		// The user was removed from the org, and joins it again.
+		update.OrgID = orgInfo.ID
+	} else if utils.UUIDFromProtoOrNil(user.OrgID) != cfg.OrgID {
+		return nil, status.Error(codes.PermissionDenied, "cannot join org - user already belongs to another org")
+	}
+	// Pending users are left for the org admins to approve, and keep their approval once they got it.
+	if role == SAMLOrgRoleMember && !user.IsApproved {
+		update.IsApproved = &types.BoolValue{Value: true}
+	}
+	if update.OrgID != nil || update.IsApproved != nil {
+		if _, err := s.env.ProfileClient().UpdateUser(ctx, update); err != nil {
+			return nil, err
+		}
+	}
+
+	tkn, err := s.completeUserLogin(ctx, userInfo, orgInfo)
+	if err != nil {
+		return nil, err
+	}
+	return loginReply(tkn, userInfo, orgInfo.OrgName, utils.ProtoToUUIDStr(orgInfo.ID), newUser), nil
+}
+
+// checkSAMLOrgAccess makes sure that SAML logins are enabled and the caller belongs to the org. It returns the ID
+// of the org and the email of the caller.
+func (s *Server) checkSAMLOrgAccess(ctx context.Context, orgIDPb *uuidpb.UUID) (uuid.UUID, string, error) {
+	if s.samlStore == nil {
+		return uuid.Nil, "", status.Error(codes.FailedPrecondition, "SAML logins are not enabled")
+	}
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return uuid.Nil, "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	claims := sCtx.Claims.GetUserClaims()
+	orgID := utils.UUIDFromProtoOrNil(orgIDPb)
+	if claims == nil || orgID == uuid.Nil || uuid.FromStringOrNil(claims.OrgID) != orgID {
+		return uuid.Nil, "", status.Error(codes.PermissionDenied, "cannot access the SAML config of the org")
+	}
+	return orgID, claims.Email, nil
+}
+
+func samlOrgRoleToProto(role SAMLOrgRole) authpb.SAMLOrgRole {
+	switch role {
+	case SAMLOrgRoleMember:
+		return authpb.SAML_ORG_ROLE_MEMBER
+	case SAMLOrgRolePendingApproval:
+		return authpb.SAML_ORG_ROLE_PENDING_APPROVAL
+	default:
+		return authpb.SAML_ORG_ROLE_NONE
+	}
+}
+
+func samlOrgRoleFromProto(role authpb.SAMLOrgRole) SAMLOrgRole {
+	switch role {
+	case authpb.SAML_ORG_ROLE_MEMBER:
+		return SAMLOrgRoleMember
+	case authpb.SAML_ORG_ROLE_PENDING_APPROVAL:
+		return SAMLOrgRolePendingApproval
+	default:
+		return SAMLOrgRoleNone
+	}
+}
+
+func samlConfigToProto(cfg *SAMLConfig) *authpb.OrgSAMLConfig {
+	pb := &authpb.OrgSAMLConfig{
+		OrgID:              utils.ProtoFromUUID(cfg.OrgID),
+		Enabled:            cfg.Enabled,
+		IdPEntityID:        cfg.IdPEntityID,
+		IdPSSOURL:          cfg.IdPSSOURL,
+		IdPCertificate:     cfg.IdPCertificate,
+		EmailAttribute:     cfg.EmailAttribute,
+		FirstNameAttribute: cfg.FirstNameAttribute,
+		LastNameAttribute:  cfg.LastNameAttribute,
+		GroupsAttribute:    cfg.GroupsAttribute,
+		GroupRoles:         make([]*authpb.OrgSAMLConfig_GroupRoleMapping, len(cfg.GroupRoles)),
+		DefaultRole:        samlOrgRoleToProto(cfg.DefaultRole),
+		UpdatedBy:          cfg.UpdatedBy,
+	}
+	for i, gr := range cfg.GroupRoles {
+		pb.GroupRoles[i] = &authpb.OrgSAMLConfig_GroupRoleMapping{Group: gr.Group, Role: samlOrgRoleToProto(gr.Role)}
+	}
+	pb.UpdatedAt, _ = types.TimestampProto(cfg.UpdatedAt)
+	return pb
+}
+
+// GetOrgSAMLConfig returns the SAML identity provider config of the caller's org.
+func (s *Server) GetOrgSAMLConfig(ctx context.Context, req *authpb.GetOrgSAMLConfigRequest) (*authpb.OrgSAMLConfig, error) {
+	orgID, _, err := s.checkSAMLOrgAccess(ctx, req.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.samlStore.GetSAMLConfig(ctx, orgID)
+	if err != nil {
+		log.WithError(err).Error("Failed to get SAML config")
+		return nil, status.Error(codes.Internal, "failed to get SAML config")
+	}
+	if cfg == nil {
+		return nil, status.Error(codes.NotFound, "the org has no SAML identity provider")
+	}
+	return samlConfigToProto(cfg), nil
+}
+
+// UpdateOrgSAMLConfig creates or replaces the SAML identity provider config of the caller's org.
+func (s *Server) UpdateOrgSAMLConfig(ctx context.Context, req *authpb.OrgSAMLConfig) (*authpb.OrgSAMLConfig, error) {
+	orgID, email, err := s.checkSAMLOrgAccess(ctx, req.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	if req.IdPEntityID == "" || req.IdPSSOURL == "" {
+		return nil, status.Error(codes.InvalidArgument, "the identity provider entity ID and SSO URL are required")
+	}
+	if _, err := parseSAMLCertificates(req.IdPCertificate); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	cfg := &SAMLConfig{
+		OrgID:              orgID,
+		Enabled:            req.Enabled,
+		IdPEntityID:        req.IdPEntityID,
+		IdPSSOURL:          req.IdPSSOURL,
+		IdPCertificate:     req.IdPCertificate,
+		EmailAttribute:     req.EmailAttribute,
+		FirstNameAttribute: req.FirstNameAttribute,
+		LastNameAttribute:  req.LastNameAttribute,
+		GroupsAttribute:    req.GroupsAttribute,
+		GroupRoles:         make([]SAMLGroupRole, len(req.GroupRoles)),
+		DefaultRole:        samlOrgRoleFromProto(req.DefaultRole),
+		UpdatedBy:          email,
+	}
+	for i, gr := range req.GroupRoles {
+		if gr.Group == "" {
+			return nil, status.Error(codes.InvalidArgument, "group role mappings must name a group")
+		}
+		cfg.GroupRoles[i] = SAMLGroupRole{Group: gr.Group, Role: samlOrgRoleFromProto(gr.Role)}
+	}
+	if len(cfg.GroupRoles) > 0 && cfg.GroupsAttribute == "" {
+		return nil, status.Error(codes.InvalidArgument, "group role mappings require the groups attribute")
+	}
+
+	updated, err := s.samlStore.UpsertSAMLConfig(ctx, cfg)
+	if err != nil {
+		log.WithError(err).Error("Failed to update SAML config")
+		return nil, status.Error(codes.Internal, "failed to update SAML config")
+	}
+	log.WithField("orgID", orgID).WithField("enabled", cfg.Enabled).WithField("user", email).Info("Updated SAML config")
+	return samlConfigToProto(updated), nil
+}
+
+// DeleteOrgSAMLConfig deletes the SAML identity provider config of the caller's org.
+func (s *Server) DeleteOrgSAMLConfig(ctx context.Context, req *authpb.DeleteOrgSAMLConfigRequest) (*types.Empty, error) {
+	orgID, email, err := s.checkSAMLOrgAccess(ctx, req.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.samlStore.DeleteSAMLConfig(ctx, orgID); err != nil {
+		log.WithError(err).Error("Failed to delete SAML config")
+		return nil, status.Error(codes.Internal, "failed to delete SAML config")
+	}
+	log.WithField("orgID", orgID).WithField("user", email).Info("Deleted SAML config")
+	return &types.Empty{}, nil
+}
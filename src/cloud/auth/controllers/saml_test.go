@@ -0,0 +1,450 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authenv"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/auth/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/auth/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	mock_profile "px.dev/pixie/src/cloud/profile/profilepb/mock"
+	"px.dev/pixie/src/shared/services/authcontext"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	samlOrgID     = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	samlUserID    = "7ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	samlIdPEntity = "http://www.okta.com/exk123"
+	samlBaseURL   = "https://work.withpixie.ai"
+	samlAuthPID   = "saml|" + samlOrgID + "|abc@corp.com"
+)
+
+var (
+	samlSPEntity = samlBaseURL + "/api/auth/saml/" + samlOrgID + "/metadata"
+	samlACSURL   = samlBaseURL + "/api/auth/saml/" + samlOrgID + "/acs"
+)
+
+type samlTestMocks struct {
+	profile *mock_profile.MockProfileServiceClient
+	org     *mock_profile.MockOrgServiceClient
+	store   *mock_controllers.MockSAMLConfigStore
+}
+
+func setupSAMLServer(t *testing.T, ctrl *gomock.Controller) (*controllers.Server, *samlTestMocks) {
+	m := &samlTestMocks{
+		profile: mock_profile.NewMockProfileServiceClient(ctrl),
+		org:     mock_profile.NewMockOrgServiceClient(ctrl),
+		store:   mock_controllers.NewMockSAMLConfigStore(ctrl),
+	}
+
+	viper.Set("jwt_signing_key", "jwtkey")
+	viper.Set("domain_name", "withpixie.ai")
+
+	env, err := authenv.New(m.profile, m.org)
+	require.NoError(t, err)
+	s, err := controllers.NewServer(env, mock_controllers.NewMockAuthProvider(ctrl), nil,
+		controllers.WithSAML(m.store, samlBaseURL+"/"))
+	require.NoError(t, err)
+	return s, m
+}
+
+// testIdP signs SAML responses like an identity provider would.
+type testIdP struct {
+	keyStore dsig.X509KeyStore
+	certPEM  string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	ks := dsig.RandomKeyStoreForTest()
+	_, cert, err := ks.GetKeyPair()
+	require.NoError(t, err)
+	return &testIdP{
+		keyStore: ks,
+		certPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})),
+	}
+}
+
+func (idp *testIdP) config(groupRoles ...controllers.SAMLGroupRole) *controllers.SAMLConfig {
+	return &controllers.SAMLConfig{
+		OrgID:              uuid.FromStringOrNil(samlOrgID),
+		Enabled:            true,
+		IdPEntityID:        samlIdPEntity,
+		IdPSSOURL:          "https://corp.okta.com/app/exk123/sso/saml",
+		IdPCertificate:     idp.certPEM,
+		EmailAttribute:     "email",
+		FirstNameAttribute: "firstName",
+		LastNameAttribute:  "lastName",
+		GroupsAttribute:    "groups",
+		GroupRoles:         groupRoles,
+	}
+}
+
+// response returns a base64 encoded SAML response for abc@corp.com, with a signed assertion for the given audience.
+func (idp *testIdP) response(t *testing.T, audience string, groups ...string) string {
+	now := time.Now().UTC()
+	ts := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+
+	var groupValues strings.Builder
+	for _, g := range groups {
+		fmt.Fprintf(&groupValues, `<saml:AttributeValue>%s</saml:AttributeValue>`, g)
+	}
+	assertion := fmt.Sprintf(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_assertion" Version="2.0" IssueInstant="%[1]s">`+
+		`<saml:Issuer>%[2]s</saml:Issuer>`+
+		`<saml:Subject><saml:NameID>abc@corp.com</saml:NameID>`+
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">`+
+		`<saml:SubjectConfirmationData NotOnOrAfter="%[3]s" Recipient="%[4]s"/></saml:SubjectConfirmation></saml:Subject>`+
+		`<saml:Conditions NotBefore="%[5]s" NotOnOrAfter="%[3]s"><saml:AudienceRestriction>`+
+		`<saml:Audience>%[6]s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`+
+		`<saml:AuthnStatement AuthnInstant="%[1]s"/>`+
+		`<saml:AttributeStatement>`+
+		`<saml:Attribute Name="email"><saml:AttributeValue>abc@corp.com</saml:AttributeValue></saml:Attribute>`+
+		`<saml:Attribute Name="firstName"><saml:AttributeValue>first</saml:AttributeValue></saml:Attribute>`+
+		`<saml:Attribute Name="lastName"><saml:AttributeValue>last</saml:AttributeValue></saml:Attribute>`+
+		`<saml:Attribute Name="groups">%[7]s</saml:Attribute>`+
+		`</saml:AttributeStatement></saml:Assertion>`,
+		ts(0), samlIdPEntity, ts(5*time.Minute), samlACSURL, ts(-5*time.Minute), audience, groupValues.String())
+
+	assertionDoc := etree.NewDocument()
+	require.NoError(t, assertionDoc.ReadFromString(assertion))
+	signer := dsig.NewDefaultSigningContext(idp.keyStore)
+	// Like real identity providers, sign with exclusive canonicalization so that embedding the assertion in the
+	// response doesn't change its digest.
+	signer.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := signer.SignEnveloped(assertionDoc.Root())
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(fmt.Sprintf(
+		`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" `+
+			`ID="_response" Version="2.0" IssueInstant="%s" Destination="%s">`+
+			`<saml:Issuer>%s</saml:Issuer>`+
+			`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>`+
+			`</samlp:Response>`, ts(0), samlACSURL, samlIdPEntity)))
+	doc.Root().AddChild(signed)
+	out, err := doc.WriteToString()
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString([]byte(out))
+}
+
+func TestServer_GetSAMLServiceProviderMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, _ := setupSAMLServer(t, ctrl)
+
+	resp, err := s.GetSAMLServiceProviderMetadata(context.Background(), &authpb.GetSAMLServiceProviderMetadataRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(samlOrgID),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, resp.Metadata, fmt.Sprintf(`entityID="%s"`, samlSPEntity))
+	assert.Contains(t, resp.Metadata, fmt.Sprintf(`Location="%s"`, samlACSURL))
+}
+
+func TestServer_GetSAMLAuthURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, m := setupSAMLServer(t, ctrl)
+	idp := newTestIdP(t)
+
+	m.store.EXPECT().GetSAMLConfig(gomock.Any(), uuid.FromStringOrNil(samlOrgID)).Return(idp.config(), nil)
+	resp, err := s.GetSAMLAuthURL(context.Background(), &authpb.GetSAMLAuthURLRequest{
+		OrgID:      utils.ProtoFromUUIDStrOrNil(samlOrgID),
+		RelayState: "/live",
+	})
+	require.NoError(t, err)
+	u, err := url.Parse(resp.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "corp.okta.com", u.Host)
+	assert.Equal(t, "/live", u.Query().Get("RelayState"))
+	assert.NotEmpty(t, u.Query().Get("SAMLRequest"))
+}
+
+func TestServer_GetSAMLAuthURL_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, m := setupSAMLServer(t, ctrl)
+
+	cfg := newTestIdP(t).config()
+	cfg.Enabled = false
+	m.store.EXPECT().GetSAMLConfig(gomock.Any(), uuid.FromStringOrNil(samlOrgID)).Return(cfg, nil)
+	_, err := s.GetSAMLAuthURL(context.Background(), &authpb.GetSAMLAuthURLRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(samlOrgID),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_LoginSAML_NewMember(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, m := setupSAMLServer(t, ctrl)
+	idp := newTestIdP(t)
+
+	orgPb := utils.ProtoFromUUIDStrOrNil(samlOrgID)
+	userPb := utils.ProtoFromUUIDStrOrNil(samlUserID)
+	m.store.EXPECT().GetSAMLConfig(gomock.Any(), uuid.FromStringOrNil(samlOrgID)).Return(idp.config(
+		controllers.SAMLGroupRole{Group: "contractors", Role: controllers.SAMLOrgRolePendingApproval},
+		controllers.SAMLGroupRole{Group: "eng", Role: controllers.SAMLOrgRoleMember},
+	), nil)
+	m.store.EXPECT().ConsumeSAMLAssertion(gomock.Any(), uuid.FromStringOrNil(samlOrgID), "_assertion", gomock.Any()).
+		Return(true, nil)
+	m.org.EXPECT().GetOrg(gomock.Any(), orgPb).
+		Return(&profilepb.OrgInfo{ID: orgPb, OrgName: "corp", EnableApprovals: true}, nil)
+	gomock.InOrder(
+		m.profile.EXPECT().
+			GetUserByAuthProviderID(gomock.Any(), &profilepb.GetUserByAuthProviderIDRequest{AuthProviderID: samlAuthPID}).
+			Return(nil, status.Error(codes.NotFound, "user not found")),
+		m.profile.EXPECT().CreateUser(gomock.Any(), &profilepb.CreateUserRequest{
+			OrgID:            orgPb,
+			FirstName:        "first",
+			LastName:         "last",
+			Email:            "abc@corp.com",
+			IdentityProvider: "saml",
+			AuthProviderID:   samlAuthPID,
+		}).Return(userPb, nil),
+		m.profile.EXPECT().
+			GetUserByAuthProviderID(gomock.Any(), &profilepb.GetUserByAuthProviderIDRequest{AuthProviderID: samlAuthPID}).
+			Return(&profilepb.UserInfo{ID: userPb, OrgID: orgPb}, nil),
+		m.profile.EXPECT().UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+			ID:         userPb,
+			IsApproved: &types.BoolValue{Value: true},
+		}).Return(nil, nil),
+		m.profile.EXPECT().
+			GetUserByAuthProviderID(gomock.Any(), &profilepb.GetUserByAuthProviderIDRequest{AuthProviderID: samlAuthPID}).
+			Return(&profilepb.UserInfo{ID: userPb, OrgID: orgPb, IsApproved: true}, nil),
+		m.profile.EXPECT().UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+			ID:             userPb,
+			DisplayPicture: &types.StringValue{},
+		}).Return(nil, nil),
+	)
+
+	resp, err := s.LoginSAML(context.Background(), &authpb.LoginSAMLRequest{
+		OrgID:        orgPb,
+		SAMLResponse: idp.response(t, samlSPEntity, "everyone", "eng"),
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.UserCreated)
+	assert.Equal(t, "saml", resp.IdentityProvider)
+	assert.Equal(t, samlOrgID, resp.OrgInfo.OrgID)
+	assert.Equal(t, "abc@corp.com", resp.UserInfo.Email)
+	verifyToken(t, resp.Token, samlUserID, samlOrgID, resp.ExpiresAt, "jwtkey")
+}
+
+func TestServer_LoginSAML_NoRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, m := setupSAMLServer(t, ctrl)
+	idp := newTestIdP(t)
+
+	m.store.EXPECT().GetSAMLConfig(gomock.Any(), uuid.FromStringOrNil(samlOrgID)).Return(idp.config(
+		controllers.SAMLGroupRole{Group: "eng", Role: controllers.SAMLOrgRoleMember},
+	), nil)
+	m.store.EXPECT().ConsumeSAMLAssertion(gomock.Any(), uuid.FromStringOrNil(samlOrgID), "_assertion", gomock.Any()).
+		Return(true, nil)
+
+	_, err := s.LoginSAML(context.Background(), &authpb.LoginSAMLRequest{
+		OrgID:        utils.ProtoFromUUIDStrOrNil(samlOrgID),
+		SAMLResponse: idp.response(t, samlSPEntity, "sales"),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_LoginSAML_InvalidAssertion(t *testing.T) {
+	idp := newTestIdP(t)
+	tests := []struct {
+		name     string
+		cert     string
+		response string
+	}{
+		{
+			name:     "wrong audience",
+			cert:     idp.certPEM,
+			response: idp.response(t, "https://someone.else/metadata", "eng"),
+		},
+		{
+			name:     "signed by another key",
+			cert:     newTestIdP(t).certPEM,
+			response: idp.response(t, samlSPEntity, "eng"),
+		},
+		{
+			name:     "not a SAML response",
+			cert:     idp.certPEM,
+			response: base64.StdEncoding.EncodeToString([]byte("<html></html>")),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s, m := setupSAMLServer(t, ctrl)
+
+			cfg := idp.config()
+			cfg.IdPCertificate = tc.cert
+			cfg.DefaultRole = controllers.SAMLOrgRoleMember
+			m.store.EXPECT().GetSAMLConfig(gomock.Any(), uuid.FromStringOrNil(samlOrgID)).Return(cfg, nil)
+
+			_, err := s.LoginSAML(context.Background(), &authpb.LoginSAMLRequest{
+				OrgID:        utils.ProtoFromUUIDStrOrNil(samlOrgID),
+				SAMLResponse: tc.response,
+			})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+}
+
+func TestServer_LoginSAML_ReplayedAssertion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, m := setupSAMLServer(t, ctrl)
+	idp := newTestIdP(t)
+
+	cfg := idp.config()
+	cfg.DefaultRole = controllers.SAMLOrgRoleMember
+	m.store.EXPECT().GetSAMLConfig(gomock.Any(), uuid.FromStringOrNil(samlOrgID)).Return(cfg, nil)
+	// The assertion expires when its conditions say, which is 5 minutes after it was issued.
+	m.store.EXPECT().ConsumeSAMLAssertion(gomock.Any(), uuid.FromStringOrNil(samlOrgID), "_assertion", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ uuid.UUID, _ string, expiresAt time.Time) (bool, error) {
+			assert.WithinDuration(t, time.Now().Add(5*time.Minute), expiresAt, time.Minute)
+			return false, nil
+		})
+
+	_, err := s.LoginSAML(context.Background(), &authpb.LoginSAMLRequest{
+		OrgID:        utils.ProtoFromUUIDStrOrNil(samlOrgID),
+		SAMLResponse: idp.response(t, samlSPEntity, "eng"),
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_LoginSAML_UserInOtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, m := setupSAMLServer(t, ctrl)
+	idp := newTestIdP(t)
+
+	orgPb := utils.ProtoFromUUIDStrOrNil(samlOrgID)
+	cfg := idp.config()
+	cfg.DefaultRole = controllers.SAMLOrgRolePendingApproval
+	m.store.EXPECT().GetSAMLConfig(gomock.Any(), uuid.FromStringOrNil(samlOrgID)).Return(cfg, nil)
+	m.store.EXPECT().ConsumeSAMLAssertion(gomock.Any(), uuid.FromStringOrNil(samlOrgID), "_assertion", gomock.Any()).
+		Return(true, nil)
+	m.org.EXPECT().GetOrg(gomock.Any(), orgPb).Return(&profilepb.OrgInfo{ID: orgPb, OrgName: "corp"}, nil)
+	m.profile.EXPECT().
+		GetUserByAuthProviderID(gomock.Any(), &profilepb.GetUserByAuthProviderIDRequest{AuthProviderID: samlAuthPID}).
+		Return(&profilepb.UserInfo{
+			ID:    utils.ProtoFromUUIDStrOrNil(samlUserID),
+			OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		}, nil)
+
+	_, err := s.LoginSAML(context.Background(), &authpb.LoginSAMLRequest{
+		OrgID:        orgPb,
+		SAMLResponse: idp.response(t, samlSPEntity),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func samlOrgUserContext(orgID string) context.Context {
+	sCtx := authcontext.New()
+	sCtx.Claims = srvutils.GenerateJWTForUser(samlUserID, orgID, "admin@corp.com", time.Now().Add(time.Hour), "withpixie.ai")
+	return authcontext.NewContext(context.Background(), sCtx)
+}
+
+func TestServer_UpdateOrgSAMLConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, m := setupSAMLServer(t, ctrl)
+	idp := newTestIdP(t)
+
+	m.store.EXPECT().UpsertSAMLConfig(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, cfg *controllers.SAMLConfig) (*controllers.SAMLConfig, error) {
+			assert.Equal(t, uuid.FromStringOrNil(samlOrgID), cfg.OrgID)
+			assert.Equal(t, "admin@corp.com", cfg.UpdatedBy)
+			assert.Equal(t, []controllers.SAMLGroupRole{{Group: "eng", Role: controllers.SAMLOrgRoleMember}}, cfg.GroupRoles)
+			assert.Equal(t, controllers.SAMLOrgRolePendingApproval, cfg.DefaultRole)
+			return cfg, nil
+		})
+
+	resp, err := s.UpdateOrgSAMLConfig(samlOrgUserContext(samlOrgID), &authpb.OrgSAMLConfig{
+		OrgID:           utils.ProtoFromUUIDStrOrNil(samlOrgID),
+		Enabled:         true,
+		IdPEntityID:     samlIdPEntity,
+		IdPSSOURL:       "https://corp.okta.com/app/exk123/sso/saml",
+		IdPCertificate:  idp.certPEM,
+		GroupsAttribute: "groups",
+		GroupRoles: []*authpb.OrgSAMLConfig_GroupRoleMapping{
+			{Group: "eng", Role: authpb.SAML_ORG_ROLE_MEMBER},
+		},
+		DefaultRole: authpb.SAML_ORG_ROLE_PENDING_APPROVAL,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, authpb.SAML_ORG_ROLE_PENDING_APPROVAL, resp.DefaultRole)
+	assert.Equal(t, "admin@corp.com", resp.UpdatedBy)
+}
+
+func TestServer_UpdateOrgSAMLConfig_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, _ := setupSAMLServer(t, ctrl)
+	idp := newTestIdP(t)
+
+	valid := func() *authpb.OrgSAMLConfig {
+		return &authpb.OrgSAMLConfig{
+			OrgID:          utils.ProtoFromUUIDStrOrNil(samlOrgID),
+			IdPEntityID:    samlIdPEntity,
+			IdPSSOURL:      "https://corp.okta.com/app/exk123/sso/saml",
+			IdPCertificate: idp.certPEM,
+		}
+	}
+
+	otherOrg := valid()
+	otherOrg.OrgID = utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	_, err := s.UpdateOrgSAMLConfig(samlOrgUserContext(samlOrgID), otherOrg)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	badCert := valid()
+	badCert.IdPCertificate = "not a cert"
+	_, err = s.UpdateOrgSAMLConfig(samlOrgUserContext(samlOrgID), badCert)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	noGroupsAttr := valid()
+	noGroupsAttr.GroupRoles = []*authpb.OrgSAMLConfig_GroupRoleMapping{{Group: "eng", Role: authpb.SAML_ORG_ROLE_MEMBER}}
+	_, err = s.UpdateOrgSAMLConfig(samlOrgUserContext(samlOrgID), noGroupsAttr)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -20,6 +20,9 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 
@@ -28,7 +31,38 @@ import (
 
 // APIKeyMgr is the internal interface for managing API keys.
 type APIKeyMgr interface {
-	FetchOrgUserIDUsingAPIKey(ctx context.Context, key string) (uuid.UUID, uuid.UUID, error)
+	// FetchAPIKeyUsingKey returns the unexpired key with the given value.
+	FetchAPIKeyUsingKey(ctx context.Context, key string) (*APIKey, error)
+}
+
+// APIKey is the owner and restrictions of an API key.
+type APIKey struct {
+	OrgID  uuid.UUID
+	UserID uuid.UUID
+	// Scopes restricts the calls that the key may make. The key is unrestricted if empty.
+	Scopes []string
+	// ClusterIDs restricts the clusters that the key may run scripts on.
+	ClusterIDs []uuid.UUID
+}
+
+// PersonalAccessTokenPrefix is the prefix of personal access tokens, which distinguishes them from API keys.
+const PersonalAccessTokenPrefix = "px-pat-"
+
+// PersonalAccessToken is a token that a user can use to access the Pixie API in place of an API key.
+type PersonalAccessToken struct {
+	ID        uuid.UUID
+	OrgID     uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// PersonalAccessTokenMgr is the internal interface for authenticating with personal access tokens.
+type PersonalAccessTokenMgr interface {
+	// UsePersonalAccessToken returns the unexpired token with the given value, and records that it was used by
+	// the client with the given IP.
+	UsePersonalAccessToken(ctx context.Context, token string, clientIP string) (*PersonalAccessToken, error)
 }
 
 // UserInfo contains all the info about a user. It's not tied to any specific AuthProvider.
@@ -73,18 +107,172 @@ type AuthProvider interface {
 	CreateIdentity(email string) (*CreateIdentityResponse, error)
 }
 
+// JITApprovalStatus is the state of a JITApprovalRequest.
+type JITApprovalStatus string
+
+const (
+	// JITApprovalPending is the status of requests that haven't been reviewed yet.
+	JITApprovalPending JITApprovalStatus = "pending"
+	// JITApprovalApproved is the status of requests that an admin approved.
+	JITApprovalApproved JITApprovalStatus = "approved"
+	// JITApprovalDenied is the status of requests that an admin denied.
+	JITApprovalDenied JITApprovalStatus = "denied"
+)
+
+// JITApprovalRequest is the request of an unknown user to join Pixie Cloud, queued for review by an admin.
+type JITApprovalRequest struct {
+	ID               uuid.UUID
+	AuthProviderID   string
+	Email            string
+	FirstName        string
+	LastName         string
+	IdentityProvider string
+	HostedDomain     string
+	Status           JITApprovalStatus
+	// OrgID is the org that the user joins once approved. If it is uuid.Nil, an org is created for the user.
+	OrgID      uuid.UUID
+	CreatedAt  time.Time
+	ReviewedAt time.Time
+	ReviewedBy string
+}
+
+// JITApprovalStore stores the requests of unknown users that are waiting for approval.
+type JITApprovalStore interface {
+	// CreateJITApprovalRequest creates a pending request for the user, or returns the existing request if
+	// there already is one.
+	CreateJITApprovalRequest(ctx context.Context, req *JITApprovalRequest) (*JITApprovalRequest, error)
+	// GetJITApprovalRequest returns the request of the user, or nil if the user has none.
+	GetJITApprovalRequest(ctx context.Context, authProviderID string) (*JITApprovalRequest, error)
+	// ListJITApprovalRequests lists the requests, oldest first.
+	ListJITApprovalRequests(ctx context.Context, pendingOnly bool) ([]*JITApprovalRequest, error)
+	// ReviewJITApprovalRequest records the decision of an admin on a request.
+	ReviewJITApprovalRequest(ctx context.Context, id uuid.UUID, approved bool, orgID uuid.UUID, reviewedBy string) (*JITApprovalRequest, error)
+}
+
+// JITNotifier notifies admins and users about JIT approval requests.
+type JITNotifier interface {
+	// NotifyJITApprovalRequested is called when a new request is queued for review.
+	NotifyJITApprovalRequested(ctx context.Context, req *JITApprovalRequest) error
+	// NotifyJITApprovalReviewed is called when an admin approves or denies a request.
+	NotifyJITApprovalReviewed(ctx context.Context, req *JITApprovalRequest) error
+}
+
+// SAMLOrgRole is the role in the org that a user gets from the groups of their SAML assertion.
+type SAMLOrgRole string
+
+const (
+	// SAMLOrgRoleNone means that the user has no role and can't log in.
+	SAMLOrgRoleNone SAMLOrgRole = ""
+	// SAMLOrgRoleMember lets the user join the org, approved to log in.
+	SAMLOrgRoleMember SAMLOrgRole = "member"
+	// SAMLOrgRolePendingApproval lets the user join the org, but they have to be approved by an org admin if
+	// the org requires approvals.
+	SAMLOrgRolePendingApproval SAMLOrgRole = "pending_approval"
+)
+
+// SAMLGroupRole maps the members of an identity provider group to a role in the org.
+type SAMLGroupRole struct {
+	Group string      `json:"group"`
+	Role  SAMLOrgRole `json:"role"`
+}
+
+// SAMLConfig is the config of the SAML identity provider of an org.
+type SAMLConfig struct {
+	OrgID          uuid.UUID
+	Enabled        bool
+	IdPEntityID    string
+	IdPSSOURL      string
+	IdPCertificate string
+
+	EmailAttribute     string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	GroupsAttribute    string
+	// GroupRoles are checked in order, and the user gets the role of the first group they're a member of.
+	GroupRoles  []SAMLGroupRole
+	DefaultRole SAMLOrgRole
+
+	UpdatedAt time.Time
+	UpdatedBy string
+}
+
+// SAMLConfigStore stores the SAML identity provider configs of the orgs.
+type SAMLConfigStore interface {
+	// GetSAMLConfig returns the config of the org, or nil if the org has none.
+	GetSAMLConfig(ctx context.Context, orgID uuid.UUID) (*SAMLConfig, error)
+	// UpsertSAMLConfig creates or replaces the config of the org.
+	UpsertSAMLConfig(ctx context.Context, cfg *SAMLConfig) (*SAMLConfig, error)
+	// DeleteSAMLConfig deletes the config of the org, if it has one.
+	DeleteSAMLConfig(ctx context.Context, orgID uuid.UUID) error
+	// ConsumeSAMLAssertion records that the assertion was used to log in, until it expires. It returns false
+	// if the assertion was already used.
+	ConsumeSAMLAssertion(ctx context.Context, orgID uuid.UUID, assertionID string, expiresAt time.Time) (bool, error)
+}
+
 // Server defines an gRPC server type.
 type Server struct {
 	env       authenv.AuthEnv
 	a         AuthProvider
 	apiKeyMgr APIKeyMgr
+
+	jitPolicy   JITOrgPolicy
+	jitStore    JITApprovalStore
+	jitNotifier JITNotifier
+	jitAdmins   map[string]bool
+
+	samlStore   SAMLConfigStore
+	samlBaseURL string
+
+	patMgr PersonalAccessTokenMgr
+}
+
+// ServerOption configures the Server.
+type ServerOption func(s *Server)
+
+// WithJITOrgPolicy sets the policy for users that authenticate without an account, invite or matching org.
+// The store and notifier are only used by the approval policy, and admins are the emails of the users that
+// may review approval requests.
+func WithJITOrgPolicy(policy JITOrgPolicy, store JITApprovalStore, notifier JITNotifier, admins []string) ServerOption {
+	return func(s *Server) {
+		s.jitPolicy = policy
+		s.jitStore = store
+		s.jitNotifier = notifier
+		s.jitAdmins = make(map[string]bool)
+		for _, admin := range admins {
+			s.jitAdmins[admin] = true
+		}
+	}
+}
+
+// WithSAML enables logins through the SAML identity providers of the orgs. baseURL is the URL of Pixie Cloud that
+// the service provider endpoints of the orgs are served under.
+func WithSAML(store SAMLConfigStore, baseURL string) ServerOption {
+	return func(s *Server) {
+		s.samlStore = store
+		s.samlBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithPersonalAccessTokens lets users authenticate with their personal access tokens in place of API keys.
+func WithPersonalAccessTokens(mgr PersonalAccessTokenMgr) ServerOption {
+	return func(s *Server) {
+		s.patMgr = mgr
+	}
 }
 
 // NewServer creates GRPC handlers.
-func NewServer(env authenv.AuthEnv, a AuthProvider, apiKeyMgr APIKeyMgr) (*Server, error) {
-	return &Server{
+func NewServer(env authenv.AuthEnv, a AuthProvider, apiKeyMgr APIKeyMgr, opts ...ServerOption) (*Server, error) {
+	s := &Server{
 		env:       env,
 		a:         a,
 		apiKeyMgr: apiKeyMgr,
-	}, nil
+		jitPolicy: JITOrgPolicyAllow,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.jitPolicy == JITOrgPolicyApproval && s.jitStore == nil {
+		return nil, errors.New("the approval JIT org policy requires an approval store")
+	}
+	return s, nil
 }
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package jitapproval
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/controllers"
+)
+
+// Store keeps the JIT approval requests in postgres.
+type Store struct {
+	db *sqlx.DB
+}
+
+// New creates a new Store.
+func New(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+type requestRow struct {
+	ID               uuid.UUID      `db:"id"`
+	AuthProviderID   string         `db:"auth_provider_id"`
+	Email            string         `db:"email"`
+	FirstName        sql.NullString `db:"first_name"`
+	LastName         sql.NullString `db:"last_name"`
+	IdentityProvider sql.NullString `db:"identity_provider"`
+	HostedDomain     sql.NullString `db:"hosted_domain"`
+	Status           string         `db:"status"`
+	OrgID            uuid.NullUUID  `db:"org_id"`
+	CreatedAt        time.Time      `db:"created_at"`
+	ReviewedAt       sql.NullTime   `db:"reviewed_at"`
+	ReviewedBy       sql.NullString `db:"reviewed_by"`
+}
+
+func (r *requestRow) toRequest() *controllers.JITApprovalRequest {
+	return &controllers.JITApprovalRequest{
+		ID:               r.ID,
+		AuthProviderID:   r.AuthProviderID,
+		Email:            r.Email,
+		FirstName:        r.FirstName.String,
+		LastName:         r.LastName.String,
+		IdentityProvider: r.IdentityProvider.String,
+		HostedDomain:     r.HostedDomain.String,
+		Status:           controllers.JITApprovalStatus(r.Status),
+		OrgID:            r.OrgID.UUID,
+		CreatedAt:        r.CreatedAt,
+		ReviewedAt:       r.ReviewedAt.Time,
+		ReviewedBy:       r.ReviewedBy.String,
+	}
+}
+
+const requestColumns = `id, auth_provider_id, email, first_name, last_name, identity_provider, hosted_domain,
+                status, org_id, created_at, reviewed_at, reviewed_by`
+
+// CreateJITApprovalRequest creates a pending request for the user, or returns their existing request.
+func (s *Store) CreateJITApprovalRequest(ctx context.Context, req *controllers.JITApprovalRequest) (*controllers.JITApprovalRequest, error) {
+	// The no-op update makes the query return the existing row when the user already has a request.
+	query := `INSERT INTO jit_approval_requests(auth_provider_id, email, first_name, last_name, identity_provider, hosted_domain)
+                VALUES($1, $2, $3, $4, $5, $6)
+                ON CONFLICT (auth_provider_id) DO UPDATE SET auth_provider_id=EXCLUDED.auth_provider_id
+                RETURNING ` + requestColumns
+	var row requestRow
+	err := s.db.QueryRowxContext(ctx, query, req.AuthProviderID, req.Email, req.FirstName, req.LastName,
+		req.IdentityProvider, req.HostedDomain).StructScan(&row)
+	if err != nil {
+		return nil, err
+	}
+	return row.toRequest(), nil
+}
+
+// GetJITApprovalRequest returns the request of the user, or nil if they have none.
+func (s *Store) GetJITApprovalRequest(ctx context.Context, authProviderID string) (*controllers.JITApprovalRequest, error) {
+	query := `SELECT ` + requestColumns + ` FROM jit_approval_requests WHERE auth_provider_id=$1`
+	var row requestRow
+	err := s.db.QueryRowxContext(ctx, query, authProviderID).StructScan(&row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toRequest(), nil
+}
+
+// ListJITApprovalRequests lists the requests, oldest first.
+func (s *Store) ListJITApprovalRequests(ctx context.Context, pendingOnly bool) ([]*controllers.JITApprovalRequest, error) {
+	query := `SELECT ` + requestColumns + ` FROM jit_approval_requests
+                WHERE NOT $1 OR status=$2
+                ORDER BY created_at`
+	rows, err := s.db.QueryxContext(ctx, query, pendingOnly, controllers.JITApprovalPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []*controllers.JITApprovalRequest
+	for rows.Next() {
+		var row requestRow
+		if err := rows.StructScan(&row); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, row.toRequest())
+	}
+	return reqs, rows.Err()
+}
+
+// ReviewJITApprovalRequest records the decision of an admin on a request.
+func (s *Store) ReviewJITApprovalRequest(ctx context.Context, id uuid.UUID, approved bool, orgID uuid.UUID, reviewedBy string) (*controllers.JITApprovalRequest, error) {
+	reqStatus := controllers.JITApprovalDenied
+	if approved {
+		reqStatus = controllers.JITApprovalApproved
+	}
+	query := `UPDATE jit_approval_requests
+                SET status=$2, org_id=$3, reviewed_at=NOW(), reviewed_by=$4
+                WHERE id=$1
+                RETURNING ` + requestColumns
+	var row requestRow
+	err := s.db.QueryRowxContext(ctx, query, id, reqStatus, uuid.NullUUID{UUID: orgID, Valid: orgID != uuid.Nil}, reviewedBy).StructScan(&row)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "no such approval request")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toRequest(), nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package jitapproval_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/controllers"
+	"px.dev/pixie/src/cloud/auth/jitapproval"
+	"px.dev/pixie/src/cloud/auth/schema"
+	"px.dev/pixie/src/shared/services/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+var db *sqlx.DB
+
+func testMain(m *testing.M) error {
+	s := bindata.Resource(schema.AssetNames(), schema.Asset)
+	testDB, teardown, err := pgtest.SetupTestDB(s)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+func TestStore_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := jitapproval.New(db)
+
+	req, err := s.GetJITApprovalRequest(ctx, "github|abc")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	req, err = s.CreateJITApprovalRequest(ctx, &controllers.JITApprovalRequest{
+		AuthProviderID: "github|abc",
+		Email:          "abc@gmail.com",
+		FirstName:      "first",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, controllers.JITApprovalPending, req.Status)
+	assert.Equal(t, "abc@gmail.com", req.Email)
+	assert.Equal(t, uuid.Nil, req.OrgID)
+	assert.True(t, req.ReviewedAt.IsZero())
+
+	// Creating the request again returns the existing one.
+	again, err := s.CreateJITApprovalRequest(ctx, &controllers.JITApprovalRequest{
+		AuthProviderID: "github|abc",
+		Email:          "abc@gmail.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, req.ID, again.ID)
+
+	_, err = s.CreateJITApprovalRequest(ctx, &controllers.JITApprovalRequest{
+		AuthProviderID: "github|def",
+		Email:          "def@gmail.com",
+	})
+	require.NoError(t, err)
+
+	reqs, err := s.ListJITApprovalRequests(ctx, true)
+	require.NoError(t, err)
+	assert.Len(t, reqs, 2)
+
+	orgID := uuid.Must(uuid.NewV4())
+	reviewed, err := s.ReviewJITApprovalRequest(ctx, req.ID, true, orgID, "admin@pixie.dev")
+	require.NoError(t, err)
+	assert.Equal(t, controllers.JITApprovalApproved, reviewed.Status)
+	assert.Equal(t, orgID, reviewed.OrgID)
+	assert.Equal(t, "admin@pixie.dev", reviewed.ReviewedBy)
+	assert.False(t, reviewed.ReviewedAt.IsZero())
+
+	reqs, err = s.ListJITApprovalRequests(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, reqs, 1)
+	assert.Equal(t, "def@gmail.com", reqs[0].Email)
+
+	reqs, err = s.ListJITApprovalRequests(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, reqs, 2)
+
+	fetched, err := s.GetJITApprovalRequest(ctx, "github|abc")
+	require.NoError(t, err)
+	assert.Equal(t, controllers.JITApprovalApproved, fetched.Status)
+
+	_, err = s.ReviewJITApprovalRequest(ctx, uuid.Must(uuid.NewV4()), false, uuid.Nil, "admin@pixie.dev")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
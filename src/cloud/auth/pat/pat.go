@@ -0,0 +1,307 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pat
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/jackc/pgx"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/auth/controllers"
+	"px.dev/pixie/src/cloud/shared/patscope"
+	"px.dev/pixie/src/shared/services/authcontext"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+var (
+	// ErrTokenNotFound is used when the token doesn't exist or has expired.
+	ErrTokenNotFound = errors.New("invalid personal access token")
+)
+
+const (
+	// Code for `unique_violation`.
+	uniqueViolation = "23505"
+	// maxNameLength is the maximum length of the name of a token.
+	maxNameLength = 255
+)
+
+// Service is used to provision and manage personal access tokens.
+type Service struct {
+	db          *sqlx.DB
+	maxLifetime time.Duration
+}
+
+// New creates a new Service. Tokens can't be created to live longer than maxLifetime.
+func New(db *sqlx.DB, maxLifetime time.Duration) *Service {
+	return &Service{
+		db:          db,
+		maxLifetime: maxLifetime,
+	}
+}
+
+type tokenRow struct {
+	ID         uuid.UUID      `db:"id"`
+	OrgID      uuid.UUID      `db:"org_id"`
+	UserID     uuid.UUID      `db:"user_id"`
+	Name       string         `db:"name"`
+	Scopes     []byte         `db:"scopes"`
+	CreatedAt  time.Time      `db:"created_at"`
+	ExpiresAt  time.Time      `db:"expires_at"`
+	LastUsedAt sql.NullTime   `db:"last_used_at"`
+	LastUsedIP sql.NullString `db:"last_used_ip"`
+}
+
+func (r *tokenRow) toProto() (*authpb.PersonalAccessToken, error) {
+	t := &authpb.PersonalAccessToken{
+		ID:         utils.ProtoFromUUID(r.ID),
+		OrgID:      utils.ProtoFromUUID(r.OrgID),
+		UserID:     utils.ProtoFromUUID(r.UserID),
+		Name:       r.Name,
+		LastUsedIP: r.LastUsedIP.String,
+	}
+	if err := json.Unmarshal(r.Scopes, &t.Scopes); err != nil {
+		return nil, err
+	}
+	t.CreatedAt, _ = types.TimestampProto(r.CreatedAt)
+	t.ExpiresAt, _ = types.TimestampProto(r.ExpiresAt)
+	if r.LastUsedAt.Valid {
+		t.LastUsedAt, _ = types.TimestampProto(r.LastUsedAt.Time)
+	}
+	return t, nil
+}
+
+const tokenColumns = `id, org_id, user_id, name, scopes, created_at, expires_at, last_used_at, last_used_ip`
+
+func hashToken(token string) []byte {
+	h := sha256.Sum256([]byte(token))
+	return h[:]
+}
+
+// userClaims returns the claims of the user that makes the request. Tokens can only be managed by users that
+// logged in themselves, and not by API keys or other tokens.
+func userClaims(ctx context.Context) (*authcontext.AuthContext, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	userClaims := sCtx.Claims.GetUserClaims()
+	if userClaims == nil || userClaims.IsAPIUser || patscope.IsPersonalAccessToken(sCtx.Claims.Scopes) {
+		return nil, status.Error(codes.PermissionDenied, "personal access tokens can only be managed by users")
+	}
+	return sCtx, nil
+}
+
+// Create a token with the user as the owner.
+func (s *Service) Create(ctx context.Context, req *authpb.CreatePersonalAccessTokenRequest) (*authpb.PersonalAccessToken, error) {
+	sCtx, err := userClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name == "" || len(req.Name) > maxNameLength {
+		return nil, status.Errorf(codes.InvalidArgument, "name must be between 1 and %d characters", maxNameLength)
+	}
+	if err := patscope.Validate(req.Scopes); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.ExpiresAt == nil {
+		return nil, status.Error(codes.InvalidArgument, "expires_at is required")
+	}
+	expiresAt, err := types.TimestampFromProto(req.ExpiresAt)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid expires_at")
+	}
+	now := time.Now()
+	if !expiresAt.After(now) {
+		return nil, status.Error(codes.InvalidArgument, "expires_at must be in the future")
+	}
+	if expiresAt.After(now.Add(s.maxLifetime)) {
+		return nil, status.Errorf(codes.InvalidArgument, "tokens can't live longer than %s", s.maxLifetime)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate token")
+	}
+	token := controllers.PersonalAccessTokenPrefix + hex.EncodeToString(b)
+
+	scopes, err := json.Marshal(req.Scopes)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create token")
+	}
+
+	query := `INSERT INTO personal_access_tokens(org_id, user_id, name, hashed_token, scopes, expires_at)
+                VALUES($1, $2, $3, $4, $5, $6)
+                RETURNING ` + tokenColumns
+	var row tokenRow
+	err = s.db.QueryRowxContext(ctx, query,
+		sCtx.Claims.GetUserClaims().OrgID,
+		sCtx.Claims.GetUserClaims().UserID,
+		req.Name,
+		hashToken(token),
+		scopes,
+		expiresAt.UTC()).
+		StructScan(&row)
+	if err != nil {
+		if e, ok := err.(pgx.PgError); ok && e.Code == uniqueViolation {
+			return nil, status.Error(codes.AlreadyExists, "a token with this name already exists")
+		}
+		log.WithError(err).Error("Failed to insert personal access token")
+		return nil, status.Error(codes.Internal, "failed to create token")
+	}
+
+	resp, err := row.toProto()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to read token")
+	}
+	resp.Token = token
+	return resp, nil
+}
+
+// List returns all the tokens of the user, including the expired ones.
+func (s *Service) List(ctx context.Context, req *authpb.ListPersonalAccessTokensRequest) (*authpb.ListPersonalAccessTokensResponse, error) {
+	sCtx, err := userClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + tokenColumns + ` FROM personal_access_tokens WHERE user_id=$1 ORDER BY created_at`
+	rows, err := s.db.QueryxContext(ctx, query, sCtx.Claims.GetUserClaims().UserID)
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch personal access tokens")
+		return nil, status.Error(codes.Internal, "failed to fetch tokens")
+	}
+	defer rows.Close()
+
+	resp := &authpb.ListPersonalAccessTokensResponse{}
+	for rows.Next() {
+		var row tokenRow
+		if err := rows.StructScan(&row); err != nil {
+			log.WithError(err).Error("Failed to read data from postgres")
+			return nil, status.Error(codes.Internal, "failed to read data")
+		}
+		t, err := row.toProto()
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read data")
+		}
+		resp.Tokens = append(resp.Tokens, t)
+	}
+	return resp, nil
+}
+
+// Delete revokes the token of the user.
+func (s *Service) Delete(ctx context.Context, req *uuidpb.UUID) (*types.Empty, error) {
+	sCtx, err := userClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tokenID, err := utils.UUIDFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid id format")
+	}
+
+	query := `DELETE FROM personal_access_tokens WHERE user_id=$1 AND id=$2`
+	res, err := s.db.ExecContext(ctx, query, sCtx.Claims.GetUserClaims().UserID, tokenID)
+	if err != nil {
+		log.WithError(err).Error("Failed to delete personal access token")
+		return nil, status.Error(codes.Internal, "failed to delete token")
+	}
+	c, err := res.RowsAffected()
+	if err != nil {
+		log.WithError(err).Error("Failed to delete personal access token")
+		return nil, status.Error(codes.Internal, "failed to delete token")
+	}
+	if c == 0 {
+		return nil, status.Error(codes.NotFound, "no such token to delete")
+	}
+	return &types.Empty{}, nil
+}
+
+// DeleteAllForUser revokes all tokens of the user. Only services may revoke the tokens of other users.
+func (s *Service) DeleteAllForUser(ctx context.Context, req *authpb.DeleteAllPersonalAccessTokensRequest) (*authpb.DeleteAllPersonalAccessTokensResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if srvutils.GetClaimsType(sCtx.Claims) != srvutils.ServiceClaimType {
+		return nil, status.Error(codes.PermissionDenied, "only services may revoke the tokens of a user")
+	}
+	userID := utils.UUIDFromProtoOrNil(req.UserID)
+	if userID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user id")
+	}
+
+	query := `DELETE FROM personal_access_tokens WHERE user_id=$1`
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		log.WithError(err).Error("Failed to delete personal access tokens")
+		return nil, status.Error(codes.Internal, "failed to delete tokens")
+	}
+	c, err := res.RowsAffected()
+	if err != nil {
+		log.WithError(err).Error("Failed to delete personal access tokens")
+		return nil, status.Error(codes.Internal, "failed to delete tokens")
+	}
+	return &authpb.DeleteAllPersonalAccessTokensResponse{NumTokens: c}, nil
+}
+
+// UsePersonalAccessToken returns the unexpired token with the given value, and records that it was used by the
+// client with the given IP.
+func (s *Service) UsePersonalAccessToken(ctx context.Context, token string, clientIP string) (*controllers.PersonalAccessToken, error) {
+	query := `UPDATE personal_access_tokens SET last_used_at=NOW(), last_used_ip=$2
+                WHERE hashed_token=$1 AND expires_at > NOW()
+                RETURNING ` + tokenColumns
+	var row tokenRow
+	err := s.db.QueryRowxContext(ctx, query, hashToken(token), sql.NullString{String: clientIP, Valid: clientIP != ""}).
+		StructScan(&row)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := &controllers.PersonalAccessToken{
+		ID:        row.ID,
+		OrgID:     row.OrgID,
+		UserID:    row.UserID,
+		Name:      row.Name,
+		ExpiresAt: row.ExpiresAt,
+	}
+	if err := json.Unmarshal(row.Scopes, &t.Scopes); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/auth/schema"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/pgtest"
+	jwtutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+var (
+	testOrgID       = uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")
+	testUserID      = uuid.FromStringOrNil("423e4567-e89b-12d3-a456-426655440000")
+	testOtherUserID = uuid.FromStringOrNil("003e4567-e89b-12d3-a456-426655440000")
+
+	testToken1ID = uuid.FromStringOrNil("883e4567-e89b-12d3-a456-426655440000")
+	testToken2ID = uuid.FromStringOrNil("993e4567-e89b-12d3-a456-426655440000")
+	testToken3ID = uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+)
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+var db *sqlx.DB
+
+func testMain(m *testing.M) error {
+	s := bindata.Resource(schema.AssetNames(), schema.Asset)
+	testDB, teardown, err := pgtest.SetupTestDB(s)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+func createTestContext() context.Context {
+	sCtx := authcontext.New()
+	sCtx.Claims = jwtutils.GenerateJWTForUser(testUserID.String(), testOrgID.String(), "test@test.com", time.Now(), "pixie")
+	return authcontext.NewContext(context.Background(), sCtx)
+}
+
+func mustLoadTestData(db *sqlx.DB) {
+	db.MustExec(`DELETE from personal_access_tokens`)
+
+	insertToken := `INSERT INTO personal_access_tokens(id, org_id, user_id, name, hashed_token, scopes, created_at, expires_at)
+                      VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	now := time.Now().UTC()
+	db.MustExec(insertToken, testToken1ID, testOrgID, testUserID, "laptop", hashToken("px-pat-token1"), `["cloud:read"]`,
+		now.Add(-2*time.Hour), now.Add(time.Hour))
+	db.MustExec(insertToken, testToken2ID, testOrgID, testUserID, "expired", hashToken("px-pat-token2"), `["cloud:write"]`,
+		now.Add(-time.Hour), now.Add(-time.Minute))
+	db.MustExec(insertToken, testToken3ID, testOrgID, testOtherUserID, "laptop", hashToken("px-pat-token3"), `["vizier:exec"]`,
+		now.Add(-time.Hour), now.Add(time.Hour))
+}
+
+func TestService_Create(t *testing.T) {
+	mustLoadTestData(db)
+	svc := New(db, 24*time.Hour)
+
+	expiresAt, _ := types.TimestampProto(time.Now().Add(time.Hour))
+	resp, err := svc.Create(createTestContext(), &authpb.CreatePersonalAccessTokenRequest{
+		Name:      "scripts",
+		Scopes:    []string{"cloud:read", "vizier:exec"},
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resp.Token, "px-pat-"))
+	assert.Equal(t, "scripts", resp.Name)
+	assert.Equal(t, []string{"cloud:read", "vizier:exec"}, resp.Scopes)
+	assert.Equal(t, testUserID, utils.UUIDFromProtoOrNil(resp.UserID))
+	assert.Equal(t, testOrgID, utils.UUIDFromProtoOrNil(resp.OrgID))
+	assert.Nil(t, resp.LastUsedAt)
+
+	// The new token can be used right away.
+	pat, err := svc.UsePersonalAccessToken(context.Background(), resp.Token, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, utils.UUIDFromProtoOrNil(resp.ID), pat.ID)
+}
+
+func TestService_Create_Invalid(t *testing.T) {
+	mustLoadTestData(db)
+	svc := New(db, 24*time.Hour)
+
+	ts := func(d time.Duration) *types.Timestamp {
+		p, _ := types.TimestampProto(time.Now().Add(d))
+		return p
+	}
+	apiUserCtx := authcontext.New()
+	apiUserCtx.Claims = jwtutils.GenerateJWTForAPIUser(testUserID.String(), testOrgID.String(), time.Now(), "pixie")
+	patCtx := authcontext.New()
+	patCtx.Claims = jwtutils.GenerateJWTForUser(testUserID.String(), testOrgID.String(), "test@test.com", time.Now(), "pixie")
+	patCtx.Claims.Scopes = append(patCtx.Claims.Scopes, "pat", "cloud:write")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  *authpb.CreatePersonalAccessTokenRequest
+		code codes.Code
+	}{
+		{
+			name: "duplicate name",
+			ctx:  createTestContext(),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Name: "laptop", Scopes: []string{"cloud:read"}, ExpiresAt: ts(time.Hour)},
+			code: codes.AlreadyExists,
+		},
+		{
+			name: "missing name",
+			ctx:  createTestContext(),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Scopes: []string{"cloud:read"}, ExpiresAt: ts(time.Hour)},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "unknown scope",
+			ctx:  createTestContext(),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Name: "a", Scopes: []string{"admin"}, ExpiresAt: ts(time.Hour)},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "no expiry",
+			ctx:  createTestContext(),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Name: "a", Scopes: []string{"cloud:read"}},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "expiry in the past",
+			ctx:  createTestContext(),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Name: "a", Scopes: []string{"cloud:read"}, ExpiresAt: ts(-time.Hour)},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "expiry beyond max lifetime",
+			ctx:  createTestContext(),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Name: "a", Scopes: []string{"cloud:read"}, ExpiresAt: ts(48 * time.Hour)},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "api user",
+			ctx:  authcontext.NewContext(context.Background(), apiUserCtx),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Name: "a", Scopes: []string{"cloud:read"}, ExpiresAt: ts(time.Hour)},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "personal access token",
+			ctx:  authcontext.NewContext(context.Background(), patCtx),
+			req:  &authpb.CreatePersonalAccessTokenRequest{Name: "a", Scopes: []string{"cloud:read"}, ExpiresAt: ts(time.Hour)},
+			code: codes.PermissionDenied,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.Create(test.ctx, test.req)
+			assert.Equal(t, test.code, status.Code(err))
+		})
+	}
+}
+
+func TestService_List(t *testing.T) {
+	mustLoadTestData(db)
+	svc := New(db, 24*time.Hour)
+
+	resp, err := svc.List(createTestContext(), &authpb.ListPersonalAccessTokensRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Tokens))
+	assert.Equal(t, testToken1ID, utils.UUIDFromProtoOrNil(resp.Tokens[0].ID))
+	assert.Equal(t, "laptop", resp.Tokens[0].Name)
+	assert.Equal(t, []string{"cloud:read"}, resp.Tokens[0].Scopes)
+	assert.Empty(t, resp.Tokens[0].Token)
+	assert.Equal(t, testToken2ID, utils.UUIDFromProtoOrNil(resp.Tokens[1].ID))
+}
+
+func TestService_Delete(t *testing.T) {
+	mustLoadTestData(db)
+	svc := New(db, 24*time.Hour)
+
+	_, err := svc.Delete(createTestContext(), utils.ProtoFromUUID(testToken1ID))
+	require.NoError(t, err)
+	_, err = svc.UsePersonalAccessToken(context.Background(), "px-pat-token1", "")
+	assert.Equal(t, ErrTokenNotFound, err)
+
+	// Tokens of other users can't be deleted.
+	_, err = svc.Delete(createTestContext(), utils.ProtoFromUUID(testToken3ID))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestService_UsePersonalAccessToken(t *testing.T) {
+	mustLoadTestData(db)
+	svc := New(db, 24*time.Hour)
+
+	pat, err := svc.UsePersonalAccessToken(context.Background(), "px-pat-token1", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, testToken1ID, pat.ID)
+	assert.Equal(t, testUserID, pat.UserID)
+	assert.Equal(t, testOrgID, pat.OrgID)
+	assert.Equal(t, []string{"cloud:read"}, pat.Scopes)
+
+	resp, err := svc.List(createTestContext(), &authpb.ListPersonalAccessTokensRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", resp.Tokens[0].LastUsedIP)
+	require.NotNil(t, resp.Tokens[0].LastUsedAt)
+	lastUsedAt, err := types.TimestampFromProto(resp.Tokens[0].LastUsedAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), lastUsedAt, 10*time.Second)
+
+	_, err = svc.UsePersonalAccessToken(context.Background(), "px-pat-token2", "10.0.0.1")
+	assert.Equal(t, ErrTokenNotFound, err)
+	_, err = svc.UsePersonalAccessToken(context.Background(), "px-pat-unknown", "10.0.0.1")
+	assert.Equal(t, ErrTokenNotFound, err)
+}
+
+func TestService_DeleteAllForUser(t *testing.T) {
+	mustLoadTestData(db)
+	svc := New(db, 24*time.Hour)
+
+	sCtx := authcontext.New()
+	sCtx.Claims = jwtutils.GenerateJWTForService("ProfileService", "pixie")
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+
+	resp, err := svc.DeleteAllForUser(ctx, &authpb.DeleteAllPersonalAccessTokensRequest{
+		UserID: utils.ProtoFromUUID(testUserID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), resp.NumTokens)
+
+	_, err = svc.UsePersonalAccessToken(context.Background(), "px-pat-token1", "")
+	assert.Equal(t, ErrTokenNotFound, err)
+	// Tokens of other users are kept.
+	_, err = svc.UsePersonalAccessToken(context.Background(), "px-pat-token3", "")
+	require.NoError(t, err)
+
+	// Users may not revoke tokens through this endpoint.
+	_, err = svc.DeleteAllForUser(createTestContext(), &authpb.DeleteAllPersonalAccessTokensRequest{
+		UserID: utils.ProtoFromUUID(testOtherUserID),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package samlconfig
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"px.dev/pixie/src/cloud/auth/controllers"
+)
+
+// Store keeps the SAML identity provider configs in postgres.
+type Store struct {
+	db *sqlx.DB
+}
+
+// New creates a new Store.
+func New(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+type configRow struct {
+	OrgID              uuid.UUID      `db:"org_id"`
+	Enabled            bool           `db:"enabled"`
+	IdPEntityID        string         `db:"idp_entity_id"`
+	IdPSSOURL          string         `db:"idp_sso_url"`
+	IdPCertificate     string         `db:"idp_certificate"`
+	EmailAttribute     sql.NullString `db:"email_attribute"`
+	FirstNameAttribute sql.NullString `db:"first_name_attribute"`
+	LastNameAttribute  sql.NullString `db:"last_name_attribute"`
+	GroupsAttribute    sql.NullString `db:"groups_attribute"`
+	GroupRoles         []byte         `db:"group_roles"`
+	DefaultRole        string         `db:"default_role"`
+	UpdatedAt          time.Time      `db:"updated_at"`
+	UpdatedBy          sql.NullString `db:"updated_by"`
+}
+
+func (r *configRow) toConfig() (*controllers.SAMLConfig, error) {
+	cfg := &controllers.SAMLConfig{
+		OrgID:              r.OrgID,
+		Enabled:            r.Enabled,
+		IdPEntityID:        r.IdPEntityID,
+		IdPSSOURL:          r.IdPSSOURL,
+		IdPCertificate:     r.IdPCertificate,
+		EmailAttribute:     r.EmailAttribute.String,
+		FirstNameAttribute: r.FirstNameAttribute.String,
+		LastNameAttribute:  r.LastNameAttribute.String,
+		GroupsAttribute:    r.GroupsAttribute.String,
+		DefaultRole:        controllers.SAMLOrgRole(r.DefaultRole),
+		UpdatedAt:          r.UpdatedAt,
+		UpdatedBy:          r.UpdatedBy.String,
+	}
+	if err := json.Unmarshal(r.GroupRoles, &cfg.GroupRoles); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+const configColumns = `org_id, enabled, idp_entity_id, idp_sso_url, idp_certificate, email_attribute,
+                first_name_attribute, last_name_attribute, groups_attribute, group_roles, default_role,
+                updated_at, updated_by`
+
+// GetSAMLConfig returns the config of the org, or nil if the org has none.
+func (s *Store) GetSAMLConfig(ctx context.Context, orgID uuid.UUID) (*controllers.SAMLConfig, error) {
+	query := `SELECT ` + configColumns + ` FROM saml_idp_configs WHERE org_id=$1`
+	var row configRow
+	err := s.db.QueryRowxContext(ctx, query, orgID).StructScan(&row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toConfig()
+}
+
+// UpsertSAMLConfig creates or replaces the config of the org.
+func (s *Store) UpsertSAMLConfig(ctx context.Context, cfg *controllers.SAMLConfig) (*controllers.SAMLConfig, error) {
+	groupRoles := cfg.GroupRoles
+	if groupRoles == nil {
+		groupRoles = []controllers.SAMLGroupRole{}
+	}
+	groupRolesJSON, err := json.Marshal(groupRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO saml_idp_configs(org_id, enabled, idp_entity_id, idp_sso_url, idp_certificate,
+                  email_attribute, first_name_attribute, last_name_attribute, groups_attribute, group_roles,
+                  default_role, updated_by)
+                VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+                ON CONFLICT (org_id) DO UPDATE SET enabled=EXCLUDED.enabled, idp_entity_id=EXCLUDED.idp_entity_id,
+                  idp_sso_url=EXCLUDED.idp_sso_url, idp_certificate=EXCLUDED.idp_certificate,
+                  email_attribute=EXCLUDED.email_attribute, first_name_attribute=EXCLUDED.first_name_attribute,
+                  last_name_attribute=EXCLUDED.last_name_attribute, groups_attribute=EXCLUDED.groups_attribute,
+                  group_roles=EXCLUDED.group_roles, default_role=EXCLUDED.default_role,
+                  updated_at=NOW(), updated_by=EXCLUDED.updated_by
+                RETURNING ` + configColumns
+	var row configRow
+	err = s.db.QueryRowxContext(ctx, query, cfg.OrgID, cfg.Enabled, cfg.IdPEntityID, cfg.IdPSSOURL, cfg.IdPCertificate,
+		cfg.EmailAttribute, cfg.FirstNameAttribute, cfg.LastNameAttribute, cfg.GroupsAttribute, groupRolesJSON,
+		cfg.DefaultRole, cfg.UpdatedBy).StructScan(&row)
+	if err != nil {
+		return nil, err
+	}
+	return row.toConfig()
+}
+
+// DeleteSAMLConfig deletes the config of the org, if it has one.
+func (s *Store) DeleteSAMLConfig(ctx context.Context, orgID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM saml_idp_configs WHERE org_id=$1`, orgID)
+	return err
+}
+
+// ConsumeSAMLAssertion records that the assertion was used to log in. It returns false if the assertion was
+// already used. Assertions that expired are forgotten, since they aren't accepted anymore.
+func (s *Store) ConsumeSAMLAssertion(ctx context.Context, orgID uuid.UUID, assertionID string, expiresAt time.Time) (bool, error) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM saml_consumed_assertions WHERE expires_at < NOW()`); err != nil {
+		return false, err
+	}
+	query := `INSERT INTO saml_consumed_assertions(org_id, assertion_id, expires_at) VALUES($1, $2, $3)
+                ON CONFLICT (org_id, assertion_id) DO NOTHING`
+	res, err := s.db.ExecContext(ctx, query, orgID, assertionID, expiresAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
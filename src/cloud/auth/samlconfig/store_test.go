@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package samlconfig_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/auth/controllers"
+	"px.dev/pixie/src/cloud/auth/samlconfig"
+	"px.dev/pixie/src/cloud/auth/schema"
+	"px.dev/pixie/src/shared/services/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+var db *sqlx.DB
+
+func testMain(m *testing.M) error {
+	s := bindata.Resource(schema.AssetNames(), schema.Asset)
+	testDB, teardown, err := pgtest.SetupTestDB(s)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+func TestStore_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := samlconfig.New(db)
+	orgID := uuid.Must(uuid.NewV4())
+
+	cfg, err := s.GetSAMLConfig(ctx, orgID)
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = s.UpsertSAMLConfig(ctx, &controllers.SAMLConfig{
+		OrgID:          orgID,
+		Enabled:        true,
+		IdPEntityID:    "http://www.okta.com/abc",
+		IdPSSOURL:      "https://pixie.okta.com/app/abc/sso/saml",
+		IdPCertificate: "cert",
+		UpdatedBy:      "admin@pixie.dev",
+	})
+	require.NoError(t, err)
+	assert.True(t, cfg.Enabled)
+	assert.Empty(t, cfg.GroupRoles)
+	assert.Equal(t, controllers.SAMLOrgRoleNone, cfg.DefaultRole)
+	assert.False(t, cfg.UpdatedAt.IsZero())
+
+	_, err = s.UpsertSAMLConfig(ctx, &controllers.SAMLConfig{
+		OrgID:           orgID,
+		IdPEntityID:     "http://www.okta.com/abc",
+		IdPSSOURL:       "https://pixie.okta.com/app/abc/sso/saml",
+		IdPCertificate:  "cert2",
+		GroupsAttribute: "groups",
+		GroupRoles: []controllers.SAMLGroupRole{
+			{Group: "eng", Role: controllers.SAMLOrgRoleMember},
+			{Group: "contractors", Role: controllers.SAMLOrgRolePendingApproval},
+		},
+		DefaultRole: controllers.SAMLOrgRolePendingApproval,
+		UpdatedBy:   "other@pixie.dev",
+	})
+	require.NoError(t, err)
+
+	fetched, err := s.GetSAMLConfig(ctx, orgID)
+	require.NoError(t, err)
+	assert.False(t, fetched.Enabled)
+	assert.Equal(t, "cert2", fetched.IdPCertificate)
+	assert.Equal(t, "groups", fetched.GroupsAttribute)
+	assert.Equal(t, []controllers.SAMLGroupRole{
+		{Group: "eng", Role: controllers.SAMLOrgRoleMember},
+		{Group: "contractors", Role: controllers.SAMLOrgRolePendingApproval},
+	}, fetched.GroupRoles)
+	assert.Equal(t, controllers.SAMLOrgRolePendingApproval, fetched.DefaultRole)
+	assert.Equal(t, "other@pixie.dev", fetched.UpdatedBy)
+
+	require.NoError(t, s.DeleteSAMLConfig(ctx, orgID))
+	cfg, err = s.GetSAMLConfig(ctx, orgID)
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestStore_ConsumeSAMLAssertion(t *testing.T) {
+	ctx := context.Background()
+	s := samlconfig.New(db)
+	orgID := uuid.Must(uuid.NewV4())
+	expiresAt := time.Now().Add(5 * time.Minute)
+
+	ok, err := s.ConsumeSAMLAssertion(ctx, orgID, "_assertion", expiresAt)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.ConsumeSAMLAssertion(ctx, orgID, "_assertion", expiresAt)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Assertion IDs are only unique for the identity provider that issued them.
+	ok, err = s.ConsumeSAMLAssertion(ctx, uuid.Must(uuid.NewV4()), "_assertion", expiresAt)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
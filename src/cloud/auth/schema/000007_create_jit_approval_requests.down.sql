@@ -0,0 +1 @@
+DROP TABLE IF EXISTS jit_approval_requests;
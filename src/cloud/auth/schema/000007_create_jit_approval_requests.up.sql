@@ -0,0 +1,26 @@
+-- This table contains requests from users that authenticated without an account, invite or
+-- matching org, and are waiting for a Pixie Cloud admin to let them in.
+CREATE TABLE jit_approval_requests (
+  -- The ID of the request.
+  id UUID UNIQUE DEFAULT uuid_generate_v4(),
+  -- The ID that the auth provider assigned to the user. Users have at most one request.
+  auth_provider_id varchar(1000) NOT NULL,
+  -- The info that the auth provider returned for the user.
+  email varchar(1000) NOT NULL,
+  first_name varchar(1000),
+  last_name varchar(1000),
+  identity_provider varchar(1000),
+  hosted_domain varchar(1000),
+  -- The state of the request: pending, approved or denied.
+  status varchar(20) NOT NULL DEFAULT 'pending',
+  -- The org that the user joins once approved. If null, an org is created for the user.
+  org_id UUID,
+  -- Timestamp when the request was created.
+  created_at TIMESTAMP DEFAULT NOW(),
+  -- Timestamp when the request was last reviewed, and the email of the admin that reviewed it.
+  reviewed_at TIMESTAMP,
+  reviewed_by varchar(1000),
+
+  UNIQUE(auth_provider_id),
+  PRIMARY KEY(id)
+);
@@ -0,0 +1,26 @@
+-- This table contains the SAML identity provider of the orgs that log in with SAML.
+CREATE TABLE saml_idp_configs (
+  -- The org that the identity provider authenticates. Orgs have at most one identity provider.
+  org_id UUID NOT NULL,
+  -- Whether users of the org may log in with SAML.
+  enabled boolean NOT NULL DEFAULT false,
+  -- The entity ID and single sign-on URL of the identity provider.
+  idp_entity_id varchar(1000) NOT NULL,
+  idp_sso_url varchar(1000) NOT NULL,
+  -- The PEM encoded certificate that the identity provider signs its assertions with.
+  idp_certificate text NOT NULL,
+  -- The names of the assertion attributes that hold the user's info.
+  email_attribute varchar(1000),
+  first_name_attribute varchar(1000),
+  last_name_attribute varchar(1000),
+  groups_attribute varchar(1000),
+  -- The ordered list of {"group": ..., "role": ...} mappings from groups to org roles.
+  group_roles jsonb NOT NULL DEFAULT '[]',
+  -- The role of users that aren't in any of the mapped groups. Empty if they can't log in.
+  default_role varchar(20) NOT NULL DEFAULT '',
+  -- Timestamp when the config was last updated, and the email of the user that updated it.
+  updated_at TIMESTAMP DEFAULT NOW(),
+  updated_by varchar(1000),
+
+  PRIMARY KEY(org_id)
+);
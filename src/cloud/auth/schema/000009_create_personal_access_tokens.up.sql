@@ -0,0 +1,23 @@
+-- This table contains the personal access tokens of users.
+CREATE TABLE personal_access_tokens (
+  id UUID UNIQUE DEFAULT uuid_generate_v4(),
+  -- The org of the user when the token was created. The token stops working if the user leaves the org.
+  org_id UUID NOT NULL,
+  -- The user that owns the token.
+  user_id UUID NOT NULL,
+  -- The name of the token, unique for the user.
+  name varchar(255) NOT NULL,
+  -- The SHA-256 hash of the token. The token itself is only shown to the user when it is created.
+  hashed_token bytea NOT NULL,
+  -- The list of scopes that the token allows.
+  scopes jsonb NOT NULL DEFAULT '[]',
+  created_at TIMESTAMP DEFAULT NOW(),
+  expires_at TIMESTAMP NOT NULL,
+  -- When and from which IP the token was last used. NULL if the token was never used.
+  last_used_at TIMESTAMP,
+  last_used_ip varchar(64),
+
+  UNIQUE(hashed_token),
+  UNIQUE(user_id, name),
+  PRIMARY KEY(id)
+);
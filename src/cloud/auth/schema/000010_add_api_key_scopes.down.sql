@@ -0,0 +1,3 @@
+ALTER TABLE api_keys DROP COLUMN scopes;
+ALTER TABLE api_keys DROP COLUMN cluster_ids;
+ALTER TABLE api_keys DROP COLUMN expires_at;
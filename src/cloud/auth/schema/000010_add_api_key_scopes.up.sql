@@ -0,0 +1,6 @@
+-- The scopes that the key is restricted to. Keys without scopes are unrestricted.
+ALTER TABLE api_keys ADD COLUMN scopes jsonb NOT NULL DEFAULT '[]';
+-- The clusters that the key may run scripts on. The key may run scripts on all clusters if empty.
+ALTER TABLE api_keys ADD COLUMN cluster_ids jsonb NOT NULL DEFAULT '[]';
+-- When the key expires. NULL if the key never expires.
+ALTER TABLE api_keys ADD COLUMN expires_at TIMESTAMP;
@@ -0,0 +1,12 @@
+-- This table contains the IDs of the SAML assertions that were used to log in, so that they can't be
+-- replayed. Rows are kept until the assertions expire.
+CREATE TABLE saml_consumed_assertions (
+  -- The org whose identity provider issued the assertion.
+  org_id UUID NOT NULL,
+  -- The ID of the assertion, which identity providers pick to be unique.
+  assertion_id varchar(1000) NOT NULL,
+  -- The time after which the assertion isn't accepted anymore, and the row can be deleted.
+  expires_at TIMESTAMP NOT NULL,
+
+  PRIMARY KEY(org_id, assertion_id)
+);
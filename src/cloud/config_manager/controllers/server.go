@@ -160,7 +160,19 @@ func (s *Server) GetConfigForVizier(ctx context.Context,
 	in *cpb.ConfigForVizierRequest) (*cpb.ConfigForVizierResponse, error) {
 	log.Info("Fetching config for Vizier")
 
-	templatedYAMLs, err := fetchVizierTemplates(ctx, "", in.VzSpec.Version, s.atClient)
+	// Attempt to get the org ID from DeployKey, otherwise from the Vizier.
+	orgID, err := s.getOrgIDForDeployKey(in.VzSpec.DeployKey)
+	if err != nil || orgID == uuid.Nil {
+		log.WithError(err).Error("Error getting org ID from deploy key")
+	}
+	if orgID == uuid.Nil && in.VizierID != nil {
+		orgID, err = s.getOrgIDForVizier(in.VizierID)
+		if err != nil || orgID == uuid.Nil {
+			log.WithError(err).Error("Error getting the org ID from Vizier")
+		}
+	}
+
+	templatedYAMLs, err := fetchVizierTemplates(ctx, "", in.VzSpec.Version, s.atClient, orgID, in.VizierID)
 	if err != nil {
 		log.WithError(err).Error("Failed to fetch Vizier templates")
 		return nil, err
@@ -239,19 +251,6 @@ func (s *Server) GetConfigForVizier(ctx context.Context,
 	}
 	AddDefaultTableStoreSize(tmplValues.PEMMemoryRequest, tmplValues.CustomPEMFlags)
 
-	// Attempt to get the org ID from DeployKey, otherwise from the Vizier.
-	var orgID uuid.UUID
-	orgID, err = s.getOrgIDForDeployKey(tmplValues.DeployKey)
-	if err != nil || orgID == uuid.Nil {
-		log.WithError(err).Error("Error getting org ID from deploy key")
-	}
-	if orgID == uuid.Nil && in.VizierID != nil {
-		orgID, err = s.getOrgIDForVizier(in.VizierID)
-		if err != nil || orgID == uuid.Nil {
-			log.WithError(err).Error("Error getting the org ID from Vizier")
-		}
-	}
-
 	// Next we inject any feature flags that we want to set for this org.
 	if orgID != uuid.Nil {
 		AddFeatureFlagsToTemplate(s.vzFeatureFlagClient, orgID, tmplValues)
@@ -301,11 +300,15 @@ func getSentryDSN(vizierVersion string) string {
 // fetchVizierTemplates gets a download link, untars file, and
 // converts to yaml maps.
 func fetchVizierTemplates(ctx context.Context, authToken,
-	versionStr string, atClient atpb.ArtifactTrackerClient) ([]*yamls.YAMLFile, error) {
+	versionStr string, atClient atpb.ArtifactTrackerClient, orgID uuid.UUID, vizierID *uuidpb.UUID) ([]*yamls.YAMLFile, error) {
 	req := &atpb.GetDownloadLinkRequest{
 		ArtifactName: "vizier",
 		VersionStr:   versionStr,
 		ArtifactType: versionspb.AT_CONTAINER_SET_TEMPLATE_YAMLS,
+		ClusterID:    vizierID,
+	}
+	if orgID != uuid.Nil {
+		req.OrgID = utils.ProtoFromUUID(orgID)
 	}
 	resp, err := atClient.GetDownloadLink(ctx, req)
 	if err != nil {
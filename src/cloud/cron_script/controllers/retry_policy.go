@@ -0,0 +1,376 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	// maxRetries is the largest number of retries a retry policy can specify.
+	maxRetries = 10
+	// maxExecutionHistory is the number of runs of a script that are kept in its execution history.
+	maxExecutionHistory = 100
+	// defaultExecutionHistoryLimit is the number of runs returned by GetExecutionHistory, if no limit is given.
+	defaultExecutionHistoryLimit = 20
+	notificationTimeout          = 10 * time.Second
+)
+
+// RetryPolicy is how failed runs of a cron script are retried, as stored in the database.
+type RetryPolicy struct {
+	MaxRetries           int32    `json:"max_retries,omitempty"`
+	Exponential          bool     `json:"exponential,omitempty"`
+	InitialBackoffS      int64    `json:"initial_backoff_s,omitempty"`
+	MaxBackoffS          int64    `json:"max_backoff_s,omitempty"`
+	FailureThreshold     int32    `json:"failure_threshold,omitempty"`
+	NotificationWebhooks []string `json:"notification_webhooks,omitempty"`
+}
+
+// Value Returns a golang database/sql driver value for RetryPolicy.
+func (p RetryPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// Scan Scans the sqlx database type ([]bytes) into the RetryPolicy type.
+func (p *RetryPolicy) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil
+	}
+	return json.Unmarshal(data, p)
+}
+
+func retryPolicyFromProto(p *cronscriptpb.RetryPolicy) (RetryPolicy, error) {
+	if p == nil {
+		return RetryPolicy{}, nil
+	}
+	if p.MaxRetries < 0 || p.MaxRetries > maxRetries {
+		return RetryPolicy{}, fmt.Errorf("max retries must be between 0 and %d", maxRetries)
+	}
+	if p.InitialBackoffS < 0 || p.MaxBackoffS < 0 {
+		return RetryPolicy{}, errors.New("backoff must not be negative")
+	}
+	if p.MaxBackoffS != 0 && p.MaxBackoffS < p.InitialBackoffS {
+		return RetryPolicy{}, errors.New("max backoff must not be less than the initial backoff")
+	}
+	if p.FailureThreshold < 0 {
+		return RetryPolicy{}, errors.New("failure threshold must not be negative")
+	}
+	for _, w := range p.NotificationWebhooks {
+		u, err := url.Parse(w)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return RetryPolicy{}, fmt.Errorf("notification webhook %q must be an http or https URL", w)
+		}
+	}
+	return RetryPolicy{
+		MaxRetries:           p.MaxRetries,
+		Exponential:          p.BackoffStrategy == cronscriptpb.BACKOFF_STRATEGY_EXPONENTIAL,
+		InitialBackoffS:      p.InitialBackoffS,
+		MaxBackoffS:          p.MaxBackoffS,
+		FailureThreshold:     p.FailureThreshold,
+		NotificationWebhooks: p.NotificationWebhooks,
+	}, nil
+}
+
+func (p RetryPolicy) isEmpty() bool {
+	return p.MaxRetries == 0 && p.InitialBackoffS == 0 && p.MaxBackoffS == 0 && p.FailureThreshold == 0 &&
+		!p.Exponential && len(p.NotificationWebhooks) == 0
+}
+
+// toProto returns the policy as a proto, or nil if the script has no retry policy.
+func (p RetryPolicy) toProto() *cronscriptpb.RetryPolicy {
+	if p.isEmpty() {
+		return nil
+	}
+	strategy := cronscriptpb.BACKOFF_STRATEGY_FIXED
+	if p.Exponential {
+		strategy = cronscriptpb.BACKOFF_STRATEGY_EXPONENTIAL
+	}
+	return &cronscriptpb.RetryPolicy{
+		MaxRetries:           p.MaxRetries,
+		BackoffStrategy:      strategy,
+		InitialBackoffS:      p.InitialBackoffS,
+		MaxBackoffS:          p.MaxBackoffS,
+		FailureThreshold:     p.FailureThreshold,
+		NotificationWebhooks: p.NotificationWebhooks,
+	}
+}
+
+// toVizierProto returns the part of the policy that the Vizier applies, or nil if failed runs should not be retried.
+func (p RetryPolicy) toVizierProto() *cvmsgspb.CronScriptRetryPolicy {
+	if p.MaxRetries == 0 {
+		return nil
+	}
+	return &cvmsgspb.CronScriptRetryPolicy{
+		MaxRetries:         p.MaxRetries,
+		ExponentialBackoff: p.Exponential,
+		InitialBackoffS:    p.InitialBackoffS,
+		MaxBackoffS:        p.MaxBackoffS,
+	}
+}
+
+func (p RetryPolicy) failureThreshold() int64 {
+	if p.FailureThreshold <= 0 {
+		return 1
+	}
+	return int64(p.FailureThreshold)
+}
+
+// HandleExecutionResult handles the results of cron script runs sent by Viziers. It records the run in the
+// execution history of the script, tracks the number of consecutive failed runs and notifies the targets of
+// the retry policy when the script starts failing or recovers.
+func (s *Server) HandleExecutionResult(msg *cvmsgspb.V2CMessage) {
+	req := &cvmsgspb.CronScriptExecutionResult{}
+	err := types.UnmarshalAny(msg.Msg, req)
+	if err != nil {
+		log.WithError(err).Error("Could not unmarshal NATS message")
+		return
+	}
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+	clusterID := uuid.FromStringOrNil(msg.VizierID)
+	startTime, err := types.TimestampFromProto(req.StartTime)
+	if err != nil {
+		log.WithError(err).Error("Invalid cron script execution start time")
+		return
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		log.WithError(err).Error("Failed to start transaction")
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var script struct {
+		OrgID               uuid.UUID   `db:"org_id"`
+		RetryPolicy         RetryPolicy `db:"retry_policy"`
+		ConsecutiveFailures int64       `db:"consecutive_failures"`
+	}
+	query := `SELECT org_id, retry_policy, consecutive_failures FROM cron_scripts WHERE id=$1 FOR UPDATE`
+	err = tx.Get(&script, query, scriptID)
+	if err == sql.ErrNoRows {
+		// The script was deleted, or it does not come from the cloud.
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithField("script_id", scriptID).Error("Failed to fetch cron script")
+		return
+	}
+
+	failures := int64(0)
+	if !req.Succeeded {
+		failures = script.ConsecutiveFailures + 1
+	}
+	query = `UPDATE cron_scripts SET consecutive_failures=$1 WHERE id=$2`
+	_, err = tx.Exec(query, failures, scriptID)
+	if err != nil {
+		log.WithError(err).WithField("script_id", scriptID).Error("Failed to update consecutive failures")
+		return
+	}
+
+	query = `INSERT INTO cron_script_executions(script_id, cluster_id, succeeded, start_time, duration_ns, attempts, error)
+             VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.Exec(query, scriptID, clusterID, req.Succeeded, startTime, req.DurationNs, req.Attempts, req.Error)
+	if err != nil {
+		log.WithError(err).WithField("script_id", scriptID).Error("Failed to record cron script execution")
+		return
+	}
+
+	query = `DELETE FROM cron_script_executions WHERE script_id=$1 AND id NOT IN
+             (SELECT id FROM cron_script_executions WHERE script_id=$1 ORDER BY start_time DESC LIMIT $2)`
+	_, err = tx.Exec(query, scriptID, maxExecutionHistory)
+	if err != nil {
+		log.WithError(err).WithField("script_id", scriptID).Error("Failed to trim cron script execution history")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.WithError(err).WithField("script_id", scriptID).Error("Failed to commit cron script execution")
+		return
+	}
+
+	threshold := script.RetryPolicy.failureThreshold()
+	var n *failureNotification
+	switch {
+	case !req.Succeeded && failures == threshold:
+		n = newFailureNotification(scriptID, script.OrgID, clusterID, "failing", failures, req.Error)
+	case req.Succeeded && script.ConsecutiveFailures >= threshold:
+		n = newFailureNotification(scriptID, script.OrgID, clusterID, "recovered", 0, "")
+	}
+	if n != nil {
+		for _, webhook := range script.RetryPolicy.NotificationWebhooks {
+			go func(webhook string) {
+				err := s.postNotification(webhook, n)
+				if err != nil {
+					log.WithError(err).WithField("script_id", scriptID).Error("Failed to send cron script failure notification")
+				}
+			}(webhook)
+		}
+	}
+}
+
+// failureNotification is the body of a notification about a failing cron script. The text makes it
+// compatible with Slack's incoming webhooks.
+type failureNotification struct {
+	Text                string `json:"text"`
+	State               string `json:"state"`
+	ScriptID            string `json:"script_id"`
+	OrgID               string `json:"org_id"`
+	ClusterID           string `json:"cluster_id"`
+	ConsecutiveFailures int64  `json:"consecutive_failures"`
+	Error               string `json:"error,omitempty"`
+}
+
+func newFailureNotification(scriptID, orgID, clusterID uuid.UUID, state string, failures int64, errMsg string) *failureNotification {
+	n := &failureNotification{
+		State:               state,
+		ScriptID:            scriptID.String(),
+		OrgID:               orgID.String(),
+		ClusterID:           clusterID.String(),
+		ConsecutiveFailures: failures,
+		Error:               errMsg,
+		Text:                fmt.Sprintf("Cron script %s has recovered.", scriptID),
+	}
+	if state == "failing" {
+		n.Text = fmt.Sprintf("Cron script %s has failed %d times in a row: %s", scriptID, failures, errMsg)
+	}
+	return n
+}
+
+func (s *Server) postNotification(webhook string, n *failureNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Execution is a run of a cron script, as stored in the database.
+type Execution struct {
+	ClusterID  uuid.UUID `db:"cluster_id"`
+	Succeeded  bool      `db:"succeeded"`
+	StartTime  time.Time `db:"start_time"`
+	DurationNs int64     `db:"duration_ns"`
+	Attempts   int32     `db:"attempts"`
+	Error      *string   `db:"error"`
+}
+
+// GetExecutionHistory gets the most recent runs of a cron script, across all clusters.
+func (s *Server) GetExecutionHistory(ctx context.Context, req *cronscriptpb.GetExecutionHistoryRequest) (*cronscriptpb.GetExecutionHistoryResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthenticated")
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if req.OrgID == nil {
+		orgID = uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID)
+	}
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+
+	limit := int32(defaultExecutionHistoryLimit)
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+	if limit > maxExecutionHistory {
+		limit = maxExecutionHistory
+	}
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM cron_scripts WHERE org_id=$1 AND id=$2)`
+	err = s.db.Get(&exists, query, orgID, scriptID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to fetch cron script")
+	}
+	if !exists {
+		return nil, status.Error(codes.NotFound, "cron script not found")
+	}
+
+	var execs []Execution
+	query = `SELECT cluster_id, succeeded, start_time, duration_ns, attempts, error FROM cron_script_executions
+             WHERE script_id=$1 ORDER BY start_time DESC LIMIT $2`
+	err = s.db.Select(&execs, query, scriptID, limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to fetch execution history")
+	}
+
+	resp := &cronscriptpb.GetExecutionHistoryResponse{
+		Executions: make([]*cronscriptpb.Execution, len(execs)),
+	}
+	for i, e := range execs {
+		tsPb, err := types.TimestampProto(e.StartTime)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to read execution history")
+		}
+		pb := &cronscriptpb.Execution{
+			ClusterID:  utils.ProtoFromUUID(e.ClusterID),
+			Status:     cronscriptpb.EXECUTION_STATUS_FAILED,
+			StartTime:  tsPb,
+			DurationNs: e.DurationNs,
+			Attempts:   e.Attempts,
+		}
+		if e.Succeeded {
+			pb.Status = cronscriptpb.EXECUTION_STATUS_SUCCEEDED
+		}
+		if e.Error != nil {
+			pb.Error = *e.Error
+		}
+		resp.Executions[i] = pb
+	}
+	return resp, nil
+}
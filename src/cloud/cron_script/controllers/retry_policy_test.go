@@ -0,0 +1,197 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/cron_script/controllers"
+	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	mock_vzmgrpb "px.dev/pixie/src/cloud/vzmgr/vzmgrpb/mock"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/utils"
+)
+
+func TestServer_CreateScriptWithRetryPolicy(t *testing.T) {
+	mustLoadTestData(db)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockVZMgr := mock_vzmgrpb.NewMockVZMgrServiceClient(ctrl)
+	mockVZMgr.EXPECT().GetVizierInfos(gomock.Any(), gomock.Any()).Return(&vzmgrpb.GetVizierInfosResponse{}, nil)
+
+	clusterIDs := []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000")}
+	s := controllers.New(db, "test", nil, mockVZMgr)
+	ctx := createTestContext()
+
+	_, err := s.CreateScript(ctx, &cronscriptpb.CreateScriptRequest{
+		Script:      "px.display()",
+		Configs:     "config1",
+		FrequencyS:  11,
+		Disabled:    true,
+		RetryPolicy: &cronscriptpb.RetryPolicy{MaxRetries: 100},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.CreateScript(ctx, &cronscriptpb.CreateScriptRequest{
+		Script:     "px.display()",
+		Configs:    "config1",
+		FrequencyS: 11,
+		Disabled:   true,
+		RetryPolicy: &cronscriptpb.RetryPolicy{
+			MaxRetries:           1,
+			NotificationWebhooks: []string{"ftp://example.com"},
+		},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	policy := &cronscriptpb.RetryPolicy{
+		MaxRetries:           3,
+		BackoffStrategy:      cronscriptpb.BACKOFF_STRATEGY_EXPONENTIAL,
+		InitialBackoffS:      2,
+		MaxBackoffS:          30,
+		FailureThreshold:     2,
+		NotificationWebhooks: []string{"https://example.com/hook"},
+	}
+	resp, err := s.CreateScript(ctx, &cronscriptpb.CreateScriptRequest{
+		Script:      "px.display()",
+		Configs:     "config1",
+		FrequencyS:  11,
+		Disabled:    true,
+		ClusterIDs:  clusterIDs,
+		RetryPolicy: policy,
+	})
+	require.NoError(t, err)
+
+	getResp, err := s.GetScript(ctx, &cronscriptpb.GetScriptRequest{ID: resp.ID})
+	require.NoError(t, err)
+	assert.Equal(t, policy, getResp.Script.RetryPolicy)
+
+	_, err = s.UpdateScript(ctx, &cronscriptpb.UpdateScriptRequest{
+		ScriptId:    resp.ID,
+		RetryPolicy: &cronscriptpb.RetryPolicy{MaxRetries: 1},
+	})
+	require.NoError(t, err)
+
+	getResp, err = s.GetScript(ctx, &cronscriptpb.GetScriptRequest{ID: resp.ID})
+	require.NoError(t, err)
+	assert.Equal(t, &cronscriptpb.RetryPolicy{MaxRetries: 1}, getResp.Script.RetryPolicy)
+}
+
+func TestServer_HandleExecutionResult(t *testing.T) {
+	mustLoadTestData(db)
+
+	notifications := make(chan map[string]interface{}, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&n)
+		require.NoError(t, err)
+		notifications <- n
+	}))
+	defer webhook.Close()
+
+	scriptID := "123e4567-e89b-12d3-a456-426655440000"
+	clusterID := "323e4567-e89b-12d3-a456-426655440000"
+	db.MustExec(`UPDATE cron_scripts SET retry_policy=$1 WHERE id=$2`, controllers.RetryPolicy{
+		MaxRetries:           2,
+		FailureThreshold:     2,
+		NotificationWebhooks: []string{webhook.URL},
+	}, scriptID)
+
+	s := controllers.New(db, "test", nil, nil)
+	ctx := createTestContext()
+
+	sendResult := func(startTime time.Time, succeeded bool, errMsg string) {
+		tsPb, err := types.TimestampProto(startTime)
+		require.NoError(t, err)
+		anyMsg, err := types.MarshalAny(&cvmsgspb.CronScriptExecutionResult{
+			ScriptID:   utils.ProtoFromUUIDStrOrNil(scriptID),
+			StartTime:  tsPb,
+			DurationNs: 1000,
+			Attempts:   3,
+			Succeeded:  succeeded,
+			Error:      errMsg,
+		})
+		require.NoError(t, err)
+		s.HandleExecutionResult(&cvmsgspb.V2CMessage{VizierID: clusterID, Msg: anyMsg})
+	}
+
+	consecutiveFailures := func() int64 {
+		resp, err := s.GetScript(ctx, &cronscriptpb.GetScriptRequest{ID: utils.ProtoFromUUIDStrOrNil(scriptID)})
+		require.NoError(t, err)
+		return resp.Script.ConsecutiveFailures
+	}
+
+	start := time.Unix(1700000000, 0).UTC()
+	sendResult(start, false, "export failed")
+	assert.Equal(t, int64(1), consecutiveFailures())
+	assert.Len(t, notifications, 0)
+
+	// The second failure reaches the failure threshold.
+	sendResult(start.Add(time.Minute), false, "export failed")
+	assert.Equal(t, int64(2), consecutiveFailures())
+	n := <-notifications
+	assert.Equal(t, "failing", n["state"])
+	assert.Equal(t, scriptID, n["script_id"])
+	assert.Equal(t, "export failed", n["error"])
+
+	sendResult(start.Add(2*time.Minute), true, "")
+	assert.Equal(t, int64(0), consecutiveFailures())
+	n = <-notifications
+	assert.Equal(t, "recovered", n["state"])
+
+	resp, err := s.GetExecutionHistory(ctx, &cronscriptpb.GetExecutionHistoryRequest{
+		ScriptID: utils.ProtoFromUUIDStrOrNil(scriptID),
+		Limit:    2,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Executions, 2)
+	assert.Equal(t, cronscriptpb.EXECUTION_STATUS_SUCCEEDED, resp.Executions[0].Status)
+	assert.Equal(t, cronscriptpb.EXECUTION_STATUS_FAILED, resp.Executions[1].Status)
+	assert.Equal(t, "export failed", resp.Executions[1].Error)
+	assert.Equal(t, int32(3), resp.Executions[1].Attempts)
+	assert.Equal(t, int64(1000), resp.Executions[1].DurationNs)
+	assert.Equal(t, utils.ProtoFromUUIDStrOrNil(clusterID), resp.Executions[1].ClusterID)
+}
+
+func TestServer_GetExecutionHistoryNotFound(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", nil, nil)
+	// The script belongs to another org.
+	_, err := s.GetExecutionHistory(createTestContext(), &cronscriptpb.GetExecutionHistoryRequest{
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -22,6 +22,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
@@ -65,6 +66,7 @@ type Server struct {
 	dbKey       string
 	nc          *nats.Conn
 	vzmgrClient vzmgrpb.VZMgrServiceClient
+	httpClient  *http.Client
 
 	done chan struct{}
 	once sync.Once
@@ -77,6 +79,7 @@ func New(db *sqlx.DB, dbKey string, nc *nats.Conn, vzmgrClient vzmgrpb.VZMgrServ
 		dbKey:       dbKey,
 		nc:          nc,
 		vzmgrClient: vzmgrClient,
+		httpClient:  &http.Client{Timeout: notificationTimeout},
 		done:        make(chan struct{}),
 	}
 	s.handleRequests()
@@ -93,19 +96,22 @@ func (s *Server) Stop() {
 
 // CronScript contains metadata about a regularly scheduled script.
 type CronScript struct {
-	ID         uuid.UUID  `db:"id"`
-	OrgID      uuid.UUID  `db:"org_id"`
-	Script     string     `db:"script"`
-	ClusterIDs ClusterIDs `db:"cluster_ids"`
-	ConfigStr  string     `db:"configs"`
-	Enabled    bool       `db:"enabled"`
-	FrequencyS int64      `db:"frequency_s"`
+	ID                  uuid.UUID   `db:"id"`
+	OrgID               uuid.UUID   `db:"org_id"`
+	Script              string      `db:"script"`
+	ClusterIDs          ClusterIDs  `db:"cluster_ids"`
+	ConfigStr           string      `db:"configs"`
+	Enabled             bool        `db:"enabled"`
+	FrequencyS          int64       `db:"frequency_s"`
+	RetryPolicy         RetryPolicy `db:"retry_policy"`
+	ConsecutiveFailures int64       `db:"consecutive_failures"`
 }
 
 func (s *Server) handleRequests() {
 	for _, shard := range vzshard.GenerateShardRange() {
 		s.startShardedHandler(shard, cvmsgs.CronScriptChecksumRequestChannel, s.HandleChecksumRequest)
 		s.startShardedHandler(shard, cvmsgs.GetCronScriptsRequestChannel, s.HandleScriptsRequest)
+		s.startShardedHandler(shard, cvmsgs.CronScriptExecutionResultChannel, s.HandleExecutionResult)
 	}
 }
 
@@ -204,7 +210,7 @@ func (s *Server) fetchScriptsForVizier(vizierID *uuidpb.UUID) (map[string]*cvmsg
 	}
 
 	// Fetch all scripts registered to this Vizier.
-	query := `SELECT id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, frequency_s FROM cron_scripts WHERE org_id=$2 AND enabled=true`
+	query := `SELECT id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, frequency_s, retry_policy FROM cron_scripts WHERE org_id=$2 AND enabled=true`
 	rows, err := s.db.Queryx(query, s.dbKey, utils.UUIDFromProtoOrNil(resp.OrgID))
 	if err != nil {
 		log.WithError(err).Error("Could not fetch scripts for org")
@@ -233,10 +239,11 @@ func (s *Server) fetchScriptsForVizier(vizierID *uuidpb.UUID) (map[string]*cvmsg
 			}
 		}
 		scriptsMap[s.ID.String()] = &cvmsgspb.CronScript{
-			ID:         utils.ProtoFromUUID(s.ID),
-			Script:     s.Script,
-			Configs:    s.ConfigStr,
-			FrequencyS: s.FrequencyS,
+			ID:          utils.ProtoFromUUID(s.ID),
+			Script:      s.Script,
+			Configs:     s.ConfigStr,
+			FrequencyS:  s.FrequencyS,
+			RetryPolicy: s.RetryPolicy.toVizierProto(),
 		}
 	}
 	return scriptsMap, nil
@@ -295,7 +302,7 @@ func (s *Server) GetScript(ctx context.Context, req *cronscriptpb.GetScriptReque
 	}
 	scriptID := utils.UUIDFromProtoOrNil(req.ID)
 
-	query := `SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id=$2 AND id=$3`
+	query := `SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s, retry_policy, consecutive_failures FROM cron_scripts WHERE org_id=$2 AND id=$3`
 	rows, err := s.db.Queryx(query, s.dbKey, orgID, scriptID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to fetch cron script")
@@ -318,13 +325,15 @@ func (s *Server) GetScript(ctx context.Context, req *cronscriptpb.GetScriptReque
 
 	return &cronscriptpb.GetScriptResponse{
 		Script: &cronscriptpb.CronScript{
-			ID:         req.ID,
-			OrgID:      utils.ProtoFromUUID(orgID),
-			Script:     script.Script,
-			ClusterIDs: clusterIDs,
-			Configs:    script.ConfigStr,
-			Enabled:    script.Enabled,
-			FrequencyS: script.FrequencyS,
+			ID:                  req.ID,
+			OrgID:               utils.ProtoFromUUID(orgID),
+			Script:              script.Script,
+			ClusterIDs:          clusterIDs,
+			Configs:             script.ConfigStr,
+			Enabled:             script.Enabled,
+			FrequencyS:          script.FrequencyS,
+			RetryPolicy:         script.RetryPolicy.toProto(),
+			ConsecutiveFailures: script.ConsecutiveFailures,
 		},
 	}, nil
 }
@@ -346,7 +355,7 @@ func (s *Server) GetScripts(ctx context.Context, req *cronscriptpb.GetScriptsReq
 		ids[i] = utils.UUIDFromProtoOrNil(id)
 	}
 
-	strQuery := "SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, ? ::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id=? AND id IN (?)"
+	strQuery := "SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, ? ::text) as configs, enabled, frequency_s, retry_policy, consecutive_failures FROM cron_scripts WHERE org_id=? AND id IN (?)"
 	cronErr := status.Error(codes.Internal, "Failed to get cron scripts")
 
 	query, args, err := sqlx.In(strQuery, s.dbKey, orgID, ids)
@@ -380,13 +389,15 @@ func (s *Server) GetScripts(ctx context.Context, req *cronscriptpb.GetScriptsReq
 		}
 
 		cpb := &cronscriptpb.CronScript{
-			ID:         utils.ProtoFromUUID(p.ID),
-			OrgID:      utils.ProtoFromUUID(p.OrgID),
-			Script:     p.Script,
-			ClusterIDs: clusterIDs,
-			Configs:    p.ConfigStr,
-			Enabled:    p.Enabled,
-			FrequencyS: p.FrequencyS,
+			ID:                  utils.ProtoFromUUID(p.ID),
+			OrgID:               utils.ProtoFromUUID(p.OrgID),
+			Script:              p.Script,
+			ClusterIDs:          clusterIDs,
+			Configs:             p.ConfigStr,
+			Enabled:             p.Enabled,
+			FrequencyS:          p.FrequencyS,
+			RetryPolicy:         p.RetryPolicy.toProto(),
+			ConsecutiveFailures: p.ConsecutiveFailures,
 		}
 		scripts = append(scripts, cpb)
 	}
@@ -406,13 +417,24 @@ func (s *Server) CreateScript(ctx context.Context, req *cronscriptpb.CreateScrip
 		orgID = uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID)
 	}
 
+	retryPolicy, err := retryPolicyFromProto(req.RetryPolicy)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	clusterIDs := make([]uuid.UUID, len(req.ClusterIDs))
 	for i, c := range req.ClusterIDs {
 		clusterIDs[i] = utils.UUIDFromProtoOrNil(c)
 	}
 
-	query := `INSERT INTO cron_scripts(org_id, script, cluster_ids, configs, enabled, frequency_s) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5), $6, $7) RETURNING id`
-	rows, err := s.db.Queryx(query, orgID, req.Script, ClusterIDs(clusterIDs), req.Configs, s.dbKey, !req.Disabled, req.FrequencyS)
+	// Scripts created by services, rather than by a user, belong to the org.
+	var ownerID *uuid.UUID
+	if userID := uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().GetUserID()); userID != uuid.Nil {
+		ownerID = &userID
+	}
+
+	query := `INSERT INTO cron_scripts(org_id, script, cluster_ids, configs, enabled, frequency_s, owner_id, retry_policy) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5), $6, $7, $8, $9) RETURNING id`
+	rows, err := s.db.Queryx(query, orgID, req.Script, ClusterIDs(clusterIDs), req.Configs, s.dbKey, !req.Disabled, req.FrequencyS, ownerID, retryPolicy)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to create cron script")
 	}
@@ -434,10 +456,11 @@ func (s *Server) CreateScript(ctx context.Context, req *cronscriptpb.CreateScrip
 			Msg: &cvmsgspb.CronScriptUpdate_UpsertReq{
 				UpsertReq: &cvmsgspb.RegisterOrUpdateCronScriptRequest{
 					Script: &cvmsgspb.CronScript{
-						ID:         idPb,
-						Script:     req.Script,
-						FrequencyS: req.FrequencyS,
-						Configs:    req.Configs,
+						ID:          idPb,
+						Script:      req.Script,
+						FrequencyS:  req.FrequencyS,
+						Configs:     req.Configs,
+						RetryPolicy: retryPolicy.toVizierProto(),
 					},
 				},
 			},
@@ -459,7 +482,7 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 	}
 	scriptID := utils.UUIDFromProtoOrNil(req.ScriptId)
 
-	query := `SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id=$2 AND id=$3`
+	query := `SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s, retry_policy, consecutive_failures FROM cron_scripts WHERE org_id=$2 AND id=$3`
 	rows, err := s.db.Queryx(query, s.dbKey, orgID, scriptID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to fetch cron script")
@@ -495,6 +518,14 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 		freq = req.FrequencyS.Value
 	}
 
+	retryPolicy := script.RetryPolicy
+	if req.RetryPolicy != nil {
+		retryPolicy, err = retryPolicyFromProto(req.RetryPolicy)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
 	clusterIDs := script.ClusterIDs
 	if req.ClusterIDs != nil {
 		clusterIDs = make([]uuid.UUID, len(req.ClusterIDs.Value))
@@ -503,8 +534,8 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 		}
 	}
 
-	query = `UPDATE cron_scripts SET script = $1, configs = PGP_SYM_ENCRYPT($2, $3), enabled = $4, frequency_s = $5, cluster_ids=$6 WHERE id = $7`
-	_, err = s.db.Exec(query, contents, configs, s.dbKey, enabled, freq, ClusterIDs(clusterIDs), scriptID)
+	query = `UPDATE cron_scripts SET script = $1, configs = PGP_SYM_ENCRYPT($2, $3), enabled = $4, frequency_s = $5, cluster_ids=$6, retry_policy=$7 WHERE id = $8`
+	_, err = s.db.Exec(query, contents, configs, s.dbKey, enabled, freq, ClusterIDs(clusterIDs), retryPolicy, scriptID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to update cron script")
 	}
@@ -533,10 +564,11 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 			Msg: &cvmsgspb.CronScriptUpdate_UpsertReq{
 				UpsertReq: &cvmsgspb.RegisterOrUpdateCronScriptRequest{
 					Script: &cvmsgspb.CronScript{
-						ID:         req.ScriptId,
-						Script:     contents,
-						FrequencyS: freq,
-						Configs:    configs,
+						ID:          req.ScriptId,
+						Script:      contents,
+						FrequencyS:  freq,
+						Configs:     configs,
+						RetryPolicy: retryPolicy.toVizierProto(),
 					},
 				},
 			},
@@ -594,6 +626,35 @@ func (s *Server) DeleteScript(ctx context.Context, req *cronscriptpb.DeleteScrip
 	return &cronscriptpb.DeleteScriptResponse{}, nil
 }
 
+// TransferOwnership moves the cron scripts created by a user to another user in the same org.
+func (s *Server) TransferOwnership(ctx context.Context, req *cronscriptpb.TransferScriptsRequest) (*cronscriptpb.TransferScriptsResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthenticated")
+	}
+	if jwtutils.GetClaimsType(sCtx.Claims) != jwtutils.ServiceClaimType {
+		return nil, status.Error(codes.PermissionDenied, "only services may transfer cron scripts")
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	fromUserID := utils.UUIDFromProtoOrNil(req.FromUserID)
+	toUserID := utils.UUIDFromProtoOrNil(req.ToUserID)
+	if orgID == uuid.Nil || fromUserID == uuid.Nil || toUserID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "org, from and to users are required")
+	}
+
+	query := `UPDATE cron_scripts SET owner_id=$3 WHERE org_id=$1 AND owner_id=$2`
+	res, err := s.db.Exec(query, orgID, fromUserID, toUserID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to transfer cron scripts")
+	}
+	c, err := res.RowsAffected()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to transfer cron scripts")
+	}
+	return &cronscriptpb.TransferScriptsResponse{NumScripts: c}, nil
+}
+
 func (s *Server) sendCronScriptUpdateToViziers(msg *cvmsgspb.CronScriptUpdate, orgID uuid.UUID, clusterIDs []*uuidpb.UUID) {
 	msg.RequestID = uuid.Must(uuid.NewV4()).String()
 	msg.Timestamp = time.Now().UnixNano()
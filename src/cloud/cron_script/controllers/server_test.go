@@ -36,6 +36,8 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/cron_script/controllers"
@@ -564,6 +566,42 @@ func TestServer_DeleteScript(t *testing.T) {
 	require.False(t, rows.Next())
 }
 
+func TestServer_TransferOwnership(t *testing.T) {
+	mustLoadTestData(db)
+
+	orgID := "223e4567-e89b-12d3-a456-426655440000"
+	fromUserID := "523e4567-e89b-12d3-a456-426655440000"
+	toUserID := "523e4567-e89b-12d3-a456-426655440001"
+	db.MustExec(`UPDATE cron_scripts SET owner_id=$1 WHERE id IN ($2, $3)`, fromUserID,
+		"123e4567-e89b-12d3-a456-426655440000", "123e4567-e89b-12d3-a456-426655440001")
+
+	sCtx := authcontext.New()
+	sCtx.Claims = srvutils.GenerateJWTForService("ProfileService", "pixie")
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+
+	s := controllers.New(db, "test", nil, nil)
+	resp, err := s.TransferOwnership(ctx, &cronscriptpb.TransferScriptsRequest{
+		OrgID:      utils.ProtoFromUUIDStrOrNil(orgID),
+		FromUserID: utils.ProtoFromUUIDStrOrNil(fromUserID),
+		ToUserID:   utils.ProtoFromUUIDStrOrNil(toUserID),
+	})
+	require.NoError(t, err)
+	// The script in the other org is left alone.
+	assert.Equal(t, int64(1), resp.NumScripts)
+
+	var owners []uuid.UUID
+	err = db.Select(&owners, `SELECT owner_id FROM cron_scripts WHERE owner_id IS NOT NULL ORDER BY id`)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{uuid.FromStringOrNil(toUserID), uuid.FromStringOrNil(fromUserID)}, owners)
+
+	_, err = s.TransferOwnership(createTestContext(), &cronscriptpb.TransferScriptsRequest{
+		OrgID:      utils.ProtoFromUUIDStrOrNil(orgID),
+		FromUserID: utils.ProtoFromUUIDStrOrNil(toUserID),
+		ToUserID:   utils.ProtoFromUUIDStrOrNil(fromUserID),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
 func TestServer_HandleChecksumRequest(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -0,0 +1,2 @@
+ALTER TABLE cron_scripts
+  DROP COLUMN owner_id;
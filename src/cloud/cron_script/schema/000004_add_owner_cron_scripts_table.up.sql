@@ -0,0 +1,3 @@
+-- owner_id is the user who created the script. Scripts without an owner belong to the org.
+ALTER TABLE cron_scripts
+  ADD COLUMN owner_id UUID;
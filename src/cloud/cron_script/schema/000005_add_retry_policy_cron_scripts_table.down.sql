@@ -0,0 +1,5 @@
+DROP TABLE cron_script_executions;
+
+ALTER TABLE cron_scripts
+  DROP COLUMN retry_policy,
+  DROP COLUMN consecutive_failures;
@@ -0,0 +1,23 @@
+ALTER TABLE cron_scripts
+  ADD COLUMN retry_policy json,
+  ADD COLUMN consecutive_failures integer NOT NULL DEFAULT 0;
+
+CREATE TABLE cron_script_executions (
+  id UUID DEFAULT uuid_generate_v4(),
+  -- script_id is the cron script that was run.
+  script_id UUID NOT NULL REFERENCES cron_scripts(id) ON DELETE CASCADE,
+  -- cluster_id is the cluster the script was run on.
+  cluster_id UUID NOT NULL,
+  succeeded boolean NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  -- duration_ns is how long the run took, including its retries.
+  duration_ns bigint NOT NULL,
+  -- attempts is the number of attempts made, including the first one.
+  attempts integer NOT NULL,
+  -- error is the error of the last attempt, if the run failed.
+  error varchar,
+
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_cron_script_executions_script_id ON cron_script_executions(script_id, start_time);
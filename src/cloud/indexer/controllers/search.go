@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/indexer/indexerpb"
+	"px.dev/pixie/src/cloud/indexer/md"
+	"px.dev/pixie/src/utils"
+)
+
+const maxSearchPageSize = 100
+
+var kindToEsType = map[indexerpb.EntityKind]md.EsMDType{
+	indexerpb.ENTITY_KIND_NAMESPACE: md.EsMDTypeNamespace,
+	indexerpb.ENTITY_KIND_SERVICE:   md.EsMDTypeService,
+	indexerpb.ENTITY_KIND_POD:       md.EsMDTypePod,
+	indexerpb.ENTITY_KIND_NODE:      md.EsMDTypeNode,
+}
+
+var esTypeToKind = map[md.EsMDType]indexerpb.EntityKind{
+	md.EsMDTypeNamespace: indexerpb.ENTITY_KIND_NAMESPACE,
+	md.EsMDTypeService:   indexerpb.ENTITY_KIND_SERVICE,
+	md.EsMDTypePod:       indexerpb.ENTITY_KIND_POD,
+	md.EsMDTypeNode:      indexerpb.ENTITY_KIND_NODE,
+}
+
+var esStateToState = map[md.ESMDEntityState]indexerpb.EntityState{
+	md.ESMDEntityStateUnknown:    indexerpb.ENTITY_STATE_UNKNOWN,
+	md.ESMDEntityStatePending:    indexerpb.ENTITY_STATE_PENDING,
+	md.ESMDEntityStateRunning:    indexerpb.ENTITY_STATE_RUNNING,
+	md.ESMDEntityStateFailed:     indexerpb.ENTITY_STATE_FAILED,
+	md.ESMDEntityStateTerminated: indexerpb.ENTITY_STATE_TERMINATED,
+}
+
+// EntitySearcher searches the indexed entities.
+type EntitySearcher interface {
+	Search(ctx context.Context, req *md.SearchRequest) (*md.SearchResult, error)
+}
+
+// SearchServer is the GRPC server which searches the entities in the metadata index.
+type SearchServer struct {
+	searcher EntitySearcher
+}
+
+// NewSearchServer creates a new search server.
+func NewSearchServer(searcher EntitySearcher) *SearchServer {
+	return &SearchServer{searcher: searcher}
+}
+
+// entityNamespace returns the namespace of the entity. Pods and services are named "<namespace>/<name>".
+func entityNamespace(e *md.EsMDEntity) string {
+	switch md.EsMDType(e.Kind) {
+	case md.EsMDTypeNamespace:
+		return e.Name
+	case md.EsMDTypeNode:
+		return ""
+	}
+	if e.NS != "" {
+		return e.NS
+	}
+	if idx := strings.Index(e.Name, "/"); idx >= 0 {
+		return e.Name[:idx]
+	}
+	return ""
+}
+
+// Search finds the entities of the org whose names match the query.
+func (s *SearchServer) Search(ctx context.Context, req *indexerpb.SearchRequest) (*indexerpb.SearchResponse, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if orgID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "missing org ID")
+	}
+	if req.PageSize < 0 || req.PageSize > maxSearchPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page size must be between 0 and %d", maxSearchPageSize)
+	}
+
+	kinds := make([]md.EsMDType, len(req.Kinds))
+	for i, k := range req.Kinds {
+		esType, ok := kindToEsType[k]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown entity kind %s", k.String())
+		}
+		kinds[i] = esType
+	}
+
+	res, err := s.searcher.Search(ctx, &md.SearchRequest{
+		OrgID:      orgID,
+		Query:      strings.TrimSpace(req.Query),
+		Kinds:      kinds,
+		ClusterUID: req.ClusterUID,
+		Namespace:  req.Namespace,
+		Limit:      int(req.PageSize),
+		Cursor:     req.Cursor,
+	})
+	if err == md.ErrInvalidCursor {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to search entities: %s", err.Error())
+	}
+
+	resp := &indexerpb.SearchResponse{
+		Results:    make([]*indexerpb.SearchResult, len(res.Hits)),
+		NextCursor: res.NextCursor,
+	}
+	for i, h := range res.Hits {
+		resp.Results[i] = &indexerpb.SearchResult{
+			Kind:       esTypeToKind[md.EsMDType(h.Entity.Kind)],
+			Name:       h.Entity.Name,
+			Namespace:  entityNamespace(h.Entity),
+			UID:        h.Entity.UID,
+			ClusterUID: h.Entity.ClusterUID,
+			VizierID:   utils.ProtoFromUUIDStrOrNil(h.Entity.VizierID),
+			State:      esStateToState[h.Entity.State],
+			Score:      float32(h.Score),
+		}
+	}
+	return resp, nil
+}
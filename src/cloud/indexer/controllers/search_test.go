@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/indexer/controllers"
+	"px.dev/pixie/src/cloud/indexer/indexerpb"
+	"px.dev/pixie/src/cloud/indexer/md"
+	"px.dev/pixie/src/utils"
+)
+
+type fakeSearcher struct {
+	req *md.SearchRequest
+	res *md.SearchResult
+	err error
+}
+
+func (f *fakeSearcher) Search(ctx context.Context, req *md.SearchRequest) (*md.SearchResult, error) {
+	f.req = req
+	return f.res, f.err
+}
+
+func TestSearchServer_Search(t *testing.T) {
+	orgID := uuid.Must(uuid.NewV4())
+	vzID := uuid.Must(uuid.NewV4())
+	searcher := &fakeSearcher{
+		res: &md.SearchResult{
+			Hits: []*md.SearchHit{
+				{
+					Entity: &md.EsMDEntity{
+						UID:        "1",
+						Name:       "default/frontend",
+						Kind:       "service",
+						ClusterUID: "cluster1",
+						VizierID:   vzID.String(),
+						State:      md.ESMDEntityStateRunning,
+					},
+					Score: 12.5,
+				},
+				{
+					Entity: &md.EsMDEntity{
+						UID:        "2",
+						Name:       "default",
+						Kind:       "namespace",
+						ClusterUID: "cluster1",
+						VizierID:   vzID.String(),
+						State:      md.ESMDEntityStateTerminated,
+					},
+					Score: 1,
+				},
+			},
+			NextCursor: "abc",
+		},
+	}
+	s := controllers.NewSearchServer(searcher)
+
+	resp, err := s.Search(context.Background(), &indexerpb.SearchRequest{
+		OrgID:      utils.ProtoFromUUID(orgID),
+		Query:      " frontend ",
+		Kinds:      []indexerpb.EntityKind{indexerpb.ENTITY_KIND_SERVICE, indexerpb.ENTITY_KIND_NAMESPACE},
+		ClusterUID: "cluster1",
+		PageSize:   2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &md.SearchRequest{
+		OrgID:      orgID,
+		Query:      "frontend",
+		Kinds:      []md.EsMDType{md.EsMDTypeService, md.EsMDTypeNamespace},
+		ClusterUID: "cluster1",
+		Limit:      2,
+	}, searcher.req)
+	assert.Equal(t, &indexerpb.SearchResponse{
+		Results: []*indexerpb.SearchResult{
+			{
+				Kind:       indexerpb.ENTITY_KIND_SERVICE,
+				Name:       "default/frontend",
+				Namespace:  "default",
+				UID:        "1",
+				ClusterUID: "cluster1",
+				VizierID:   utils.ProtoFromUUID(vzID),
+				State:      indexerpb.ENTITY_STATE_RUNNING,
+				Score:      12.5,
+			},
+			{
+				Kind:       indexerpb.ENTITY_KIND_NAMESPACE,
+				Name:       "default",
+				Namespace:  "default",
+				UID:        "2",
+				ClusterUID: "cluster1",
+				VizierID:   utils.ProtoFromUUID(vzID),
+				State:      indexerpb.ENTITY_STATE_TERMINATED,
+				Score:      1,
+			},
+		},
+		NextCursor: "abc",
+	}, resp)
+}
+
+func TestSearchServer_Search_InvalidRequest(t *testing.T) {
+	orgID := utils.ProtoFromUUID(uuid.Must(uuid.NewV4()))
+	tests := []struct {
+		name string
+		req  *indexerpb.SearchRequest
+		err  error
+	}{
+		{
+			name: "missing org",
+			req:  &indexerpb.SearchRequest{Query: "frontend"},
+		},
+		{
+			name: "page too large",
+			req:  &indexerpb.SearchRequest{OrgID: orgID, PageSize: 1000},
+		},
+		{
+			name: "unknown kind",
+			req:  &indexerpb.SearchRequest{OrgID: orgID, Kinds: []indexerpb.EntityKind{indexerpb.ENTITY_KIND_UNKNOWN}},
+		},
+		{
+			name: "invalid cursor",
+			req:  &indexerpb.SearchRequest{OrgID: orgID, Cursor: "abc"},
+			err:  md.ErrInvalidCursor,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := controllers.NewSearchServer(&fakeSearcher{res: &md.SearchResult{}, err: test.err})
+			_, err := s.Search(context.Background(), test.req)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
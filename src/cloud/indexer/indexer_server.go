@@ -19,6 +19,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	_ "net/http/pprof"
 
@@ -28,12 +29,16 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"px.dev/pixie/src/cloud/indexer/controllers"
+	"px.dev/pixie/src/cloud/indexer/indexerpb"
 	"px.dev/pixie/src/cloud/indexer/md"
 	"px.dev/pixie/src/cloud/shared/esutils"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/services"
+	"px.dev/pixie/src/shared/services/election"
 	"px.dev/pixie/src/shared/services/env"
 	"px.dev/pixie/src/shared/services/healthz"
 	"px.dev/pixie/src/shared/services/metrics"
@@ -54,6 +59,38 @@ func init() {
 	pflag.String("md_index_delete_after", "", "The amount of time after rollover to delete old elastic indices, as a string, eg '30d'")
 	pflag.Int("md_index_replicas", 4, "The number of replicas to setup for the metadata index.")
 	pflag.Bool("md_manual_index_management", false, "Skip creation of managed elastic indices. Requires manually deploying an elastic index with md_index_name")
+	pflag.String("pod_namespace", "plc", "The namespace this pod runs in.")
+}
+
+// indexerSingleton runs the indexer on the replica that is the leader. The other replicas stay connected to NATS,
+// elastic and vzmgr, so that they can take over immediately.
+type indexerSingleton struct {
+	nc          *nats.Conn
+	vzmgrClient vzmgrpb.VZMgrServiceClient
+	strmr       msgbus.Streamer
+	es          *elastic.Client
+	indexName   string
+
+	indexer *controllers.Indexer
+}
+
+func (s *indexerSingleton) Promote(ctx context.Context, state []byte) error {
+	indexer, err := controllers.NewIndexer(s.nc, s.vzmgrClient, s.strmr, s.es, s.indexName, "00", "ff")
+	if err != nil {
+		return err
+	}
+	s.indexer = indexer
+	return nil
+}
+
+func (s *indexerSingleton) Demote() {
+	s.indexer.Stop()
+	s.indexer = nil
+}
+
+// Checkpoint returns no state, since the progress of the indexer is tracked by its durable JetStream consumers.
+func (s *indexerSingleton) Checkpoint() ([]byte, error) {
+	return nil, nil
 }
 
 func newVZMgrClient() (vzmgrpb.VZMgrServiceClient, error) {
@@ -143,13 +180,43 @@ func main() {
 		log.WithError(err).Fatal("Could not connect to vzmgr")
 	}
 
-	indexer, err := controllers.NewIndexer(nc, vzmgrClient, strmr, es, indexName, "00", "ff")
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Fatal("Could not get in-cluster config")
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
-		log.WithError(err).Fatal("Could not start indexer")
+		log.WithError(err).Fatal("Could not create K8s client")
 	}
 
-	defer indexer.Stop()
+	standby, err := election.NewWarmStandby(clientset, viper.GetString("pod_namespace"), "indexer-election", &indexerSingleton{
+		nc:          nc,
+		vzmgrClient: vzmgrClient,
+		strmr:       strmr,
+		es:          es,
+		indexName:   indexName,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Could not set up leader election")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	standbyDone := make(chan struct{})
+	go func() {
+		defer close(standbyDone)
+		err := standby.Run(ctx)
+		if err != nil {
+			log.WithError(err).Fatal("Could not run leader election")
+		}
+	}()
+
+	// Every replica serves searches, not just the leader.
+	indexerpb.RegisterIndexerServiceServer(s.GRPCServer(), controllers.NewSearchServer(md.NewSearcher(es, indexName)))
 
 	s.Start()
 	s.StopOnInterrupt()
+
+	// Stop indexing and release the lease, so that a standby takes over right away.
+	cancel()
+	<-standbyDone
 }
@@ -169,7 +169,12 @@ const IndexMapping = `
         "eager_global_ordinals": true
       },
       "uid": {
-        "type": "text"
+        "type": "text",
+        "fields": {
+          "keyword": {
+            "type": "keyword"
+          }
+        }
       },
       "name": {
         "type": "text",
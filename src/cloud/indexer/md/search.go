@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package md
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/gofrs/uuid"
+	"github.com/olivere/elastic/v7"
+)
+
+// ErrInvalidCursor is returned when the cursor of a search wasn't returned by a previous search.
+var ErrInvalidCursor = errors.New("invalid search cursor")
+
+// SearchableTypes are the kinds of entities that are searched when a search doesn't specify any.
+var SearchableTypes = []EsMDType{EsMDTypeNamespace, EsMDTypeService, EsMDTypePod, EsMDTypeNode}
+
+const (
+	// DefaultSearchLimit is the number of results in a page of a search that doesn't specify a limit.
+	DefaultSearchLimit = 20
+	// exactMatchBoost ranks entities whose whole name is the query above partial matches.
+	exactMatchBoost = 10
+	// prefixMatchBoost ranks entities whose names match every term of the query above fuzzy matches.
+	prefixMatchBoost = 2
+	// liveEntityBoost ranks running and pending entities above terminated ones.
+	liveEntityBoost = 0.5
+)
+
+// SearchRequest is a search for the entities of an org, across kinds and clusters.
+type SearchRequest struct {
+	OrgID uuid.UUID
+	// Query is matched against the names of the entities, with some typo tolerance.
+	Query string
+	Kinds []EsMDType
+	// ClusterUID and Namespace filter the entities, if set.
+	ClusterUID string
+	Namespace  string
+	Limit      int
+	// Cursor is the NextCursor of the previous page of results.
+	Cursor string
+}
+
+// SearchHit is an entity that matched a search.
+type SearchHit struct {
+	Entity *EsMDEntity
+	Score  float64
+}
+
+// SearchResult is a page of the entities that matched a search.
+type SearchResult struct {
+	Hits []*SearchHit
+	// NextCursor is the cursor of the next page of results, or empty if there are none.
+	NextCursor string
+}
+
+func encodeCursor(sortValues []interface{}) (string, error) {
+	b, err := json.Marshal(sortValues)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var sortValues []interface{}
+	if err := json.Unmarshal(b, &sortValues); err != nil || len(sortValues) != 3 {
+		return nil, ErrInvalidCursor
+	}
+	return sortValues, nil
+}
+
+// Searcher searches the entities in a metadata index.
+type Searcher struct {
+	es        *elastic.Client
+	indexName string
+}
+
+// NewSearcher creates a searcher for the metadata index.
+func NewSearcher(es *elastic.Client, indexName string) *Searcher {
+	return &Searcher{es: es, indexName: indexName}
+}
+
+func searchQuery(req *SearchRequest) *elastic.BoolQuery {
+	q := elastic.NewBoolQuery()
+	q.Filter(elastic.NewTermQuery("orgID", req.OrgID.String()))
+	if req.ClusterUID != "" {
+		q.Filter(elastic.NewTermQuery("clusterUID", req.ClusterUID))
+	}
+
+	kinds := req.Kinds
+	if len(kinds) == 0 {
+		kinds = SearchableTypes
+	}
+	kindValues := make([]interface{}, len(kinds))
+	for i, k := range kinds {
+		kindValues[i] = string(k)
+	}
+	q.Filter(elastic.NewTermsQuery("kind", kindValues...))
+
+	if req.Namespace != "" {
+		// Pods and services are named "<namespace>/<name>", so the namespace is a prefix of their names.
+		nsQuery := elastic.NewBoolQuery().
+			Should(elastic.NewBoolQuery().
+				Filter(elastic.NewTermQuery("kind", string(EsMDTypeNamespace))).
+				Filter(elastic.NewTermQuery("name.keyword", req.Namespace))).
+			Should(elastic.NewPrefixQuery("name.keyword", req.Namespace+"/")).
+			MinimumNumberShouldMatch(1)
+		q.Filter(nsQuery)
+	}
+
+	if req.Query == "" {
+		q.Must(elastic.NewMatchAllQuery())
+	} else {
+		q.Must(elastic.NewBoolQuery().
+			Should(elastic.NewTermQuery("name.keyword", req.Query).Boost(exactMatchBoost)).
+			Should(elastic.NewMatchQuery("name", req.Query).Operator("and").Boost(prefixMatchBoost)).
+			Should(elastic.NewMatchQuery("name", req.Query).Fuzziness("AUTO")).
+			MinimumNumberShouldMatch(1))
+	}
+
+	q.Should(elastic.NewTermsQuery("state", ESMDEntityStateRunning, ESMDEntityStatePending).Boost(liveEntityBoost))
+	return q
+}
+
+// Search finds the entities that match the search, ordered by relevance. Pages of results are fetched with
+// search_after, so that deep pages are as cheap as the first one.
+func (s *Searcher) Search(ctx context.Context, req *SearchRequest) (*SearchResult, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	search := s.es.Search(s.indexName).
+		Query(searchQuery(req)).
+		SortBy(
+			elastic.NewScoreSort(),
+			elastic.NewFieldSort("name.keyword").Asc(),
+			elastic.NewFieldSort("uid.keyword").Asc()).
+		// Fetch one more result than the limit, so that we know whether there is another page.
+		Size(limit + 1)
+	if req.Cursor != "" {
+		sortValues, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		search = search.SearchAfter(sortValues...)
+	}
+
+	resp, err := search.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SearchResult{}
+	for i, h := range resp.Hits.Hits {
+		if i == limit {
+			res.NextCursor, err = encodeCursor(resp.Hits.Hits[i-1].Sort)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		entity := &EsMDEntity{}
+		if err := json.Unmarshal(h.Source, entity); err != nil {
+			return nil, err
+		}
+		hit := &SearchHit{Entity: entity}
+		if h.Score != nil {
+			hit.Score = *h.Score
+		}
+		res.Hits = append(res.Hits, hit)
+	}
+	return res, nil
+}
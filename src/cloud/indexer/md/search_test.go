@@ -0,0 +1,125 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package md_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/indexer/md"
+)
+
+func indexSearchEntities(t *testing.T, searchOrgID uuid.UUID) {
+	entities := []*md.EsMDEntity{
+		{UID: "s1", Name: "default", Kind: "namespace", ClusterUID: "cluster1", State: md.ESMDEntityStateRunning},
+		{UID: "s2", Name: "default/frontend", Kind: "service", ClusterUID: "cluster1", State: md.ESMDEntityStateRunning},
+		{UID: "s3", Name: "default/frontend-abcd", Kind: "pod", ClusterUID: "cluster1", State: md.ESMDEntityStateRunning},
+		{UID: "s4", Name: "default/frontend-efgh", Kind: "pod", ClusterUID: "cluster1", State: md.ESMDEntityStateTerminated},
+		{UID: "s5", Name: "kube-system/frontend-proxy", Kind: "pod", ClusterUID: "cluster2", State: md.ESMDEntityStateRunning},
+		{UID: "s6", Name: "frontend-node", Kind: "node", ClusterUID: "cluster2", State: md.ESMDEntityStateRunning},
+		{UID: "s7", Name: "default/backend", Kind: "service", ClusterUID: "cluster1", State: md.ESMDEntityStateRunning},
+	}
+	for _, e := range entities {
+		e.OrgID = searchOrgID.String()
+		e.VizierID = vzID.String()
+		e.RelatedEntityNames = []string{}
+		_, err := elasticClient.Index().
+			Index(indexName).
+			Id(fmt.Sprintf("%s-%s", searchOrgID, e.UID)).
+			BodyJson(e).
+			Refresh("true").
+			Do(context.Background())
+		require.NoError(t, err)
+	}
+}
+
+func hitNames(res *md.SearchResult) []string {
+	names := make([]string, len(res.Hits))
+	for i, h := range res.Hits {
+		names[i] = h.Entity.Name
+	}
+	return names
+}
+
+func TestSearcher_Search(t *testing.T) {
+	searchOrgID := uuid.Must(uuid.NewV4())
+	indexSearchEntities(t, searchOrgID)
+	searcher := md.NewSearcher(elasticClient, indexName)
+	ctx := context.Background()
+
+	t.Run("exact match ranks first", func(t *testing.T) {
+		res, err := searcher.Search(ctx, &md.SearchRequest{OrgID: searchOrgID, Query: "default/frontend"})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.Hits)
+		assert.Equal(t, "default/frontend", res.Hits[0].Entity.Name)
+	})
+
+	t.Run("tolerates typos", func(t *testing.T) {
+		res, err := searcher.Search(ctx, &md.SearchRequest{OrgID: searchOrgID, Query: "fronend"})
+		require.NoError(t, err)
+		assert.Contains(t, hitNames(res), "default/frontend")
+	})
+
+	t.Run("filters by kind, cluster and namespace", func(t *testing.T) {
+		res, err := searcher.Search(ctx, &md.SearchRequest{
+			OrgID:      searchOrgID,
+			Query:      "frontend",
+			Kinds:      []md.EsMDType{md.EsMDTypePod},
+			ClusterUID: "cluster1",
+		})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"default/frontend-abcd", "default/frontend-efgh"}, hitNames(res))
+
+		res, err = searcher.Search(ctx, &md.SearchRequest{OrgID: searchOrgID, Namespace: "default"})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{
+			"default", "default/frontend", "default/frontend-abcd", "default/frontend-efgh", "default/backend",
+		}, hitNames(res))
+	})
+
+	t.Run("paginates with cursor", func(t *testing.T) {
+		var names []string
+		cursor := ""
+		for i := 0; i < 10; i++ {
+			res, err := searcher.Search(ctx, &md.SearchRequest{OrgID: searchOrgID, Limit: 2, Cursor: cursor})
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(res.Hits), 2)
+			names = append(names, hitNames(res)...)
+			cursor = res.NextCursor
+			if cursor == "" {
+				break
+			}
+		}
+		assert.Len(t, names, 7)
+		assert.ElementsMatch(t, names, []string{
+			"default", "default/frontend", "default/frontend-abcd", "default/frontend-efgh",
+			"kube-system/frontend-proxy", "frontend-node", "default/backend",
+		})
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := searcher.Search(ctx, &md.SearchRequest{OrgID: searchOrgID, Cursor: "not-a-cursor"})
+		assert.Equal(t, md.ErrInvalidCursor, err)
+	})
+}
@@ -38,6 +38,7 @@ import (
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
 	"px.dev/pixie/src/cloud/plugin/pluginpb"
+	"px.dev/pixie/src/cloud/shared/residency"
 	"px.dev/pixie/src/shared/scripts"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/events"
@@ -50,17 +51,20 @@ type Server struct {
 	dbKey string
 
 	cronScriptClient cronscriptpb.CronScriptServiceClient
+	// residency enforces org data residency policies on retention exports. Nil disables enforcement.
+	residency *residency.Enforcer
 
 	done chan struct{}
 	once sync.Once
 }
 
 // New creates a new server.
-func New(db *sqlx.DB, dbKey string, cronScriptClient cronscriptpb.CronScriptServiceClient) *Server {
+func New(db *sqlx.DB, dbKey string, cronScriptClient cronscriptpb.CronScriptServiceClient, enforcer *residency.Enforcer) *Server {
 	return &Server{
 		db:               db,
 		dbKey:            dbKey,
 		cronScriptClient: cronScriptClient,
+		residency:        enforcer,
 		done:             make(chan struct{}),
 	}
 }
@@ -81,6 +85,19 @@ func contextWithAuthToken(ctx context.Context) (context.Context, error) {
 		fmt.Sprintf("bearer %s", sCtx.AuthToken)), nil
 }
 
+// checkDataResidency returns an error if retention exports for the org may not be configured from this region.
+// The context must already carry the caller's auth token.
+func (s *Server) checkDataResidency(ctx context.Context, orgID uuid.UUID) error {
+	if s.residency == nil {
+		return nil
+	}
+	err := s.residency.Check(ctx, orgID, "retention_export")
+	if err == residency.ErrRegionNotPermitted {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
 // PluginService implementation.
 
 // Plugin contains metadata about a plugin.
@@ -512,22 +529,14 @@ func (s *Server) propagateConfigChangesToScripts(ctx context.Context, txn *sqlx.
 		if exportURL == "" {
 			exportURL = pluginExportURL
 		}
-		config := &scripts.Config{
-			OtelEndpointConfig: &scripts.OtelEndpointConfig{
-				URL:      exportURL,
-				Headers:  configMap,
-				Insecure: insecureTLS,
-			},
-		}
-
-		mConfig, err := yaml.Marshal(&config)
+		configYAML, err := scriptConfigToYAML(pluginID, configMap, exportURL, insecureTLS)
 		if err != nil {
-			return status.Error(codes.Internal, "failed to marshal configs")
+			return err
 		}
 
 		_, err = s.cronScriptClient.UpdateScript(ctx, &cronscriptpb.UpdateScriptRequest{
 			ScriptId: utils.ProtoFromUUID(sc.ScriptID),
-			Configs:  &types.StringValue{Value: string(mConfig)},
+			Configs:  &types.StringValue{Value: configYAML},
 			OrgID:    utils.ProtoFromUUID(orgID),
 		})
 		if err != nil {
@@ -618,6 +627,19 @@ func (s *Server) UpdateOrgRetentionPluginConfig(ctx context.Context, req *plugin
 		customExportURL = nil
 	}
 
+	if req.PluginID == WebhookPluginID && (req.Enabled == nil || req.Enabled.Value) {
+		configMap := map[string]string(req.Configurations)
+		if configurations == nil && len(origConfig) > 0 {
+			err = json.Unmarshal(origConfig, &configMap)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+		if err := validateWebhookConfig(configMap, customExportURL); err != nil {
+			return nil, err
+		}
+	}
+
 	if req.InsecureTLS != nil && allowInsecureTLS {
 		insecureTLS = req.InsecureTLS.Value
 	} else if !allowInsecureTLS {
@@ -629,6 +651,13 @@ func (s *Server) UpdateOrgRetentionPluginConfig(ctx context.Context, req *plugin
 		return nil, err
 	}
 
+	// Disabling retention is always allowed, so that an org can stop exports from a region it doesn't permit.
+	if req.Enabled == nil || req.Enabled.Value {
+		if err := s.checkDataResidency(ctx, orgID); err != nil {
+			return nil, err
+		}
+	}
+
 	if !enabled && req.Enabled != nil && req.Enabled.Value { // Plugin was just enabled, we should create it.
 		disablePresets := false
 		if req.DisablePresets != nil {
@@ -829,7 +858,7 @@ func (s *Server) createRetentionScript(ctx context.Context, txn *sqlx.Tx, orgID
 		exportURL = rs.ExportURL
 	}
 
-	configYAML, err := scriptConfigToYAML(configMap, exportURL, insecureTLS)
+	configYAML, err := scriptConfigToYAML(pluginID, configMap, exportURL, insecureTLS)
 	if err != nil {
 		return nil, err
 	}
@@ -880,6 +909,10 @@ func (s *Server) CreateRetentionScript(ctx context.Context, req *pluginpb.Create
 		return nil, err
 	}
 
+	if err := s.checkDataResidency(ctx, orgID); err != nil {
+		return nil, err
+	}
+
 	id, err := s.createRetentionScript(ctx, txn, orgID, req.Script.Script.PluginId, &RetentionScript{
 		ScriptName:  req.Script.Script.ScriptName,
 		Description: req.Script.Script.Description,
@@ -945,7 +978,7 @@ func (s *Server) getPluginConfigs(txn *sqlx.Tx, orgID uuid.UUID, pluginID string
 	return pluginExportURL, configMap, insecureTLS, nil
 }
 
-func scriptConfigToYAML(configMap map[string]string, exportURL string, insecureTLS bool) (string, error) {
+func scriptConfigToYAML(pluginID string, configMap map[string]string, exportURL string, insecureTLS bool) (string, error) {
 	config := &scripts.Config{
 		OtelEndpointConfig: &scripts.OtelEndpointConfig{
 			URL:      exportURL,
@@ -953,6 +986,13 @@ func scriptConfigToYAML(configMap map[string]string, exportURL string, insecureT
 			Insecure: insecureTLS,
 		},
 	}
+	if pluginID == WebhookPluginID {
+		var err error
+		config, err = webhookScriptConfig(configMap, exportURL)
+		if err != nil {
+			return "", err
+		}
+	}
 
 	mConfig, err := yaml.Marshal(&config)
 	if err != nil {
@@ -1002,6 +1042,10 @@ func (s *Server) UpdateRetentionScript(ctx context.Context, req *pluginpb.Update
 		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized")
 	}
 
+	if err := s.checkDataResidency(ctx, script.OrgID); err != nil {
+		return nil, err
+	}
+
 	// Fetch config + headers from plugin info.
 	pluginExportURL, configMap, insecureTLS, err := s.getPluginConfigs(txn, script.OrgID, script.PluginID)
 	if err != nil {
@@ -1038,7 +1082,7 @@ func (s *Server) UpdateRetentionScript(ctx context.Context, req *pluginpb.Update
 	if exportURL == "" {
 		configExportURL = pluginExportURL
 	}
-	configYAML, err := scriptConfigToYAML(configMap, configExportURL, insecureTLS)
+	configYAML, err := scriptConfigToYAML(script.PluginID, configMap, configExportURL, insecureTLS)
 	if err != nil {
 		return nil, err
 	}
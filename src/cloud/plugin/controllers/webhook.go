@@ -0,0 +1,153 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/shared/scripts"
+)
+
+const (
+	// WebhookPluginID is the ID of the built-in plugin that POSTs script results to an HTTPS endpoint.
+	WebhookPluginID = "webhook"
+	// WebhookPluginVersion is the version of the built-in webhook plugin.
+	WebhookPluginVersion = "0.0.1"
+
+	// The configurations of the webhook plugin which are not sent as headers.
+	webhookPayloadTemplateKey = "payload_template"
+	webhookBatchSizeKey       = "batch_size"
+	webhookMaxRetriesKey      = "max_retries"
+
+	defaultWebhookBatchSize  = 500
+	maxWebhookBatchSize      = 10000
+	defaultWebhookMaxRetries = 3
+	maxWebhookMaxRetries     = 10
+)
+
+// WebhookPlugin returns the release of the built-in webhook plugin.
+func WebhookPlugin() (*Plugin, *RetentionPlugin) {
+	description := "Send the results of scripts to any HTTPS endpoint as JSON."
+	defaultExportURL := ""
+	plugin := &Plugin{
+		Name:                 "Webhook",
+		ID:                   WebhookPluginID,
+		Description:          &description,
+		Version:              WebhookPluginVersion,
+		DataRetentionEnabled: true,
+	}
+	retention := &RetentionPlugin{
+		ID:      WebhookPluginID,
+		Version: WebhookPluginVersion,
+		Configurations: Configurations{
+			"Authorization":           "The value of the Authorization header sent with each request. Any other configuration which is not listed here is also sent as a header.",
+			webhookPayloadTemplateKey: "A Go template which renders each batch of rows into the JSON body of a request. The template is executed with .ScriptID, .BatchID, .Table and .Rows, and can use the json function.",
+			webhookBatchSizeKey:       fmt.Sprintf("The maximum number of rows sent in each request. Defaults to %d.", defaultWebhookBatchSize),
+			webhookMaxRetriesKey:      fmt.Sprintf("The number of times a failed request is retried. Defaults to %d.", defaultWebhookMaxRetries),
+		},
+		DefaultExportURL:     &defaultExportURL,
+		AllowCustomExportURL: true,
+		PresetScripts:        PresetScripts{},
+	}
+	return plugin, retention
+}
+
+func parseWebhookIntConfig(configMap map[string]string, key string, defaultValue int, maxValue int) (int, error) {
+	v, ok := configMap[key]
+	if !ok || v == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 || i > maxValue {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be a number between 0 and %d", key, maxValue)
+	}
+	return i, nil
+}
+
+func validateWebhookURL(exportURL string) error {
+	u, err := url.Parse(exportURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return status.Error(codes.InvalidArgument, "webhook export URL must be an https URL")
+	}
+	return nil
+}
+
+// webhookConfigFromConfigurations returns the webhook config for the org's configuration of the webhook
+// plugin, without the URL. Configurations which aren't options of the webhook are sent as headers.
+func webhookConfigFromConfigurations(configMap map[string]string) (*scripts.WebhookConfig, error) {
+	tmpl := configMap[webhookPayloadTemplateKey]
+	if _, err := scripts.ParseWebhookPayloadTemplate(tmpl); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid payload template: %v", err)
+	}
+	batchSize, err := parseWebhookIntConfig(configMap, webhookBatchSizeKey, defaultWebhookBatchSize, maxWebhookBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize == 0 {
+		batchSize = defaultWebhookBatchSize
+	}
+	maxRetries, err := parseWebhookIntConfig(configMap, webhookMaxRetriesKey, defaultWebhookMaxRetries, maxWebhookMaxRetries)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	for k, v := range configMap {
+		switch k {
+		case webhookPayloadTemplateKey, webhookBatchSizeKey, webhookMaxRetriesKey:
+		default:
+			headers[k] = v
+		}
+	}
+	return &scripts.WebhookConfig{
+		Headers:         headers,
+		PayloadTemplate: tmpl,
+		BatchSize:       batchSize,
+		MaxRetries:      maxRetries,
+	}, nil
+}
+
+// validateWebhookConfig checks the org's configuration of the webhook plugin. The export URL is optional,
+// since each script can specify its own.
+func validateWebhookConfig(configMap map[string]string, customExportURL *string) error {
+	if customExportURL != nil && *customExportURL != "" {
+		if err := validateWebhookURL(*customExportURL); err != nil {
+			return err
+		}
+	}
+	_, err := webhookConfigFromConfigurations(configMap)
+	return err
+}
+
+// webhookScriptConfig returns the config of a script which exports to the webhook plugin.
+func webhookScriptConfig(configMap map[string]string, exportURL string) (*scripts.Config, error) {
+	if err := validateWebhookURL(exportURL); err != nil {
+		return nil, err
+	}
+	config, err := webhookConfigFromConfigurations(configMap)
+	if err != nil {
+		return nil, err
+	}
+	config.URL = exportURL
+	return &scripts.Config{WebhookConfig: config}, nil
+}
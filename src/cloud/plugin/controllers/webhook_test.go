@@ -0,0 +1,127 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+
+	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
+	mock_cronscriptpb "px.dev/pixie/src/cloud/cron_script/cronscriptpb/mock"
+	"px.dev/pixie/src/cloud/plugin/controllers"
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
+	"px.dev/pixie/src/shared/scripts"
+	"px.dev/pixie/src/utils"
+)
+
+func mustLoadWebhookPlugin(db *sqlx.DB) {
+	plugin, retention := controllers.WebhookPlugin()
+	insertRelease := `INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled) VALUES ($1, $2, $3, $4, $5, $6)`
+	db.MustExec(insertRelease, plugin.Name, plugin.ID, plugin.Description, plugin.Logo, plugin.Version, plugin.DataRetentionEnabled)
+	insertRetentionRelease := `INSERT INTO data_retention_plugin_releases(plugin_id, version, configurations, preset_scripts, documentation_url, default_export_url, allow_custom_export_url, allow_insecure_tls) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	db.MustExec(insertRetentionRelease, retention.ID, retention.Version, retention.Configurations, retention.PresetScripts,
+		retention.DocumentationURL, retention.DefaultExportURL, retention.AllowCustomExportURL, retention.AllowInsecureTLS)
+}
+
+func TestServer_WebhookPlugin(t *testing.T) {
+	mustLoadTestData(db)
+	mustLoadWebhookPlugin(db)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCSClient := mock_cronscriptpb.NewMockCronScriptServiceClient(ctrl)
+
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440003")
+	s := controllers.New(db, "test", mockCSClient, nil)
+
+	_, err := s.UpdateOrgRetentionPluginConfig(createTestContext(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: controllers.WebhookPluginID,
+		Configurations: map[string]string{
+			"batch_size": "many",
+		},
+		Enabled: &types.BoolValue{Value: true},
+		Version: &types.StringValue{Value: controllers.WebhookPluginVersion},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.UpdateOrgRetentionPluginConfig(createTestContext(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: controllers.WebhookPluginID,
+		Configurations: map[string]string{
+			"Authorization":    "Bearer abcd",
+			"batch_size":       "100",
+			"payload_template": `{"events": {{json .Rows}}}`,
+		},
+		Enabled:         &types.BoolValue{Value: true},
+		Version:         &types.StringValue{Value: controllers.WebhookPluginVersion},
+		CustomExportUrl: &types.StringValue{Value: "https://hooks.example.com/pixie"},
+	})
+	require.NoError(t, err)
+
+	config := &scripts.Config{
+		WebhookConfig: &scripts.WebhookConfig{
+			URL:             "https://hooks.example.com/pixie",
+			Headers:         map[string]string{"Authorization": "Bearer abcd"},
+			PayloadTemplate: `{"events": {{json .Rows}}}`,
+			BatchSize:       100,
+			MaxRetries:      3,
+		},
+	}
+	mConfig, err := yaml.Marshal(&config)
+	require.NoError(t, err)
+
+	mockCSClient.EXPECT().CreateScript(gomock.Any(), &cronscriptpb.CreateScriptRequest{
+		Script:     "px.display()",
+		Configs:    string(mConfig),
+		FrequencyS: 20,
+		OrgID:      orgID,
+	}).Return(&cronscriptpb.CreateScriptResponse{
+		ID: utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440010"),
+	}, nil)
+
+	createReq := &pluginpb.CreateRetentionScriptRequest{
+		Script: &pluginpb.DetailedRetentionScript{
+			Script: &pluginpb.RetentionScript{
+				ScriptName: "Webhook Script",
+				FrequencyS: 20,
+				PluginId:   controllers.WebhookPluginID,
+				Enabled:    true,
+			},
+			Contents: "px.display()",
+		},
+		OrgID: orgID,
+	}
+	_, err = s.CreateRetentionScript(createTestContext(), createReq)
+	require.NoError(t, err)
+
+	// Webhooks must be sent over HTTPS.
+	createReq.Script.ExportURL = "http://hooks.example.com/pixie"
+	_, err = s.CreateRetentionScript(createTestContext(), createReq)
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package main
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"px.dev/pixie/src/cloud/plugin/controllers"
+)
+
+// loadBuiltinPlugins loads the releases of plugins which are implemented by Pixie itself, rather than
+// by a plugin provider.
+func loadBuiltinPlugins(db *sqlx.DB) {
+	plugin, retention := controllers.WebhookPlugin()
+	addConfigs(plugin, retention, db)
+}
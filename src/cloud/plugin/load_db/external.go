@@ -0,0 +1,118 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"px.dev/pixie/src/cloud/plugin/controllers"
+	"px.dev/pixie/src/cloud/plugin/sdk"
+	"px.dev/pixie/src/cloud/plugin/sdk/sdkpb"
+	"px.dev/pixie/src/shared/services"
+)
+
+const externalPluginTimeout = 30 * time.Second
+
+// loadExternalPlugins loads the releases of plugins which are served by third parties over the plugin SDK.
+func loadExternalPlugins(db *sqlx.DB) {
+	addrs := viper.GetStringSlice("external_plugins")
+	if len(addrs) == 0 {
+		return
+	}
+
+	dialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to get dial options for external plugins")
+	}
+
+	for _, addr := range addrs {
+		plugin, retention, err := fetchExternalPlugin(addr, dialOpts)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to load external plugin at %s", addr)
+			continue
+		}
+		addConfigs(plugin, retention, db)
+	}
+}
+
+func fetchExternalPlugin(addr string, dialOpts []grpc.DialOption) (*controllers.Plugin, *controllers.RetentionPlugin, error) {
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), externalPluginTimeout)
+	defer cancel()
+
+	c, err := sdk.Connect(ctx, conn, sdkpb.CAPABILITY_RETENTION)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Infof("Processing external plugin %s %s (API version %d)", c.Info.ID, c.Info.Version, c.APIVersion)
+
+	plugin := &controllers.Plugin{
+		Name:                 c.Info.Name,
+		ID:                   c.Info.ID,
+		Description:          optionalString(c.Info.Description),
+		Logo:                 optionalString(c.Info.Logo),
+		Version:              c.Info.Version,
+		DataRetentionEnabled: c.HasCapability(sdkpb.CAPABILITY_RETENTION),
+	}
+	if !plugin.DataRetentionEnabled {
+		return plugin, nil, nil
+	}
+
+	resp, err := c.GetRetentionConfig(ctx, &sdkpb.GetRetentionConfigRequest{})
+	if err != nil {
+		return nil, nil, err
+	}
+	retention := &controllers.RetentionPlugin{
+		ID:                   plugin.ID,
+		Version:              plugin.Version,
+		Configurations:       resp.Configurations,
+		DocumentationURL:     optionalString(resp.DocumentationURL),
+		DefaultExportURL:     optionalString(resp.DefaultExportURL),
+		AllowCustomExportURL: resp.AllowCustomExportURL,
+		AllowInsecureTLS:     resp.AllowInsecureTLS,
+	}
+	for _, s := range resp.PresetScripts {
+		retention.PresetScripts = append(retention.PresetScripts, &controllers.PresetScript{
+			Name:              s.Name,
+			Description:       s.Description,
+			DefaultFrequencyS: s.DefaultFrequencyS,
+			Script:            s.Script,
+			DefaultDisabled:   s.DefaultDisabled,
+		})
+	}
+	return plugin, retention, nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -58,6 +58,7 @@ func init() {
 	pflag.String("plugin_repo", "pixie-io/pixie-plugin", "The name of the plugin repo.")
 	pflag.String("plugin_service", "plugin-service.plc.svc.cluster.local:50600", "The plugin service url (load balancer/list is ok)")
 	pflag.String("domain_name", "dev.withpixie.dev", "The domain name of Pixie Cloud")
+	pflag.StringSlice("external_plugins", []string{}, "The addresses of external plugins which implement the plugin SDK")
 }
 
 func initDB() *sqlx.DB {
@@ -338,6 +339,8 @@ func main() {
 		log.WithError(err).Fatal("Failed to connect to plugin service")
 	}
 	loadPlugins(db)
+	loadExternalPlugins(db)
+	loadBuiltinPlugins(db)
 
 	// Auto-update any plugins.
 	UpdatePlugins(db, retentionPluginClient)
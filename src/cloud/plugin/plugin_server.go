@@ -32,7 +32,9 @@ import (
 	"px.dev/pixie/src/cloud/plugin/controllers"
 	"px.dev/pixie/src/cloud/plugin/pluginpb"
 	"px.dev/pixie/src/cloud/plugin/schema"
+	"px.dev/pixie/src/cloud/profile/profilepb"
 	"px.dev/pixie/src/cloud/shared/pgmigrate"
+	"px.dev/pixie/src/cloud/shared/residency"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/env"
 	"px.dev/pixie/src/shared/services/healthz"
@@ -42,6 +44,8 @@ import (
 
 func init() {
 	pflag.String("cron_script_service", "cron-script-service.plc.svc.cluster.local:50700", "The cronscript service url (load balancer/list is ok)")
+	pflag.String("profile_service", "profile-service.plc.svc.cluster.local:51500", "The profile service url (load balancer/list is ok)")
+	pflag.String("data_region", "", "The data residency region (eu, us) this service is deployed in")
 }
 
 // NewCronScriptServiceClient creates a new cron script service RPC client stub.
@@ -59,6 +63,21 @@ func NewCronScriptServiceClient() (cronscriptpb.CronScriptServiceClient, error)
 	return cronscriptpb.NewCronScriptServiceClient(csChannel), nil
 }
 
+// NewOrgServiceClient creates a new org RPC client stub.
+func NewOrgServiceClient() (profilepb.OrgServiceClient, error) {
+	dialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	profileChannel, err := grpc.Dial(viper.GetString("profile_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return profilepb.NewOrgServiceClient(profileChannel), nil
+}
+
 func main() {
 	services.SetupService("plugin-service", 50600)
 	services.PostFlagSetupAndParse()
@@ -88,7 +107,15 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to start cronscript client")
 	}
-	c := controllers.New(db, dbKey, csClient)
+	orgClient, err := NewOrgServiceClient()
+	if err != nil {
+		log.Fatal("Failed to start org client")
+	}
+	enforcer, err := residency.NewEnforcer(orgClient, "plugin", viper.GetString("data_region"))
+	if err != nil {
+		log.WithError(err).Fatal("Invalid data region")
+	}
+	c := controllers.New(db, dbKey, csClient, enforcer)
 
 	pluginpb.RegisterPluginServiceServer(s.GRPCServer(), c)
 	pluginpb.RegisterDataRetentionPluginServiceServer(s.GRPCServer(), c)
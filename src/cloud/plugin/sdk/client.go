@@ -0,0 +1,102 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/blang/semver"
+	"google.golang.org/grpc"
+
+	"px.dev/pixie/src/cloud/plugin/sdk/sdkpb"
+)
+
+// Client is a connection to a plugin which completed the handshake.
+type Client struct {
+	sdkpb.PluginClient
+
+	// APIVersion is the API version that was negotiated with the plugin.
+	APIVersion uint32
+	// Info describes the plugin.
+	Info *sdkpb.PluginInfo
+
+	capabilities map[sdkpb.Capability]bool
+}
+
+// Connect performs the handshake with the plugin, offering the given capabilities. It fails if the plugin does not
+// follow the handshake protocol, so that a misbehaving plugin is never used.
+func Connect(ctx context.Context, conn *grpc.ClientConn, capabilities ...sdkpb.Capability) (*Client, error) {
+	pc := sdkpb.NewPluginClient(conn)
+	resp, err := pc.Handshake(ctx, &sdkpb.HandshakeRequest{
+		APIVersions:  SupportedAPIVersions,
+		Capabilities: capabilities,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("plugin handshake failed: %w", err)
+	}
+
+	if _, ok := negotiateVersion([]uint32{resp.APIVersion}); !ok {
+		return nil, fmt.Errorf("plugin chose API version %d, which was not offered", resp.APIVersion)
+	}
+	if err := ValidateInfo(resp.Info); err != nil {
+		return nil, err
+	}
+
+	offered := make(map[sdkpb.Capability]bool)
+	for _, c := range capabilities {
+		offered[c] = true
+	}
+	c := &Client{
+		PluginClient: pc,
+		APIVersion:   resp.APIVersion,
+		Info:         resp.Info,
+		capabilities: make(map[sdkpb.Capability]bool),
+	}
+	for _, capability := range resp.Capabilities {
+		if !offered[capability] {
+			return nil, fmt.Errorf("plugin %s claimed capability %s, which was not offered", resp.Info.ID, capability)
+		}
+		c.capabilities[capability] = true
+	}
+	return c, nil
+}
+
+// HasCapability returns whether the plugin agreed to provide the capability.
+func (c *Client) HasCapability(capability sdkpb.Capability) bool {
+	return c.capabilities[capability]
+}
+
+// ValidateInfo checks that the plugin info contains everything that Pixie Cloud needs to list the plugin.
+func ValidateInfo(info *sdkpb.PluginInfo) error {
+	if info == nil {
+		return errors.New("plugin did not return its info")
+	}
+	if info.ID == "" {
+		return errors.New("plugin info is missing the ID")
+	}
+	if info.Name == "" {
+		return fmt.Errorf("plugin %s is missing a name", info.ID)
+	}
+	if _, err := semver.Parse(info.Version); err != nil {
+		return fmt.Errorf("plugin %s has invalid version %q, which must be a semantic version: %w", info.ID, info.Version, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package conformance contains tests which every external plugin must pass before it can be used by Pixie Cloud.
+// Plugin writers should run them against their plugin from a go test:
+//
+//	func TestConformance(t *testing.T) {
+//		conn := ... // Connect to the plugin.
+//		conformance.Run(t, conn)
+//	}
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/plugin/sdk"
+	"px.dev/pixie/src/cloud/plugin/sdk/sdkpb"
+)
+
+const rpcTimeout = 10 * time.Second
+
+var allCapabilities = []sdkpb.Capability{sdkpb.CAPABILITY_RETENTION, sdkpb.CAPABILITY_ALERTS}
+
+// Run runs the conformance tests against the plugin served on conn.
+func Run(t *testing.T, conn *grpc.ClientConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	c, err := sdk.Connect(ctx, conn, allCapabilities...)
+	require.NoError(t, err, "plugin must complete the handshake")
+
+	t.Run("handshake", func(t *testing.T) {
+		testHandshake(t, conn)
+	})
+	t.Run("unsupported version", func(t *testing.T) {
+		testUnsupportedVersion(t, conn)
+	})
+	t.Run("capabilities limited to request", func(t *testing.T) {
+		testCapabilitiesLimitedToRequest(t, conn)
+	})
+	if c.HasCapability(sdkpb.CAPABILITY_RETENTION) {
+		t.Run("retention config", func(t *testing.T) {
+			testRetentionConfig(t, c)
+		})
+		t.Run("validate retention config", func(t *testing.T) {
+			testValidateRetentionConfig(t, c)
+		})
+	}
+	if c.HasCapability(sdkpb.CAPABILITY_ALERTS) {
+		t.Run("alerts idempotent", func(t *testing.T) {
+			testAlertsIdempotent(t, c)
+		})
+	}
+	t.Run("undeclared capabilities unimplemented", func(t *testing.T) {
+		testUndeclaredCapabilities(t, c)
+	})
+}
+
+func testHandshake(t *testing.T, conn *grpc.ClientConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	resp, err := sdkpb.NewPluginClient(conn).Handshake(ctx, &sdkpb.HandshakeRequest{
+		APIVersions:  sdk.SupportedAPIVersions,
+		Capabilities: allCapabilities,
+	})
+	require.NoError(t, err)
+	assert.Contains(t, sdk.SupportedAPIVersions, resp.APIVersion)
+	assert.NoError(t, sdk.ValidateInfo(resp.Info))
+	assert.NotEmpty(t, resp.Capabilities, "plugin must provide at least one capability")
+}
+
+func testUnsupportedVersion(t *testing.T, conn *grpc.ClientConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	_, err := sdkpb.NewPluginClient(conn).Handshake(ctx, &sdkpb.HandshakeRequest{
+		APIVersions:  []uint32{0, 1 << 31},
+		Capabilities: allCapabilities,
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func testCapabilitiesLimitedToRequest(t *testing.T, conn *grpc.ClientConn) {
+	for _, capability := range allCapabilities {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		resp, err := sdkpb.NewPluginClient(conn).Handshake(ctx, &sdkpb.HandshakeRequest{
+			APIVersions:  sdk.SupportedAPIVersions,
+			Capabilities: []sdkpb.Capability{capability},
+		})
+		cancel()
+		require.NoError(t, err)
+		for _, c := range resp.Capabilities {
+			assert.Equal(t, capability, c)
+		}
+	}
+}
+
+func testRetentionConfig(t *testing.T, c *sdk.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	resp, err := c.GetRetentionConfig(ctx, &sdkpb.GetRetentionConfigRequest{})
+	require.NoError(t, err)
+	if !resp.AllowCustomExportURL {
+		assert.NotEmpty(t, resp.DefaultExportURL, "a default export URL is required if custom URLs are not allowed")
+	}
+	names := make(map[string]bool)
+	for _, s := range resp.PresetScripts {
+		assert.NotEmpty(t, s.Name, "preset scripts must have a name")
+		assert.NotEmpty(t, s.Script, "preset script %s must have a script", s.Name)
+		assert.Greater(t, s.DefaultFrequencyS, int64(0), "preset script %s must have a frequency", s.Name)
+		assert.False(t, names[s.Name], "preset script %s is not unique", s.Name)
+		names[s.Name] = true
+	}
+}
+
+func testValidateRetentionConfig(t *testing.T, c *sdk.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	cfg, err := c.GetRetentionConfig(ctx, &sdkpb.GetRetentionConfigRequest{})
+	require.NoError(t, err)
+
+	// An empty configuration is the most likely to be invalid. Any errors must point the user at a field that
+	// they can actually fill in.
+	resp, err := c.ValidateRetentionConfig(ctx, &sdkpb.ValidateRetentionConfigRequest{})
+	require.NoError(t, err)
+	for _, fe := range resp.Errors {
+		assert.NotEmpty(t, fe.Message, "field errors must have a message")
+		if fe.Field == "custom_export_url" {
+			continue
+		}
+		_, ok := cfg.Configurations[fe.Field]
+		assert.True(t, ok, "field error references unknown field %q", fe.Field)
+	}
+}
+
+func testAlertsIdempotent(t *testing.T, c *sdk.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	alert := &sdkpb.HandleAlertRequest{
+		AlertID:     "conformance-test-alert",
+		Name:        "Conformance test",
+		Severity:    sdkpb.ALERT_SEVERITY_INFO,
+		Message:     "This alert is sent by the plugin conformance tests.",
+		TimestampNs: time.Now().UnixNano(),
+	}
+	_, err := c.HandleAlert(ctx, alert)
+	require.NoError(t, err)
+	// Alerts are delivered at least once, so redelivery must succeed.
+	_, err = c.HandleAlert(ctx, alert)
+	assert.NoError(t, err)
+}
+
+func testUndeclaredCapabilities(t *testing.T, c *sdk.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	if !c.HasCapability(sdkpb.CAPABILITY_RETENTION) {
+		_, err := c.GetRetentionConfig(ctx, &sdkpb.GetRetentionConfigRequest{})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	}
+	if !c.HasCapability(sdkpb.CAPABILITY_ALERTS) {
+		_, err := c.HandleAlert(ctx, &sdkpb.HandleAlertRequest{AlertID: "conformance-test-alert"})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	}
+}
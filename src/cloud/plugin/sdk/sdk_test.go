@@ -0,0 +1,139 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package sdk_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"px.dev/pixie/src/cloud/plugin/sdk"
+	"px.dev/pixie/src/cloud/plugin/sdk/conformance"
+	"px.dev/pixie/src/cloud/plugin/sdk/sdkpb"
+)
+
+const bufSize = 1024 * 1024
+
+type examplePlugin struct {
+	mu     sync.Mutex
+	alerts map[string]*sdkpb.HandleAlertRequest
+}
+
+func (p *examplePlugin) RetentionConfig(ctx context.Context) (*sdkpb.GetRetentionConfigResponse, error) {
+	return &sdkpb.GetRetentionConfigResponse{
+		Configurations: map[string]string{
+			"api_key": "The API key used to write to the backend.",
+		},
+		PresetScripts: []*sdkpb.PresetScript{
+			{
+				Name:              "HTTP Data",
+				Description:       "HTTP requests in the cluster.",
+				DefaultFrequencyS: 10,
+				Script:            "import px",
+			},
+		},
+		DefaultExportURL: "https://example.com/export",
+	}, nil
+}
+
+func (p *examplePlugin) ValidateRetentionConfig(ctx context.Context, req *sdkpb.ValidateRetentionConfigRequest) ([]*sdkpb.FieldError, error) {
+	if req.Configurations["api_key"] == "" {
+		return []*sdkpb.FieldError{{Field: "api_key", Message: "an API key is required"}}, nil
+	}
+	return nil, nil
+}
+
+func (p *examplePlugin) HandleAlert(ctx context.Context, alert *sdkpb.HandleAlertRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.alerts[alert.AlertID] = alert
+	return nil
+}
+
+var exampleInfo = &sdkpb.PluginInfo{
+	ID:      "example",
+	Name:    "Example",
+	Version: "0.0.1",
+}
+
+func startPlugin(t *testing.T, s *sdk.Server) *grpc.ClientConn {
+	lis := bufconn.Listen(bufSize)
+	grpcServer := grpc.NewServer()
+	s.Register(grpcServer)
+	go func() {
+		_ = grpcServer.Serve(lis)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestConformance_AllCapabilities(t *testing.T) {
+	p := &examplePlugin{alerts: make(map[string]*sdkpb.HandleAlertRequest)}
+	conn := startPlugin(t, sdk.NewServer(exampleInfo, sdk.WithRetention(p), sdk.WithAlerts(p)))
+	conformance.Run(t, conn)
+}
+
+func TestConformance_RetentionOnly(t *testing.T) {
+	p := &examplePlugin{alerts: make(map[string]*sdkpb.HandleAlertRequest)}
+	conn := startPlugin(t, sdk.NewServer(exampleInfo, sdk.WithRetention(p)))
+	conformance.Run(t, conn)
+}
+
+func TestConnect_NegotiatesCapabilities(t *testing.T) {
+	p := &examplePlugin{alerts: make(map[string]*sdkpb.HandleAlertRequest)}
+	conn := startPlugin(t, sdk.NewServer(exampleInfo, sdk.WithRetention(p), sdk.WithAlerts(p)))
+
+	c, err := sdk.Connect(context.Background(), conn, sdkpb.CAPABILITY_RETENTION)
+	require.NoError(t, err)
+	assert.Equal(t, sdk.APIVersion, c.APIVersion)
+	assert.Equal(t, "example", c.Info.ID)
+	assert.True(t, c.HasCapability(sdkpb.CAPABILITY_RETENTION))
+	assert.False(t, c.HasCapability(sdkpb.CAPABILITY_ALERTS))
+}
+
+func TestConnect_InvalidInfo(t *testing.T) {
+	p := &examplePlugin{alerts: make(map[string]*sdkpb.HandleAlertRequest)}
+	conn := startPlugin(t, sdk.NewServer(&sdkpb.PluginInfo{ID: "example", Name: "Example", Version: "latest"}, sdk.WithRetention(p)))
+
+	_, err := sdk.Connect(context.Background(), conn, sdkpb.CAPABILITY_RETENTION)
+	assert.ErrorContains(t, err, "invalid version")
+}
+
+func TestServer_UnsupportedVersion(t *testing.T) {
+	s := sdk.NewServer(exampleInfo)
+	_, err := s.Handshake(context.Background(), &sdkpb.HandshakeRequest{APIVersions: []uint32{sdk.APIVersion + 1}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
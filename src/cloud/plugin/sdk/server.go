@@ -0,0 +1,169 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package sdk is the Go SDK for external Pixie Cloud plugins. Plugin writers implement the interfaces of the
+// capabilities that their plugin provides, and serve them with NewServer. Pixie Cloud connects to plugins with
+// Connect.
+package sdk
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/plugin/sdk/sdkpb"
+)
+
+// APIVersion is the latest version of the plugin API, and the one implemented by this package.
+const APIVersion uint32 = 1
+
+// SupportedAPIVersions are the versions of the plugin API that this package can serve and talk to.
+var SupportedAPIVersions = []uint32{APIVersion}
+
+// RetentionPlugin is implemented by plugins which receive the data of retention scripts.
+type RetentionPlugin interface {
+	// RetentionConfig returns how the plugin's data retention is configured.
+	RetentionConfig(ctx context.Context) (*sdkpb.GetRetentionConfigResponse, error)
+	// ValidateRetentionConfig returns the problems with an org's configuration of the plugin.
+	ValidateRetentionConfig(ctx context.Context, req *sdkpb.ValidateRetentionConfigRequest) ([]*sdkpb.FieldError, error)
+}
+
+// AlertPlugin is implemented by plugins which receive alerts raised by scripts.
+type AlertPlugin interface {
+	// HandleAlert delivers an alert. Alerts may be delivered more than once, with the same ID.
+	HandleAlert(ctx context.Context, alert *sdkpb.HandleAlertRequest) error
+}
+
+// Server serves a plugin over the plugin API.
+type Server struct {
+	info      *sdkpb.PluginInfo
+	retention RetentionPlugin
+	alerts    AlertPlugin
+}
+
+// ServerOption configures the capabilities of a Server.
+type ServerOption func(*Server)
+
+// WithRetention makes the plugin provide CAPABILITY_RETENTION.
+func WithRetention(p RetentionPlugin) ServerOption {
+	return func(s *Server) {
+		s.retention = p
+	}
+}
+
+// WithAlerts makes the plugin provide CAPABILITY_ALERTS.
+func WithAlerts(p AlertPlugin) ServerOption {
+	return func(s *Server) {
+		s.alerts = p
+	}
+}
+
+// NewServer creates a server for the plugin with the given info.
+func NewServer(info *sdkpb.PluginInfo, opts ...ServerOption) *Server {
+	s := &Server{info: info}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register registers the plugin API on the gRPC server.
+func (s *Server) Register(grpcServer *grpc.Server) {
+	sdkpb.RegisterPluginServer(grpcServer, s)
+}
+
+func (s *Server) capabilities() []sdkpb.Capability {
+	var caps []sdkpb.Capability
+	if s.retention != nil {
+		caps = append(caps, sdkpb.CAPABILITY_RETENTION)
+	}
+	if s.alerts != nil {
+		caps = append(caps, sdkpb.CAPABILITY_ALERTS)
+	}
+	return caps
+}
+
+// Handshake picks the latest API version that both sides support, and the capabilities that both sides provide.
+func (s *Server) Handshake(ctx context.Context, req *sdkpb.HandshakeRequest) (*sdkpb.HandshakeResponse, error) {
+	version, ok := negotiateVersion(req.APIVersions)
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "none of the API versions %v are supported, the plugin supports %v",
+			req.APIVersions, SupportedAPIVersions)
+	}
+
+	requested := make(map[sdkpb.Capability]bool)
+	for _, c := range req.Capabilities {
+		requested[c] = true
+	}
+	resp := &sdkpb.HandshakeResponse{
+		APIVersion: version,
+		Info:       s.info,
+	}
+	for _, c := range s.capabilities() {
+		if requested[c] {
+			resp.Capabilities = append(resp.Capabilities, c)
+		}
+	}
+	return resp, nil
+}
+
+// GetRetentionConfig returns the retention configuration of the plugin.
+func (s *Server) GetRetentionConfig(ctx context.Context, req *sdkpb.GetRetentionConfigRequest) (*sdkpb.GetRetentionConfigResponse, error) {
+	if s.retention == nil {
+		return nil, status.Error(codes.Unimplemented, "plugin does not support data retention")
+	}
+	return s.retention.RetentionConfig(ctx)
+}
+
+// ValidateRetentionConfig validates an org's configuration of the plugin.
+func (s *Server) ValidateRetentionConfig(ctx context.Context, req *sdkpb.ValidateRetentionConfigRequest) (*sdkpb.ValidateRetentionConfigResponse, error) {
+	if s.retention == nil {
+		return nil, status.Error(codes.Unimplemented, "plugin does not support data retention")
+	}
+	errs, err := s.retention.ValidateRetentionConfig(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &sdkpb.ValidateRetentionConfigResponse{Errors: errs}, nil
+}
+
+// HandleAlert delivers an alert to the plugin.
+func (s *Server) HandleAlert(ctx context.Context, req *sdkpb.HandleAlertRequest) (*sdkpb.HandleAlertResponse, error) {
+	if s.alerts == nil {
+		return nil, status.Error(codes.Unimplemented, "plugin does not support alerts")
+	}
+	if err := s.alerts.HandleAlert(ctx, req); err != nil {
+		return nil, err
+	}
+	return &sdkpb.HandleAlertResponse{}, nil
+}
+
+// negotiateVersion returns the latest of the offered versions that is supported.
+func negotiateVersion(offered []uint32) (uint32, bool) {
+	var version uint32
+	for _, v := range offered {
+		for _, supported := range SupportedAPIVersions {
+			if v == supported && v > version {
+				version = v
+			}
+		}
+	}
+	return version, version != 0
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	htmltemplate "html/template"
+	"net/url"
+	"sort"
+	texttemplate "text/template"
+	"unicode/utf8"
+
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	defaultProductName = "Pixie"
+	maxProductNameLen  = 256
+	// maxEmailTemplateLen bounds the size of the subject and body of the email templates.
+	maxEmailTemplateLen = 64 * 1024
+)
+
+// defaultEmailTemplates are the email templates that orgs use until they customize them.
+var defaultEmailTemplates = map[string]*datastore.EmailTemplate{
+	"invite": {
+		Name:    "invite",
+		Subject: "You have been invited to {{.OrgName}} on {{.ProductName}}",
+		Body: `{{if .LogoURL}}<img src="{{.LogoURL}}" alt="{{.ProductName}}" height="40"><br>{{end}}` +
+			`<p>Hi{{if .RecipientName}} {{.RecipientName}}{{end}},</p>` +
+			`<p>You have been invited to join {{.OrgName}} on {{.ProductName}}.</p>` +
+			`<p><a href="{{.Link}}">Accept the invite</a></p>`,
+	},
+	"notification": {
+		Name:    "notification",
+		Subject: "{{.ProductName}} notification for {{.OrgName}}",
+		Body: `{{if .LogoURL}}<img src="{{.LogoURL}}" alt="{{.ProductName}}" height="40"><br>{{end}}` +
+			`<p>Hi{{if .RecipientName}} {{.RecipientName}}{{end}},</p>` +
+			`<p>{{.Message}}</p>` +
+			`{{if .Link}}<p><a href="{{.Link}}">View in {{.ProductName}}</a></p>{{end}}`,
+	},
+}
+
+// emailTemplateData is the data that the email templates are rendered with.
+type emailTemplateData struct {
+	ProductName   string
+	LogoURL       string
+	OrgName       string
+	RecipientName string
+	Link          string
+	Message       string
+}
+
+// renderEmailTemplate renders the subject of the template as text, and its body as HTML so that the values are
+// escaped.
+func renderEmailTemplate(tmpl *datastore.EmailTemplate, data *emailTemplateData) (string, string, error) {
+	subjectTmpl, err := texttemplate.New("subject").Option("missingkey=error").Parse(tmpl.Subject)
+	if err != nil {
+		return "", "", err
+	}
+	bodyTmpl, err := htmltemplate.New("body").Option("missingkey=error").Parse(tmpl.Body)
+	if err != nil {
+		return "", "", err
+	}
+	var subject, body bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
+
+func validateLogoURL(logoURL string) error {
+	if logoURL == "" {
+		return nil
+	}
+	u, err := url.Parse(logoURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return status.Error(codes.InvalidArgument, "logo URL must be an https URL")
+	}
+	return nil
+}
+
+func orgBrandingToProto(b *datastore.OrgBranding) *profilepb.OrgBranding {
+	return &profilepb.OrgBranding{
+		OrgID:       utils.ProtoFromUUID(b.OrgID),
+		ProductName: b.ProductName,
+		LogoURL:     b.LogoURL,
+	}
+}
+
+func emailTemplateToProto(t *datastore.EmailTemplate, isDefault bool) *profilepb.EmailTemplate {
+	return &profilepb.EmailTemplate{
+		Name:      t.Name,
+		Subject:   t.Subject,
+		Body:      t.Body,
+		IsDefault: isDefault,
+	}
+}
+
+// GetOrgBranding gets the branding of the org.
+func (s *Server) GetOrgBranding(ctx context.Context, req *profilepb.GetOrgBrandingRequest) (*profilepb.OrgBranding, error) {
+	branding, err := s.osds.GetOrgBranding(utils.UUIDFromProtoOrNil(req.OrgID))
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	return orgBrandingToProto(branding), nil
+}
+
+// UpdateOrgBranding updates the given fields of the branding of the org.
+func (s *Server) UpdateOrgBranding(ctx context.Context, req *profilepb.UpdateOrgBrandingRequest) (*profilepb.OrgBranding, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	branding, err := s.osds.GetOrgBranding(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	if req.ProductName != nil {
+		if utf8.RuneCountInString(req.ProductName.Value) > maxProductNameLen {
+			return nil, status.Errorf(codes.InvalidArgument, "product name must be at most %d characters", maxProductNameLen)
+		}
+		branding.ProductName = req.ProductName.Value
+	}
+	if req.LogoURL != nil {
+		if err := validateLogoURL(req.LogoURL.Value); err != nil {
+			return nil, err
+		}
+		branding.LogoURL = req.LogoURL.Value
+	}
+	if err := s.osds.UpdateOrgBranding(branding); err != nil {
+		return nil, toExternalError(err)
+	}
+	return orgBrandingToProto(branding), nil
+}
+
+// GetOrgEmailTemplates gets the email templates of the org, including the default templates that it has not
+// customized.
+func (s *Server) GetOrgEmailTemplates(ctx context.Context, req *profilepb.GetOrgEmailTemplatesRequest) (*profilepb.GetOrgEmailTemplatesResponse, error) {
+	custom, err := s.osds.GetEmailTemplates(utils.UUIDFromProtoOrNil(req.OrgID))
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	customByName := make(map[string]*datastore.EmailTemplate)
+	for _, t := range custom {
+		customByName[t.Name] = t
+	}
+
+	names := make([]string, 0, len(defaultEmailTemplates))
+	for name := range defaultEmailTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := &profilepb.GetOrgEmailTemplatesResponse{}
+	for _, name := range names {
+		if t, ok := customByName[name]; ok {
+			resp.Templates = append(resp.Templates, emailTemplateToProto(t, false))
+		} else {
+			resp.Templates = append(resp.Templates, emailTemplateToProto(defaultEmailTemplates[name], true))
+		}
+	}
+	return resp, nil
+}
+
+// SetOrgEmailTemplate creates or replaces the custom email template of the org. The template must render with
+// the values that the mailer provides.
+func (s *Server) SetOrgEmailTemplate(ctx context.Context, req *profilepb.SetOrgEmailTemplateRequest) (*profilepb.EmailTemplate, error) {
+	if req.Template == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing template")
+	}
+	if _, ok := defaultEmailTemplates[req.Template.Name]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown email template %q", req.Template.Name)
+	}
+	if req.Template.Subject == "" || req.Template.Body == "" {
+		return nil, status.Error(codes.InvalidArgument, "email template must have a subject and a body")
+	}
+	if len(req.Template.Subject) > maxEmailTemplateLen || len(req.Template.Body) > maxEmailTemplateLen {
+		return nil, status.Errorf(codes.InvalidArgument, "email template must be at most %d bytes", maxEmailTemplateLen)
+	}
+
+	tmpl := &datastore.EmailTemplate{
+		Name:    req.Template.Name,
+		Subject: req.Template.Subject,
+		Body:    req.Template.Body,
+	}
+	if _, _, err := renderEmailTemplate(tmpl, &emailTemplateData{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid email template: %s", err.Error())
+	}
+	if err := s.osds.SetEmailTemplate(utils.UUIDFromProtoOrNil(req.OrgID), tmpl); err != nil {
+		return nil, toExternalError(err)
+	}
+	return emailTemplateToProto(tmpl, false), nil
+}
+
+// DeleteOrgEmailTemplate deletes the custom email template of the org, which reverts to the default template.
+func (s *Server) DeleteOrgEmailTemplate(ctx context.Context, req *profilepb.DeleteOrgEmailTemplateRequest) (*types.Empty, error) {
+	if err := s.osds.DeleteEmailTemplate(utils.UUIDFromProtoOrNil(req.OrgID), req.Name); err != nil {
+		return nil, toExternalError(err)
+	}
+	return &types.Empty{}, nil
+}
+
+// RenderOrgEmail renders the email template of the org with its branding, for the mailer.
+func (s *Server) RenderOrgEmail(ctx context.Context, req *profilepb.RenderOrgEmailRequest) (*profilepb.RenderOrgEmailResponse, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	tmpl, err := s.osds.GetEmailTemplate(orgID, req.TemplateName)
+	if err == datastore.ErrEmailTemplateNotFound {
+		defaultTmpl, ok := defaultEmailTemplates[req.TemplateName]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown email template %q", req.TemplateName)
+		}
+		tmpl, err = defaultTmpl, nil
+	}
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+
+	orgInfo, err := s.ods.GetOrg(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	if orgInfo == nil {
+		return nil, status.Error(codes.NotFound, "no such org")
+	}
+	branding, err := s.osds.GetOrgBranding(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	productName := branding.ProductName
+	if productName == "" {
+		productName = defaultProductName
+	}
+
+	subject, body, err := renderEmailTemplate(tmpl, &emailTemplateData{
+		ProductName:   productName,
+		LogoURL:       branding.LogoURL,
+		OrgName:       orgInfo.OrgName,
+		RecipientName: req.RecipientName,
+		Link:          req.Link,
+		Message:       req.Message,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to render email template: %s", err.Error())
+	}
+	return &profilepb.RenderOrgEmailResponse{Subject: subject, Body: body}, nil
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/profile/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/profile/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/utils"
+)
+
+func TestServer_UpdateOrgBranding(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, nil, osds, nil, nil)
+
+	orgID := uuid.Must(uuid.NewV4())
+	osds.EXPECT().GetOrgBranding(orgID).Return(&datastore.OrgBranding{
+		OrgID:       orgID,
+		ProductName: "Acme",
+		LogoURL:     "https://acme.com/old.png",
+	}, nil)
+	osds.EXPECT().UpdateOrgBranding(&datastore.OrgBranding{
+		OrgID:       orgID,
+		ProductName: "Acme",
+		LogoURL:     "https://acme.com/logo.png",
+	}).Return(nil)
+
+	resp, err := s.UpdateOrgBranding(context.Background(), &profilepb.UpdateOrgBrandingRequest{
+		OrgID:   utils.ProtoFromUUID(orgID),
+		LogoURL: &types.StringValue{Value: "https://acme.com/logo.png"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", resp.ProductName)
+	assert.Equal(t, "https://acme.com/logo.png", resp.LogoURL)
+}
+
+func TestServer_UpdateOrgBranding_InvalidLogoURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, nil, osds, nil, nil)
+
+	orgID := uuid.Must(uuid.NewV4())
+	osds.EXPECT().GetOrgBranding(orgID).Return(&datastore.OrgBranding{OrgID: orgID}, nil)
+
+	_, err := s.UpdateOrgBranding(context.Background(), &profilepb.UpdateOrgBrandingRequest{
+		OrgID:   utils.ProtoFromUUID(orgID),
+		LogoURL: &types.StringValue{Value: "http://acme.com/logo.png"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetOrgEmailTemplates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, nil, osds, nil, nil)
+
+	orgID := uuid.Must(uuid.NewV4())
+	osds.EXPECT().GetEmailTemplates(orgID).Return([]*datastore.EmailTemplate{
+		{Name: "notification", Subject: "Hello", Body: "<p>{{.Message}}</p>"},
+	}, nil)
+
+	resp, err := s.GetOrgEmailTemplates(context.Background(), &profilepb.GetOrgEmailTemplatesRequest{
+		OrgID: utils.ProtoFromUUID(orgID),
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Templates, 2)
+	assert.Equal(t, "invite", resp.Templates[0].Name)
+	assert.True(t, resp.Templates[0].IsDefault)
+	assert.Equal(t, &profilepb.EmailTemplate{
+		Name:    "notification",
+		Subject: "Hello",
+		Body:    "<p>{{.Message}}</p>",
+	}, resp.Templates[1])
+}
+
+func TestServer_SetOrgEmailTemplate_InvalidTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template *profilepb.EmailTemplate
+	}{
+		{
+			name:     "unknown name",
+			template: &profilepb.EmailTemplate{Name: "welcome", Subject: "a", Body: "b"},
+		},
+		{
+			name:     "missing body",
+			template: &profilepb.EmailTemplate{Name: "invite", Subject: "a"},
+		},
+		{
+			name:     "unparseable",
+			template: &profilepb.EmailTemplate{Name: "invite", Subject: "a", Body: "{{.Link"},
+		},
+		{
+			name:     "unknown variable",
+			template: &profilepb.EmailTemplate{Name: "invite", Subject: "{{.Password}}", Body: "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+			s := controllers.NewServer(nil, nil, nil, nil, osds, nil, nil)
+
+			_, err := s.SetOrgEmailTemplate(context.Background(), &profilepb.SetOrgEmailTemplateRequest{
+				OrgID:    utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+				Template: test.template,
+			})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestServer_RenderOrgEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, ods, osds, nil, nil)
+
+	orgID := uuid.Must(uuid.NewV4())
+	osds.EXPECT().GetEmailTemplate(orgID, "invite").Return(&datastore.EmailTemplate{
+		Name:    "invite",
+		Subject: "Join {{.OrgName}} on {{.ProductName}}",
+		Body:    `<img src="{{.LogoURL}}"><p>Hi {{.RecipientName}}, <a href="{{.Link}}">join</a></p>`,
+	}, nil)
+	ods.EXPECT().GetOrg(orgID).Return(&datastore.OrgInfo{ID: orgID, OrgName: "acme"}, nil)
+	osds.EXPECT().GetOrgBranding(orgID).Return(&datastore.OrgBranding{
+		OrgID:       orgID,
+		ProductName: "Acme Observability",
+		LogoURL:     "https://acme.com/logo.png",
+	}, nil)
+
+	resp, err := s.RenderOrgEmail(context.Background(), &profilepb.RenderOrgEmailRequest{
+		OrgID:         utils.ProtoFromUUID(orgID),
+		TemplateName:  "invite",
+		RecipientName: "<b>Bob</b>",
+		Link:          "https://acme.com/invite?token=abc",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Join acme on Acme Observability", resp.Subject)
+	assert.Equal(t, `<img src="https://acme.com/logo.png"><p>Hi &lt;b&gt;Bob&lt;/b&gt;, <a href="https://acme.com/invite?token=abc">join</a></p>`, resp.Body)
+}
+
+func TestServer_RenderOrgEmail_DefaultTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, ods, osds, nil, nil)
+
+	orgID := uuid.Must(uuid.NewV4())
+	osds.EXPECT().GetEmailTemplate(orgID, "notification").Return(nil, datastore.ErrEmailTemplateNotFound)
+	ods.EXPECT().GetOrg(orgID).Return(&datastore.OrgInfo{ID: orgID, OrgName: "acme"}, nil)
+	osds.EXPECT().GetOrgBranding(orgID).Return(&datastore.OrgBranding{OrgID: orgID}, nil)
+
+	resp, err := s.RenderOrgEmail(context.Background(), &profilepb.RenderOrgEmailRequest{
+		OrgID:        utils.ProtoFromUUID(orgID),
+		TemplateName: "notification",
+		Message:      "Your cluster is disconnected.",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Pixie notification for acme", resp.Subject)
+	assert.Contains(t, resp.Body, "<p>Your cluster is disconnected.</p>")
+	assert.NotContains(t, resp.Body, "<img")
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	claimsutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+// getOrgAdmins gets the active admins of the org.
+func (s *Server) getOrgAdmins(orgID uuid.UUID) ([]uuid.UUID, error) {
+	users, err := s.ods.GetUsersInOrg(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	orgBindings, err := s.rds.GetRoleBindingsInOrg(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	defaultRole, err := s.rds.GetOrgDefaultRole(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	bindingsByUser := make(map[uuid.UUID][]*datastore.RoleBinding)
+	for _, b := range orgBindings {
+		bindingsByUser[b.UserID] = append(bindingsByUser[b.UserID], b)
+	}
+
+	var admins []uuid.UUID
+	for _, u := range users {
+		if !u.IsDeactivated && isOrgAdmin(bindingsByUser[u.ID], defaultRole) {
+			admins = append(admins, u.ID)
+		}
+	}
+	return admins, nil
+}
+
+// serviceContext adds the credentials of the profile service to the outgoing context, for calls that
+// may only be made by other services.
+func (s *Server) serviceContext(ctx context.Context) (context.Context, error) {
+	claims := claimsutils.GenerateJWTForService("ProfileService", s.env.Audience())
+	token, err := claimsutils.SignJWTClaims(claims, s.env.JWTSigningKey())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to sign service token")
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "bearer "+token), nil
+}
+
+// DeactivateUser deactivates the user, revokes their personal access tokens and transfers their API keys,
+// cron scripts and saved queries to another user in the org. Every step can be repeated, so a deactivation
+// that fails part of the way through can be retried.
+func (s *Server) DeactivateUser(ctx context.Context, req *profilepb.DeactivateUserRequest) (*profilepb.DeactivateUserResponse, error) {
+	userID := utils.UUIDFromProtoOrNil(req.UserID)
+	if userID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
+	}
+	orgID, err := s.getUserOrg(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	admins, err := s.getOrgAdmins(orgID)
+	if err != nil {
+		return nil, err
+	}
+	isAdmin := false
+	otherAdminID := uuid.Nil
+	for _, a := range admins {
+		if a == userID {
+			isAdmin = true
+		} else if otherAdminID == uuid.Nil {
+			otherAdminID = a
+		}
+	}
+	if isAdmin && otherAdminID == uuid.Nil {
+		return nil, status.Error(codes.FailedPrecondition, "the org must keep at least one admin")
+	}
+
+	// Unless someone else is given, an admin of the org takes over the resources of the user.
+	newOwnerID := utils.UUIDFromProtoOrNil(req.NewOwnerID)
+	if newOwnerID == uuid.Nil {
+		if otherAdminID == uuid.Nil {
+			return nil, status.Error(codes.FailedPrecondition, "the org has no other admin to take over the resources of the user")
+		}
+		newOwnerID = otherAdminID
+	} else {
+		if newOwnerID == userID {
+			return nil, status.Error(codes.InvalidArgument, "the new owner must be another user")
+		}
+		newOwner, err := s.uds.GetUser(newOwnerID)
+		if err != nil {
+			return nil, toExternalError(err)
+		}
+		if newOwner.OrgID == nil || *newOwner.OrgID != orgID || newOwner.IsDeactivated {
+			return nil, status.Error(codes.InvalidArgument, "the new owner must be an active user in the same org")
+		}
+	}
+
+	// Deactivate the user first, so that they can't log in or create new resources while the
+	// existing ones are moved.
+	userInfo, err := s.uds.GetUser(userID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	if !userInfo.IsDeactivated {
+		userInfo.IsDeactivated = true
+		if err := s.uds.UpdateUser(userInfo); err != nil {
+			return nil, toExternalError(err)
+		}
+	}
+
+	sCtx, err := s.serviceContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.env.PersonalAccessTokenClient().DeleteAllForUser(sCtx, &authpb.DeleteAllPersonalAccessTokensRequest{
+		UserID: utils.ProtoFromUUID(userID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.env.APIKeyClient().TransferOwnership(sCtx, &authpb.TransferAPIKeysRequest{
+		OrgID:      utils.ProtoFromUUID(orgID),
+		FromUserID: utils.ProtoFromUUID(userID),
+		ToUserID:   utils.ProtoFromUUID(newOwnerID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := s.env.CronScriptClient().TransferOwnership(sCtx, &cronscriptpb.TransferScriptsRequest{
+		OrgID:      utils.ProtoFromUUID(orgID),
+		FromUserID: utils.ProtoFromUUID(userID),
+		ToUserID:   utils.ProtoFromUUID(newOwnerID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	queries, err := s.env.SavedQueryClient().TransferSavedQueries(sCtx, &scriptmgrpb.TransferSavedQueriesReq{
+		OrgID:      utils.ProtoFromUUID(orgID),
+		FromUserID: utils.ProtoFromUUID(userID),
+		ToUserID:   utils.ProtoFromUUID(newOwnerID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordConfigChange(ctx, "deactivate_user", orgID, map[string]string{
+		"user_id":      userID.String(),
+		"new_owner_id": newOwnerID.String(),
+	})
+
+	return &profilepb.DeactivateUserResponse{
+		NewOwnerID:       utils.ProtoFromUUID(newOwnerID),
+		NumAPIKeys:       keys.NumKeys,
+		NumCronScripts:   scripts.NumScripts,
+		NumSavedQueries:  queries.NumQueries,
+		NumTokensRevoked: tokens.NumTokens,
+	}, nil
+}
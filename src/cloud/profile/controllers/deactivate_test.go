@@ -0,0 +1,275 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/auth/authpb"
+	mock_auth "px.dev/pixie/src/cloud/auth/authpb/mock"
+	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
+	mock_cronscriptpb "px.dev/pixie/src/cloud/cron_script/cronscriptpb/mock"
+	"px.dev/pixie/src/cloud/profile/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/profile/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profileenv"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	mock_scriptmgr "px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb/mock"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/utils"
+)
+
+type deactivateTestServer struct {
+	s    *controllers.Server
+	uds  *mock_controllers.MockUserDatastore
+	ods  *mock_controllers.MockOrgDatastore
+	rds  *mock_controllers.MockRoleDatastore
+	keys *mock_auth.MockAPIKeyServiceClient
+	pats *mock_auth.MockPersonalAccessTokenServiceClient
+	cron *mock_cronscriptpb.MockCronScriptServiceClient
+	sq   *mock_scriptmgr.MockSavedQueryServiceClient
+}
+
+func newDeactivateTestServer(t *testing.T) *deactivateTestServer {
+	ctrl := gomock.NewController(t)
+	viper.Set("jwt_signing_key", "jwtkey")
+
+	ts := &deactivateTestServer{
+		uds:  mock_controllers.NewMockUserDatastore(ctrl),
+		ods:  mock_controllers.NewMockOrgDatastore(ctrl),
+		rds:  mock_controllers.NewMockRoleDatastore(ctrl),
+		keys: mock_auth.NewMockAPIKeyServiceClient(ctrl),
+		pats: mock_auth.NewMockPersonalAccessTokenServiceClient(ctrl),
+		cron: mock_cronscriptpb.NewMockCronScriptServiceClient(ctrl),
+		sq:   mock_scriptmgr.NewMockSavedQueryServiceClient(ctrl),
+	}
+	env := profileenv.New(nil, ts.keys, ts.pats, ts.cron, ts.sq)
+	ts.s = controllers.NewServer(env, ts.uds, nil, ts.ods, nil, nil, ts.rds)
+	return ts
+}
+
+// expectOrg sets up an org with the given users, where the admins have the admin role and everyone
+// else has the default viewer role.
+func (ts *deactivateTestServer) expectOrg(users []*datastore.UserInfo, admins ...uuid.UUID) {
+	bindings := make([]*datastore.RoleBinding, len(admins))
+	for i, a := range admins {
+		bindings[i] = &datastore.RoleBinding{UserID: a, Role: orgrole.Admin}
+	}
+	ts.ods.EXPECT().GetUsersInOrg(groupTestOrgID).Return(users, nil)
+	ts.rds.EXPECT().GetRoleBindingsInOrg(groupTestOrgID).Return(bindings, nil)
+	ts.rds.EXPECT().GetOrgDefaultRole(groupTestOrgID).Return(orgrole.Viewer, nil)
+}
+
+// requireServiceCredentials checks that the call is made with the credentials of a service.
+func requireServiceCredentials(t *testing.T, ctx context.Context) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	require.True(t, ok)
+	auth := md.Get("authorization")
+	require.Len(t, auth, 1)
+	assert.True(t, strings.HasPrefix(auth[0], "bearer "))
+}
+
+func TestServer_DeactivateUser(t *testing.T) {
+	ts := newDeactivateTestServer(t)
+
+	orgID := groupTestOrgID
+	userID := uuid.Must(uuid.NewV4())
+	adminID := uuid.Must(uuid.NewV4())
+	user := &datastore.UserInfo{ID: userID, OrgID: &orgID}
+	ts.uds.EXPECT().GetUser(userID).Return(user, nil).Times(2)
+	ts.expectOrg([]*datastore.UserInfo{user, {ID: adminID, OrgID: &orgID}}, adminID)
+	ts.uds.EXPECT().UpdateUser(&datastore.UserInfo{ID: userID, OrgID: &orgID, IsDeactivated: true}).Return(nil)
+
+	ts.pats.EXPECT().
+		DeleteAllForUser(gomock.Any(), &authpb.DeleteAllPersonalAccessTokensRequest{UserID: utils.ProtoFromUUID(userID)}).
+		DoAndReturn(func(ctx context.Context, _ *authpb.DeleteAllPersonalAccessTokensRequest, _ ...grpc.CallOption) (*authpb.DeleteAllPersonalAccessTokensResponse, error) {
+			requireServiceCredentials(t, ctx)
+			return &authpb.DeleteAllPersonalAccessTokensResponse{NumTokens: 2}, nil
+		})
+	ts.keys.EXPECT().
+		TransferOwnership(gomock.Any(), &authpb.TransferAPIKeysRequest{
+			OrgID: utils.ProtoFromUUID(orgID), FromUserID: utils.ProtoFromUUID(userID), ToUserID: utils.ProtoFromUUID(adminID),
+		}).
+		Return(&authpb.TransferAPIKeysResponse{NumKeys: 3}, nil)
+	ts.cron.EXPECT().
+		TransferOwnership(gomock.Any(), &cronscriptpb.TransferScriptsRequest{
+			OrgID: utils.ProtoFromUUID(orgID), FromUserID: utils.ProtoFromUUID(userID), ToUserID: utils.ProtoFromUUID(adminID),
+		}).
+		Return(&cronscriptpb.TransferScriptsResponse{NumScripts: 1}, nil)
+	ts.sq.EXPECT().
+		TransferSavedQueries(gomock.Any(), &scriptmgrpb.TransferSavedQueriesReq{
+			OrgID: utils.ProtoFromUUID(orgID), FromUserID: utils.ProtoFromUUID(userID), ToUserID: utils.ProtoFromUUID(adminID),
+		}).
+		Return(&scriptmgrpb.TransferSavedQueriesResp{NumQueries: 4}, nil)
+
+	resp, err := ts.s.DeactivateUser(createRoleTestContext(orgrole.Admin), &profilepb.DeactivateUserRequest{
+		UserID: utils.ProtoFromUUID(userID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &profilepb.DeactivateUserResponse{
+		NewOwnerID:       utils.ProtoFromUUID(adminID),
+		NumAPIKeys:       3,
+		NumCronScripts:   1,
+		NumSavedQueries:  4,
+		NumTokensRevoked: 2,
+	}, resp)
+}
+
+func TestServer_DeactivateUser_NewOwner(t *testing.T) {
+	ts := newDeactivateTestServer(t)
+
+	orgID := groupTestOrgID
+	userID := uuid.Must(uuid.NewV4())
+	adminID := uuid.Must(uuid.NewV4())
+	newOwnerID := uuid.Must(uuid.NewV4())
+	user := &datastore.UserInfo{ID: userID, OrgID: &orgID, IsDeactivated: true}
+	newOwner := &datastore.UserInfo{ID: newOwnerID, OrgID: &orgID}
+	ts.uds.EXPECT().GetUser(userID).Return(user, nil).Times(2)
+	ts.uds.EXPECT().GetUser(newOwnerID).Return(newOwner, nil)
+	ts.expectOrg([]*datastore.UserInfo{user, newOwner, {ID: adminID, OrgID: &orgID}}, adminID)
+
+	// The user is already deactivated, so only the transfers are retried.
+	ts.pats.EXPECT().DeleteAllForUser(gomock.Any(), gomock.Any()).
+		Return(&authpb.DeleteAllPersonalAccessTokensResponse{}, nil)
+	ts.keys.EXPECT().TransferOwnership(gomock.Any(), &authpb.TransferAPIKeysRequest{
+		OrgID: utils.ProtoFromUUID(orgID), FromUserID: utils.ProtoFromUUID(userID), ToUserID: utils.ProtoFromUUID(newOwnerID),
+	}).Return(&authpb.TransferAPIKeysResponse{NumKeys: 1}, nil)
+	ts.cron.EXPECT().TransferOwnership(gomock.Any(), gomock.Any()).
+		Return(&cronscriptpb.TransferScriptsResponse{}, nil)
+	ts.sq.EXPECT().TransferSavedQueries(gomock.Any(), gomock.Any()).
+		Return(&scriptmgrpb.TransferSavedQueriesResp{}, nil)
+
+	resp, err := ts.s.DeactivateUser(createRoleTestContext(orgrole.Admin), &profilepb.DeactivateUserRequest{
+		UserID:     utils.ProtoFromUUID(userID),
+		NewOwnerID: utils.ProtoFromUUID(newOwnerID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, utils.ProtoFromUUID(newOwnerID), resp.NewOwnerID)
+	assert.Equal(t, int64(1), resp.NumAPIKeys)
+}
+
+func TestServer_DeactivateUser_NewOwnerWithoutOtherAdmin(t *testing.T) {
+	ts := newDeactivateTestServer(t)
+
+	orgID := groupTestOrgID
+	userID := uuid.Must(uuid.NewV4())
+	newOwnerID := uuid.Must(uuid.NewV4())
+	user := &datastore.UserInfo{ID: userID, OrgID: &orgID}
+	newOwner := &datastore.UserInfo{ID: newOwnerID, OrgID: &orgID}
+	ts.uds.EXPECT().GetUser(userID).Return(user, nil).Times(2)
+	ts.uds.EXPECT().GetUser(newOwnerID).Return(newOwner, nil)
+	// None of the users of the org is an admin, but the new owner is given.
+	ts.expectOrg([]*datastore.UserInfo{user, newOwner})
+	ts.uds.EXPECT().UpdateUser(gomock.Any()).Return(nil)
+
+	ts.pats.EXPECT().DeleteAllForUser(gomock.Any(), gomock.Any()).
+		Return(&authpb.DeleteAllPersonalAccessTokensResponse{}, nil)
+	ts.keys.EXPECT().TransferOwnership(gomock.Any(), gomock.Any()).
+		Return(&authpb.TransferAPIKeysResponse{}, nil)
+	ts.cron.EXPECT().TransferOwnership(gomock.Any(), gomock.Any()).
+		Return(&cronscriptpb.TransferScriptsResponse{}, nil)
+	ts.sq.EXPECT().TransferSavedQueries(gomock.Any(), gomock.Any()).
+		Return(&scriptmgrpb.TransferSavedQueriesResp{}, nil)
+
+	resp, err := ts.s.DeactivateUser(createRoleTestContext(orgrole.Admin), &profilepb.DeactivateUserRequest{
+		UserID:     utils.ProtoFromUUID(userID),
+		NewOwnerID: utils.ProtoFromUUID(newOwnerID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, utils.ProtoFromUUID(newOwnerID), resp.NewOwnerID)
+}
+
+func TestServer_DeactivateUser_NoOtherAdmin(t *testing.T) {
+	ts := newDeactivateTestServer(t)
+
+	orgID := groupTestOrgID
+	userID := uuid.Must(uuid.NewV4())
+	user := &datastore.UserInfo{ID: userID, OrgID: &orgID}
+	ts.uds.EXPECT().GetUser(userID).Return(user, nil)
+	ts.expectOrg([]*datastore.UserInfo{user})
+
+	_, err := ts.s.DeactivateUser(createRoleTestContext(orgrole.Admin), &profilepb.DeactivateUserRequest{
+		UserID: utils.ProtoFromUUID(userID),
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestServer_DeactivateUser_NewOwnerInOtherOrg(t *testing.T) {
+	ts := newDeactivateTestServer(t)
+
+	orgID := groupTestOrgID
+	otherOrgID := uuid.Must(uuid.NewV4())
+	userID := uuid.Must(uuid.NewV4())
+	adminID := uuid.Must(uuid.NewV4())
+	newOwnerID := uuid.Must(uuid.NewV4())
+	user := &datastore.UserInfo{ID: userID, OrgID: &orgID}
+	ts.uds.EXPECT().GetUser(userID).Return(user, nil)
+	ts.uds.EXPECT().GetUser(newOwnerID).Return(&datastore.UserInfo{ID: newOwnerID, OrgID: &otherOrgID}, nil)
+	ts.expectOrg([]*datastore.UserInfo{user, {ID: adminID, OrgID: &orgID}}, adminID)
+
+	_, err := ts.s.DeactivateUser(createRoleTestContext(orgrole.Admin), &profilepb.DeactivateUserRequest{
+		UserID:     utils.ProtoFromUUID(userID),
+		NewOwnerID: utils.ProtoFromUUID(newOwnerID),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_DeactivateUser_LastAdmin(t *testing.T) {
+	ts := newDeactivateTestServer(t)
+
+	orgID := groupTestOrgID
+	userID := uuid.Must(uuid.NewV4())
+	user := &datastore.UserInfo{ID: userID, OrgID: &orgID}
+	ts.uds.EXPECT().GetUser(userID).Return(user, nil)
+	newOwnerID := uuid.Must(uuid.NewV4())
+	ts.expectOrg([]*datastore.UserInfo{user, {ID: newOwnerID, OrgID: &orgID}}, userID)
+
+	// Giving a new owner doesn't let the org lose its last admin.
+	_, err := ts.s.DeactivateUser(createRoleTestContext(orgrole.Admin), &profilepb.DeactivateUserRequest{
+		UserID:     utils.ProtoFromUUID(userID),
+		NewOwnerID: utils.ProtoFromUUID(newOwnerID),
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestServer_DeactivateUser_NotAdmin(t *testing.T) {
+	ts := newDeactivateTestServer(t)
+
+	orgID := groupTestOrgID
+	userID := uuid.Must(uuid.NewV4())
+	ts.uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &orgID}, nil)
+
+	_, err := ts.s.DeactivateUser(createRoleTestContext(orgrole.Editor), &profilepb.DeactivateUserRequest{
+		UserID: utils.ProtoFromUUID(userID),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+func groupInfoToProto(g *datastore.GroupInfo) *profilepb.GroupInfo {
+	memberIDs := make([]*uuidpb.UUID, len(g.MemberIDs))
+	for i, id := range g.MemberIDs {
+		memberIDs[i] = utils.ProtoFromUUID(id)
+	}
+	return &profilepb.GroupInfo{
+		ID:          utils.ProtoFromUUID(g.ID),
+		OrgID:       utils.ProtoFromUUID(g.OrgID),
+		DisplayName: g.DisplayName,
+		ExternalID:  g.ExternalID,
+		MemberIDs:   memberIDs,
+	}
+}
+
+// checkGroupOrgAccess makes sure that the caller belongs to the org that owns the groups.
+func checkGroupOrgAccess(ctx context.Context, orgID uuid.UUID) error {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	claims := sCtx.Claims.GetUserClaims()
+	if claims == nil || orgID == uuid.Nil || uuid.FromStringOrNil(claims.OrgID) != orgID {
+		return status.Error(codes.PermissionDenied, "unauthorized to access the groups of the org")
+	}
+	return nil
+}
+
+// orgMemberIDs converts the given user IDs, and makes sure that all of the users belong to the org.
+func (s *Server) orgMemberIDs(orgID uuid.UUID, ids []*uuidpb.UUID) ([]uuid.UUID, error) {
+	memberIDs := make([]uuid.UUID, 0, len(ids))
+	for _, idPb := range ids {
+		id := utils.UUIDFromProtoOrNil(idPb)
+		userInfo, err := s.uds.GetUser(id)
+		if err != nil || userInfo == nil || userInfo.OrgID == nil || *userInfo.OrgID != orgID {
+			return nil, status.Errorf(codes.InvalidArgument, "user %s does not belong to the org", id)
+		}
+		memberIDs = append(memberIDs, id)
+	}
+	return memberIDs, nil
+}
+
+// getGroup gets the group, given that the requestor belongs to its org.
+func (s *Server) getGroup(ctx context.Context, idPb *uuidpb.UUID) (*datastore.GroupInfo, error) {
+	groupInfo, err := s.gds.GetGroup(utils.UUIDFromProtoOrNil(idPb))
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	if err := checkGroupOrgAccess(ctx, groupInfo.OrgID); err != nil {
+		return nil, err
+	}
+	return groupInfo, nil
+}
+
+// CreateGroup creates a group of users in an org.
+func (s *Server) CreateGroup(ctx context.Context, req *profilepb.CreateGroupRequest) (*profilepb.GroupInfo, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if err := checkGroupOrgAccess(ctx, orgID); err != nil {
+		return nil, err
+	}
+	if req.DisplayName == "" {
+		return nil, status.Error(codes.InvalidArgument, "display name must not be empty")
+	}
+	memberIDs, err := s.orgMemberIDs(orgID, req.MemberIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	groupInfo := &datastore.GroupInfo{
+		OrgID:       orgID,
+		DisplayName: req.DisplayName,
+		ExternalID:  req.ExternalID,
+		MemberIDs:   memberIDs,
+	}
+	id, err := s.gds.CreateGroup(groupInfo)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	groupInfo.ID = id
+	return groupInfoToProto(groupInfo), nil
+}
+
+// GetGroup gets a group and its members.
+func (s *Server) GetGroup(ctx context.Context, req *uuidpb.UUID) (*profilepb.GroupInfo, error) {
+	groupInfo, err := s.getGroup(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return groupInfoToProto(groupInfo), nil
+}
+
+// GetGroupsInOrg gets the groups in the requested org, given that the requestor belongs to it.
+func (s *Server) GetGroupsInOrg(ctx context.Context, req *profilepb.GetGroupsInOrgRequest) (*profilepb.GetGroupsInOrgResponse, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if err := checkGroupOrgAccess(ctx, orgID); err != nil {
+		return nil, err
+	}
+	groups, err := s.gds.GetGroupsInOrg(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupsProto := make([]*profilepb.GroupInfo, len(groups))
+	for i, g := range groups {
+		groupsProto[i] = groupInfoToProto(g)
+	}
+	return &profilepb.GetGroupsInOrgResponse{Groups: groupsProto}, nil
+}
+
+// UpdateGroup updates the name and members of a group.
+func (s *Server) UpdateGroup(ctx context.Context, req *profilepb.UpdateGroupRequest) (*profilepb.GroupInfo, error) {
+	groupInfo, err := s.getGroup(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DisplayName != nil {
+		if req.DisplayName.Value == "" {
+			return nil, status.Error(codes.InvalidArgument, "display name must not be empty")
+		}
+		groupInfo.DisplayName = req.DisplayName.Value
+	}
+	if req.ExternalID != nil {
+		groupInfo.ExternalID = req.ExternalID.Value
+	}
+
+	var members []uuid.UUID
+	if !req.ReplaceMembers {
+		members = groupInfo.MemberIDs
+	} else if members, err = s.orgMemberIDs(groupInfo.OrgID, req.MemberIDs); err != nil {
+		return nil, err
+	}
+	added, err := s.orgMemberIDs(groupInfo.OrgID, req.AddMemberIDs)
+	if err != nil {
+		return nil, err
+	}
+	removed := make(map[uuid.UUID]bool)
+	for _, id := range req.RemoveMemberIDs {
+		removed[utils.UUIDFromProtoOrNil(id)] = true
+	}
+
+	groupInfo.MemberIDs = nil
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range append(members, added...) {
+		if removed[id] || seen[id] {
+			continue
+		}
+		seen[id] = true
+		groupInfo.MemberIDs = append(groupInfo.MemberIDs, id)
+	}
+
+	if err := s.gds.UpdateGroup(groupInfo); err != nil {
+		return nil, toExternalError(err)
+	}
+	return groupInfoToProto(groupInfo), nil
+}
+
+// DeleteGroup deletes a group. Its members stay in the org.
+func (s *Server) DeleteGroup(ctx context.Context, req *uuidpb.UUID) (*types.Empty, error) {
+	groupInfo, err := s.getGroup(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.gds.DeleteGroup(groupInfo.ID); err != nil {
+		return nil, toExternalError(err)
+	}
+	return &types.Empty{}, nil
+}
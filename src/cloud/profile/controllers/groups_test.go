@@ -0,0 +1,162 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/profile/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/profile/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/utils"
+)
+
+// The org of the user in CreateTestContext.
+var groupTestOrgID = uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+func TestServer_CreateGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	gds := mock_controllers.NewMockGroupDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, nil, nil, gds, nil)
+
+	userID := uuid.Must(uuid.NewV4())
+	groupID := uuid.Must(uuid.NewV4())
+	orgID := groupTestOrgID
+	uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &orgID}, nil)
+	gds.EXPECT().CreateGroup(&datastore.GroupInfo{
+		OrgID:       orgID,
+		DisplayName: "engineering",
+		ExternalID:  "ext",
+		MemberIDs:   []uuid.UUID{userID},
+	}).Return(groupID, nil)
+
+	resp, err := s.CreateGroup(CreateTestContext(), &profilepb.CreateGroupRequest{
+		OrgID:       utils.ProtoFromUUID(orgID),
+		DisplayName: "engineering",
+		ExternalID:  "ext",
+		MemberIDs:   []*uuidpb.UUID{utils.ProtoFromUUID(userID)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, utils.ProtoFromUUID(groupID), resp.ID)
+	assert.Equal(t, []*uuidpb.UUID{utils.ProtoFromUUID(userID)}, resp.MemberIDs)
+}
+
+func TestServer_CreateGroup_MemberInOtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	gds := mock_controllers.NewMockGroupDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, nil, nil, gds, nil)
+
+	userID := uuid.Must(uuid.NewV4())
+	otherOrgID := uuid.Must(uuid.NewV4())
+	uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &otherOrgID}, nil)
+
+	_, err := s.CreateGroup(CreateTestContext(), &profilepb.CreateGroupRequest{
+		OrgID:       utils.ProtoFromUUID(groupTestOrgID),
+		DisplayName: "engineering",
+		MemberIDs:   []*uuidpb.UUID{utils.ProtoFromUUID(userID)},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetGroupsInOrg_OtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	gds := mock_controllers.NewMockGroupDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, nil, nil, gds, nil)
+
+	_, err := s.GetGroupsInOrg(CreateTestContext(), &profilepb.GetGroupsInOrgRequest{
+		OrgID: utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.GetGroupsInOrg(context.Background(), &profilepb.GetGroupsInOrgRequest{
+		OrgID: utils.ProtoFromUUID(groupTestOrgID),
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_UpdateGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	gds := mock_controllers.NewMockGroupDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, nil, nil, gds, nil)
+
+	orgID := groupTestOrgID
+	groupID := uuid.Must(uuid.NewV4())
+	user1 := uuid.Must(uuid.NewV4())
+	user2 := uuid.Must(uuid.NewV4())
+	user3 := uuid.Must(uuid.NewV4())
+
+	gds.EXPECT().GetGroup(groupID).Return(&datastore.GroupInfo{
+		ID:          groupID,
+		OrgID:       orgID,
+		DisplayName: "engineering",
+		MemberIDs:   []uuid.UUID{user1, user2},
+	}, nil)
+	uds.EXPECT().GetUser(user3).Return(&datastore.UserInfo{ID: user3, OrgID: &orgID}, nil)
+	gds.EXPECT().UpdateGroup(&datastore.GroupInfo{
+		ID:          groupID,
+		OrgID:       orgID,
+		DisplayName: "platform",
+		MemberIDs:   []uuid.UUID{user2, user3},
+	}).Return(nil)
+
+	resp, err := s.UpdateGroup(CreateTestContext(), &profilepb.UpdateGroupRequest{
+		ID:              utils.ProtoFromUUID(groupID),
+		DisplayName:     &types.StringValue{Value: "platform"},
+		AddMemberIDs:    []*uuidpb.UUID{utils.ProtoFromUUID(user3)},
+		RemoveMemberIDs: []*uuidpb.UUID{utils.ProtoFromUUID(user1)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "platform", resp.DisplayName)
+	assert.Len(t, resp.MemberIDs, 2)
+}
+
+func TestServer_DeleteGroup_OtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	gds := mock_controllers.NewMockGroupDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, nil, nil, gds, nil)
+
+	groupID := uuid.Must(uuid.NewV4())
+	gds.EXPECT().GetGroup(groupID).Return(&datastore.GroupInfo{ID: groupID, OrgID: uuid.Must(uuid.NewV4())}, nil)
+
+	_, err := s.DeleteGroup(CreateTestContext(), utils.ProtoFromUUID(groupID))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
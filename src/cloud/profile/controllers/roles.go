@@ -0,0 +1,277 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/shared/services/authcontext"
+	claimsutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+// orgRoleNames are the names of the roles, as they are stored and added to tokens.
+var orgRoleNames = map[profilepb.OrgRole]string{
+	profilepb.ORG_ROLE_ADMIN:  orgrole.Admin,
+	profilepb.ORG_ROLE_EDITOR: orgrole.Editor,
+	profilepb.ORG_ROLE_VIEWER: orgrole.Viewer,
+}
+
+func orgRoleToProto(role string) profilepb.OrgRole {
+	for pb, name := range orgRoleNames {
+		if name == role {
+			return pb
+		}
+	}
+	return profilepb.ORG_ROLE_UNKNOWN
+}
+
+func orgRoleFromProto(role profilepb.OrgRole) (string, error) {
+	name, ok := orgRoleNames[role]
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "invalid role %s", role)
+	}
+	return name, nil
+}
+
+func userRolesToProto(userID uuid.UUID, bindings []*datastore.RoleBinding, defaultRole string) *profilepb.UserRoles {
+	if len(bindings) == 0 {
+		return &profilepb.UserRoles{
+			UserID:    utils.ProtoFromUUID(userID),
+			Bindings:  []*profilepb.RoleBinding{{Role: orgRoleToProto(defaultRole)}},
+			IsDefault: true,
+		}
+	}
+	pbs := make([]*profilepb.RoleBinding, len(bindings))
+	for i, b := range bindings {
+		var clusterID *uuidpb.UUID
+		if b.ClusterID != nil {
+			clusterID = utils.ProtoFromUUID(*b.ClusterID)
+		}
+		pbs[i] = &profilepb.RoleBinding{Role: orgRoleToProto(b.Role), ClusterID: clusterID}
+	}
+	return &profilepb.UserRoles{UserID: utils.ProtoFromUUID(userID), Bindings: pbs}
+}
+
+// checkRoleOrgAccess makes sure that the caller belongs to the org, and is one of its admins if the roles
+// are being changed. Services may access the roles of all orgs.
+func checkRoleOrgAccess(ctx context.Context, orgID uuid.UUID, modify bool) error {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	switch claimsutils.GetClaimsType(sCtx.Claims) {
+	case claimsutils.ServiceClaimType:
+		return nil
+	case claimsutils.UserClaimType:
+		if orgID == uuid.Nil || uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID) != orgID {
+			return status.Error(codes.PermissionDenied, "unauthorized to access the roles of the org")
+		}
+		if modify && !orgrole.IsAdmin(sCtx.Claims.Scopes) {
+			return status.Error(codes.PermissionDenied, "only admins may change the roles of the org")
+		}
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "unauthorized to access the roles of the org")
+}
+
+// getUserOrg gets the org of the user, given that the requestor may access its roles.
+func (s *Server) getUserOrg(ctx context.Context, userID uuid.UUID, modify bool) (uuid.UUID, error) {
+	userInfo, err := s.uds.GetUser(userID)
+	if err != nil {
+		return uuid.Nil, toExternalError(err)
+	}
+	if userInfo.OrgID == nil || *userInfo.OrgID == uuid.Nil {
+		return uuid.Nil, status.Error(codes.FailedPrecondition, "user does not belong to an org")
+	}
+	if err := checkRoleOrgAccess(ctx, *userInfo.OrgID, modify); err != nil {
+		return uuid.Nil, err
+	}
+	return *userInfo.OrgID, nil
+}
+
+// checkOrgKeepsAdmin makes sure that the org still has an active admin, once the roles of the user are
+// replaced with bindings and the default role of the org is set to defaultRole.
+func (s *Server) checkOrgKeepsAdmin(orgID uuid.UUID, userID uuid.UUID, bindings []*datastore.RoleBinding, defaultRole string) error {
+	users, err := s.ods.GetUsersInOrg(orgID)
+	if err != nil {
+		return toExternalError(err)
+	}
+	orgBindings, err := s.rds.GetRoleBindingsInOrg(orgID)
+	if err != nil {
+		return toExternalError(err)
+	}
+	bindingsByUser := make(map[uuid.UUID][]*datastore.RoleBinding)
+	for _, b := range orgBindings {
+		bindingsByUser[b.UserID] = append(bindingsByUser[b.UserID], b)
+	}
+	if userID != uuid.Nil {
+		bindingsByUser[userID] = bindings
+	}
+
+	for _, u := range users {
+		if !u.IsDeactivated && isOrgAdmin(bindingsByUser[u.ID], defaultRole) {
+			return nil
+		}
+	}
+	return status.Error(codes.FailedPrecondition, "the org must keep at least one admin")
+}
+
+// isOrgAdmin returns whether a user with the given bindings is an admin of the whole org.
+func isOrgAdmin(bindings []*datastore.RoleBinding, defaultRole string) bool {
+	if len(bindings) == 0 {
+		return defaultRole == orgrole.Admin
+	}
+	for _, b := range bindings {
+		if b.ClusterID == nil && b.Role == orgrole.Admin {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUserRoles gets the roles of the user in their org.
+func (s *Server) GetUserRoles(ctx context.Context, req *profilepb.GetUserRolesRequest) (*profilepb.UserRoles, error) {
+	userID := utils.UUIDFromProtoOrNil(req.UserID)
+	orgID, err := s.getUserOrg(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := s.rds.GetRoleBindings(orgID, userID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	defaultRole := ""
+	if len(bindings) == 0 {
+		if defaultRole, err = s.rds.GetOrgDefaultRole(orgID); err != nil {
+			return nil, toExternalError(err)
+		}
+	}
+	return userRolesToProto(userID, bindings, defaultRole), nil
+}
+
+// SetUserRoles replaces the roles of the user in their org.
+func (s *Server) SetUserRoles(ctx context.Context, req *profilepb.SetUserRolesRequest) (*profilepb.UserRoles, error) {
+	userID := utils.UUIDFromProtoOrNil(req.UserID)
+	orgID, err := s.getUserOrg(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]*datastore.RoleBinding, len(req.Bindings))
+	for i, b := range req.Bindings {
+		role, err := orgRoleFromProto(b.Role)
+		if err != nil {
+			return nil, err
+		}
+		bindings[i] = &datastore.RoleBinding{UserID: userID, Role: role}
+		if b.ClusterID != nil {
+			clusterID := utils.UUIDFromProtoOrNil(b.ClusterID)
+			if clusterID == uuid.Nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid cluster ID")
+			}
+			bindings[i].ClusterID = &clusterID
+		}
+	}
+
+	defaultRole, err := s.rds.GetOrgDefaultRole(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	if err := s.checkOrgKeepsAdmin(orgID, userID, bindings, defaultRole); err != nil {
+		return nil, err
+	}
+	if err := s.rds.SetRoleBindings(orgID, userID, bindings); err != nil {
+		return nil, toExternalError(err)
+	}
+	roles := make([]string, len(bindings))
+	for i, b := range bindings {
+		roles[i] = b.Role
+		if b.ClusterID != nil {
+			roles[i] += "@" + b.ClusterID.String()
+		}
+	}
+	recordConfigChange(ctx, "set_user_roles", orgID, map[string]string{
+		"target_user_id": userID.String(),
+		"roles":          strings.Join(roles, ","),
+	})
+	return userRolesToProto(userID, bindings, defaultRole), nil
+}
+
+// GetOrgRoles gets the default role of the org, and the roles of each of its users.
+func (s *Server) GetOrgRoles(ctx context.Context, req *profilepb.GetOrgRolesRequest) (*profilepb.GetOrgRolesResponse, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if err := checkRoleOrgAccess(ctx, orgID, false); err != nil {
+		return nil, err
+	}
+	defaultRole, err := s.rds.GetOrgDefaultRole(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	users, err := s.ods.GetUsersInOrg(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	orgBindings, err := s.rds.GetRoleBindingsInOrg(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	bindingsByUser := make(map[uuid.UUID][]*datastore.RoleBinding)
+	for _, b := range orgBindings {
+		bindingsByUser[b.UserID] = append(bindingsByUser[b.UserID], b)
+	}
+
+	resp := &profilepb.GetOrgRolesResponse{
+		DefaultRole: orgRoleToProto(defaultRole),
+		Users:       make([]*profilepb.UserRoles, len(users)),
+	}
+	for i, u := range users {
+		resp.Users[i] = userRolesToProto(u.ID, bindingsByUser[u.ID], defaultRole)
+	}
+	return resp, nil
+}
+
+// SetOrgDefaultRole sets the role of the users in the org that don't have any roles of their own.
+func (s *Server) SetOrgDefaultRole(ctx context.Context, req *profilepb.SetOrgDefaultRoleRequest) (*types.Empty, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if err := checkRoleOrgAccess(ctx, orgID, true); err != nil {
+		return nil, err
+	}
+	role, err := orgRoleFromProto(req.Role)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOrgKeepsAdmin(orgID, uuid.Nil, nil, role); err != nil {
+		return nil, err
+	}
+	if err := s.rds.SetOrgDefaultRole(orgID, role); err != nil {
+		return nil, toExternalError(err)
+	}
+	recordConfigChange(ctx, "set_org_default_role", orgID, map[string]string{"role": role})
+	return &types.Empty{}, nil
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/profile/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/profile/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/cloud/shared/orgrole"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+// createRoleTestContext creates a context for the user in CreateTestContext, with the given role.
+func createRoleTestContext(role string) context.Context {
+	ctx := CreateTestContext()
+	sCtx, _ := authcontext.FromContext(ctx)
+	sCtx.Claims.Scopes = append(sCtx.Claims.Scopes, orgrole.TokenScopes([]orgrole.Binding{{Role: role}})...)
+	return ctx
+}
+
+func TestServer_GetUserRoles_Default(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	rds := mock_controllers.NewMockRoleDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, nil, nil, nil, rds)
+
+	userID := uuid.Must(uuid.NewV4())
+	orgID := groupTestOrgID
+	uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &orgID}, nil)
+	rds.EXPECT().GetRoleBindings(orgID, userID).Return([]*datastore.RoleBinding{}, nil)
+	rds.EXPECT().GetOrgDefaultRole(orgID).Return(orgrole.Editor, nil)
+
+	resp, err := s.GetUserRoles(CreateTestContext(), &profilepb.GetUserRolesRequest{UserID: utils.ProtoFromUUID(userID)})
+	require.NoError(t, err)
+	assert.True(t, resp.IsDefault)
+	require.Len(t, resp.Bindings, 1)
+	assert.Equal(t, profilepb.ORG_ROLE_EDITOR, resp.Bindings[0].Role)
+	assert.Nil(t, resp.Bindings[0].ClusterID)
+}
+
+func TestServer_GetUserRoles_OtherOrg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	rds := mock_controllers.NewMockRoleDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, nil, nil, nil, rds)
+
+	userID := uuid.Must(uuid.NewV4())
+	orgID := uuid.Must(uuid.NewV4())
+	uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &orgID}, nil)
+
+	_, err := s.GetUserRoles(CreateTestContext(), &profilepb.GetUserRolesRequest{UserID: utils.ProtoFromUUID(userID)})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_SetUserRoles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	rds := mock_controllers.NewMockRoleDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, ods, nil, nil, rds)
+
+	userID := uuid.Must(uuid.NewV4())
+	adminID := uuid.Must(uuid.NewV4())
+	clusterID := uuid.Must(uuid.NewV4())
+	orgID := groupTestOrgID
+	bindings := []*datastore.RoleBinding{
+		{UserID: userID, Role: orgrole.Viewer},
+		{UserID: userID, Role: orgrole.Editor, ClusterID: &clusterID},
+	}
+	uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &orgID}, nil)
+	rds.EXPECT().GetOrgDefaultRole(orgID).Return(orgrole.Viewer, nil)
+	ods.EXPECT().GetUsersInOrg(orgID).Return([]*datastore.UserInfo{{ID: userID}, {ID: adminID}}, nil)
+	rds.EXPECT().GetRoleBindingsInOrg(orgID).Return([]*datastore.RoleBinding{
+		{UserID: adminID, Role: orgrole.Admin},
+	}, nil)
+	rds.EXPECT().SetRoleBindings(orgID, userID, bindings).Return(nil)
+
+	resp, err := s.SetUserRoles(createRoleTestContext(orgrole.Admin), &profilepb.SetUserRolesRequest{
+		UserID: utils.ProtoFromUUID(userID),
+		Bindings: []*profilepb.RoleBinding{
+			{Role: profilepb.ORG_ROLE_VIEWER},
+			{Role: profilepb.ORG_ROLE_EDITOR, ClusterID: utils.ProtoFromUUID(clusterID)},
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, resp.IsDefault)
+	require.Len(t, resp.Bindings, 2)
+	assert.Equal(t, utils.ProtoFromUUID(clusterID), resp.Bindings[1].ClusterID)
+}
+
+func TestServer_SetUserRoles_NotAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	rds := mock_controllers.NewMockRoleDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, nil, nil, nil, rds)
+
+	userID := uuid.Must(uuid.NewV4())
+	orgID := groupTestOrgID
+	uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &orgID}, nil)
+
+	_, err := s.SetUserRoles(createRoleTestContext(orgrole.Editor), &profilepb.SetUserRolesRequest{
+		UserID:   utils.ProtoFromUUID(userID),
+		Bindings: []*profilepb.RoleBinding{{Role: profilepb.ORG_ROLE_ADMIN}},
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_SetUserRoles_LastAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	rds := mock_controllers.NewMockRoleDatastore(ctrl)
+	s := controllers.NewServer(nil, uds, nil, ods, nil, nil, rds)
+
+	userID := uuid.Must(uuid.NewV4())
+	deactivatedID := uuid.Must(uuid.NewV4())
+	orgID := groupTestOrgID
+	uds.EXPECT().GetUser(userID).Return(&datastore.UserInfo{ID: userID, OrgID: &orgID}, nil)
+	rds.EXPECT().GetOrgDefaultRole(orgID).Return(orgrole.Viewer, nil)
+	ods.EXPECT().GetUsersInOrg(orgID).Return([]*datastore.UserInfo{
+		{ID: userID},
+		{ID: deactivatedID, IsDeactivated: true},
+	}, nil)
+	rds.EXPECT().GetRoleBindingsInOrg(orgID).Return([]*datastore.RoleBinding{
+		{UserID: userID, Role: orgrole.Admin},
+		{UserID: deactivatedID, Role: orgrole.Admin},
+	}, nil)
+
+	_, err := s.SetUserRoles(createRoleTestContext(orgrole.Admin), &profilepb.SetUserRolesRequest{
+		UserID: utils.ProtoFromUUID(userID),
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestServer_GetOrgRoles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	rds := mock_controllers.NewMockRoleDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, ods, nil, nil, rds)
+
+	userID := uuid.Must(uuid.NewV4())
+	adminID := uuid.Must(uuid.NewV4())
+	orgID := groupTestOrgID
+	rds.EXPECT().GetOrgDefaultRole(orgID).Return(orgrole.Viewer, nil)
+	ods.EXPECT().GetUsersInOrg(orgID).Return([]*datastore.UserInfo{{ID: userID}, {ID: adminID}}, nil)
+	rds.EXPECT().GetRoleBindingsInOrg(orgID).Return([]*datastore.RoleBinding{
+		{UserID: adminID, Role: orgrole.Admin},
+	}, nil)
+
+	resp, err := s.GetOrgRoles(CreateTestContext(), &profilepb.GetOrgRolesRequest{OrgID: utils.ProtoFromUUID(orgID)})
+	require.NoError(t, err)
+	assert.Equal(t, profilepb.ORG_ROLE_VIEWER, resp.DefaultRole)
+	require.Len(t, resp.Users, 2)
+	assert.True(t, resp.Users[0].IsDefault)
+	assert.Equal(t, profilepb.ORG_ROLE_VIEWER, resp.Users[0].Bindings[0].Role)
+	assert.False(t, resp.Users[1].IsDefault)
+	assert.Equal(t, profilepb.ORG_ROLE_ADMIN, resp.Users[1].Bindings[0].Role)
+}
+
+func TestServer_SetOrgDefaultRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	rds := mock_controllers.NewMockRoleDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, ods, nil, nil, rds)
+
+	adminID := uuid.Must(uuid.NewV4())
+	orgID := groupTestOrgID
+	ods.EXPECT().GetUsersInOrg(orgID).Return([]*datastore.UserInfo{{ID: adminID}}, nil)
+	rds.EXPECT().GetRoleBindingsInOrg(orgID).Return([]*datastore.RoleBinding{
+		{UserID: adminID, Role: orgrole.Admin},
+	}, nil)
+	rds.EXPECT().SetOrgDefaultRole(orgID, orgrole.Viewer).Return(nil)
+
+	_, err := s.SetOrgDefaultRole(createRoleTestContext(orgrole.Admin), &profilepb.SetOrgDefaultRoleRequest{
+		OrgID: utils.ProtoFromUUID(orgID),
+		Role:  profilepb.ORG_ROLE_VIEWER,
+	})
+	require.NoError(t, err)
+
+	_, err = s.SetOrgDefaultRole(createRoleTestContext(orgrole.Admin), &profilepb.SetOrgDefaultRoleRequest{
+		OrgID: utils.ProtoFromUUID(orgID),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
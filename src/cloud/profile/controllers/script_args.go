@@ -0,0 +1,130 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/shared/scripts"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	maxScriptArgNameLen    = 256
+	maxScriptArgForbidden  = 100
+	maxScriptArgValueBytes = 1024
+)
+
+func scriptArgPolicyToProto(p *datastore.ScriptArgPolicy) *profilepb.ScriptArgPolicy {
+	return &profilepb.ScriptArgPolicy{
+		ArgName:         p.ArgName,
+		DefaultValue:    p.DefaultValue,
+		MaxLookbackNS:   p.MaxLookbackNS,
+		ForbiddenValues: p.ForbiddenValues,
+	}
+}
+
+// validateScriptArgPolicy makes sure that the policy is well formed, and that its default is allowed by its
+// own bounds.
+func validateScriptArgPolicy(p *profilepb.ScriptArgPolicy) error {
+	if p.ArgName == "" || len(p.ArgName) > maxScriptArgNameLen {
+		return status.Errorf(codes.InvalidArgument, "argument name must be between 1 and %d characters", maxScriptArgNameLen)
+	}
+	if p.MaxLookbackNS < 0 {
+		return status.Error(codes.InvalidArgument, "max lookback must not be negative")
+	}
+	if len(p.ForbiddenValues) > maxScriptArgForbidden {
+		return status.Errorf(codes.InvalidArgument, "an argument may have at most %d forbidden values", maxScriptArgForbidden)
+	}
+	if len(p.DefaultValue) > maxScriptArgValueBytes {
+		return status.Errorf(codes.InvalidArgument, "argument values must be at most %d bytes", maxScriptArgValueBytes)
+	}
+	for _, v := range p.ForbiddenValues {
+		if len(v) > maxScriptArgValueBytes {
+			return status.Errorf(codes.InvalidArgument, "argument values must be at most %d bytes", maxScriptArgValueBytes)
+		}
+	}
+	if p.DefaultValue == "" {
+		return nil
+	}
+	policy := &scripts.ArgPolicy{
+		ArgName:         p.ArgName,
+		MaxLookback:     time.Duration(p.MaxLookbackNS),
+		ForbiddenValues: p.ForbiddenValues,
+	}
+	if err := policy.CheckValue(p.DefaultValue, time.Now()); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid default value: %s", err.Error())
+	}
+	return nil
+}
+
+// GetOrgScriptArgPolicies gets the script argument policies of the org.
+func (s *Server) GetOrgScriptArgPolicies(ctx context.Context, req *profilepb.GetOrgScriptArgPoliciesRequest) (*profilepb.GetOrgScriptArgPoliciesResponse, error) {
+	policies, err := s.osds.GetScriptArgPolicies(utils.UUIDFromProtoOrNil(req.OrgID))
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	resp := &profilepb.GetOrgScriptArgPoliciesResponse{
+		Policies: make([]*profilepb.ScriptArgPolicy, len(policies)),
+	}
+	for i, p := range policies {
+		resp.Policies[i] = scriptArgPolicyToProto(p)
+	}
+	return resp, nil
+}
+
+// SetOrgScriptArgPolicy creates or replaces the org's policy for a script argument.
+func (s *Server) SetOrgScriptArgPolicy(ctx context.Context, req *profilepb.SetOrgScriptArgPolicyRequest) (*profilepb.ScriptArgPolicy, error) {
+	if req.Policy == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing policy")
+	}
+	if err := validateScriptArgPolicy(req.Policy); err != nil {
+		return nil, err
+	}
+
+	policy := &datastore.ScriptArgPolicy{
+		ArgName:         req.Policy.ArgName,
+		DefaultValue:    req.Policy.DefaultValue,
+		MaxLookbackNS:   req.Policy.MaxLookbackNS,
+		ForbiddenValues: req.Policy.ForbiddenValues,
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if err := s.osds.SetScriptArgPolicy(orgID, policy); err != nil {
+		return nil, toExternalError(err)
+	}
+	recordConfigChange(ctx, "set_script_arg_policy", orgID, map[string]string{"arg_name": policy.ArgName})
+	return scriptArgPolicyToProto(policy), nil
+}
+
+// DeleteOrgScriptArgPolicy deletes the org's policy for a script argument.
+func (s *Server) DeleteOrgScriptArgPolicy(ctx context.Context, req *profilepb.DeleteOrgScriptArgPolicyRequest) (*types.Empty, error) {
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if err := s.osds.DeleteScriptArgPolicy(orgID, req.ArgName); err != nil {
+		return nil, toExternalError(err)
+	}
+	recordConfigChange(ctx, "delete_script_arg_policy", orgID, map[string]string{"arg_name": req.ArgName})
+	return &types.Empty{}, nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/profile/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/profile/controllers/mock"
+	"px.dev/pixie/src/cloud/profile/datastore"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/utils"
+)
+
+func TestServer_SetOrgScriptArgPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, nil, osds, nil, nil)
+
+	orgID := uuid.Must(uuid.NewV4())
+	osds.EXPECT().SetScriptArgPolicy(orgID, &datastore.ScriptArgPolicy{
+		ArgName:       "start_time",
+		DefaultValue:  "-5m",
+		MaxLookbackNS: int64(time.Hour),
+	}).Return(nil)
+
+	resp, err := s.SetOrgScriptArgPolicy(context.Background(), &profilepb.SetOrgScriptArgPolicyRequest{
+		OrgID: utils.ProtoFromUUID(orgID),
+		Policy: &profilepb.ScriptArgPolicy{
+			ArgName:       "start_time",
+			DefaultValue:  "-5m",
+			MaxLookbackNS: int64(time.Hour),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "-5m", resp.DefaultValue)
+}
+
+func TestServer_SetOrgScriptArgPolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *profilepb.ScriptArgPolicy
+	}{
+		{
+			name:   "missing policy",
+			policy: nil,
+		},
+		{
+			name:   "missing arg name",
+			policy: &profilepb.ScriptArgPolicy{DefaultValue: "-5m"},
+		},
+		{
+			name:   "negative lookback",
+			policy: &profilepb.ScriptArgPolicy{ArgName: "start_time", MaxLookbackNS: -1},
+		},
+		{
+			name: "default exceeds lookback",
+			policy: &profilepb.ScriptArgPolicy{
+				ArgName:       "start_time",
+				DefaultValue:  "-2h",
+				MaxLookbackNS: int64(time.Hour),
+			},
+		},
+		{
+			name: "forbidden default",
+			policy: &profilepb.ScriptArgPolicy{
+				ArgName:         "namespace",
+				DefaultValue:    "kube-system",
+				ForbiddenValues: []string{"kube-system"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+			s := controllers.NewServer(nil, nil, nil, nil, osds, nil, nil)
+
+			_, err := s.SetOrgScriptArgPolicy(context.Background(), &profilepb.SetOrgScriptArgPolicyRequest{
+				OrgID:  utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+				Policy: test.policy,
+			})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestServer_DeleteOrgScriptArgPolicy_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+	s := controllers.NewServer(nil, nil, nil, nil, osds, nil, nil)
+
+	orgID := uuid.Must(uuid.NewV4())
+	osds.EXPECT().DeleteScriptArgPolicy(orgID, "namespace").Return(datastore.ErrScriptArgPolicyNotFound)
+
+	_, err := s.DeleteOrgScriptArgPolicy(context.Background(), &profilepb.DeleteOrgScriptArgPolicyRequest{
+		OrgID:   utils.ProtoFromUUID(orgID),
+		ArgName: "namespace",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -22,6 +22,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -38,6 +39,8 @@ import (
 	"px.dev/pixie/src/cloud/profile/profileenv"
 	"px.dev/pixie/src/cloud/profile/profilepb"
 	"px.dev/pixie/src/cloud/project_manager/projectmanagerpb"
+	"px.dev/pixie/src/cloud/shared/audit"
+	"px.dev/pixie/src/cloud/shared/residency"
 	"px.dev/pixie/src/shared/services/authcontext"
 	claimsutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
@@ -115,6 +118,52 @@ type OrgSettingsDatastore interface {
 	GetIDEConfigs(uuid.UUID) ([]*datastore.IDEConfig, error)
 	// GetIDEConfig gets the IDE config for the IDE with the given name.
 	GetIDEConfig(uuid.UUID, string) (*datastore.IDEConfig, error)
+	// GetOrgBranding gets the branding of the org.
+	GetOrgBranding(uuid.UUID) (*datastore.OrgBranding, error)
+	// UpdateOrgBranding creates or replaces the branding of the org.
+	UpdateOrgBranding(*datastore.OrgBranding) error
+	// GetEmailTemplates gets the custom email templates of the org.
+	GetEmailTemplates(uuid.UUID) ([]*datastore.EmailTemplate, error)
+	// GetEmailTemplate gets the custom email template of the org with the given name.
+	GetEmailTemplate(uuid.UUID, string) (*datastore.EmailTemplate, error)
+	// SetEmailTemplate creates or replaces the custom email template of the org.
+	SetEmailTemplate(uuid.UUID, *datastore.EmailTemplate) error
+	// DeleteEmailTemplate deletes the custom email template of the org.
+	DeleteEmailTemplate(uuid.UUID, string) error
+	// GetScriptArgPolicies gets the script argument policies of the org.
+	GetScriptArgPolicies(uuid.UUID) ([]*datastore.ScriptArgPolicy, error)
+	// SetScriptArgPolicy creates or replaces the org's policy for a script argument.
+	SetScriptArgPolicy(uuid.UUID, *datastore.ScriptArgPolicy) error
+	// DeleteScriptArgPolicy deletes the org's policy for a script argument.
+	DeleteScriptArgPolicy(uuid.UUID, string) error
+}
+
+// GroupDatastore is the interface used as the backing store for the groups of users in orgs.
+type GroupDatastore interface {
+	// CreateGroup creates a new group with its members.
+	CreateGroup(*datastore.GroupInfo) (uuid.UUID, error)
+	// GetGroup gets a group by ID.
+	GetGroup(uuid.UUID) (*datastore.GroupInfo, error)
+	// GetGroupsInOrg gets all of the groups in the given org.
+	GetGroupsInOrg(uuid.UUID) ([]*datastore.GroupInfo, error)
+	// UpdateGroup updates the group info and replaces its members.
+	UpdateGroup(*datastore.GroupInfo) error
+	// DeleteGroup deletes the group.
+	DeleteGroup(uuid.UUID) error
+}
+
+// RoleDatastore is the interface used as the backing store for the roles of the users in orgs.
+type RoleDatastore interface {
+	// GetRoleBindings gets the roles of the user in the org.
+	GetRoleBindings(orgID uuid.UUID, userID uuid.UUID) ([]*datastore.RoleBinding, error)
+	// GetRoleBindingsInOrg gets the roles of all of the users in the org.
+	GetRoleBindingsInOrg(uuid.UUID) ([]*datastore.RoleBinding, error)
+	// SetRoleBindings replaces the roles of the user in the org.
+	SetRoleBindings(orgID uuid.UUID, userID uuid.UUID, bindings []*datastore.RoleBinding) error
+	// GetOrgDefaultRole gets the role of the users in the org that don't have any roles of their own.
+	GetOrgDefaultRole(uuid.UUID) (string, error)
+	// SetOrgDefaultRole sets the role of the users in the org that don't have any roles of their own.
+	SetOrgDefaultRole(uuid.UUID, string) error
 }
 
 // Server is an implementation of GRPC server for profile service.
@@ -124,11 +173,13 @@ type Server struct {
 	usds UserSettingsDatastore
 	ods  OrgDatastore
 	osds OrgSettingsDatastore
+	gds  GroupDatastore
+	rds  RoleDatastore
 }
 
 // NewServer creates a new GRPC profile server.
-func NewServer(env profileenv.ProfileEnv, uds UserDatastore, usds UserSettingsDatastore, ods OrgDatastore, osds OrgSettingsDatastore) *Server {
-	return &Server{env: env, uds: uds, usds: usds, ods: ods, osds: osds}
+func NewServer(env profileenv.ProfileEnv, uds UserDatastore, usds UserSettingsDatastore, ods OrgDatastore, osds OrgSettingsDatastore, gds GroupDatastore, rds RoleDatastore) *Server {
+	return &Server{env: env, uds: uds, usds: usds, ods: ods, osds: osds, gds: gds, rds: rds}
 }
 
 func userInfoToProto(u *datastore.UserInfo) *profilepb.UserInfo {
@@ -150,6 +201,7 @@ func userInfoToProto(u *datastore.UserInfo) *profilepb.UserInfo {
 		IsApproved:       u.IsApproved,
 		IdentityProvider: u.IdentityProvider,
 		AuthProviderID:   u.AuthProviderID,
+		IsDeactivated:    u.IsDeactivated,
 	}
 }
 
@@ -163,6 +215,7 @@ func orgInfoToProto(o *datastore.OrgInfo) *profilepb.OrgInfo {
 		OrgName:         o.OrgName,
 		DomainName:      domainName,
 		EnableApprovals: o.EnableApprovals,
+		DataResidency:   o.DataResidency,
 	}
 }
 
@@ -171,6 +224,18 @@ func toExternalError(err error) error {
 		return status.Error(codes.NotFound, "no such org")
 	} else if err == datastore.ErrUserNotFound {
 		return status.Error(codes.NotFound, "no such user")
+	} else if err == datastore.ErrDuplicateUser {
+		return status.Error(codes.AlreadyExists, "user already exists")
+	} else if err == datastore.ErrGroupNotFound {
+		return status.Error(codes.NotFound, "no such group")
+	} else if err == datastore.ErrDuplicateGroup {
+		return status.Error(codes.AlreadyExists, "a group with that name already exists in the org")
+	} else if err == datastore.ErrEmailTemplateNotFound {
+		return status.Error(codes.NotFound, "the org has not customized the email template")
+	} else if err == datastore.ErrScriptArgPolicyNotFound {
+		return status.Error(codes.NotFound, "the org has no policy for the script argument")
+	} else if err == datastore.ErrDuplicateRoleBinding {
+		return status.Error(codes.InvalidArgument, "a user may only have one role in the org, and one role for each cluster")
 	}
 	return err
 }
@@ -203,7 +268,10 @@ func (s *Server) CreateUser(ctx context.Context, req *profilepb.CreateUserReques
 		return nil, status.Error(codes.InvalidArgument, "identity provider must not be empty")
 	}
 	uid, err := s.uds.CreateUser(userInfo)
-	return utils.ProtoFromUUID(uid), err
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	return utils.ProtoFromUUID(uid), nil
 }
 
 // GetUser is the GRPC method to get a user.
@@ -399,6 +467,10 @@ func (s *Server) UpdateUser(ctx context.Context, req *profilepb.UpdateUserReques
 		userInfo.IsApproved = req.IsApproved.Value
 	}
 
+	if req.IsDeactivated != nil {
+		userInfo.IsDeactivated = req.IsDeactivated.Value
+	}
+
 	err = s.uds.UpdateUser(userInfo)
 	if err != nil {
 		return nil, toExternalError(err)
@@ -530,6 +602,22 @@ func (s *Server) GetUsersInOrg(ctx context.Context, req *profilepb.GetUsersInOrg
 	}, nil
 }
 
+// recordConfigChange writes a change to the config of the org to the audit log, along with the user who made it.
+// Changes made by other services have no user.
+func recordConfigChange(ctx context.Context, action string, orgID uuid.UUID, details map[string]string) {
+	e := &audit.Event{
+		Category: audit.CategoryConfig,
+		Action:   action,
+		Outcome:  audit.OutcomeSuccess,
+		OrgID:    orgID.String(),
+		Details:  details,
+	}
+	if sCtx, err := authcontext.FromContext(ctx); err == nil {
+		e.UserID = sCtx.Claims.GetUserClaims().GetUserID()
+	}
+	audit.Record(e)
+}
+
 // UpdateOrg updates an orgs info.
 func (s *Server) UpdateOrg(ctx context.Context, req *profilepb.UpdateOrgRequest) (*profilepb.OrgInfo, error) {
 	id := utils.UUIDFromProtoOrNil(req.ID)
@@ -568,6 +656,16 @@ func (s *Server) UpdateOrg(ctx context.Context, req *profilepb.UpdateOrgRequest)
 			orgInfo.DomainName = &req.DomainName.Value
 		}
 	}
+	if req.DataResidency != nil {
+		if err := residency.ValidateRegion(req.DataResidency.Value); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		region := residency.NormalizeRegion(req.DataResidency.Value)
+		if orgInfo.DataResidency != region {
+			hasUpdate = true
+			orgInfo.DataResidency = region
+		}
+	}
 	// If the values are the same, no need to update.
 	if !hasUpdate {
 		return orgInfoToProto(orgInfo), nil
@@ -576,6 +674,11 @@ func (s *Server) UpdateOrg(ctx context.Context, req *profilepb.UpdateOrgRequest)
 	if err := s.ods.UpdateOrg(orgInfo); err != nil {
 		return nil, toExternalError(err)
 	}
+	recordConfigChange(ctx, "update_org", id, map[string]string{
+		"enable_approvals": strconv.FormatBool(orgInfo.EnableApprovals),
+		"domain_name":      orgInfo.GetDomainName(),
+		"data_residency":   orgInfo.DataResidency,
+	})
 	// If EnableApprovals has changed to false, we flip the flag for all users to approve them.
 	if req.EnableApprovals != nil && !orgInfo.EnableApprovals {
 		err = s.ods.ApproveAllOrgUsers(id)
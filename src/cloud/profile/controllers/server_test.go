@@ -196,7 +196,7 @@ func TestServer_CreateUser(t *testing.T) {
 
 	for _, tc := range createUsertests {
 		t.Run(tc.name, func(t *testing.T) {
-			s := controllers.NewServer(nil, uds, usds, ods, osds)
+			s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 			if utils.UUIDFromProtoOrNil(tc.userInfo.OrgID) != uuid.Nil {
 				ods.EXPECT().
 					GetOrg(testOrgUUID).
@@ -242,7 +242,7 @@ func TestServer_CreateOrg(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	testOrgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, nil, nil, ods, osds)
+	s := controllers.NewServer(nil, nil, nil, ods, osds, nil, nil)
 	domain := "pixielabs.ai"
 	req := &datastore.OrgInfo{
 		OrgName:    "pixie",
@@ -270,7 +270,7 @@ func TestServer_CreateOrg_NilDomainName(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	testOrgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, nil, nil, ods, osds)
+	s := controllers.NewServer(nil, nil, nil, ods, osds, nil, nil)
 	req := &datastore.OrgInfo{
 		OrgName: "pixie",
 	}
@@ -299,7 +299,7 @@ func TestServer_GetUser(t *testing.T) {
 
 	userUUID := uuid.Must(uuid.NewV4())
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.UserInfo{
 		ID:             userUUID,
@@ -335,7 +335,7 @@ func TestServer_GetUser_MissingUser(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	userUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 	uds.EXPECT().
 		GetUser(userUUID).
 		Return(nil, nil)
@@ -357,7 +357,7 @@ func TestServer_GetUserByEmail(t *testing.T) {
 
 	userUUID := uuid.Must(uuid.NewV4())
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.UserInfo{
 		ID:               userUUID,
@@ -396,7 +396,7 @@ func TestServer_GetUserByAuthProviderID(t *testing.T) {
 
 	userUUID := uuid.Must(uuid.NewV4())
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.UserInfo{
 		ID:               userUUID,
@@ -433,7 +433,7 @@ func TestServer_GetUserByEmail_MissingEmail(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	uds.EXPECT().
 		GetUserByEmail("foo@bar.com").
@@ -517,9 +517,9 @@ func TestServer_CreateOrgAndUser_SuccessCases(t *testing.T) {
 			}
 			pm.EXPECT().RegisterProject(gomock.Any(), req).Return(resp, nil)
 
-			env := profileenv.New(pm)
+			env := profileenv.New(pm, nil, nil, nil, nil)
 
-			s := controllers.NewServer(env, uds, usds, ods, osds)
+			s := controllers.NewServer(env, uds, usds, ods, osds, nil, nil)
 			exUserInfo := &datastore.UserInfo{
 				FirstName:        tc.req.User.FirstName,
 				LastName:         tc.req.User.LastName,
@@ -590,8 +590,8 @@ func TestServer_CreateOrgAndUser_InvalidArgumentCases(t *testing.T) {
 	for _, tc := range createOrgUserTest {
 		t.Run(tc.name, func(t *testing.T) {
 			pm := mock_projectmanager.NewMockProjectManagerServiceClient(ctrl)
-			env := profileenv.New(pm)
-			s := controllers.NewServer(env, uds, usds, ods, osds)
+			env := profileenv.New(pm, nil, nil, nil, nil)
+			s := controllers.NewServer(env, uds, usds, ods, osds, nil, nil)
 			resp, err := s.CreateOrgAndUser(context.Background(), tc.req)
 			assert.NotNil(t, err)
 			assert.Nil(t, resp)
@@ -621,7 +621,7 @@ func TestServer_CreateOrgAndUser_CreateProjectFailed(t *testing.T) {
 
 	pm.EXPECT().RegisterProject(gomock.Any(), projectReq).Return(nil, fmt.Errorf("an error"))
 
-	env := profileenv.New(pm)
+	env := profileenv.New(pm, nil, nil, nil, nil)
 
 	req := &profilepb.CreateOrgAndUserRequest{
 		Org: &profilepb.CreateOrgAndUserRequest_Org{
@@ -636,7 +636,7 @@ func TestServer_CreateOrgAndUser_CreateProjectFailed(t *testing.T) {
 		},
 	}
 
-	s := controllers.NewServer(env, uds, usds, ods, osds)
+	s := controllers.NewServer(env, uds, usds, ods, osds, nil, nil)
 	exUserInfo := &datastore.UserInfo{
 		FirstName:        req.User.FirstName,
 		LastName:         req.User.LastName,
@@ -671,7 +671,7 @@ func TestServer_GetOrg(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	orgDomain := "my-org.com"
 	mockReply := &datastore.OrgInfo{
@@ -702,7 +702,7 @@ func TestServer_GetOrg_NilDomain(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID:         orgUUID,
@@ -734,7 +734,7 @@ func TestServer_GetOrgs(t *testing.T) {
 	orgUUID := uuid.Must(uuid.NewV4())
 	org2UUID := uuid.Must(uuid.NewV4())
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	org1Domain := "my-org.com"
 	org2Domain := "pixie.com"
@@ -777,7 +777,7 @@ func TestServer_GetOrg_MissingOrg(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	ods.EXPECT().
 		GetOrg(orgUUID).
@@ -799,7 +799,7 @@ func TestServer_GetOrgByName(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	orgDomain := "my-org.com"
 	mockReply := &datastore.OrgInfo{
@@ -831,7 +831,7 @@ func TestServer_GetOrgByName_MissingOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	ods.EXPECT().
 		GetOrgByName("my-org").
@@ -856,7 +856,7 @@ func TestServer_GetOrgByDomain(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgUUID := uuid.Must(uuid.NewV4())
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	orgDomain := "my-org.com"
 	mockReply := &datastore.OrgInfo{
@@ -888,7 +888,7 @@ func TestServer_GetOrgByDomain_MissingOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	ods.EXPECT().
 		GetOrgByDomain("my-org.com").
@@ -912,7 +912,7 @@ func TestServer_DeleteUser(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	userID := uuid.Must(uuid.NewV4())
 	orgID := uuid.Must(uuid.NewV4())
@@ -942,7 +942,7 @@ func TestServer_DeleteUser_MultiUserOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	userID := uuid.Must(uuid.NewV4())
 	orgID := uuid.Must(uuid.NewV4())
@@ -979,7 +979,7 @@ func TestServer_DeleteOrgAndUsers(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	orgUUID := uuid.Must(uuid.NewV4())
 
@@ -1005,7 +1005,7 @@ func TestServer_DeleteOrgAndUsers_MissingOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	orgUUID := uuid.Must(uuid.NewV4())
 	ods.EXPECT().
@@ -1078,7 +1078,7 @@ func TestServer_UpdateUser(t *testing.T) {
 	for _, tc := range updateUserTest {
 		t.Run(tc.name, func(t *testing.T) {
 			ctx := CreateTestContext()
-			s := controllers.NewServer(nil, uds, usds, ods, osds)
+			s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 			userID := uuid.FromStringOrNil(tc.userID)
 			orgID := uuid.FromStringOrNil(tc.userOrg)
 
@@ -1155,7 +1155,7 @@ func TestServer_UpdateOrg_EnableApprovals(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID:              orgID,
@@ -1187,6 +1187,63 @@ func TestServer_UpdateOrg_EnableApprovals(t *testing.T) {
 	assert.Equal(t, resp.EnableApprovals, true)
 }
 
+func TestServer_UpdateOrg_DataResidency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+
+	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
+
+	ods.EXPECT().
+		GetOrg(orgID).
+		Return(&datastore.OrgInfo{ID: orgID}, nil)
+
+	ods.EXPECT().
+		UpdateOrg(&datastore.OrgInfo{ID: orgID, DataResidency: "eu"}).
+		Return(nil)
+
+	resp, err := s.UpdateOrg(
+		CreateTestContext(),
+		&profilepb.UpdateOrgRequest{
+			ID:            utils.ProtoFromUUID(orgID),
+			DataResidency: &types.StringValue{Value: "EU"},
+		})
+
+	require.NoError(t, err)
+	assert.Equal(t, "eu", resp.DataResidency)
+}
+
+func TestServer_UpdateOrg_InvalidDataResidency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+
+	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
+
+	ods.EXPECT().
+		GetOrg(orgID).
+		Return(&datastore.OrgInfo{ID: orgID}, nil)
+
+	_, err := s.UpdateOrg(
+		CreateTestContext(),
+		&profilepb.UpdateOrgRequest{
+			ID:            utils.ProtoFromUUID(orgID),
+			DataResidency: &types.StringValue{Value: "apac"},
+		})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 func TestServer_UpdateOrg_DisableApprovals(t *testing.T) {
 	// Disabling approvals now causes all existing users to become approved.
 	ctrl := gomock.NewController(t)
@@ -1198,7 +1255,7 @@ func TestServer_UpdateOrg_DisableApprovals(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID: orgID,
@@ -1249,7 +1306,7 @@ func TestServer_UpdateOrg_NoChangeInState(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID:              orgID,
@@ -1283,7 +1340,7 @@ func TestServer_UpdateOrg_EnableApprovalsIsNull(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID:              orgID,
@@ -1316,7 +1373,7 @@ func TestServer_UpdateOrg_DomainName(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID:         orgID,
@@ -1365,7 +1422,7 @@ func TestServer_UpdateOrg_NilToEmptyDomainName(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID:         orgID,
@@ -1415,7 +1472,7 @@ func TestServer_UpdateOrg_DomainName_EnableApprovals(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	mockReply := &datastore.OrgInfo{
 		ID:              orgID,
@@ -1466,7 +1523,7 @@ func TestServer_UpdateOrg_RequestBlockedForUserOutsideOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 	_, err := s.UpdateOrg(
 		CreateTestContext(),
 		&profilepb.UpdateOrgRequest{
@@ -1487,7 +1544,7 @@ func TestServer_GetUserAttributes(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	userID := uuid.Must(uuid.NewV4())
 	tourSeen := true
@@ -1511,7 +1568,7 @@ func TestServer_SetUserAttributes(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	userID := uuid.Must(uuid.NewV4())
 	tourSeen := true
@@ -1539,7 +1596,7 @@ func TestServer_GetUserSettings(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	userID := uuid.Must(uuid.NewV4())
 	analyticsOptout := true
@@ -1563,7 +1620,7 @@ func TestServer_UpdateUserSettings(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	userID := uuid.Must(uuid.NewV4())
 	analyticsOptout := true
@@ -1608,7 +1665,7 @@ func TestServer_GetUsersInOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	ods.EXPECT().
 		GetUsersInOrg(orgID).
@@ -1659,7 +1716,7 @@ func TestServer_AddOrgIDEConfig(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	osds.EXPECT().
 		AddIDEConfig(orgID, &datastore.IDEConfig{Name: "test", Path: "test://path/{{symbol}}"}).
@@ -1691,7 +1748,7 @@ func TestServer_DeleteOrgIDEConfig(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	osds.EXPECT().
 		DeleteIDEConfig(orgID, "test").
@@ -1717,7 +1774,7 @@ func TestServer_GetOrgIDEConfigs_Single(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	osds.EXPECT().
 		GetIDEConfig(orgID, "test").
@@ -1753,7 +1810,7 @@ func TestServer_GetOrgIDEConfigs_Multi(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	osds.EXPECT().
 		GetIDEConfigs(orgID).
@@ -1798,7 +1855,7 @@ func TestServer_CreateInviteToken(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	inviteSigningKey := "secret_jwt_key"
 	ods.EXPECT().
@@ -1832,7 +1889,7 @@ func TestServer_CreateInviteToken_NoSigningKey(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	inviteSigningKey := "secret_jwt_key"
 	ods.EXPECT().
@@ -1869,7 +1926,7 @@ func TestServer_CreateInviteToken_BadOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	_, err := s.CreateInviteToken(ctx, &profilepb.CreateInviteTokenRequest{
 		OrgID: utils.ProtoFromUUID(uuid.Nil),
@@ -1889,7 +1946,7 @@ func TestServer_RevokeInvites(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	ods.EXPECT().
 		CreateInviteSigningKey(orgID)
@@ -1908,7 +1965,7 @@ func TestServer_RevokeInvites_BadOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	_, err := s.RevokeAllInviteTokens(ctx, utils.ProtoFromUUID(uuid.Nil))
 	require.Error(t, err)
@@ -1926,7 +1983,7 @@ func TestServer_VerifyInvites_Good(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	inviteSigningKey := "secret_jwt_key"
 	builder := jwt.NewBuilder().
@@ -1962,7 +2019,7 @@ func TestServer_VerifyInvites_Expired(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	inviteSigningKey := "secret_jwt_key"
 	builder := jwt.NewBuilder().
@@ -1991,7 +2048,7 @@ func TestServer_VerifyInvites_BadSigningKey(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	inviteSigningKey := "secret_jwt_key"
 	builder := jwt.NewBuilder().
@@ -2022,7 +2079,7 @@ func TestServer_VerifyInvites_BadOrg(t *testing.T) {
 	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
-	s := controllers.NewServer(nil, uds, usds, ods, osds)
+	s := controllers.NewServer(nil, uds, usds, ods, osds, nil, nil)
 
 	inviteSigningKey := "secret_jwt_key"
 	builder := jwt.NewBuilder().
@@ -20,6 +20,7 @@ package datastore
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
@@ -49,6 +50,7 @@ type UserInfo struct {
 	Email            string     `db:"email"`
 	ProfilePicture   *string    `db:"profile_picture"`
 	IsApproved       bool       `db:"is_approved"`
+	IsDeactivated    bool       `db:"is_deactivated"`
 	IdentityProvider string     `db:"identity_provider"`
 	AuthProviderID   string     `db:"auth_provider_id"`
 }
@@ -59,6 +61,9 @@ type OrgInfo struct {
 	OrgName         string    `db:"org_name"`
 	DomainName      *string   `db:"domain_name"`
 	EnableApprovals bool      `db:"enable_approvals"`
+	// DataResidency restricts the regions that may process or store data for the org.
+	// An empty value means the org is unrestricted.
+	DataResidency string `db:"data_residency"`
 }
 
 // GetDomainName is a helper to nil check the DomainName column value and convert
@@ -96,6 +101,16 @@ var (
 	ErrDuplicateOrgName = errors.New("cannot create org (name already in use)")
 	// ErrDuplicateUser is used when the user creation violates unique constraints for auth_provider_id or email.
 	ErrDuplicateUser = errors.New("cannot create duplicate user")
+	// ErrGroupNotFound is used when a group is not found.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrEmailTemplateNotFound is used when an org has no custom email template with the given name.
+	ErrEmailTemplateNotFound = errors.New("email template not found")
+	// ErrDuplicateGroup is used when the group's display name is already in use in the org.
+	ErrDuplicateGroup = errors.New("cannot create duplicate group")
+	// ErrDuplicateRoleBinding is used when a user is given more than one role in the org, or for a cluster.
+	ErrDuplicateRoleBinding = errors.New("cannot create duplicate role binding")
+	// ErrScriptArgPolicyNotFound is used when an org has no policy for the script argument.
+	ErrScriptArgPolicyNotFound = errors.New("script argument policy not found")
 )
 
 // CreateUser creates a new user.
@@ -126,7 +141,7 @@ func (d *Datastore) CreateUser(userInfo *UserInfo) (uuid.UUID, error) {
 
 // GetUser gets user information by user ID.
 func (d *Datastore) GetUser(id uuid.UUID) (*UserInfo, error) {
-	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, identity_provider, auth_provider_id FROM users WHERE id=$1`
+	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, is_deactivated, identity_provider, auth_provider_id FROM users WHERE id=$1`
 	rows, err := d.db.Queryx(query, id)
 	if err != nil {
 		return nil, err
@@ -194,7 +209,7 @@ func (d *Datastore) CreateUserAndOrg(orgInfo *OrgInfo, userInfo *UserInfo) (uuid
 
 // GetOrg gets org information by ID.
 func (d *Datastore) GetOrg(id uuid.UUID) (*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs WHERE id=$1`
+	query := `SELECT id, org_name, domain_name, enable_approvals, data_residency FROM orgs WHERE id=$1`
 	rows, err := d.db.Queryx(query, id)
 	if err != nil {
 		return nil, err
@@ -211,7 +226,7 @@ func (d *Datastore) GetOrg(id uuid.UUID) (*OrgInfo, error) {
 
 // GetOrgs gets all orgs.
 func (d *Datastore) GetOrgs() ([]*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs`
+	query := `SELECT id, org_name, domain_name, enable_approvals, data_residency FROM orgs`
 	rows, err := d.db.Queryx(query)
 	if err != nil {
 		return nil, err
@@ -232,7 +247,7 @@ func (d *Datastore) GetOrgs() ([]*OrgInfo, error) {
 
 // GetOrgByName gets org information by domain.
 func (d *Datastore) GetOrgByName(name string) (*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs WHERE org_name=$1`
+	query := `SELECT id, org_name, domain_name, enable_approvals, data_residency FROM orgs WHERE org_name=$1`
 	rows, err := d.db.Queryx(query, name)
 	if err != nil {
 		return nil, err
@@ -249,7 +264,7 @@ func (d *Datastore) GetOrgByName(name string) (*OrgInfo, error) {
 
 // GetOrgByDomain gets org information by domain.
 func (d *Datastore) GetOrgByDomain(domainName string) (*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs WHERE domain_name=$1`
+	query := `SELECT id, org_name, domain_name, enable_approvals, data_residency FROM orgs WHERE domain_name=$1`
 	rows, err := d.db.Queryx(query, domainName)
 	if err != nil {
 		return nil, err
@@ -315,7 +330,7 @@ func (d *Datastore) CreateInviteSigningKey(id uuid.UUID) (string, error) {
 
 // GetUserByEmail gets user info by email.
 func (d *Datastore) GetUserByEmail(email string) (*UserInfo, error) {
-	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, identity_provider, auth_provider_id FROM users WHERE email=$1`
+	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, is_deactivated, identity_provider, auth_provider_id FROM users WHERE email=$1`
 	rows, err := d.db.Queryx(query, email)
 	if err != nil {
 		return nil, err
@@ -332,7 +347,7 @@ func (d *Datastore) GetUserByEmail(email string) (*UserInfo, error) {
 
 // GetUserByAuthProviderID gets userinfo by auth provider id.
 func (d *Datastore) GetUserByAuthProviderID(id string) (*UserInfo, error) {
-	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, identity_provider, auth_provider_id FROM users WHERE auth_provider_id=$1`
+	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, is_deactivated, identity_provider, auth_provider_id FROM users WHERE auth_provider_id=$1`
 	rows, err := d.db.Queryx(query, id)
 	if err != nil {
 		return nil, err
@@ -457,7 +472,7 @@ func (d *Datastore) createOrgUsingTxn(txn *sqlx.Tx, orgInfo *OrgInfo) (uuid.UUID
 
 // GetUsersInOrg gets all users in the given org.
 func (d *Datastore) GetUsersInOrg(orgID uuid.UUID) ([]*UserInfo, error) {
-	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, identity_provider, auth_provider_id FROM users WHERE org_id=$1 order by created_at desc`
+	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, is_deactivated, identity_provider, auth_provider_id FROM users WHERE org_id=$1 order by created_at desc`
 	rows, err := d.db.Queryx(query, orgID)
 	if err != nil {
 		return nil, err
@@ -498,14 +513,14 @@ func (d *Datastore) NumUsersInOrg(orgID uuid.UUID) (int, error) {
 
 // UpdateUser updates the user in the database.
 func (d *Datastore) UpdateUser(userInfo *UserInfo) error {
-	query := `UPDATE users SET profile_picture = :profile_picture, is_approved = :is_approved, org_id = :org_id WHERE id = :id`
+	query := `UPDATE users SET profile_picture = :profile_picture, is_approved = :is_approved, is_deactivated = :is_deactivated, org_id = :org_id WHERE id = :id`
 	_, err := d.db.NamedExec(query, userInfo)
 	return err
 }
 
 // UpdateOrg updates the org in the database.
 func (d *Datastore) UpdateOrg(orgInfo *OrgInfo) error {
-	query := `UPDATE orgs SET enable_approvals = :enable_approvals, domain_name = :domain_name WHERE id = :id`
+	query := `UPDATE orgs SET enable_approvals = :enable_approvals, domain_name = :domain_name, data_residency = :data_residency WHERE id = :id`
 	_, err := d.db.NamedExec(query, orgInfo)
 	return err
 }
@@ -725,3 +740,391 @@ func (d *Datastore) GetIDEConfig(orgID uuid.UUID, name string) (*IDEConfig, erro
 	}
 	return nil, errors.New("failed to get IDE config for IDE with given name")
 }
+
+// OrgBranding is the branding that an org uses in place of Pixie's, in the UI and in the emails sent to its users.
+type OrgBranding struct {
+	OrgID       uuid.UUID `db:"org_id"`
+	ProductName string    `db:"product_name"`
+	LogoURL     string    `db:"logo_url"`
+}
+
+// GetOrgBranding gets the branding of the org. Orgs that have not set their branding get an empty one.
+func (d *Datastore) GetOrgBranding(orgID uuid.UUID) (*OrgBranding, error) {
+	query := `SELECT org_id, product_name, logo_url FROM org_branding WHERE org_id=$1`
+	branding := &OrgBranding{}
+	err := d.db.Get(branding, query, orgID)
+	if err == sql.ErrNoRows {
+		return &OrgBranding{OrgID: orgID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return branding, nil
+}
+
+// UpdateOrgBranding creates or replaces the branding of the org.
+func (d *Datastore) UpdateOrgBranding(branding *OrgBranding) error {
+	query := `INSERT INTO org_branding (org_id, product_name, logo_url) VALUES (:org_id, :product_name, :logo_url)
+		ON CONFLICT (org_id) DO UPDATE SET product_name=EXCLUDED.product_name, logo_url=EXCLUDED.logo_url, updated_at=NOW()`
+	_, err := d.db.NamedExec(query, branding)
+	return err
+}
+
+// EmailTemplate is an org's custom template of an email sent to its users.
+type EmailTemplate struct {
+	Name    string `db:"name"`
+	Subject string `db:"subject"`
+	Body    string `db:"body"`
+}
+
+// GetEmailTemplates gets the custom email templates of the org.
+func (d *Datastore) GetEmailTemplates(orgID uuid.UUID) ([]*EmailTemplate, error) {
+	query := `SELECT name, subject, body FROM org_email_templates WHERE org_id=$1 ORDER BY name`
+	templates := make([]*EmailTemplate, 0)
+	if err := d.db.Select(&templates, query, orgID); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// GetEmailTemplate gets the custom email template of the org with the given name.
+func (d *Datastore) GetEmailTemplate(orgID uuid.UUID, name string) (*EmailTemplate, error) {
+	query := `SELECT name, subject, body FROM org_email_templates WHERE org_id=$1 AND name=$2`
+	tmpl := &EmailTemplate{}
+	err := d.db.Get(tmpl, query, orgID, name)
+	if err == sql.ErrNoRows {
+		return nil, ErrEmailTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// SetEmailTemplate creates or replaces the custom email template of the org.
+func (d *Datastore) SetEmailTemplate(orgID uuid.UUID, tmpl *EmailTemplate) error {
+	query := `INSERT INTO org_email_templates (org_id, name, subject, body) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (org_id, name) DO UPDATE SET subject=EXCLUDED.subject, body=EXCLUDED.body, updated_at=NOW()`
+	_, err := d.db.Exec(query, orgID, tmpl.Name, tmpl.Subject, tmpl.Body)
+	return err
+}
+
+// DeleteEmailTemplate deletes the custom email template of the org.
+func (d *Datastore) DeleteEmailTemplate(orgID uuid.UUID, name string) error {
+	query := `DELETE FROM org_email_templates WHERE org_id=$1 AND name=$2`
+	res, err := d.db.Exec(query, orgID, name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEmailTemplateNotFound
+	}
+	return nil
+}
+
+// ScriptArgPolicy is an org's default and bounds for a script argument.
+type ScriptArgPolicy struct {
+	ArgName         string   `db:"arg_name"`
+	DefaultValue    string   `db:"default_value"`
+	MaxLookbackNS   int64    `db:"max_lookback_ns"`
+	ForbiddenValues []string `db:"-"`
+}
+
+// GetScriptArgPolicies gets the script argument policies of the org.
+func (d *Datastore) GetScriptArgPolicies(orgID uuid.UUID) ([]*ScriptArgPolicy, error) {
+	query := `SELECT arg_name, default_value, max_lookback_ns FROM org_script_arg_policies WHERE org_id=$1 ORDER BY arg_name`
+	policies := make([]*ScriptArgPolicy, 0)
+	if err := d.db.Select(&policies, query, orgID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Queryx(`SELECT arg_name, value FROM org_script_arg_forbidden_values WHERE org_id=$1 ORDER BY arg_name, value`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	forbidden := make(map[string][]string)
+	for rows.Next() {
+		var argName, value string
+		if err := rows.Scan(&argName, &value); err != nil {
+			return nil, err
+		}
+		forbidden[argName] = append(forbidden[argName], value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, p := range policies {
+		p.ForbiddenValues = forbidden[p.ArgName]
+	}
+	return policies, nil
+}
+
+// SetScriptArgPolicy creates or replaces the org's policy for the script argument.
+func (d *Datastore) SetScriptArgPolicy(orgID uuid.UUID, policy *ScriptArgPolicy) error {
+	txn, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	query := `INSERT INTO org_script_arg_policies (org_id, arg_name, default_value, max_lookback_ns) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (org_id, arg_name) DO UPDATE SET default_value=EXCLUDED.default_value, max_lookback_ns=EXCLUDED.max_lookback_ns, updated_at=NOW()`
+	if _, err := txn.Exec(query, orgID, policy.ArgName, policy.DefaultValue, policy.MaxLookbackNS); err != nil {
+		return err
+	}
+	if _, err := txn.Exec(`DELETE FROM org_script_arg_forbidden_values WHERE org_id=$1 AND arg_name=$2`, orgID, policy.ArgName); err != nil {
+		return err
+	}
+	query = `INSERT INTO org_script_arg_forbidden_values (org_id, arg_name, value) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	for _, v := range policy.ForbiddenValues {
+		if _, err := txn.Exec(query, orgID, policy.ArgName, v); err != nil {
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// DeleteScriptArgPolicy deletes the org's policy for the script argument.
+func (d *Datastore) DeleteScriptArgPolicy(orgID uuid.UUID, argName string) error {
+	query := `DELETE FROM org_script_arg_policies WHERE org_id=$1 AND arg_name=$2`
+	res, err := d.db.Exec(query, orgID, argName)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrScriptArgPolicyNotFound
+	}
+	return nil
+}
+
+// GroupInfo is a group of users in an org.
+type GroupInfo struct {
+	ID          uuid.UUID   `db:"id"`
+	OrgID       uuid.UUID   `db:"org_id"`
+	DisplayName string      `db:"display_name"`
+	ExternalID  string      `db:"external_id"`
+	MemberIDs   []uuid.UUID `db:"-"`
+}
+
+// CreateGroup creates a group along with its members, returning the created group ID.
+func (d *Datastore) CreateGroup(groupInfo *GroupInfo) (uuid.UUID, error) {
+	txn, err := d.db.Beginx()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer txn.Rollback()
+
+	query := `INSERT INTO scim_groups (org_id, display_name, external_id) VALUES ($1, $2, $3) RETURNING id`
+	var id uuid.UUID
+	err = txn.QueryRowx(query, groupInfo.OrgID, groupInfo.DisplayName, groupInfo.ExternalID).Scan(&id)
+	if e, ok := err.(pgx.PgError); ok && e.Code == uniqueViolation {
+		return uuid.Nil, ErrDuplicateGroup
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := setGroupMembersUsingTxn(txn, id, groupInfo.MemberIDs); err != nil {
+		return uuid.Nil, err
+	}
+	return id, txn.Commit()
+}
+
+// GetGroup gets a group and its members by ID.
+func (d *Datastore) GetGroup(id uuid.UUID) (*GroupInfo, error) {
+	query := `SELECT id, org_id, display_name, external_id FROM scim_groups WHERE id=$1`
+	var groupInfo GroupInfo
+	err := d.db.Get(&groupInfo, query, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := d.getGroupMembers(`WHERE group_id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	groupInfo.MemberIDs = members[id]
+	return &groupInfo, nil
+}
+
+// GetGroupsInOrg gets all of the groups in the given org, along with their members.
+func (d *Datastore) GetGroupsInOrg(orgID uuid.UUID) ([]*GroupInfo, error) {
+	query := `SELECT id, org_id, display_name, external_id FROM scim_groups WHERE org_id=$1 ORDER BY display_name`
+	groups := make([]*GroupInfo, 0)
+	if err := d.db.Select(&groups, query, orgID); err != nil {
+		return nil, err
+	}
+
+	members, err := d.getGroupMembers(`JOIN scim_groups ON scim_groups.id=scim_group_members.group_id WHERE scim_groups.org_id=$1`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		g.MemberIDs = members[g.ID]
+	}
+	return groups, nil
+}
+
+// getGroupMembers returns the members of the groups that match the given filter, keyed by group ID.
+func (d *Datastore) getGroupMembers(filter string, args ...interface{}) (map[uuid.UUID][]uuid.UUID, error) {
+	query := `SELECT group_id, user_id FROM scim_group_members ` + filter + ` ORDER BY user_id`
+	rows, err := d.db.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[uuid.UUID][]uuid.UUID)
+	for rows.Next() {
+		var groupID, userID uuid.UUID
+		if err := rows.Scan(&groupID, &userID); err != nil {
+			return nil, err
+		}
+		members[groupID] = append(members[groupID], userID)
+	}
+	return members, rows.Err()
+}
+
+// UpdateGroup updates the name of the group and replaces its members.
+func (d *Datastore) UpdateGroup(groupInfo *GroupInfo) error {
+	txn, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	query := `UPDATE scim_groups SET display_name=$2, external_id=$3, updated_at=NOW() WHERE id=$1`
+	res, err := txn.Exec(query, groupInfo.ID, groupInfo.DisplayName, groupInfo.ExternalID)
+	if e, ok := err.(pgx.PgError); ok && e.Code == uniqueViolation {
+		return ErrDuplicateGroup
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupNotFound
+	}
+
+	if _, err := txn.Exec(`DELETE FROM scim_group_members WHERE group_id=$1`, groupInfo.ID); err != nil {
+		return err
+	}
+	if err := setGroupMembersUsingTxn(txn, groupInfo.ID, groupInfo.MemberIDs); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+func setGroupMembersUsingTxn(txn *sqlx.Tx, groupID uuid.UUID, memberIDs []uuid.UUID) error {
+	query := `INSERT INTO scim_group_members (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	for _, userID := range memberIDs {
+		if _, err := txn.Exec(query, groupID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteGroup deletes the group.
+func (d *Datastore) DeleteGroup(id uuid.UUID) error {
+	res, err := d.db.Exec(`DELETE FROM scim_groups WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// RoleBinding is a role of a user in an org, which only applies to a cluster if ClusterID is set.
+type RoleBinding struct {
+	UserID    uuid.UUID  `db:"user_id"`
+	Role      string     `db:"role"`
+	ClusterID *uuid.UUID `db:"cluster_id"`
+}
+
+// GetRoleBindings gets the roles of the user in the org.
+func (d *Datastore) GetRoleBindings(orgID uuid.UUID, userID uuid.UUID) ([]*RoleBinding, error) {
+	query := `SELECT user_id, role, cluster_id FROM org_role_bindings WHERE org_id=$1 AND user_id=$2 ORDER BY cluster_id NULLS FIRST`
+	bindings := make([]*RoleBinding, 0)
+	if err := d.db.Select(&bindings, query, orgID, userID); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// GetRoleBindingsInOrg gets the roles of all of the users in the org.
+func (d *Datastore) GetRoleBindingsInOrg(orgID uuid.UUID) ([]*RoleBinding, error) {
+	query := `SELECT user_id, role, cluster_id FROM org_role_bindings WHERE org_id=$1 ORDER BY user_id, cluster_id NULLS FIRST`
+	bindings := make([]*RoleBinding, 0)
+	if err := d.db.Select(&bindings, query, orgID); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// SetRoleBindings replaces the roles of the user in the org.
+func (d *Datastore) SetRoleBindings(orgID uuid.UUID, userID uuid.UUID, bindings []*RoleBinding) error {
+	txn, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	if _, err := txn.Exec(`DELETE FROM org_role_bindings WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	query := `INSERT INTO org_role_bindings (org_id, user_id, role, cluster_id) VALUES ($1, $2, $3, $4)`
+	for _, b := range bindings {
+		if _, err := txn.Exec(query, orgID, userID, b.Role, b.ClusterID); err != nil {
+			if e, ok := err.(pgx.PgError); ok && e.Code == uniqueViolation {
+				return ErrDuplicateRoleBinding
+			}
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// GetOrgDefaultRole gets the role of the users in the org that don't have any roles of their own.
+func (d *Datastore) GetOrgDefaultRole(orgID uuid.UUID) (string, error) {
+	var role string
+	err := d.db.Get(&role, `SELECT default_role FROM orgs WHERE id=$1`, orgID)
+	if err == sql.ErrNoRows {
+		return "", ErrOrgNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// SetOrgDefaultRole sets the role of the users in the org that don't have any roles of their own.
+func (d *Datastore) SetOrgDefaultRole(orgID uuid.UUID, role string) error {
+	res, err := d.db.Exec(`UPDATE orgs SET default_role=$2 WHERE id=$1`, orgID, role)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrOrgNotFound
+	}
+	return nil
+}
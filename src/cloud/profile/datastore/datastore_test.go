@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	bindata "github.com/golang-migrate/migrate/source/go_bindata"
@@ -63,7 +64,13 @@ func testMain(m *testing.M) error {
 
 func mustLoadTestData(db *sqlx.DB) {
 	// Cleanup.
+	db.MustExec(`DELETE FROM org_role_bindings`)
+	db.MustExec(`DELETE FROM scim_groups`)
 	db.MustExec(`DELETE FROM org_ide_configs`)
+	db.MustExec(`DELETE FROM org_branding`)
+	db.MustExec(`DELETE FROM org_email_templates`)
+	db.MustExec(`DELETE FROM org_script_arg_forbidden_values`)
+	db.MustExec(`DELETE FROM org_script_arg_policies`)
 	db.MustExec(`DELETE FROM user_attributes`)
 	db.MustExec(`DELETE FROM user_settings`)
 	db.MustExec(`DELETE FROM users`)
@@ -777,4 +784,212 @@ func TestDatastore(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, 2, len(ideConfigs))
 	})
+
+	t.Run("get and update org branding", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		orgID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+		branding, err := d.GetOrgBranding(orgID)
+		require.NoError(t, err)
+		assert.Equal(t, &datastore.OrgBranding{OrgID: orgID}, branding)
+
+		branding.ProductName = "Acme Observability"
+		branding.LogoURL = "https://acme.com/logo.png"
+		require.NoError(t, d.UpdateOrgBranding(branding))
+		branding.LogoURL = "https://acme.com/logo2.png"
+		require.NoError(t, d.UpdateOrgBranding(branding))
+
+		branding, err = d.GetOrgBranding(orgID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme Observability", branding.ProductName)
+		assert.Equal(t, "https://acme.com/logo2.png", branding.LogoURL)
+	})
+
+	t.Run("set, get and delete script arg policies", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		orgID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+		policies, err := d.GetScriptArgPolicies(orgID)
+		require.NoError(t, err)
+		assert.Empty(t, policies)
+
+		require.NoError(t, d.SetScriptArgPolicy(orgID, &datastore.ScriptArgPolicy{
+			ArgName:         "start_time",
+			DefaultValue:    "-5m",
+			MaxLookbackNS:   int64(time.Hour),
+			ForbiddenValues: []string{"-2h"},
+		}))
+		require.NoError(t, d.SetScriptArgPolicy(orgID, &datastore.ScriptArgPolicy{
+			ArgName:         "namespace",
+			ForbiddenValues: []string{"kube-system", "secrets"},
+		}))
+		require.NoError(t, d.SetScriptArgPolicy(orgID, &datastore.ScriptArgPolicy{
+			ArgName:       "start_time",
+			DefaultValue:  "-15m",
+			MaxLookbackNS: int64(time.Hour),
+		}))
+
+		policies, err = d.GetScriptArgPolicies(orgID)
+		require.NoError(t, err)
+		require.Len(t, policies, 2)
+		assert.Equal(t, &datastore.ScriptArgPolicy{
+			ArgName:         "namespace",
+			ForbiddenValues: []string{"kube-system", "secrets"},
+		}, policies[0])
+		assert.Equal(t, &datastore.ScriptArgPolicy{
+			ArgName:       "start_time",
+			DefaultValue:  "-15m",
+			MaxLookbackNS: int64(time.Hour),
+		}, policies[1])
+
+		require.NoError(t, d.DeleteScriptArgPolicy(orgID, "namespace"))
+		assert.Equal(t, datastore.ErrScriptArgPolicyNotFound, d.DeleteScriptArgPolicy(orgID, "namespace"))
+		policies, err = d.GetScriptArgPolicies(orgID)
+		require.NoError(t, err)
+		assert.Len(t, policies, 1)
+	})
+
+	t.Run("set, get and delete email templates", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		orgID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+		_, err := d.GetEmailTemplate(orgID, "invite")
+		assert.Equal(t, datastore.ErrEmailTemplateNotFound, err)
+
+		require.NoError(t, d.SetEmailTemplate(orgID, &datastore.EmailTemplate{Name: "invite", Subject: "a", Body: "b"}))
+		require.NoError(t, d.SetEmailTemplate(orgID, &datastore.EmailTemplate{Name: "invite", Subject: "c", Body: "d"}))
+		require.NoError(t, d.SetEmailTemplate(orgID, &datastore.EmailTemplate{Name: "notification", Subject: "e", Body: "f"}))
+
+		tmpl, err := d.GetEmailTemplate(orgID, "invite")
+		require.NoError(t, err)
+		assert.Equal(t, &datastore.EmailTemplate{Name: "invite", Subject: "c", Body: "d"}, tmpl)
+
+		tmpls, err := d.GetEmailTemplates(orgID)
+		require.NoError(t, err)
+		require.Len(t, tmpls, 2)
+		assert.Equal(t, "invite", tmpls[0].Name)
+		assert.Equal(t, "notification", tmpls[1].Name)
+
+		require.NoError(t, d.DeleteEmailTemplate(orgID, "invite"))
+		assert.Equal(t, datastore.ErrEmailTemplateNotFound, d.DeleteEmailTemplate(orgID, "invite"))
+	})
+
+	t.Run("create, update and delete group", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		orgID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+		user1 := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+		user2 := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440002")
+
+		groupID, err := d.CreateGroup(&datastore.GroupInfo{
+			OrgID:       orgID,
+			DisplayName: "engineering",
+			ExternalID:  "ext-1",
+			MemberIDs:   []uuid.UUID{user1},
+		})
+		require.NoError(t, err)
+
+		_, err = d.CreateGroup(&datastore.GroupInfo{OrgID: orgID, DisplayName: "engineering"})
+		assert.Equal(t, datastore.ErrDuplicateGroup, err)
+
+		group, err := d.GetGroup(groupID)
+		require.NoError(t, err)
+		assert.Equal(t, "engineering", group.DisplayName)
+		assert.Equal(t, "ext-1", group.ExternalID)
+		assert.Equal(t, []uuid.UUID{user1}, group.MemberIDs)
+
+		group.DisplayName = "platform"
+		group.MemberIDs = []uuid.UUID{user2}
+		require.NoError(t, d.UpdateGroup(group))
+
+		groups, err := d.GetGroupsInOrg(orgID)
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+		assert.Equal(t, "platform", groups[0].DisplayName)
+		assert.Equal(t, []uuid.UUID{user2}, groups[0].MemberIDs)
+
+		// Deleting a user removes them from their groups.
+		require.NoError(t, d.DeleteUser(user2))
+		group, err = d.GetGroup(groupID)
+		require.NoError(t, err)
+		assert.Empty(t, group.MemberIDs)
+
+		require.NoError(t, d.DeleteGroup(groupID))
+		_, err = d.GetGroup(groupID)
+		assert.Equal(t, datastore.ErrGroupNotFound, err)
+		assert.Equal(t, datastore.ErrGroupNotFound, d.DeleteGroup(groupID))
+	})
+
+	t.Run("set and get role bindings", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		orgID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+		user1 := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+		user2 := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440002")
+		clusterID := uuid.Must(uuid.NewV4())
+
+		role, err := d.GetOrgDefaultRole(orgID)
+		require.NoError(t, err)
+		assert.Equal(t, "admin", role)
+		require.NoError(t, d.SetOrgDefaultRole(orgID, "viewer"))
+		role, err = d.GetOrgDefaultRole(orgID)
+		require.NoError(t, err)
+		assert.Equal(t, "viewer", role)
+		assert.Equal(t, datastore.ErrOrgNotFound, d.SetOrgDefaultRole(uuid.Must(uuid.NewV4()), "viewer"))
+
+		bindings, err := d.GetRoleBindings(orgID, user1)
+		require.NoError(t, err)
+		assert.Empty(t, bindings)
+
+		require.NoError(t, d.SetRoleBindings(orgID, user1, []*datastore.RoleBinding{
+			{Role: "viewer"},
+			{Role: "editor", ClusterID: &clusterID},
+		}))
+		require.NoError(t, d.SetRoleBindings(orgID, user2, []*datastore.RoleBinding{{Role: "admin"}}))
+
+		bindings, err = d.GetRoleBindings(orgID, user1)
+		require.NoError(t, err)
+		require.Len(t, bindings, 2)
+		assert.Equal(t, "viewer", bindings[0].Role)
+		assert.Nil(t, bindings[0].ClusterID)
+		assert.Equal(t, "editor", bindings[1].Role)
+		assert.Equal(t, clusterID, *bindings[1].ClusterID)
+
+		err = d.SetRoleBindings(orgID, user1, []*datastore.RoleBinding{{Role: "viewer"}, {Role: "editor"}})
+		assert.Equal(t, datastore.ErrDuplicateRoleBinding, err)
+		// The roles aren't changed when setting them fails.
+		bindings, err = d.GetRoleBindings(orgID, user1)
+		require.NoError(t, err)
+		assert.Len(t, bindings, 2)
+
+		bindings, err = d.GetRoleBindingsInOrg(orgID)
+		require.NoError(t, err)
+		assert.Len(t, bindings, 3)
+
+		require.NoError(t, d.SetRoleBindings(orgID, user1, nil))
+		bindings, err = d.GetRoleBindingsInOrg(orgID)
+		require.NoError(t, err)
+		require.Len(t, bindings, 1)
+		assert.Equal(t, user2, bindings[0].UserID)
+	})
+
+	t.Run("deactivate user", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		userID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+
+		userInfo, err := d.GetUser(userID)
+		require.NoError(t, err)
+		assert.False(t, userInfo.IsDeactivated)
+
+		userInfo.IsDeactivated = true
+		require.NoError(t, d.UpdateUser(userInfo))
+
+		userInfo, err = d.GetUser(userID)
+		require.NoError(t, err)
+		assert.True(t, userInfo.IsDeactivated)
+	})
 }
@@ -31,6 +31,7 @@ import (
 	"px.dev/pixie/src/cloud/profile/profileenv"
 	"px.dev/pixie/src/cloud/profile/profilepb"
 	"px.dev/pixie/src/cloud/profile/schema"
+	"px.dev/pixie/src/cloud/shared/audit"
 	"px.dev/pixie/src/cloud/shared/pgmigrate"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/healthz"
@@ -40,6 +41,7 @@ import (
 
 func main() {
 	services.SetupService("profile-service", 51500)
+	audit.SetupFlags()
 	services.PostFlagSetupAndParse()
 	services.CheckServiceFlags()
 	services.SetupServiceLogging()
@@ -47,6 +49,11 @@ func main() {
 	flush := services.InitDefaultSentry()
 	defer flush()
 
+	if err := audit.Init(); err != nil {
+		log.WithError(err).Fatal("Failed to set up the audit log")
+	}
+	defer audit.Close()
+
 	mux := http.NewServeMux()
 	// This handles all the pprof endpoints.
 	mux.Handle("/debug/", http.DefaultServeMux)
@@ -70,7 +77,7 @@ func main() {
 		log.WithError(err).Fatal("Failed to set up profileenv")
 	}
 
-	svr := controllers.NewServer(env, datastore, datastore, datastore, datastore)
+	svr := controllers.NewServer(env, datastore, datastore, datastore, datastore, datastore, datastore)
 
 	serverOpts := &server.GRPCServerOptions{
 		DisableAuth: map[string]bool{
@@ -23,25 +23,39 @@ import (
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
 	"px.dev/pixie/src/cloud/project_manager/projectmanagerpb"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/env"
 )
 
 func init() {
 	pflag.String("project_manager_service", "project-manager-service.plc.svc.cluster.local:50300", "The project manager service url (load balancer/list is ok)")
+	pflag.String("auth_service", "auth-service.plc.svc.cluster.local:50100", "The auth service url (load balancer/list is ok)")
+	pflag.String("cron_script_service", "cron-script-service.plc.svc.cluster.local:50700", "The cron script service url (load balancer/list is ok)")
+	pflag.String("scriptmgr_service", "scriptmgr-service.plc.svc.cluster.local:52000", "The scriptmgr service url (load balancer/list is ok)")
 }
 
 // ProfileEnv is the environment used for the profile service.
 type ProfileEnv interface {
 	env.Env
 	ProjectManagerClient() projectmanagerpb.ProjectManagerServiceClient
+	APIKeyClient() authpb.APIKeyServiceClient
+	PersonalAccessTokenClient() authpb.PersonalAccessTokenServiceClient
+	CronScriptClient() cronscriptpb.CronScriptServiceClient
+	SavedQueryClient() scriptmgrpb.SavedQueryServiceClient
 }
 
 // Impl is an implementation of the AuthEnv interface
 type Impl struct {
 	*env.BaseEnv
 	projectManagerClient projectmanagerpb.ProjectManagerServiceClient
+	apiKeyClient         authpb.APIKeyServiceClient
+	patClient            authpb.PersonalAccessTokenServiceClient
+	cronScriptClient     cronscriptpb.CronScriptServiceClient
+	savedQueryClient     scriptmgrpb.SavedQueryServiceClient
 }
 
 // ProjectManagerClient is an accessor for the project manager client.
@@ -49,6 +63,26 @@ func (p *Impl) ProjectManagerClient() projectmanagerpb.ProjectManagerServiceClie
 	return p.projectManagerClient
 }
 
+// APIKeyClient is an accessor for the API key client.
+func (p *Impl) APIKeyClient() authpb.APIKeyServiceClient {
+	return p.apiKeyClient
+}
+
+// PersonalAccessTokenClient is an accessor for the personal access token client.
+func (p *Impl) PersonalAccessTokenClient() authpb.PersonalAccessTokenServiceClient {
+	return p.patClient
+}
+
+// CronScriptClient is an accessor for the cron script client.
+func (p *Impl) CronScriptClient() cronscriptpb.CronScriptServiceClient {
+	return p.cronScriptClient
+}
+
+// SavedQueryClient is an accessor for the saved query client.
+func (p *Impl) SavedQueryClient() scriptmgrpb.SavedQueryServiceClient {
+	return p.savedQueryClient
+}
+
 // NewWithDefaults creates a profile env with the default clients and values.
 func NewWithDefaults() (*Impl, error) {
 	dialOpts, err := services.GetGRPCClientDialOpts()
@@ -59,11 +93,28 @@ func NewWithDefaults() (*Impl, error) {
 	if err != nil {
 		return nil, err
 	}
+	authChannel, err := grpc.Dial(viper.GetString("auth_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	cronScriptChannel, err := grpc.Dial(viper.GetString("cron_script_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	scriptMgrChannel, err := grpc.Dial(viper.GetString("scriptmgr_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
 	pc := projectmanagerpb.NewProjectManagerServiceClient(projectChannel)
-	return New(pc), nil
+	ak := authpb.NewAPIKeyServiceClient(authChannel)
+	tc := authpb.NewPersonalAccessTokenServiceClient(authChannel)
+	cc := cronscriptpb.NewCronScriptServiceClient(cronScriptChannel)
+	sc := scriptmgrpb.NewSavedQueryServiceClient(scriptMgrChannel)
+	return New(pc, ak, tc, cc, sc), nil
 }
 
 // New creates a new profile env.
-func New(pm projectmanagerpb.ProjectManagerServiceClient) *Impl {
-	return &Impl{env.New(viper.GetString("domain_name")), pm}
+func New(pm projectmanagerpb.ProjectManagerServiceClient, ak authpb.APIKeyServiceClient, tc authpb.PersonalAccessTokenServiceClient,
+	cc cronscriptpb.CronScriptServiceClient, sc scriptmgrpb.SavedQueryServiceClient) *Impl {
+	return &Impl{env.New(viper.GetString("domain_name")), pm, ak, tc, cc, sc}
 }
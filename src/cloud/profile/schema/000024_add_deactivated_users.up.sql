@@ -0,0 +1,3 @@
+-- is_deactivated is set when the user is offboarded. Deactivated users can't log in.
+ALTER TABLE users
+ADD COLUMN is_deactivated BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+ALTER TABLE orgs
+DROP COLUMN data_residency;
@@ -0,0 +1,2 @@
+ALTER TABLE orgs
+ADD COLUMN data_residency VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,21 @@
+CREATE TABLE scim_groups (
+  id UUID NOT NULL DEFAULT uuid_generate_v4(),
+  org_id UUID NOT NULL,
+  display_name VARCHAR(1024) NOT NULL,
+  external_id VARCHAR(1024) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (id),
+  UNIQUE (org_id, display_name),
+  FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE scim_group_members (
+  group_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+
+  PRIMARY KEY (group_id, user_id),
+  FOREIGN KEY (group_id) REFERENCES scim_groups(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
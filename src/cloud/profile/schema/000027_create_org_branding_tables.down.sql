@@ -0,0 +1,3 @@
+DROP TABLE org_email_templates;
+
+DROP TABLE org_branding;
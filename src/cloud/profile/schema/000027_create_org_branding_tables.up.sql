@@ -0,0 +1,20 @@
+CREATE TABLE org_branding (
+  org_id UUID NOT NULL,
+  product_name VARCHAR(256) NOT NULL DEFAULT '',
+  logo_url TEXT NOT NULL DEFAULT '',
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (org_id),
+  FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE org_email_templates (
+  org_id UUID NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  subject TEXT NOT NULL,
+  body TEXT NOT NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (org_id, name),
+  FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE org_role_bindings;
+
+ALTER TABLE orgs
+DROP COLUMN default_role;
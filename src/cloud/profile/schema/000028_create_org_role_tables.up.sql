@@ -0,0 +1,20 @@
+ALTER TABLE orgs
+ADD COLUMN default_role VARCHAR(16) NOT NULL DEFAULT 'admin';
+
+CREATE TABLE org_role_bindings (
+  id UUID NOT NULL DEFAULT uuid_generate_v4(),
+  org_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  role VARCHAR(16) NOT NULL,
+  -- If set, the role only applies to the cluster.
+  cluster_id UUID,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (id),
+  UNIQUE (user_id, cluster_id),
+  FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_org_role_bindings_org_wide ON org_role_bindings (user_id) WHERE cluster_id IS NULL;
+CREATE INDEX idx_org_role_bindings_org_id ON org_role_bindings (org_id);
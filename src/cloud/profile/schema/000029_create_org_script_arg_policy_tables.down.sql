@@ -0,0 +1,3 @@
+DROP TABLE org_script_arg_forbidden_values;
+
+DROP TABLE org_script_arg_policies;
@@ -0,0 +1,20 @@
+CREATE TABLE org_script_arg_policies (
+  org_id UUID NOT NULL,
+  arg_name VARCHAR(256) NOT NULL,
+  default_value TEXT NOT NULL DEFAULT '',
+  -- If non-zero, the argument is a start time which may not look back further than this.
+  max_lookback_ns BIGINT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (org_id, arg_name),
+  FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE org_script_arg_forbidden_values (
+  org_id UUID NOT NULL,
+  arg_name VARCHAR(256) NOT NULL,
+  value TEXT NOT NULL,
+
+  PRIMARY KEY (org_id, arg_name, value),
+  FOREIGN KEY (org_id, arg_name) REFERENCES org_script_arg_policies(org_id, arg_name) ON DELETE CASCADE
+);
@@ -0,0 +1,289 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+// releaseNameRegex matches the valid names of bundle releases, which are used as paths within the bundle bucket.
+var releaseNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// bundlePin is a row in the bundle_pins table.
+type bundlePin struct {
+	OrgID     uuid.UUID `db:"org_id"`
+	Release   string    `db:"release"`
+	UpdatedBy uuid.UUID `db:"updated_by"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func (p *bundlePin) toProto() (*scriptmgrpb.BundlePin, error) {
+	if p == nil {
+		return &scriptmgrpb.BundlePin{}, nil
+	}
+	updatedAt, err := types.TimestampProto(p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &scriptmgrpb.BundlePin{
+		Release:   p.Release,
+		UpdatedBy: utils.ProtoFromUUID(p.UpdatedBy),
+		UpdatedAt: updatedAt,
+	}, nil
+}
+
+func (s *Server) checkPinningEnabled() error {
+	if s.db == nil {
+		return status.Error(codes.Unimplemented, "Bundle pinning is not enabled")
+	}
+	return nil
+}
+
+func (s *Server) getPin(ctx context.Context, orgID uuid.UUID) (*bundlePin, error) {
+	pin := &bundlePin{}
+	query := `SELECT org_id, release, updated_by, updated_at FROM bundle_pins WHERE org_id=$1`
+	err := s.db.GetContext(ctx, pin, query, orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to get bundle pin")
+		return nil, status.Error(codes.Internal, "Failed to get bundle pin")
+	}
+	return pin, nil
+}
+
+// releaseStore returns the scripts of the given release of the bundle, or of the latest bundle if the release is
+// empty.
+func (s *Server) releaseStore(release string) (*scriptStore, error) {
+	if release == "" {
+		return s.store, nil
+	}
+	if !releaseNameRegex.MatchString(release) {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid release name %q", release)
+	}
+
+	s.releaseStoresMu.Lock()
+	defer s.releaseStoresMu.Unlock()
+	if store, ok := s.releaseStores[release]; ok {
+		return store, nil
+	}
+
+	releasePath := path.Join(s.releasesPath, release, "bundle.json")
+	_, err := s.sc.Bucket(s.bundleBucket).Object(releasePath).Attrs(context.Background())
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, status.Errorf(codes.NotFound, "Release %q of the script bundle doesn't exist", release)
+	}
+	if err != nil {
+		log.WithError(err).WithField("path", releasePath).Error("Failed to get attrs of bundle release")
+		return nil, status.Error(codes.Internal, "Failed to load bundle release")
+	}
+	b, err := getBundle(s.sc, s.bundleBucket, releasePath)
+	if err != nil {
+		log.WithError(err).WithField("path", releasePath).Error("Failed to download bundle release")
+		return nil, status.Error(codes.Internal, "Failed to load bundle release")
+	}
+	store := newScriptStore()
+	if err := s.loadBundle(store, b); err != nil {
+		// Like the latest bundle, a release is still served if some of its live views are invalid.
+		log.WithError(err).WithField("path", releasePath).Error("Failed to load some scripts of bundle release")
+	}
+	s.releaseStores[release] = store
+	return store, nil
+}
+
+// storeForContext returns the scripts for the org of the requesting user, which are those of the release that the
+// org is pinned to, or of the latest bundle.
+func (s *Server) storeForContext(ctx context.Context) (*scriptStore, error) {
+	if s.db == nil {
+		return s.store, nil
+	}
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return s.store, nil
+	}
+	claims := sCtx.Claims.GetUserClaims()
+	if claims == nil {
+		return s.store, nil
+	}
+	pin, err := s.getPin(ctx, uuid.FromStringOrNil(claims.OrgID))
+	if err != nil {
+		return nil, err
+	}
+	if pin == nil {
+		return s.store, nil
+	}
+	return s.releaseStore(pin.Release)
+}
+
+// GetBundlePin returns the release of the script bundle that the org of the requesting user is pinned to.
+func (s *Server) GetBundlePin(ctx context.Context, req *scriptmgrpb.GetBundlePinReq) (*scriptmgrpb.BundlePin, error) {
+	if err := s.checkPinningEnabled(); err != nil {
+		return nil, err
+	}
+	orgID, _, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pin, err := s.getPin(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return pin.toProto()
+}
+
+func scriptsByName(store *scriptStore) map[string]*scriptModel {
+	scripts := make(map[string]*scriptModel, len(store.Scripts))
+	for _, script := range store.Scripts {
+		scripts[script.name] = script
+	}
+	return scripts
+}
+
+// diffStores returns how the scripts change from one store to the other, sorted by script name.
+func diffStores(from, to *scriptStore) []*scriptmgrpb.ScriptChange {
+	fromScripts := scriptsByName(from)
+	toScripts := scriptsByName(to)
+
+	var changes []*scriptmgrpb.ScriptChange
+	for name, toScript := range toScripts {
+		fromScript, ok := fromScripts[name]
+		if !ok {
+			changes = append(changes, &scriptmgrpb.ScriptChange{Name: name, Type: scriptmgrpb.SCT_ADDED})
+			continue
+		}
+		change := &scriptmgrpb.ScriptChange{
+			Name:        name,
+			Type:        scriptmgrpb.SCT_MODIFIED,
+			PxlChanged:  fromScript.pxl != toScript.pxl,
+			VisChanged:  fromScript.vis != toScript.vis,
+			DescChanged: fromScript.desc != toScript.desc,
+		}
+		if !change.PxlChanged && !change.VisChanged && !change.DescChanged {
+			continue
+		}
+		if change.PxlChanged {
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(fromScript.pxl),
+				B:        difflib.SplitLines(toScript.pxl),
+				FromFile: name,
+				ToFile:   name,
+				Context:  3,
+			})
+			if err != nil {
+				log.WithError(err).WithField("script", name).Error("Failed to diff script")
+			}
+			change.PxlDiff = diff
+		}
+		changes = append(changes, change)
+	}
+	for name := range fromScripts {
+		if _, ok := toScripts[name]; !ok {
+			changes = append(changes, &scriptmgrpb.ScriptChange{Name: name, Type: scriptmgrpb.SCT_REMOVED})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// PreviewBundlePin returns how the scripts of the org of the requesting user would change, if it were pinned to
+// the given release.
+func (s *Server) PreviewBundlePin(ctx context.Context, req *scriptmgrpb.PreviewBundlePinReq) (*scriptmgrpb.PreviewBundlePinResp, error) {
+	if err := s.checkPinningEnabled(); err != nil {
+		return nil, err
+	}
+	orgID, _, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pin, err := s.getPin(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	fromRelease := ""
+	if pin != nil {
+		fromRelease = pin.Release
+	}
+	from, err := s.releaseStore(fromRelease)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.releaseStore(req.Release)
+	if err != nil {
+		return nil, err
+	}
+	return &scriptmgrpb.PreviewBundlePinResp{
+		FromRelease: fromRelease,
+		ToRelease:   req.Release,
+		Changes:     diffStores(from, to),
+	}, nil
+}
+
+// SetBundlePin pins the org of the requesting user to a release of the script bundle, or unpins it so that it
+// tracks the latest bundle again.
+func (s *Server) SetBundlePin(ctx context.Context, req *scriptmgrpb.SetBundlePinReq) (*scriptmgrpb.BundlePin, error) {
+	if err := s.checkPinningEnabled(); err != nil {
+		return nil, err
+	}
+	orgID, userID, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Release == "" {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM bundle_pins WHERE org_id=$1`, orgID); err != nil {
+			log.WithError(err).Error("Failed to delete bundle pin")
+			return nil, status.Error(codes.Internal, "Failed to unpin bundle")
+		}
+		return &scriptmgrpb.BundlePin{}, nil
+	}
+
+	// Make sure that the release exists, so that the org's scripts don't fail to load after pinning it.
+	if _, err := s.releaseStore(req.Release); err != nil {
+		return nil, err
+	}
+	pin := &bundlePin{}
+	query := `INSERT INTO bundle_pins (org_id, release, updated_by, updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (org_id) DO UPDATE SET release=EXCLUDED.release, updated_by=EXCLUDED.updated_by, updated_at=EXCLUDED.updated_at
+		RETURNING org_id, release, updated_by, updated_at`
+	if err := s.db.GetContext(ctx, pin, query, orgID, req.Release, userID); err != nil {
+		log.WithError(err).Error("Failed to set bundle pin")
+		return nil, status.Error(codes.Internal, "Failed to pin bundle")
+	}
+	log.WithField("org_id", orgID).WithField("release", req.Release).Info("Pinned org to bundle release")
+	return pin.toProto()
+}
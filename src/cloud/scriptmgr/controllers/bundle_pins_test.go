@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/scriptmgr/controllers"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const releasesPath = "releases"
+
+var testReleaseBundle = map[string]scriptsDef{
+	"scripts": {
+		"script1": scriptDef{
+			"pxl":       "script1 pxl\nv1",
+			"placement": "",
+			"vis":       "",
+			"ShortDoc":  "script1 desc",
+			"LongDoc":   "",
+		},
+		"liveview1": testBundle["scripts"]["liveview1"],
+		"script3": {
+			"pxl":       "script3 pxl",
+			"vis":       "",
+			"placement": "",
+			"ShortDoc":  "script3 desc",
+			"LongDoc":   "",
+		},
+	},
+}
+
+func mustSetupFakeBucketWithRelease(t *testing.T) stiface.Client {
+	bundleJSON, err := json.Marshal(testBundle)
+	require.NoError(t, err)
+	releaseJSON, err := json.Marshal(testReleaseBundle)
+	require.NoError(t, err)
+
+	return testingutils.NewMockGCSClient(map[string]*testingutils.MockGCSBucket{
+		bundleBucket: testingutils.NewMockGCSBucket(
+			map[string]*testingutils.MockGCSObject{
+				bundlePath: testingutils.NewMockGCSObject(bundleJSON, &storage.ObjectAttrs{Updated: time.Now()}),
+				"releases/v1/bundle.json": testingutils.NewMockGCSObject(releaseJSON,
+					&storage.ObjectAttrs{Updated: time.Now()}),
+			},
+			nil,
+		),
+	})
+}
+
+func scriptNames(t *testing.T, s *controllers.Server, ctx context.Context) []string {
+	resp, err := s.GetScripts(ctx, &scriptmgrpb.GetScriptsReq{})
+	require.NoError(t, err)
+	var names []string
+	for _, script := range resp.Scripts {
+		names = append(names, script.Name)
+	}
+	return names
+}
+
+func TestBundlePin_Disabled(t *testing.T) {
+	s := controllers.NewServer(bundleBucket, bundlePath, mustSetupFakeBucketWithRelease(t), releasesPath, nil)
+	_, err := s.SetBundlePin(createUserContext(testOwnerID), &scriptmgrpb.SetBundlePinReq{Release: "v1"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	assert.ElementsMatch(t, []string{"script1", "script2", "liveview1"}, scriptNames(t, s, createUserContext(testOwnerID)))
+}
+
+func TestBundlePin(t *testing.T) {
+	s := controllers.NewServer(bundleBucket, bundlePath, mustSetupFakeBucketWithRelease(t), releasesPath, mustSetupDB(t))
+	ctx := createUserContext(testOwnerID)
+
+	pin, err := s.GetBundlePin(ctx, &scriptmgrpb.GetBundlePinReq{})
+	require.NoError(t, err)
+	assert.Equal(t, "", pin.Release)
+
+	preview, err := s.PreviewBundlePin(ctx, &scriptmgrpb.PreviewBundlePinReq{Release: "v1"})
+	require.NoError(t, err)
+	assert.Equal(t, "", preview.FromRelease)
+	assert.Equal(t, "v1", preview.ToRelease)
+	require.Len(t, preview.Changes, 3)
+	assert.Equal(t, &scriptmgrpb.ScriptChange{
+		Name:       "script1",
+		Type:       scriptmgrpb.SCT_MODIFIED,
+		PxlChanged: true,
+		PxlDiff:    "--- script1\n+++ script1\n@@ -1 +1,2 @@\n script1 pxl\n+v1\n",
+	}, preview.Changes[0])
+	assert.Equal(t, &scriptmgrpb.ScriptChange{Name: "script2", Type: scriptmgrpb.SCT_REMOVED}, preview.Changes[1])
+	assert.Equal(t, &scriptmgrpb.ScriptChange{Name: "script3", Type: scriptmgrpb.SCT_ADDED}, preview.Changes[2])
+
+	_, err = s.SetBundlePin(ctx, &scriptmgrpb.SetBundlePinReq{Release: "v2"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = s.SetBundlePin(ctx, &scriptmgrpb.SetBundlePinReq{Release: "../v1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	pin, err = s.SetBundlePin(ctx, &scriptmgrpb.SetBundlePinReq{Release: "v1"})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", pin.Release)
+	assert.Equal(t, utils.ProtoFromUUIDStrOrNil(testOwnerID), pin.UpdatedBy)
+
+	// The whole org sees the scripts of the release, while requests without an org see the latest bundle.
+	assert.ElementsMatch(t, []string{"script1", "script3", "liveview1"}, scriptNames(t, s, createUserContext(testOtherID)))
+	assert.ElementsMatch(t, []string{"script1", "script2", "liveview1"}, scriptNames(t, s, context.Background()))
+
+	preview, err = s.PreviewBundlePin(ctx, &scriptmgrpb.PreviewBundlePinReq{})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", preview.FromRelease)
+	assert.Equal(t, "", preview.ToRelease)
+	require.Len(t, preview.Changes, 3)
+	assert.Equal(t, scriptmgrpb.SCT_ADDED, preview.Changes[1].Type)
+
+	pin, err = s.SetBundlePin(ctx, &scriptmgrpb.SetBundlePinReq{})
+	require.NoError(t, err)
+	assert.Equal(t, "", pin.Release)
+	assert.ElementsMatch(t, []string{"script1", "script2", "liveview1"}, scriptNames(t, s, ctx))
+}
@@ -0,0 +1,560 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	"github.com/jackc/pgx"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/api/proto/vispb"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+// Code for `unique_violation`.
+const uniqueViolation = "23505"
+
+// SavedQueryServer implements the GRPC Server for the saved query service.
+type SavedQueryServer struct {
+	db *sqlx.DB
+}
+
+// NewSavedQueryServer creates a new GRPC saved query server.
+func NewSavedQueryServer(db *sqlx.DB) *SavedQueryServer {
+	return &SavedQueryServer{db: db}
+}
+
+// savedQuery is a row in the saved_queries table.
+type savedQuery struct {
+	ID          uuid.UUID `db:"id"`
+	OrgID       uuid.UUID `db:"org_id"`
+	OwnerID     uuid.UUID `db:"owner_id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Pxl         string    `db:"pxl"`
+	Args        string    `db:"args"`
+	Vis         string    `db:"vis"`
+	Scope       int32     `db:"scope"`
+	AllowEdit   bool      `db:"allow_edit"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+
+	members []uuid.UUID
+}
+
+const savedQueryColumns = `id, org_id, owner_id, name, description, pxl, args, vis, scope, allow_edit, created_at, updated_at`
+
+// visibleSavedQueryCondition matches the saved queries in the org $1 that the user $2 can see.
+const visibleSavedQueryCondition = `org_id=$1 AND (owner_id=$2 OR scope=$3 OR
+	(scope=$4 AND EXISTS (SELECT 1 FROM saved_query_members m WHERE m.saved_query_id=saved_queries.id AND m.user_id=$2)))`
+
+func userFromContext(ctx context.Context) (uuid.UUID, uuid.UUID, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, status.Error(codes.Unauthenticated, "Unauthenticated")
+	}
+	claims := sCtx.Claims.GetUserClaims()
+	if claims == nil {
+		return uuid.Nil, uuid.Nil, status.Error(codes.PermissionDenied, "Saved queries can only be accessed by users")
+	}
+	return uuid.FromStringOrNil(claims.OrgID), uuid.FromStringOrNil(claims.UserID), nil
+}
+
+func (q *savedQuery) canView(userID uuid.UUID) bool {
+	if q.OwnerID == userID || q.Scope == int32(scriptmgrpb.SQS_ORG) {
+		return true
+	}
+	if q.Scope != int32(scriptmgrpb.SQS_TEAM) {
+		return false
+	}
+	for _, m := range q.members {
+		if m == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *savedQuery) canEdit(userID uuid.UUID) bool {
+	return q.OwnerID == userID || (q.AllowEdit && q.canView(userID))
+}
+
+func (q *savedQuery) toProto() (*scriptmgrpb.SavedQuery, error) {
+	args := make(map[string]string)
+	if q.Args != "" {
+		if err := json.Unmarshal([]byte(q.Args), &args); err != nil {
+			return nil, err
+		}
+	}
+	var vis *vispb.Vis
+	if q.Vis != "" {
+		vis = &vispb.Vis{}
+		if err := jsonpb.UnmarshalString(q.Vis, vis); err != nil {
+			return nil, err
+		}
+	}
+	createdAt, err := types.TimestampProto(q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	updatedAt, err := types.TimestampProto(q.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*uuidpb.UUID, len(q.members))
+	for i, m := range q.members {
+		members[i] = utils.ProtoFromUUID(m)
+	}
+	return &scriptmgrpb.SavedQuery{
+		ID:          utils.ProtoFromUUID(q.ID),
+		OrgID:       utils.ProtoFromUUID(q.OrgID),
+		OwnerID:     utils.ProtoFromUUID(q.OwnerID),
+		Name:        q.Name,
+		Description: q.Description,
+		Pxl:         q.Pxl,
+		Args:        args,
+		Vis:         vis,
+		Scope:       scriptmgrpb.SavedQueryScope(q.Scope),
+		MemberIDs:   members,
+		AllowEdit:   q.AllowEdit,
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
+	}, nil
+}
+
+// setContents sets the name, description, script, arguments and layout of the saved query.
+func (q *savedQuery) setContents(name, description, pxl string, args map[string]string, vis *vispb.Vis) error {
+	if name == "" {
+		return status.Error(codes.InvalidArgument, "Saved query must have a name")
+	}
+	if pxl == "" {
+		return status.Error(codes.InvalidArgument, "Saved query must have a script")
+	}
+	if args == nil {
+		args = make(map[string]string)
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Invalid saved query args")
+	}
+	visJSON := ""
+	if vis != nil {
+		m := jsonpb.Marshaler{}
+		visJSON, err = m.MarshalToString(vis)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "Invalid saved query vis")
+		}
+	}
+	q.Name = name
+	q.Description = description
+	q.Pxl = pxl
+	q.Args = string(argsJSON)
+	q.Vis = visJSON
+	return nil
+}
+
+// setSharing sets who can see and edit the saved query.
+func (q *savedQuery) setSharing(scope scriptmgrpb.SavedQueryScope, members []*uuidpb.UUID, allowEdit bool) error {
+	if _, ok := scriptmgrpb.SavedQueryScope_name[int32(scope)]; !ok || scope == scriptmgrpb.SQS_UNKNOWN {
+		return status.Error(codes.InvalidArgument, "Invalid saved query scope")
+	}
+	q.Scope = int32(scope)
+	q.AllowEdit = allowEdit
+	q.members = nil
+	if scope != scriptmgrpb.SQS_TEAM {
+		return nil
+	}
+	seen := make(map[uuid.UUID]bool)
+	for _, m := range members {
+		id := utils.UUIDFromProtoOrNil(m)
+		if id == uuid.Nil {
+			return status.Error(codes.InvalidArgument, "Invalid saved query member ID")
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		q.members = append(q.members, id)
+	}
+	return nil
+}
+
+func writeMembers(tx *sqlx.Tx, q *savedQuery) error {
+	_, err := tx.Exec(`DELETE FROM saved_query_members WHERE saved_query_id=$1`, q.ID)
+	if err != nil {
+		return err
+	}
+	for _, m := range q.members {
+		_, err = tx.Exec(`INSERT INTO saved_query_members (saved_query_id, user_id) VALUES ($1, $2)`, q.ID, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMembers fills in the team members of the given saved queries.
+func (s *SavedQueryServer) loadMembers(queries []*savedQuery) error {
+	if len(queries) == 0 {
+		return nil
+	}
+	byID := make(map[uuid.UUID]*savedQuery)
+	ids := make([]uuid.UUID, len(queries))
+	for i, q := range queries {
+		byID[q.ID] = q
+		ids[i] = q.ID
+	}
+	query, args, err := sqlx.In(`SELECT saved_query_id, user_id FROM saved_query_members WHERE saved_query_id IN (?) ORDER BY user_id`, ids)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.Queryx(s.db.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var queryID, userID uuid.UUID
+		if err := rows.Scan(&queryID, &userID); err != nil {
+			return err
+		}
+		if q, ok := byID[queryID]; ok {
+			q.members = append(q.members, userID)
+		}
+	}
+	return rows.Err()
+}
+
+// getSavedQuery fetches the saved query with the given ID in the org, along with its members.
+func (s *SavedQueryServer) getSavedQuery(orgID uuid.UUID, id uuid.UUID) (*savedQuery, error) {
+	q := &savedQuery{}
+	err := s.db.Get(q, `SELECT `+savedQueryColumns+` FROM saved_queries WHERE org_id=$1 AND id=$2`, orgID, id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Saved query not found")
+	}
+	if err := s.loadMembers([]*savedQuery{q}); err != nil {
+		log.WithError(err).Error("Failed to fetch saved query members")
+		return nil, status.Error(codes.Internal, "Failed to fetch saved query")
+	}
+	return q, nil
+}
+
+func savedQueryWriteError(err error) error {
+	if e, ok := err.(pgx.PgError); ok && e.Code == uniqueViolation {
+		return status.Error(codes.AlreadyExists, "A saved query with this name already exists")
+	}
+	log.WithError(err).Error("Failed to write saved query")
+	return status.Error(codes.Internal, "Failed to write saved query")
+}
+
+func savedQueryProto(q *savedQuery) (*scriptmgrpb.SavedQuery, error) {
+	pb, err := q.toProto()
+	if err != nil {
+		log.WithError(err).WithField("id", q.ID).Error("Failed to read saved query")
+		return nil, status.Error(codes.Internal, "Failed to read saved query")
+	}
+	return pb, nil
+}
+
+// CreateSavedQuery saves a new query, owned by the requesting user.
+func (s *SavedQueryServer) CreateSavedQuery(ctx context.Context, req *scriptmgrpb.CreateSavedQueryReq) (*scriptmgrpb.SavedQuery, error) {
+	orgID, userID, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Query == nil {
+		return nil, status.Error(codes.InvalidArgument, "Missing saved query")
+	}
+
+	q := &savedQuery{OrgID: orgID, OwnerID: userID}
+	if err := q.setContents(req.Query.Name, req.Query.Description, req.Query.Pxl, req.Query.Args, req.Query.Vis); err != nil {
+		return nil, err
+	}
+	scope := req.Query.Scope
+	if scope == scriptmgrpb.SQS_UNKNOWN {
+		scope = scriptmgrpb.SQS_USER
+	}
+	if err := q.setSharing(scope, req.Query.MemberIDs, req.Query.AllowEdit); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO saved_queries (org_id, owner_id, name, description, pxl, args, vis, scope, allow_edit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`
+	err = tx.QueryRowx(query, q.OrgID, q.OwnerID, q.Name, q.Description, q.Pxl, q.Args, q.Vis, q.Scope, q.AllowEdit).
+		Scan(&q.ID, &q.CreatedAt, &q.UpdatedAt)
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	if err := writeMembers(tx, q); err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	return savedQueryProto(q)
+}
+
+// GetSavedQuery returns a saved query that the requesting user can see.
+func (s *SavedQueryServer) GetSavedQuery(ctx context.Context, req *scriptmgrpb.GetSavedQueryReq) (*scriptmgrpb.SavedQuery, error) {
+	orgID, userID, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.getSavedQuery(orgID, utils.UUIDFromProtoOrNil(req.ID))
+	if err != nil {
+		return nil, err
+	}
+	// Don't reveal the existence of saved queries that the user can't see.
+	if !q.canView(userID) {
+		return nil, status.Error(codes.NotFound, "Saved query not found")
+	}
+	return savedQueryProto(q)
+}
+
+// GetSavedQueries returns the saved queries that the requesting user can see.
+func (s *SavedQueryServer) GetSavedQueries(ctx context.Context, req *scriptmgrpb.GetSavedQueriesReq) (*scriptmgrpb.GetSavedQueriesResp, error) {
+	orgID, userID, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + savedQueryColumns + ` FROM saved_queries WHERE ` + visibleSavedQueryCondition
+	args := []interface{}{orgID, userID, int32(scriptmgrpb.SQS_ORG), int32(scriptmgrpb.SQS_TEAM)}
+	if req.Name != "" {
+		query += ` AND name=$5`
+		args = append(args, req.Name)
+	}
+	query += ` ORDER BY name, created_at`
+
+	var queries []*savedQuery
+	if err := s.db.Select(&queries, query, args...); err != nil {
+		log.WithError(err).Error("Failed to fetch saved queries")
+		return nil, status.Error(codes.Internal, "Failed to fetch saved queries")
+	}
+	if err := s.loadMembers(queries); err != nil {
+		log.WithError(err).Error("Failed to fetch saved query members")
+		return nil, status.Error(codes.Internal, "Failed to fetch saved queries")
+	}
+
+	resp := &scriptmgrpb.GetSavedQueriesResp{
+		Queries: make([]*scriptmgrpb.SavedQuery, len(queries)),
+	}
+	for i, q := range queries {
+		resp.Queries[i], err = savedQueryProto(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// UpdateSavedQuery updates a saved query that the requesting user can edit.
+func (s *SavedQueryServer) UpdateSavedQuery(ctx context.Context, req *scriptmgrpb.UpdateSavedQueryReq) (*scriptmgrpb.SavedQuery, error) {
+	orgID, userID, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.getSavedQuery(orgID, utils.UUIDFromProtoOrNil(req.ID))
+	if err != nil {
+		return nil, err
+	}
+	if !q.canView(userID) {
+		return nil, status.Error(codes.NotFound, "Saved query not found")
+	}
+	if !q.canEdit(userID) {
+		return nil, status.Error(codes.PermissionDenied, "Saved query can only be edited by its owner")
+	}
+
+	pb, err := savedQueryProto(q)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		pb.Name = req.Name.Value
+	}
+	if req.Description != nil {
+		pb.Description = req.Description.Value
+	}
+	if req.Pxl != nil {
+		pb.Pxl = req.Pxl.Value
+	}
+	if req.Args != nil {
+		pb.Args = req.Args.Args
+	}
+	if req.Vis != nil {
+		pb.Vis = req.Vis
+	}
+	if err := q.setContents(pb.Name, pb.Description, pb.Pxl, pb.Args, pb.Vis); err != nil {
+		return nil, err
+	}
+
+	sharingChanged := req.Scope != scriptmgrpb.SQS_UNKNOWN || req.Members != nil || req.AllowEdit != nil
+	if sharingChanged {
+		if q.OwnerID != userID {
+			return nil, status.Error(codes.PermissionDenied, "Only the owner of a saved query can change who it is shared with")
+		}
+		if req.Scope != scriptmgrpb.SQS_UNKNOWN {
+			pb.Scope = req.Scope
+		}
+		if req.Members != nil {
+			pb.MemberIDs = req.Members.MemberIDs
+		}
+		if req.AllowEdit != nil {
+			pb.AllowEdit = req.AllowEdit.Value
+		}
+		if err := q.setSharing(pb.Scope, pb.MemberIDs, pb.AllowEdit); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE saved_queries SET name=$1, description=$2, pxl=$3, args=$4, vis=$5, scope=$6, allow_edit=$7, updated_at=NOW()
+		WHERE id=$8 RETURNING updated_at`
+	err = tx.QueryRowx(query, q.Name, q.Description, q.Pxl, q.Args, q.Vis, q.Scope, q.AllowEdit, q.ID).Scan(&q.UpdatedAt)
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	if sharingChanged {
+		if err := writeMembers(tx, q); err != nil {
+			return nil, savedQueryWriteError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	return savedQueryProto(q)
+}
+
+// DeleteSavedQuery deletes a saved query owned by the requesting user.
+func (s *SavedQueryServer) DeleteSavedQuery(ctx context.Context, req *scriptmgrpb.DeleteSavedQueryReq) (*scriptmgrpb.DeleteSavedQueryResp, error) {
+	orgID, userID, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.getSavedQuery(orgID, utils.UUIDFromProtoOrNil(req.ID))
+	if err != nil {
+		return nil, err
+	}
+	if !q.canView(userID) {
+		return nil, status.Error(codes.NotFound, "Saved query not found")
+	}
+	if q.OwnerID != userID {
+		return nil, status.Error(codes.PermissionDenied, "Saved query can only be deleted by its owner")
+	}
+
+	_, err = s.db.Exec(`DELETE FROM saved_queries WHERE id=$1`, q.ID)
+	if err != nil {
+		log.WithError(err).Error("Failed to delete saved query")
+		return nil, status.Error(codes.Internal, "Failed to delete saved query")
+	}
+	return &scriptmgrpb.DeleteSavedQueryResp{}, nil
+}
+
+// TransferSavedQueries moves the saved queries owned by a user to another user in the same org. The old
+// owner is also removed from the members of the org's saved queries.
+func (s *SavedQueryServer) TransferSavedQueries(ctx context.Context, req *scriptmgrpb.TransferSavedQueriesReq) (*scriptmgrpb.TransferSavedQueriesResp, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Unauthenticated")
+	}
+	if srvutils.GetClaimsType(sCtx.Claims) != srvutils.ServiceClaimType {
+		return nil, status.Error(codes.PermissionDenied, "Saved queries can only be transferred by services")
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	fromUserID := utils.UUIDFromProtoOrNil(req.FromUserID)
+	toUserID := utils.UUIDFromProtoOrNil(req.ToUserID)
+	if orgID == uuid.Nil || fromUserID == uuid.Nil || toUserID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "Org, from and to users are required")
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	defer tx.Rollback()
+
+	var queries []*savedQuery
+	err = tx.Select(&queries, `SELECT `+savedQueryColumns+` FROM saved_queries WHERE org_id=$1 AND owner_id=$2`, orgID, fromUserID)
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	var names []string
+	err = tx.Select(&names, `SELECT name FROM saved_queries WHERE org_id=$1 AND owner_id=$2`, orgID, toUserID)
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	taken := make(map[string]bool)
+	for _, n := range names {
+		taken[n] = true
+	}
+
+	for _, q := range queries {
+		// Names are unique for each owner, so keep the new owner's query and rename the moved one.
+		name := q.Name
+		for i := 1; taken[name]; i++ {
+			name = fmt.Sprintf("%s (%d)", q.Name, i)
+		}
+		taken[name] = true
+
+		_, err = tx.Exec(`UPDATE saved_queries SET owner_id=$1, name=$2 WHERE id=$3`, toUserID, name, q.ID)
+		if err != nil {
+			return nil, savedQueryWriteError(err)
+		}
+		// The new owner can always see their own queries.
+		_, err = tx.Exec(`DELETE FROM saved_query_members WHERE saved_query_id=$1 AND user_id=$2`, q.ID, toUserID)
+		if err != nil {
+			return nil, savedQueryWriteError(err)
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM saved_query_members WHERE user_id=$1 AND
+		saved_query_id IN (SELECT id FROM saved_queries WHERE org_id=$2)`, fromUserID, orgID)
+	if err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, savedQueryWriteError(err)
+	}
+	return &scriptmgrpb.TransferSavedQueriesResp{NumQueries: int64(len(queries))}, nil
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/api/proto/vispb"
+	"px.dev/pixie/src/cloud/scriptmgr/controllers"
+	"px.dev/pixie/src/cloud/scriptmgr/schema"
+	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/pgtest"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	testOrgID      = "223e4567-e89b-12d3-a456-426655440000"
+	testOwnerID    = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	testTeammateID = "6ba7b810-9dad-11d1-80b4-00c04fd430c9"
+	testOtherID    = "6ba7b810-9dad-11d1-80b4-00c04fd430ca"
+)
+
+var (
+	db         *sqlx.DB
+	dbOnce     sync.Once
+	dbErr      error
+	dbTeardown func()
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if dbTeardown != nil {
+		dbTeardown()
+	}
+	os.Exit(code)
+}
+
+// mustSetupDB starts the test database the first time that it is needed, so that tests which don't
+// use the database can run without it.
+func mustSetupDB(t *testing.T) *sqlx.DB {
+	dbOnce.Do(func() {
+		s := bindata.Resource(schema.AssetNames(), schema.Asset)
+		db, dbTeardown, dbErr = pgtest.SetupTestDB(s)
+	})
+	if dbErr != nil {
+		t.Fatal(fmt.Errorf("failed to start test database: %w", dbErr))
+	}
+	db.MustExec(`DELETE FROM saved_queries`)
+	db.MustExec(`DELETE FROM bundle_pins`)
+	return db
+}
+
+func createUserContext(userID string) context.Context {
+	sCtx := authcontext.New()
+	sCtx.Claims = srvutils.GenerateJWTForUser(userID, testOrgID, "test@test.com", time.Now(), "pixie")
+	return authcontext.NewContext(context.Background(), sCtx)
+}
+
+func createTestSavedQuery(t *testing.T, s *controllers.SavedQueryServer, name string, scope scriptmgrpb.SavedQueryScope, allowEdit bool) *scriptmgrpb.SavedQuery {
+	q, err := s.CreateSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.CreateSavedQueryReq{
+		Query: &scriptmgrpb.SavedQuery{
+			Name:        name,
+			Description: "a saved query",
+			Pxl:         "px.display(px.DataFrame('http_events'))",
+			Args:        map[string]string{"start_time": "-5m"},
+			Scope:       scope,
+			MemberIDs:   []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(testTeammateID)},
+			AllowEdit:   allowEdit,
+		},
+	})
+	require.NoError(t, err)
+	return q
+}
+
+func TestSavedQueryServer_CreateAndGet(t *testing.T) {
+	s := controllers.NewSavedQueryServer(mustSetupDB(t))
+
+	vis := &vispb.Vis{
+		Widgets: []*vispb.Widget{{Name: "table"}},
+	}
+	created, err := s.CreateSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.CreateSavedQueryReq{
+		Query: &scriptmgrpb.SavedQuery{
+			Name: "http_errors",
+			Pxl:  "px.display(px.DataFrame('http_events'))",
+			Args: map[string]string{"start_time": "-5m"},
+			Vis:  vis,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, utils.ProtoFromUUIDStrOrNil(testOrgID), created.OrgID)
+	assert.Equal(t, utils.ProtoFromUUIDStrOrNil(testOwnerID), created.OwnerID)
+	assert.Equal(t, scriptmgrpb.SQS_USER, created.Scope)
+
+	got, err := s.GetSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.GetSavedQueryReq{ID: created.ID})
+	require.NoError(t, err)
+	assert.Equal(t, created, got)
+	assert.Equal(t, vis, got.Vis)
+	assert.Equal(t, map[string]string{"start_time": "-5m"}, got.Args)
+
+	_, err = s.GetSavedQuery(createUserContext(testTeammateID), &scriptmgrpb.GetSavedQueryReq{ID: created.ID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = s.CreateSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.CreateSavedQueryReq{
+		Query: &scriptmgrpb.SavedQuery{Name: "http_errors", Pxl: "px.display()"},
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestSavedQueryServer_CreateInvalid(t *testing.T) {
+	s := controllers.NewSavedQueryServer(mustSetupDB(t))
+
+	_, err := s.CreateSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.CreateSavedQueryReq{
+		Query: &scriptmgrpb.SavedQuery{Name: "no_script"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.CreateSavedQuery(context.Background(), &scriptmgrpb.CreateSavedQueryReq{
+		Query: &scriptmgrpb.SavedQuery{Name: "unauthenticated", Pxl: "px.display()"},
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestSavedQueryServer_GetSavedQueries(t *testing.T) {
+	s := controllers.NewSavedQueryServer(mustSetupDB(t))
+
+	createTestSavedQuery(t, s, "private", scriptmgrpb.SQS_USER, false)
+	createTestSavedQuery(t, s, "team", scriptmgrpb.SQS_TEAM, false)
+	createTestSavedQuery(t, s, "org", scriptmgrpb.SQS_ORG, false)
+
+	names := func(userID string, name string) []string {
+		resp, err := s.GetSavedQueries(createUserContext(userID), &scriptmgrpb.GetSavedQueriesReq{Name: name})
+		require.NoError(t, err)
+		var names []string
+		for _, q := range resp.Queries {
+			names = append(names, q.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"org", "private", "team"}, names(testOwnerID, ""))
+	assert.Equal(t, []string{"org", "team"}, names(testTeammateID, ""))
+	assert.Equal(t, []string{"org"}, names(testOtherID, ""))
+	assert.Equal(t, []string{"team"}, names(testTeammateID, "team"))
+	assert.Nil(t, names(testOtherID, "team"))
+}
+
+func TestSavedQueryServer_UpdateSavedQuery(t *testing.T) {
+	s := controllers.NewSavedQueryServer(mustSetupDB(t))
+
+	readOnly := createTestSavedQuery(t, s, "read_only", scriptmgrpb.SQS_TEAM, false)
+	editable := createTestSavedQuery(t, s, "editable", scriptmgrpb.SQS_TEAM, true)
+
+	_, err := s.UpdateSavedQuery(createUserContext(testTeammateID), &scriptmgrpb.UpdateSavedQueryReq{
+		ID:  readOnly.ID,
+		Pxl: &types.StringValue{Value: "px.display()"},
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.UpdateSavedQuery(createUserContext(testOtherID), &scriptmgrpb.UpdateSavedQueryReq{
+		ID:  editable.ID,
+		Pxl: &types.StringValue{Value: "px.display()"},
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	updated, err := s.UpdateSavedQuery(createUserContext(testTeammateID), &scriptmgrpb.UpdateSavedQueryReq{
+		ID:   editable.ID,
+		Pxl:  &types.StringValue{Value: "px.display()"},
+		Args: &scriptmgrpb.SavedQueryArgs{Args: map[string]string{"start_time": "-1h"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "px.display()", updated.Pxl)
+	assert.Equal(t, map[string]string{"start_time": "-1h"}, updated.Args)
+	assert.Equal(t, editable.Name, updated.Name)
+
+	// Only the owner can change the sharing settings.
+	_, err = s.UpdateSavedQuery(createUserContext(testTeammateID), &scriptmgrpb.UpdateSavedQueryReq{
+		ID:    editable.ID,
+		Scope: scriptmgrpb.SQS_ORG,
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	updated, err = s.UpdateSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.UpdateSavedQueryReq{
+		ID:    editable.ID,
+		Scope: scriptmgrpb.SQS_ORG,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, scriptmgrpb.SQS_ORG, updated.Scope)
+	assert.Empty(t, updated.MemberIDs)
+
+	_, err = s.GetSavedQuery(createUserContext(testOtherID), &scriptmgrpb.GetSavedQueryReq{ID: editable.ID})
+	require.NoError(t, err)
+}
+
+func TestSavedQueryServer_DeleteSavedQuery(t *testing.T) {
+	s := controllers.NewSavedQueryServer(mustSetupDB(t))
+
+	q := createTestSavedQuery(t, s, "editable", scriptmgrpb.SQS_TEAM, true)
+
+	_, err := s.DeleteSavedQuery(createUserContext(testTeammateID), &scriptmgrpb.DeleteSavedQueryReq{ID: q.ID})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.DeleteSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.DeleteSavedQueryReq{ID: q.ID})
+	require.NoError(t, err)
+
+	_, err = s.GetSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.GetSavedQueryReq{ID: q.ID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSavedQueryServer_TransferSavedQueries(t *testing.T) {
+	s := controllers.NewSavedQueryServer(mustSetupDB(t))
+
+	shared := createTestSavedQuery(t, s, "shared", scriptmgrpb.SQS_TEAM, false)
+	createTestSavedQuery(t, s, "dup", scriptmgrpb.SQS_USER, false)
+	_, err := s.CreateSavedQuery(createUserContext(testTeammateID), &scriptmgrpb.CreateSavedQueryReq{
+		Query: &scriptmgrpb.SavedQuery{Name: "dup", Pxl: "px.display(px.DataFrame('http_events'))"},
+	})
+	require.NoError(t, err)
+
+	req := &scriptmgrpb.TransferSavedQueriesReq{
+		OrgID:      utils.ProtoFromUUIDStrOrNil(testOrgID),
+		FromUserID: utils.ProtoFromUUIDStrOrNil(testOwnerID),
+		ToUserID:   utils.ProtoFromUUIDStrOrNil(testTeammateID),
+	}
+	_, err = s.TransferSavedQueries(createUserContext(testOwnerID), req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	sCtx := authcontext.New()
+	sCtx.Claims = srvutils.GenerateJWTForService("ProfileService", "pixie")
+	resp, err := s.TransferSavedQueries(authcontext.NewContext(context.Background(), sCtx), req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), resp.NumQueries)
+
+	// The moved query that clashes with one of the new owner's queries is renamed.
+	queries, err := s.GetSavedQueries(createUserContext(testTeammateID), &scriptmgrpb.GetSavedQueriesReq{})
+	require.NoError(t, err)
+	require.Len(t, queries.Queries, 3)
+	assert.Equal(t, "dup", queries.Queries[0].Name)
+	assert.Equal(t, "dup (1)", queries.Queries[1].Name)
+	assert.Equal(t, "shared", queries.Queries[2].Name)
+	for _, q := range queries.Queries {
+		assert.Equal(t, testTeammateID, utils.UUIDFromProtoOrNil(q.OwnerID).String())
+	}
+	// The new owner is no longer listed as a member of the query they now own.
+	assert.Empty(t, queries.Queries[2].MemberIDs)
+
+	_, err = s.GetSavedQuery(createUserContext(testOwnerID), &scriptmgrpb.GetSavedQueryReq{ID: shared.ID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -22,11 +22,13 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/gogo/protobuf/jsonpb"
 	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -40,6 +42,7 @@ type scriptModel struct {
 	name        string
 	desc        string
 	pxl         string
+	vis         string
 	hasLiveView bool
 }
 
@@ -55,6 +58,13 @@ type scriptStore struct {
 	LiveViews map[uuid.UUID]*liveViewModel
 }
 
+func newScriptStore() *scriptStore {
+	return &scriptStore{
+		Scripts:   make(map[uuid.UUID]*scriptModel),
+		LiveViews: make(map[uuid.UUID]*liveViewModel),
+	}
+}
+
 // Server implements the GRPC Server for the scriptmgr service.
 type Server struct {
 	bundleBucket    string
@@ -63,20 +73,30 @@ type Server struct {
 	store           *scriptStore
 	storeLastUpdate time.Time
 	SeedUUID        uuid.UUID
+
+	// releasesPath is the path within the bundle bucket that holds the releases of the bundle, which orgs can
+	// be pinned to. Pinning is disabled if db is nil.
+	releasesPath string
+	db           *sqlx.DB
+	// releaseStores caches the scripts of the releases that orgs are pinned to. Releases never change once
+	// they are published, so they don't need to be refreshed.
+	releaseStoresMu sync.Mutex
+	releaseStores   map[string]*scriptStore
 }
 
-// NewServer creates a new GRPC scriptmgr server.
-func NewServer(bundleBucket string, bundlePath string, sc stiface.Client) *Server {
+// NewServer creates a new GRPC scriptmgr server. Orgs can be pinned to the releases of the bundle under the
+// releases path, with the pins stored in the given database. Pinning is disabled if the database is nil.
+func NewServer(bundleBucket string, bundlePath string, sc stiface.Client, releasesPath string, db *sqlx.DB) *Server {
 	s := &Server{
-		bundleBucket: bundleBucket,
-		bundlePath:   bundlePath,
-		sc:           sc,
-		store: &scriptStore{
-			Scripts:   make(map[uuid.UUID]*scriptModel),
-			LiveViews: make(map[uuid.UUID]*liveViewModel),
-		},
+		bundleBucket:    bundleBucket,
+		bundlePath:      bundlePath,
+		sc:              sc,
+		store:           newScriptStore(),
 		storeLastUpdate: time.Unix(0, 0),
 		SeedUUID:        uuid.Must(uuid.NewV4()),
+		releasesPath:    releasesPath,
+		db:              db,
+		releaseStores:   make(map[string]*scriptStore),
 	}
 	err := s.updateStore()
 	if err != nil {
@@ -88,7 +108,7 @@ func NewServer(bundleBucket string, bundlePath string, sc stiface.Client) *Serve
 	return s
 }
 
-func (s *Server) addLiveView(name string, bundleScript *pixieScript) error {
+func (s *Server) addLiveView(store *scriptStore, name string, bundleScript *pixieScript) error {
 	id := uuid.NewV5(s.SeedUUID, name)
 
 	var vis vispb.Vis
@@ -97,7 +117,7 @@ func (s *Server) addLiveView(name string, bundleScript *pixieScript) error {
 		return err
 	}
 
-	s.store.LiveViews[id] = &liveViewModel{
+	store.LiveViews[id] = &liveViewModel{
 		name:        name,
 		desc:        bundleScript.ShortDoc,
 		vis:         &vis,
@@ -107,12 +127,13 @@ func (s *Server) addLiveView(name string, bundleScript *pixieScript) error {
 	return nil
 }
 
-func (s *Server) addScript(name string, bundleScript *pixieScript, hasLiveView bool) {
+func (s *Server) addScript(store *scriptStore, name string, bundleScript *pixieScript, hasLiveView bool) {
 	id := uuid.NewV5(s.SeedUUID, name)
-	s.store.Scripts[id] = &scriptModel{
+	store.Scripts[id] = &scriptModel{
 		name:        name,
 		desc:        bundleScript.ShortDoc,
 		pxl:         bundleScript.Pxl,
+		vis:         bundleScript.Vis,
 		hasLiveView: hasLiveView,
 	}
 }
@@ -122,12 +143,17 @@ func (s *Server) updateStore() error {
 	if err != nil {
 		return err
 	}
+	return s.loadBundle(s.store, b)
+}
+
+// loadBundle adds the scripts and live views of the bundle to the store.
+func (s *Server) loadBundle(store *scriptStore, b *bundle) error {
 	var errorMsgs []string
 	for name, bundleScript := range b.Scripts {
 		hasLiveView := bundleScript.Vis != ""
-		s.addScript(name, bundleScript, hasLiveView)
+		s.addScript(store, name, bundleScript, hasLiveView)
 		if hasLiveView {
-			err = s.addLiveView(name, bundleScript)
+			err := s.addLiveView(store, name, bundleScript)
 			if err != nil {
 				errorMsgs = append(errorMsgs, fmt.Sprintf("Error in Live View %s: %s", name, err.Error()))
 			}
@@ -179,8 +205,12 @@ func (s *Server) Start() {
 
 // GetLiveViews returns a list of all available live views.
 func (s *Server) GetLiveViews(ctx context.Context, req *scriptmgrpb.GetLiveViewsReq) (*scriptmgrpb.GetLiveViewsResp, error) {
+	store, err := s.storeForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	resp := &scriptmgrpb.GetLiveViewsResp{}
-	for id, liveView := range s.store.LiveViews {
+	for id, liveView := range store.LiveViews {
 		resp.LiveViews = append(resp.LiveViews, &scriptmgrpb.LiveViewMetadata{
 			Name: liveView.name,
 			Desc: liveView.desc,
@@ -196,7 +226,11 @@ func (s *Server) GetLiveViewContents(ctx context.Context, req *scriptmgrpb.GetLi
 	if id == uuid.Nil {
 		return nil, status.Error(codes.InvalidArgument, "Invalid LiveViewID, bytes couldn't be parsed as UUID.")
 	}
-	liveView, ok := s.store.LiveViews[id]
+	store, err := s.storeForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	liveView, ok := store.LiveViews[id]
 	if !ok {
 		return nil, status.Errorf(codes.InvalidArgument, "LiveViewID: %s, not found.", id.String())
 	}
@@ -214,8 +248,12 @@ func (s *Server) GetLiveViewContents(ctx context.Context, req *scriptmgrpb.GetLi
 
 // GetScripts returns a list of all available scripts.
 func (s *Server) GetScripts(ctx context.Context, req *scriptmgrpb.GetScriptsReq) (*scriptmgrpb.GetScriptsResp, error) {
+	store, err := s.storeForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	resp := &scriptmgrpb.GetScriptsResp{}
-	for id, script := range s.store.Scripts {
+	for id, script := range store.Scripts {
 		resp.Scripts = append(resp.Scripts, &scriptmgrpb.ScriptMetadata{
 			ID:          utils.ProtoFromUUID(id),
 			Name:        script.name,
@@ -232,7 +270,11 @@ func (s *Server) GetScriptContents(ctx context.Context, req *scriptmgrpb.GetScri
 	if id == uuid.Nil {
 		return nil, status.Error(codes.InvalidArgument, "Invalid ScriptID, bytes couldn't be parsed as UUID.")
 	}
-	script, ok := s.store.Scripts[id]
+	store, err := s.storeForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	script, ok := store.Scripts[id]
 	if !ok {
 		return nil, status.Errorf(codes.InvalidArgument, "ScriptID: %s, not found.", id.String())
 	}
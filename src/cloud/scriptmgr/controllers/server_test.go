@@ -131,7 +131,7 @@ func TestScriptMgr_GetLiveViews(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			c := mustSetupFakeBucket(t, testBundle)
-			s := controllers.NewServer(bundleBucket, bundlePath, c)
+			s := controllers.NewServer(bundleBucket, bundlePath, c, "", nil)
 			ctx := context.Background()
 
 			req := &scriptmgrpb.GetLiveViewsReq{}
@@ -174,7 +174,7 @@ func TestScriptMgr_GetLiveViewContents(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			c := mustSetupFakeBucket(t, testBundle)
-			s := controllers.NewServer(bundleBucket, bundlePath, c)
+			s := controllers.NewServer(bundleBucket, bundlePath, c, "", nil)
 			ctx := context.Background()
 
 			id := uuid.NewV5(s.SeedUUID, tc.liveViewName)
@@ -252,7 +252,7 @@ func TestScriptMgr_GetScripts(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			c := mustSetupFakeBucket(t, testBundle)
-			s := controllers.NewServer(bundleBucket, bundlePath, c)
+			s := controllers.NewServer(bundleBucket, bundlePath, c, "", nil)
 			ctx := context.Background()
 
 			req := &scriptmgrpb.GetScriptsReq{}
@@ -295,7 +295,7 @@ func TestScriptMgr_GetScriptContents(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			c := mustSetupFakeBucket(t, testBundle)
-			s := controllers.NewServer(bundleBucket, bundlePath, c)
+			s := controllers.NewServer(bundleBucket, bundlePath, c, "", nil)
 			ctx := context.Background()
 			id := uuid.NewV5(s.SeedUUID, tc.scriptName)
 			req := &scriptmgrpb.GetScriptContentsReq{
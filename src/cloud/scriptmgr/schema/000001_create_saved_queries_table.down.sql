@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS saved_query_members;
+DROP TABLE IF EXISTS saved_queries;
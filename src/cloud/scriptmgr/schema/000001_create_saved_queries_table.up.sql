@@ -0,0 +1,39 @@
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE saved_queries (
+  -- The ID of the saved query.
+  id UUID UNIQUE DEFAULT uuid_generate_v4(),
+  -- org_id is the org that the saved query belongs to.
+  org_id UUID NOT NULL,
+  -- owner_id is the user who created the saved query.
+  owner_id UUID NOT NULL,
+  -- name is the name of the saved query, which is unique for each owner.
+  name varchar NOT NULL,
+  description varchar NOT NULL DEFAULT '',
+  -- pxl contains the PxL script to run.
+  pxl varchar NOT NULL,
+  -- args contains the arguments to run the script with, as a JSON object.
+  args varchar NOT NULL DEFAULT '{}',
+  -- vis contains the layout of the results, as a JSON vis spec.
+  vis varchar NOT NULL DEFAULT '',
+  -- scope controls who can see the saved query. It is one of the SavedQueryScope values.
+  scope integer NOT NULL,
+  -- allow_edit is whether users other than the owner who can see the query may also edit it.
+  allow_edit boolean NOT NULL DEFAULT false,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (id),
+  UNIQUE (org_id, owner_id, name)
+);
+
+CREATE TABLE saved_query_members (
+  -- saved_query_id is the saved query that is shared with the user.
+  saved_query_id UUID NOT NULL REFERENCES saved_queries(id) ON DELETE CASCADE,
+  -- user_id is the team member that the saved query is shared with.
+  user_id UUID NOT NULL,
+
+  PRIMARY KEY (saved_query_id, user_id)
+);
+
+CREATE INDEX saved_query_members_user_id_idx ON saved_query_members (user_id);
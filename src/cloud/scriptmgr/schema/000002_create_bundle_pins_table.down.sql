@@ -0,0 +1 @@
+DROP TABLE IF EXISTS bundle_pins;
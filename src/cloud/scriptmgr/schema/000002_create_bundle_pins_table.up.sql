@@ -0,0 +1,11 @@
+CREATE TABLE bundle_pins (
+  -- org_id is the org that is pinned to a release of the script bundle.
+  org_id UUID NOT NULL,
+  -- release is the release of the script bundle that the org is pinned to.
+  release varchar NOT NULL,
+  -- updated_by is the user who last changed the pin.
+  updated_by UUID NOT NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (org_id)
+);
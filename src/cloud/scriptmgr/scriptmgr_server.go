@@ -24,6 +24,7 @@ import (
 	_ "net/http/pprof"
 
 	"cloud.google.com/go/storage"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
 	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -31,16 +32,21 @@ import (
 	"google.golang.org/api/option"
 
 	"px.dev/pixie/src/cloud/scriptmgr/controllers"
+	"px.dev/pixie/src/cloud/scriptmgr/schema"
 	"px.dev/pixie/src/cloud/scriptmgr/scriptmgrpb"
+	"px.dev/pixie/src/cloud/shared/pgmigrate"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/env"
 	"px.dev/pixie/src/shared/services/healthz"
+	"px.dev/pixie/src/shared/services/pg"
 	"px.dev/pixie/src/shared/services/server"
 )
 
 func init() {
 	pflag.String("bundle_bucket", "pixie-prod-artifacts", "GCS Bucket containing the bundle of scripts.")
 	pflag.String("bundle_path", "script-bundles/bundle.json", "Path to bundle within bucket.")
+	pflag.String("bundle_releases_path", "script-bundles/releases", "Path within the bucket to the releases of the "+
+		"bundle that orgs can pin their scripts to. Each release is stored at <path>/<release>/bundle.json.")
 }
 
 func main() {
@@ -61,14 +67,25 @@ func main() {
 		log.WithError(err).Fatal("Failed to initialize GCS client.")
 	}
 
+	db := pg.MustConnectDefaultPostgresDB()
+	err = pgmigrate.PerformMigrationsUsingBindata(db, "scriptmgr_service_migrations",
+		bindata.Resource(schema.AssetNames(), schema.Asset))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to apply migrations")
+	}
+
 	svr := controllers.NewServer(
 		viper.GetString("bundle_bucket"),
 		viper.GetString("bundle_path"),
-		stiface.AdaptClient(client))
+		stiface.AdaptClient(client),
+		viper.GetString("bundle_releases_path"),
+		db)
 	svr.Start()
 
 	scriptmgrpb.RegisterScriptMgrServiceServer(s.GRPCServer(), svr)
 
+	scriptmgrpb.RegisterSavedQueryServiceServer(s.GRPCServer(), controllers.NewSavedQueryServer(db))
+
 	s.Start()
 	s.StopOnInterrupt()
 }
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package apikeyscope
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"px.dev/pixie/src/cloud/shared/patscope"
+)
+
+const (
+	// ScriptRead allows running scripts that don't mutate the clusters, and reading from the Pixie Cloud API.
+	ScriptRead = "script:read"
+	// ScriptWrite allows running all scripts, including mutations such as tracepoints, and reading from the
+	// Pixie Cloud API.
+	ScriptWrite = "script:write"
+	// Deploy allows the calls that deploy and upgrade Viziers.
+	Deploy = "deploy"
+
+	// TokenScope is added to the scopes of the JWTs issued for scoped API keys, so that the scopes of the
+	// key are enforced.
+	TokenScope = "apikey"
+	// clusterScopePrefix is the prefix of the JWT scopes that restrict the clusters that scripts may run on.
+	clusterScopePrefix = "cluster:"
+)
+
+// Scopes are all the scopes that API keys can have.
+var Scopes = []string{ScriptRead, ScriptWrite, Deploy}
+
+// scriptMethods are the Vizier methods that run scripts.
+var scriptMethods = []string{
+	"/px.api.vizierpb.VizierService/ExecuteScript",
+	"/px.api.vizierpb.VizierService/HealthCheck",
+	"/px.api.vizierpb.VizierService/GenerateOTelScript",
+}
+
+// deployServicePrefixes are the prefixes of the Pixie Cloud API services that are used to deploy Viziers.
+var deployServicePrefixes = []string{
+	"/px.cloudapi.ArtifactTracker/",
+	"/px.cloudapi.ConfigService/",
+	"/px.cloudapi.VizierClusterInfo/",
+	"/px.cloudapi.VizierDeploymentKeyManager/",
+}
+
+// credentialServicePrefixes are the prefixes of the Pixie Cloud API services that return credentials. Script
+// scopes never allow them, even for reads, so that a scoped key can't be used to get an unrestricted one.
+var credentialServicePrefixes = []string{
+	"/px.cloudapi.APIKeyManager/",
+	"/px.cloudapi.PersonalAccessTokenManager/",
+	"/px.cloudapi.VizierDeploymentKeyManager/",
+}
+
+// credentialMethods are the methods that return credentials that aren't restricted to the scopes of the key,
+// such as a direct token for a Vizier. No scope allows them.
+var credentialMethods = []string{
+	"/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+}
+
+// Validate checks that the scopes are known. Keys without scopes are unrestricted.
+func Validate(scopes []string) error {
+	for _, s := range scopes {
+		if !contains(Scopes, s) {
+			return fmt.Errorf("invalid scope %q, valid scopes are: %s", s, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// ClusterScope returns the JWT scope that allows running scripts on the cluster.
+func ClusterScope(clusterID uuid.UUID) string {
+	return clusterScopePrefix + clusterID.String()
+}
+
+// IsScoped returns whether the JWT with the given scopes was issued for a scoped API key.
+func IsScoped(jwtScopes []string) bool {
+	return contains(jwtScopes, TokenScope)
+}
+
+// Allows returns whether a scoped API key with the given JWT scopes may make the call. path is the full name
+// of the gRPC method, or the path of the HTTP request.
+func Allows(jwtScopes []string, path string) bool {
+	canRunScripts := AllowsScripts(jwtScopes)
+	if contains(credentialMethods, path) {
+		return false
+	}
+	if contains(scriptMethods, path) {
+		return canRunScripts
+	}
+	if contains(jwtScopes, Deploy) {
+		for _, prefix := range deployServicePrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+	}
+	for _, prefix := range credentialServicePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	// Running scripts needs to look up the clusters of the org.
+	return canRunScripts && patscope.IsReadMethod(path)
+}
+
+// AllowsScripts returns whether the scopes allow running scripts.
+func AllowsScripts(scopes []string) bool {
+	return contains(scopes, ScriptRead) || contains(scopes, ScriptWrite)
+}
+
+// AllowsMutation returns whether the JWT with the given scopes may run scripts that mutate the cluster.
+func AllowsMutation(jwtScopes []string) bool {
+	return !IsScoped(jwtScopes) || contains(jwtScopes, ScriptWrite)
+}
+
+// AllowsCluster returns whether the JWT with the given scopes may run scripts on the cluster. Scoped API
+// keys that aren't restricted to any clusters may run scripts on all of them.
+func AllowsCluster(jwtScopes []string, clusterID uuid.UUID) bool {
+	if !IsScoped(jwtScopes) {
+		return true
+	}
+	restricted := false
+	for _, s := range jwtScopes {
+		if !strings.HasPrefix(s, clusterScopePrefix) {
+			continue
+		}
+		restricted = true
+		if s == ClusterScope(clusterID) {
+			return true
+		}
+	}
+	return !restricted
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package apikeyscope_test
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"px.dev/pixie/src/cloud/shared/apikeyscope"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, apikeyscope.Validate(nil))
+	assert.NoError(t, apikeyscope.Validate([]string{apikeyscope.ScriptRead, apikeyscope.Deploy}))
+	assert.Error(t, apikeyscope.Validate([]string{apikeyscope.TokenScope}))
+	assert.Error(t, apikeyscope.Validate([]string{"cloud:write"}))
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		path    string
+		allowed bool
+	}{
+		{
+			name:    "script with read scope",
+			scopes:  []string{apikeyscope.ScriptRead},
+			path:    "/px.api.vizierpb.VizierService/ExecuteScript",
+			allowed: true,
+		},
+		{
+			name:    "cluster lookup with read scope",
+			scopes:  []string{apikeyscope.ScriptRead},
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterInfo",
+			allowed: true,
+		},
+		{
+			name:    "org update with script write scope",
+			scopes:  []string{apikeyscope.ScriptWrite},
+			path:    "/px.cloudapi.OrganizationService/UpdateOrg",
+			allowed: false,
+		},
+		{
+			name:    "debug with write scope",
+			scopes:  []string{apikeyscope.ScriptWrite},
+			path:    "/px.api.vizierpb.VizierDebugService/DebugLog",
+			allowed: false,
+		},
+		{
+			name:    "api key lookup with read scope",
+			scopes:  []string{apikeyscope.ScriptRead},
+			path:    "/px.cloudapi.APIKeyManager/Get",
+			allowed: false,
+		},
+		{
+			name:    "cluster connection info with read scope",
+			scopes:  []string{apikeyscope.ScriptRead},
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+			allowed: false,
+		},
+		{
+			name:    "cluster connection info with all scopes",
+			scopes:  []string{apikeyscope.ScriptWrite, apikeyscope.Deploy},
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+			allowed: false,
+		},
+		{
+			name:    "graphql with read scope",
+			scopes:  []string{apikeyscope.ScriptRead},
+			path:    "/api/graphql",
+			allowed: false,
+		},
+		{
+			name:    "deploy with deploy scope",
+			scopes:  []string{apikeyscope.Deploy},
+			path:    "/px.cloudapi.VizierClusterInfo/UpdateOrInstallCluster",
+			allowed: true,
+		},
+		{
+			name:    "deployment key with deploy scope",
+			scopes:  []string{apikeyscope.Deploy},
+			path:    "/px.cloudapi.VizierDeploymentKeyManager/Create",
+			allowed: true,
+		},
+		{
+			name:    "script with deploy scope",
+			scopes:  []string{apikeyscope.Deploy},
+			path:    "/px.api.vizierpb.VizierService/ExecuteScript",
+			allowed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scopes := append([]string{"user", apikeyscope.TokenScope}, test.scopes...)
+			assert.Equal(t, test.allowed, apikeyscope.Allows(scopes, test.path))
+		})
+	}
+}
+
+func TestAllowsMutation(t *testing.T) {
+	assert.True(t, apikeyscope.AllowsMutation([]string{"user"}))
+	assert.True(t, apikeyscope.AllowsMutation([]string{"user", apikeyscope.TokenScope, apikeyscope.ScriptWrite}))
+	assert.False(t, apikeyscope.AllowsMutation([]string{"user", apikeyscope.TokenScope, apikeyscope.ScriptRead}))
+}
+
+func TestAllowsCluster(t *testing.T) {
+	clusterID := uuid.Must(uuid.NewV4())
+	otherClusterID := uuid.Must(uuid.NewV4())
+
+	unrestricted := []string{"user", apikeyscope.TokenScope, apikeyscope.ScriptRead}
+	assert.True(t, apikeyscope.AllowsCluster(unrestricted, clusterID))
+
+	restricted := append(unrestricted, apikeyscope.ClusterScope(clusterID))
+	assert.True(t, apikeyscope.AllowsCluster(restricted, clusterID))
+	assert.False(t, apikeyscope.AllowsCluster(restricted, otherClusterID))
+
+	// Cluster scopes only apply to scoped API keys.
+	assert.True(t, apikeyscope.AllowsCluster([]string{"user", apikeyscope.ClusterScope(clusterID)}, otherClusterID))
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package audit records the security relevant events of the cloud services, such as logins and script
+// executions, and exports them to the SIEM systems that are configured for the deployment.
+package audit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Category is the kind of an audit event.
+type Category string
+
+const (
+	// CategoryAuth is for logins and signups.
+	CategoryAuth Category = "auth"
+	// CategoryAPIKey is for the use of API keys and personal access tokens.
+	CategoryAPIKey Category = "api_key"
+	// CategoryScript is for script executions.
+	CategoryScript Category = "script"
+	// CategoryConfig is for changes to the config of orgs and clusters.
+	CategoryConfig Category = "config"
+)
+
+// Outcome is whether the audited action succeeded.
+type Outcome string
+
+const (
+	// OutcomeSuccess is an action that succeeded.
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure is an action that failed or was denied.
+	OutcomeFailure Outcome = "failure"
+)
+
+// Event is an audit log entry.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Category Category  `json:"category"`
+	// Action is what happened, for example "login" or "execute_script".
+	Action  string  `json:"action"`
+	Outcome Outcome `json:"outcome"`
+	OrgID   string  `json:"orgID,omitempty"`
+	UserID  string  `json:"userID,omitempty"`
+	// Resource is what the action was done on, such as the ID of a cluster.
+	Resource string `json:"resource,omitempty"`
+	// Source is the pod of the service that recorded the event.
+	Source  string            `json:"source,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// SetupFlags installs the flag handlers for the audit log.
+func SetupFlags() {
+	pflag.StringSlice("audit_sinks", []string{"log"}, "Where audit events are exported to: any of log, syslog, s3 and kafka. If empty, audit events aren't recorded")
+	pflag.Duration("audit_flush_interval", 5*time.Second, "How often the buffered audit events are exported")
+	pflag.String("audit_syslog_network", "udp", "The network to reach the syslog server on, udp or tcp")
+	pflag.String("audit_syslog_addr", "", "The address of the syslog server that audit events are sent to in CEF")
+	pflag.String("audit_s3_endpoint", "https://s3.amazonaws.com", "The endpoint of the S3 (or S3 compatible) service that audit events are written to")
+	pflag.String("audit_s3_region", "us-east-1", "The region of the S3 bucket")
+	pflag.String("audit_s3_bucket", "", "The S3 bucket that audit events are written to")
+	pflag.String("audit_s3_prefix", "audit", "The prefix of the objects that audit events are written to")
+	pflag.String("audit_s3_access_key_id", "", "The access key ID to write to the S3 bucket with")
+	pflag.String("audit_s3_secret_access_key", "", "The secret access key to write to the S3 bucket with")
+	pflag.String("audit_kafka_rest_url", "", "The URL of the Kafka REST proxy that audit events are produced through")
+	pflag.String("audit_kafka_topic", "pixie-audit", "The Kafka topic that audit events are produced to")
+}
+
+var (
+	mu       sync.Mutex
+	pipeline *Pipeline
+)
+
+func sinksFromFlags() ([]Sink, error) {
+	var sinks []Sink
+	for _, name := range viper.GetStringSlice("audit_sinks") {
+		switch name {
+		case "log":
+			sinks = append(sinks, NewLogSink())
+		case "syslog":
+			s, err := NewSyslogSink(viper.GetString("audit_syslog_network"), viper.GetString("audit_syslog_addr"))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		case "s3":
+			s, err := NewS3Sink(&S3Config{
+				Endpoint:        viper.GetString("audit_s3_endpoint"),
+				Region:          viper.GetString("audit_s3_region"),
+				Bucket:          viper.GetString("audit_s3_bucket"),
+				Prefix:          viper.GetString("audit_s3_prefix"),
+				AccessKeyID:     viper.GetString("audit_s3_access_key_id"),
+				SecretAccessKey: viper.GetString("audit_s3_secret_access_key"),
+			})
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		case "kafka":
+			s, err := NewKafkaSink(viper.GetString("audit_kafka_rest_url"), viper.GetString("audit_kafka_topic"))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// Init starts exporting the audit events that the service records to the sinks configured by the flags.
+func Init() error {
+	sinks, err := sinksFromFlags()
+	if err != nil {
+		return err
+	}
+	if len(sinks) == 0 {
+		log.Info("Audit log is disabled")
+		return nil
+	}
+	SetPipeline(NewPipeline(sinks, viper.GetDuration("audit_flush_interval")))
+	return nil
+}
+
+// SetPipeline sets the pipeline that audit events are recorded to.
+func SetPipeline(p *Pipeline) {
+	mu.Lock()
+	defer mu.Unlock()
+	pipeline = p
+}
+
+// Record records an audit event. It never blocks on the export of the event, and is a no-op if the audit
+// log isn't initialized.
+func Record(e *Event) {
+	mu.Lock()
+	p := pipeline
+	mu.Unlock()
+	if p == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Source == "" {
+		e.Source = viper.GetString("pod_name")
+	}
+	p.Record(e)
+}
+
+// Close exports the events that are still buffered and stops the pipeline.
+func Close() {
+	mu.Lock()
+	p := pipeline
+	pipeline = nil
+	mu.Unlock()
+	if p != nil {
+		p.Close()
+	}
+}
+
+// OutcomeOf returns the outcome of an action that returned err.
+func OutcomeOf(err error) Outcome {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
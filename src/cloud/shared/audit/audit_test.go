@@ -0,0 +1,232 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	batches [][]*Event
+	closed  bool
+}
+
+func (f *fakeSink) Name() string {
+	return "fake"
+}
+
+func (f *fakeSink) Write(ctx context.Context, events []*Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, events)
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeSink) events() []*Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var events []*Event
+	for _, b := range f.batches {
+		events = append(events, b...)
+	}
+	return events
+}
+
+func TestRecord(t *testing.T) {
+	// Recording without an initialized audit log is a no-op.
+	Record(&Event{Category: CategoryAuth, Action: "login"})
+
+	viper.Set("pod_name", "api-server-1")
+	defer viper.Set("pod_name", "")
+	sink := &fakeSink{}
+	SetPipeline(NewPipeline([]Sink{sink}, time.Hour))
+
+	Record(&Event{Category: CategoryAuth, Action: "login", Outcome: OutcomeSuccess, UserID: "user1"})
+	Record(&Event{Category: CategoryScript, Action: "execute_script", Outcome: OutcomeFailure, OrgID: "org1"})
+	// Closing exports the events that are still buffered.
+	Close()
+
+	events := sink.events()
+	require.Len(t, events, 2)
+	assert.Equal(t, "login", events[0].Action)
+	assert.Equal(t, "api-server-1", events[0].Source)
+	assert.False(t, events[0].Time.IsZero())
+	assert.Equal(t, "execute_script", events[1].Action)
+	assert.True(t, sink.closed)
+}
+
+func TestPipeline_FlushesPeriodically(t *testing.T) {
+	sink := &fakeSink{}
+	p := NewPipeline([]Sink{sink}, 10*time.Millisecond)
+	defer p.Close()
+
+	p.Record(&Event{Category: CategoryConfig, Action: "update_org"})
+	require.Eventually(t, func() bool {
+		return len(sink.events()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSinksFromFlags(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("audit_sinks", []string{"log"})
+	sinks, err := sinksFromFlags()
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+
+	viper.Set("audit_sinks", []string{"s3"})
+	_, err = sinksFromFlags()
+	assert.Error(t, err)
+
+	viper.Set("audit_sinks", []string{"splunk"})
+	_, err = sinksFromFlags()
+	assert.Error(t, err)
+}
+
+func testEvent() *Event {
+	return &Event{
+		Time:     time.Unix(1700000000, 0),
+		Category: CategoryAPIKey,
+		Action:   "use_api_key",
+		Outcome:  OutcomeFailure,
+		OrgID:    "org1",
+		UserID:   "user1",
+		Details:  map[string]string{"reason": "key=revoked"},
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	cef := FormatCEF(testEvent())
+	assert.True(t, strings.HasPrefix(cef, "CEF:0|Pixie|Pixie Cloud|"))
+	assert.Contains(t, cef, "|api_key.use_api_key|api_key use_api_key|7|")
+	assert.Contains(t, cef, "rt=1700000000000 cat=api_key act=use_api_key outcome=failure suid=user1 cs1Label=orgID cs1=org1")
+	assert.Contains(t, cef, `msg=reason:key\=revoked`)
+}
+
+func TestSyslogSink(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	lineCh := make(chan string, 2)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lineCh <- line
+		}
+	}()
+
+	s, err := NewSyslogSink("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Write(context.Background(), []*Event{testEvent()}))
+
+	line := <-lineCh
+	// authpriv (10) * 8 + warning (4).
+	assert.True(t, strings.HasPrefix(line, "<84>1 2023-11-14T22:13:20Z "))
+	assert.Contains(t, line, " pixie-cloud - - - CEF:0|Pixie|")
+}
+
+func TestS3Sink(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	s, err := NewS3Sink(&S3Config{
+		Endpoint:        srv.URL,
+		Region:          "eu-west-1",
+		Bucket:          "audit-bucket",
+		Prefix:          "pixie/",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(t, err)
+	s.now = func() time.Time { return time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC) }
+
+	require.NoError(t, s.Write(context.Background(), []*Event{testEvent(), testEvent()}))
+	require.NotNil(t, req)
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.True(t, strings.HasPrefix(req.URL.Path, "/audit-bucket/pixie/2023/11/14/20231114T221320Z-"))
+	assert.Equal(t, "20231114T221320Z", req.Header.Get("x-amz-date"))
+	assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKID/20231114/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="))
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 2)
+	e := &Event{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), e))
+	assert.Equal(t, "use_api_key", e.Action)
+}
+
+func TestKafkaSink(t *testing.T) {
+	var path, contentType string
+	var body struct {
+		Records []struct {
+			Key   string `json:"key"`
+			Value *Event `json:"value"`
+		} `json:"records"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	s, err := NewKafkaSink(srv.URL+"/", "pixie-audit")
+	require.NoError(t, err)
+	require.NoError(t, s.Write(context.Background(), []*Event{testEvent()}))
+	assert.Equal(t, "/topics/pixie-audit", path)
+	assert.Equal(t, "application/vnd.kafka.json.v2+json", contentType)
+	require.Len(t, body.Records, 1)
+	assert.Equal(t, "org1", body.Records[0].Key)
+	assert.Equal(t, "use_api_key", body.Records[0].Value.Action)
+}
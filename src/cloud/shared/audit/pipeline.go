@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// bufferSize is the number of events that can wait to be exported. Events are dropped when the buffer is
+	// full, so that a slow sink never slows down the services.
+	bufferSize = 10000
+	// maxBatchSize is the most events that are exported to the sinks at once.
+	maxBatchSize = 500
+	// exportTimeout is how long a sink has to export a batch of events.
+	exportTimeout = 30 * time.Second
+)
+
+// Sink exports audit events to a SIEM system.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, events []*Event) error
+	Close() error
+}
+
+// Pipeline buffers the recorded audit events and exports them to the sinks in batches.
+type Pipeline struct {
+	sinks         []Sink
+	flushInterval time.Duration
+
+	eventCh chan *Event
+	quitCh  chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// NewPipeline creates and starts a pipeline that exports events to the sinks every flushInterval.
+func NewPipeline(sinks []Sink, flushInterval time.Duration) *Pipeline {
+	p := &Pipeline{
+		sinks:         sinks,
+		flushInterval: flushInterval,
+		eventCh:       make(chan *Event, bufferSize),
+		quitCh:        make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+// Record queues an event to be exported.
+func (p *Pipeline) Record(e *Event) {
+	select {
+	case p.eventCh <- e:
+	default:
+		log.WithField("category", e.Category).
+			WithField("action", e.Action).
+			Error("Audit log buffer is full, dropping event")
+	}
+}
+
+func (p *Pipeline) run() {
+	defer p.wg.Done()
+	t := time.NewTicker(p.flushInterval)
+	defer t.Stop()
+
+	var batch []*Event
+	for {
+		select {
+		case e := <-p.eventCh:
+			batch = append(batch, e)
+			if len(batch) >= maxBatchSize {
+				p.export(batch)
+				batch = nil
+			}
+		case <-t.C:
+			if len(batch) > 0 {
+				p.export(batch)
+				batch = nil
+			}
+		case <-p.quitCh:
+			// Drain the events that were recorded before the pipeline was closed.
+			for {
+				select {
+				case e := <-p.eventCh:
+					batch = append(batch, e)
+				default:
+					if len(batch) > 0 {
+						p.export(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *Pipeline) export(batch []*Event) {
+	for _, s := range p.sinks {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		if err := s.Write(ctx, batch); err != nil {
+			log.WithError(err).
+				WithField("sink", s.Name()).
+				WithField("events", len(batch)).
+				Error("Failed to export audit events")
+		}
+		cancel()
+	}
+}
+
+// Close exports the buffered events and closes the sinks.
+func (p *Pipeline) Close() {
+	p.once.Do(func() {
+		close(p.quitCh)
+		p.wg.Wait()
+		for _, s := range p.sinks {
+			if err := s.Close(); err != nil {
+				log.WithError(err).WithField("sink", s.Name()).Error("Failed to close audit sink")
+			}
+		}
+	})
+}
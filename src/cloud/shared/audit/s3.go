@@ -0,0 +1,171 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	s3DateFormat       = "20060102T150405Z"
+	s3SignedHeaders    = "host;x-amz-content-sha256;x-amz-date"
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// S3Config configures the bucket that the S3Sink writes to.
+type S3Config struct {
+	// Endpoint is the URL of the S3 service. Buckets are addressed by path, so that S3 compatible services
+	// work too.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Sink writes each batch of audit events to an object in an S3 bucket, as JSON lines. Objects are
+// partitioned by day, so that they are easy to load into a SIEM and to expire with lifecycle rules.
+type S3Sink struct {
+	cfg      *S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Sink creates a new S3Sink.
+func NewS3Sink(cfg *S3Config) (*S3Sink, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("the bucket and credentials are required for the s3 audit sink")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	return &S3Sink{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   &http.Client{},
+		now:      time.Now,
+	}, nil
+}
+
+// Name implements Sink.
+func (s *S3Sink) Name() string {
+	return "s3"
+}
+
+func (s *S3Sink) objectKey(now time.Time) string {
+	now = now.UTC()
+	name := fmt.Sprintf("%s/%s-%s.jsonl", now.Format("2006/01/02"), now.Format(s3DateFormat), uuid.Must(uuid.NewV4()))
+	if s.cfg.Prefix == "" {
+		return name
+	}
+	return strings.Trim(s.cfg.Prefix, "/") + "/" + name
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign signs the request with AWS Signature Version 4.
+func (s *S3Sink) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(s3DateFormat)
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		s3SignedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.cfg.Region)
+	stringToSign := strings.Join([]string{s3SigningAlgorithm, amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, s.cfg.AccessKeyID, scope, s3SignedHeaders, signature))
+}
+
+// Write implements Sink.
+func (s *S3Sink) Write(ctx context.Context, events []*Event) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	now := s.now()
+	objectURL := *s.endpoint
+	objectURL.Path = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.endpoint.Path, "/"), s.cfg.Bucket, s.objectKey(now))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	payloadHash := sha256.Sum256(body.Bytes())
+	s.sign(req, hex.EncodeToString(payloadHash[:]), now)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *S3Sink) Close() error {
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogSink writes audit events to the service logs, which is enough for deployments that already ship their
+// logs to a SIEM.
+type LogSink struct{}
+
+// NewLogSink creates a new LogSink.
+func NewLogSink() *LogSink {
+	return &LogSink{}
+}
+
+// Name implements Sink.
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+// Write implements Sink.
+func (s *LogSink) Write(ctx context.Context, events []*Event) error {
+	for _, e := range events {
+		entry := log.WithFields(log.Fields{
+			"audit":    e.Category,
+			"action":   e.Action,
+			"outcome":  e.Outcome,
+			"org_id":   e.OrgID,
+			"user_id":  e.UserID,
+			"resource": e.Resource,
+			"time":     e.Time,
+		})
+		for k, v := range e.Details {
+			entry = entry.WithField(k, v)
+		}
+		entry.Info("Audit event")
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *LogSink) Close() error {
+	return nil
+}
+
+// KafkaSink produces audit events to a Kafka topic, through a Kafka REST proxy. Events are keyed by their
+// org, so that the events of an org stay in order.
+type KafkaSink struct {
+	topicURL string
+	client   *http.Client
+}
+
+// NewKafkaSink creates a new KafkaSink that produces to the topic through the REST proxy at restURL.
+func NewKafkaSink(restURL string, topic string) (*KafkaSink, error) {
+	if restURL == "" || topic == "" {
+		return nil, errors.New("the Kafka REST proxy URL and topic are required for the kafka audit sink")
+	}
+	return &KafkaSink{
+		topicURL: fmt.Sprintf("%s/topics/%s", strings.TrimSuffix(restURL, "/"), url.PathEscape(topic)),
+		client:   &http.Client{},
+	}, nil
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key,omitempty"`
+	Value *Event `json:"value"`
+}
+
+// Name implements Sink.
+func (s *KafkaSink) Name() string {
+	return "kafka"
+}
+
+// Write implements Sink.
+func (s *KafkaSink) Write(ctx context.Context, events []*Event) error {
+	records := make([]kafkaRecord, len(events))
+	for i, e := range events {
+		records[i] = kafkaRecord{Key: e.OrgID, Value: e}
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.topicURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("kafka REST proxy returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *KafkaSink) Close() error {
+	return nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	version "px.dev/pixie/src/shared/goversion"
+)
+
+const (
+	// syslogFacilityAuthpriv is the facility for security and authorization messages.
+	syslogFacilityAuthpriv = 10
+	syslogSeverityWarning  = 4
+	syslogSeverityNotice   = 5
+	syslogDialTimeout      = 5 * time.Second
+	syslogAppName          = "pixie-cloud"
+)
+
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+var cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+// FormatCEF formats an audit event in the ArcSight Common Event Format.
+func FormatCEF(e *Event) string {
+	severity := 3
+	if e.Outcome == OutcomeFailure {
+		severity = 7
+	}
+	ext := []string{
+		fmt.Sprintf("rt=%d", e.Time.UnixMilli()),
+		"cat=" + cefExtensionEscaper.Replace(string(e.Category)),
+		"act=" + cefExtensionEscaper.Replace(e.Action),
+		"outcome=" + cefExtensionEscaper.Replace(string(e.Outcome)),
+	}
+	if e.UserID != "" {
+		ext = append(ext, "suid="+cefExtensionEscaper.Replace(e.UserID))
+	}
+	if e.OrgID != "" {
+		ext = append(ext, "cs1Label=orgID", "cs1="+cefExtensionEscaper.Replace(e.OrgID))
+	}
+	if e.Resource != "" {
+		ext = append(ext, "cs2Label=resource", "cs2="+cefExtensionEscaper.Replace(e.Resource))
+	}
+	if e.Source != "" {
+		ext = append(ext, "dvchost="+cefExtensionEscaper.Replace(e.Source))
+	}
+	if len(e.Details) > 0 {
+		keys := make([]string, 0, len(e.Details))
+		for k := range e.Details {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		details := make([]string, len(keys))
+		for i, k := range keys {
+			details[i] = k + ":" + e.Details[k]
+		}
+		ext = append(ext, "msg="+cefExtensionEscaper.Replace(strings.Join(details, " ")))
+	}
+
+	return fmt.Sprintf("CEF:0|Pixie|Pixie Cloud|%s|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(version.GetVersion().ToString()),
+		cefHeaderEscaper.Replace(string(e.Category)+"."+e.Action),
+		cefHeaderEscaper.Replace(string(e.Category)+" "+e.Action),
+		severity,
+		strings.Join(ext, " "))
+}
+
+// SyslogSink sends audit events to a syslog server, as RFC 5424 messages with a CEF payload.
+type SyslogSink struct {
+	network  string
+	addr     string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink creates a new SyslogSink for the syslog server at addr.
+func NewSyslogSink(network string, addr string) (*SyslogSink, error) {
+	if addr == "" {
+		return nil, errors.New("the syslog address is required for the syslog audit sink")
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog network %q", network)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &SyslogSink{network: network, addr: addr, hostname: hostname}, nil
+}
+
+// Name implements Sink.
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+func (s *SyslogSink) formatMessage(e *Event) string {
+	severity := syslogSeverityNotice
+	if e.Outcome == OutcomeFailure {
+		severity = syslogSeverityWarning
+	}
+	// Messages over TCP are newline delimited, so that they can be told apart in the stream.
+	return fmt.Sprintf("<%d>1 %s %s %s - - - %s\n",
+		syslogFacilityAuthpriv*8+severity,
+		e.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		syslogAppName,
+		FormatCEF(e))
+}
+
+// Write implements Sink. The connection is reestablished if writing fails, so that events are still exported
+// after the syslog server restarts.
+func (s *SyslogSink) Write(ctx context.Context, events []*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range events {
+		if s.conn == nil {
+			d := net.Dialer{Timeout: syslogDialTimeout}
+			conn, err := d.DialContext(ctx, s.network, s.addr)
+			if err != nil {
+				return err
+			}
+			s.conn = conn
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = s.conn.SetWriteDeadline(deadline)
+		}
+		if _, err := s.conn.Write([]byte(s.formatMessage(e))); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/shared/services/authcontext"
+)
+
+const (
+	// MetadataKey is the GRPC metadata key that clients set the idempotency key of a request in.
+	// HTTP clients can set it with the Idempotency-Key header.
+	MetadataKey = "idempotency-key"
+
+	bucketName   = "IdempotencyKeys"
+	maxKeyLength = 255
+	// pendingTimeout is how long a request may hold an idempotency key without completing. After that,
+	// the request is assumed to have been lost, for example because the service restarted, and a retry
+	// may run the request again.
+	pendingTimeout = 1 * time.Minute
+	// maxClaimAttempts is how many times to try to claim a key that is concurrently changed by other requests.
+	maxClaimAttempts = 3
+)
+
+// entry is the value stored for each idempotency key.
+type entry struct {
+	// RequestHash is the hash of the request that used the key. Reusing the key for a different request is an error.
+	RequestHash string    `json:"requestHash"`
+	StartedAt   time.Time `json:"startedAt"`
+	Done        bool      `json:"done"`
+	// Response is the response of the request, as a marshaled types.Any. Only set once the request is done.
+	Response []byte `json:"response,omitempty"`
+}
+
+// SecretResponse keeps the secrets in the responses of a method, such as the value of a created key, out of the
+// key-value bucket. Only the redacted response is stored, and the secrets are fetched again when it's replayed.
+type SecretResponse struct {
+	// Redact returns a copy of the response without its secrets, which still identifies what was created.
+	Redact func(resp proto.Message) proto.Message
+	// Restore returns the full response from its redacted copy, with the credentials of the retry.
+	Restore func(ctx context.Context, redacted proto.Message) (proto.Message, error)
+}
+
+// Interceptor deduplicates retries of mutating RPCs. If a request to one of its methods has an idempotency
+// key, the response is stored in a JetStream key-value bucket and any later request from the same user with
+// the same key gets the stored response instead of running again. Only successful responses are stored, so
+// that failed requests can be retried. Keys expire after the dedupe window.
+type Interceptor struct {
+	kv      nats.KeyValue
+	methods map[string]bool
+	secrets map[string]SecretResponse
+}
+
+// NewInterceptor creates an Interceptor for the given full GRPC method names, such as
+// "/px.cloudapi.APIKeyManager/Create". Responses are kept for the given window.
+func NewInterceptor(js nats.JetStreamContext, window time.Duration, replicas int, methods ...string) (*Interceptor, error) {
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:      bucketName,
+		Description: "Responses of requests with idempotency keys",
+		TTL:         window,
+		Replicas:    replicas,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]bool)
+	for _, method := range methods {
+		m[method] = true
+	}
+	return &Interceptor{kv: kv, methods: m, secrets: make(map[string]SecretResponse)}, nil
+}
+
+// SetSecretResponse sets how the secrets in the responses of the method are kept out of the stored responses. It
+// must be called before the interceptor handles any requests.
+func (i *Interceptor) SetSecretResponse(method string, s SecretResponse) {
+	i.secrets[method] = s
+}
+
+func keyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	vals := md.Get(MetadataKey)
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+func hash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+		// Separate the parts, so that different splits of the same bytes hash differently.
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// UnaryServerInterceptor returns the GRPC interceptor. It must run after authentication, since keys
+// are scoped to the subject of the request's claims.
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !i.methods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		key := keyFromContext(ctx)
+		if key == "" {
+			return handler(ctx, req)
+		}
+		if len(key) > maxKeyLength {
+			return nil, status.Errorf(codes.InvalidArgument, "idempotency key must be at most %d characters", maxKeyLength)
+		}
+		reqMsg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+		sCtx, err := authcontext.FromContext(ctx)
+		if err != nil || sCtx.Claims == nil {
+			return handler(ctx, req)
+		}
+
+		reqBytes, err := proto.Marshal(reqMsg)
+		if err != nil {
+			return nil, err
+		}
+		storeKey := hash([]byte(info.FullMethod), []byte(sCtx.Claims.Subject), []byte(key))
+		reqHash := hash(reqBytes)
+
+		stored, rev, err := i.claim(storeKey, reqHash)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil {
+			log.WithField("method", info.FullMethod).Debug("Replaying response for idempotency key")
+			if secret, ok := i.secrets[info.FullMethod]; ok {
+				return secret.Restore(ctx, stored)
+			}
+			return stored, nil
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			// Release the key, so that the request can be retried.
+			if delErr := i.kv.Delete(storeKey, nats.LastRevision(rev)); delErr != nil {
+				log.WithError(delErr).Error("Failed to release idempotency key")
+			}
+			return nil, err
+		}
+		storedResp := resp
+		if secret, ok := i.secrets[info.FullMethod]; ok {
+			if respMsg, ok := resp.(proto.Message); ok {
+				storedResp = secret.Redact(respMsg)
+			}
+		}
+		if err := i.complete(storeKey, rev, reqHash, storedResp); err != nil {
+			// The request succeeded, so return its response even though a retry won't be deduplicated.
+			log.WithError(err).WithField("method", info.FullMethod).Error("Failed to store response for idempotency key")
+		}
+		return resp, nil
+	}
+}
+
+// claim claims the key for a new request, and returns the revision of the claim. If the key was already
+// used by a request that completed, its response is returned instead.
+func (i *Interceptor) claim(storeKey string, reqHash string) (proto.Message, uint64, error) {
+	pending, err := json.Marshal(&entry{RequestHash: reqHash, StartedAt: time.Now()})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		rev, err := i.kv.Create(storeKey, pending)
+		if err == nil {
+			return nil, rev, nil
+		}
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return nil, 0, status.Errorf(codes.Unavailable, "failed to check idempotency key: %v", err)
+		}
+
+		kve, err := i.kv.Get(storeKey)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			// The key was released or expired since we tried to create it.
+			continue
+		}
+		if err != nil {
+			return nil, 0, status.Errorf(codes.Unavailable, "failed to check idempotency key: %v", err)
+		}
+		var e entry
+		if err := json.Unmarshal(kve.Value(), &e); err != nil {
+			return nil, 0, err
+		}
+		if e.RequestHash != reqHash {
+			return nil, 0, status.Error(codes.InvalidArgument, "idempotency key was already used for a different request")
+		}
+		if e.Done {
+			resp, err := unmarshalResponse(e.Response)
+			return resp, 0, err
+		}
+		if time.Since(e.StartedAt) < pendingTimeout {
+			return nil, 0, status.Error(codes.Aborted, "a request with the same idempotency key is in progress")
+		}
+
+		// The request that claimed the key never completed, so this request takes over.
+		rev, err = i.kv.Update(storeKey, pending, kve.Revision())
+		if err == nil {
+			return nil, rev, nil
+		}
+	}
+	return nil, 0, status.Error(codes.Aborted, "a request with the same idempotency key is in progress")
+}
+
+func (i *Interceptor) complete(storeKey string, rev uint64, reqHash string, resp interface{}) error {
+	respMsg, ok := resp.(proto.Message)
+	if !ok {
+		return errors.New("response is not a proto message")
+	}
+	respAny, err := types.MarshalAny(respMsg)
+	if err != nil {
+		return err
+	}
+	anyBytes, err := respAny.Marshal()
+	if err != nil {
+		return err
+	}
+	done, err := json.Marshal(&entry{
+		RequestHash: reqHash,
+		StartedAt:   time.Now(),
+		Done:        true,
+		Response:    anyBytes,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = i.kv.Update(storeKey, done, rev)
+	return err
+}
+
+func unmarshalResponse(b []byte) (proto.Message, error) {
+	respAny := &types.Any{}
+	if err := respAny.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	var resp types.DynamicAny
+	if err := types.UnmarshalAny(respAny, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Message, nil
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/shared/idempotency"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/jwtpb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const createAPIKeyMethod = "/px.cloudapi.APIKeyManager/Create"
+
+func contextWithKey(subject string, key string) context.Context {
+	sCtx := authcontext.New()
+	sCtx.Claims = &jwtpb.JWTClaims{Subject: subject}
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+	if key == "" {
+		return ctx
+	}
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(idempotency.MetadataKey, key))
+}
+
+// fakeCreateHandler returns a new API key for each call, and fails the calls listed in failures.
+type fakeCreateHandler struct {
+	calls    int
+	failures map[int]bool
+}
+
+func (h *fakeCreateHandler) handle(ctx context.Context, req interface{}) (interface{}, error) {
+	h.calls++
+	if h.failures[h.calls] {
+		return nil, status.Error(codes.Unavailable, "failed")
+	}
+	return &cloudpb.APIKey{
+		Key:  string(rune('a' + h.calls - 1)),
+		Desc: req.(*cloudpb.CreateAPIKeyRequest).Desc,
+	}, nil
+}
+
+func setupInterceptor(t *testing.T) (grpc.UnaryServerInterceptor, func()) {
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+
+	i, err := idempotency.NewInterceptor(js, time.Hour, 1, createAPIKeyMethod)
+	require.NoError(t, err)
+	return i.UnaryServerInterceptor(), natsCleanup
+}
+
+func TestInterceptor_DeduplicatesRetries(t *testing.T) {
+	interceptor, cleanup := setupInterceptor(t)
+	defer cleanup()
+
+	h := &fakeCreateHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: createAPIKeyMethod}
+	req := &cloudpb.CreateAPIKeyRequest{Desc: "automation"}
+
+	resp1, err := interceptor(contextWithKey("user1", "key1"), req, info, h.handle)
+	require.NoError(t, err)
+	resp2, err := interceptor(contextWithKey("user1", "key1"), req, info, h.handle)
+	require.NoError(t, err)
+	assert.Equal(t, 1, h.calls)
+	assert.Equal(t, resp1, resp2)
+
+	// Other keys, other users and requests without a key all run the handler.
+	_, err = interceptor(contextWithKey("user1", "key2"), req, info, h.handle)
+	require.NoError(t, err)
+	_, err = interceptor(contextWithKey("user2", "key1"), req, info, h.handle)
+	require.NoError(t, err)
+	_, err = interceptor(contextWithKey("user1", ""), req, info, h.handle)
+	require.NoError(t, err)
+	assert.Equal(t, 4, h.calls)
+}
+
+func TestInterceptor_DifferentRequestSameKey(t *testing.T) {
+	interceptor, cleanup := setupInterceptor(t)
+	defer cleanup()
+
+	h := &fakeCreateHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: createAPIKeyMethod}
+
+	_, err := interceptor(contextWithKey("user1", "key1"), &cloudpb.CreateAPIKeyRequest{Desc: "a"}, info, h.handle)
+	require.NoError(t, err)
+	_, err = interceptor(contextWithKey("user1", "key1"), &cloudpb.CreateAPIKeyRequest{Desc: "b"}, info, h.handle)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 1, h.calls)
+}
+
+func TestInterceptor_FailedRequestsAreRetried(t *testing.T) {
+	interceptor, cleanup := setupInterceptor(t)
+	defer cleanup()
+
+	h := &fakeCreateHandler{failures: map[int]bool{1: true}}
+	info := &grpc.UnaryServerInfo{FullMethod: createAPIKeyMethod}
+	req := &cloudpb.CreateAPIKeyRequest{Desc: "automation"}
+
+	_, err := interceptor(contextWithKey("user1", "key1"), req, info, h.handle)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	resp, err := interceptor(contextWithKey("user1", "key1"), req, info, h.handle)
+	require.NoError(t, err)
+	assert.Equal(t, "b", resp.(*cloudpb.APIKey).Key)
+
+	resp, err = interceptor(contextWithKey("user1", "key1"), req, info, h.handle)
+	require.NoError(t, err)
+	assert.Equal(t, "b", resp.(*cloudpb.APIKey).Key)
+	assert.Equal(t, 2, h.calls)
+}
+
+func TestInterceptor_ConcurrentRequest(t *testing.T) {
+	interceptor, cleanup := setupInterceptor(t)
+	defer cleanup()
+
+	info := &grpc.UnaryServerInfo{FullMethod: createAPIKeyMethod}
+	req := &cloudpb.CreateAPIKeyRequest{Desc: "automation"}
+
+	// While the first request is running, a retry with the same key is rejected.
+	var retryErr error
+	_, err := interceptor(contextWithKey("user1", "key1"), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, retryErr = interceptor(contextWithKey("user1", "key1"), req, info, func(context.Context, interface{}) (interface{}, error) {
+			return nil, errors.New("should not run")
+		})
+		return &cloudpb.APIKey{Key: "a"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, codes.Aborted, status.Code(retryErr))
+}
+
+func TestInterceptor_IgnoresOtherMethods(t *testing.T) {
+	interceptor, cleanup := setupInterceptor(t)
+	defer cleanup()
+
+	h := &fakeCreateHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/px.cloudapi.APIKeyManager/Get"}
+	req := &cloudpb.CreateAPIKeyRequest{Desc: "automation"}
+
+	_, err := interceptor(contextWithKey("user1", "key1"), req, info, h.handle)
+	require.NoError(t, err)
+	_, err = interceptor(contextWithKey("user1", "key1"), req, info, h.handle)
+	require.NoError(t, err)
+	assert.Equal(t, 2, h.calls)
+}
+
+func TestInterceptor_SecretResponse(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+	i, err := idempotency.NewInterceptor(js, time.Hour, 1, createAPIKeyMethod)
+	require.NoError(t, err)
+
+	keyID := utils.ProtoFromUUIDStrOrNil("8ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	restores := 0
+	i.SetSecretResponse(createAPIKeyMethod, idempotency.SecretResponse{
+		Redact: func(resp proto.Message) proto.Message {
+			redacted := *resp.(*cloudpb.APIKey)
+			redacted.Key = ""
+			return &redacted
+		},
+		Restore: func(ctx context.Context, redacted proto.Message) (proto.Message, error) {
+			restores++
+			key := *redacted.(*cloudpb.APIKey)
+			assert.Equal(t, keyID, key.ID)
+			key.Key = "secret-value"
+			return &key, nil
+		},
+	})
+	interceptor := i.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: createAPIKeyMethod}
+	req := &cloudpb.CreateAPIKeyRequest{Desc: "automation"}
+	handle := func(context.Context, interface{}) (interface{}, error) {
+		return &cloudpb.APIKey{ID: keyID, Key: "secret-value", Desc: "automation"}, nil
+	}
+
+	resp1, err := interceptor(contextWithKey("user1", "key1"), req, info, handle)
+	require.NoError(t, err)
+	resp2, err := interceptor(contextWithKey("user1", "key1"), req, info, handle)
+	require.NoError(t, err)
+	assert.Equal(t, resp1, resp2)
+	assert.Equal(t, 1, restores)
+
+	// The stored response identifies the key, without its value.
+	kv, err := js.KeyValue("IdempotencyKeys")
+	require.NoError(t, err)
+	keys, err := kv.Keys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	kve, err := kv.Get(keys[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(kve.Value()), "secret-value")
+}
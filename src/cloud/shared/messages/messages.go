@@ -18,8 +18,23 @@
 
 package messages
 
+import (
+	"fmt"
+
+	"github.com/gofrs/uuid"
+)
+
 // This file contains the NATS channels used in Pixie Cloud.
 
 // VizierConnectedChannel is the channel to listen to be notified of Viziers connecting.
 // The message passed along this channel is of type px.cloud.messages.VizierConnected.
 const VizierConnectedChannel = "VizierConnected"
+
+// ScriptExecutionChannel is the prefix of the channels that the API service publishes the start and end of
+// script executions on. The message passed along these channels is of type px.cloud.messages.ScriptExecution.
+const ScriptExecutionChannel = "ScriptExecution"
+
+// ScriptExecutionTopic returns the channel of the script executions of the given org.
+func ScriptExecutionTopic(orgID uuid.UUID) string {
+	return fmt.Sprintf("%s.%s", ScriptExecutionChannel, orgID.String())
+}
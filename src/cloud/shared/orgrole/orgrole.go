@@ -0,0 +1,311 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package orgrole
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"px.dev/pixie/src/cloud/shared/patscope"
+)
+
+const (
+	// Admin allows everything, including managing the org, its users and their roles.
+	Admin = "admin"
+	// Editor allows everything but managing the org, including deploying Viziers and running scripts that
+	// mutate the clusters.
+	Editor = "editor"
+	// Viewer allows reading from the Pixie Cloud API and running scripts that don't mutate the clusters.
+	Viewer = "viewer"
+
+	// TokenScope is added to the scopes of the JWTs issued for the users of orgs, so that their roles are
+	// enforced. Tokens without it, such as service tokens, aren't restricted by roles.
+	TokenScope = "roles"
+	// scopePrefix is the prefix of the JWT scopes that hold the roles of the user.
+	scopePrefix = "role:"
+	// clusterInfix separates the role from the cluster in the scopes of cluster-scoped roles.
+	clusterInfix = ":cluster:"
+)
+
+// Roles are all the roles that users can have, from the most to the least privileged.
+var Roles = []string{Admin, Editor, Viewer}
+
+// vizierServicePrefix is the prefix of the methods that are passed through to Vizier.
+const vizierServicePrefix = "/px.api.vizierpb."
+
+// adminServicePrefixes are the prefixes of the Pixie Cloud API services that manage the org. Only admins
+// may call the methods in them that aren't reads.
+var adminServicePrefixes = []string{
+	"/px.cloudapi.OrganizationService/",
+}
+
+// adminMethods are the Pixie Cloud API methods outside of the admin services that only admins may call.
+var adminMethods = []string{
+	"/px.cloudapi.UserService/UpdateUser",
+}
+
+// credentialServicePrefixes are the prefixes of the Pixie Cloud API services that return credentials. The
+// credentials act with the privileges of the user that owns them, so only admins may call any of the methods
+// in them.
+var credentialServicePrefixes = []string{
+	"/px.cloudapi.APIKeyManager/",
+	"/px.cloudapi.VizierDeploymentKeyManager/",
+}
+
+// credentialMethods are the Pixie Cloud API methods outside of the credential services that return
+// credentials, which only admins may call.
+var credentialMethods = []string{
+	// Returns a token with full access to the cluster.
+	"/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+}
+
+// selfServiceMethods are the Pixie Cloud API methods that only change the caller's own data, which all
+// roles may call.
+var selfServiceMethods = []string{
+	"/px.cloudapi.OrganizationService/CreateOrg",
+	"/px.cloudapi.UserService/UpdateUserSettings",
+	"/px.cloudapi.UserService/SetUserAttributes",
+	"/px.cloudapi.UserService/DeleteUser",
+	"/px.cloudapi.PersonalAccessTokenManager/Create",
+	"/px.cloudapi.PersonalAccessTokenManager/Delete",
+}
+
+// Validate checks that the role is known.
+func Validate(role string) error {
+	if rank(role) < 0 {
+		return fmt.Errorf("invalid role %q, valid roles are: %s", role, strings.Join(Roles, ", "))
+	}
+	return nil
+}
+
+// OrgScope returns the JWT scope of a role in the whole org.
+func OrgScope(role string) string {
+	return scopePrefix + role
+}
+
+// ClusterScope returns the JWT scope of a role that only applies to the cluster.
+func ClusterScope(role string, clusterID uuid.UUID) string {
+	return scopePrefix + role + clusterInfix + clusterID.String()
+}
+
+// Binding is a role of a user, either in the whole org or, if ClusterID is set, scoped to the cluster.
+type Binding struct {
+	Role      string
+	ClusterID uuid.UUID
+}
+
+// TokenScopes returns the JWT scopes that enforce the roles of a user.
+func TokenScopes(bindings []Binding) []string {
+	scopes := []string{TokenScope}
+	for _, b := range bindings {
+		if b.ClusterID == uuid.Nil {
+			scopes = append(scopes, OrgScope(b.Role))
+		} else {
+			scopes = append(scopes, ClusterScope(b.Role, b.ClusterID))
+		}
+	}
+	return scopes
+}
+
+// WithoutRoleScopes returns the JWT scopes without any of the scopes that hold roles, so that the roles
+// can be replaced with the current ones.
+func WithoutRoleScopes(jwtScopes []string) []string {
+	scopes := make([]string, 0, len(jwtScopes))
+	for _, s := range jwtScopes {
+		if s == TokenScope || strings.HasPrefix(s, scopePrefix) {
+			continue
+		}
+		scopes = append(scopes, s)
+	}
+	return scopes
+}
+
+// IsRoleScoped returns whether the JWT with the given scopes is restricted by the roles of its user.
+func IsRoleScoped(jwtScopes []string) bool {
+	for _, s := range jwtScopes {
+		if s == TokenScope {
+			return true
+		}
+	}
+	return false
+}
+
+// OrgRole returns the role of the user in the whole org. Users that only have cluster-scoped roles are
+// viewers of the rest of the org. Tokens that aren't restricted by roles act as admins.
+func OrgRole(jwtScopes []string) string {
+	if !IsRoleScoped(jwtScopes) {
+		return Admin
+	}
+	role := ""
+	for _, s := range jwtScopes {
+		r, clusterID, ok := parseScope(s)
+		if !ok {
+			continue
+		}
+		if clusterID != uuid.Nil {
+			r = Viewer
+		}
+		if rank(r) > rank(role) {
+			role = r
+		}
+	}
+	return role
+}
+
+// ClusterRole returns the role of the user for the cluster, which is the more privileged of their role
+// in the org and their role scoped to the cluster.
+func ClusterRole(jwtScopes []string, clusterID uuid.UUID) string {
+	if !IsRoleScoped(jwtScopes) {
+		return Admin
+	}
+	role := ""
+	for _, s := range jwtScopes {
+		r, scopeClusterID, ok := parseScope(s)
+		if !ok || (scopeClusterID != uuid.Nil && scopeClusterID != clusterID) {
+			continue
+		}
+		if rank(r) > rank(role) {
+			role = r
+		}
+	}
+	return role
+}
+
+// IsAdmin returns whether the JWT with the given scopes may manage the org.
+func IsAdmin(jwtScopes []string) bool {
+	return OrgRole(jwtScopes) == Admin
+}
+
+// Allows returns whether the roles in the JWT with the given scopes allow the call. path is the full name
+// of the gRPC method, or the path of the HTTP request. HTTP endpoints, such as GraphQL, check the roles for
+// each of the operations that they serve.
+func Allows(jwtScopes []string, path string) bool {
+	if !IsRoleScoped(jwtScopes) {
+		return true
+	}
+	if !isGRPCMethod(path) {
+		return true
+	}
+	role := OrgRole(jwtScopes)
+	switch {
+	case rank(role) < 0:
+		return false
+	case role == Admin:
+		return true
+	case isCredentialMethod(path):
+		return false
+	case strings.HasPrefix(path, vizierServicePrefix):
+		// Scripts are checked against the role for the cluster that they run on, once it is known.
+		return true
+	case patscope.IsReadMethod(path) || contains(selfServiceMethods, path):
+		return true
+	case role == Viewer:
+		return false
+	}
+	if contains(adminMethods, path) {
+		return false
+	}
+	for _, prefix := range adminServicePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsCluster returns whether the user may access the cluster. Users that have a role in the whole org
+// may access all of its clusters, while users that only have cluster-scoped roles may only access those
+// clusters.
+func AllowsCluster(jwtScopes []string, clusterID uuid.UUID) bool {
+	if !IsRoleScoped(jwtScopes) {
+		return true
+	}
+	for _, s := range jwtScopes {
+		_, scopeClusterID, ok := parseScope(s)
+		if ok && (scopeClusterID == uuid.Nil || scopeClusterID == clusterID) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsMutation returns whether the user may run scripts that mutate the cluster.
+func AllowsMutation(jwtScopes []string, clusterID uuid.UUID) bool {
+	return rank(ClusterRole(jwtScopes, clusterID)) >= rank(Editor)
+}
+
+// parseScope returns the role in the JWT scope, and the cluster that it's scoped to, if any.
+func parseScope(s string) (string, uuid.UUID, bool) {
+	if !strings.HasPrefix(s, scopePrefix) {
+		return "", uuid.Nil, false
+	}
+	role := strings.TrimPrefix(s, scopePrefix)
+	clusterID := uuid.Nil
+	if i := strings.Index(role, clusterInfix); i >= 0 {
+		var err error
+		if clusterID, err = uuid.FromString(role[i+len(clusterInfix):]); err != nil || clusterID == uuid.Nil {
+			return "", uuid.Nil, false
+		}
+		role = role[:i]
+	}
+	if rank(role) < 0 {
+		return "", uuid.Nil, false
+	}
+	return role, clusterID, true
+}
+
+// rank orders the roles by privilege, and is -1 for unknown roles.
+func rank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return len(Roles) - 1 - i
+		}
+	}
+	return -1
+}
+
+// isGRPCMethod returns whether path is the full name of a gRPC method, rather than the path of an HTTP
+// request.
+func isGRPCMethod(path string) bool {
+	parts := strings.Split(path, "/")
+	return len(parts) == 3 && parts[0] == "" && strings.Contains(parts[1], ".")
+}
+
+// isCredentialMethod returns whether the method returns credentials.
+func isCredentialMethod(path string) bool {
+	if contains(credentialMethods, path) {
+		return true
+	}
+	for _, prefix := range credentialServicePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
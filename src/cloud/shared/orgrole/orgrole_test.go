@@ -0,0 +1,205 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package orgrole_test
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"px.dev/pixie/src/cloud/shared/orgrole"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, orgrole.Validate(orgrole.Viewer))
+	assert.Error(t, orgrole.Validate(""))
+	assert.Error(t, orgrole.Validate("owner"))
+}
+
+func TestOrgRole(t *testing.T) {
+	clusterID := uuid.Must(uuid.NewV4())
+	assert.Equal(t, orgrole.Admin, orgrole.OrgRole(nil))
+	assert.Equal(t, orgrole.Editor, orgrole.OrgRole(orgrole.TokenScopes([]orgrole.Binding{
+		{Role: orgrole.Viewer}, {Role: orgrole.Editor},
+	})))
+	assert.Equal(t, orgrole.Viewer, orgrole.OrgRole(orgrole.TokenScopes([]orgrole.Binding{
+		{Role: orgrole.Admin, ClusterID: clusterID},
+	})))
+	assert.Equal(t, "", orgrole.OrgRole(orgrole.TokenScopes(nil)))
+}
+
+func TestWithoutRoleScopes(t *testing.T) {
+	scopes := append([]string{"pat"}, orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Admin}})...)
+	assert.Equal(t, []string{"pat"}, orgrole.WithoutRoleScopes(scopes))
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		path    string
+		allowed bool
+	}{
+		{
+			name:    "viewer read",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterInfo",
+			allowed: true,
+		},
+		{
+			name:    "viewer script",
+			role:    orgrole.Viewer,
+			path:    "/px.api.vizierpb.VizierService/ExecuteScript",
+			allowed: true,
+		},
+		{
+			name:    "viewer own settings",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.UserService/UpdateUserSettings",
+			allowed: true,
+		},
+		{
+			name:    "viewer write",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.VizierDeploymentKeyManager/Create",
+			allowed: false,
+		},
+		{
+			name:    "viewer get API key",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.APIKeyManager/Get",
+			allowed: false,
+		},
+		{
+			name:    "viewer list API keys",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.APIKeyManager/List",
+			allowed: false,
+		},
+		{
+			name:    "viewer get deployment key",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.VizierDeploymentKeyManager/Get",
+			allowed: false,
+		},
+		{
+			name:    "viewer list deployment keys",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.VizierDeploymentKeyManager/List",
+			allowed: false,
+		},
+		{
+			name:    "viewer cluster connection info",
+			role:    orgrole.Viewer,
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+			allowed: false,
+		},
+		{
+			name:    "editor write",
+			role:    orgrole.Editor,
+			path:    "/px.cloudapi.VizierClusterInfo/UpdateOrInstallCluster",
+			allowed: true,
+		},
+		{
+			name:    "editor create API key",
+			role:    orgrole.Editor,
+			path:    "/px.cloudapi.APIKeyManager/Create",
+			allowed: false,
+		},
+		{
+			name:    "admin cluster connection info",
+			role:    orgrole.Admin,
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+			allowed: true,
+		},
+		{
+			name:    "editor org management",
+			role:    orgrole.Editor,
+			path:    "/px.cloudapi.OrganizationService/InviteUser",
+			allowed: false,
+		},
+		{
+			name:    "editor user permissions",
+			role:    orgrole.Editor,
+			path:    "/px.cloudapi.UserService/UpdateUser",
+			allowed: false,
+		},
+		{
+			name:    "editor org read",
+			role:    orgrole.Editor,
+			path:    "/px.cloudapi.OrganizationService/GetUsersInOrg",
+			allowed: true,
+		},
+		{
+			name:    "admin org management",
+			role:    orgrole.Admin,
+			path:    "/px.cloudapi.OrganizationService/InviteUser",
+			allowed: true,
+		},
+		{
+			name:    "viewer http",
+			role:    orgrole.Viewer,
+			path:    "/api/graphql",
+			allowed: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scopes := orgrole.TokenScopes([]orgrole.Binding{{Role: test.role}})
+			assert.Equal(t, test.allowed, orgrole.Allows(scopes, test.path))
+		})
+	}
+}
+
+func TestAllows_Unscoped(t *testing.T) {
+	assert.True(t, orgrole.Allows(nil, "/px.cloudapi.OrganizationService/InviteUser"))
+	assert.False(t, orgrole.Allows(orgrole.TokenScopes(nil), "/px.cloudapi.VizierClusterInfo/GetClusterInfo"))
+}
+
+func TestAllowsCluster(t *testing.T) {
+	clusterID := uuid.Must(uuid.NewV4())
+	otherClusterID := uuid.Must(uuid.NewV4())
+
+	assert.True(t, orgrole.AllowsCluster(nil, clusterID))
+
+	orgScopes := orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Viewer}})
+	assert.True(t, orgrole.AllowsCluster(orgScopes, otherClusterID))
+
+	clusterScopes := orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Editor, ClusterID: clusterID}})
+	assert.True(t, orgrole.AllowsCluster(clusterScopes, clusterID))
+	assert.False(t, orgrole.AllowsCluster(clusterScopes, otherClusterID))
+}
+
+func TestAllowsMutation(t *testing.T) {
+	clusterID := uuid.Must(uuid.NewV4())
+	otherClusterID := uuid.Must(uuid.NewV4())
+
+	assert.True(t, orgrole.AllowsMutation(nil, clusterID))
+
+	scopes := orgrole.TokenScopes([]orgrole.Binding{
+		{Role: orgrole.Viewer},
+		{Role: orgrole.Editor, ClusterID: clusterID},
+	})
+	assert.True(t, orgrole.AllowsMutation(scopes, clusterID))
+	assert.False(t, orgrole.AllowsMutation(scopes, otherClusterID))
+
+	editorScopes := orgrole.TokenScopes([]orgrole.Binding{{Role: orgrole.Editor}})
+	assert.True(t, orgrole.AllowsMutation(editorScopes, otherClusterID))
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package patscope
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// CloudRead allows the calls that only read from the Pixie Cloud API.
+	CloudRead = "cloud:read"
+	// CloudWrite allows all calls to the Pixie Cloud API.
+	CloudWrite = "cloud:write"
+	// VizierExec allows running scripts on the Viziers of the org through Pixie Cloud.
+	VizierExec = "vizier:exec"
+
+	// TokenScope is added to the scopes of the JWTs issued for personal access tokens, so that the
+	// scopes of the token are enforced.
+	TokenScope = "pat"
+)
+
+// Scopes are all the scopes that personal access tokens can have.
+var Scopes = []string{CloudRead, CloudWrite, VizierExec}
+
+// vizierServicePrefix is the prefix of the methods that are passed through to Vizier.
+const vizierServicePrefix = "/px.api.vizierpb."
+
+// vizierExecMethods are the Pixie Cloud API methods that give direct access to the Viziers, so they need the
+// same scope as the calls that are passed through to them.
+var vizierExecMethods = []string{
+	"/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+}
+
+// readMethodPrefixes are the prefixes of the names of the Pixie Cloud API methods that don't modify anything.
+var readMethodPrefixes = []string{"Get", "List", "Lookup", "Search", "Verify"}
+
+// Validate checks that the scopes are known and that there is at least one of them.
+func Validate(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required, valid scopes are: %s", strings.Join(Scopes, ", "))
+	}
+	for _, s := range scopes {
+		if !contains(Scopes, s) {
+			return fmt.Errorf("invalid scope %q, valid scopes are: %s", s, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// IsPersonalAccessToken returns whether the JWT with the given scopes was issued for a personal access token.
+func IsPersonalAccessToken(jwtScopes []string) bool {
+	return contains(jwtScopes, TokenScope)
+}
+
+// Allows returns whether a token with the given scopes may make the call. path is the full name of
+// the gRPC method, or the path of the HTTP request.
+func Allows(jwtScopes []string, path string) bool {
+	if strings.HasPrefix(path, vizierServicePrefix) || contains(vizierExecMethods, path) {
+		return contains(jwtScopes, VizierExec)
+	}
+	if contains(jwtScopes, CloudWrite) {
+		return true
+	}
+	return contains(jwtScopes, CloudRead) && IsReadMethod(path)
+}
+
+// IsReadMethod returns whether path is a gRPC method that only reads. HTTP endpoints, such as
+// GraphQL, may write and are never considered reads.
+func IsReadMethod(path string) bool {
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[0] != "" || !strings.Contains(parts[1], ".") {
+		return false
+	}
+	for _, prefix := range readMethodPrefixes {
+		if strings.HasPrefix(parts[2], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
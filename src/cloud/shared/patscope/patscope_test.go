@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package patscope_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"px.dev/pixie/src/cloud/shared/patscope"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, patscope.Validate([]string{patscope.CloudRead}))
+	assert.NoError(t, patscope.Validate([]string{patscope.CloudWrite, patscope.VizierExec}))
+	assert.Error(t, patscope.Validate(nil))
+	assert.Error(t, patscope.Validate([]string{patscope.CloudRead, "admin"}))
+	assert.Error(t, patscope.Validate([]string{patscope.TokenScope}))
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		path    string
+		allowed bool
+	}{
+		{
+			name:    "read method with read scope",
+			scopes:  []string{patscope.CloudRead},
+			path:    "/px.cloudapi.OrganizationService/GetOrg",
+			allowed: true,
+		},
+		{
+			name:    "write method with read scope",
+			scopes:  []string{patscope.CloudRead},
+			path:    "/px.cloudapi.OrganizationService/UpdateOrg",
+			allowed: false,
+		},
+		{
+			name:    "write method with write scope",
+			scopes:  []string{patscope.CloudWrite},
+			path:    "/px.cloudapi.OrganizationService/UpdateOrg",
+			allowed: true,
+		},
+		{
+			name:    "graphql with read scope",
+			scopes:  []string{patscope.CloudRead},
+			path:    "/api/graphql",
+			allowed: false,
+		},
+		{
+			name:    "graphql with write scope",
+			scopes:  []string{patscope.CloudWrite},
+			path:    "/api/graphql",
+			allowed: true,
+		},
+		{
+			name:    "vizier with write scope",
+			scopes:  []string{patscope.CloudWrite},
+			path:    "/px.api.vizierpb.VizierService/ExecuteScript",
+			allowed: false,
+		},
+		{
+			name:    "vizier with exec scope",
+			scopes:  []string{patscope.VizierExec},
+			path:    "/px.api.vizierpb.VizierService/ExecuteScript",
+			allowed: true,
+		},
+		{
+			name:    "cloud with exec scope",
+			scopes:  []string{patscope.VizierExec},
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterInfo",
+			allowed: false,
+		},
+		{
+			name:    "cluster connection info with write scope",
+			scopes:  []string{patscope.CloudRead, patscope.CloudWrite},
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+			allowed: false,
+		},
+		{
+			name:    "cluster connection info with exec scope",
+			scopes:  []string{patscope.VizierExec},
+			path:    "/px.cloudapi.VizierClusterInfo/GetClusterConnectionInfo",
+			allowed: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scopes := append([]string{"user", patscope.TokenScope}, test.scopes...)
+			assert.Equal(t, test.allowed, patscope.Allows(scopes, test.path))
+		})
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package regions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	// healthCheckInterval is how often the health of the other regions is checked.
+	healthCheckInterval = 15 * time.Second
+	// healthCheckTimeout is how long a region has to answer a health check.
+	healthCheckTimeout = 5 * time.Second
+	// unhealthyThreshold is the number of consecutive failed health checks after which a region is considered
+	// unhealthy, so that a single slow response doesn't move viziers away from it.
+	unhealthyThreshold = 3
+)
+
+// SetupFlags installs the flag handlers for multi-region deployments.
+func SetupFlags() {
+	pflag.String("cloud_region", "", "The name of the cloud region this service is deployed in, one of --cloud_regions")
+	pflag.String("cloud_regions", "", "The regions that Pixie Cloud is deployed in, as a JSON list. Viziers are steered to the nearest healthy region. If empty, viziers stay in the region they connect to")
+}
+
+// Region is a region that Pixie Cloud is deployed in.
+type Region struct {
+	// Name is the name of the region, for example "us-west".
+	Name string `json:"name"`
+	// VZConnAddr is the address that viziers connect to the vzconn service of the region on.
+	VZConnAddr string `json:"vzconnAddr"`
+	// HealthCheckURL is polled to check that the region is healthy. If empty, the region is always considered
+	// healthy.
+	HealthCheckURL string `json:"healthCheckURL,omitempty"`
+	// Locations are the locations of the clusters which are nearest to this region, as the cloud provider regions
+	// that the clusters run in. A location ending with "*" matches every cloud provider region with that prefix,
+	// for example "europe-*".
+	Locations []string `json:"locations,omitempty"`
+}
+
+// ParseRegions parses a JSON list of regions.
+func ParseRegions(s string) ([]*Region, error) {
+	var regions []*Region
+	if err := json.Unmarshal([]byte(s), &regions); err != nil {
+		return nil, fmt.Errorf("invalid cloud regions: %w", err)
+	}
+	return regions, nil
+}
+
+// matchScore returns how closely the pattern matches the location, or -1 if it doesn't. Exact matches score
+// higher than any prefix, and longer prefixes score higher than shorter ones.
+func matchScore(pattern string, location string) int {
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+		if strings.HasPrefix(location, prefix) {
+			return len(prefix)
+		}
+		return -1
+	}
+	if pattern == location {
+		return len(location) + 1
+	}
+	return -1
+}
+
+// Router steers viziers to the nearest healthy region. It periodically checks the health of the other regions,
+// so that viziers fail over to another region when their nearest one goes down.
+type Router struct {
+	regions []*Region
+	local   *Region
+	client  *http.Client
+
+	quitCh chan struct{}
+	once   sync.Once
+
+	mu       sync.RWMutex
+	failures map[string]int
+}
+
+// NewRouter creates a router between the given regions, for a service deployed in the local region.
+func NewRouter(regions []*Region, localRegion string) (*Router, error) {
+	if len(regions) == 0 {
+		return nil, errors.New("no cloud regions")
+	}
+	r := &Router{
+		regions:  regions,
+		client:   &http.Client{Timeout: healthCheckTimeout},
+		quitCh:   make(chan struct{}),
+		failures: make(map[string]int),
+	}
+	names := make(map[string]bool)
+	for _, region := range regions {
+		if region.Name == "" || region.VZConnAddr == "" {
+			return nil, errors.New("cloud regions must have a name and a vzconn address")
+		}
+		if names[region.Name] {
+			return nil, fmt.Errorf("duplicate cloud region %q", region.Name)
+		}
+		names[region.Name] = true
+		if region.Name == localRegion {
+			r.local = region
+		}
+	}
+	if r.local == nil {
+		return nil, fmt.Errorf("the local cloud region %q is not one of the cloud regions", localRegion)
+	}
+	return r, nil
+}
+
+// NewRouterFromFlags creates a router from the --cloud_regions and --cloud_region flags. It returns nil if no
+// regions are configured, in which case viziers are not steered.
+func NewRouterFromFlags() (*Router, error) {
+	s := viper.GetString("cloud_regions")
+	if s == "" {
+		return nil, nil
+	}
+	regions, err := ParseRegions(s)
+	if err != nil {
+		return nil, err
+	}
+	return NewRouter(regions, viper.GetString("cloud_region"))
+}
+
+// Local returns the region that the service is deployed in.
+func (r *Router) Local() *Region {
+	return r.local
+}
+
+// Healthy returns whether the region is healthy. The local region is always considered healthy, since it is
+// the one serving the request.
+func (r *Router) Healthy(region *Region) bool {
+	if region == r.local {
+		return true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.failures[region.Name] < unhealthyThreshold
+}
+
+// Route returns the region that a vizier whose cluster runs in the given location should connect to: the
+// healthy region whose locations match it most closely, or the first healthy region that matches equally well.
+// Viziers which don't report their location, or that no healthy region matches, stay in the local region.
+func (r *Router) Route(location string) *Region {
+	location = strings.ToLower(strings.TrimSpace(location))
+	if location == "" {
+		return r.local
+	}
+
+	var best *Region
+	bestScore := -1
+	for _, region := range r.regions {
+		score := -1
+		for _, pattern := range region.Locations {
+			if s := matchScore(strings.ToLower(pattern), location); s > score {
+				score = s
+			}
+		}
+		// The local region wins ties, so that viziers don't move between equally near regions.
+		if score > bestScore || (score == bestScore && score >= 0 && region == r.local) {
+			if r.Healthy(region) {
+				best = region
+				bestScore = score
+			}
+		}
+	}
+	if best == nil {
+		return r.local
+	}
+	return best
+}
+
+// Start periodically checks the health of the other regions.
+func (r *Router) Start() {
+	go func() {
+		t := time.NewTicker(healthCheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-r.quitCh:
+				return
+			case <-t.C:
+				r.checkHealth()
+			}
+		}
+	}()
+}
+
+func (r *Router) checkHealth() {
+	for _, region := range r.regions {
+		if region == r.local || region.HealthCheckURL == "" {
+			continue
+		}
+		err := r.probe(region.HealthCheckURL)
+
+		r.mu.Lock()
+		wasHealthy := r.failures[region.Name] < unhealthyThreshold
+		if err != nil {
+			r.failures[region.Name]++
+		} else {
+			r.failures[region.Name] = 0
+		}
+		healthy := r.failures[region.Name] < unhealthyThreshold
+		r.mu.Unlock()
+
+		if wasHealthy && !healthy {
+			log.WithError(err).WithField("region", region.Name).Warn("Cloud region is unhealthy, viziers will fail over")
+		} else if !wasHealthy && healthy {
+			log.WithField("region", region.Name).Info("Cloud region is healthy again")
+		}
+	}
+}
+
+func (r *Router) probe(url string) error {
+	resp, err := r.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Stop stops checking the health of the regions.
+func (r *Router) Stop() {
+	r.once.Do(func() {
+		close(r.quitCh)
+	})
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package regions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRegions(healthCheckURL string) []*Region {
+	return []*Region{
+		{Name: "us-west", VZConnAddr: "vzconn.us-west.example.com:443", Locations: []string{"us-west*", "us-*", "northamerica-*"}},
+		{Name: "us-east", VZConnAddr: "vzconn.us-east.example.com:443", Locations: []string{"us-east*", "us-*"}},
+		{Name: "eu", VZConnAddr: "vzconn.eu.example.com:443", HealthCheckURL: healthCheckURL, Locations: []string{"eu-*", "europe-*"}},
+	}
+}
+
+func TestParseRegions(t *testing.T) {
+	regions, err := ParseRegions(`[{"name": "eu", "vzconnAddr": "vzconn.eu.example.com:443", "locations": ["europe-*"]}]`)
+	require.NoError(t, err)
+	assert.Equal(t, []*Region{{Name: "eu", VZConnAddr: "vzconn.eu.example.com:443", Locations: []string{"europe-*"}}}, regions)
+
+	_, err = ParseRegions(`{"name": "eu"}`)
+	assert.Error(t, err)
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	_, err := NewRouter(testRegions(""), "apac")
+	assert.Error(t, err)
+
+	_, err = NewRouter([]*Region{{Name: "eu"}}, "eu")
+	assert.Error(t, err)
+
+	_, err = NewRouter([]*Region{{Name: "eu", VZConnAddr: "a:443"}, {Name: "eu", VZConnAddr: "b:443"}}, "eu")
+	assert.Error(t, err)
+}
+
+func TestRouter_Route(t *testing.T) {
+	r, err := NewRouter(testRegions(""), "us-east")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		location string
+		expected string
+	}{
+		{"no location", "", "us-east"},
+		{"unknown location", "asia-east1", "us-east"},
+		{"most specific prefix", "us-west1", "us-west"},
+		{"local region wins ties", "us-central1", "us-east"},
+		{"case insensitive", "Europe-West1", "eu"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, r.Route(test.location).Name)
+		})
+	}
+}
+
+func TestRouter_FailsOverUnhealthyRegion(t *testing.T) {
+	healthy := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	r, err := NewRouter(testRegions(srv.URL), "us-west")
+	require.NoError(t, err)
+	defer r.Stop()
+
+	r.checkHealth()
+	assert.Equal(t, "eu", r.Route("europe-west1").Name)
+
+	// A single failed health check doesn't move the viziers.
+	healthy = false
+	r.checkHealth()
+	assert.Equal(t, "eu", r.Route("europe-west1").Name)
+
+	for i := 1; i < unhealthyThreshold; i++ {
+		r.checkHealth()
+	}
+	assert.Equal(t, "us-west", r.Route("europe-west1").Name)
+
+	healthy = true
+	r.checkHealth()
+	assert.Equal(t, "eu", r.Route("europe-west1").Name)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package residency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	// RegionEU restricts processing and storage of an org's data to components deployed in the EU.
+	RegionEU = "eu"
+	// RegionUS restricts processing and storage of an org's data to components deployed in the US.
+	RegionUS = "us"
+)
+
+// ErrRegionNotPermitted is returned when a component is not allowed to handle data for an org.
+var ErrRegionNotPermitted = errors.New("component region is not permitted by the org's data residency policy")
+
+// ValidateRegion checks that the given region is either empty (unrestricted) or a known region.
+func ValidateRegion(region string) error {
+	switch NormalizeRegion(region) {
+	case "", RegionEU, RegionUS:
+		return nil
+	}
+	return fmt.Errorf("unknown data residency region %q, must be one of %q, %q", region, RegionEU, RegionUS)
+}
+
+// NormalizeRegion lowercases and trims the region so that it can be compared.
+func NormalizeRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
+
+// Permitted returns whether a component deployed in componentRegion may process or store data for an org
+// with the given residency requirement. Orgs without a requirement are permitted everywhere, while
+// restricted orgs are never permitted on components that don't declare their region.
+func Permitted(orgResidency string, componentRegion string) bool {
+	orgResidency = NormalizeRegion(orgResidency)
+	if orgResidency == "" {
+		return true
+	}
+	return orgResidency == NormalizeRegion(componentRegion)
+}
+
+// OrgGetter fetches org info. This is satisfied by profilepb.OrgServiceClient.
+type OrgGetter interface {
+	GetOrg(ctx context.Context, in *uuidpb.UUID, opts ...grpc.CallOption) (*profilepb.OrgInfo, error)
+}
+
+// Enforcer checks the data residency policy of orgs against the region of the component it runs in and
+// writes an audit log entry for every decision made on a restricted org.
+type Enforcer struct {
+	orgGetter OrgGetter
+	component string
+	region    string
+}
+
+// NewEnforcer creates a new Enforcer for the named component deployed in the given region.
+func NewEnforcer(orgGetter OrgGetter, component string, region string) (*Enforcer, error) {
+	if err := ValidateRegion(region); err != nil {
+		return nil, err
+	}
+	return &Enforcer{
+		orgGetter: orgGetter,
+		component: component,
+		region:    NormalizeRegion(region),
+	}, nil
+}
+
+// Check returns ErrRegionNotPermitted if the org's data may not be handled by this component. The path
+// describes the data flow being checked (for example "bridge" or "retention_export") and is included in
+// the audit log.
+func (e *Enforcer) Check(ctx context.Context, orgID uuid.UUID, path string) error {
+	org, err := e.orgGetter.GetOrg(ctx, utils.ProtoFromUUID(orgID))
+	if err != nil {
+		return err
+	}
+	if org.DataResidency == "" {
+		return nil
+	}
+
+	permitted := Permitted(org.DataResidency, e.region)
+	entry := log.WithFields(log.Fields{
+		"audit":          "data_residency",
+		"org_id":         orgID.String(),
+		"org_residency":  org.DataResidency,
+		"component":      e.component,
+		"region":         e.region,
+		"path":           path,
+		"residency_pass": permitted,
+	})
+	if !permitted {
+		entry.Warn("Data residency policy denied access to org data")
+		return ErrRegionNotPermitted
+	}
+	entry.Info("Data residency policy allowed access to org data")
+	return nil
+}
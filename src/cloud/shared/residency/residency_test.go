@@ -0,0 +1,96 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package residency_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	mock_profilepb "px.dev/pixie/src/cloud/profile/profilepb/mock"
+	"px.dev/pixie/src/cloud/shared/residency"
+	"px.dev/pixie/src/utils"
+)
+
+func TestPermitted(t *testing.T) {
+	tests := []struct {
+		name            string
+		orgResidency    string
+		componentRegion string
+		expected        bool
+	}{
+		{"unrestricted org, no region", "", "", true},
+		{"unrestricted org, eu region", "", "eu", true},
+		{"eu org, eu region", "eu", "eu", true},
+		{"eu org, mixed case region", "EU", " eu ", true},
+		{"eu org, us region", "eu", "us", false},
+		{"us org, no region", "us", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, residency.Permitted(test.orgResidency, test.componentRegion))
+		})
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	assert.NoError(t, residency.ValidateRegion(""))
+	assert.NoError(t, residency.ValidateRegion("eu"))
+	assert.NoError(t, residency.ValidateRegion("US"))
+	assert.Error(t, residency.ValidateRegion("apac"))
+
+	_, err := residency.NewEnforcer(nil, "vzconn", "mars")
+	assert.Error(t, err)
+}
+
+func TestEnforcer_Check(t *testing.T) {
+	tests := []struct {
+		name          string
+		orgResidency  string
+		region        string
+		expectedError error
+	}{
+		{"unrestricted", "", "", nil},
+		{"allowed", "eu", "eu", nil},
+		{"denied", "eu", "us", residency.ErrRegionNotPermitted},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			orgID := uuid.Must(uuid.NewV4())
+			mockProfile := mock_profilepb.NewMockOrgServiceClient(ctrl)
+			mockProfile.EXPECT().
+				GetOrg(gomock.Any(), utils.ProtoFromUUID(orgID)).
+				Return(&profilepb.OrgInfo{ID: utils.ProtoFromUUID(orgID), DataResidency: test.orgResidency}, nil)
+
+			e, err := residency.NewEnforcer(mockProfile, "vzconn", test.region)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedError, e.Check(context.Background(), orgID, "bridge"))
+		})
+	}
+}
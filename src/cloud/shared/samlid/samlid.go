@@ -0,0 +1,44 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package samlid
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+// IdentityProvider is the identity provider of the users that log in to their org with SAML.
+const IdentityProvider = "saml"
+
+// AuthProviderID returns the ID of the user with the given SAML NameID. NameIDs are only unique for
+// an identity provider, so the org is part of the ID.
+func AuthProviderID(orgID uuid.UUID, nameID string) string {
+	return fmt.Sprintf("saml|%s|%s", orgID, nameID)
+}
+
+// NameID returns the SAML NameID of the user with the given auth provider ID, if they are a SAML
+// user of the org.
+func NameID(orgID uuid.UUID, authProviderID string) (string, bool) {
+	prefix := AuthProviderID(orgID, "")
+	if !strings.HasPrefix(authProviderID, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(authProviderID, prefix), true
+}
@@ -38,9 +38,11 @@ import (
 	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/cloud/shared/vzshard"
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/tracing"
 )
 
 // NATSBridgeController is responsible for routing messages from Vizier to NATS. It assumes that all authentication/handshakes
@@ -56,6 +58,11 @@ type NATSBridgeController struct {
 	grpcOutCh chan *vzconnpb.C2VBridgeMessage
 	grpcInCh  chan *vzconnpb.V2CBridgeMessage
 
+	// signer and verifier authenticate the messages on the stream. They default to accepting
+	// and sending unsigned messages.
+	signer   *bridgesig.Signer
+	verifier *bridgesig.Verifier
+
 	quitCh chan bool // Channel is used to signal that things should shutdown.
 	subCh  chan *nats.Msg
 }
@@ -74,6 +81,9 @@ func NewNATSBridgeController(clusterID uuid.UUID, srv vzconnpb.VZConnService_NAT
 		grpcOutCh: make(chan *vzconnpb.C2VBridgeMessage, 4096),
 		grpcInCh:  make(chan *vzconnpb.V2CBridgeMessage, 4096),
 
+		signer:   bridgesig.NewSigner(nil),
+		verifier: bridgesig.NewV2CVerifier(nil, 0, false),
+
 		quitCh: make(chan bool),
 		subCh:  make(chan *nats.Msg, 4096),
 	}
@@ -184,8 +194,9 @@ func (s *NATSBridgeController) sendNATSMessageToGRPC(msg *nats.Msg) error {
 	topic := s.getRemoteSubject(msg.Subject)
 
 	outMsg := &vzconnpb.C2VBridgeMessage{
-		Topic: topic,
-		Msg:   c2vMsg.Msg,
+		Topic:        topic,
+		Msg:          c2vMsg.Msg,
+		TraceContext: tracing.Inject(msgbus.ContextFromNATSMsg(msg)),
 	}
 
 	s.grpcOutCh <- outMsg
@@ -204,14 +215,15 @@ func (s *NATSBridgeController) sendMessageToMessageBus(msg *vzconnpb.V2CBridgeMe
 		return err
 	}
 	topic := vzshard.V2CTopic(msg.Topic, s.clusterID)
+	ctx := tracing.Extract(context.Background(), msg.TraceContext)
 
 	if strings.Contains(topic, "Durable") {
 		stanPublishCount.WithLabelValues(cid).Inc()
-		return s.st.Publish(topic, b)
+		return s.st.PublishWithContext(ctx, topic, b)
 	}
 
 	natsPublishCount.WithLabelValues(cid).Inc()
-	return s.nc.Publish(topic, b)
+	return msgbus.PublishWithContext(ctx, s.nc, topic, b)
 }
 
 func (s *NATSBridgeController) startStreamGRPCReader(ctx context.Context) error {
@@ -235,6 +247,10 @@ func (s *NATSBridgeController) startStreamGRPCReader(ctx context.Context) error
 			if err != nil {
 				return err
 			}
+			if err := s.verifier.VerifyV2C(msg); err != nil {
+				s.l.WithError(err).WithField("topic", msg.Topic).Error("Rejecting unauthenticated bridge message")
+				return err
+			}
 			s.grpcInCh <- msg
 		}
 	}
@@ -255,6 +271,7 @@ func (s *NATSBridgeController) startStreamGRPCWriter(ctx context.Context) error
 			return ctx.Err()
 		case m := <-s.grpcOutCh:
 			// Write message to GRPC if it exists.
+			s.signer.SignC2V(m)
 			err := s.srv.Send(m)
 			if err != nil {
 				s.l.WithError(err).Error("Failed to send message")
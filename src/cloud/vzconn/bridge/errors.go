@@ -31,4 +31,10 @@ var (
 	ErrRegistrationFailedNotFound = errors.New("registration failed not found")
 	// ErrRequestChannelClosed is an error returned when the streams have already been closed.
 	ErrRequestChannelClosed = errors.New("request channel already closed")
+	// ErrDataResidencyViolation is the error when the org's data residency policy does not allow this bridge.
+	ErrDataResidencyViolation = errors.New("data residency policy does not permit this region")
+	// ErrRedirectedToRegion is the error when the vizier was told to reconnect to a nearer cloud region.
+	ErrRedirectedToRegion = errors.New("vizier redirected to another cloud region")
+	// ErrBridgeSessionRejected is the error when the registration message could not be authenticated, or was replayed.
+	ErrBridgeSessionRejected = errors.New("bridge session rejected")
 )
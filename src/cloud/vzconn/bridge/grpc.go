@@ -32,6 +32,9 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/shared/residency"
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/cvmsgspb"
@@ -54,11 +57,13 @@ type GRPCServer struct {
 	vzDeploymentClient vzmgrpb.VZDeploymentServiceClient
 	nc                 *nats.Conn
 	st                 msgbus.Streamer
+	// residency enforces org data residency policies on bridge connections. Nil disables enforcement.
+	residency *residency.Enforcer
 }
 
 // NewBridgeGRPCServer creates a new GRPCServer.
-func NewBridgeGRPCServer(vzmgrClient vzmgrpb.VZMgrServiceClient, vzDeploymentClient vzmgrpb.VZDeploymentServiceClient, nc *nats.Conn, st msgbus.Streamer) *GRPCServer {
-	return &GRPCServer{vzmgrClient, vzDeploymentClient, nc, st}
+func NewBridgeGRPCServer(vzmgrClient vzmgrpb.VZMgrServiceClient, vzDeploymentClient vzmgrpb.VZDeploymentServiceClient, nc *nats.Conn, st msgbus.Streamer, enforcer *residency.Enforcer) *GRPCServer {
+	return &GRPCServer{vzmgrClient, vzDeploymentClient, nc, st, enforcer}
 }
 
 // RegisterVizierDeployment registers the vizier using the deployment key passed in on X-API-KEY.
@@ -114,7 +119,24 @@ func (s *GRPCServer) NATSBridge(srv vzconnpb.VZConnService_NATSBridgeServer) err
 		return convertToGRPCErr(ErrBadRegistrationMessage)
 	}
 	clusterID := registerMsg.VizierID
-	err = s.handleRegisterMessage(registerMsg, srv)
+
+	log.WithField("VizierID", utils2.UUIDFromProtoOrNil(clusterID).String()).
+		Info("Vizier registration request")
+
+	if err := s.checkDataResidency(srv.Context(), clusterID); err != nil {
+		return convertToGRPCErr(err)
+	}
+
+	// The rest of the stream is signed with the key that vzmgr derives from the vizier's stored key, once it has
+	// authenticated the registration message.
+	session, err := s.startBridgeSession(srv.Context(), msg)
+	if err != nil {
+		return convertToGRPCErr(err)
+	}
+	verifier := bridgesig.NewV2CVerifier(session.SessionKey, msg.SessionId, len(session.SessionKey) > 0)
+	signer := bridgesig.NewSigner(session.SessionKey)
+
+	err = s.handleRegisterMessage(registerMsg, session.Nonce, signer, srv)
 	if err != nil {
 		return convertToGRPCErr(err)
 	}
@@ -124,17 +146,35 @@ func (s *GRPCServer) NATSBridge(srv vzconnpb.VZConnService_NATSBridgeServer) err
 	// Each Vizier calls this endpoint. Once it's called we will basically
 	// create NATS bridge and subscribe to the relevant channels.
 	c := NewNATSBridgeController(utils2.UUIDFromProtoOrNil(clusterID), srv, s.nc, s.st)
+	c.signer = signer
+	c.verifier = verifier
 	bridgeMetricsCollector.Register(c)
 	defer bridgeMetricsCollector.Unregister(c)
 
 	return convertToGRPCErr(c.Run())
 }
 
-func (s *GRPCServer) handleRegisterMessage(msg *cvmsgspb.RegisterVizierRequest, srv vzconnpb.VZConnService_NATSBridgeServer) error {
-	vzID := utils2.UUIDFromProtoOrNil(msg.VizierID)
+// startBridgeSession has vzmgr authenticate the registration message, and get the key for the rest of the stream.
+func (s *GRPCServer) startBridgeSession(ctx context.Context, registerMsg *vzconnpb.V2CBridgeMessage) (*vzmgrpb.StartBridgeSessionResponse, error) {
+	serviceAuthToken, err := getServiceCredentials(viper.GetString("jwt_signing_key"))
+	if err != nil {
+		return nil, err
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization",
+		fmt.Sprintf("bearer %s", serviceAuthToken))
+	resp, err := s.vzmgrClient.StartBridgeSession(ctx, &vzmgrpb.StartBridgeSessionRequest{RegisterMsg: registerMsg})
+	if err != nil {
+		if c := status.Code(err); c == codes.Unauthenticated || c == codes.PermissionDenied {
+			log.WithError(err).Info("Rejected vizier bridge session")
+			return nil, ErrBridgeSessionRejected
+		}
+		return nil, err
+	}
+	return resp, nil
+}
 
-	log.WithField("VizierID", vzID.String()).
-		Info("Vizier registration request")
+func (s *GRPCServer) handleRegisterMessage(msg *cvmsgspb.RegisterVizierRequest, nonce []byte, signer *bridgesig.Signer, srv vzconnpb.VZConnService_NATSBridgeServer) error {
+	vzID := utils2.UUIDFromProtoOrNil(msg.VizierID)
 
 	serviceAuthToken, err := getClusterCredentials(viper.GetString("jwt_signing_key"), vzID)
 	if err != nil {
@@ -152,12 +192,21 @@ func (s *GRPCServer) handleRegisterMessage(msg *cvmsgspb.RegisterVizierRequest,
 		return err
 	}
 
-	sendErr := srv.Send(&vzconnpb.C2VBridgeMessage{
+	ackMsg := &vzconnpb.C2VBridgeMessage{
 		Topic: "registerAck",
 		Msg:   respAsAny,
-	})
+		Nonce: nonce,
+	}
+	signer.SignC2V(ackMsg)
+	sendErr := srv.Send(ackMsg)
 	// If registration failed it's an error and we should destroy the stream processor.
 	if vzmgrResp.Status == cvmsgspb.ST_OK {
+		if sendErr == nil && vzmgrResp.RedirectAddr != "" {
+			// The vizier reconnects to the region in the ack, so there is no bridge to run here.
+			log.WithField("VizierID", vzID.String()).WithField("region", vzmgrResp.Region).
+				Info("Redirected vizier to another cloud region")
+			return ErrRedirectedToRegion
+		}
 		return sendErr
 	}
 	if vzmgrResp.Status == cvmsgspb.ST_FAILED_NOT_FOUND {
@@ -166,6 +215,28 @@ func (s *GRPCServer) handleRegisterMessage(msg *cvmsgspb.RegisterVizierRequest,
 	return ErrRegistrationFailedUnknown
 }
 
+// checkDataResidency makes sure that the org owning the vizier allows its data to flow through this bridge.
+func (s *GRPCServer) checkDataResidency(ctx context.Context, vizierID *uuidpb.UUID) error {
+	if s.residency == nil {
+		return nil
+	}
+	serviceAuthToken, err := getServiceCredentials(viper.GetString("jwt_signing_key"))
+	if err != nil {
+		return err
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization",
+		fmt.Sprintf("bearer %s", serviceAuthToken))
+	resp, err := s.vzmgrClient.GetOrgFromVizier(ctx, vizierID)
+	if err != nil {
+		return err
+	}
+	err = s.residency.Check(ctx, utils2.UUIDFromProtoOrNil(resp.OrgID), "bridge")
+	if err == residency.ErrRegionNotPermitted {
+		return ErrDataResidencyViolation
+	}
+	return err
+}
+
 func convertToGRPCErr(err error) error {
 	if err == nil {
 		return err
@@ -182,6 +253,13 @@ func convertToGRPCErr(err error) error {
 		return status.Error(codes.NotFound, err.Error())
 	case ErrRequestChannelClosed:
 		return status.Error(codes.Canceled, err.Error())
+	case ErrDataResidencyViolation:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case ErrRedirectedToRegion:
+		return status.Error(codes.Unavailable, err.Error())
+	case ErrBridgeSessionRejected, bridgesig.ErrMissingSignature, bridgesig.ErrBadSignature, bridgesig.ErrReplayedMessage,
+		bridgesig.ErrSessionMismatch:
+		return status.Error(codes.Unauthenticated, err.Error())
 	}
 	return status.Error(codes.Unknown, err.Error())
 }
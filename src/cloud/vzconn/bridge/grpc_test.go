@@ -36,13 +36,18 @@ import (
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	mock_profilepb "px.dev/pixie/src/cloud/profile/profilepb/mock"
+	"px.dev/pixie/src/cloud/shared/residency"
 	"px.dev/pixie/src/cloud/shared/vzshard"
 	"px.dev/pixie/src/cloud/vzconn/bridge"
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	mock_vzmgrpb "px.dev/pixie/src/cloud/vzmgr/vzmgrpb/mock"
@@ -66,6 +71,10 @@ type testState struct {
 }
 
 func createTestState(t *testing.T, ctrl *gomock.Controller) (*testState, func(t *testing.T)) {
+	return createTestStateWithEnforcer(t, ctrl, nil)
+}
+
+func createTestStateWithEnforcer(t *testing.T, ctrl *gomock.Controller, enforcer *residency.Enforcer) (*testState, func(t *testing.T)) {
 	viper.Set("jwt_signing_key", "jwtkey")
 	lis := bufconn.Listen(bufSize)
 	s := grpc.NewServer()
@@ -81,7 +90,7 @@ func createTestState(t *testing.T, ctrl *gomock.Controller) (*testState, func(t
 		MaxAge:   1 * time.Minute,
 	})
 	require.NoError(t, err)
-	b := bridge.NewBridgeGRPCServer(mockVZMgr, mockVZDeployment, nc, st)
+	b := bridge.NewBridgeGRPCServer(mockVZMgr, mockVZDeployment, nc, st, enforcer)
 	vzconnpb.RegisterVZConnServiceServer(s, b)
 
 	eg := errgroup.Group{}
@@ -167,6 +176,9 @@ func TestNATSGRPCBridgeHandshakeTest_CorrectRegistration(t *testing.T) {
 		JwtKey:   "123",
 	}
 
+	ts.mockVZMgr.EXPECT().
+		StartBridgeSession(gomock.Any(), gomock.Any()).
+		Return(&vzmgrpb.StartBridgeSessionResponse{}, nil)
 	ts.mockVZMgr.EXPECT().
 		VizierConnected(gomock.Any(), regReq).
 		Return(&cvmsgspb.RegisterVizierAck{Status: cvmsgspb.ST_OK}, nil)
@@ -201,6 +213,182 @@ func TestNATSGRPCBridgeHandshakeTest_CorrectRegistration(t *testing.T) {
 	assert.Equal(t, cvmsgspb.ST_OK, ack.Status)
 }
 
+func TestNATSGRPCBridgeHandshakeTest_RedirectedToRegion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ts, cleanup := createTestState(t, ctrl)
+	defer cleanup(t)
+
+	vizierID := uuid.Must(uuid.NewV4())
+	regReq := &cvmsgspb.RegisterVizierRequest{
+		VizierID: utils.ProtoFromUUID(vizierID),
+		JwtKey:   "123",
+	}
+
+	ts.mockVZMgr.EXPECT().
+		StartBridgeSession(gomock.Any(), gomock.Any()).
+		Return(&vzmgrpb.StartBridgeSessionResponse{}, nil)
+	ts.mockVZMgr.EXPECT().
+		VizierConnected(gomock.Any(), regReq).
+		Return(&cvmsgspb.RegisterVizierAck{
+			Status:       cvmsgspb.ST_OK,
+			Region:       "eu",
+			RedirectAddr: "vzconn.eu.example.com:443",
+		}, nil)
+
+	client := vzconnpb.NewVZConnServiceClient(ts.conn)
+	stream, err := client.NATSBridge(context.Background())
+	require.NoError(t, err)
+
+	readCh := grpcReader(stream)
+	err = stream.Send(&vzconnpb.V2CBridgeMessage{
+		Topic:     "register",
+		SessionId: 0,
+		Msg:       convertToAny(regReq),
+	})
+	require.NoError(t, err)
+
+	// The vizier gets the ack with the region to reconnect to, and then the stream is closed.
+	m := <-readCh
+	require.Nil(t, m.err)
+	ack := cvmsgspb.RegisterVizierAck{}
+	require.NoError(t, types.UnmarshalAny(m.msg.Msg, &ack))
+	assert.Equal(t, "vzconn.eu.example.com:443", ack.RedirectAddr)
+
+	m = <-readCh
+	require.NotNil(t, m.err)
+	assert.Equal(t, codes.Unavailable, status.Code(m.err))
+}
+
+func TestNATSGRPCBridgeHandshakeTest_SignedRegistration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ts, cleanup := createTestState(t, ctrl)
+	defer cleanup(t)
+
+	vizierID := uuid.Must(uuid.NewV4())
+	regReq := &cvmsgspb.RegisterVizierRequest{
+		VizierID: utils.ProtoFromUUID(vizierID),
+		JwtKey:   "123",
+	}
+	regMsg := &vzconnpb.V2CBridgeMessage{
+		Topic:     "register",
+		SessionId: 1,
+		Msg:       convertToAny(regReq),
+	}
+	bridgesig.NewSigner(bridgesig.DeriveKey("123", vizierID, 1, nil)).SignV2C(regMsg)
+
+	nonce := []byte("nonce")
+	ts.mockVZMgr.EXPECT().
+		StartBridgeSession(gomock.Any(), &vzmgrpb.StartBridgeSessionRequest{RegisterMsg: regMsg}).
+		Return(&vzmgrpb.StartBridgeSessionResponse{
+			Nonce:      nonce,
+			SessionKey: bridgesig.DeriveKey("123", vizierID, 1, nonce),
+		}, nil)
+	ts.mockVZMgr.EXPECT().
+		VizierConnected(gomock.Any(), regReq).
+		Return(&cvmsgspb.RegisterVizierAck{Status: cvmsgspb.ST_OK}, nil)
+
+	client := vzconnpb.NewVZConnServiceClient(ts.conn)
+	stream, err := client.NATSBridge(context.Background())
+	require.NoError(t, err)
+
+	readCh := grpcReader(stream)
+	require.NoError(t, stream.Send(regMsg))
+
+	// The ack carries the nonce, and is signed with the key derived from it.
+	m := <-readCh
+	require.Nil(t, m.err)
+	assert.Equal(t, nonce, m.msg.Nonce)
+	verifier := bridgesig.NewC2VVerifier(func(nonce []byte) []byte {
+		return bridgesig.DeriveKey("123", vizierID, 1, nonce)
+	}, true)
+	require.NoError(t, verifier.VerifyC2V(m.msg))
+
+	// Unsigned messages are rejected for the rest of the stream.
+	require.NoError(t, stream.Send(&vzconnpb.V2CBridgeMessage{
+		Topic:     "t1",
+		SessionId: 1,
+		Msg:       convertToAny(&cvmsgspb.VizierHeartbeat{VizierID: utils.ProtoFromUUID(vizierID)}),
+	}))
+	m = <-readCh
+	require.NotNil(t, m.err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(m.err))
+}
+
+func TestNATSGRPCBridgeHandshakeTest_SessionRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ts, cleanup := createTestState(t, ctrl)
+	defer cleanup(t)
+
+	vizierID := uuid.Must(uuid.NewV4())
+	regReq := &cvmsgspb.RegisterVizierRequest{
+		VizierID: utils.ProtoFromUUID(vizierID),
+		JwtKey:   "123",
+	}
+
+	ts.mockVZMgr.EXPECT().
+		StartBridgeSession(gomock.Any(), gomock.Any()).
+		Return(nil, status.Error(codes.PermissionDenied, "bridge session was already used"))
+
+	client := vzconnpb.NewVZConnServiceClient(ts.conn)
+	stream, err := client.NATSBridge(context.Background())
+	require.NoError(t, err)
+
+	readCh := grpcReader(stream)
+	err = stream.Send(&vzconnpb.V2CBridgeMessage{
+		Topic:     "register",
+		SessionId: 0,
+		Msg:       convertToAny(regReq),
+	})
+	require.NoError(t, err)
+
+	// The vizier should never be marked as connected.
+	m := <-readCh
+	require.NotNil(t, m.err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(m.err))
+	assert.Nil(t, m.msg)
+}
+
+func TestNATSGRPCBridgeHandshakeTest_DataResidencyDenied(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockOrg := mock_profilepb.NewMockOrgServiceClient(ctrl)
+	enforcer, err := residency.NewEnforcer(mockOrg, "vzconn", residency.RegionUS)
+	require.NoError(t, err)
+	ts, cleanup := createTestStateWithEnforcer(t, ctrl, enforcer)
+	defer cleanup(t)
+
+	vizierID := uuid.Must(uuid.NewV4())
+	orgID := uuid.Must(uuid.NewV4())
+	regReq := &cvmsgspb.RegisterVizierRequest{
+		VizierID: utils.ProtoFromUUID(vizierID),
+		JwtKey:   "123",
+	}
+
+	ts.mockVZMgr.EXPECT().
+		GetOrgFromVizier(gomock.Any(), utils.ProtoFromUUID(vizierID)).
+		Return(&vzmgrpb.GetOrgFromVizierResponse{OrgID: utils.ProtoFromUUID(orgID)}, nil)
+	mockOrg.EXPECT().
+		GetOrg(gomock.Any(), utils.ProtoFromUUID(orgID)).
+		Return(&profilepb.OrgInfo{ID: utils.ProtoFromUUID(orgID), DataResidency: residency.RegionEU}, nil)
+
+	client := vzconnpb.NewVZConnServiceClient(ts.conn)
+	stream, err := client.NATSBridge(context.Background())
+	require.NoError(t, err)
+
+	readCh := grpcReader(stream)
+	err = stream.Send(&vzconnpb.V2CBridgeMessage{
+		Topic:     "register",
+		SessionId: 0,
+		Msg:       convertToAny(regReq),
+	})
+	require.NoError(t, err)
+
+	// The vizier should never be marked as connected.
+	m := <-readCh
+	require.NotNil(t, m.err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(m.err))
+	assert.Nil(t, m.msg)
+}
+
 func TestNATSGRPCBridgeHandshakeTest_MissingRegister(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	ts, cleanup := createTestState(t, ctrl)
@@ -291,6 +479,9 @@ func registerVizier(ts *testState, vizierID uuid.UUID, stream vzconnpb.VZConnSer
 		JwtKey:   "123",
 	}
 
+	ts.mockVZMgr.EXPECT().
+		StartBridgeSession(gomock.Any(), gomock.Any()).
+		Return(&vzmgrpb.StartBridgeSessionResponse{}, nil)
 	ts.mockVZMgr.EXPECT().
 		VizierConnected(gomock.Any(), regReq).
 		Return(&cvmsgspb.RegisterVizierAck{Status: cvmsgspb.ST_OK}, nil)
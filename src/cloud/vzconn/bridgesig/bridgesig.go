@@ -0,0 +1,257 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package bridgesig signs and verifies the messages sent over the vizier<->cloud NATS bridge.
+// Each message carries a sequence number and an HMAC over its contents, keyed by a key derived
+// from the vizier's JWT signing key. The message that opens a stream is signed with a key bound to
+// the vizier's session, and every later message with a key bound to a fresh nonce that the cloud
+// picks for the stream. This prevents an attacker on the network path from forging messages or
+// replaying old ones, whether on the same stream or another one.
+//
+// Both sides share the same code so that the signed payload is guaranteed to be identical.
+package bridgesig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+
+	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
+)
+
+const keyDerivationLabel = "px-bridge-session-key-v1"
+
+// nonceLength is the length of the nonces that the cloud picks for each stream.
+const nonceLength = 32
+
+// Direction labels are mixed into the signature so that a message can't be reflected back to its sender.
+const (
+	v2cLabel = "v2c"
+	c2vLabel = "c2v"
+)
+
+var (
+	// ErrMissingSignature is returned when an unsigned message is received and signatures are required.
+	ErrMissingSignature = errors.New("bridge message is not signed")
+	// ErrBadSignature is returned when the signature on a message does not match its contents.
+	ErrBadSignature = errors.New("bridge message signature is invalid")
+	// ErrReplayedMessage is returned when a message's sequence number is not greater than the last one seen.
+	ErrReplayedMessage = errors.New("bridge message sequence number is not increasing")
+	// ErrSessionMismatch is returned when a message is sent with a session ID other than the one that was registered,
+	// or when the cloud sends a second nonce on a stream.
+	ErrSessionMismatch = errors.New("bridge message session does not match registration")
+)
+
+// DeriveKey derives a bridge signing key from the vizier's JWT signing key. The message that opens a
+// stream is signed with the key derived without a nonce, and the rest of the stream with the key derived
+// from the nonce that the cloud sends in its registerAck.
+// Returns nil if there is no JWT signing key to derive from.
+func DeriveKey(jwtKey string, vizierID uuid.UUID, sessionID int64, nonce []byte) []byte {
+	if jwtKey == "" {
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(jwtKey))
+	mac.Write([]byte(keyDerivationLabel))
+	mac.Write(vizierID.Bytes())
+	mac.Write([]byte(strconv.FormatInt(sessionID, 10)))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// NewNonce generates a fresh nonce for a stream.
+func NewNonce() ([]byte, error) {
+	nonce := make([]byte, nonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+func computeSignature(key []byte, direction string, seqNum uint64, sessionID int64, topic string, msg *types.Any, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	writeField := func(b []byte) {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+		mac.Write(l[:])
+		mac.Write(b)
+	}
+	var n [8]byte
+	writeField([]byte(direction))
+	binary.BigEndian.PutUint64(n[:], seqNum)
+	writeField(n[:])
+	binary.BigEndian.PutUint64(n[:], uint64(sessionID))
+	writeField(n[:])
+	writeField([]byte(topic))
+	writeField([]byte(msg.GetTypeUrl()))
+	writeField(msg.GetValue())
+	writeField(nonce)
+	return mac.Sum(nil)
+}
+
+// Signer assigns sequence numbers to outgoing bridge messages and signs them.
+type Signer struct {
+	mu     sync.Mutex
+	key    []byte
+	seqNum uint64
+}
+
+// NewSigner creates a signer using the given key. A signer with an empty key leaves messages unsigned.
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// SetKey changes the key that messages are signed with. Sequence numbers carry on across keys, so that
+// the message that opens each stream of a session has a higher sequence number than the one before.
+func (s *Signer) SetKey(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+}
+
+// next returns the key and sequence number to sign the next message with, or a nil key if messages
+// are left unsigned.
+func (s *Signer) next() ([]byte, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.key) == 0 {
+		return nil, 0
+	}
+	s.seqNum++
+	return s.key, s.seqNum
+}
+
+// SignV2C signs a message going from vizier to cloud.
+func (s *Signer) SignV2C(m *vzconnpb.V2CBridgeMessage) {
+	key, seqNum := s.next()
+	if key == nil {
+		return
+	}
+	m.SeqNum = seqNum
+	m.Signature = computeSignature(key, v2cLabel, m.SeqNum, m.SessionId, m.Topic, m.Msg, nil)
+}
+
+// SignC2V signs a message going from cloud to vizier.
+func (s *Signer) SignC2V(m *vzconnpb.C2VBridgeMessage) {
+	key, seqNum := s.next()
+	if key == nil {
+		return
+	}
+	m.SeqNum = seqNum
+	m.Signature = computeSignature(key, c2vLabel, m.SeqNum, 0, m.Topic, m.Msg, m.Nonce)
+}
+
+// Verifier checks the signatures and sequence numbers of incoming bridge messages.
+//
+// For compatibility with peers that predate signing, unsigned messages are accepted unless
+// signatures are required. However, once a signed message has been seen, every message after it
+// must be signed as well so that signatures can't be stripped from the stream.
+type Verifier struct {
+	required  bool
+	sessionID int64
+	// deriveKey, if set, derives the key from the nonce that the cloud sends on the stream.
+	deriveKey func(nonce []byte) []byte
+
+	mu         sync.Mutex
+	key        []byte
+	lastSeqNum uint64
+	seenSigned bool
+	seenNonce  bool
+}
+
+// NewV2CVerifier creates a verifier for vizier to cloud messages, which must all use the given session ID.
+func NewV2CVerifier(key []byte, sessionID int64, required bool) *Verifier {
+	return &Verifier{key: key, required: required, sessionID: sessionID}
+}
+
+// NewC2VVerifier creates a verifier for cloud to vizier messages. Its key is derived from the nonce that
+// the first message of the stream, the registerAck, carries.
+func NewC2VVerifier(deriveKey func(nonce []byte) []byte, required bool) *Verifier {
+	return &Verifier{deriveKey: deriveKey, required: required}
+}
+
+// Key returns the key that the stream is verified with, or nil if it isn't known yet.
+func (v *Verifier) Key() []byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.key
+}
+
+// VerifyV2C verifies a message sent from vizier to cloud.
+func (v *Verifier) VerifyV2C(m *vzconnpb.V2CBridgeMessage) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.key) > 0 && m.SessionId != v.sessionID {
+		return ErrSessionMismatch
+	}
+	return v.verifyLocked(m.Signature, m.SeqNum, func() []byte {
+		return computeSignature(v.key, v2cLabel, m.SeqNum, m.SessionId, m.Topic, m.Msg, nil)
+	})
+}
+
+// VerifyC2V verifies a message sent from cloud to vizier.
+func (v *Verifier) VerifyC2V(m *vzconnpb.C2VBridgeMessage) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	prevKey := v.key
+	if len(m.Nonce) > 0 && len(m.Signature) > 0 && v.deriveKey != nil {
+		// Only one nonce is accepted per stream, so that the stream can't be switched onto another key.
+		if v.seenNonce {
+			return ErrSessionMismatch
+		}
+		v.key = v.deriveKey(m.Nonce)
+	}
+	err := v.verifyLocked(m.Signature, m.SeqNum, func() []byte {
+		return computeSignature(v.key, c2vLabel, m.SeqNum, 0, m.Topic, m.Msg, m.Nonce)
+	})
+	if err != nil {
+		// A forged nonce must not replace the key.
+		v.key = prevKey
+		return err
+	}
+	if len(m.Nonce) > 0 && len(m.Signature) > 0 {
+		v.seenNonce = true
+	}
+	return nil
+}
+
+func (v *Verifier) verifyLocked(sig []byte, seqNum uint64, expected func() []byte) error {
+	if len(sig) == 0 {
+		if v.required || v.seenSigned {
+			return ErrMissingSignature
+		}
+		return nil
+	}
+	if len(v.key) == 0 || !hmac.Equal(sig, expected()) {
+		return ErrBadSignature
+	}
+	if seqNum <= v.lastSeqNum {
+		return ErrReplayedMessage
+	}
+	v.lastSeqNum = seqNum
+	v.seenSigned = true
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridgesig_test
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
+	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
+)
+
+var vizierID = uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+func v2cMsg(t *testing.T, topic string, sessionID int64) *vzconnpb.V2CBridgeMessage {
+	anyMsg, err := types.MarshalAny(&types.StringValue{Value: topic})
+	require.NoError(t, err)
+	return &vzconnpb.V2CBridgeMessage{Topic: topic, SessionId: sessionID, Msg: anyMsg}
+}
+
+func TestDeriveKey(t *testing.T) {
+	k := bridgesig.DeriveKey("jwtkey", vizierID, 1, nil)
+	assert.Len(t, k, 32)
+	assert.Equal(t, k, bridgesig.DeriveKey("jwtkey", vizierID, 1, nil))
+	assert.NotEqual(t, k, bridgesig.DeriveKey("jwtkey", vizierID, 2, nil))
+	assert.NotEqual(t, k, bridgesig.DeriveKey("otherkey", vizierID, 1, nil))
+	assert.NotEqual(t, k, bridgesig.DeriveKey("jwtkey", vizierID, 1, []byte("nonce")))
+	assert.Nil(t, bridgesig.DeriveKey("", vizierID, 1, nil))
+
+	n1, err := bridgesig.NewNonce()
+	require.NoError(t, err)
+	n2, err := bridgesig.NewNonce()
+	require.NoError(t, err)
+	assert.NotEqual(t, n1, n2)
+}
+
+func TestVerifyV2C(t *testing.T) {
+	key := bridgesig.DeriveKey("jwtkey", vizierID, 1, nil)
+	signer := bridgesig.NewSigner(key)
+	verifier := bridgesig.NewV2CVerifier(key, 1, false)
+
+	first := v2cMsg(t, "heartbeat", 1)
+	signer.SignV2C(first)
+	second := v2cMsg(t, "heartbeat", 1)
+	signer.SignV2C(second)
+	assert.Equal(t, uint64(1), first.SeqNum)
+	assert.Equal(t, uint64(2), second.SeqNum)
+
+	require.NoError(t, verifier.VerifyV2C(first))
+	require.NoError(t, verifier.VerifyV2C(second))
+	// Replaying an earlier message is rejected.
+	assert.Equal(t, bridgesig.ErrReplayedMessage, verifier.VerifyV2C(first))
+
+	// Tampering with the contents or the sequence number invalidates the signature.
+	tampered := v2cMsg(t, "heartbeat", 1)
+	signer.SignV2C(tampered)
+	tampered.Topic = "disconnect"
+	assert.Equal(t, bridgesig.ErrBadSignature, verifier.VerifyV2C(tampered))
+	tampered = v2cMsg(t, "heartbeat", 1)
+	signer.SignV2C(tampered)
+	tampered.SeqNum += 10
+	assert.Equal(t, bridgesig.ErrBadSignature, verifier.VerifyV2C(tampered))
+
+	// Signatures can't be stripped once the stream is signed.
+	assert.Equal(t, bridgesig.ErrMissingSignature, verifier.VerifyV2C(v2cMsg(t, "heartbeat", 1)))
+	assert.Equal(t, bridgesig.ErrSessionMismatch, verifier.VerifyV2C(v2cMsg(t, "heartbeat", 2)))
+}
+
+func TestVerify_Unsigned(t *testing.T) {
+	key := bridgesig.DeriveKey("jwtkey", vizierID, 1, nil)
+
+	assert.NoError(t, bridgesig.NewV2CVerifier(key, 1, false).VerifyV2C(v2cMsg(t, "heartbeat", 1)))
+	assert.Equal(t, bridgesig.ErrMissingSignature, bridgesig.NewV2CVerifier(key, 1, true).VerifyV2C(v2cMsg(t, "heartbeat", 1)))
+}
+
+func TestVerifyC2V(t *testing.T) {
+	nonce, err := bridgesig.NewNonce()
+	require.NoError(t, err)
+	deriveKey := func(nonce []byte) []byte {
+		return bridgesig.DeriveKey("jwtkey", vizierID, 1, nonce)
+	}
+	signer := bridgesig.NewSigner(deriveKey(nonce))
+	verifier := bridgesig.NewC2VVerifier(deriveKey, true)
+
+	anyMsg, err := types.MarshalAny(&types.StringValue{Value: "ack"})
+	require.NoError(t, err)
+
+	// An ack with a forged nonce doesn't replace the key of the stream.
+	forged := &vzconnpb.C2VBridgeMessage{Topic: "registerAck", Msg: anyMsg, Nonce: []byte("forged")}
+	bridgesig.NewSigner(bridgesig.DeriveKey("otherkey", vizierID, 1, []byte("forged"))).SignC2V(forged)
+	assert.Equal(t, bridgesig.ErrBadSignature, verifier.VerifyC2V(forged))
+	assert.Nil(t, verifier.Key())
+
+	ack := &vzconnpb.C2VBridgeMessage{Topic: "registerAck", Msg: anyMsg, Nonce: nonce}
+	signer.SignC2V(ack)
+	require.NoError(t, verifier.VerifyC2V(ack))
+	assert.Equal(t, deriveKey(nonce), verifier.Key())
+	assert.Equal(t, bridgesig.ErrSessionMismatch, verifier.VerifyC2V(ack))
+
+	msg := &vzconnpb.C2VBridgeMessage{Topic: "update", Msg: anyMsg}
+	signer.SignC2V(msg)
+	require.NoError(t, verifier.VerifyC2V(msg))
+	assert.Equal(t, bridgesig.ErrReplayedMessage, verifier.VerifyC2V(msg))
+
+	// A message from another stream of the session, which used another nonce, is rejected.
+	otherNonce, err := bridgesig.NewNonce()
+	require.NoError(t, err)
+	other := &vzconnpb.C2VBridgeMessage{Topic: "update", Msg: anyMsg}
+	bridgesig.NewSigner(deriveKey(otherNonce)).SignC2V(other)
+	other.SeqNum = 5
+	assert.Equal(t, bridgesig.ErrBadSignature, verifier.VerifyC2V(other))
+}
+
+func TestSigner_SetKey(t *testing.T) {
+	regKey := bridgesig.DeriveKey("jwtkey", vizierID, 1, nil)
+	streamKey := bridgesig.DeriveKey("jwtkey", vizierID, 1, []byte("nonce"))
+	signer := bridgesig.NewSigner(regKey)
+
+	register := v2cMsg(t, "register", 1)
+	signer.SignV2C(register)
+	require.NoError(t, bridgesig.NewV2CVerifier(regKey, 1, true).VerifyV2C(register))
+
+	// Sequence numbers carry on with the new key.
+	signer.SetKey(streamKey)
+	heartbeat := v2cMsg(t, "heartbeat", 1)
+	signer.SignV2C(heartbeat)
+	assert.Equal(t, uint64(2), heartbeat.SeqNum)
+	require.NoError(t, bridgesig.NewV2CVerifier(streamKey, 1, true).VerifyV2C(heartbeat))
+	assert.Equal(t, bridgesig.ErrBadSignature, bridgesig.NewV2CVerifier(regKey, 1, true).VerifyV2C(heartbeat))
+}
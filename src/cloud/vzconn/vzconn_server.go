@@ -28,7 +28,9 @@ import (
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 
+	"px.dev/pixie/src/cloud/profile/profilepb"
 	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/residency"
 	"px.dev/pixie/src/cloud/vzconn/bridge"
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
@@ -45,6 +47,8 @@ var natsErrorCounter *messages.NatsErrorCounter
 func init() {
 	pflag.String("vzmgr_service", "kubernetes:///vzmgr-service.plc:51800", "The profile service url (load balancer/list is ok)")
 	pflag.String("domain_name", "dev.withpixie.dev", "The domain name of Pixie Cloud")
+	pflag.String("profile_service", "kubernetes:///profile-service.plc:51500", "The profile service url (load balancer/list is ok)")
+	pflag.String("data_region", "", "The data residency region (eu, us) this service is deployed in")
 
 	natsErrorCounter = messages.NewNatsErrorCounter()
 }
@@ -63,6 +67,20 @@ func newVZMgrClients() (vzmgrpb.VZMgrServiceClient, vzmgrpb.VZDeploymentServiceC
 	return vzmgrpb.NewVZMgrServiceClient(vzmgrChannel), vzmgrpb.NewVZDeploymentServiceClient(vzmgrChannel), nil
 }
 
+func newOrgServiceClient() (profilepb.OrgServiceClient, error) {
+	dialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	profileChannel, err := grpc.Dial(viper.GetString("profile_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return profilepb.NewOrgServiceClient(profileChannel), nil
+}
+
 func mustSetupNATSAndJetStream() (*nats.Conn, msgbus.Streamer) {
 	nc := msgbus.MustConnectNATS()
 	js := msgbus.MustConnectJetStream(nc)
@@ -111,7 +129,15 @@ func main() {
 		log.WithError(err).Fatal("failed to initialize vizer manager RPC client")
 		panic(err)
 	}
-	svr := bridge.NewBridgeGRPCServer(vzmgrClient, vzdeployClient, nc, strmr)
+	orgClient, err := newOrgServiceClient()
+	if err != nil {
+		log.WithError(err).Fatal("failed to initialize org RPC client")
+	}
+	enforcer, err := residency.NewEnforcer(orgClient, "vzconn", viper.GetString("data_region"))
+	if err != nil {
+		log.WithError(err).Fatal("Invalid data region")
+	}
+	svr := bridge.NewBridgeGRPCServer(vzmgrClient, vzdeployClient, nc, strmr, enforcer)
 	vzconnpb.RegisterVZConnServiceServer(s.GRPCServer(), svr)
 
 	s.Start()
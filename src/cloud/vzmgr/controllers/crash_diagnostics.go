@@ -0,0 +1,190 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	// crashDiagnosticsTopic is the topic that the operators of the clusters upload crash diagnostics on.
+	crashDiagnosticsTopic = "CrashDiagnostics"
+	// The number of bundles that are kept for each cluster. Older bundles are deleted when a new one is uploaded.
+	crashDiagnosticsKept = 10
+	// The largest bundle that is stored. The operator keeps its bundles well below this size.
+	maxCrashDiagnosticsBundleSize = 1024 * 1024
+)
+
+// CrashDiagnosticsContainers is the type to use in sqlx for the crashlooping containers of a bundle.
+type CrashDiagnosticsContainers []string
+
+// Value returns a golang database/sql driver value for CrashDiagnosticsContainers.
+func (c CrashDiagnosticsContainers) Value() (driver.Value, error) {
+	if c == nil {
+		c = CrashDiagnosticsContainers{}
+	}
+	return json.Marshal(c)
+}
+
+// Scan scans the sqlx database type ([]bytes) into the CrashDiagnosticsContainers type.
+func (c *CrashDiagnosticsContainers) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New("could not scan crash diagnostics containers")
+	}
+	return json.Unmarshal(b, c)
+}
+
+// crashDiagnosticsInfo is a diagnostic bundle of crashlooping pods, without the bundle itself.
+type crashDiagnosticsInfo struct {
+	Name       string                     `db:"name"`
+	Reason     string                     `db:"reason"`
+	CapturedAt time.Time                  `db:"captured_at"`
+	Containers CrashDiagnosticsContainers `db:"containers"`
+	SizeBytes  int64                      `db:"size_bytes"`
+}
+
+func (c *crashDiagnosticsInfo) toProto() *vzmgrpb.CrashDiagnosticsInfo {
+	capturedAt, _ := types.TimestampProto(c.CapturedAt)
+	return &vzmgrpb.CrashDiagnosticsInfo{
+		Name:       c.Name,
+		Reason:     c.Reason,
+		CapturedAt: capturedAt,
+		Containers: c.Containers,
+		SizeBytes:  c.SizeBytes,
+	}
+}
+
+const crashDiagnosticsInfoColumns = `name, reason, captured_at, containers, octet_length(bundle) AS size_bytes`
+
+// HandleCrashDiagnostics stores a diagnostic bundle of crashlooping pods that the operator of a cluster uploaded,
+// and deletes the oldest bundles of the cluster.
+func (s *Server) HandleCrashDiagnostics(v2cMsg *cvmsgspb.V2CMessage) {
+	req := &cvmsgspb.CrashDiagnosticsBundle{}
+	err := types.UnmarshalAny(v2cMsg.Msg, req)
+	if err != nil {
+		log.WithError(err).Error("Could not unmarshal NATS message")
+		return
+	}
+	vizierID, err := uuid.FromString(v2cMsg.VizierID)
+	if err != nil {
+		log.WithError(err).Error("Received crash diagnostics with an invalid vizier ID")
+		return
+	}
+	if req.Name == "" || len(req.Bundle) > maxCrashDiagnosticsBundleSize {
+		log.WithField("vizierID", vizierID).WithField("size", len(req.Bundle)).Error("Received invalid crash diagnostics")
+		return
+	}
+	capturedAt, err := types.TimestampFromProto(req.CapturedAt)
+	if err != nil {
+		capturedAt = time.Now()
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		log.WithError(err).Error("Failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO vizier_crash_diagnostics (vizier_cluster_id, name, reason, captured_at, containers, bundle)
+              VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (vizier_cluster_id, name) DO NOTHING`
+	_, err = tx.Exec(query, vizierID, req.Name, req.Reason, capturedAt, CrashDiagnosticsContainers(req.Containers), req.Bundle)
+	if err != nil {
+		log.WithError(err).WithField("vizierID", vizierID).Error("Failed to store crash diagnostics")
+		return
+	}
+
+	query = `DELETE FROM vizier_crash_diagnostics WHERE vizier_cluster_id=$1 AND name NOT IN
+              (SELECT name FROM vizier_crash_diagnostics WHERE vizier_cluster_id=$1 ORDER BY captured_at DESC LIMIT $2)`
+	_, err = tx.Exec(query, vizierID, crashDiagnosticsKept)
+	if err != nil {
+		log.WithError(err).WithField("vizierID", vizierID).Error("Failed to delete old crash diagnostics")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.WithError(err).Error("Failed to commit transaction")
+		return
+	}
+	log.WithField("vizierID", vizierID).WithField("bundle", req.Name).WithField("reason", req.Reason).
+		Info("Stored crash diagnostics")
+}
+
+// ListCrashDiagnostics lists the diagnostic bundles of crashlooping pods that the cluster uploaded, from the most
+// recent.
+func (s *Server) ListCrashDiagnostics(ctx context.Context, req *uuidpb.UUID) (*vzmgrpb.ListCrashDiagnosticsResponse, error) {
+	if err := s.validateOrgOwnsCluster(ctx, req); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + crashDiagnosticsInfoColumns + ` FROM vizier_crash_diagnostics
+              WHERE vizier_cluster_id=$1 ORDER BY captured_at DESC`
+	var infos []crashDiagnosticsInfo
+	if err := s.db.SelectContext(ctx, &infos, query, utils.UUIDFromProtoOrNil(req)); err != nil {
+		log.WithError(err).Error("Failed to query crash diagnostics")
+		return nil, status.Error(codes.Internal, "failed to query crash diagnostics")
+	}
+	resp := &vzmgrpb.ListCrashDiagnosticsResponse{}
+	for i := range infos {
+		resp.Bundles = append(resp.Bundles, infos[i].toProto())
+	}
+	return resp, nil
+}
+
+// GetCrashDiagnosticsBundle gets a diagnostic bundle of crashlooping pods that the cluster uploaded.
+func (s *Server) GetCrashDiagnosticsBundle(ctx context.Context, req *vzmgrpb.GetCrashDiagnosticsBundleRequest) (*vzmgrpb.GetCrashDiagnosticsBundleResponse, error) {
+	if err := s.validateOrgOwnsCluster(ctx, req.VizierID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + crashDiagnosticsInfoColumns + `, bundle FROM vizier_crash_diagnostics
+              WHERE vizier_cluster_id=$1 AND name=$2`
+	var row struct {
+		crashDiagnosticsInfo
+		Bundle []byte `db:"bundle"`
+	}
+	err := s.db.GetContext(ctx, &row, query, utils.UUIDFromProtoOrNil(req.VizierID), req.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.NotFound, "crash diagnostics bundle not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to query crash diagnostics")
+		return nil, status.Error(codes.Internal, "failed to query crash diagnostics")
+	}
+	return &vzmgrpb.GetCrashDiagnosticsBundleResponse{
+		Info:   row.crashDiagnosticsInfo.toProto(),
+		Bundle: row.Bundle,
+	}, nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/vzmgr/controllers"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/utils"
+)
+
+func crashDiagnosticsMessage(t *testing.T, vizierID string, name string, capturedAt time.Time) *cvmsgspb.V2CMessage {
+	capturedAtPb, err := types.TimestampProto(capturedAt)
+	require.NoError(t, err)
+	anyMsg, err := types.MarshalAny(&cvmsgspb.CrashDiagnosticsBundle{
+		Name:       name,
+		Reason:     "PodsOOMKilled",
+		CapturedAt: capturedAtPb,
+		Containers: []string{"vizier-pem-abc/pem"},
+		Bundle:     []byte("bundle of " + name),
+	})
+	require.NoError(t, err)
+	return &cvmsgspb.V2CMessage{VizierID: vizierID, Msg: anyMsg}
+}
+
+func TestServer_HandleCrashDiagnostics(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", nil, nil)
+
+	start := time.Date(2023, 10, 4, 12, 0, 0, 0, time.UTC)
+	// Upload more bundles than are kept, so that the oldest are deleted.
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("crash-%02d", i)
+		s.HandleCrashDiagnostics(crashDiagnosticsMessage(t, testHealthyClusterID, name, start.Add(time.Duration(i)*time.Hour)))
+	}
+
+	resp, err := s.ListCrashDiagnostics(CreateTestContext(), utils.ProtoFromUUIDStrOrNil(testHealthyClusterID))
+	require.NoError(t, err)
+	require.Len(t, resp.Bundles, 10)
+	assert.Equal(t, "crash-11", resp.Bundles[0].Name)
+	assert.Equal(t, "crash-02", resp.Bundles[9].Name)
+	assert.Equal(t, "PodsOOMKilled", resp.Bundles[0].Reason)
+	assert.Equal(t, []string{"vizier-pem-abc/pem"}, resp.Bundles[0].Containers)
+	assert.Equal(t, int64(len("bundle of crash-11")), resp.Bundles[0].SizeBytes)
+
+	bundle, err := s.GetCrashDiagnosticsBundle(CreateTestContext(), &vzmgrpb.GetCrashDiagnosticsBundleRequest{
+		VizierID: utils.ProtoFromUUIDStrOrNil(testHealthyClusterID),
+		Name:     "crash-11",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bundle of crash-11"), bundle.Bundle)
+	assert.Equal(t, "crash-11", bundle.Info.Name)
+
+	_, err = s.GetCrashDiagnosticsBundle(CreateTestContext(), &vzmgrpb.GetCrashDiagnosticsBundleRequest{
+		VizierID: utils.ProtoFromUUIDStrOrNil(testHealthyClusterID),
+		Name:     "crash-00",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_ListCrashDiagnostics_OtherOrg(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", nil, nil)
+
+	_, err := s.ListCrashDiagnostics(CreateTestContext(), utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440003"))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,520 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	// How often the health of the clusters is sampled.
+	healthSampleInterval = time.Minute
+	// A cluster is considered down in a sample if it has not sent a heartbeat in this long. With 5 second
+	// heartbeats, this is 6 missed heartbeats.
+	missedHeartbeatThreshold = 30 * time.Second
+	// The state reported by a cluster is considered stale if the Vizier has not refreshed it in this long.
+	dataFreshnessThreshold = 5 * time.Minute
+	// How long the health samples are kept. This must be longer than the longest SLO window.
+	healthSampleRetention = 31 * 24 * time.Hour
+	// The default and maximum range of the health history.
+	defaultHealthHistoryRange = 24 * time.Hour
+	maxHealthHistoryRange     = 30 * 24 * time.Hour
+	// The default and maximum window that SLO alerts are evaluated over.
+	defaultSLOAlertWindow = time.Hour
+	maxSLOAlertWindow     = 7 * 24 * time.Hour
+)
+
+// sloWindows are the rolling windows that the health SLOs of a cluster are reported over.
+var sloWindows = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// healthStatsColumns aggregates the health samples of a cluster into healthStats.
+const healthStatsColumns = `COUNT(*) AS num_samples,
+  COUNT(*) FILTER (WHERE connected) AS num_connected,
+  COUNT(*) FILTER (WHERE data_fresh) AS num_fresh,
+  COALESCE(SUM(num_queries), 0) AS num_queries,
+  COALESCE(SUM(num_failed_queries), 0) AS num_failed_queries`
+
+// healthStats are the aggregated health samples of a cluster over a window of time.
+type healthStats struct {
+	NumSamples       int64 `db:"num_samples"`
+	NumConnected     int64 `db:"num_connected"`
+	NumFresh         int64 `db:"num_fresh"`
+	NumQueries       int64 `db:"num_queries"`
+	NumFailedQueries int64 `db:"num_failed_queries"`
+}
+
+func ratio(good, total int64) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(good) / float64(total)
+}
+
+func (h *healthStats) heartbeatUptime() float64 {
+	return ratio(h.NumConnected, h.NumSamples)
+}
+
+func (h *healthStats) querySuccessRate() float64 {
+	return ratio(h.NumQueries-h.NumFailedQueries, h.NumQueries)
+}
+
+func (h *healthStats) dataFreshness() float64 {
+	return ratio(h.NumFresh, h.NumSamples)
+}
+
+func (h *healthStats) toProto(start time.Time, window time.Duration) *vzmgrpb.VizierHealthSLOs {
+	startPb, _ := types.TimestampProto(start)
+	return &vzmgrpb.VizierHealthSLOs{
+		StartTime:        startPb,
+		WindowSeconds:    int64(window.Seconds()),
+		HeartbeatUptime:  h.heartbeatUptime(),
+		QuerySuccessRate: h.querySuccessRate(),
+		DataFreshness:    h.dataFreshness(),
+		NumSamples:       h.NumSamples,
+		NumQueries:       h.NumQueries,
+		NumFailedQueries: h.NumFailedQueries,
+	}
+}
+
+// GetVizierHealthSLOs gets the health SLOs of the cluster over each of the SLO windows.
+func (s *Server) GetVizierHealthSLOs(ctx context.Context, req *uuidpb.UUID) (*vzmgrpb.GetVizierHealthSLOsResponse, error) {
+	if err := s.validateOrgOwnsCluster(ctx, req); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + healthStatsColumns + ` FROM vizier_health_samples
+              WHERE vizier_cluster_id=$1 AND sampled_at > $2`
+	now := time.Now()
+	resp := &vzmgrpb.GetVizierHealthSLOsResponse{}
+	for _, window := range sloWindows {
+		start := now.Add(-window)
+		var stats healthStats
+		if err := s.db.GetContext(ctx, &stats, query, utils.UUIDFromProtoOrNil(req), start); err != nil {
+			log.WithError(err).Error("Failed to query vizier health samples")
+			return nil, status.Error(codes.Internal, "failed to query vizier health")
+		}
+		resp.SLOs = append(resp.SLOs, stats.toProto(start, window))
+	}
+	return resp, nil
+}
+
+// GetVizierHealthHistory gets the health of the cluster in each hour of the requested range.
+func (s *Server) GetVizierHealthHistory(ctx context.Context, req *vzmgrpb.GetVizierHealthHistoryRequest) (*vzmgrpb.GetVizierHealthHistoryResponse, error) {
+	if err := s.validateOrgOwnsCluster(ctx, req.VizierID); err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	if req.EndTime != nil {
+		t, err := types.TimestampFromProto(req.EndTime)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid end time")
+		}
+		end = t
+	}
+	start := end.Add(-defaultHealthHistoryRange)
+	if req.StartTime != nil {
+		t, err := types.TimestampFromProto(req.StartTime)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid start time")
+		}
+		start = t
+	}
+	if !start.Before(end) {
+		return nil, status.Error(codes.InvalidArgument, "start time must be before end time")
+	}
+	if end.Sub(start) > maxHealthHistoryRange {
+		return nil, status.Errorf(codes.InvalidArgument, "range must be at most %s", maxHealthHistoryRange)
+	}
+
+	query := `SELECT date_trunc('hour', sampled_at) AS bucket, ` + healthStatsColumns + `
+              FROM vizier_health_samples
+              WHERE vizier_cluster_id=$1 AND sampled_at >= $2 AND sampled_at < $3
+              GROUP BY bucket ORDER BY bucket`
+	rows, err := s.db.QueryxContext(ctx, query, utils.UUIDFromProtoOrNil(req.VizierID), start, end)
+	if err != nil {
+		log.WithError(err).Error("Failed to query vizier health history")
+		return nil, status.Error(codes.Internal, "failed to query vizier health history")
+	}
+	defer rows.Close()
+
+	resp := &vzmgrpb.GetVizierHealthHistoryResponse{}
+	for rows.Next() {
+		var bucket struct {
+			Bucket time.Time `db:"bucket"`
+			healthStats
+		}
+		if err := rows.StructScan(&bucket); err != nil {
+			log.WithError(err).Error("Failed to read vizier health history")
+			return nil, status.Error(codes.Internal, "failed to read vizier health history")
+		}
+		resp.Buckets = append(resp.Buckets, bucket.toProto(bucket.Bucket, time.Hour))
+	}
+	return resp, nil
+}
+
+// sloAlertConfig is the SLO alert config of an org, as stored in the database.
+type sloAlertConfig struct {
+	OrgID                  uuid.UUID `db:"org_id"`
+	WebhookURL             string    `db:"webhook_url"`
+	WindowSeconds          int64     `db:"window_seconds"`
+	HeartbeatUptimeTarget  float64   `db:"heartbeat_uptime_target"`
+	QuerySuccessRateTarget float64   `db:"query_success_rate_target"`
+	DataFreshnessTarget    float64   `db:"data_freshness_target"`
+}
+
+func (c *sloAlertConfig) toProto() *vzmgrpb.SLOAlertConfig {
+	return &vzmgrpb.SLOAlertConfig{
+		OrgID:                  utils.ProtoFromUUID(c.OrgID),
+		WebhookURL:             c.WebhookURL,
+		WindowSeconds:          c.WindowSeconds,
+		HeartbeatUptimeTarget:  c.HeartbeatUptimeTarget,
+		QuerySuccessRateTarget: c.QuerySuccessRateTarget,
+		DataFreshnessTarget:    c.DataFreshnessTarget,
+	}
+}
+
+// violations returns a description of each SLO of the stats that is below its target.
+func (c *sloAlertConfig) violations(stats *healthStats) []string {
+	var violations []string
+	check := func(name string, value, target float64) {
+		if value < target {
+			violations = append(violations, fmt.Sprintf("%s is %.2f%%, below the target of %.2f%%", name, value*100, target*100))
+		}
+	}
+	check("heartbeat uptime", stats.heartbeatUptime(), c.HeartbeatUptimeTarget)
+	check("query success rate", stats.querySuccessRate(), c.QuerySuccessRateTarget)
+	check("data freshness", stats.dataFreshness(), c.DataFreshnessTarget)
+	return violations
+}
+
+// GetSLOAlertConfig gets the SLO alert config of the org.
+func (s *Server) GetSLOAlertConfig(ctx context.Context, req *uuidpb.UUID) (*vzmgrpb.SLOAlertConfig, error) {
+	if err := validateOrgID(ctx, req); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT org_id, webhook_url, window_seconds, heartbeat_uptime_target, query_success_rate_target,
+              data_freshness_target FROM vizier_slo_alert_configs WHERE org_id=$1`
+	var cfg sloAlertConfig
+	err := s.db.GetContext(ctx, &cfg, query, utils.UUIDFromProtoOrNil(req))
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "org has no SLO alert config")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to query SLO alert config")
+		return nil, status.Error(codes.Internal, "failed to query SLO alert config")
+	}
+	return cfg.toProto(), nil
+}
+
+// UpdateSLOAlertConfig creates or replaces the SLO alert config of the org.
+func (s *Server) UpdateSLOAlertConfig(ctx context.Context, req *vzmgrpb.SLOAlertConfig) (*vzmgrpb.SLOAlertConfig, error) {
+	if err := validateOrgID(ctx, req.OrgID); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(req.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, status.Error(codes.InvalidArgument, "webhook URL must be an http or https URL")
+	}
+	window := time.Duration(req.WindowSeconds) * time.Second
+	if window == 0 {
+		window = defaultSLOAlertWindow
+	}
+	if window < healthSampleInterval || window > maxSLOAlertWindow {
+		return nil, status.Errorf(codes.InvalidArgument, "window must be between %s and %s", healthSampleInterval, maxSLOAlertWindow)
+	}
+	for _, target := range []float64{req.HeartbeatUptimeTarget, req.QuerySuccessRateTarget, req.DataFreshnessTarget} {
+		if target < 0 || target > 1 {
+			return nil, status.Error(codes.InvalidArgument, "targets must be between 0 and 1")
+		}
+	}
+
+	cfg := &sloAlertConfig{
+		OrgID:                  utils.UUIDFromProtoOrNil(req.OrgID),
+		WebhookURL:             req.WebhookURL,
+		WindowSeconds:          int64(window.Seconds()),
+		HeartbeatUptimeTarget:  req.HeartbeatUptimeTarget,
+		QuerySuccessRateTarget: req.QuerySuccessRateTarget,
+		DataFreshnessTarget:    req.DataFreshnessTarget,
+	}
+	query := `INSERT INTO vizier_slo_alert_configs (org_id, webhook_url, window_seconds, heartbeat_uptime_target,
+                query_success_rate_target, data_freshness_target)
+              VALUES (:org_id, :webhook_url, :window_seconds, :heartbeat_uptime_target, :query_success_rate_target,
+                :data_freshness_target)
+              ON CONFLICT (org_id) DO UPDATE SET webhook_url=EXCLUDED.webhook_url,
+                window_seconds=EXCLUDED.window_seconds, heartbeat_uptime_target=EXCLUDED.heartbeat_uptime_target,
+                query_success_rate_target=EXCLUDED.query_success_rate_target,
+                data_freshness_target=EXCLUDED.data_freshness_target`
+	if _, err := s.db.NamedExecContext(ctx, query, cfg); err != nil {
+		log.WithError(err).Error("Failed to update SLO alert config")
+		return nil, status.Error(codes.Internal, "failed to update SLO alert config")
+	}
+	return cfg.toProto(), nil
+}
+
+// DeleteSLOAlertConfig deletes the SLO alert config of the org.
+func (s *Server) DeleteSLOAlertConfig(ctx context.Context, req *uuidpb.UUID) (*types.Empty, error) {
+	if err := validateOrgID(ctx, req); err != nil {
+		return nil, err
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req)
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM vizier_slo_alert_configs WHERE org_id=$1`, orgID); err != nil {
+		log.WithError(err).Error("Failed to delete SLO alert config")
+		return nil, status.Error(codes.Internal, "failed to delete SLO alert config")
+	}
+	// Clear the alert state, so that the clusters are alerted on afresh if the org configures alerts again.
+	query := `UPDATE vizier_cluster_info SET slo_degraded=false
+              WHERE vizier_cluster_id IN (SELECT id FROM vizier_cluster WHERE org_id=$1)`
+	if _, err := s.db.ExecContext(ctx, query, orgID); err != nil {
+		log.WithError(err).Error("Failed to reset SLO alert state")
+	}
+	return &types.Empty{}, nil
+}
+
+// SLOMonitor periodically samples the health of the vizier clusters, which their SLOs are computed from,
+// and alerts the orgs that configured it when their clusters degrade or recover.
+type SLOMonitor struct {
+	db     *sqlx.DB
+	clock  clock.Clock
+	client *http.Client
+	quitCh chan struct{}
+	once   sync.Once
+}
+
+// NewSLOMonitor creates a new SLOMonitor operating on the passed in DB and starts it.
+func NewSLOMonitor(db *sqlx.DB) *SLOMonitor {
+	return NewSLOMonitorWithClock(db, clock.New())
+}
+
+// NewSLOMonitorWithClock creates a new SLOMonitor which uses the given clock to schedule and timestamp samples.
+func NewSLOMonitorWithClock(db *sqlx.DB, clk clock.Clock) *SLOMonitor {
+	m := &SLOMonitor{
+		db:     db,
+		clock:  clk,
+		client: &http.Client{Timeout: 10 * time.Second},
+		quitCh: make(chan struct{}),
+	}
+	m.start()
+	return m
+}
+
+func (m *SLOMonitor) start() {
+	go func() {
+		tick := m.clock.NewTicker(healthSampleInterval)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-m.quitCh:
+				return
+			case <-tick.C():
+				m.SampleHealth()
+			}
+		}
+	}()
+}
+
+// Stop kills the SLO monitor.
+func (m *SLOMonitor) Stop() {
+	m.once.Do(func() {
+		close(m.quitCh)
+	})
+}
+
+// SampleHealth records a health sample for every cluster that has connected at least once, prunes the
+// expired samples, and sends the alerts for the clusters whose SLOs crossed their targets.
+func (m *SLOMonitor) SampleHealth() {
+	now := m.clock.Now()
+
+	// The counters are subtracted rather than reset, so that the ones counted by concurrent heartbeats
+	// are kept for the next sample.
+	query := `
+    WITH taken AS (
+      UPDATE vizier_cluster_info x
+      SET num_queries_since_sample = x.num_queries_since_sample - y.num_queries_since_sample,
+        num_failed_queries_since_sample = x.num_failed_queries_since_sample - y.num_failed_queries_since_sample,
+        num_bridge_reconnects_since_sample = x.num_bridge_reconnects_since_sample - y.num_bridge_reconnects_since_sample,
+        num_dropped_messages_since_sample = x.num_dropped_messages_since_sample - y.num_dropped_messages_since_sample
+      FROM (SELECT * FROM vizier_cluster_info WHERE last_heartbeat IS NOT NULL) y
+      WHERE x.vizier_cluster_id = y.vizier_cluster_id
+      RETURNING x.vizier_cluster_id, x.last_heartbeat, x.state_last_updated,
+        y.num_queries_since_sample AS num_queries, y.num_failed_queries_since_sample AS num_failed_queries,
+        y.num_bridge_reconnects_since_sample AS num_bridge_reconnects,
+        y.num_dropped_messages_since_sample AS num_dropped_messages)
+    INSERT INTO vizier_health_samples (vizier_cluster_id, sampled_at, connected, data_fresh, num_queries,
+      num_failed_queries, num_bridge_reconnects, num_dropped_messages)
+    SELECT vizier_cluster_id, $1, last_heartbeat > $2, last_heartbeat > $2 AND COALESCE(state_last_updated > $3, false),
+      num_queries, num_failed_queries, num_bridge_reconnects, num_dropped_messages
+    FROM taken
+    ON CONFLICT DO NOTHING`
+	res, err := m.db.Exec(query, now, now.Add(-missedHeartbeatThreshold), now.Add(-dataFreshnessThreshold))
+	if err != nil {
+		log.WithError(err).Error("Failed to sample vizier health, ignoring (will retry in next tick)")
+		return
+	}
+	numSampled, _ := res.RowsAffected()
+
+	_, err = m.db.Exec(`DELETE FROM vizier_health_samples WHERE sampled_at < $1`, now.Add(-healthSampleRetention))
+	if err != nil {
+		log.WithError(err).Error("Failed to prune vizier health samples")
+	}
+
+	m.evaluateAlerts(now)
+	log.WithField("num_sampled", numSampled).
+		WithField("sample_time", m.clock.Since(now)).
+		Trace("Vizier health sample complete")
+}
+
+// sloAlertRow is a cluster of an org that configured SLO alerts, with its health over the alert window.
+type sloAlertRow struct {
+	ClusterID   uuid.UUID `db:"id"`
+	ClusterName *string   `db:"cluster_name"`
+	SLODegraded bool      `db:"slo_degraded"`
+	sloAlertConfig
+	healthStats
+}
+
+func (m *SLOMonitor) evaluateAlerts(now time.Time) {
+	query := `SELECT c.id, c.cluster_name, i.slo_degraded, a.org_id, a.webhook_url, a.window_seconds,
+                a.heartbeat_uptime_target, a.query_success_rate_target, a.data_freshness_target, stats.*
+              FROM vizier_cluster AS c
+              JOIN vizier_cluster_info AS i ON i.vizier_cluster_id = c.id
+              JOIN vizier_slo_alert_configs AS a ON a.org_id = c.org_id
+              CROSS JOIN LATERAL (
+                SELECT ` + healthStatsColumns + ` FROM vizier_health_samples AS s
+                WHERE s.vizier_cluster_id = c.id AND s.sampled_at > $1 - a.window_seconds * INTERVAL '1 second'
+              ) AS stats`
+	var rows []*sloAlertRow
+	if err := m.db.Select(&rows, query, now); err != nil {
+		log.WithError(err).Error("Failed to evaluate SLO alerts")
+		return
+	}
+
+	for _, row := range rows {
+		// Clusters that have not been sampled in the window have nothing to alert on.
+		if row.NumSamples == 0 {
+			continue
+		}
+		violations := row.violations(&row.healthStats)
+		degraded := len(violations) > 0
+		if degraded == row.SLODegraded {
+			continue
+		}
+
+		if err := m.postAlert(row, violations); err != nil {
+			// The alert state is unchanged, so that the alert is retried in the next tick.
+			log.WithError(err).WithField("cluster_id", row.ClusterID).Error("Failed to send SLO alert")
+			continue
+		}
+		_, err := m.db.Exec(`UPDATE vizier_cluster_info SET slo_degraded=$1 WHERE vizier_cluster_id=$2`, degraded, row.ClusterID)
+		if err != nil {
+			log.WithError(err).WithField("cluster_id", row.ClusterID).Error("Failed to update SLO alert state")
+		}
+	}
+}
+
+// sloAlert is the body of an SLO alert. The text makes it compatible with Slack's incoming webhooks.
+type sloAlert struct {
+	Text             string   `json:"text"`
+	State            string   `json:"state"`
+	ClusterID        string   `json:"cluster_id"`
+	ClusterName      string   `json:"cluster_name"`
+	OrgID            string   `json:"org_id"`
+	WindowSeconds    int64    `json:"window_seconds"`
+	HeartbeatUptime  float64  `json:"heartbeat_uptime"`
+	QuerySuccessRate float64  `json:"query_success_rate"`
+	DataFreshness    float64  `json:"data_freshness"`
+	Violations       []string `json:"violations,omitempty"`
+}
+
+func newSLOAlert(row *sloAlertRow, violations []string) *sloAlert {
+	name := stringOrEmpty(row.ClusterName)
+	if name == "" {
+		name = row.ClusterID.String()
+	}
+	window := time.Duration(row.WindowSeconds) * time.Second
+	alert := &sloAlert{
+		State:            "recovered",
+		ClusterID:        row.ClusterID.String(),
+		ClusterName:      stringOrEmpty(row.ClusterName),
+		OrgID:            row.OrgID.String(),
+		WindowSeconds:    row.WindowSeconds,
+		HeartbeatUptime:  row.heartbeatUptime(),
+		QuerySuccessRate: row.querySuccessRate(),
+		DataFreshness:    row.dataFreshness(),
+		Violations:       violations,
+		Text:             fmt.Sprintf("Cluster %s meets its SLO targets again over the last %s.", name, window),
+	}
+	if len(violations) > 0 {
+		alert.State = "degraded"
+		alert.Text = fmt.Sprintf("Cluster %s is degraded over the last %s: ", name, window)
+		for i, v := range violations {
+			if i > 0 {
+				alert.Text += "; "
+			}
+			alert.Text += v
+		}
+		alert.Text += "."
+	}
+	return alert
+}
+
+func (m *SLOMonitor) postAlert(row *sloAlertRow, violations []string) error {
+	body, err := json.Marshal(newSLOAlert(row, violations))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, row.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/vzmgr/controllers"
+	mock_controllers "px.dev/pixie/src/cloud/vzmgr/controllers/mock"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const testHealthyClusterID = "123e4567-e89b-12d3-a456-426655440001"
+
+func mustInsertHealthSamples(t *testing.T, clusterID string, end time.Time, n int, disconnected int, numQueries int64, numFailed int64) {
+	query := `INSERT INTO vizier_health_samples (vizier_cluster_id, sampled_at, connected, data_fresh, num_queries,
+              num_failed_queries) VALUES ($1, $2, $3, $4, $5, $6)`
+	for i := 0; i < n; i++ {
+		connected := i >= disconnected
+		var queries, failed int64
+		if i == n-1 {
+			queries, failed = numQueries, numFailed
+		}
+		_, err := db.Exec(query, clusterID, end.Add(-time.Duration(i)*time.Minute), connected, connected, queries, failed)
+		require.NoError(t, err)
+	}
+}
+
+func TestSLOMonitor_SampleHealth(t *testing.T) {
+	mustLoadTestData(db)
+
+	now := time.Now()
+	_, err := db.Exec(`UPDATE vizier_cluster_info SET last_heartbeat=$1, state_last_updated=$1,
+                       num_queries_since_sample=10, num_failed_queries_since_sample=2,
+                       num_bridge_reconnects_since_sample=3, num_dropped_messages_since_sample=4 WHERE vizier_cluster_id=$2`,
+		now, testHealthyClusterID)
+	require.NoError(t, err)
+
+	m := controllers.NewSLOMonitor(db)
+	defer m.Stop()
+	m.SampleHealth()
+
+	var sample struct {
+		Connected           bool  `db:"connected"`
+		DataFresh           bool  `db:"data_fresh"`
+		NumQueries          int64 `db:"num_queries"`
+		NumFailedQueries    int64 `db:"num_failed_queries"`
+		NumBridgeReconnects int64 `db:"num_bridge_reconnects"`
+		NumDroppedMessages  int64 `db:"num_dropped_messages"`
+	}
+	query := `SELECT connected, data_fresh, num_queries, num_failed_queries, num_bridge_reconnects, num_dropped_messages
+            FROM vizier_health_samples WHERE vizier_cluster_id=$1`
+	require.NoError(t, db.Get(&sample, query, testHealthyClusterID))
+	assert.True(t, sample.Connected)
+	assert.True(t, sample.DataFresh)
+	assert.Equal(t, int64(10), sample.NumQueries)
+	assert.Equal(t, int64(2), sample.NumFailedQueries)
+	assert.Equal(t, int64(3), sample.NumBridgeReconnects)
+	assert.Equal(t, int64(4), sample.NumDroppedMessages)
+
+	// The cluster has not sent a heartbeat since 2011.
+	require.NoError(t, db.Get(&sample, query, "123e4567-e89b-12d3-a456-426655440002"))
+	assert.False(t, sample.Connected)
+	assert.False(t, sample.DataFresh)
+
+	var numQueries int64
+	require.NoError(t, db.Get(&numQueries, `SELECT num_queries_since_sample FROM vizier_cluster_info WHERE vizier_cluster_id=$1`, testHealthyClusterID))
+	assert.Equal(t, int64(0), numQueries)
+}
+
+func TestServer_GetVizierHealthSLOs(t *testing.T) {
+	mustLoadTestData(db)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	s := controllers.New(db, "test", nc, mock_controllers.NewMockVzUpdater(ctrl))
+
+	// An hour of samples, in which the cluster was disconnected for 6 minutes.
+	mustInsertHealthSamples(t, testHealthyClusterID, time.Now(), 60, 6, 200, 10)
+	// A day earlier, the cluster was down.
+	mustInsertHealthSamples(t, testHealthyClusterID, time.Now().Add(-25*time.Hour), 60, 60, 0, 0)
+
+	resp, err := s.GetVizierHealthSLOs(CreateTestContext(), utils.ProtoFromUUIDStrOrNil(testHealthyClusterID))
+	require.NoError(t, err)
+	require.Len(t, resp.SLOs, 4)
+
+	hour := resp.SLOs[0]
+	assert.Equal(t, int64(3600), hour.WindowSeconds)
+	assert.Equal(t, int64(60), hour.NumSamples)
+	assert.InDelta(t, 0.9, hour.HeartbeatUptime, 0.0001)
+	assert.InDelta(t, 0.95, hour.QuerySuccessRate, 0.0001)
+	assert.InDelta(t, 0.9, hour.DataFreshness, 0.0001)
+
+	week := resp.SLOs[2]
+	assert.Equal(t, int64(120), week.NumSamples)
+	assert.InDelta(t, 0.45, week.HeartbeatUptime, 0.0001)
+}
+
+func TestServer_GetVizierHealthSLOs_OtherOrg(t *testing.T) {
+	mustLoadTestData(db)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	s := controllers.New(db, "test", nc, mock_controllers.NewMockVzUpdater(ctrl))
+
+	_, err := s.GetVizierHealthSLOs(CreateTestContext(), utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440003"))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_UpdateSLOAlertConfig(t *testing.T) {
+	mustLoadTestData(db)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	s := controllers.New(db, "test", nc, mock_controllers.NewMockVzUpdater(ctrl))
+	ctx := CreateTestContext()
+	orgID := utils.ProtoFromUUIDStrOrNil(testAuthOrgID)
+
+	_, err := s.GetSLOAlertConfig(ctx, orgID)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = s.UpdateSLOAlertConfig(ctx, &vzmgrpb.SLOAlertConfig{
+		OrgID:                 orgID,
+		WebhookURL:            "https://hooks.example.com/abc",
+		HeartbeatUptimeTarget: 1.5,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	cfg, err := s.UpdateSLOAlertConfig(ctx, &vzmgrpb.SLOAlertConfig{
+		OrgID:                  orgID,
+		WebhookURL:             "https://hooks.example.com/abc",
+		HeartbeatUptimeTarget:  0.99,
+		QuerySuccessRateTarget: 0.95,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3600), cfg.WindowSeconds)
+
+	fetched, err := s.GetSLOAlertConfig(ctx, orgID)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, fetched)
+
+	_, err = s.DeleteSLOAlertConfig(ctx, orgID)
+	require.NoError(t, err)
+	_, err = s.GetSLOAlertConfig(ctx, orgID)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSLOMonitor_Alerts(t *testing.T) {
+	mustLoadTestData(db)
+
+	var mu sync.Mutex
+	alerts := make(map[string][]string)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert struct {
+			State     string `json:"state"`
+			ClusterID string `json:"cluster_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		alerts[alert.ClusterID] = append(alerts[alert.ClusterID], alert.State)
+	}))
+	defer webhook.Close()
+
+	// Only alert on the query success rate, since the other clusters in the test data are not sending heartbeats.
+	_, err := db.Exec(`INSERT INTO vizier_slo_alert_configs (org_id, webhook_url, window_seconds, heartbeat_uptime_target,
+                       query_success_rate_target, data_freshness_target) VALUES ($1, $2, 3600, 0, 0.9, 0)`,
+		testAuthOrgID, webhook.URL)
+	require.NoError(t, err)
+	mustInsertHealthSamples(t, testHealthyClusterID, time.Now().Add(-time.Minute), 10, 0, 100, 50)
+
+	m := controllers.NewSLOMonitor(db)
+	defer m.Stop()
+	m.SampleHealth()
+	// The cluster is still degraded, so it is not alerted on again.
+	m.SampleHealth()
+
+	mu.Lock()
+	assert.Equal(t, []string{"degraded"}, alerts[testHealthyClusterID])
+	mu.Unlock()
+
+	var degraded bool
+	require.NoError(t, db.Get(&degraded, `SELECT slo_degraded FROM vizier_cluster_info WHERE vizier_cluster_id=$1`, testHealthyClusterID))
+	assert.True(t, degraded)
+
+	// Once the queries succeed again, the cluster recovers.
+	_, err = db.Exec(`UPDATE vizier_health_samples SET num_failed_queries=0 WHERE vizier_cluster_id=$1`, testHealthyClusterID)
+	require.NoError(t, err)
+	m.SampleHealth()
+
+	mu.Lock()
+	assert.Equal(t, []string{"degraded", "recovered"}, alerts[testHealthyClusterID])
+	mu.Unlock()
+}
@@ -0,0 +1,348 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/utils"
+)
+
+// clusterLabels is the type to use in sqlx for the labels of a cluster.
+type clusterLabels map[string]string
+
+// Value returns a golang database/sql driver value for clusterLabels.
+func (l clusterLabels) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan scans the sqlx database type ([]bytes) into the clusterLabels type.
+func (l *clusterLabels) Scan(src interface{}) error {
+	jsonText, ok := src.([]byte)
+	if !ok {
+		return status.Error(codes.Internal, "could not unmarshal cluster labels")
+	}
+	if err := json.Unmarshal(jsonText, l); err != nil {
+		return status.Error(codes.Internal, "could not unmarshal cluster labels")
+	}
+	return nil
+}
+
+// inventoryCluster is a cluster in an exported or imported cluster inventory.
+type inventoryCluster struct {
+	ID              string        `json:"id,omitempty"`
+	ClusterName     string        `json:"cluster_name"`
+	ClusterUID      string        `json:"cluster_uid,omitempty"`
+	Status          string        `json:"status,omitempty"`
+	PreRegistered   bool          `json:"pre_registered,omitempty"`
+	VizierVersion   string        `json:"vizier_version,omitempty"`
+	OperatorVersion string        `json:"operator_version,omitempty"`
+	ClusterVersion  string        `json:"cluster_version,omitempty"`
+	NumNodes        int32         `json:"num_nodes,omitempty"`
+	LastHeartbeat   string        `json:"last_heartbeat,omitempty"`
+	Labels          clusterLabels `json:"labels,omitempty"`
+}
+
+// inventoryColumns are the columns of a CSV cluster inventory, in the order in which they are exported.
+var inventoryColumns = []string{
+	"id", "cluster_name", "cluster_uid", "status", "pre_registered", "vizier_version", "operator_version",
+	"cluster_version", "num_nodes", "last_heartbeat", "labels",
+}
+
+func formatLabels(labels clusterLabels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func parseLabels(s string) (clusterLabels, error) {
+	labels := make(clusterLabels)
+	if strings.TrimSpace(s) == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q is not of the form key=value", pair)
+		}
+		labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
+
+func encodeClusterInventory(clusters []*inventoryCluster, format vzmgrpb.ClusterInventoryFormat) ([]byte, error) {
+	switch format {
+	case vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON:
+		if clusters == nil {
+			clusters = []*inventoryCluster{}
+		}
+		return json.MarshalIndent(clusters, "", "  ")
+	case vzmgrpb.CLUSTER_INVENTORY_FORMAT_CSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write(inventoryColumns)
+		for _, c := range clusters {
+			_ = w.Write([]string{
+				c.ID, c.ClusterName, c.ClusterUID, c.Status, strconv.FormatBool(c.PreRegistered), c.VizierVersion,
+				c.OperatorVersion, c.ClusterVersion, strconv.Itoa(int(c.NumNodes)), c.LastHeartbeat, formatLabels(c.Labels),
+			})
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	}
+	return nil, fmt.Errorf("unsupported inventory format %s", format)
+}
+
+// decodeClusterInventory decodes the names and labels of the clusters in an inventory. The other fields are ignored,
+// so that an exported inventory can be imported as is.
+func decodeClusterInventory(data []byte, format vzmgrpb.ClusterInventoryFormat) ([]*inventoryCluster, error) {
+	switch format {
+	case vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON:
+		var clusters []*inventoryCluster
+		if err := json.Unmarshal(data, &clusters); err != nil {
+			return nil, fmt.Errorf("invalid JSON inventory: %w", err)
+		}
+		for i, c := range clusters {
+			if c == nil {
+				return nil, fmt.Errorf("cluster %d: must be an object", i)
+			}
+			clusters[i] = &inventoryCluster{ClusterName: c.ClusterName, Labels: c.Labels}
+		}
+		return clusters, nil
+	case vzmgrpb.CLUSTER_INVENTORY_FORMAT_CSV:
+		r := csv.NewReader(bytes.NewReader(data))
+		header, err := r.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV inventory: %w", err)
+		}
+		nameCol, labelsCol := -1, -1
+		for i, col := range header {
+			switch strings.TrimSpace(col) {
+			case "cluster_name":
+				nameCol = i
+			case "labels":
+				labelsCol = i
+			}
+		}
+		if nameCol == -1 {
+			return nil, errors.New("invalid CSV inventory: the header has no cluster_name column")
+		}
+		var clusters []*inventoryCluster
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				return clusters, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid CSV inventory: %w", err)
+			}
+			c := &inventoryCluster{ClusterName: record[nameCol]}
+			if labelsCol != -1 {
+				line, _ := r.FieldPos(labelsCol)
+				if c.Labels, err = parseLabels(record[labelsCol]); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+			clusters = append(clusters, c)
+		}
+	}
+	return nil, fmt.Errorf("unsupported inventory format %s", format)
+}
+
+// validateInventoryClusters checks that the imported clusters can be registered with their names and labels.
+func validateInventoryClusters(clusters []*inventoryCluster) error {
+	seen := make(map[string]bool)
+	for i, c := range clusters {
+		if c.ClusterName == "" || c.ClusterName != strings.TrimSpace(c.ClusterName) {
+			return fmt.Errorf("cluster %d: cluster_name must be set, without leading or trailing whitespace", i)
+		}
+		if seen[c.ClusterName] {
+			return fmt.Errorf("cluster %q is in the inventory more than once", c.ClusterName)
+		}
+		seen[c.ClusterName] = true
+		for k, v := range c.Labels {
+			// Labels are exported as comma separated key=value pairs, so they can't contain those characters.
+			if k == "" || strings.ContainsAny(k, "=,") || strings.Contains(v, ",") {
+				return fmt.Errorf("cluster %q: label %q=%q is invalid. Keys must not be empty or contain ',' or '=', and values must not contain ','", c.ClusterName, k, v)
+			}
+		}
+	}
+	return nil
+}
+
+type inventoryRow struct {
+	ID              uuid.UUID     `db:"id"`
+	ClusterName     *string       `db:"cluster_name"`
+	ClusterUID      *string       `db:"cluster_uid"`
+	Labels          clusterLabels `db:"labels"`
+	PreRegistered   bool          `db:"pre_registered"`
+	Status          vizierStatus  `db:"status"`
+	VizierVersion   *string       `db:"vizier_version"`
+	OperatorVersion *string       `db:"operator_version"`
+	ClusterVersion  *string       `db:"cluster_version"`
+	NumNodes        int32         `db:"num_nodes"`
+	LastHeartbeat   *time.Time    `db:"last_heartbeat"`
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ExportClusterInventory exports all of the org's clusters in the requested format.
+func (s *Server) ExportClusterInventory(ctx context.Context, req *vzmgrpb.ExportClusterInventoryRequest) (*vzmgrpb.ExportClusterInventoryResponse, error) {
+	if err := validateOrgID(ctx, req.OrgID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT c.id, c.cluster_name, c.cluster_uid, c.labels, c.pre_registered, i.status, i.vizier_version,
+              i.operator_version, i.cluster_version, i.num_nodes, i.last_heartbeat
+              FROM vizier_cluster AS c, vizier_cluster_info AS i
+              WHERE i.vizier_cluster_id=c.id AND c.org_id=$1
+              ORDER BY c.cluster_name`
+	rows, err := s.db.QueryxContext(ctx, query, utils.UUIDFromProtoOrNil(req.OrgID))
+	if err != nil {
+		log.WithError(err).Error("Failed to query cluster inventory")
+		return nil, status.Error(codes.Internal, "failed to query cluster inventory")
+	}
+	defer rows.Close()
+
+	var clusters []*inventoryCluster
+	for rows.Next() {
+		var row inventoryRow
+		if err := rows.StructScan(&row); err != nil {
+			log.WithError(err).Error("Failed to read cluster inventory")
+			return nil, status.Error(codes.Internal, "failed to read cluster inventory")
+		}
+		c := &inventoryCluster{
+			ID:              row.ID.String(),
+			ClusterName:     stringOrEmpty(row.ClusterName),
+			ClusterUID:      stringOrEmpty(row.ClusterUID),
+			Status:          row.Status.Stringify(),
+			PreRegistered:   row.PreRegistered,
+			VizierVersion:   stringOrEmpty(row.VizierVersion),
+			OperatorVersion: stringOrEmpty(row.OperatorVersion),
+			ClusterVersion:  stringOrEmpty(row.ClusterVersion),
+			NumNodes:        row.NumNodes,
+			Labels:          row.Labels,
+		}
+		if row.LastHeartbeat != nil {
+			c.LastHeartbeat = row.LastHeartbeat.UTC().Format(time.RFC3339)
+		}
+		clusters = append(clusters, c)
+	}
+
+	inventory, err := encodeClusterInventory(clusters, req.Format)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &vzmgrpb.ExportClusterInventoryResponse{Inventory: inventory}, nil
+}
+
+// ImportClusterInventory pre-registers the clusters in the inventory that don't exist yet, and replaces the labels
+// of the ones that do. Either all of the clusters are imported, or none are.
+func (s *Server) ImportClusterInventory(ctx context.Context, req *vzmgrpb.ImportClusterInventoryRequest) (*vzmgrpb.ImportClusterInventoryResponse, error) {
+	if err := validateOrgID(ctx, req.OrgID); err != nil {
+		return nil, err
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+
+	clusters, err := decodeClusterInventory(req.Inventory, req.Format)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateInventoryClusters(clusters); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to import cluster inventory")
+	}
+	defer tx.Rollback()
+
+	resp := &vzmgrpb.ImportClusterInventoryResponse{}
+	for _, c := range clusters {
+		var clusterID uuid.UUID
+		query := `SELECT id FROM vizier_cluster WHERE org_id=$1 AND cluster_name=$2`
+		err := tx.QueryRowxContext(ctx, query, orgID, c.ClusterName).Scan(&clusterID)
+		switch {
+		case err == sql.ErrNoRows:
+			query = `
+        WITH ins AS (
+          INSERT INTO vizier_cluster (org_id, project_name, cluster_name, labels, pre_registered) VALUES($1, $2, $3, $4, true) RETURNING id
+        )
+        INSERT INTO vizier_cluster_info(vizier_cluster_id, status) SELECT id, 'DISCONNECTED' FROM ins`
+			_, err = tx.ExecContext(ctx, query, orgID, DefaultProjectName, c.ClusterName, c.Labels)
+			resp.Created = append(resp.Created, c.ClusterName)
+		case err == nil:
+			query = `UPDATE vizier_cluster SET labels=$1 WHERE id=$2`
+			_, err = tx.ExecContext(ctx, query, c.Labels, clusterID)
+			resp.Updated = append(resp.Updated, c.ClusterName)
+		}
+		if err != nil {
+			log.WithError(err).WithField("clusterName", c.ClusterName).Error("Failed to import cluster")
+			return nil, status.Error(codes.Internal, "failed to import cluster inventory")
+		}
+	}
+
+	if req.DryRun {
+		return resp, nil
+	}
+	if err := tx.Commit(); err != nil {
+		log.WithError(err).Error("Failed to commit cluster inventory")
+		return nil, status.Error(codes.Internal, "failed to import cluster inventory")
+	}
+	log.WithField("orgID", orgID).WithField("created", len(resp.Created)).WithField("updated", len(resp.Updated)).
+		Info("Imported cluster inventory")
+	return resp, nil
+}
@@ -45,7 +45,9 @@ import (
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/shared/messages"
 	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/cloud/shared/regions"
 	"px.dev/pixie/src/cloud/shared/vzshard"
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
 	"px.dev/pixie/src/cloud/vzmgr/vzerrors"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/cvmsgspb"
@@ -71,6 +73,8 @@ type Server struct {
 	dbKey   string
 	nc      *nats.Conn
 	updater VzUpdater
+	// regions steers viziers to the nearest healthy cloud region. Nil if Pixie Cloud runs in a single region.
+	regions *regions.Router
 
 	done chan struct{}
 	once sync.Once
@@ -98,11 +102,17 @@ func New(db *sqlx.DB, dbKey string, nc *nats.Conn, updater VzUpdater) *Server {
 
 	for _, shard := range vzshard.GenerateShardRange() {
 		s.startShardedHandler(shard, "heartbeat", s.HandleVizierHeartbeat)
+		s.startShardedHandler(shard, crashDiagnosticsTopic, s.HandleCrashDiagnostics)
 	}
 
 	return s
 }
 
+// SetRegionRouter steers the viziers that connect to the nearest healthy cloud region.
+func (s *Server) SetRegionRouter(r *regions.Router) {
+	s.regions = r
+}
+
 // Stop performs any necessary cleanup before shutdown.
 func (s *Server) Stop() {
 	s.once.Do(func() {
@@ -263,8 +273,23 @@ type VizierInfo struct {
 	OrgID                         uuid.UUID     `db:"org_id"`
 	PrevStatus                    *vizierStatus `db:"prev_status"`
 	PrevStatusTime                *time.Time    `db:"prev_status_time"`
+	NumSelfTestPassedNodes        int32         `db:"num_self_test_passed_nodes"`
+	FailedNodeSelfTests           NodeSelfTests `db:"failed_node_self_tests"`
+	BridgeRTTNs                   int64         `db:"bridge_rtt_ns"`
+	NumBridgeReconnectsLastHour   int64         `db:"num_bridge_reconnects_last_hour"`
+	NumDroppedMessagesLastHour    int64         `db:"num_dropped_messages_last_hour"`
 }
 
+// bridgeQualityColumns selects the quality of the bridge of the cluster info i. The counts over the last hour
+// include the ones that weren't sampled yet.
+const bridgeQualityColumns = `i.bridge_rtt_ns,
+              i.num_bridge_reconnects_since_sample + COALESCE((SELECT SUM(s.num_bridge_reconnects) FROM vizier_health_samples AS s
+                WHERE s.vizier_cluster_id = i.vizier_cluster_id AND s.sampled_at > now() - INTERVAL '1 hour'), 0)::bigint
+                AS num_bridge_reconnects_last_hour,
+              i.num_dropped_messages_since_sample + COALESCE((SELECT SUM(s.num_dropped_messages) FROM vizier_health_samples AS s
+                WHERE s.vizier_cluster_id = i.vizier_cluster_id AND s.sampled_at > now() - INTERVAL '1 hour'), 0)::bigint
+                AS num_dropped_messages_last_hour`
+
 func vizierInfoToProto(vzInfo VizierInfo) *cvmsgspb.VizierInfo {
 	clusterUID := ""
 	clusterName := ""
@@ -304,6 +329,10 @@ func vizierInfoToProto(vzInfo VizierInfo) *cvmsgspb.VizierInfo {
 	if vzInfo.PrevStatus != nil {
 		prevStatus = vzInfo.PrevStatus.ToProto()
 	}
+	var failedSelfTests []*cvmsgspb.NodeSelfTest
+	if len(vzInfo.FailedNodeSelfTests) > 0 {
+		failedSelfTests = vzInfo.FailedNodeSelfTests
+	}
 
 	return &cvmsgspb.VizierInfo{
 		VizierID:                      utils.ProtoFromUUID(vzInfo.ID),
@@ -322,6 +351,11 @@ func vizierInfoToProto(vzInfo VizierInfo) *cvmsgspb.VizierInfo {
 		NumInstrumentedNodes:          vzInfo.NumInstrumentedNodes,
 		PreviousStatus:                prevStatus,
 		PreviousStatusTime:            prevStatusTime,
+		NumSelfTestPassedNodes:        vzInfo.NumSelfTestPassedNodes,
+		FailedNodeSelfTests:           failedSelfTests,
+		BridgeRTTNs:                   vzInfo.BridgeRTTNs,
+		NumBridgeReconnectsLastHour:   vzInfo.NumBridgeReconnectsLastHour,
+		NumDroppedMessagesLastHour:    vzInfo.NumDroppedMessagesLastHour,
 	}
 }
 
@@ -345,7 +379,8 @@ func (s *Server) GetVizierInfos(ctx context.Context, req *vzmgrpb.GetVizierInfos
 	strQuery := `SELECT i.vizier_cluster_id, c.cluster_uid, c.cluster_name, i.cluster_version, i.operator_version, i.vizier_version,
 			  c.org_id, i.status, (EXTRACT(EPOCH FROM age(now(), i.last_heartbeat))*1E9)::bigint as last_heartbeat,
               i.control_plane_pod_statuses, i.unhealthy_data_plane_pod_statuses,
-							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time
+							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time,
+							i.num_self_test_passed_nodes, i.failed_node_self_tests, ` + bridgeQualityColumns + `
               FROM vizier_cluster_info as i, vizier_cluster as c
               WHERE i.vizier_cluster_id=c.id AND i.vizier_cluster_id IN (?) AND c.org_id=?`
 
@@ -397,7 +432,8 @@ func (s *Server) GetVizierInfo(ctx context.Context, req *uuidpb.UUID) (*cvmsgspb
 	query := `SELECT i.vizier_cluster_id, c.cluster_uid, c.cluster_name, i.cluster_version, i.operator_version, i.vizier_version,
 			  i.status, (EXTRACT(EPOCH FROM age(now(), i.last_heartbeat))*1E9)::bigint as last_heartbeat,
               i.control_plane_pod_statuses, i.unhealthy_data_plane_pod_statuses,
-							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time
+							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time,
+							i.num_self_test_passed_nodes, i.failed_node_self_tests, ` + bridgeQualityColumns + `
               from vizier_cluster_info as i, vizier_cluster as c
               WHERE i.vizier_cluster_id=$1 AND i.vizier_cluster_id=c.id`
 	vzInfo := VizierInfo{}
@@ -462,6 +498,13 @@ func (s *Server) GetVizierConnectionInfo(ctx context.Context, req *uuidpb.UUID)
 	// Generate a signed token for this cluster.
 	jwtKey := info.JWTSigningKey[SaltLength:]
 	claims := jwtutils.GenerateJWTForCluster("vizier_cluster", "vizier")
+	// The token carries the user that it was issued to, so that the cluster can apply their limits to their requests.
+	if sCtx, err := authcontext.FromContext(ctx); err == nil {
+		if userClaims := sCtx.Claims.GetUserClaims(); userClaims != nil {
+			claims.GetClusterClaims().RequesterOrgID = userClaims.OrgID
+			claims.GetClusterClaims().RequesterUserID = userClaims.UserID
+		}
+	}
 	tokenString, err := jwtutils.SignJWTClaims(claims, jwtKey)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to sign token: %s", err.Error())
@@ -604,9 +647,85 @@ func (s *Server) VizierConnected(ctx context.Context, req *cvmsgspb.RegisterVizi
 	if err != nil {
 		return nil, err
 	}
-	return &cvmsgspb.RegisterVizierAck{
+	ack := &cvmsgspb.RegisterVizierAck{
 		Status:     cvmsgspb.ST_OK,
 		VizierName: val.VizierName,
+	}
+	if s.regions != nil {
+		region := s.regions.Route(req.ClusterInfo.GetRegion())
+		ack.Region = region.Name
+		if region != s.regions.Local() {
+			loggerWithCtx.WithField("region", region.Name).Info("Redirecting Vizier to a nearer cloud region")
+			ack.RedirectAddr = region.VZConnAddr
+		}
+	}
+	return ack, nil
+}
+
+// StartBridgeSession authenticates the message that opens a bridge stream and returns the key that the rest of the
+// stream is signed with. This is intended to be for internal use only.
+func (s *Server) StartBridgeSession(ctx context.Context, req *vzmgrpb.StartBridgeSessionRequest) (*vzmgrpb.StartBridgeSessionResponse, error) {
+	msg := req.RegisterMsg
+	if msg == nil || msg.Msg == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing register message")
+	}
+	reg := &cvmsgspb.RegisterVizierRequest{}
+	if err := types.UnmarshalAny(msg.Msg, reg); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid register message")
+	}
+	vizierID := utils.UUIDFromProtoOrNil(reg.VizierID)
+	if vizierID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "failed to parse cluster id")
+	}
+
+	query := `SELECT PGP_SYM_DECRYPT(jwt_signing_key::bytea, $2) as jwt_signing_key from vizier_cluster_info WHERE vizier_cluster_id=$1`
+	var info struct {
+		JWTSigningKey *string `db:"jwt_signing_key"`
+	}
+	err := s.db.GetContext(ctx, &info, query, vizierID, s.dbKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "no such cluster")
+		}
+		return nil, err
+	}
+	// The stream must be signed with the key that the vizier registered with before. A vizier that has never
+	// registered has no key yet, so the key that it sends is trusted on first use.
+	jwtKey := reg.JwtKey
+	if info.JWTSigningKey != nil && len(*info.JWTSigningKey) > SaltLength {
+		jwtKey = (*info.JWTSigningKey)[SaltLength:]
+	}
+
+	verifier := bridgesig.NewV2CVerifier(bridgesig.DeriveKey(jwtKey, vizierID, msg.SessionId, nil), msg.SessionId, viper.GetBool("require_bridge_signatures"))
+	if err := verifier.VerifyV2C(msg); err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if len(msg.Signature) == 0 {
+		// Unsigned streams are allowed for viziers that predate signing.
+		return &vzmgrpb.StartBridgeSessionResponse{}, nil
+	}
+
+	// Only accept the register message once, so that it can't be replayed to open another stream.
+	query = `
+    UPDATE vizier_cluster_info
+    SET (bridge_session_id, bridge_seq_num) = ($2, $3)
+    WHERE vizier_cluster_id = $1
+      AND (bridge_session_id IS NULL OR bridge_session_id < $2 OR (bridge_session_id = $2 AND bridge_seq_num < $3))`
+	res, err := s.db.ExecContext(ctx, query, vizierID, msg.SessionId, int64(msg.SeqNum))
+	if err != nil {
+		return nil, err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return nil, status.Error(codes.PermissionDenied, "bridge session was already used")
+	}
+
+	nonce, err := bridgesig.NewNonce()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not create nonce")
+	}
+	return &vzmgrpb.StartBridgeSessionResponse{
+		Nonce:      nonce,
+		SessionKey: bridgesig.DeriveKey(jwtKey, vizierID, msg.SessionId, nonce),
 	}, nil
 }
 
@@ -621,6 +740,9 @@ func (s *Server) HandleVizierHeartbeat(v2cMsg *cvmsgspb.V2CMessage) {
 	}
 	vizierID := utils.UUIDFromProtoOrNil(req.VizierID)
 
+	// Ack the heartbeat right away, so that the Vizier can measure the round trip time of its bridge.
+	s.sendHeartbeatAck(vizierID, req.SequenceNumber)
+
 	// We want to detect when the record changes, so we need to exhaustively list all the columns except the
 	// heartbeat time and status.
 	// Note: We don't compare the json fields because they just contain details of the status fields.
@@ -628,7 +750,12 @@ func (s *Server) HandleVizierHeartbeat(v2cMsg *cvmsgspb.V2CMessage) {
 		UPDATE vizier_cluster_info x
 		SET last_heartbeat = $1, status = $2, control_plane_pod_statuses = CASE WHEN $11 THEN $3::json ELSE y.control_plane_pod_statuses END,
 			num_nodes = $4, num_instrumented_nodes = $5, auto_update_enabled = $6,
-			unhealthy_data_plane_pod_statuses = $7, cluster_version = $8, status_message = $9, operator_version = $12
+			unhealthy_data_plane_pod_statuses = $7, cluster_version = $8, status_message = $9, operator_version = $12,
+			num_self_test_passed_nodes = $13, failed_node_self_tests = $14, state_last_updated = $15,
+			num_queries_since_sample = x.num_queries_since_sample + $16,
+			num_failed_queries_since_sample = x.num_failed_queries_since_sample + $17, bridge_rtt_ns = $18,
+			num_bridge_reconnects_since_sample = x.num_bridge_reconnects_since_sample + $19,
+			num_dropped_messages_since_sample = x.num_dropped_messages_since_sample + $20
 		FROM (SELECT * FROM vizier_cluster_info WHERE vizier_cluster_id = $10) y
 		WHERE x.vizier_cluster_id = y.vizier_cluster_id
 		RETURNING (x.status != y.status
@@ -644,9 +771,17 @@ func (s *Server) HandleVizierHeartbeat(v2cMsg *cvmsgspb.V2CMessage) {
 		Version string `db:"vizier_version"`
 	}
 
+	var stateLastUpdated *time.Time
+	if req.PodStatusesLastUpdated > 0 {
+		t := time.Unix(0, req.PodStatusesLastUpdated)
+		stateLastUpdated = &t
+	}
+
 	rows, err := s.db.Queryx(query, time.Now(), vizierStatus(req.Status), PodStatuses(req.PodStatuses), req.NumNodes,
 		req.NumInstrumentedNodes, !req.DisableAutoUpdate, PodStatuses(req.UnhealthyDataPlanePodStatuses),
-		req.K8sClusterVersion, req.StatusMessage, vizierID, req.PodStatuses != nil, req.OperatorVersion)
+		req.K8sClusterVersion, req.StatusMessage, vizierID, req.PodStatuses != nil, req.OperatorVersion,
+		req.NumSelfTestPassedNodes, NodeSelfTests(req.FailedNodeSelfTests), stateLastUpdated, req.NumQueries,
+		req.NumFailedQueries, req.BridgeRTTNs, req.NumBridgeReconnects, req.NumDroppedMessages)
 	if err != nil {
 		log.WithError(err).Error("Could not update vizier heartbeat")
 		return
@@ -692,6 +827,27 @@ func (s *Server) HandleVizierHeartbeat(v2cMsg *cvmsgspb.V2CMessage) {
 	}
 }
 
+func (s *Server) sendHeartbeatAck(vizierID uuid.UUID, seqNum int64) {
+	ack, err := types.MarshalAny(&cvmsgspb.VizierHeartbeatAck{
+		Status:         cvmsgspb.HB_OK,
+		Time:           time.Now().UnixNano(),
+		SequenceNumber: seqNum,
+	})
+	if err != nil {
+		log.WithError(err).Error("Could not marshal heartbeat ack")
+		return
+	}
+	b, err := (&cvmsgspb.C2VMessage{VizierID: vizierID.String(), Msg: ack}).Marshal()
+	if err != nil {
+		log.WithError(err).Error("Could not marshal heartbeat ack")
+		return
+	}
+	err = s.nc.Publish(vzshard.C2VTopic("VizierHeartbeatAck", vizierID), b)
+	if err != nil {
+		log.WithError(err).Error("Could not publish heartbeat ack")
+	}
+}
+
 // getServiceCredentials returns JWT credentials for inter-service requests.
 func getServiceCredentials(signingKey string) (string, error) {
 	claims := jwtutils.GenerateJWTForService("vzmgr Service", viper.GetString("domain_name"))
@@ -748,6 +904,7 @@ func findVizierWithEmptyUID(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID) (
        AND vizier_cluster.org_id = $1
        AND (vizier_cluster.cluster_uid = ''
             OR vizier_cluster.cluster_uid IS NULL)
+       AND NOT vizier_cluster.pre_registered
     `
 
 	var vizierID uuid.UUID
@@ -771,6 +928,22 @@ func findVizierWithEmptyUID(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID) (
 	return uuid.Nil, vizierStatus(cvmsgspb.VZ_ST_UNKNOWN), nil
 }
 
+// findPreRegisteredVizier finds the cluster with the given name that was imported from an inventory, and has not
+// been claimed by a Vizier yet.
+func findPreRegisteredVizier(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, clusterName string) (uuid.UUID, error) {
+	query := `SELECT id from vizier_cluster WHERE org_id=$1 AND cluster_name=$2 AND pre_registered`
+
+	var vizierID uuid.UUID
+	err := tx.QueryRowxContext(ctx, query, orgID, clusterName).Scan(&vizierID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, vzerrors.ErrInternalDB
+	}
+	return vizierID, nil
+}
+
 func setClusterName(ctx context.Context, tx *sqlx.Tx, clusterID uuid.UUID, generateName func(i int) string) (string, error) {
 	// Retry a few times until we find a name that doesn't collide.
 	finalName := ""
@@ -821,6 +994,14 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 		return name
 	}
 
+	commit := func(name string) (uuid.UUID, string, error) {
+		if err := tx.Commit(); err != nil {
+			log.WithError(err).Error("Failed to commit transaction")
+			return uuid.Nil, "", vzerrors.ErrInternalDB
+		}
+		return clusterID, name, nil
+	}
+
 	assignNameAndCommit := func() (uuid.UUID, string, error) {
 		// Check if cluster already has a name.
 		var existingName *string
@@ -834,7 +1015,7 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 		if existingName != nil {
 			// No input name specified, so no need to change cluster name.
 			if inputName == "" {
-				return clusterID, *existingName, nil
+				return commit(*existingName)
 			}
 
 			// The existing name is already the same as the input name, or a derivation
@@ -845,14 +1026,14 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 			// cannot distinguish between randomly generated names and actual-unaltered names.
 			dbName := *existingName
 			if inputName == dbName {
-				return clusterID, *existingName, nil
+				return commit(*existingName)
 			}
 			prefixIndex := strings.LastIndex(dbName, "_")
 			if prefixIndex != -1 {
 				dbName = dbName[:prefixIndex]
 			}
 			if inputName == dbName {
-				return clusterID, *existingName, nil
+				return commit(*existingName)
 			}
 		}
 
@@ -889,9 +1070,29 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 		if status != vizierStatus(cvmsgspb.VZ_ST_DISCONNECTED) {
 			return uuid.Nil, "", vzerrors.ErrProvisionFailedVizierIsActive
 		}
+		// The cluster is being reinstalled, which generates a new signing key. Forget the old one so that the new
+		// one is accepted when the vizier registers.
+		query := `UPDATE vizier_cluster_info SET (jwt_signing_key, bridge_session_id, bridge_seq_num) = (NULL, NULL, NULL) WHERE vizier_cluster_id=$1`
+		if _, err := tx.ExecContext(ctx, query, clusterID); err != nil {
+			return uuid.Nil, "", vzerrors.ErrInternalDB
+		}
 		return assignNameAndCommit()
 	}
 
+	if inputName != "" {
+		clusterID, err = findPreRegisteredVizier(ctx, tx, orgID, inputName)
+		if err != nil {
+			return uuid.Nil, "", err
+		}
+		if clusterID != uuid.Nil {
+			query := `UPDATE vizier_cluster SET cluster_uid=$1, pre_registered=false WHERE id=$2`
+			if _, err := tx.ExecContext(ctx, query, clusterUID, clusterID); err != nil {
+				return uuid.Nil, "", vzerrors.ErrInternalDB
+			}
+			return assignNameAndCommit()
+		}
+	}
+
 	clusterID, _, err = findVizierWithEmptyUID(ctx, tx, orgID)
 	if err != nil {
 		return uuid.Nil, "", err
@@ -20,6 +20,7 @@ package controllers_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
@@ -42,6 +43,10 @@ import (
 
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/cloud/shared/regions"
+	"px.dev/pixie/src/cloud/shared/vzshard"
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
+	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/cloud/vzmgr/controllers"
 	mock_controllers "px.dev/pixie/src/cloud/vzmgr/controllers/mock"
 	"px.dev/pixie/src/cloud/vzmgr/schema"
@@ -117,6 +122,8 @@ func testMain(m *testing.M) error {
 }
 
 func mustLoadTestData(db *sqlx.DB) {
+	db.MustExec(`DELETE FROM vizier_slo_alert_configs`)
+	db.MustExec(`DELETE FROM vizier_crash_diagnostics`)
 	db.MustExec(`DELETE FROM vizier_cluster_info`)
 	db.MustExec(`DELETE FROM vizier_cluster`)
 
@@ -311,6 +318,10 @@ func TestServer_GetVizierConnectionInfo(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, []string{"cluster"}, srvutils.GetScopes(token))
+	claims, err := srvutils.TokenToProto(token)
+	require.NoError(t, err)
+	assert.Equal(t, testAuthOrgID, claims.GetClusterClaims().RequesterOrgID)
+	assert.Equal(t, "abcdef", claims.GetClusterClaims().RequesterUserID)
 }
 
 func TestServer_VizierConnectedHealthy(t *testing.T) {
@@ -378,6 +389,155 @@ func TestServer_VizierConnectedHealthy(t *testing.T) {
 	// TODO(zasgar): write more tests here.
 }
 
+func TestServer_VizierConnectedRedirectsToNearestRegion(t *testing.T) {
+	mustLoadTestData(db)
+
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	router, err := regions.NewRouter([]*regions.Region{
+		{Name: "us", VZConnAddr: "vzconn.us.example.com:443", Locations: []string{"us-*"}},
+		{Name: "eu", VZConnAddr: "vzconn.eu.example.com:443", Locations: []string{"europe-*"}},
+	}, "us")
+	require.NoError(t, err)
+
+	s := controllers.New(db, "test", nc, nil)
+	s.SetRegionRouter(router)
+
+	tests := []struct {
+		name         string
+		region       string
+		expected     string
+		redirectAddr string
+	}{
+		{"nearest region", "us-west1", "us", ""},
+		{"unknown location", "", "us", ""},
+		{"other region", "europe-west1", "eu", "vzconn.eu.example.com:443"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.VizierConnected(context.Background(), &cvmsgspb.RegisterVizierRequest{
+				VizierID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				JwtKey:   "the-token",
+				ClusterInfo: &cvmsgspb.VizierClusterInfo{
+					ClusterUID:    "cUID",
+					VizierVersion: "some version",
+					Region:        test.region,
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, cvmsgspb.ST_OK, resp.Status)
+			assert.Equal(t, test.expected, resp.Region)
+			assert.Equal(t, test.redirectAddr, resp.RedirectAddr)
+		})
+	}
+}
+
+func signedRegisterMsg(t *testing.T, jwtKey string, vizierID uuid.UUID, sessionID int64, signer *bridgesig.Signer) *vzconnpb.V2CBridgeMessage {
+	reg, err := types.MarshalAny(&cvmsgspb.RegisterVizierRequest{
+		VizierID: utils.ProtoFromUUID(vizierID),
+		JwtKey:   jwtKey,
+	})
+	require.NoError(t, err)
+	msg := &vzconnpb.V2CBridgeMessage{
+		Topic:     "register",
+		SessionId: sessionID,
+		Msg:       reg,
+	}
+	if signer != nil {
+		signer.SignV2C(msg)
+	}
+	return msg
+}
+
+func TestServer_StartBridgeSession(t *testing.T) {
+	mustLoadTestData(db)
+	viper.Set("require_bridge_signatures", true)
+
+	s := controllers.New(db, "test", nil, nil)
+	vizierID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+	signer := bridgesig.NewSigner(bridgesig.DeriveKey("key0", vizierID, 1, nil))
+
+	msg := signedRegisterMsg(t, "key0", vizierID, 1, signer)
+	resp, err := s.StartBridgeSession(context.Background(), &vzmgrpb.StartBridgeSessionRequest{RegisterMsg: msg})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Nonce)
+	assert.Equal(t, bridgesig.DeriveKey("key0", vizierID, 1, resp.Nonce), resp.SessionKey)
+
+	// The register message can't be replayed to open another stream.
+	_, err = s.StartBridgeSession(context.Background(), &vzmgrpb.StartBridgeSessionRequest{RegisterMsg: msg})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// A later message of the same session opens a new stream with a new nonce.
+	next, err := s.StartBridgeSession(context.Background(), &vzmgrpb.StartBridgeSessionRequest{
+		RegisterMsg: signedRegisterMsg(t, "key0", vizierID, 1, signer),
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, resp.Nonce, next.Nonce)
+}
+
+func TestServer_StartBridgeSession_Unauthenticated(t *testing.T) {
+	mustLoadTestData(db)
+	viper.Set("require_bridge_signatures", true)
+
+	s := controllers.New(db, "test", nil, nil)
+	vizierID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+
+	tests := []struct {
+		name string
+		msg  *vzconnpb.V2CBridgeMessage
+	}{
+		{
+			name: "unsigned",
+			msg:  signedRegisterMsg(t, "key0", vizierID, 1, nil),
+		},
+		{
+			// The key in the message must not be trusted once the vizier has registered a key.
+			name: "signed with another key",
+			msg:  signedRegisterMsg(t, "other-key", vizierID, 1, bridgesig.NewSigner(bridgesig.DeriveKey("other-key", vizierID, 1, nil))),
+		},
+		{
+			name: "signed for another session",
+			msg:  signedRegisterMsg(t, "key0", vizierID, 2, bridgesig.NewSigner(bridgesig.DeriveKey("key0", vizierID, 1, nil))),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.StartBridgeSession(context.Background(), &vzmgrpb.StartBridgeSessionRequest{RegisterMsg: test.msg})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+}
+
+func TestServer_StartBridgeSession_NewVizier(t *testing.T) {
+	mustLoadTestData(db)
+	viper.Set("require_bridge_signatures", true)
+	db.MustExec(`UPDATE vizier_cluster_info SET jwt_signing_key=NULL WHERE vizier_cluster_id=$1`, testExistingCluster)
+
+	s := controllers.New(db, "test", nil, nil)
+	vizierID := uuid.FromStringOrNil(testExistingCluster)
+	// A vizier that has no key yet is trusted with the key that it registers with.
+	msg := signedRegisterMsg(t, "new-key", vizierID, 1, bridgesig.NewSigner(bridgesig.DeriveKey("new-key", vizierID, 1, nil)))
+	resp, err := s.StartBridgeSession(context.Background(), &vzmgrpb.StartBridgeSessionRequest{RegisterMsg: msg})
+	require.NoError(t, err)
+	assert.Equal(t, bridgesig.DeriveKey("new-key", vizierID, 1, resp.Nonce), resp.SessionKey)
+}
+
+func TestServer_StartBridgeSession_SignaturesNotRequired(t *testing.T) {
+	mustLoadTestData(db)
+	viper.Set("require_bridge_signatures", false)
+	defer viper.Set("require_bridge_signatures", true)
+
+	s := controllers.New(db, "test", nil, nil)
+	vizierID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001")
+	resp, err := s.StartBridgeSession(context.Background(), &vzmgrpb.StartBridgeSessionRequest{
+		RegisterMsg: signedRegisterMsg(t, "key0", vizierID, 1, nil),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Nonce)
+	assert.Empty(t, resp.SessionKey)
+}
+
 func TestServer_HandleVizierHeartbeat(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -410,18 +570,30 @@ func TestServer_HandleVizierHeartbeat(t *testing.T) {
 		disableAutoUpdate               bool
 		status                          cvmsgspb.VizierStatus
 		statusMessage                   string
+		numSelfTestPassedNodes          int32
+		failedNodeSelfTests             controllers.NodeSelfTests
 	}{
 		{
-			name:                            "valid vizier",
-			status:                          cvmsgspb.VZ_ST_HEALTHY,
-			vizierID:                        "123e4567-e89b-12d3-a456-426655440001",
-			updatedClusterStatus:            "HEALTHY",
-			controlPlanePodStatuses:         testPodStatuses,
-			unhealthyDataPlanePodStatuses:   testDataPlanePodStatuses,
-			clusterVersion:                  "v1.20.1",
-			operatorVersion:                 "0.0.30",
-			numNodes:                        4,
-			numInstrumentedNodes:            3,
+			name:                          "valid vizier",
+			status:                        cvmsgspb.VZ_ST_HEALTHY,
+			vizierID:                      "123e4567-e89b-12d3-a456-426655440001",
+			updatedClusterStatus:          "HEALTHY",
+			controlPlanePodStatuses:       testPodStatuses,
+			unhealthyDataPlanePodStatuses: testDataPlanePodStatuses,
+			clusterVersion:                "v1.20.1",
+			operatorVersion:               "0.0.30",
+			numNodes:                      4,
+			numInstrumentedNodes:          3,
+			numSelfTestPassedNodes:        2,
+			failedNodeSelfTests: controllers.NodeSelfTests{
+				{
+					Hostname: "node-3",
+					Checks: []*cvmsgspb.SelfTestCheck{
+						{Name: "http_tracing", Passed: false, Message: "no http_events records were collected"},
+					},
+					LastRunNS: 100,
+				},
+			},
 			checkVersion:                    true,
 			checkDB:                         true,
 			statusMessage:                   "test",
@@ -522,6 +694,10 @@ func TestServer_HandleVizierHeartbeat(t *testing.T) {
 				NumInstrumentedNodes:          tc.numInstrumentedNodes,
 				DisableAutoUpdate:             tc.disableAutoUpdate,
 				StatusMessage:                 tc.statusMessage,
+				NumSelfTestPassedNodes:        tc.numSelfTestPassedNodes,
+				FailedNodeSelfTests:           tc.failedNodeSelfTests,
+				BridgeRTTNs:                   5000000,
+				NumBridgeReconnects:           1,
 			}
 			nestedAny, err := types.MarshalAny(nestedMsg)
 			if err != nil {
@@ -536,27 +712,45 @@ func TestServer_HandleVizierHeartbeat(t *testing.T) {
 			err = db.Get(&heartbeatTime, `SELECT NOW()`)
 			require.NoError(t, err)
 
+			ackSub, err := nc.SubscribeSync(vzshard.C2VTopic("VizierHeartbeatAck", uuid.FromStringOrNil(tc.vizierID)))
+			require.NoError(t, err)
+			defer func() { _ = ackSub.Unsubscribe() }()
+
 			s.HandleVizierHeartbeat(req)
 
+			// The heartbeat is acked, so that the vizier can measure the round trip time of its bridge.
+			ackMsg, err := ackSub.NextMsg(time.Second)
+			require.NoError(t, err)
+			c2vMsg := &cvmsgspb.C2VMessage{}
+			require.NoError(t, c2vMsg.Unmarshal(ackMsg.Data))
+			ack := &cvmsgspb.VizierHeartbeatAck{}
+			require.NoError(t, types.UnmarshalAny(c2vMsg.Msg, ack))
+			assert.Equal(t, int64(200), ack.SequenceNumber)
+
 			// Check database.
 			clusterQuery := `
 			SELECT status, last_heartbeat, control_plane_pod_statuses, num_nodes, num_instrumented_nodes,
 			auto_update_enabled, unhealthy_data_plane_pod_statuses, prev_status,
-			prev_status_time, cluster_version, operator_version, status_message
+			prev_status_time, cluster_version, operator_version, status_message,
+			num_self_test_passed_nodes, failed_node_self_tests, bridge_rtt_ns, num_bridge_reconnects_since_sample
 			FROM vizier_cluster_info WHERE vizier_cluster_id=$1`
 			var clusterInfo struct {
-				Status                        string                  `db:"status"`
-				LastHeartbeat                 time.Time               `db:"last_heartbeat"`
-				PrevStatus                    *string                 `db:"prev_status"`
-				PrevStatusTime                *time.Time              `db:"prev_status_time"`
-				ClusterVersion                *string                 `db:"cluster_version"`
-				OperatorVersion               *string                 `db:"operator_version"`
-				ControlPlanePodStatuses       controllers.PodStatuses `db:"control_plane_pod_statuses"`
-				UnhealthyDataPlanePodStatuses controllers.PodStatuses `db:"unhealthy_data_plane_pod_statuses"`
-				NumNodes                      int32                   `db:"num_nodes"`
-				NumInstrumentedNodes          int32                   `db:"num_instrumented_nodes"`
-				AutoUpdateEnabled             bool                    `db:"auto_update_enabled"`
-				StatusMessage                 string                  `db:"status_message"`
+				Status                        string                    `db:"status"`
+				LastHeartbeat                 time.Time                 `db:"last_heartbeat"`
+				PrevStatus                    *string                   `db:"prev_status"`
+				PrevStatusTime                *time.Time                `db:"prev_status_time"`
+				ClusterVersion                *string                   `db:"cluster_version"`
+				OperatorVersion               *string                   `db:"operator_version"`
+				ControlPlanePodStatuses       controllers.PodStatuses   `db:"control_plane_pod_statuses"`
+				UnhealthyDataPlanePodStatuses controllers.PodStatuses   `db:"unhealthy_data_plane_pod_statuses"`
+				NumNodes                      int32                     `db:"num_nodes"`
+				NumInstrumentedNodes          int32                     `db:"num_instrumented_nodes"`
+				AutoUpdateEnabled             bool                      `db:"auto_update_enabled"`
+				StatusMessage                 string                    `db:"status_message"`
+				NumSelfTestPassedNodes        int32                     `db:"num_self_test_passed_nodes"`
+				FailedNodeSelfTests           controllers.NodeSelfTests `db:"failed_node_self_tests"`
+				BridgeRTTNs                   int64                     `db:"bridge_rtt_ns"`
+				NumBridgeReconnects           int64                     `db:"num_bridge_reconnects_since_sample"`
 			}
 			clusterID, err := uuid.FromString(tc.vizierID)
 			require.NoError(t, err)
@@ -576,6 +770,12 @@ func TestServer_HandleVizierHeartbeat(t *testing.T) {
 			assert.Equal(t, !tc.disableAutoUpdate, clusterInfo.AutoUpdateEnabled)
 			assert.Equal(t, tc.statusMessage, clusterInfo.StatusMessage)
 			assert.Equal(t, tc.expectedControlPlanePodStatuses, clusterInfo.ControlPlanePodStatuses)
+			assert.Equal(t, tc.numSelfTestPassedNodes, clusterInfo.NumSelfTestPassedNodes)
+			assert.ElementsMatch(t, tc.failedNodeSelfTests, clusterInfo.FailedNodeSelfTests)
+			if tc.checkDB {
+				assert.Equal(t, int64(5000000), clusterInfo.BridgeRTTNs)
+				assert.Less(t, int64(0), clusterInfo.NumBridgeReconnects)
+			}
 		})
 	}
 }
@@ -806,6 +1006,12 @@ func TestServer_ProvisionOrClaimVizierWIthExistingUID(t *testing.T) {
 			// Should select the disconnected cluster.
 			assert.Equal(t, testExistingCluster, clusterID.String())
 			assert.Equal(t, clusterName, test.expectedName)
+
+			// The reinstalled cluster registers with a new signing key.
+			var jwtKey *string
+			err = db.QueryRow(`SELECT jwt_signing_key FROM vizier_cluster_info WHERE vizier_cluster_id=$1`, clusterID).Scan(&jwtKey)
+			require.NoError(t, err)
+			assert.Nil(t, jwtKey)
 		})
 	}
 }
@@ -850,6 +1056,154 @@ func TestServer_ProvisionOrClaimVizier_WithExistingName(t *testing.T) {
 	assert.True(t, strings.HasPrefix(clusterName, "test_cluster_1234_"))
 }
 
+func TestServer_ProvisionOrClaimVizier_WithPreRegisteredName(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", nil, nil)
+	resp, err := s.ImportClusterInventory(CreateTestContext(), &vzmgrpb.ImportClusterInventoryRequest{
+		OrgID:     utils.ProtoFromUUIDStrOrNil(testAuthOrgID),
+		Format:    vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON,
+		Inventory: []byte(`[{"cluster_name": "prod-us-east", "labels": {"env": "prod"}}]`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"prod-us-east"}, resp.Created)
+	var preRegisteredID uuid.UUID
+	require.NoError(t, db.Get(&preRegisteredID, `SELECT id FROM vizier_cluster WHERE cluster_name='prod-us-east'`))
+
+	userID := uuid.Must(uuid.NewV4())
+	// A Vizier without a matching name doesn't claim the pre-registered cluster.
+	clusterID, _, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "some_cluster", "")
+	require.NoError(t, err)
+	assert.Equal(t, testDisconnectedClusterEmptyUID, clusterID.String())
+
+	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "prod_uid", "prod-us-east")
+	require.NoError(t, err)
+	assert.Equal(t, preRegisteredID, clusterID)
+	assert.Equal(t, "prod-us-east", clusterName)
+
+	var claimed struct {
+		ClusterUID    string `db:"cluster_uid"`
+		PreRegistered bool   `db:"pre_registered"`
+	}
+	require.NoError(t, db.Get(&claimed, `SELECT cluster_uid, pre_registered FROM vizier_cluster WHERE id=$1`, clusterID))
+	assert.Equal(t, "prod_uid", claimed.ClusterUID)
+	assert.False(t, claimed.PreRegistered)
+}
+
+func TestServer_ExportClusterInventory(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE vizier_cluster SET labels='{"env": "prod", "team": "obs"}' WHERE id=$1`, "123e4567-e89b-12d3-a456-426655440001")
+
+	s := controllers.New(db, "test", nil, nil)
+
+	t.Run("csv", func(t *testing.T) {
+		resp, err := s.ExportClusterInventory(CreateTestContext(), &vzmgrpb.ExportClusterInventoryRequest{
+			OrgID:  utils.ProtoFromUUIDStrOrNil(testAuthOrgID),
+			Format: vzmgrpb.CLUSTER_INVENTORY_FORMAT_CSV,
+		})
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(resp.Inventory)), "\n")
+		require.Len(t, lines, 7)
+		assert.Equal(t, "id,cluster_name,cluster_uid,status,pre_registered,vizier_version,operator_version,cluster_version,num_nodes,last_heartbeat,labels", lines[0])
+		assert.Equal(t, `123e4567-e89b-12d3-a456-426655440001,healthy_cluster,cUID,HEALTHY,false,vzVers,opVers,cVers,12,2011-05-17T15:36:38Z,"env=prod,team=obs"`, lines[2])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		resp, err := s.ExportClusterInventory(CreateTestContext(), &vzmgrpb.ExportClusterInventoryRequest{
+			OrgID:  utils.ProtoFromUUIDStrOrNil(testAuthOrgID),
+			Format: vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON,
+		})
+		require.NoError(t, err)
+		var clusters []map[string]interface{}
+		require.NoError(t, json.Unmarshal(resp.Inventory, &clusters))
+		require.Len(t, clusters, 6)
+		assert.Equal(t, "healthy_cluster", clusters[1]["cluster_name"])
+		assert.Equal(t, map[string]interface{}{"env": "prod", "team": "obs"}, clusters[1]["labels"])
+	})
+
+	t.Run("other org", func(t *testing.T) {
+		_, err := s.ExportClusterInventory(CreateTestContext(), &vzmgrpb.ExportClusterInventoryRequest{
+			OrgID: utils.ProtoFromUUIDStrOrNil(testNonAuthOrgID),
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
+
+func TestServer_ImportClusterInventory(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          vzmgrpb.ClusterInventoryFormat
+		inventory       string
+		dryRun          bool
+		expectedCode    codes.Code
+		expectedCreated []string
+		expectedUpdated []string
+	}{
+		{
+			name:            "csv",
+			format:          vzmgrpb.CLUSTER_INVENTORY_FORMAT_CSV,
+			inventory:       "cluster_name,labels\nhealthy_cluster,env=staging\nprod-us-east,\"env=prod,region=us-east\"\n",
+			expectedCreated: []string{"prod-us-east"},
+			expectedUpdated: []string{"healthy_cluster"},
+		},
+		{
+			name:            "json",
+			format:          vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON,
+			inventory:       `[{"cluster_name": "healthy_cluster", "labels": {"env": "staging"}}, {"cluster_name": "prod-us-east"}]`,
+			expectedCreated: []string{"prod-us-east"},
+			expectedUpdated: []string{"healthy_cluster"},
+		},
+		{
+			name:            "dry run",
+			format:          vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON,
+			inventory:       `[{"cluster_name": "prod-us-east"}]`,
+			dryRun:          true,
+			expectedCreated: []string{"prod-us-east"},
+		},
+		{
+			name:         "missing name column",
+			format:       vzmgrpb.CLUSTER_INVENTORY_FORMAT_CSV,
+			inventory:    "name,labels\nprod-us-east,env=prod\n",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "duplicate cluster",
+			format:       vzmgrpb.CLUSTER_INVENTORY_FORMAT_JSON,
+			inventory:    `[{"cluster_name": "prod-us-east"}, {"cluster_name": "prod-us-east"}]`,
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test", nil, nil)
+			resp, err := s.ImportClusterInventory(CreateTestContext(), &vzmgrpb.ImportClusterInventoryRequest{
+				OrgID:     utils.ProtoFromUUIDStrOrNil(testAuthOrgID),
+				Format:    test.format,
+				Inventory: []byte(test.inventory),
+				DryRun:    test.dryRun,
+			})
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCreated, resp.Created)
+			assert.Equal(t, test.expectedUpdated, resp.Updated)
+
+			var count int
+			require.NoError(t, db.Get(&count, `SELECT COUNT(*) FROM vizier_cluster WHERE cluster_name='prod-us-east' AND pre_registered`))
+			if test.dryRun {
+				assert.Equal(t, 0, count)
+			} else {
+				assert.Equal(t, 1, count)
+			}
+		})
+	}
+}
+
 func TestServer_GetOrgFromVizier(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -29,6 +29,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/clock"
 	"px.dev/pixie/src/shared/services/events"
 )
 
@@ -46,14 +47,21 @@ const (
 // It has a routine that is periodically invoked.
 type StatusMonitor struct {
 	db     *sqlx.DB
+	clock  clock.Clock
 	quitCh chan struct{}
 	once   sync.Once
 }
 
 // NewStatusMonitor creates a new StatusMonitor operating on the passed in DB and starts it.
 func NewStatusMonitor(db *sqlx.DB) *StatusMonitor {
+	return NewStatusMonitorWithClock(db, clock.New())
+}
+
+// NewStatusMonitorWithClock creates a new StatusMonitor which uses the given clock to schedule updates.
+func NewStatusMonitorWithClock(db *sqlx.DB, clk clock.Clock) *StatusMonitor {
 	sm := &StatusMonitor{
 		db:     db,
+		clock:  clk,
 		quitCh: make(chan struct{}),
 	}
 	sm.start()
@@ -62,14 +70,14 @@ func NewStatusMonitor(db *sqlx.DB) *StatusMonitor {
 
 func (s *StatusMonitor) start() {
 	go func() {
-		tick := time.NewTicker(updateInterval)
+		tick := s.clock.NewTicker(updateInterval)
 		defer tick.Stop()
 
 		for {
 			select {
 			case <-s.quitCh:
 				return
-			case <-tick.C:
+			case <-tick.C():
 				s.UpdateDBEntries()
 			}
 		}
@@ -100,7 +108,7 @@ func (s *StatusMonitor) UpdateDBEntries() {
 	// query and input data it should be safe to add the value to the query using
 	// a format directive.
 	query = fmt.Sprintf(query, durationBeforeDisconnect.Seconds(), durationBeforeUpdateDisconnect.Seconds())
-	start := time.Now()
+	start := s.clock.Now()
 	rows, err := s.db.Queryx(query)
 	if err != nil {
 		log.WithError(err).Error("Failed to update database, ignoring (will retry in next tick)")
@@ -126,6 +134,6 @@ func (s *StatusMonitor) UpdateDBEntries() {
 		}
 	}
 	log.WithField("entries_update", entryUpdated).
-		WithField("update_time", time.Since(start)).
+		WithField("update_time", s.clock.Since(start)).
 		Info("Heartbeat Update Complete")
 }
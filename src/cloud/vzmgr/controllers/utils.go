@@ -54,3 +54,31 @@ func (p *PodStatuses) Scan(src interface{}) error {
 
 	return nil
 }
+
+// NodeSelfTests Type to use in sqlx for the list of node self-test results.
+type NodeSelfTests []*cvmsgspb.NodeSelfTest
+
+// Value Returns a golang database/sql driver value for NodeSelfTests.
+func (n NodeSelfTests) Value() (driver.Value, error) {
+	if n == nil {
+		n = NodeSelfTests{}
+	}
+	res, err := json.Marshal(n)
+	if err != nil {
+		return res, err
+	}
+	return driver.Value(res), err
+}
+
+// Scan Scans the sqlx database type ([]bytes) into the NodeSelfTests type.
+func (n *NodeSelfTests) Scan(src interface{}) error {
+	jsonText, ok := src.([]byte)
+	if !ok {
+		return status.Error(codes.Internal, "could not unmarshal node self-tests")
+	}
+	err := json.Unmarshal(jsonText, n)
+	if err != nil {
+		return status.Error(codes.Internal, "could not unmarshal node self-tests")
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	defaultVizierStatusPageSize = 500
+	maxVizierStatusPageSize     = 1000
+)
+
+// vizierStatusCursor is the position of the last cluster of a page. Clusters are ordered by name, and then by ID
+// to break ties between clusters with the same name.
+type vizierStatusCursor struct {
+	ClusterName string    `json:"n"`
+	ID          uuid.UUID `json:"id"`
+}
+
+func encodeVizierStatusCursor(c vizierStatusCursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeVizierStatusCursor(s string) (*vizierStatusCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &vizierStatusCursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type vizierStatusRow struct {
+	ID                   uuid.UUID    `db:"id"`
+	ClusterName          string       `db:"cluster_name"`
+	ClusterUID           *string      `db:"cluster_uid"`
+	Status               vizierStatus `db:"status"`
+	VizierVersion        *string      `db:"vizier_version"`
+	OperatorVersion      *string      `db:"operator_version"`
+	ClusterVersion       *string      `db:"cluster_version"`
+	LastHeartbeat        *int64       `db:"last_heartbeat"`
+	NumNodes             int32        `db:"num_nodes"`
+	NumInstrumentedNodes int32        `db:"num_instrumented_nodes"`
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so that s is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// vizierStatusFilter returns the WHERE clause, and its args, of the clusters that match the request.
+func vizierStatusFilter(orgID uuid.UUID, req *vzmgrpb.ListVizierStatusesRequest) (string, []interface{}, error) {
+	where := `i.vizier_cluster_id=c.id AND c.org_id=?`
+	args := []interface{}{orgID}
+	if len(req.Statuses) > 0 {
+		statuses := make([]string, len(req.Statuses))
+		for i, s := range req.Statuses {
+			statuses[i] = vizierStatus(s).Stringify()
+		}
+		where += ` AND i.status IN (?)`
+		args = append(args, statuses)
+	}
+	if req.VizierVersion != "" {
+		where += ` AND i.vizier_version=?`
+		args = append(args, req.VizierVersion)
+	}
+	if req.ClusterNameContains != "" {
+		where += ` AND c.cluster_name LIKE ?`
+		args = append(args, "%"+escapeLike(req.ClusterNameContains)+"%")
+	}
+	return sqlx.In(where, args...)
+}
+
+// ListVizierStatuses lists the status of the org's clusters that match the filters, a page at a time. Each page
+// also has the number of matching clusters per status and Vizier version, so that fleet dashboards don't need to
+// fetch every cluster to summarize them.
+func (s *Server) ListVizierStatuses(ctx context.Context, req *vzmgrpb.ListVizierStatusesRequest) (*vzmgrpb.ListVizierStatusesResponse, error) {
+	if err := validateOrgID(ctx, req.OrgID); err != nil {
+		return nil, err
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+
+	if req.PageSize < 0 || req.PageSize > maxVizierStatusPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page size must be between 0 and %d", maxVizierStatusPageSize)
+	}
+	pageSize := int(req.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultVizierStatusPageSize
+	}
+
+	where, whereArgs, err := vizierStatusFilter(orgID, req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	pageWhere := where
+	pageArgs := append([]interface{}{}, whereArgs...)
+	if req.Cursor != "" {
+		cursor, err := decodeVizierStatusCursor(req.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+		pageWhere += ` AND (COALESCE(c.cluster_name, ''), c.id) > (?, ?)`
+		pageArgs = append(pageArgs, cursor.ClusterName, cursor.ID)
+	}
+
+	// Fetch one more cluster than was requested to find out whether there is a next page.
+	query := `SELECT c.id, COALESCE(c.cluster_name, '') AS cluster_name, c.cluster_uid, i.status, i.vizier_version,
+              i.operator_version, i.cluster_version,
+              (EXTRACT(EPOCH FROM age(now(), i.last_heartbeat))*1E9)::bigint as last_heartbeat,
+              i.num_nodes, i.num_instrumented_nodes
+              FROM vizier_cluster AS c, vizier_cluster_info AS i
+              WHERE ` + pageWhere + `
+              ORDER BY COALESCE(c.cluster_name, ''), c.id
+              LIMIT ?`
+	pageArgs = append(pageArgs, pageSize+1)
+	rows, err := s.db.QueryxContext(ctx, s.db.Rebind(query), pageArgs...)
+	if err != nil {
+		log.WithError(err).Error("Failed to query vizier statuses")
+		return nil, status.Error(codes.Internal, "failed to query vizier statuses")
+	}
+	defer rows.Close()
+
+	resp := &vzmgrpb.ListVizierStatusesResponse{}
+	var last vizierStatusRow
+	for rows.Next() {
+		var row vizierStatusRow
+		if err := rows.StructScan(&row); err != nil {
+			log.WithError(err).Error("Failed to read vizier statuses")
+			return nil, status.Error(codes.Internal, "failed to read vizier statuses")
+		}
+		if len(resp.Viziers) == pageSize {
+			resp.NextCursor, err = encodeVizierStatusCursor(vizierStatusCursor{
+				ClusterName: last.ClusterName,
+				ID:          last.ID,
+			})
+			if err != nil {
+				return nil, status.Error(codes.Internal, "failed to encode cursor")
+			}
+			break
+		}
+		lastHeartbeat := int64(-1)
+		if row.LastHeartbeat != nil {
+			lastHeartbeat = *row.LastHeartbeat
+		}
+		resp.Viziers = append(resp.Viziers, &vzmgrpb.VizierStatusSummary{
+			VizierID:             utils.ProtoFromUUID(row.ID),
+			ClusterName:          row.ClusterName,
+			ClusterUID:           stringOrEmpty(row.ClusterUID),
+			Status:               row.Status.ToProto(),
+			VizierVersion:        stringOrEmpty(row.VizierVersion),
+			OperatorVersion:      stringOrEmpty(row.OperatorVersion),
+			ClusterVersion:       stringOrEmpty(row.ClusterVersion),
+			LastHeartbeatNs:      lastHeartbeat,
+			NumNodes:             row.NumNodes,
+			NumInstrumentedNodes: row.NumInstrumentedNodes,
+		})
+		last = row
+	}
+	rows.Close()
+
+	if err := s.countVizierStatuses(ctx, where, whereArgs, resp); err != nil {
+		log.WithError(err).Error("Failed to count vizier statuses")
+		return nil, status.Error(codes.Internal, "failed to count vizier statuses")
+	}
+	return resp, nil
+}
+
+// countVizierStatuses fills in the number of clusters that match the filter, in total and per status and version.
+func (s *Server) countVizierStatuses(ctx context.Context, where string, args []interface{}, resp *vzmgrpb.ListVizierStatusesResponse) error {
+	query := `SELECT i.status, COALESCE(i.vizier_version, '') AS vizier_version, COUNT(*) AS count
+              FROM vizier_cluster AS c, vizier_cluster_info AS i
+              WHERE ` + where + `
+              GROUP BY i.status, COALESCE(i.vizier_version, '')`
+	rows, err := s.db.QueryxContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statusCounts := make(map[vizierStatus]int64)
+	versionCounts := make(map[string]int64)
+	for rows.Next() {
+		var row struct {
+			Status        vizierStatus `db:"status"`
+			VizierVersion string       `db:"vizier_version"`
+			Count         int64        `db:"count"`
+		}
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		statusCounts[row.Status] += row.Count
+		versionCounts[row.VizierVersion] += row.Count
+		resp.TotalCount += row.Count
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for st, count := range statusCounts {
+		resp.StatusCounts = append(resp.StatusCounts, &vzmgrpb.ListVizierStatusesResponse_StatusCount{
+			Status: st.ToProto(),
+			Count:  count,
+		})
+	}
+	sort.Slice(resp.StatusCounts, func(i, j int) bool {
+		return resp.StatusCounts[i].Status < resp.StatusCounts[j].Status
+	})
+	for v, count := range versionCounts {
+		resp.VersionCounts = append(resp.VersionCounts, &vzmgrpb.ListVizierStatusesResponse_VersionCount{
+			VizierVersion: v,
+			Count:         count,
+		})
+	}
+	// The most common versions come first.
+	sort.Slice(resp.VersionCounts, func(i, j int) bool {
+		a, b := resp.VersionCounts[i], resp.VersionCounts[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.VizierVersion < b.VizierVersion
+	})
+	return nil
+}
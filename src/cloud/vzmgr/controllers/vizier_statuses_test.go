@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/vzmgr/controllers"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/utils"
+)
+
+func vizierStatusNames(resp *vzmgrpb.ListVizierStatusesResponse) []string {
+	names := make([]string, len(resp.Viziers))
+	for i, vz := range resp.Viziers {
+		names[i] = vz.ClusterName
+	}
+	return names
+}
+
+func TestServer_ListVizierStatuses(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", nil, nil)
+	orgID := utils.ProtoFromUUIDStrOrNil(testAuthOrgID)
+
+	t.Run("paginates", func(t *testing.T) {
+		var names []string
+		cursor := ""
+		pages := 0
+		for {
+			resp, err := s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+				OrgID:    orgID,
+				PageSize: 4,
+				Cursor:   cursor,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, int64(6), resp.TotalCount)
+			names = append(names, vizierStatusNames(resp)...)
+			pages++
+			if resp.NextCursor == "" {
+				break
+			}
+			cursor = resp.NextCursor
+		}
+		assert.Equal(t, 2, pages)
+		assert.Equal(t, []string{
+			"", "existing_cluster", "healthy_cluster", "test_cluster_1234", "unhealthy_cluster", "unknown_cluster",
+		}, names)
+	})
+
+	t.Run("summarizes", func(t *testing.T) {
+		resp, err := s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+			OrgID:    orgID,
+			PageSize: 1,
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.Viziers, 1)
+		assert.Equal(t, []*vzmgrpb.ListVizierStatusesResponse_StatusCount{
+			{Status: cvmsgspb.VZ_ST_UNKNOWN, Count: 1},
+			{Status: cvmsgspb.VZ_ST_HEALTHY, Count: 1},
+			{Status: cvmsgspb.VZ_ST_UNHEALTHY, Count: 2},
+			{Status: cvmsgspb.VZ_ST_DISCONNECTED, Count: 2},
+		}, resp.StatusCounts)
+		assert.Equal(t, []*vzmgrpb.ListVizierStatusesResponse_VersionCount{
+			{VizierVersion: "", Count: 5},
+			{VizierVersion: "vzVers", Count: 1},
+		}, resp.VersionCounts)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		resp, err := s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+			OrgID:               orgID,
+			Statuses:            []cvmsgspb.VizierStatus{cvmsgspb.VZ_ST_HEALTHY, cvmsgspb.VZ_ST_UNHEALTHY},
+			ClusterNameContains: "health",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"healthy_cluster", "unhealthy_cluster"}, vizierStatusNames(resp))
+		assert.Equal(t, int64(2), resp.TotalCount)
+		assert.Equal(t, "", resp.NextCursor)
+
+		healthy := resp.Viziers[0]
+		assert.Equal(t, "123e4567-e89b-12d3-a456-426655440001", utils.UUIDFromProtoOrNil(healthy.VizierID).String())
+		assert.Equal(t, "cUID", healthy.ClusterUID)
+		assert.Equal(t, cvmsgspb.VZ_ST_HEALTHY, healthy.Status)
+		assert.Equal(t, "vzVers", healthy.VizierVersion)
+		assert.Equal(t, int32(12), healthy.NumNodes)
+		assert.Equal(t, int32(9), healthy.NumInstrumentedNodes)
+
+		resp, err = s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+			OrgID:         orgID,
+			VizierVersion: "vzVers",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"healthy_cluster"}, vizierStatusNames(resp))
+	})
+
+	t.Run("name filter is literal", func(t *testing.T) {
+		resp, err := s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+			OrgID:               orgID,
+			ClusterNameContains: "%",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Viziers)
+		assert.Equal(t, int64(0), resp.TotalCount)
+	})
+
+	t.Run("invalid page size", func(t *testing.T) {
+		_, err := s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+			OrgID:    orgID,
+			PageSize: 5000,
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+			OrgID:  orgID,
+			Cursor: "not a cursor",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("other org", func(t *testing.T) {
+		_, err := s.ListVizierStatuses(CreateTestContext(), &vzmgrpb.ListVizierStatusesRequest{
+			OrgID: utils.ProtoFromUUIDStrOrNil(testNonAuthOrgID),
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
@@ -154,6 +154,7 @@ func (u *Updater) updateOrInstallVizier(vizierID uuid.UUID, version string, rede
 			ArtifactName: "vizier",
 			VersionStr:   version,
 			ArtifactType: versionspb.AT_CONTAINER_SET_YAMLS,
+			ValidateOnly: true,
 		}
 
 		_, err = u.atClient.GetDownloadLink(ctx, atReq)
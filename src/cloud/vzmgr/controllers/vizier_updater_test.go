@@ -120,6 +120,7 @@ func TestUpdater_UpdateOrInstallVizier(t *testing.T) {
 			ArtifactName: "vizier",
 			VersionStr:   "123",
 			ArtifactType: versionspb.AT_CONTAINER_SET_YAMLS,
+			ValidateOnly: true,
 		}).Return(&artifacttrackerpb.GetDownloadLinkResponse{}, nil)
 
 	_, err := updater.UpdateOrInstallVizier(vizierID, "123", false)
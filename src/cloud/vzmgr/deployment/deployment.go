@@ -44,10 +44,16 @@ type VizierProvisioner interface {
 	ProvisionOrClaimVizier(context.Context, uuid.UUID, uuid.UUID, string, string) (uuid.UUID, string, error)
 }
 
+// QuotaChecker checks whether an org may use more of a metered resource.
+type QuotaChecker interface {
+	CheckQuota(context.Context, *vzmgrpb.CheckQuotaRequest) (*vzmgrpb.CheckQuotaResponse, error)
+}
+
 // Service is the deployment service.
 type Service struct {
 	deploymentInfoFetcher InfoFetcher
 	vp                    VizierProvisioner
+	qc                    QuotaChecker
 }
 
 // New creates a deployment service.
@@ -55,6 +61,32 @@ func New(dif InfoFetcher, vp VizierProvisioner) *Service {
 	return &Service{deploymentInfoFetcher: dif, vp: vp}
 }
 
+// SetQuotaChecker makes the service deny registrations that would take an org over its quota of connected clusters.
+func (s *Service) SetQuotaChecker(qc QuotaChecker) {
+	s.qc = qc
+}
+
+func (s *Service) checkClusterQuota(ctx context.Context, orgID uuid.UUID) error {
+	if s.qc == nil {
+		return nil
+	}
+	resp, err := s.qc.CheckQuota(ctx, &vzmgrpb.CheckQuotaRequest{
+		OrgID:  utils.ProtoFromUUID(orgID),
+		Metric: vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS,
+		Amount: 1,
+	})
+	if err != nil {
+		return err
+	}
+	switch resp.State {
+	case vzmgrpb.QUOTA_STATE_HARD_LIMIT_EXCEEDED:
+		return status.Error(codes.ResourceExhausted, "the org has reached its quota of connected clusters")
+	case vzmgrpb.QUOTA_STATE_SOFT_LIMIT_EXCEEDED:
+		log.WithField("orgID", orgID).WithField("usage", resp.Usage).Warn("Org is over the soft limit of its connected cluster quota")
+	}
+	return nil
+}
+
 // RegisterVizierDeployment will use the deployment key to generate or fetch the vizier key.
 func (s *Service) RegisterVizierDeployment(ctx context.Context, req *vzmgrpb.RegisterVizierDeploymentRequest) (*vzmgrpb.RegisterVizierDeploymentResponse, error) {
 	if len(req.K8sClusterUID) == 0 {
@@ -65,11 +97,15 @@ func (s *Service) RegisterVizierDeployment(ctx context.Context, req *vzmgrpb.Reg
 	if err != nil {
 		return nil, status.Error(codes.Unauthenticated, "invalid/unknown deployment key")
 	}
+	if err := s.checkClusterQuota(ctx, orgID); err != nil {
+		return nil, err
+	}
 	// Now we know the org and user ID to use for deployment. The process is as follows:
 	// 1. Try to fetch a cluster with either an empty UID or one where the UID matches the one in the protobuf.
 	// 2. If the UID matches then return that cluster.
-	// 3. Otherwise, pick a cluster with no UID specified and claim it.
-	// 4. If no empty clusters exist then we create a new cluster.
+	// 3. Otherwise, claim the cluster that was pre-registered with the same name from an inventory.
+	// 4. Otherwise, pick a cluster with no UID specified and claim it.
+	// 5. If no empty clusters exist then we create a new cluster.
 	clusterID, clusterName, err := s.vp.ProvisionOrClaimVizier(ctx, orgID, userID, req.K8sClusterUID, req.K8sClusterName)
 	if err != nil {
 		return nil, vzerrors.ToGRPCError(err)
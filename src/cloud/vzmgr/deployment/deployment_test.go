@@ -106,3 +106,52 @@ func TestService_RegisterVizierDeployment_InvalidDeployKey(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, codes.Unauthenticated, status.Code(err))
 }
+
+type fakeQuotaChecker struct {
+	state vzmgrpb.QuotaState
+}
+
+func (f *fakeQuotaChecker) CheckQuota(ctx context.Context, req *vzmgrpb.CheckQuotaRequest) (*vzmgrpb.CheckQuotaResponse, error) {
+	if utils.UUIDFromProtoOrNil(req.OrgID) != testOrgID || req.Metric != vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS || req.Amount != 1 {
+		return nil, errors.New("bad request")
+	}
+	return &vzmgrpb.CheckQuotaResponse{State: f.state}, nil
+}
+
+func TestService_RegisterVizierDeployment_ClusterQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		state vzmgrpb.QuotaState
+		code  codes.Code
+	}{
+		{
+			name:  "within quota",
+			state: vzmgrpb.QUOTA_STATE_OK,
+			code:  codes.OK,
+		},
+		{
+			name:  "over soft limit",
+			state: vzmgrpb.QUOTA_STATE_SOFT_LIMIT_EXCEEDED,
+			code:  codes.OK,
+		},
+		{
+			name:  "over hard limit",
+			state: vzmgrpb.QUOTA_STATE_HARD_LIMIT_EXCEEDED,
+			code:  codes.ResourceExhausted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := deployment.New(&fakeDF{}, &fakeProvisioner{})
+			svc.SetQuotaChecker(&fakeQuotaChecker{state: test.state})
+
+			_, err := svc.RegisterVizierDeployment(context.Background(), &vzmgrpb.RegisterVizierDeploymentRequest{
+				K8sClusterUID:  "cluster1",
+				DeploymentKey:  testValidDeploymentKey,
+				K8sClusterName: "test",
+			})
+			assert.Equal(t, test.code, status.Code(err))
+		})
+	}
+}
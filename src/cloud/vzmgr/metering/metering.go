@@ -0,0 +1,360 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package metering
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils"
+)
+
+// Service meters the usage of each org, and enforces the quotas of the orgs.
+type Service struct {
+	db    *sqlx.DB
+	clock clock.Clock
+}
+
+// New creates a new Service.
+func New(db *sqlx.DB) *Service {
+	return NewWithClock(db, clock.New())
+}
+
+// NewWithClock creates a new Service which uses the given clock to timestamp usage and find the current quota period.
+func NewWithClock(db *sqlx.DB, clk clock.Clock) *Service {
+	return &Service{
+		db:    db,
+		clock: clk,
+	}
+}
+
+func validateMetric(m vzmgrpb.UsageMetric) error {
+	if m == vzmgrpb.USAGE_METRIC_UNKNOWN {
+		return status.Error(codes.InvalidArgument, "metric must be specified")
+	}
+	if _, ok := vzmgrpb.UsageMetric_name[int32(m)]; !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown metric %d", m)
+	}
+	return nil
+}
+
+// monthStart returns the start of the calendar month, in UTC, that t is in.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// RecordUsage adds usage of a metric to an org. The usage is aggregated into the hour that it happened in.
+func (s *Service) RecordUsage(ctx context.Context, req *vzmgrpb.RecordUsageRequest) (*types.Empty, error) {
+	orgID, err := utils.UUIDFromProto(req.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+	if err := validateMetric(req.Metric); err != nil {
+		return nil, err
+	}
+	if req.Metric == vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS {
+		return nil, status.Error(codes.InvalidArgument, "connected clusters are sampled by vzmgr and can't be recorded")
+	}
+	if req.Amount < 0 {
+		return nil, status.Error(codes.InvalidArgument, "amount must not be negative")
+	}
+
+	ts := s.clock.Now()
+	if req.Time != nil {
+		ts, err = types.TimestampFromProto(req.Time)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid time")
+		}
+	}
+
+	query := `INSERT INTO org_usage (org_id, metric, period_start, amount)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (org_id, metric, period_start) DO UPDATE SET amount = org_usage.amount + EXCLUDED.amount`
+	_, err = s.db.ExecContext(ctx, query, orgID, req.Metric.String(), ts.UTC().Truncate(time.Hour), req.Amount)
+	if err != nil {
+		log.WithError(err).Error("Failed to record usage")
+		return nil, status.Error(codes.Internal, "failed to record usage")
+	}
+	return &types.Empty{}, nil
+}
+
+type quotaRow struct {
+	OrgID     uuid.UUID `db:"org_id"`
+	Metric    string    `db:"metric"`
+	SoftLimit float64   `db:"soft_limit"`
+	HardLimit float64   `db:"hard_limit"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func (r *quotaRow) toProto() *vzmgrpb.OrgQuota {
+	updatedAt, _ := types.TimestampProto(r.UpdatedAt)
+	return &vzmgrpb.OrgQuota{
+		OrgID:     utils.ProtoFromUUID(r.OrgID),
+		Metric:    vzmgrpb.UsageMetric(vzmgrpb.UsageMetric_value[r.Metric]),
+		SoftLimit: r.SoftLimit,
+		HardLimit: r.HardLimit,
+		UpdatedAt: updatedAt,
+	}
+}
+
+// exceeds returns whether adding amount to usage goes over the limit. An amount of 0 asks whether any further
+// usage goes over the limit.
+func exceeds(limit, usage, amount float64) bool {
+	if limit <= 0 {
+		return false
+	}
+	if amount == 0 {
+		return usage >= limit
+	}
+	return usage+amount > limit
+}
+
+// CheckQuota returns whether the org may use more of a metric. Orgs without a quota for the metric may use as much
+// of it as they want.
+func (s *Service) CheckQuota(ctx context.Context, req *vzmgrpb.CheckQuotaRequest) (*vzmgrpb.CheckQuotaResponse, error) {
+	orgID, err := utils.UUIDFromProto(req.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+	if err := validateMetric(req.Metric); err != nil {
+		return nil, err
+	}
+
+	var q quotaRow
+	query := `SELECT org_id, metric, soft_limit, hard_limit, updated_at FROM org_quotas WHERE org_id=$1 AND metric=$2`
+	err = s.db.GetContext(ctx, &q, query, orgID, req.Metric.String())
+	if err == sql.ErrNoRows {
+		return &vzmgrpb.CheckQuotaResponse{State: vzmgrpb.QUOTA_STATE_OK}, nil
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch quota")
+		return nil, status.Error(codes.Internal, "failed to fetch quota")
+	}
+
+	resp := &vzmgrpb.CheckQuotaResponse{Quota: q.toProto()}
+	if req.Metric == vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS {
+		resp.Usage, err = s.connectedClusters(ctx, orgID)
+	} else {
+		start := monthStart(s.clock.Now())
+		end := start.AddDate(0, 1, 0)
+		resp.PeriodEnd, _ = types.TimestampProto(end)
+		resp.Usage, err = s.usageBetween(ctx, orgID, req.Metric, start, end)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch usage")
+		return nil, status.Error(codes.Internal, "failed to fetch usage")
+	}
+
+	switch {
+	case exceeds(q.HardLimit, resp.Usage, req.Amount):
+		resp.State = vzmgrpb.QUOTA_STATE_HARD_LIMIT_EXCEEDED
+	case exceeds(q.SoftLimit, resp.Usage, req.Amount):
+		resp.State = vzmgrpb.QUOTA_STATE_SOFT_LIMIT_EXCEEDED
+	default:
+		resp.State = vzmgrpb.QUOTA_STATE_OK
+	}
+	return resp, nil
+}
+
+func (s *Service) connectedClusters(ctx context.Context, orgID uuid.UUID) (float64, error) {
+	var count int64
+	query := `SELECT COUNT(*) FROM vizier_cluster AS c, vizier_cluster_info AS i
+              WHERE i.vizier_cluster_id=c.id AND c.org_id=$1 AND i.status != 'DISCONNECTED'`
+	err := s.db.GetContext(ctx, &count, query, orgID)
+	return float64(count), err
+}
+
+func (s *Service) usageBetween(ctx context.Context, orgID uuid.UUID, metric vzmgrpb.UsageMetric, start, end time.Time) (float64, error) {
+	var usage float64
+	query := `SELECT COALESCE(SUM(amount), 0) FROM org_usage
+              WHERE org_id=$1 AND metric=$2 AND period_start >= $3 AND period_start < $4`
+	err := s.db.GetContext(ctx, &usage, query, orgID, metric.String(), start, end)
+	return usage, err
+}
+
+// GetOrgQuotas returns the quotas of an org.
+func (s *Service) GetOrgQuotas(ctx context.Context, req *uuidpb.UUID) (*vzmgrpb.GetOrgQuotasResponse, error) {
+	orgID, err := utils.UUIDFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+
+	var rows []quotaRow
+	query := `SELECT org_id, metric, soft_limit, hard_limit, updated_at FROM org_quotas WHERE org_id=$1 ORDER BY metric`
+	if err := s.db.SelectContext(ctx, &rows, query, orgID); err != nil {
+		log.WithError(err).Error("Failed to fetch quotas")
+		return nil, status.Error(codes.Internal, "failed to fetch quotas")
+	}
+
+	resp := &vzmgrpb.GetOrgQuotasResponse{}
+	for i := range rows {
+		resp.Quotas = append(resp.Quotas, rows[i].toProto())
+	}
+	return resp, nil
+}
+
+// SetOrgQuota sets the quota of an org for a metric.
+func (s *Service) SetOrgQuota(ctx context.Context, req *vzmgrpb.OrgQuota) (*vzmgrpb.OrgQuota, error) {
+	orgID, err := utils.UUIDFromProto(req.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+	if err := validateMetric(req.Metric); err != nil {
+		return nil, err
+	}
+	if req.SoftLimit < 0 || req.HardLimit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limits must not be negative")
+	}
+	if req.SoftLimit > 0 && req.HardLimit > 0 && req.SoftLimit > req.HardLimit {
+		return nil, status.Error(codes.InvalidArgument, "soft limit must not be above the hard limit")
+	}
+
+	var q quotaRow
+	query := `INSERT INTO org_quotas (org_id, metric, soft_limit, hard_limit, updated_at)
+              VALUES ($1, $2, $3, $4, NOW())
+              ON CONFLICT (org_id, metric) DO UPDATE
+                SET soft_limit = EXCLUDED.soft_limit, hard_limit = EXCLUDED.hard_limit, updated_at = NOW()
+              RETURNING org_id, metric, soft_limit, hard_limit, updated_at`
+	err = s.db.GetContext(ctx, &q, query, orgID, req.Metric.String(), req.SoftLimit, req.HardLimit)
+	if err != nil {
+		log.WithError(err).Error("Failed to set quota")
+		return nil, status.Error(codes.Internal, "failed to set quota")
+	}
+	return q.toProto(), nil
+}
+
+// DeleteOrgQuota deletes the quota of an org for a metric.
+func (s *Service) DeleteOrgQuota(ctx context.Context, req *vzmgrpb.DeleteOrgQuotaRequest) (*types.Empty, error) {
+	orgID, err := utils.UUIDFromProto(req.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+	if err := validateMetric(req.Metric); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM org_quotas WHERE org_id=$1 AND metric=$2`, orgID, req.Metric.String())
+	if err != nil {
+		log.WithError(err).Error("Failed to delete quota")
+		return nil, status.Error(codes.Internal, "failed to delete quota")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, status.Error(codes.NotFound, "no such quota")
+	}
+	return &types.Empty{}, nil
+}
+
+var granularityTrunc = map[vzmgrpb.UsageGranularity]string{
+	vzmgrpb.USAGE_GRANULARITY_HOUR:  "hour",
+	vzmgrpb.USAGE_GRANULARITY_DAY:   "day",
+	vzmgrpb.USAGE_GRANULARITY_MONTH: "month",
+}
+
+// GetUsageReport returns the usage of an org over time, per metric and period.
+func (s *Service) GetUsageReport(ctx context.Context, req *vzmgrpb.GetUsageReportRequest) (*vzmgrpb.GetUsageReportResponse, error) {
+	orgID, err := utils.UUIDFromProto(req.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+	trunc, ok := granularityTrunc[req.Granularity]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown granularity")
+	}
+	if req.StartTime == nil {
+		return nil, status.Error(codes.InvalidArgument, "start time must be specified")
+	}
+	start, err := types.TimestampFromProto(req.StartTime)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid start time")
+	}
+	end := s.clock.Now()
+	if req.EndTime != nil {
+		end, err = types.TimestampFromProto(req.EndTime)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid end time")
+		}
+	}
+	if !end.After(start) {
+		return nil, status.Error(codes.InvalidArgument, "end time must be after the start time")
+	}
+
+	var metrics []string
+	for _, m := range req.Metrics {
+		if err := validateMetric(m); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m.String())
+	}
+
+	// The usage of the connected clusters is a peak rather than a total, so it is aggregated with MAX.
+	query := `SELECT metric, date_trunc(?, period_start) AS period,
+                CASE WHEN metric = ? THEN MAX(amount) ELSE SUM(amount) END AS amount
+              FROM org_usage
+              WHERE org_id=? AND period_start >= ? AND period_start < ?`
+	args := []interface{}{trunc, vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS.String(), orgID,
+		start.UTC().Truncate(time.Hour), end.UTC()}
+	if len(metrics) > 0 {
+		query += ` AND metric IN (?)`
+		args = append(args, metrics)
+	}
+	query += ` GROUP BY metric, period ORDER BY metric, period`
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	rows, err := s.db.QueryxContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch usage report")
+		return nil, status.Error(codes.Internal, "failed to fetch usage report")
+	}
+	defer rows.Close()
+
+	resp := &vzmgrpb.GetUsageReportResponse{}
+	for rows.Next() {
+		var row struct {
+			Metric string    `db:"metric"`
+			Period time.Time `db:"period"`
+			Amount float64   `db:"amount"`
+		}
+		if err := rows.StructScan(&row); err != nil {
+			log.WithError(err).Error("Failed to read usage report")
+			return nil, status.Error(codes.Internal, "failed to read usage report")
+		}
+		periodStart, _ := types.TimestampProto(row.Period)
+		resp.Records = append(resp.Records, &vzmgrpb.GetUsageReportResponse_UsageRecord{
+			Metric:      vzmgrpb.UsageMetric(vzmgrpb.UsageMetric_value[row.Metric]),
+			PeriodStart: periodStart,
+			Amount:      row.Amount,
+		})
+	}
+	return resp, nil
+}
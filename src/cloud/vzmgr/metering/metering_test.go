@@ -0,0 +1,354 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package metering
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/vzmgr/schema"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/shared/services/pgtest"
+	"px.dev/pixie/src/utils"
+)
+
+var (
+	testOrgID      = uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")
+	testOtherOrgID = uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440001")
+
+	testNow = time.Date(2023, time.March, 15, 10, 30, 0, 0, time.UTC)
+)
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+var db *sqlx.DB
+
+func testMain(m *testing.M) error {
+	s := bindata.Resource(schema.AssetNames(), schema.Asset)
+	testDB, teardown, err := pgtest.SetupTestDB(s)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+func mustLoadTestData(db *sqlx.DB) {
+	db.MustExec(`DELETE FROM org_usage`)
+	db.MustExec(`DELETE FROM org_quotas`)
+	db.MustExec(`DELETE FROM vizier_cluster_info`)
+	db.MustExec(`DELETE FROM vizier_cluster`)
+
+	insertCluster := `INSERT INTO vizier_cluster(org_id, id, cluster_uid, cluster_name) VALUES ($1, $2, $3, $4)`
+	insertClusterInfo := `INSERT INTO vizier_cluster_info(vizier_cluster_id, status) VALUES ($1, $2)`
+	clusters := []struct {
+		orgID  uuid.UUID
+		name   string
+		status string
+	}{
+		{testOrgID, "healthy", "HEALTHY"},
+		{testOrgID, "unhealthy", "UNHEALTHY"},
+		{testOrgID, "disconnected", "DISCONNECTED"},
+		{testOtherOrgID, "other", "HEALTHY"},
+	}
+	for _, c := range clusters {
+		id := uuid.Must(uuid.NewV4())
+		db.MustExec(insertCluster, c.orgID, id, c.name, c.name)
+		db.MustExec(insertClusterInfo, id, c.status)
+	}
+}
+
+func recordUsage(t *testing.T, s *Service, orgID uuid.UUID, metric vzmgrpb.UsageMetric, amount float64, ts time.Time) {
+	tp, err := types.TimestampProto(ts)
+	require.NoError(t, err)
+	_, err = s.RecordUsage(context.Background(), &vzmgrpb.RecordUsageRequest{
+		OrgID:  utils.ProtoFromUUID(orgID),
+		Metric: metric,
+		Amount: amount,
+		Time:   tp,
+	})
+	require.NoError(t, err)
+}
+
+func setQuota(t *testing.T, s *Service, metric vzmgrpb.UsageMetric, soft, hard float64) {
+	_, err := s.SetOrgQuota(context.Background(), &vzmgrpb.OrgQuota{
+		OrgID:     utils.ProtoFromUUID(testOrgID),
+		Metric:    metric,
+		SoftLimit: soft,
+		HardLimit: hard,
+	})
+	require.NoError(t, err)
+}
+
+func TestService_RecordUsage_Invalid(t *testing.T) {
+	mustLoadTestData(db)
+	s := NewWithClock(db, clock.NewFakeClock(testNow))
+
+	tests := []struct {
+		name string
+		req  *vzmgrpb.RecordUsageRequest
+	}{
+		{
+			name: "missing metric",
+			req:  &vzmgrpb.RecordUsageRequest{OrgID: utils.ProtoFromUUID(testOrgID), Amount: 1},
+		},
+		{
+			name: "sampled metric",
+			req: &vzmgrpb.RecordUsageRequest{
+				OrgID:  utils.ProtoFromUUID(testOrgID),
+				Metric: vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS,
+				Amount: 1,
+			},
+		},
+		{
+			name: "negative amount",
+			req: &vzmgrpb.RecordUsageRequest{
+				OrgID:  utils.ProtoFromUUID(testOrgID),
+				Metric: vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES,
+				Amount: -1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.RecordUsage(context.Background(), test.req)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestService_CheckQuota(t *testing.T) {
+	mustLoadTestData(db)
+	s := NewWithClock(db, clock.NewFakeClock(testNow))
+
+	// Usage from the previous month doesn't count towards the quota.
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 500, testNow.AddDate(0, -1, 0))
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 60, testNow.Add(-48*time.Hour))
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 30, testNow)
+	recordUsage(t, s, testOtherOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 1000, testNow)
+
+	check := func(metric vzmgrpb.UsageMetric, amount float64) *vzmgrpb.CheckQuotaResponse {
+		resp, err := s.CheckQuota(context.Background(), &vzmgrpb.CheckQuotaRequest{
+			OrgID:  utils.ProtoFromUUID(testOrgID),
+			Metric: metric,
+			Amount: amount,
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("no quota", func(t *testing.T) {
+		resp := check(vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 0)
+		assert.Equal(t, vzmgrpb.QUOTA_STATE_OK, resp.State)
+		assert.Nil(t, resp.Quota)
+	})
+
+	t.Run("monthly quota", func(t *testing.T) {
+		setQuota(t, s, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 80, 100)
+
+		resp := check(vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 0)
+		assert.Equal(t, vzmgrpb.QUOTA_STATE_SOFT_LIMIT_EXCEEDED, resp.State)
+		assert.Equal(t, float64(90), resp.Usage)
+		assert.Equal(t, float64(100), resp.Quota.HardLimit)
+		periodEnd, err := types.TimestampFromProto(resp.PeriodEnd)
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC), periodEnd)
+
+		assert.Equal(t, vzmgrpb.QUOTA_STATE_HARD_LIMIT_EXCEEDED, check(vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 20).State)
+
+		recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 10, testNow)
+		assert.Equal(t, vzmgrpb.QUOTA_STATE_HARD_LIMIT_EXCEEDED, check(vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 0).State)
+	})
+
+	t.Run("connected clusters", func(t *testing.T) {
+		setQuota(t, s, vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, 0, 3)
+
+		resp := check(vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, 1)
+		assert.Equal(t, vzmgrpb.QUOTA_STATE_OK, resp.State)
+		assert.Equal(t, float64(2), resp.Usage)
+		assert.Nil(t, resp.PeriodEnd)
+
+		setQuota(t, s, vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, 0, 2)
+		assert.Equal(t, vzmgrpb.QUOTA_STATE_HARD_LIMIT_EXCEEDED, check(vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, 1).State)
+	})
+}
+
+func TestService_OrgQuotas(t *testing.T) {
+	mustLoadTestData(db)
+	s := NewWithClock(db, clock.NewFakeClock(testNow))
+	ctx := context.Background()
+
+	_, err := s.SetOrgQuota(ctx, &vzmgrpb.OrgQuota{
+		OrgID:     utils.ProtoFromUUID(testOrgID),
+		Metric:    vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES,
+		SoftLimit: 10,
+		HardLimit: 5,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	setQuota(t, s, vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES, 1e9, 2e9)
+	setQuota(t, s, vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, 0, 10)
+	// Setting a quota again replaces it.
+	setQuota(t, s, vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, 0, 20)
+
+	resp, err := s.GetOrgQuotas(ctx, utils.ProtoFromUUID(testOrgID))
+	require.NoError(t, err)
+	require.Len(t, resp.Quotas, 2)
+	assert.Equal(t, vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, resp.Quotas[0].Metric)
+	assert.Equal(t, float64(20), resp.Quotas[0].HardLimit)
+	assert.Equal(t, vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES, resp.Quotas[1].Metric)
+	assert.Equal(t, float64(1e9), resp.Quotas[1].SoftLimit)
+
+	_, err = s.DeleteOrgQuota(ctx, &vzmgrpb.DeleteOrgQuotaRequest{
+		OrgID:  utils.ProtoFromUUID(testOrgID),
+		Metric: vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS,
+	})
+	require.NoError(t, err)
+	_, err = s.DeleteOrgQuota(ctx, &vzmgrpb.DeleteOrgQuotaRequest{
+		OrgID:  utils.ProtoFromUUID(testOrgID),
+		Metric: vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS,
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err = s.GetOrgQuotas(ctx, utils.ProtoFromUUID(testOrgID))
+	require.NoError(t, err)
+	require.Len(t, resp.Quotas, 1)
+	assert.Equal(t, vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES, resp.Quotas[0].Metric)
+
+	resp, err = s.GetOrgQuotas(ctx, utils.ProtoFromUUID(testOtherOrgID))
+	require.NoError(t, err)
+	assert.Empty(t, resp.Quotas)
+}
+
+func TestService_GetUsageReport(t *testing.T) {
+	mustLoadTestData(db)
+	clk := clock.NewFakeClock(testNow)
+	s := NewWithClock(db, clk)
+	ctx := context.Background()
+
+	day1 := time.Date(2023, time.March, 14, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, time.March, 15, 0, 0, 0, 0, time.UTC)
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 10, day1.Add(time.Hour))
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 5, day1.Add(time.Hour+time.Minute))
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 7, day1.Add(5*time.Hour))
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, 3, day2.Add(time.Hour))
+	recordUsage(t, s, testOrgID, vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES, 1024, day2.Add(time.Hour))
+	recordUsage(t, s, testOtherOrgID, vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES, 2048, day2.Add(time.Hour))
+
+	// Sample the connected clusters in two different hours, with a cluster disconnecting in between.
+	sampler := NewClusterSamplerWithClock(db, clk)
+	defer sampler.Stop()
+	require.NoError(t, sampler.Sample(ctx))
+	require.NoError(t, sampler.Sample(ctx))
+	db.MustExec(`UPDATE vizier_cluster_info SET status='DISCONNECTED' WHERE status='UNHEALTHY'`)
+	clk.Advance(time.Hour)
+	require.NoError(t, sampler.Sample(ctx))
+
+	start, _ := types.TimestampProto(day1)
+	end, _ := types.TimestampProto(day2.Add(24 * time.Hour))
+
+	type record struct {
+		metric vzmgrpb.UsageMetric
+		period time.Time
+		amount float64
+	}
+	report := func(req *vzmgrpb.GetUsageReportRequest) []record {
+		req.OrgID = utils.ProtoFromUUID(testOrgID)
+		req.StartTime = start
+		req.EndTime = end
+		resp, err := s.GetUsageReport(ctx, req)
+		require.NoError(t, err)
+		records := make([]record, len(resp.Records))
+		for i, r := range resp.Records {
+			period, err := types.TimestampFromProto(r.PeriodStart)
+			require.NoError(t, err)
+			records[i] = record{r.Metric, period, r.Amount}
+		}
+		return records
+	}
+
+	t.Run("hourly", func(t *testing.T) {
+		assert.Equal(t, []record{
+			{vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, day1.Add(time.Hour), 15},
+			{vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, day1.Add(5 * time.Hour), 7},
+			{vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, day2.Add(time.Hour), 3},
+		}, report(&vzmgrpb.GetUsageReportRequest{
+			Metrics:     []vzmgrpb.UsageMetric{vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS},
+			Granularity: vzmgrpb.USAGE_GRANULARITY_HOUR,
+		}))
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		assert.Equal(t, []record{
+			// The peak of the connected clusters, rather than their total, is reported.
+			{vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, day2, 2},
+			{vzmgrpb.USAGE_METRIC_DATA_EGRESS_BYTES, day2, 1024},
+			{vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, day1, 22},
+			{vzmgrpb.USAGE_METRIC_QUERY_EXECUTION_SECONDS, day2, 3},
+		}, report(&vzmgrpb.GetUsageReportRequest{
+			Granularity: vzmgrpb.USAGE_GRANULARITY_DAY,
+		}))
+	})
+
+	t.Run("hourly connected clusters", func(t *testing.T) {
+		assert.Equal(t, []record{
+			{vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, day2.Add(10 * time.Hour), 2},
+			{vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS, day2.Add(11 * time.Hour), 1},
+		}, report(&vzmgrpb.GetUsageReportRequest{
+			Metrics:     []vzmgrpb.UsageMetric{vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS},
+			Granularity: vzmgrpb.USAGE_GRANULARITY_HOUR,
+		}))
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := s.GetUsageReport(ctx, &vzmgrpb.GetUsageReportRequest{
+			OrgID:     utils.ProtoFromUUID(testOrgID),
+			StartTime: end,
+			EndTime:   start,
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package metering
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/services/clock"
+)
+
+const clusterSampleInterval = 1 * time.Minute
+
+// ClusterSampler periodically samples the number of connected clusters of each org, and records the peak of
+// each hour as the org's usage.
+type ClusterSampler struct {
+	db     *sqlx.DB
+	clock  clock.Clock
+	quitCh chan struct{}
+	once   sync.Once
+}
+
+// NewClusterSampler creates a new ClusterSampler operating on the passed in DB and starts it.
+func NewClusterSampler(db *sqlx.DB) *ClusterSampler {
+	return NewClusterSamplerWithClock(db, clock.New())
+}
+
+// NewClusterSamplerWithClock creates a new ClusterSampler which uses the given clock to schedule and timestamp
+// samples.
+func NewClusterSamplerWithClock(db *sqlx.DB, clk clock.Clock) *ClusterSampler {
+	c := &ClusterSampler{
+		db:     db,
+		clock:  clk,
+		quitCh: make(chan struct{}),
+	}
+	c.start()
+	return c
+}
+
+func (c *ClusterSampler) start() {
+	go func() {
+		tick := c.clock.NewTicker(clusterSampleInterval)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-c.quitCh:
+				return
+			case <-tick.C():
+				if err := c.Sample(context.Background()); err != nil {
+					log.WithError(err).Error("Failed to sample connected clusters")
+				}
+			}
+		}
+	}()
+}
+
+// Stop kills the cluster sampler.
+func (c *ClusterSampler) Stop() {
+	c.once.Do(func() {
+		close(c.quitCh)
+	})
+}
+
+// Sample records the number of connected clusters of each org, if it is the highest so far in the current hour.
+func (c *ClusterSampler) Sample(ctx context.Context) error {
+	query := `INSERT INTO org_usage (org_id, metric, period_start, amount)
+              SELECT c.org_id, $1, $2, COUNT(*)
+                FROM vizier_cluster AS c, vizier_cluster_info AS i
+                WHERE i.vizier_cluster_id=c.id AND i.status != 'DISCONNECTED'
+                GROUP BY c.org_id
+              ON CONFLICT (org_id, metric, period_start) DO UPDATE SET amount = GREATEST(org_usage.amount, EXCLUDED.amount)`
+	_, err := c.db.ExecContext(ctx, query, vzmgrpb.USAGE_METRIC_CONNECTED_CLUSTERS.String(),
+		c.clock.Now().UTC().Truncate(time.Hour))
+	return err
+}
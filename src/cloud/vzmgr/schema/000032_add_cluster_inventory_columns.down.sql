@@ -0,0 +1,3 @@
+ALTER TABLE vizier_cluster
+  DROP COLUMN labels,
+  DROP COLUMN pre_registered;
@@ -0,0 +1,4 @@
+ALTER TABLE vizier_cluster
+  ADD COLUMN labels json NOT NULL DEFAULT '{}',
+  -- Whether the cluster was imported from an inventory, and has not been claimed by a Vizier yet.
+  ADD COLUMN pre_registered boolean NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE vizier_cluster_info
+  DROP COLUMN num_self_test_passed_nodes,
+  DROP COLUMN failed_node_self_tests;
@@ -0,0 +1,4 @@
+ALTER TABLE vizier_cluster_info
+  ADD COLUMN num_self_test_passed_nodes integer NOT NULL DEFAULT 0,
+  -- The self-test results of the nodes whose PEM failed at least one check.
+  ADD COLUMN failed_node_self_tests json NOT NULL DEFAULT '[]';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS vizier_slo_alert_configs;
+
+DROP TABLE IF EXISTS vizier_health_samples;
+
+ALTER TABLE vizier_cluster_info
+  DROP COLUMN state_last_updated,
+  DROP COLUMN num_queries_since_sample,
+  DROP COLUMN num_failed_queries_since_sample,
+  DROP COLUMN slo_degraded;
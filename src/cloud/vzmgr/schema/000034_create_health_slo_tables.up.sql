@@ -0,0 +1,40 @@
+ALTER TABLE vizier_cluster_info
+  -- When the Vizier last refreshed the state of the cluster that it reports in its heartbeats.
+  ADD COLUMN state_last_updated TIMESTAMP,
+  -- The queries that finished since the last health sample was taken.
+  ADD COLUMN num_queries_since_sample bigint NOT NULL DEFAULT 0,
+  ADD COLUMN num_failed_queries_since_sample bigint NOT NULL DEFAULT 0,
+  -- Whether the cluster is currently failing the SLO alert targets of its org.
+  ADD COLUMN slo_degraded boolean NOT NULL DEFAULT false;
+
+-- This table contains the history of the health of the clusters, which their SLOs are computed from.
+CREATE TABLE vizier_health_samples (
+  vizier_cluster_id UUID NOT NULL,
+  sampled_at TIMESTAMP NOT NULL,
+  -- Whether the Vizier was sending heartbeats.
+  connected boolean NOT NULL,
+  -- Whether the state reported by the Vizier was up to date.
+  data_fresh boolean NOT NULL,
+  -- The queries that finished since the previous sample.
+  num_queries bigint NOT NULL,
+  num_failed_queries bigint NOT NULL,
+
+  PRIMARY KEY(vizier_cluster_id, sampled_at),
+  FOREIGN KEY(vizier_cluster_id) REFERENCES vizier_cluster(id) ON DELETE CASCADE
+);
+
+CREATE INDEX vizier_health_samples_sampled_at_idx ON vizier_health_samples (sampled_at);
+
+-- This table contains the per-org targets that clusters are alerted on when they degrade.
+CREATE TABLE vizier_slo_alert_configs (
+  org_id UUID NOT NULL,
+  -- The webhook that alerts are posted to.
+  webhook_url text NOT NULL,
+  -- The rolling window that the SLOs are evaluated over.
+  window_seconds bigint NOT NULL,
+  heartbeat_uptime_target double precision NOT NULL,
+  query_success_rate_target double precision NOT NULL,
+  data_freshness_target double precision NOT NULL,
+
+  PRIMARY KEY(org_id)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS vizier_crash_diagnostics;
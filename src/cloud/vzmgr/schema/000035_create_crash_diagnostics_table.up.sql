@@ -0,0 +1,17 @@
+-- This table contains the diagnostic bundles of crashlooping pods that the clusters uploaded.
+CREATE TABLE vizier_crash_diagnostics (
+  vizier_cluster_id UUID NOT NULL,
+  -- The name of the bundle, which is unique within the cluster.
+  name varchar(64) NOT NULL,
+  -- The reason of the Vizier status when the bundle was captured.
+  reason varchar(64) NOT NULL,
+  captured_at TIMESTAMP NOT NULL,
+  -- The crashlooping containers, as <pod>/<container>.
+  containers json NOT NULL,
+  -- The gzipped tarball of the logs, events and resources of the crashlooping pods.
+  bundle bytea NOT NULL,
+  received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(vizier_cluster_id, name),
+  FOREIGN KEY(vizier_cluster_id) REFERENCES vizier_cluster(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS org_quotas;
+DROP TABLE IF EXISTS org_usage;
@@ -0,0 +1,23 @@
+-- This table contains the usage of each org, aggregated per metric and hour.
+CREATE TABLE org_usage (
+  org_id UUID NOT NULL,
+  -- The name of the UsageMetric.
+  metric varchar(64) NOT NULL,
+  -- The start of the hour that the usage is aggregated over.
+  period_start TIMESTAMP NOT NULL,
+  -- The total usage in the hour. For the connected clusters, this is the peak in the hour instead.
+  amount DOUBLE PRECISION NOT NULL,
+
+  PRIMARY KEY(org_id, metric, period_start)
+);
+
+-- This table contains the quotas that limit the usage of each org. A limit of 0 means no limit.
+CREATE TABLE org_quotas (
+  org_id UUID NOT NULL,
+  metric varchar(64) NOT NULL,
+  soft_limit DOUBLE PRECISION NOT NULL DEFAULT 0,
+  hard_limit DOUBLE PRECISION NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(org_id, metric)
+);
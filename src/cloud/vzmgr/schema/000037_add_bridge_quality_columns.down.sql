@@ -0,0 +1,8 @@
+ALTER TABLE vizier_health_samples
+  DROP COLUMN num_bridge_reconnects,
+  DROP COLUMN num_dropped_messages;
+
+ALTER TABLE vizier_cluster_info
+  DROP COLUMN bridge_rtt_ns,
+  DROP COLUMN num_bridge_reconnects_since_sample,
+  DROP COLUMN num_dropped_messages_since_sample;
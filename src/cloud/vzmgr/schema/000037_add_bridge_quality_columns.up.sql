@@ -0,0 +1,11 @@
+ALTER TABLE vizier_cluster_info
+  -- The latest round trip time of the bridge between the Vizier and the cloud.
+  ADD COLUMN bridge_rtt_ns bigint NOT NULL DEFAULT 0,
+  -- The bridge reconnects and dropped messages since the last health sample was taken.
+  ADD COLUMN num_bridge_reconnects_since_sample bigint NOT NULL DEFAULT 0,
+  ADD COLUMN num_dropped_messages_since_sample bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE vizier_health_samples
+  -- The bridge reconnects and dropped messages since the previous sample.
+  ADD COLUMN num_bridge_reconnects bigint NOT NULL DEFAULT 0,
+  ADD COLUMN num_dropped_messages bigint NOT NULL DEFAULT 0;
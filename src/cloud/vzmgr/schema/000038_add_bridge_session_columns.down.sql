@@ -0,0 +1,3 @@
+ALTER TABLE vizier_cluster_info
+  DROP COLUMN bridge_session_id,
+  DROP COLUMN bridge_seq_num;
@@ -0,0 +1,5 @@
+ALTER TABLE vizier_cluster_info
+  -- The session ID and sequence number of the message that opened the latest bridge stream of the
+  -- Vizier. Streams may only be opened with a later session, or a later message of the same session.
+  ADD COLUMN bridge_session_id bigint,
+  ADD COLUMN bridge_seq_num bigint;
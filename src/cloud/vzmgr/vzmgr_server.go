@@ -24,6 +24,7 @@ import (
 	_ "net/http/pprof"
 
 	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/regions"
 
 	bindata "github.com/golang-migrate/migrate/source/go_bindata"
 	"github.com/nats-io/nats.go"
@@ -38,6 +39,7 @@ import (
 	"px.dev/pixie/src/cloud/vzmgr/controllers"
 	"px.dev/pixie/src/cloud/vzmgr/deployment"
 	"px.dev/pixie/src/cloud/vzmgr/deploymentkey"
+	"px.dev/pixie/src/cloud/vzmgr/metering"
 	"px.dev/pixie/src/cloud/vzmgr/schema"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/services"
@@ -54,6 +56,7 @@ var natsErrorCounter *messages.NatsErrorCounter
 func init() {
 	pflag.String("database_key", "", "The encryption key to use for the database")
 	pflag.String("domain_name", "dev.withpixie.dev", "The domain name of Pixie Cloud")
+	pflag.Bool("require_bridge_signatures", true, "Reject vizier bridge streams whose messages are not signed")
 
 	natsErrorCounter = messages.NewNatsErrorCounter()
 }
@@ -100,6 +103,7 @@ func mustSetupNATSAndJetStream() (*nats.Conn, msgbus.Streamer) {
 func main() {
 	services.SetupService("vzmgr-service", 51800)
 	vzshard.SetupFlags()
+	regions.SetupFlags()
 	services.PostFlagSetupAndParse()
 	services.CheckServiceFlags()
 	services.SetupServiceLogging()
@@ -152,14 +156,30 @@ func main() {
 	defer updater.Stop()
 
 	c := controllers.New(db, dbKey, nc, updater)
+	router, err := regions.NewRouterFromFlags()
+	if err != nil {
+		log.WithError(err).Fatal("Invalid cloud regions")
+	}
+	if router != nil {
+		router.Start()
+		defer router.Stop()
+		c.SetRegionRouter(router)
+	}
 	dks := deploymentkey.New(db, dbKey)
 	ds := deployment.New(dks, c)
+	ms := metering.New(db)
+	ds.SetQuotaChecker(ms)
 
 	sm := controllers.NewStatusMonitor(db)
 	defer sm.Stop()
+	slom := controllers.NewSLOMonitor(db)
+	defer slom.Stop()
+	cs := metering.NewClusterSampler(db)
+	defer cs.Stop()
 	vzmgrpb.RegisterVZMgrServiceServer(s.GRPCServer(), c)
 	vzmgrpb.RegisterVZDeploymentKeyServiceServer(s.GRPCServer(), dks)
 	vzmgrpb.RegisterVZDeploymentServiceServer(s.GRPCServer(), ds)
+	vzmgrpb.RegisterMeteringServiceServer(s.GRPCServer(), ms)
 
 	var mdr *controllers.MetadataReader
 	go func() {
@@ -45,6 +45,10 @@ Status NATSConnectorBase::ConnectBase(Dispatcher* base_dispatcher) {
                                       tls_config_->tls_key.c_str());
   }
 
+  if (tls_config_ != nullptr && !tls_config_->creds_file.empty()) {
+    natsOptions_SetUserCredentialsFromFiles(nats_opts, tls_config_->creds_file.c_str(), nullptr);
+  }
+
   natsOptions_SetMaxReconnect(nats_opts, -1);
   natsOptions_SetDisconnectedCB(nats_opts, DisconnectedCB, this);
   natsOptions_SetReconnectedCB(nats_opts, ReconnectedCB, this);
@@ -31,6 +31,8 @@ struct NATSTLSConfig {
   std::string ca_cert;
   std::string tls_key;
   std::string tls_cert;
+  // The NATS credentials file with the user JWT and NKey seed. Empty if NATS doesn't require credentials.
+  std::string creds_file;
 };
 
 class NATSConnectorBase {
@@ -0,0 +1,389 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/shared/k8s/metadatapb"
+	"px.dev/pixie/src/shared/types/typespb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+const (
+	// updateAgentTopic is the topic the metadata service listens to for agent registrations and heartbeats.
+	updateAgentTopic = "UpdateAgent"
+	// missingMetadataRequestTopic is the topic the metadata service listens to for missing K8s metadata requests.
+	missingMetadataRequestTopic = "MissingMetadataRequests"
+	// k8sUpdatesTopicPrefix is the prefix of the topics that the metadata service sends K8s updates to PEMs on.
+	k8sUpdatesTopicPrefix = "K8sUpdates"
+)
+
+// simConfig is the load that each simulated agent puts on the control plane.
+type simConfig struct {
+	heartbeatInterval       time.Duration
+	heartbeatTimeout        time.Duration
+	registerTimeout         time.Duration
+	schemaUpdateInterval    time.Duration
+	metadataRequestInterval time.Duration
+	processesPerHeartbeat   int
+	numTables               int
+}
+
+// simAgent emulates the control plane traffic of a single PEM: it registers with the metadata service, heartbeats
+// with process updates, periodically reports a new schema and requests the K8s updates for its node.
+type simAgent struct {
+	id  uuid.UUID
+	idx int
+	ip  string
+	nc  *nats.Conn
+	cfg *simConfig
+
+	// The following are only accessed from the run goroutine.
+	asid      uint32
+	seq       int64
+	pids      []uint32
+	nextPID   uint32
+	lastRV    int64
+	pendingHB map[int64]time.Time
+
+	msgCh  chan *nats.Msg
+	quitCh chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+func newSimAgent(idx int, nc *nats.Conn, cfg *simConfig) *simAgent {
+	return &simAgent{
+		id:        uuid.Must(uuid.NewV4()),
+		idx:       idx,
+		ip:        fmt.Sprintf("10.%d.%d.%d", (idx>>16)&0xff, (idx>>8)&0xff, idx&0xff),
+		nc:        nc,
+		cfg:       cfg,
+		nextPID:   1,
+		pendingHB: make(map[int64]time.Time),
+		msgCh:     make(chan *nats.Msg, 64),
+		quitCh:    make(chan struct{}),
+	}
+}
+
+// start begins the agent's lifecycle in the background.
+func (a *simAgent) start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.run()
+	}()
+}
+
+// stop kills the agent without unregistering it, the same way a PEM disappears when its node goes away. The
+// metadata service is expected to notice the missing heartbeats and expire the agent.
+func (a *simAgent) stop() {
+	a.once.Do(func() {
+		close(a.quitCh)
+	})
+	a.wg.Wait()
+}
+
+func (a *simAgent) log() *log.Entry {
+	return log.WithField("agentID", a.id.String()).WithField("idx", a.idx)
+}
+
+func (a *simAgent) publish(topic string, msg *messagespb.VizierMessage) error {
+	b, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	err = a.nc.Publish(topic, b)
+	if err != nil {
+		publishErrors.WithLabelValues(topic).Inc()
+	}
+	return err
+}
+
+func (a *simAgent) run() {
+	agentSub, err := a.nc.ChanSubscribe(messagebus.AgentUUIDTopic(a.id), a.msgCh)
+	if err != nil {
+		a.log().WithError(err).Error("Failed to subscribe to agent topic")
+		return
+	}
+	defer agentSub.Unsubscribe()
+	k8sSub, err := a.nc.ChanSubscribe(path.Join(k8sUpdatesTopicPrefix, a.ip), a.msgCh)
+	if err != nil {
+		a.log().WithError(err).Error("Failed to subscribe to K8s updates topic")
+		return
+	}
+	defer k8sSub.Unsubscribe()
+
+	if !a.register() {
+		return
+	}
+	activeAgents.Inc()
+	defer activeAgents.Dec()
+
+	// Spread the agents' timers, so that they don't all fire at once.
+	time.Sleep(time.Duration(rand.Int63n(int64(a.cfg.heartbeatInterval))))
+
+	hbTicker := time.NewTicker(a.cfg.heartbeatInterval)
+	defer hbTicker.Stop()
+	schemaTicker := time.NewTicker(a.cfg.schemaUpdateInterval)
+	defer schemaTicker.Stop()
+	mdTicker := time.NewTicker(a.cfg.metadataRequestInterval)
+	defer mdTicker.Stop()
+
+	// The first heartbeat of a PEM carries its full schema.
+	sendSchema := true
+	a.requestMissingMetadata()
+	for {
+		select {
+		case <-a.quitCh:
+			return
+		case <-hbTicker.C:
+			a.expirePendingHeartbeats()
+			a.heartbeat(sendSchema)
+			sendSchema = false
+		case <-schemaTicker.C:
+			sendSchema = true
+		case <-mdTicker.C:
+			a.requestMissingMetadata()
+		case msg := <-a.msgCh:
+			if !a.handleMessage(msg) {
+				return
+			}
+		}
+	}
+}
+
+// register sends a registration request and waits until it is accepted, retrying on timeouts. It returns false
+// if the agent was stopped before it could register.
+func (a *simAgent) register() bool {
+	req := &messagespb.VizierMessage{
+		Msg: &messagespb.VizierMessage_RegisterAgentRequest{
+			RegisterAgentRequest: &messagespb.RegisterAgentRequest{
+				Info: &agentpb.AgentInfo{
+					AgentID: utils.ProtoFromUUID(a.id),
+					HostInfo: &agentpb.HostInfo{
+						Hostname: fmt.Sprintf("sim-node-%d", a.idx),
+						PodName:  fmt.Sprintf("vizier-pem-sim-%s", a.id.String()[:8]),
+						HostIP:   a.ip,
+					},
+					IPAddress: a.ip,
+					Capabilities: &agentpb.AgentCapabilities{
+						CollectsData: true,
+					},
+				},
+				ASID: a.asid,
+			},
+		},
+	}
+
+	for {
+		start := time.Now()
+		if err := a.publish(updateAgentTopic, req); err != nil {
+			a.log().WithError(err).Error("Failed to send register request")
+		}
+		timeout := time.NewTimer(a.cfg.registerTimeout)
+		waiting := true
+		for waiting {
+			select {
+			case <-a.quitCh:
+				timeout.Stop()
+				return false
+			case <-timeout.C:
+				registerTimeouts.Inc()
+				a.log().Warn("Timed out waiting for registration, retrying")
+				waiting = false
+			case msg := <-a.msgCh:
+				vzMsg := &messagespb.VizierMessage{}
+				if err := vzMsg.Unmarshal(msg.Data); err != nil {
+					continue
+				}
+				resp := vzMsg.GetRegisterAgentResponse()
+				if resp == nil {
+					continue
+				}
+				timeout.Stop()
+				registerLatency.Observe(time.Since(start).Seconds())
+				a.asid = resp.ASID
+				return true
+			}
+		}
+	}
+}
+
+// handleMessage processes a message from the metadata service. It returns false if the agent should die.
+func (a *simAgent) handleMessage(msg *nats.Msg) bool {
+	vzMsg := &messagespb.VizierMessage{}
+	if err := vzMsg.Unmarshal(msg.Data); err != nil {
+		a.log().WithError(err).Error("Failed to unmarshal message")
+		return true
+	}
+
+	switch m := vzMsg.Msg.(type) {
+	case *messagespb.VizierMessage_HeartbeatAck:
+		sent, ok := a.pendingHB[m.HeartbeatAck.SequenceNumber]
+		if !ok {
+			// The ack came after we gave up on the heartbeat.
+			return true
+		}
+		delete(a.pendingHB, m.HeartbeatAck.SequenceNumber)
+		heartbeatAckLatency.Observe(time.Since(sent).Seconds())
+	case *messagespb.VizierMessage_HeartbeatNack:
+		heartbeatNacks.Inc()
+		if !m.HeartbeatNack.Reregister {
+			a.log().Warn("Received heartbeat nack, agent is dying")
+			return false
+		}
+		a.pendingHB = make(map[int64]time.Time)
+		reregistrations.Inc()
+		return a.register()
+	case *messagespb.VizierMessage_K8SMetadataMessage:
+		resp := m.K8SMetadataMessage.GetMissingK8SMetadataResponse()
+		if resp == nil {
+			return true
+		}
+		metadataUpdatesReceived.Add(float64(len(resp.Updates)))
+		if resp.LastUpdateAvailable > a.lastRV {
+			a.lastRV = resp.LastUpdateAvailable
+		}
+	}
+	return true
+}
+
+// expirePendingHeartbeats counts the heartbeats that weren't acked in time as missed.
+func (a *simAgent) expirePendingHeartbeats() {
+	for seq, sent := range a.pendingHB {
+		if time.Since(sent) > a.cfg.heartbeatTimeout {
+			heartbeatsMissed.Inc()
+			delete(a.pendingHB, seq)
+		}
+	}
+}
+
+func (a *simAgent) heartbeat(sendSchema bool) {
+	now := time.Now()
+	updateInfo := &messagespb.AgentUpdateInfo{}
+	a.churnProcesses(now, updateInfo)
+	if sendSchema {
+		updateInfo.DoesUpdateSchema = true
+		updateInfo.Schema = simSchema(a.cfg.numTables, now)
+		schemaUpdatesSent.Inc()
+	}
+
+	hb := &messagespb.VizierMessage{
+		Msg: &messagespb.VizierMessage_Heartbeat{
+			Heartbeat: &messagespb.Heartbeat{
+				AgentID:        utils.ProtoFromUUID(a.id),
+				Time:           now.UnixNano(),
+				UpdateInfo:     updateInfo,
+				SequenceNumber: a.seq,
+			},
+		},
+	}
+	if err := a.publish(updateAgentTopic, hb); err != nil {
+		a.log().WithError(err).Error("Failed to send heartbeat")
+		return
+	}
+	heartbeatsSent.Inc()
+	a.pendingHB[a.seq] = now
+	a.seq++
+}
+
+// churnProcesses starts processesPerHeartbeat new processes, and terminates as many of the old ones, so that the
+// number of live processes on the simulated node stays steady.
+func (a *simAgent) churnProcesses(now time.Time, updateInfo *messagespb.AgentUpdateInfo) {
+	for i := 0; i < a.cfg.processesPerHeartbeat; i++ {
+		pid := a.nextPID
+		a.nextPID++
+		a.pids = append(a.pids, pid)
+		updateInfo.ProcessCreated = append(updateInfo.ProcessCreated, &metadatapb.ProcessCreated{
+			UPID:             a.upid(pid),
+			StartTimestampNS: now.UnixNano(),
+			Cmdline:          fmt.Sprintf("/app/sim-process-%d", pid),
+			CID:              fmt.Sprintf("sim-container-%d-%d", a.idx, pid),
+		})
+	}
+	for len(a.pids) > 2*a.cfg.processesPerHeartbeat {
+		pid := a.pids[0]
+		a.pids = a.pids[1:]
+		updateInfo.ProcessTerminated = append(updateInfo.ProcessTerminated, &metadatapb.ProcessTerminated{
+			UPID:            a.upid(pid),
+			StopTimestampNS: now.UnixNano(),
+		})
+	}
+}
+
+func (a *simAgent) upid(pid uint32) *typespb.UInt128 {
+	return &typespb.UInt128{
+		High: uint64(a.asid)<<32 | uint64(pid),
+		Low:  uint64(pid),
+	}
+}
+
+func (a *simAgent) requestMissingMetadata() {
+	req := &messagespb.VizierMessage{
+		Msg: &messagespb.VizierMessage_K8SMetadataMessage{
+			K8SMetadataMessage: &messagespb.K8SMetadataMessage{
+				Msg: &messagespb.K8SMetadataMessage_MissingK8SMetadataRequest{
+					MissingK8SMetadataRequest: &metadatapb.MissingK8SMetadataRequest{
+						Selector:          a.ip,
+						FromUpdateVersion: a.lastRV + 1,
+						ToUpdateVersion:   0,
+					},
+				},
+			},
+		},
+	}
+	if err := a.publish(missingMetadataRequestTopic, req); err != nil {
+		a.log().WithError(err).Error("Failed to request missing metadata")
+		return
+	}
+	metadataRequestsSent.Inc()
+}
+
+// simSchema returns a schema of numTables tables, shaped like the tables that PEMs collect.
+func simSchema(numTables int, now time.Time) []*storepb.TableInfo {
+	tables := make([]*storepb.TableInfo, numTables)
+	for i := range tables {
+		tables[i] = &storepb.TableInfo{
+			Name:             fmt.Sprintf("sim_table_%d", i),
+			Desc:             "A table reported by the scale simulator",
+			StartTimestampNS: now.UnixNano(),
+			Columns: []*storepb.TableInfo_ColumnInfo{
+				{Name: "time_", DataType: typespb.TIME64NS},
+				{Name: "upid", DataType: typespb.UINT128},
+				{Name: "remote_addr", DataType: typespb.STRING},
+				{Name: "latency", DataType: typespb.INT64},
+			},
+		}
+	}
+	return tables
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/shared/services"
+	"px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/healthz"
+	"px.dev/pixie/src/shared/services/httpmiddleware"
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/server"
+)
+
+var (
+	activeAgents = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "px_scale_sim_active_agents",
+		Help: "The number of simulated agents that are registered with the metadata service",
+	})
+
+	registerLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "px_scale_sim_register_latency_seconds",
+		Help:    "The time it takes the metadata service to accept an agent registration",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	})
+
+	registerTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_register_timeouts",
+		Help: "The number of agent registrations that weren't accepted in time",
+	})
+
+	reregistrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_reregistrations",
+		Help: "The number of times the metadata service asked an agent to reregister",
+	})
+
+	heartbeatsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_heartbeats_sent",
+		Help: "The number of heartbeats sent by the simulated agents",
+	})
+
+	heartbeatAckLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "px_scale_sim_heartbeat_ack_latency_seconds",
+		Help:    "The time it takes the metadata service to ack a heartbeat",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	})
+
+	heartbeatsMissed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_heartbeats_missed",
+		Help: "The number of heartbeats that weren't acked in time",
+	})
+
+	heartbeatNacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_heartbeat_nacks",
+		Help: "The number of heartbeats that the metadata service rejected",
+	})
+
+	schemaUpdatesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_schema_updates_sent",
+		Help: "The number of heartbeats that carried a schema update",
+	})
+
+	metadataRequestsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_metadata_requests_sent",
+		Help: "The number of missing K8s metadata requests sent by the simulated agents",
+	})
+
+	metadataUpdatesReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_metadata_updates_received",
+		Help: "The number of K8s metadata updates received by the simulated agents",
+	})
+
+	agentsChurned = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "px_scale_sim_agents_churned",
+		Help: "The number of simulated agents that were killed and replaced",
+	})
+
+	publishErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "px_scale_sim_publish_errors",
+		Help: "The number of messages that failed to publish, per topic",
+	}, []string{"topic"})
+)
+
+func init() {
+	// The defaults replicate the control plane load of a large cluster.
+	pflag.Int("num_agents", 1000, "The number of PEMs to simulate")
+	pflag.Duration("ramp_up_duration", 5*time.Minute, "The time over which the simulated PEMs are started")
+	pflag.Duration("heartbeat_interval", 5*time.Second, "How often each simulated PEM heartbeats")
+	pflag.Duration("heartbeat_timeout", 30*time.Second, "How long to wait for a heartbeat ack before counting the heartbeat as missed")
+	pflag.Duration("register_timeout", 30*time.Second, "How long to wait for a registration to be accepted before retrying")
+	pflag.Duration("schema_update_interval", 10*time.Minute, "How often each simulated PEM reports a new schema")
+	pflag.Duration("metadata_request_interval", time.Minute, "How often each simulated PEM requests the K8s updates it is missing")
+	pflag.Int("processes_per_heartbeat", 5, "The number of processes that start, and stop, on each simulated node between heartbeats")
+	pflag.Int("num_tables", 30, "The number of tables in the schema that the simulated PEMs report")
+	pflag.Float64("agent_churn_per_minute", 10, "The number of simulated PEMs that are killed and replaced by new ones every minute")
+
+	prometheus.MustRegister(activeAgents)
+	prometheus.MustRegister(registerLatency)
+	prometheus.MustRegister(registerTimeouts)
+	prometheus.MustRegister(reregistrations)
+	prometheus.MustRegister(heartbeatsSent)
+	prometheus.MustRegister(heartbeatAckLatency)
+	prometheus.MustRegister(heartbeatsMissed)
+	prometheus.MustRegister(heartbeatNacks)
+	prometheus.MustRegister(schemaUpdatesSent)
+	prometheus.MustRegister(metadataRequestsSent)
+	prometheus.MustRegister(metadataUpdatesReceived)
+	prometheus.MustRegister(agentsChurned)
+	prometheus.MustRegister(publishErrors)
+}
+
+// simulator runs a fleet of simulated PEMs against the metadata service, killing and replacing some of them over
+// time the same way nodes come and go in an autoscaled cluster.
+type simulator struct {
+	nc  *nats.Conn
+	cfg *simConfig
+
+	numAgents      int
+	rampUp         time.Duration
+	churnPerMinute float64
+
+	mu     sync.Mutex
+	agents []*simAgent
+
+	done chan struct{}
+}
+
+func (s *simulator) start() {
+	s.agents = make([]*simAgent, s.numAgents)
+	go s.rampUpAgents()
+	if s.churnPerMinute > 0 {
+		go s.churnAgents()
+	}
+}
+
+func (s *simulator) rampUpAgents() {
+	delay := s.rampUp / time.Duration(s.numAgents)
+	for i := 0; i < s.numAgents; i++ {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		a := newSimAgent(i, s.nc, s.cfg)
+		s.mu.Lock()
+		s.agents[i] = a
+		s.mu.Unlock()
+		a.start()
+		time.Sleep(delay)
+	}
+	log.WithField("numAgents", s.numAgents).Info("Started all simulated agents")
+}
+
+func (s *simulator) churnAgents() {
+	ticker := time.NewTicker(time.Duration(float64(time.Minute) / s.churnPerMinute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.replaceAgent(rand.Intn(s.numAgents))
+		}
+	}
+}
+
+// replaceAgent kills the agent on the given node and starts a new one in its place, like a PEM that is rescheduled
+// onto a replacement node.
+func (s *simulator) replaceAgent(idx int) {
+	s.mu.Lock()
+	old := s.agents[idx]
+	if old == nil {
+		// The node hasn't been started yet.
+		s.mu.Unlock()
+		return
+	}
+	a := newSimAgent(idx, s.nc, s.cfg)
+	s.agents[idx] = a
+	s.mu.Unlock()
+
+	old.stop()
+	a.start()
+	agentsChurned.Inc()
+}
+
+func (s *simulator) stop() {
+	close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.agents {
+		if a != nil {
+			a.stop()
+		}
+	}
+}
+
+func main() {
+	services.SetupService("vizier-scale-tester", 51700)
+	services.SetupSSLClientFlags()
+	services.PostFlagSetupAndParse()
+	services.CheckServiceFlags()
+	services.CheckSSLClientFlags()
+	services.SetupServiceLogging()
+
+	mux := http.NewServeMux()
+	healthz.RegisterDefaultChecks(mux)
+
+	e := env.New("vizier")
+	s := server.NewPLServer(e,
+		httpmiddleware.WithBearerAuthMiddleware(e, mux))
+
+	nc := msgbus.MustConnectNATS()
+	defer nc.Close()
+
+	numAgents := viper.GetInt("num_agents")
+	if numAgents <= 0 {
+		log.Fatal("num_agents must be positive")
+	}
+
+	sim := &simulator{
+		nc: nc,
+		cfg: &simConfig{
+			heartbeatInterval:       viper.GetDuration("heartbeat_interval"),
+			heartbeatTimeout:        viper.GetDuration("heartbeat_timeout"),
+			registerTimeout:         viper.GetDuration("register_timeout"),
+			schemaUpdateInterval:    viper.GetDuration("schema_update_interval"),
+			metadataRequestInterval: viper.GetDuration("metadata_request_interval"),
+			processesPerHeartbeat:   viper.GetInt("processes_per_heartbeat"),
+			numTables:               viper.GetInt("num_tables"),
+		},
+		numAgents:      numAgents,
+		rampUp:         viper.GetDuration("ramp_up_duration"),
+		churnPerMinute: viper.GetFloat64("agent_churn_per_minute"),
+		done:           make(chan struct{}),
+	}
+	sim.start()
+	defer sim.stop()
+
+	s.Start()
+	s.StopOnInterrupt()
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OperatorConfigName is the name of the OperatorConfig that the operator reads its settings from.
+// Any OperatorConfig with a different name is ignored.
+const OperatorConfigName = "default"
+
+// OperatorConfigSpec defines the settings of the operator itself. Changes take effect without
+// redeploying the operator.
+type OperatorConfigSpec struct {
+	// ReconcileIntervals specifies how often the operator runs its periodic checks. If not specified,
+	// defaults are used.
+	ReconcileIntervals *ReconcileIntervals `json:"reconcileIntervals,omitempty"`
+	// ArtifactMirror is the address of an artifact tracker that the operator should query for Vizier
+	// versions, instead of the artifact tracker of the Vizier's cloud.
+	ArtifactMirror string `json:"artifactMirror,omitempty"`
+	// UpdateChannel specifies which Vizier releases the operator considers when picking the latest
+	// version. If not specified, all releases are considered.
+	UpdateChannel UpdateChannel `json:"updateChannel,omitempty"`
+	// ResyncPeriod is how often each Vizier is reconciled, even if its spec hasn't changed. If not
+	// specified, Viziers are only reconciled when they change.
+	ResyncPeriod *metav1.Duration `json:"resyncPeriod,omitempty"`
+	// FeatureGates enables or disables operator features by name. Features that aren't listed use
+	// their default. See the FeatureGate constants for the known features.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	// EventSink is where the operator publishes CloudEvents when a Vizier is deployed, upgraded, degraded or
+	// deleted, so that automation can react to the changes without polling the Viziers. If not specified, no
+	// CloudEvents are published.
+	EventSink *EventSink `json:"eventSink,omitempty"`
+}
+
+// EventSink is a destination for the CloudEvents that the operator publishes. Exactly one of HTTP and NATS
+// must be set.
+type EventSink struct {
+	// HTTP posts the events to an HTTP endpoint.
+	HTTP *HTTPEventSink `json:"http,omitempty"`
+	// NATS publishes the events to a NATS subject.
+	NATS *NATSEventSink `json:"nats,omitempty"`
+}
+
+// HTTPEventSink posts CloudEvents to an HTTP endpoint, in the structured content mode of the CloudEvents
+// HTTP binding.
+type HTTPEventSink struct {
+	// URL is the endpoint that the events are posted to.
+	URL string `json:"url"`
+}
+
+// NATSEventSink publishes CloudEvents to a NATS subject, in the structured content mode of the CloudEvents
+// NATS binding.
+type NATSEventSink struct {
+	// URL is the address of the NATS servers, such as nats://nats.messaging.svc:4222.
+	URL string `json:"url"`
+	// Subject is the subject that the events are published to. Defaults to "pixie.vizier.lifecycle".
+	Subject string `json:"subject,omitempty"`
+}
+
+// ReconcileIntervals specifies how often the operator runs its periodic checks.
+type ReconcileIntervals struct {
+	// StatusCheck is how often the Vizier pods are checked for status updates.
+	StatusCheck *metav1.Duration `json:"statusCheck,omitempty"`
+	// UpdateCheck is how often the operator checks whether a Vizier update failed.
+	UpdateCheck *metav1.Duration `json:"updateCheck,omitempty"`
+	// UpdateTimeout is how long a Vizier update may run before it is considered failed.
+	UpdateTimeout *metav1.Duration `json:"updateTimeout,omitempty"`
+}
+
+// UpdateChannel defines which Vizier releases are considered when picking the latest version.
+// +kubebuilder:validation:Enum=stable;prerelease
+type UpdateChannel string
+
+const (
+	// UpdateChannelAll considers all releases.
+	UpdateChannelAll UpdateChannel = ""
+	// UpdateChannelStable only considers releases without a prerelease version, such as "0.12.3".
+	UpdateChannelStable UpdateChannel = "stable"
+	// UpdateChannelPrerelease considers all releases, including release candidates.
+	UpdateChannelPrerelease UpdateChannel = "prerelease"
+)
+
+// FeatureGate is the name of an operator feature that can be toggled in an OperatorConfig.
+type FeatureGate string
+
+const (
+	// FeatureGateAutoRepair allows the operator to try to repair unhealthy Viziers, for example by
+	// restarting crashing pods. Enabled by default.
+	FeatureGateAutoRepair FeatureGate = "AutoRepair"
+	// FeatureGateVersionCheck marks Viziers that are too far behind the latest release as degraded.
+	// Enabled by default.
+	FeatureGateVersionCheck FeatureGate = "VersionCheck"
+	// FeatureGatePodMonitor creates a Prometheus Operator PodMonitor that scrapes the operator's
+	// metrics, if the Prometheus Operator CRDs are installed. Disabled by default.
+	FeatureGatePodMonitor FeatureGate = "PodMonitor"
+	// FeatureGateMultiVizier lets the operator run a Vizier in each namespace that has a Vizier object, for
+	// example so that each team has its own Vizier with its own deploy key. The cluster-scoped resources of each
+	// Vizier are suffixed with its namespace, so that they don't collide. Disabled by default, in which case
+	// only the first Vizier in the cluster is deployed.
+	FeatureGateMultiVizier FeatureGate = "MultiVizier"
+)
+
+// DefaultFeatureGates contains the default state of each known feature gate.
+var DefaultFeatureGates = map[FeatureGate]bool{
+	FeatureGateAutoRepair:   true,
+	FeatureGateVersionCheck: true,
+	FeatureGatePodMonitor:   false,
+	FeatureGateMultiVizier:  false,
+}
+
+// OperatorConfigStatus defines the observed state of the OperatorConfig.
+type OperatorConfigStatus struct {
+	// ObservedGeneration is the generation of the spec that the operator last applied.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Message is a human-readable message with details about problems with the applied spec.
+	Message string `json:"message,omitempty"`
+}
+
+// OperatorConfig is the Schema for the operatorconfigs API
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+type OperatorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OperatorConfigSpec   `json:"spec,omitempty"`
+	Status OperatorConfigStatus `json:"status,omitempty"`
+}
+
+// OperatorConfigList contains a list of OperatorConfig
+// +kubebuilder:object:root=true
+type OperatorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OperatorConfig `json:"items"`
+}
@@ -27,6 +27,7 @@ package v1alpha1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"px.dev/pixie/src/shared/status"
@@ -81,6 +82,67 @@ type VizierSpec struct {
 	Registry string `json:"registry,omitempty"`
 	// Autopilot should be set if running Pixie on GKE Autopilot.
 	Autopilot bool `json:"autopilot,omitempty"`
+	// PEMAutoscaling configures the automatic adjustment of PEM resources, based on their observed usage and
+	// the size of the nodes they run on. When enabled, it overrides pemMemoryLimit and pemMemoryRequest.
+	PEMAutoscaling *PEMAutoscaling `json:"pemAutoscaling,omitempty"`
+	// JetStream configures the NATS JetStream persistence layer used for Vizier messaging.
+	JetStream *JetStreamParams `json:"jetStream,omitempty"`
+	// Backpressure configures when PEMs are asked to ingest less data, because the paths that consume their data
+	// are saturated.
+	Backpressure *BackpressurePolicy `json:"backpressure,omitempty"`
+	// Backfill configures whether and how far PEMs backfill the kernel data that was buffered while they restarted,
+	// balancing gap-free data against the CPU spike of restarting PEMs.
+	Backfill *BackfillPolicy `json:"backfill,omitempty"`
+	// ProtocolTracers enables or disables the tracing of protocols by the PEMs, by protocol name, for example
+	// {"dns": false, "kafka": true}. Changes are applied without restarting the PEMs. Protocols that aren't listed
+	// are traced according to the PEMs' flags.
+	ProtocolTracers map[string]bool `json:"protocolTracers,omitempty"`
+	// MetadataBackup configures periodic backups of the metadata store, which can be restored with MetadataRestore
+	// to recover from a disaster.
+	MetadataBackup *MetadataBackup `json:"metadataBackup,omitempty"`
+	// MetadataRestore restores the metadata store from a backup. Each backup is restored at most once, so this
+	// should be removed once the restore succeeded.
+	MetadataRestore *MetadataRestore `json:"metadataRestore,omitempty"`
+	// UpgradeStrategy configures how the operator rolls out a new Vizier version. By default, all components are
+	// upgraded at once.
+	UpgradeStrategy *UpgradeStrategy `json:"upgradeStrategy,omitempty"`
+	// RegistryMirror configures an internal registry that mirrors Pixie's images, for clusters that can't pull
+	// from public registries. Unlike registry, it is applied by the operator to every workload it creates, and
+	// keeps the image paths of the original registries. Only one of registry and registryMirror may be set.
+	RegistryMirror *RegistryMirror `json:"registryMirror,omitempty"`
+	// Scheduling controls which nodes the pods of individual Vizier components are scheduled on. It is applied
+	// on top of the nodeSelector and tolerations in pod, and changes are rolled out when Vizier is updated.
+	Scheduling *ComponentScheduling `json:"scheduling,omitempty"`
+	// Exposure exposes the query endpoint of Vizier outside of the cluster through an Ingress or a Gateway API
+	// route, so that clients can query Vizier directly instead of through Pixie Cloud.
+	Exposure *EndpointExposure `json:"exposure,omitempty"`
+	// NATS configures the NATS servers that Vizier uses for messaging.
+	NATS *NATSParams `json:"nats,omitempty"`
+	// CertRotation configures how the operator renews the service certs that it provisions for Vizier, before
+	// they expire.
+	CertRotation *CertRotation `json:"certRotation,omitempty"`
+	// CertSigning has the Vizier service certs signed by an external CA, such as an enterprise PKI or Vault,
+	// instead of a CA that the operator generates, so that they chain up to a trust root that the cluster's
+	// security team controls.
+	CertSigning *CertSigning `json:"certSigning,omitempty"`
+	// SecurityContextProfile hardens the security contexts of the Vizier workloads that don't require privileges,
+	// for clusters that enforce the restricted Pod Security Standard or OpenShift's security context constraints.
+	// The workloads that require privileges, such as the PEMs, are listed in the status. Defaults to Default.
+	SecurityContextProfile SecurityContextProfile `json:"securityContextProfile,omitempty"`
+	// CrashRemediation configures how the operator responds to crashlooping Vizier pods, once it has diagnosed
+	// the cause. The diagnosis is always reported in the Degraded condition, but no remediation is applied
+	// unless it is enabled here.
+	CrashRemediation *CrashRemediation `json:"crashRemediation,omitempty"`
+	// CrashDiagnostics configures the diagnostic bundles that the operator captures when Vizier pods crashloop,
+	// so that their logs and events are kept after the pods restart. No bundles are captured unless it is set.
+	CrashDiagnostics *CrashDiagnostics `json:"crashDiagnostics,omitempty"`
+	// DryRun makes the operator compute the changes that it would make to the Vizier resources for this spec,
+	// without applying them. The planned changes are listed in the status, and their diffs are published to
+	// the ConfigMap named there. Unsetting it rolls out the spec.
+	DryRun bool `json:"dryRun,omitempty"`
+	// DeletionPolicy configures which resources are kept when the Vizier is deleted. By default, all of the
+	// resources that the operator created for the Vizier are deleted.
+	DeletionPolicy *DeletionPolicy `json:"deletionPolicy,omitempty"`
 }
 
 // DataAccessLevel defines the levels of data access that can be used when executing a script on a cluster.
@@ -134,8 +196,53 @@ type VizierStatus struct {
 	Checksum []byte `json:"checksum,omitempty"`
 	// OperatorVersion is the actual version of the Operator instance.
 	OperatorVersion string `json:"operatorVersion,omitempty"`
+	// PEMResources are the resources that the operator has set on the PEMs of each node size class, when
+	// PEM autoscaling is enabled.
+	PEMResources []PEMClassResources `json:"pemResources,omitempty"`
+	// Conditions are the standard Kubernetes conditions of the Vizier. They mirror the VizierPhase and
+	// ReconciliationPhase in a form that generic tools, such as `kubectl wait` and Argo CD, understand.
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// MetadataBackup is the state of the metadata store backups and restores.
+	MetadataBackup *MetadataBackupStatus `json:"metadataBackup,omitempty"`
+	// Upgrade is the state of the most recent canary upgrade.
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+	// Certs is the state of the service certs of the Vizier.
+	Certs *CertStatus `json:"certs,omitempty"`
+	// PrivilegedWorkloads are the Vizier workloads that the security context profile can't restrict, because
+	// they require privileges.
+	PrivilegedWorkloads []PrivilegedWorkload `json:"privilegedWorkloads,omitempty"`
+	// DryRun is the set of changes that were most recently planned in dry-run mode.
+	DryRun *DryRunStatus `json:"dryRun,omitempty"`
+	// Deletion is the progress of the deletion of the Vizier's resources, once the Vizier is deleted.
+	Deletion *DeletionStatus `json:"deletion,omitempty"`
+	// CrashDiagnostics is the state of the most recent diagnostic bundle of crashlooping pods.
+	CrashDiagnostics *CrashDiagnosticsStatus `json:"crashDiagnostics,omitempty"`
 }
 
+const (
+	// VizierConditionAvailable indicates that the Vizier is queryable.
+	VizierConditionAvailable = "Available"
+	// VizierConditionProgressing indicates that the Reconciler is creating or updating the Vizier.
+	VizierConditionProgressing = "Progressing"
+	// VizierConditionDegraded indicates that the Vizier is not fully functioning.
+	VizierConditionDegraded = "Degraded"
+	// VizierConditionUpdateInProgress indicates that the Reconciler is updating an existing Vizier to a new version or spec.
+	VizierConditionUpdateInProgress = "UpdateInProgress"
+	// VizierConditionDiagnosticsCaptured indicates that the operator captured a diagnostic bundle of crashlooping pods.
+	VizierConditionDiagnosticsCaptured = "DiagnosticsCaptured"
+)
+
+const (
+	// VizierConditionReasonHealthy is the reason of the Available and Degraded conditions when the Vizier is healthy.
+	VizierConditionReasonHealthy = "Healthy"
+	// VizierConditionReasonUnknown is the reason of conditions that the Reconciler has not determined yet.
+	VizierConditionReasonUnknown = "Unknown"
+)
+
 // VizierPhase is a high-level summary of where the Vizier is in its lifecycle.
 type VizierPhase string
 
@@ -219,6 +326,29 @@ type DataCollectorParams struct {
 	DatastreamBufferSpikeSize uint32 `json:"datastreamBufferSpikeSize,omitempty"`
 	// This contains custom flags that should be passed to the PEM via environment variables.
 	CustomPEMFlags map[string]string `json:"customPEMFlags,omitempty"`
+	// TableStore configures how much data the PEMs keep in memory, and for how long.
+	TableStore *TableStoreParams `json:"tableStore,omitempty"`
+}
+
+// TableStoreParams configures the size and retention of the PEM table store.
+type TableStoreParams struct {
+	// TotalSize is the maximum amount of data stored across all tables on each PEM, for example "1280Mi".
+	// Defaults to a size based on the PEM memory limit.
+	TotalSize string `json:"totalSize,omitempty"`
+	// Retention is the maximum age of the data kept in tables without their own retention. By default,
+	// data is kept until the table is full.
+	Retention *metav1.Duration `json:"retention,omitempty"`
+	// Tables configures individual tables, keyed by table name, such as http_events.
+	Tables map[string]TableParams `json:"tables,omitempty"`
+}
+
+// TableParams configures the size and retention of a single table in the PEM table store.
+type TableParams struct {
+	// MaxSize is the maximum amount of data stored in the table, for example "512Mi". The tables without a
+	// MaxSize split the rest of the table store.
+	MaxSize string `json:"maxSize,omitempty"`
+	// Retention is the maximum age of the data kept in the table.
+	Retention *metav1.Duration `json:"retention,omitempty"`
 }
 
 // LeadershipElectionParams specifies configurable values for the K8s leaderships elections which Vizier uses manage pod leadership.
@@ -229,6 +359,666 @@ type LeadershipElectionParams struct {
 	ElectionPeriodMs int64 `json:"electionPeriodMs,omitempty"`
 }
 
+// NATSParams configures the NATS servers deployed by the operator.
+type NATSParams struct {
+	// Replicas is the number of NATS servers. More than one server forms a cluster that keeps Vizier messaging
+	// available while a server restarts or its node is drained: the operator creates a PodDisruptionBudget that
+	// allows only one server to be disrupted at a time, and JetStream streams are replicated to up to three
+	// servers. Must be 1 or an odd number, so that JetStream keeps its quorum. Defaults to 1.
+	Replicas int32 `json:"replicas,omitempty"`
+	// External points the Vizier at an existing NATS cluster, for users who centrally manage their messaging.
+	// When set, the operator doesn't deploy its own NATS servers, and Replicas only sets the number of replicas
+	// of the Vizier streams.
+	External *ExternalNATS `json:"external,omitempty"`
+	// ComponentCredentials gives each Vizier component its own NATS user, on top of the shared service certs.
+	// The PEMs and Kelvins are each issued a user by the metadata service when they start, which may only publish
+	// their updates to the metadata service and cloud connector, and only subscribe to the agent's own topics. This
+	// limits what the certs of a compromised node give access to. The operator generates the credentials and keeps
+	// them in the pl-nats-creds secret.
+	// Can't be used with an external NATS cluster.
+	ComponentCredentials bool `json:"componentCredentials,omitempty"`
+}
+
+// ExternalNATS describes how Vizier connects to an existing NATS cluster. JetStream streams in the Vizier
+// spec are created on the external cluster, which must have JetStream enabled.
+type ExternalNATS struct {
+	// URL is the address of the NATS cluster, such as tls://nats.messaging.svc:4222. Multiple servers may be
+	// given, separated by commas.
+	URL string `json:"url"`
+	// CredentialsSecret is the name of a secret in the Vizier namespace with a NATS credentials file, containing
+	// the user JWT and NKey seed, under the nats.creds key. If empty, Vizier connects without credentials.
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// TLS configures how Vizier verifies the NATS servers. Vizier only talks to NATS over TLS.
+	TLS *ExternalNATSTLS `json:"tls"`
+}
+
+// ExternalNATSTLS configures the TLS connection to an external NATS cluster.
+type ExternalNATSTLS struct {
+	// SecretName is the name of a secret in the Vizier namespace, with the CA cert that signed the NATS server
+	// certs under the ca.crt key.
+	SecretName string `json:"secretName"`
+	// ClientAuth specifies that the secret also holds a client cert and key, under the tls.crt and tls.key keys,
+	// for NATS servers that verify their clients. Otherwise, Vizier presents its own service cert.
+	ClientAuth bool `json:"clientAuth,omitempty"`
+}
+
+// CrashRemediation configures the remediations that the operator applies to crashlooping Vizier pods.
+type CrashRemediation struct {
+	// IncreasePEMMemory raises pemMemoryLimit by half when PEMs are OOMKilled, up to MaxPEMMemory. It has no
+	// effect when pemAutoscaling is enabled, since the autoscaler already sizes the PEMs.
+	IncreasePEMMemory bool `json:"increasePEMMemory,omitempty"`
+	// MaxPEMMemory is the highest memory limit that IncreasePEMMemory sets. Defaults to 4Gi.
+	MaxPEMMemory string `json:"maxPEMMemory,omitempty"`
+	// DisableTracingWithoutKernelHeaders limits the PEMs to the data sources that don't need kernel headers when
+	// they crash because the headers are missing on the node. The PEMs keep collecting metrics, but stop tracing
+	// protocols.
+	DisableTracingWithoutKernelHeaders bool `json:"disableTracingWithoutKernelHeaders,omitempty"`
+}
+
+// CrashDiagnostics configures the diagnostic bundles of crashlooping Vizier pods. A bundle is a gzipped tarball of
+// the recent logs, events and resources of the crashlooping pods. At least one of PVC and UploadToCloud must be set.
+type CrashDiagnostics struct {
+	// PVC is the name of a PersistentVolumeClaim in the Vizier namespace that bundles are written to.
+	PVC string `json:"pvc,omitempty"`
+	// Retention is the number of bundles kept on the PVC. Defaults to 5.
+	Retention int32 `json:"retention,omitempty"`
+	// UploadToCloud consents to uploading the bundles to Pixie Cloud through the cloud connector, where Pixie
+	// support can inspect them.
+	UploadToCloud bool `json:"uploadToCloud,omitempty"`
+	// LogLines is the number of lines of the current and previous logs that are captured from each crashlooping
+	// container. Defaults to 500.
+	LogLines int64 `json:"logLines,omitempty"`
+}
+
+// CrashDiagnosticsStatus is the state of the most recent diagnostic bundle of crashlooping pods.
+type CrashDiagnosticsStatus struct {
+	// LastBundle is the name of the most recent bundle.
+	LastBundle string `json:"lastBundle,omitempty"`
+	// LastBundleTime is the time that the most recent bundle was captured.
+	LastBundleTime *metav1.Time `json:"lastBundleTime,omitempty"`
+	// Reason is the reason of the Vizier status that the bundle was captured for.
+	Reason string `json:"reason,omitempty"`
+	// Containers are the crashlooping containers in the bundle, as <pod>/<container>.
+	Containers []string `json:"containers,omitempty"`
+	// StoredJob is the job that writes the bundle to the PVC, if one is configured.
+	StoredJob string `json:"storedJob,omitempty"`
+	// Uploaded is whether the bundle was uploaded to Pixie Cloud.
+	Uploaded bool `json:"uploaded,omitempty"`
+	// Message is a human-readable message with details about why the bundle couldn't be stored or uploaded.
+	Message string `json:"message,omitempty"`
+}
+
+// RetentionPolicy is whether a resource is deleted along with the Vizier.
+// +kubebuilder:validation:Enum=Delete;Retain
+type RetentionPolicy string
+
+const (
+	// RetentionPolicyDelete deletes the resource along with the Vizier.
+	RetentionPolicyDelete RetentionPolicy = "Delete"
+	// RetentionPolicyRetain keeps the resource after the Vizier is deleted.
+	RetentionPolicyRetain RetentionPolicy = "Retain"
+)
+
+// NATSDeletionPolicy is what happens to NATS when the Vizier is deleted.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type NATSDeletionPolicy string
+
+const (
+	// NATSDeletionPolicyDelete deletes NATS along with the Vizier.
+	NATSDeletionPolicyDelete NATSDeletionPolicy = "Delete"
+	// NATSDeletionPolicyOrphan leaves NATS running, including its JetStream volumes.
+	NATSDeletionPolicyOrphan NATSDeletionPolicy = "Orphan"
+)
+
+// DeletionPolicy configures which resources are kept when the Vizier is deleted. Kept resources no longer carry
+// the operator's label, and are annotated with the name of the Vizier that they were kept from.
+type DeletionPolicy struct {
+	// PersistentVolumeClaims is whether the PVCs of the Vizier, such as the metadata store and the JetStream volumes,
+	// are deleted. Defaults to Delete.
+	PersistentVolumeClaims RetentionPolicy `json:"persistentVolumeClaims,omitempty"`
+	// MetadataStore is whether the PVC of the metadata store is deleted, so that a reinstalled Vizier can pick up
+	// the stored metadata. It overrides persistentVolumeClaims for that PVC. Defaults to persistentVolumeClaims.
+	MetadataStore RetentionPolicy `json:"metadataStore,omitempty"`
+	// NATS is whether the NATS servers are deleted or orphaned. Orphaned servers keep running, along with their
+	// config, services and JetStream volumes. Defaults to Delete.
+	NATS NATSDeletionPolicy `json:"nats,omitempty"`
+}
+
+// DeletionPhase is the progress of the deletion of the Vizier's resources.
+type DeletionPhase string
+
+const (
+	// DeletionPhaseRetaining means that the resources that the deletion policy keeps are being released.
+	DeletionPhaseRetaining DeletionPhase = "Retaining"
+	// DeletionPhaseDeleting means that the remaining resources are being deleted.
+	DeletionPhaseDeleting DeletionPhase = "Deleting"
+	// DeletionPhaseCompleted means that the resources were deleted, and the Vizier is about to be removed.
+	DeletionPhaseCompleted DeletionPhase = "Completed"
+	// DeletionPhaseFailed means that the resources could not be deleted. The deletion is retried.
+	DeletionPhaseFailed DeletionPhase = "Failed"
+)
+
+// DeletionStatus is the progress of the deletion of the Vizier's resources.
+type DeletionStatus struct {
+	// Phase is how far the deletion has progressed.
+	Phase DeletionPhase `json:"phase,omitempty"`
+	// Message describes the phase, such as why the deletion failed.
+	Message string `json:"message,omitempty"`
+	// Retained are the resources that the deletion policy keeps, as kind/name.
+	Retained []string `json:"retained,omitempty"`
+}
+
+// PlannedAction is the action that the operator would take on a Vizier resource.
+type PlannedAction string
+
+const (
+	// PlannedActionCreate means that the resource does not exist yet, and would be created.
+	PlannedActionCreate PlannedAction = "Create"
+	// PlannedActionUpdate means that the resource exists, and would be updated.
+	PlannedActionUpdate PlannedAction = "Update"
+	// PlannedActionDelete means that the resource exists, and would be deleted.
+	PlannedActionDelete PlannedAction = "Delete"
+)
+
+// PlannedChange is a change that the operator would make to a Vizier resource.
+type PlannedChange struct {
+	// Kind is the kind of the resource, such as Deployment.
+	Kind string `json:"kind"`
+	// Name is the name of the resource.
+	Name string `json:"name"`
+	// Action is what the operator would do to the resource.
+	Action PlannedAction `json:"action"`
+}
+
+// DryRunStatus is the set of changes that the operator would make for a spec in dry-run mode.
+type DryRunStatus struct {
+	// Checksum is the checksum of the spec that the changes were planned for.
+	Checksum []byte `json:"checksum,omitempty"`
+	// PlannedTime is when the changes were planned.
+	PlannedTime metav1.Time `json:"plannedTime,omitempty"`
+	// ConfigMap is the name of the ConfigMap in the Vizier's namespace that holds the diffs of the planned changes.
+	ConfigMap string `json:"configMap,omitempty"`
+	// Changes are the resources that would be created, updated or deleted. Resources that would be left as they
+	// are aren't listed.
+	Changes []PlannedChange `json:"changes,omitempty"`
+}
+
+// SecurityContextProfile is the set of security context settings that the operator applies to Vizier workloads.
+type SecurityContextProfile string
+
+const (
+	// SecurityContextProfileDefault leaves the security contexts of the Vizier workloads as they are.
+	SecurityContextProfileDefault SecurityContextProfile = "Default"
+	// SecurityContextProfileRestricted makes the workloads that don't require privileges comply with the
+	// restricted Pod Security Standard: they run as non-root, without privilege escalation or capabilities, and
+	// with the runtime's default seccomp profile.
+	SecurityContextProfileRestricted SecurityContextProfile = "Restricted"
+	// SecurityContextProfileOpenShift restricts the workloads like Restricted, but leaves their user and group IDs
+	// to be assigned by OpenShift's restricted-v2 security context constraint. The service accounts of the
+	// workloads that require privileges are granted the privileged security context constraint.
+	SecurityContextProfileOpenShift SecurityContextProfile = "OpenShift"
+)
+
+// PrivilegedWorkload is a Vizier workload that requires privileges.
+type PrivilegedWorkload struct {
+	// Kind is the kind of the workload, such as DaemonSet.
+	Kind string `json:"kind"`
+	// Name is the name of the workload.
+	Name string `json:"name"`
+	// ServiceAccount is the service account that the pods of the workload run as.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Requirements are the settings of the workload that require privileges, such as hostPID or the capabilities
+	// that its containers add.
+	Requirements []string `json:"requirements"`
+}
+
+// CertRestartStrategy is how the Vizier pods pick up renewed service certs.
+type CertRestartStrategy string
+
+const (
+	// CertRestartRolling restarts the Vizier workloads through rolling updates that follow their own update
+	// strategies, so that the components stay available. Restarted pods also trust the previous CA, so that they
+	// can reach the components that haven't restarted yet. Workloads whose pod template has the px.dev/certs-hot-reload annotation
+	// set to "true" reload the certs from their mounted secret, and aren't restarted.
+	CertRestartRolling CertRestartStrategy = "Rolling"
+	// CertRestartRecreate deletes all Vizier pods at once, so that no pods with the old certs remain. Pods with
+	// the px.dev/certs-hot-reload annotation are kept.
+	CertRestartRecreate CertRestartStrategy = "Recreate"
+)
+
+// CertRotation configures the renewal of the Vizier service certs.
+type CertRotation struct {
+	// RenewBefore is how long before the certs expire that they are renewed. Defaults to 720h (30 days).
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+	// RestartStrategy is how the Vizier pods pick up the renewed certs. Defaults to Rolling.
+	RestartStrategy CertRestartStrategy `json:"restartStrategy,omitempty"`
+}
+
+// CertSigning configures the external CA that signs the Vizier service certs. The certs are requested through
+// the Kubernetes CertificateSigningRequest API, so any CA that is integrated with it as a signer can be used.
+type CertSigning struct {
+	// SignerName is the signer that the CertificateSigningRequests are addressed to.
+	SignerName string `json:"signerName"`
+	// CABundle is the PEM encoded trust root of the signer, which the Vizier services use to verify each other.
+	CABundle string `json:"caBundle"`
+	// AutoApprove makes the operator approve its own CertificateSigningRequests. Otherwise, they must be
+	// approved by an approver of the signer.
+	AutoApprove bool `json:"autoApprove,omitempty"`
+	// Duration is the validity that is requested for the certs. The signer may issue certs with a different
+	// validity. Defaults to the signer's default.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Timeout is how long to wait for the certs to be approved and issued. Defaults to 10m.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// CertStatus is the state of the Vizier service certs.
+type CertStatus struct {
+	// NotAfter is when the first of the service certs expires.
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// LastRotationTime is when the operator last renewed the certs.
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	// PendingSince is when the CA of the renewed certs was added to the trusted CAs. The renewed certs are
+	// swapped in once all of the Vizier pods picked it up.
+	PendingSince *metav1.Time `json:"pendingSince,omitempty"`
+	// Message is a human-readable message with details about why the most recent renewal failed.
+	Message string `json:"message,omitempty"`
+}
+
+// JetStreamStorage is where JetStream stores its messages.
+type JetStreamStorage string
+
+const (
+	// JetStreamStorageFile stores messages on a persistent volume, so that they survive NATS restarts.
+	JetStreamStorageFile JetStreamStorage = "file"
+	// JetStreamStorageMemory stores messages in memory, for clusters without persistent volume support.
+	JetStreamStorageMemory JetStreamStorage = "memory"
+)
+
+// JetStreamRetention is the retention policy of a JetStream stream.
+type JetStreamRetention string
+
+const (
+	// JetStreamRetentionLimits keeps messages until the stream's limits are reached.
+	JetStreamRetentionLimits JetStreamRetention = "limits"
+	// JetStreamRetentionInterest keeps messages until all consumers have acknowledged them.
+	JetStreamRetentionInterest JetStreamRetention = "interest"
+	// JetStreamRetentionWorkQueue keeps messages until any consumer has acknowledged them.
+	JetStreamRetentionWorkQueue JetStreamRetention = "workqueue"
+)
+
+// JetStreamParams configures the NATS JetStream persistence layer used for Vizier messaging. When enabled, the
+// operator configures JetStream on the NATS server, and creates the given streams and consumers.
+type JetStreamParams struct {
+	// Enabled specifies whether JetStream should be enabled on the NATS server.
+	Enabled bool `json:"enabled,omitempty"`
+	// Storage is where JetStream stores its messages, either "file" or "memory". Defaults to "file", or to "memory"
+	// if Vizier is deployed without persistent volumes. Changing the storage recreates the NATS server and its streams.
+	Storage JetStreamStorage `json:"storage,omitempty"`
+	// StorageSize is the maximum size of the JetStream storage, and of its persistent volume. Defaults to 1Gi.
+	StorageSize string `json:"storageSize,omitempty"`
+	// Streams are the streams that the operator creates and keeps up to date. Streams that are removed from
+	// this list are not deleted.
+	Streams []JetStreamStream `json:"streams,omitempty"`
+}
+
+// JetStreamStream is a JetStream stream managed by the operator.
+type JetStreamStream struct {
+	// Name is the name of the stream.
+	Name string `json:"name"`
+	// Subjects are the subjects captured by the stream. Wildcards are supported.
+	Subjects []string `json:"subjects"`
+	// Retention is the retention policy of the stream, one of "limits", "interest" or "workqueue". Defaults to "limits".
+	Retention JetStreamRetention `json:"retention,omitempty"`
+	// MaxAge is the maximum age of the messages in the stream. Unlimited if not set.
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// MaxBytes is the maximum size of the stream, in bytes. Unlimited if not set.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+	// MaxMsgs is the maximum number of messages in the stream. Unlimited if not set.
+	MaxMsgs int64 `json:"maxMsgs,omitempty"`
+	// Consumers are the durable consumers of the stream that the operator creates and keeps up to date.
+	Consumers []JetStreamConsumer `json:"consumers,omitempty"`
+}
+
+// JetStreamConsumer is a durable JetStream consumer managed by the operator.
+type JetStreamConsumer struct {
+	// Name is the durable name of the consumer.
+	Name string `json:"name"`
+	// FilterSubject restricts the consumer to the messages of the stream on this subject.
+	FilterSubject string `json:"filterSubject,omitempty"`
+	// AckWait is how long the server waits for an acknowledgement before redelivering a message. Defaults to 30s.
+	AckWait *metav1.Duration `json:"ackWait,omitempty"`
+	// MaxAckPending is the maximum number of unacknowledged messages. Defaults to 50.
+	MaxAckPending int32 `json:"maxAckPending,omitempty"`
+}
+
+// PEMAutoscaling configures the automatic adjustment of PEM resources. The operator periodically samples the
+// resource usage of PEMs from the metrics API, and sets their requests to the peak usage plus some headroom,
+// within the given bounds.
+type PEMAutoscaling struct {
+	// Enabled specifies whether the operator should adjust the resources of PEMs.
+	Enabled bool `json:"enabled,omitempty"`
+	// MinMemory is the smallest memory request and limit set on PEMs. Defaults to 1Gi.
+	MinMemory string `json:"minMemory,omitempty"`
+	// MaxMemory is the largest memory request and limit set on PEMs. Defaults to 8Gi.
+	MaxMemory string `json:"maxMemory,omitempty"`
+	// MinCPU is the smallest CPU request set on PEMs. Defaults to 100m.
+	MinCPU string `json:"minCPU,omitempty"`
+	// MaxCPU is the largest CPU request set on PEMs. Defaults to 2.
+	MaxCPU string `json:"maxCPU,omitempty"`
+	// MaxNodeMemoryPercent is the largest percentage of a node's allocatable memory that its PEM may use.
+	// Defaults to 25.
+	MaxNodeMemoryPercent int32 `json:"maxNodeMemoryPercent,omitempty"`
+	// NodeSizeClasses groups the nodes of the cluster by their allocatable memory. The PEMs of each class are
+	// deployed in a separate DaemonSet, and their resources are adjusted independently. If no classes are
+	// specified, all PEMs get the same resources.
+	NodeSizeClasses []PEMNodeSizeClass `json:"nodeSizeClasses,omitempty"`
+}
+
+// BackpressurePolicy configures the backpressure signals that the metadata service sends to PEMs. The query broker
+// reports how saturated kelvin and the result exports are, and the PEMs are asked to reduce sampling, and then to
+// pause low priority tables, as the saturation increases.
+type BackpressurePolicy struct {
+	// Enabled specifies whether PEMs should be sent backpressure signals.
+	Enabled bool `json:"enabled,omitempty"`
+	// ReduceSamplingThresholdPercent is the saturation of a data path, as a percentage, above which PEMs reduce
+	// sampling. Defaults to 80.
+	ReduceSamplingThresholdPercent int32 `json:"reduceSamplingThresholdPercent,omitempty"`
+	// SamplingPercent is the percentage of traced events that PEMs keep while sampling is reduced. Defaults to 50.
+	SamplingPercent int32 `json:"samplingPercent,omitempty"`
+	// PauseTablesThresholdPercent is the saturation of a data path, as a percentage, above which PEMs also stop
+	// collecting the LowPriorityTables. Defaults to 95.
+	PauseTablesThresholdPercent int32 `json:"pauseTablesThresholdPercent,omitempty"`
+	// LowPriorityTables are the tables that PEMs stop collecting when a data path is nearly full, for example
+	// "conn_stats" or "stack_traces.beta".
+	LowPriorityTables []string `json:"lowPriorityTables,omitempty"`
+}
+
+// BackfillPolicy configures how the metadata service coordinates the backfills of restarted PEMs. A backfill
+// closes the gap in the data that a PEM restart causes, but costs CPU, so only a few PEMs backfill at a time.
+type BackfillPolicy struct {
+	// Enabled specifies whether restarted PEMs backfill their buffered data. Otherwise the data is dropped.
+	Enabled bool `json:"enabled,omitempty"`
+	// MaxAge is how far back PEMs backfill. Older buffered data is dropped. By default, all buffered data is
+	// backfilled.
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// MaxConcurrentPEMs is how many PEMs may backfill at the same time. The other restarted PEMs wait for their
+	// turn. Defaults to 2.
+	MaxConcurrentPEMs int32 `json:"maxConcurrentPEMs,omitempty"`
+	// Timeout is how long a PEM may spend backfilling, before it stops and lets the next PEM backfill. Defaults
+	// to 5m.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// MetadataBackup configures periodic backups of the metadata store. When the metadata is stored on a persistent
+// volume, a backup is an archive of the volume. When it is stored in etcd, a backup is an etcd snapshot.
+type MetadataBackup struct {
+	// Enabled specifies whether the metadata store should be backed up.
+	Enabled bool `json:"enabled,omitempty"`
+	// Interval is how often the metadata store is backed up. Defaults to 6h.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Retention is the number of backups kept on a PVC destination. Defaults to 7. Backups in an object store are
+	// never deleted by Vizier, use the lifecycle rules of the bucket to expire them instead.
+	Retention int32 `json:"retention,omitempty"`
+	// Destination is where backups are stored.
+	Destination MetadataBackupDestination `json:"destination"`
+}
+
+// MetadataBackupDestination is where metadata backups are stored. Exactly one of PVC and ObjectStore must be set.
+type MetadataBackupDestination struct {
+	// PVC is the name of a PersistentVolumeClaim in the Vizier namespace that backups are written to.
+	PVC string `json:"pvc,omitempty"`
+	// ObjectStore is an S3-compatible bucket that backups are uploaded to.
+	ObjectStore *ObjectStoreDestination `json:"objectStore,omitempty"`
+}
+
+// ObjectStoreDestination is an S3-compatible bucket.
+type ObjectStoreDestination struct {
+	// URL is the URL of the bucket, followed by the prefix of the backups, for example
+	// "https://my-bucket.s3.us-west-2.amazonaws.com/pixie".
+	URL string `json:"url"`
+	// Region is the region of the bucket, which is used to sign requests. Defaults to "us-east-1".
+	Region string `json:"region,omitempty"`
+	// CredentialsSecret is the name of a secret in the Vizier namespace, with the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY used to access the bucket.
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+// MetadataRestore restores the metadata store from a backup in the MetadataBackup destination. Only metadata
+// that is stored on a persistent volume can be restored.
+type MetadataRestore struct {
+	// BackupName is the name of the backup to restore, as reported in the lastSuccessfulBackup of the status.
+	BackupName string `json:"backupName"`
+}
+
+// MetadataBackupPhase is the phase of a metadata backup or restore.
+type MetadataBackupPhase string
+
+const (
+	// MetadataBackupPhaseRunning indicates that the backup or restore is in progress.
+	MetadataBackupPhaseRunning MetadataBackupPhase = "Running"
+	// MetadataBackupPhaseSucceeded indicates that the backup or restore completed.
+	MetadataBackupPhaseSucceeded MetadataBackupPhase = "Succeeded"
+	// MetadataBackupPhaseFailed indicates that the backup or restore failed.
+	MetadataBackupPhaseFailed MetadataBackupPhase = "Failed"
+)
+
+// MetadataBackupStatus is the state of the metadata store backups and restores.
+type MetadataBackupStatus struct {
+	// LastBackup is the name of the most recent backup.
+	LastBackup string `json:"lastBackup,omitempty"`
+	// LastBackupPhase is the phase of the most recent backup.
+	LastBackupPhase MetadataBackupPhase `json:"lastBackupPhase,omitempty"`
+	// LastBackupTime is the time that the most recent backup started.
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+	// LastSuccessfulBackup is the name of the most recent backup that succeeded, which can be restored.
+	LastSuccessfulBackup string `json:"lastSuccessfulBackup,omitempty"`
+	// LastSuccessfulBackupTime is the time that the most recent successful backup started.
+	LastSuccessfulBackupTime *metav1.Time `json:"lastSuccessfulBackupTime,omitempty"`
+	// Message is a human-readable message with details about why the most recent backup failed.
+	Message string `json:"message,omitempty"`
+	// Restore is the state of the most recent restore.
+	Restore *MetadataRestoreStatus `json:"restore,omitempty"`
+}
+
+// MetadataRestoreStatus is the state of a metadata restore.
+type MetadataRestoreStatus struct {
+	// BackupName is the name of the backup that is restored.
+	BackupName string `json:"backupName,omitempty"`
+	// Phase is the phase of the restore.
+	Phase MetadataBackupPhase `json:"phase,omitempty"`
+	// Message is a human-readable message with details about why the restore failed.
+	Message string `json:"message,omitempty"`
+	// CompletionTime is the time that the restore completed.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// UpgradeStrategyType is the way that a new Vizier version is rolled out.
+type UpgradeStrategyType string
+
+const (
+	// UpgradeStrategyAllAtOnce upgrades all Vizier components at once.
+	UpgradeStrategyAllAtOnce UpgradeStrategyType = "AllAtOnce"
+	// UpgradeStrategyCanary first upgrades the PEMs of a subset of nodes, and only upgrades the rest of Vizier
+	// once the canary PEMs have been healthy for a soak period.
+	UpgradeStrategyCanary UpgradeStrategyType = "Canary"
+)
+
+// UpgradeStrategy configures how the operator rolls out a new Vizier version.
+type UpgradeStrategy struct {
+	// Type is the way that a new version is rolled out. Defaults to AllAtOnce.
+	Type UpgradeStrategyType `json:"type,omitempty"`
+	// Canary configures canary upgrades, when the type is Canary.
+	Canary *CanaryUpgrade `json:"canary,omitempty"`
+}
+
+// CanaryUpgrade configures a canary upgrade. The new PEM version is deployed to a subset of nodes, and the canary
+// is rolled back if the canary PEMs crash or stop sending heartbeats, or if too many queries fail during the soak
+// period.
+type CanaryUpgrade struct {
+	// NodePercent is the percentage of nodes that run the canary PEMs. At least one node is always used.
+	// Defaults to 10.
+	NodePercent int32 `json:"nodePercent,omitempty"`
+	// SoakPeriod is how long the canary PEMs must stay healthy before the rest of Vizier is upgraded.
+	// Defaults to 15m.
+	SoakPeriod *metav1.Duration `json:"soakPeriod,omitempty"`
+	// MaxQueryErrorPercent is the percentage of queries that may fail during the soak period before the canary
+	// is rolled back. Defaults to 10.
+	MaxQueryErrorPercent int32 `json:"maxQueryErrorPercent,omitempty"`
+}
+
+// UpgradePhase is the phase of a canary upgrade.
+type UpgradePhase string
+
+const (
+	// UpgradePhaseCanary indicates that the canary PEMs are running, and their health is being verified.
+	UpgradePhaseCanary UpgradePhase = "Canary"
+	// UpgradePhasePromoted indicates that the canary was healthy, and the new version was rolled out to all of Vizier.
+	UpgradePhasePromoted UpgradePhase = "Promoted"
+	// UpgradePhaseRolledBack indicates that the canary was unhealthy and was removed. The new version is not
+	// retried until the version in the spec changes.
+	UpgradePhaseRolledBack UpgradePhase = "RolledBack"
+)
+
+// UpgradeStatus is the state of a canary upgrade.
+type UpgradeStatus struct {
+	// Phase is the phase of the upgrade.
+	Phase UpgradePhase `json:"phase,omitempty"`
+	// FromVersion is the Vizier version that was running before the upgrade.
+	FromVersion string `json:"fromVersion,omitempty"`
+	// ToVersion is the Vizier version that is rolled out.
+	ToVersion string `json:"toVersion,omitempty"`
+	// CanaryNodes are the nodes that run the canary PEMs.
+	CanaryNodes []string `json:"canaryNodes,omitempty"`
+	// StartTime is the time that the canary PEMs were deployed.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Message is a human-readable message with details about why the canary was rolled back.
+	Message string `json:"message,omitempty"`
+}
+
+// ComponentScheduling configures the scheduling of individual Vizier components.
+type ComponentScheduling struct {
+	// PEM configures the scheduling of the PEM DaemonSets, for example to keep PEMs off of nodes that should not
+	// be traced.
+	PEM *Scheduling `json:"pem,omitempty"`
+	// Kelvin configures the scheduling of Kelvin.
+	Kelvin *Scheduling `json:"kelvin,omitempty"`
+	// Metadata configures the scheduling of the metadata service.
+	Metadata *Scheduling `json:"metadata,omitempty"`
+	// NATS configures the scheduling of the NATS message bus.
+	NATS *Scheduling `json:"nats,omitempty"`
+}
+
+// Scheduling controls which nodes the pods of a Vizier component are scheduled on.
+// More info: https://kubernetes.io/docs/concepts/scheduling-eviction/assign-pod-node/
+type Scheduling struct {
+	// NodeSelector must match a node's labels for the pods to be scheduled on that node. It is merged with the
+	// nodeSelector in pod, and takes precedence for keys that are in both.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations allow scheduling the pods on nodes with matching taints. They are added to the tolerations in pod.
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+	// Affinity adds scheduling constraints to the pods. Node affinity requirements must be met in addition to the
+	// requirements that Vizier already has, such as only running on Linux nodes.
+	Affinity *v1.Affinity `json:"affinity,omitempty"`
+}
+
+// RegistryMirror configures the internal registry that all Vizier images are pulled from.
+type RegistryMirror struct {
+	// Host is the host, and optionally the port, of the mirror, for example "registry.internal:5000". The registry
+	// host of every image is replaced with it.
+	Host string `json:"host"`
+	// PathRewrites rewrite the path of images in the mirror. The first rewrite whose prefix matches the leading
+	// components of the path of an image, without its registry host, is applied.
+	PathRewrites []RegistryPathRewrite `json:"pathRewrites,omitempty"`
+	// PullSecrets are the names of the image pull secrets for the mirror. The secrets must exist in the
+	// namespace of Vizier.
+	PullSecrets []string `json:"pullSecrets,omitempty"`
+}
+
+// RegistryPathRewrite replaces the leading components of an image path, for example to rewrite
+// "pixie-oss/pixie-prod" to "pixie".
+type RegistryPathRewrite struct {
+	// Prefix is the leading components of the image path that are replaced.
+	Prefix string `json:"prefix"`
+	// Replacement replaces the prefix. An empty replacement removes the prefix.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// ExposureType is the kind of resource that exposes the query endpoint of Vizier.
+type ExposureType string
+
+const (
+	// ExposureTypeIngress exposes the query endpoint through an Ingress.
+	ExposureTypeIngress ExposureType = "Ingress"
+	// ExposureTypeGateway exposes the query endpoint through a Gateway API HTTPRoute.
+	ExposureTypeGateway ExposureType = "Gateway"
+)
+
+// EndpointExposure configures the resources that expose the query endpoint of Vizier. The query broker serves
+// gRPC, gRPC-Web and JSON over TLS, so the ingress controller or gateway must use TLS to reach it.
+type EndpointExposure struct {
+	// Type is the kind of resource that exposes the query endpoint, either Ingress or Gateway.
+	Type ExposureType `json:"type"`
+	// Hostname is the DNS name that the query endpoint is served on.
+	Hostname string `json:"hostname"`
+	// IngressClassName is the class of the Ingress. Only used by the Ingress type.
+	IngressClassName string `json:"ingressClassName,omitempty"`
+	// TLSSecretName is the name of the secret with the certificate for the hostname, which the Ingress terminates
+	// TLS with. Only used by the Ingress type.
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+	// Gateway is the Gateway that the route is attached to. Required by the Gateway type.
+	Gateway *GatewayReference `json:"gateway,omitempty"`
+	// Annotations are added to the Ingress or route, for example to tell the ingress controller that the
+	// backend speaks gRPC over TLS.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ExternalDNS annotates the Ingress or route for external-dns, so that it creates a DNS record for the
+	// hostname.
+	ExternalDNS *ExternalDNS `json:"externalDNS,omitempty"`
+}
+
+// GatewayReference refers to a Gateway API Gateway.
+type GatewayReference struct {
+	// Name is the name of the Gateway.
+	Name string `json:"name"`
+	// Namespace is the namespace of the Gateway. Defaults to the namespace of Vizier.
+	Namespace string `json:"namespace,omitempty"`
+	// SectionName is the name of the listener of the Gateway to attach to. By default, the route is attached to
+	// all listeners that allow it.
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// ExternalDNS configures the external-dns annotations of the resources that expose Vizier.
+type ExternalDNS struct {
+	// Enabled adds the external-dns hostname annotation.
+	Enabled bool `json:"enabled,omitempty"`
+	// TTL is the TTL of the DNS record, in seconds. Defaults to the TTL that external-dns is configured with.
+	TTL int32 `json:"ttl,omitempty"`
+	// Target overrides the address that the DNS record points to, for example when the load balancer does not
+	// report its address in the status of the Ingress or Gateway.
+	Target string `json:"target,omitempty"`
+}
+
+// PEMNodeSizeClass is a class of nodes with similar amounts of allocatable memory.
+type PEMNodeSizeClass struct {
+	// Name is the name of the class. It must be a valid label value.
+	Name string `json:"name"`
+	// MinNodeMemory is the least allocatable memory of the nodes in the class. Nodes belong to the class with
+	// the largest MinNodeMemory that they have, or to the class with the smallest MinNodeMemory if they are
+	// smaller than all classes.
+	MinNodeMemory string `json:"minNodeMemory,omitempty"`
+}
+
+// PEMClassResources are the resources set on the PEMs of a node size class.
+type PEMClassResources struct {
+	// Class is the name of the node size class, or empty if no classes are specified.
+	Class string `json:"class,omitempty"`
+	// Memory is the memory request and limit of the PEMs.
+	Memory string `json:"memory,omitempty"`
+	// CPU is the CPU request of the PEMs.
+	CPU string `json:"cpu,omitempty"`
+	// LastUpdateTime is the last time that the resources changed.
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
 // Vizier is the Schema for the viziers API
 // +genclient
 // +genclient:noStatus
@@ -247,6 +1037,17 @@ func (vz *Vizier) SetReconciliationPhase(rp ReconciliationPhase) {
 	vz.Status.ReconciliationPhase = rp
 	timeNow := metav1.Now()
 	vz.Status.LastReconciliationPhaseTime = &timeNow
+
+	switch rp {
+	case ReconciliationPhaseUpdating:
+		vz.SetCondition(VizierConditionProgressing, metav1.ConditionTrue, string(rp), "The operator is deploying Vizier.")
+	case ReconciliationPhaseReady:
+		vz.SetCondition(VizierConditionProgressing, metav1.ConditionFalse, string(rp), "Vizier is deployed at the desired version.")
+		vz.SetCondition(VizierConditionUpdateInProgress, metav1.ConditionFalse, string(rp), "")
+	case ReconciliationPhaseFailed:
+		vz.SetCondition(VizierConditionProgressing, metav1.ConditionFalse, string(rp), "The operator failed to deploy Vizier.")
+		vz.SetCondition(VizierConditionUpdateInProgress, metav1.ConditionFalse, string(rp), "")
+	}
 }
 
 // SetStatus updates the Vizier status with the given Reason.
@@ -254,6 +1055,35 @@ func (vz *Vizier) SetStatus(reason status.VizierReason) {
 	vz.Status.VizierPhase = ReasonToPhase(reason)
 	vz.Status.VizierReason = string(reason)
 	vz.Status.Message = reason.GetMessage()
+
+	condReason := string(reason)
+	if reason == "" {
+		condReason = VizierConditionReasonHealthy
+	}
+	available, degraded := metav1.ConditionFalse, metav1.ConditionTrue
+	switch vz.Status.VizierPhase {
+	case VizierPhaseHealthy:
+		available, degraded = metav1.ConditionTrue, metav1.ConditionFalse
+	case VizierPhaseDegraded:
+		available = metav1.ConditionTrue
+	}
+	vz.SetCondition(VizierConditionAvailable, available, condReason, vz.Status.Message)
+	vz.SetCondition(VizierConditionDegraded, degraded, condReason, vz.Status.Message)
+}
+
+// SetCondition adds or updates the condition of the given type. The transition time only changes when the
+// status of the condition changes.
+func (vz *Vizier) SetCondition(condType string, condStatus metav1.ConditionStatus, reason, message string) {
+	if reason == "" {
+		reason = VizierConditionReasonUnknown
+	}
+	meta.SetStatusCondition(&vz.Status.Conditions, metav1.Condition{
+		Type:               condType,
+		Status:             condStatus,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: vz.Generation,
+	})
 }
 
 // ReasonToPhase converts the Reason into the relevant Phase.
@@ -263,7 +1093,8 @@ func ReasonToPhase(reason status.VizierReason) VizierPhase {
 		return VizierPhaseHealthy
 	case status.CloudConnectorMissing:
 		return VizierPhaseDisconnected
-	case status.PEMsSomeInsufficientMemory, status.KernelVersionsIncompatible, status.PEMsHighFailureRate:
+	case status.PEMsSomeInsufficientMemory, status.KernelVersionsIncompatible, status.PEMsHighFailureRate,
+		status.PodsOOMKilled, status.KernelHeadersMissing, status.PodsCrashLooping:
 		return VizierPhaseDegraded
 	default:
 		return VizierPhaseUnhealthy
@@ -7,42 +7,882 @@ package v1alpha1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackfillPolicy) DeepCopyInto(out *BackfillPolicy) {
+	*out = *in
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackfillPolicy.
+func (in *BackfillPolicy) DeepCopy() *BackfillPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BackfillPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackpressurePolicy) DeepCopyInto(out *BackpressurePolicy) {
+	*out = *in
+	if in.LowPriorityTables != nil {
+		in, out := &in.LowPriorityTables, &out.LowPriorityTables
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackpressurePolicy.
+func (in *BackpressurePolicy) DeepCopy() *BackpressurePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BackpressurePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryUpgrade) DeepCopyInto(out *CanaryUpgrade) {
+	*out = *in
+	if in.SoakPeriod != nil {
+		in, out := &in.SoakPeriod, &out.SoakPeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryUpgrade.
+func (in *CanaryUpgrade) DeepCopy() *CanaryUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertRotation) DeepCopyInto(out *CertRotation) {
+	*out = *in
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertRotation.
+func (in *CertRotation) DeepCopy() *CertRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(CertRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertSigning) DeepCopyInto(out *CertSigning) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertSigning.
+func (in *CertSigning) DeepCopy() *CertSigning {
+	if in == nil {
+		return nil
+	}
+	out := new(CertSigning)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertStatus) DeepCopyInto(out *CertStatus) {
+	*out = *in
+	if in.NotAfter != nil {
+		in, out := &in.NotAfter, &out.NotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PendingSince != nil {
+		in, out := &in.PendingSince, &out.PendingSince
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertStatus.
+func (in *CertStatus) DeepCopy() *CertStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentScheduling) DeepCopyInto(out *ComponentScheduling) {
+	*out = *in
+	if in.PEM != nil {
+		in, out := &in.PEM, &out.PEM
+		*out = new(Scheduling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Kelvin != nil {
+		in, out := &in.Kelvin, &out.Kelvin
+		*out = new(Scheduling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(Scheduling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NATS != nil {
+		in, out := &in.NATS, &out.NATS
+		*out = new(Scheduling)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentScheduling.
+func (in *ComponentScheduling) DeepCopy() *ComponentScheduling {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentScheduling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrashDiagnostics) DeepCopyInto(out *CrashDiagnostics) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrashDiagnostics.
+func (in *CrashDiagnostics) DeepCopy() *CrashDiagnostics {
+	if in == nil {
+		return nil
+	}
+	out := new(CrashDiagnostics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrashDiagnosticsStatus) DeepCopyInto(out *CrashDiagnosticsStatus) {
+	*out = *in
+	if in.LastBundleTime != nil {
+		in, out := &in.LastBundleTime, &out.LastBundleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrashDiagnosticsStatus.
+func (in *CrashDiagnosticsStatus) DeepCopy() *CrashDiagnosticsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CrashDiagnosticsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrashRemediation) DeepCopyInto(out *CrashRemediation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrashRemediation.
+func (in *CrashRemediation) DeepCopy() *CrashRemediation {
+	if in == nil {
+		return nil
+	}
+	out := new(CrashRemediation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataCollectorParams) DeepCopyInto(out *DataCollectorParams) {
 	*out = *in
-	if in.CustomPEMFlags != nil {
-		in, out := &in.CustomPEMFlags, &out.CustomPEMFlags
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
+	if in.CustomPEMFlags != nil {
+		in, out := &in.CustomPEMFlags, &out.CustomPEMFlags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TableStore != nil {
+		in, out := &in.TableStore, &out.TableStore
+		*out = new(TableStoreParams)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataCollectorParams.
+func (in *DataCollectorParams) DeepCopy() *DataCollectorParams {
+	if in == nil {
+		return nil
+	}
+	out := new(DataCollectorParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeletionPolicy) DeepCopyInto(out *DeletionPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeletionPolicy.
+func (in *DeletionPolicy) DeepCopy() *DeletionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DeletionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeletionStatus) DeepCopyInto(out *DeletionStatus) {
+	*out = *in
+	if in.Retained != nil {
+		in, out := &in.Retained, &out.Retained
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeletionStatus.
+func (in *DeletionStatus) DeepCopy() *DeletionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DeletionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DryRunStatus) DeepCopyInto(out *DryRunStatus) {
+	*out = *in
+	if in.Checksum != nil {
+		in, out := &in.Checksum, &out.Checksum
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	in.PlannedTime.DeepCopyInto(&out.PlannedTime)
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]PlannedChange, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DryRunStatus.
+func (in *DryRunStatus) DeepCopy() *DryRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DryRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointExposure) DeepCopyInto(out *EndpointExposure) {
+	*out = *in
+	if in.Gateway != nil {
+		in, out := &in.Gateway, &out.Gateway
+		*out = new(GatewayReference)
+		**out = **in
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExternalDNS != nil {
+		in, out := &in.ExternalDNS, &out.ExternalDNS
+		*out = new(ExternalDNS)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointExposure.
+func (in *EndpointExposure) DeepCopy() *EndpointExposure {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointExposure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EventSink) DeepCopyInto(out *EventSink) {
+	*out = *in
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPEventSink)
+		**out = **in
+	}
+	if in.NATS != nil {
+		in, out := &in.NATS, &out.NATS
+		*out = new(NATSEventSink)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EventSink.
+func (in *EventSink) DeepCopy() *EventSink {
+	if in == nil {
+		return nil
+	}
+	out := new(EventSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalDNS) DeepCopyInto(out *ExternalDNS) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalDNS.
+func (in *ExternalDNS) DeepCopy() *ExternalDNS {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalDNS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalNATS) DeepCopyInto(out *ExternalNATS) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(ExternalNATSTLS)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalNATS.
+func (in *ExternalNATS) DeepCopy() *ExternalNATS {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalNATS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalNATSTLS) DeepCopyInto(out *ExternalNATSTLS) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalNATSTLS.
+func (in *ExternalNATSTLS) DeepCopy() *ExternalNATSTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalNATSTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GatewayReference) DeepCopyInto(out *GatewayReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayReference.
+func (in *GatewayReference) DeepCopy() *GatewayReference {
+	if in == nil {
+		return nil
+	}
+	out := new(GatewayReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPEventSink) DeepCopyInto(out *HTTPEventSink) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPEventSink.
+func (in *HTTPEventSink) DeepCopy() *HTTPEventSink {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPEventSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JetStreamConsumer) DeepCopyInto(out *JetStreamConsumer) {
+	*out = *in
+	if in.AckWait != nil {
+		in, out := &in.AckWait, &out.AckWait
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JetStreamConsumer.
+func (in *JetStreamConsumer) DeepCopy() *JetStreamConsumer {
+	if in == nil {
+		return nil
+	}
+	out := new(JetStreamConsumer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JetStreamParams) DeepCopyInto(out *JetStreamParams) {
+	*out = *in
+	if in.Streams != nil {
+		in, out := &in.Streams, &out.Streams
+		*out = make([]JetStreamStream, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JetStreamParams.
+func (in *JetStreamParams) DeepCopy() *JetStreamParams {
+	if in == nil {
+		return nil
+	}
+	out := new(JetStreamParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JetStreamStream) DeepCopyInto(out *JetStreamStream) {
+	*out = *in
+	if in.Subjects != nil {
+		in, out := &in.Subjects, &out.Subjects
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]JetStreamConsumer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JetStreamStream.
+func (in *JetStreamStream) DeepCopy() *JetStreamStream {
+	if in == nil {
+		return nil
+	}
+	out := new(JetStreamStream)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LeadershipElectionParams) DeepCopyInto(out *LeadershipElectionParams) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LeadershipElectionParams.
+func (in *LeadershipElectionParams) DeepCopy() *LeadershipElectionParams {
+	if in == nil {
+		return nil
+	}
+	out := new(LeadershipElectionParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackup) DeepCopyInto(out *MetadataBackup) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	in.Destination.DeepCopyInto(&out.Destination)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackup.
+func (in *MetadataBackup) DeepCopy() *MetadataBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupDestination) DeepCopyInto(out *MetadataBackupDestination) {
+	*out = *in
+	if in.ObjectStore != nil {
+		in, out := &in.ObjectStore, &out.ObjectStore
+		*out = new(ObjectStoreDestination)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupDestination.
+func (in *MetadataBackupDestination) DeepCopy() *MetadataBackupDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupStatus) DeepCopyInto(out *MetadataBackupStatus) {
+	*out = *in
+	if in.LastBackupTime != nil {
+		in, out := &in.LastBackupTime, &out.LastBackupTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastSuccessfulBackupTime != nil {
+		in, out := &in.LastSuccessfulBackupTime, &out.LastSuccessfulBackupTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Restore != nil {
+		in, out := &in.Restore, &out.Restore
+		*out = new(MetadataRestoreStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupStatus.
+func (in *MetadataBackupStatus) DeepCopy() *MetadataBackupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataRestore) DeepCopyInto(out *MetadataRestore) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestore.
+func (in *MetadataRestore) DeepCopy() *MetadataRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataRestoreStatus) DeepCopyInto(out *MetadataRestoreStatus) {
+	*out = *in
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestoreStatus.
+func (in *MetadataRestoreStatus) DeepCopy() *MetadataRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NATSEventSink) DeepCopyInto(out *NATSEventSink) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NATSEventSink.
+func (in *NATSEventSink) DeepCopy() *NATSEventSink {
+	if in == nil {
+		return nil
+	}
+	out := new(NATSEventSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NATSParams) DeepCopyInto(out *NATSParams) {
+	*out = *in
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(ExternalNATS)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NATSParams.
+func (in *NATSParams) DeepCopy() *NATSParams {
+	if in == nil {
+		return nil
+	}
+	out := new(NATSParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectStoreDestination) DeepCopyInto(out *ObjectStoreDestination) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectStoreDestination.
+func (in *ObjectStoreDestination) DeepCopy() *ObjectStoreDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectStoreDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OperatorConfig) DeepCopyInto(out *OperatorConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorConfig.
+func (in *OperatorConfig) DeepCopy() *OperatorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(OperatorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OperatorConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OperatorConfigList) DeepCopyInto(out *OperatorConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]OperatorConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorConfigList.
+func (in *OperatorConfigList) DeepCopy() *OperatorConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(OperatorConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OperatorConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OperatorConfigSpec) DeepCopyInto(out *OperatorConfigSpec) {
+	*out = *in
+	if in.ReconcileIntervals != nil {
+		in, out := &in.ReconcileIntervals, &out.ReconcileIntervals
+		*out = new(ReconcileIntervals)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResyncPeriod != nil {
+		in, out := &in.ResyncPeriod, &out.ResyncPeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FeatureGates != nil {
+		in, out := &in.FeatureGates, &out.FeatureGates
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.EventSink != nil {
+		in, out := &in.EventSink, &out.EventSink
+		*out = new(EventSink)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorConfigSpec.
+func (in *OperatorConfigSpec) DeepCopy() *OperatorConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OperatorConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OperatorConfigStatus) DeepCopyInto(out *OperatorConfigStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorConfigStatus.
+func (in *OperatorConfigStatus) DeepCopy() *OperatorConfigStatus {
+	if in == nil {
+		return nil
 	}
+	out := new(OperatorConfigStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataCollectorParams.
-func (in *DataCollectorParams) DeepCopy() *DataCollectorParams {
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PEMAutoscaling) DeepCopyInto(out *PEMAutoscaling) {
+	*out = *in
+	if in.NodeSizeClasses != nil {
+		in, out := &in.NodeSizeClasses, &out.NodeSizeClasses
+		*out = make([]PEMNodeSizeClass, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PEMAutoscaling.
+func (in *PEMAutoscaling) DeepCopy() *PEMAutoscaling {
 	if in == nil {
 		return nil
 	}
-	out := new(DataCollectorParams)
+	out := new(PEMAutoscaling)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LeadershipElectionParams) DeepCopyInto(out *LeadershipElectionParams) {
+func (in *PEMClassResources) DeepCopyInto(out *PEMClassResources) {
 	*out = *in
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LeadershipElectionParams.
-func (in *LeadershipElectionParams) DeepCopy() *LeadershipElectionParams {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PEMClassResources.
+func (in *PEMClassResources) DeepCopy() *PEMClassResources {
 	if in == nil {
 		return nil
 	}
-	out := new(LeadershipElectionParams)
+	out := new(PEMClassResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PEMNodeSizeClass) DeepCopyInto(out *PEMNodeSizeClass) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PEMNodeSizeClass.
+func (in *PEMNodeSizeClass) DeepCopy() *PEMNodeSizeClass {
+	if in == nil {
+		return nil
+	}
+	out := new(PEMNodeSizeClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedChange) DeepCopyInto(out *PlannedChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedChange.
+func (in *PlannedChange) DeepCopy() *PlannedChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedChange)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -111,6 +951,221 @@ func (in *PodSecurityContext) DeepCopy() *PodSecurityContext {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrivilegedWorkload) DeepCopyInto(out *PrivilegedWorkload) {
+	*out = *in
+	if in.Requirements != nil {
+		in, out := &in.Requirements, &out.Requirements
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrivilegedWorkload.
+func (in *PrivilegedWorkload) DeepCopy() *PrivilegedWorkload {
+	if in == nil {
+		return nil
+	}
+	out := new(PrivilegedWorkload)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcileIntervals) DeepCopyInto(out *ReconcileIntervals) {
+	*out = *in
+	if in.StatusCheck != nil {
+		in, out := &in.StatusCheck, &out.StatusCheck
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.UpdateCheck != nil {
+		in, out := &in.UpdateCheck, &out.UpdateCheck
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.UpdateTimeout != nil {
+		in, out := &in.UpdateTimeout, &out.UpdateTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcileIntervals.
+func (in *ReconcileIntervals) DeepCopy() *ReconcileIntervals {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcileIntervals)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryMirror) DeepCopyInto(out *RegistryMirror) {
+	*out = *in
+	if in.PathRewrites != nil {
+		in, out := &in.PathRewrites, &out.PathRewrites
+		*out = make([]RegistryPathRewrite, len(*in))
+		copy(*out, *in)
+	}
+	if in.PullSecrets != nil {
+		in, out := &in.PullSecrets, &out.PullSecrets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryMirror.
+func (in *RegistryMirror) DeepCopy() *RegistryMirror {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryMirror)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryPathRewrite) DeepCopyInto(out *RegistryPathRewrite) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryPathRewrite.
+func (in *RegistryPathRewrite) DeepCopy() *RegistryPathRewrite {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryPathRewrite)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Scheduling) DeepCopyInto(out *Scheduling) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Scheduling.
+func (in *Scheduling) DeepCopy() *Scheduling {
+	if in == nil {
+		return nil
+	}
+	out := new(Scheduling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TableParams) DeepCopyInto(out *TableParams) {
+	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TableParams.
+func (in *TableParams) DeepCopy() *TableParams {
+	if in == nil {
+		return nil
+	}
+	out := new(TableParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TableStoreParams) DeepCopyInto(out *TableStoreParams) {
+	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Tables != nil {
+		in, out := &in.Tables, &out.Tables
+		*out = make(map[string]TableParams, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TableStoreParams.
+func (in *TableStoreParams) DeepCopy() *TableStoreParams {
+	if in == nil {
+		return nil
+	}
+	out := new(TableStoreParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeStatus) DeepCopyInto(out *UpgradeStatus) {
+	*out = *in
+	if in.CanaryNodes != nil {
+		in, out := &in.CanaryNodes, &out.CanaryNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeStatus.
+func (in *UpgradeStatus) DeepCopy() *UpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeStrategy) DeepCopyInto(out *UpgradeStrategy) {
+	*out = *in
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanaryUpgrade)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeStrategy.
+func (in *UpgradeStrategy) DeepCopy() *UpgradeStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Vizier) DeepCopyInto(out *Vizier) {
 	*out = *in
@@ -195,6 +1250,93 @@ func (in *VizierSpec) DeepCopyInto(out *VizierSpec) {
 		*out = new(LeadershipElectionParams)
 		**out = **in
 	}
+	if in.PEMAutoscaling != nil {
+		in, out := &in.PEMAutoscaling, &out.PEMAutoscaling
+		*out = new(PEMAutoscaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JetStream != nil {
+		in, out := &in.JetStream, &out.JetStream
+		*out = new(JetStreamParams)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Backpressure != nil {
+		in, out := &in.Backpressure, &out.Backpressure
+		*out = new(BackpressurePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Backfill != nil {
+		in, out := &in.Backfill, &out.Backfill
+		*out = new(BackfillPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProtocolTracers != nil {
+		in, out := &in.ProtocolTracers, &out.ProtocolTracers
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.MetadataBackup != nil {
+		in, out := &in.MetadataBackup, &out.MetadataBackup
+		*out = new(MetadataBackup)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MetadataRestore != nil {
+		in, out := &in.MetadataRestore, &out.MetadataRestore
+		*out = new(MetadataRestore)
+		**out = **in
+	}
+	if in.UpgradeStrategy != nil {
+		in, out := &in.UpgradeStrategy, &out.UpgradeStrategy
+		*out = new(UpgradeStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RegistryMirror != nil {
+		in, out := &in.RegistryMirror, &out.RegistryMirror
+		*out = new(RegistryMirror)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Scheduling != nil {
+		in, out := &in.Scheduling, &out.Scheduling
+		*out = new(ComponentScheduling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Exposure != nil {
+		in, out := &in.Exposure, &out.Exposure
+		*out = new(EndpointExposure)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NATS != nil {
+		in, out := &in.NATS, &out.NATS
+		*out = new(NATSParams)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CertRotation != nil {
+		in, out := &in.CertRotation, &out.CertRotation
+		*out = new(CertRotation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CertSigning != nil {
+		in, out := &in.CertSigning, &out.CertSigning
+		*out = new(CertSigning)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CrashRemediation != nil {
+		in, out := &in.CrashRemediation, &out.CrashRemediation
+		*out = new(CrashRemediation)
+		**out = **in
+	}
+	if in.CrashDiagnostics != nil {
+		in, out := &in.CrashDiagnostics, &out.CrashDiagnostics
+		*out = new(CrashDiagnostics)
+		**out = **in
+	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(DeletionPolicy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VizierSpec.
@@ -219,6 +1361,57 @@ func (in *VizierStatus) DeepCopyInto(out *VizierStatus) {
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.PEMResources != nil {
+		in, out := &in.PEMResources, &out.PEMResources
+		*out = make([]PEMClassResources, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MetadataBackup != nil {
+		in, out := &in.MetadataBackup, &out.MetadataBackup
+		*out = new(MetadataBackupStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(UpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Certs != nil {
+		in, out := &in.Certs, &out.Certs
+		*out = new(CertStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PrivilegedWorkloads != nil {
+		in, out := &in.PrivilegedWorkloads, &out.PrivilegedWorkloads
+		*out = make([]PrivilegedWorkload, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DryRun != nil {
+		in, out := &in.DryRun, &out.DryRun
+		*out = new(DryRunStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Deletion != nil {
+		in, out := &in.Deletion, &out.Deletion
+		*out = new(DeletionStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CrashDiagnostics != nil {
+		in, out := &in.CrashDiagnostics, &out.CrashDiagnostics
+		*out = new(CrashDiagnosticsStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VizierStatus.
@@ -0,0 +1,113 @@
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+	v1alpha1 "px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+// FakeOperatorConfigs implements OperatorConfigInterface
+type FakeOperatorConfigs struct {
+	Fake *FakePxV1alpha1
+}
+
+var operatorconfigsResource = schema.GroupVersionResource{Group: "px.dev", Version: "v1alpha1", Resource: "operatorconfigs"}
+
+var operatorconfigsKind = schema.GroupVersionKind{Group: "px.dev", Version: "v1alpha1", Kind: "OperatorConfig"}
+
+// Get takes name of the operatorConfig, and returns the corresponding operatorConfig object, and an error if there is any.
+func (c *FakeOperatorConfigs) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.OperatorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(operatorconfigsResource, name), &v1alpha1.OperatorConfig{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OperatorConfig), err
+}
+
+// List takes label and field selectors, and returns the list of OperatorConfigs that match those selectors.
+func (c *FakeOperatorConfigs) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.OperatorConfigList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(operatorconfigsResource, operatorconfigsKind, opts), &v1alpha1.OperatorConfigList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.OperatorConfigList{ListMeta: obj.(*v1alpha1.OperatorConfigList).ListMeta}
+	for _, item := range obj.(*v1alpha1.OperatorConfigList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested operatorconfigs.
+func (c *FakeOperatorConfigs) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(operatorconfigsResource, opts))
+
+}
+
+// Create takes the representation of a operatorConfig and creates it.  Returns the server's representation of the operatorConfig, and an error, if there is any.
+func (c *FakeOperatorConfigs) Create(ctx context.Context, operatorConfig *v1alpha1.OperatorConfig, opts v1.CreateOptions) (result *v1alpha1.OperatorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(operatorconfigsResource, operatorConfig), &v1alpha1.OperatorConfig{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OperatorConfig), err
+}
+
+// Update takes the representation of a operatorConfig and updates it. Returns the server's representation of the operatorConfig, and an error, if there is any.
+func (c *FakeOperatorConfigs) Update(ctx context.Context, operatorConfig *v1alpha1.OperatorConfig, opts v1.UpdateOptions) (result *v1alpha1.OperatorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(operatorconfigsResource, operatorConfig), &v1alpha1.OperatorConfig{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OperatorConfig), err
+}
+
+// Delete takes name of the operatorConfig and deletes it. Returns an error if one occurs.
+func (c *FakeOperatorConfigs) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(operatorconfigsResource, name), &v1alpha1.OperatorConfig{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeOperatorConfigs) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(operatorconfigsResource, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.OperatorConfigList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched operatorConfig.
+func (c *FakeOperatorConfigs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.OperatorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(operatorconfigsResource, name, pt, data, subresources...), &v1alpha1.OperatorConfig{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OperatorConfig), err
+}
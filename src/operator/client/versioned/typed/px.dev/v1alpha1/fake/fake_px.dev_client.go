@@ -12,6 +12,10 @@ type FakePxV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakePxV1alpha1) OperatorConfigs() v1alpha1.OperatorConfigInterface {
+	return &FakeOperatorConfigs{c}
+}
+
 func (c *FakePxV1alpha1) Viziers(namespace string) v1alpha1.VizierInterface {
 	return &FakeViziers{c, namespace}
 }
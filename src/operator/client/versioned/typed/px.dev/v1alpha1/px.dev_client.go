@@ -10,6 +10,7 @@ import (
 
 type PxV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	OperatorConfigsGetter
 	ViziersGetter
 }
 
@@ -18,6 +19,10 @@ type PxV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *PxV1alpha1Client) OperatorConfigs() OperatorConfigInterface {
+	return newOperatorConfigs(c)
+}
+
 func (c *PxV1alpha1Client) Viziers(namespace string) VizierInterface {
 	return newViziers(c, namespace)
 }
@@ -0,0 +1,585 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	// pemCanaryLabel is the label on the nodes that run the canary PEMs, and on the canary PEM pods.
+	pemCanaryLabel        = "px.dev/pem-canary"
+	pemCanaryDaemonSet    = "vizier-pem-canary"
+	canaryCheckInterval   = 30 * time.Second
+	metricsPortAnnotation = "px.dev/metrics_port"
+	queryBrokerLabel      = "vizier-query-broker"
+	// The metrics that the metadata service and query broker export about agent heartbeats and query results.
+	agentHeartbeatsMetric = "agent_heartbeats"
+	queryResultsMetric    = "query_exec_results"
+	// The number of times a canary PEM may restart before the canary is rolled back.
+	canaryMaxRestarts = 2
+	// The number of queries that must finish during the soak period before their error rate is considered.
+	canaryMinQueries = 10
+	// The default canary settings.
+	defaultCanaryNodePercent          = int32(10)
+	defaultCanarySoakPeriod           = 15 * time.Minute
+	defaultCanaryMaxQueryErrorPercent = int32(10)
+	eventReasonCanaryStarted          = "CanaryStarted"
+	eventReasonCanaryPromoted         = "CanaryPromoted"
+	eventReasonCanaryRolledBack       = "CanaryRolledBack"
+)
+
+func canaryUpgradeEnabled(vz *v1alpha1.Vizier) bool {
+	return vz.Spec.UpgradeStrategy != nil && vz.Spec.UpgradeStrategy.Type == v1alpha1.UpgradeStrategyCanary
+}
+
+// getCanaryUpgrade returns the canary settings of the Vizier, with the defaults filled in.
+func getCanaryUpgrade(vz *v1alpha1.Vizier) v1alpha1.CanaryUpgrade {
+	canary := v1alpha1.CanaryUpgrade{}
+	if vz.Spec.UpgradeStrategy != nil && vz.Spec.UpgradeStrategy.Canary != nil {
+		canary = *vz.Spec.UpgradeStrategy.Canary
+	}
+	if canary.NodePercent == 0 {
+		canary.NodePercent = defaultCanaryNodePercent
+	}
+	if canary.SoakPeriod == nil {
+		canary.SoakPeriod = &metav1.Duration{Duration: defaultCanarySoakPeriod}
+	}
+	if canary.MaxQueryErrorPercent == 0 {
+		canary.MaxQueryErrorPercent = defaultCanaryMaxQueryErrorPercent
+	}
+	return canary
+}
+
+// selectCanaryNodes returns the names of the ready nodes that should run the canary PEMs. The same nodes are
+// chosen for every upgrade, so that a canary only ever disrupts a predictable subset of the cluster.
+func selectCanaryNodes(nodes []v1.Node, percent int32) []string {
+	var ready []string
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		for _, c := range node.Status.Conditions {
+			if c.Type == v1.NodeReady && c.Status == v1.ConditionTrue {
+				ready = append(ready, node.Name)
+				break
+			}
+		}
+	}
+	if len(ready) == 0 {
+		return nil
+	}
+	sort.Strings(ready)
+
+	count := (len(ready)*int(percent) + 99) / 100
+	if count < 1 {
+		count = 1
+	}
+	if count > len(ready) {
+		count = len(ready)
+	}
+	return ready[:count]
+}
+
+// canaryPEMDaemonSet returns a copy of the PEM DaemonSet in the resources, which only runs on the canary nodes.
+func canaryPEMDaemonSet(resources []*k8s.Resource) (*appsv1.DaemonSet, error) {
+	var pem *k8s.Resource
+	for _, r := range resources {
+		if r.GVK.Kind == "DaemonSet" && r.Object.GetName() == pemDaemonSetName {
+			pem = r
+		}
+	}
+	if pem == nil {
+		return nil, fmt.Errorf("the Vizier YAMLs have no %s DaemonSet", pemDaemonSetName)
+	}
+
+	canary := pem.Object.DeepCopy()
+	canary.SetName(pemCanaryDaemonSet)
+	labels := canary.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[pemCanaryLabel] = "true"
+	canary.SetLabels(labels)
+	for _, path := range [][]string{{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}} {
+		if err := unstructured.SetNestedField(canary.Object, "true", append(path, pemCanaryLabel)...); err != nil {
+			return nil, err
+		}
+	}
+	err := addPEMNodeAffinity(canary.Object, map[string]interface{}{
+		"key":      pemCanaryLabel,
+		"operator": "In",
+		"values":   []interface{}{"true"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &appsv1.DaemonSet{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(canary.Object, ds); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// setCanaryExclusion adds or removes the node affinity requirement that keeps a PEM DaemonSet off the canary nodes.
+func setCanaryExclusion(ds *appsv1.DaemonSet, exclude bool) {
+	spec := &ds.Spec.Template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &v1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+	selector := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if selector == nil {
+		selector = &v1.NodeSelector{}
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = selector
+	}
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []v1.NodeSelectorTerm{{}}
+	}
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		var exprs []v1.NodeSelectorRequirement
+		for _, e := range term.MatchExpressions {
+			if e.Key != pemCanaryLabel {
+				exprs = append(exprs, e)
+			}
+		}
+		if exclude {
+			exprs = append(exprs, v1.NodeSelectorRequirement{Key: pemCanaryLabel, Operator: v1.NodeSelectorOpDoesNotExist})
+		}
+		term.MatchExpressions = exprs
+	}
+}
+
+// canaryPodFailure returns why the canary PEM pod is unhealthy, or an empty string if it is healthy.
+func canaryPodFailure(pod *v1.Pod) string {
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.State.Waiting != nil && c.State.Waiting.Reason == "CrashLoopBackOff" {
+			return fmt.Sprintf("canary PEM %s is crashing", pod.Name)
+		}
+		if c.RestartCount > canaryMaxRestarts {
+			return fmt.Sprintf("canary PEM %s restarted %d times", pod.Name, c.RestartCount)
+		}
+	}
+	return ""
+}
+
+// counterIncrease returns how much the counter increased since the baseline. If the counter is lower than the
+// baseline, the pod that exports it restarted, and the whole value is counted.
+func counterIncrease(current, baseline map[string]float64, key string) float64 {
+	if current[key] < baseline[key] {
+		return current[key]
+	}
+	return current[key] - baseline[key]
+}
+
+// fetchPodCounters scrapes the metrics of the running pods with the given name label, and returns the value of
+// the counter summed across the pods, keyed by the value of the given label of the counter.
+func fetchPodCounters(ctx context.Context, clientset kubernetes.Interface, client HTTPClient, namespace, nameLabel, metric, label string) (map[string]float64, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "name=" + nameLabel})
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]float64)
+	for _, pod := range pods.Items {
+		port := pod.Annotations[metricsPortAnnotation]
+		if pod.Status.Phase != v1.PodRunning || port == "" {
+			continue
+		}
+		u := url.URL{
+			Scheme: "https",
+			Host:   net.JoinHostPort(k8s.GetPodAddr(pod), port),
+			Path:   "metrics",
+		}
+		resp, err := client.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to fetch metrics of pod %s: %s", pod.Name, resp.Status)
+		}
+		families, err := (&expfmt.TextParser{}).TextToMetricFamilies(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		family, ok := families[metric]
+		if !ok {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			key := ""
+			for _, l := range m.GetLabel() {
+				if l.GetName() == label {
+					key = l.GetValue()
+				}
+			}
+			counters[key] += m.GetCounter().GetValue()
+		}
+	}
+	return counters, nil
+}
+
+// canaryBaseline holds the counters observed when the operator started to supervise a canary, which the health of
+// the canary is measured against.
+type canaryBaseline struct {
+	toVersion  string
+	heartbeats map[string]float64
+	queries    map[string]float64
+}
+
+// canaryUpgrader rolls new PEM versions out to a subset of nodes, and decides whether they are healthy enough to
+// upgrade the rest of Vizier.
+type canaryUpgrader struct {
+	clientset kubernetes.Interface
+	// fetchCounters returns the value of a counter exported by the pods with the given name label, keyed by the
+	// value of the given label.
+	fetchCounters func(ctx context.Context, namespace, nameLabel, metric, label string) (map[string]float64, error)
+
+	// baselines holds the baseline of the canary of each Vizier, keyed by namespace.
+	baselines map[string]*canaryBaseline
+}
+
+func newCanaryUpgrader(clientset kubernetes.Interface) *canaryUpgrader {
+	return &canaryUpgrader{
+		clientset: clientset,
+		fetchCounters: func(ctx context.Context, namespace, nameLabel, metric, label string) (map[string]float64, error) {
+			tr := http.DefaultTransport.(*http.Transport).Clone()
+			tr.TLSClientConfig = getVizierTLSConfig(clientset, namespace)
+			client := &http.Client{Transport: tr, Timeout: 10 * time.Second}
+			return fetchPodCounters(ctx, clientset, client, namespace, nameLabel, metric, label)
+		},
+		baselines: make(map[string]*canaryBaseline),
+	}
+}
+
+// pemDaemonSets returns the PEM DaemonSets of the Vizier, other than the canary.
+func (u *canaryUpgrader) pemDaemonSets(ctx context.Context, namespace string) ([]appsv1.DaemonSet, error) {
+	dsList, err := u.clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var pems []appsv1.DaemonSet
+	for _, ds := range dsList.Items {
+		if strings.HasPrefix(ds.Name, pemDaemonSetName) && ds.Name != pemCanaryDaemonSet {
+			pems = append(pems, ds)
+		}
+	}
+	return pems, nil
+}
+
+// setNodeLabel adds or removes the canary label on the node.
+func (u *canaryUpgrader) setNodeLabel(ctx context.Context, node string, canary bool) error {
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:null}}}`, pemCanaryLabel)
+	if canary {
+		patch = fmt.Sprintf(`{"metadata":{"labels":{%q:"true"}}}`, pemCanaryLabel)
+	}
+	_, err := u.clientset.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// start moves the canary nodes off the existing PEMs, and deploys the given canary PEM DaemonSet to them. The
+// canary is recorded in the Vizier status.
+func (u *canaryUpgrader) start(ctx context.Context, vz *v1alpha1.Vizier, canary *appsv1.DaemonSet, now time.Time) error {
+	nodes, err := u.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	canaryNodes := selectCanaryNodes(nodes.Items, getCanaryUpgrade(vz).NodePercent)
+	if len(canaryNodes) == 0 {
+		return fmt.Errorf("no ready nodes to run the canary PEMs on")
+	}
+
+	pems, err := u.pemDaemonSets(ctx, vz.Namespace)
+	if err != nil {
+		return err
+	}
+	for i := range pems {
+		setCanaryExclusion(&pems[i], true)
+		if _, err := u.clientset.AppsV1().DaemonSets(vz.Namespace).Update(ctx, &pems[i], metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	for _, node := range canaryNodes {
+		if err := u.setNodeLabel(ctx, node, true); err != nil {
+			return err
+		}
+	}
+
+	canary.Namespace = vz.Namespace
+	existing, err := u.clientset.AppsV1().DaemonSets(vz.Namespace).Get(ctx, pemCanaryDaemonSet, metav1.GetOptions{})
+	switch {
+	case k8serrors.IsNotFound(err):
+		_, err = u.clientset.AppsV1().DaemonSets(vz.Namespace).Create(ctx, canary, metav1.CreateOptions{})
+	case err == nil:
+		canary.ResourceVersion = existing.ResourceVersion
+		_, err = u.clientset.AppsV1().DaemonSets(vz.Namespace).Update(ctx, canary, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	startTime := metav1.NewTime(now)
+	vz.Status.Upgrade = &v1alpha1.UpgradeStatus{
+		Phase:       v1alpha1.UpgradePhaseCanary,
+		FromVersion: vz.Status.Version,
+		ToVersion:   vz.Spec.Version,
+		CanaryNodes: canaryNodes,
+		StartTime:   &startTime,
+	}
+	delete(u.baselines, vz.Namespace)
+	return nil
+}
+
+// cleanup deletes the canary PEMs, and lets the existing PEMs run on the canary nodes again.
+func (u *canaryUpgrader) cleanup(ctx context.Context, vz *v1alpha1.Vizier) error {
+	err := u.clientset.AppsV1().DaemonSets(vz.Namespace).Delete(ctx, pemCanaryDaemonSet, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	nodes, err := u.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: pemCanaryLabel})
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes.Items {
+		if err := u.setNodeLabel(ctx, node.Name, false); err != nil {
+			return err
+		}
+	}
+
+	pems, err := u.pemDaemonSets(ctx, vz.Namespace)
+	if err != nil {
+		return err
+	}
+	for i := range pems {
+		setCanaryExclusion(&pems[i], false)
+		if _, err := u.clientset.AppsV1().DaemonSets(vz.Namespace).Update(ctx, &pems[i], metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	delete(u.baselines, vz.Namespace)
+	return nil
+}
+
+// evaluate checks the health of the canary of the Vizier. It returns UpgradePhasePromoted once the canary PEMs have
+// been healthy and sending heartbeats for the soak period, UpgradePhaseRolledBack with the reason if the canary is
+// unhealthy, and UpgradePhaseCanary while the canary is still soaking.
+func (u *canaryUpgrader) evaluate(ctx context.Context, vz *v1alpha1.Vizier, now time.Time) (v1alpha1.UpgradePhase, string, error) {
+	upgrade := vz.Status.Upgrade
+	canary := getCanaryUpgrade(vz)
+
+	pods, err := u.clientset.CoreV1().Pods(vz.Namespace).List(ctx, metav1.ListOptions{LabelSelector: pemCanaryLabel})
+	if err != nil {
+		return "", "", err
+	}
+	for i := range pods.Items {
+		if msg := canaryPodFailure(&pods.Items[i]); msg != "" {
+			return v1alpha1.UpgradePhaseRolledBack, msg, nil
+		}
+	}
+
+	heartbeats, err := u.fetchCounters(ctx, vz.Namespace, vizierMetadataLabel, agentHeartbeatsMetric, "agent_pod_name")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch agent heartbeats: %w", err)
+	}
+	queries, err := u.fetchCounters(ctx, vz.Namespace, queryBrokerLabel, queryResultsMetric, "result")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch query results: %w", err)
+	}
+	baseline, ok := u.baselines[vz.Namespace]
+	if !ok || baseline.toVersion != upgrade.ToVersion {
+		baseline = &canaryBaseline{toVersion: upgrade.ToVersion, heartbeats: heartbeats, queries: queries}
+		u.baselines[vz.Namespace] = baseline
+	}
+
+	// Cancelled and invalid queries are caused by the user, not by the canary, so they are ignored.
+	failed := counterIncrease(queries, baseline.queries, "error")
+	total := failed + counterIncrease(queries, baseline.queries, "success")
+	if total >= canaryMinQueries && failed*100 > total*float64(canary.MaxQueryErrorPercent) {
+		return v1alpha1.UpgradePhaseRolledBack, fmt.Sprintf("%.0f of %.0f queries failed during the canary", failed, total), nil
+	}
+
+	if upgrade.StartTime == nil || now.Before(upgrade.StartTime.Add(canary.SoakPeriod.Duration)) {
+		return v1alpha1.UpgradePhaseCanary, "", nil
+	}
+
+	if len(pods.Items) == 0 {
+		return v1alpha1.UpgradePhaseRolledBack, fmt.Sprintf("no canary PEMs were scheduled on nodes %s", strings.Join(upgrade.CanaryNodes, ", ")), nil
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning {
+			return v1alpha1.UpgradePhaseRolledBack, fmt.Sprintf("canary PEM %s is %s", pod.Name, pod.Status.Phase), nil
+		}
+		// Metadata services that predate the heartbeat metric don't export it, in which case only the state of
+		// the canary pods is checked.
+		if len(heartbeats) > 0 && counterIncrease(heartbeats, baseline.heartbeats, pod.Name) == 0 {
+			return v1alpha1.UpgradePhaseRolledBack, fmt.Sprintf("canary PEM %s stopped sending heartbeats", pod.Name), nil
+		}
+	}
+	return v1alpha1.UpgradePhasePromoted, "", nil
+}
+
+// canaryUpgradeHoldsDeploy returns whether a deploy of the Vizier's spec should wait for a canary upgrade. It
+// returns true while the canary is soaking, and after it was rolled back, until the spec version changes.
+func canaryUpgradeHoldsDeploy(vz *v1alpha1.Vizier) bool {
+	upgrade := vz.Status.Upgrade
+	return upgrade != nil && upgrade.ToVersion == vz.Spec.Version && upgrade.Phase != v1alpha1.UpgradePhasePromoted
+}
+
+// startCanaryUpgrade deploys the PEMs of the Vizier's spec version to the canary nodes. The rest of Vizier is upgraded
+// once superviseCanaryUpgrades promotes the canary.
+func (r *VizierReconciler) startCanaryUpgrade(ctx context.Context, req ctrl.Request, vz *v1alpha1.Vizier) error {
+	log.WithField("version", vz.Spec.Version).Info("Starting a canary upgrade")
+	cloudClient, err := getCloudClientConnection(vz.Spec.CloudAddr, vz.Spec.DevCloudNamespace)
+	if err != nil {
+		return err
+	}
+	defer cloudClient.Close()
+
+	configForVizierResp, err := generateVizierYAMLsConfig(ctx, req.Namespace, r.K8sVersion, vz, cloudClient)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate configs for Vizier YAMLs")
+		return err
+	}
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(configForVizierResp.NameToYamlContent[vizierYAMLName(vz)]))
+	if err != nil {
+		return err
+	}
+	if vz.Spec.Pod == nil {
+		vz.Spec.Pod = &v1alpha1.PodPolicy{}
+	}
+	for _, res := range resources {
+		if err := updateResourceConfiguration(res, vz); err != nil {
+			return err
+		}
+	}
+	resources, err = configurePEMAutoscaling(resources, vz)
+	if err != nil {
+		return err
+	}
+	canary, err := canaryPEMDaemonSet(resources)
+	if err != nil {
+		return err
+	}
+
+	if err := newCanaryUpgrader(r.Clientset).start(ctx, vz, canary, time.Now()); err != nil {
+		return err
+	}
+	vz.SetCondition(v1alpha1.VizierConditionUpdateInProgress, metav1.ConditionTrue, string(v1alpha1.UpgradePhaseCanary),
+		fmt.Sprintf("Running version %s on the PEMs of %d nodes before updating the rest of Vizier from version %s.",
+			vz.Spec.Version, len(vz.Status.Upgrade.CanaryNodes), vz.Status.Version))
+	if err := r.Status().Update(ctx, vz); err != nil {
+		return err
+	}
+	r.recordEvent(vz, v1.EventTypeNormal, eventReasonCanaryStarted, "Running version %s on the PEMs of nodes %s",
+		vz.Spec.Version, strings.Join(vz.Status.Upgrade.CanaryNodes, ", "))
+	return nil
+}
+
+// superviseCanaryUpgrades regularly checks the health of the canary of each Vizier with a canary upgrade in progress,
+// and promotes or rolls back the canary. Promoting the canary updates the status, which triggers a reconcile that
+// upgrades the rest of Vizier.
+func (r *VizierReconciler) superviseCanaryUpgrades() {
+	u := newCanaryUpgrader(r.Clientset)
+	t := time.NewTicker(canaryCheckInterval)
+	defer t.Stop()
+	for range t.C {
+		start := time.Now()
+		var viziersList v1alpha1.VizierList
+		ctx := context.Background()
+		err := r.List(ctx, &viziersList)
+		if err != nil {
+			log.WithError(err).Error("Unable to list the vizier objects")
+			recordLoopError(loopCanaryUpgrade)
+			continue
+		}
+		for _, vz := range viziersList.Items {
+			if vz.Status.Upgrade == nil || vz.Status.Upgrade.Phase != v1alpha1.UpgradePhaseCanary {
+				continue
+			}
+			// The canary was superseded if the strategy changed or Vizier was updated in the meantime.
+			if !canaryUpgradeEnabled(&vz) || vz.Status.Version == vz.Status.Upgrade.ToVersion {
+				continue
+			}
+			phase, msg, err := u.evaluate(ctx, &vz, time.Now())
+			if err != nil {
+				log.WithError(err).Warn("Failed to check the health of the canary")
+				recordLoopError(loopCanaryUpgrade)
+				continue
+			}
+
+			switch phase {
+			case v1alpha1.UpgradePhaseRolledBack:
+				log.WithField("reason", msg).Info("Rolling back canary upgrade")
+				if err := u.cleanup(ctx, &vz); err != nil {
+					log.WithError(err).Error("Failed to roll back canary")
+					recordLoopError(loopCanaryUpgrade)
+					continue
+				}
+				vz.Status.Upgrade.Phase = v1alpha1.UpgradePhaseRolledBack
+				vz.Status.Upgrade.Message = msg
+				vz.SetReconciliationPhase(v1alpha1.ReconciliationPhaseFailed)
+				if err := r.Status().Update(ctx, &vz); err != nil {
+					log.WithError(err).Error("Unable to update vizier status")
+					recordLoopError(loopCanaryUpgrade)
+					continue
+				}
+				r.recordEvent(&vz, v1.EventTypeWarning, eventReasonCanaryRolledBack, "Rolled back version %s: %s", vz.Status.Upgrade.ToVersion, msg)
+			case v1alpha1.UpgradePhasePromoted:
+				log.WithField("version", vz.Status.Upgrade.ToVersion).Info("Promoting canary upgrade")
+				vz.Status.Upgrade.Phase = v1alpha1.UpgradePhasePromoted
+				if err := r.Status().Update(ctx, &vz); err != nil {
+					log.WithError(err).Error("Unable to update vizier status")
+					recordLoopError(loopCanaryUpgrade)
+					continue
+				}
+				r.recordEvent(&vz, v1.EventTypeNormal, eventReasonCanaryPromoted, "Canary of version %s was healthy, updating the rest of Vizier", vz.Status.Upgrade.ToVersion)
+			}
+		}
+		observeLoop(loopCanaryUpgrade, start)
+	}
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+func readyNode(name string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+func canaryVizier() *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec: v1alpha1.VizierSpec{
+			Version: "0.14.3",
+			UpgradeStrategy: &v1alpha1.UpgradeStrategy{
+				Type:   v1alpha1.UpgradeStrategyCanary,
+				Canary: &v1alpha1.CanaryUpgrade{NodePercent: 50},
+			},
+		},
+		Status: v1alpha1.VizierStatus{Version: "0.14.2"},
+	}
+}
+
+func hasCanaryExclusion(ds *appsv1.DaemonSet) bool {
+	for _, term := range ds.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, e := range term.MatchExpressions {
+			if e.Key == pemCanaryLabel && e.Operator == v1.NodeSelectorOpDoesNotExist {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestSelectCanaryNodes(t *testing.T) {
+	notReady := readyNode("node-0")
+	notReady.Status.Conditions[0].Status = v1.ConditionFalse
+	cordoned := readyNode("node-00")
+	cordoned.Spec.Unschedulable = true
+	nodes := []v1.Node{*readyNode("node-3"), *readyNode("node-1"), *notReady, *cordoned, *readyNode("node-2"), *readyNode("node-4")}
+
+	assert.Equal(t, []string{"node-1"}, selectCanaryNodes(nodes, 10))
+	assert.Equal(t, []string{"node-1", "node-2"}, selectCanaryNodes(nodes, 50))
+	assert.Equal(t, []string{"node-1", "node-2", "node-3", "node-4"}, selectCanaryNodes(nodes, 100))
+	assert.Empty(t, selectCanaryNodes([]v1.Node{*notReady}, 10))
+}
+
+func TestCanaryPEMDaemonSet(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(pemDaemonSetYAML))
+	require.NoError(t, err)
+
+	ds, err := canaryPEMDaemonSet(resources)
+	require.NoError(t, err)
+	assert.Equal(t, pemCanaryDaemonSet, ds.Name)
+	assert.Equal(t, map[string]string{"name": vizierPemLabel, pemCanaryLabel: "true"}, ds.Spec.Selector.MatchLabels)
+	assert.Equal(t, map[string]string{"name": vizierPemLabel, pemCanaryLabel: "true"}, ds.Spec.Template.Labels)
+	exprs := ds.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions
+	require.Len(t, exprs, 2)
+	assert.Equal(t, "kubernetes.io/os", exprs[0].Key)
+	assert.Equal(t, v1.NodeSelectorRequirement{Key: pemCanaryLabel, Operator: v1.NodeSelectorOpIn, Values: []string{"true"}}, exprs[1])
+
+	// The original DaemonSet is unchanged.
+	assert.Equal(t, pemDaemonSetName, resources[0].Object.GetName())
+}
+
+func TestCanaryUpgrader_StartAndCleanup(t *testing.T) {
+	ctx := context.Background()
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(pemDaemonSetYAML))
+	require.NoError(t, err)
+	pem := &appsv1.DaemonSet{}
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.Object, pem))
+	pem.Namespace = "pl"
+	canary, err := canaryPEMDaemonSet(resources)
+	require.NoError(t, err)
+
+	clientset := fake.NewSimpleClientset(readyNode("node-1"), readyNode("node-2"), readyNode("node-3"), readyNode("node-4"), pem)
+	u := newCanaryUpgrader(clientset)
+	vz := canaryVizier()
+	now := time.Now()
+	require.NoError(t, u.start(ctx, vz, canary, now))
+
+	require.NotNil(t, vz.Status.Upgrade)
+	assert.Equal(t, v1alpha1.UpgradePhaseCanary, vz.Status.Upgrade.Phase)
+	assert.Equal(t, "0.14.2", vz.Status.Upgrade.FromVersion)
+	assert.Equal(t, "0.14.3", vz.Status.Upgrade.ToVersion)
+	assert.Equal(t, []string{"node-1", "node-2"}, vz.Status.Upgrade.CanaryNodes)
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: pemCanaryLabel})
+	require.NoError(t, err)
+	assert.Len(t, nodes.Items, 2)
+	updatedPEM, err := clientset.AppsV1().DaemonSets("pl").Get(ctx, pemDaemonSetName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, hasCanaryExclusion(updatedPEM))
+	_, err = clientset.AppsV1().DaemonSets("pl").Get(ctx, pemCanaryDaemonSet, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, u.cleanup(ctx, vz))
+
+	nodes, err = clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: pemCanaryLabel})
+	require.NoError(t, err)
+	assert.Empty(t, nodes.Items)
+	updatedPEM, err = clientset.AppsV1().DaemonSets("pl").Get(ctx, pemDaemonSetName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.False(t, hasCanaryExclusion(updatedPEM))
+	dsList, err := clientset.AppsV1().DaemonSets("pl").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, dsList.Items, 1)
+}
+
+func canaryPod(name string, phase v1.PodPhase, restarts int32) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "pl",
+			Labels:    map[string]string{"name": vizierPemLabel, pemCanaryLabel: "true"},
+		},
+		Status: v1.PodStatus{
+			Phase:             phase,
+			ContainerStatuses: []v1.ContainerStatus{{Name: pemContainerName, RestartCount: restarts}},
+		},
+	}
+}
+
+func TestCanaryUpgrader_Evaluate(t *testing.T) {
+	start := time.Now()
+	soaked := start.Add(defaultCanarySoakPeriod + time.Minute)
+
+	tests := []struct {
+		name string
+		pods []*v1.Pod
+		// The heartbeats and query results when the canary is first and last checked.
+		heartbeats [2]map[string]float64
+		queries    [2]map[string]float64
+		now        time.Time
+
+		expectedPhase   v1alpha1.UpgradePhase
+		expectedMessage string
+	}{
+		{
+			name:          "soaking",
+			pods:          []*v1.Pod{canaryPod("pem-1", v1.PodRunning, 0)},
+			heartbeats:    [2]map[string]float64{{"pem-1": 3}, {"pem-1": 3}},
+			now:           start.Add(time.Minute),
+			expectedPhase: v1alpha1.UpgradePhaseCanary,
+		},
+		{
+			name:          "healthy",
+			pods:          []*v1.Pod{canaryPod("pem-1", v1.PodRunning, 0), canaryPod("pem-2", v1.PodRunning, 1)},
+			heartbeats:    [2]map[string]float64{{"pem-1": 3, "pem-other": 5}, {"pem-1": 90, "pem-2": 80, "pem-other": 90}},
+			queries:       [2]map[string]float64{{"success": 10}, {"success": 100, "error": 5, "invalid": 50}},
+			now:           soaked,
+			expectedPhase: v1alpha1.UpgradePhasePromoted,
+		},
+		{
+			name:          "metadata without heartbeat metric",
+			pods:          []*v1.Pod{canaryPod("pem-1", v1.PodRunning, 0)},
+			now:           soaked,
+			expectedPhase: v1alpha1.UpgradePhasePromoted,
+		},
+		{
+			name:            "crashing",
+			pods:            []*v1.Pod{canaryPod("pem-1", v1.PodRunning, 0), canaryPod("pem-2", v1.PodRunning, 3)},
+			now:             start.Add(time.Minute),
+			expectedPhase:   v1alpha1.UpgradePhaseRolledBack,
+			expectedMessage: "canary PEM pem-2 restarted 3 times",
+		},
+		{
+			name:            "heartbeats stopped",
+			pods:            []*v1.Pod{canaryPod("pem-1", v1.PodRunning, 0), canaryPod("pem-2", v1.PodRunning, 0)},
+			heartbeats:      [2]map[string]float64{{"pem-1": 3, "pem-2": 3}, {"pem-1": 90, "pem-2": 3}},
+			now:             soaked,
+			expectedPhase:   v1alpha1.UpgradePhaseRolledBack,
+			expectedMessage: "canary PEM pem-2 stopped sending heartbeats",
+		},
+		{
+			name:            "not scheduled",
+			heartbeats:      [2]map[string]float64{{"pem-other": 3}, {"pem-other": 90}},
+			now:             soaked,
+			expectedPhase:   v1alpha1.UpgradePhaseRolledBack,
+			expectedMessage: "no canary PEMs were scheduled on nodes node-1",
+		},
+		{
+			name:            "query errors",
+			pods:            []*v1.Pod{canaryPod("pem-1", v1.PodRunning, 0)},
+			queries:         [2]map[string]float64{{"success": 100, "error": 1}, {"success": 110, "error": 11}},
+			now:             start.Add(time.Minute),
+			expectedPhase:   v1alpha1.UpgradePhaseRolledBack,
+			expectedMessage: "10 of 20 queries failed during the canary",
+		},
+		{
+			name:          "too few queries",
+			pods:          []*v1.Pod{canaryPod("pem-1", v1.PodRunning, 0)},
+			queries:       [2]map[string]float64{{}, {"success": 1, "error": 5}},
+			now:           start.Add(time.Minute),
+			expectedPhase: v1alpha1.UpgradePhaseCanary,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			for _, pod := range test.pods {
+				_, err := clientset.CoreV1().Pods("pl").Create(context.Background(), pod, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			u := newCanaryUpgrader(clientset)
+			check := 0
+			u.fetchCounters = func(ctx context.Context, namespace, nameLabel, metric, label string) (map[string]float64, error) {
+				if nameLabel == vizierMetadataLabel {
+					return test.heartbeats[check], nil
+				}
+				return test.queries[check], nil
+			}
+
+			vz := canaryVizier()
+			startTime := metav1.NewTime(start)
+			vz.Status.Upgrade = &v1alpha1.UpgradeStatus{
+				Phase:       v1alpha1.UpgradePhaseCanary,
+				ToVersion:   vz.Spec.Version,
+				CanaryNodes: []string{"node-1"},
+				StartTime:   &startTime,
+			}
+
+			_, _, err := u.evaluate(context.Background(), vz, start)
+			require.NoError(t, err)
+			check = 1
+			phase, msg, err := u.evaluate(context.Background(), vz, test.now)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedPhase, phase)
+			assert.Equal(t, test.expectedMessage, msg)
+		})
+	}
+}
+
+type fakeMetricsClient map[string]string
+
+func (f fakeMetricsClient) Get(url string) (*http.Response, error) {
+	body, ok := f[url]
+	if !ok {
+		return nil, fmt.Errorf("unexpected request to %s", url)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+func TestFetchPodCounters(t *testing.T) {
+	metadataPod := func(name, ip string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "pl",
+				Labels:      map[string]string{"name": vizierMetadataLabel},
+				Annotations: map[string]string{metricsPortAnnotation: "50400"},
+			},
+			Status: v1.PodStatus{Phase: v1.PodRunning, PodIP: ip},
+		}
+	}
+	clientset := fake.NewSimpleClientset(metadataPod("vizier-metadata-0", "10.0.0.1"), metadataPod("vizier-metadata-1", "10.0.0.2"))
+	client := fakeMetricsClient{
+		"https://10-0-0-1.pl.pod.cluster.local:50400/metrics": `# HELP agent_heartbeats Number of heartbeats received from an agent.
+# TYPE agent_heartbeats counter
+agent_heartbeats{agent_pod_name="pem-1"} 12
+agent_heartbeats{agent_pod_name="pem-2"} 3
+`,
+		"https://10-0-0-2.pl.pod.cluster.local:50400/metrics": `# TYPE agent_heartbeats counter
+agent_heartbeats{agent_pod_name="pem-1"} 2
+`,
+	}
+
+	counters, err := fetchPodCounters(context.Background(), clientset, client, "pl", vizierMetadataLabel, agentHeartbeatsMetric, "agent_pod_name")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"pem-1": 14, "pem-2": 3}, counters)
+}
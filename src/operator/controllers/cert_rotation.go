@@ -0,0 +1,533 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/shared/status"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	serviceTLSCertsSecret  = "service-tls-certs"
+	proxyTLSCertsSecret    = "proxy-tls-certs"
+	defaultCertRenewBefore = 30 * 24 * time.Hour
+	maxCertRenewBefore     = 365 * 24 * time.Hour
+	certCheckInterval      = 1 * time.Hour
+	// certRolloutCheckInterval is how often the rollout of a renewed CA is checked, while the renewed certs wait
+	// for it.
+	certRolloutCheckInterval = 1 * time.Minute
+	// certHotReloadDelay is how long the pods that hot reload the certs may take to see an update of their
+	// mounted secret.
+	certHotReloadDelay = 2 * time.Minute
+	// certExpiryWarning is how long before the certs expire that the Vizier is marked unhealthy, if they
+	// couldn't be renewed.
+	certExpiryWarning = 5 * 24 * time.Hour
+	// certsRotatedAtAnnotation is the pod template annotation that is updated to restart a workload after
+	// the certs are renewed.
+	certsRotatedAtAnnotation = "px.dev/certs-rotated-at"
+	// certsHotReloadAnnotation marks the pods that reload the certs from their mounted secret, which don't need
+	// to be restarted.
+	certsHotReloadAnnotation = "px.dev/certs-hot-reload"
+	// certsPendingSinceAnnotation is set on the renewed certs while they wait for the pods to trust their CA.
+	certsPendingSinceAnnotation = "px.dev/certs-pending-since"
+	// pendingCertsSuffix names the secrets that hold the renewed certs until they are swapped in.
+	pendingCertsSuffix = "-pending"
+	// vizierWorkloadSelector selects all of the workloads that make up Vizier.
+	vizierWorkloadSelector = "app=pl-monitoring"
+
+	eventReasonCertsRotated         = "CertsRotated"
+	eventReasonCertsRotationStarted = "CertsRotationStarted"
+	eventReasonCertRotationFailed   = "CertRotationFailed"
+)
+
+// certKeys are the certs in each secret that must be renewed before they expire.
+var certKeys = map[string][]string{
+	serviceTLSCertsSecret: {"ca.crt", "server.crt", "client.crt"},
+	proxyTLSCertsSecret:   {"tls.crt"},
+}
+
+func certRenewBefore(vz *v1alpha1.Vizier) time.Duration {
+	if vz.Spec.CertRotation == nil {
+		return defaultCertRenewBefore
+	}
+	return durationOrDefault(vz.Spec.CertRotation.RenewBefore, defaultCertRenewBefore)
+}
+
+func certRestartStrategy(vz *v1alpha1.Vizier) v1alpha1.CertRestartStrategy {
+	if vz.Spec.CertRotation == nil || vz.Spec.CertRotation.RestartStrategy == "" {
+		return v1alpha1.CertRestartRolling
+	}
+	return vz.Spec.CertRotation.RestartStrategy
+}
+
+// parseFirstCert parses the first cert of the PEM data. Later certs, such as a previous CA that is still
+// trusted, are ignored.
+func parseFirstCert(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded cert found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// getCertsNotAfter returns when the first of the Vizier service certs expires.
+func getCertsNotAfter(ctx context.Context, clientset kubernetes.Interface, namespace string) (time.Time, error) {
+	var notAfter time.Time
+	for secretName, keys := range certKeys {
+		secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, key := range keys {
+			cert, err := parseFirstCert(secret.Data[key])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse %s in %s: %w", key, secretName, err)
+			}
+			if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+				notAfter = cert.NotAfter
+			}
+		}
+	}
+	return notAfter, nil
+}
+
+// bundleCA returns the first CA of ca followed by the first CA of other, so that the certs signed by either are
+// trusted. other is left out once it expired.
+func bundleCA(ca []byte, other []byte, now time.Time) []byte {
+	block, _ := pem.Decode(ca)
+	if block == nil {
+		return ca
+	}
+	bundle := pem.EncodeToMemory(block)
+	cert, err := parseFirstCert(other)
+	if err != nil || now.After(cert.NotAfter) {
+		// There is no other CA worth trusting.
+		return bundle
+	}
+	otherBlock, _ := pem.Decode(other)
+	return append(bundle, pem.EncodeToMemory(otherBlock)...)
+}
+
+// generateRenewedCerts generates the secrets with the renewed Vizier service certs.
+func generateRenewedCerts(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) ([]*k8s.Resource, error) {
+	if vz.Spec.Pod == nil {
+		vz = vz.DeepCopy()
+		vz.Spec.Pod = &v1alpha1.PodPolicy{}
+	}
+	return generateSignedVizierCertResources(ctx, clientset, namespace, vz)
+}
+
+// rotateCerts replaces the Vizier service certs with newly generated ones at once.
+func rotateCerts(ctx context.Context, clientset kubernetes.Interface, restConfig *rest.Config, namespace string, vz *v1alpha1.Vizier) error {
+	resources, err := generateRenewedCerts(ctx, clientset, namespace, vz)
+	if err != nil {
+		return err
+	}
+	return k8s.ApplyResources(clientset, restConfig, resources, namespace, nil, true)
+}
+
+func applySecret(ctx context.Context, clientset kubernetes.Interface, secret *v1.Secret) error {
+	_, err := clientset.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// stageCerts is the first phase of a rolling renewal of the certs. It stores the renewed certs aside, and adds their
+// CA to the CA of the current certs, so that the pods trust the renewed certs before any pod uses them.
+func stageCerts(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier, now time.Time) error {
+	current, err := clientset.CoreV1().Secrets(namespace).Get(ctx, serviceTLSCertsSecret, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	resources, err := generateRenewedCerts(ctx, clientset, namespace, vz)
+	if err != nil {
+		return err
+	}
+	var renewedCA []byte
+	for _, r := range resources {
+		if r.GVK.Kind != "Secret" {
+			continue
+		}
+		var secret v1.Secret
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(r.Object.Object, &secret); err != nil {
+			return err
+		}
+		if secret.Name == serviceTLSCertsSecret {
+			renewedCA = secret.Data["ca.crt"]
+		}
+		secret.Name += pendingCertsSuffix
+		secret.Namespace = namespace
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[certsPendingSinceAnnotation] = now.UTC().Format(time.RFC3339)
+		if err := applySecret(ctx, clientset, &secret); err != nil {
+			return err
+		}
+	}
+	if renewedCA == nil {
+		return fmt.Errorf("the renewed certs are missing %s", serviceTLSCertsSecret)
+	}
+
+	current.Data["ca.crt"] = bundleCA(current.Data["ca.crt"], renewedCA, now)
+	_, err = clientset.CoreV1().Secrets(namespace).Update(ctx, current, metav1.UpdateOptions{})
+	return err
+}
+
+// getCertsPendingSince returns when the renewed certs were staged, or the zero time if none are.
+func getCertsPendingSince(ctx context.Context, clientset kubernetes.Interface, namespace string) (time.Time, error) {
+	pending, err := clientset.CoreV1().Secrets(namespace).Get(ctx, serviceTLSCertsSecret+pendingCertsSuffix, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, pending.Annotations[certsPendingSinceAnnotation])
+}
+
+// swapStagedCerts is the second phase of a rolling renewal of the certs. It replaces the current certs with the
+// staged ones. The previous CA stays trusted, for the pods that haven't restarted with the renewed certs yet.
+func swapStagedCerts(ctx context.Context, clientset kubernetes.Interface, namespace string, now time.Time) error {
+	for secretName := range certKeys {
+		pending, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName+pendingCertsSuffix, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if secretName == serviceTLSCertsSecret {
+			pending.Data["ca.crt"] = bundleCA(pending.Data["ca.crt"], current.Data["ca.crt"], now)
+		}
+		current.Data = pending.Data
+		if _, err := clientset.CoreV1().Secrets(namespace).Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	for secretName := range certKeys {
+		err := clientset.CoreV1().Secrets(namespace).Delete(ctx, secretName+pendingCertsSuffix, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// certDependentsRolledOut returns whether all of the Vizier pods that load the certs on start were restarted since
+// the workloads were last updated.
+func certDependentsRolledOut(ctx context.Context, clientset kubernetes.Interface, namespace string) (bool, error) {
+	replicas := func(r *int32) int32 {
+		if r == nil {
+			return 1
+		}
+		return *r
+	}
+	opts := metav1.ListOptions{LabelSelector: vizierWorkloadSelector}
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range deployments.Items {
+		if certsHotReload(d.Spec.Template.ObjectMeta) {
+			continue
+		}
+		want := replicas(d.Spec.Replicas)
+		if d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedReplicas < want ||
+			d.Status.Replicas > d.Status.UpdatedReplicas || d.Status.AvailableReplicas < want {
+			return false, nil
+		}
+	}
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, ss := range statefulSets.Items {
+		if certsHotReload(ss.Spec.Template.ObjectMeta) {
+			continue
+		}
+		want := replicas(ss.Spec.Replicas)
+		if ss.Status.ObservedGeneration < ss.Generation || ss.Status.UpdatedReplicas < want || ss.Status.ReadyReplicas < want {
+			return false, nil
+		}
+	}
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, ds := range daemonSets.Items {
+		if certsHotReload(ds.Spec.Template.ObjectMeta) {
+			continue
+		}
+		want := ds.Status.DesiredNumberScheduled
+		if ds.Status.ObservedGeneration < ds.Generation || ds.Status.UpdatedNumberScheduled < want || ds.Status.NumberAvailable < want {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func certsHotReload(meta metav1.ObjectMeta) bool {
+	return meta.Annotations[certsHotReloadAnnotation] == "true"
+}
+
+// restartCertDependents restarts the Vizier pods, so that they pick up the renewed certs.
+func restartCertDependents(ctx context.Context, clientset kubernetes.Interface, namespace string, strategy v1alpha1.CertRestartStrategy, now time.Time) error {
+	opts := metav1.ListOptions{LabelSelector: vizierWorkloadSelector}
+	if strategy == v1alpha1.CertRestartRecreate {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, p := range pods.Items {
+			if certsHotReload(p.ObjectMeta) {
+				continue
+			}
+			if err := clientset.CoreV1().Pods(namespace).Delete(ctx, p.Name, metav1.DeleteOptions{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		certsRotatedAtAnnotation, now.UTC().Format(time.RFC3339)))
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, ss := range statefulSets.Items {
+		if certsHotReload(ss.Spec.Template.ObjectMeta) {
+			continue
+		}
+		_, err := clientset.AppsV1().StatefulSets(namespace).Patch(ctx, ss.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments.Items {
+		if certsHotReload(d.Spec.Template.ObjectMeta) {
+			continue
+		}
+		_, err := clientset.AppsV1().Deployments(namespace).Patch(ctx, d.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, ds := range daemonSets.Items {
+		if certsHotReload(ds.Spec.Template.ObjectMeta) {
+			continue
+		}
+		_, err := clientset.AppsV1().DaemonSets(namespace).Patch(ctx, ds.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certRotator watches the expiry of the Vizier service certs, and renews them before they expire. With the rolling
+// restart strategy, the certs are renewed in two phases: the CA of the renewed certs is first added to the trusted CAs
+// of the pods, and the renewed certs are only swapped in once all of the pods picked it up.
+type certRotator struct {
+	clientset      kubernetes.Interface
+	restConfig     *rest.Config
+	namespace      string
+	namespacedName types.NamespacedName
+	clock          clock.Clock
+
+	vzGet    func(context.Context, types.NamespacedName, client.Object, ...client.GetOption) error
+	vzUpdate func(context.Context, client.Object, ...client.SubResourceUpdateOption) error
+	// recorder records an event on the Vizier when the certs are renewed. If nil, no events are recorded.
+	recorder record.EventRecorder
+	// onRotate is called after the certs are renewed.
+	onRotate func()
+
+	state chan<- *vizierState
+}
+
+func (c *certRotator) start(ctx context.Context) {
+	t := c.clock.NewTicker(c.check(ctx, c.clock.Now()))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Received cancel, stopping cert rotator")
+			return
+		case <-t.C():
+			t.Reset(c.check(ctx, c.clock.Now()))
+		}
+	}
+}
+
+func (c *certRotator) sendState(ctx context.Context, state *vizierState) {
+	select {
+	case <-ctx.Done():
+	case c.state <- state:
+	}
+}
+
+func (c *certRotator) recordEvent(vz *v1alpha1.Vizier, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.recorder != nil {
+		c.recorder.Eventf(vz, eventType, reason, messageFmt, args...)
+	}
+}
+
+// check renews the certs if they expire within the renewal period of the Vizier, or swaps in the renewed certs once
+// the pods trust their CA. It returns when the certs should be checked next.
+func (c *certRotator) check(ctx context.Context, now time.Time) time.Duration {
+	vz := &v1alpha1.Vizier{}
+	if err := c.vzGet(ctx, c.namespacedName, vz); err != nil {
+		log.WithError(err).Error("Failed to get vizier")
+		return certCheckInterval
+	}
+	notAfter, err := getCertsNotAfter(ctx, c.clientset, c.namespace)
+	if err != nil {
+		// The certs don't exist until Vizier is first deployed.
+		log.WithError(err).Warn("Failed to check the expiry of the Vizier certs")
+		return certCheckInterval
+	}
+
+	certStatus := &v1alpha1.CertStatus{}
+	if vz.Status.Certs != nil {
+		certStatus.LastRotationTime = vz.Status.Certs.LastRotationTime
+	}
+	state := okState()
+	pendingSince, err := getCertsPendingSince(ctx, c.clientset, c.namespace)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("failed to check the renewed certs: %w", err)
+	case !pendingSince.IsZero():
+		err = c.finishRotation(ctx, vz, pendingSince, now, certStatus)
+	case !now.Add(certRenewBefore(vz)).Before(notAfter):
+		log.WithField("notAfter", notAfter).Info("Renewing Vizier certs before they expire")
+		err = c.rotate(ctx, vz, now, certStatus)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to renew Vizier certs")
+		c.recordEvent(vz, v1.EventTypeWarning, eventReasonCertRotationFailed, "Failed to renew the service certs: %v", err)
+		certStatus.Message = fmt.Sprintf("Failed to renew the service certs: %v", err)
+	}
+	if renewed, err := getCertsNotAfter(ctx, c.clientset, c.namespace); err == nil {
+		notAfter = renewed
+	}
+	certStatus.NotAfter = &metav1.Time{Time: notAfter}
+	if certStatus.Message != "" && now.Add(certExpiryWarning).After(notAfter) {
+		state = &vizierState{Reason: status.TLSCertsExpired}
+	}
+	c.sendState(ctx, state)
+
+	if !reflect.DeepEqual(certStatus, vz.Status.Certs) {
+		vz.Status.Certs = certStatus
+		if err := c.vzUpdate(ctx, vz); err != nil {
+			log.WithError(err).Error("Failed to update the cert status of the vizier")
+		}
+	}
+	if certStatus.PendingSince != nil {
+		return certRolloutCheckInterval
+	}
+	return certCheckInterval
+}
+
+// rotate renews the certs and restarts the pods that use them. With the rolling restart strategy, the renewed certs
+// are only staged, and the pods are restarted to trust their CA.
+func (c *certRotator) rotate(ctx context.Context, vz *v1alpha1.Vizier, now time.Time, certStatus *v1alpha1.CertStatus) error {
+	strategy := certRestartStrategy(vz)
+	if strategy == v1alpha1.CertRestartRolling {
+		if err := stageCerts(ctx, c.clientset, c.namespace, vz, now); err != nil {
+			return err
+		}
+		certStatus.PendingSince = &metav1.Time{Time: now}
+	} else if err := rotateCerts(ctx, c.clientset, c.restConfig, c.namespace, vz); err != nil {
+		return err
+	}
+	if c.onRotate != nil {
+		c.onRotate()
+	}
+	if err := restartCertDependents(ctx, c.clientset, c.namespace, strategy, now); err != nil {
+		return fmt.Errorf("renewed the certs, but failed to restart Vizier: %w", err)
+	}
+	if strategy == v1alpha1.CertRestartRolling {
+		c.recordEvent(vz, v1.EventTypeNormal, eventReasonCertsRotationStarted,
+			"Added the CA of the renewed service certs to the trusted CAs, and restarted Vizier with the %s strategy", strategy)
+		return nil
+	}
+	c.recordEvent(vz, v1.EventTypeNormal, eventReasonCertsRotated,
+		"Renewed the service certs, and restarted Vizier with the %s strategy", strategy)
+	certStatus.LastRotationTime = &metav1.Time{Time: now}
+	return nil
+}
+
+// finishRotation swaps in the staged certs once all of the pods trust their CA, and restarts the pods that use them.
+func (c *certRotator) finishRotation(ctx context.Context, vz *v1alpha1.Vizier, pendingSince time.Time, now time.Time, certStatus *v1alpha1.CertStatus) error {
+	certStatus.PendingSince = &metav1.Time{Time: pendingSince}
+	if now.Before(pendingSince.Add(certHotReloadDelay)) {
+		return nil
+	}
+	rolledOut, err := certDependentsRolledOut(ctx, c.clientset, c.namespace)
+	if err != nil || !rolledOut {
+		return err
+	}
+	if err := swapStagedCerts(ctx, c.clientset, c.namespace, now); err != nil {
+		return err
+	}
+	certStatus.PendingSince = nil
+	if c.onRotate != nil {
+		c.onRotate()
+	}
+	if err := restartCertDependents(ctx, c.clientset, c.namespace, v1alpha1.CertRestartRolling, now); err != nil {
+		return fmt.Errorf("renewed the certs, but failed to restart Vizier: %w", err)
+	}
+	c.recordEvent(vz, v1.EventTypeNormal, eventReasonCertsRotated,
+		"Renewed the service certs, and restarted Vizier with the %s strategy", v1alpha1.CertRestartRolling)
+	certStatus.LastRotationTime = &metav1.Time{Time: now}
+	return nil
+}
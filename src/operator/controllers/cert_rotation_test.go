@@ -0,0 +1,288 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+func certSecrets(t *testing.T, resources []*k8s.Resource) []runtime.Object {
+	var secrets []runtime.Object
+	for _, r := range resources {
+		var secret v1.Secret
+		require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(r.Object.Object, &secret))
+		secret.Namespace = "pl"
+		secrets = append(secrets, &secret)
+	}
+	return secrets
+}
+
+func TestCertRotation(t *testing.T) {
+	vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{Pod: &v1alpha1.PodPolicy{}}}
+	current, err := generateVizierCertResources("pl", vz)
+	require.NoError(t, err)
+	renewed, err := generateVizierCertResources("pl", vz)
+	require.NoError(t, err)
+	now := time.Now()
+
+	t.Run("not after", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(certSecrets(t, current)...)
+		notAfter, err := getCertsNotAfter(context.Background(), clientset, "pl")
+		require.NoError(t, err)
+		assert.WithinDuration(t, now.AddDate(5, 0, 0), notAfter, time.Minute)
+
+		_, err = getCertsNotAfter(context.Background(), fake.NewSimpleClientset(), "pl")
+		assert.True(t, k8serrors.IsNotFound(err))
+	})
+
+	t.Run("bundle CA", func(t *testing.T) {
+		currentCA := secretData(t, current, serviceTLSCertsSecret)["ca.crt"]
+		renewedCA := secretData(t, renewed, serviceTLSCertsSecret)["ca.crt"]
+
+		bundle := bundleCA(renewedCA, currentCA, now)
+		first, rest := pem.Decode(bundle)
+		require.NotNil(t, first)
+		second, _ := pem.Decode(rest)
+		require.NotNil(t, second)
+		assert.Equal(t, bytes.TrimSpace(renewedCA), bytes.TrimSpace(pem.EncodeToMemory(first)))
+		assert.Equal(t, bytes.TrimSpace(currentCA), bytes.TrimSpace(pem.EncodeToMemory(second)))
+
+		// Only the first CA of each bundle is kept, and expired CAs are dropped.
+		assert.Equal(t, bundle, bundleCA(bundle, bundleCA(currentCA, renewedCA, now), now))
+		assert.Equal(t, bytes.TrimSpace(renewedCA), bytes.TrimSpace(bundleCA(bundle, currentCA, now.AddDate(6, 0, 0))))
+	})
+
+	t.Run("check before renewal", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(certSecrets(t, renewed)...)
+		stored := &v1alpha1.Vizier{ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"}}
+		stateCh := make(chan *vizierState, 1)
+		rotator := newTestCertRotator(clientset, stored, nil, stateCh)
+		rotator.onRotate = func() { t.Error("the certs must not be renewed") }
+
+		rotator.check(context.Background(), now)
+		assert.True(t, isOk(<-stateCh))
+		require.NotNil(t, stored.Status.Certs)
+		assert.WithinDuration(t, now.AddDate(5, 0, 0), stored.Status.Certs.NotAfter.Time, time.Minute)
+		assert.Nil(t, stored.Status.Certs.LastRotationTime)
+	})
+}
+
+func secretData(t *testing.T, resources []*k8s.Resource, name string) map[string][]byte {
+	for _, s := range certSecrets(t, resources) {
+		if secret := s.(*v1.Secret); secret.Name == name {
+			return secret.Data
+		}
+	}
+	t.Fatalf("missing secret %s", name)
+	return nil
+}
+
+func newTestCertRotator(clientset *fake.Clientset, stored *v1alpha1.Vizier, c clock.Clock, stateCh chan *vizierState) *certRotator {
+	return &certRotator{
+		clientset:      clientset,
+		namespace:      "pl",
+		namespacedName: types.NamespacedName{Name: "pixie", Namespace: "pl"},
+		clock:          c,
+		vzGet: func(_ context.Context, _ types.NamespacedName, obj client.Object, _ ...client.GetOption) error {
+			stored.DeepCopyInto(obj.(*v1alpha1.Vizier))
+			return nil
+		},
+		vzUpdate: func(_ context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+			obj.(*v1alpha1.Vizier).DeepCopyInto(stored)
+			return nil
+		},
+		state: stateCh,
+	}
+}
+
+func TestCertRotation_TwoPhases(t *testing.T) {
+	ctx := context.Background()
+	vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{Pod: &v1alpha1.PodPolicy{}}}
+	current, err := generateVizierCertResources("pl", vz)
+	require.NoError(t, err)
+	currentData := secretData(t, current, serviceTLSCertsSecret)
+
+	one := int32(1)
+	kelvin := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "kelvin", Namespace: "pl", Labels: map[string]string{"app": "pl-monitoring"}, Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &one},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+	clientset := fake.NewSimpleClientset(append(certSecrets(t, current), kelvin)...)
+	stored := &v1alpha1.Vizier{ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"}}
+	stateCh := make(chan *vizierState, 1)
+	rotations := 0
+	rotator := newTestCertRotator(clientset, stored, nil, stateCh)
+	rotator.onRotate = func() { rotations++ }
+
+	getSecret := func(name string) *v1.Secret {
+		secret, err := clientset.CoreV1().Secrets("pl").Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		return secret
+	}
+	setRolledOut := func(rolledOut bool) {
+		d, err := clientset.AppsV1().Deployments("pl").Get(ctx, "kelvin", metav1.GetOptions{})
+		require.NoError(t, err)
+		d.Generation++
+		if rolledOut {
+			d.Status.ObservedGeneration = d.Generation
+		}
+		_, err = clientset.AppsV1().Deployments("pl").Update(ctx, d, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+
+	// The certs are within the renewal period, so the renewed certs are staged, and their CA is trusted alongside
+	// the current CA.
+	now := time.Now().AddDate(5, 0, -10)
+	assert.Equal(t, certRolloutCheckInterval, rotator.check(ctx, now))
+	assert.True(t, isOk(<-stateCh))
+	pending := getSecret(serviceTLSCertsSecret + pendingCertsSuffix)
+	assert.Equal(t, now.UTC().Format(time.RFC3339), pending.Annotations[certsPendingSinceAnnotation])
+	getSecret(proxyTLSCertsSecret + pendingCertsSuffix)
+	staged := getSecret(serviceTLSCertsSecret)
+	assert.Equal(t, currentData["server.crt"], staged.Data["server.crt"])
+	assert.Equal(t, bundleCA(currentData["ca.crt"], pending.Data["ca.crt"], now), staged.Data["ca.crt"])
+	require.NotNil(t, stored.Status.Certs.PendingSince)
+	assert.Nil(t, stored.Status.Certs.LastRotationTime)
+	d, err := clientset.AppsV1().Deployments("pl").Get(ctx, "kelvin", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, d.Spec.Template.Annotations, certsRotatedAtAnnotation)
+	assert.Equal(t, 1, rotations)
+
+	// The renewed certs wait until the pods that hot reload the certs had time to pick up the CA, and the other
+	// pods were restarted.
+	setRolledOut(false)
+	for _, later := range []time.Duration{time.Minute, certHotReloadDelay + time.Minute} {
+		assert.Equal(t, certRolloutCheckInterval, rotator.check(ctx, now.Add(later)))
+		assert.True(t, isOk(<-stateCh))
+		assert.Equal(t, staged.Data, getSecret(serviceTLSCertsSecret).Data)
+	}
+
+	// Once all of the pods trust the renewed CA, the renewed certs are swapped in. The previous CA stays trusted
+	// until the pods restarted with the renewed certs.
+	setRolledOut(true)
+	swapAt := now.Add(certHotReloadDelay + 2*time.Minute)
+	assert.Equal(t, certCheckInterval, rotator.check(ctx, swapAt))
+	assert.True(t, isOk(<-stateCh))
+	swapped := getSecret(serviceTLSCertsSecret)
+	assert.Equal(t, pending.Data["server.crt"], swapped.Data["server.crt"])
+	assert.Equal(t, bundleCA(pending.Data["ca.crt"], currentData["ca.crt"], swapAt), swapped.Data["ca.crt"])
+	_, err = clientset.CoreV1().Secrets("pl").Get(ctx, serviceTLSCertsSecret+pendingCertsSuffix, metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	_, err = clientset.CoreV1().Secrets("pl").Get(ctx, proxyTLSCertsSecret+pendingCertsSuffix, metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	assert.Nil(t, stored.Status.Certs.PendingSince)
+	require.NotNil(t, stored.Status.Certs.LastRotationTime)
+	assert.Equal(t, swapAt, stored.Status.Certs.LastRotationTime.Time)
+	assert.Equal(t, 2, rotations)
+}
+
+func TestCertRotator_UsesClock(t *testing.T) {
+	vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{Pod: &v1alpha1.PodPolicy{}}}
+	current, err := generateVizierCertResources("pl", vz)
+	require.NoError(t, err)
+	stored := &v1alpha1.Vizier{ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"}}
+	stateCh := make(chan *vizierState)
+	c := clock.NewFakeClock(time.Now())
+	rotator := newTestCertRotator(fake.NewSimpleClientset(certSecrets(t, current)...), stored, c, stateCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rotator.start(ctx)
+	assert.True(t, isOk(<-stateCh))
+
+	c.BlockUntil(1)
+	c.Advance(certCheckInterval)
+	assert.True(t, isOk(<-stateCh))
+}
+
+func TestCertRenewBefore(t *testing.T) {
+	assert.Equal(t, defaultCertRenewBefore, certRenewBefore(&v1alpha1.Vizier{}))
+	vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{CertRotation: &v1alpha1.CertRotation{
+		RenewBefore: &metav1.Duration{Duration: 7 * 24 * time.Hour},
+	}}}
+	assert.Equal(t, 7*24*time.Hour, certRenewBefore(vz))
+	assert.Equal(t, v1alpha1.CertRestartRolling, certRestartStrategy(vz))
+}
+
+func TestRestartCertDependents(t *testing.T) {
+	labels := map[string]string{"app": "pl-monitoring"}
+	hotReload := map[string]string{certsHotReloadAnnotation: "true"}
+	now := time.Date(2023, 10, 15, 9, 30, 0, 0, time.UTC)
+
+	t.Run("rolling", func(t *testing.T) {
+		ctx := context.Background()
+		clientset := fake.NewSimpleClientset(
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "kelvin", Namespace: "pl", Labels: labels}},
+			&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "vizier-metadata", Namespace: "pl", Labels: labels}},
+			&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "vizier-pem", Namespace: "pl", Labels: labels},
+				Spec: appsv1.DaemonSetSpec{Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Annotations: hotReload},
+				}},
+			},
+		)
+
+		require.NoError(t, restartCertDependents(ctx, clientset, "pl", v1alpha1.CertRestartRolling, now))
+
+		d, err := clientset.AppsV1().Deployments("pl").Get(ctx, "kelvin", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "2023-10-15T09:30:00Z", d.Spec.Template.Annotations[certsRotatedAtAnnotation])
+		ss, err := clientset.AppsV1().StatefulSets("pl").Get(ctx, "vizier-metadata", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "2023-10-15T09:30:00Z", ss.Spec.Template.Annotations[certsRotatedAtAnnotation])
+		ds, err := clientset.AppsV1().DaemonSets("pl").Get(ctx, "vizier-pem", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, ds.Spec.Template.Annotations, certsRotatedAtAnnotation)
+	})
+
+	t.Run("recreate", func(t *testing.T) {
+		ctx := context.Background()
+		clientset := fake.NewSimpleClientset(
+			&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kelvin-abc", Namespace: "pl", Labels: labels}},
+			&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "vizier-pem-abc", Namespace: "pl", Labels: labels, Annotations: hotReload}},
+		)
+
+		require.NoError(t, restartCertDependents(ctx, clientset, "pl", v1alpha1.CertRestartRecreate, now))
+
+		pods, err := clientset.CoreV1().Pods("pl").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, pods.Items, 1)
+		assert.Equal(t, "vizier-pem-abc", pods.Items[0].Name)
+	})
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/certs"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const defaultCertSigningTimeout = 10 * time.Minute
+
+// csrPollInterval is how often a CertificateSigningRequest is checked for its issued cert.
+var csrPollInterval = 2 * time.Second
+
+// csrSigner requests the Vizier service certs from an external CA, through the Kubernetes
+// CertificateSigningRequest API.
+type csrSigner struct {
+	ctx       context.Context
+	clientset kubernetes.Interface
+	namespace string
+	config    *v1alpha1.CertSigning
+}
+
+// SignCSR creates a CertificateSigningRequest for the CSR, and waits for the signer to issue its cert. The
+// request is deleted once it is no longer needed.
+func (s *csrSigner) SignCSR(csr []byte) ([]byte, error) {
+	req := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   fmt.Sprintf("pl-vizier-certs-%s-%s", s.namespace, utilrand.String(8)),
+			Labels: map[string]string{"app": "pl-monitoring"},
+		},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    csr,
+			SignerName: s.config.SignerName,
+			Usages: []certificatesv1.KeyUsage{
+				certificatesv1.UsageDigitalSignature,
+				certificatesv1.UsageKeyEncipherment,
+				certificatesv1.UsageServerAuth,
+				certificatesv1.UsageClientAuth,
+			},
+		},
+	}
+	if s.config.Duration != nil && s.config.Duration.Duration > 0 {
+		seconds := int32(s.config.Duration.Duration.Seconds())
+		req.Spec.ExpirationSeconds = &seconds
+	}
+
+	csrClient := s.clientset.CertificatesV1().CertificateSigningRequests()
+	req, err := csrClient.Create(s.ctx, req, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CertificateSigningRequest: %w", err)
+	}
+	name := req.Name
+	defer func() {
+		err := csrClient.Delete(context.Background(), name, metav1.DeleteOptions{})
+		if err != nil {
+			log.WithError(err).WithField("name", name).Error("Failed to delete CertificateSigningRequest")
+		}
+	}()
+
+	if s.config.AutoApprove {
+		req.Status.Conditions = append(req.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           certificatesv1.CertificateApproved,
+			Status:         v1.ConditionTrue,
+			Reason:         "PixieOperatorApproved",
+			Message:        "Approved by the Pixie operator for the Vizier service certs",
+			LastUpdateTime: metav1.Now(),
+		})
+		req, err = csrClient.UpdateApproval(s.ctx, name, req, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to approve CertificateSigningRequest %s: %w", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, durationOrDefault(s.config.Timeout, defaultCertSigningTimeout))
+	defer cancel()
+	ticker := time.NewTicker(csrPollInterval)
+	defer ticker.Stop()
+	for {
+		for _, c := range req.Status.Conditions {
+			if (c.Type == certificatesv1.CertificateDenied || c.Type == certificatesv1.CertificateFailed) && c.Status == v1.ConditionTrue {
+				return nil, fmt.Errorf("CertificateSigningRequest %s was %s: %s", name, c.Type, c.Message)
+			}
+		}
+		if len(req.Status.Certificate) > 0 {
+			return req.Status.Certificate, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for CertificateSigningRequest %s to be issued", name)
+		case <-ticker.C:
+		}
+		req, err = csrClient.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CertificateSigningRequest: %w", err)
+		}
+	}
+}
+
+// generateSignedVizierCertResources generates the secrets with a new set of Vizier service certs, which are
+// signed by the external CA of the Vizier if it has one.
+func generateSignedVizierCertResources(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) ([]*k8s.Resource, error) {
+	if vz.Spec.CertSigning == nil {
+		return generateVizierCertResources(namespace, vz)
+	}
+
+	log.WithField("signer", vz.Spec.CertSigning.SignerName).Info("Requesting certs from external CA")
+	signer := &csrSigner{
+		ctx:       ctx,
+		clientset: clientset,
+		namespace: namespace,
+		config:    vz.Spec.CertSigning,
+	}
+	certYAMLs, err := certs.GenerateVizierCertYAMLsWithSigner(namespace, signer, []byte(vz.Spec.CertSigning.CABundle))
+	if err != nil {
+		return nil, err
+	}
+	return generateVizierResources(certYAMLs, vz)
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *rsa.PrivateKey
+	certPEM []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test PKI"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) sign(t *testing.T, csrPEM []byte) []byte {
+	block, _ := pem.Decode(csrPEM)
+	require.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func approved(csr *certificatesv1.CertificateSigningRequest) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == certificatesv1.CertificateApproved && c.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// runSigner handles the CertificateSigningRequests in the clientset like an external CA would, until the
+// context is done.
+func runSigner(ctx context.Context, t *testing.T, clientset *fake.Clientset, handle func(*certificatesv1.CertificateSigningRequest) bool) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			csrs, err := clientset.CertificatesV1().CertificateSigningRequests().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				continue
+			}
+			for i := range csrs.Items {
+				csr := &csrs.Items[i]
+				if len(csr.Status.Certificate) > 0 || !handle(csr) {
+					continue
+				}
+				_, _ = clientset.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, csr, metav1.UpdateOptions{})
+			}
+		}
+	}()
+}
+
+func withCSRPollInterval(t *testing.T, d time.Duration) {
+	prev := csrPollInterval
+	csrPollInterval = d
+	t.Cleanup(func() { csrPollInterval = prev })
+}
+
+func TestGenerateSignedVizierCertResources(t *testing.T) {
+	withCSRPollInterval(t, 10*time.Millisecond)
+	ca := newTestCA(t)
+	clientset := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requested []*certificatesv1.CertificateSigningRequest
+	runSigner(ctx, t, clientset, func(csr *certificatesv1.CertificateSigningRequest) bool {
+		if !approved(csr) {
+			return false
+		}
+		requested = append(requested, csr.DeepCopy())
+		csr.Status.Certificate = ca.sign(t, csr.Spec.Request)
+		return true
+	})
+
+	vz := &v1alpha1.Vizier{
+		Spec: v1alpha1.VizierSpec{
+			Pod: &v1alpha1.PodPolicy{},
+			CertSigning: &v1alpha1.CertSigning{
+				SignerName:  "example.com/pixie",
+				CABundle:    string(ca.certPEM),
+				AutoApprove: true,
+				Duration:    &metav1.Duration{Duration: 24 * time.Hour},
+			},
+		},
+	}
+	resources, err := generateSignedVizierCertResources(ctx, clientset, "pl", vz)
+	require.NoError(t, err)
+
+	require.Len(t, requested, 2)
+	for _, csr := range requested {
+		assert.Equal(t, "example.com/pixie", csr.Spec.SignerName)
+		assert.Equal(t, int32(24*60*60), *csr.Spec.ExpirationSeconds)
+	}
+	// The requests are cleaned up once the certs are issued.
+	csrs, err := clientset.CertificatesV1().CertificateSigningRequests().List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, csrs.Items)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	var found bool
+	for _, r := range resources {
+		if r.Object.GetName() != serviceTLSCertsSecret {
+			continue
+		}
+		found = true
+		var secret v1.Secret
+		require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(r.Object.Object, &secret))
+		assert.Equal(t, ca.certPEM, secret.Data["ca.crt"])
+		for _, key := range []string{"server.crt", "client.crt"} {
+			cert, err := parseFirstCert(secret.Data[key])
+			require.NoError(t, err)
+			_, err = cert.Verify(x509.VerifyOptions{
+				Roots:     roots,
+				DNSName:   "vizier-api.pl.svc",
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			})
+			assert.NoError(t, err, key)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestGenerateSignedVizierCertResources_Denied(t *testing.T) {
+	withCSRPollInterval(t, 10*time.Millisecond)
+	clientset := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runSigner(ctx, t, clientset, func(csr *certificatesv1.CertificateSigningRequest) bool {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateDenied,
+			Status:  v1.ConditionTrue,
+			Message: "not allowed",
+		})
+		return true
+	})
+
+	vz := &v1alpha1.Vizier{
+		Spec: v1alpha1.VizierSpec{
+			CertSigning: &v1alpha1.CertSigning{SignerName: "example.com/pixie", CABundle: "ca"},
+		},
+	}
+	_, err := generateSignedVizierCertResources(ctx, clientset, "pl", vz)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed")
+}
+
+func TestGenerateSignedVizierCertResources_Timeout(t *testing.T) {
+	withCSRPollInterval(t, 10*time.Millisecond)
+	clientset := fake.NewSimpleClientset()
+
+	// Without auto approval, the requests wait for an approver that never comes.
+	vz := &v1alpha1.Vizier{
+		Spec: v1alpha1.VizierSpec{
+			CertSigning: &v1alpha1.CertSigning{
+				SignerName: "example.com/pixie",
+				CABundle:   "ca",
+				Timeout:    &metav1.Duration{Duration: 50 * time.Millisecond},
+			},
+		},
+	}
+	_, err := generateSignedVizierCertResources(context.Background(), clientset, "pl", vz)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
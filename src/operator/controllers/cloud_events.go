@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	// cloudEventsContentType is the content type of a CloudEvent in the structured content mode.
+	cloudEventsContentType = "application/cloudevents+json"
+	// defaultEventSubject is the NATS subject that CloudEvents are published to if the sink doesn't set one.
+	defaultEventSubject = "pixie.vizier.lifecycle"
+	// eventPublishTimeout is how long the operator tries to publish a CloudEvent before giving up on it.
+	eventPublishTimeout = 10 * time.Second
+)
+
+// The types of the CloudEvents that the operator publishes about Vizier lifecycle changes.
+const (
+	cloudEventVizierDeployed = "dev.px.vizier.deployed"
+	cloudEventVizierUpgraded = "dev.px.vizier.upgraded"
+	cloudEventVizierDegraded = "dev.px.vizier.degraded"
+	cloudEventVizierDeleted  = "dev.px.vizier.deleted"
+)
+
+// cloudEvent is a CloudEvent in the JSON event format.
+type cloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject"`
+	Time            time.Time         `json:"time"`
+	DataContentType string            `json:"datacontenttype"`
+	Data            *vizierChangeData `json:"data"`
+}
+
+// vizierChangeData is the data of the CloudEvents about Vizier lifecycle changes.
+type vizierChangeData struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	// PreviousVersion is the version that the Vizier was upgraded from.
+	PreviousVersion string `json:"previousVersion,omitempty"`
+	Phase           string `json:"phase,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	Message         string `json:"message,omitempty"`
+}
+
+// newVizierCloudEvent creates a CloudEvent of the given type about the Vizier. The source of the event is the
+// Vizier object.
+func newVizierCloudEvent(eventType string, vz *v1alpha1.Vizier) *cloudEvent {
+	return &cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              uuid.Must(uuid.NewV4()).String(),
+		Source:          fmt.Sprintf("/apis/px.dev/v1alpha1/namespaces/%s/viziers/%s", vz.Namespace, vz.Name),
+		Type:            eventType,
+		Subject:         vz.Name,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data: &vizierChangeData{
+			Namespace: vz.Namespace,
+			Name:      vz.Name,
+			Version:   vz.Status.Version,
+			Phase:     string(vz.Status.VizierPhase),
+			Reason:    vz.Status.VizierReason,
+			Message:   vz.Status.Message,
+		},
+	}
+}
+
+// LifecycleEventPublisher publishes CloudEvents about Vizier lifecycle changes to the event sink in the
+// operator settings. A nil *LifecycleEventPublisher publishes nothing.
+type LifecycleEventPublisher struct {
+	settings   *OperatorSettings
+	httpClient *http.Client
+
+	// nc is the connection to the NATS servers at natsURL, which is kept between events.
+	natsMu  sync.Mutex
+	nc      *nats.Conn
+	natsURL string
+}
+
+// NewLifecycleEventPublisher creates a publisher that publishes to the event sink in the given settings.
+func NewLifecycleEventPublisher(settings *OperatorSettings) *LifecycleEventPublisher {
+	return &LifecycleEventPublisher{
+		settings:   settings,
+		httpClient: &http.Client{Timeout: eventPublishTimeout},
+	}
+}
+
+// emit publishes the event in the background, so that a slow or unavailable sink doesn't hold up the
+// reconciliation. Events that can't be published are logged and dropped.
+func (p *LifecycleEventPublisher) emit(ev *cloudEvent) {
+	if p == nil || p.settings.EventSink() == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+		defer cancel()
+		if err := p.publish(ctx, ev); err != nil {
+			log.WithError(err).WithField("type", ev.Type).WithField("source", ev.Source).Error("Failed to publish CloudEvent")
+		}
+	}()
+}
+
+// publish sends the event to the event sink.
+func (p *LifecycleEventPublisher) publish(ctx context.Context, ev *cloudEvent) error {
+	sink := p.settings.EventSink()
+	if sink == nil {
+		return nil
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if sink.HTTP != nil {
+		return p.publishHTTP(ctx, sink.HTTP, body)
+	}
+	return p.publishNATS(sink.NATS, body)
+}
+
+func (p *LifecycleEventPublisher) publishHTTP(ctx context.Context, sink *v1alpha1.HTTPEventSink, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", cloudEventsContentType)
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event sink %s responded with %s", sink.URL, resp.Status)
+	}
+	return nil
+}
+
+func (p *LifecycleEventPublisher) publishNATS(sink *v1alpha1.NATSEventSink, body []byte) error {
+	p.natsMu.Lock()
+	defer p.natsMu.Unlock()
+
+	if p.nc == nil || p.nc.IsClosed() || p.natsURL != sink.URL {
+		if p.nc != nil {
+			p.nc.Close()
+		}
+		nc, err := nats.Connect(sink.URL, nats.Name("vizier-operator"), nats.Timeout(eventPublishTimeout))
+		if err != nil {
+			p.nc = nil
+			return fmt.Errorf("failed to connect to the event sink: %w", err)
+		}
+		p.nc, p.natsURL = nc, sink.URL
+	}
+
+	subject := sink.Subject
+	if subject == "" {
+		subject = defaultEventSubject
+	}
+	msg := nats.NewMsg(subject)
+	msg.Header.Set("Content-Type", cloudEventsContentType)
+	msg.Data = body
+	if err := p.nc.PublishMsg(msg); err != nil {
+		return err
+	}
+	return p.nc.FlushTimeout(eventPublishTimeout)
+}
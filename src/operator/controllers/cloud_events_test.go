@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+func cloudEventTestVizier() *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "pl", Name: "pixie"},
+		Status: v1alpha1.VizierStatus{
+			Version:      "0.14.2",
+			VizierPhase:  v1alpha1.VizierPhaseDegraded,
+			VizierReason: "PodsCrashLooping",
+			Message:      "Vizier pods are crashlooping.",
+		},
+	}
+}
+
+func eventSinkSettings(sink *v1alpha1.EventSink) *OperatorSettings {
+	s := NewOperatorSettings()
+	s.set(&v1alpha1.OperatorConfigSpec{EventSink: sink})
+	return s
+}
+
+func TestNewVizierCloudEvent(t *testing.T) {
+	ev := newVizierCloudEvent(cloudEventVizierDegraded, cloudEventTestVizier())
+
+	assert.Equal(t, "1.0", ev.SpecVersion)
+	assert.NotEmpty(t, ev.ID)
+	assert.Equal(t, "/apis/px.dev/v1alpha1/namespaces/pl/viziers/pixie", ev.Source)
+	assert.Equal(t, "dev.px.vizier.degraded", ev.Type)
+	assert.Equal(t, "pixie", ev.Subject)
+	assert.Equal(t, &vizierChangeData{
+		Namespace: "pl",
+		Name:      "pixie",
+		Version:   "0.14.2",
+		Phase:     "Degraded",
+		Reason:    "PodsCrashLooping",
+		Message:   "Vizier pods are crashlooping.",
+	}, ev.Data)
+}
+
+func TestLifecycleEventPublisher_HTTP(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/cloudevents+json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var ev map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &ev))
+		received <- ev
+	}))
+	defer srv.Close()
+
+	p := NewLifecycleEventPublisher(eventSinkSettings(&v1alpha1.EventSink{HTTP: &v1alpha1.HTTPEventSink{URL: srv.URL}}))
+	ev := newVizierCloudEvent(cloudEventVizierUpgraded, cloudEventTestVizier())
+	ev.Data.PreviousVersion = "0.14.1"
+	require.NoError(t, p.publish(context.Background(), ev))
+
+	got := <-received
+	assert.Equal(t, "dev.px.vizier.upgraded", got["type"])
+	assert.Equal(t, "application/json", got["datacontenttype"])
+	data := got["data"].(map[string]interface{})
+	assert.Equal(t, "0.14.2", data["version"])
+	assert.Equal(t, "0.14.1", data["previousVersion"])
+}
+
+func TestLifecycleEventPublisher_HTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p := NewLifecycleEventPublisher(eventSinkSettings(&v1alpha1.EventSink{HTTP: &v1alpha1.HTTPEventSink{URL: srv.URL}}))
+	err := p.publish(context.Background(), newVizierCloudEvent(cloudEventVizierDeployed, cloudEventTestVizier()))
+	assert.ErrorContains(t, err, "503")
+}
+
+func TestLifecycleEventPublisher_NATS(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	sub, err := nc.SubscribeSync("platform.pixie")
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	p := NewLifecycleEventPublisher(eventSinkSettings(&v1alpha1.EventSink{
+		NATS: &v1alpha1.NATSEventSink{URL: nc.ConnectedUrl(), Subject: "platform.pixie"},
+	}))
+	require.NoError(t, p.publish(context.Background(), newVizierCloudEvent(cloudEventVizierDeleted, cloudEventTestVizier())))
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "application/cloudevents+json", msg.Header.Get("Content-Type"))
+	var ev cloudEvent
+	require.NoError(t, json.Unmarshal(msg.Data, &ev))
+	assert.Equal(t, "dev.px.vizier.deleted", ev.Type)
+	assert.Equal(t, "pixie", ev.Data.Name)
+}
+
+func TestLifecycleEventPublisher_NoSink(t *testing.T) {
+	p := NewLifecycleEventPublisher(NewOperatorSettings())
+	assert.NoError(t, p.publish(context.Background(), newVizierCloudEvent(cloudEventVizierDeployed, cloudEventTestVizier())))
+
+	// A nil publisher doesn't publish anything.
+	var nilPublisher *LifecycleEventPublisher
+	nilPublisher.emit(newVizierCloudEvent(cloudEventVizierDeployed, cloudEventTestVizier()))
+}
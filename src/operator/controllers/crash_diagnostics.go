@@ -0,0 +1,426 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+const (
+	crashDiagnosticsNamePrefix = "crash-"
+	crashDiagnosticsTimeFormat = "20060102-150405"
+	// crashDiagnosticsLabel is the label on the jobs that write bundles to the PVC, which holds the name of the bundle.
+	crashDiagnosticsLabel = "px.dev/crash-diagnostics"
+	crashDiagnosticsDir   = "/diagnostics"
+	crashDiagnosticsFile  = "bundle.tar.gz"
+	// How long the operator waits after capturing a bundle before it captures another, so that a long crash loop
+	// doesn't fill the PVC with the same evidence.
+	crashDiagnosticsCooldown         = 30 * time.Minute
+	defaultCrashDiagnosticsRetention = 5
+	defaultCrashDiagnosticsLogLines  = 500
+	crashDiagnosticsJobTTL           = int32(24 * 3600)
+	crashDiagnosticsJobDeadline      = int64(600)
+	crashDiagnosticsUploadTimeout    = 30 * time.Second
+	maxCrashDiagnosticsLogBytes      = int64(512 * 1024)
+	minCrashDiagnosticsLogBytes      = int64(4 * 1024)
+	// The largest bundle, which must fit in a ConfigMap and in a NATS message.
+	maxCrashDiagnosticsBundleSize = 768 * 1024
+)
+
+// crashDiagnosticsName returns the name of the bundle captured at the given time. Bundle names sort in the order
+// that the bundles were captured.
+func crashDiagnosticsName(t time.Time) string {
+	return crashDiagnosticsNamePrefix + t.UTC().Format(crashDiagnosticsTimeFormat)
+}
+
+func getCrashDiagnosticsRetention(spec *v1alpha1.CrashDiagnostics) int32 {
+	if spec.Retention <= 0 {
+		return defaultCrashDiagnosticsRetention
+	}
+	return spec.Retention
+}
+
+func getCrashDiagnosticsLogLines(spec *v1alpha1.CrashDiagnostics) int64 {
+	if spec.LogLines <= 0 {
+		return defaultCrashDiagnosticsLogLines
+	}
+	return spec.LogLines
+}
+
+// crashDiagnosticsDue returns whether a bundle should be captured for the crash loops.
+func crashDiagnosticsDue(vz *v1alpha1.Vizier, loops []crashLoop, now time.Time) bool {
+	if vz.Spec.CrashDiagnostics == nil || len(loops) == 0 {
+		return false
+	}
+	s := vz.Status.CrashDiagnostics
+	return s == nil || s.LastBundleTime == nil || now.Sub(s.LastBundleTime.Time) >= crashDiagnosticsCooldown
+}
+
+// containerLogs are the logs of a crashlooping container, from before and after its last restart.
+type containerLogs struct {
+	loop     crashLoop
+	current  []byte
+	previous []byte
+}
+
+// crashDiagnosticsCapturer captures diagnostic bundles of crashlooping pods, and stores or uploads them.
+type crashDiagnosticsCapturer struct {
+	clientset kubernetes.Interface
+	// upload publishes the bundle to the cloud connector, which forwards it to Pixie Cloud.
+	upload func(ctx context.Context, vz *v1alpha1.Vizier, bundle *cvmsgspb.CrashDiagnosticsBundle) error
+}
+
+func newCrashDiagnosticsCapturer(clientset kubernetes.Interface) *crashDiagnosticsCapturer {
+	c := &crashDiagnosticsCapturer{clientset: clientset}
+	c.upload = c.publishBundle
+	return c
+}
+
+// getLogs returns the tail of the logs of the container. A failure to get the logs is recorded in their place,
+// since the previous logs of a container are gone once it restarts twice.
+func (c *crashDiagnosticsCapturer) getLogs(ctx context.Context, namespace, pod, container string, previous bool, lines int64) []byte {
+	limit := maxCrashDiagnosticsLogBytes
+	logs, err := c.clientset.CoreV1().Pods(namespace).GetLogs(pod, &v1.PodLogOptions{
+		Container:  container,
+		Previous:   previous,
+		TailLines:  &lines,
+		LimitBytes: &limit,
+	}).DoRaw(ctx)
+	if err != nil {
+		return []byte(fmt.Sprintf("failed to get logs: %v\n", err))
+	}
+	return logs
+}
+
+// collect gets the resources, events and logs of the crashlooping pods, and builds the bundle from them.
+func (c *crashDiagnosticsCapturer) collect(ctx context.Context, vz *v1alpha1.Vizier, loops []crashLoop) ([]byte, error) {
+	lines := getCrashDiagnosticsLogLines(vz.Spec.CrashDiagnostics)
+	files := make(map[string][]byte)
+
+	vzStatus, err := json.MarshalIndent(vz.Status, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files["vizier-status.json"] = vzStatus
+
+	var logs []containerLogs
+	for _, l := range loops {
+		if _, ok := files[l.pod+"/pod.json"]; !ok {
+			pod, err := c.clientset.CoreV1().Pods(vz.Namespace).Get(ctx, l.pod, metav1.GetOptions{})
+			if err != nil {
+				files[l.pod+"/pod.json"] = []byte(fmt.Sprintf("failed to get pod: %v\n", err))
+			} else {
+				pod.ManagedFields = nil
+				if files[l.pod+"/pod.json"], err = json.MarshalIndent(pod, "", "  "); err != nil {
+					return nil, err
+				}
+			}
+
+			events, err := c.clientset.CoreV1().Events(vz.Namespace).List(ctx, metav1.ListOptions{
+				FieldSelector: "involvedObject.name=" + l.pod,
+			})
+			if err != nil {
+				files[l.pod+"/events.json"] = []byte(fmt.Sprintf("failed to list events: %v\n", err))
+			} else {
+				sort.Slice(events.Items, func(i, j int) bool {
+					return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+				})
+				if files[l.pod+"/events.json"], err = json.MarshalIndent(events.Items, "", "  "); err != nil {
+					return nil, err
+				}
+			}
+		}
+		logs = append(logs, containerLogs{
+			loop:     l,
+			current:  c.getLogs(ctx, vz.Namespace, l.pod, l.container, false, lines),
+			previous: c.getLogs(ctx, vz.Namespace, l.pod, l.container, true, lines),
+		})
+	}
+
+	// The logs are truncated to their most recent lines until the bundle is small enough to be stored and uploaded.
+	for limit := maxCrashDiagnosticsLogBytes; ; limit /= 4 {
+		for _, cl := range logs {
+			files[fmt.Sprintf("%s/%s.log", cl.loop.pod, cl.loop.container)] = tailBytes(cl.current, limit)
+			files[fmt.Sprintf("%s/%s.previous.log", cl.loop.pod, cl.loop.container)] = tailBytes(cl.previous, limit)
+		}
+		bundle, err := buildTarball(files)
+		if err != nil {
+			return nil, err
+		}
+		if len(bundle) <= maxCrashDiagnosticsBundleSize {
+			return bundle, nil
+		}
+		if limit <= minCrashDiagnosticsLogBytes {
+			return nil, fmt.Errorf("the bundle is %d bytes, more than the maximum of %d bytes", len(bundle), maxCrashDiagnosticsBundleSize)
+		}
+	}
+}
+
+// tailBytes returns the last limit bytes of b.
+func tailBytes(b []byte, limit int64) []byte {
+	if int64(len(b)) <= limit {
+		return b
+	}
+	return b[int64(len(b))-limit:]
+}
+
+// buildTarball returns a gzipped tarball of the files, in the order of their names.
+func buildTarball(files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name]))})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// crashDiagnosticsJob returns the job that writes the bundle with the given name from its ConfigMap to the PVC,
+// and deletes the oldest bundles beyond the retention.
+func crashDiagnosticsJob(vz *v1alpha1.Vizier, name string) *batchv1.Job {
+	spec := vz.Spec.CrashDiagnostics
+	store := v1.Container{
+		Name:  "store",
+		Image: registryImage(vz, backupToolsImage),
+		Command: []string{"sh", "-c", fmt.Sprintf(`set -e; cp /bundle/%s %s/%s.tar.gz; cd %s; `+
+			`ls -1 %s* | sort -r | tail -n +%d | xargs -r rm -f`, crashDiagnosticsFile, crashDiagnosticsDir, name,
+			crashDiagnosticsDir, crashDiagnosticsNamePrefix, getCrashDiagnosticsRetention(spec)+1)},
+		VolumeMounts: []v1.VolumeMount{
+			{Name: "bundle", MountPath: "/bundle", ReadOnly: true},
+			{Name: "diagnostics", MountPath: crashDiagnosticsDir},
+		},
+	}
+	podSpec := v1.PodSpec{
+		RestartPolicy: v1.RestartPolicyNever,
+		Containers:    []v1.Container{store},
+		Volumes: []v1.Volume{
+			{Name: "bundle", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: "vizier-" + name},
+			}}},
+			{Name: "diagnostics", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+				ClaimName: spec.PVC,
+			}}},
+		},
+		ImagePullSecrets: registryPullSecrets(vz),
+	}
+	if vz.Spec.Pod != nil {
+		podSpec.Tolerations = append(podSpec.Tolerations, vz.Spec.Pod.Tolerations...)
+		if sc := vz.Spec.Pod.SecurityContext; sc != nil && sc.Enabled {
+			podSpec.SecurityContext = &v1.PodSecurityContext{}
+			if sc.FSGroup != 0 {
+				podSpec.SecurityContext.FSGroup = &sc.FSGroup
+			}
+			if sc.RunAsUser != 0 {
+				podSpec.SecurityContext.RunAsUser = &sc.RunAsUser
+			}
+			if sc.RunAsGroup != 0 {
+				podSpec.SecurityContext.RunAsGroup = &sc.RunAsGroup
+			}
+		}
+	}
+
+	backoffLimit := int32(2)
+	deadline := crashDiagnosticsJobDeadline
+	ttl := crashDiagnosticsJobTTL
+	labels := map[string]string{crashDiagnosticsLabel: name}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vizier-" + name,
+			Namespace: vz.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   &deadline,
+			TTLSecondsAfterFinished: &ttl,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
+
+// store starts the job that writes the bundle to the PVC. The bundle is passed to the job in a ConfigMap that is
+// owned by the job, so that both are deleted once the job expires.
+func (c *crashDiagnosticsCapturer) store(ctx context.Context, vz *v1alpha1.Vizier, name string, bundle []byte) (string, error) {
+	job, err := c.clientset.BatchV1().Jobs(vz.Namespace).Create(ctx, crashDiagnosticsJob(vz, name), metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: vz.Namespace,
+			Labels:    map[string]string{crashDiagnosticsLabel: name},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "batch/v1",
+				Kind:       "Job",
+				Name:       job.Name,
+				UID:        job.UID,
+			}},
+		},
+		BinaryData: map[string][]byte{crashDiagnosticsFile: bundle},
+	}
+	if _, err := c.clientset.CoreV1().ConfigMaps(vz.Namespace).Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+		return "", err
+	}
+	return job.Name, nil
+}
+
+// publishBundle publishes the bundle on the Vizier's NATS, from which the cloud connector forwards it to Pixie Cloud.
+func (c *crashDiagnosticsCapturer) publishBundle(ctx context.Context, vz *v1alpha1.Vizier, bundle *cvmsgspb.CrashDiagnosticsBundle) error {
+	anyMsg, err := types.MarshalAny(bundle)
+	if err != nil {
+		return err
+	}
+	b, err := (&cvmsgspb.V2CMessage{Msg: anyMsg}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	nc, err := connectVizierNATS(ctx, c.clientset, vz.Namespace, vz)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+	if err := nc.Publish(messagebus.V2CTopic(messagebus.CrashDiagnosticsTopic), b); err != nil {
+		return err
+	}
+	return nc.FlushTimeout(crashDiagnosticsUploadTimeout)
+}
+
+// capture captures a bundle of the crash loops, stores and uploads it as configured, and records it in the status
+// and the DiagnosticsCaptured condition of the Vizier.
+func (c *crashDiagnosticsCapturer) capture(ctx context.Context, vz *v1alpha1.Vizier, state *vizierState, now time.Time) error {
+	spec := vz.Spec.CrashDiagnostics
+	name := crashDiagnosticsName(now)
+	bundle, err := c.collect(ctx, vz, state.crashLoops)
+	if err != nil {
+		return err
+	}
+
+	var containers []string
+	for _, l := range state.crashLoops {
+		containers = append(containers, l.pod+"/"+l.container)
+	}
+	s := &v1alpha1.CrashDiagnosticsStatus{
+		LastBundle:     name,
+		LastBundleTime: &metav1.Time{Time: now},
+		Reason:         string(state.Reason),
+		Containers:     containers,
+	}
+	vz.Status.CrashDiagnostics = s
+
+	var stored []string
+	var failures []string
+	if spec.PVC != "" {
+		job, err := c.store(ctx, vz, name, bundle)
+		if err != nil {
+			log.WithError(err).Error("Failed to store the crash diagnostics bundle")
+			failures = append(failures, fmt.Sprintf("failed to write to PVC %s: %v", spec.PVC, err))
+		} else {
+			s.StoredJob = job
+			stored = append(stored, "written to PVC "+spec.PVC)
+		}
+	}
+	if spec.UploadToCloud {
+		capturedAt, _ := types.TimestampProto(now)
+		err := c.upload(ctx, vz, &cvmsgspb.CrashDiagnosticsBundle{
+			Name:       name,
+			Reason:     string(state.Reason),
+			CapturedAt: capturedAt,
+			Containers: containers,
+			Bundle:     bundle,
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed to upload the crash diagnostics bundle")
+			failures = append(failures, fmt.Sprintf("failed to upload to Pixie Cloud: %v", err))
+		} else {
+			s.Uploaded = true
+			stored = append(stored, "uploaded to Pixie Cloud")
+		}
+	}
+	s.Message = strings.Join(failures, "; ")
+
+	msg := fmt.Sprintf("Captured diagnostic bundle %s of %d crashlooping containers", name, len(containers))
+	if len(stored) > 0 {
+		msg += ", " + strings.Join(stored, " and ")
+	}
+	msg += "."
+	if s.Message != "" {
+		msg += " The bundle " + s.Message + "."
+	}
+	vz.SetCondition(v1alpha1.VizierConditionDiagnosticsCaptured, metav1.ConditionTrue, string(state.Reason), msg)
+	return nil
+}
+
+// captureCrashDiagnostics captures a diagnostic bundle of the crashlooping pods of the Vizier, if one is due.
+func (m *VizierMonitor) captureCrashDiagnostics(vz *v1alpha1.Vizier, state *vizierState) {
+	now := time.Now()
+	if !crashDiagnosticsDue(vz, state.crashLoops, now) {
+		return
+	}
+	err := newCrashDiagnosticsCapturer(m.clientset).capture(m.ctx, vz, state, now)
+	if err != nil {
+		log.WithError(err).Error("Failed to capture crash diagnostics")
+		return
+	}
+	log.WithField("bundle", vz.Status.CrashDiagnostics.LastBundle).Info("Captured crash diagnostics")
+	if m.recorder != nil {
+		m.recorder.Eventf(vz, v1.EventTypeWarning, "CrashDiagnostics", "Captured diagnostic bundle %s for %s",
+			vz.Status.CrashDiagnostics.LastBundle, state.Reason)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/status"
+)
+
+// readTarball returns the files in the gzipped tarball.
+func readTarball(t *testing.T, b []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[h.Name] = string(contents)
+	}
+	return files
+}
+
+func TestCrashDiagnosticsDue(t *testing.T) {
+	now := time.Date(2023, 10, 4, 12, 0, 0, 0, time.UTC)
+	loops := []crashLoop{{pod: "vizier-pem-abc", container: "pem", cause: crashCauseOOMKilled, restartCount: 5}}
+	tests := []struct {
+		name     string
+		spec     *v1alpha1.CrashDiagnostics
+		status   *v1alpha1.CrashDiagnosticsStatus
+		loops    []crashLoop
+		expected bool
+	}{
+		{
+			name:  "not configured",
+			loops: loops,
+		},
+		{
+			name: "no crash loops",
+			spec: &v1alpha1.CrashDiagnostics{UploadToCloud: true},
+		},
+		{
+			name:     "first bundle",
+			spec:     &v1alpha1.CrashDiagnostics{UploadToCloud: true},
+			loops:    loops,
+			expected: true,
+		},
+		{
+			name:   "recent bundle",
+			spec:   &v1alpha1.CrashDiagnostics{UploadToCloud: true},
+			status: &v1alpha1.CrashDiagnosticsStatus{LastBundleTime: &metav1.Time{Time: now.Add(-time.Minute)}},
+			loops:  loops,
+		},
+		{
+			name:     "old bundle",
+			spec:     &v1alpha1.CrashDiagnostics{UploadToCloud: true},
+			status:   &v1alpha1.CrashDiagnosticsStatus{LastBundleTime: &metav1.Time{Time: now.Add(-time.Hour)}},
+			loops:    loops,
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vz := &v1alpha1.Vizier{
+				Spec:   v1alpha1.VizierSpec{CrashDiagnostics: test.spec},
+				Status: v1alpha1.VizierStatus{CrashDiagnostics: test.status},
+			}
+			assert.Equal(t, test.expected, crashDiagnosticsDue(vz, test.loops, now))
+		})
+	}
+}
+
+func TestCrashDiagnosticsCapturer_Capture(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 10, 4, 12, 0, 0, 0, time.UTC)
+	clientset := fake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "vizier-pem-abc", Namespace: "pl"}},
+		&v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "vizier-pem-abc.1", Namespace: "pl"},
+			InvolvedObject: v1.ObjectReference{Name: "vizier-pem-abc"},
+			Reason:         "BackOff",
+		},
+	)
+	var uploaded *cvmsgspb.CrashDiagnosticsBundle
+	c := newCrashDiagnosticsCapturer(clientset)
+	c.upload = func(ctx context.Context, vz *v1alpha1.Vizier, bundle *cvmsgspb.CrashDiagnosticsBundle) error {
+		uploaded = bundle
+		return nil
+	}
+
+	vz := &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec: v1alpha1.VizierSpec{
+			CrashDiagnostics: &v1alpha1.CrashDiagnostics{PVC: "diagnostics", Retention: 3, UploadToCloud: true},
+		},
+	}
+	state := getCrashLoopState([]crashLoop{
+		{nameLabel: vizierPemLabel, pod: "vizier-pem-abc", container: "pem", cause: crashCauseOOMKilled, restartCount: 5},
+	})
+	require.NoError(t, c.capture(ctx, vz, state, now))
+
+	s := vz.Status.CrashDiagnostics
+	require.NotNil(t, s)
+	assert.Equal(t, "crash-20231004-120000", s.LastBundle)
+	assert.Equal(t, string(status.PodsOOMKilled), s.Reason)
+	assert.Equal(t, []string{"vizier-pem-abc/pem"}, s.Containers)
+	assert.Equal(t, "vizier-crash-20231004-120000", s.StoredJob)
+	assert.True(t, s.Uploaded)
+	assert.Empty(t, s.Message)
+
+	cond := meta.FindStatusCondition(vz.Status.Conditions, v1alpha1.VizierConditionDiagnosticsCaptured)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, string(status.PodsOOMKilled), cond.Reason)
+	assert.Contains(t, cond.Message, "written to PVC diagnostics and uploaded to Pixie Cloud")
+
+	job, err := clientset.BatchV1().Jobs("pl").Get(ctx, "vizier-crash-20231004-120000", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "crash-20231004-120000", job.Labels[crashDiagnosticsLabel])
+	assert.Equal(t, "diagnostics", job.Spec.Template.Spec.Volumes[1].PersistentVolumeClaim.ClaimName)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2], "tail -n +4")
+
+	cm, err := clientset.CoreV1().ConfigMaps("pl").Get(ctx, "vizier-crash-20231004-120000", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, cm.OwnerReferences, 1)
+	assert.Equal(t, "Job", cm.OwnerReferences[0].Kind)
+
+	require.NotNil(t, uploaded)
+	assert.Equal(t, cm.BinaryData[crashDiagnosticsFile], uploaded.Bundle)
+	assert.Equal(t, []string{"vizier-pem-abc/pem"}, uploaded.Containers)
+
+	files := readTarball(t, uploaded.Bundle)
+	assert.Contains(t, files, "vizier-status.json")
+	assert.Contains(t, files["vizier-pem-abc/pod.json"], `"name": "vizier-pem-abc"`)
+	assert.Contains(t, files["vizier-pem-abc/events.json"], "BackOff")
+	assert.Contains(t, files, "vizier-pem-abc/pem.log")
+	assert.Contains(t, files, "vizier-pem-abc/pem.previous.log")
+}
+
+func TestCrashDiagnosticsCapturer_CaptureUploadFailure(t *testing.T) {
+	c := newCrashDiagnosticsCapturer(fake.NewSimpleClientset())
+	c.upload = func(ctx context.Context, vz *v1alpha1.Vizier, bundle *cvmsgspb.CrashDiagnosticsBundle) error {
+		return errors.New("no cloud connection")
+	}
+
+	vz := &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec:       v1alpha1.VizierSpec{CrashDiagnostics: &v1alpha1.CrashDiagnostics{UploadToCloud: true}},
+	}
+	state := getCrashLoopState([]crashLoop{
+		{nameLabel: "vizier-query-broker", pod: "vizier-query-broker-abc", container: "app", cause: crashCauseUnknown, restartCount: 4},
+	})
+	require.NoError(t, c.capture(context.Background(), vz, state, time.Now()))
+
+	s := vz.Status.CrashDiagnostics
+	require.NotNil(t, s)
+	assert.False(t, s.Uploaded)
+	assert.Empty(t, s.StoredJob)
+	assert.Contains(t, s.Message, "no cloud connection")
+
+	cond := meta.FindStatusCondition(vz.Status.Conditions, v1alpha1.VizierConditionDiagnosticsCaptured)
+	require.NotNil(t, cond)
+	assert.True(t, strings.HasSuffix(cond.Message, "failed to upload to Pixie Cloud: no cloud connection."))
+}
+
+func TestTailBytes(t *testing.T) {
+	assert.Equal(t, []byte("abc"), tailBytes([]byte("abc"), 4))
+	assert.Equal(t, []byte("bc"), tailBytes([]byte("abc"), 2))
+}
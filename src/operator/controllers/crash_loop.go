@@ -0,0 +1,273 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/status"
+)
+
+const (
+	// The number of restarts after which a crashing container is considered to be crashlooping.
+	crashLoopRestartThreshold = 3
+	// The maximum number of crashlooping containers that are listed in the Degraded condition.
+	maxCrashLoopsInCondition = 5
+	// How long the operator waits after remediating crash loops before it remediates them again, so that the
+	// pods have time to restart with the remediation.
+	crashRemediationCooldown = 15 * time.Minute
+	// crashRemediatedAtAnnotation is the Vizier annotation that records when the last remediation was applied.
+	crashRemediatedAtAnnotation = "px.dev/crash-remediated-at"
+
+	defaultPEMMemoryLimit = "2Gi"
+	defaultMaxPEMMemory   = "4Gi"
+
+	stirlingSourcesPEMFlag = "PL_STIRLING_SOURCES"
+	// The Stirling sources that don't need kernel headers.
+	stirlingSourcesWithoutKernelHeaders = "kMetrics"
+)
+
+// kernelHeadersMissingRe matches the errors that the PEM logs before exiting when it can't find the Linux headers
+// of its node.
+var kernelHeadersMissingRe = regexp.MustCompile(`(?i)could not find any linux headers|did not find (the )?host headers`)
+
+// crashCause is the diagnosed cause of a crash loop.
+type crashCause string
+
+const (
+	crashCauseOOMKilled            crashCause = "OOMKilled"
+	crashCauseKernelHeadersMissing crashCause = "KernelHeadersMissing"
+	crashCauseUnknown              crashCause = "Unknown"
+)
+
+// crashLoop is a crashlooping container of a Vizier pod.
+type crashLoop struct {
+	nameLabel    string
+	pod          string
+	container    string
+	cause        crashCause
+	restartCount int32
+}
+
+func (c crashLoop) String() string {
+	return fmt.Sprintf("%s/%s (%s, %d restarts)", c.pod, c.container, c.cause, c.restartCount)
+}
+
+// diagnoseContainer returns the cause of the container's crashes, or false if it isn't crashlooping.
+func diagnoseContainer(c v1.ContainerStatus) (crashCause, bool) {
+	if c.RestartCount < crashLoopRestartThreshold {
+		return "", false
+	}
+	crashing := c.State.Terminated != nil || (c.State.Waiting != nil && c.State.Waiting.Reason == "CrashLoopBackOff")
+	if !crashing {
+		return "", false
+	}
+
+	terminated := c.State.Terminated
+	if terminated == nil {
+		terminated = c.LastTerminationState.Terminated
+	}
+	switch {
+	case terminated == nil:
+		return crashCauseUnknown, true
+	case terminated.Reason == "OOMKilled":
+		return crashCauseOOMKilled, true
+	case kernelHeadersMissingRe.MatchString(terminated.Message):
+		return crashCauseKernelHeadersMissing, true
+	default:
+		return crashCauseUnknown, true
+	}
+}
+
+// getCrashLoops returns the crashlooping containers of all Vizier pods, sorted by pod and container name.
+func getCrashLoops(pods *concurrentPodMap) []crashLoop {
+	pods.mapMu.Lock()
+	defer pods.mapMu.Unlock()
+
+	var loops []crashLoop
+	for nameLabel, labelPods := range pods.unsafeMap {
+		for _, p := range labelPods {
+			for _, c := range p.pod.Status.ContainerStatuses {
+				cause, ok := diagnoseContainer(c)
+				if !ok {
+					continue
+				}
+				loops = append(loops, crashLoop{
+					nameLabel:    nameLabel,
+					pod:          p.pod.Name,
+					container:    c.Name,
+					cause:        cause,
+					restartCount: c.RestartCount,
+				})
+			}
+		}
+	}
+	sort.Slice(loops, func(i, j int) bool {
+		if loops[i].pod != loops[j].pod {
+			return loops[i].pod < loops[j].pod
+		}
+		return loops[i].container < loops[j].container
+	})
+	return loops
+}
+
+// getCrashLoopState returns the state of the Vizier given its crashlooping containers. The most actionable
+// diagnosis is reported: OOMKills first, then missing kernel headers.
+func getCrashLoopState(loops []crashLoop) *vizierState {
+	if len(loops) == 0 {
+		return okState()
+	}
+	reason := status.PodsCrashLooping
+	for _, l := range loops {
+		if l.cause == crashCauseOOMKilled {
+			reason = status.PodsOOMKilled
+			break
+		}
+		if l.cause == crashCauseKernelHeadersMissing {
+			reason = status.KernelHeadersMissing
+		}
+	}
+	return &vizierState{Reason: reason, Detail: crashLoopDetail(loops), crashLoops: loops}
+}
+
+// crashLoopDetail describes the crashlooping containers for the Degraded condition.
+func crashLoopDetail(loops []crashLoop) string {
+	var descs []string
+	for i, l := range loops {
+		if i == maxCrashLoopsInCondition {
+			descs = append(descs, fmt.Sprintf("and %d more", len(loops)-maxCrashLoopsInCondition))
+			break
+		}
+		descs = append(descs, l.String())
+	}
+	return "Crashlooping containers: " + strings.Join(descs, ", ") + "."
+}
+
+// hasPEMCrashLoop returns whether a PEM is crashlooping with the given cause.
+func hasPEMCrashLoop(loops []crashLoop, cause crashCause) bool {
+	for _, l := range loops {
+		if l.nameLabel == vizierPemLabel && l.cause == cause {
+			return true
+		}
+	}
+	return false
+}
+
+// applyCrashRemediation updates the spec of the Vizier to remediate the crash loops, as allowed by its
+// crashRemediation. It returns a description of the changes, or "" if nothing was changed.
+func applyCrashRemediation(vz *v1alpha1.Vizier, loops []crashLoop) (string, error) {
+	cr := vz.Spec.CrashRemediation
+	if cr == nil {
+		return "", nil
+	}
+
+	var changes []string
+	autoscaled := vz.Spec.PEMAutoscaling != nil && vz.Spec.PEMAutoscaling.Enabled
+	if cr.IncreasePEMMemory && !autoscaled && hasPEMCrashLoop(loops, crashCauseOOMKilled) {
+		current := vz.Spec.PemMemoryLimit
+		if current == "" {
+			current = defaultPEMMemoryLimit
+		}
+		currentQ, err := resource.ParseQuantity(current)
+		if err != nil {
+			return "", fmt.Errorf("invalid pemMemoryLimit %q: %w", current, err)
+		}
+		maxMemory := cr.MaxPEMMemory
+		if maxMemory == "" {
+			maxMemory = defaultMaxPEMMemory
+		}
+		maxQ, err := resource.ParseQuantity(maxMemory)
+		if err != nil {
+			return "", fmt.Errorf("invalid crashRemediation maxPEMMemory %q: %w", maxMemory, err)
+		}
+
+		if currentQ.Cmp(maxQ) < 0 {
+			increased := currentQ.Value() + currentQ.Value()/2
+			if increased > maxQ.Value() {
+				increased = maxQ.Value()
+			}
+			// Round up to a whole Mi, so that the limit stays readable.
+			limit := fmt.Sprintf("%dMi", (increased+(1<<20)-1)/(1<<20))
+			vz.Spec.PemMemoryLimit = limit
+			changes = append(changes, fmt.Sprintf("increased pemMemoryLimit from %s to %s", current, limit))
+		} else {
+			log.WithField("pemMemoryLimit", current).Info("PEMs are OOMKilled, but their memory limit is already at the crash remediation maximum")
+		}
+	}
+
+	if cr.DisableTracingWithoutKernelHeaders && hasPEMCrashLoop(loops, crashCauseKernelHeadersMissing) {
+		if vz.Spec.DataCollectorParams == nil {
+			vz.Spec.DataCollectorParams = &v1alpha1.DataCollectorParams{}
+		}
+		if vz.Spec.DataCollectorParams.CustomPEMFlags == nil {
+			vz.Spec.DataCollectorParams.CustomPEMFlags = make(map[string]string)
+		}
+		if vz.Spec.DataCollectorParams.CustomPEMFlags[stirlingSourcesPEMFlag] != stirlingSourcesWithoutKernelHeaders {
+			vz.Spec.DataCollectorParams.CustomPEMFlags[stirlingSourcesPEMFlag] = stirlingSourcesWithoutKernelHeaders
+			changes = append(changes, fmt.Sprintf("set the %s PEM flag to %s to disable tracing", stirlingSourcesPEMFlag, stirlingSourcesWithoutKernelHeaders))
+		}
+	}
+
+	return strings.Join(changes, " and "), nil
+}
+
+// remediateCrashLoops applies the enabled crash remediations to the Vizier, unless it was remediated recently.
+func (m *VizierMonitor) remediateCrashLoops(state *vizierState) error {
+	vz := &v1alpha1.Vizier{}
+	err := m.vzGet(m.ctx, m.namespacedName, vz)
+	if err != nil {
+		return err
+	}
+	if vz.Spec.CrashRemediation == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if last, err := time.Parse(time.RFC3339, vz.Annotations[crashRemediatedAtAnnotation]); err == nil && now.Sub(last) < crashRemediationCooldown {
+		return nil
+	}
+
+	changes, err := applyCrashRemediation(vz, state.crashLoops)
+	if err != nil || changes == "" {
+		return err
+	}
+	if vz.Annotations == nil {
+		vz.Annotations = make(map[string]string)
+	}
+	vz.Annotations[crashRemediatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	if err := m.vzSpecUpdate(context.Background(), vz); err != nil {
+		return err
+	}
+
+	log.WithField("reason", state.Reason).Infof("Remediated crashlooping pods: %s", changes)
+	if m.recorder != nil {
+		m.recorder.Eventf(vz, v1.EventTypeNormal, "CrashRemediation", "Remediated %s: %s", state.Reason, changes)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/status"
+)
+
+func crashingContainer(name string, restarts int32, reason, message string) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name:         name,
+		RestartCount: restarts,
+		State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		LastTerminationState: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{Reason: reason, Message: message},
+		},
+	}
+}
+
+func TestDiagnoseContainer(t *testing.T) {
+	tests := []struct {
+		name          string
+		container     v1.ContainerStatus
+		expectedCause crashCause
+		crashLooping  bool
+	}{
+		{
+			name:          "OOMKilled",
+			container:     crashingContainer("pem", 5, "OOMKilled", ""),
+			expectedCause: crashCauseOOMKilled,
+			crashLooping:  true,
+		},
+		{
+			name: "kernel headers missing",
+			container: crashingContainer("pem", 5, "Error",
+				"F20231004 linux_headers.cc:418] Could not find any linux headers to use."),
+			expectedCause: crashCauseKernelHeadersMissing,
+			crashLooping:  true,
+		},
+		{
+			name:          "unknown error",
+			container:     crashingContainer("pem", 5, "Error", "segfault"),
+			expectedCause: crashCauseUnknown,
+			crashLooping:  true,
+		},
+		{
+			name:      "too few restarts",
+			container: crashingContainer("pem", 1, "OOMKilled", ""),
+		},
+		{
+			name: "running after an old crash",
+			container: v1.ContainerStatus{
+				Name:         "pem",
+				RestartCount: 5,
+				State:        v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				LastTerminationState: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cause, ok := diagnoseContainer(tc.container)
+			assert.Equal(t, tc.crashLooping, ok)
+			assert.Equal(t, tc.expectedCause, cause)
+		})
+	}
+}
+
+func TestGetCrashLoopState(t *testing.T) {
+	pods := &concurrentPodMap{unsafeMap: map[string]map[string]*podWrapper{}}
+	addPod := func(nameLabel, name string, c v1.ContainerStatus) {
+		pods.write(nameLabel, name, &podWrapper{pod: &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: []v1.ContainerStatus{c}},
+		}})
+	}
+
+	assert.True(t, isOk(getCrashLoopState(getCrashLoops(pods))))
+
+	addPod(vizierPemLabel, "vizier-pem-b", crashingContainer("pem", 4, "Error", "Could not find any linux headers to use."))
+	state := getCrashLoopState(getCrashLoops(pods))
+	assert.Equal(t, status.KernelHeadersMissing, state.Reason)
+
+	addPod(vizierPemLabel, "vizier-pem-a", crashingContainer("pem", 3, "OOMKilled", ""))
+	addPod("kelvin", "kelvin-a", crashingContainer("app", 7, "Error", ""))
+	state = getCrashLoopState(getCrashLoops(pods))
+	assert.Equal(t, status.PodsOOMKilled, state.Reason)
+	assert.Equal(t, "Crashlooping containers: kelvin-a/app (Unknown, 7 restarts), vizier-pem-a/pem (OOMKilled, 3 restarts), "+
+		"vizier-pem-b/pem (KernelHeadersMissing, 4 restarts).", state.Detail)
+	assert.Len(t, state.crashLoops, 3)
+	assert.Equal(t, v1alpha1.VizierPhaseDegraded, v1alpha1.ReasonToPhase(state.Reason))
+}
+
+func TestApplyCrashRemediation(t *testing.T) {
+	oomLoops := []crashLoop{{nameLabel: vizierPemLabel, pod: "vizier-pem-a", container: "pem", cause: crashCauseOOMKilled}}
+	headersLoops := []crashLoop{{nameLabel: vizierPemLabel, pod: "vizier-pem-a", container: "pem", cause: crashCauseKernelHeadersMissing}}
+
+	tests := []struct {
+		name            string
+		spec            v1alpha1.VizierSpec
+		loops           []crashLoop
+		expectedChanged bool
+		expectedLimit   string
+		expectedFlags   map[string]string
+	}{
+		{
+			name:  "remediation disabled",
+			spec:  v1alpha1.VizierSpec{},
+			loops: oomLoops,
+		},
+		{
+			name:            "increase default memory",
+			spec:            v1alpha1.VizierSpec{CrashRemediation: &v1alpha1.CrashRemediation{IncreasePEMMemory: true}},
+			loops:           oomLoops,
+			expectedChanged: true,
+			expectedLimit:   "3072Mi",
+		},
+		{
+			name: "increase memory up to the maximum",
+			spec: v1alpha1.VizierSpec{
+				PemMemoryLimit:   "3Gi",
+				CrashRemediation: &v1alpha1.CrashRemediation{IncreasePEMMemory: true},
+			},
+			loops:           oomLoops,
+			expectedChanged: true,
+			expectedLimit:   "4096Mi",
+		},
+		{
+			name: "memory already at the maximum",
+			spec: v1alpha1.VizierSpec{
+				PemMemoryLimit:   "4Gi",
+				CrashRemediation: &v1alpha1.CrashRemediation{IncreasePEMMemory: true},
+			},
+			loops:         oomLoops,
+			expectedLimit: "4Gi",
+		},
+		{
+			name: "autoscaled PEMs",
+			spec: v1alpha1.VizierSpec{
+				PEMAutoscaling:   &v1alpha1.PEMAutoscaling{Enabled: true},
+				CrashRemediation: &v1alpha1.CrashRemediation{IncreasePEMMemory: true},
+			},
+			loops: oomLoops,
+		},
+		{
+			name:            "disable tracing",
+			spec:            v1alpha1.VizierSpec{CrashRemediation: &v1alpha1.CrashRemediation{DisableTracingWithoutKernelHeaders: true}},
+			loops:           headersLoops,
+			expectedChanged: true,
+			expectedFlags:   map[string]string{stirlingSourcesPEMFlag: stirlingSourcesWithoutKernelHeaders},
+		},
+		{
+			name: "tracing already disabled",
+			spec: v1alpha1.VizierSpec{
+				DataCollectorParams: &v1alpha1.DataCollectorParams{
+					CustomPEMFlags: map[string]string{stirlingSourcesPEMFlag: stirlingSourcesWithoutKernelHeaders},
+				},
+				CrashRemediation: &v1alpha1.CrashRemediation{DisableTracingWithoutKernelHeaders: true},
+			},
+			loops:         headersLoops,
+			expectedFlags: map[string]string{stirlingSourcesPEMFlag: stirlingSourcesWithoutKernelHeaders},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vz := &v1alpha1.Vizier{Spec: tc.spec}
+			changes, err := applyCrashRemediation(vz, tc.loops)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedChanged, changes != "")
+			assert.Equal(t, tc.expectedLimit, vz.Spec.PemMemoryLimit)
+			if tc.expectedFlags != nil {
+				assert.Equal(t, tc.expectedFlags, vz.Spec.DataCollectorParams.CustomPEMFlags)
+			}
+		})
+	}
+}
+
+func TestMonitor_remediateCrashLoops(t *testing.T) {
+	state := getCrashLoopState([]crashLoop{{nameLabel: vizierPemLabel, pod: "vizier-pem-a", container: "pem", cause: crashCauseOOMKilled}})
+
+	tests := []struct {
+		name              string
+		remediatedAt      string
+		expectedUpdate    bool
+		expectedPEMMemory string
+	}{
+		{
+			name:              "not remediated before",
+			expectedUpdate:    true,
+			expectedPEMMemory: "3072Mi",
+		},
+		{
+			name:              "remediated long ago",
+			remediatedAt:      time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+			expectedUpdate:    true,
+			expectedPEMMemory: "3072Mi",
+		},
+		{
+			name:         "remediated recently",
+			remediatedAt: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var updated *v1alpha1.Vizier
+			get := func(ctx context.Context, namespacedName k8stypes.NamespacedName, obj client.Object, opts ...client.GetOption) error {
+				vz := obj.(*v1alpha1.Vizier)
+				vz.Spec.CrashRemediation = &v1alpha1.CrashRemediation{IncreasePEMMemory: true}
+				if tc.remediatedAt != "" {
+					vz.Annotations = map[string]string{crashRemediatedAtAnnotation: tc.remediatedAt}
+				}
+				return nil
+			}
+			update := func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+				updated = obj.(*v1alpha1.Vizier)
+				return nil
+			}
+			recorder := record.NewFakeRecorder(1)
+			monitor := &VizierMonitor{ctx: context.Background(), vzGet: get, vzSpecUpdate: update, recorder: recorder}
+
+			require.NoError(t, monitor.repairVizier(state))
+			if !tc.expectedUpdate {
+				assert.Nil(t, updated)
+				return
+			}
+			require.NotNil(t, updated)
+			assert.Equal(t, tc.expectedPEMMemory, updated.Spec.PemMemoryLimit)
+			assert.NotEmpty(t, updated.Annotations[crashRemediatedAtAnnotation])
+			assert.Equal(t, "Normal CrashRemediation Remediated PodsOOMKilled: increased pemMemoryLimit from 2Gi to 3072Mi", <-recorder.Events)
+		})
+	}
+}
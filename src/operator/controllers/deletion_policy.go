@@ -0,0 +1,223 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+const (
+	// vizierFinalizer keeps the Vizier around until the operator has deleted its resources according to the
+	// deletion policy.
+	vizierFinalizer = "px.dev/vizier-cleanup"
+	// retainedFromAnnotation is set on the resources that the deletion policy keeps, to the name of the Vizier
+	// that they were kept from.
+	retainedFromAnnotation = "px.dev/retained-from"
+)
+
+// natsResources are the resources of the NATS servers that are kept when NATS is orphaned. The JetStream volumes
+// are created by the StatefulSet and don't carry the operator's label, so they are kept regardless.
+var natsResources = []struct {
+	kind string
+	name string
+}{
+	{"ConfigMap", "nats-config"},
+	{"Service", natsStatefulSetName},
+	{"Service", natsStatefulSetName + "-mgmt"},
+	{"StatefulSet", natsStatefulSetName},
+	{"PodDisruptionBudget", natsPDBName},
+}
+
+// pvcRetention returns whether the PVCs of the Vizier are kept when it is deleted.
+func pvcRetention(vz *v1alpha1.Vizier) v1alpha1.RetentionPolicy {
+	if vz.Spec.DeletionPolicy == nil || vz.Spec.DeletionPolicy.PersistentVolumeClaims == "" {
+		return v1alpha1.RetentionPolicyDelete
+	}
+	return vz.Spec.DeletionPolicy.PersistentVolumeClaims
+}
+
+// metadataStoreRetention returns whether the PVC of the metadata store is kept when the Vizier is deleted.
+func metadataStoreRetention(vz *v1alpha1.Vizier) v1alpha1.RetentionPolicy {
+	if vz.Spec.DeletionPolicy == nil || vz.Spec.DeletionPolicy.MetadataStore == "" {
+		return pvcRetention(vz)
+	}
+	return vz.Spec.DeletionPolicy.MetadataStore
+}
+
+// natsDeletionPolicy returns what happens to NATS when the Vizier is deleted.
+func natsDeletionPolicy(vz *v1alpha1.Vizier) v1alpha1.NATSDeletionPolicy {
+	if vz.Spec.DeletionPolicy == nil || vz.Spec.DeletionPolicy.NATS == "" {
+		return v1alpha1.NATSDeletionPolicyDelete
+	}
+	return vz.Spec.DeletionPolicy.NATS
+}
+
+// finalizeVizier deletes the resources of a Vizier that is being deleted according to its deletion policy, and then
+// releases the Vizier by removing the finalizer. The progress is reported in the status.
+func (r *VizierReconciler) finalizeVizier(ctx context.Context, req ctrl.Request, vz *v1alpha1.Vizier) error {
+	if !controllerutil.ContainsFinalizer(vz, vizierFinalizer) {
+		return nil
+	}
+	log.WithField("req", req).Info("Finalizing Vizier...")
+
+	r.setDeletionStatus(ctx, vz, v1alpha1.DeletionPhaseRetaining, "Releasing the resources kept by the deletion policy.", nil)
+	retained, err := retainResources(ctx, r.Clientset, req.Namespace, vz)
+	if err != nil {
+		r.setDeletionStatus(ctx, vz, v1alpha1.DeletionPhaseFailed, fmt.Sprintf("Failed to release the kept resources: %v", err), nil)
+		return err
+	}
+
+	r.setDeletionStatus(ctx, vz, v1alpha1.DeletionPhaseDeleting, "Deleting the Vizier resources.", retained)
+	err = r.deleteVizier(ctx, req)
+	if err == nil && natsDeletionPolicy(vz) == v1alpha1.NATSDeletionPolicyDelete && pvcRetention(vz) == v1alpha1.RetentionPolicyDelete {
+		err = deleteJetStreamVolumes(ctx, r.Clientset, req.Namespace)
+	}
+	if err != nil {
+		r.setDeletionStatus(ctx, vz, v1alpha1.DeletionPhaseFailed, fmt.Sprintf("Failed to delete the Vizier resources: %v", err), retained)
+		return err
+	}
+	r.setDeletionStatus(ctx, vz, v1alpha1.DeletionPhaseCompleted, "Deleted the Vizier resources.", retained)
+	r.Events.emit(newVizierCloudEvent(cloudEventVizierDeleted, vz))
+
+	controllerutil.RemoveFinalizer(vz, vizierFinalizer)
+	return r.Update(ctx, vz)
+}
+
+func (r *VizierReconciler) setDeletionStatus(ctx context.Context, vz *v1alpha1.Vizier, phase v1alpha1.DeletionPhase, message string, retained []string) {
+	vz.Status.Deletion = &v1alpha1.DeletionStatus{
+		Phase:    phase,
+		Message:  message,
+		Retained: retained,
+	}
+	err := r.Status().Update(ctx, vz)
+	if err != nil {
+		log.WithError(err).Error("Failed to update the deletion status")
+	}
+}
+
+// retainResources releases the resources that the deletion policy keeps, by removing the operator's label so that
+// they aren't deleted along with the rest of the Vizier resources. It returns the released resources as kind/name.
+func retainResources(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) ([]string, error) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      map[string]interface{}{operatorAnnotation: nil},
+			"annotations": map[string]interface{}{retainedFromAnnotation: vz.Name},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var retained []string
+	retain := func(kind, name string) error {
+		err := patchResource(ctx, clientset, namespace, kind, name, patch)
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		retained = append(retained, kind+"/"+name)
+		return nil
+	}
+
+	if pvcRetention(vz) == v1alpha1.RetentionPolicyRetain {
+		pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: operatorAnnotation + "=" + vz.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs.Items {
+			if pvc.Name == metadataPVCName && metadataStoreRetention(vz) == v1alpha1.RetentionPolicyDelete {
+				continue
+			}
+			if err := retain("PersistentVolumeClaim", pvc.Name); err != nil {
+				return nil, err
+			}
+		}
+	} else if metadataStoreRetention(vz) == v1alpha1.RetentionPolicyRetain {
+		if err := retain("PersistentVolumeClaim", metadataPVCName); err != nil {
+			return nil, err
+		}
+	}
+
+	if natsDeletionPolicy(vz) == v1alpha1.NATSDeletionPolicyOrphan {
+		for _, res := range natsResources {
+			if err := retain(res.kind, res.name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return retained, nil
+}
+
+// patchResource applies the merge patch to the resource of the given kind.
+func patchResource(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string, patch []byte) error {
+	var err error
+	opts := metav1.PatchOptions{}
+	switch kind {
+	case "PersistentVolumeClaim":
+		_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	case "ConfigMap":
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	case "Service":
+		_, err = clientset.CoreV1().Services(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	case "StatefulSet":
+		_, err = clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	case "PodDisruptionBudget":
+		_, err = clientset.PolicyV1().PodDisruptionBudgets(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	default:
+		return fmt.Errorf("cannot retain resources of kind %s", kind)
+	}
+	return err
+}
+
+// deleteJetStreamVolumes deletes the JetStream volumes of the NATS servers. They are created from the volume claim
+// templates of the NATS StatefulSet, so they aren't deleted by the operator's label.
+func deleteJetStreamVolumes(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("%s-%s-", jetStreamVolumeName, natsStatefulSetName)
+	for _, pvc := range pvcs.Items {
+		if !strings.HasPrefix(pvc.Name, prefix) {
+			continue
+		}
+		err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
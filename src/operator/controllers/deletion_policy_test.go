@@ -0,0 +1,135 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+func vizierObjectMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "pl",
+		Labels:    map[string]string{operatorAnnotation: "pixie", "app": "pl-monitoring"},
+	}
+}
+
+func deletionTestObjects() []runtime.Object {
+	return []runtime.Object{
+		&v1.PersistentVolumeClaim{ObjectMeta: vizierObjectMeta(metadataPVCName)},
+		&v1.PersistentVolumeClaim{ObjectMeta: vizierObjectMeta("other-claim")},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "nats-js-pl-nats-0", Namespace: "pl"}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "nats-js-pl-nats-1", Namespace: "pl"}},
+		&v1.ConfigMap{ObjectMeta: vizierObjectMeta("nats-config")},
+		&v1.Service{ObjectMeta: vizierObjectMeta("pl-nats")},
+		&v1.Service{ObjectMeta: vizierObjectMeta("pl-nats-mgmt")},
+		&appsv1.StatefulSet{ObjectMeta: vizierObjectMeta("pl-nats")},
+	}
+}
+
+func TestRetainResources(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           *v1alpha1.DeletionPolicy
+		expectedRetained []string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "retain metadata store",
+			policy: &v1alpha1.DeletionPolicy{
+				MetadataStore: v1alpha1.RetentionPolicyRetain,
+			},
+			expectedRetained: []string{"PersistentVolumeClaim/metadata-pv-claim"},
+		},
+		{
+			name: "retain pvcs except the metadata store",
+			policy: &v1alpha1.DeletionPolicy{
+				PersistentVolumeClaims: v1alpha1.RetentionPolicyRetain,
+				MetadataStore:          v1alpha1.RetentionPolicyDelete,
+			},
+			expectedRetained: []string{"PersistentVolumeClaim/other-claim"},
+		},
+		{
+			name: "orphan nats",
+			policy: &v1alpha1.DeletionPolicy{
+				NATS: v1alpha1.NATSDeletionPolicyOrphan,
+			},
+			// The PodDisruptionBudget doesn't exist.
+			expectedRetained: []string{
+				"ConfigMap/nats-config",
+				"Service/pl-nats",
+				"Service/pl-nats-mgmt",
+				"StatefulSet/pl-nats",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewSimpleClientset(deletionTestObjects()...)
+			vz := &v1alpha1.Vizier{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "pl", Name: "pixie"},
+				Spec:       v1alpha1.VizierSpec{DeletionPolicy: test.policy},
+			}
+
+			retained, err := retainResources(ctx, clientset, "pl", vz)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.expectedRetained, retained)
+
+			for _, r := range retained {
+				if r != "PersistentVolumeClaim/"+metadataPVCName {
+					continue
+				}
+				pvc, err := clientset.CoreV1().PersistentVolumeClaims("pl").Get(ctx, metadataPVCName, metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.NotContains(t, pvc.Labels, operatorAnnotation)
+				assert.Equal(t, "pl-monitoring", pvc.Labels["app"])
+				assert.Equal(t, "pixie", pvc.Annotations[retainedFromAnnotation])
+			}
+		})
+	}
+}
+
+func TestDeleteJetStreamVolumes(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(deletionTestObjects()...)
+
+	require.NoError(t, deleteJetStreamVolumes(ctx, clientset, "pl"))
+
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims("pl").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, pvc := range pvcs.Items {
+		names = append(names, pvc.Name)
+	}
+	assert.ElementsMatch(t, []string{metadataPVCName, "other-claim"}, names)
+}
@@ -0,0 +1,395 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	// dryRunConfigMapSuffix is appended to the name of the Vizier to name the ConfigMap with the planned diffs.
+	dryRunConfigMapSuffix = "-dry-run"
+	// maxDryRunDiffSize caps the size of each diff, so that the ConfigMap stays below the size limit of K8s objects.
+	maxDryRunDiffSize = 32 * 1024
+
+	eventReasonDryRunPlanned = "DryRunPlanned"
+)
+
+// plannedResource is a resource that a deploy of the Vizier would apply.
+type plannedResource struct {
+	resource *k8s.Resource
+	// allowUpdate is whether the deploy replaces the resource when it already exists, instead of leaving it as is.
+	allowUpdate bool
+}
+
+// planVizierChanges computes the changes that deploying the Vizier's spec would make, and publishes them instead of
+// applying them.
+func (r *VizierReconciler) planVizierChanges(ctx context.Context, req ctrl.Request, vz *v1alpha1.Vizier, update bool) error {
+	checksum, err := getSpecChecksum(vz)
+	if err != nil {
+		return err
+	}
+	if vz.Status.DryRun != nil && bytes.Equal(vz.Status.DryRun.Checksum, checksum) {
+		log.Info("Changes for the spec were already planned, nothing to do")
+		return nil
+	}
+	log.Info("Planning Vizier changes in dry-run mode")
+
+	cloudClient, err := getCloudClientConnection(vz.Spec.CloudAddr, vz.Spec.DevCloudNamespace)
+	if err != nil {
+		log.WithError(err).Error("Failed to connect to Pixie cloud")
+		return err
+	}
+	defer cloudClient.Close()
+
+	// The deploy adds the operator's metadata to the spec, which must be planned for without updating the Vizier.
+	planned := vz.DeepCopy()
+	addOperatorMetadata(planned, req.Name)
+	if r.Settings.FeatureEnabled(v1alpha1.FeatureGateMultiVizier) {
+		addMultiVizierMetadata(planned)
+	}
+	configForVizierResp, err := generateVizierYAMLsConfig(ctx, req.Namespace, r.K8sVersion, planned, cloudClient)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate configs for Vizier YAMLs")
+		return err
+	}
+	natsCreds, err := planNATSCredentials(ctx, r.Clientset, req.Namespace, planned)
+	if err != nil {
+		return err
+	}
+	resources, err := generatePlannedResources(req.Namespace, planned, configForVizierResp.NameToYamlContent, update, natsCreds)
+	if err != nil {
+		return err
+	}
+	changes, diffs, err := planChanges(ctx, r.Client, req.Namespace, resources, plannedDeletions(planned))
+	if err != nil {
+		return err
+	}
+
+	configMap := vz.Name + dryRunConfigMapSuffix
+	err = publishDryRunDiffs(ctx, r.Clientset, req.Namespace, configMap, vz.Name, diffs)
+	if err != nil {
+		log.WithError(err).Error("Failed to publish the planned changes")
+		return err
+	}
+
+	vz.Status.DryRun = &v1alpha1.DryRunStatus{
+		Checksum:    checksum,
+		PlannedTime: metav1.Now(),
+		ConfigMap:   configMap,
+		Changes:     changes,
+	}
+	err = r.Status().Update(ctx, vz)
+	if err != nil {
+		return err
+	}
+	r.recordEvent(vz, v1.EventTypeNormal, eventReasonDryRunPlanned,
+		"Planned %d changes without applying them, see the %s ConfigMap for their diffs", len(changes), configMap)
+	return nil
+}
+
+// generatePlannedResources generates the resources that a deploy of the Vizier applies, in the order that it
+// applies them.
+func generatePlannedResources(namespace string, vz *v1alpha1.Vizier, yamlMap map[string]string, update bool,
+	natsCreds *natsCredentials) ([]plannedResource, error) {
+	var planned []plannedResource
+	add := func(resources []*k8s.Resource, allowUpdate bool) {
+		for _, r := range resources {
+			planned = append(planned, plannedResource{resource: r, allowUpdate: allowUpdate})
+		}
+	}
+
+	if !update {
+		resources, err := generateVizierResources(yamlMap["secrets"], vz)
+		if err != nil {
+			return nil, err
+		}
+		add(resources, false)
+		// The certs are never requested from an external CA here, so that planning has no side effects.
+		resources, err = generateVizierCertResources(namespace, vz)
+		if err != nil {
+			return nil, err
+		}
+		add(resources, false)
+	}
+	if externalNATS(vz) == nil {
+		resources, err := generateNATSResources(namespace, vz, yamlMap, natsCreds)
+		if err != nil {
+			return nil, err
+		}
+		add(resources, true)
+	}
+	if vz.Spec.UseEtcdOperator {
+		resources, err := generateVizierResources(yamlMap["etcd"], vz)
+		if err != nil {
+			return nil, err
+		}
+		add(resources, false)
+	}
+	resources, err := generateVizierCoreResources(vz, yamlMap, natsCreds)
+	if err != nil {
+		return nil, err
+	}
+	add(resources, update)
+	return planned, nil
+}
+
+// plannedDeletions returns the resources that a deploy of the Vizier deletes, because they belong to the metadata
+// backend that isn't used.
+func plannedDeletions(vz *v1alpha1.Vizier) []*unstructured.Unstructured {
+	resource := func(kind, name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind})
+		u.SetName(name)
+		return u
+	}
+	if vz.Spec.UseEtcdOperator {
+		return []*unstructured.Unstructured{resource("StatefulSet", "vizier-metadata")}
+	}
+	return []*unstructured.Unstructured{
+		resource("StatefulSet", "pl-etcd"),
+		resource("Deployment", "vizier-metadata"),
+	}
+}
+
+// planChanges compares the planned resources against the ones in the cluster. It returns the resources that
+// would change, and the diffs of the changes keyed by the resource.
+func planChanges(ctx context.Context, c client.Reader, namespace string, planned []plannedResource,
+	deletions []*unstructured.Unstructured) ([]v1alpha1.PlannedChange, map[string]string, error) {
+	var changes []v1alpha1.PlannedChange
+	diffs := make(map[string]string)
+	addChange := func(kind, name string, action v1alpha1.PlannedAction, diff string) {
+		changes = append(changes, v1alpha1.PlannedChange{Kind: kind, Name: name, Action: action})
+		if len(diff) > maxDryRunDiffSize {
+			diff = diff[:maxDryRunDiffSize] + "\n... (truncated)\n"
+		}
+		diffs[strings.ToLower(kind)+"."+name] = diff
+	}
+
+	for _, p := range planned {
+		obj := p.resource.Object
+		kind := p.resource.GVK.Kind
+		live, err := getLiveResource(ctx, c, namespace, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		if live == nil {
+			diff, err := diffResource(nil, obj.Object)
+			if err != nil {
+				return nil, nil, err
+			}
+			addChange(kind, obj.GetName(), v1alpha1.PlannedActionCreate, diff)
+			continue
+		}
+		// Mirrors k8s.ApplyResources, which always updates ClusterRoles and CronJobs.
+		if !p.allowUpdate && kind != "ClusterRole" && kind != "CronJob" {
+			continue
+		}
+		diff, err := diffResource(live.Object, obj.Object)
+		if err != nil {
+			return nil, nil, err
+		}
+		if diff != "" {
+			addChange(kind, obj.GetName(), v1alpha1.PlannedActionUpdate, diff)
+		}
+	}
+
+	for _, obj := range deletions {
+		live, err := getLiveResource(ctx, c, namespace, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		if live != nil {
+			addChange(obj.GetKind(), obj.GetName(), v1alpha1.PlannedActionDelete,
+				fmt.Sprintf("%s %s would be deleted.\n", obj.GetKind(), obj.GetName()))
+		}
+	}
+	return changes, diffs, nil
+}
+
+// getLiveResource gets the resource from the cluster, or returns nil if it doesn't exist.
+func getLiveResource(ctx context.Context, c client.Reader, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	ns := obj.GetNamespace()
+	if ns == "" {
+		ns = namespace
+	}
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(obj.GroupVersionKind())
+	err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: obj.GetName()}, live)
+	if k8serrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// diffResource returns a unified diff of the YAML of the planned resource against the live one, or an empty string if
+// the planned resource matches. Only the fields of the live resource that are set in the planned one are compared,
+// since the rest are defaulted or managed by K8s.
+func diffResource(live, planned map[string]interface{}) (string, error) {
+	plannedObj, err := normalizeResource(planned)
+	if err != nil {
+		return "", err
+	}
+	var liveYAML []byte
+	if live != nil {
+		liveObj, err := normalizeResource(live)
+		if err != nil {
+			return "", err
+		}
+		liveYAML, err = yaml.Marshal(pruneToPlanned(liveObj, plannedObj))
+		if err != nil {
+			return "", err
+		}
+	}
+	plannedYAML, err := yaml.Marshal(plannedObj)
+	if err != nil {
+		return "", err
+	}
+	if live != nil && bytes.Equal(liveYAML, plannedYAML) {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(liveYAML)),
+		B:        difflib.SplitLines(string(plannedYAML)),
+		FromFile: "live",
+		ToFile:   "planned",
+		Context:  3,
+	})
+}
+
+// normalizeResource converts the resource to plain JSON values, so that resources parsed from YAML and resources
+// read from the cluster compare equal. The data of secrets is redacted.
+func normalizeResource(obj map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return nil, err
+	}
+	if normalized["kind"] == "Secret" {
+		redactSecret(normalized)
+	}
+	return normalized, nil
+}
+
+// redactSecret replaces the values of the secret with a short hash, which still shows whether they would change.
+// K8s merges stringData into data, so both are redacted as data.
+func redactSecret(obj map[string]interface{}) {
+	data, _ := obj["data"].(map[string]interface{})
+	redacted := make(map[string]interface{})
+	for k, v := range data {
+		s, _ := v.(string)
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			decoded = []byte(s)
+		}
+		redacted[k] = redactedValue(decoded)
+	}
+	if stringData, ok := obj["stringData"].(map[string]interface{}); ok {
+		for k, v := range stringData {
+			s, _ := v.(string)
+			redacted[k] = redactedValue([]byte(s))
+		}
+		delete(obj, "stringData")
+	}
+	if len(redacted) > 0 {
+		obj["data"] = redacted
+	}
+}
+
+func redactedValue(value []byte) string {
+	sum := sha256.Sum256(value)
+	return fmt.Sprintf("<redacted sha256:%x>", sum[:6])
+}
+
+// pruneToPlanned drops the fields of the live value that aren't set in the planned value.
+func pruneToPlanned(live, planned interface{}) interface{} {
+	switch p := planned.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		pruned := make(map[string]interface{})
+		for k, v := range p {
+			if lv, ok := l[k]; ok {
+				pruned[k] = pruneToPlanned(lv, v)
+			}
+		}
+		return pruned
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(p) {
+			return live
+		}
+		pruned := make([]interface{}, len(l))
+		for i := range l {
+			pruned[i] = pruneToPlanned(l[i], p[i])
+		}
+		return pruned
+	default:
+		return live
+	}
+}
+
+// publishDryRunDiffs writes the diffs of the planned changes to the ConfigMap, replacing the diffs of earlier dry
+// runs. The ConfigMap carries the operator's label, so that it is deleted with the Vizier.
+func publishDryRunDiffs(ctx context.Context, clientset kubernetes.Interface, namespace, name, vzName string, diffs map[string]string) error {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{operatorAnnotation: vzName},
+		},
+		Data: diffs,
+	}
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+	_, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+func mustParseResources(t *testing.T, yamlStr string) []*k8s.Resource {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlStr))
+	require.NoError(t, err)
+	return resources
+}
+
+func TestPlanChanges(t *testing.T) {
+	live := mustParseResources(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: vizier-query-broker
+  namespace: pl
+  resourceVersion: "12"
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: query-broker:0.1.0
+        imagePullPolicy: IfNotPresent
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: vizier-query-broker-svc
+  namespace: pl
+spec:
+  clusterIP: 10.0.0.1
+  ports:
+  - port: 50300
+    protocol: TCP
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: query-broker-service-account
+  namespace: pl
+  labels:
+    app: old
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: pl-etcd
+  namespace: pl
+`)
+	liveObjs := make([]client.Object, len(live))
+	for i, r := range live {
+		liveObjs[i] = r.Object
+	}
+	c := newFakeClient(t, liveObjs...)
+
+	planned := mustParseResources(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: vizier-query-broker
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: query-broker:0.2.0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: vizier-query-broker-svc
+spec:
+  ports:
+  - port: 50300
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: query-broker-service-account
+  labels:
+    app: new
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: pl-cluster-config
+data:
+  PL_CLUSTER_NAME: test
+`)
+	resources := []plannedResource{
+		{resource: planned[0], allowUpdate: true},
+		{resource: planned[1], allowUpdate: true},
+		// Existing resources that aren't updated are left as they are.
+		{resource: planned[2], allowUpdate: false},
+		{resource: planned[3], allowUpdate: false},
+	}
+
+	changes, diffs, err := planChanges(context.Background(), c, "pl", resources, plannedDeletions(&v1alpha1.Vizier{}))
+	require.NoError(t, err)
+	assert.Equal(t, []v1alpha1.PlannedChange{
+		{Kind: "Deployment", Name: "vizier-query-broker", Action: v1alpha1.PlannedActionUpdate},
+		{Kind: "ConfigMap", Name: "pl-cluster-config", Action: v1alpha1.PlannedActionCreate},
+		{Kind: "StatefulSet", Name: "pl-etcd", Action: v1alpha1.PlannedActionDelete},
+	}, changes)
+
+	require.Len(t, diffs, 3)
+	assert.Contains(t, diffs["deployment.vizier-query-broker"], "-      - image: query-broker:0.1.0")
+	assert.Contains(t, diffs["deployment.vizier-query-broker"], "+      - image: query-broker:0.2.0")
+	// Fields that aren't set by the operator don't show up in the diff.
+	assert.NotContains(t, diffs["deployment.vizier-query-broker"], "imagePullPolicy")
+	assert.NotContains(t, diffs["deployment.vizier-query-broker"], "resourceVersion")
+	assert.Contains(t, diffs["configmap.pl-cluster-config"], "+  PL_CLUSTER_NAME: test")
+	assert.Equal(t, "StatefulSet pl-etcd would be deleted.\n", diffs["statefulset.pl-etcd"])
+}
+
+func TestDiffResource_RedactsSecrets(t *testing.T) {
+	live := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "pl-deploy-secrets"},
+		// "hunter2", base64 encoded.
+		"data": map[string]interface{}{"deploy-key": "aHVudGVyMg=="},
+	}
+	planned := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "pl-deploy-secrets"},
+		"stringData": map[string]interface{}{"deploy-key": "hunter2"},
+	}
+	diff, err := diffResource(live, planned)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	planned["stringData"] = map[string]interface{}{"deploy-key": "hunter3"}
+	diff, err = diffResource(live, planned)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "deploy-key: <redacted sha256:")
+	assert.NotContains(t, diff, "hunter")
+	assert.NotContains(t, diff, "aHVudGVyMg==")
+}
+
+func TestPublishDryRunDiffs(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+
+	require.NoError(t, publishDryRunDiffs(ctx, clientset, "pl", "pixie-dry-run", "pixie", map[string]string{"a": "1", "b": "2"}))
+	require.NoError(t, publishDryRunDiffs(ctx, clientset, "pl", "pixie-dry-run", "pixie", map[string]string{"c": "3"}))
+
+	cm, err := clientset.CoreV1().ConfigMaps("pl").Get(ctx, "pixie-dry-run", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"c": "3"}, cm.Data)
+	assert.Equal(t, "pixie", cm.Labels[operatorAnnotation])
+}
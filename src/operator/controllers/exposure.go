@@ -0,0 +1,276 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+const (
+	// queryEndpointName is the name of the Ingress or HTTPRoute that exposes the query endpoint.
+	queryEndpointName        = "vizier-query-endpoint"
+	queryBrokerServiceName   = "vizier-query-broker-svc"
+	queryBrokerServicePort   = 50300
+	externalDNSHostnameAnnot = "external-dns.alpha.kubernetes.io/hostname"
+	externalDNSTTLAnnot      = "external-dns.alpha.kubernetes.io/ttl"
+	externalDNSTargetAnnot   = "external-dns.alpha.kubernetes.io/target"
+)
+
+var httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"}
+
+// endpointExposer creates the Ingress or Gateway API route that exposes the query endpoint of Vizier, and
+// removes the ones that are no longer wanted.
+type endpointExposer struct {
+	clientset kubernetes.Interface
+	// client is used for the Gateway API routes, whose CRDs may not be installed.
+	client client.Client
+}
+
+func newEndpointExposer(clientset kubernetes.Interface, c client.Client) *endpointExposer {
+	return &endpointExposer{clientset: clientset, client: c}
+}
+
+func exposureType(vz *v1alpha1.Vizier) v1alpha1.ExposureType {
+	if vz.Spec.Exposure == nil {
+		return ""
+	}
+	return vz.Spec.Exposure.Type
+}
+
+// exposureMetadata returns the labels and annotations of the resources that expose the query endpoint. The
+// labels let the resources be deleted with the rest of Vizier.
+func exposureMetadata(vz *v1alpha1.Vizier) (map[string]string, map[string]string) {
+	labels := map[string]string{
+		"app":              "pl-monitoring",
+		"component":        "vizier",
+		operatorAnnotation: vz.Name,
+	}
+	exposure := vz.Spec.Exposure
+	annotations := make(map[string]string, len(exposure.Annotations))
+	for k, v := range exposure.Annotations {
+		annotations[k] = v
+	}
+	if dns := exposure.ExternalDNS; dns != nil && dns.Enabled {
+		annotations[externalDNSHostnameAnnot] = exposure.Hostname
+		if dns.TTL > 0 {
+			annotations[externalDNSTTLAnnot] = strconv.Itoa(int(dns.TTL))
+		}
+		if dns.Target != "" {
+			annotations[externalDNSTargetAnnot] = dns.Target
+		}
+	}
+	return labels, annotations
+}
+
+func queryEndpointIngress(vz *v1alpha1.Vizier) *networkingv1.Ingress {
+	exposure := vz.Spec.Exposure
+	labels, annotations := exposureMetadata(vz)
+	pathType := networkingv1.PathTypePrefix
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        queryEndpointName,
+			Namespace:   vz.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: exposure.Hostname,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: queryBrokerServiceName,
+											Port: networkingv1.ServiceBackendPort{Number: queryBrokerServicePort},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if exposure.IngressClassName != "" {
+		className := exposure.IngressClassName
+		ing.Spec.IngressClassName = &className
+	}
+	if exposure.TLSSecretName != "" {
+		ing.Spec.TLS = []networkingv1.IngressTLS{
+			{Hosts: []string{exposure.Hostname}, SecretName: exposure.TLSSecretName},
+		}
+	}
+	return ing
+}
+
+func queryEndpointHTTPRoute(vz *v1alpha1.Vizier) *unstructured.Unstructured {
+	exposure := vz.Spec.Exposure
+	labels, annotations := exposureMetadata(vz)
+	parentRef := map[string]interface{}{"name": exposure.Gateway.Name}
+	if exposure.Gateway.Namespace != "" {
+		parentRef["namespace"] = exposure.Gateway.Namespace
+	}
+	if exposure.Gateway.SectionName != "" {
+		parentRef["sectionName"] = exposure.Gateway.SectionName
+	}
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{parentRef},
+			"hostnames":  []interface{}{exposure.Hostname},
+			"rules": []interface{}{
+				map[string]interface{}{
+					"backendRefs": []interface{}{
+						map[string]interface{}{
+							"name": queryBrokerServiceName,
+							"port": int64(queryBrokerServicePort),
+						},
+					},
+				},
+			},
+		},
+	}}
+	route.SetGroupVersionKind(httpRouteGVK)
+	route.SetNamespace(vz.Namespace)
+	route.SetName(queryEndpointName)
+	route.SetLabels(labels)
+	route.SetAnnotations(annotations)
+	return route
+}
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;create;update;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;create;update;delete
+
+// reconcile makes the resources that expose the query endpoint match the spec of the Vizier.
+func (e *endpointExposer) reconcile(ctx context.Context, vz *v1alpha1.Vizier) error {
+	if err := e.reconcileIngress(ctx, vz); err != nil {
+		return fmt.Errorf("failed to reconcile query endpoint Ingress: %w", err)
+	}
+	if err := e.reconcileHTTPRoute(ctx, vz); err != nil {
+		return fmt.Errorf("failed to reconcile query endpoint HTTPRoute: %w", err)
+	}
+	return nil
+}
+
+func (e *endpointExposer) reconcileIngress(ctx context.Context, vz *v1alpha1.Vizier) error {
+	ingresses := e.clientset.NetworkingV1().Ingresses(vz.Namespace)
+	existing, err := ingresses.Get(ctx, queryEndpointName, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+	wanted := exposureType(vz) == v1alpha1.ExposureTypeIngress
+	// Only Ingresses that the operator created are updated or deleted.
+	if found && existing.Labels[operatorAnnotation] != vz.Name {
+		if wanted {
+			return fmt.Errorf("ingress %s already exists and is not managed by the operator", queryEndpointName)
+		}
+		return nil
+	}
+
+	if !wanted {
+		if !found {
+			return nil
+		}
+		log.WithField("namespace", vz.Namespace).Info("Deleting query endpoint Ingress")
+		return client.IgnoreNotFound(ingresses.Delete(ctx, queryEndpointName, metav1.DeleteOptions{}))
+	}
+
+	desired := queryEndpointIngress(vz)
+	if !found {
+		log.WithField("host", vz.Spec.Exposure.Hostname).Info("Creating query endpoint Ingress")
+		_, err = ingresses.Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, desired.Spec) &&
+		equality.Semantic.DeepEqual(existing.Labels, desired.Labels) &&
+		equality.Semantic.DeepEqual(existing.Annotations, desired.Annotations) {
+		return nil
+	}
+	existing.Spec = desired.Spec
+	existing.Labels = desired.Labels
+	existing.Annotations = desired.Annotations
+	_, err = ingresses.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+func (e *endpointExposer) reconcileHTTPRoute(ctx context.Context, vz *v1alpha1.Vizier) error {
+	wanted := exposureType(vz) == v1alpha1.ExposureTypeGateway
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(httpRouteGVK)
+	err := e.client.Get(ctx, client.ObjectKey{Namespace: vz.Namespace, Name: queryEndpointName}, existing)
+	if meta.IsNoMatchError(err) {
+		if wanted {
+			return fmt.Errorf("the Gateway API CRDs are not installed")
+		}
+		return nil
+	}
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+	if found && existing.GetLabels()[operatorAnnotation] != vz.Name {
+		if wanted {
+			return fmt.Errorf("HTTPRoute %s already exists and is not managed by the operator", queryEndpointName)
+		}
+		return nil
+	}
+
+	if !wanted {
+		if !found {
+			return nil
+		}
+		log.WithField("namespace", vz.Namespace).Info("Deleting query endpoint HTTPRoute")
+		return client.IgnoreNotFound(e.client.Delete(ctx, existing))
+	}
+
+	desired := queryEndpointHTTPRoute(vz)
+	if !found {
+		log.WithField("host", vz.Spec.Exposure.Hostname).Info("Creating query endpoint HTTPRoute")
+		return e.client.Create(ctx, desired)
+	}
+	if equality.Semantic.DeepEqual(existing.Object["spec"], desired.Object["spec"]) &&
+		equality.Semantic.DeepEqual(existing.GetLabels(), desired.GetLabels()) &&
+		equality.Semantic.DeepEqual(existing.GetAnnotations(), desired.GetAnnotations()) {
+		return nil
+	}
+	existing.Object["spec"] = desired.Object["spec"]
+	existing.SetLabels(desired.GetLabels())
+	existing.SetAnnotations(desired.GetAnnotations())
+	return e.client.Update(ctx, existing)
+}
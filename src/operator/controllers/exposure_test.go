@@ -0,0 +1,154 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+func exposedVizier(exposure *v1alpha1.EndpointExposure) *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "pl", Name: "pixie"},
+		Spec:       v1alpha1.VizierSpec{Exposure: exposure},
+	}
+}
+
+func TestEndpointExposer_Ingress(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	e := newEndpointExposer(clientset, newFakeClient(t))
+
+	vz := exposedVizier(&v1alpha1.EndpointExposure{
+		Type:             v1alpha1.ExposureTypeIngress,
+		Hostname:         "pixie.example.com",
+		IngressClassName: "nginx",
+		TLSSecretName:    "pixie-tls",
+		Annotations:      map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "GRPCS"},
+		ExternalDNS:      &v1alpha1.ExternalDNS{Enabled: true, TTL: 60},
+	})
+	require.NoError(t, e.reconcile(ctx, vz))
+
+	ing, err := clientset.NetworkingV1().Ingresses("pl").Get(ctx, queryEndpointName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "nginx", *ing.Spec.IngressClassName)
+	assert.Equal(t, []networkingv1.IngressTLS{{Hosts: []string{"pixie.example.com"}, SecretName: "pixie-tls"}}, ing.Spec.TLS)
+	require.Len(t, ing.Spec.Rules, 1)
+	assert.Equal(t, "pixie.example.com", ing.Spec.Rules[0].Host)
+	backend := ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+	assert.Equal(t, queryBrokerServiceName, backend.Name)
+	assert.Equal(t, int32(queryBrokerServicePort), backend.Port.Number)
+	assert.Equal(t, map[string]string{
+		"nginx.ingress.kubernetes.io/backend-protocol": "GRPCS",
+		"external-dns.alpha.kubernetes.io/hostname":    "pixie.example.com",
+		"external-dns.alpha.kubernetes.io/ttl":         "60",
+	}, ing.Annotations)
+	assert.Equal(t, "pixie", ing.Labels[operatorAnnotation])
+
+	vz.Spec.Exposure.Hostname = "px.example.com"
+	require.NoError(t, e.reconcile(ctx, vz))
+	ing, err = clientset.NetworkingV1().Ingresses("pl").Get(ctx, queryEndpointName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "px.example.com", ing.Spec.Rules[0].Host)
+
+	vz.Spec.Exposure = nil
+	require.NoError(t, e.reconcile(ctx, vz))
+	_, err = clientset.NetworkingV1().Ingresses("pl").Get(ctx, queryEndpointName, metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+}
+
+func TestEndpointExposer_IngressNotManaged(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "pl", Name: queryEndpointName},
+	})
+	e := newEndpointExposer(clientset, newFakeClient(t))
+
+	// An Ingress that the operator didn't create is left alone.
+	require.NoError(t, e.reconcile(ctx, exposedVizier(nil)))
+	_, err := clientset.NetworkingV1().Ingresses("pl").Get(ctx, queryEndpointName, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	err = e.reconcile(ctx, exposedVizier(&v1alpha1.EndpointExposure{
+		Type:     v1alpha1.ExposureTypeIngress,
+		Hostname: "pixie.example.com",
+	}))
+	assert.Error(t, err)
+}
+
+func TestEndpointExposer_Gateway(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+	e := newEndpointExposer(fake.NewSimpleClientset(), c)
+
+	vz := exposedVizier(&v1alpha1.EndpointExposure{
+		Type:        v1alpha1.ExposureTypeGateway,
+		Hostname:    "pixie.example.com",
+		Gateway:     &v1alpha1.GatewayReference{Name: "public", Namespace: "gateways", SectionName: "https"},
+		ExternalDNS: &v1alpha1.ExternalDNS{Enabled: true, Target: "lb.example.com"},
+	})
+	require.NoError(t, e.reconcile(ctx, vz))
+
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	key := client.ObjectKey{Namespace: "pl", Name: queryEndpointName}
+	require.NoError(t, c.Get(ctx, key, route))
+	parentRefs, _, err := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "public", "namespace": "gateways", "sectionName": "https"},
+	}, parentRefs)
+	hostnames, _, err := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pixie.example.com"}, hostnames)
+	assert.Equal(t, map[string]string{
+		"external-dns.alpha.kubernetes.io/hostname": "pixie.example.com",
+		"external-dns.alpha.kubernetes.io/target":   "lb.example.com",
+	}, route.GetAnnotations())
+
+	// Switching to an Ingress removes the route.
+	vz.Spec.Exposure.Type = v1alpha1.ExposureTypeIngress
+	require.NoError(t, e.reconcile(ctx, vz))
+	assert.True(t, k8serrors.IsNotFound(c.Get(ctx, key, route)))
+}
+
+func TestEndpointExposer_GatewayAPINotInstalled(t *testing.T) {
+	ctx := context.Background()
+	e := newEndpointExposer(fake.NewSimpleClientset(), &noMatchClient{Client: newFakeClient(t)})
+
+	// Without the Gateway API CRDs, there are no routes to remove.
+	require.NoError(t, e.reconcile(ctx, exposedVizier(nil)))
+
+	err := e.reconcile(ctx, exposedVizier(&v1alpha1.EndpointExposure{
+		Type:     v1alpha1.ExposureTypeGateway,
+		Hostname: "pixie.example.com",
+		Gateway:  &v1alpha1.GatewayReference{Name: "public"},
+	}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,428 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	natsStatefulSetName = "pl-nats"
+	natsConfigMapName   = "nats-config"
+	natsConfigKey       = "nats.conf"
+	// jetStreamConfigAnnotation records the JetStream configuration of the NATS StatefulSet, so that the operator
+	// can tell when the StatefulSet must be recreated.
+	jetStreamConfigAnnotation = "px.dev/jetstream-config"
+	jetStreamVolumeName       = "nats-js"
+	jetStreamStoreDir         = "/data/jetstream"
+	defaultJetStreamStorage   = "1Gi"
+	// The defaults for consumers, matching the consumers created by the msgbus package.
+	defaultJetStreamAckWait       = 30 * time.Second
+	defaultJetStreamMaxAckPending = 50
+)
+
+func jetStreamEnabled(vz *v1alpha1.Vizier) bool {
+	return vz.Spec.JetStream != nil && vz.Spec.JetStream.Enabled
+}
+
+// getJetStreamStorage returns where JetStream should store its messages. Vizier falls back to the etcd operator
+// when the cluster has no persistent volume support, in which case messages are stored in memory.
+func getJetStreamStorage(vz *v1alpha1.Vizier) v1alpha1.JetStreamStorage {
+	if vz.Spec.JetStream.Storage != "" {
+		return vz.Spec.JetStream.Storage
+	}
+	if vz.Spec.UseEtcdOperator {
+		return v1alpha1.JetStreamStorageMemory
+	}
+	return v1alpha1.JetStreamStorageFile
+}
+
+func getJetStreamStorageSize(vz *v1alpha1.Vizier) (resource.Quantity, error) {
+	if vz.Spec.JetStream.StorageSize == "" {
+		return resource.MustParse(defaultJetStreamStorage), nil
+	}
+	return resource.ParseQuantity(vz.Spec.JetStream.StorageSize)
+}
+
+// getJetStreamConfig returns the value of the JetStream config annotation for the Vizier. It is empty if
+// JetStream is disabled.
+func getJetStreamConfig(vz *v1alpha1.Vizier) (string, error) {
+	if !jetStreamEnabled(vz) {
+		return "", nil
+	}
+	size, err := getJetStreamStorageSize(vz)
+	if err != nil {
+		return "", fmt.Errorf("invalid JetStream storage size: %w", err)
+	}
+	return fmt.Sprintf("%s:%s", getJetStreamStorage(vz), size.String()), nil
+}
+
+// jetStreamUsesVolume returns whether the given JetStream config stores messages on a persistent volume.
+func jetStreamUsesVolume(config string) bool {
+	return strings.HasPrefix(config, string(v1alpha1.JetStreamStorageFile)+":")
+}
+
+// configureNATSJetStream enables JetStream in the NATS config and StatefulSet of the given resources.
+func configureNATSJetStream(resources []*k8s.Resource, vz *v1alpha1.Vizier) error {
+	config, err := getJetStreamConfig(vz)
+	if err != nil || config == "" {
+		return err
+	}
+	size, err := getJetStreamStorageSize(vz)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resources {
+		obj := r.Object.Object
+		switch {
+		case r.GVK.Kind == "ConfigMap" && r.Object.GetName() == natsConfigMapName:
+			natsConf, _, err := unstructured.NestedString(obj, "data", natsConfigKey)
+			if err != nil {
+				return err
+			}
+			if getJetStreamStorage(vz) == v1alpha1.JetStreamStorageFile {
+				natsConf += fmt.Sprintf("\njetstream {\n  store_dir: %q\n  max_file_store: %d\n  max_memory_store: 0\n}\n", jetStreamStoreDir, size.Value())
+			} else {
+				natsConf += fmt.Sprintf("\njetstream {\n  max_memory_store: %d\n  max_file_store: 0\n}\n", size.Value())
+			}
+			if err := unstructured.SetNestedField(obj, natsConf, "data", natsConfigKey); err != nil {
+				return err
+			}
+		case r.GVK.Kind == "StatefulSet" && r.Object.GetName() == natsStatefulSetName:
+			annotations := r.Object.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[jetStreamConfigAnnotation] = config
+			r.Object.SetAnnotations(annotations)
+			// The annotation on the pod template restarts NATS when the JetStream config changes, since the
+			// config map change doesn't.
+			if err := unstructured.SetNestedField(obj, config, "spec", "template", "metadata", "annotations", jetStreamConfigAnnotation); err != nil {
+				return err
+			}
+			if getJetStreamStorage(vz) != v1alpha1.JetStreamStorageFile {
+				continue
+			}
+			if err := addJetStreamVolume(obj, size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addJetStreamVolume adds the persistent volume for the JetStream file store to the NATS StatefulSet.
+func addJetStreamVolume(ss map[string]interface{}, size resource.Quantity) error {
+	claims, _, err := unstructured.NestedSlice(ss, "spec", "volumeClaimTemplates")
+	if err != nil {
+		return err
+	}
+	claims = append(claims, map[string]interface{}{
+		"metadata": map[string]interface{}{"name": jetStreamVolumeName},
+		"spec": map[string]interface{}{
+			"accessModes": []interface{}{"ReadWriteOnce"},
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{"storage": size.String()},
+			},
+		},
+	})
+	if err := unstructured.SetNestedSlice(ss, claims, "spec", "volumeClaimTemplates"); err != nil {
+		return err
+	}
+
+	containers, _, err := unstructured.NestedSlice(ss, "spec", "template", "spec", "containers")
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok || container["name"] != natsStatefulSetName {
+			continue
+		}
+		mounts, _ := container["volumeMounts"].([]interface{})
+		container["volumeMounts"] = append(mounts, map[string]interface{}{
+			"name":      jetStreamVolumeName,
+			"mountPath": jetStreamStoreDir,
+		})
+	}
+	return unstructured.SetNestedSlice(ss, containers, "spec", "template", "spec", "containers")
+}
+
+// natsJetStreamConfigChanged returns whether the running NATS StatefulSet has a different JetStream config than
+// the Vizier spec.
+func natsJetStreamConfigChanged(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) (bool, error) {
+	config, err := getJetStreamConfig(vz)
+	if err != nil {
+		return false, err
+	}
+	ss, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, natsStatefulSetName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return ss.Annotations[jetStreamConfigAnnotation] != config, nil
+}
+
+// migrateNATSJetStream prepares the running NATS StatefulSet for the JetStream config in the Vizier spec. The
+// volume claims of a StatefulSet can't be updated, so if the JetStream file store is added, removed or resized,
+// the StatefulSet and its JetStream volumes are deleted so that NATS can be redeployed. Messages that were stored
+// in the old file store are lost, and the streams are recreated when NATS is back up.
+func migrateNATSJetStream(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) error {
+	config, err := getJetStreamConfig(vz)
+	if err != nil {
+		return err
+	}
+	ss, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, natsStatefulSetName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	oldConfig := ss.Annotations[jetStreamConfigAnnotation]
+	if oldConfig == config || (!jetStreamUsesVolume(oldConfig) && !jetStreamUsesVolume(config)) {
+		return nil
+	}
+
+	log.WithField("from", oldConfig).WithField("to", config).Info("Recreating NATS for the new JetStream storage")
+	err = clientset.AppsV1().StatefulSets(namespace).Delete(ctx, natsStatefulSetName, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	// Wait for the StatefulSet to be gone, otherwise it can't be recreated.
+	bOpts := backoff.NewExponentialBackOff()
+	bOpts.InitialInterval = time.Second
+	bOpts.MaxElapsedTime = 2 * time.Minute
+	err = backoff.Retry(func() error {
+		_, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, natsStatefulSetName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.New("NATS is still being deleted")
+	}, bOpts)
+	if err != nil {
+		return fmt.Errorf("timed out waiting for NATS to be deleted: %w", err)
+	}
+
+	if !jetStreamUsesVolume(oldConfig) {
+		return nil
+	}
+	replicas := int32(1)
+	if ss.Spec.Replicas != nil {
+		replicas = *ss.Spec.Replicas
+	}
+	for i := int32(0); i < replicas; i++ {
+		pvc := fmt.Sprintf("%s-%s-%d", jetStreamVolumeName, natsStatefulSetName, i)
+		err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvc, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectVizierNATS connects to the NATS server of the Vizier in the given namespace, using the Vizier's client
+// certs and the operator's NATS user if the components have their own users, or to the Vizier's external NATS
+// cluster.
+func connectVizierNATS(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) (*nats.Conn, error) {
+	if ext := externalNATS(vz); ext != nil {
+		opts, err := externalNATSConnectOptions(ctx, clientset, namespace, ext)
+		if err != nil {
+			return nil, err
+		}
+		return nats.Connect(ext.URL, opts...)
+	}
+
+	tlsSecret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, "service-tls-certs", metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(tlsSecret.Data["client.crt"], tlsSecret.Data["client.key"])
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if ok := certPool.AppendCertsFromPEM(tlsSecret.Data["ca.crt"]); !ok {
+		return nil, errors.New("failed to add the Vizier CA to the cert pool")
+	}
+
+	opts := []nats.Option{
+		nats.Secure(&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: certPool}),
+		nats.Name("vizier-operator"),
+	}
+	if componentCredentialsEnabled(vz) {
+		credsOpt, err := operatorNATSCredsOption(ctx, clientset, namespace)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, credsOpt)
+	}
+	return nats.Connect(fmt.Sprintf("tls://%s.%s.svc:4222", natsStatefulSetName, namespace), opts...)
+}
+
+func jetStreamRetentionPolicy(r v1alpha1.JetStreamRetention) (nats.RetentionPolicy, error) {
+	switch r {
+	case "", v1alpha1.JetStreamRetentionLimits:
+		return nats.LimitsPolicy, nil
+	case v1alpha1.JetStreamRetentionInterest:
+		return nats.InterestPolicy, nil
+	case v1alpha1.JetStreamRetentionWorkQueue:
+		return nats.WorkQueuePolicy, nil
+	default:
+		return nats.LimitsPolicy, fmt.Errorf("unknown JetStream retention policy %q", r)
+	}
+}
+
+func jetStreamStreamConfig(s *v1alpha1.JetStreamStream, storage v1alpha1.JetStreamStorage, replicas int) (*nats.StreamConfig, error) {
+	retention, err := jetStreamRetentionPolicy(s.Retention)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &nats.StreamConfig{
+		Name:      s.Name,
+		Subjects:  s.Subjects,
+		Retention: retention,
+		Storage:   nats.FileStorage,
+		MaxBytes:  -1,
+		MaxMsgs:   -1,
+		Replicas:  replicas,
+	}
+	if storage == v1alpha1.JetStreamStorageMemory {
+		cfg.Storage = nats.MemoryStorage
+	}
+	if s.MaxAge != nil {
+		cfg.MaxAge = s.MaxAge.Duration
+	}
+	if s.MaxBytes > 0 {
+		cfg.MaxBytes = s.MaxBytes
+	}
+	if s.MaxMsgs > 0 {
+		cfg.MaxMsgs = s.MaxMsgs
+	}
+	return cfg, nil
+}
+
+func jetStreamConsumerConfig(c *v1alpha1.JetStreamConsumer) *nats.ConsumerConfig {
+	cfg := &nats.ConsumerConfig{
+		Durable:       c.Name,
+		FilterSubject: c.FilterSubject,
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       defaultJetStreamAckWait,
+		MaxAckPending: defaultJetStreamMaxAckPending,
+	}
+	if c.AckWait != nil {
+		cfg.AckWait = c.AckWait.Duration
+	}
+	if c.MaxAckPending > 0 {
+		cfg.MaxAckPending = int(c.MaxAckPending)
+	}
+	return cfg
+}
+
+// applyJetStreamStreams creates or updates the streams and consumers in the Vizier spec. Streams whose storage
+// type changed can't be updated, so they are recreated.
+func applyJetStreamStreams(js nats.JetStreamContext, vz *v1alpha1.Vizier) error {
+	storage := getJetStreamStorage(vz)
+	replicas := getJetStreamStreamReplicas(vz)
+	for i := range vz.Spec.JetStream.Streams {
+		s := &vz.Spec.JetStream.Streams[i]
+		cfg, err := jetStreamStreamConfig(s, storage, replicas)
+		if err != nil {
+			return err
+		}
+
+		info, err := js.StreamInfo(s.Name)
+		switch {
+		case errors.Is(err, nats.ErrStreamNotFound):
+			_, err = js.AddStream(cfg)
+		case err != nil:
+		case info.Config.Storage != cfg.Storage:
+			log.WithField("stream", s.Name).Info("Recreating JetStream stream for the new storage")
+			if err = js.DeleteStream(s.Name); err == nil {
+				_, err = js.AddStream(cfg)
+			}
+		default:
+			_, err = js.UpdateStream(cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply JetStream stream %s: %w", s.Name, err)
+		}
+
+		for j := range s.Consumers {
+			cfg := jetStreamConsumerConfig(&s.Consumers[j])
+			_, err := js.ConsumerInfo(s.Name, cfg.Durable)
+			if errors.Is(err, nats.ErrConsumerNotFound) {
+				_, err = js.AddConsumer(s.Name, cfg)
+			} else if err == nil {
+				_, err = js.UpdateConsumer(s.Name, cfg)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to apply JetStream consumer %s of stream %s: %w", cfg.Durable, s.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileJetStream creates or updates the JetStream streams and consumers of the Vizier. NATS may still be
+// starting up after a deploy, so connecting is retried.
+func (r *VizierReconciler) reconcileJetStream(ctx context.Context, namespace string, vz *v1alpha1.Vizier) error {
+	if !jetStreamEnabled(vz) || len(vz.Spec.JetStream.Streams) == 0 {
+		return nil
+	}
+	log.Info("Reconciling JetStream streams")
+
+	bOpts := backoff.NewExponentialBackOff()
+	bOpts.InitialInterval = 5 * time.Second
+	bOpts.MaxElapsedTime = 3 * time.Minute
+
+	return backoff.Retry(func() error {
+		nc, err := connectVizierNATS(ctx, r.Clientset, namespace, vz)
+		if err != nil {
+			log.WithError(err).Info("Failed to connect to NATS, retrying")
+			return err
+		}
+		defer nc.Close()
+		js, err := nc.JetStream()
+		if err != nil {
+			return err
+		}
+		return applyJetStreamStreams(js, vz)
+	}, bOpts)
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const natsYAML = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nats-config
+data:
+  nats.conf: |
+    http: 8222
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: pl-nats
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: pl-nats
+        volumeMounts:
+        - name: config-volume
+          mountPath: /etc/nats-config
+`
+
+func jetStreamVizier(params *v1alpha1.JetStreamParams) *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{JetStream: params}}
+}
+
+func TestConfigureNATSJetStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		vz          *v1alpha1.Vizier
+		config      string
+		natsConf    string
+		volumeSize  string
+		expectedErr bool
+	}{
+		{
+			name:     "disabled",
+			vz:       jetStreamVizier(nil),
+			natsConf: "http: 8222\n",
+		},
+		{
+			name:       "file storage",
+			vz:         jetStreamVizier(&v1alpha1.JetStreamParams{Enabled: true, StorageSize: "2Gi"}),
+			config:     "file:2Gi",
+			natsConf:   "http: 8222\n\njetstream {\n  store_dir: \"/data/jetstream\"\n  max_file_store: 2147483648\n  max_memory_store: 0\n}\n",
+			volumeSize: "2Gi",
+		},
+		{
+			name: "memory storage without persistent volumes",
+			vz: &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{
+				UseEtcdOperator: true,
+				JetStream:       &v1alpha1.JetStreamParams{Enabled: true},
+			}},
+			config:   "memory:1Gi",
+			natsConf: "http: 8222\n\njetstream {\n  max_memory_store: 1073741824\n  max_file_store: 0\n}\n",
+		},
+		{
+			name:        "invalid size",
+			vz:          jetStreamVizier(&v1alpha1.JetStreamParams{Enabled: true, StorageSize: "lots"}),
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resources, err := k8s.GetResourcesFromYAML(strings.NewReader(natsYAML))
+			require.NoError(t, err)
+
+			err = configureNATSJetStream(resources, test.vz)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var cm v1.ConfigMap
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.UnstructuredContent(), &cm))
+			assert.Equal(t, test.natsConf, cm.Data[natsConfigKey])
+
+			var ss appsv1.StatefulSet
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[1].Object.UnstructuredContent(), &ss))
+			assert.Equal(t, test.config, ss.Annotations[jetStreamConfigAnnotation])
+			assert.Equal(t, test.config, ss.Spec.Template.Annotations[jetStreamConfigAnnotation])
+			if test.volumeSize == "" {
+				assert.Empty(t, ss.Spec.VolumeClaimTemplates)
+				assert.Len(t, ss.Spec.Template.Spec.Containers[0].VolumeMounts, 1)
+				return
+			}
+			require.Len(t, ss.Spec.VolumeClaimTemplates, 1)
+			assert.Equal(t, test.volumeSize, ss.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests.Storage().String())
+			require.Len(t, ss.Spec.Template.Spec.Containers[0].VolumeMounts, 2)
+			assert.Equal(t, jetStreamStoreDir, ss.Spec.Template.Spec.Containers[0].VolumeMounts[1].MountPath)
+		})
+	}
+}
+
+func TestMigrateNATSJetStream(t *testing.T) {
+	natsSS := func(config string) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+			Name:        natsStatefulSetName,
+			Namespace:   "pl",
+			Annotations: map[string]string{jetStreamConfigAnnotation: config},
+		}}
+	}
+	pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "nats-js-pl-nats-0", Namespace: "pl"}}
+
+	tests := []struct {
+		name       string
+		oldConfig  string
+		vz         *v1alpha1.Vizier
+		recreated  bool
+		pvcDeleted bool
+	}{
+		{
+			name:      "unchanged",
+			oldConfig: "file:1Gi",
+			vz:        jetStreamVizier(&v1alpha1.JetStreamParams{Enabled: true}),
+		},
+		{
+			name:      "memory resized",
+			oldConfig: "memory:1Gi",
+			vz:        jetStreamVizier(&v1alpha1.JetStreamParams{Enabled: true, Storage: v1alpha1.JetStreamStorageMemory, StorageSize: "2Gi"}),
+		},
+		{
+			name:      "enabled with file storage",
+			oldConfig: "",
+			vz:        jetStreamVizier(&v1alpha1.JetStreamParams{Enabled: true}),
+			recreated: true,
+		},
+		{
+			name:       "file storage resized",
+			oldConfig:  "file:1Gi",
+			vz:         jetStreamVizier(&v1alpha1.JetStreamParams{Enabled: true, StorageSize: "5Gi"}),
+			recreated:  true,
+			pvcDeleted: true,
+		},
+		{
+			name:       "disabled",
+			oldConfig:  "file:1Gi",
+			vz:         jetStreamVizier(&v1alpha1.JetStreamParams{Enabled: false}),
+			recreated:  true,
+			pvcDeleted: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewSimpleClientset(natsSS(test.oldConfig), pvc)
+			require.NoError(t, migrateNATSJetStream(ctx, clientset, "pl", test.vz))
+
+			_, err := clientset.AppsV1().StatefulSets("pl").Get(ctx, natsStatefulSetName, metav1.GetOptions{})
+			assert.Equal(t, test.recreated, k8serrors.IsNotFound(err))
+			_, err = clientset.CoreV1().PersistentVolumeClaims("pl").Get(ctx, pvc.Name, metav1.GetOptions{})
+			assert.Equal(t, test.pvcDeleted, k8serrors.IsNotFound(err))
+		})
+	}
+}
+
+func TestApplyJetStreamStreams(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+
+	vz := jetStreamVizier(&v1alpha1.JetStreamParams{
+		Enabled: true,
+		Streams: []v1alpha1.JetStreamStream{
+			{
+				Name:      "Events",
+				Subjects:  []string{"events.>"},
+				Retention: v1alpha1.JetStreamRetentionWorkQueue,
+				MaxAge:    &metav1.Duration{Duration: time.Hour},
+				Consumers: []v1alpha1.JetStreamConsumer{
+					{Name: "exporter", FilterSubject: "events.>"},
+				},
+			},
+		},
+	})
+	require.NoError(t, applyJetStreamStreams(js, vz))
+
+	info, err := js.StreamInfo("Events")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"events.>"}, info.Config.Subjects)
+	assert.Equal(t, nats.WorkQueuePolicy, info.Config.Retention)
+	assert.Equal(t, nats.FileStorage, info.Config.Storage)
+	assert.Equal(t, time.Hour, info.Config.MaxAge)
+
+	consumer, err := js.ConsumerInfo("Events", "exporter")
+	require.NoError(t, err)
+	assert.Equal(t, nats.AckExplicitPolicy, consumer.Config.AckPolicy)
+	assert.Equal(t, defaultJetStreamAckWait, consumer.Config.AckWait)
+	assert.Equal(t, defaultJetStreamMaxAckPending, consumer.Config.MaxAckPending)
+
+	// Updating the spec updates the stream and consumer.
+	vz.Spec.JetStream.Streams[0].MaxAge = &metav1.Duration{Duration: 2 * time.Hour}
+	vz.Spec.JetStream.Streams[0].Consumers[0].MaxAckPending = 10
+	require.NoError(t, applyJetStreamStreams(js, vz))
+	info, err = js.StreamInfo("Events")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, info.Config.MaxAge)
+	consumer, err = js.ConsumerInfo("Events", "exporter")
+	require.NoError(t, err)
+	assert.Equal(t, 10, consumer.Config.MaxAckPending)
+
+	// Switching the storage recreates the stream.
+	_, err = js.Publish("events.a", []byte("a"))
+	require.NoError(t, err)
+	vz.Spec.JetStream.Storage = v1alpha1.JetStreamStorageMemory
+	require.NoError(t, applyJetStreamStreams(js, vz))
+	info, err = js.StreamInfo("Events")
+	require.NoError(t, err)
+	assert.Equal(t, nats.MemoryStorage, info.Config.Storage)
+	assert.Equal(t, uint64(0), info.State.Msgs)
+	_, err = js.ConsumerInfo("Events", "exporter")
+	assert.NoError(t, err)
+}
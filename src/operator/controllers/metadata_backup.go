@@ -0,0 +1,594 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	metadataStatefulSetName = "vizier-metadata"
+	metadataLabelSelector   = "name=vizier-metadata"
+	metadataPVCName         = "metadata-pv-claim"
+	metadataDir             = "/metadata"
+	// metadataBackupLabel is the label on backup jobs that holds the name of the backup.
+	metadataBackupLabel = "px.dev/metadata-backup"
+	// metadataRestoreAnnotation is the annotation on the metadata pods that holds the name of the backup that
+	// they restore. Changing it restarts the metadata service, which restores the backup before it starts.
+	metadataRestoreAnnotation     = "px.dev/metadata-restore"
+	metadataRestoreContainerName  = "metadata-restore"
+	metadataBackupNamePrefix      = "metadata-"
+	metadataBackupTimeFormat      = "20060102-150405"
+	metadataBackupCheckInterval   = 1 * time.Minute
+	defaultMetadataBackupInterval = 6 * time.Hour
+	// The number of backups kept on a PVC destination if the retention isn't set.
+	defaultMetadataBackupRetention = 7
+	// The number of finished backup jobs that are kept, so that the logs of recent backups can be inspected.
+	metadataBackupJobsKept    = 3
+	metadataBackupJobDeadline = int64(3600)
+	defaultObjectStoreRegion  = "us-east-1"
+	etcdClientCertsSecret     = "etcd-client-tls-certs"
+	// The images used by the backup jobs. They match the images that the Vizier YAMLs use for the same tools.
+	backupToolsImage = "ghcr.io/pixie-io/pixie-oss-pixie-dev-public-curl:multiarch-7.87.0@sha256:f7f265d5c64eb4463a43a99b6bf773f9e61a50aaa7cefaf564f43e42549a01dd"
+	etcdImage        = "gcr.io/pixie-oss/pixie-dev-public/etcd:3.5.9@sha256:e18afc6dda592b426834342393c4c4bd076cb46fa7e10fa7818952cae3047ca9"
+)
+
+func metadataBackupEnabled(vz *v1alpha1.Vizier) bool {
+	return vz.Spec.MetadataBackup != nil && vz.Spec.MetadataBackup.Enabled
+}
+
+func getMetadataBackupInterval(spec *v1alpha1.MetadataBackup) time.Duration {
+	if spec.Interval == nil || spec.Interval.Duration <= 0 {
+		return defaultMetadataBackupInterval
+	}
+	return spec.Interval.Duration
+}
+
+func getMetadataBackupRetention(spec *v1alpha1.MetadataBackup) int32 {
+	if spec.Retention <= 0 {
+		return defaultMetadataBackupRetention
+	}
+	return spec.Retention
+}
+
+// metadataBackupName returns the name of the backup started at the given time. Backup names sort in the order
+// that the backups were taken.
+func metadataBackupName(t time.Time) string {
+	return metadataBackupNamePrefix + t.UTC().Format(metadataBackupTimeFormat)
+}
+
+// metadataBackupTime returns the time that the backup with the given name was started.
+func metadataBackupTime(name string) (time.Time, error) {
+	return time.Parse(metadataBackupTimeFormat, strings.TrimPrefix(name, metadataBackupNamePrefix))
+}
+
+// metadataBackupFile returns the name of the file that holds the backup. Persistent volumes are backed up as an
+// archive, and etcd as an etcd snapshot.
+func metadataBackupFile(vz *v1alpha1.Vizier, name string) string {
+	if vz.Spec.UseEtcdOperator {
+		return name + ".db"
+	}
+	return name + ".tar.gz"
+}
+
+// objectStoreEnv returns the environment variables used by the backup scripts to access the object store.
+func objectStoreEnv(store *v1alpha1.ObjectStoreDestination) []v1.EnvVar {
+	region := store.Region
+	if region == "" {
+		region = defaultObjectStoreRegion
+	}
+	secretEnv := func(key string) v1.EnvVar {
+		return v1.EnvVar{
+			Name: key,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: store.CredentialsSecret},
+					Key:                  key,
+				},
+			},
+		}
+	}
+	return []v1.EnvVar{
+		{Name: "BUCKET_URL", Value: strings.TrimSuffix(store.URL, "/")},
+		{Name: "REGION", Value: region},
+		secretEnv("AWS_ACCESS_KEY_ID"),
+		secretEnv("AWS_SECRET_ACCESS_KEY"),
+	}
+}
+
+// objectStoreCurl is the curl command that signs requests to the object store.
+const objectStoreCurl = `curl -sSf --aws-sigv4 "aws:amz:${REGION}:s3" --user "${AWS_ACCESS_KEY_ID}:${AWS_SECRET_ACCESS_KEY}"`
+
+// metadataBackupJob returns the job that takes the backup with the given name. The snapshot is taken by an init
+// container, and then stored in the destination by the main container.
+func metadataBackupJob(vz *v1alpha1.Vizier, name string) *batchv1.Job {
+	spec := vz.Spec.MetadataBackup
+	env := []v1.EnvVar{
+		{Name: "BACKUP_FILE", Value: metadataBackupFile(vz, name)},
+		{Name: "POD_NAMESPACE", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+	}
+	volumes := []v1.Volume{
+		{Name: "snapshot", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+	}
+	snapshotMount := v1.VolumeMount{Name: "snapshot", MountPath: "/snapshot"}
+
+	var snapshot v1.Container
+	var affinity *v1.Affinity
+	if vz.Spec.UseEtcdOperator {
+		volumes = append(volumes, v1.Volume{
+			Name:         "etcd-client-tls",
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: etcdClientCertsSecret}},
+		})
+		snapshot = v1.Container{
+			Name:  "snapshot",
+			Image: registryImage(vz, etcdImage),
+			Command: []string{
+				"etcdctl",
+				"--endpoints=https://pl-etcd-client.$(POD_NAMESPACE).svc:2379",
+				"--cacert=/certs/etcd-client-ca.crt",
+				"--cert=/certs/etcd-client.crt",
+				"--key=/certs/etcd-client.key",
+				"snapshot", "save", "/snapshot/$(BACKUP_FILE)",
+			},
+			Env: append(env, v1.EnvVar{Name: "ETCDCTL_API", Value: "3"}),
+			VolumeMounts: []v1.VolumeMount{
+				snapshotMount,
+				{Name: "etcd-client-tls", MountPath: "/certs", ReadOnly: true},
+			},
+		}
+	} else {
+		// The archive is taken while the metadata service is running, so it holds the same state as the volume
+		// would after a crash, which the metadata store recovers from.
+		volumes = append(volumes, v1.Volume{
+			Name: "metadata",
+			VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+				ClaimName: metadataPVCName,
+				ReadOnly:  true,
+			}},
+		})
+		snapshot = v1.Container{
+			Name:    "snapshot",
+			Image:   registryImage(vz, backupToolsImage),
+			Command: []string{"sh", "-c", `set -e; tar -czf "/snapshot/${BACKUP_FILE}" -C ` + metadataDir + ` .`},
+			Env:     env,
+			VolumeMounts: []v1.VolumeMount{
+				snapshotMount,
+				{Name: "metadata", MountPath: metadataDir, ReadOnly: true},
+			},
+		}
+		// The metadata volume may only be attached to a single node, so the job must run next to the metadata
+		// service.
+		affinity = &v1.Affinity{
+			PodAffinity: &v1.PodAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": metadataStatefulSetName}},
+					TopologyKey:   "kubernetes.io/hostname",
+				}},
+			},
+		}
+	}
+
+	store := v1.Container{
+		Name:         "store",
+		Image:        registryImage(vz, backupToolsImage),
+		Env:          env,
+		VolumeMounts: []v1.VolumeMount{snapshotMount},
+	}
+	if spec.Destination.ObjectStore != nil {
+		store.Command = []string{"sh", "-c", `set -e; ` + objectStoreCurl + ` -T "/snapshot/${BACKUP_FILE}" "${BUCKET_URL}/${BACKUP_FILE}"`}
+		store.Env = append(store.Env, objectStoreEnv(spec.Destination.ObjectStore)...)
+	} else {
+		store.Command = []string{"sh", "-c", fmt.Sprintf(`set -e; cp "/snapshot/${BACKUP_FILE}" /backups/; cd /backups; `+
+			`ls -1 %s* | sort -r | tail -n +%d | xargs -r rm -f`, metadataBackupNamePrefix, getMetadataBackupRetention(spec)+1)}
+		store.VolumeMounts = append(store.VolumeMounts, v1.VolumeMount{Name: "backups", MountPath: "/backups"})
+		volumes = append(volumes, v1.Volume{
+			Name: "backups",
+			VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+				ClaimName: spec.Destination.PVC,
+			}},
+		})
+	}
+
+	podSpec := v1.PodSpec{
+		RestartPolicy:    v1.RestartPolicyNever,
+		InitContainers:   []v1.Container{snapshot},
+		Containers:       []v1.Container{store},
+		Volumes:          volumes,
+		Affinity:         affinity,
+		ImagePullSecrets: registryPullSecrets(vz),
+	}
+	// The job runs next to the metadata service, so it must tolerate the same taints.
+	if s := vz.Spec.Scheduling; s != nil && s.Metadata != nil {
+		podSpec.Tolerations = append(podSpec.Tolerations, s.Metadata.Tolerations...)
+	}
+	if vz.Spec.Pod != nil {
+		podSpec.Tolerations = append(podSpec.Tolerations, vz.Spec.Pod.Tolerations...)
+		if sc := vz.Spec.Pod.SecurityContext; sc != nil && sc.Enabled {
+			podSpec.SecurityContext = &v1.PodSecurityContext{}
+			if sc.FSGroup != 0 {
+				podSpec.SecurityContext.FSGroup = &sc.FSGroup
+			}
+			if sc.RunAsUser != 0 {
+				podSpec.SecurityContext.RunAsUser = &sc.RunAsUser
+			}
+			if sc.RunAsGroup != 0 {
+				podSpec.SecurityContext.RunAsGroup = &sc.RunAsGroup
+			}
+		}
+	}
+
+	backoffLimit := int32(2)
+	deadline := metadataBackupJobDeadline
+	labels := map[string]string{metadataBackupLabel: name}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vizier-" + name,
+			Namespace: vz.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
+
+// metadataBackupJobPhase returns the phase of the backup taken by the job, and the reason that it failed.
+func metadataBackupJobPhase(job *batchv1.Job) (v1alpha1.MetadataBackupPhase, string) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return v1alpha1.MetadataBackupPhaseSucceeded, ""
+		case batchv1.JobFailed:
+			return v1alpha1.MetadataBackupPhaseFailed, c.Message
+		}
+	}
+	if job.Status.Succeeded > 0 {
+		return v1alpha1.MetadataBackupPhaseSucceeded, ""
+	}
+	return v1alpha1.MetadataBackupPhaseRunning, ""
+}
+
+// metadataBackupper takes backups of the metadata store, and tracks the progress of restores.
+type metadataBackupper struct {
+	clientset kubernetes.Interface
+}
+
+func newMetadataBackupper(clientset kubernetes.Interface) *metadataBackupper {
+	return &metadataBackupper{clientset: clientset}
+}
+
+// listBackupJobs returns the backup jobs of the Vizier, from the most recent to the oldest.
+func (b *metadataBackupper) listBackupJobs(ctx context.Context, namespace string) ([]batchv1.Job, error) {
+	jobs, err := b.clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: metadataBackupLabel})
+	if err != nil {
+		return nil, err
+	}
+	items := jobs.Items
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Labels[metadataBackupLabel] > items[j].Labels[metadataBackupLabel]
+	})
+	return items, nil
+}
+
+// updateBackups starts a new backup if one is due, deletes old backup jobs, and updates the backup status.
+func (b *metadataBackupper) updateBackups(ctx context.Context, vz *v1alpha1.Vizier, status *v1alpha1.MetadataBackupStatus, now time.Time) error {
+	jobs, err := b.listBackupJobs(ctx, vz.Namespace)
+	if err != nil {
+		return err
+	}
+
+	restoring := status.Restore != nil && status.Restore.Phase == v1alpha1.MetadataBackupPhaseRunning
+	due := true
+	if len(jobs) > 0 {
+		if phase, _ := metadataBackupJobPhase(&jobs[0]); phase == v1alpha1.MetadataBackupPhaseRunning {
+			due = false
+		}
+		if started, err := metadataBackupTime(jobs[0].Labels[metadataBackupLabel]); err == nil &&
+			now.Sub(started) < getMetadataBackupInterval(vz.Spec.MetadataBackup) {
+			due = false
+		}
+	}
+	if due && !restoring {
+		job := metadataBackupJob(vz, metadataBackupName(now))
+		log.WithField("backup", job.Labels[metadataBackupLabel]).Info("Starting metadata backup")
+		created, err := b.clientset.BatchV1().Jobs(vz.Namespace).Create(ctx, job, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		jobs = append([]batchv1.Job{*created}, jobs...)
+	}
+
+	for i := range jobs {
+		name := jobs[i].Labels[metadataBackupLabel]
+		started, err := metadataBackupTime(name)
+		if err != nil {
+			continue
+		}
+		phase, msg := metadataBackupJobPhase(&jobs[i])
+		if i == 0 {
+			status.LastBackup = name
+			status.LastBackupPhase = phase
+			status.LastBackupTime = &metav1.Time{Time: started}
+			status.Message = msg
+		}
+		if phase == v1alpha1.MetadataBackupPhaseSucceeded && name > status.LastSuccessfulBackup {
+			status.LastSuccessfulBackup = name
+			status.LastSuccessfulBackupTime = &metav1.Time{Time: started}
+		}
+	}
+
+	if len(jobs) <= metadataBackupJobsKept {
+		return nil
+	}
+	propagation := metav1.DeletePropagationBackground
+	for _, job := range jobs[metadataBackupJobsKept:] {
+		if phase, _ := metadataBackupJobPhase(&job); phase == v1alpha1.MetadataBackupPhaseRunning {
+			continue
+		}
+		err := b.clientset.BatchV1().Jobs(vz.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateRestore tracks the progress of the restore in the Vizier spec, by checking the restore init container of
+// the metadata pods.
+func (b *metadataBackupper) updateRestore(ctx context.Context, vz *v1alpha1.Vizier, status *v1alpha1.MetadataBackupStatus, now time.Time) error {
+	if vz.Spec.MetadataRestore == nil || vz.Spec.UseEtcdOperator {
+		return nil
+	}
+	name := vz.Spec.MetadataRestore.BackupName
+	if status.Restore == nil || status.Restore.BackupName != name {
+		status.Restore = &v1alpha1.MetadataRestoreStatus{BackupName: name, Phase: v1alpha1.MetadataBackupPhaseRunning}
+	}
+	if status.Restore.Phase == v1alpha1.MetadataBackupPhaseSucceeded {
+		return nil
+	}
+
+	pods, err := b.clientset.CoreV1().Pods(vz.Namespace).List(ctx, metav1.ListOptions{LabelSelector: metadataLabelSelector})
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		if pod.Annotations[metadataRestoreAnnotation] != name {
+			continue
+		}
+		for _, cs := range pod.Status.InitContainerStatuses {
+			if cs.Name != metadataRestoreContainerName {
+				continue
+			}
+			if t := cs.State.Terminated; t != nil && t.ExitCode == 0 {
+				status.Restore.Phase = v1alpha1.MetadataBackupPhaseSucceeded
+				status.Restore.Message = ""
+				status.Restore.CompletionTime = &metav1.Time{Time: now}
+				return nil
+			}
+			t := cs.State.Terminated
+			if t == nil {
+				t = cs.LastTerminationState.Terminated
+			}
+			if t != nil && t.ExitCode != 0 {
+				status.Restore.Phase = v1alpha1.MetadataBackupPhaseFailed
+				status.Restore.Message = fmt.Sprintf("restore of %s exited with code %d: %s", name, t.ExitCode, t.Message)
+			}
+		}
+	}
+	return nil
+}
+
+// update takes a backup of the Vizier if one is due, and updates the backup and restore status. It returns whether
+// the status changed.
+func (b *metadataBackupper) update(ctx context.Context, vz *v1alpha1.Vizier, now time.Time) (bool, error) {
+	if !metadataBackupEnabled(vz) && vz.Spec.MetadataRestore == nil {
+		return false, nil
+	}
+	status := &v1alpha1.MetadataBackupStatus{}
+	if vz.Status.MetadataBackup != nil {
+		status = vz.Status.MetadataBackup.DeepCopy()
+	}
+
+	if err := b.updateRestore(ctx, vz, status, now); err != nil {
+		return false, err
+	}
+	if metadataBackupEnabled(vz) {
+		if err := b.updateBackups(ctx, vz, status, now); err != nil {
+			return false, err
+		}
+	}
+
+	if reflect.DeepEqual(status, vz.Status.MetadataBackup) {
+		return false, nil
+	}
+	vz.Status.MetadataBackup = status
+	return true, nil
+}
+
+// metadataRestoreContainer returns the init container that restores the backup into the metadata volume, before
+// the metadata service starts. A marker file records that the backup was restored, so that it isn't restored
+// again when the metadata service restarts.
+func metadataRestoreContainer(vz *v1alpha1.Vizier) (v1.Container, []v1.Volume, error) {
+	name := vz.Spec.MetadataRestore.BackupName
+	c := v1.Container{
+		Name:  metadataRestoreContainerName,
+		Image: registryImage(vz, backupToolsImage),
+		Env: []v1.EnvVar{
+			{Name: "BACKUP_NAME", Value: name},
+			{Name: "BACKUP_FILE", Value: metadataBackupFile(vz, name)},
+		},
+		VolumeMounts: []v1.VolumeMount{{Name: "metadata-volume", MountPath: metadataDir}},
+	}
+
+	var volumes []v1.Volume
+	var fetch string
+	dest := vz.Spec.MetadataBackup
+	switch {
+	case dest != nil && dest.Destination.ObjectStore != nil:
+		fetch = objectStoreCurl + ` -o "/restore/${BACKUP_FILE}" "${BUCKET_URL}/${BACKUP_FILE}"; ARCHIVE="/restore/${BACKUP_FILE}"`
+		c.Env = append(c.Env, objectStoreEnv(dest.Destination.ObjectStore)...)
+		c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{Name: "metadata-restore", MountPath: "/restore"})
+		volumes = append(volumes, v1.Volume{Name: "metadata-restore", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+	case dest != nil && dest.Destination.PVC != "":
+		fetch = `ARCHIVE="/backups/${BACKUP_FILE}"`
+		c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{Name: "metadata-backups", MountPath: "/backups", ReadOnly: true})
+		volumes = append(volumes, v1.Volume{
+			Name: "metadata-backups",
+			VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+				ClaimName: dest.Destination.PVC,
+				ReadOnly:  true,
+			}},
+		})
+	default:
+		return c, nil, fmt.Errorf("metadata backup %s can't be restored without a backup destination", name)
+	}
+
+	c.Command = []string{"sh", "-c", strings.Join([]string{
+		`set -e`,
+		`MARKER="` + metadataDir + `/.restored-${BACKUP_NAME}"`,
+		`if [ -f "${MARKER}" ]; then echo "${BACKUP_NAME} was already restored"; exit 0; fi`,
+		fetch,
+		`find ` + metadataDir + ` -mindepth 1 -delete`,
+		`tar -xzf "${ARCHIVE}" -C ` + metadataDir,
+		`touch "${MARKER}"`,
+		`echo "Restored ${BACKUP_NAME}"`,
+	}, "; ")}
+	return c, volumes, nil
+}
+
+// configureMetadataRestore adds the restore init container to the metadata StatefulSet in the resources, if a
+// restore is requested.
+func configureMetadataRestore(resources []*k8s.Resource, vz *v1alpha1.Vizier) error {
+	if vz.Spec.MetadataRestore == nil {
+		return nil
+	}
+	if vz.Spec.UseEtcdOperator {
+		log.Warn("Metadata stored in etcd can't be restored, ignoring metadataRestore")
+		return nil
+	}
+	container, volumes, err := metadataRestoreContainer(vz)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resources {
+		if r.GVK.Kind != "StatefulSet" || r.Object.GetName() != metadataStatefulSetName {
+			continue
+		}
+		obj := r.Object.Object
+		if err := unstructured.SetNestedField(obj, vz.Spec.MetadataRestore.BackupName,
+			"spec", "template", "metadata", "annotations", metadataRestoreAnnotation); err != nil {
+			return err
+		}
+
+		unstructuredContainer, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&container)
+		if err != nil {
+			return err
+		}
+		initContainers, _, err := unstructured.NestedSlice(obj, "spec", "template", "spec", "initContainers")
+		if err != nil {
+			return err
+		}
+		// The restore must run after the other init containers, which wait for the dependencies of the metadata
+		// service to be ready.
+		initContainers = append(initContainers, unstructuredContainer)
+		if err := unstructured.SetNestedSlice(obj, initContainers, "spec", "template", "spec", "initContainers"); err != nil {
+			return err
+		}
+
+		podVolumes, _, err := unstructured.NestedSlice(obj, "spec", "template", "spec", "volumes")
+		if err != nil {
+			return err
+		}
+		for i := range volumes {
+			v, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&volumes[i])
+			if err != nil {
+				return err
+			}
+			podVolumes = append(podVolumes, v)
+		}
+		if err := unstructured.SetNestedSlice(obj, podVolumes, "spec", "template", "spec", "volumes"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupMetadata regularly backs up the metadata store of each Vizier that has metadata backups enabled, and
+// tracks the progress of metadata restores.
+func (r *VizierReconciler) backupMetadata() {
+	b := newMetadataBackupper(r.Clientset)
+	t := time.NewTicker(metadataBackupCheckInterval)
+	defer t.Stop()
+	for range t.C {
+		start := time.Now()
+		var viziersList v1alpha1.VizierList
+		ctx := context.Background()
+		err := r.List(ctx, &viziersList)
+		if err != nil {
+			log.WithError(err).Error("Unable to list the vizier objects")
+			recordLoopError(loopMetadataBackup)
+			continue
+		}
+		for _, vz := range viziersList.Items {
+			if vz.Status.ReconciliationPhase == v1alpha1.ReconciliationPhaseUpdating {
+				continue
+			}
+			changed, err := b.update(ctx, &vz, time.Now())
+			if err != nil {
+				log.WithError(err).Error("Failed to back up metadata")
+				recordLoopError(loopMetadataBackup)
+			}
+			if !changed {
+				continue
+			}
+			err = r.Status().Update(ctx, &vz)
+			if err != nil {
+				log.WithError(err).Error("Unable to update vizier status")
+				recordLoopError(loopMetadataBackup)
+			}
+		}
+		observeLoop(loopMetadataBackup, start)
+	}
+}
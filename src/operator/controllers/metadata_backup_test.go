@@ -0,0 +1,335 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const metadataStatefulSetYAML = `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: vizier-metadata
+spec:
+  template:
+    metadata:
+      labels:
+        name: vizier-metadata
+    spec:
+      initContainers:
+      - name: nats-wait
+        image: curl
+      containers:
+      - name: app
+        volumeMounts:
+        - mountPath: /metadata
+          name: metadata-volume
+      volumes:
+      - name: metadata-volume
+        persistentVolumeClaim:
+          claimName: metadata-pv-claim
+`
+
+func backupVizier(dest v1alpha1.MetadataBackupDestination) *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec: v1alpha1.VizierSpec{
+			MetadataBackup: &v1alpha1.MetadataBackup{
+				Enabled:     true,
+				Interval:    &metav1.Duration{Duration: time.Hour},
+				Destination: dest,
+			},
+		},
+	}
+}
+
+func backupJob(name string, condition batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vizier-" + name,
+			Namespace: "pl",
+			Labels:    map[string]string{metadataBackupLabel: name},
+		},
+	}
+	if condition != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: v1.ConditionTrue, Message: "deadline exceeded"}}
+	}
+	return job
+}
+
+func TestMetadataBackupName(t *testing.T) {
+	now := time.Date(2023, 10, 15, 9, 30, 0, 0, time.UTC)
+	name := metadataBackupName(now)
+	assert.Equal(t, "metadata-20231015-093000", name)
+
+	parsed, err := metadataBackupTime(name)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(parsed))
+}
+
+func TestMetadataBackupJob(t *testing.T) {
+	t.Run("persistent volume to pvc", func(t *testing.T) {
+		vz := backupVizier(v1alpha1.MetadataBackupDestination{PVC: "pixie-backups"})
+		vz.Spec.MetadataBackup.Retention = 3
+		job := metadataBackupJob(vz, "metadata-20231015-093000")
+
+		assert.Equal(t, "vizier-metadata-20231015-093000", job.Name)
+		pod := job.Spec.Template.Spec
+		require.Len(t, pod.InitContainers, 1)
+		assert.Contains(t, pod.InitContainers[0].Command[2], "tar -czf")
+		assert.NotNil(t, pod.Affinity.PodAffinity, "the job must run next to the metadata service")
+		require.Len(t, pod.Containers, 1)
+		assert.Contains(t, pod.Containers[0].Command[2], "tail -n +4")
+
+		claims := make(map[string]bool)
+		for _, v := range pod.Volumes {
+			if v.PersistentVolumeClaim != nil {
+				claims[v.PersistentVolumeClaim.ClaimName] = v.PersistentVolumeClaim.ReadOnly
+			}
+		}
+		assert.Equal(t, map[string]bool{"metadata-pv-claim": true, "pixie-backups": false}, claims)
+	})
+
+	t.Run("etcd to object store", func(t *testing.T) {
+		vz := backupVizier(v1alpha1.MetadataBackupDestination{
+			ObjectStore: &v1alpha1.ObjectStoreDestination{
+				URL:               "https://my-bucket.s3.us-west-2.amazonaws.com/pixie/",
+				Region:            "us-west-2",
+				CredentialsSecret: "bucket-creds",
+			},
+		})
+		vz.Spec.UseEtcdOperator = true
+		vz.Spec.Registry = "registry.example.com"
+		job := metadataBackupJob(vz, "metadata-20231015-093000")
+
+		pod := job.Spec.Template.Spec
+		assert.Nil(t, pod.Affinity)
+		assert.Equal(t, "etcdctl", pod.InitContainers[0].Command[0])
+		assert.True(t, strings.HasPrefix(pod.InitContainers[0].Image, "registry.example.com/gcr.io-pixie-oss-"))
+		assert.Contains(t, pod.Containers[0].Command[2], "--aws-sigv4")
+
+		env := make(map[string]string)
+		for _, e := range pod.Containers[0].Env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				env[e.Name] = e.ValueFrom.SecretKeyRef.Name
+				continue
+			}
+			env[e.Name] = e.Value
+		}
+		assert.Equal(t, "metadata-20231015-093000.db", env["BACKUP_FILE"])
+		assert.Equal(t, "https://my-bucket.s3.us-west-2.amazonaws.com/pixie", env["BUCKET_URL"])
+		assert.Equal(t, "us-west-2", env["REGION"])
+		assert.Equal(t, "bucket-creds", env["AWS_ACCESS_KEY_ID"])
+	})
+}
+
+func TestMetadataBackupper_Update(t *testing.T) {
+	now := time.Date(2023, 10, 15, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		jobs []*batchv1.Job
+		// The name of the backup that is expected to be started, if any.
+		expectedNewBackup      string
+		expectedLastBackup     string
+		expectedPhase          v1alpha1.MetadataBackupPhase
+		expectedLastSuccessful string
+		expectedRemainingJobs  int
+	}{
+		{
+			name:               "first backup",
+			expectedNewBackup:  "metadata-20231015-093000",
+			expectedLastBackup: "metadata-20231015-093000",
+			expectedPhase:      v1alpha1.MetadataBackupPhaseRunning,
+			// The fake clientset doesn't run the job, so it remains running.
+			expectedRemainingJobs: 1,
+		},
+		{
+			name: "backup not due",
+			jobs: []*batchv1.Job{
+				backupJob("metadata-20231015-090000", batchv1.JobComplete),
+			},
+			expectedLastBackup:     "metadata-20231015-090000",
+			expectedPhase:          v1alpha1.MetadataBackupPhaseSucceeded,
+			expectedLastSuccessful: "metadata-20231015-090000",
+			expectedRemainingJobs:  1,
+		},
+		{
+			name: "previous backup still running",
+			jobs: []*batchv1.Job{
+				backupJob("metadata-20231015-060000", ""),
+				backupJob("metadata-20231015-000000", batchv1.JobComplete),
+			},
+			expectedLastBackup:     "metadata-20231015-060000",
+			expectedPhase:          v1alpha1.MetadataBackupPhaseRunning,
+			expectedLastSuccessful: "metadata-20231015-000000",
+			expectedRemainingJobs:  2,
+		},
+		{
+			name: "backup due and old jobs deleted",
+			jobs: []*batchv1.Job{
+				backupJob("metadata-20231015-080000", batchv1.JobFailed),
+				backupJob("metadata-20231015-070000", batchv1.JobComplete),
+				backupJob("metadata-20231015-060000", batchv1.JobComplete),
+				backupJob("metadata-20231015-050000", batchv1.JobComplete),
+			},
+			expectedNewBackup:      "metadata-20231015-093000",
+			expectedLastBackup:     "metadata-20231015-093000",
+			expectedPhase:          v1alpha1.MetadataBackupPhaseRunning,
+			expectedLastSuccessful: "metadata-20231015-070000",
+			expectedRemainingJobs:  metadataBackupJobsKept,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			for _, job := range test.jobs {
+				_, err := clientset.BatchV1().Jobs("pl").Create(context.Background(), job, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			vz := backupVizier(v1alpha1.MetadataBackupDestination{PVC: "pixie-backups"})
+
+			changed, err := newMetadataBackupper(clientset).update(context.Background(), vz, now)
+			require.NoError(t, err)
+			assert.True(t, changed)
+
+			status := vz.Status.MetadataBackup
+			assert.Equal(t, test.expectedLastBackup, status.LastBackup)
+			assert.Equal(t, test.expectedPhase, status.LastBackupPhase)
+			assert.Equal(t, test.expectedLastSuccessful, status.LastSuccessfulBackup)
+
+			jobs, err := clientset.BatchV1().Jobs("pl").List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Len(t, jobs.Items, test.expectedRemainingJobs)
+			if test.expectedNewBackup != "" {
+				_, err := clientset.BatchV1().Jobs("pl").Get(context.Background(), "vizier-"+test.expectedNewBackup, metav1.GetOptions{})
+				assert.NoError(t, err)
+			}
+
+			// Updating again without any changes to the jobs leaves the status unchanged.
+			changed, err = newMetadataBackupper(clientset).update(context.Background(), vz, now)
+			require.NoError(t, err)
+			assert.False(t, changed)
+		})
+	}
+}
+
+func TestMetadataBackupper_UpdateRestore(t *testing.T) {
+	now := time.Date(2023, 10, 15, 9, 30, 0, 0, time.UTC)
+	restorePod := func(state v1.ContainerState) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "vizier-metadata-0",
+				Namespace:   "pl",
+				Labels:      map[string]string{"name": "vizier-metadata"},
+				Annotations: map[string]string{metadataRestoreAnnotation: "metadata-20231015-090000"},
+			},
+			Status: v1.PodStatus{
+				InitContainerStatuses: []v1.ContainerStatus{{Name: metadataRestoreContainerName, State: state}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		pod           *v1.Pod
+		expectedPhase v1alpha1.MetadataBackupPhase
+	}{
+		{
+			name:          "pod not restarted yet",
+			expectedPhase: v1alpha1.MetadataBackupPhaseRunning,
+		},
+		{
+			name:          "restore running",
+			pod:           restorePod(v1.ContainerState{Running: &v1.ContainerStateRunning{}}),
+			expectedPhase: v1alpha1.MetadataBackupPhaseRunning,
+		},
+		{
+			name:          "restore succeeded",
+			pod:           restorePod(v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}),
+			expectedPhase: v1alpha1.MetadataBackupPhaseSucceeded,
+		},
+		{
+			name:          "restore failed",
+			pod:           restorePod(v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1, Message: "not found"}}),
+			expectedPhase: v1alpha1.MetadataBackupPhaseFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			if test.pod != nil {
+				_, err := clientset.CoreV1().Pods("pl").Create(context.Background(), test.pod, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			vz := backupVizier(v1alpha1.MetadataBackupDestination{PVC: "pixie-backups"})
+			vz.Spec.MetadataBackup.Enabled = false
+			vz.Spec.MetadataRestore = &v1alpha1.MetadataRestore{BackupName: "metadata-20231015-090000"}
+
+			_, err := newMetadataBackupper(clientset).update(context.Background(), vz, now)
+			require.NoError(t, err)
+			restore := vz.Status.MetadataBackup.Restore
+			require.NotNil(t, restore)
+			assert.Equal(t, "metadata-20231015-090000", restore.BackupName)
+			assert.Equal(t, test.expectedPhase, restore.Phase)
+		})
+	}
+}
+
+func TestConfigureMetadataRestore(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(metadataStatefulSetYAML))
+	require.NoError(t, err)
+	vz := backupVizier(v1alpha1.MetadataBackupDestination{PVC: "pixie-backups"})
+	vz.Spec.MetadataRestore = &v1alpha1.MetadataRestore{BackupName: "metadata-20231015-090000"}
+
+	require.NoError(t, configureMetadataRestore(resources, vz))
+
+	obj := resources[0].Object.Object
+	annotation, _, err := unstructured.NestedString(obj, "spec", "template", "metadata", "annotations", metadataRestoreAnnotation)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata-20231015-090000", annotation)
+
+	initContainers, _, err := unstructured.NestedSlice(obj, "spec", "template", "spec", "initContainers")
+	require.NoError(t, err)
+	require.Len(t, initContainers, 2)
+	assert.Equal(t, "nats-wait", initContainers[0].(map[string]interface{})["name"])
+	restore := initContainers[1].(map[string]interface{})
+	assert.Equal(t, metadataRestoreContainerName, restore["name"])
+	assert.Contains(t, restore["command"].([]interface{})[2], `ARCHIVE="/backups/${BACKUP_FILE}"`)
+
+	volumes, _, err := unstructured.NestedSlice(obj, "spec", "template", "spec", "volumes")
+	require.NoError(t, err)
+	assert.Len(t, volumes, 2)
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+// The periodic loops that the operator runs next to the controllers. The reconcile duration, errors, and work queue
+// depth of the controllers themselves are already exported by controller-runtime, as
+// controller_runtime_reconcile_time_seconds, controller_runtime_reconcile_errors_total and workqueue_depth.
+const (
+	loopFailedUpdateCheck = "failed_update_check"
+	loopPEMAutoscaling    = "pem_autoscaling"
+	loopMetadataBackup    = "metadata_backup"
+	loopCanaryUpgrade     = "canary_upgrade"
+)
+
+const (
+	podMonitorName = "vizier-operator"
+	// operatorMetricsPortName is the name of the port that the operator serves its metrics on.
+	operatorMetricsPortName = "metrics"
+)
+
+var podMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
+
+var (
+	loopDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pixie_operator_loop_duration_seconds",
+			Help:    "Duration of one run of a periodic operator loop, over all Viziers.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		},
+		[]string{"loop"},
+	)
+	loopErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pixie_operator_loop_errors_total",
+			Help: "Number of errors in the periodic operator loops.",
+		},
+		[]string{"loop"},
+	)
+	vizierPhaseDesc = prometheus.NewDesc("pixie_operator_vizier_phase",
+		"Whether the Vizier is in the phase. Exactly one phase of each Vizier is 1.",
+		[]string{"namespace", "name", "phase"}, nil)
+	vizierReconciliationPhaseDesc = prometheus.NewDesc("pixie_operator_vizier_reconciliation_phase",
+		"Whether the operator's reconciliation of the Vizier is in the phase. Exactly one phase of each Vizier is 1.",
+		[]string{"namespace", "name", "phase"}, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(loopDuration, loopErrors)
+}
+
+// observeLoop records the duration of a run of a periodic loop that started at the given time.
+func observeLoop(loop string, start time.Time) {
+	loopDuration.WithLabelValues(loop).Observe(time.Since(start).Seconds())
+}
+
+// recordLoopError counts an error in a periodic loop.
+func recordLoopError(loop string) {
+	loopErrors.WithLabelValues(loop).Inc()
+}
+
+var (
+	vizierPhases = []v1alpha1.VizierPhase{
+		v1alpha1.VizierPhaseDisconnected, v1alpha1.VizierPhaseHealthy, v1alpha1.VizierPhaseUpdating,
+		v1alpha1.VizierPhaseUnhealthy, v1alpha1.VizierPhaseDegraded,
+	}
+	reconciliationPhases = []v1alpha1.ReconciliationPhase{
+		v1alpha1.ReconciliationPhaseReady, v1alpha1.ReconciliationPhaseUpdating, v1alpha1.ReconciliationPhaseFailed,
+	}
+)
+
+// vizierPhaseCollector reports the phases of the Viziers. The Viziers are read on every scrape, so that deleted
+// Viziers aren't reported.
+type vizierPhaseCollector struct {
+	reader client.Reader
+}
+
+// Describe implements prometheus.Collector.
+func (c *vizierPhaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- vizierPhaseDesc
+	ch <- vizierReconciliationPhaseDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *vizierPhaseCollector) Collect(ch chan<- prometheus.Metric) {
+	var viziers v1alpha1.VizierList
+	if err := c.reader.List(context.Background(), &viziers); err != nil {
+		log.WithError(err).Error("Unable to list the vizier objects for metrics")
+		return
+	}
+	boolToFloat := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	for _, vz := range viziers.Items {
+		for _, p := range vizierPhases {
+			ch <- prometheus.MustNewConstMetric(vizierPhaseDesc, prometheus.GaugeValue,
+				boolToFloat(vz.Status.VizierPhase == p), vz.Namespace, vz.Name, string(p))
+		}
+		for _, p := range reconciliationPhases {
+			ch <- prometheus.MustNewConstMetric(vizierReconciliationPhaseDesc, prometheus.GaugeValue,
+				boolToFloat(vz.Status.ReconciliationPhase == p), vz.Namespace, vz.Name, string(p))
+		}
+	}
+}
+
+func operatorPodMonitor(namespace string) *unstructured.Unstructured {
+	pm := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"name": "vizier-operator"},
+			},
+			"podMetricsEndpoints": []interface{}{
+				map[string]interface{}{"port": operatorMetricsPortName},
+			},
+		},
+	}}
+	pm.SetGroupVersionKind(podMonitorGVK)
+	pm.SetNamespace(namespace)
+	pm.SetName(podMonitorName)
+	pm.SetLabels(map[string]string{"app": "pixie-operator"})
+	return pm
+}
+
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=podmonitors,verbs=get;create;update;delete
+
+// reconcilePodMonitor creates or deletes the PodMonitor of the operator, depending on whether it is enabled. Nothing
+// is done if the Prometheus Operator CRDs aren't installed.
+func reconcilePodMonitor(ctx context.Context, c client.Client, namespace string, enabled bool) error {
+	desired := operatorPodMonitor(namespace)
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(podMonitorGVK)
+	err := c.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if meta.IsNoMatchError(err) {
+		if enabled {
+			log.Info("Not creating a PodMonitor for the operator, the Prometheus Operator CRDs are not installed")
+		}
+		return nil
+	}
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	switch {
+	case enabled && !found:
+		log.WithField("namespace", namespace).Info("Creating PodMonitor for the operator")
+		return c.Create(ctx, desired)
+	case enabled && found:
+		if equality.Semantic.DeepEqual(existing.Object["spec"], desired.Object["spec"]) {
+			return nil
+		}
+		existing.Object["spec"] = desired.Object["spec"]
+		return c.Update(ctx, existing)
+	case !enabled && found:
+		log.WithField("namespace", namespace).Info("Deleting PodMonitor of the operator")
+		return client.IgnoreNotFound(c.Delete(ctx, existing))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestVizierPhaseCollector(t *testing.T) {
+	vz := &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "pl", Name: "pixie"},
+		Status: v1alpha1.VizierStatus{
+			VizierPhase:         v1alpha1.VizierPhaseDegraded,
+			ReconciliationPhase: v1alpha1.ReconciliationPhaseReady,
+		},
+	}
+	c := &vizierPhaseCollector{reader: newFakeClient(t, vz)}
+
+	expected := `
+# HELP pixie_operator_vizier_reconciliation_phase Whether the operator's reconciliation of the Vizier is in the phase. Exactly one phase of each Vizier is 1.
+# TYPE pixie_operator_vizier_reconciliation_phase gauge
+pixie_operator_vizier_reconciliation_phase{name="pixie",namespace="pl",phase="Failed"} 0
+pixie_operator_vizier_reconciliation_phase{name="pixie",namespace="pl",phase="Ready"} 1
+pixie_operator_vizier_reconciliation_phase{name="pixie",namespace="pl",phase="Updating"} 0
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "pixie_operator_vizier_reconciliation_phase"))
+	assert.Equal(t, 8, testutil.CollectAndCount(c))
+	assert.Equal(t, 5, testutil.CollectAndCount(c, "pixie_operator_vizier_phase"))
+}
+
+type noMatchClient struct {
+	client.Client
+}
+
+func (c *noMatchClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return &meta.NoKindMatchError{GroupKind: podMonitorGVK.GroupKind(), SearchedVersions: []string{podMonitorGVK.Version}}
+}
+
+func TestReconcilePodMonitor(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+
+	get := func() (*unstructured.Unstructured, error) {
+		pm := &unstructured.Unstructured{}
+		pm.SetGroupVersionKind(podMonitorGVK)
+		err := c.Get(ctx, client.ObjectKey{Namespace: "px-operator", Name: podMonitorName}, pm)
+		return pm, err
+	}
+
+	// Disabled and missing: nothing to do.
+	require.NoError(t, reconcilePodMonitor(ctx, c, "px-operator", false))
+	_, err := get()
+	require.Error(t, err)
+
+	require.NoError(t, reconcilePodMonitor(ctx, c, "px-operator", true))
+	pm, err := get()
+	require.NoError(t, err)
+	endpoints, _, err := unstructured.NestedSlice(pm.Object, "spec", "podMetricsEndpoints")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"port": "metrics"}}, endpoints)
+
+	// A changed spec is restored.
+	require.NoError(t, unstructured.SetNestedField(pm.Object, "other", "spec", "selector", "matchLabels", "name"))
+	require.NoError(t, c.Update(ctx, pm))
+	require.NoError(t, reconcilePodMonitor(ctx, c, "px-operator", true))
+	pm, err = get()
+	require.NoError(t, err)
+	name, _, _ := unstructured.NestedString(pm.Object, "spec", "selector", "matchLabels", "name")
+	assert.Equal(t, "vizier-operator", name)
+
+	require.NoError(t, reconcilePodMonitor(ctx, c, "px-operator", false))
+	_, err = get()
+	require.Error(t, err)
+
+	// Without the Prometheus Operator CRDs, the PodMonitor is skipped.
+	require.NoError(t, reconcilePodMonitor(ctx, &noMatchClient{Client: c}, "px-operator", true))
+}
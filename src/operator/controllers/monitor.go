@@ -22,7 +22,6 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"io"
 	"net"
@@ -43,11 +42,13 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
 	pixiev1alpha1 "px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/services/clock"
 	"px.dev/pixie/src/shared/status"
 	"px.dev/pixie/src/utils/shared/k8s"
 )
@@ -118,10 +119,14 @@ type VizierMonitor struct {
 	clientset   kubernetes.Interface
 	restConfig  *rest.Config
 	factory     informers.SharedInformerFactory
-	httpClient  HTTPClient
 	ctx         context.Context
 	cancel      func()
 	cloudClient *grpc.ClientConn
+	settings    *OperatorSettings
+
+	// httpClient is replaced when the service certs are renewed, and must only be used through getHTTPClient.
+	httpClient   HTTPClient
+	httpClientMu sync.RWMutex
 
 	namespace         string
 	namespacedName    types.NamespacedName
@@ -135,14 +140,17 @@ type VizierMonitor struct {
 	vzUpdate     func(context.Context, client.Object, ...client.SubResourceUpdateOption) error
 	vzGet        func(context.Context, types.NamespacedName, client.Object, ...client.GetOption) error
 	vzSpecUpdate func(context.Context, client.Object, ...client.UpdateOption) error
+
+	// recorder records an event on the Vizier when its phase changes. If nil, no events are recorded.
+	recorder record.EventRecorder
+	// events publishes a CloudEvent when the Vizier becomes degraded. If nil, no CloudEvents are published.
+	events *LifecycleEventPublisher
 }
 
 // InitAndStartMonitor initializes and starts the status monitor for the Vizier.
 func (m *VizierMonitor) InitAndStartMonitor(cloudClient *grpc.ClientConn) {
 	// Initialize current state.
-	tr := http.DefaultTransport.(*http.Transport).Clone()
-	tr.TLSClientConfig = m.getTLSConfig()
-	m.httpClient = &http.Client{Transport: tr}
+	m.resetHTTPClient()
 	m.cloudClient = cloudClient
 	m.ctx, m.cancel = context.WithCancel(context.Background())
 	m.podStates = &concurrentPodMap{unsafeMap: make(map[string]map[string]*podWrapper)}
@@ -156,7 +164,21 @@ func (m *VizierMonitor) InitAndStartMonitor(cloudClient *grpc.ClientConn) {
 	// Watch for pod updates in the namespace.
 	go m.watchK8sPods()
 
-	m.watchCerts()
+	// Start cert rotator.
+	certStateCh := make(chan *vizierState)
+	certR := &certRotator{
+		clientset:      m.clientset,
+		restConfig:     m.restConfig,
+		namespace:      m.namespace,
+		namespacedName: m.namespacedName,
+		clock:          clock.New(),
+		vzGet:          m.vzGet,
+		vzUpdate:       m.vzUpdate,
+		recorder:       m.recorder,
+		onRotate:       m.resetHTTPClient,
+		state:          certStateCh,
+	}
+	go certR.start(m.ctx)
 
 	// Start PVC monitor.
 	pvcStateCh := make(chan *vizierState)
@@ -178,7 +200,7 @@ func (m *VizierMonitor) InitAndStartMonitor(cloudClient *grpc.ClientConn) {
 
 	// Start goroutine for periodically pinging statusz endpoints and
 	// reconciling the Vizier status.
-	go m.statusAggregator(nodeStateCh, pvcStateCh)
+	go m.statusAggregator(nodeStateCh, pvcStateCh, certStateCh)
 	go m.runReconciler()
 }
 
@@ -227,53 +249,34 @@ func (m *VizierMonitor) watchK8sPods() {
 	informer.Run(stopper)
 }
 
-func (m *VizierMonitor) watchCerts() {
-	err := m.checkCerts()
-	if err != nil {
-		log.WithError(err).Error("Failed to check certs")
-	}
-
-	timer := time.NewTicker(24 * time.Hour)
-	go func() {
-		for {
-			select {
-			case <-m.ctx.Done():
-				log.Info("Received cancel, stopping cert checker")
-				return
-			case <-timer.C:
-				err := m.checkCerts()
-				if err != nil {
-					log.WithError(err).Error("Failed to check certs")
-				}
-			}
-		}
-	}()
+func (m *VizierMonitor) getTLSConfig() *tls.Config {
+	return getVizierTLSConfig(m.clientset, m.namespace)
 }
 
-func (m *VizierMonitor) checkCerts() error {
-	tlsSecret, err := m.clientset.CoreV1().Secrets(m.namespace).Get(context.Background(), "service-tls-certs", metav1.GetOptions{})
-	if err != nil {
-		return err
-	}
-	cert, _ := pem.Decode(tlsSecret.Data["server.crt"])
-	x509cert, err := x509.ParseCertificate(cert.Bytes)
-	if err != nil {
-		log.WithError(err).Error("failed to parse cert")
-		return err
-	}
-	if time.Now().Add(5 * 24 * time.Hour).After(x509cert.NotAfter) {
-		m.certState = &vizierState{Reason: status.TLSCertsExpired}
-		return nil
-	}
-	m.certState = okState()
-	return nil
+// resetHTTPClient creates the client used to check the endpoints of Vizier's pods, so that it trusts the
+// current CA of the Vizier's service certs.
+func (m *VizierMonitor) resetHTTPClient() {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = m.getTLSConfig()
+
+	m.httpClientMu.Lock()
+	defer m.httpClientMu.Unlock()
+	m.httpClient = &http.Client{Transport: tr}
 }
 
-func (m *VizierMonitor) getTLSConfig() *tls.Config {
+func (m *VizierMonitor) getHTTPClient() HTTPClient {
+	m.httpClientMu.RLock()
+	defer m.httpClientMu.RUnlock()
+	return m.httpClient
+}
+
+// getVizierTLSConfig returns the TLS config used to connect to the endpoints of Vizier's pods, which are served
+// with the Vizier's service certs.
+func getVizierTLSConfig(clientset kubernetes.Interface, namespace string) *tls.Config {
 	// This is used as a fallback incase we somehow fail to get the CA for the vizier.
 	fallbackInsecureConfig := &tls.Config{InsecureSkipVerify: true} // lgtm [go/disabled-certificate-check]
 
-	tlsSecret, err := m.clientset.CoreV1().Secrets(m.namespace).Get(context.Background(), "service-tls-certs", metav1.GetOptions{})
+	tlsSecret, err := clientset.CoreV1().Secrets(namespace).Get(context.Background(), "service-tls-certs", metav1.GetOptions{})
 	if err != nil {
 		log.WithError(err).Warn("failed to get certs secret, monitor will use insecure tls to check /statusz")
 		return fallbackInsecureConfig
@@ -292,6 +295,11 @@ func (m *VizierMonitor) getTLSConfig() *tls.Config {
 type vizierState struct {
 	// Reason is the description of the state. Should only be set with values enumerated in `src/shared/status/vzstatus.go`
 	Reason status.VizierReason
+	// Detail is an optional diagnosis that is added to the message of the Degraded condition.
+	Detail string
+
+	// crashLoops are the crashlooping containers that led to this state, if any.
+	crashLoops []crashLoop
 }
 
 func okState() *vizierState {
@@ -509,8 +517,8 @@ func getPEMResourceLimitsState(pods *concurrentPodMap) *vizierState {
 
 // getVizierVersionState gets the version of the running Vizier and compares it to the latest version of Vizier.
 // If the vizier version is more than one major version too old, then the cluster is in a degraded state.
-func getVizierVersionState(atClient cloudpb.ArtifactTrackerClient, vz *pixiev1alpha1.Vizier) *vizierState {
-	latest, err := getLatestVizierVersion(context.Background(), atClient)
+func getVizierVersionState(atClient cloudpb.ArtifactTrackerClient, vz *pixiev1alpha1.Vizier, channel pixiev1alpha1.UpdateChannel) *vizierState {
+	latest, err := getLatestVizierVersion(context.Background(), atClient, channel)
 	if err != nil {
 		log.WithError(err).Error("Failed to get latest vizier version")
 		return nil
@@ -582,13 +590,24 @@ func getPEMCrashingState(pods *concurrentPodMap) *vizierState {
 // getVizierState determines the state of the Vizier instance based on the snapshot
 // of data available at call time. Reports the first state that fails (does not aggregate),
 // otherwise reports a healthy state.
+func (m *VizierMonitor) getVizierVersionState(vz *pixiev1alpha1.Vizier) *vizierState {
+	atClient, closeAT, err := getArtifactTrackerClient(m.settings, m.cloudClient)
+	if err != nil {
+		log.WithError(err).Error("Failed to connect to artifact tracker")
+		return nil
+	}
+	defer closeAT()
+	return getVizierVersionState(atClient, vz, m.settings.UpdateChannel())
+}
+
 func (m *VizierMonitor) getVizierState(vz *pixiev1alpha1.Vizier) *vizierState {
 	// Check the latest vizier version, and current vizier version first. Regardless of
 	// whether the vizier pods are running, we consider the cluster in a degraded state.
-	atClient := cloudpb.NewArtifactTrackerClient(m.cloudClient)
-	vzVersionState := getVizierVersionState(atClient, vz)
-	if vzVersionState != nil && !isOk(vzVersionState) {
-		return vzVersionState
+	if m.settings.FeatureEnabled(pixiev1alpha1.FeatureGateVersionCheck) {
+		vzVersionState := m.getVizierVersionState(vz)
+		if vzVersionState != nil && !isOk(vzVersionState) {
+			return vzVersionState
+		}
 	}
 
 	if !isOk(m.certState) {
@@ -614,7 +633,12 @@ func (m *VizierMonitor) getVizierState(vz *pixiev1alpha1.Vizier) *vizierState {
 		return podState
 	}
 
-	natsState := getNATSState(m.httpClient, m.podStates)
+	var natsState *vizierState
+	if externalNATS(vz) != nil {
+		natsState = getExternalNATSState(m.ctx, m.clientset, m.namespace, vz)
+	} else {
+		natsState = getNATSState(m.getHTTPClient(), m.podStates)
+	}
 	if !isOk(natsState) {
 		return natsState
 	}
@@ -631,12 +655,25 @@ func (m *VizierMonitor) getVizierState(vz *pixiev1alpha1.Vizier) *vizierState {
 		return pemResourceState
 	}
 
+	// PEMsAllFailing is reported over the diagnosis of the crash loops, since the Vizier is unhealthy rather
+	// than degraded, but the diagnosis is kept so that the crash loops can still be remediated.
+	crashLoopState := getCrashLoopState(getCrashLoops(m.podStates))
 	pemCrashingState := getPEMCrashingState(m.podStates)
+	if pemCrashingState.Reason == status.PEMsAllFailing {
+		pemCrashingState.Detail = crashLoopState.Detail
+		pemCrashingState.crashLoops = crashLoopState.crashLoops
+		return pemCrashingState
+	}
+
+	if !isOk(crashLoopState) {
+		return crashLoopState
+	}
+
 	if !isOk(pemCrashingState) {
 		return pemCrashingState
 	}
 
-	ccState := getCloudConnState(m.httpClient, m.podStates)
+	ccState := getCloudConnState(m.getHTTPClient(), m.podStates)
 	if !isOk(ccState) {
 		return ccState
 	}
@@ -644,7 +681,7 @@ func (m *VizierMonitor) getVizierState(vz *pixiev1alpha1.Vizier) *vizierState {
 	return okState()
 }
 
-func (m *VizierMonitor) statusAggregator(nodeStateCh, pvcStateCh <-chan *vizierState) {
+func (m *VizierMonitor) statusAggregator(nodeStateCh, pvcStateCh, certStateCh <-chan *vizierState) {
 	for {
 		select {
 		case <-m.ctx.Done():
@@ -653,6 +690,8 @@ func (m *VizierMonitor) statusAggregator(nodeStateCh, pvcStateCh <-chan *vizierS
 			m.nodeState = u
 		case u := <-pvcStateCh:
 			m.pvcState = u
+		case u := <-certStateCh:
+			m.certState = u
 		}
 
 		vz := &pixiev1alpha1.Vizier{}
@@ -698,6 +737,8 @@ func (m *VizierMonitor) repairVizier(state *vizierState) error {
 		}
 
 		log.Info("Successfully switched to etcd backed metadata store")
+	} else if len(state.crashLoops) > 0 {
+		return m.remediateCrashLoops(state)
 	} else if state.Reason == status.EtcdPodsCrashing {
 		log.Info("Etcd detected to be crashing, attempting to restart etcd")
 		// Delete etcd, deploy will trigger a new statefulset to startup.
@@ -721,38 +762,22 @@ func (m *VizierMonitor) repairVizier(state *vizierState) error {
 			log.WithError(err).Error("Failed to update status with empty checksum")
 			return err
 		}
-	} else if state.Reason == status.TLSCertsExpired {
-		vz := &pixiev1alpha1.Vizier{}
-		err := m.vzGet(context.Background(), m.namespacedName, vz)
-		if err != nil {
-			log.WithError(err).Error("Failed to fetch Vizier")
-			return err
-		}
-
-		err = deployCerts(context.Background(), m.namespace, vz, m.clientset, m.restConfig, true)
-		if err != nil {
-			log.WithError(err).Error("Failed to update certs")
-		}
-		m.certState = okState()
-
-		log.Info("Bouncing Vizier pods to get certs update")
-		err = k8s.DeletePods(m.clientset, m.namespace, "")
-		if err != nil {
-			return err
-		}
 	}
 	return nil
 }
 
 // runReconciler periodically evaluates the state of the Vizier Cluster and sends the state as an update.
 func (m *VizierMonitor) runReconciler() {
-	t := time.NewTicker(statuszCheckInterval)
+	t := time.NewTimer(m.settings.StatusCheckInterval())
+	defer t.Stop()
 	for {
 		select {
 		case <-m.ctx.Done():
 			log.Info("Received cancel, stopping status reconciler")
 			return
 		case <-t.C:
+			// The interval is read on every check, so that changes to the settings are picked up.
+			t.Reset(m.settings.StatusCheckInterval())
 			vz := &pixiev1alpha1.Vizier{}
 			err := m.vzGet(context.Background(), m.namespacedName, vz)
 			if err != nil {
@@ -761,14 +786,25 @@ func (m *VizierMonitor) runReconciler() {
 			}
 
 			vizierState := m.getVizierState(vz)
+			prevPhase := vz.Status.VizierPhase
 			vz.SetStatus(vizierState.Reason)
+			if vizierState.Detail != "" {
+				vz.SetCondition(pixiev1alpha1.VizierConditionDegraded, metav1.ConditionTrue, string(vizierState.Reason),
+					vz.Status.Message+" "+vizierState.Detail)
+			}
+			// The diagnostics are captured before the crash loops are remediated, which restarts the pods.
+			m.captureCrashDiagnostics(vz, vizierState)
+			m.recordPhaseChange(vz, prevPhase)
+			if isDegradedPhase(vz.Status.VizierPhase) && !isDegradedPhase(prevPhase) {
+				m.events.emit(newVizierCloudEvent(cloudEventVizierDegraded, vz))
+			}
 
 			err = m.vzUpdate(context.Background(), vz)
 			if err != nil {
 				log.WithError(err).Error("Failed to update vizier status")
 			}
 
-			if !isOk(vizierState) {
+			if !isOk(vizierState) && m.settings.FeatureEnabled(pixiev1alpha1.FeatureGateAutoRepair) {
 				err := m.repairVizier(vizierState)
 				if err != nil {
 					log.WithError(err).Info("Failed to autorepair vizier")
@@ -778,6 +814,31 @@ func (m *VizierMonitor) runReconciler() {
 	}
 }
 
+// isDegradedPhase returns whether the Vizier is in a phase in which it isn't fully working.
+func isDegradedPhase(phase pixiev1alpha1.VizierPhase) bool {
+	switch phase {
+	case pixiev1alpha1.VizierPhaseDegraded, pixiev1alpha1.VizierPhaseUnhealthy, pixiev1alpha1.VizierPhaseDisconnected:
+		return true
+	}
+	return false
+}
+
+// recordPhaseChange records an event on the Vizier if its phase changed from prevPhase.
+func (m *VizierMonitor) recordPhaseChange(vz *pixiev1alpha1.Vizier, prevPhase pixiev1alpha1.VizierPhase) {
+	if m.recorder == nil || vz.Status.VizierPhase == prevPhase {
+		return
+	}
+	eventType := v1.EventTypeWarning
+	if vz.Status.VizierPhase == pixiev1alpha1.VizierPhaseHealthy {
+		eventType = v1.EventTypeNormal
+	}
+	msg := fmt.Sprintf("Vizier is %s", vz.Status.VizierPhase)
+	if vz.Status.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, vz.Status.Message)
+	}
+	m.recorder.Event(vz, eventType, string(vz.Status.VizierPhase), msg)
+}
+
 // queryPodStatusz returns a pod's self-reported status as served by its statusz endpoint.
 func queryPodStatusz(client HTTPClient, pod *v1.Pod) (bool, string) {
 	// Assume that the statusz endpoint is on the first port in the first container.
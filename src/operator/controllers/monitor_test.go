@@ -32,11 +32,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	testclient "k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
@@ -1067,7 +1069,7 @@ func TestMonitor_getVizierVersionState(t *testing.T) {
 				Status: v1alpha1.VizierStatus{
 					Version: test.currentVersion,
 				},
-			})
+			}, v1alpha1.UpdateChannelAll)
 
 			assert.Equal(t, test.expectedReason, versionState.Reason)
 			assert.Equal(t, test.expectedVizierPhase, v1alpha1.ReasonToPhase(versionState.Reason))
@@ -1391,3 +1393,43 @@ func TestMonitor_repairVizier_consolidateVizierDeployments(t *testing.T) {
 		})
 	}
 }
+
+func TestMonitor_recordPhaseChange(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	m := &VizierMonitor{recorder: recorder}
+
+	vz := &v1alpha1.Vizier{ObjectMeta: metav1.ObjectMeta{Name: "pixie", Generation: 2}}
+	vz.SetStatus(status.CloudConnectorMissing)
+	m.recordPhaseChange(vz, v1alpha1.VizierPhaseHealthy)
+
+	available := meta.FindStatusCondition(vz.Status.Conditions, v1alpha1.VizierConditionAvailable)
+	assert.Equal(t, metav1.ConditionFalse, available.Status)
+	assert.Equal(t, string(status.CloudConnectorMissing), available.Reason)
+	assert.Equal(t, int64(2), available.ObservedGeneration)
+	assert.True(t, meta.IsStatusConditionTrue(vz.Status.Conditions, v1alpha1.VizierConditionDegraded))
+	assert.Equal(t, "Warning Disconnected Vizier is Disconnected: "+status.CloudConnectorMissing.GetMessage(), <-recorder.Events)
+
+	// No event is recorded when the phase does not change.
+	m.recordPhaseChange(vz, v1alpha1.VizierPhaseDisconnected)
+	assert.Len(t, recorder.Events, 0)
+
+	vz.SetStatus("")
+	m.recordPhaseChange(vz, v1alpha1.VizierPhaseDisconnected)
+	assert.True(t, meta.IsStatusConditionTrue(vz.Status.Conditions, v1alpha1.VizierConditionAvailable))
+	assert.True(t, meta.IsStatusConditionFalse(vz.Status.Conditions, v1alpha1.VizierConditionDegraded))
+	assert.Equal(t, "Normal Healthy Vizier is Healthy", <-recorder.Events)
+}
+
+func TestVizier_SetReconciliationPhaseConditions(t *testing.T) {
+	vz := &v1alpha1.Vizier{}
+	vz.SetReconciliationPhase(v1alpha1.ReconciliationPhaseUpdating)
+	vz.SetCondition(v1alpha1.VizierConditionUpdateInProgress, metav1.ConditionTrue, "Updating", "")
+	assert.True(t, meta.IsStatusConditionTrue(vz.Status.Conditions, v1alpha1.VizierConditionProgressing))
+	assert.True(t, meta.IsStatusConditionTrue(vz.Status.Conditions, v1alpha1.VizierConditionUpdateInProgress))
+
+	vz.SetReconciliationPhase(v1alpha1.ReconciliationPhaseFailed)
+	progressing := meta.FindStatusCondition(vz.Status.Conditions, v1alpha1.VizierConditionProgressing)
+	assert.Equal(t, metav1.ConditionFalse, progressing.Status)
+	assert.Equal(t, "Failed", progressing.Reason)
+	assert.True(t, meta.IsStatusConditionFalse(vz.Status.Conditions, v1alpha1.VizierConditionUpdateInProgress))
+}
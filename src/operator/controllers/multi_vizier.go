@@ -0,0 +1,210 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nkeys"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	// vizierNamespaceLabel is the label that the operator adds to the resources of a Vizier when the MultiVizier
+	// feature is enabled, so that the cluster-scoped resources of Viziers with the same name in different
+	// namespaces can be told apart.
+	vizierNamespaceLabel = "vizier-namespace"
+	// eventReasonVizierConflict is the reason of the event recorded when a Vizier isn't deployed because it
+	// conflicts with another Vizier in the cluster.
+	eventReasonVizierConflict = "VizierConflict"
+	// vizierConditionReasonConflict is the reason of the Degraded condition of a Vizier that conflicts with
+	// another Vizier in the cluster.
+	vizierConditionReasonConflict = "VizierConflict"
+)
+
+// namespacedClusterResourceName returns the name of a cluster-scoped resource of the Vizier in the given namespace.
+func namespacedClusterResourceName(name, namespace string) string {
+	return fmt.Sprintf("%s-%s", name, namespace)
+}
+
+// namespaceClusterScopedResources suffixes the names of the cluster roles and cluster role bindings with the
+// namespace of the Vizier, and points the bindings at the renamed roles, so that the resources of Viziers in
+// different namespaces don't collide. Roles that aren't part of the resources, such as the ones that the
+// platform provides, are left alone.
+func namespaceClusterScopedResources(resources []*k8s.Resource, namespace string) error {
+	clusterRoles := make(map[string]bool)
+	for _, r := range resources {
+		if r.GVK.Kind == "ClusterRole" {
+			clusterRoles[r.Object.GetName()] = true
+		}
+	}
+
+	for _, r := range resources {
+		switch r.GVK.Kind {
+		case "ClusterRole", "ClusterRoleBinding":
+			r.Object.SetName(namespacedClusterResourceName(r.Object.GetName(), namespace))
+		}
+		if r.GVK.Kind != "ClusterRoleBinding" && r.GVK.Kind != "RoleBinding" {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(r.Object.Object, "roleRef", "kind")
+		name, _, _ := unstructured.NestedString(r.Object.Object, "roleRef", "name")
+		if kind != "ClusterRole" || !clusterRoles[name] {
+			continue
+		}
+		err := unstructured.SetNestedField(r.Object.Object, namespacedClusterResourceName(name, namespace), "roleRef", "name")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createdBefore returns whether the first Vizier was created before the second. Viziers that were created at
+// the same time are ordered by namespace and name, so that exactly one of them wins a conflict.
+func createdBefore(a, b *v1alpha1.Vizier) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// vizierConflict returns why the Vizier can't be deployed alongside the other Viziers in the cluster, or an
+// empty string if it can. Only one Vizier runs per namespace, and only one per cluster unless the MultiVizier
+// feature is enabled. When two Viziers conflict, the one that was created first is deployed.
+func vizierConflict(ctx context.Context, c client.Reader, clientset kubernetes.Interface, vz *v1alpha1.Vizier, multiVizier bool) (string, error) {
+	var viziers v1alpha1.VizierList
+	if err := c.List(ctx, &viziers); err != nil {
+		return "", err
+	}
+	for i := range viziers.Items {
+		other := &viziers.Items[i]
+		if other.UID == vz.UID || !other.DeletionTimestamp.IsZero() || !createdBefore(other, vz) {
+			continue
+		}
+		if other.Namespace == vz.Namespace {
+			return fmt.Sprintf("Vizier %s already runs in namespace %s. Only one Vizier can run per namespace.", other.Name, other.Namespace), nil
+		}
+		if !multiVizier {
+			return fmt.Sprintf("Vizier %s/%s already runs in this cluster. Enable the %s feature gate in the OperatorConfig to run a Vizier per namespace.",
+				other.Namespace, other.Name, v1alpha1.FeatureGateMultiVizier), nil
+		}
+		msg, err := sharedNATSConflict(ctx, clientset, vz, other)
+		if msg != "" || err != nil {
+			return msg, err
+		}
+	}
+	return "", nil
+}
+
+// sharedNATSConflict returns why the Viziers can't share their external NATS cluster, or an empty string if they
+// can. Viziers that deploy their own NATS servers never share subjects. Viziers that share an external NATS
+// cluster must connect as users of different NATS accounts, since accounts are what keep the subjects and
+// JetStream streams of the Viziers apart.
+func sharedNATSConflict(ctx context.Context, clientset kubernetes.Interface, vz, other *v1alpha1.Vizier) (string, error) {
+	ext, otherExt := externalNATS(vz), externalNATS(other)
+	if ext == nil || otherExt == nil || ext.URL != otherExt.URL {
+		return "", nil
+	}
+	if ext.CredentialsSecret == "" || otherExt.CredentialsSecret == "" {
+		return fmt.Sprintf("Vizier %s/%s uses the same external NATS cluster. Viziers that share a NATS cluster must set nats.external.credentialsSecret to users of different NATS accounts.",
+			other.Namespace, other.Name), nil
+	}
+	account, err := externalNATSAccount(ctx, clientset, vz.Namespace, ext)
+	if err != nil {
+		return "", err
+	}
+	otherAccount, err := externalNATSAccount(ctx, clientset, other.Namespace, otherExt)
+	if err != nil {
+		return "", err
+	}
+	if account == otherAccount {
+		return fmt.Sprintf("Vizier %s/%s connects to the same external NATS cluster with the same NATS account %s. Viziers that share a NATS cluster must use different NATS accounts.",
+			other.Namespace, other.Name, account), nil
+	}
+	return "", nil
+}
+
+// externalNATSAccount returns the NATS account of the user that the Vizier connects to the external NATS
+// cluster as.
+func externalNATSAccount(ctx context.Context, clientset kubernetes.Interface, namespace string, ext *v1alpha1.ExternalNATS) (string, error) {
+	creds, err := getExternalNATSCreds(ctx, clientset, namespace, ext)
+	if err != nil {
+		return "", err
+	}
+	return natsAccountOfCreds(creds)
+}
+
+// natsAccountOfCreds returns the NATS account of the user in the NATS credentials file. The account is the
+// issuer of the user JWT, unless the JWT was issued with a signing key of the account.
+func natsAccountOfCreds(creds []byte) (string, error) {
+	userJWT, err := nkeys.ParseDecoratedJWT(creds)
+	if err != nil {
+		return "", fmt.Errorf("invalid NATS credentials: %w", err)
+	}
+	parts := strings.Split(userJWT, ".")
+	if len(parts) != 3 {
+		return "", errors.New("invalid NATS credentials: malformed user JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid NATS credentials: %w", err)
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+		NATS   struct {
+			IssuerAccount string `json:"issuer_account"`
+		} `json:"nats"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("invalid NATS credentials: %w", err)
+	}
+	if claims.NATS.IssuerAccount != "" {
+		return claims.NATS.IssuerAccount, nil
+	}
+	return claims.Issuer, nil
+}
+
+// addMultiVizierMetadata labels the resources of the Vizier with its namespace. The cluster-scoped resources of
+// Viziers that have the label are suffixed with the namespace.
+func addMultiVizierMetadata(vz *v1alpha1.Vizier) {
+	vz.Spec.Pod.Labels[vizierNamespaceLabel] = vz.Namespace
+}
+
+// isNamespacedVizier returns whether the cluster-scoped resources of the Vizier are suffixed with its namespace.
+func isNamespacedVizier(vz *v1alpha1.Vizier) bool {
+	if vz.Spec.Pod == nil {
+		return false
+	}
+	_, ok := vz.Spec.Pod.Labels[vizierNamespaceLabel]
+	return ok
+}
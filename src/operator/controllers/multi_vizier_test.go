@@ -0,0 +1,266 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const clusterScopedYAML = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: pl-node-view
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: pl-node-view-cluster-binding
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: pl-node-view
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: pl-privileged
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:openshift:scc:privileged
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: pl-node-view-binding
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: pl-node-view
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: pl-node-view
+`
+
+func TestNamespaceClusterScopedResources(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(clusterScopedYAML))
+	require.NoError(t, err)
+	require.NoError(t, namespaceClusterScopedResources(resources, "team-a"))
+
+	var names, roleRefs []string
+	for _, r := range resources {
+		names = append(names, r.GVK.Kind+"/"+r.Object.GetName())
+		if roleRef, ok, _ := unstructured.NestedString(r.Object.Object, "roleRef", "name"); ok {
+			roleRefs = append(roleRefs, roleRef)
+		}
+	}
+	assert.Equal(t, []string{
+		"ClusterRole/pl-node-view-team-a",
+		"ClusterRoleBinding/pl-node-view-cluster-binding-team-a",
+		"RoleBinding/pl-privileged",
+		"RoleBinding/pl-node-view-binding",
+		"ServiceAccount/pl-node-view",
+	}, names)
+	assert.Equal(t, []string{"pl-node-view-team-a", "system:openshift:scc:privileged", "pl-node-view-team-a"}, roleRefs)
+}
+
+func conflictTestVizier(namespace, name string, created time.Time, ext *v1alpha1.ExternalNATS) *v1alpha1.Vizier {
+	vz := &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			UID:               k8stypes.UID(namespace + "/" + name),
+			CreationTimestamp: metav1.NewTime(created),
+		},
+	}
+	if ext != nil {
+		vz.Spec.NATS = &v1alpha1.NATSParams{External: ext}
+	}
+	return vz
+}
+
+func TestVizierConflict(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		other       *v1alpha1.Vizier
+		multiVizier bool
+		conflict    string
+	}{
+		{
+			name:     "no other vizier",
+			conflict: "",
+		},
+		{
+			name:     "older vizier in same namespace",
+			other:    conflictTestVizier("team-a", "other", earlier, nil),
+			conflict: "Vizier other already runs in namespace team-a",
+		},
+		{
+			name:     "newer vizier in same namespace",
+			other:    conflictTestVizier("team-a", "other", now.Add(time.Hour), nil),
+			conflict: "",
+		},
+		{
+			name:     "older vizier in other namespace",
+			other:    conflictTestVizier("team-b", "pixie", earlier, nil),
+			conflict: "Enable the MultiVizier feature gate",
+		},
+		{
+			name:        "older vizier in other namespace with multi vizier",
+			other:       conflictTestVizier("team-b", "pixie", earlier, nil),
+			multiVizier: true,
+			conflict:    "",
+		},
+		{
+			name:     "vizier created at the same time in a later namespace",
+			other:    conflictTestVizier("team-c", "pixie", now, nil),
+			conflict: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vz := conflictTestVizier("team-a", "pixie", now, nil)
+			c := newFakeClient(t, vz)
+			if tc.other != nil {
+				c = newFakeClient(t, vz, tc.other)
+			}
+
+			conflict, err := vizierConflict(context.Background(), c, fake.NewSimpleClientset(), vz, tc.multiVizier)
+			require.NoError(t, err)
+			if tc.conflict == "" {
+				assert.Empty(t, conflict)
+			} else {
+				assert.Contains(t, conflict, tc.conflict)
+			}
+		})
+	}
+}
+
+// testNATSCreds returns a NATS credentials file for a user of the given account. The JWT isn't signed, since
+// only its claims are read.
+func testNATSCreds(t *testing.T, issuer, issuerAccount string) []byte {
+	claims := map[string]interface{}{"iss": issuer, "sub": "UUSER"}
+	if issuerAccount != "" {
+		claims["nats"] = map[string]interface{}{"issuer_account": issuerAccount}
+	}
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	jwt := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ed25519-nkey"}`)),
+		base64.RawURLEncoding.EncodeToString(payload),
+		"c2ln",
+	}, ".")
+	return []byte(fmt.Sprintf("-----BEGIN NATS USER JWT-----\n%s\n------END NATS USER JWT------\n", jwt))
+}
+
+func TestNATSAccountOfCreds(t *testing.T) {
+	account, err := natsAccountOfCreds(testNATSCreds(t, "AACCOUNT", ""))
+	require.NoError(t, err)
+	assert.Equal(t, "AACCOUNT", account)
+
+	account, err = natsAccountOfCreds(testNATSCreds(t, "ASIGNINGKEY", "AACCOUNT"))
+	require.NoError(t, err)
+	assert.Equal(t, "AACCOUNT", account)
+
+	_, err = natsAccountOfCreds([]byte("not a jwt"))
+	assert.Error(t, err)
+}
+
+func TestVizierConflict_SharedExternalNATS(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	credsSecret := func(namespace, account string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "nats-creds"},
+			Data:       map[string][]byte{externalNATSCredsKey: testNATSCreds(t, account, "")},
+		}
+	}
+	external := func(creds string) *v1alpha1.ExternalNATS {
+		return &v1alpha1.ExternalNATS{
+			URL:               "tls://nats.messaging.svc:4222",
+			CredentialsSecret: creds,
+			TLS:               &v1alpha1.ExternalNATSTLS{SecretName: "nats-tls"},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		creds        string
+		otherAccount string
+		conflict     string
+	}{
+		{
+			name:         "different accounts",
+			creds:        "nats-creds",
+			otherAccount: "ATEAMB",
+			conflict:     "",
+		},
+		{
+			name:         "same account",
+			creds:        "nats-creds",
+			otherAccount: "ATEAMA",
+			conflict:     "with the same NATS account ATEAMA",
+		},
+		{
+			name:         "no credentials",
+			creds:        "",
+			otherAccount: "ATEAMB",
+			conflict:     "must set nats.external.credentialsSecret",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vz := conflictTestVizier("team-a", "pixie", now, external(tc.creds))
+			other := conflictTestVizier("team-b", "pixie", now.Add(-time.Hour), external("nats-creds"))
+			clientset := fake.NewSimpleClientset(credsSecret("team-a", "ATEAMA"), credsSecret("team-b", tc.otherAccount))
+
+			conflict, err := vizierConflict(context.Background(), newFakeClient(t, vz, other), clientset, vz, true)
+			require.NoError(t, err)
+			if tc.conflict == "" {
+				assert.Empty(t, conflict)
+			} else {
+				assert.Contains(t, conflict, tc.conflict)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	// natsCredsSecretName is the secret with the NATS operator and account, and the credentials of each
+	// component's user.
+	natsCredsSecretName = "pl-nats-creds"
+	natsOperatorJWTKey  = "operator.jwt"
+	natsAccountJWTKey   = "account.jwt"
+	// natsSystemAccountJWTKey holds the account that the NATS servers use internally, such as for JetStream.
+	natsSystemAccountJWTKey = "system-account.jwt"
+	// natsAccountSeedKey holds the seed of the account, so that users can be added for new components without
+	// changing the account that the NATS servers trust.
+	natsAccountSeedKey       = "account.nk"
+	natsComponentCredsVolume = "nats-creds"
+	natsComponentCredsDir    = "/nats-creds"
+	natsComponentCredsFile   = "nats.creds"
+	// natsAccountAnnotation records the account on the pod templates of NATS and of the components, so that they
+	// are restarted when the account changes.
+	natsAccountAnnotation = "px.dev/nats-account"
+	operatorNATSUser      = "operator"
+)
+
+// natsComponent is a Vizier component with its own NATS user.
+type natsComponent struct {
+	// user is the name of the NATS user, and of its credentials file in the secret.
+	user string
+	// podName is the name label on the pod templates of the component, which is empty for the operator.
+	podName string
+	// issuesAgentCreds is whether the component is given the account seed, to issue the NATS users of the agents.
+	issuesAgentCreds bool
+}
+
+var natsComponents = []natsComponent{
+	{user: "metadata", podName: vizierMetadataLabel, issuesAgentCreds: true},
+	{user: "query-broker", podName: queryBrokerLabel},
+	{user: "cloud-connector", podName: cloudConnName},
+	{user: operatorNATSUser},
+}
+
+// natsAgentPodNames are the name labels on the pod templates of the PEMs and Kelvins. Rather than sharing a user,
+// each agent is issued a user by the metadata service when it starts, that may only subscribe to the agent's own
+// topics. See messagebus.AgentNATSPermissions.
+var natsAgentPodNames = []string{vizierPemLabel, kelvinDeploymentName}
+
+func natsCredsKey(user string) string {
+	return user + ".creds"
+}
+
+// componentCredentialsEnabled returns whether the Vizier components authenticate to the operator's NATS
+// servers with their own users.
+func componentCredentialsEnabled(vz *v1alpha1.Vizier) bool {
+	return vz.Spec.NATS != nil && vz.Spec.NATS.ComponentCredentials && vz.Spec.NATS.External == nil
+}
+
+// natsCredentials are the NATS operator and accounts that the NATS servers trust, and the credentials files of
+// the component users, keyed by user.
+type natsCredentials struct {
+	operatorJWT      string
+	accountJWT       string
+	accountKey       string
+	systemAccountJWT string
+	systemAccountKey string
+	creds            map[string][]byte
+}
+
+// generateNATSAccount generates the secret data with a new NATS operator, the account that the component users
+// belong to, and the system account of the servers. JetStream is enabled for the account, which is limited by
+// the servers' JetStream config.
+func generateNATSAccount() (map[string][]byte, error) {
+	operatorKP, err := nkeys.CreateOperator()
+	if err != nil {
+		return nil, err
+	}
+	operatorKey, err := operatorKP.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	systemKP, err := nkeys.CreateAccount()
+	if err != nil {
+		return nil, err
+	}
+	systemKey, err := systemKP.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	systemClaims := jwt.NewAccountClaims(systemKey)
+	systemClaims.Name = "SYS"
+	systemJWT, err := systemClaims.Encode(operatorKP)
+	if err != nil {
+		return nil, err
+	}
+
+	operatorClaims := jwt.NewOperatorClaims(operatorKey)
+	operatorClaims.Name = "pixie"
+	operatorClaims.SystemAccount = systemKey
+	operatorJWT, err := operatorClaims.Encode(operatorKP)
+	if err != nil {
+		return nil, err
+	}
+
+	accountKP, err := nkeys.CreateAccount()
+	if err != nil {
+		return nil, err
+	}
+	accountKey, err := accountKP.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	accountSeed, err := accountKP.Seed()
+	if err != nil {
+		return nil, err
+	}
+	accountClaims := jwt.NewAccountClaims(accountKey)
+	accountClaims.Name = "vizier"
+	accountClaims.Limits.JetStreamLimits = jwt.JetStreamLimits{
+		MemoryStorage: jwt.NoLimit,
+		DiskStorage:   jwt.NoLimit,
+		Streams:       jwt.NoLimit,
+		Consumer:      jwt.NoLimit,
+	}
+	accountJWT, err := accountClaims.Encode(operatorKP)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		natsOperatorJWTKey:      []byte(operatorJWT),
+		natsAccountJWTKey:       []byte(accountJWT),
+		natsAccountSeedKey:      accountSeed,
+		natsSystemAccountJWTKey: []byte(systemJWT),
+	}, nil
+}
+
+// addNATSComponentUsers adds the credentials of the component users that are missing from the secret data,
+// signed by the account. It returns whether any users were added.
+func addNATSComponentUsers(data map[string][]byte) (bool, error) {
+	accountKP, err := nkeys.FromSeed(data[natsAccountSeedKey])
+	if err != nil {
+		return false, fmt.Errorf("invalid NATS account seed in %s: %w", natsCredsSecretName, err)
+	}
+	added := false
+	for _, c := range natsComponents {
+		if len(data[natsCredsKey(c.user)]) != 0 {
+			continue
+		}
+		userKP, err := nkeys.CreateUser()
+		if err != nil {
+			return false, err
+		}
+		userKey, err := userKP.PublicKey()
+		if err != nil {
+			return false, err
+		}
+		userSeed, err := userKP.Seed()
+		if err != nil {
+			return false, err
+		}
+		claims := jwt.NewUserClaims(userKey)
+		claims.Name = c.user
+		userJWT, err := claims.Encode(accountKP)
+		if err != nil {
+			return false, err
+		}
+		creds, err := jwt.FormatUserConfig(userJWT, userSeed)
+		if err != nil {
+			return false, err
+		}
+		data[natsCredsKey(c.user)] = creds
+		added = true
+	}
+	return added, nil
+}
+
+func parseNATSCredentials(data map[string][]byte) (*natsCredentials, error) {
+	accountClaims, err := jwt.DecodeAccountClaims(string(data[natsAccountJWTKey]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS account in %s: %w", natsCredsSecretName, err)
+	}
+	systemClaims, err := jwt.DecodeAccountClaims(string(data[natsSystemAccountJWTKey]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS system account in %s: %w", natsCredsSecretName, err)
+	}
+	creds := &natsCredentials{
+		operatorJWT:      string(data[natsOperatorJWTKey]),
+		accountJWT:       string(data[natsAccountJWTKey]),
+		accountKey:       accountClaims.Subject,
+		systemAccountJWT: string(data[natsSystemAccountJWTKey]),
+		systemAccountKey: systemClaims.Subject,
+		creds:            make(map[string][]byte),
+	}
+	for _, c := range natsComponents {
+		creds.creds[c.user] = data[natsCredsKey(c.user)]
+	}
+	return creds, nil
+}
+
+// readNATSCredentials returns the secret with the NATS credentials, or nil if it doesn't exist yet, along with
+// the credentials of all components. The credentials that are missing from the secret are generated, and
+// whether the secret must be saved is returned.
+func readNATSCredentials(ctx context.Context, clientset kubernetes.Interface, namespace string) (*v1.Secret, map[string][]byte, bool, error) {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, natsCredsSecretName, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, nil, false, err
+	}
+	var data map[string][]byte
+	if err == nil {
+		data = secret.Data
+	} else {
+		secret = nil
+		data, err = generateNATSAccount()
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+	added, err := addNATSComponentUsers(data)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return secret, data, secret == nil || added, nil
+}
+
+// getNATSCredentials returns the NATS credentials of the Vizier components, and saves them in the secret if they
+// are new. It returns nil if the components share the service certs to authenticate.
+func getNATSCredentials(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) (*natsCredentials, error) {
+	if !componentCredentialsEnabled(vz) {
+		return nil, nil
+	}
+	secret, data, changed, err := readNATSCredentials(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case secret == nil:
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: natsCredsSecretName, Namespace: namespace},
+			Data:       data,
+		}
+		if vz.Spec.Pod != nil && len(vz.Spec.Pod.Labels) != 0 {
+			secret.Labels = make(map[string]string)
+			for k, v := range vz.Spec.Pod.Labels {
+				secret.Labels[k] = v
+			}
+		}
+		if _, err := clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+		log.Info("Generated the NATS credentials of the Vizier components")
+	case changed:
+		if _, err := clientset.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return nil, err
+		}
+		log.Info("Added the NATS credentials of new Vizier components")
+	}
+	return parseNATSCredentials(data)
+}
+
+// planNATSCredentials returns the NATS credentials that a deploy of the Vizier would use, without saving the
+// ones that are generated, so that planning has no side effects.
+func planNATSCredentials(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) (*natsCredentials, error) {
+	if !componentCredentialsEnabled(vz) {
+		return nil, nil
+	}
+	_, data, _, err := readNATSCredentials(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return parseNATSCredentials(data)
+}
+
+// natsAuthConfig returns the part of the NATS config that only accepts users of the account.
+func natsAuthConfig(creds *natsCredentials) string {
+	return fmt.Sprintf(`
+operator: %s
+system_account: %s
+resolver: MEMORY
+resolver_preload: {
+  %s: %s
+  %s: %s
+}
+`, creds.operatorJWT, creds.systemAccountKey, creds.systemAccountKey, creds.systemAccountJWT, creds.accountKey, creds.accountJWT)
+}
+
+// configureNATSServerAuth makes the NATS servers in the given resources require the users of the account, on
+// top of the client certs.
+func configureNATSServerAuth(resources []*k8s.Resource, creds *natsCredentials) error {
+	if creds == nil {
+		return nil
+	}
+	for _, r := range resources {
+		obj := r.Object.Object
+		switch {
+		case r.GVK.Kind == "ConfigMap" && r.Object.GetName() == natsConfigMapName:
+			natsConf, _, err := unstructured.NestedString(obj, "data", natsConfigKey)
+			if err != nil {
+				return err
+			}
+			if err := unstructured.SetNestedField(obj, natsConf+natsAuthConfig(creds), "data", natsConfigKey); err != nil {
+				return err
+			}
+		case r.GVK.Kind == "StatefulSet" && r.Object.GetName() == natsStatefulSetName:
+			if err := unstructured.SetNestedField(obj, creds.accountKey, "spec", "template", "metadata", "annotations", natsAccountAnnotation); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// natsCredsPodSpec returns the env and volumes that give the pods with the given name label their NATS credentials,
+// or nil if the pods don't connect to NATS.
+func natsCredsPodSpec(podName string) *v1.PodSpec {
+	credsPath := path.Join(natsComponentCredsDir, natsComponentCredsFile)
+	for _, agentPodName := range natsAgentPodNames {
+		if podName != agentPodName {
+			continue
+		}
+		// The agents store the credentials that they are issued in a volume that only lives as long as the pod.
+		return &v1.PodSpec{
+			Containers: []v1.Container{{
+				Env: []v1.EnvVar{{Name: "PL_NATS_AGENT_CREDS", Value: credsPath}},
+				VolumeMounts: []v1.VolumeMount{{
+					Name:      natsComponentCredsVolume,
+					MountPath: natsComponentCredsDir,
+				}},
+			}},
+			Volumes: []v1.Volume{{
+				Name:         natsComponentCredsVolume,
+				VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory}},
+			}},
+		}
+	}
+
+	for _, c := range natsComponents {
+		if c.podName == "" || podName != c.podName {
+			continue
+		}
+		env := []v1.EnvVar{{Name: "PL_NATS_CREDS", Value: credsPath}}
+		items := []v1.KeyToPath{{Key: natsCredsKey(c.user), Path: natsComponentCredsFile}}
+		if c.issuesAgentCreds {
+			env = append(env, v1.EnvVar{Name: "PL_NATS_ACCOUNT_SEED", Value: path.Join(natsComponentCredsDir, natsAccountSeedKey)})
+			items = append(items, v1.KeyToPath{Key: natsAccountSeedKey, Path: natsAccountSeedKey})
+		}
+		return &v1.PodSpec{
+			Containers: []v1.Container{{
+				Env: env,
+				VolumeMounts: []v1.VolumeMount{{
+					Name:      natsComponentCredsVolume,
+					MountPath: natsComponentCredsDir,
+					ReadOnly:  true,
+				}},
+			}},
+			Volumes: []v1.Volume{{
+				Name: natsComponentCredsVolume,
+				VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+					SecretName: natsCredsSecretName,
+					Items:      items,
+				}},
+			}},
+		}
+	}
+	return nil
+}
+
+// configureNATSComponentCredentials mounts the credentials of each component's user in its pods, from where the
+// components pick them up through PL_NATS_CREDS. The metadata service is also given the account seed, with which
+// it issues the users of the agents, that store them where PL_NATS_AGENT_CREDS points.
+func configureNATSComponentCredentials(resources []*k8s.Resource, creds *natsCredentials) error {
+	if creds == nil {
+		return nil
+	}
+
+	for _, r := range resources {
+		obj := r.Object.Object
+		podName, _, err := unstructured.NestedString(obj, "spec", "template", "metadata", "labels", "name")
+		if err != nil {
+			return err
+		}
+		credsSpec := natsCredsPodSpec(podName)
+		if credsSpec == nil {
+			continue
+		}
+		podSpec := podSpecOfResource(obj)
+		if podSpec == nil {
+			continue
+		}
+
+		spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(credsSpec)
+		if err != nil {
+			return err
+		}
+		container := spec["containers"].([]interface{})[0].(map[string]interface{})
+		env := container["env"].([]interface{})
+		mounts := container["volumeMounts"].([]interface{})
+
+		containers, _ := podSpec["containers"].([]interface{})
+		for _, c := range containers {
+			castedContainer, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			setContainerEnv(castedContainer, env)
+			existingMounts, _ := castedContainer["volumeMounts"].([]interface{})
+			castedContainer["volumeMounts"] = append(existingMounts, mounts...)
+		}
+		existingVolumes, _ := podSpec["volumes"].([]interface{})
+		podSpec["volumes"] = append(existingVolumes, spec["volumes"].([]interface{})...)
+
+		if err := unstructured.SetNestedField(obj, creds.accountKey, "spec", "template", "metadata", "annotations", natsAccountAnnotation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// natsAuthChanged returns whether the account that the running NATS StatefulSet trusts differs from the desired
+// one, including when component credentials are enabled or disabled.
+func natsAuthChanged(current, desired *appsv1.StatefulSet) bool {
+	return current.Spec.Template.Annotations[natsAccountAnnotation] != desired.Spec.Template.Annotations[natsAccountAnnotation]
+}
+
+// natsCredsOption returns the option to connect to NATS with the user JWT and NKey seed of a credentials file.
+func natsCredsOption(creds []byte) (nats.Option, error) {
+	userJWT, err := nkeys.ParseDecoratedJWT(creds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS credentials: %w", err)
+	}
+	kp, err := nkeys.ParseDecoratedNKey(creds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS credentials: %w", err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS credentials: %w", err)
+	}
+	return nats.UserJWTAndSeed(userJWT, string(seed)), nil
+}
+
+// operatorNATSCredsOption returns the option for the operator to connect to NATS with its own user.
+func operatorNATSCredsOption(ctx context.Context, clientset kubernetes.Interface, namespace string) (nats.Option, error) {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, natsCredsSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the NATS credentials secret: %w", err)
+	}
+	creds := secret.Data[natsCredsKey(operatorNATSUser)]
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("the NATS credentials secret %s has no %s", natsCredsSecretName, natsCredsKey(operatorNATSUser))
+	}
+	return natsCredsOption(creds)
+}
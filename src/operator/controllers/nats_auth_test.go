@@ -0,0 +1,297 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+func componentCredentialsVizier() *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec: v1alpha1.VizierSpec{
+			NATS: &v1alpha1.NATSParams{ComponentCredentials: true},
+			Pod:  &v1alpha1.PodPolicy{Labels: map[string]string{operatorAnnotation: "pixie"}},
+		},
+	}
+}
+
+func testNATSCredentials(t *testing.T) *natsCredentials {
+	data, err := generateNATSAccount()
+	require.NoError(t, err)
+	_, err = addNATSComponentUsers(data)
+	require.NoError(t, err)
+	creds, err := parseNATSCredentials(data)
+	require.NoError(t, err)
+	return creds
+}
+
+func TestGetNATSCredentials(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	vz := componentCredentialsVizier()
+
+	creds, err := getNATSCredentials(ctx, clientset, "pl", &v1alpha1.Vizier{})
+	require.NoError(t, err)
+	assert.Nil(t, creds, "no credentials are needed when the components share the service certs")
+
+	planned, err := planNATSCredentials(ctx, clientset, "pl", vz)
+	require.NoError(t, err)
+	require.NotNil(t, planned)
+	_, err = clientset.CoreV1().Secrets("pl").Get(ctx, natsCredsSecretName, metav1.GetOptions{})
+	assert.Error(t, err, "planning must not save the credentials")
+
+	creds, err = getNATSCredentials(ctx, clientset, "pl", vz)
+	require.NoError(t, err)
+	secret, err := clientset.CoreV1().Secrets("pl").Get(ctx, natsCredsSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "pixie", secret.Labels[operatorAnnotation])
+	for _, c := range natsComponents {
+		assert.NotEmpty(t, creds.creds[c.user], c.user)
+		assert.Equal(t, secret.Data[natsCredsKey(c.user)], creds.creds[c.user], c.user)
+	}
+
+	// The credentials are kept, and only the missing ones are added.
+	delete(secret.Data, natsCredsKey("query-broker"))
+	_, err = clientset.CoreV1().Secrets("pl").Update(ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	updated, err := getNATSCredentials(ctx, clientset, "pl", vz)
+	require.NoError(t, err)
+	assert.Equal(t, creds.accountKey, updated.accountKey)
+	assert.Equal(t, creds.creds["metadata"], updated.creds["metadata"])
+	assert.NotEmpty(t, updated.creds["query-broker"])
+	secret, err = clientset.CoreV1().Secrets("pl").Get(ctx, natsCredsSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, updated.creds["query-broker"], secret.Data[natsCredsKey("query-broker")])
+}
+
+func TestConfigureNATSServerAuth(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(natsYAML))
+	require.NoError(t, err)
+	creds := testNATSCredentials(t)
+
+	require.NoError(t, configureNATSServerAuth(resources, creds))
+
+	var cm v1.ConfigMap
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.UnstructuredContent(), &cm))
+	assert.True(t, strings.HasPrefix(cm.Data[natsConfigKey], "http: 8222\n"))
+	assert.Contains(t, cm.Data[natsConfigKey], "operator: "+creds.operatorJWT)
+	assert.Contains(t, cm.Data[natsConfigKey], creds.accountKey+": "+creds.accountJWT)
+
+	var ss appsv1.StatefulSet
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[1].Object.UnstructuredContent(), &ss))
+	assert.Equal(t, creds.accountKey, ss.Spec.Template.Annotations[natsAccountAnnotation])
+
+	unchanged := &appsv1.StatefulSet{}
+	assert.True(t, natsAuthChanged(unchanged, &ss))
+	assert.False(t, natsAuthChanged(&ss, &ss))
+}
+
+func TestConfigureNATSComponentCredentials(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(pemDaemonSetYAML + "---" + metadataStatefulSetYAML + "---" + natsYAML))
+	require.NoError(t, err)
+	creds := testNATSCredentials(t)
+
+	require.NoError(t, configureNATSComponentCredentials(resources, creds))
+
+	containerEnv := func(podTemplate *v1.PodTemplateSpec) map[string]string {
+		env := make(map[string]string)
+		for _, e := range podTemplate.Spec.Containers[0].Env {
+			env[e.Name] = e.Value
+		}
+		return env
+	}
+
+	// The PEMs are issued their users by the metadata service, and store them in a volume of their own.
+	pem := podTemplateOfResource(t, resources[0])
+	assert.Equal(t, creds.accountKey, pem.Annotations[natsAccountAnnotation])
+	assert.Equal(t, "/nats-creds/nats.creds", containerEnv(pem)["PL_NATS_AGENT_CREDS"])
+	assert.NotContains(t, containerEnv(pem), "PL_NATS_CREDS")
+	mounts := pem.Spec.Containers[0].VolumeMounts
+	assert.Equal(t, natsComponentCredsDir, mounts[len(mounts)-1].MountPath)
+	assert.False(t, mounts[len(mounts)-1].ReadOnly)
+	volumes := pem.Spec.Volumes
+	assert.Nil(t, volumes[len(volumes)-1].Secret)
+	assert.NotNil(t, volumes[len(volumes)-1].EmptyDir)
+
+	// The metadata service gets its own user, and the account seed to issue the users of the agents.
+	metadata := podTemplateOfResource(t, resources[1])
+	assert.Equal(t, creds.accountKey, metadata.Annotations[natsAccountAnnotation])
+	env := containerEnv(metadata)
+	assert.Equal(t, "/nats-creds/nats.creds", env["PL_NATS_CREDS"])
+	assert.Equal(t, "/nats-creds/account.nk", env["PL_NATS_ACCOUNT_SEED"])
+	mounts = metadata.Spec.Containers[0].VolumeMounts
+	assert.Equal(t, natsComponentCredsDir, mounts[len(mounts)-1].MountPath)
+	volumes = metadata.Spec.Volumes
+	secret := volumes[len(volumes)-1].Secret
+	require.NotNil(t, secret)
+	assert.Equal(t, natsCredsSecretName, secret.SecretName)
+	assert.Equal(t, []v1.KeyToPath{
+		{Key: "metadata.creds", Path: natsComponentCredsFile},
+		{Key: natsAccountSeedKey, Path: natsAccountSeedKey},
+	}, secret.Items)
+
+	// The NATS servers don't connect to themselves.
+	assert.Empty(t, podTemplateOfResource(t, resources[3]).Spec.Volumes)
+}
+
+// podTemplateOfResource returns the pod template of a workload resource.
+func podTemplateOfResource(t *testing.T, r *k8s.Resource) *v1.PodTemplateSpec {
+	template, ok, err := unstructured.NestedMap(r.Object.Object, "spec", "template")
+	require.NoError(t, err)
+	require.True(t, ok)
+	var podTemplate v1.PodTemplateSpec
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(template, &podTemplate))
+	return &podTemplate
+}
+
+// startAuthNATS starts a NATS server with JetStream, that requires the users of the account.
+func startAuthNATS(t *testing.T, creds *natsCredentials) string {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "nats.conf")
+	config := fmt.Sprintf("listen: 127.0.0.1:-1\njetstream {\n  store_dir: %q\n}\n%s", dir, natsAuthConfig(creds))
+	require.NoError(t, os.WriteFile(conf, []byte(config), 0o600))
+	opts, err := server.ProcessConfigFile(conf)
+	require.NoError(t, err)
+	opts.NoLog = true
+	opts.NoSigs = true
+	s, err := server.NewServer(opts)
+	require.NoError(t, err)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	require.True(t, s.ReadyForConnections(5*time.Second))
+	return s.ClientURL()
+}
+
+func connectAsNATSUser(t *testing.T, url string, creds *natsCredentials, user string) (*nats.Conn, chan error) {
+	return connectWithNATSCreds(t, url, creds.creds[user])
+}
+
+func connectWithNATSCreds(t *testing.T, url string, credsFile []byte) (*nats.Conn, chan error) {
+	errCh := make(chan error, 10)
+	credsOpt, err := natsCredsOption(credsFile)
+	require.NoError(t, err)
+	nc, err := nats.Connect(url, credsOpt, nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+		errCh <- err
+	}))
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+	return nc, errCh
+}
+
+func expectPermissionViolation(t *testing.T, errCh chan error, subject string) {
+	select {
+	case err := <-errCh:
+		assert.Contains(t, err.Error(), "Permissions Violation")
+		assert.Contains(t, err.Error(), subject)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a permissions violation for %s", subject)
+	}
+}
+
+func TestNATSComponentPermissions(t *testing.T) {
+	data, err := generateNATSAccount()
+	require.NoError(t, err)
+	_, err = addNATSComponentUsers(data)
+	require.NoError(t, err)
+	creds, err := parseNATSCredentials(data)
+	require.NoError(t, err)
+	url := startAuthNATS(t, creds)
+
+	_, err = nats.Connect(url)
+	assert.Error(t, err, "clients without a user must be rejected")
+
+	// The operator manages the JetStream streams.
+	operator, _ := connectAsNATSUser(t, url, creds, operatorNATSUser)
+	js, err := operator.JetStream()
+	require.NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "MetadataUpdates", Subjects: []string{"MetadataUpdates.>"}})
+	require.NoError(t, err)
+
+	metadata, _ := connectAsNATSUser(t, url, creds, "metadata")
+	updates, err := metadata.SubscribeSync("UpdateAgent")
+	require.NoError(t, err)
+	require.NoError(t, metadata.Flush())
+
+	// The agents connect with the users that the metadata service issues them with the account seed.
+	account, err := nkeys.FromSeed(data[natsAccountSeedKey])
+	require.NoError(t, err)
+	agentID := uuid.Must(uuid.NewV4())
+	agentCreds, err := messagebus.NewAgentNATSCreds(account, agentID, "10.0.0.1")
+	require.NoError(t, err)
+	pem, pemErrs := connectWithNATSCreds(t, url, agentCreds)
+	agentMsgs, err := pem.SubscribeSync(messagebus.AgentUUIDTopic(agentID))
+	require.NoError(t, err)
+	k8sUpdates, err := pem.SubscribeSync("K8sUpdates/10.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, pem.Publish("UpdateAgent", []byte("heartbeat")))
+	require.NoError(t, pem.Flush())
+	msg, err := updates.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("heartbeat"), msg.Data)
+
+	require.NoError(t, metadata.Publish(messagebus.AgentUUIDTopic(agentID), []byte("ack")))
+	msg, err = agentMsgs.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ack"), msg.Data)
+	require.NoError(t, metadata.Publish("K8sUpdates/10.0.0.1", []byte("update")))
+	msg, err = k8sUpdates.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("update"), msg.Data)
+
+	// PEMs may not impersonate the other components, nor listen in on them or on the other agents.
+	otherAgent := messagebus.AgentUUIDTopic(uuid.Must(uuid.NewV4()))
+	require.NoError(t, pem.Publish(otherAgent, []byte("query")))
+	expectPermissionViolation(t, pemErrs, otherAgent)
+	_, err = pem.SubscribeSync(otherAgent)
+	require.NoError(t, err)
+	expectPermissionViolation(t, pemErrs, otherAgent)
+	_, err = pem.SubscribeSync("K8sUpdates/10.0.0.2")
+	require.NoError(t, err)
+	expectPermissionViolation(t, pemErrs, "K8sUpdates/10.0.0.2")
+	_, err = pem.SubscribeSync("UpdateAgent")
+	require.NoError(t, err)
+	expectPermissionViolation(t, pemErrs, "UpdateAgent")
+	_, err = pem.SubscribeSync("v2c.>")
+	require.NoError(t, err)
+	expectPermissionViolation(t, pemErrs, "v2c.>")
+}
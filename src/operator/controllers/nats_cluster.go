@@ -0,0 +1,217 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	natsPDBName = "pl-nats"
+	// natsMgmtServiceName is the headless service of the NATS servers, which the servers find each other through.
+	natsMgmtServiceName = "pl-nats-mgmt"
+	natsClusterPort     = 6222
+	// natsClusterSizeAnnotation records the number of NATS servers on the pod template, so that the servers are
+	// restarted with the new cluster config when the number changes.
+	natsClusterSizeAnnotation = "px.dev/nats-cluster-size"
+	// natsMinReadySeconds gives a restarted NATS server time to rejoin the cluster and catch up, before the next
+	// server is restarted during a rolling update.
+	natsMinReadySeconds = 30
+	// maxJetStreamStreamReplicas is the number of servers that JetStream streams are replicated to at most.
+	maxJetStreamStreamReplicas = 3
+)
+
+// getNATSReplicas returns the number of NATS servers of the Vizier.
+func getNATSReplicas(vz *v1alpha1.Vizier) int32 {
+	if vz.Spec.NATS == nil || vz.Spec.NATS.Replicas == 0 {
+		return 1
+	}
+	return vz.Spec.NATS.Replicas
+}
+
+// getJetStreamStreamReplicas returns the number of servers that the JetStream streams are replicated to.
+func getJetStreamStreamReplicas(vz *v1alpha1.Vizier) int {
+	replicas := int(getNATSReplicas(vz))
+	if replicas > maxJetStreamStreamReplicas {
+		return maxJetStreamStreamReplicas
+	}
+	return replicas
+}
+
+// natsClusterConfig returns the part of the NATS config that makes the servers form a cluster. The servers
+// discover each other through the headless service, whose name is covered by the service certificates.
+func natsClusterConfig(namespace string) string {
+	return fmt.Sprintf(`
+server_name: $POD_NAME
+cluster {
+  name: pl-nats
+  port: %d
+  routes [
+    nats://%s.%s.svc:%d
+  ]
+  tls {
+    ca_file: "/etc/nats-server-tls-certs/ca.crt",
+    cert_file: "/etc/nats-server-tls-certs/server.crt",
+    key_file: "/etc/nats-server-tls-certs/server.key",
+    timeout: 3
+  }
+  connect_retries: 30
+}
+`, natsClusterPort, natsMgmtServiceName, namespace, natsClusterPort)
+}
+
+func natsPodDisruptionBudget(namespace string) *k8s.Resource {
+	pdb := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"maxUnavailable": int64(1),
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"name": natsStatefulSetName},
+			},
+		},
+	}}
+	gvk := schema.GroupVersionKind{Group: "policy", Version: "v1", Kind: "PodDisruptionBudget"}
+	pdb.SetGroupVersionKind(gvk)
+	pdb.SetNamespace(namespace)
+	pdb.SetName(natsPDBName)
+	pdb.SetLabels(map[string]string{"name": natsStatefulSetName})
+	return &k8s.Resource{Object: pdb, GVK: &gvk}
+}
+
+// configureNATSCluster sets the number of NATS servers in the given resources. With more than one server, the
+// servers are configured to form a cluster, are spread over nodes, and a PodDisruptionBudget is added so that
+// voluntary disruptions such as node drains only take down one server at a time. The StatefulSet rolls out
+// changes one server at a time, so the cluster keeps its quorum during updates.
+func configureNATSCluster(resources []*k8s.Resource, namespace string, vz *v1alpha1.Vizier) ([]*k8s.Resource, error) {
+	replicas := getNATSReplicas(vz)
+	for _, r := range resources {
+		obj := r.Object.Object
+		switch {
+		case r.GVK.Kind == "ConfigMap" && r.Object.GetName() == natsConfigMapName:
+			if replicas == 1 {
+				continue
+			}
+			natsConf, _, err := unstructured.NestedString(obj, "data", natsConfigKey)
+			if err != nil {
+				return nil, err
+			}
+			if err := unstructured.SetNestedField(obj, natsConf+natsClusterConfig(namespace), "data", natsConfigKey); err != nil {
+				return nil, err
+			}
+		case r.GVK.Kind == "StatefulSet" && r.Object.GetName() == natsStatefulSetName:
+			if err := unstructured.SetNestedField(obj, int64(replicas), "spec", "replicas"); err != nil {
+				return nil, err
+			}
+			if err := unstructured.SetNestedField(obj, strconv.Itoa(int(replicas)), "spec", "template", "metadata", "annotations", natsClusterSizeAnnotation); err != nil {
+				return nil, err
+			}
+			if replicas == 1 {
+				continue
+			}
+			if err := unstructured.SetNestedField(obj, int64(natsMinReadySeconds), "spec", "minReadySeconds"); err != nil {
+				return nil, err
+			}
+			if err := spreadNATSServers(obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if replicas == 1 {
+		return resources, nil
+	}
+	return append(resources, natsPodDisruptionBudget(namespace)), nil
+}
+
+// spreadNATSServers prefers scheduling the NATS servers on different nodes, so that losing a node only takes
+// down one server.
+func spreadNATSServers(ss map[string]interface{}) error {
+	podSpec, ok, err := unstructured.NestedFieldNoCopy(ss, "spec", "template", "spec")
+	if err != nil || !ok {
+		return err
+	}
+	podSpecMap, ok := podSpec.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var affinity *v1.Affinity
+	if a, ok := podSpecMap["affinity"].(map[string]interface{}); ok {
+		affinity = &v1.Affinity{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(a, affinity); err != nil {
+			return err
+		}
+	}
+	spread := &v1.Affinity{
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: v1.PodAffinityTerm{
+						LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": natsStatefulSetName}},
+						TopologyKey:   "kubernetes.io/hostname",
+					},
+				},
+			},
+		},
+	}
+	a, err := runtime.DefaultUnstructuredConverter.ToUnstructured(mergeAffinity(affinity, spread))
+	if err != nil {
+		return err
+	}
+	podSpecMap["affinity"] = a
+	return nil
+}
+
+// natsClusterChanged returns whether the number of servers of the running NATS StatefulSet differs from the
+// desired one.
+func natsClusterChanged(current, desired *appsv1.StatefulSet) bool {
+	currentReplicas, desiredReplicas := int32(1), int32(1)
+	if current.Spec.Replicas != nil {
+		currentReplicas = *current.Spec.Replicas
+	}
+	if desired.Spec.Replicas != nil {
+		desiredReplicas = *desired.Spec.Replicas
+	}
+	return currentReplicas != desiredReplicas
+}
+
+// deleteNATSPodDisruptionBudget deletes the PodDisruptionBudget of NATS, which is only needed when there is more
+// than one server.
+func deleteNATSPodDisruptionBudget(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	err := clientset.PolicyV1().PodDisruptionBudgets(namespace).Delete(ctx, natsPDBName, metav1.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err == nil {
+		log.Info("Deleted NATS PodDisruptionBudget")
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+func TestConfigureNATSCluster(t *testing.T) {
+	tests := []struct {
+		name             string
+		nats             *v1alpha1.NATSParams
+		expectedReplicas int32
+	}{
+		{
+			name:             "default",
+			expectedReplicas: 1,
+		},
+		{
+			name:             "cluster",
+			nats:             &v1alpha1.NATSParams{Replicas: 3},
+			expectedReplicas: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resources, err := k8s.GetResourcesFromYAML(strings.NewReader(natsYAML))
+			require.NoError(t, err)
+			vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{NATS: test.nats}}
+
+			resources, err = configureNATSCluster(resources, "pl", vz)
+			require.NoError(t, err)
+
+			var cm v1.ConfigMap
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.UnstructuredContent(), &cm))
+			var ss appsv1.StatefulSet
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[1].Object.UnstructuredContent(), &ss))
+			assert.Equal(t, test.expectedReplicas, *ss.Spec.Replicas)
+
+			if test.expectedReplicas == 1 {
+				assert.Equal(t, "http: 8222\n", cm.Data[natsConfigKey])
+				assert.Nil(t, ss.Spec.Template.Spec.Affinity)
+				assert.Len(t, resources, 2)
+				return
+			}
+
+			assert.Contains(t, cm.Data[natsConfigKey], "server_name: $POD_NAME")
+			assert.Contains(t, cm.Data[natsConfigKey], "nats://pl-nats-mgmt.pl.svc:6222")
+			assert.Equal(t, "3", ss.Spec.Template.Annotations[natsClusterSizeAnnotation])
+			assert.Equal(t, int32(natsMinReadySeconds), ss.Spec.MinReadySeconds)
+			require.NotNil(t, ss.Spec.Template.Spec.Affinity)
+			terms := ss.Spec.Template.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+			require.Len(t, terms, 1)
+			assert.Equal(t, "kubernetes.io/hostname", terms[0].PodAffinityTerm.TopologyKey)
+
+			require.Len(t, resources, 3)
+			var pdb policyv1.PodDisruptionBudget
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[2].Object.UnstructuredContent(), &pdb))
+			assert.Equal(t, natsPDBName, pdb.Name)
+			assert.Equal(t, 1, pdb.Spec.MaxUnavailable.IntValue())
+			assert.Equal(t, map[string]string{"name": natsStatefulSetName}, pdb.Spec.Selector.MatchLabels)
+		})
+	}
+}
+
+func TestNATSClusterChanged(t *testing.T) {
+	replicas := func(n int32) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: &n}}
+	}
+	assert.False(t, natsClusterChanged(replicas(1), &appsv1.StatefulSet{}))
+	assert.False(t, natsClusterChanged(replicas(3), replicas(3)))
+	assert.True(t, natsClusterChanged(replicas(1), replicas(3)))
+}
+
+func TestGetJetStreamStreamReplicas(t *testing.T) {
+	for replicas, expected := range map[int32]int{0: 1, 1: 1, 3: 3, 5: 3} {
+		vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{NATS: &v1alpha1.NATSParams{Replicas: replicas}}}
+		assert.Equal(t, expected, getJetStreamStreamReplicas(vz))
+	}
+}
+
+func TestDeleteNATSPodDisruptionBudget(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "pl", Name: natsPDBName},
+	})
+	require.NoError(t, deleteNATSPodDisruptionBudget(ctx, clientset, "pl"))
+	_, err := clientset.PolicyV1().PodDisruptionBudgets("pl").Get(ctx, natsPDBName, metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// Deleting a missing PodDisruptionBudget is not an error.
+	require.NoError(t, deleteNATSPodDisruptionBudget(ctx, clientset, "pl"))
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"path"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/status"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	externalNATSCredsKey    = "nats.creds"
+	externalNATSCredsVolume = "nats-external-creds"
+	externalNATSCredsDir    = "/nats-external-creds"
+	externalNATSTLSVolume   = "nats-external-tls"
+	externalNATSTLSDir      = "/nats-external-tls"
+	// natsWaitContainerName is the init container that holds Vizier pods back until the operator's NATS servers
+	// are up.
+	natsWaitContainerName = "nats-wait"
+	// eventReasonExternalNATSUnreachable is the reason of the event recorded when the external NATS cluster
+	// can't be connected to during a deploy.
+	eventReasonExternalNATSUnreachable = "ExternalNATSUnreachable"
+)
+
+// externalNATS returns the external NATS cluster of the Vizier, or nil if the operator deploys NATS itself.
+func externalNATS(vz *v1alpha1.Vizier) *v1alpha1.ExternalNATS {
+	if vz.Spec.NATS == nil {
+		return nil
+	}
+	return vz.Spec.NATS.External
+}
+
+// externalNATSEnv returns the env vars that point the Vizier components at the external NATS cluster.
+func externalNATSEnv(ext *v1alpha1.ExternalNATS) []v1.EnvVar {
+	env := []v1.EnvVar{
+		{Name: "PL_NATS_URL", Value: ext.URL},
+		{Name: "PL_NATS_TLS_CA_CERT", Value: path.Join(externalNATSTLSDir, "ca.crt")},
+	}
+	if ext.TLS.ClientAuth {
+		env = append(env,
+			v1.EnvVar{Name: "PL_NATS_TLS_CERT", Value: path.Join(externalNATSTLSDir, "tls.crt")},
+			v1.EnvVar{Name: "PL_NATS_TLS_KEY", Value: path.Join(externalNATSTLSDir, "tls.key")})
+	}
+	if ext.CredentialsSecret != "" {
+		env = append(env, v1.EnvVar{Name: "PL_NATS_CREDS", Value: path.Join(externalNATSCredsDir, externalNATSCredsKey)})
+	}
+	return env
+}
+
+// externalNATSVolumes returns the volumes with the secrets of the external NATS cluster, and where they are
+// mounted in the Vizier containers.
+func externalNATSVolumes(ext *v1alpha1.ExternalNATS) ([]v1.Volume, []v1.VolumeMount) {
+	volumes := []v1.Volume{{
+		Name:         externalNATSTLSVolume,
+		VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: ext.TLS.SecretName}},
+	}}
+	mounts := []v1.VolumeMount{{Name: externalNATSTLSVolume, MountPath: externalNATSTLSDir, ReadOnly: true}}
+	if ext.CredentialsSecret != "" {
+		volumes = append(volumes, v1.Volume{
+			Name:         externalNATSCredsVolume,
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: ext.CredentialsSecret}},
+		})
+		mounts = append(mounts, v1.VolumeMount{Name: externalNATSCredsVolume, MountPath: externalNATSCredsDir, ReadOnly: true})
+	}
+	return volumes, mounts
+}
+
+// setContainerEnv sets the given env vars on the container, replacing any existing vars of the same name.
+func setContainerEnv(container map[string]interface{}, env []interface{}) {
+	names := make(map[string]bool)
+	for _, e := range env {
+		names[e.(map[string]interface{})["name"].(string)] = true
+	}
+	existing, _ := container["env"].([]interface{})
+	merged := make([]interface{}, 0, len(existing)+len(env))
+	for _, e := range existing {
+		if castedEnv, ok := e.(map[string]interface{}); ok {
+			if name, _ := castedEnv["name"].(string); names[name] {
+				continue
+			}
+		}
+		merged = append(merged, e)
+	}
+	container["env"] = append(merged, env...)
+}
+
+// configureExternalNATS points the Vizier components at the external NATS cluster of the Vizier, with its
+// credentials and TLS certs mounted from their secrets. The init containers that wait for the operator's NATS
+// servers are removed, since those servers aren't deployed.
+func configureExternalNATS(resources []*k8s.Resource, vz *v1alpha1.Vizier) error {
+	ext := externalNATS(vz)
+	if ext == nil {
+		return nil
+	}
+	volumes, mounts := externalNATSVolumes(ext)
+	// The additions are converted to their unstructured form through a pod spec that holds all of them.
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&v1.PodSpec{
+		Containers: []v1.Container{{Env: externalNATSEnv(ext), VolumeMounts: mounts}},
+		Volumes:    volumes,
+	})
+	if err != nil {
+		return err
+	}
+	container := spec["containers"].([]interface{})[0].(map[string]interface{})
+	env := container["env"].([]interface{})
+	unstructuredMounts := container["volumeMounts"].([]interface{})
+	unstructuredVolumes := spec["volumes"].([]interface{})
+
+	for _, r := range resources {
+		podSpec := podSpecOfResource(r.Object.Object)
+		if podSpec == nil {
+			continue
+		}
+
+		if initContainers, ok := podSpec["initContainers"].([]interface{}); ok {
+			filtered := make([]interface{}, 0, len(initContainers))
+			for _, c := range initContainers {
+				if castedContainer, ok := c.(map[string]interface{}); ok && castedContainer["name"] == natsWaitContainerName {
+					continue
+				}
+				filtered = append(filtered, c)
+			}
+			podSpec["initContainers"] = filtered
+		}
+
+		containers, _ := podSpec["containers"].([]interface{})
+		for _, c := range containers {
+			castedContainer, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			setContainerEnv(castedContainer, env)
+			existingMounts, _ := castedContainer["volumeMounts"].([]interface{})
+			castedContainer["volumeMounts"] = append(existingMounts, unstructuredMounts...)
+		}
+		existingVolumes, _ := podSpec["volumes"].([]interface{})
+		podSpec["volumes"] = append(existingVolumes, unstructuredVolumes...)
+	}
+	return nil
+}
+
+// externalNATSConnectOptions returns the options for the operator to connect to the external NATS cluster,
+// with the credentials and TLS certs from the secrets in the Vizier namespace.
+func externalNATSConnectOptions(ctx context.Context, clientset kubernetes.Interface, namespace string, ext *v1alpha1.ExternalNATS) ([]nats.Option, error) {
+	tlsSecret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, ext.TLS.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the NATS TLS secret: %w", err)
+	}
+	certPool := x509.NewCertPool()
+	if ok := certPool.AppendCertsFromPEM(tlsSecret.Data["ca.crt"]); !ok {
+		return nil, fmt.Errorf("the NATS TLS secret %s has no valid CA cert in ca.crt", ext.TLS.SecretName)
+	}
+	tlsConfig := &tls.Config{RootCAs: certPool}
+	if ext.TLS.ClientAuth {
+		cert, err := tls.X509KeyPair(tlsSecret.Data["tls.crt"], tlsSecret.Data["tls.key"])
+		if err != nil {
+			return nil, fmt.Errorf("the NATS TLS secret %s has no valid client cert: %w", ext.TLS.SecretName, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	opts := []nats.Option{nats.Secure(tlsConfig), nats.Name("vizier-operator")}
+
+	if ext.CredentialsSecret == "" {
+		return opts, nil
+	}
+	creds, err := getExternalNATSCreds(ctx, clientset, namespace, ext)
+	if err != nil {
+		return nil, err
+	}
+	credsOpt, err := natsCredsOption(creds)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, credsOpt), nil
+}
+
+// getExternalNATSCreds returns the NATS credentials file in the credentials secret of the external NATS cluster.
+func getExternalNATSCreds(ctx context.Context, clientset kubernetes.Interface, namespace string, ext *v1alpha1.ExternalNATS) ([]byte, error) {
+	credsSecret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, ext.CredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the NATS credentials secret: %w", err)
+	}
+	creds := credsSecret.Data[externalNATSCredsKey]
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("the NATS credentials secret %s has no %s", ext.CredentialsSecret, externalNATSCredsKey)
+	}
+	return creds, nil
+}
+
+// checkExternalNATS checks that the operator can connect to the external NATS cluster of the Vizier.
+func checkExternalNATS(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) error {
+	nc, err := connectVizierNATS(ctx, clientset, namespace, vz)
+	if err != nil {
+		return err
+	}
+	nc.Close()
+	return nil
+}
+
+// getExternalNATSState determines the state of the external NATS cluster of the Vizier.
+func getExternalNATSState(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier) *vizierState {
+	if err := checkExternalNATS(ctx, clientset, namespace, vz); err != nil {
+		log.WithError(err).Error("Failed to connect to the external NATS cluster")
+		return &vizierState{Reason: status.ExternalNATSUnreachable}
+	}
+	return okState()
+}
+
+// useExternalNATS replaces the operator's NATS servers with the external NATS cluster of the Vizier. The NATS
+// servers that the operator deployed earlier, if any, are removed. A Vizier that can't reach the external
+// cluster is still deployed, so that it picks the cluster up once it is reachable, and the failure is
+// surfaced as an event and in the Vizier status.
+func (r *VizierReconciler) useExternalNATS(ctx context.Context, namespace string, vz *v1alpha1.Vizier) error {
+	if err := deleteNATSServers(ctx, r.Clientset, namespace); err != nil {
+		return err
+	}
+	if err := checkExternalNATS(ctx, r.Clientset, namespace, vz); err != nil {
+		log.WithError(err).Warn("Failed to connect to the external NATS cluster")
+		r.recordEvent(vz, v1.EventTypeWarning, eventReasonExternalNATSUnreachable,
+			"Failed to connect to the external NATS cluster at %s: %v", externalNATS(vz).URL, err)
+	}
+	return nil
+}
+
+// deleteNATSServers deletes the NATS servers that the operator deployed, along with their PodDisruptionBudget.
+func deleteNATSServers(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	err := clientset.AppsV1().StatefulSets(namespace).Delete(ctx, natsStatefulSetName, metav1.DeleteOptions{})
+	if err == nil {
+		log.Info("Deleted the NATS StatefulSet in favor of the external NATS cluster")
+	} else if !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return deleteNATSPodDisruptionBudget(ctx, clientset, namespace)
+}
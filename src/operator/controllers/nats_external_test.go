@@ -0,0 +1,116 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/status"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+func externalNATSVizier(ext *v1alpha1.ExternalNATS) *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec:       v1alpha1.VizierSpec{NATS: &v1alpha1.NATSParams{External: ext}},
+	}
+}
+
+func TestConfigureExternalNATS(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(metadataStatefulSetYAML))
+	require.NoError(t, err)
+	vz := externalNATSVizier(&v1alpha1.ExternalNATS{
+		URL:               "tls://nats.messaging.svc:4222",
+		CredentialsSecret: "nats-creds",
+		TLS:               &v1alpha1.ExternalNATSTLS{SecretName: "nats-tls", ClientAuth: true},
+	})
+
+	require.NoError(t, configureExternalNATS(resources, vz))
+
+	var ss appsv1.StatefulSet
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.UnstructuredContent(), &ss))
+	pod := ss.Spec.Template.Spec
+	assert.Empty(t, pod.InitContainers, "the nats-wait init container must be removed")
+
+	env := make(map[string]string)
+	for _, e := range pod.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, map[string]string{
+		"PL_NATS_URL":         "tls://nats.messaging.svc:4222",
+		"PL_NATS_TLS_CA_CERT": "/nats-external-tls/ca.crt",
+		"PL_NATS_TLS_CERT":    "/nats-external-tls/tls.crt",
+		"PL_NATS_TLS_KEY":     "/nats-external-tls/tls.key",
+		"PL_NATS_CREDS":       "/nats-external-creds/nats.creds",
+	}, env)
+	assert.Len(t, pod.Containers[0].VolumeMounts, 3)
+
+	secrets := make(map[string]string)
+	for _, v := range pod.Volumes {
+		if v.Secret != nil {
+			secrets[v.Name] = v.Secret.SecretName
+		}
+	}
+	assert.Equal(t, map[string]string{externalNATSTLSVolume: "nats-tls", externalNATSCredsVolume: "nats-creds"}, secrets)
+}
+
+func TestConfigureExternalNATS_NotExternal(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(metadataStatefulSetYAML))
+	require.NoError(t, err)
+
+	require.NoError(t, configureExternalNATS(resources, &v1alpha1.Vizier{}))
+
+	var ss appsv1.StatefulSet
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.UnstructuredContent(), &ss))
+	assert.Len(t, ss.Spec.Template.Spec.InitContainers, 1)
+	assert.Empty(t, ss.Spec.Template.Spec.Containers[0].Env)
+}
+
+func TestGetExternalNATSState_MissingSecret(t *testing.T) {
+	vz := externalNATSVizier(&v1alpha1.ExternalNATS{
+		URL: "tls://nats.messaging.svc:4222",
+		TLS: &v1alpha1.ExternalNATSTLS{SecretName: "nats-tls"},
+	})
+	state := getExternalNATSState(context.Background(), fake.NewSimpleClientset(), "pl", vz)
+	assert.Equal(t, status.ExternalNATSUnreachable, state.Reason)
+}
+
+func TestDeleteNATSServers(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "pl", Name: natsStatefulSetName},
+	})
+	require.NoError(t, deleteNATSServers(ctx, clientset, "pl"))
+	_, err := clientset.AppsV1().StatefulSets("pl").Get(ctx, natsStatefulSetName, metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// Deleting NATS servers that were never deployed is not an error.
+	require.NoError(t, deleteNATSServers(ctx, clientset, "pl"))
+}
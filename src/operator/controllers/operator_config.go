@@ -0,0 +1,215 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+// OperatorSettings holds the operator's own settings, as configured by the OperatorConfig resource.
+// It is safe for concurrent use. A nil *OperatorSettings returns the defaults for every setting.
+type OperatorSettings struct {
+	mu   sync.RWMutex
+	spec v1alpha1.OperatorConfigSpec
+}
+
+// NewOperatorSettings creates settings which use the defaults until an OperatorConfig is applied.
+func NewOperatorSettings() *OperatorSettings {
+	return &OperatorSettings{}
+}
+
+func (s *OperatorSettings) set(spec *v1alpha1.OperatorConfigSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spec = *spec.DeepCopy()
+}
+
+func (s *OperatorSettings) get() v1alpha1.OperatorConfigSpec {
+	if s == nil {
+		return v1alpha1.OperatorConfigSpec{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.spec
+}
+
+func durationOrDefault(d *metav1.Duration, def time.Duration) time.Duration {
+	if d == nil || d.Duration <= 0 {
+		return def
+	}
+	return d.Duration
+}
+
+func (s *OperatorSettings) intervals() v1alpha1.ReconcileIntervals {
+	if i := s.get().ReconcileIntervals; i != nil {
+		return *i
+	}
+	return v1alpha1.ReconcileIntervals{}
+}
+
+// StatusCheckInterval is how often the Vizier pods should be checked for status updates.
+func (s *OperatorSettings) StatusCheckInterval() time.Duration {
+	return durationOrDefault(s.intervals().StatusCheck, statuszCheckInterval)
+}
+
+// UpdateCheckInterval is how often to check whether a Vizier update failed.
+func (s *OperatorSettings) UpdateCheckInterval() time.Duration {
+	return durationOrDefault(s.intervals().UpdateCheck, updatingVizierCheckPeriod)
+}
+
+// UpdateTimeout is how long a Vizier update may run before it is considered failed.
+func (s *OperatorSettings) UpdateTimeout() time.Duration {
+	return durationOrDefault(s.intervals().UpdateTimeout, updatingFailedTimeout)
+}
+
+// ResyncPeriod is how often a Vizier should be reconciled even if it hasn't changed. Zero means never.
+func (s *OperatorSettings) ResyncPeriod() time.Duration {
+	return durationOrDefault(s.get().ResyncPeriod, 0)
+}
+
+// ArtifactMirror is the address of the artifact tracker to use instead of the cloud's, if any.
+func (s *OperatorSettings) ArtifactMirror() string {
+	return s.get().ArtifactMirror
+}
+
+// UpdateChannel is the channel of Vizier releases to pick the latest version from.
+func (s *OperatorSettings) UpdateChannel() v1alpha1.UpdateChannel {
+	return s.get().UpdateChannel
+}
+
+// EventSink is where CloudEvents about Vizier lifecycle changes are published, or nil if they aren't.
+func (s *OperatorSettings) EventSink() *v1alpha1.EventSink {
+	sink := s.get().EventSink
+	if sink == nil || (sink.HTTP == nil) == (sink.NATS == nil) {
+		return nil
+	}
+	return sink
+}
+
+// FeatureEnabled returns whether the given feature gate is enabled.
+func (s *OperatorSettings) FeatureEnabled(gate v1alpha1.FeatureGate) bool {
+	if enabled, ok := s.get().FeatureGates[string(gate)]; ok {
+		return enabled
+	}
+	return v1alpha1.DefaultFeatureGates[gate]
+}
+
+// validateOperatorConfig returns a description of any problems with the given spec, or an empty string.
+func validateOperatorConfig(spec *v1alpha1.OperatorConfigSpec) string {
+	var problems []string
+	var unknown []string
+	for gate := range spec.FeatureGates {
+		if _, ok := v1alpha1.DefaultFeatureGates[v1alpha1.FeatureGate(gate)]; !ok {
+			unknown = append(unknown, gate)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		problems = append(problems, fmt.Sprintf("Unknown feature gates are ignored: %s", strings.Join(unknown, ", ")))
+	}
+	if sink := spec.EventSink; sink != nil && (sink.HTTP == nil) == (sink.NATS == nil) {
+		problems = append(problems, "The event sink must set exactly one of http and nats, so no CloudEvents are published")
+	}
+	return strings.Join(problems, ". ")
+}
+
+// OperatorConfigReconciler applies the OperatorConfig resource to the operator's settings.
+type OperatorConfigReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	Settings *OperatorSettings
+	// Namespace is the namespace that the operator runs in. If it is set, the operator's PodMonitor is managed in
+	// it.
+	Namespace string
+}
+
+// +kubebuilder:rbac:groups=px.dev,resources=operatorconfigs,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=px.dev,resources=operatorconfigs/status,verbs=get;update;patch
+
+// Reconcile updates the operator settings to match the OperatorConfig.
+func (r *OperatorConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Name != v1alpha1.OperatorConfigName {
+		log.WithField("name", req.Name).Infof("Ignoring OperatorConfig, only %q is used", v1alpha1.OperatorConfigName)
+		return ctrl.Result{}, nil
+	}
+
+	var config v1alpha1.OperatorConfig
+	if err := r.Get(ctx, req.NamespacedName, &config); err != nil {
+		if k8serrors.IsNotFound(err) {
+			log.Info("OperatorConfig deleted, reverting to default operator settings")
+			r.Settings.set(&v1alpha1.OperatorConfigSpec{})
+			return ctrl.Result{}, r.reconcilePodMonitor(ctx)
+		}
+		return ctrl.Result{}, err
+	}
+
+	log.WithField("generation", config.Generation).Info("Applying OperatorConfig")
+	r.Settings.set(&config.Spec)
+	if err := r.reconcilePodMonitor(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	msg := validateOperatorConfig(&config.Spec)
+	if msg != "" {
+		log.Warn(msg)
+	}
+	if config.Status.ObservedGeneration == config.Generation && config.Status.Message == msg {
+		return ctrl.Result{}, nil
+	}
+	config.Status.ObservedGeneration = config.Generation
+	config.Status.Message = msg
+	if err := r.Status().Update(ctx, &config); err != nil {
+		log.WithError(err).Error("Failed to update OperatorConfig status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *OperatorConfigReconciler) reconcilePodMonitor(ctx context.Context) error {
+	if r.Namespace == "" {
+		return nil
+	}
+	err := reconcilePodMonitor(ctx, r.Client, r.Namespace, r.Settings.FeatureEnabled(v1alpha1.FeatureGatePodMonitor))
+	if err != nil {
+		log.WithError(err).Error("Failed to update the PodMonitor of the operator")
+	}
+	return err
+}
+
+// SetupWithManager sets up the reconciler.
+func (r *OperatorConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.OperatorConfig{}).
+		Complete(r)
+}
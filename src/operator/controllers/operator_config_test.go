@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	mock_cloudpb "px.dev/pixie/src/api/proto/cloudpb/mock"
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+func TestOperatorSettings(t *testing.T) {
+	var nilSettings *OperatorSettings
+	assert.Equal(t, statuszCheckInterval, nilSettings.StatusCheckInterval())
+	assert.True(t, nilSettings.FeatureEnabled(v1alpha1.FeatureGateAutoRepair))
+
+	s := NewOperatorSettings()
+	assert.Equal(t, statuszCheckInterval, s.StatusCheckInterval())
+	assert.Equal(t, updatingVizierCheckPeriod, s.UpdateCheckInterval())
+	assert.Equal(t, updatingFailedTimeout, s.UpdateTimeout())
+	assert.Equal(t, time.Duration(0), s.ResyncPeriod())
+	assert.True(t, s.FeatureEnabled(v1alpha1.FeatureGateAutoRepair))
+	assert.True(t, s.FeatureEnabled(v1alpha1.FeatureGateVersionCheck))
+
+	s.set(&v1alpha1.OperatorConfigSpec{
+		ReconcileIntervals: &v1alpha1.ReconcileIntervals{
+			StatusCheck:   &metav1.Duration{Duration: 5 * time.Second},
+			UpdateTimeout: &metav1.Duration{Duration: 30 * time.Minute},
+		},
+		ArtifactMirror: "artifacts.example.com:443",
+		UpdateChannel:  v1alpha1.UpdateChannelStable,
+		ResyncPeriod:   &metav1.Duration{Duration: time.Hour},
+		FeatureGates:   map[string]bool{string(v1alpha1.FeatureGateAutoRepair): false},
+	})
+	assert.Equal(t, 5*time.Second, s.StatusCheckInterval())
+	assert.Equal(t, updatingVizierCheckPeriod, s.UpdateCheckInterval())
+	assert.Equal(t, 30*time.Minute, s.UpdateTimeout())
+	assert.Equal(t, time.Hour, s.ResyncPeriod())
+	assert.Equal(t, "artifacts.example.com:443", s.ArtifactMirror())
+	assert.Equal(t, v1alpha1.UpdateChannelStable, s.UpdateChannel())
+	assert.False(t, s.FeatureEnabled(v1alpha1.FeatureGateAutoRepair))
+	assert.True(t, s.FeatureEnabled(v1alpha1.FeatureGateVersionCheck))
+
+	// Reverting to an empty spec restores the defaults.
+	s.set(&v1alpha1.OperatorConfigSpec{})
+	assert.Equal(t, statuszCheckInterval, s.StatusCheckInterval())
+	assert.True(t, s.FeatureEnabled(v1alpha1.FeatureGateAutoRepair))
+}
+
+func TestValidateOperatorConfig(t *testing.T) {
+	assert.Equal(t, "", validateOperatorConfig(&v1alpha1.OperatorConfigSpec{
+		FeatureGates: map[string]bool{"AutoRepair": false},
+	}))
+	assert.Equal(t, "Unknown feature gates are ignored: Bar, Foo", validateOperatorConfig(&v1alpha1.OperatorConfigSpec{
+		FeatureGates: map[string]bool{"Foo": true, "AutoRepair": false, "Bar": true},
+	}))
+	assert.Equal(t, "The event sink must set exactly one of http and nats, so no CloudEvents are published", validateOperatorConfig(&v1alpha1.OperatorConfigSpec{
+		EventSink: &v1alpha1.EventSink{},
+	}))
+}
+
+func TestOperatorSettings_EventSink(t *testing.T) {
+	s := NewOperatorSettings()
+	assert.Nil(t, s.EventSink())
+
+	s.set(&v1alpha1.OperatorConfigSpec{EventSink: &v1alpha1.EventSink{
+		HTTP: &v1alpha1.HTTPEventSink{URL: "http://events.example.com"},
+		NATS: &v1alpha1.NATSEventSink{URL: "nats://nats:4222"},
+	}})
+	assert.Nil(t, s.EventSink())
+
+	s.set(&v1alpha1.OperatorConfigSpec{EventSink: &v1alpha1.EventSink{
+		HTTP: &v1alpha1.HTTPEventSink{URL: "http://events.example.com"},
+	}})
+	assert.Equal(t, "http://events.example.com", s.EventSink().HTTP.URL)
+}
+
+func TestGetLatestVizierVersion_Channels(t *testing.T) {
+	artifacts := &cloudpb.ArtifactSet{
+		Name: "vizier",
+		Artifact: []*cloudpb.Artifact{
+			{VersionStr: "0.12.0-pre-r1.0"},
+			{VersionStr: "0.12.0-pre-r0.0"},
+			{VersionStr: "0.11.5"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		channel         v1alpha1.UpdateChannel
+		expectedLimit   int64
+		expectedVersion string
+	}{
+		{
+			name:            "all",
+			channel:         v1alpha1.UpdateChannelAll,
+			expectedLimit:   1,
+			expectedVersion: "0.12.0-pre-r1.0",
+		},
+		{
+			name:            "prerelease",
+			channel:         v1alpha1.UpdateChannelPrerelease,
+			expectedLimit:   1,
+			expectedVersion: "0.12.0-pre-r1.0",
+		},
+		{
+			name:            "stable",
+			channel:         v1alpha1.UpdateChannelStable,
+			expectedLimit:   stableChannelSearchLimit,
+			expectedVersion: "0.11.5",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			ats := mock_cloudpb.NewMockArtifactTrackerClient(ctrl)
+
+			ats.EXPECT().GetArtifactList(gomock.Any(),
+				&cloudpb.GetArtifactListRequest{
+					ArtifactName: "vizier",
+					ArtifactType: cloudpb.AT_CONTAINER_SET_YAMLS,
+					Limit:        test.expectedLimit,
+				}).
+				Return(artifacts, nil)
+
+			version, err := getLatestVizierVersion(context.Background(), ats, test.channel)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedVersion, version)
+		})
+	}
+}
@@ -0,0 +1,715 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	// pemSizeClassLabel is the node label that holds the PEM size class of the node.
+	pemSizeClassLabel = "px.dev/pem-size-class"
+	pemDaemonSetName  = "vizier-pem"
+	pemContainerName  = "pem"
+	pemLabelSelector  = "name=" + vizierPemLabel
+	// How often the resource usage of PEMs is sampled.
+	pemAutoscalingInterval = 5 * time.Minute
+	// The window over which the peak usage of PEMs is tracked. Resources are only scaled down
+	// once they have been stable for this long.
+	pemUsageWindow = 1 * time.Hour
+	// The headroom added on top of the peak usage.
+	pemUsageHeadroom = 1.25
+	// Resources are only scaled down if the decrease is larger than this fraction.
+	pemScaleDownThreshold = 0.1
+	// The table store is sized to this fraction of the PEM memory, matching the default from the config manager.
+	pemTableStorePercentage = 0.6
+	tableStoreSizePEMFlag   = "PL_TABLE_STORE_DATA_LIMIT_MB"
+)
+
+var (
+	defaultPEMMinMemory            = resource.MustParse("1Gi")
+	defaultPEMMaxMemory            = resource.MustParse("8Gi")
+	defaultPEMMinCPU               = resource.MustParse("100m")
+	defaultPEMMaxCPU               = resource.MustParse("2")
+	defaultPEMMaxNodeMemoryPercent = int32(25)
+)
+
+// pemAutoscalingBounds are the parsed bounds from the PEMAutoscaling spec.
+type pemAutoscalingBounds struct {
+	minMemory            resource.Quantity
+	maxMemory            resource.Quantity
+	minCPU               resource.Quantity
+	maxCPU               resource.Quantity
+	maxNodeMemoryPercent int32
+}
+
+func parseQuantityOrDefault(q string, def resource.Quantity) (resource.Quantity, error) {
+	if q == "" {
+		return def, nil
+	}
+	return resource.ParseQuantity(q)
+}
+
+func getPEMAutoscalingBounds(spec *v1alpha1.PEMAutoscaling) (*pemAutoscalingBounds, error) {
+	b := &pemAutoscalingBounds{maxNodeMemoryPercent: spec.MaxNodeMemoryPercent}
+	if b.maxNodeMemoryPercent <= 0 || b.maxNodeMemoryPercent > 100 {
+		b.maxNodeMemoryPercent = defaultPEMMaxNodeMemoryPercent
+	}
+	var err error
+	if b.minMemory, err = parseQuantityOrDefault(spec.MinMemory, defaultPEMMinMemory); err != nil {
+		return nil, fmt.Errorf("invalid minMemory: %w", err)
+	}
+	if b.maxMemory, err = parseQuantityOrDefault(spec.MaxMemory, defaultPEMMaxMemory); err != nil {
+		return nil, fmt.Errorf("invalid maxMemory: %w", err)
+	}
+	if b.minCPU, err = parseQuantityOrDefault(spec.MinCPU, defaultPEMMinCPU); err != nil {
+		return nil, fmt.Errorf("invalid minCPU: %w", err)
+	}
+	if b.maxCPU, err = parseQuantityOrDefault(spec.MaxCPU, defaultPEMMaxCPU); err != nil {
+		return nil, fmt.Errorf("invalid maxCPU: %w", err)
+	}
+	if b.maxMemory.Cmp(b.minMemory) < 0 || b.maxCPU.Cmp(b.minCPU) < 0 {
+		return nil, fmt.Errorf("PEM autoscaling maximums must not be smaller than the minimums")
+	}
+	return b, nil
+}
+
+// pemAutoscalingEnabled returns whether the operator should manage the resources of the Vizier's PEMs.
+func pemAutoscalingEnabled(vz *v1alpha1.Vizier) bool {
+	return vz.Spec.PEMAutoscaling != nil && vz.Spec.PEMAutoscaling.Enabled
+}
+
+// pemSizeClasses returns the names of the node size classes, or a single empty class if none are specified.
+func pemSizeClasses(spec *v1alpha1.PEMAutoscaling) []string {
+	if len(spec.NodeSizeClasses) == 0 {
+		return []string{""}
+	}
+	classes := make([]string, len(spec.NodeSizeClasses))
+	for i, c := range spec.NodeSizeClasses {
+		classes[i] = c.Name
+	}
+	return classes
+}
+
+// getNodeSizeClass returns the class with the largest MinNodeMemory that is at most the given allocatable memory,
+// or the smallest class if there is none.
+func getNodeSizeClass(classes []v1alpha1.PEMNodeSizeClass, allocatable resource.Quantity) (string, error) {
+	if len(classes) == 0 {
+		return "", nil
+	}
+	type sizedClass struct {
+		name    string
+		minSize resource.Quantity
+	}
+	sized := make([]sizedClass, len(classes))
+	for i, c := range classes {
+		minSize, err := parseQuantityOrDefault(c.MinNodeMemory, resource.Quantity{})
+		if err != nil {
+			return "", fmt.Errorf("invalid minNodeMemory for class %s: %w", c.Name, err)
+		}
+		sized[i] = sizedClass{name: c.Name, minSize: minSize}
+	}
+	sort.SliceStable(sized, func(i, j int) bool { return sized[i].minSize.Cmp(sized[j].minSize) < 0 })
+
+	class := sized[0].name
+	for _, c := range sized {
+		if c.minSize.Cmp(allocatable) <= 0 {
+			class = c.name
+		}
+	}
+	return class, nil
+}
+
+// pemDaemonSetNameForClass returns the name of the PEM DaemonSet that runs on the nodes of the given class.
+func pemDaemonSetNameForClass(class string) string {
+	if class == "" {
+		return pemDaemonSetName
+	}
+	return fmt.Sprintf("%s-%s", pemDaemonSetName, class)
+}
+
+// pemUsageSample is the peak resource usage of the PEMs of a class at a point in time.
+type pemUsageSample struct {
+	time        time.Time
+	memoryBytes int64
+	cpuMillis   int64
+}
+
+// pemUsage is the resource usage of a single PEM.
+type pemUsage struct {
+	memoryBytes int64
+	cpuMillis   int64
+}
+
+// podMetricsList is the subset of the metrics.k8s.io PodMetricsList that is used to compute the PEM usage.
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Containers []struct {
+			Name  string                       `json:"name"`
+			Usage map[string]resource.Quantity `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// fetchPEMUsage fetches the current resource usage of the PEMs in the namespace from the metrics API, keyed by
+// pod name.
+func fetchPEMUsage(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]pemUsage, error) {
+	raw, err := clientset.Discovery().RESTClient().Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", namespace, "pods").
+		Param("labelSelector", pemLabelSelector).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var metrics podMetricsList
+	if err := json.Unmarshal(raw, &metrics); err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]pemUsage)
+	for _, pod := range metrics.Items {
+		for _, c := range pod.Containers {
+			if c.Name != pemContainerName {
+				continue
+			}
+			mem := c.Usage[string(v1.ResourceMemory)]
+			cpu := c.Usage[string(v1.ResourceCPU)]
+			usage[pod.Metadata.Name] = pemUsage{memoryBytes: mem.Value(), cpuMillis: cpu.MilliValue()}
+		}
+	}
+	return usage, nil
+}
+
+// pemAutoscaler adjusts the resources of PEMs based on their observed usage.
+type pemAutoscaler struct {
+	clientset kubernetes.Interface
+	// fetchUsage returns the resource usage of the PEMs in the namespace, keyed by pod name.
+	fetchUsage func(ctx context.Context, namespace string) (map[string]pemUsage, error)
+
+	// samples holds the recent usage samples of each class, keyed by the namespace and class.
+	samples map[string][]pemUsageSample
+}
+
+func newPEMAutoscaler(clientset kubernetes.Interface) *pemAutoscaler {
+	return &pemAutoscaler{
+		clientset: clientset,
+		fetchUsage: func(ctx context.Context, namespace string) (map[string]pemUsage, error) {
+			return fetchPEMUsage(ctx, clientset, namespace)
+		},
+		samples: make(map[string][]pemUsageSample),
+	}
+}
+
+// labelNodes labels each node with its size class, and returns the smallest allocatable memory of the nodes in
+// each class.
+func (a *pemAutoscaler) labelNodes(ctx context.Context, spec *v1alpha1.PEMAutoscaling) (map[string]resource.Quantity, error) {
+	nodes, err := a.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	smallestNodes := make(map[string]resource.Quantity)
+	for _, node := range nodes.Items {
+		allocatable := node.Status.Allocatable[v1.ResourceMemory]
+		class, err := getNodeSizeClass(spec.NodeSizeClasses, allocatable)
+		if err != nil {
+			return nil, err
+		}
+		if smallest, ok := smallestNodes[class]; !ok || allocatable.Cmp(smallest) < 0 {
+			smallestNodes[class] = allocatable
+		}
+		if class == "" || node.Labels[pemSizeClassLabel] == class {
+			continue
+		}
+
+		patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%q}}}`, pemSizeClassLabel, class)
+		_, err = a.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("node", node.Name).WithField("class", class).Info("Labeled node with PEM size class")
+	}
+	return smallestNodes, nil
+}
+
+// samplePEMUsage records the peak resource usage of the PEMs in each class.
+func (a *pemAutoscaler) samplePEMUsage(ctx context.Context, namespace string, spec *v1alpha1.PEMAutoscaling, now time.Time) error {
+	usage, err := a.fetchUsage(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	pods, err := a.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: pemLabelSelector})
+	if err != nil {
+		return err
+	}
+
+	peaks := make(map[string]*pemUsageSample)
+	for _, pod := range pods.Items {
+		u, ok := usage[pod.Name]
+		if !ok {
+			continue
+		}
+		class := ""
+		if len(spec.NodeSizeClasses) > 0 {
+			class = pod.Labels[pemSizeClassLabel]
+		}
+		peak, ok := peaks[class]
+		if !ok {
+			peak = &pemUsageSample{time: now}
+			peaks[class] = peak
+		}
+		if u.memoryBytes > peak.memoryBytes {
+			peak.memoryBytes = u.memoryBytes
+		}
+		if u.cpuMillis > peak.cpuMillis {
+			peak.cpuMillis = u.cpuMillis
+		}
+	}
+
+	for _, class := range pemSizeClasses(spec) {
+		key := namespace + "/" + class
+		var samples []pemUsageSample
+		for _, s := range a.samples[key] {
+			if now.Sub(s.time) < pemUsageWindow {
+				samples = append(samples, s)
+			}
+		}
+		if peak, ok := peaks[class]; ok {
+			samples = append(samples, *peak)
+		}
+		a.samples[key] = samples
+	}
+	return nil
+}
+
+// recommendPEMResources returns the memory and CPU that the PEMs of the class should have, based on the peak
+// usage over the usage window. ok is false if there is no usage data for the class.
+func (a *pemAutoscaler) recommendPEMResources(namespace string, class string, bounds *pemAutoscalingBounds,
+	smallestNode resource.Quantity) (memory resource.Quantity, cpu resource.Quantity, ok bool) {
+	samples := a.samples[namespace+"/"+class]
+	if len(samples) == 0 {
+		return memory, cpu, false
+	}
+	var peak pemUsageSample
+	for _, s := range samples {
+		if s.memoryBytes > peak.memoryBytes {
+			peak.memoryBytes = s.memoryBytes
+		}
+		if s.cpuMillis > peak.cpuMillis {
+			peak.cpuMillis = s.cpuMillis
+		}
+	}
+
+	maxMemory := bounds.maxMemory.Value()
+	if nodeCap := smallestNode.Value() * int64(bounds.maxNodeMemoryPercent) / 100; nodeCap > 0 && nodeCap < maxMemory {
+		maxMemory = nodeCap
+	}
+	memBytes := clamp(int64(float64(peak.memoryBytes)*pemUsageHeadroom), bounds.minMemory.Value(), maxMemory)
+	cpuMillis := clamp(int64(float64(peak.cpuMillis)*pemUsageHeadroom), bounds.minCPU.MilliValue(), bounds.maxCPU.MilliValue())
+
+	// Round memory up to the next MiB, so that the quantities are readable.
+	memBytes = (memBytes + (1 << 20) - 1) / (1 << 20) * (1 << 20)
+	return *resource.NewQuantity(memBytes, resource.BinarySI), *resource.NewMilliQuantity(cpuMillis, resource.DecimalSI), true
+}
+
+func clamp(v, lo, hi int64) int64 {
+	if v < lo {
+		return lo
+	}
+	if hi >= lo && v > hi {
+		return hi
+	}
+	return v
+}
+
+// shouldUpdatePEMResources returns whether the PEM resources should change from current to the recommendation.
+// Scale ups are applied right away, while scale downs are only applied if the resources have been stable
+// for the usage window and the decrease is significant, to avoid restarting the PEMs too often.
+func shouldUpdatePEMResources(current *v1alpha1.PEMClassResources, memory, cpu resource.Quantity, now time.Time) bool {
+	if current == nil {
+		return true
+	}
+	currentMemory, err := resource.ParseQuantity(current.Memory)
+	if err != nil {
+		return true
+	}
+	currentCPU, err := resource.ParseQuantity(current.CPU)
+	if err != nil {
+		return true
+	}
+
+	if memory.Cmp(currentMemory) > 0 || cpu.Cmp(currentCPU) > 0 {
+		return true
+	}
+	if current.LastUpdateTime != nil && now.Sub(current.LastUpdateTime.Time) < pemUsageWindow {
+		return false
+	}
+	significant := func(recommended, current resource.Quantity) bool {
+		return float64(current.MilliValue()-recommended.MilliValue()) > pemScaleDownThreshold*float64(current.MilliValue())
+	}
+	return significant(memory, currentMemory) || significant(cpu, currentCPU)
+}
+
+// update samples the PEM usage of the Vizier and updates the PEM resources in its status. It returns the classes
+// whose resources changed.
+func (a *pemAutoscaler) update(ctx context.Context, vz *v1alpha1.Vizier, now time.Time) ([]string, error) {
+	spec := vz.Spec.PEMAutoscaling
+	bounds, err := getPEMAutoscalingBounds(spec)
+	if err != nil {
+		return nil, err
+	}
+	smallestNodes, err := a.labelNodes(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.samplePEMUsage(ctx, vz.Namespace, spec, now); err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]*v1alpha1.PEMClassResources)
+	for i := range vz.Status.PEMResources {
+		current[vz.Status.PEMResources[i].Class] = &vz.Status.PEMResources[i]
+	}
+
+	var changed []string
+	var resources []v1alpha1.PEMClassResources
+	for _, class := range pemSizeClasses(spec) {
+		memory, cpu, ok := a.recommendPEMResources(vz.Namespace, class, bounds, smallestNodes[class])
+		if !ok || !shouldUpdatePEMResources(current[class], memory, cpu, now) {
+			if c, ok := current[class]; ok {
+				resources = append(resources, *c)
+			}
+			continue
+		}
+		resources = append(resources, v1alpha1.PEMClassResources{
+			Class:          class,
+			Memory:         memory.String(),
+			CPU:            cpu.String(),
+			LastUpdateTime: &metav1.Time{Time: now},
+		})
+		changed = append(changed, class)
+	}
+	vz.Status.PEMResources = resources
+	return changed, nil
+}
+
+// getPEMClassResources returns the resources that should be set on the PEMs of the class. If the autoscaler
+// hasn't set any yet, the minimums are used.
+func getPEMClassResources(vz *v1alpha1.Vizier, class string) (memory string, cpu string, err error) {
+	for _, r := range vz.Status.PEMResources {
+		if r.Class == class {
+			return r.Memory, r.CPU, nil
+		}
+	}
+	bounds, err := getPEMAutoscalingBounds(vz.Spec.PEMAutoscaling)
+	if err != nil {
+		return "", "", err
+	}
+	return bounds.minMemory.String(), bounds.minCPU.String(), nil
+}
+
+// getTableStoreSizeMB returns the table store size for PEMs with the given memory, or "" if the user has set
+// the table store size explicitly.
+func getTableStoreSizeMB(vz *v1alpha1.Vizier, memory string) (string, error) {
+	if dc := vz.Spec.DataCollectorParams; dc != nil {
+		if _, ok := dc.CustomPEMFlags[tableStoreSizePEMFlag]; ok {
+			return "", nil
+		}
+		if dc.TableStore != nil && dc.TableStore.TotalSize != "" {
+			return "", nil
+		}
+	}
+	q, err := resource.ParseQuantity(memory)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(int(pemTableStorePercentage * float64(q.Value()) / (1 << 20))), nil
+}
+
+// pemContainerPatch returns the patch for the PEM container that sets the given resources.
+func pemContainerPatch(vz *v1alpha1.Vizier, memory string, cpu string) (map[string]interface{}, error) {
+	container := map[string]interface{}{
+		"name": pemContainerName,
+		"resources": map[string]interface{}{
+			"requests": map[string]interface{}{"memory": memory, "cpu": cpu},
+			"limits":   map[string]interface{}{"memory": memory},
+		},
+	}
+	tableStoreSize, err := getTableStoreSizeMB(vz, memory)
+	if err != nil {
+		return nil, err
+	}
+	if tableStoreSize != "" {
+		container["env"] = []interface{}{
+			map[string]interface{}{"name": tableStoreSizePEMFlag, "value": tableStoreSize},
+		}
+	}
+	return container, nil
+}
+
+// setPEMContainerResources sets the resources of the PEM container in the DaemonSet.
+func setPEMContainerResources(vz *v1alpha1.Vizier, ds map[string]interface{}, class string) error {
+	memory, cpu, err := getPEMClassResources(vz, class)
+	if err != nil {
+		return err
+	}
+	patch, err := pemContainerPatch(vz, memory, cpu)
+	if err != nil {
+		return err
+	}
+
+	containers, _, err := unstructured.NestedSlice(ds, "spec", "template", "spec", "containers")
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok || container["name"] != pemContainerName {
+			continue
+		}
+		container["resources"] = patch["resources"]
+		env, ok := patch["env"].([]interface{})
+		if !ok {
+			continue
+		}
+		var existing []interface{}
+		if e, ok := container["env"].([]interface{}); ok {
+			existing = e
+		}
+		for _, e := range existing {
+			if envVar, ok := e.(map[string]interface{}); !ok || envVar["name"] != tableStoreSizePEMFlag {
+				env = append(env, e)
+			}
+		}
+		container["env"] = env
+	}
+	return unstructured.SetNestedSlice(ds, containers, "spec", "template", "spec", "containers")
+}
+
+// addPEMNodeAffinity adds a node affinity requirement on a node label to all of the DaemonSet's node
+// selector terms.
+func addPEMNodeAffinity(ds map[string]interface{}, requirement map[string]interface{}) error {
+	path := []string{"spec", "template", "spec", "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms"}
+	terms, ok, err := unstructured.NestedSlice(ds, path...)
+	if err != nil {
+		return err
+	}
+	if !ok || len(terms) == 0 {
+		terms = []interface{}{map[string]interface{}{}}
+	}
+	for _, t := range terms {
+		term, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		exprs, _ := term["matchExpressions"].([]interface{})
+		term["matchExpressions"] = append(exprs, requirement)
+	}
+	return unstructured.SetNestedSlice(ds, terms, path...)
+}
+
+// configurePEMAutoscaling updates the PEM DaemonSet in the resources to use the resources chosen by the autoscaler.
+// If node size classes are specified, a DaemonSet is added for each class, which only runs on the nodes of that
+// class. The original DaemonSet only runs on nodes that haven't been assigned a class yet.
+func configurePEMAutoscaling(resources []*k8s.Resource, vz *v1alpha1.Vizier) ([]*k8s.Resource, error) {
+	if !pemAutoscalingEnabled(vz) {
+		return resources, nil
+	}
+
+	var pem *k8s.Resource
+	for _, r := range resources {
+		if r.GVK.Kind == "DaemonSet" && r.Object.GetName() == pemDaemonSetName {
+			pem = r
+		}
+	}
+	if pem == nil {
+		return resources, nil
+	}
+
+	classes := vz.Spec.PEMAutoscaling.NodeSizeClasses
+	if len(classes) == 0 {
+		return resources, setPEMContainerResources(vz, pem.Object.Object, "")
+	}
+
+	for _, c := range classes {
+		class := &k8s.Resource{Object: pem.Object.DeepCopy(), GVK: pem.GVK}
+		ds := class.Object.Object
+		class.Object.SetName(pemDaemonSetNameForClass(c.Name))
+
+		labels := class.Object.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[pemSizeClassLabel] = c.Name
+		class.Object.SetLabels(labels)
+		for _, path := range [][]string{{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}} {
+			if err := unstructured.SetNestedField(ds, c.Name, append(path, pemSizeClassLabel)...); err != nil {
+				return nil, err
+			}
+		}
+
+		err := addPEMNodeAffinity(ds, map[string]interface{}{
+			"key":      pemSizeClassLabel,
+			"operator": "In",
+			"values":   []interface{}{c.Name},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := setPEMContainerResources(vz, ds, c.Name); err != nil {
+			return nil, err
+		}
+		resources = append(resources, class)
+	}
+
+	err := addPEMNodeAffinity(pem.Object.Object, map[string]interface{}{
+		"key":      pemSizeClassLabel,
+		"operator": "DoesNotExist",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, setPEMContainerResources(vz, pem.Object.Object, "")
+}
+
+// patchPEMDaemonSet updates the resources of the PEM DaemonSet for the given class.
+func (a *pemAutoscaler) patchPEMDaemonSet(ctx context.Context, vz *v1alpha1.Vizier, class string) error {
+	memory, cpu, err := getPEMClassResources(vz, class)
+	if err != nil {
+		return err
+	}
+	container, err := pemContainerPatch(vz, memory, cpu)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{container},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.clientset.AppsV1().DaemonSets(vz.Namespace).Patch(ctx, pemDaemonSetNameForClass(class), types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// deleteStalePEMDaemonSets deletes the PEM DaemonSets of classes that are no longer in the Vizier spec.
+func (a *pemAutoscaler) deleteStalePEMDaemonSets(ctx context.Context, vz *v1alpha1.Vizier) error {
+	classes := make(map[string]bool)
+	if pemAutoscalingEnabled(vz) {
+		for _, c := range vz.Spec.PEMAutoscaling.NodeSizeClasses {
+			classes[c.Name] = true
+		}
+	}
+
+	dsList, err := a.clientset.AppsV1().DaemonSets(vz.Namespace).List(ctx, metav1.ListOptions{LabelSelector: pemSizeClassLabel})
+	if err != nil {
+		return err
+	}
+	for _, ds := range dsList.Items {
+		if classes[ds.Labels[pemSizeClassLabel]] {
+			continue
+		}
+		log.WithField("daemonset", ds.Name).Info("Deleting PEM DaemonSet of removed size class")
+		err := a.clientset.AppsV1().DaemonSets(vz.Namespace).Delete(ctx, ds.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// autoscalePEMs regularly samples the resource usage of PEMs, and updates the resources of the PEMs of each Vizier
+// that has PEM autoscaling enabled.
+func (r *VizierReconciler) autoscalePEMs() {
+	a := newPEMAutoscaler(r.Clientset)
+	t := time.NewTicker(pemAutoscalingInterval)
+	defer t.Stop()
+	for range t.C {
+		start := time.Now()
+		var viziersList v1alpha1.VizierList
+		ctx := context.Background()
+		err := r.List(ctx, &viziersList)
+		if err != nil {
+			log.WithError(err).Error("Unable to list the vizier objects")
+			recordLoopError(loopPEMAutoscaling)
+			continue
+		}
+		for _, vz := range viziersList.Items {
+			err := a.deleteStalePEMDaemonSets(ctx, &vz)
+			if err != nil {
+				log.WithError(err).Error("Failed to delete stale PEM DaemonSets")
+				recordLoopError(loopPEMAutoscaling)
+			}
+			if !pemAutoscalingEnabled(&vz) || vz.Status.ReconciliationPhase == v1alpha1.ReconciliationPhaseUpdating {
+				continue
+			}
+
+			changed, err := a.update(ctx, &vz, time.Now())
+			if err != nil {
+				log.WithError(err).Error("Failed to compute PEM resources")
+				recordLoopError(loopPEMAutoscaling)
+				continue
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			err = r.Status().Update(ctx, &vz)
+			if err != nil {
+				log.WithError(err).Error("Unable to update vizier status")
+				recordLoopError(loopPEMAutoscaling)
+				continue
+			}
+			for _, class := range changed {
+				log.WithField("class", class).WithField("resources", vz.Status.PEMResources).Info("Updating PEM resources")
+				err := a.patchPEMDaemonSet(ctx, &vz, class)
+				if err != nil {
+					log.WithError(err).Error("Failed to update PEM resources")
+					recordLoopError(loopPEMAutoscaling)
+				}
+			}
+		}
+		observeLoop(loopPEMAutoscaling, start)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const pemDaemonSetYAML = `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: vizier-pem
+spec:
+  selector:
+    matchLabels:
+      name: vizier-pem
+  template:
+    metadata:
+      labels:
+        name: vizier-pem
+    spec:
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/os
+                operator: In
+                values:
+                - linux
+      containers:
+      - name: pem
+        env:
+        - name: PL_TABLE_STORE_DATA_LIMIT_MB
+          value: "1228"
+        - name: PL_CLIENT_TLS_CERT
+          value: /certs/client.crt
+`
+
+func testNode(name string, memory string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{v1.ResourceMemory: resource.MustParse(memory)},
+		},
+	}
+}
+
+func testPEMPod(name string, class string) *v1.Pod {
+	labels := map[string]string{"name": vizierPemLabel}
+	if class != "" {
+		labels[pemSizeClassLabel] = class
+	}
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pl", Labels: labels}}
+}
+
+func autoscaledVizier(classes ...v1alpha1.PEMNodeSizeClass) *v1alpha1.Vizier {
+	return &v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec: v1alpha1.VizierSpec{
+			PEMAutoscaling: &v1alpha1.PEMAutoscaling{
+				Enabled:         true,
+				NodeSizeClasses: classes,
+			},
+		},
+	}
+}
+
+func TestGetNodeSizeClass(t *testing.T) {
+	classes := []v1alpha1.PEMNodeSizeClass{
+		{Name: "large", MinNodeMemory: "32Gi"},
+		{Name: "small", MinNodeMemory: "4Gi"},
+		{Name: "medium", MinNodeMemory: "16Gi"},
+	}
+
+	tests := []struct {
+		memory        string
+		expectedClass string
+	}{
+		{"2Gi", "small"},
+		{"4Gi", "small"},
+		{"16Gi", "medium"},
+		{"31Gi", "medium"},
+		{"64Gi", "large"},
+	}
+	for _, test := range tests {
+		t.Run(test.memory, func(t *testing.T) {
+			class, err := getNodeSizeClass(classes, resource.MustParse(test.memory))
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedClass, class)
+		})
+	}
+
+	class, err := getNodeSizeClass(nil, resource.MustParse("8Gi"))
+	require.NoError(t, err)
+	assert.Equal(t, "", class)
+}
+
+func TestShouldUpdatePEMResources(t *testing.T) {
+	now := time.Now()
+	current := &v1alpha1.PEMClassResources{
+		Memory:         "2Gi",
+		CPU:            "500m",
+		LastUpdateTime: &metav1.Time{Time: now.Add(-10 * time.Minute)},
+	}
+	stale := current.DeepCopy()
+	stale.LastUpdateTime = &metav1.Time{Time: now.Add(-2 * time.Hour)}
+
+	tests := []struct {
+		name     string
+		current  *v1alpha1.PEMClassResources
+		memory   string
+		cpu      string
+		expected bool
+	}{
+		{"no current resources", nil, "1Gi", "100m", true},
+		{"scale up memory", current, "3Gi", "500m", true},
+		{"scale up cpu", current, "2Gi", "600m", true},
+		{"unchanged", current, "2Gi", "500m", false},
+		{"recent scale down", current, "1Gi", "500m", false},
+		{"scale down", stale, "1Gi", "500m", true},
+		{"small scale down", stale, "1900Mi", "480m", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, shouldUpdatePEMResources(test.current, resource.MustParse(test.memory), resource.MustParse(test.cpu), now))
+		})
+	}
+}
+
+func TestPEMAutoscaler_Update(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testNode("node-1", "8Gi"),
+		testNode("node-2", "64Gi"),
+		testPEMPod("pem-1", "small"),
+		testPEMPod("pem-2", "large"),
+	)
+	usage := map[string]pemUsage{
+		"pem-1": {memoryBytes: 2 << 30, cpuMillis: 200},
+		"pem-2": {memoryBytes: 4 << 30, cpuMillis: 1000},
+	}
+	a := newPEMAutoscaler(clientset)
+	a.fetchUsage = func(ctx context.Context, namespace string) (map[string]pemUsage, error) {
+		return usage, nil
+	}
+
+	vz := autoscaledVizier(
+		v1alpha1.PEMNodeSizeClass{Name: "small"},
+		v1alpha1.PEMNodeSizeClass{Name: "large", MinNodeMemory: "32Gi"},
+	)
+	now := time.Now()
+	changed, err := a.update(context.Background(), vz, now)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"small", "large"}, changed)
+
+	// The nodes are labeled with their size class.
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "small", node.Labels[pemSizeClassLabel])
+	node, err = clientset.CoreV1().Nodes().Get(context.Background(), "node-2", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "large", node.Labels[pemSizeClassLabel])
+
+	// The small class is capped at 25% of the node's memory, the large one gets its usage plus headroom.
+	require.Len(t, vz.Status.PEMResources, 2)
+	assert.Equal(t, "small", vz.Status.PEMResources[0].Class)
+	assert.Equal(t, "2Gi", vz.Status.PEMResources[0].Memory)
+	assert.Equal(t, "250m", vz.Status.PEMResources[0].CPU)
+	assert.Equal(t, "large", vz.Status.PEMResources[1].Class)
+	assert.Equal(t, "5Gi", vz.Status.PEMResources[1].Memory)
+	assert.Equal(t, "1250m", vz.Status.PEMResources[1].CPU)
+
+	// A drop in usage doesn't scale down right away, since the peak is tracked over the usage window.
+	usage["pem-2"] = pemUsage{memoryBytes: 1 << 30, cpuMillis: 100}
+	changed, err = a.update(context.Background(), vz, now.Add(pemAutoscalingInterval))
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, "5Gi", vz.Status.PEMResources[1].Memory)
+
+	// Once the peak has left the window, the resources are scaled down.
+	changed, err = a.update(context.Background(), vz, now.Add(pemUsageWindow+pemAutoscalingInterval))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"large"}, changed)
+	assert.Equal(t, "1280Mi", vz.Status.PEMResources[1].Memory)
+	assert.Equal(t, "125m", vz.Status.PEMResources[1].CPU)
+}
+
+func TestConfigurePEMAutoscaling(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(pemDaemonSetYAML))
+	require.NoError(t, err)
+
+	vz := autoscaledVizier(v1alpha1.PEMNodeSizeClass{Name: "small"}, v1alpha1.PEMNodeSizeClass{Name: "large", MinNodeMemory: "32Gi"})
+	vz.Status.PEMResources = []v1alpha1.PEMClassResources{{Class: "large", Memory: "4Gi", CPU: "1"}}
+	resources, err = configurePEMAutoscaling(resources, vz)
+	require.NoError(t, err)
+	require.Len(t, resources, 3)
+
+	daemonSets := make(map[string]*appsv1.DaemonSet)
+	for _, r := range resources {
+		ds := &appsv1.DaemonSet{}
+		require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(r.Object.Object, ds))
+		daemonSets[ds.Name] = ds
+	}
+
+	base := daemonSets["vizier-pem"]
+	require.NotNil(t, base)
+	exprs := base.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions
+	assert.Equal(t, v1.NodeSelectorRequirement{Key: pemSizeClassLabel, Operator: v1.NodeSelectorOpDoesNotExist}, exprs[len(exprs)-1])
+	assert.Equal(t, map[string]string{"name": "vizier-pem"}, base.Spec.Selector.MatchLabels)
+
+	large := daemonSets["vizier-pem-large"]
+	require.NotNil(t, large)
+	assert.Equal(t, "large", large.Labels[pemSizeClassLabel])
+	assert.Equal(t, map[string]string{"name": "vizier-pem", pemSizeClassLabel: "large"}, large.Spec.Selector.MatchLabels)
+	assert.Equal(t, "large", large.Spec.Template.Labels[pemSizeClassLabel])
+	exprs = large.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions
+	assert.Len(t, exprs, 2)
+	assert.Equal(t, v1.NodeSelectorRequirement{Key: pemSizeClassLabel, Operator: v1.NodeSelectorOpIn, Values: []string{"large"}}, exprs[1])
+
+	pem := large.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "4Gi", pem.Resources.Requests.Memory().String())
+	assert.Equal(t, "4Gi", pem.Resources.Limits.Memory().String())
+	assert.Equal(t, "1", pem.Resources.Requests.Cpu().String())
+	assert.Equal(t, []v1.EnvVar{
+		{Name: tableStoreSizePEMFlag, Value: "2457"},
+		{Name: "PL_CLIENT_TLS_CERT", Value: "/certs/client.crt"},
+	}, pem.Env)
+
+	// Classes without resources in the status use the minimums.
+	pem = daemonSets["vizier-pem-small"].Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "1Gi", pem.Resources.Limits.Memory().String())
+	assert.Equal(t, "100m", pem.Resources.Requests.Cpu().String())
+}
+
+func TestPEMAutoscaler_DaemonSets(t *testing.T) {
+	pemDS := func(name string, class string) *appsv1.DaemonSet {
+		ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pl"}}
+		if class != "" {
+			ds.Labels = map[string]string{pemSizeClassLabel: class}
+		}
+		ds.Spec.Template.Spec.Containers = []v1.Container{{Name: pemContainerName}}
+		return ds
+	}
+	clientset := fake.NewSimpleClientset(pemDS("vizier-pem", ""), pemDS("vizier-pem-small", "small"), pemDS("vizier-pem-old", "old"))
+	a := newPEMAutoscaler(clientset)
+	vz := autoscaledVizier(v1alpha1.PEMNodeSizeClass{Name: "small"})
+	vz.Status.PEMResources = []v1alpha1.PEMClassResources{{Class: "small", Memory: "3Gi", CPU: "500m"}}
+
+	require.NoError(t, a.deleteStalePEMDaemonSets(context.Background(), vz))
+	dsList, err := clientset.AppsV1().DaemonSets("pl").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, ds := range dsList.Items {
+		names = append(names, ds.Name)
+	}
+	assert.ElementsMatch(t, []string{"vizier-pem", "vizier-pem-small"}, names)
+
+	require.NoError(t, a.patchPEMDaemonSet(context.Background(), vz, "small"))
+	ds, err := clientset.AppsV1().DaemonSets("pl").Get(context.Background(), "vizier-pem-small", metav1.GetOptions{})
+	require.NoError(t, err)
+	pem := ds.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "3Gi", pem.Resources.Limits.Memory().String())
+	assert.Equal(t, "500m", pem.Resources.Requests.Cpu().String())
+	assert.Equal(t, []v1.EnvVar{{Name: tableStoreSizePEMFlag, Value: "1843"}}, pem.Env)
+}
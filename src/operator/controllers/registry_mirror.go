@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+// splitImageRegistry splits an image into its registry host and its path. The first component of the image is only
+// a registry host if it looks like one, as Docker Hub images don't include their registry.
+func splitImageRegistry(image string) (string, string) {
+	host, path, ok := strings.Cut(image, "/")
+	if !ok || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return "", image
+	}
+	return host, path
+}
+
+// mirrorImage returns the image in the registry mirror.
+func mirrorImage(mirror *v1alpha1.RegistryMirror, image string) string {
+	_, path := splitImageRegistry(image)
+	for _, rw := range mirror.PathRewrites {
+		// Prefixes only match whole path components.
+		prefix := strings.TrimSuffix(rw.Prefix, "/") + "/"
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		path = strings.TrimPrefix(strings.TrimSuffix(rw.Replacement, "/")+"/"+path[len(prefix):], "/")
+		break
+	}
+	return fmt.Sprintf("%s/%s", mirror.Host, path)
+}
+
+// registryImage returns the image in the custom registry or registry mirror of the Vizier, following the same
+// naming scheme as the Vizier YAMLs.
+func registryImage(vz *v1alpha1.Vizier, image string) string {
+	if vz.Spec.RegistryMirror != nil {
+		return mirrorImage(vz.Spec.RegistryMirror, image)
+	}
+	if vz.Spec.Registry == "" {
+		return image
+	}
+	return fmt.Sprintf("%s/%s", vz.Spec.Registry, strings.ReplaceAll(image, "/", "-"))
+}
+
+// registryPullSecrets returns the image pull secrets of the Vizier's registry mirror.
+func registryPullSecrets(vz *v1alpha1.Vizier) []v1.LocalObjectReference {
+	if vz.Spec.RegistryMirror == nil {
+		return nil
+	}
+	var secrets []v1.LocalObjectReference
+	for _, s := range vz.Spec.RegistryMirror.PullSecrets {
+		secrets = append(secrets, v1.LocalObjectReference{Name: s})
+	}
+	return secrets
+}
+
+// podSpecOfResource returns the pod spec of a K8s resource, or nil if the resource doesn't run pods.
+func podSpecOfResource(res map[string]interface{}) map[string]interface{} {
+	paths := [][]string{
+		{"spec", "template", "spec"},
+		{"spec", "jobTemplate", "spec", "template", "spec"},
+	}
+	if kind, _ := res["kind"].(string); kind == "Pod" {
+		paths = [][]string{{"spec"}}
+	}
+	for _, p := range paths {
+		spec, ok, err := unstructured.NestedFieldNoCopy(res, p...)
+		if !ok || err != nil {
+			continue
+		}
+		if specCast, castOk := spec.(map[string]interface{}); castOk {
+			return specCast
+		}
+	}
+	return nil
+}
+
+// applyRegistryMirror pulls the images of a K8s resource from the registry mirror, with the mirror's pull secrets.
+func applyRegistryMirror(mirror *v1alpha1.RegistryMirror, res map[string]interface{}) {
+	podSpec := podSpecOfResource(res)
+	if mirror == nil || podSpec == nil {
+		return
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, ok := podSpec[field].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, c := range containers {
+			castedContainer, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if image, ok := castedContainer["image"].(string); ok && image != "" {
+				castedContainer["image"] = mirrorImage(mirror, image)
+			}
+		}
+	}
+
+	if len(mirror.PullSecrets) == 0 {
+		return
+	}
+	pullSecrets, _ := podSpec["imagePullSecrets"].([]interface{})
+	existing := make(map[string]bool)
+	for _, s := range pullSecrets {
+		if castedSecret, ok := s.(map[string]interface{}); ok {
+			if name, ok := castedSecret["name"].(string); ok {
+				existing[name] = true
+			}
+		}
+	}
+	for _, name := range mirror.PullSecrets {
+		if !existing[name] {
+			pullSecrets = append(pullSecrets, map[string]interface{}{"name": name})
+		}
+	}
+	podSpec["imagePullSecrets"] = pullSecrets
+}
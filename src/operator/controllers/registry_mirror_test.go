@@ -0,0 +1,145 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+func TestMirrorImage(t *testing.T) {
+	mirror := &v1alpha1.RegistryMirror{
+		Host: "registry.internal:5000",
+		PathRewrites: []v1alpha1.RegistryPathRewrite{
+			{Prefix: "pixie-oss/pixie-prod", Replacement: "pixie"},
+			{Prefix: "pixie-oss/", Replacement: ""},
+		},
+	}
+
+	tests := []struct {
+		image    string
+		expected string
+	}{
+		{
+			image:    "gcr.io/pixie-oss/pixie-prod/vizier-metadata_server_image:0.14.2",
+			expected: "registry.internal:5000/pixie/vizier-metadata_server_image:0.14.2",
+		},
+		{
+			image:    "gcr.io/pixie-oss/pixie-production/vizier-pem_image:0.14.2",
+			expected: "registry.internal:5000/pixie-production/vizier-pem_image:0.14.2",
+		},
+		{
+			image:    "gcr.io/pixie-oss/pixie-dev-public/etcd:3.5.9@sha256:e18afc6d",
+			expected: "registry.internal:5000/pixie-dev-public/etcd:3.5.9@sha256:e18afc6d",
+		},
+		{
+			image:    "ghcr.io/pixie-io/nats:2.9.25-scratch",
+			expected: "registry.internal:5000/pixie-io/nats:2.9.25-scratch",
+		},
+		{
+			image:    "busybox:1.36",
+			expected: "registry.internal:5000/busybox:1.36",
+		},
+		{
+			image:    "localhost/pixie-oss/curl:7.87.0",
+			expected: "registry.internal:5000/curl:7.87.0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			assert.Equal(t, test.expected, mirrorImage(mirror, test.image))
+		})
+	}
+}
+
+const mirrorTestYAML = `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: vizier-pem
+spec:
+  template:
+    spec:
+      imagePullSecrets:
+      - name: existing-creds
+      initContainers:
+      - name: pem-wait
+        image: gcr.io/pixie-oss/pixie-dev-public/curl:1.0
+      containers:
+      - name: pem
+        image: gcr.io/pixie-oss/pixie-prod/vizier-pem_image:0.14.2
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: vizier-query-broker-svc
+spec:
+  ports:
+  - port: 50300
+`
+
+func TestApplyRegistryMirror(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(mirrorTestYAML))
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+
+	mirror := &v1alpha1.RegistryMirror{
+		Host:         "registry.internal:5000",
+		PathRewrites: []v1alpha1.RegistryPathRewrite{{Prefix: "pixie-oss/pixie-prod", Replacement: "pixie"}},
+		PullSecrets:  []string{"existing-creds", "internal-registry-creds"},
+	}
+	for _, r := range resources {
+		applyRegistryMirror(mirror, r.Object.Object)
+	}
+
+	var ds appsv1.DaemonSet
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.Object, &ds))
+	pod := ds.Spec.Template.Spec
+	assert.Equal(t, "registry.internal:5000/pixie-oss/pixie-dev-public/curl:1.0", pod.InitContainers[0].Image)
+	assert.Equal(t, "registry.internal:5000/pixie/vizier-pem_image:0.14.2", pod.Containers[0].Image)
+	assert.Equal(t, []v1.LocalObjectReference{{Name: "existing-creds"}, {Name: "internal-registry-creds"}}, pod.ImagePullSecrets)
+
+	_, hasTemplate := resources[1].Object.Object["spec"].(map[string]interface{})["template"]
+	assert.False(t, hasTemplate)
+}
+
+func TestRegistryImage(t *testing.T) {
+	vz := &v1alpha1.Vizier{}
+	assert.Equal(t, etcdImage, registryImage(vz, etcdImage))
+
+	vz.Spec.Registry = "registry.example.com"
+	assert.Equal(t, "registry.example.com/gcr.io-pixie-oss-pixie-dev-public-etcd:3.5.9@sha256:e18afc6dda592b426834342393c4c4bd076cb46fa7e10fa7818952cae3047ca9",
+		registryImage(vz, etcdImage))
+
+	vz.Spec.Registry = ""
+	vz.Spec.RegistryMirror = &v1alpha1.RegistryMirror{Host: "registry.internal:5000", PullSecrets: []string{"internal-registry-creds"}}
+	assert.Equal(t, "registry.internal:5000/pixie-oss/pixie-dev-public/etcd:3.5.9@sha256:e18afc6dda592b426834342393c4c4bd076cb46fa7e10fa7818952cae3047ca9",
+		registryImage(vz, etcdImage))
+	assert.Equal(t, []v1.LocalObjectReference{{Name: "internal-registry-creds"}}, registryPullSecrets(vz))
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const kelvinDeploymentName = "kelvin"
+
+// componentScheduling returns the scheduling of the Vizier component that runs the workload with the given kind
+// and name, or nil if it has none.
+func componentScheduling(s *v1alpha1.ComponentScheduling, kind, name string) *v1alpha1.Scheduling {
+	if s == nil {
+		return nil
+	}
+	switch {
+	case kind == "DaemonSet" && name == pemDaemonSetName:
+		return s.PEM
+	case kind == "Deployment" && name == kelvinDeploymentName:
+		return s.Kelvin
+	// The metadata service is a Deployment when it uses etcd, and a StatefulSet otherwise.
+	case (kind == "StatefulSet" || kind == "Deployment") && name == metadataStatefulSetName:
+		return s.Metadata
+	case kind == "StatefulSet" && name == natsStatefulSetName:
+		return s.NATS
+	}
+	return nil
+}
+
+// mergeNodeSelectors returns a selector that requires both of the given selectors. Each selector is a list of
+// terms, of which only one has to match.
+func mergeNodeSelectors(base, add *v1.NodeSelector) *v1.NodeSelector {
+	if base == nil || len(base.NodeSelectorTerms) == 0 {
+		return add
+	}
+	if add == nil || len(add.NodeSelectorTerms) == 0 {
+		return base
+	}
+	merged := &v1.NodeSelector{}
+	for _, b := range base.NodeSelectorTerms {
+		for _, a := range add.NodeSelectorTerms {
+			var term v1.NodeSelectorTerm
+			term.MatchExpressions = append(append(term.MatchExpressions, b.MatchExpressions...), a.MatchExpressions...)
+			term.MatchFields = append(append(term.MatchFields, b.MatchFields...), a.MatchFields...)
+			merged.NodeSelectorTerms = append(merged.NodeSelectorTerms, term)
+		}
+	}
+	return merged
+}
+
+// mergeAffinity returns an affinity that has the constraints of both of the given affinities.
+func mergeAffinity(base, add *v1.Affinity) *v1.Affinity {
+	if base == nil {
+		return add.DeepCopy()
+	}
+	merged := base.DeepCopy()
+	if na := add.NodeAffinity; na != nil {
+		if merged.NodeAffinity == nil {
+			merged.NodeAffinity = &v1.NodeAffinity{}
+		}
+		merged.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = mergeNodeSelectors(
+			merged.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution, na.RequiredDuringSchedulingIgnoredDuringExecution.DeepCopy())
+		merged.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			merged.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, na.PreferredDuringSchedulingIgnoredDuringExecution...)
+	}
+	if pa := add.PodAffinity; pa != nil {
+		if merged.PodAffinity == nil {
+			merged.PodAffinity = &v1.PodAffinity{}
+		}
+		merged.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			merged.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution, pa.RequiredDuringSchedulingIgnoredDuringExecution...)
+		merged.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			merged.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution, pa.PreferredDuringSchedulingIgnoredDuringExecution...)
+	}
+	if paa := add.PodAntiAffinity; paa != nil {
+		if merged.PodAntiAffinity == nil {
+			merged.PodAntiAffinity = &v1.PodAntiAffinity{}
+		}
+		merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, paa.RequiredDuringSchedulingIgnoredDuringExecution...)
+		merged.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			merged.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, paa.PreferredDuringSchedulingIgnoredDuringExecution...)
+	}
+	return merged
+}
+
+// applyComponentScheduling adds the scheduling of the Vizier component that runs the workload to its pod spec.
+func applyComponentScheduling(vz *v1alpha1.Vizier, res *k8s.Resource) error {
+	sched := componentScheduling(vz.Spec.Scheduling, res.GVK.Kind, res.Object.GetName())
+	if sched == nil {
+		return nil
+	}
+	md, ok, err := unstructured.NestedFieldNoCopy(res.Object.Object, "spec", "template", "spec")
+	if !ok || err != nil {
+		return err
+	}
+	podSpec, ok := md.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if len(sched.NodeSelector) > 0 {
+		nodeSelector, _ := podSpec["nodeSelector"].(map[string]interface{})
+		if nodeSelector == nil {
+			nodeSelector = make(map[string]interface{})
+		}
+		for k, v := range sched.NodeSelector {
+			nodeSelector[k] = v
+		}
+		podSpec["nodeSelector"] = nodeSelector
+	}
+
+	if len(sched.Tolerations) > 0 {
+		// updatePodSpec sets the tolerations of the pod without converting them to unstructured.
+		switch tolerations := podSpec["tolerations"].(type) {
+		case []v1.Toleration:
+			podSpec["tolerations"] = append(append([]v1.Toleration{}, tolerations...), sched.Tolerations...)
+		default:
+			merged, _ := tolerations.([]interface{})
+			for i := range sched.Tolerations {
+				t, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&sched.Tolerations[i])
+				if err != nil {
+					return err
+				}
+				merged = append(merged, t)
+			}
+			podSpec["tolerations"] = merged
+		}
+	}
+
+	if sched.Affinity != nil {
+		var affinity *v1.Affinity
+		if a, ok := podSpec["affinity"].(map[string]interface{}); ok {
+			affinity = &v1.Affinity{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(a, affinity); err != nil {
+				return err
+			}
+		}
+		a, err := runtime.DefaultUnstructuredConverter.ToUnstructured(mergeAffinity(affinity, sched.Affinity))
+		if err != nil {
+			return err
+		}
+		podSpec["affinity"] = a
+	}
+	return nil
+}
+
+// schedulingChanged returns whether the scheduling constraints of the pod specs are different.
+func schedulingChanged(current, desired *v1.PodSpec) bool {
+	return !equality.Semantic.DeepEqual(current.NodeSelector, desired.NodeSelector) ||
+		!equality.Semantic.DeepEqual(current.Tolerations, desired.Tolerations) ||
+		!equality.Semantic.DeepEqual(current.Affinity, desired.Affinity)
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const schedulingTestYAML = `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: vizier-pem
+spec:
+  template:
+    spec:
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/os
+                operator: In
+                values:
+                - linux
+            - matchExpressions:
+              - key: beta.kubernetes.io/os
+                operator: In
+                values:
+                - linux
+      containers:
+      - name: pem
+        image: vizier-pem_image:0.14.2
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kelvin
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: vizier-kelvin_image:0.14.2
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: vizier-query-broker
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: vizier-query_broker_server_image:0.14.2
+`
+
+func TestApplyComponentScheduling(t *testing.T) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(schedulingTestYAML))
+	require.NoError(t, err)
+	require.Len(t, resources, 3)
+
+	gpuToleration := v1.Toleration{Key: "nvidia.com/gpu", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}
+	infraToleration := v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "infra", Effect: v1.TaintEffectNoSchedule}
+	poolRequirement := v1.NodeSelectorRequirement{Key: "pool", Operator: v1.NodeSelectorOpNotIn, Values: []string{"spot"}}
+
+	vz := &v1alpha1.Vizier{
+		Spec: v1alpha1.VizierSpec{
+			Pod: &v1alpha1.PodPolicy{
+				NodeSelector: map[string]string{"pool": "default", "zone": "a"},
+				Tolerations:  []v1.Toleration{infraToleration},
+			},
+			Scheduling: &v1alpha1.ComponentScheduling{
+				PEM: &v1alpha1.Scheduling{
+					NodeSelector: map[string]string{"pixie.io/monitored": "true"},
+					Tolerations:  []v1.Toleration{gpuToleration},
+					Affinity: &v1.Affinity{
+						NodeAffinity: &v1.NodeAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+								NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{poolRequirement}}},
+							},
+						},
+					},
+				},
+				Kelvin: &v1alpha1.Scheduling{
+					NodeSelector: map[string]string{"pool": "observability"},
+				},
+			},
+		},
+	}
+	for _, r := range resources {
+		require.NoError(t, updateResourceConfiguration(r, vz))
+	}
+
+	var pem appsv1.DaemonSet
+	decodeResource(t, resources[0], &pem)
+	pemSpec := pem.Spec.Template.Spec
+	// The global node selector is not applied to DaemonSets, but the PEM's own one is.
+	assert.Equal(t, map[string]string{"pixie.io/monitored": "true"}, pemSpec.NodeSelector)
+	assert.Equal(t, []v1.Toleration{infraToleration, gpuToleration}, pemSpec.Tolerations)
+	terms := pemSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	require.Len(t, terms, 2)
+	for _, term := range terms {
+		require.Len(t, term.MatchExpressions, 2)
+		assert.Equal(t, poolRequirement, term.MatchExpressions[1])
+	}
+	assert.Equal(t, "kubernetes.io/os", terms[0].MatchExpressions[0].Key)
+	assert.Equal(t, "beta.kubernetes.io/os", terms[1].MatchExpressions[0].Key)
+
+	var kelvin appsv1.Deployment
+	decodeResource(t, resources[1], &kelvin)
+	assert.Equal(t, map[string]string{"pool": "observability", "zone": "a"}, kelvin.Spec.Template.Spec.NodeSelector)
+	assert.Equal(t, []v1.Toleration{infraToleration}, kelvin.Spec.Template.Spec.Tolerations)
+	assert.Nil(t, kelvin.Spec.Template.Spec.Affinity)
+
+	var qb appsv1.Deployment
+	decodeResource(t, resources[2], &qb)
+	assert.Equal(t, map[string]string{"pool": "default", "zone": "a"}, qb.Spec.Template.Spec.NodeSelector)
+}
+
+// decodeResource decodes the resource through JSON, as updatePodSpec leaves typed values in the unstructured object.
+func decodeResource(t *testing.T, r *k8s.Resource, obj interface{}) {
+	b, err := r.Object.MarshalJSON()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, obj))
+}
+
+func TestMergeAffinity(t *testing.T) {
+	zoneTerm := v1.NodeSelectorTerm{
+		MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}},
+	}
+	antiAffinity := v1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"}
+	add := &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{zoneTerm}},
+		},
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{antiAffinity},
+		},
+	}
+
+	// Without an existing affinity, the added one is used as is.
+	assert.Equal(t, add, mergeAffinity(nil, add))
+
+	base := &v1.Affinity{
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{TopologyKey: "zone"}},
+		},
+	}
+	merged := mergeAffinity(base, add)
+	assert.Equal(t, []v1.NodeSelectorTerm{zoneTerm}, merged.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
+	assert.Equal(t, []v1.PodAffinityTerm{{TopologyKey: "zone"}, antiAffinity}, merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+	// The existing affinity is not modified.
+	assert.Nil(t, base.NodeAffinity)
+	assert.Len(t, base.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, 1)
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const (
+	// privilegedSCCClusterRole is the cluster role that OpenShift provides to grant the use of the privileged
+	// security context constraint.
+	privilegedSCCClusterRole = "system:openshift:scc:privileged"
+	privilegedSCCRoleBinding = "pl-privileged-scc"
+
+	eventReasonPrivilegedWorkloads = "PrivilegedWorkloads"
+)
+
+func securityContextProfile(vz *v1alpha1.Vizier) v1alpha1.SecurityContextProfile {
+	if vz.Spec.SecurityContextProfile == "" {
+		return v1alpha1.SecurityContextProfileDefault
+	}
+	return vz.Spec.SecurityContextProfile
+}
+
+// podSpecPrivileges returns the settings of the pod spec that require privileges, in the terms of the Pod
+// Security Standards.
+func podSpecPrivileges(spec *v1.PodSpec) []string {
+	var reqs []string
+	if spec.HostPID {
+		reqs = append(reqs, "hostPID")
+	}
+	if spec.HostIPC {
+		reqs = append(reqs, "hostIPC")
+	}
+	if spec.HostNetwork {
+		reqs = append(reqs, "hostNetwork")
+	}
+	for _, vol := range spec.Volumes {
+		if vol.HostPath != nil {
+			reqs = append(reqs, fmt.Sprintf("hostPath volume %s", vol.HostPath.Path))
+		}
+	}
+	containers := append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		sc := c.SecurityContext
+		if sc == nil {
+			continue
+		}
+		if sc.Privileged != nil && *sc.Privileged {
+			reqs = append(reqs, fmt.Sprintf("privileged container %s", c.Name))
+		}
+		if sc.Capabilities != nil && len(sc.Capabilities.Add) > 0 {
+			caps := make([]string, len(sc.Capabilities.Add))
+			for i, capability := range sc.Capabilities.Add {
+				caps[i] = string(capability)
+			}
+			reqs = append(reqs, fmt.Sprintf("capabilities %s of container %s", strings.Join(caps, ", "), c.Name))
+		}
+	}
+	return reqs
+}
+
+// restrictPodSpec makes the pod spec comply with the restricted Pod Security Standard. For OpenShift, the user
+// and group IDs are removed, so that the security context constraint assigns them from the namespace's range.
+func restrictPodSpec(spec *v1.PodSpec, openShift bool) {
+	runAsNonRoot := true
+	allowPrivilegeEscalation := false
+	seccompProfile := &v1.SeccompProfile{Type: v1.SeccompProfileTypeRuntimeDefault}
+
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = &v1.PodSecurityContext{}
+	}
+	psc := spec.SecurityContext
+	psc.RunAsNonRoot = &runAsNonRoot
+	if psc.SeccompProfile == nil {
+		psc.SeccompProfile = seccompProfile
+	}
+	if openShift {
+		psc.RunAsUser = nil
+		psc.RunAsGroup = nil
+		psc.FSGroup = nil
+	}
+
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			if containers[i].SecurityContext == nil {
+				containers[i].SecurityContext = &v1.SecurityContext{}
+			}
+			sc := containers[i].SecurityContext
+			sc.RunAsNonRoot = &runAsNonRoot
+			sc.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+			sc.Capabilities = &v1.Capabilities{Drop: []v1.Capability{"ALL"}}
+			if sc.SeccompProfile == nil {
+				sc.SeccompProfile = seccompProfile
+			}
+			if openShift {
+				sc.RunAsUser = nil
+				sc.RunAsGroup = nil
+			}
+		}
+	}
+}
+
+// typedPodSpec converts the unstructured pod spec of a resource.
+func typedPodSpec(podSpec map[string]interface{}) (*v1.PodSpec, error) {
+	var spec v1.PodSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(podSpec, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// applySecurityContextProfile restricts the security contexts of a Vizier workload, according to the security
+// context profile of the Vizier. Workloads that require privileges are left as they are.
+func applySecurityContextProfile(vz *v1alpha1.Vizier, res map[string]interface{}) error {
+	profile := securityContextProfile(vz)
+	podSpec := podSpecOfResource(res)
+	if profile == v1alpha1.SecurityContextProfileDefault || podSpec == nil {
+		return nil
+	}
+	spec, err := typedPodSpec(podSpec)
+	if err != nil {
+		return err
+	}
+	if len(podSpecPrivileges(spec)) > 0 {
+		return nil
+	}
+	restrictPodSpec(spec, profile == v1alpha1.SecurityContextProfileOpenShift)
+
+	restricted, err := runtime.DefaultUnstructuredConverter.ToUnstructured(spec)
+	if err != nil {
+		return err
+	}
+	for k := range podSpec {
+		delete(podSpec, k)
+	}
+	for k, v := range restricted {
+		podSpec[k] = v
+	}
+	return nil
+}
+
+// getPrivilegedWorkloads returns the workloads among the resources that require privileges.
+func getPrivilegedWorkloads(resources []*k8s.Resource) ([]v1alpha1.PrivilegedWorkload, error) {
+	var workloads []v1alpha1.PrivilegedWorkload
+	for _, r := range resources {
+		podSpec := podSpecOfResource(r.Object.Object)
+		if podSpec == nil {
+			continue
+		}
+		spec, err := typedPodSpec(podSpec)
+		if err != nil {
+			return nil, err
+		}
+		reqs := podSpecPrivileges(spec)
+		if len(reqs) == 0 {
+			continue
+		}
+		serviceAccount := spec.ServiceAccountName
+		if serviceAccount == "" {
+			serviceAccount = "default"
+		}
+		workloads = append(workloads, v1alpha1.PrivilegedWorkload{
+			Kind:           r.Object.GetKind(),
+			Name:           r.Object.GetName(),
+			ServiceAccount: serviceAccount,
+			Requirements:   reqs,
+		})
+	}
+	return workloads, nil
+}
+
+// reconcilePrivilegedSCCBinding grants the service accounts of the privileged workloads the use of OpenShift's
+// privileged security context constraint, when the Vizier uses the OpenShift profile. Otherwise, the binding is
+// removed.
+func reconcilePrivilegedSCCBinding(ctx context.Context, clientset kubernetes.Interface, namespace string, vz *v1alpha1.Vizier, workloads []v1alpha1.PrivilegedWorkload) error {
+	bindings := clientset.RbacV1().RoleBindings(namespace)
+	if securityContextProfile(vz) != v1alpha1.SecurityContextProfileOpenShift || len(workloads) == 0 {
+		err := bindings.Delete(ctx, privilegedSCCRoleBinding, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var serviceAccounts []string
+	for _, w := range workloads {
+		if !seen[w.ServiceAccount] {
+			seen[w.ServiceAccount] = true
+			serviceAccounts = append(serviceAccounts, w.ServiceAccount)
+		}
+	}
+	sort.Strings(serviceAccounts)
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      privilegedSCCRoleBinding,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": "pl-monitoring"},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     privilegedSCCClusterRole,
+		},
+	}
+	for _, sa := range serviceAccounts {
+		binding.Subjects = append(binding.Subjects, rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: sa, Namespace: namespace})
+	}
+
+	existing, err := bindings.Get(ctx, privilegedSCCRoleBinding, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		log.WithField("serviceAccounts", serviceAccounts).Info("Granting the privileged security context constraint")
+		_, err = bindings.Create(ctx, binding, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Subjects = binding.Subjects
+	_, err = bindings.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// reconcilePrivilegedWorkloads reports the Vizier workloads that require privileges in the status of the Vizier,
+// and grants them the privileged security context constraint on OpenShift.
+func (r *VizierReconciler) reconcilePrivilegedWorkloads(ctx context.Context, namespace string, vz *v1alpha1.Vizier, resources []*k8s.Resource) error {
+	if securityContextProfile(vz) == v1alpha1.SecurityContextProfileDefault {
+		vz.Status.PrivilegedWorkloads = nil
+		return reconcilePrivilegedSCCBinding(ctx, r.Clientset, namespace, vz, nil)
+	}
+	workloads, err := getPrivilegedWorkloads(resources)
+	if err != nil {
+		return err
+	}
+	if err := reconcilePrivilegedSCCBinding(ctx, r.Clientset, namespace, vz, workloads); err != nil {
+		return err
+	}
+	vz.Status.PrivilegedWorkloads = workloads
+	if len(workloads) > 0 {
+		r.recordEvent(vz, v1.EventTypeNormal, eventReasonPrivilegedWorkloads,
+			"Not restricted by the %s profile: %s", securityContextProfile(vz), privilegedWorkloadsMessage(workloads))
+	}
+	return nil
+}
+
+// privilegedWorkloadsMessage describes why the privileged workloads can't be restricted.
+func privilegedWorkloadsMessage(workloads []v1alpha1.PrivilegedWorkload) string {
+	descs := make([]string, len(workloads))
+	for i, w := range workloads {
+		descs[i] = fmt.Sprintf("%s %s requires %s", w.Kind, w.Name, strings.Join(w.Requirements, ", "))
+	}
+	return strings.Join(descs, "; ")
+}
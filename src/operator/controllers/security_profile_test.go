@@ -0,0 +1,180 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/utils/shared/k8s"
+)
+
+const securityProfileTestYAML = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: vizier-query-broker
+spec:
+  template:
+    spec:
+      serviceAccountName: query-broker-service-account
+      initContainers:
+      - name: cc-wait
+        image: curl
+      containers:
+      - name: app
+        image: vizier-query_broker_image:latest
+        securityContext:
+          capabilities:
+            drop:
+            - ALL
+      securityContext:
+        runAsUser: 10100
+        runAsGroup: 10100
+        fsGroup: 10100
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: vizier-pem
+spec:
+  template:
+    spec:
+      containers:
+      - name: pem
+        image: vizier-pem_image:latest
+        securityContext:
+          capabilities:
+            add:
+            - SYS_PTRACE
+            - SYS_ADMIN
+          privileged: true
+      hostPID: true
+      hostNetwork: true
+      volumes:
+      - name: sys
+        hostPath:
+          path: /sys
+`
+
+func securityProfileResources(t *testing.T, profile v1alpha1.SecurityContextProfile) (*appsv1.Deployment, *appsv1.DaemonSet, []*k8s.Resource) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(securityProfileTestYAML))
+	require.NoError(t, err)
+	vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{SecurityContextProfile: profile}}
+	for _, r := range resources {
+		require.NoError(t, applySecurityContextProfile(vz, r.Object.Object))
+	}
+
+	var d appsv1.Deployment
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[0].Object.Object, &d))
+	var ds appsv1.DaemonSet
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(resources[1].Object.Object, &ds))
+	return &d, &ds, resources
+}
+
+func TestApplySecurityContextProfile(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		d, _, _ := securityProfileResources(t, "")
+		assert.Nil(t, d.Spec.Template.Spec.InitContainers[0].SecurityContext)
+		assert.Nil(t, d.Spec.Template.Spec.SecurityContext.RunAsNonRoot)
+	})
+
+	for _, profile := range []v1alpha1.SecurityContextProfile{v1alpha1.SecurityContextProfileRestricted, v1alpha1.SecurityContextProfileOpenShift} {
+		t.Run(string(profile), func(t *testing.T) {
+			d, ds, _ := securityProfileResources(t, profile)
+			pod := d.Spec.Template.Spec
+			assert.True(t, *pod.SecurityContext.RunAsNonRoot)
+			assert.Equal(t, v1.SeccompProfileTypeRuntimeDefault, pod.SecurityContext.SeccompProfile.Type)
+			for _, c := range append(pod.InitContainers, pod.Containers...) {
+				require.NotNil(t, c.SecurityContext, c.Name)
+				assert.False(t, *c.SecurityContext.AllowPrivilegeEscalation, c.Name)
+				assert.Equal(t, []v1.Capability{"ALL"}, c.SecurityContext.Capabilities.Drop, c.Name)
+				assert.Equal(t, v1.SeccompProfileTypeRuntimeDefault, c.SecurityContext.SeccompProfile.Type, c.Name)
+			}
+			if profile == v1alpha1.SecurityContextProfileOpenShift {
+				assert.Nil(t, pod.SecurityContext.RunAsUser)
+				assert.Nil(t, pod.SecurityContext.FSGroup)
+			} else {
+				assert.Equal(t, int64(10100), *pod.SecurityContext.RunAsUser)
+			}
+
+			// The PEMs require privileges, so they are left as they are.
+			pem := ds.Spec.Template.Spec
+			assert.Nil(t, pem.SecurityContext)
+			assert.True(t, *pem.Containers[0].SecurityContext.Privileged)
+		})
+	}
+}
+
+func TestGetPrivilegedWorkloads(t *testing.T) {
+	_, _, resources := securityProfileResources(t, v1alpha1.SecurityContextProfileRestricted)
+	workloads, err := getPrivilegedWorkloads(resources)
+	require.NoError(t, err)
+	assert.Equal(t, []v1alpha1.PrivilegedWorkload{{
+		Kind:           "DaemonSet",
+		Name:           "vizier-pem",
+		ServiceAccount: "default",
+		Requirements: []string{
+			"hostPID",
+			"hostNetwork",
+			"hostPath volume /sys",
+			"privileged container pem",
+			"capabilities SYS_PTRACE, SYS_ADMIN of container pem",
+		},
+	}}, workloads)
+	assert.Equal(t, "DaemonSet vizier-pem requires hostPID, hostNetwork, hostPath volume /sys, privileged container pem, "+
+		"capabilities SYS_PTRACE, SYS_ADMIN of container pem", privilegedWorkloadsMessage(workloads))
+}
+
+func TestReconcilePrivilegedSCCBinding(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	workloads := []v1alpha1.PrivilegedWorkload{
+		{Kind: "DaemonSet", Name: "vizier-pem", ServiceAccount: "default"},
+		{Kind: "Deployment", Name: "kelvin", ServiceAccount: "default"},
+	}
+	vz := &v1alpha1.Vizier{Spec: v1alpha1.VizierSpec{SecurityContextProfile: v1alpha1.SecurityContextProfileOpenShift}}
+
+	require.NoError(t, reconcilePrivilegedSCCBinding(ctx, clientset, "pl", vz, workloads))
+	binding, err := clientset.RbacV1().RoleBindings("pl").Get(ctx, privilegedSCCRoleBinding, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, privilegedSCCClusterRole, binding.RoleRef.Name)
+	require.Len(t, binding.Subjects, 1)
+	assert.Equal(t, "default", binding.Subjects[0].Name)
+
+	// Updating an existing binding is not an error.
+	require.NoError(t, reconcilePrivilegedSCCBinding(ctx, clientset, "pl", vz, workloads))
+
+	// The binding is removed when the profile is no longer OpenShift.
+	vz.Spec.SecurityContextProfile = v1alpha1.SecurityContextProfileRestricted
+	require.NoError(t, reconcilePrivilegedSCCBinding(ctx, clientset, "pl", vz, workloads))
+	_, err = clientset.RbacV1().RoleBindings("pl").Get(ctx, privilegedSCCRoleBinding, metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+}
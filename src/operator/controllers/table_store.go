@@ -0,0 +1,110 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+const (
+	tableSizeLimitsPEMFlag  = "PL_TABLE_STORE_TABLE_SIZE_LIMITS_MB"
+	tableRetentionPEMFlag   = "PL_TABLE_STORE_RETENTION_S"
+	defaultRetentionPEMFlag = "PL_TABLE_STORE_DEFAULT_RETENTION_S"
+)
+
+// quantityToMB converts a quantity such as "512Mi" to a whole number of MB, rounding up so that
+// small quantities don't become 0.
+func quantityToMB(q string) (int64, error) {
+	parsed, err := resource.ParseQuantity(q)
+	if err != nil {
+		return 0, err
+	}
+	return (parsed.Value() + (1 << 20) - 1) / (1 << 20), nil
+}
+
+// getTableStorePEMFlags translates the table store params of the Vizier into the PEM flags that configure them.
+func getTableStorePEMFlags(ts *v1alpha1.TableStoreParams) (map[string]string, error) {
+	flags := make(map[string]string)
+	if ts == nil {
+		return flags, nil
+	}
+
+	if ts.TotalSize != "" {
+		mb, err := quantityToMB(ts.TotalSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table store totalSize %q: %w", ts.TotalSize, err)
+		}
+		flags[tableStoreSizePEMFlag] = strconv.FormatInt(mb, 10)
+	}
+	if ts.Retention != nil {
+		flags[defaultRetentionPEMFlag] = strconv.FormatInt(int64(ts.Retention.Seconds()), 10)
+	}
+
+	// Sort the tables so that the flags, and therefore the PEM spec, don't change between reconciles.
+	names := make([]string, 0, len(ts.Tables))
+	for name := range ts.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sizeLimits, retentions []string
+	for _, name := range names {
+		table := ts.Tables[name]
+		if table.MaxSize != "" {
+			mb, err := quantityToMB(table.MaxSize)
+			if err != nil {
+				return nil, fmt.Errorf("invalid maxSize %q for table %s: %w", table.MaxSize, name, err)
+			}
+			sizeLimits = append(sizeLimits, fmt.Sprintf("%s=%d", name, mb))
+		}
+		if table.Retention != nil {
+			retentions = append(retentions, fmt.Sprintf("%s=%d", name, int64(table.Retention.Seconds())))
+		}
+	}
+	if len(sizeLimits) > 0 {
+		flags[tableSizeLimitsPEMFlag] = strings.Join(sizeLimits, ",")
+	}
+	if len(retentions) > 0 {
+		flags[tableRetentionPEMFlag] = strings.Join(retentions, ",")
+	}
+	return flags, nil
+}
+
+// getCustomPEMFlags returns the flags that should be passed to the PEM for the data collector params. Flags set
+// explicitly in customPEMFlags take precedence over the ones generated from the other params.
+func getCustomPEMFlags(dc *v1alpha1.DataCollectorParams) (map[string]string, error) {
+	if dc.TableStore == nil {
+		return dc.CustomPEMFlags, nil
+	}
+	flags, err := getTableStorePEMFlags(dc.TableStore)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range dc.CustomPEMFlags {
+		flags[k] = v
+	}
+	return flags, nil
+}
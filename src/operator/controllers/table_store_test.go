@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+func TestGetCustomPEMFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   *v1alpha1.DataCollectorParams
+		expected map[string]string
+	}{
+		{
+			name:     "no table store",
+			params:   &v1alpha1.DataCollectorParams{CustomPEMFlags: map[string]string{"PL_FOO": "bar"}},
+			expected: map[string]string{"PL_FOO": "bar"},
+		},
+		{
+			name: "table store",
+			params: &v1alpha1.DataCollectorParams{TableStore: &v1alpha1.TableStoreParams{
+				TotalSize: "2Gi",
+				Retention: &metav1.Duration{Duration: 24 * time.Hour},
+				Tables: map[string]v1alpha1.TableParams{
+					"http_events": {MaxSize: "512Mi", Retention: &metav1.Duration{Duration: time.Hour}},
+					"conn_stats":  {MaxSize: "100M"},
+					"dns_events":  {Retention: &metav1.Duration{Duration: 90 * time.Minute}},
+				},
+			}},
+			expected: map[string]string{
+				"PL_TABLE_STORE_DATA_LIMIT_MB":        "2048",
+				"PL_TABLE_STORE_DEFAULT_RETENTION_S":  "86400",
+				"PL_TABLE_STORE_TABLE_SIZE_LIMITS_MB": "conn_stats=96,http_events=512",
+				"PL_TABLE_STORE_RETENTION_S":          "dns_events=5400,http_events=3600",
+			},
+		},
+		{
+			name: "custom flags take precedence",
+			params: &v1alpha1.DataCollectorParams{
+				CustomPEMFlags: map[string]string{"PL_TABLE_STORE_DATA_LIMIT_MB": "4096"},
+				TableStore:     &v1alpha1.TableStoreParams{TotalSize: "1Gi"},
+			},
+			expected: map[string]string{"PL_TABLE_STORE_DATA_LIMIT_MB": "4096"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			flags, err := getCustomPEMFlags(tc.params)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, flags)
+		})
+	}
+}
+
+func TestGetCustomPEMFlags_InvalidSize(t *testing.T) {
+	_, err := getCustomPEMFlags(&v1alpha1.DataCollectorParams{TableStore: &v1alpha1.TableStoreParams{
+		Tables: map[string]v1alpha1.TableParams{"http_events": {MaxSize: "lots"}},
+	}})
+	assert.Error(t, err)
+}
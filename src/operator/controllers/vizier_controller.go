@@ -42,10 +42,15 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/vizierconfigpb"
@@ -66,6 +71,20 @@ const (
 	updatingFailedTimeout = 10 * time.Minute
 	// How often we should check whether a Vizier update failed.
 	updatingVizierCheckPeriod = 1 * time.Minute
+	// The number of recent Vizier releases to search for the latest stable release.
+	stableChannelSearchLimit = 50
+)
+
+// The reasons of the events that the operator records on the Vizier.
+const (
+	eventReasonDeployStarted         = "DeployStarted"
+	eventReasonDeployed              = "Deployed"
+	eventReasonDeployFailed          = "DeployFailed"
+	eventReasonUpdateStarted         = "UpdateStarted"
+	eventReasonUpdated               = "Updated"
+	eventReasonUpdateFailed          = "UpdateFailed"
+	eventReasonUpdateTimedOut        = "UpdateTimedOut"
+	eventReasonCloudConnectionFailed = "CloudConnectionFailed"
 )
 
 // defaultClassAnnotationKey is the key in the annotation map which indicates
@@ -85,21 +104,48 @@ type VizierReconciler struct {
 	Clientset  *kubernetes.Clientset
 	RestConfig *rest.Config
 
-	monitor      *VizierMonitor
-	lastChecksum []byte
-	K8sVersion   string
+	// monitors are the monitors of the Viziers in the cluster, keyed by the Vizier.
+	monitors map[k8stypes.NamespacedName]*VizierMonitor
+	// lastChecksums are the spec checksums of the last deploy of each Vizier.
+	lastChecksums map[k8stypes.NamespacedName][]byte
+	K8sVersion    string
+
+	// Settings are the operator settings from the OperatorConfig. If nil, the defaults are used.
+	Settings *OperatorSettings
+
+	// Recorder records Kubernetes events on the Vizier, so that `kubectl describe vizier` shows the progress
+	// of the reconciliation. If nil, no events are recorded.
+	Recorder record.EventRecorder
+
+	// Events publishes CloudEvents about the lifecycle of the Viziers. If nil, no CloudEvents are published.
+	Events *LifecycleEventPublisher
 
 	sentryFlush func()
 }
 
+// recordEvent records an event on the Vizier, if the reconciler has a recorder.
+func (r *VizierReconciler) recordEvent(vz *v1alpha1.Vizier, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(vz, eventType, reason, messageFmt, args...)
+}
+
 // +kubebuilder:rbac:groups=pixie.px.dev,resources=viziers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=pixie.px.dev,resources=viziers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=pixie.px.dev,resources=viziers/finalizers,verbs=update
+
+// devCloudAddr is the address of the API service of a dev cloud, which Vizier is redirected to when the
+// devCloudNamespace is set.
+func devCloudAddr(devCloudNS string) string {
+	return fmt.Sprintf("api-service.%s.svc.cluster.local:51200", devCloudNS)
+}
 
 func getCloudClientConnection(cloudAddr string, devCloudNS string, extraDialOpts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	isInternal := false
 
 	if devCloudNS != "" {
-		cloudAddr = fmt.Sprintf("api-service.%s.svc.cluster.local:51200", devCloudNS)
+		cloudAddr = devCloudAddr(devCloudNS)
 		isInternal = true
 	}
 
@@ -117,22 +163,47 @@ func getCloudClientConnection(cloudAddr string, devCloudNS string, extraDialOpts
 	return c, nil
 }
 
-func getLatestVizierVersion(ctx context.Context, client cloudpb.ArtifactTrackerClient) (string, error) {
+// getArtifactTrackerClient returns a client for the artifact tracker mirror in the operator settings, or
+// for the artifact tracker behind the given cloud connection if there is no mirror. The returned
+// function closes any connection that was opened for the client.
+func getArtifactTrackerClient(settings *OperatorSettings, cloudClient *grpc.ClientConn) (cloudpb.ArtifactTrackerClient, func(), error) {
+	mirror := settings.ArtifactMirror()
+	if mirror == "" {
+		return cloudpb.NewArtifactTrackerClient(cloudClient), func() {}, nil
+	}
+	conn, err := getCloudClientConnection(mirror, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return cloudpb.NewArtifactTrackerClient(conn), func() { conn.Close() }, nil
+}
+
+func getLatestVizierVersion(ctx context.Context, client cloudpb.ArtifactTrackerClient, channel v1alpha1.UpdateChannel) (string, error) {
 	req := &cloudpb.GetArtifactListRequest{
 		ArtifactName: "vizier",
 		ArtifactType: cloudpb.AT_CONTAINER_SET_YAMLS,
 		Limit:        1,
 	}
+	// The latest stable release may be behind several prereleases.
+	if channel == v1alpha1.UpdateChannelStable {
+		req.Limit = stableChannelSearchLimit
+	}
 	resp, err := client.GetArtifactList(ctx, req)
 	if err != nil {
 		return "", err
 	}
 
-	if len(resp.Artifact) != 1 {
-		return "", errors.New("Could not find Vizier artifact")
+	for _, artifact := range resp.Artifact {
+		if channel == v1alpha1.UpdateChannelStable {
+			v, err := semver.Parse(artifact.VersionStr)
+			if err != nil || len(v.Pre) > 0 {
+				continue
+			}
+		}
+		return artifact.VersionStr, nil
 	}
 
-	return resp.Artifact[0].VersionStr, nil
+	return "", errors.New("Could not find Vizier artifact")
 }
 
 // Kubernetes used to have in-tree plugins for a variety of vendor CSI drivers.
@@ -262,37 +333,64 @@ func (r *VizierReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			log.WithError(err).Info("Failed to delete Vizier instance")
 		}
 
-		if r.monitor != nil && r.monitor.namespace == req.Namespace {
-			r.monitor.Quit()
-			r.monitor = nil
-		}
+		r.stopMonitor(req.NamespacedName)
 		// Vizier CRD deleted. The vizier instance should also be deleted.
 		return ctrl.Result{}, err
 	}
 
+	if !vizier.ObjectMeta.DeletionTimestamp.IsZero() {
+		err := r.finalizeVizier(ctx, req, &vizier)
+		if err != nil {
+			log.WithError(err).Info("Failed to finalize Vizier instance")
+			return ctrl.Result{}, err
+		}
+		r.stopMonitor(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	// The finalizer lets the operator apply the deletion policy before the Vizier is removed.
+	if !controllerutil.ContainsFinalizer(&vizier, vizierFinalizer) {
+		controllerutil.AddFinalizer(&vizier, vizierFinalizer)
+		if err := r.Update(ctx, &vizier); err != nil {
+			log.WithError(err).Info("Failed to add finalizer to Vizier")
+			return ctrl.Result{}, err
+		}
+	}
+
+	conflict, err := vizierConflict(ctx, r.Client, r.Clientset, &vizier, r.Settings.FeatureEnabled(v1alpha1.FeatureGateMultiVizier))
+	if err != nil {
+		log.WithError(err).Info("Failed to check for conflicting Viziers")
+		return ctrl.Result{}, err
+	}
+	if conflict != "" {
+		r.stopMonitor(req.NamespacedName)
+		r.markVizierConflict(ctx, &vizier, conflict)
+		return ctrl.Result{RequeueAfter: r.Settings.ResyncPeriod()}, nil
+	}
+
 	// Check if vizier already exists, if not create a new vizier.
 	if vizier.Status.VizierPhase == v1alpha1.VizierPhaseNone && vizier.Status.ReconciliationPhase == v1alpha1.ReconciliationPhaseNone {
 		// We are creating a new vizier instance.
 		err := r.createVizier(ctx, req, &vizier)
 		if err != nil {
 			log.WithError(err).Info("Failed to deploy new Vizier instance")
+			r.recordEvent(&vizier, v1.EventTypeWarning, eventReasonDeployFailed, "Failed to deploy Vizier: %v", err)
 		}
 		return ctrl.Result{}, err
 	}
 
-	err := r.updateVizier(ctx, req, &vizier)
+	err = r.updateVizier(ctx, req, &vizier)
 	if err != nil {
 		log.WithError(err).Info("Failed to update Vizier instance")
+		r.recordEvent(&vizier, v1.EventTypeWarning, eventReasonUpdateFailed, "Failed to update Vizier: %v", err)
 	}
 
 	// Check if we are already monitoring this Vizier.
-	if r.monitor == nil || r.monitor.namespace != req.Namespace || r.monitor.devCloudNamespace != vizier.Spec.DevCloudNamespace {
-		if r.monitor != nil {
-			r.monitor.Quit()
-			r.monitor = nil
-		}
+	if m, ok := r.monitors[req.NamespacedName]; !ok || m.devCloudNamespace != vizier.Spec.DevCloudNamespace {
+		r.stopMonitor(req.NamespacedName)
 
-		r.monitor = &VizierMonitor{
+		m = &VizierMonitor{
+			settings:          r.Settings,
 			namespace:         req.Namespace,
 			namespacedName:    req.NamespacedName,
 			devCloudNamespace: vizier.Spec.DevCloudNamespace,
@@ -301,11 +399,14 @@ func (r *VizierReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			clientset:         r.Clientset,
 			vzSpecUpdate:      r.Update,
 			restConfig:        r.RestConfig,
+			recorder:          r.Recorder,
+			events:            r.Events,
 		}
 
 		cloudClient, err := getCloudClientConnection(vizier.Spec.CloudAddr, vizier.Spec.DevCloudNamespace, grpc.FailOnNonTempDialError(true), grpc.WithBlock())
 		if err != nil {
 			vizier.SetStatus(status.UnableToConnectToCloud)
+			r.recordEvent(&vizier, v1.EventTypeWarning, eventReasonCloudConnectionFailed, "Failed to connect to Pixie Cloud at %s: %v", vizier.Spec.CloudAddr, err)
 			err := r.Status().Update(ctx, &vizier)
 			if err != nil {
 				if strings.Contains(err.Error(), "timeout") {
@@ -322,7 +423,11 @@ func (r *VizierReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			r.sentryFlush = setupSentry(ctx, cloudClient, r.Clientset)
 		}
 
-		r.monitor.InitAndStartMonitor(cloudClient)
+		m.InitAndStartMonitor(cloudClient)
+		if r.monitors == nil {
+			r.monitors = make(map[k8stypes.NamespacedName]*VizierMonitor)
+		}
+		r.monitors[req.NamespacedName] = m
 
 		// Update operator version
 		vizier.Status.OperatorVersion = version.GetVersion().ToString()
@@ -337,7 +442,26 @@ func (r *VizierReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	// Vizier CRD has been updated, and we should update the running vizier accordingly.
-	return ctrl.Result{}, err
+	return ctrl.Result{RequeueAfter: r.Settings.ResyncPeriod()}, err
+}
+
+// stopMonitor stops monitoring the Vizier, if it is being monitored.
+func (r *VizierReconciler) stopMonitor(name k8stypes.NamespacedName) {
+	if m, ok := r.monitors[name]; ok {
+		m.Quit()
+		delete(r.monitors, name)
+	}
+}
+
+// markVizierConflict surfaces why the Vizier isn't deployed in its status and as an event.
+func (r *VizierReconciler) markVizierConflict(ctx context.Context, vz *v1alpha1.Vizier, conflict string) {
+	log.WithField("namespace", vz.Namespace).WithField("vizier", vz.Name).WithField("conflict", conflict).Info("Not deploying conflicting Vizier")
+	vz.SetCondition(v1alpha1.VizierConditionDegraded, metav1.ConditionTrue, vizierConditionReasonConflict, conflict)
+	err := r.Status().Update(ctx, vz)
+	if err != nil {
+		log.WithError(err).Error("Failed to update vizier status")
+	}
+	r.recordEvent(vz, v1.EventTypeWarning, eventReasonVizierConflict, "%s", conflict)
 }
 
 // updateVizier updates the vizier instance according to the spec.
@@ -354,7 +478,7 @@ func (r *VizierReconciler) updateVizier(ctx context.Context, req ctrl.Request, v
 		return nil
 	}
 
-	if len(vz.Status.Checksum) == 0 && bytes.Equal(checksum, r.lastChecksum) {
+	if len(vz.Status.Checksum) == 0 && bytes.Equal(checksum, r.lastChecksums[req.NamespacedName]) {
 		log.Warn("No checksum written to status")
 		log.Info("Checksums matched, no need to reconcile")
 		return nil
@@ -366,6 +490,20 @@ func (r *VizierReconciler) updateVizier(ctx context.Context, req ctrl.Request, v
 	}
 	log.Infof("Status checksum '%x' does not match spec checksum '%x' - running an update", vz.Status.Checksum, checksum)
 
+	if vz.Spec.DryRun {
+		return r.planVizierChanges(ctx, req, vz, true)
+	}
+
+	if canaryUpgradeEnabled(vz) && vz.Status.Version != "" && vz.Status.Version != vz.Spec.Version {
+		if vz.Status.Upgrade == nil || vz.Status.Upgrade.ToVersion != vz.Spec.Version {
+			return r.startCanaryUpgrade(ctx, req, vz)
+		}
+		if canaryUpgradeHoldsDeploy(vz) {
+			log.WithField("phase", vz.Status.Upgrade.Phase).Info("Waiting for canary upgrade")
+			return nil
+		}
+	}
+
 	return r.deployVizier(ctx, req, vz, true)
 }
 
@@ -379,8 +517,12 @@ func (r *VizierReconciler) deleteVizier(ctx context.Context, req ctrl.Request) e
 		Timeout:    2 * time.Minute,
 	}
 
+	// Viziers in different namespaces may have the same name, so the resources that are labeled with the
+	// namespace are deleted by it. This keeps the cluster-scoped resources of the other Viziers. Resources
+	// without the label were deployed before the MultiVizier feature was enabled.
 	keyValueLabel := operatorAnnotation + "=" + req.Name
-	_, _ = od.DeleteByLabel(keyValueLabel)
+	_, _ = od.DeleteByLabel(keyValueLabel + "," + vizierNamespaceLabel + "=" + req.Namespace)
+	_, _ = od.DeleteByLabel(keyValueLabel + ",!" + vizierNamespaceLabel)
 	return nil
 }
 
@@ -390,6 +532,7 @@ func (r *VizierReconciler) createVizier(ctx context.Context, req ctrl.Request, v
 	cloudClient, err := getCloudClientConnection(vz.Spec.CloudAddr, vz.Spec.DevCloudNamespace)
 	if err != nil {
 		vz.SetStatus(status.UnableToConnectToCloud)
+		r.recordEvent(vz, v1.EventTypeWarning, eventReasonCloudConnectionFailed, "Failed to connect to Pixie Cloud at %s: %v", vz.Spec.CloudAddr, err)
 		err := r.Status().Update(ctx, vz)
 		if err != nil {
 			if strings.Contains(err.Error(), "timeout") {
@@ -405,8 +548,13 @@ func (r *VizierReconciler) createVizier(ctx context.Context, req ctrl.Request, v
 	// If no version is set, we should fetch the latest version. This will trigger another reconcile that will do
 	// the actual vizier deployment.
 	if vz.Spec.Version == "" {
-		atClient := cloudpb.NewArtifactTrackerClient(cloudClient)
-		latest, err := getLatestVizierVersion(ctx, atClient)
+		atClient, closeAT, err := getArtifactTrackerClient(r.Settings, cloudClient)
+		if err != nil {
+			log.WithError(err).Error("Failed to connect to artifact tracker")
+			return err
+		}
+		latest, err := getLatestVizierVersion(ctx, atClient, r.Settings.UpdateChannel())
+		closeAT()
 		if err != nil {
 			log.WithError(err).Error("Failed to get latest Vizier version")
 			return err
@@ -420,6 +568,9 @@ func (r *VizierReconciler) createVizier(ctx context.Context, req ctrl.Request, v
 		return nil
 	}
 
+	if vz.Spec.DryRun {
+		return r.planVizierChanges(ctx, req, vz, false)
+	}
 	return r.deployVizier(ctx, req, vz, false)
 }
 
@@ -428,6 +579,7 @@ func (r *VizierReconciler) deployVizier(ctx context.Context, req ctrl.Request, v
 	cloudClient, err := getCloudClientConnection(vz.Spec.CloudAddr, vz.Spec.DevCloudNamespace)
 	if err != nil {
 		vz.SetStatus(status.UnableToConnectToCloud)
+		r.recordEvent(vz, v1.EventTypeWarning, eventReasonCloudConnectionFailed, "Failed to connect to Pixie Cloud at %s: %v", vz.Spec.CloudAddr, err)
 		err := r.Status().Update(ctx, vz)
 		if err != nil {
 			if strings.Contains(err.Error(), "timeout") {
@@ -442,27 +594,24 @@ func (r *VizierReconciler) deployVizier(ctx context.Context, req ctrl.Request, v
 
 	// Set the status of the Vizier.
 	vz.SetReconciliationPhase(v1alpha1.ReconciliationPhaseUpdating)
+	if update {
+		vz.SetCondition(v1alpha1.VizierConditionUpdateInProgress, metav1.ConditionTrue, string(v1alpha1.ReconciliationPhaseUpdating),
+			fmt.Sprintf("Updating Vizier from version %s to %s.", vz.Status.Version, vz.Spec.Version))
+	}
 	err = r.Status().Update(ctx, vz)
 	if err != nil {
 		log.WithError(err).Error("Failed to update status in Vizier spec")
 		return err
 	}
-
-	// Add an additional annotation to our deployed vizier-resources, to allow easier tracking of the vizier resources.
-	if vz.Spec.Pod == nil {
-		vz.Spec.Pod = &v1alpha1.PodPolicy{}
-	}
-
-	if vz.Spec.Pod.Annotations == nil {
-		vz.Spec.Pod.Annotations = make(map[string]string)
-	}
-
-	if vz.Spec.Pod.Labels == nil {
-		vz.Spec.Pod.Labels = make(map[string]string)
+	if update {
+		r.recordEvent(vz, v1.EventTypeNormal, eventReasonUpdateStarted, "Updating Vizier to version %s", vz.Spec.Version)
+	} else {
+		r.recordEvent(vz, v1.EventTypeNormal, eventReasonDeployStarted, "Deploying Vizier version %s", vz.Spec.Version)
 	}
 
-	if vz.Spec.Pod.NodeSelector == nil {
-		vz.Spec.Pod.NodeSelector = make(map[string]string)
+	addOperatorMetadata(vz, req.Name)
+	if r.Settings.FeatureEnabled(v1alpha1.FeatureGateMultiVizier) {
+		addMultiVizierMetadata(vz)
 	}
 
 	if !vz.Spec.UseEtcdOperator && !update {
@@ -481,9 +630,6 @@ func (r *VizierReconciler) deployVizier(ctx context.Context, req ctrl.Request, v
 		}
 	}
 
-	vz.Spec.Pod.Annotations[operatorAnnotation] = req.Name
-	vz.Spec.Pod.Labels[operatorAnnotation] = req.Name
-
 	// Update the spec in the k8s api as other parts of the code expect this to be true.
 	err = r.Update(ctx, vz)
 	if err != nil {
@@ -569,38 +715,98 @@ func (r *VizierReconciler) deployVizier(ctx context.Context, req ctrl.Request, v
 			log.Info("Deleted vizier-metadata deployment")
 		}
 	}
+	if vz.Status.Upgrade != nil && vz.Status.Upgrade.Phase != v1alpha1.UpgradePhaseRolledBack {
+		// The PEM DaemonSets take over the canary nodes again once they are updated.
+		err = newCanaryUpgrader(r.Clientset).cleanup(ctx, vz)
+		if err != nil {
+			log.WithError(err).Error("Failed to clean up canary PEMs")
+			return err
+		}
+	}
 	err = r.deployVizierCore(ctx, req.Namespace, vz, yamlMap, update)
 	if err != nil {
 		log.WithError(err).Info("Failed to deploy Vizier core")
 		return err
 	}
 
+	err = r.reconcileJetStream(ctx, req.Namespace, vz)
+	if err != nil {
+		log.WithError(err).Error("Failed to reconcile JetStream streams")
+		return err
+	}
+
+	err = newEndpointExposer(r.Clientset, r.Client).reconcile(ctx, vz)
+	if err != nil {
+		log.WithError(err).Error("Failed to expose the query endpoint")
+		return err
+	}
+
 	// TODO(michellenguyen): Remove when the operator has the ability to ping CloudConn for Vizier Version.
 	// We are currently blindly assuming that the new version is correct.
 	_ = waitForCluster(r.Clientset, req.Namespace)
 
 	// Refetch the Vizier resource, as it may have changed in the time in which we were waiting for the cluster.
+	privilegedWorkloads := vz.Status.PrivilegedWorkloads
 	err = r.Get(ctx, req.NamespacedName, vz)
 	if err != nil {
 		log.WithError(err).Info("Failed to get vizier after deploy. Vizier was likely deleted")
 		// The Vizier was deleted in the meantime. Do nothing.
 		return nil
 	}
+	vz.Status.PrivilegedWorkloads = privilegedWorkloads
 
+	previousVersion := vz.Status.Version
 	vz.Status.Version = vz.Spec.Version
 	vz.SetReconciliationPhase(v1alpha1.ReconciliationPhaseReady)
 
 	vz.Status.Checksum = checksum
-	r.lastChecksum = checksum
+	if r.lastChecksums == nil {
+		r.lastChecksums = make(map[k8stypes.NamespacedName][]byte)
+	}
+	r.lastChecksums[req.NamespacedName] = checksum
 	err = r.Status().Update(ctx, vz)
 	if err != nil {
 		return err
 	}
+	if update {
+		r.recordEvent(vz, v1.EventTypeNormal, eventReasonUpdated, "Updated Vizier to version %s", vz.Spec.Version)
+		if previousVersion != vz.Status.Version {
+			ev := newVizierCloudEvent(cloudEventVizierUpgraded, vz)
+			ev.Data.PreviousVersion = previousVersion
+			r.Events.emit(ev)
+		}
+	} else {
+		r.recordEvent(vz, v1.EventTypeNormal, eventReasonDeployed, "Deployed Vizier version %s", vz.Spec.Version)
+		r.Events.emit(newVizierCloudEvent(cloudEventVizierDeployed, vz))
+	}
 
 	log.Info("Vizier deploy is complete")
 	return nil
 }
 
+// addOperatorMetadata adds an additional annotation and label to our deployed vizier-resources, to allow easier
+// tracking of the vizier resources.
+func addOperatorMetadata(vz *v1alpha1.Vizier, name string) {
+	if vz.Spec.Pod == nil {
+		vz.Spec.Pod = &v1alpha1.PodPolicy{}
+	}
+
+	if vz.Spec.Pod.Annotations == nil {
+		vz.Spec.Pod.Annotations = make(map[string]string)
+	}
+
+	if vz.Spec.Pod.Labels == nil {
+		vz.Spec.Pod.Labels = make(map[string]string)
+	}
+
+	if vz.Spec.Pod.NodeSelector == nil {
+		vz.Spec.Pod.NodeSelector = make(map[string]string)
+	}
+
+	vz.Spec.Pod.Annotations[operatorAnnotation] = name
+	vz.Spec.Pod.Labels[operatorAnnotation] = name
+}
+
 func getSpecChecksum(vz *v1alpha1.Vizier) ([]byte, error) {
 	specStr, err := json.Marshal(vz.Spec)
 	if err != nil {
@@ -613,6 +819,9 @@ func getSpecChecksum(vz *v1alpha1.Vizier) ([]byte, error) {
 }
 
 func (r *VizierReconciler) upgradeNats(ctx context.Context, namespace string, vz *v1alpha1.Vizier, yamlMap map[string]string) error {
+	if externalNATS(vz) != nil {
+		return r.useExternalNATS(ctx, namespace, vz)
+	}
 	log.Info("Upgrading NATS if necessary")
 
 	ss, err := r.Clientset.AppsV1().StatefulSets(namespace).Get(ctx, "pl-nats", metav1.GetOptions{})
@@ -632,12 +841,28 @@ func (r *VizierReconciler) upgradeNats(ctx context.Context, namespace string, vz
 	if err != nil {
 		return err
 	}
+	resources, err = configureNATSCluster(resources, namespace, vz)
+	if err != nil {
+		return err
+	}
+	natsCreds, err := getNATSCredentials(ctx, r.Clientset, namespace, vz)
+	if err != nil {
+		return err
+	}
+	err = configureNATSServerAuth(resources, natsCreds)
+	if err != nil {
+		return err
+	}
 
 	var newSS appsv1.StatefulSet
 	for _, r := range resources {
 		if r.GVK.Kind != "StatefulSet" {
 			continue
 		}
+		err = updateResourceConfiguration(r, vz)
+		if err != nil {
+			return err
+		}
 		err = runtime.DefaultUnstructuredConverter.FromUnstructured(r.Object.UnstructuredContent(), &newSS)
 		if err != nil {
 			log.WithError(err).Info("Could not decode NATS Statefulset")
@@ -651,7 +876,13 @@ func (r *VizierReconciler) upgradeNats(ctx context.Context, namespace string, vz
 		return r.deployNATSStatefulset(ctx, namespace, vz, yamlMap)
 	}
 
-	if natsImage == newSS.Spec.Template.Spec.Containers[0].Image {
+	jsChanged, err := natsJetStreamConfigChanged(ctx, r.Clientset, namespace, vz)
+	if err != nil {
+		return err
+	}
+
+	if natsImage == newSS.Spec.Template.Spec.Containers[0].Image && !jsChanged && !natsClusterChanged(ss, &newSS) &&
+		!natsAuthChanged(ss, &newSS) && !schedulingChanged(&ss.Spec.Template.Spec, &newSS.Spec.Template.Spec) {
 		log.Info("NATS up to date. Nothing to do.")
 		return nil
 	}
@@ -661,10 +892,10 @@ func (r *VizierReconciler) upgradeNats(ctx context.Context, namespace string, vz
 }
 
 func (r *VizierReconciler) deployVizierCerts(ctx context.Context, namespace string, vz *v1alpha1.Vizier) error {
-	return deployCerts(ctx, namespace, vz, r.Clientset, r.RestConfig, false)
+	return deployCerts(ctx, namespace, vz, r.Clientset, r.RestConfig)
 }
 
-func deployCerts(ctx context.Context, namespace string, vz *v1alpha1.Vizier, clientset kubernetes.Interface, restConfig *rest.Config, update bool) error {
+func deployCerts(ctx context.Context, namespace string, vz *v1alpha1.Vizier, clientset kubernetes.Interface, restConfig *rest.Config) error {
 	log.Info("Generating certs")
 
 	// Assign JWT signing key.
@@ -684,50 +915,53 @@ func deployCerts(ctx context.Context, namespace string, vz *v1alpha1.Vizier, cli
 		return err
 	}
 
-	certYAMLs, err := certs.GenerateVizierCertYAMLs(namespace)
+	resources, err := generateSignedVizierCertResources(ctx, clientset, namespace, vz)
 	if err != nil {
 		return err
 	}
+	return k8s.ApplyResources(clientset, restConfig, resources, namespace, nil, false)
+}
 
-	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(certYAMLs))
+// generateVizierCertResources generates the secrets with a new set of Vizier service certs, which are signed by
+// a newly generated CA.
+func generateVizierCertResources(namespace string, vz *v1alpha1.Vizier) ([]*k8s.Resource, error) {
+	certYAMLs, err := certs.GenerateVizierCertYAMLs(namespace)
 	if err != nil {
-		return err
-	}
-	for _, r := range resources {
-		err = updateResourceConfiguration(r, vz)
-		if err != nil {
-			return err
-		}
+		return nil, err
 	}
-
-	return k8s.ApplyResources(clientset, restConfig, resources, namespace, nil, update)
+	return generateVizierResources(certYAMLs, vz)
 }
 
 // deployVizierConfigs deploys the secrets, configmaps, and certs that are necessary for running vizier.
 func (r *VizierReconciler) deployVizierConfigs(ctx context.Context, namespace string, vz *v1alpha1.Vizier, yamlMap map[string]string) error {
 	log.Info("Deploying Vizier configs and secrets")
-	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlMap["secrets"]))
+	resources, err := generateVizierResources(yamlMap["secrets"], vz)
 	if err != nil {
 		return err
 	}
-	for _, r := range resources {
-		err = updateResourceConfiguration(r, vz)
-		if err != nil {
-			return err
-		}
-	}
 	return k8s.ApplyResources(r.Clientset, r.RestConfig, resources, namespace, nil, false)
 }
 
 // deployNATSStatefulset deploys nats to the given namespace.
 func (r *VizierReconciler) deployNATSStatefulset(ctx context.Context, namespace string, vz *v1alpha1.Vizier, yamlMap map[string]string) error {
+	if externalNATS(vz) != nil {
+		return r.useExternalNATS(ctx, namespace, vz)
+	}
 	log.Info("Deploying NATS")
-	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlMap["nats"]))
+	natsCreds, err := getNATSCredentials(ctx, r.Clientset, namespace, vz)
 	if err != nil {
 		return err
 	}
-	for _, r := range resources {
-		err = updateResourceConfiguration(r, vz)
+	resources, err := generateNATSResources(namespace, vz, yamlMap, natsCreds)
+	if err != nil {
+		return err
+	}
+	err = migrateNATSJetStream(ctx, r.Clientset, namespace, vz)
+	if err != nil {
+		return err
+	}
+	if getNATSReplicas(vz) == 1 {
+		err = deleteNATSPodDisruptionBudget(ctx, r.Clientset, namespace)
 		if err != nil {
 			return err
 		}
@@ -738,16 +972,10 @@ func (r *VizierReconciler) deployNATSStatefulset(ctx context.Context, namespace
 // deployEtcdStatefulset deploys etcd to the given namespace.
 func (r *VizierReconciler) deployEtcdStatefulset(ctx context.Context, namespace string, vz *v1alpha1.Vizier, yamlMap map[string]string) error {
 	log.Info("Deploying etcd")
-	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlMap["etcd"]))
+	resources, err := generateVizierResources(yamlMap["etcd"], vz)
 	if err != nil {
 		return err
 	}
-	for _, r := range resources {
-		err = updateResourceConfiguration(r, vz)
-		if err != nil {
-			return err
-		}
-	}
 	return retryDeploy(r.Clientset, r.RestConfig, namespace, resources, false)
 }
 
@@ -755,35 +983,130 @@ func (r *VizierReconciler) deployEtcdStatefulset(ctx context.Context, namespace
 func (r *VizierReconciler) deployVizierCore(ctx context.Context, namespace string, vz *v1alpha1.Vizier, yamlMap map[string]string, allowUpdate bool) error {
 	log.Info("Deploying Vizier")
 
-	vzYaml := "vizier_persistent"
-	if vz.Spec.UseEtcdOperator {
-		vzYaml = "vizier_etcd"
+	natsCreds, err := getNATSCredentials(ctx, r.Clientset, namespace, vz)
+	if err != nil {
+		log.WithError(err).Error("Failed to get the NATS credentials of the Vizier components")
+		return err
 	}
-
-	if vz.Spec.Autopilot {
-		vzYaml = fmt.Sprintf("%s_ap", vzYaml)
+	resources, err := generateVizierCoreResources(vz, yamlMap, natsCreds)
+	if err != nil {
+		return err
+	}
+	err = r.reconcilePrivilegedWorkloads(ctx, namespace, vz, resources)
+	if err != nil {
+		log.WithError(err).Error("Failed to reconcile the privileged workloads")
+		return err
+	}
+	err = retryDeploy(r.Clientset, r.RestConfig, namespace, resources, allowUpdate)
+	if err != nil {
+		log.WithError(err).Error("Retry deploy of Vizier failed")
+		return err
 	}
 
-	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlMap[vzYaml]))
+	return nil
+}
+
+// generateVizierCoreResources generates the core pods and services for running vizier, configured for the
+// Vizier's spec. The components are given their own NATS users if natsCreds is set.
+func generateVizierCoreResources(vz *v1alpha1.Vizier, yamlMap map[string]string, natsCreds *natsCredentials) ([]*k8s.Resource, error) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlMap[vizierYAMLName(vz)]))
 	if err != nil {
 		log.WithError(err).Error("Error getting resources from Vizier YAML")
-		return err
+		return nil, err
 	}
 
 	for _, r := range resources {
 		err = updateResourceConfiguration(r, vz)
 		if err != nil {
 			log.WithError(err).Error("Failed to update resource configuration for resources")
-			return err
+			return nil, err
 		}
 	}
-	err = retryDeploy(r.Clientset, r.RestConfig, namespace, resources, allowUpdate)
+	resources, err = configurePEMAutoscaling(resources, vz)
 	if err != nil {
-		log.WithError(err).Error("Retry deploy of Vizier failed")
-		return err
+		log.WithError(err).Error("Failed to configure PEM autoscaling")
+		return nil, err
+	}
+	err = configureMetadataRestore(resources, vz)
+	if err != nil {
+		log.WithError(err).Error("Failed to configure metadata restore")
+		return nil, err
+	}
+	err = configureExternalNATS(resources, vz)
+	if err != nil {
+		log.WithError(err).Error("Failed to configure the external NATS cluster")
+		return nil, err
+	}
+	err = configureNATSComponentCredentials(resources, natsCreds)
+	if err != nil {
+		log.WithError(err).Error("Failed to configure the NATS credentials of the Vizier components")
+		return nil, err
 	}
+	if isNamespacedVizier(vz) {
+		err = namespaceClusterScopedResources(resources, vz.Namespace)
+		if err != nil {
+			log.WithError(err).Error("Failed to namespace the cluster-scoped resources")
+			return nil, err
+		}
+	}
+	return resources, nil
+}
 
-	return nil
+// generateNATSResources generates the NATS resources, configured for the Vizier's spec. The servers require the
+// users of the Vizier components if natsCreds is set.
+func generateNATSResources(namespace string, vz *v1alpha1.Vizier, yamlMap map[string]string, natsCreds *natsCredentials) ([]*k8s.Resource, error) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlMap["nats"]))
+	if err != nil {
+		return nil, err
+	}
+	resources, err = configureNATSCluster(resources, namespace, vz)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resources {
+		err = updateResourceConfiguration(r, vz)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = configureNATSJetStream(resources, vz)
+	if err != nil {
+		return nil, err
+	}
+	err = configureNATSServerAuth(resources, natsCreds)
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// generateVizierResources parses the resources in the YAML and applies the resource configuration of the Vizier's
+// spec to them.
+func generateVizierResources(yamlStr string, vz *v1alpha1.Vizier) ([]*k8s.Resource, error) {
+	resources, err := k8s.GetResourcesFromYAML(strings.NewReader(yamlStr))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resources {
+		err = updateResourceConfiguration(r, vz)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// vizierYAMLName returns the name of the YAML with the core Vizier resources for the Vizier's spec.
+func vizierYAMLName(vz *v1alpha1.Vizier) string {
+	vzYaml := "vizier_persistent"
+	if vz.Spec.UseEtcdOperator {
+		vzYaml = "vizier_etcd"
+	}
+
+	if vz.Spec.Autopilot {
+		vzYaml = fmt.Sprintf("%s_ap", vzYaml)
+	}
+	return vzYaml
 }
 
 func updateResourceConfiguration(resource *k8s.Resource, vz *v1alpha1.Vizier) error {
@@ -792,7 +1115,11 @@ func updateResourceConfiguration(resource *k8s.Resource, vz *v1alpha1.Vizier) er
 	addKeyValueMapToResource("annotations", vz.Spec.Pod.Annotations, resource.Object.Object)
 	updateResourceRequirements(vz.Spec.Pod.Resources, resource.Object.Object)
 	updatePodSpec(vz.Spec.Pod.NodeSelector, vz.Spec.Pod.Tolerations, vz.Spec.Pod.SecurityContext, resource.Object.Object)
-	return nil
+	if err := applySecurityContextProfile(vz, resource.Object.Object); err != nil {
+		return err
+	}
+	applyRegistryMirror(vz.Spec.RegistryMirror, resource.Object.Object)
+	return applyComponentScheduling(vz, resource)
 }
 
 func convertResourceType(originalLst v1.ResourceList) *vizierconfigpb.ResourceList {
@@ -845,10 +1172,14 @@ func generateVizierYAMLsConfig(ctx context.Context, ns string, k8sVersion string
 	}
 
 	if vz.Spec.DataCollectorParams != nil {
+		customPEMFlags, err := getCustomPEMFlags(vz.Spec.DataCollectorParams)
+		if err != nil {
+			return nil, err
+		}
 		req.VzSpec.DataCollectorParams = &vizierconfigpb.DataCollectorParams{
 			DatastreamBufferSize:      vz.Spec.DataCollectorParams.DatastreamBufferSize,
 			DatastreamBufferSpikeSize: vz.Spec.DataCollectorParams.DatastreamBufferSpikeSize,
-			CustomPEMFlags:            vz.Spec.DataCollectorParams.CustomPEMFlags,
+			CustomPEMFlags:            customPEMFlags,
 		}
 	}
 
@@ -1063,14 +1394,18 @@ func waitForCluster(clientset *kubernetes.Clientset, namespace string) error {
 // watchForFailedVizierUpdates regularly polls for timed-out viziers
 // and marks matching Viziers ReconciliationPhases as failed.
 func (r *VizierReconciler) watchForFailedVizierUpdates() {
-	t := time.NewTicker(updatingVizierCheckPeriod)
+	t := time.NewTimer(r.Settings.UpdateCheckInterval())
 	defer t.Stop()
 	for range t.C {
+		// The interval is read on every check, so that changes to the settings are picked up.
+		t.Reset(r.Settings.UpdateCheckInterval())
+		start := time.Now()
 		var viziersList v1alpha1.VizierList
 		ctx := context.Background()
 		err := r.List(ctx, &viziersList)
 		if err != nil {
 			log.WithError(err).Error("Unable to list the vizier objects")
+			recordLoopError(loopFailedUpdateCheck)
 			continue
 		}
 		for _, vz := range viziersList.Items {
@@ -1078,7 +1413,7 @@ func (r *VizierReconciler) watchForFailedVizierUpdates() {
 			if vz.Status.ReconciliationPhase != v1alpha1.ReconciliationPhaseUpdating {
 				continue
 			}
-			if time.Since(vz.Status.LastReconciliationPhaseTime.Time) < updatingFailedTimeout {
+			if time.Since(vz.Status.LastReconciliationPhaseTime.Time) < r.Settings.UpdateTimeout() {
 				continue
 			}
 			log.WithField("namespace", vz.Namespace).WithField("vizier", vz.Name).Info("Marking vizier as failed")
@@ -1086,14 +1421,32 @@ func (r *VizierReconciler) watchForFailedVizierUpdates() {
 			err := r.Status().Update(ctx, &vz)
 			if err != nil {
 				log.WithError(err).Error("Unable to update vizier status")
+				recordLoopError(loopFailedUpdateCheck)
 			}
+			r.recordEvent(&vz, v1.EventTypeWarning, eventReasonUpdateTimedOut, "Vizier did not become ready within %s", r.Settings.UpdateTimeout())
 		}
+		observeLoop(loopFailedUpdateCheck, start)
 	}
 }
 
 // SetupWithManager sets up the reconciler.
 func (r *VizierReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	go r.watchForFailedVizierUpdates()
+	// Like the controller, the periodic loops act on the Viziers, so they only run in the leader when leader
+	// election is enabled.
+	err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		go r.watchForFailedVizierUpdates()
+		go r.autoscalePEMs()
+		go r.backupMetadata()
+		go r.superviseCanaryUpgrades()
+		<-ctx.Done()
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+	if err := metrics.Registry.Register(&vizierPhaseCollector{reader: mgr.GetClient()}); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.Vizier{}).
 		Complete(r)
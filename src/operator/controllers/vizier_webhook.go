@@ -0,0 +1,512 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/gofrs/uuid"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/vizier/utils/protocoltracers"
+)
+
+const deployKeyPrefix = "px-dep-"
+
+// VizierValidator is an admission webhook that rejects invalid Vizier specs when they are applied, so that
+// mistakes are reported to the user right away instead of as a Vizier that never becomes healthy.
+type VizierValidator struct{}
+
+// SetupWithManager registers the webhook with the manager's webhook server.
+func (v *VizierValidator) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.Vizier{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate validates a new Vizier.
+func (v *VizierValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	vz, ok := obj.(*v1alpha1.Vizier)
+	if !ok {
+		return fmt.Errorf("expected a Vizier but got a %T", obj)
+	}
+	errs := validateVizierSpec(&vz.Spec, field.NewPath("spec"))
+	if vz.Spec.DeployKey == "" && vz.Spec.CustomDeployKeySecret == "" {
+		errs = append(errs, field.Required(field.NewPath("spec", "deployKey"),
+			"a deploy key is required to register Vizier with Pixie Cloud. Create one with `px deploy-key create` or set customDeployKeySecret to the name of a secret that contains it"))
+	}
+	return vizierInvalidError(vz, errs)
+}
+
+// ValidateUpdate validates an updated Vizier. Fields that were already invalid before the update are not
+// reported, so that Viziers that were created before this webhook existed can still be updated.
+func (v *VizierValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldVz, ok := oldObj.(*v1alpha1.Vizier)
+	if !ok {
+		return fmt.Errorf("expected a Vizier but got a %T", oldObj)
+	}
+	vz, ok := newObj.(*v1alpha1.Vizier)
+	if !ok {
+		return fmt.Errorf("expected a Vizier but got a %T", newObj)
+	}
+
+	existing := make(map[string]bool)
+	for _, err := range validateVizierSpec(&oldVz.Spec, field.NewPath("spec")) {
+		existing[err.Error()] = true
+	}
+	var errs field.ErrorList
+	for _, err := range validateVizierSpec(&vz.Spec, field.NewPath("spec")) {
+		if !existing[err.Error()] {
+			errs = append(errs, err)
+		}
+	}
+	return vizierInvalidError(vz, errs)
+}
+
+// ValidateDelete allows all deletes.
+func (v *VizierValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func vizierInvalidError(vz *v1alpha1.Vizier, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return k8serrors.NewInvalid(v1alpha1.SchemeGroupVersion.WithKind("Vizier").GroupKind(), vz.Name, errs)
+}
+
+func validateVizierSpec(spec *v1alpha1.VizierSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if spec.Version != "" {
+		if _, err := semver.Parse(spec.Version); err != nil {
+			msg := "must be a semantic version, for example \"0.14.2\""
+			if strings.HasPrefix(spec.Version, "v") {
+				msg = fmt.Sprintf("must be a semantic version without the \"v\" prefix, for example %q", strings.TrimPrefix(spec.Version, "v"))
+			}
+			errs = append(errs, field.Invalid(path.Child("version"), spec.Version, msg))
+		}
+	}
+
+	if spec.DeployKey != "" {
+		if spec.CustomDeployKeySecret != "" {
+			errs = append(errs, field.Forbidden(path.Child("deployKey"),
+				"the deploy key is read from customDeployKeySecret when it is set. Set only one of deployKey and customDeployKeySecret"))
+		}
+		if uuid.FromStringOrNil(strings.TrimPrefix(spec.DeployKey, deployKeyPrefix)) == uuid.Nil {
+			errs = append(errs, field.Invalid(path.Child("deployKey"), "<redacted>",
+				"must be a deploy key of the form px-dep-<uuid>, as created with `px deploy-key create`"))
+		}
+	}
+
+	if spec.DevCloudNamespace != "" {
+		for _, msg := range validation.IsDNS1123Label(spec.DevCloudNamespace) {
+			errs = append(errs, field.Invalid(path.Child("devCloudNamespace"), spec.DevCloudNamespace, msg))
+		}
+		if spec.CloudAddr != "" && spec.CloudAddr != devCloudAddr(spec.DevCloudNamespace) {
+			errs = append(errs, field.Invalid(path.Child("cloudAddr"), spec.CloudAddr,
+				fmt.Sprintf("conflicts with devCloudNamespace, which connects Vizier to %s. Remove devCloudNamespace to connect to %s, or remove cloudAddr to use the dev cloud",
+					devCloudAddr(spec.DevCloudNamespace), spec.CloudAddr)))
+		}
+	} else if spec.CloudAddr == "" {
+		errs = append(errs, field.Required(path.Child("cloudAddr"),
+			"the address of Pixie Cloud is required, for example \"withpixie.ai:443\""))
+	} else if _, port, err := net.SplitHostPort(spec.CloudAddr); err != nil || port == "" {
+		errs = append(errs, field.Invalid(path.Child("cloudAddr"), spec.CloudAddr,
+			"must be a host and port, for example \"withpixie.ai:443\""))
+	}
+
+	var limit, request *resource.Quantity
+	if spec.PemMemoryLimit != "" {
+		q, err := resource.ParseQuantity(spec.PemMemoryLimit)
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Child("pemMemoryLimit"), spec.PemMemoryLimit, "must be a quantity, for example \"2Gi\""))
+		} else {
+			limit = &q
+		}
+	}
+	if spec.PemMemoryRequest != "" {
+		q, err := resource.ParseQuantity(spec.PemMemoryRequest)
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Child("pemMemoryRequest"), spec.PemMemoryRequest, "must be a quantity, for example \"2Gi\""))
+		} else {
+			request = &q
+		}
+	}
+	if limit != nil && request != nil && request.Cmp(*limit) > 0 {
+		errs = append(errs, field.Invalid(path.Child("pemMemoryRequest"), spec.PemMemoryRequest,
+			fmt.Sprintf("must not be greater than pemMemoryLimit (%s)", spec.PemMemoryLimit)))
+	}
+
+	if bp := spec.Backpressure; bp != nil {
+		bpPath := path.Child("backpressure")
+		percentages := []struct {
+			name  string
+			value int32
+		}{
+			{"reduceSamplingThresholdPercent", bp.ReduceSamplingThresholdPercent},
+			{"samplingPercent", bp.SamplingPercent},
+			{"pauseTablesThresholdPercent", bp.PauseTablesThresholdPercent},
+		}
+		for _, p := range percentages {
+			if p.value < 0 || p.value > 100 {
+				errs = append(errs, field.Invalid(bpPath.Child(p.name), p.value, "must be a percentage between 0 and 100"))
+			}
+		}
+		if bp.ReduceSamplingThresholdPercent > 0 && bp.PauseTablesThresholdPercent > 0 &&
+			bp.PauseTablesThresholdPercent < bp.ReduceSamplingThresholdPercent {
+			errs = append(errs, field.Invalid(bpPath.Child("pauseTablesThresholdPercent"), bp.PauseTablesThresholdPercent,
+				fmt.Sprintf("must not be lower than reduceSamplingThresholdPercent (%d)", bp.ReduceSamplingThresholdPercent)))
+		}
+	}
+
+	if bf := spec.Backfill; bf != nil {
+		bfPath := path.Child("backfill")
+		if bf.MaxAge != nil && bf.MaxAge.Duration < 0 {
+			errs = append(errs, field.Invalid(bfPath.Child("maxAge"), bf.MaxAge.Duration.String(), "must not be negative"))
+		}
+		if bf.MaxConcurrentPEMs < 0 {
+			errs = append(errs, field.Invalid(bfPath.Child("maxConcurrentPEMs"), bf.MaxConcurrentPEMs, "must not be negative"))
+		}
+		if bf.Timeout != nil && bf.Timeout.Duration <= 0 {
+			errs = append(errs, field.Invalid(bfPath.Child("timeout"), bf.Timeout.Duration.String(), "must be positive"))
+		}
+	}
+
+	protocols := make([]string, 0, len(spec.ProtocolTracers))
+	for protocol := range spec.ProtocolTracers {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	for _, protocol := range protocols {
+		if !protocoltracers.IsKnown(protocol) {
+			errs = append(errs, field.NotSupported(path.Child("protocolTracers").Key(protocol), protocol, protocoltracers.Protocols))
+		}
+	}
+
+	if mb := spec.MetadataBackup; mb != nil {
+		mbPath := path.Child("metadataBackup")
+		dest := mb.Destination
+		destPath := mbPath.Child("destination")
+		switch {
+		case dest.PVC == "" && dest.ObjectStore == nil:
+			errs = append(errs, field.Required(destPath, "one of pvc and objectStore is required"))
+		case dest.PVC != "" && dest.ObjectStore != nil:
+			errs = append(errs, field.Forbidden(destPath.Child("objectStore"), "only one of pvc and objectStore may be set"))
+		case dest.ObjectStore != nil:
+			if u, err := url.Parse(dest.ObjectStore.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				errs = append(errs, field.Invalid(destPath.Child("objectStore", "url"), dest.ObjectStore.URL,
+					"must be the URL of the bucket, for example \"https://my-bucket.s3.us-west-2.amazonaws.com/pixie\""))
+			}
+			if dest.ObjectStore.CredentialsSecret == "" {
+				errs = append(errs, field.Required(destPath.Child("objectStore", "credentialsSecret"),
+					"the name of a secret with the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY of the bucket is required"))
+			}
+		}
+		if mb.Interval != nil && mb.Interval.Duration < metadataBackupCheckInterval {
+			errs = append(errs, field.Invalid(mbPath.Child("interval"), mb.Interval.Duration.String(),
+				fmt.Sprintf("must be at least %s", metadataBackupCheckInterval)))
+		}
+		if mb.Retention < 0 {
+			errs = append(errs, field.Invalid(mbPath.Child("retention"), mb.Retention, "must not be negative"))
+		}
+	}
+
+	if mr := spec.MetadataRestore; mr != nil {
+		mrPath := path.Child("metadataRestore", "backupName")
+		if spec.UseEtcdOperator {
+			errs = append(errs, field.Forbidden(path.Child("metadataRestore"),
+				"metadata stored in etcd can't be restored, only metadata stored on a persistent volume"))
+		}
+		if spec.MetadataBackup == nil {
+			errs = append(errs, field.Required(path.Child("metadataBackup"), "the destination of the backup to restore is required"))
+		}
+		if _, err := metadataBackupTime(mr.BackupName); err != nil || !strings.HasPrefix(mr.BackupName, metadataBackupNamePrefix) {
+			errs = append(errs, field.Invalid(mrPath, mr.BackupName,
+				"must be the name of a backup, as reported in status.metadataBackup.lastSuccessfulBackup"))
+		}
+	}
+
+	if us := spec.UpgradeStrategy; us != nil {
+		usPath := path.Child("upgradeStrategy")
+		switch us.Type {
+		case "", v1alpha1.UpgradeStrategyAllAtOnce, v1alpha1.UpgradeStrategyCanary:
+		default:
+			errs = append(errs, field.NotSupported(usPath.Child("type"), us.Type,
+				[]string{string(v1alpha1.UpgradeStrategyAllAtOnce), string(v1alpha1.UpgradeStrategyCanary)}))
+		}
+		if c := us.Canary; c != nil {
+			canaryPath := usPath.Child("canary")
+			if c.NodePercent < 0 || c.NodePercent > 100 {
+				errs = append(errs, field.Invalid(canaryPath.Child("nodePercent"), c.NodePercent, "must be a percentage between 0 and 100"))
+			}
+			if c.MaxQueryErrorPercent < 0 || c.MaxQueryErrorPercent > 100 {
+				errs = append(errs, field.Invalid(canaryPath.Child("maxQueryErrorPercent"), c.MaxQueryErrorPercent, "must be a percentage between 0 and 100"))
+			}
+			if c.SoakPeriod != nil && c.SoakPeriod.Duration < canaryCheckInterval {
+				errs = append(errs, field.Invalid(canaryPath.Child("soakPeriod"), c.SoakPeriod.Duration.String(),
+					fmt.Sprintf("must be at least %s", canaryCheckInterval)))
+			}
+		}
+	}
+
+	if rm := spec.RegistryMirror; rm != nil {
+		rmPath := path.Child("registryMirror")
+		if spec.Registry != "" {
+			errs = append(errs, field.Forbidden(path.Child("registry"),
+				"images are pulled from registryMirror when it is set. Set only one of registry and registryMirror"))
+		}
+		if rm.Host == "" {
+			errs = append(errs, field.Required(rmPath.Child("host"), "the host of the mirror is required, for example \"registry.internal:5000\""))
+		} else if u, err := url.Parse("//" + rm.Host); err != nil || u.Host != rm.Host {
+			errs = append(errs, field.Invalid(rmPath.Child("host"), rm.Host,
+				"must be a host and optional port without a scheme or path, for example \"registry.internal:5000\""))
+		}
+		for i, rw := range rm.PathRewrites {
+			if rw.Prefix == "" {
+				errs = append(errs, field.Required(rmPath.Child("pathRewrites").Index(i).Child("prefix"), "the prefix to replace is required"))
+			}
+		}
+		for i, s := range rm.PullSecrets {
+			for _, msg := range validation.IsDNS1123Subdomain(s) {
+				errs = append(errs, field.Invalid(rmPath.Child("pullSecrets").Index(i), s, msg))
+			}
+		}
+	}
+
+	if sc := spec.Scheduling; sc != nil {
+		scPath := path.Child("scheduling")
+		components := []struct {
+			name  string
+			sched *v1alpha1.Scheduling
+		}{
+			{"pem", sc.PEM},
+			{"kelvin", sc.Kelvin},
+			{"metadata", sc.Metadata},
+			{"nats", sc.NATS},
+		}
+		for _, c := range components {
+			if c.sched == nil {
+				continue
+			}
+			cPath := scPath.Child(c.name)
+			errs = append(errs, metav1validation.ValidateLabels(c.sched.NodeSelector, cPath.Child("nodeSelector"))...)
+			for i, t := range c.sched.Tolerations {
+				if t.Operator == v1.TolerationOpExists && t.Value != "" {
+					errs = append(errs, field.Invalid(cPath.Child("tolerations").Index(i).Child("value"), t.Value,
+						"must be empty when operator is \"Exists\""))
+				}
+			}
+		}
+	}
+
+	if spec.NATS != nil {
+		if r := spec.NATS.Replicas; r < 0 || (r > 1 && r%2 == 0) {
+			errs = append(errs, field.Invalid(path.Child("nats", "replicas"), r,
+				"must be 1 or an odd number, so that the NATS cluster keeps its quorum when a server is down"))
+		}
+		if ext := spec.NATS.External; ext != nil {
+			errs = append(errs, validateExternalNATS(ext, path.Child("nats", "external"))...)
+		}
+		if spec.NATS.ComponentCredentials && spec.NATS.External != nil {
+			errs = append(errs, field.Forbidden(path.Child("nats", "componentCredentials"),
+				"the credentials of an external NATS cluster are set with external.credentialsSecret"))
+		}
+	}
+
+	switch spec.SecurityContextProfile {
+	case "", v1alpha1.SecurityContextProfileDefault, v1alpha1.SecurityContextProfileRestricted, v1alpha1.SecurityContextProfileOpenShift:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("securityContextProfile"), spec.SecurityContextProfile,
+			[]string{
+				string(v1alpha1.SecurityContextProfileDefault),
+				string(v1alpha1.SecurityContextProfileRestricted),
+				string(v1alpha1.SecurityContextProfileOpenShift),
+			}))
+	}
+
+	if cr := spec.CertRotation; cr != nil {
+		crPath := path.Child("certRotation")
+		if rb := cr.RenewBefore; rb != nil && (rb.Duration < certCheckInterval || rb.Duration > maxCertRenewBefore) {
+			errs = append(errs, field.Invalid(crPath.Child("renewBefore"), rb.Duration.String(),
+				fmt.Sprintf("must be between %s and %s, since the certs are valid for five years", certCheckInterval, maxCertRenewBefore)))
+		}
+		switch cr.RestartStrategy {
+		case "", v1alpha1.CertRestartRolling, v1alpha1.CertRestartRecreate:
+		default:
+			errs = append(errs, field.NotSupported(crPath.Child("restartStrategy"), cr.RestartStrategy,
+				[]string{string(v1alpha1.CertRestartRolling), string(v1alpha1.CertRestartRecreate)}))
+		}
+	}
+
+	if cr := spec.CrashRemediation; cr != nil && cr.MaxPEMMemory != "" {
+		if _, err := resource.ParseQuantity(cr.MaxPEMMemory); err != nil {
+			errs = append(errs, field.Invalid(path.Child("crashRemediation", "maxPEMMemory"), cr.MaxPEMMemory, "must be a quantity, for example \"4Gi\""))
+		}
+	}
+
+	if cd := spec.CrashDiagnostics; cd != nil {
+		cdPath := path.Child("crashDiagnostics")
+		if cd.PVC == "" && !cd.UploadToCloud {
+			errs = append(errs, field.Required(cdPath, "one of pvc and uploadToCloud is required"))
+		}
+		if cd.Retention < 0 {
+			errs = append(errs, field.Invalid(cdPath.Child("retention"), cd.Retention, "must not be negative"))
+		}
+		if cd.LogLines < 0 {
+			errs = append(errs, field.Invalid(cdPath.Child("logLines"), cd.LogLines, "must not be negative"))
+		}
+	}
+
+	if dc := spec.DataCollectorParams; dc != nil && dc.TableStore != nil {
+		errs = append(errs, validateTableStore(dc.TableStore, path.Child("dataCollectorParams", "tableStore"))...)
+	}
+
+	if ex := spec.Exposure; ex != nil {
+		exPath := path.Child("exposure")
+		switch ex.Type {
+		case v1alpha1.ExposureTypeIngress:
+		case v1alpha1.ExposureTypeGateway:
+			if ex.Gateway == nil || ex.Gateway.Name == "" {
+				errs = append(errs, field.Required(exPath.Child("gateway", "name"), "the Gateway to attach the route to is required"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(exPath.Child("type"), ex.Type,
+				[]string{string(v1alpha1.ExposureTypeIngress), string(v1alpha1.ExposureTypeGateway)}))
+		}
+		if ex.Hostname == "" {
+			errs = append(errs, field.Required(exPath.Child("hostname"), "the hostname to serve the query endpoint on is required"))
+		} else {
+			for _, msg := range validation.IsDNS1123Subdomain(ex.Hostname) {
+				errs = append(errs, field.Invalid(exPath.Child("hostname"), ex.Hostname, msg))
+			}
+		}
+		if ex.TLSSecretName != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(ex.TLSSecretName) {
+				errs = append(errs, field.Invalid(exPath.Child("tlsSecretName"), ex.TLSSecretName, msg))
+			}
+		}
+		if ex.ExternalDNS != nil && ex.ExternalDNS.TTL < 0 {
+			errs = append(errs, field.Invalid(exPath.Child("externalDNS", "ttl"), ex.ExternalDNS.TTL, "must not be negative"))
+		}
+	}
+
+	return errs
+}
+
+func validateTableStore(ts *v1alpha1.TableStoreParams, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	validateSize := func(p *field.Path, size string) *resource.Quantity {
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			errs = append(errs, field.Invalid(p, size, "must be a quantity, for example \"512Mi\""))
+			return nil
+		}
+		if q.Sign() <= 0 {
+			errs = append(errs, field.Invalid(p, size, "must be greater than 0"))
+			return nil
+		}
+		return &q
+	}
+	validateRetention := func(p *field.Path, retention *metav1.Duration) {
+		if retention != nil && retention.Duration < time.Second {
+			errs = append(errs, field.Invalid(p, retention.Duration.String(), "must be at least 1s"))
+		}
+	}
+
+	var total *resource.Quantity
+	if ts.TotalSize != "" {
+		total = validateSize(path.Child("totalSize"), ts.TotalSize)
+	}
+	validateRetention(path.Child("retention"), ts.Retention)
+
+	names := make([]string, 0, len(ts.Tables))
+	for name := range ts.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tablesSize := resource.Quantity{}
+	for _, name := range names {
+		table := ts.Tables[name]
+		tPath := path.Child("tables").Key(name)
+		if name == "" || strings.ContainsAny(name, "=,") {
+			errs = append(errs, field.Invalid(tPath, name, "must be the name of a table, such as \"http_events\""))
+		}
+		if table.MaxSize != "" {
+			if q := validateSize(tPath.Child("maxSize"), table.MaxSize); q != nil {
+				tablesSize.Add(*q)
+			}
+		}
+		validateRetention(tPath.Child("retention"), table.Retention)
+	}
+	if total != nil && tablesSize.Cmp(*total) > 0 {
+		errs = append(errs, field.Invalid(path.Child("tables"), tablesSize.String(),
+			fmt.Sprintf("the maxSize of the tables must not add up to more than totalSize (%s)", ts.TotalSize)))
+	}
+	return errs
+}
+
+func validateExternalNATS(ext *v1alpha1.ExternalNATS, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if ext.URL == "" {
+		errs = append(errs, field.Required(path.Child("url"), "the URL of the NATS cluster is required, for example \"tls://nats.messaging.svc:4222\""))
+	} else {
+		for _, server := range strings.Split(ext.URL, ",") {
+			u, err := url.Parse(strings.TrimSpace(server))
+			if err != nil || u.Host == "" || (u.Scheme != "nats" && u.Scheme != "tls") {
+				errs = append(errs, field.Invalid(path.Child("url"), ext.URL,
+					"must be a comma separated list of nats:// or tls:// URLs"))
+				break
+			}
+		}
+	}
+	if ext.CredentialsSecret != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(ext.CredentialsSecret) {
+			errs = append(errs, field.Invalid(path.Child("credentialsSecret"), ext.CredentialsSecret, msg))
+		}
+	}
+	if ext.TLS == nil || ext.TLS.SecretName == "" {
+		errs = append(errs, field.Required(path.Child("tls", "secretName"),
+			"the secret with the CA cert of the NATS servers is required, since Vizier only talks to NATS over TLS"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(ext.TLS.SecretName) {
+			errs = append(errs, field.Invalid(path.Child("tls", "secretName"), ext.TLS.SecretName, msg))
+		}
+	}
+	return errs
+}
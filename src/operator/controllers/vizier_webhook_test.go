@@ -0,0 +1,508 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+)
+
+const testDeployKey = "px-dep-2a4d1d5c-8b3f-4a41-9b21-3d3c1f0c6e7a"
+
+func validVizierSpec() v1alpha1.VizierSpec {
+	return v1alpha1.VizierSpec{
+		Version:   "0.14.2",
+		DeployKey: testDeployKey,
+		CloudAddr: "withpixie.ai:443",
+	}
+}
+
+func TestVizierValidator_ValidateCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(spec *v1alpha1.VizierSpec)
+		// The fields that are expected to be invalid.
+		invalidFields []string
+	}{
+		{
+			name:   "valid",
+			modify: func(spec *v1alpha1.VizierSpec) {},
+		},
+		{
+			name: "valid prerelease without version",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Version = ""
+				spec.DeployKey = "2a4d1d5c-8b3f-4a41-9b21-3d3c1f0c6e7a"
+			},
+		},
+		{
+			name: "valid dev cloud",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Version = "0.14.3-pre-main.0"
+				spec.DevCloudNamespace = "plc-dev"
+				spec.CloudAddr = "api-service.plc-dev.svc.cluster.local:51200"
+			},
+		},
+		{
+			name:          "version with v prefix",
+			modify:        func(spec *v1alpha1.VizierSpec) { spec.Version = "v0.14.2" },
+			invalidFields: []string{"spec.version"},
+		},
+		{
+			name:          "bad deploy key",
+			modify:        func(spec *v1alpha1.VizierSpec) { spec.DeployKey = "px-dep-abc" },
+			invalidFields: []string{"spec.deployKey"},
+		},
+		{
+			name:          "missing deploy key",
+			modify:        func(spec *v1alpha1.VizierSpec) { spec.DeployKey = "" },
+			invalidFields: []string{"spec.deployKey"},
+		},
+		{
+			name:          "deploy key and custom secret",
+			modify:        func(spec *v1alpha1.VizierSpec) { spec.CustomDeployKeySecret = "my-secret" },
+			invalidFields: []string{"spec.deployKey"},
+		},
+		{
+			name: "conflicting dev cloud and cloud addr",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.DevCloudNamespace = "plc-dev"
+			},
+			invalidFields: []string{"spec.cloudAddr"},
+		},
+		{
+			name: "invalid dev cloud namespace",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.DevCloudNamespace = "Plc_Dev"
+				spec.CloudAddr = ""
+			},
+			invalidFields: []string{"spec.devCloudNamespace"},
+		},
+		{
+			name:          "missing cloud addr",
+			modify:        func(spec *v1alpha1.VizierSpec) { spec.CloudAddr = "" },
+			invalidFields: []string{"spec.cloudAddr"},
+		},
+		{
+			name:          "cloud addr without port",
+			modify:        func(spec *v1alpha1.VizierSpec) { spec.CloudAddr = "withpixie.ai" },
+			invalidFields: []string{"spec.cloudAddr"},
+		},
+		{
+			name: "pem memory request above limit",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.PemMemoryLimit = "1Gi"
+				spec.PemMemoryRequest = "2Gi"
+			},
+			invalidFields: []string{"spec.pemMemoryRequest"},
+		},
+		{
+			name:          "bad pem memory limit",
+			modify:        func(spec *v1alpha1.VizierSpec) { spec.PemMemoryLimit = "lots" },
+			invalidFields: []string{"spec.pemMemoryLimit"},
+		},
+		{
+			name: "backpressure thresholds out of order",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Backpressure = &v1alpha1.BackpressurePolicy{
+					Enabled:                        true,
+					ReduceSamplingThresholdPercent: 90,
+					PauseTablesThresholdPercent:    70,
+					SamplingPercent:                150,
+				}
+			},
+			invalidFields: []string{"spec.backpressure.pauseTablesThresholdPercent", "spec.backpressure.samplingPercent"},
+		},
+		{
+			name: "valid backfill",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Backfill = &v1alpha1.BackfillPolicy{
+					Enabled:           true,
+					MaxAge:            &metav1.Duration{Duration: 5 * time.Minute},
+					MaxConcurrentPEMs: 3,
+				}
+			},
+		},
+		{
+			name: "invalid backfill",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Backfill = &v1alpha1.BackfillPolicy{
+					Enabled:           true,
+					MaxAge:            &metav1.Duration{Duration: -time.Minute},
+					MaxConcurrentPEMs: -1,
+					Timeout:           &metav1.Duration{},
+				}
+			},
+			invalidFields: []string{"spec.backfill.maxAge", "spec.backfill.maxConcurrentPEMs", "spec.backfill.timeout"},
+		},
+		{
+			name: "valid protocol tracers",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.ProtocolTracers = map[string]bool{"dns": false, "kafka": true}
+			},
+		},
+		{
+			name: "unknown protocol tracer",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.ProtocolTracers = map[string]bool{"dns": false, "smtp": true}
+			},
+			invalidFields: []string{"spec.protocolTracers[smtp]"},
+		},
+		{
+			name: "valid metadata restore",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.MetadataBackup = &v1alpha1.MetadataBackup{
+					Enabled:     true,
+					Destination: v1alpha1.MetadataBackupDestination{PVC: "pixie-backups"},
+				}
+				spec.MetadataRestore = &v1alpha1.MetadataRestore{BackupName: "metadata-20231015-093000"}
+			},
+		},
+		{
+			name: "metadata backup without destination",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.MetadataBackup = &v1alpha1.MetadataBackup{
+					Enabled:  true,
+					Interval: &metav1.Duration{Duration: time.Second},
+				}
+			},
+			invalidFields: []string{"spec.metadataBackup.destination", "spec.metadataBackup.interval"},
+		},
+		{
+			name: "metadata restore from etcd",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.UseEtcdOperator = true
+				spec.MetadataBackup = &v1alpha1.MetadataBackup{
+					Enabled: true,
+					Destination: v1alpha1.MetadataBackupDestination{
+						ObjectStore: &v1alpha1.ObjectStoreDestination{URL: "s3://my-bucket"},
+					},
+				}
+				spec.MetadataRestore = &v1alpha1.MetadataRestore{BackupName: "latest"}
+			},
+			invalidFields: []string{
+				"spec.metadataBackup.destination.objectStore.url",
+				"spec.metadataBackup.destination.objectStore.credentialsSecret",
+				"spec.metadataRestore",
+				"spec.metadataRestore.backupName",
+			},
+		},
+		{
+			name: "valid canary upgrade",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.UpgradeStrategy = &v1alpha1.UpgradeStrategy{
+					Type:   v1alpha1.UpgradeStrategyCanary,
+					Canary: &v1alpha1.CanaryUpgrade{NodePercent: 25, SoakPeriod: &metav1.Duration{Duration: time.Hour}},
+				}
+			},
+		},
+		{
+			name: "invalid canary upgrade",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.UpgradeStrategy = &v1alpha1.UpgradeStrategy{
+					Type: "BlueGreen",
+					Canary: &v1alpha1.CanaryUpgrade{
+						NodePercent:          200,
+						SoakPeriod:           &metav1.Duration{Duration: time.Second},
+						MaxQueryErrorPercent: -1,
+					},
+				}
+			},
+			invalidFields: []string{
+				"spec.upgradeStrategy.type",
+				"spec.upgradeStrategy.canary.nodePercent",
+				"spec.upgradeStrategy.canary.soakPeriod",
+				"spec.upgradeStrategy.canary.maxQueryErrorPercent",
+			},
+		},
+		{
+			name: "valid registry mirror",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.RegistryMirror = &v1alpha1.RegistryMirror{
+					Host:         "registry.internal:5000",
+					PathRewrites: []v1alpha1.RegistryPathRewrite{{Prefix: "pixie-oss/pixie-prod", Replacement: "pixie"}},
+					PullSecrets:  []string{"internal-registry-creds"},
+				}
+			},
+		},
+		{
+			name: "invalid registry mirror",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Registry = "registry.internal:5000"
+				spec.RegistryMirror = &v1alpha1.RegistryMirror{
+					Host:         "https://registry.internal:5000",
+					PathRewrites: []v1alpha1.RegistryPathRewrite{{Replacement: "pixie"}},
+					PullSecrets:  []string{"Internal_Creds"},
+				}
+			},
+			invalidFields: []string{
+				"spec.registry",
+				"spec.registryMirror.host",
+				"spec.registryMirror.pathRewrites[0].prefix",
+				"spec.registryMirror.pullSecrets[0]",
+			},
+		},
+		{
+			name: "valid scheduling",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Scheduling = &v1alpha1.ComponentScheduling{
+					PEM: &v1alpha1.Scheduling{
+						Tolerations: []v1.Toleration{{Operator: v1.TolerationOpExists}},
+					},
+					Kelvin: &v1alpha1.Scheduling{
+						NodeSelector: map[string]string{"pool": "observability"},
+					},
+				}
+			},
+		},
+		{
+			name: "invalid scheduling",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Scheduling = &v1alpha1.ComponentScheduling{
+					Metadata: &v1alpha1.Scheduling{
+						NodeSelector: map[string]string{"pool": "not a label value"},
+					},
+					NATS: &v1alpha1.Scheduling{
+						Tolerations: []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists, Value: "pixie"}},
+					},
+				}
+			},
+			invalidFields: []string{
+				"spec.scheduling.metadata.nodeSelector",
+				"spec.scheduling.nats.tolerations[0].value",
+			},
+		},
+		{
+			name: "valid exposure",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Exposure = &v1alpha1.EndpointExposure{
+					Type:        v1alpha1.ExposureTypeGateway,
+					Hostname:    "pixie.example.com",
+					Gateway:     &v1alpha1.GatewayReference{Name: "public", Namespace: "gateways"},
+					ExternalDNS: &v1alpha1.ExternalDNS{Enabled: true, TTL: 60},
+				}
+			},
+		},
+		{
+			name: "invalid exposure",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Exposure = &v1alpha1.EndpointExposure{
+					Type:          v1alpha1.ExposureTypeGateway,
+					Hostname:      "https://pixie.example.com",
+					TLSSecretName: "Pixie_TLS",
+					ExternalDNS:   &v1alpha1.ExternalDNS{Enabled: true, TTL: -1},
+				}
+			},
+			invalidFields: []string{
+				"spec.exposure.gateway.name",
+				"spec.exposure.hostname",
+				"spec.exposure.tlsSecretName",
+				"spec.exposure.externalDNS.ttl",
+			},
+		},
+		{
+			name: "valid nats replicas",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.NATS = &v1alpha1.NATSParams{Replicas: 3}
+			},
+		},
+		{
+			name: "even nats replicas",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.NATS = &v1alpha1.NATSParams{Replicas: 2}
+			},
+			invalidFields: []string{"spec.nats.replicas"},
+		},
+		{
+			name: "unknown security context profile",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.SecurityContextProfile = "Baseline"
+			},
+			invalidFields: []string{"spec.securityContextProfile"},
+		},
+		{
+			name: "valid cert rotation",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.CertRotation = &v1alpha1.CertRotation{
+					RenewBefore:     &metav1.Duration{Duration: 14 * 24 * time.Hour},
+					RestartStrategy: v1alpha1.CertRestartRecreate,
+				}
+			},
+		},
+		{
+			name: "invalid cert rotation",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.CertRotation = &v1alpha1.CertRotation{
+					RenewBefore:     &metav1.Duration{Duration: 5 * 365 * 24 * time.Hour},
+					RestartStrategy: "HotReload",
+				}
+			},
+			invalidFields: []string{"spec.certRotation.renewBefore", "spec.certRotation.restartStrategy"},
+		},
+		{
+			name: "invalid crash remediation",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.CrashRemediation = &v1alpha1.CrashRemediation{IncreasePEMMemory: true, MaxPEMMemory: "lots"}
+			},
+			invalidFields: []string{"spec.crashRemediation.maxPEMMemory"},
+		},
+		{
+			name: "crash diagnostics without a destination",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.CrashDiagnostics = &v1alpha1.CrashDiagnostics{Retention: -1}
+			},
+			invalidFields: []string{"spec.crashDiagnostics", "spec.crashDiagnostics.retention"},
+		},
+		{
+			name: "valid table store",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.DataCollectorParams = &v1alpha1.DataCollectorParams{TableStore: &v1alpha1.TableStoreParams{
+					TotalSize: "1Gi",
+					Retention: &metav1.Duration{Duration: 24 * time.Hour},
+					Tables: map[string]v1alpha1.TableParams{
+						"http_events": {MaxSize: "512Mi", Retention: &metav1.Duration{Duration: time.Hour}},
+						"conn_stats":  {MaxSize: "128Mi"},
+					},
+				}}
+			},
+		},
+		{
+			name: "invalid table store",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.DataCollectorParams = &v1alpha1.DataCollectorParams{TableStore: &v1alpha1.TableStoreParams{
+					TotalSize: "0",
+					Retention: &metav1.Duration{Duration: time.Millisecond},
+					Tables: map[string]v1alpha1.TableParams{
+						"http_events=1": {MaxSize: "lots"},
+					},
+				}}
+			},
+			invalidFields: []string{
+				"spec.dataCollectorParams.tableStore.totalSize",
+				"spec.dataCollectorParams.tableStore.retention",
+				"spec.dataCollectorParams.tableStore.tables[http_events=1]",
+				"spec.dataCollectorParams.tableStore.tables[http_events=1].maxSize",
+			},
+		},
+		{
+			name: "table sizes larger than table store",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.DataCollectorParams = &v1alpha1.DataCollectorParams{TableStore: &v1alpha1.TableStoreParams{
+					TotalSize: "1Gi",
+					Tables: map[string]v1alpha1.TableParams{
+						"http_events": {MaxSize: "768Mi"},
+						"conn_stats":  {MaxSize: "512Mi"},
+					},
+				}}
+			},
+			invalidFields: []string{"spec.dataCollectorParams.tableStore.tables"},
+		},
+		{
+			name: "valid external nats",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.NATS = &v1alpha1.NATSParams{External: &v1alpha1.ExternalNATS{
+					URL:               "tls://nats-0.messaging.svc:4222,tls://nats-1.messaging.svc:4222",
+					CredentialsSecret: "nats-creds",
+					TLS:               &v1alpha1.ExternalNATSTLS{SecretName: "nats-tls"},
+				}}
+			},
+		},
+		{
+			name: "invalid external nats",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.NATS = &v1alpha1.NATSParams{External: &v1alpha1.ExternalNATS{
+					URL:               "http://nats.messaging.svc:4222",
+					CredentialsSecret: "NATS_CREDS",
+				}}
+			},
+			invalidFields: []string{
+				"spec.nats.external.url",
+				"spec.nats.external.credentialsSecret",
+				"spec.nats.external.tls.secretName",
+			},
+		},
+		{
+			name: "component credentials with external nats",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.NATS = &v1alpha1.NATSParams{
+					ComponentCredentials: true,
+					External: &v1alpha1.ExternalNATS{
+						URL: "tls://nats.messaging.svc:4222",
+						TLS: &v1alpha1.ExternalNATSTLS{SecretName: "nats-tls"},
+					},
+				}
+			},
+			invalidFields: []string{"spec.nats.componentCredentials"},
+		},
+		{
+			name: "unknown exposure type",
+			modify: func(spec *v1alpha1.VizierSpec) {
+				spec.Exposure = &v1alpha1.EndpointExposure{Type: "LoadBalancer", Hostname: "pixie.example.com"}
+			},
+			invalidFields: []string{"spec.exposure.type"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vz := &v1alpha1.Vizier{ObjectMeta: metav1.ObjectMeta{Name: "pixie"}, Spec: validVizierSpec()}
+			test.modify(&vz.Spec)
+
+			err := (&VizierValidator{}).ValidateCreate(context.Background(), vz)
+			if len(test.invalidFields) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.True(t, k8serrors.IsInvalid(err), "expected an invalid error, got %v", err)
+			var fields []string
+			for _, cause := range err.(*k8serrors.StatusError).ErrStatus.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			assert.ElementsMatch(t, test.invalidFields, fields)
+		})
+	}
+}
+
+func TestVizierValidator_ValidateUpdate(t *testing.T) {
+	oldVz := &v1alpha1.Vizier{Spec: validVizierSpec()}
+	// A Vizier created before the webhook existed, with an invalid cloud address.
+	oldVz.Spec.CloudAddr = "withpixie.ai"
+	oldVz.Spec.DeployKey = ""
+
+	// Updating another field is allowed.
+	vz := oldVz.DeepCopy()
+	vz.Spec.Version = "0.14.3"
+	assert.NoError(t, (&VizierValidator{}).ValidateUpdate(context.Background(), oldVz, vz))
+
+	// New mistakes are rejected.
+	vz.Spec.Version = "latest"
+	err := (&VizierValidator{}).ValidateUpdate(context.Background(), oldVz, vz)
+	require.True(t, k8serrors.IsInvalid(err))
+	assert.Contains(t, err.Error(), "spec.version")
+	assert.NotContains(t, err.Error(), "spec.cloudAddr")
+}
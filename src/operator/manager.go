@@ -21,12 +21,16 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
@@ -41,6 +45,8 @@ var (
 
 const (
 	leaderElectionID = "27ad4010.px.dev"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 )
 
 func init() {
@@ -50,21 +56,50 @@ func init() {
 	// +kubebuilder:scaffold:scheme
 }
 
+// operatorNamespace returns the namespace the operator is running in, or an empty string if it can't be
+// determined.
+func operatorNamespace() string {
+	ns, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(ns))
+}
+
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var webhookCertDir string
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory with the certificate of the webhook server. OLM mounts the certificate in this directory.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"The duration that standby operators wait before taking over leadership from a leader that stopped renewing its lease.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"The duration that the leader retries renewing its lease before giving up leadership.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"The duration between attempts to acquire or renew the lease.")
 	flag.Parse()
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               9443,
+		CertDir:            webhookCertDir,
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   leaderElectionID,
+		// Only the leader reconciles Viziers. Standbys keep their caches warm, so that they can take over within
+		// the lease duration.
+		LeaderElectionResourceLock:    resourcelock.LeasesResourceLock,
+		LeaderElectionNamespace:       operatorNamespace(),
+		LeaderElectionReleaseOnCancel: true,
+		LeaseDuration:                 &leaseDuration,
+		RenewDeadline:                 &renewDeadline,
+		RetryPeriod:                   &retryPeriod,
 	})
 	if err != nil {
 		log.WithError(err).Error("Unable to start manager")
@@ -92,12 +127,30 @@ func main() {
 		}
 	}
 
+	// The operator's own settings are read from the OperatorConfig, so that they can be changed without
+	// redeploying the operator.
+	settings := controllers.NewOperatorSettings()
+	ocr := &controllers.OperatorConfigReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Settings:  settings,
+		Namespace: operatorNamespace(),
+	}
+	err = ocr.SetupWithManager(mgr)
+	if err != nil {
+		log.WithError(err).Error("Unable to create OperatorConfig controller")
+		os.Exit(1)
+	}
+
 	vr := &controllers.VizierReconciler{
 		Client:     mgr.GetClient(),
 		Scheme:     mgr.GetScheme(),
 		Clientset:  clientset,
 		RestConfig: kubeConfig,
 		K8sVersion: k8sVersion,
+		Settings:   settings,
+		Recorder:   mgr.GetEventRecorderFor("vizier-operator"),
+		Events:     controllers.NewLifecycleEventPublisher(settings),
 	}
 	err = vr.SetupWithManager(mgr)
 	if err != nil {
@@ -105,6 +158,18 @@ func main() {
 		os.Exit(1)
 	}
 	defer vr.Stop()
+
+	// The webhook can only be served when a certificate was provisioned for it, which OLM does for the webhooks
+	// in the operator's CSV.
+	if _, err := os.Stat(filepath.Join(webhookCertDir, "tls.crt")); err == nil {
+		err = (&controllers.VizierValidator{}).SetupWithManager(mgr)
+		if err != nil {
+			log.WithError(err).Error("Unable to create Vizier webhook")
+			os.Exit(1)
+		}
+	} else {
+		log.Info("No webhook certificate found, Vizier specs will not be validated when they are applied")
+	}
 	// +kubebuilder:scaffold:builder
 
 	log.Info("Starting manager")
@@ -40,6 +40,7 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
 	"px.dev/pixie/src/pixie_cli/pkg/pxanalytics"
 	"px.dev/pixie/src/pixie_cli/pkg/pxconfig"
 	"px.dev/pixie/src/pixie_cli/pkg/utils"
@@ -108,7 +109,7 @@ func LoadDefaultCredentials() (*RefreshToken, error) {
 // existing credentials and whether those are actually valid.
 func IsAuthenticated(cloudAddr string) bool {
 	creds := MustLoadDefaultCredentials()
-	client := http.Client{}
+	client := proxy.HTTPClient()
 	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/api/authorized", cloudAddr), nil)
 	if err != nil {
 		return false
@@ -317,6 +318,7 @@ func (p *PixieCloudLogin) tryBrowserAuth() (*RefreshToken, error) {
 	}()
 
 	go func() {
+		printBrowserProxyHint(authURL)
 		utils.Info("Starting browser... (if browser-based login fails, try running `px auth login --manual` for headless login)")
 		err := open.Run(authURL.String())
 		if err != nil {
@@ -357,8 +359,18 @@ func (p *PixieCloudLogin) tryBrowserAuth() (*RefreshToken, error) {
 	}
 }
 
+// printBrowserProxyHint tells the user that their browser may need to use the CLI's proxy. Only the browser
+// needs to reach the auth page, the token is exchanged by the CLI through the proxy.
+func printBrowserProxyHint(authURL *url.URL) {
+	if proxyURL := proxy.URL(); proxyURL != "" {
+		utils.Infof("Pixie Cloud is reached through the proxy %s. If your browser cannot reach %s directly, configure it to use the same proxy.",
+			proxyURL, authURL.Host)
+	}
+}
+
 func (p *PixieCloudLogin) getAuthStringManually() (string, error) {
 	authURL := p.getAuthURL()
+	printBrowserProxyHint(authURL)
 	// fmt.Printf appears to escape % (as desired) so we use it here instead of the cli logger.
 	fmt.Printf("\nPlease Visit: \n \t %s\n\n", authURL.String())
 	f := bufio.NewWriter(os.Stdout)
@@ -24,14 +24,17 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"golang.org/x/term"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/pixie_cli/pkg/auth"
 	"px.dev/pixie/src/pixie_cli/pkg/components"
 	"px.dev/pixie/src/pixie_cli/pkg/utils"
@@ -44,12 +47,19 @@ func init() {
 	APIKeyCmd.AddCommand(ListAPIKeyCmd)
 	APIKeyCmd.AddCommand(GetAPIKeyCmd)
 	APIKeyCmd.AddCommand(LookupAPIKeyCmd)
+	APIKeyCmd.AddCommand(RotateAPIKeyCmd)
 
 	CreateAPIKeyCmd.Flags().StringP("desc", "d", "", "A description for the API key")
 	CreateAPIKeyCmd.Flags().BoolP("short", "s", false, "Return only the created API key, for use to pipe to other tools")
+	CreateAPIKeyCmd.Flags().StringSlice("scopes", nil, "Restrict the key to scopes: script:read, script:write and/or deploy. Unrestricted if empty")
+	CreateAPIKeyCmd.Flags().StringSlice("clusters", nil, "Restrict the clusters that the key may run scripts on")
+	CreateAPIKeyCmd.Flags().Duration("expires_in", 0, "How long until the key expires. The key never expires if 0")
 
 	DeleteAPIKeyCmd.Flags().StringP("id", "i", "", "The API key to delete")
 
+	RotateAPIKeyCmd.Flags().StringP("id", "i", "", "The API key to rotate")
+	RotateAPIKeyCmd.Flags().BoolP("short", "s", false, "Return only the new API key, for use to pipe to other tools")
+
 	ListAPIKeyCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
 
 	LookupAPIKeyCmd.Flags().StringP("key", "k", "", "Value of the key. Leave blank to be prompted.")
@@ -77,8 +87,23 @@ var CreateAPIKeyCmd = &cobra.Command{
 		cloudAddr := viper.GetString("cloud_addr")
 		desc, _ := cmd.Flags().GetString("desc")
 		short, _ := cmd.Flags().GetBool("short")
+		scopes, _ := cmd.Flags().GetStringSlice("scopes")
+		clusters, _ := cmd.Flags().GetStringSlice("clusters")
+		expiresIn, _ := cmd.Flags().GetDuration("expires_in")
+
+		req := &cloudpb.CreateAPIKeyRequest{Desc: desc, Scopes: scopes}
+		for _, c := range clusters {
+			clusterID, err := uuid.FromString(c)
+			if err != nil {
+				utils.WithError(err).Fatal("Invalid cluster ID")
+			}
+			req.ClusterIDs = append(req.ClusterIDs, utils2.ProtoFromUUID(clusterID))
+		}
+		if expiresIn > 0 {
+			req.ExpiresAt, _ = types.TimestampProto(time.Now().Add(expiresIn))
+		}
 
-		keyID, key, err := generateAPIKey(cloudAddr, desc)
+		keyID, key, err := generateAPIKey(cloudAddr, req)
 		if err != nil {
 			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
 			log.WithError(err).Fatal("Failed to generate API key")
@@ -119,6 +144,40 @@ var DeleteAPIKeyCmd = &cobra.Command{
 	},
 }
 
+// RotateAPIKeyCmd is the Rotate sub-command of APIKey.
+var RotateAPIKeyCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the value of a API key for Pixie, keeping its scopes and expiry",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("id", cmd.Flags().Lookup("id"))
+		viper.BindPFlag("short", cmd.Flags().Lookup("short"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		id, _ := cmd.Flags().GetString("id")
+		short, _ := cmd.Flags().GetBool("short")
+		if id == "" {
+			utils.Fatal("API key ID must be specified using --id flag")
+		}
+
+		idUUID, err := uuid.FromString(id)
+		if err != nil {
+			utils.WithError(err).Fatal("Invalid API key ID")
+		}
+
+		key, err := rotateAPIKey(cloudAddr, idUUID)
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatal("Failed to rotate API key")
+		}
+		if short {
+			fmt.Fprintf(os.Stdout, "%s\n", key)
+		} else {
+			utils.Infof("Rotated API key: \nID: %s \nKey: %s", id, key)
+		}
+	},
+}
+
 // ListAPIKeyCmd is the List sub-command of APIKey.
 var ListAPIKeyCmd = &cobra.Command{
 	Use:   "list",
@@ -139,10 +198,10 @@ var ListAPIKeyCmd = &cobra.Command{
 		// Throw keys into table.
 		w := components.CreateStreamWriter(format, os.Stdout)
 		defer w.Finish()
-		w.SetHeader("api-keys", []string{"ID", "Key", "CreatedAt", "Description"})
+		w.SetHeader("api-keys", []string{"ID", "Key", "CreatedAt", "Description", "Scopes", "Clusters", "ExpiresAt"})
 		for _, k := range keys {
 			_ = w.Write([]interface{}{utils2.UUIDFromProtoOrNil(k.ID), "<hidden>", k.CreatedAt,
-				k.Desc})
+				k.Desc, strings.Join(k.Scopes, ","), clusterIDsString(k.ClusterIDs), k.ExpiresAt})
 		}
 	},
 }
@@ -225,13 +284,21 @@ func getAPIKeyClientAndContext(cloudAddr string) (cloudpb.APIKeyManagerClient, c
 	return apiKeyMgr, ctxWithCreds, nil
 }
 
-func generateAPIKey(cloudAddr string, desc string) (string, string, error) {
+func clusterIDsString(ids []*uuidpb.UUID) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = utils2.UUIDFromProtoOrNil(id).String()
+	}
+	return strings.Join(strs, ",")
+}
+
+func generateAPIKey(cloudAddr string, req *cloudpb.CreateAPIKeyRequest) (string, string, error) {
 	apiKeyMgr, ctxWithCreds, err := getAPIKeyClientAndContext(cloudAddr)
 	if err != nil {
 		return "", "", err
 	}
 
-	resp, err := apiKeyMgr.Create(ctxWithCreds, &cloudpb.CreateAPIKeyRequest{Desc: desc})
+	resp, err := apiKeyMgr.Create(ctxWithCreds, req)
 	if err != nil {
 		return "", "", err
 	}
@@ -249,6 +316,20 @@ func deleteAPIKey(cloudAddr string, keyID uuid.UUID) error {
 	return err
 }
 
+func rotateAPIKey(cloudAddr string, keyID uuid.UUID) (string, error) {
+	apiKeyMgr, ctxWithCreds, err := getAPIKeyClientAndContext(cloudAddr)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := apiKeyMgr.Rotate(ctxWithCreds, utils2.ProtoFromUUID(keyID))
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Key, nil
+}
+
 func listAPIKeyMetadatas(cloudAddr string) ([]*cloudpb.APIKeyMetadata, error) {
 	apiKeyMgr, ctxWithCreds, err := getAPIKeyClientAndContext(cloudAddr)
 	if err != nil {
@@ -37,7 +37,7 @@ func init() {
 
 	LoginCmd.PersistentFlags().Bool("manual", false, "Don't automatically open the browser")
 	LoginCmd.Flags().Bool("use_api_key", false, "Use API key for authentication")
-	LoginCmd.Flags().String("api_key", "", "Use specified API key for authentication.")
+	LoginCmd.Flags().String("api_key", "", "Use specified API key or personal access token for authentication.")
 }
 
 // AuthCmd is the auth sub-command of the CLI.
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/pixie_cli/pkg/auth"
+	"px.dev/pixie/src/pixie_cli/pkg/components"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+	utils2 "px.dev/pixie/src/utils"
+)
+
+func init() {
+	AuthCmd.AddCommand(TokensCmd)
+
+	TokensCmd.AddCommand(CreateTokenCmd)
+	TokensCmd.AddCommand(DeleteTokenCmd)
+	TokensCmd.AddCommand(ListTokensCmd)
+
+	CreateTokenCmd.Flags().StringP("name", "n", "", "A name for the token, unique among your tokens")
+	CreateTokenCmd.Flags().StringSlice("scopes", []string{"cloud:read"}, "The scopes of the token: cloud:read, cloud:write and/or vizier:exec")
+	CreateTokenCmd.Flags().Duration("expires_in", 30*24*time.Hour, "How long until the token expires")
+	CreateTokenCmd.Flags().BoolP("short", "s", false, "Return only the created token, for use to pipe to other tools")
+
+	DeleteTokenCmd.Flags().StringP("id", "i", "", "The ID of the token to delete")
+
+	ListTokensCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+}
+
+// TokensCmd is the tokens sub-command of Auth.
+var TokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "Manage your personal access tokens for Pixie",
+	Long: "Manage your personal access tokens for Pixie. Personal access tokens belong to you rather than to your org, " +
+		"expire, and only allow the calls of their scopes. Use them in place of an API key, for example " +
+		"with `px auth login --api_key`.",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Info("Nothing here... Please execute one of the subcommands")
+		cmd.Help()
+	},
+}
+
+// CreateTokenCmd is the Create sub-command of Tokens.
+var CreateTokenCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Generate a personal access token",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("name", cmd.Flags().Lookup("name"))
+		viper.BindPFlag("short", cmd.Flags().Lookup("short"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		name, _ := cmd.Flags().GetString("name")
+		scopes, _ := cmd.Flags().GetStringSlice("scopes")
+		expiresIn, _ := cmd.Flags().GetDuration("expires_in")
+		short, _ := cmd.Flags().GetBool("short")
+		if name == "" {
+			utils.Fatal("Token name must be specified using --name flag")
+		}
+
+		t, err := createPersonalAccessToken(cloudAddr, name, scopes, time.Now().Add(expiresIn))
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatal("Failed to generate personal access token")
+		}
+		if short {
+			fmt.Fprintf(os.Stdout, "%s\n", t.Token)
+		} else {
+			utils.Infof("Generated personal access token: \nID: %s \nToken: %s \nExpires: %s",
+				utils2.UUIDFromProtoOrNil(t.ID), t.Token, t.ExpiresAt)
+		}
+	},
+}
+
+// DeleteTokenCmd is the Delete sub-command of Tokens.
+var DeleteTokenCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete a personal access token",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("id", cmd.Flags().Lookup("id"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		id, _ := cmd.Flags().GetString("id")
+		if id == "" {
+			utils.Fatal("Token ID must be specified using --id flag")
+		}
+
+		idUUID, err := uuid.FromString(id)
+		if err != nil {
+			utils.WithError(err).Fatal("Invalid token ID")
+		}
+
+		err = deletePersonalAccessToken(cloudAddr, idUUID)
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatal("Failed to delete personal access token")
+		}
+		utils.Info("Successfully deleted personal access token")
+	},
+}
+
+// ListTokensCmd is the List sub-command of Tokens.
+var ListTokensCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your personal access tokens",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		tokens, err := listPersonalAccessTokens(cloudAddr)
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatal("Failed to list personal access tokens")
+		}
+		w := components.CreateStreamWriter(format, os.Stdout)
+		defer w.Finish()
+		w.SetHeader("tokens", []string{"ID", "Name", "Scopes", "CreatedAt", "ExpiresAt", "LastUsedAt", "LastUsedIP"})
+		for _, t := range tokens {
+			_ = w.Write([]interface{}{utils2.UUIDFromProtoOrNil(t.ID), t.Name, strings.Join(t.Scopes, ","),
+				t.CreatedAt, t.ExpiresAt, t.LastUsedAt, t.LastUsedIP})
+		}
+	},
+}
+
+func getPersonalAccessTokenClientAndContext(cloudAddr string) (cloudpb.PersonalAccessTokenManagerClient, context.Context) {
+	// Get grpc connection to cloud.
+	cloudConn, err := utils.GetCloudClientConnection(cloudAddr)
+	if err != nil {
+		// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+		log.Fatalln(err)
+	}
+
+	return cloudpb.NewPersonalAccessTokenManagerClient(cloudConn), auth.CtxWithCreds(context.Background())
+}
+
+func createPersonalAccessToken(cloudAddr string, name string, scopes []string, expiresAt time.Time) (*cloudpb.PersonalAccessToken, error) {
+	client, ctxWithCreds := getPersonalAccessTokenClientAndContext(cloudAddr)
+
+	expiresAtPb, err := types.TimestampProto(expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return client.Create(ctxWithCreds, &cloudpb.CreatePersonalAccessTokenRequest{
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: expiresAtPb,
+	})
+}
+
+func deletePersonalAccessToken(cloudAddr string, id uuid.UUID) error {
+	client, ctxWithCreds := getPersonalAccessTokenClientAndContext(cloudAddr)
+
+	_, err := client.Delete(ctxWithCreds, utils2.ProtoFromUUID(id))
+	return err
+}
+
+func listPersonalAccessTokens(cloudAddr string) ([]*cloudpb.PersonalAccessToken, error) {
+	client, ctxWithCreds := getPersonalAccessTokenClientAndContext(cloudAddr)
+
+	resp, err := client.List(ctxWithCreds, &cloudpb.ListPersonalAccessTokensRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Tokens, nil
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
+	"px.dev/pixie/src/pixie_cli/pkg/pxconfig"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+)
+
+func init() {
+	ConfigCmd.AddCommand(SetProxyCmd)
+	ConfigCmd.AddCommand(UnsetProxyCmd)
+}
+
+// ConfigCmd is the "config" command.
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configure the Pixie CLI",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Info("Nothing here... Please execute one of the subcommands")
+		cmd.Help()
+	},
+}
+
+// SetProxyCmd is the "config set-proxy" command.
+var SetProxyCmd = &cobra.Command{
+	Use:   "set-proxy <url>",
+	Short: "Reach Pixie Cloud through a SOCKS5 proxy or SSH jump host",
+	Long: `Reach Pixie Cloud through a SOCKS5 proxy or SSH jump host, for self-hosted clouds that are only reachable
+on a private network. The proxy is used by all commands, unless overridden by the --proxy flag or PX_PROXY.
+
+Supported proxy URLs are:
+  socks5://[user:password@]host:port
+  ssh://[user@]host[:port][?identity_file=path][&known_hosts=path]
+
+SSH jump hosts are authenticated with the SSH agent and the default identity files in ~/.ssh, and their host key
+must be in ~/.ssh/known_hosts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := proxy.NewDialer(args[0]); err != nil {
+			utils.WithError(err).Error("Invalid proxy")
+			os.Exit(1)
+		}
+		pxconfig.Cfg().Proxy = args[0]
+		if err := pxconfig.Save(); err != nil {
+			utils.WithError(err).Error("Failed to save config")
+			os.Exit(1)
+		}
+		utils.Info("Proxy set")
+	},
+}
+
+// UnsetProxyCmd is the "config unset-proxy" command.
+var UnsetProxyCmd = &cobra.Command{
+	Use:   "unset-proxy",
+	Short: "Reach Pixie Cloud directly",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pxconfig.Cfg().Proxy = ""
+		if err := pxconfig.Save(); err != nil {
+			utils.WithError(err).Error("Failed to save config")
+			os.Exit(1)
+		}
+		utils.Info("Proxy unset")
+	},
+}
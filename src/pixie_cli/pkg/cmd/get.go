@@ -42,7 +42,7 @@ import (
 )
 
 func init() {
-	GetCmd.PersistentFlags().StringP("output", "o", "", "Output format: one of: json|proto")
+	GetCmd.PersistentFlags().StringP("output", "o", "", "Output format: one of: json|proto|wide")
 
 	GetPEMsCmd.Flags().BoolP("all-clusters", "d", false, "Run script across all clusters")
 	GetPEMsCmd.Flags().StringP("cluster", "c", "", "Run only on selected cluster")
@@ -104,7 +104,17 @@ var GetViziersCmd = &cobra.Command{
 			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
 			log.WithError(err).Fatal("Failed to create Vizier lister")
 		}
-		vzs, err := l.GetViziersInfo()
+		fields := []string{"id", "cluster_name", "cluster_version", "operator_version", "vizier_version",
+			"lastHeartbeatNs", "status", "status_message"}
+		headers := []string{"ClusterName", "ID", "K8s Version", "Operator Version", "Vizier Version", "Last Heartbeat", "Status", "Status Message"}
+		// The wide output includes the quality of the connection between each vizier and the cloud, to tell
+		// clusters with a flaky network apart from unhealthy ones.
+		wide := format == "wide"
+		if wide {
+			fields = append(fields, "bridge_rtt_ns", "num_bridge_reconnects_last_hour", "num_dropped_messages_last_hour")
+			headers = append(headers, "Bridge RTT", "Reconnects (1h)", "Dropped Msgs (1h)")
+		}
+		vzs, err := l.GetViziersInfo(fields...)
 		if err != nil {
 			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
 			log.WithError(err).Fatalln("Failed to get vizier information")
@@ -114,20 +124,29 @@ var GetViziersCmd = &cobra.Command{
 
 		w := components.CreateStreamWriter(format, os.Stdout)
 		defer w.Finish()
-		w.SetHeader("viziers", []string{"ClusterName", "ID", "K8s Version", "Operator Version", "Vizier Version", "Last Heartbeat", "Status", "Status Message"})
+		w.SetHeader("viziers", headers)
 
 		for _, vz := range vzs {
 			var lastHeartbeat interface{}
 			lastHeartbeat = vz.LastHeartbeatNs
-			if format == "" || format == "table" {
+			if format == "" || format == "table" || wide {
 				if vz.LastHeartbeatNs >= 0 {
 					lastHeartbeat = humanize.Time(
 						time.Unix(0,
 							time.Since(time.Unix(0, vz.LastHeartbeatNs)).Nanoseconds()))
 				}
 			}
-			_ = w.Write([]interface{}{vz.ClusterName, utils.UUIDFromProtoOrNil(vz.ID), vz.ClusterVersion,
-				prettyVersion(vz.OperatorVersion), prettyVersion(vz.VizierVersion), lastHeartbeat, vz.Status, vz.StatusMessage})
+			row := []interface{}{vz.ClusterName, utils.UUIDFromProtoOrNil(vz.ID), vz.ClusterVersion,
+				prettyVersion(vz.OperatorVersion), prettyVersion(vz.VizierVersion), lastHeartbeat, vz.Status, vz.StatusMessage}
+			if wide {
+				// A vizier that hasn't measured its round trip time yet reports 0.
+				bridgeRTT := ""
+				if vz.BridgeRTTNs > 0 {
+					bridgeRTT = time.Duration(vz.BridgeRTTNs).Round(time.Millisecond).String()
+				}
+				row = append(row, bridgeRTT, vz.NumBridgeReconnectsLastHour, vz.NumDroppedMessagesLastHour)
+			}
+			_ = w.Write(row)
 		}
 	},
 }
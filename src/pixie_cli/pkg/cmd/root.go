@@ -33,6 +33,7 @@ import (
 	"golang.org/x/exp/slices"
 
 	"px.dev/pixie/src/pixie_cli/pkg/auth"
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
 	"px.dev/pixie/src/pixie_cli/pkg/pxanalytics"
 	"px.dev/pixie/src/pixie_cli/pkg/pxconfig"
 	"px.dev/pixie/src/pixie_cli/pkg/update"
@@ -74,6 +75,9 @@ func init() {
 	RootCmd.PersistentFlags().String("direct_vizier_key", "", "Should be set if direct_vizier_addr is set, the key to authenticate whether the user has permissions to connect to the Vizier service.")
 	viper.BindPFlag("direct_vizier_key", RootCmd.PersistentFlags().Lookup("direct_vizier_key"))
 
+	RootCmd.PersistentFlags().String("proxy", "", "If set, reach Pixie Cloud through this SOCKS5 proxy or SSH jump host. Overrides the proxy from px config set-proxy.")
+	viper.BindPFlag("proxy", RootCmd.PersistentFlags().Lookup("proxy"))
+
 	RootCmd.AddCommand(VersionCmd)
 	RootCmd.AddCommand(AuthCmd)
 	RootCmd.AddCommand(CollectLogsCmd)
@@ -89,7 +93,9 @@ func init() {
 	RootCmd.AddCommand(CreateBundle)
 	RootCmd.AddCommand(DeployKeyCmd)
 	RootCmd.AddCommand(APIKeyCmd)
+	RootCmd.AddCommand(SavedQueryCmd)
 	RootCmd.AddCommand(DebugCmd)
+	RootCmd.AddCommand(ConfigCmd)
 
 	RootCmd.PersistentFlags().MarkHidden("cloud_addr")
 	RootCmd.PersistentFlags().MarkHidden("dev_cloud_namespace")
@@ -106,6 +112,7 @@ func init() {
 	viper.BindEnv("vizier_version", "PX_VIZIER_VERSION", "PL_VIZIER_VERSION")
 	viper.BindEnv("direct_vizier_key", "PX_DIRECT_VIZIER_KEY")
 	viper.BindEnv("direct_vizier_addr", "PX_DIRECT_VIZIER_ADDR")
+	viper.BindEnv("proxy", "PX_PROXY")
 
 	viper.BindPFlags(pflag.CommandLine)
 
@@ -144,6 +151,8 @@ var RootCmd = &cobra.Command{
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		printEnvVars()
 
+		configureProxy(cmd)
+
 		cloudAddr := getCloudAddrIfRequired(cmd)
 
 		if matched, err := regexp.MatchString(".+:[0-9]+$", cloudAddr); !matched && err == nil {
@@ -194,6 +203,9 @@ var RootCmd = &cobra.Command{
 		// such as `px deploy` run through most of the command before suddenly complaining partway through when we
 		// actually hit Pixie Cloud.
 
+		if slices.Contains(cmdsAuthNotReqd, cmd) {
+			return
+		}
 		// Check if the subcommand requires auth.
 		checkAuthForCmd(cmd)
 		// Check if any parents of the subcommand requires auth.
@@ -201,10 +213,32 @@ var RootCmd = &cobra.Command{
 	},
 }
 
+// cmdsAuthNotReqd are the commands that don't require auth, even if their parent command does.
+var cmdsAuthNotReqd = []*cobra.Command{
+	ScriptInitCmd,
+}
+
 // Name a variable to store a slice of commands that don't require cloudAddr
 var cmdsCloudAddrNotReqd = []*cobra.Command{
 	CollectLogsCmd,
 	VersionCmd,
+	SetProxyCmd,
+	UnsetProxyCmd,
+}
+
+// configureProxy routes the connections to Pixie Cloud through the proxy from the flags, or the CLI config.
+func configureProxy(cmd *cobra.Command) {
+	proxyURL := viper.GetString("proxy")
+	if proxyURL == "" {
+		proxyURL = pxconfig.Cfg().Proxy
+	}
+	if err := proxy.Set(proxyURL); err != nil {
+		utils.WithError(err).Error("Failed to configure proxy. Please fix it with `px config set-proxy` or `px config unset-proxy`.")
+		// The config commands must still work, so that the proxy can be fixed.
+		if cmd.Parent() != ConfigCmd {
+			os.Exit(1)
+		}
+	}
 }
 
 func getCloudAddrIfRequired(cmd *cobra.Command) string {
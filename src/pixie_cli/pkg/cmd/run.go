@@ -114,11 +114,7 @@ func createNewCobraCommand() *cobra.Command {
 			viper.BindPFlag("bundle", cmd.Flags().Lookup("bundle"))
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			cloudAddr := viper.GetString("cloud_addr")
 			format, _ := cmd.Flags().GetString("output")
-			directVzAddr := viper.GetString("direct_vizier_addr")
-			directVzKey := viper.GetString("direct_vizier_key")
-
 			format = strings.ToLower(format)
 			if format == "live" {
 				LiveCmd.Run(cmd, args)
@@ -157,96 +153,129 @@ func createNewCobraCommand() *cobra.Command {
 				scriptArgs = args
 			}
 
-			fs := execScript.GetFlagSet()
-			if fs != nil {
-				if err := fs.Parse(scriptArgs); err != nil {
-					if err == flag.ErrHelp {
-						os.Exit(0)
-					}
-					utils.WithError(err).Fatal("Failed to parse script flags")
-				}
-				err := execScript.UpdateFlags(fs)
-				if err != nil {
-					if errors.Is(err, script.ErrMissingRequiredArgument) {
-						utils.Errorf("Missing required argument, please look at help below on how to pass in required arguments\n")
-						cmd.Help()
-						os.Exit(1)
-					}
-					utils.WithError(err).Fatal("Error parsing script flags")
-				}
-			}
+			mustParseScriptFlags(cmd, execScript, scriptArgs, nil)
+			executeScript(cmd, execScript, format)
+		},
+	}
+}
 
-			allClusters, _ := cmd.Flags().GetBool("all-clusters")
-			selectedCluster, _ := cmd.Flags().GetString("cluster")
-			clusterID := uuid.FromStringOrNil(selectedCluster)
+// RunCmd is the "query" command.
+var RunCmd = createNewCobraCommand()
 
-			if !allClusters && clusterID == uuid.Nil && directVzAddr == "" {
-				clusterID, err = vizier.GetCurrentVizier(cloudAddr)
-				if err != nil {
-					utils.WithError(err).Fatal("Could not fetch healthy vizier")
+// RunSubCmd is the "query" command used as a subcommand with scripts.
+var RunSubCmd = createNewCobraCommand()
+
+// mustParseScriptFlags parses the script arguments passed on the command line into the
+// script's flags. defaultArgs, if set, takes precedence over the default values in the vis spec.
+func mustParseScriptFlags(cmd *cobra.Command, execScript *script.ExecutableScript, scriptArgs []string, defaultArgs map[string]string) {
+	fs := execScript.GetFlagSet()
+	if fs != nil {
+		// Only the arguments that the script declares as vis variables can be set.
+		for _, v := range execScript.Vis.Variables {
+			if val, ok := defaultArgs[v.Name]; ok {
+				if err := fs.Set(v.Name, val); err != nil {
+					utils.WithError(err).Fatal("Failed to set script flags")
 				}
 			}
-
-			conns := vizier.MustConnectVizier(cloudAddr, allClusters, clusterID, directVzAddr, directVzKey)
-			useEncryption, _ := cmd.Flags().GetBool("e2e_encryption")
-			if directVzAddr != "" {
-				// There is no e2e encryption for direct mode.
-				useEncryption = false
+		}
+		if err := fs.Parse(scriptArgs); err != nil {
+			if err == flag.ErrHelp {
+				os.Exit(0)
 			}
-
-			// Support Ctrl+C to cancel a query.
-			ctx, cleanup := utils.WithSignalCancellable(context.Background())
-			defer cleanup()
-			err = vizier.RunScriptAndOutputResults(ctx, conns, execScript, format, useEncryption)
-
-			if err != nil {
-				vzErr, ok := err.(*vizier.ScriptExecutionError)
-				switch {
-				case ok && vzErr.Code() == vizier.CodeCanceled:
-					utils.Info("Script was cancelled. Exiting.")
-				case err == ptproxy.ErrNotAvailable:
-					utils.WithError(err).Fatal("Cannot execute script")
-				default:
-					utils.WithError(err).Fatal("Failed to execute script")
-				}
+			utils.WithError(err).Fatal("Failed to parse script flags")
+		}
+		err := execScript.UpdateFlags(fs)
+		if err != nil {
+			if errors.Is(err, script.ErrMissingRequiredArgument) {
+				utils.Errorf("Missing required argument, please look at help below on how to pass in required arguments\n")
+				cmd.Help()
+				os.Exit(1)
 			}
+			utils.WithError(err).Fatal("Error parsing script flags")
+		}
+	}
+}
 
-			// Don't print cloudAddr live view link for direct mode.
-			if directVzAddr != "" {
-				return
-			}
+// mustConnectSelectedViziers connects to the cluster(s) selected by the command's flags. It returns the
+// connections, the ID of the selected cluster and whether the results should be e2e encrypted.
+func mustConnectSelectedViziers(cmd *cobra.Command) ([]*vizier.Connector, uuid.UUID, bool) {
+	cloudAddr := viper.GetString("cloud_addr")
+	directVzAddr := viper.GetString("direct_vizier_addr")
+	directVzKey := viper.GetString("direct_vizier_key")
 
-			// Get the name for this cluster for the live view
-			var clusterName *string
-			lister, err := vizier.NewLister(cloudAddr)
-			if err != nil {
-				log.WithError(err).Fatal("Failed to create Vizier lister")
-			}
-			vzInfo, err := lister.GetVizierInfo(clusterID)
-			switch {
-			case err != nil:
-				utils.WithError(err).Errorf("Error getting cluster name for cluster %s", clusterID.String())
-			case len(vzInfo) == 0:
-				utils.Errorf("Error getting cluster name for cluster %s, no results returned", clusterID.String())
-			default:
-				clusterName = &(vzInfo[0].ClusterName)
-			}
+	allClusters, _ := cmd.Flags().GetBool("all-clusters")
+	selectedCluster, _ := cmd.Flags().GetString("cluster")
+	clusterID := uuid.FromStringOrNil(selectedCluster)
 
-			if lvl := execScript.LiveViewLink(clusterName); lvl != "" {
-				p := func(s string, a ...interface{}) {
-					fmt.Fprintf(os.Stderr, s, a...)
-				}
-				b := color.New(color.Bold).Sprint
-				u := color.New(color.Underline).Sprint
-				p("\n%s %s: %s\n", color.CyanString("\n==> "),
-					b("Live UI"), u(lvl))
-			}
-		},
+	if !allClusters && clusterID == uuid.Nil && directVzAddr == "" {
+		var err error
+		clusterID, err = vizier.GetCurrentVizier(cloudAddr)
+		if err != nil {
+			utils.WithError(err).Fatal("Could not fetch healthy vizier")
+		}
 	}
+
+	conns := vizier.MustConnectVizier(cloudAddr, allClusters, clusterID, directVzAddr, directVzKey)
+	useEncryption, _ := cmd.Flags().GetBool("e2e_encryption")
+	if directVzAddr != "" {
+		// There is no e2e encryption for direct mode.
+		useEncryption = false
+	}
+	return conns, clusterID, useEncryption
 }
 
-// RunCmd is the "query" command.
-var RunCmd = createNewCobraCommand()
+// executeScript runs the script on the cluster(s) selected by the command's flags, and outputs
+// the results in the given format.
+func executeScript(cmd *cobra.Command, execScript *script.ExecutableScript, format string) {
+	cloudAddr := viper.GetString("cloud_addr")
+	directVzAddr := viper.GetString("direct_vizier_addr")
+	conns, clusterID, useEncryption := mustConnectSelectedViziers(cmd)
+
+	// Support Ctrl+C to cancel a query.
+	ctx, cleanup := utils.WithSignalCancellable(context.Background())
+	defer cleanup()
+	err := vizier.RunScriptAndOutputResults(ctx, conns, execScript, format, useEncryption)
+
+	if err != nil {
+		vzErr, ok := err.(*vizier.ScriptExecutionError)
+		switch {
+		case ok && vzErr.Code() == vizier.CodeCanceled:
+			utils.Info("Script was cancelled. Exiting.")
+		case err == ptproxy.ErrNotAvailable:
+			utils.WithError(err).Fatal("Cannot execute script")
+		default:
+			utils.WithError(err).Fatal("Failed to execute script")
+		}
+	}
 
-// RunSubCmd is the "query" command used as a subcommand with scripts.
-var RunSubCmd = createNewCobraCommand()
+	// Don't print cloudAddr live view link for direct mode.
+	if directVzAddr != "" {
+		return
+	}
+
+	// Get the name for this cluster for the live view
+	var clusterName *string
+	lister, err := vizier.NewLister(cloudAddr)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create Vizier lister")
+	}
+	vzInfo, err := lister.GetVizierInfo(clusterID)
+	switch {
+	case err != nil:
+		utils.WithError(err).Errorf("Error getting cluster name for cluster %s", clusterID.String())
+	case len(vzInfo) == 0:
+		utils.Errorf("Error getting cluster name for cluster %s, no results returned", clusterID.String())
+	default:
+		clusterName = &(vzInfo[0].ClusterName)
+	}
+
+	if lvl := execScript.LiveViewLink(clusterName); lvl != "" {
+		p := func(s string, a ...interface{}) {
+			fmt.Fprintf(os.Stderr, s, a...)
+		}
+		b := color.New(color.Bold).Sprint
+		u := color.New(color.Underline).Sprint
+		p("\n%s %s: %s\n", color.CyanString("\n==> "),
+			b("Live UI"), u(lvl))
+	}
+}
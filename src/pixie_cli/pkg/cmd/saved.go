@@ -0,0 +1,201 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/lestrrat-go/jwx/jwt"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/pixie_cli/pkg/auth"
+	"px.dev/pixie/src/pixie_cli/pkg/components"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	utils2 "px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/script"
+)
+
+func init() {
+	SavedQueryCmd.AddCommand(ListSavedQueryCmd)
+	SavedQueryCmd.AddCommand(RunSavedQueryCmd)
+
+	ListSavedQueryCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+
+	RunSavedQueryCmd.Flags().StringP("output", "o", "", "Output format: one of: json|table|csv")
+	RunSavedQueryCmd.Flags().StringP("id", "i", "", "ID of the saved query to run, if several queries share the name")
+	RunSavedQueryCmd.Flags().BoolP("e2e_encryption", "e", true, "Enable E2E encryption")
+	RunSavedQueryCmd.Flags().BoolP("all-clusters", "d", false, "Run script across all clusters")
+	RunSavedQueryCmd.Flags().StringP("cluster", "c", "", "ID of the cluster to run on. "+
+		"Use 'px get viziers' to find the ID")
+	RunSavedQueryCmd.Flags().MarkHidden("all-clusters")
+}
+
+// SavedQueryCmd is the saved sub-command of the CLI.
+var SavedQueryCmd = &cobra.Command{
+	Use:   "saved",
+	Short: "List and run saved queries",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Info("Nothing here... Please execute one of the subcommands")
+		cmd.Help()
+	},
+}
+
+// ListSavedQueryCmd is the List sub-command of SavedQuery.
+var ListSavedQueryCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved queries that you can see",
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		queries, err := listSavedQueries(cloudAddr, "")
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatal("Failed to list saved queries")
+		}
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		defer w.Finish()
+		w.SetHeader("saved-queries", []string{"ID", "Name", "Scope", "Owner", "Description"})
+		for _, q := range queries {
+			_ = w.Write([]interface{}{utils2.UUIDFromProtoOrNil(q.ID), q.Name, q.Scope.String(),
+				utils2.UUIDFromProtoOrNil(q.OwnerID), q.Description})
+		}
+	},
+}
+
+// RunSavedQueryCmd is the Run sub-command of SavedQuery.
+var RunSavedQueryCmd = &cobra.Command{
+	Use:   "run <name> [-- script_args]",
+	Short: "Run a saved query, with its saved arguments",
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+		id, _ := cmd.Flags().GetString("id")
+
+		if len(args) == 0 {
+			utils.Fatal("Expected the name of the saved query to run.")
+		}
+		name := args[0]
+
+		queries, err := listSavedQueries(cloudAddr, name)
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatal("Failed to get saved queries")
+		}
+		q, err := selectSavedQuery(queries, name, id, currentUserID())
+		if err != nil {
+			utils.WithError(err).Fatal("Could not find saved query")
+		}
+
+		execScript := &script.ExecutableScript{
+			ScriptName:   q.Name,
+			ScriptString: q.Pxl,
+			ShortDoc:     q.Description,
+			LongDoc:      q.Description,
+			Vis:          q.Vis,
+			// Saved queries aren't part of the script bundle, so they can't be linked to as live views.
+			IsLocal: true,
+		}
+		// Arguments passed on the command line override the saved arguments.
+		mustParseScriptFlags(cmd, execScript, args[1:], q.Args)
+		executeScript(cmd, execScript, format)
+	},
+}
+
+// currentUserID returns the ID of the logged in user, or uuid.Nil if it can't be determined, for
+// example when using an API key.
+func currentUserID() uuid.UUID {
+	creds := auth.MustLoadDefaultCredentials()
+	parsed, err := jwt.Parse([]byte(creds.Token))
+	if err != nil || parsed == nil {
+		return uuid.Nil
+	}
+	return uuid.FromStringOrNil(srvutils.GetUserID(parsed))
+}
+
+// selectSavedQuery picks the query to run out of the saved queries with the given name. If an ID
+// is specified, only the query with that ID matches. Otherwise, the user's own query is preferred
+// over ones shared with them.
+func selectSavedQuery(queries []*cloudpb.SavedQuery, name string, id string, userID uuid.UUID) (*cloudpb.SavedQuery, error) {
+	if id != "" {
+		for _, q := range queries {
+			if utils2.UUIDFromProtoOrNil(q.ID).String() == id {
+				return q, nil
+			}
+		}
+		return nil, fmt.Errorf("no saved query named '%s' with ID %s", name, id)
+	}
+
+	switch len(queries) {
+	case 0:
+		return nil, fmt.Errorf("no saved query named '%s'", name)
+	case 1:
+		return queries[0], nil
+	}
+
+	for _, q := range queries {
+		if userID != uuid.Nil && utils2.UUIDFromProtoOrNil(q.OwnerID) == userID {
+			return q, nil
+		}
+	}
+
+	ids := make([]string, len(queries))
+	for i, q := range queries {
+		ids[i] = utils2.UUIDFromProtoOrNil(q.ID).String()
+	}
+	sort.Strings(ids)
+	return nil, fmt.Errorf("several saved queries are named '%s', specify one with --id: %s", name, strings.Join(ids, ", "))
+}
+
+func getSavedQueryClientAndContext(cloudAddr string) (cloudpb.SavedQueryServiceClient, context.Context, error) {
+	// Get grpc connection to cloud.
+	cloudConn, err := utils.GetCloudClientConnection(cloudAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := cloudpb.NewSavedQueryServiceClient(cloudConn)
+	ctxWithCreds := auth.CtxWithCreds(context.Background())
+	return client, ctxWithCreds, nil
+}
+
+func listSavedQueries(cloudAddr string, name string) ([]*cloudpb.SavedQuery, error) {
+	client, ctxWithCreds, err := getSavedQueryClientAndContext(cloudAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.GetSavedQueries(ctxWithCreds, &cloudpb.GetSavedQueriesReq{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Queries, nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"px.dev/pixie/src/pixie_cli/pkg/scriptgen"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+	"px.dev/pixie/src/pixie_cli/pkg/vizier"
+)
+
+func init() {
+	ScriptCmd.AddCommand(ScriptInitCmd)
+	ScriptCmd.AddCommand(ScriptValidateCmd)
+
+	ScriptInitCmd.Flags().StringP("template", "t", "http_latency", "The template to generate the script from")
+	ScriptInitCmd.Flags().StringP("dir", "d", ".", "The directory to create the script in")
+
+	ScriptValidateCmd.Flags().Bool("local", false, "Only check the script files, without running the script on a cluster")
+	ScriptValidateCmd.Flags().StringP("cluster", "c", "", "ID of the cluster to validate the script on. "+
+		"Use 'px get viziers' to find the ID")
+	ScriptValidateCmd.Flags().BoolP("e2e_encryption", "e", true, "Enable E2E encryption")
+}
+
+func templatesHelp() string {
+	var sb strings.Builder
+	sb.WriteString("Available templates:\n")
+	for _, t := range scriptgen.Templates() {
+		sb.WriteString(fmt.Sprintf("  %-14s %s\n", t.Name, t.Description))
+	}
+	return sb.String()
+}
+
+// ScriptInitCmd is the "script init" command.
+var ScriptInitCmd = &cobra.Command{
+	Use:   "init <script_name>",
+	Short: "Create a new pxl script from a template",
+	Long: "Creates a directory with a new pxl script, its vis spec, manifest and test fixtures, " +
+		"generated from a template.\n\n" + templatesHelp(),
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		tmpl, _ := cmd.Flags().GetString("template")
+		dir, _ := cmd.Flags().GetString("dir")
+
+		files, err := scriptgen.Generate(dir, args[0], tmpl)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to create script")
+		}
+		utils.Infof("Created script %s:", args[0])
+		for _, f := range files {
+			utils.Infof("  %s", f)
+		}
+		utils.Infof("Run 'px script validate <dir>' to check the script against your cluster.")
+	},
+}
+
+// ScriptValidateCmd is the "script validate" command.
+var ScriptValidateCmd = &cobra.Command{
+	Use:   "validate <script_dir>",
+	Short: "Check a pxl script directory, and compile it against a cluster's schema",
+	Long: "Checks that the script's files are well-formed, then runs the script on the cluster once with " +
+		"the args of each of its fixtures, so that it is compiled against the cluster's schema.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+		problems, err := scriptgen.Validate(dir)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to read script")
+		}
+		if len(problems) > 0 {
+			for _, p := range problems {
+				utils.Errorf("  %s", p)
+			}
+			utils.Fatalf("Script %s has %d problem(s)", dir, len(problems))
+		}
+		utils.Infof("Script files are valid.")
+
+		if local, _ := cmd.Flags().GetBool("local"); local {
+			return
+		}
+
+		fixtures, err := scriptgen.LoadFixtures(dir)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to load fixtures")
+		}
+		if len(fixtures) == 0 {
+			// Run the script with the default args.
+			fixtures = []*scriptgen.Fixture{{Name: "default"}}
+		}
+
+		conns, _, useEncryption := mustConnectSelectedViziers(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+
+		failed := 0
+		for _, f := range fixtures {
+			execScript, err := loadScriptFromDir(dir)
+			if err != nil {
+				utils.WithError(err).Fatal("Failed to load script")
+			}
+			mustParseScriptFlags(cmd, execScript, nil, f.Args)
+
+			err = vizier.RunScriptAndOutputResults(ctx, conns, execScript, "null", useEncryption)
+			if err != nil {
+				failed++
+				utils.Errorf("Fixture %s failed: %s", f.Name, vizier.FormatErrorMessage(err))
+				continue
+			}
+			utils.Infof("Fixture %s passed.", f.Name)
+		}
+		if failed > 0 {
+			utils.Errorf("%d of %d fixture(s) failed", failed, len(fixtures))
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package proxy routes the CLI's connections to Pixie Cloud through a SOCKS5 proxy or an SSH jump host, for
+// self-hosted clouds that are only reachable on a private network.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"golang.org/x/net/proxy"
+	"google.golang.org/grpc"
+)
+
+// ContextDialer dials connections through a proxy.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+var (
+	mu       sync.RWMutex
+	dialer   ContextDialer
+	proxyURL string
+)
+
+// NewDialer returns a dialer for the given proxy URL. Supported URLs are:
+//
+//	socks5://[user:password@]host:port
+//	ssh://[user@]host[:port][?identity_file=path][&known_hosts=path]
+func NewDialer(rawURL string) (ContextDialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", rawURL)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: password}
+		}
+		// The SOCKS5 dialer passes hostnames to the proxy, so that they are resolved on the private network.
+		d, err := proxy.SOCKS5("tcp", u.Host, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		cd, ok := d.(ContextDialer)
+		if !ok {
+			return nil, errors.New("SOCKS5 dialer does not support contexts")
+		}
+		return cd, nil
+	case "ssh":
+		return newSSHDialer(u)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be one of socks5 or ssh", u.Scheme)
+	}
+}
+
+// Set configures the proxy that is used for connections to Pixie Cloud. An empty URL disables the proxy.
+func Set(rawURL string) error {
+	var d ContextDialer
+	redacted := ""
+	if rawURL != "" {
+		var err error
+		d, err = NewDialer(rawURL)
+		if err != nil {
+			return err
+		}
+		u, _ := url.Parse(rawURL)
+		redacted = u.Redacted()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	dialer = d
+	proxyURL = redacted
+	return nil
+}
+
+// URL returns the URL of the configured proxy with its password redacted, or an empty string if no proxy is
+// configured.
+func URL() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return proxyURL
+}
+
+func getDialer() ContextDialer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return dialer
+}
+
+// GRPCDialOptions returns the dial options that route a gRPC connection through the configured proxy.
+func GRPCDialOptions() []grpc.DialOption {
+	d := getDialer()
+	if d == nil {
+		return nil
+	}
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, "tcp", addr)
+		}),
+	}
+}
+
+// HTTPClient returns an HTTP client that sends its requests through the configured proxy.
+func HTTPClient() *http.Client {
+	d := getDialer()
+	if d == nil {
+		return &http.Client{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = d.DialContext
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package proxy_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
+)
+
+// startSOCKS5Server starts a SOCKS5 proxy without auth that only supports CONNECT to domain names, and returns
+// its address and the number of connections it has proxied.
+func startSOCKS5Server(t *testing.T) (string, *int32) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	var conns int32
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// Greeting: version, number of methods, methods. Reply with no auth.
+				buf := make([]byte, 262)
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte{5, 0})
+
+				// Request: version, CONNECT, reserved, domain name address type, length, name, port.
+				if _, err := io.ReadFull(conn, buf[:5]); err != nil || buf[3] != 3 {
+					return
+				}
+				name := make([]byte, buf[4]+2)
+				if _, err := io.ReadFull(conn, name); err != nil {
+					return
+				}
+				host := string(name[:len(name)-2])
+				port := binary.BigEndian.Uint16(name[len(name)-2:])
+				target, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+				if err != nil {
+					_, _ = conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				atomic.AddInt32(&conns, 1)
+				_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go func() { _, _ = io.Copy(target, conn) }()
+				_, _ = io.Copy(conn, target)
+			}()
+		}
+	}()
+	return lis.Addr().String(), &conns
+}
+
+func TestNewDialer_Invalid(t *testing.T) {
+	for _, u := range []string{"http://localhost:8080", "socks5://", "localhost:1080"} {
+		_, err := proxy.NewDialer(u)
+		assert.Error(t, err, u)
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	proxyAddr, conns := startSOCKS5Server(t)
+	require.NoError(t, proxy.Set("socks5://user:secret@"+proxyAddr))
+	defer func() { require.NoError(t, proxy.Set("")) }()
+	assert.Equal(t, "socks5://user:xxxxx@"+proxyAddr, proxy.URL())
+	assert.Len(t, proxy.GRPCDialOptions(), 1)
+
+	// The hostname is resolved by the proxy.
+	resp, err := proxy.HTTPClient().Get("http://localhost:" + port)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "OK", string(body))
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns))
+
+	require.NoError(t, proxy.Set(""))
+	assert.Empty(t, proxy.URL())
+	assert.Empty(t, proxy.GRPCDialOptions())
+}
+
+// startSSHServer starts an SSH server that accepts the given client key and forwards direct-tcpip channels.
+func startSSHServer(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "pixie" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChan := range chans {
+					if newChan.ChannelType() != "direct-tcpip" {
+						_ = newChan.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					var payload struct {
+						Host     string
+						Port     uint32
+						OrigHost string
+						OrigPort uint32
+					}
+					if err := ssh.Unmarshal(newChan.ExtraData(), &payload); err != nil {
+						_ = newChan.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
+					if err != nil {
+						_ = newChan.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, chReqs, err := newChan.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					go ssh.DiscardRequests(chReqs)
+					go func() {
+						defer ch.Close()
+						defer target.Close()
+						go func() { _, _ = io.Copy(target, ch) }()
+						_, _ = io.Copy(ch, target)
+					}()
+				}
+			}()
+		}
+	}()
+	return lis.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestSSHProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	defer srv.Close()
+
+	// Write the client key and known hosts to a temporary directory.
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	require.NoError(t, err)
+	identityFile := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(identityFile, pem.EncodeToMemory(block), 0600))
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	require.NoError(t, err)
+
+	sshAddr, hostKey := startSSHServer(t, clientSigner.PublicKey())
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	_, err = proxy.NewDialer(fmt.Sprintf("ssh://pixie@%s?identity_file=%s&known_hosts=%s", sshAddr, identityFile, knownHostsFile))
+	assert.Error(t, err, "a missing known hosts file should be rejected")
+
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{sshAddr}, hostKey)+"\n"), 0600))
+	require.NoError(t, proxy.Set(fmt.Sprintf("ssh://pixie@%s?identity_file=%s&known_hosts=%s", sshAddr, identityFile, knownHostsFile)))
+	defer func() { require.NoError(t, proxy.Set("")) }()
+
+	for i := 0; i < 2; i++ {
+		resp, err := proxy.HTTPClient().Get(srv.URL)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "OK", string(body))
+	}
+
+	// The jump host's key must match the known hosts.
+	otherAddr, _ := startSSHServer(t, clientSigner.PublicKey())
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{otherAddr}, hostKey)+"\n"), 0600))
+	require.NoError(t, proxy.Set(fmt.Sprintf("ssh://pixie@%s?identity_file=%s&known_hosts=%s", otherAddr, identityFile, knownHostsFile)))
+	_, err = proxy.HTTPClient().Get(srv.URL)
+	assert.Error(t, err)
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultSSHPort    = "22"
+	sshConnectTimeout = 30 * time.Second
+)
+
+// The identity files that are tried, in order, if none is specified in the proxy URL.
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshDialer tunnels connections through an SSH jump host. The connection to the jump host is established on the
+// first dial, and is shared by all tunneled connections.
+type sshDialer struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func sshDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh"), nil
+}
+
+// sshAuthMethods returns the SSH agent, if one is running, and the identity files that exist.
+func sshAuthMethods(identityFile string) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	identityFiles := []string{identityFile}
+	if identityFile == "" {
+		dir, err := sshDir()
+		if err != nil {
+			return nil, err
+		}
+		identityFiles = nil
+		for _, f := range defaultIdentityFiles {
+			identityFiles = append(identityFiles, filepath.Join(dir, f))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, f := range identityFiles {
+		key, err := os.ReadFile(f)
+		if os.IsNotExist(err) && identityFile == "" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		var passphraseErr *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseErr) && identityFile == "" {
+			// Keys with a passphrase can only be used through the SSH agent.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity file %s: %w", f, err)
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("no SSH agent or identity file found for the SSH proxy")
+	}
+	return methods, nil
+}
+
+func newSSHDialer(u *url.URL) (*sshDialer, error) {
+	username := u.User.Username()
+	if username == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		username = current.Username
+	}
+
+	knownHostsFile := u.Query().Get("known_hosts")
+	if knownHostsFile == "" {
+		dir, err := sshDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile = filepath.Join(dir, "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts for the SSH proxy: %w", err)
+	}
+
+	authMethods, err := sshAuthMethods(u.Query().Get("identity_file"))
+	if err != nil {
+		return nil, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultSSHPort
+	}
+	return &sshDialer{
+		addr: net.JoinHostPort(u.Hostname(), port),
+		config: &ssh.ClientConfig{
+			User:            username,
+			Auth:            authMethods,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         sshConnectTimeout,
+		},
+	}, nil
+}
+
+func (d *sshDialer) getClient(ctx context.Context) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	var nd net.Dialer
+	conn, err := nd.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, d.addr, d.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to SSH proxy %s: %w", d.addr, err)
+	}
+	d.client = ssh.NewClient(c, chans, reqs)
+	return d.client, nil
+}
+
+func (d *sshDialer) resetClient(client *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == client {
+		d.client.Close()
+		d.client = nil
+	}
+}
+
+// DialContext opens a connection to addr from the SSH jump host.
+func (d *sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := d.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, addr)
+	if err == nil {
+		return conn, nil
+	}
+
+	// The connection to the jump host may have been dropped, so retry once with a new connection.
+	d.resetClient(client)
+	client, err = d.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial(network, addr)
+}
@@ -32,6 +32,8 @@ import (
 type ConfigInfo struct {
 	// UniqueClientID is the ID assigned to this user on first startup when auth information is not know. This can be later associated with the UserID.
 	UniqueClientID string `json:"uniqueClientID"`
+	// Proxy is the URL of the SOCKS5 proxy or SSH jump host used to reach Pixie Cloud, if any.
+	Proxy string `json:"proxy,omitempty"`
 }
 
 var (
@@ -94,3 +96,19 @@ func Cfg() *ConfigInfo {
 	})
 	return config
 }
+
+// Save writes the default config to the config file.
+func Save() error {
+	cfg := Cfg()
+	configPath, err := utils.EnsureDefaultConfigFilePath()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(cfg)
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package scriptgen scaffolds new PxL scripts from templates, and checks that a script directory is
+// well-formed before it is run against a cluster.
+package scriptgen
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/bmatcuk/doublestar"
+	"gopkg.in/yaml.v2"
+
+	"px.dev/pixie/src/api/proto/vispb"
+	"px.dev/pixie/src/utils/script"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+const (
+	visFile      = "vis.json"
+	manifestFile = "manifest.yaml"
+	// FixturesFile is the file holding the sets of args that a script is tested with.
+	FixturesFile = "fixtures.json"
+)
+
+// templateFiles maps the files of each template to the files they are rendered to. The script file is named
+// after the script.
+var templateFiles = map[string]string{
+	"vis.json.tmpl":      visFile,
+	"manifest.yaml.tmpl": manifestFile,
+	"fixtures.json.tmpl": FixturesFile,
+}
+
+const scriptTemplateFile = "script.pxl.tmpl"
+
+// Template describes a template that scripts can be generated from.
+type Template struct {
+	Name        string
+	Description string
+}
+
+var templateDescriptions = map[string]string{
+	"alert":        "Lists the services whose HTTP error rate is above a threshold",
+	"http_latency": "Charts the HTTP latency and throughput of services over time",
+	"tracepoint":   "Deploys a tracepoint on a function of a Go program and shows its calls",
+}
+
+// Templates returns the available templates, ordered by name.
+func Templates() []Template {
+	var templates []Template
+	for name, desc := range templateDescriptions {
+		templates = append(templates, Template{Name: name, Description: desc})
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+var scriptNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*(/[a-z][a-z0-9_]*)*$`)
+
+type templateData struct {
+	// Base is the last part of the script name, which the generated files are named after.
+	Base string
+	// Title is a human readable version of Base.
+	Title string
+}
+
+func titleFromName(base string) string {
+	words := strings.Split(base, "_")
+	for i, w := range words {
+		if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Generate renders the template into a new script directory at dir/name, and returns the paths of the files
+// that were written. The name may contain slashes (such as "myorg/http_errors"), which become subdirectories.
+func Generate(dir, name, templateName string) ([]string, error) {
+	if !scriptNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("invalid script name %q: must be lowercase words separated by '_' or '/'", name)
+	}
+	if _, ok := templateDescriptions[templateName]; !ok {
+		return nil, fmt.Errorf("unknown template %q", templateName)
+	}
+
+	scriptDir := filepath.Join(dir, filepath.FromSlash(name))
+	if entries, err := os.ReadDir(scriptDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("directory %s already exists and is not empty", scriptDir)
+	}
+	if err := os.MkdirAll(scriptDir, 0755); err != nil {
+		return nil, err
+	}
+
+	base := path.Base(name)
+	data := &templateData{Base: base, Title: titleFromName(base)}
+	outputs := map[string]string{scriptTemplateFile: base + ".pxl"}
+	for tmpl, out := range templateFiles {
+		outputs[tmpl] = out
+	}
+
+	var written []string
+	for tmplFile, outFile := range outputs {
+		t, err := template.ParseFS(templatesFS, path.Join("templates", templateName, tmplFile))
+		if err != nil {
+			return nil, err
+		}
+		outPath := filepath.Join(scriptDir, outFile)
+		f, err := os.Create(outPath)
+		if err != nil {
+			return nil, err
+		}
+		err = t.Execute(f, data)
+		closeErr := f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if closeErr != nil {
+			return nil, closeErr
+		}
+		written = append(written, outPath)
+	}
+	sort.Strings(written)
+	return written, nil
+}
+
+// Fixture is a named set of args that a script is tested with.
+type Fixture struct {
+	Name string            `json:"name"`
+	Args map[string]string `json:"args"`
+}
+
+// LoadFixtures reads the fixtures of the script in dir. A script without a fixtures file has no fixtures.
+func LoadFixtures(dir string) ([]*Fixture, error) {
+	b, err := os.ReadFile(filepath.Join(dir, FixturesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []*Fixture
+	if err := json.Unmarshal(b, &fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", FixturesFile, err)
+	}
+	return fixtures, nil
+}
+
+type manifestSpec struct {
+	Short string `yaml:"short"`
+	Long  string `yaml:"long"`
+}
+
+// Validate checks that the script in dir is well-formed: that it has a single PxL file, a manifest and a
+// valid vis spec, that the vis spec only calls functions defined in the script with declared variables,
+// and that the fixtures set all required variables and nothing else. It returns the problems found, and
+// only returns an error if the files can't be read.
+func Validate(dir string) ([]string, error) {
+	var problems []string
+
+	pxlFiles, err := doublestar.Glob(path.Join(dir, "*.pxl"))
+	if err != nil {
+		return nil, err
+	}
+	var pxl string
+	if len(pxlFiles) != 1 {
+		problems = append(problems, fmt.Sprintf("expected exactly one pxl file, found %d", len(pxlFiles)))
+	} else {
+		b, err := os.ReadFile(pxlFiles[0])
+		if err != nil {
+			return nil, err
+		}
+		pxl = string(b)
+	}
+
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		problems = append(problems, fmt.Sprintf("missing %s", manifestFile))
+	case err != nil:
+		return nil, err
+	default:
+		var manifest manifestSpec
+		if err := yaml.Unmarshal(manifestBytes, &manifest); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to parse %s: %v", manifestFile, err))
+		} else if manifest.Short == "" {
+			problems = append(problems, fmt.Sprintf("%s is missing a short description", manifestFile))
+		}
+	}
+
+	var vis *vispb.Vis
+	visBytes, err := os.ReadFile(filepath.Join(dir, visFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		vis, err = script.ParseVisSpec(string(visBytes))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to parse %s: %v", visFile, err))
+		}
+	}
+
+	if vis != nil {
+		problems = append(problems, validateVis(vis, pxl)...)
+	}
+
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		problems = append(problems, validateFixtures(fixtures, vis)...)
+	}
+	return problems, nil
+}
+
+func validateVis(vis *vispb.Vis, pxl string) []string {
+	var problems []string
+	variables := make(map[string]bool)
+	for _, v := range vis.Variables {
+		variables[v.Name] = true
+	}
+
+	checkFunc := func(where string, f *vispb.Widget_Func) {
+		if f == nil {
+			problems = append(problems, fmt.Sprintf("%s has no func", where))
+			return
+		}
+		// Only a cheap check, the compiler checks the script properly when it runs on a cluster.
+		if pxl != "" && !regexp.MustCompile(`(?m)^def\s+`+regexp.QuoteMeta(f.Name)+`\s*\(`).MatchString(pxl) {
+			problems = append(problems, fmt.Sprintf("%s calls %s, which is not defined in the script", where, f.Name))
+		}
+		for _, arg := range f.Args {
+			if v, ok := arg.Input.(*vispb.Widget_Func_FuncArg_Variable); ok && !variables[v.Variable] {
+				problems = append(problems, fmt.Sprintf("%s uses undeclared variable %s", where, v.Variable))
+			}
+		}
+	}
+
+	outputs := make(map[string]bool)
+	for _, f := range vis.GlobalFuncs {
+		outputs[f.OutputName] = true
+		checkFunc(fmt.Sprintf("global func %q", f.OutputName), f.Func)
+	}
+	for _, w := range vis.Widgets {
+		where := fmt.Sprintf("widget %q", w.Name)
+		switch x := w.FuncOrRef.(type) {
+		case *vispb.Widget_Func_:
+			checkFunc(where, x.Func)
+		case *vispb.Widget_GlobalFuncOutputName:
+			if !outputs[x.GlobalFuncOutputName] {
+				problems = append(problems, fmt.Sprintf("%s uses undefined global func output %s", where, x.GlobalFuncOutputName))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s has no func", where))
+		}
+	}
+	return problems
+}
+
+func validateFixtures(fixtures []*Fixture, vis *vispb.Vis) []string {
+	var problems []string
+	variables := make(map[string]*vispb.Vis_Variable)
+	if vis != nil {
+		for _, v := range vis.Variables {
+			variables[v.Name] = v
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, f := range fixtures {
+		where := fmt.Sprintf("fixture %q", f.Name)
+		if f.Name == "" {
+			where = fmt.Sprintf("fixture %d", i)
+			problems = append(problems, fmt.Sprintf("%s has no name", where))
+		} else if names[f.Name] {
+			problems = append(problems, fmt.Sprintf("%s is defined more than once", where))
+		}
+		names[f.Name] = true
+
+		for arg := range f.Args {
+			if _, ok := variables[arg]; !ok {
+				problems = append(problems, fmt.Sprintf("%s sets undeclared variable %s", where, arg))
+			}
+		}
+		for name, v := range variables {
+			if _, ok := f.Args[name]; !ok && v.DefaultValue == nil {
+				problems = append(problems, fmt.Sprintf("%s is missing required variable %s", where, name))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
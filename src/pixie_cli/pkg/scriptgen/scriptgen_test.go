@@ -0,0 +1,115 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scriptgen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/pixie_cli/pkg/scriptgen"
+)
+
+func TestGenerate_AllTemplatesValid(t *testing.T) {
+	for _, tmpl := range scriptgen.Templates() {
+		t.Run(tmpl.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			files, err := scriptgen.Generate(dir, "myorg/my_script", tmpl.Name)
+			require.NoError(t, err)
+
+			scriptDir := filepath.Join(dir, "myorg", "my_script")
+			assert.Equal(t, []string{
+				filepath.Join(scriptDir, "fixtures.json"),
+				filepath.Join(scriptDir, "manifest.yaml"),
+				filepath.Join(scriptDir, "my_script.pxl"),
+				filepath.Join(scriptDir, "vis.json"),
+			}, files)
+
+			manifest, err := os.ReadFile(filepath.Join(scriptDir, "manifest.yaml"))
+			require.NoError(t, err)
+			assert.Contains(t, string(manifest), "short: My Script")
+
+			problems, err := scriptgen.Validate(scriptDir)
+			require.NoError(t, err)
+			assert.Empty(t, problems)
+
+			fixtures, err := scriptgen.LoadFixtures(scriptDir)
+			require.NoError(t, err)
+			assert.NotEmpty(t, fixtures)
+		})
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := scriptgen.Generate(dir, "My Script", "http_latency")
+	assert.Error(t, err)
+	_, err = scriptgen.Generate(dir, "../my_script", "http_latency")
+	assert.Error(t, err)
+	_, err = scriptgen.Generate(dir, "my_script", "unknown")
+	assert.Error(t, err)
+
+	_, err = scriptgen.Generate(dir, "my_script", "http_latency")
+	require.NoError(t, err)
+	// Doesn't overwrite an existing script.
+	_, err = scriptgen.Generate(dir, "my_script", "alert")
+	assert.Error(t, err)
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"script.pxl":    "import px\n\ndef f(start_time: str):\n    return px.DataFrame('http_events')\n",
+		"manifest.yaml": "---\nlong: No short description.\n",
+		"vis.json": `{
+  "variables": [
+    {"name": "start_time", "type": "PX_STRING", "defaultValue": "-5m"},
+    {"name": "svc", "type": "PX_SERVICE"}
+  ],
+  "globalFuncs": [
+    {"outputName": "out", "func": {"name": "f", "args": [{"name": "start_time", "variable": "start_time"}]}}
+  ],
+  "widgets": [
+    {"name": "missing func", "func": {"name": "g", "args": [{"name": "a", "variable": "namespace"}]}},
+    {"name": "missing output", "globalFuncOutputName": "other"}
+  ]
+}`,
+		"fixtures.json": `[{"name": "ok", "args": {"svc": "default/svc"}}, {"name": "bad", "args": {"pod": "default/pod"}}]`,
+	})
+
+	problems, err := scriptgen.Validate(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"manifest.yaml is missing a short description",
+		`widget "missing func" calls g, which is not defined in the script`,
+		`widget "missing func" uses undeclared variable namespace`,
+		`widget "missing output" uses undefined global func output other`,
+		`fixture "bad" is missing required variable svc`,
+		`fixture "bad" sets undeclared variable pod`,
+	}, problems)
+}
@@ -37,6 +37,7 @@ import (
 	"google.golang.org/grpc"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
 	"px.dev/pixie/src/pixie_cli/pkg/utils"
 	version "px.dev/pixie/src/shared/goversion"
 	"px.dev/pixie/src/shared/services"
@@ -49,6 +50,7 @@ func newATClient(cloudAddr string) (cloudpb.ArtifactTrackerClient, error) {
 	if err != nil {
 		return nil, err
 	}
+	dialOpts = append(dialOpts, proxy.GRPCDialOptions()...)
 
 	c, err := grpc.Dial(cloudAddr, dialOpts...)
 	if err != nil {
@@ -23,6 +23,7 @@ import (
 
 	"google.golang.org/grpc"
 
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
 	"px.dev/pixie/src/shared/services"
 )
 
@@ -34,6 +35,7 @@ func GetCloudClientConnection(cloudAddr string) (*grpc.ClientConn, error) {
 	if err != nil {
 		return nil, err
 	}
+	dialOpts = append(dialOpts, proxy.GRPCDialOptions()...)
 
 	c, err := grpc.Dial(cloudAddr, dialOpts...)
 	if err != nil {
@@ -24,6 +24,7 @@ import (
 	"google.golang.org/grpc"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
 	"px.dev/pixie/src/shared/services"
 )
 
@@ -34,6 +35,7 @@ func newVizierClusterInfoClient(cloudAddr string) (cloudpb.VizierClusterInfoClie
 	if err != nil {
 		return nil, err
 	}
+	dialOpts = append(dialOpts, proxy.GRPCDialOptions()...)
 
 	c, err := grpc.Dial(cloudAddr, dialOpts...)
 	if err != nil {
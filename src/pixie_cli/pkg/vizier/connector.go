@@ -39,6 +39,7 @@ import (
 	"px.dev/pixie/src/api/proto/vispb"
 	"px.dev/pixie/src/api/proto/vizierpb"
 	"px.dev/pixie/src/pixie_cli/pkg/auth"
+	"px.dev/pixie/src/pixie_cli/pkg/proxy"
 	cliUtils "px.dev/pixie/src/pixie_cli/pkg/utils"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/utils"
@@ -109,6 +110,7 @@ func (c *Connector) connect(addr string) error {
 		return err
 	}
 
+	dialOpts = append(dialOpts, proxy.GRPCDialOptions()...)
 	dialOpts = append(dialOpts, grpc.WithBlock())
 	// Try to dial with a time out (ctrl-c can be used to cancel)
 	conn, err := grpc.DialContext(ctx, addr, dialOpts...)
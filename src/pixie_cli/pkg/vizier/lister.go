@@ -22,6 +22,7 @@ import (
 	"context"
 
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/pixie_cli/pkg/auth"
@@ -42,11 +43,16 @@ func NewLister(cloudAddr string) (*Lister, error) {
 	return &Lister{vc: vc}, nil
 }
 
-// GetViziersInfo returns information about connected viziers.
-func (l *Lister) GetViziersInfo() ([]*cloudpb.ClusterInfo, error) {
+// GetViziersInfo returns information about connected viziers. If fields are specified, only those fields of
+// the ClusterInfo are returned, which is much smaller than the full cluster status.
+func (l *Lister) GetViziersInfo(fields ...string) ([]*cloudpb.ClusterInfo, error) {
 	ctx := auth.CtxWithCreds(context.Background())
 
-	c, err := l.vc.GetClusterInfo(ctx, &cloudpb.GetClusterInfoRequest{})
+	req := &cloudpb.GetClusterInfoRequest{}
+	if len(fields) > 0 {
+		req.ReadMask = &types.FieldMask{Paths: fields}
+	}
+	c, err := l.vc.GetClusterInfo(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +69,8 @@ type StreamOutputAdapter struct {
 	format              string
 	formatters          map[string]DataFormatter
 	mutationInfo        *vizierpb.MutationInfo
+	progressMu          sync.Mutex
+	progress            *vizierpb.QueryProgress
 	decOpts             *vizierpb.ExecuteScriptRequest_EncryptionOptions
 
 	// This is used to track table/ID -> names across multiple clusters.
@@ -159,6 +161,14 @@ func (v *StreamOutputAdapter) MutationInfo() (*vizierpb.MutationInfo, error) {
 	return v.mutationInfo, nil
 }
 
+// Progress returns the latest progress of the query, if the request asked for progress to be streamed. It may be
+// called while the query is running.
+func (v *StreamOutputAdapter) Progress() *vizierpb.QueryProgress {
+	v.progressMu.Lock()
+	defer v.progressMu.Unlock()
+	return v.progress
+}
+
 // Views gets all the accumulated views. This function is only valid with format = inmemory and after Finish.
 func (v *StreamOutputAdapter) Views() ([]components.TableView, error) {
 	if v.err != nil {
@@ -241,6 +251,11 @@ func (v *StreamOutputAdapter) handleStream(ctx context.Context, stream chan *Exe
 				continue
 			}
 
+			if msg.Resp.Progress != nil {
+				v.handleProgress(ctx, msg.Resp.Progress)
+				continue
+			}
+
 			if msg.Resp.Result == nil {
 				v.err = newScriptExecutionError(CodeUnknown, "Got empty response")
 				return
@@ -358,6 +373,12 @@ func (v *StreamOutputAdapter) handleMutationInfo(ctx context.Context, mi *vizier
 	v.mutationInfo = mi
 }
 
+func (v *StreamOutputAdapter) handleProgress(ctx context.Context, p *vizierpb.QueryProgress) {
+	v.progressMu.Lock()
+	defer v.progressMu.Unlock()
+	v.progress = p
+}
+
 func (v *StreamOutputAdapter) handleData(ctx context.Context, d *vizierpb.ExecuteScriptResponse_Data) error {
 	if d.Data.ExecutionStats != nil {
 		err := v.handleExecutionStats(ctx, d.Data.ExecutionStats)
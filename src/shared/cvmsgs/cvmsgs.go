@@ -31,6 +31,8 @@ var (
 	CronScriptUpdatesChannel = "CronScriptsUpdates"
 	// CronScriptUpdatesResponseChannel is the NATS channel that script updates are published to.
 	CronScriptUpdatesResponseChannel = "CronScriptsUpdatesResponse"
+	// CronScriptExecutionResultChannel is the NATS channel that the results of cron script runs are published to.
+	CronScriptExecutionResultChannel = "CronScriptExecutionResult"
 
 	// VizierMetricsChannel is the NATS channel on the cloud side that Vizier metrics are published to.
 	VizierMetricsChannel = "VZMetrics"
@@ -96,6 +96,11 @@ func (v *Version) BuildTimestamp() string {
 	return v.buildTimeStamp.UTC().String()
 }
 
+// BuildTime returns the build time.
+func (v *Version) BuildTime() time.Time {
+	return v.buildTimeStamp
+}
+
 // Builder returns the built by.
 func (v *Version) Builder() string {
 	return v.builtBy
@@ -68,6 +68,11 @@ owner_references: {
   name: "rs0"
   kind: "ReplicaSet"
 }
+workload: {
+  uid: "deployment_uid"
+  name: "deployment1"
+  kind: "Deployment"
+}
 )";
 
 const char* kReusedIPPodUpdatePbTxt = R"(
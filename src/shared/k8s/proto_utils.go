@@ -163,19 +163,27 @@ var conditionTypeToPbMap = map[v1.NodeConditionType]metadatapb.NodeConditionType
 // OwnerReferenceToProto converts an OwnerReference into a proto.
 func OwnerReferenceToProto(o *metav1.OwnerReference) *metadatapb.OwnerReference {
 	return &metadatapb.OwnerReference{
-		Kind: o.Kind,
-		Name: o.Name,
-		UID:  string(o.UID),
+		Kind:       o.Kind,
+		Name:       o.Name,
+		UID:        string(o.UID),
+		APIVersion: o.APIVersion,
+		Controller: o.Controller != nil && *o.Controller,
 	}
 }
 
 // OwnerReferenceFromProto converts a proto message to an OwnerReference.
 func OwnerReferenceFromProto(pb *metadatapb.OwnerReference) *metav1.OwnerReference {
-	return &metav1.OwnerReference{
-		Kind: pb.Kind,
-		Name: pb.Name,
-		UID:  types.UID(pb.UID),
+	ref := &metav1.OwnerReference{
+		Kind:       pb.Kind,
+		Name:       pb.Name,
+		UID:        types.UID(pb.UID),
+		APIVersion: pb.APIVersion,
 	}
+	if pb.Controller {
+		controller := true
+		ref.Controller = &controller
+	}
+	return ref
 }
 
 // ObjectMetadataToProto converts an ObjectMeta into a proto.
@@ -570,6 +578,7 @@ func ContainerStatusToProto(c *v1.ContainerStatus) *metadatapb.ContainerStatus {
 		Name:         c.Name,
 		ContainerID:  c.ContainerID,
 		RestartCount: int64(c.RestartCount),
+		Ready:        c.Ready,
 	}
 	switch {
 	case c.State.Waiting != nil:
@@ -585,6 +594,16 @@ func ContainerStatusToProto(c *v1.ContainerStatus) *metadatapb.ContainerStatus {
 		cPb.StopTimestampNS = c.State.Terminated.FinishedAt.UnixNano()
 		cPb.Message = c.State.Terminated.Message
 		cPb.Reason = c.State.Terminated.Reason
+		cPb.ExitCode = c.State.Terminated.ExitCode
+	}
+	if t := c.LastTerminationState.Terminated; t != nil {
+		cPb.LastTermination = &metadatapb.ContainerTermination{
+			ExitCode:         t.ExitCode,
+			Reason:           t.Reason,
+			Message:          t.Message,
+			StartTimestampNS: t.StartedAt.UnixNano(),
+			StopTimestampNS:  t.FinishedAt.UnixNano(),
+		}
 	}
 	return cPb
 }
@@ -413,6 +413,21 @@ start_timestamp_ns: 4
 stop_timestamp_ns: 6
 `
 
+const restartedContainerStatusPb = `
+name: "test_container"
+container_id: "test_id"
+container_state: 1
+start_timestamp_ns: 8
+restart_count: 1
+ready: true
+last_termination {
+	exit_code: 137
+	reason: "OOMKilled"
+	start_timestamp_ns: 4
+	stop_timestamp_ns: 6
+}
+`
+
 const nodePb = `
 metadata {
 	name: "some_node"
@@ -1555,6 +1570,36 @@ func TestContainerStatusToProtoTerminated(t *testing.T) {
 	assert.Equal(t, expectedPb, oPb)
 }
 
+func TestContainerStatusToProtoRestarted(t *testing.T) {
+	o := v1.ContainerStatus{
+		Name:        "test_container",
+		ContainerID: "test_id",
+		State: v1.ContainerState{
+			Running: &v1.ContainerStateRunning{
+				StartedAt: metav1.Unix(0, 8),
+			},
+		},
+		LastTerminationState: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{
+				ExitCode:   137,
+				Reason:     "OOMKilled",
+				StartedAt:  metav1.Unix(0, 4),
+				FinishedAt: metav1.Unix(0, 6),
+			},
+		},
+		Ready:        true,
+		RestartCount: 1,
+	}
+
+	oPb := k8s.ContainerStatusToProto(&o)
+
+	expectedPb := &metadatapb.ContainerStatus{}
+	if err := proto.UnmarshalText(restartedContainerStatusPb, expectedPb); err != nil {
+		t.Fatal("Cannot Unmarshal protobuf.")
+	}
+	assert.Equal(t, expectedPb, oPb)
+}
+
 func TestNodeToProto(t *testing.T) {
 	oRefs := []metav1.OwnerReference{
 		{
@@ -329,6 +329,11 @@ class PodInfo : public K8sMetadataObject {
   const std::string& pod_ip() const { return pod_ip_; }
   const std::string& labels() const { return labels_; }
 
+  // The top-level workload that manages this pod, as resolved by the metadata service.
+  // Has an empty UID if the pod has no owners.
+  const OwnerReference& workload() const { return workload_; }
+  void set_workload(OwnerReference workload) { workload_ = std::move(workload); }
+
   const absl::flat_hash_set<std::string>& containers() const { return containers_; }
   const absl::flat_hash_set<std::string>& services() const { return services_; }
 
@@ -368,6 +373,7 @@ class PodInfo : public K8sMetadataObject {
   std::string hostname_;
   std::string pod_ip_;
   std::string labels_;
+  OwnerReference workload_;
 };
 
 struct UPIDStartTSCompare {
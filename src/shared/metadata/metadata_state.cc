@@ -281,6 +281,8 @@ Status K8sMetadataState::HandlePodUpdate(const PodUpdate& update) {
   for (const auto& owner_ref : update.owner_references()) {
     pod_info->AddOwnerReference(owner_ref.uid(), owner_ref.name(), owner_ref.kind());
   }
+  pod_info->set_workload(
+      OwnerReference{update.workload().uid(), update.workload().name(), update.workload().kind()});
 
   pod_info->set_start_time_ns(update.start_timestamp_ns());
   pod_info->set_stop_time_ns(update.stop_timestamp_ns());
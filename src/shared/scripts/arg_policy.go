@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scripts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArgPolicy is an org's default and bounds for the value of a script argument.
+type ArgPolicy struct {
+	ArgName string
+	// DefaultValue is used when the argument is left empty. Empty if the argument has no default.
+	DefaultValue string
+	// MaxLookback is how far a start time argument may look back. Zero if the argument is unbounded.
+	MaxLookback time.Duration
+	// ForbiddenValues are the values that the argument may not have.
+	ForbiddenValues []string
+}
+
+// ParseTimeArg parses the value of a time argument of a script, such as start_time. The value is
+// either relative to now, like "-5m" or "-1d", an RFC3339 timestamp, or a unix timestamp in nanoseconds.
+func ParseTimeArg(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if ns, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ns), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if !strings.HasPrefix(value, "-") {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	offset := strings.TrimPrefix(value, "-")
+	if days := strings.TrimSuffix(offset, "d"); days != offset {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", value)
+		}
+		return now.Add(-time.Duration(n * float64(24*time.Hour))), nil
+	}
+	d, err := time.ParseDuration(offset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return now.Add(-d), nil
+}
+
+// CheckValue returns an error if the policy doesn't allow the value of the argument.
+func (p *ArgPolicy) CheckValue(value string, now time.Time) error {
+	for _, v := range p.ForbiddenValues {
+		if value == v {
+			return fmt.Errorf("%s may not be %q", p.ArgName, value)
+		}
+	}
+	if p.MaxLookback <= 0 {
+		return nil
+	}
+	t, err := ParseTimeArg(value, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.ArgName, err)
+	}
+	if now.Sub(t) > p.MaxLookback {
+		return fmt.Errorf("%s may not look back more than %s", p.ArgName, p.MaxLookback)
+	}
+	return nil
+}
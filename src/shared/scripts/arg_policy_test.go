@@ -0,0 +1,70 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scripts_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/scripts"
+)
+
+func TestParseTimeArg(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{value: "-5m", expected: now.Add(-5 * time.Minute)},
+		{value: "-1h30m", expected: now.Add(-90 * time.Minute)},
+		{value: "-2d", expected: now.Add(-48 * time.Hour)},
+		{value: "2023-01-01T00:00:00Z", expected: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "1672531200000000000", expected: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "yesterday", wantErr: true},
+		{value: "-5x", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			parsed, err := scripts.ParseTimeArg(test.value, now)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, test.expected.Equal(parsed), "expected %v, got %v", test.expected, parsed)
+		})
+	}
+}
+
+func TestArgPolicy_CheckValue(t *testing.T) {
+	now := time.Now()
+	startTime := &scripts.ArgPolicy{ArgName: "start_time", MaxLookback: time.Hour}
+	assert.NoError(t, startTime.CheckValue("-5m", now))
+	assert.NoError(t, startTime.CheckValue("-1h", now))
+	assert.Error(t, startTime.CheckValue("-2h", now))
+	assert.Error(t, startTime.CheckValue("not a time", now))
+
+	namespace := &scripts.ArgPolicy{ArgName: "namespace", ForbiddenValues: []string{"kube-system"}}
+	assert.NoError(t, namespace.CheckValue("default", now))
+	assert.Error(t, namespace.CheckValue("kube-system", now))
+}
@@ -21,6 +21,8 @@ package scripts
 // Config represents the configuration for a script. For example: which variables should be pulled in and how.
 type Config struct {
 	OtelEndpointConfig *OtelEndpointConfig `yaml:"otelEndpointConfig"`
+	WebhookConfig      *WebhookConfig      `yaml:"webhookConfig,omitempty"`
+	ActionsConfig      *ActionsConfig      `yaml:"actionsConfig,omitempty"`
 }
 
 // OtelEndpointConfig specifies values that should be filled in for all OTel endpoints in the script.
@@ -29,3 +31,24 @@ type OtelEndpointConfig struct {
 	Headers  map[string]string `yaml:"headers"`
 	Insecure bool              `yaml:"insecure"`
 }
+
+// WebhookConfig specifies an HTTP endpoint that the results of the script should be POSTed to.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// PayloadTemplate is a text/template which renders each batch of rows into the JSON body of a
+	// request. If empty, DefaultWebhookPayloadTemplate is used.
+	PayloadTemplate string `yaml:"payloadTemplate,omitempty"`
+	// BatchSize is the maximum number of rows sent in each request.
+	BatchSize int `yaml:"batchSize,omitempty"`
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int `yaml:"maxRetries,omitempty"`
+}
+
+// ActionsConfig specifies a table of the script whose rows request Kubernetes actions, such as deleting
+// a pod. The requests are only executed if the actions policy of the Vizier allows them.
+type ActionsConfig struct {
+	// Table is the name of the output table. Its rows need type, namespace and name columns, and may
+	// have kind, replicas, annotations (a JSON object) and reason columns.
+	Table string `yaml:"table"`
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scripts
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FuncArgTypes returns the type annotations of the arguments of a function that is defined in a PxL script, by
+// argument name. For example, the types of `def pods(start_time: str, pod: px.Pod)` are "str" and "px.Pod".
+// Arguments without an annotation are left out, and nil is returned if the script doesn't define the function.
+func FuncArgTypes(script string, funcName string) map[string]string {
+	def := regexp.MustCompile(`(?m)^def\s+` + regexp.QuoteMeta(funcName) + `\s*\(`)
+	loc := def.FindStringIndex(script)
+	if loc == nil {
+		return nil
+	}
+
+	// Split the arguments on the commas that aren't nested in a default value, like a list, a call or a string.
+	var args []string
+	var arg strings.Builder
+	depth := 0
+	for i := loc[1]; i < len(script); i++ {
+		c := script[i]
+		switch c {
+		case '#':
+			// Comments are dropped, up to the end of the line.
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				return nil
+			}
+			i += end
+			continue
+		case '"', '\'':
+			end := strings.IndexByte(script[i+1:], c)
+			if end < 0 {
+				return nil
+			}
+			arg.WriteString(script[i : i+end+2])
+			i += end + 1
+			continue
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				return argTypes(append(args, arg.String()))
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, arg.String())
+				arg.Reset()
+				continue
+			}
+		}
+		arg.WriteByte(c)
+	}
+	// The signature isn't closed, so the script doesn't compile anyway.
+	return nil
+}
+
+func argTypes(args []string) map[string]string {
+	types := make(map[string]string)
+	for _, arg := range args {
+		if i := strings.Index(arg, "="); i >= 0 {
+			arg = arg[:i]
+		}
+		name, typ, ok := strings.Cut(arg, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "*") {
+			continue
+		}
+		types[name] = strings.TrimSpace(typ)
+	}
+	return types
+}
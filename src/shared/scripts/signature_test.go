@@ -0,0 +1,74 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scripts_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"px.dev/pixie/src/shared/scripts"
+)
+
+const testPxL = `
+import px
+
+def pod_stats(pod: px.Pod):
+    return px.DataFrame('process_stats')
+
+def pods(start_time: str, namespace: px.Namespace,
+         node: px.Node = '',  # The node, as (name).
+         columns: list = ['pod', 'ns'], match=px.contains('a, b'), *rest):
+    df = px.DataFrame('process_stats', start_time=start_time)
+    return df
+`
+
+func TestFuncArgTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		funcName string
+		expected map[string]string
+	}{
+		{
+			name:     "single line",
+			funcName: "pod_stats",
+			expected: map[string]string{"pod": "px.Pod"},
+		},
+		{
+			name:     "multi line with defaults and comments",
+			funcName: "pods",
+			expected: map[string]string{
+				"start_time": "str",
+				"namespace":  "px.Namespace",
+				"node":       "px.Node",
+				"columns":    "list",
+			},
+		},
+		{
+			name:     "missing func",
+			funcName: "pod",
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, scripts.FuncArgTypes(testPxL, test.funcName))
+		})
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package scripts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"text/template"
+)
+
+// DefaultWebhookPayloadTemplate is the payload template of webhooks that don't specify one.
+const DefaultWebhookPayloadTemplate = `{"script_id": {{json .ScriptID}}, "batch_id": {{json .BatchID}}, "table": {{json .Table}}, "rows": {{json .Rows}}}`
+
+// WebhookPayload is the data that webhook payload templates are executed with.
+type WebhookPayload struct {
+	// ScriptID is the ID of the cron script that produced the rows.
+	ScriptID string
+	// BatchID is the ID of the run of the script that produced the rows.
+	BatchID string
+	// Table is the name of the table that the rows belong to.
+	Table string
+	// Rows are the rows of the batch, keyed by column name.
+	Rows []map[string]interface{}
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParseWebhookPayloadTemplate parses a webhook payload template. An empty template parses to
+// DefaultWebhookPayloadTemplate.
+func ParseWebhookPayloadTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultWebhookPayloadTemplate
+	}
+	return template.New("payload").Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// RenderWebhookPayload executes the payload template, and checks that it rendered valid JSON.
+func RenderWebhookPayload(tmpl *template.Template, payload *WebhookPayload) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, payload)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("webhook payload template did not render valid JSON")
+	}
+	return buf.Bytes(), nil
+}
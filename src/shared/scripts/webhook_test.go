@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package scripts_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/scripts"
+)
+
+func TestRenderWebhookPayload(t *testing.T) {
+	payload := &scripts.WebhookPayload{
+		ScriptID: "223e4567-e89b-12d3-a456-426655440000",
+		BatchID:  "323e4567-e89b-12d3-a456-426655440000",
+		Table:    "http_events",
+		Rows: []map[string]interface{}{
+			{"service": "frontend", "latency_ns": 123},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "default template",
+			expected: `{"script_id": "223e4567-e89b-12d3-a456-426655440000", "batch_id": "323e4567-e89b-12d3-a456-426655440000", "table": "http_events", "rows": [{"latency_ns": 123, "service": "frontend"}]}`,
+		},
+		{
+			name:     "custom template",
+			template: `{"source": "pixie", "events": {{json .Rows}}, "count": {{len .Rows}}}`,
+			expected: `{"source": "pixie", "events": [{"latency_ns": 123, "service": "frontend"}], "count": 1}`,
+		},
+		{
+			name:        "invalid JSON",
+			template:    `{"table": {{.Table}}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "unknown field",
+			template:    `{{json .Unknown}}`,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := scripts.ParseWebhookPayloadTemplate(test.template)
+			require.NoError(t, err)
+			body, err := scripts.RenderWebhookPayload(tmpl, payload)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(body))
+			assert.True(t, json.Valid(body))
+		})
+	}
+}
+
+func TestParseWebhookPayloadTemplate_Invalid(t *testing.T) {
+	_, err := scripts.ParseWebhookPayloadTemplate(`{{json .Rows}`)
+	require.Error(t, err)
+}
@@ -39,6 +39,9 @@ type AuthContext struct {
 	AuthToken string
 	Claims    *jwtpb.JWTClaims
 	Path      string
+	// PeerIdentity is the identity of the calling workload, as attested by the service mesh. It is only
+	// set when TLS is delegated to the mesh.
+	PeerIdentity string
 }
 
 // New creates a new sesion context.
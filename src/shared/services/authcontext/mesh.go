@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package authcontext
+
+import (
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// XFCCHeader is the header in which Envoy based meshes, such as Istio, forward the client certificate.
+	XFCCHeader = "x-forwarded-client-cert"
+	// LinkerdClientIDHeader is the header in which Linkerd forwards the identity of the client.
+	LinkerdClientIDHeader = "l5d-client-id"
+)
+
+// splitUnquoted splits s on sep, except where sep is inside a quoted value.
+func splitUnquoted(s string, sep rune) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ParseXFCC returns the identity of the client in an XFCC header, which is the URI SAN of its certificate
+// (e.g. spiffe://cluster.local/ns/pl/sv/vizier-query-broker). Each proxy that the request went through
+// appends an element to the header, so the last element is the one for the immediate client.
+func ParseXFCC(header string) string {
+	if header == "" {
+		return ""
+	}
+	elements := splitUnquoted(header, ',')
+	for _, pair := range splitUnquoted(elements[len(elements)-1], ';') {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(kv[0], "URI") {
+			continue
+		}
+		return strings.Trim(kv[1], `"`)
+	}
+	return ""
+}
+
+func meshPeerIdentity(xfcc string, linkerdClientID string) string {
+	if id := ParseXFCC(xfcc); id != "" {
+		return id
+	}
+	return linkerdClientID
+}
+
+// PeerIdentityFromMD returns the identity of the client that the mesh forwarded in the GRPC metadata.
+// The headers can be set by anyone, so they must only be trusted when the mesh sanitizes them.
+func PeerIdentityFromMD(md metadata.MD) string {
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	return meshPeerIdentity(first(XFCCHeader), first(LinkerdClientIDHeader))
+}
+
+// PeerIdentityFromHeader returns the identity of the client that the mesh forwarded in the HTTP headers.
+// The headers can be set by anyone, so they must only be trusted when the mesh sanitizes them.
+func PeerIdentityFromHeader(h http.Header) string {
+	return meshPeerIdentity(h.Get(XFCCHeader), h.Get(LinkerdClientIDHeader))
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package authcontext_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+
+	"px.dev/pixie/src/shared/services/authcontext"
+)
+
+func TestParseXFCC(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{
+			name:     "empty",
+			header:   "",
+			expected: "",
+		},
+		{
+			name:     "single element",
+			header:   `By=spiffe://cluster.local/ns/pl/sa/metadata;Hash=abcd;Subject="";URI=spiffe://cluster.local/ns/pl/sa/query-broker`,
+			expected: "spiffe://cluster.local/ns/pl/sa/query-broker",
+		},
+		{
+			name:     "uses the immediate client",
+			header:   `By=spiffe://a;URI=spiffe://cluster.local/ns/pl/sa/proxy,By=spiffe://b;Subject="CN=x,O=y";URI=spiffe://cluster.local/ns/pl/sa/kelvin`,
+			expected: "spiffe://cluster.local/ns/pl/sa/kelvin",
+		},
+		{
+			name:     "quoted URI",
+			header:   `Hash=abcd;URI="spiffe://cluster.local/ns/pl/sa/pem"`,
+			expected: "spiffe://cluster.local/ns/pl/sa/pem",
+		},
+		{
+			name:     "no URI",
+			header:   `Hash=abcd;DNS=pem.pl.svc`,
+			expected: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, authcontext.ParseXFCC(test.header))
+		})
+	}
+}
+
+func TestPeerIdentity(t *testing.T) {
+	md := metadata.Pairs(authcontext.XFCCHeader, "Hash=abcd;URI=spiffe://cluster.local/ns/pl/sa/pem")
+	assert.Equal(t, "spiffe://cluster.local/ns/pl/sa/pem", authcontext.PeerIdentityFromMD(md))
+
+	md = metadata.Pairs(authcontext.LinkerdClientIDHeader, "pem.pl.serviceaccount.identity.linkerd.cluster.local")
+	assert.Equal(t, "pem.pl.serviceaccount.identity.linkerd.cluster.local", authcontext.PeerIdentityFromMD(md))
+
+	h := http.Header{}
+	h.Set(authcontext.LinkerdClientIDHeader, "pem.pl.serviceaccount.identity.linkerd.cluster.local")
+	assert.Equal(t, "pem.pl.serviceaccount.identity.linkerd.cluster.local", authcontext.PeerIdentityFromHeader(h))
+	assert.Equal(t, "", authcontext.PeerIdentityFromHeader(http.Header{}))
+}
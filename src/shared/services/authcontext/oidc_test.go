@@ -0,0 +1,154 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package authcontext_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/utils"
+)
+
+func setupOIDCProvider(t *testing.T) (jwk.Key, string) {
+	rawKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privKey, err := jwk.New(rawKey)
+	require.NoError(t, err)
+	require.NoError(t, privKey.Set(jwk.KeyIDKey, "test-key"))
+	require.NoError(t, privKey.Set(jwk.AlgorithmKey, jwa.RS256))
+
+	pubKey, err := privKey.PublicKey()
+	require.NoError(t, err)
+	set := jwk.NewSet()
+	set.Add(pubKey)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(set))
+	}))
+	t.Cleanup(srv.Close)
+	return privKey, srv.URL
+}
+
+func signOIDCToken(t *testing.T, key jwk.Key, issuer string, expiresAt time.Time) string {
+	token, err := jwt.NewBuilder().
+		Issuer(issuer).
+		Audience([]string{"withpixie.ai"}).
+		Subject("svc-account").
+		IssuedAt(time.Now()).
+		Expiration(expiresAt).
+		Claim("client_id", "vzmgr").
+		Claim("scope", "read write").
+		Build()
+	require.NoError(t, err)
+	signed, err := jwt.Sign(token, jwa.RS256, key)
+	require.NoError(t, err)
+	return string(signed)
+}
+
+func TestSessionCtx_UseOIDCAuth(t *testing.T) {
+	key, jwksURL := setupOIDCProvider(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := authcontext.NewOIDCVerifier(ctx, "https://issuer.test", jwksURL, "withpixie.ai")
+	require.NoError(t, err)
+
+	sCtx := authcontext.New()
+	token := signOIDCToken(t, key, "https://issuer.test", time.Now().Add(time.Hour))
+	require.NoError(t, sCtx.UseOIDCAuth(ctx, verifier, token))
+
+	assert.Equal(t, utils.ServiceClaimType, utils.GetClaimsType(sCtx.Claims))
+	assert.Equal(t, "vzmgr", sCtx.Claims.GetServiceClaims().ServiceID)
+	assert.Equal(t, []string{"read", "write"}, sCtx.Claims.Scopes)
+	assert.True(t, sCtx.ValidClaims())
+}
+
+func TestSessionCtx_UseOIDCAuth_Invalid(t *testing.T) {
+	key, jwksURL := setupOIDCProvider(t)
+	otherKey, _ := setupOIDCProvider(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := authcontext.NewOIDCVerifier(ctx, "https://issuer.test", jwksURL, "withpixie.ai")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "wrong issuer",
+			token: signOIDCToken(t, key, "https://other.test", time.Now().Add(time.Hour)),
+		},
+		{
+			name:  "expired",
+			token: signOIDCToken(t, key, "https://issuer.test", time.Now().Add(-time.Hour)),
+		},
+		{
+			name:  "unknown key",
+			token: signOIDCToken(t, otherKey, "https://issuer.test", time.Now().Add(time.Hour)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sCtx := authcontext.New()
+			assert.Error(t, sCtx.UseOIDCAuth(ctx, verifier, test.token))
+			assert.Nil(t, sCtx.Claims)
+		})
+	}
+}
+
+func TestSessionCtx_UseOIDCAuth_WrongAudience(t *testing.T) {
+	key, jwksURL := setupOIDCProvider(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := authcontext.NewOIDCVerifier(ctx, "https://issuer.test", jwksURL, "other.app")
+	require.NoError(t, err)
+
+	sCtx := authcontext.New()
+	assert.Error(t, sCtx.UseOIDCAuth(ctx, verifier, signOIDCToken(t, key, "https://issuer.test", time.Now().Add(time.Hour))))
+	assert.Nil(t, sCtx.Claims)
+}
+
+func TestNewOIDCVerifier_RequiresIssuerAndAudience(t *testing.T) {
+	_, jwksURL := setupOIDCProvider(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := authcontext.NewOIDCVerifier(ctx, "", jwksURL, "withpixie.ai")
+	assert.Error(t, err)
+	_, err = authcontext.NewOIDCVerifier(ctx, "https://issuer.test", jwksURL, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package channelz exposes GRPC's channelz data, which tracks the state of every GRPC channel, subchannel and
+// server in the process. Importing this package turns channelz on for the whole process, so the client
+// connections set up with the shared dial options are tracked as well.
+package channelz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/channelz/service"
+
+	"px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/httpmiddleware"
+)
+
+// maxRecentErrors is the maximum number of recent errors that are reported per channel.
+const maxRecentErrors = 5
+
+// captureRegistrar captures the channelz service implementation, so that it can be queried in-process.
+type captureRegistrar struct {
+	desc *grpc.ServiceDesc
+	impl interface{}
+}
+
+func (c *captureRegistrar) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	c.desc = desc
+	c.impl = impl
+}
+
+var registrar = func() *captureRegistrar {
+	c := &captureRegistrar{}
+	service.RegisterChannelzServiceToServer(c)
+	return c
+}()
+
+func server() channelzpb.ChannelzServer {
+	return registrar.impl.(channelzpb.ChannelzServer)
+}
+
+// Register registers the channelz GRPC service to the given server. The service is subject to the server's
+// auth, like any other GRPC service.
+func Register(s grpc.ServiceRegistrar) {
+	s.RegisterService(registrar.desc, registrar.impl)
+}
+
+// Summary summarizes the connection state of the process.
+type Summary struct {
+	Channels []*ChannelSummary `json:"channels"`
+	Servers  []*ServerSummary  `json:"servers"`
+}
+
+// CallCounts are the RPC counts for a channel, subchannel or server.
+type CallCounts struct {
+	Started         int64      `json:"started"`
+	Succeeded       int64      `json:"succeeded"`
+	Failed          int64      `json:"failed"`
+	LastCallStarted *time.Time `json:"lastCallStarted,omitempty"`
+}
+
+// ChannelSummary summarizes a client channel, i.e. a connection to a single target.
+type ChannelSummary struct {
+	ID           int64                `json:"id"`
+	Target       string               `json:"target"`
+	State        string               `json:"state"`
+	Calls        CallCounts           `json:"calls"`
+	Subchannels  []*SubchannelSummary `json:"subchannels"`
+	RecentErrors []*Event             `json:"recentErrors,omitempty"`
+}
+
+// SubchannelSummary summarizes a subchannel, i.e. the connection to one of the resolved addresses of a target.
+type SubchannelSummary struct {
+	ID           int64      `json:"id"`
+	State        string     `json:"state"`
+	Addresses    []string   `json:"addresses"`
+	Calls        CallCounts `json:"calls"`
+	RecentErrors []*Event   `json:"recentErrors,omitempty"`
+}
+
+// ServerSummary summarizes a GRPC server.
+type ServerSummary struct {
+	ID    int64      `json:"id"`
+	Calls CallCounts `json:"calls"`
+}
+
+// Event is a channel trace event.
+type Event struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Severity    string    `json:"severity"`
+	Description string    `json:"description"`
+}
+
+func callCounts(started, succeeded, failed int64, last interface{ AsTime() time.Time }) CallCounts {
+	c := CallCounts{Started: started, Succeeded: succeeded, Failed: failed}
+	if started > 0 && last != nil {
+		t := last.AsTime()
+		c.LastCallStarted = &t
+	}
+	return c
+}
+
+func recentErrors(trace *channelzpb.ChannelTrace) []*Event {
+	var events []*Event
+	for _, e := range trace.GetEvents() {
+		if e.Severity != channelzpb.ChannelTraceEvent_CT_WARNING && e.Severity != channelzpb.ChannelTraceEvent_CT_ERROR {
+			continue
+		}
+		events = append(events, &Event{
+			Timestamp:   e.Timestamp.AsTime(),
+			Severity:    e.Severity.String(),
+			Description: e.Description,
+		})
+	}
+	if len(events) > maxRecentErrors {
+		events = events[len(events)-maxRecentErrors:]
+	}
+	return events
+}
+
+func formatAddress(a *channelzpb.Address) string {
+	switch addr := a.GetAddress().(type) {
+	case *channelzpb.Address_TcpipAddress:
+		return net.JoinHostPort(net.IP(addr.TcpipAddress.IpAddress).String(), fmt.Sprint(addr.TcpipAddress.Port))
+	case *channelzpb.Address_UdsAddress_:
+		return addr.UdsAddress.Filename
+	case *channelzpb.Address_OtherAddress_:
+		return addr.OtherAddress.Name
+	}
+	return ""
+}
+
+func summarizeSubchannel(ctx context.Context, id int64) (*SubchannelSummary, error) {
+	resp, err := server().GetSubchannel(ctx, &channelzpb.GetSubchannelRequest{SubchannelId: id})
+	if err != nil {
+		return nil, err
+	}
+	data := resp.Subchannel.GetData()
+	s := &SubchannelSummary{
+		ID:           id,
+		State:        data.GetState().GetState().String(),
+		Calls:        callCounts(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed(), data.GetLastCallStartedTimestamp()),
+		RecentErrors: recentErrors(data.GetTrace()),
+		Addresses:    []string{},
+	}
+	for _, ref := range resp.Subchannel.GetSocketRef() {
+		sock, err := server().GetSocket(ctx, &channelzpb.GetSocketRequest{SocketId: ref.SocketId})
+		if err != nil {
+			// The socket may have been closed since the subchannel was fetched.
+			continue
+		}
+		if addr := formatAddress(sock.Socket.GetRemote()); addr != "" {
+			s.Addresses = append(s.Addresses, addr)
+		}
+	}
+	return s, nil
+}
+
+// Summarize returns a summary of all of the GRPC channels and servers in the process.
+func Summarize(ctx context.Context) (*Summary, error) {
+	summary := &Summary{
+		Channels: []*ChannelSummary{},
+		Servers:  []*ServerSummary{},
+	}
+
+	startID := int64(0)
+	for {
+		resp, err := server().GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: startID})
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range resp.Channel {
+			data := ch.GetData()
+			c := &ChannelSummary{
+				ID:           ch.Ref.ChannelId,
+				Target:       data.GetTarget(),
+				State:        data.GetState().GetState().String(),
+				Calls:        callCounts(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed(), data.GetLastCallStartedTimestamp()),
+				RecentErrors: recentErrors(data.GetTrace()),
+				Subchannels:  []*SubchannelSummary{},
+			}
+			for _, ref := range ch.SubchannelRef {
+				sc, err := summarizeSubchannel(ctx, ref.SubchannelId)
+				if err != nil {
+					// The subchannel may have been removed since the channel was fetched.
+					continue
+				}
+				c.Subchannels = append(c.Subchannels, sc)
+			}
+			summary.Channels = append(summary.Channels, c)
+			startID = ch.Ref.ChannelId + 1
+		}
+		if resp.End || len(resp.Channel) == 0 {
+			break
+		}
+	}
+
+	startID = 0
+	for {
+		resp, err := server().GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: startID})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Server {
+			data := s.GetData()
+			summary.Servers = append(summary.Servers, &ServerSummary{
+				ID:    s.Ref.ServerId,
+				Calls: callCounts(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed(), data.GetLastCallStartedTimestamp()),
+			})
+			startID = s.Ref.ServerId + 1
+		}
+		if resp.End || len(resp.Server) == 0 {
+			break
+		}
+	}
+
+	return summary, nil
+}
+
+// mux is an interface describing the methods InstallPathHandler requires.
+type mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// InstallPathHandler registers a JSON view of the connection summary under path. Requests must have
+// a valid bearer token.
+func InstallPathHandler(mux mux, path string, env env.Env) {
+	mux.Handle(path, Handler(env))
+}
+
+// Handler returns the authenticated HTTP handler that serves the connection summary as JSON.
+func Handler(env env.Env) http.Handler {
+	return httpmiddleware.WithBearerAuthMiddleware(env, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		summary, err := Summarize(r.Context())
+		if err != nil {
+			log.WithError(err).Error("Failed to summarize channelz data")
+			http.Error(w, "failed to get channelz data", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			log.WithError(err).Error("Failed to write channelz summary")
+		}
+	}))
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package channelz_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"px.dev/pixie/src/shared/services/channelz"
+	"px.dev/pixie/src/shared/services/env"
+	ping "px.dev/pixie/src/shared/services/testproto"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+type testserver struct {
+	ping.UnimplementedPingServiceServer
+}
+
+func (s *testserver) Ping(ctx context.Context, in *ping.PingRequest) (*ping.PingReply, error) {
+	return &ping.PingReply{Reply: "test reply"}, nil
+}
+
+func startPingServer(t *testing.T) (string, ping.PingServiceClient) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	ping.RegisterPingServiceServer(s, &testserver{})
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return lis.Addr().String(), ping.NewPingServiceClient(conn)
+}
+
+func TestSummarize(t *testing.T) {
+	addr, client := startPingServer(t)
+	_, err := client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+
+	summary, err := channelz.Summarize(context.Background())
+	require.NoError(t, err)
+
+	var ch *channelz.ChannelSummary
+	for _, c := range summary.Channels {
+		if c.Target == addr {
+			ch = c
+		}
+	}
+	require.NotNil(t, ch)
+	assert.Equal(t, "READY", ch.State)
+	assert.Equal(t, int64(1), ch.Calls.Started)
+	assert.Equal(t, int64(1), ch.Calls.Succeeded)
+	assert.NotNil(t, ch.Calls.LastCallStarted)
+	require.Len(t, ch.Subchannels, 1)
+	assert.Equal(t, "READY", ch.Subchannels[0].State)
+	assert.Equal(t, []string{addr}, ch.Subchannels[0].Addresses)
+
+	require.NotEmpty(t, summary.Servers)
+}
+
+func TestHandler(t *testing.T) {
+	viper.Set("jwt_signing_key", "jwt-key")
+	defer viper.Set("jwt_signing_key", "")
+	addr, _ := startPingServer(t)
+
+	mux := http.NewServeMux()
+	channelz.InstallPathHandler(mux, "/debug/channelz", env.New("withpixie.ai"))
+
+	req := httptest.NewRequest("GET", "/debug/channelz", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest("GET", "/debug/channelz", nil)
+	req.Header.Set("Authorization", "Bearer "+testingutils.GenerateTestJWTToken(t, "jwt-key"))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	summary := &channelz.Summary{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), summary))
+	targets := []string{}
+	for _, c := range summary.Channels {
+		targets = append(targets, c.Target)
+	}
+	assert.Contains(t, targets, addr)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package clock
+
+import (
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// NewExponentialBackOff creates an exponential backoff whose elapsed time is measured with the given clock.
+func NewExponentialBackOff(c Clock) *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.Clock = c
+	b.Reset()
+	return b
+}
+
+// backoffTimer adapts a Clock to the backoff.Timer interface.
+type backoffTimer struct {
+	clock Clock
+	timer Timer
+}
+
+// NewBackoffTimer returns a backoff.Timer, for use with backoff.RetryNotifyWithTimer, which waits on the given clock.
+func NewBackoffTimer(c Clock) backoff.Timer {
+	return &backoffTimer{clock: c}
+}
+
+func (t *backoffTimer) Start(d time.Duration) {
+	if t.timer == nil {
+		t.timer = t.clock.NewTimer(d)
+		return
+	}
+	t.timer.Reset(d)
+}
+
+func (t *backoffTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *backoffTimer) C() <-chan time.Time {
+	return t.timer.C()
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock whose time only moves when Advance is called. Timers and tickers
+// fire synchronously as the clock is advanced past their deadline.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	// period is non-zero for tickers.
+	period time.Duration
+	ch     chan time.Time
+	active bool
+}
+
+// NewFakeClock creates a fake clock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the fake time elapsed since t.
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After returns a channel which receives the fake time once d has elapsed.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// NewTimer creates a timer which fires once the clock has been advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.addWaiter(d, 0)
+}
+
+// NewTicker creates a ticker which fires each time the clock is advanced by d.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return &fakeTicker{c.addWaiter(d, d)}
+}
+
+func (c *FakeClock) addWaiter(d time.Duration, period time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{
+		clock:    c,
+		deadline: c.now.Add(d),
+		period:   period,
+		ch:       make(chan time.Time, 1),
+		active:   true,
+	}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return w
+}
+
+// Advance moves the clock forward by d, firing any timers and tickers whose deadline has passed.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool {
+			return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+		})
+		if len(c.waiters) == 0 || c.waiters[0].deadline.After(end) {
+			break
+		}
+		w := c.waiters[0]
+		c.now = w.deadline
+		// Like time.Ticker, drop ticks if the receiver isn't keeping up.
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+		} else {
+			c.removeLocked(w)
+		}
+	}
+	c.now = end
+}
+
+// BlockUntil blocks until at least n timers or tickers are waiting on the clock. This is
+// useful to make sure a goroutine has set up its ticker before advancing the clock.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) removeLocked(w *fakeWaiter) bool {
+	if !w.active {
+		return false
+	}
+	w.active = false
+	for i, o := range c.waiters {
+		if o == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	c.cond.Broadcast()
+	return true
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.removeLocked(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasActive := c.removeLocked(w)
+	w.deadline = c.now.Add(d)
+	if w.period > 0 {
+		w.period = d
+	}
+	w.active = true
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return wasActive
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t *fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	t.fakeWaiter.Reset(d)
+}
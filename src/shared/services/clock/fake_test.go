@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"px.dev/pixie/src/shared/services/clock"
+)
+
+func TestFakeClock_Timer(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := clock.NewFakeClock(start)
+
+	timer := c.NewTimer(10 * time.Second)
+	c.Advance(9 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(10*time.Second), <-timer.C())
+	assert.False(t, timer.Stop())
+}
+
+func TestFakeClock_TimerStopAndReset(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(1000, 0))
+
+	timer := c.NewTimer(time.Second)
+	assert.True(t, timer.Stop())
+	c.Advance(time.Minute)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	assert.False(t, timer.Reset(time.Second))
+	c.Advance(time.Second)
+	<-timer.C()
+}
+
+func TestFakeClock_Ticker(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := clock.NewFakeClock(start)
+
+	ticker := c.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for i := 1; i <= 3; i++ {
+		c.Advance(time.Minute)
+		assert.Equal(t, start.Add(time.Duration(i)*time.Minute), <-ticker.C())
+	}
+	assert.Equal(t, start.Add(3*time.Minute), c.Now())
+}
+
+func TestFakeClock_BlockUntil(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(1000, 0))
+
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Hour)
+		close(done)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	<-done
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultEnvPrefix = "PL"
+	// nestedKeyEnvDelimiter replaces the "." in nested keys when looking up env vars,
+	// so the key "auth.oidc.issuer" is read from PL_AUTH__OIDC__ISSUER.
+	nestedKeyEnvDelimiter = "__"
+	redactedValue         = "<redacted>"
+)
+
+var (
+	envPrefix = defaultEnvPrefix
+	// Keys containing any of these substrings have their values masked in the config dump. This errs on the
+	// side of masking, since "key" also matches flags that only hold the paths of keys.
+	secretKeySubstrings = []string{"secret", "password", "passwd", "token", "key", "private", "credential", "dsn"}
+)
+
+// SetEnvPrefix sets the prefix used to look up flag values in the environment. It must be
+// called before PostFlagSetupAndParse. Defaults to "PL".
+func SetEnvPrefix(prefix string) {
+	envPrefix = prefix
+}
+
+// EnvPrefix returns the prefix used to look up flag values in the environment.
+func EnvPrefix() string {
+	return envPrefix
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeySubstrings {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case []string:
+		return len(val) == 0
+	}
+	return false
+}
+
+// EffectiveConfig returns the fully resolved configuration of the service, after flags,
+// env vars and defaults have been applied. Values of secret keys are masked.
+func EffectiveConfig() map[string]interface{} {
+	cfg := make(map[string]interface{})
+	for _, key := range viper.AllKeys() {
+		val := viper.Get(key)
+		if isSecretKey(key) && !isEmptyValue(val) {
+			val = redactedValue
+		}
+		cfg[key] = val
+	}
+	return cfg
+}
+
+// LogEffectiveConfig logs the resolved configuration, one key per line.
+func LogEffectiveConfig() {
+	cfg := EffectiveConfig()
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	log.WithField("envPrefix", envPrefix).Info("Effective configuration:")
+	for _, k := range keys {
+		log.Infof("  %s=%v", k, cfg[k])
+	}
+}
+
+// ConfigDumpHandler returns an HTTP handler which responds with the resolved configuration as JSON.
+func ConfigDumpHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(EffectiveConfig()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
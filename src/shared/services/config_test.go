@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEffectiveConfig_NestedEnvKeys(t *testing.T) {
+	defer viper.Reset()
+	SetEnvPrefix("PX_TEST")
+	defer SetEnvPrefix(defaultEnvPrefix)
+
+	t.Setenv("PX_TEST_AUTH__OIDC__ISSUER", "https://issuer.test")
+	viper.SetDefault("auth.oidc.issuer", "")
+	viper.AutomaticEnv()
+	viper.SetEnvPrefix(EnvPrefix())
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", nestedKeyEnvDelimiter))
+
+	assert.Equal(t, "https://issuer.test", viper.GetString("auth.oidc.issuer"))
+	assert.Equal(t, "https://issuer.test", EffectiveConfig()["auth.oidc.issuer"])
+}
+
+func TestEffectiveConfig_MasksSecrets(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("jwt_signing_key", "abcd")
+	viper.Set("oidc_client_secret", "")
+	viper.Set("domain_name", "dev.withpixie.dev")
+
+	secretKeys := []string{
+		"database_key", "deploy_key", "api_key", "session_key", "es_passwd", "ld_sdk_key",
+		"segment_write_key", "client_key", "server_key",
+	}
+	for _, key := range secretKeys {
+		viper.Set(key, "abcd")
+	}
+
+	cfg := EffectiveConfig()
+	assert.Equal(t, redactedValue, cfg["jwt_signing_key"])
+	for _, key := range secretKeys {
+		assert.Equal(t, redactedValue, cfg[key], key)
+	}
+	// Empty secrets are shown so that missing config is easy to spot.
+	assert.Equal(t, "", cfg["oidc_client_secret"])
+	assert.Equal(t, "dev.withpixie.dev", cfg["domain_name"])
+}
+
+func TestConfigDumpHandler(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("client_tls_key", "/certs/client.key")
+	viper.Set("http2_port", 50000)
+
+	rec := httptest.NewRecorder()
+	ConfigDumpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	cfg := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cfg))
+	assert.Equal(t, redactedValue, cfg["client_tls_key"])
+	assert.Equal(t, float64(50000), cfg["http2_port"])
+}
@@ -0,0 +1,336 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package election
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	defaultLeaseDuration      = 15 * time.Second
+	defaultRenewDeadline      = 10 * time.Second
+	defaultRetryPeriod        = 2 * time.Second
+	defaultCheckpointInterval = 30 * time.Second
+	// The key of the handoff state in the state config map.
+	standbyStateKey = "state"
+	// The annotation on the state config map that records which replica wrote the state.
+	standbyHolderAnnotation = "px.dev/standby-holder"
+)
+
+// Role is the role of a replica of a warm-standby singleton.
+type Role int32
+
+const (
+	// RoleStandby is the role of the replicas that are ready to take over from the leader.
+	RoleStandby Role = iota
+	// RoleLeader is the role of the replica that runs the singleton.
+	RoleLeader
+)
+
+func (r Role) String() string {
+	if r == RoleLeader {
+		return "leader"
+	}
+	return "standby"
+}
+
+// Singleton is a component that must only run on one replica at a time. Replicas should do as much of their
+// setup as possible before running the WarmStandby, so that a standby can take over immediately.
+type Singleton interface {
+	// Promote starts the singleton on this replica. state is the last state checkpointed by the previous leader,
+	// or nil if there is none. ctx is canceled when this replica loses the lease.
+	Promote(ctx context.Context, state []byte) error
+	// Demote stops the singleton. It must only return once all of the work started by Promote has stopped.
+	Demote()
+	// Checkpoint returns the state to hand off to the next leader.
+	Checkpoint() ([]byte, error)
+}
+
+// WarmStandby runs a Singleton on the replica that holds a K8s lease, while the other replicas wait as warm
+// standbys. When the leader shuts down, it stops the singleton, checkpoints its state and releases the lease, so
+// that a standby takes over within one retry period instead of waiting for the lease to expire.
+type WarmStandby struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	id        string
+	singleton Singleton
+
+	leaseDuration      time.Duration
+	renewDeadline      time.Duration
+	retryPeriod        time.Duration
+	checkpointInterval time.Duration
+
+	role atomic.Int32
+
+	// mu serializes promotion, demotion and checkpoints.
+	mu       sync.Mutex
+	leading  bool
+	resigned bool
+}
+
+// StandbyOption configures a WarmStandby.
+type StandbyOption func(w *WarmStandby)
+
+// WithLeaseDurations sets the duration of the lease, the deadline for the leader to renew it and the period at
+// which standbys try to acquire it.
+func WithLeaseDurations(leaseDuration, renewDeadline, retryPeriod time.Duration) StandbyOption {
+	return func(w *WarmStandby) {
+		w.leaseDuration = leaseDuration
+		w.renewDeadline = renewDeadline
+		w.retryPeriod = retryPeriod
+	}
+}
+
+// WithCheckpointInterval sets how often the leader checkpoints its state.
+func WithCheckpointInterval(interval time.Duration) StandbyOption {
+	return func(w *WarmStandby) {
+		w.checkpointInterval = interval
+	}
+}
+
+// WithIdentity sets the identity of this replica. It defaults to the hostname, which is the pod name.
+func WithIdentity(id string) StandbyOption {
+	return func(w *WarmStandby) {
+		w.id = id
+	}
+}
+
+// NewWarmStandby creates a WarmStandby for the given singleton. The lease is named after the election, and the
+// handoff state is stored in the "<name>-state" config map, both in the given namespace.
+func NewWarmStandby(clientset kubernetes.Interface, namespace, name string, singleton Singleton, opts ...StandbyOption) (*WarmStandby, error) {
+	if namespace == "" {
+		return nil, errors.New("namespace must be specified for leader election")
+	}
+	w := &WarmStandby{
+		clientset:          clientset,
+		namespace:          namespace,
+		name:               name,
+		singleton:          singleton,
+		leaseDuration:      defaultLeaseDuration,
+		renewDeadline:      defaultRenewDeadline,
+		retryPeriod:        defaultRetryPeriod,
+		checkpointInterval: defaultCheckpointInterval,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		w.id = hostname
+	}
+	return w, nil
+}
+
+// Role returns the current role of this replica.
+func (w *WarmStandby) Role() Role {
+	return Role(w.role.Load())
+}
+
+func (w *WarmStandby) stateConfigMapName() string {
+	return w.name + "-state"
+}
+
+func (w *WarmStandby) loadState(ctx context.Context) ([]byte, error) {
+	cm, err := w.clientset.CoreV1().ConfigMaps(w.namespace).Get(ctx, w.stateConfigMapName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cm.BinaryData[standbyStateKey], nil
+}
+
+func (w *WarmStandby) saveState(ctx context.Context, state []byte) error {
+	cms := w.clientset.CoreV1().ConfigMaps(w.namespace)
+	cm, err := cms.Get(ctx, w.stateConfigMapName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = cms.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        w.stateConfigMapName(),
+				Annotations: map[string]string{standbyHolderAnnotation: w.id},
+			},
+			BinaryData: map[string][]byte{standbyStateKey: state},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	cm.Annotations[standbyHolderAnnotation] = w.id
+	cm.BinaryData = map[string][]byte{standbyStateKey: state}
+	_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// checkpoint saves the state of the singleton. It must be called with mu held.
+func (w *WarmStandby) checkpoint(ctx context.Context) {
+	state, err := w.singleton.Checkpoint()
+	if err != nil {
+		log.WithError(err).WithField("election", w.name).Error("Failed to checkpoint state")
+		return
+	}
+	if err := w.saveState(ctx, state); err != nil {
+		log.WithError(err).WithField("election", w.name).Error("Failed to save checkpointed state")
+	}
+}
+
+// promote runs the singleton for as long as this replica holds the lease.
+func (w *WarmStandby) promote(ctx context.Context, resign func()) {
+	state, err := w.loadState(ctx)
+	if err != nil {
+		log.WithError(err).WithField("election", w.name).Error("Failed to load handoff state, resigning")
+		resign()
+		return
+	}
+
+	w.mu.Lock()
+	if w.resigned || ctx.Err() != nil {
+		w.mu.Unlock()
+		return
+	}
+	if err := w.singleton.Promote(ctx, state); err != nil {
+		w.mu.Unlock()
+		log.WithError(err).WithField("election", w.name).Error("Failed to promote, resigning")
+		resign()
+		return
+	}
+	w.leading = true
+	w.role.Store(int32(RoleLeader))
+	w.mu.Unlock()
+	log.WithField("election", w.name).WithField("id", w.id).Info("Promoted to leader")
+
+	t := time.NewTicker(w.checkpointInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			w.mu.Lock()
+			if w.leading {
+				w.checkpoint(ctx)
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// demote stops the singleton. The final state is only checkpointed on a graceful handoff, since a replica that
+// lost the lease may race with the new leader.
+func (w *WarmStandby) demote(handoff bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.leading {
+		return
+	}
+	w.singleton.Demote()
+	if handoff {
+		ctx, cancel := context.WithTimeout(context.Background(), w.renewDeadline)
+		w.checkpoint(ctx)
+		cancel()
+	}
+	w.leading = false
+	w.role.Store(int32(RoleStandby))
+	log.WithField("election", w.name).WithField("id", w.id).Info("Demoted to standby")
+}
+
+// Run campaigns for the lease and runs the singleton whenever this replica holds it. A replica that loses the
+// lease goes back to being a standby. When ctx is canceled, the singleton is stopped and the lease released before
+// Run returns.
+func (w *WarmStandby) Run(ctx context.Context) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      w.name,
+			Namespace: w.namespace,
+		},
+		Client:     w.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: w.id},
+	}
+
+	for ctx.Err() == nil {
+		electionCtx, cancelElection := context.WithCancel(context.Background())
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   w.leaseDuration,
+			RenewDeadline:   w.renewDeadline,
+			RetryPeriod:     w.retryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					w.promote(leaderCtx, cancelElection)
+				},
+				OnStoppedLeading: func() {
+					w.demote(false)
+				},
+			},
+			Name: w.name,
+		})
+		if err != nil {
+			cancelElection()
+			return err
+		}
+
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				// Stop the singleton and hand off its state before the lease is released.
+				w.mu.Lock()
+				w.resigned = true
+				w.mu.Unlock()
+				w.demote(true)
+				cancelElection()
+			case <-done:
+			}
+		}()
+		le.Run(electionCtx)
+		close(done)
+		cancelElection()
+
+		if ctx.Err() == nil {
+			log.WithField("election", w.name).Warn("Lost leadership, campaigning again")
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.retryPeriod):
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package election_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/shared/services/election"
+)
+
+type fakeSingleton struct {
+	mu       sync.Mutex
+	running  bool
+	promoted []byte
+	state    []byte
+}
+
+func (f *fakeSingleton) Promote(ctx context.Context, state []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.running = true
+	f.promoted = state
+	return nil
+}
+
+func (f *fakeSingleton) Demote() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.running = false
+}
+
+func (f *fakeSingleton) Checkpoint() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state, nil
+}
+
+func (f *fakeSingleton) isRunning() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running
+}
+
+func (f *fakeSingleton) promotedState() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.promoted
+}
+
+func startStandby(t *testing.T, clientset *fake.Clientset, id string, s *fakeSingleton) (*election.WarmStandby, func()) {
+	w, err := election.NewWarmStandby(clientset, "pl", "test-election", s,
+		election.WithIdentity(id),
+		election.WithLeaseDurations(3*time.Second, 2*time.Second, 100*time.Millisecond),
+		election.WithCheckpointInterval(50*time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, w.Run(ctx))
+	}()
+	return w, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestWarmStandby_Failover(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	first := &fakeSingleton{state: []byte("first")}
+	w1, stop1 := startStandby(t, clientset, "replica-1", first)
+	require.Eventually(t, first.isRunning, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, election.RoleLeader, w1.Role())
+	assert.Nil(t, first.promotedState())
+
+	second := &fakeSingleton{state: []byte("second")}
+	w2, stop2 := startStandby(t, clientset, "replica-2", second)
+	defer stop2()
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, election.RoleStandby, w2.Role())
+	assert.False(t, second.isRunning())
+
+	// The leader hands off its state on shutdown, and the standby takes over well before the lease expires.
+	first.mu.Lock()
+	first.state = []byte("handoff")
+	first.mu.Unlock()
+	start := time.Now()
+	stop1()
+	assert.False(t, first.isRunning())
+	assert.Equal(t, election.RoleStandby, w1.Role())
+
+	require.Eventually(t, second.isRunning, 5*time.Second, 10*time.Millisecond)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, election.RoleLeader, w2.Role())
+	assert.Equal(t, []byte("handoff"), second.promotedState())
+}
+
+func TestNewWarmStandby_RequiresNamespace(t *testing.T) {
+	_, err := election.NewWarmStandby(fake.NewSimpleClientset(), "", "test-election", &fakeSingleton{})
+	assert.Error(t, err)
+}
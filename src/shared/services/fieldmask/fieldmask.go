@@ -0,0 +1,181 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package fieldmask prunes protobuf messages down to the fields listed in a google.protobuf.FieldMask,
+// so that services can return only the fields that a client asked for.
+package fieldmask
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gogo/protobuf/types"
+)
+
+// tree is the set of paths in a field mask, keyed by field name. An empty subtree means that the
+// whole field is kept.
+type tree map[string]tree
+
+func newTree(paths []string) tree {
+	t := tree{}
+	for _, p := range paths {
+		node := t
+		parts := strings.Split(p, ".")
+		for i, part := range parts {
+			child, ok := node[part]
+			if ok && len(child) == 0 {
+				// This field is already kept as a whole.
+				break
+			}
+			if i == len(parts)-1 {
+				node[part] = tree{}
+				break
+			}
+			if !ok {
+				child = tree{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return t
+}
+
+// fieldName returns the protobuf name of the struct field, or "" if it isn't a protobuf field.
+func fieldName(f reflect.StructField) string {
+	if name := f.Tag.Get("protobuf_oneof"); name != "" {
+		return name
+	}
+	for _, part := range strings.Split(f.Tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(part, "name=") {
+			return strings.TrimPrefix(part, "name=")
+		}
+	}
+	return ""
+}
+
+// messageType returns the struct type of the messages stored in a field of type t, or nil if the field
+// doesn't store messages.
+func messageType(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map:
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+func validate(t reflect.Type, paths tree, prefix string) error {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		if name := fieldName(t.Field(i)); name != "" {
+			fields[name] = t.Field(i)
+		}
+	}
+	for name, sub := range paths {
+		f, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("unknown field %q in %s", prefix+name, t.Name())
+		}
+		if len(sub) == 0 {
+			continue
+		}
+		mt := messageType(f.Type)
+		if mt == nil || f.Tag.Get("protobuf_oneof") != "" {
+			return fmt.Errorf("field %q does not have subfields", prefix+name)
+		}
+		if err := validate(mt, sub, prefix+name+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func prune(v reflect.Value, paths tree) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			prune(v.Elem(), paths)
+		}
+		return
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			prune(v.Index(i), paths)
+		}
+		return
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			// Map values aren't addressable, so they are pruned in a copy.
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			prune(elem, paths)
+			v.SetMapIndex(k, elem)
+		}
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := fieldName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		sub, ok := paths[name]
+		if !ok {
+			v.Field(i).Set(reflect.Zero(t.Field(i).Type))
+			continue
+		}
+		if len(sub) > 0 {
+			prune(v.Field(i), sub)
+		}
+	}
+}
+
+// Validate returns an error if the paths of the mask don't refer to fields of messages of msg's type.
+func Validate(mask *types.FieldMask, msg interface{}) error {
+	if mask == nil || len(mask.Paths) == 0 {
+		return nil
+	}
+	t := messageType(reflect.TypeOf(msg))
+	if t == nil {
+		return fmt.Errorf("%T is not a message", msg)
+	}
+	return validate(t, newTree(mask.Paths), "")
+}
+
+// Apply clears all of the fields of msg that aren't in the mask. msg is a pointer to a message, or a slice of
+// pointers to messages. An empty mask keeps all fields.
+func Apply(mask *types.FieldMask, msg interface{}) error {
+	if mask == nil || len(mask.Paths) == 0 {
+		return nil
+	}
+	if err := Validate(mask, msg); err != nil {
+		return err
+	}
+	prune(reflect.ValueOf(msg), newTree(mask.Paths))
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fieldmask_test
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/shared/services/fieldmask"
+)
+
+func newClusterInfo() *cloudpb.ClusterInfo {
+	return &cloudpb.ClusterInfo{
+		ID:            &uuidpb.UUID{HighBits: 1, LowBits: 2},
+		Status:        cloudpb.CS_HEALTHY,
+		ClusterName:   "test-cluster",
+		StatusMessage: "all good",
+		ControlPlanePodStatuses: map[string]*cloudpb.PodStatus{
+			"vizier-pem": {Name: "vizier-pem", Reason: "running", StatusMessage: "ok"},
+		},
+		UnhealthyDataPlanePodStatuses: map[string]*cloudpb.PodStatus{
+			"vizier-pem-abc": {Name: "vizier-pem-abc", Reason: "crashing"},
+		},
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		expected *cloudpb.ClusterInfo
+	}{
+		{
+			name:     "empty mask",
+			paths:    nil,
+			expected: newClusterInfo(),
+		},
+		{
+			name:  "top level fields",
+			paths: []string{"id", "cluster_name"},
+			expected: &cloudpb.ClusterInfo{
+				ID:          &uuidpb.UUID{HighBits: 1, LowBits: 2},
+				ClusterName: "test-cluster",
+			},
+		},
+		{
+			name:  "nested fields",
+			paths: []string{"cluster_name", "control_plane_pod_statuses.name"},
+			expected: &cloudpb.ClusterInfo{
+				ClusterName: "test-cluster",
+				ControlPlanePodStatuses: map[string]*cloudpb.PodStatus{
+					"vizier-pem": {Name: "vizier-pem"},
+				},
+			},
+		},
+		{
+			name:  "parent path keeps subfields",
+			paths: []string{"control_plane_pod_statuses.name", "control_plane_pod_statuses"},
+			expected: &cloudpb.ClusterInfo{
+				ControlPlanePodStatuses: map[string]*cloudpb.PodStatus{
+					"vizier-pem": {Name: "vizier-pem", Reason: "running", StatusMessage: "ok"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info := newClusterInfo()
+			require.NoError(t, fieldmask.Apply(&types.FieldMask{Paths: tc.paths}, info))
+			assert.Equal(t, tc.expected, info)
+		})
+	}
+}
+
+func TestApply_Slice(t *testing.T) {
+	clusters := []*cloudpb.ClusterInfo{newClusterInfo(), newClusterInfo()}
+	require.NoError(t, fieldmask.Apply(&types.FieldMask{Paths: []string{"status"}}, clusters))
+	for _, c := range clusters {
+		assert.Equal(t, &cloudpb.ClusterInfo{Status: cloudpb.CS_HEALTHY}, c)
+	}
+}
+
+func TestApply_InvalidPaths(t *testing.T) {
+	for _, path := range []string{"not_a_field", "cluster_name.length", "control_plane_pod_statuses.not_a_field"} {
+		t.Run(path, func(t *testing.T) {
+			info := newClusterInfo()
+			assert.Error(t, fieldmask.Apply(&types.FieldMask{Paths: []string{path}}, info))
+			// The message is left untouched when the mask is invalid.
+			assert.Equal(t, newClusterInfo(), info)
+		})
+	}
+}
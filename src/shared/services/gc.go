@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	gcSetup sync.Once
+	// memoryBallast is never read. It only raises the size of the live heap, so that the GC runs less often
+	// while the real heap is small.
+	memoryBallast []byte
+)
+
+func setupGCFlags() {
+	pflag.Int("gc_percent", 0, "The GC target percentage, like GOGC. A negative value disables the GC unless memory_limit is reached. 0 keeps the runtime default")
+	pflag.String("memory_limit", "", "A soft memory limit for the runtime, like GOMEMLIMIT, for example \"1gb\". Unset keeps the runtime default")
+	pflag.String("memory_ballast", "", "The size of a heap allocation that is held for the lifetime of the service to reduce the GC frequency, for example \"256mb\"")
+}
+
+// setupGC applies the GC flags to the runtime, and registers metrics on the impact of the GC.
+func setupGC() {
+	gcSetup.Do(func() {
+		gcPercent := viper.GetInt("gc_percent")
+		memoryLimit := viper.GetSizeInBytes("memory_limit")
+		ballast := viper.GetSizeInBytes("memory_ballast")
+		if gcPercent != 0 {
+			debug.SetGCPercent(gcPercent)
+		}
+		if memoryLimit > 0 {
+			debug.SetMemoryLimit(int64(memoryLimit))
+		}
+		if ballast > 0 {
+			memoryBallast = make([]byte, ballast)
+		}
+		if gcPercent != 0 || memoryLimit > 0 || ballast > 0 {
+			log.WithField("gcPercent", gcPercent).
+				WithField("memoryLimitBytes", memoryLimit).
+				WithField("memoryBallastBytes", ballast).
+				Info("Configured GC")
+		}
+
+		// The metrics are registered even when the GC isn't tuned, so that the tuning can be compared to the default.
+		_ = prometheus.Register(&gcCollector{})
+	})
+}
+
+var (
+	gcPauseSecondsDesc = prometheus.NewDesc("gc_pause_seconds_total",
+		"Total time that the program was stopped for GC.", nil, nil)
+	gcCyclesDesc = prometheus.NewDesc("gc_cycles_total",
+		"Number of completed GC cycles.", nil, nil)
+	gcCPUFractionDesc = prometheus.NewDesc("gc_cpu_fraction",
+		"Fraction of the available CPU time used by the GC since the program started.", nil, nil)
+	gcHeapGoalDesc = prometheus.NewDesc("gc_heap_goal_bytes",
+		"Heap size at which the next GC cycle starts.", nil, nil)
+)
+
+// gcCollector reports the GC stats of the runtime. It reads them once per scrape, because reading them stops
+// the world.
+type gcCollector struct{}
+
+// Describe implements prometheus.Collector.
+func (c *gcCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- gcPauseSecondsDesc
+	ch <- gcCyclesDesc
+	ch <- gcCPUFractionDesc
+	ch <- gcHeapGoalDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *gcCollector) Collect(ch chan<- prometheus.Metric) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	ch <- prometheus.MustNewConstMetric(gcPauseSecondsDesc, prometheus.CounterValue, float64(stats.PauseTotalNs)/1e9)
+	ch <- prometheus.MustNewConstMetric(gcCyclesDesc, prometheus.CounterValue, float64(stats.NumGC))
+	ch <- prometheus.MustNewConstMetric(gcCPUFractionDesc, prometheus.GaugeValue, stats.GCCPUFraction)
+	ch <- prometheus.MustNewConstMetric(gcHeapGoalDesc, prometheus.GaugeValue, float64(stats.NextGC))
+}
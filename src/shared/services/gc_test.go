@@ -0,0 +1,53 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCCollector(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(&gcCollector{}))
+	runtime.GC()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, f := range families {
+		require.Len(t, f.GetMetric(), 1)
+		m := f.GetMetric()[0]
+		if m.GetCounter() != nil {
+			values[f.GetName()] = m.GetCounter().GetValue()
+		} else {
+			values[f.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+
+	assert.Len(t, values, 4)
+	assert.GreaterOrEqual(t, values["gc_cycles_total"], 1.0)
+	assert.Greater(t, values["gc_pause_seconds_total"], 0.0)
+	assert.Greater(t, values["gc_heap_goal_bytes"], 0.0)
+	assert.Contains(t, values, "gc_cpu_fraction")
+}
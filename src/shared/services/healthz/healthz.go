@@ -29,10 +29,14 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
+const meshSidecarCheckTimeout = 2 * time.Second
+
 // Checker is a named healthz checker.
 type Checker interface {
 	Name() string
@@ -52,12 +56,33 @@ func RegisterPingEndpoint(mux mux) {
 	mux.Handle("/ping", adaptCheckToHandler(PingHealthz.Check))
 }
 
-// RegisterDefaultChecks register the default checks along with the passed in checks.
+// RegisterDefaultChecks register the default checks along with the passed in checks. When the service runs
+// behind a service mesh, the readiness of the mesh sidecar is also checked, since the service can't be reached
+// until its sidecar is ready.
 func RegisterDefaultChecks(mux mux, checks ...Checker) {
 	RegisterPingEndpoint(mux)
+	if url := viper.GetString("mesh_ready_url"); url != "" {
+		checks = append(checks, MeshSidecarCheck(url))
+	}
 	InstallPathHandler(mux, "/healthz", checks...)
 }
 
+// MeshSidecarCheck returns a healthz checker for the readiness endpoint of a service mesh sidecar.
+func MeshSidecarCheck(url string) Checker {
+	client := &http.Client{Timeout: meshSidecarCheckTimeout}
+	return NamedCheck("mesh-sidecar", func() error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("mesh sidecar is not ready: %s", resp.Status)
+		}
+		return nil
+	})
+}
+
 // healthzCheck implements Checker on an arbitrary name and check function.
 type healthzCheck struct {
 	name  string
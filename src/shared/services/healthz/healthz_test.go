@@ -25,6 +25,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -92,3 +93,30 @@ func TestMultipleChecks(t *testing.T) {
 		assert.True(t, strings.HasPrefix(w.Body.String(), test.expectedResponseStartsWith))
 	}
 }
+
+func TestRegisterDefaultChecks_MeshSidecar(t *testing.T) {
+	sidecarReady := false
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sidecarReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer sidecar.Close()
+
+	viper.Set("mesh_ready_url", sidecar.URL)
+	defer viper.Set("mesh_ready_url", "")
+
+	mux := http.NewServeMux()
+	healthz.RegisterDefaultChecks(mux)
+
+	check := func() int {
+		req, err := http.NewRequest("GET", "http://abc.com/healthz", nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusInternalServerError, check())
+	sidecarReady = true
+	assert.Equal(t, http.StatusOK, check())
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package httpmiddleware_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/shared/services/httpmiddleware"
+	ping "px.dev/pixie/src/shared/services/testproto"
+)
+
+type pingServer struct{}
+
+func (s *pingServer) Ping(ctx context.Context, in *ping.PingRequest) (*ping.PingReply, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("authorization")) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing auth")
+	}
+	return &ping.PingReply{Reply: "pong: " + in.Req}, nil
+}
+
+func (s *pingServer) PingServerStream(in *ping.PingRequest, srv ping.PingService_PingServerStreamServer) error {
+	return srv.Send(&ping.PingReply{Reply: "pong"})
+}
+
+func (s *pingServer) PingClientStream(srv ping.PingService_PingClientStreamServer) error {
+	return srv.SendAndClose(&ping.PingReply{Reply: "pong"})
+}
+
+func newGatewayHandler() http.Handler {
+	s := grpc.NewServer()
+	ping.RegisterPingServiceServer(s, &pingServer{})
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	return httpmiddleware.WithGRPCWeb(s, httpmiddleware.WithRESTGateway(s, notFound))
+}
+
+func frame(flag byte, b []byte) []byte {
+	f := make([]byte, 5, 5+len(b))
+	f[0] = flag
+	binary.BigEndian.PutUint32(f[1:], uint32(len(b)))
+	return append(f, b...)
+}
+
+// readFrames splits a gRPC-Web response body into its data and trailer frames.
+func readFrames(t *testing.T, b []byte) ([][]byte, string) {
+	var msgs [][]byte
+	var trailers string
+	for len(b) > 0 {
+		require.GreaterOrEqual(t, len(b), 5)
+		l := binary.BigEndian.Uint32(b[1:5])
+		if b[0]&0x80 != 0 {
+			trailers = string(b[5 : 5+l])
+		} else {
+			msgs = append(msgs, b[5:5+l])
+		}
+		b = b[5+l:]
+	}
+	return msgs, trailers
+}
+
+// decodeBase64Chunks decodes a gRPC-Web text body, where each write is padded and encoded separately.
+func decodeBase64Chunks(t *testing.T, s string) []byte {
+	var decoded []byte
+	for len(s) > 0 {
+		end := strings.Index(s, "=")
+		if end == -1 {
+			end = len(s)
+		}
+		for end < len(s) && s[end] == '=' {
+			end++
+		}
+		b, err := base64.StdEncoding.DecodeString(s[:end])
+		require.NoError(t, err)
+		decoded = append(decoded, b...)
+		s = s[end:]
+	}
+	return decoded
+}
+
+func TestWithGRPCWeb(t *testing.T) {
+	h := newGatewayHandler()
+	reqBytes, err := proto.Marshal(&ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		auth        bool
+		expCode     codes.Code
+	}{
+		{name: "binary", contentType: "application/grpc-web+proto", auth: true, expCode: codes.OK},
+		{name: "text", contentType: "application/grpc-web-text", auth: true, expCode: codes.OK},
+		{name: "error", contentType: "application/grpc-web+proto", auth: false, expCode: codes.Unauthenticated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isText := strings.HasPrefix(test.contentType, "application/grpc-web-text")
+			body := frame(0, reqBytes)
+			if isText {
+				body = []byte(base64.StdEncoding.EncodeToString(body))
+			}
+			req := httptest.NewRequest(http.MethodPost, "/px.common.PingService/Ping", bytes.NewReader(body))
+			req.Header.Set("Content-Type", test.contentType)
+			if test.auth {
+				req.Header.Set("Authorization", "bearer abc")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, test.contentType, rec.Header().Get("Content-Type"))
+			assert.Empty(t, rec.Header().Get("Grpc-Status"))
+
+			respBody := rec.Body.Bytes()
+			if isText {
+				respBody = decodeBase64Chunks(t, string(respBody))
+			}
+			msgs, trailers := readFrames(t, respBody)
+			assert.Contains(t, trailers, fmt.Sprintf("grpc-status: %d\r\n", test.expCode))
+			if test.expCode != codes.OK {
+				assert.Len(t, msgs, 0)
+				return
+			}
+			require.Len(t, msgs, 1)
+			reply := &ping.PingReply{}
+			require.NoError(t, proto.Unmarshal(msgs[0], reply))
+			assert.Equal(t, "pong: hello", reply.Reply)
+		})
+	}
+}
+
+func TestWithRESTGateway(t *testing.T) {
+	h := newGatewayHandler()
+
+	tests := []struct {
+		name       string
+		path       string
+		auth       bool
+		expStatus  int
+		expReply   string
+		expMessage string
+	}{
+		{name: "unary", path: "/rpc/px.common.PingService/Ping", auth: true, expStatus: http.StatusOK, expReply: "pong: hello"},
+		{name: "grpc error", path: "/rpc/px.common.PingService/Ping", auth: false, expStatus: http.StatusUnauthorized, expMessage: "missing auth"},
+		{name: "streaming", path: "/rpc/px.common.PingService/PingServerStream", auth: true, expStatus: http.StatusNotImplemented},
+		{name: "unknown method", path: "/rpc/px.common.PingService/Pong", auth: true, expStatus: http.StatusNotImplemented},
+		{name: "not gateway", path: "/api/ping", auth: true, expStatus: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(`{"req": "hello"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if test.auth {
+				req.Header.Set("Authorization", "bearer abc")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, test.expStatus, rec.Code)
+
+			resp := make(map[string]interface{})
+			if test.expReply != "" {
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, test.expReply, resp["reply"])
+			}
+			if test.expMessage != "" {
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, test.expMessage, resp["message"])
+			}
+		})
+	}
+}
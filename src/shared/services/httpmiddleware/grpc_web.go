@@ -0,0 +1,182 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package httpmiddleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+)
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	// grpcWebTrailerFlag marks the frame holding the trailers in a gRPC-Web response.
+	grpcWebTrailerFlag byte = 0x80
+)
+
+func isGRPCWebRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// WithGRPCWeb serves gRPC-Web requests using the given GRPC server, so that browsers can call
+// the server without a separate proxy. All other requests are passed to next.
+//
+// The requests are run through grpcServer as regular gRPC calls, so they go through the same
+// interceptors (including auth) as any other call.
+func WithGRPCWeb(grpcServer *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isGRPCWebRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		isText := strings.HasPrefix(contentType, grpcWebTextContentType)
+
+		body := io.Reader(r.Body)
+		if isText {
+			body = base64.NewDecoder(base64.StdEncoding, r.Body)
+			contentType = grpcContentType + strings.TrimPrefix(contentType, grpcWebTextContentType)
+		} else {
+			contentType = grpcContentType + strings.TrimPrefix(contentType, grpcWebContentType)
+		}
+
+		grpcReq := toGRPCRequest(r, contentType, io.NopCloser(body))
+		gw := newGRPCWebResponseWriter(w, r.Header.Get("Content-Type"), isText)
+		grpcServer.ServeHTTP(gw, grpcReq)
+		gw.finish()
+	})
+}
+
+// toGRPCRequest creates a copy of r that the GRPC server will accept as a native gRPC request.
+func toGRPCRequest(r *http.Request, contentType string, body io.ReadCloser) *http.Request {
+	req := r.Clone(r.Context())
+	req.Proto = "HTTP/2"
+	req.ProtoMajor = 2
+	req.ProtoMinor = 0
+	req.Body = body
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Del("Content-Length")
+	return req
+}
+
+// grpcWebResponseWriter converts the gRPC response written by the GRPC server into a gRPC-Web
+// response. gRPC-Web doesn't use HTTP trailers, so they are written at the end of the body instead.
+type grpcWebResponseWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	contentType string
+	isText      bool
+	wroteHeader bool
+}
+
+func newGRPCWebResponseWriter(w http.ResponseWriter, contentType string, isText bool) *grpcWebResponseWriter {
+	return &grpcWebResponseWriter{
+		w:           w,
+		header:      make(http.Header),
+		contentType: contentType,
+		isText:      isText,
+	}
+}
+
+func (g *grpcWebResponseWriter) Header() http.Header {
+	return g.header
+}
+
+func (g *grpcWebResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.w.Header()
+	for k, vv := range g.header {
+		if k == "Trailer" || strings.HasPrefix(k, http2.TrailerPrefix) {
+			continue
+		}
+		h[k] = vv
+	}
+	h.Set("Content-Type", g.contentType)
+	h.Del("Content-Length")
+	g.w.WriteHeader(code)
+}
+
+func (g *grpcWebResponseWriter) Write(b []byte) (int, error) {
+	g.WriteHeader(http.StatusOK)
+	if g.isText {
+		if _, err := g.w.Write([]byte(base64.StdEncoding.EncodeToString(b))); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return g.w.Write(b)
+}
+
+func (g *grpcWebResponseWriter) Flush() {
+	g.WriteHeader(http.StatusOK)
+	if f, ok := g.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish writes out the trailers that were set on the response as the final frame of the body.
+func (g *grpcWebResponseWriter) finish() {
+	trailers := make(http.Header)
+	for _, k := range g.header.Values("Trailer") {
+		if v := g.header.Values(k); len(v) > 0 {
+			trailers[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	for k, vv := range g.header {
+		if strings.HasPrefix(k, http2.TrailerPrefix) {
+			trailers[http.CanonicalHeaderKey(strings.TrimPrefix(k, http2.TrailerPrefix))] = vv
+		}
+	}
+
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		for _, v := range trailers[k] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", strings.ToLower(k), v)
+		}
+	}
+
+	frame := make([]byte, 5, 5+buf.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(buf.Len()))
+	frame = append(frame, buf.Bytes()...)
+	_, _ = g.Write(frame)
+	g.Flush()
+}
@@ -24,8 +24,10 @@ import (
 	"net/http"
 	"strings"
 
+	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/utils"
 )
 
 // GetTokenFromBearer extracts a bearer token from the authorization header.
@@ -87,6 +89,9 @@ func WithBearerAuthMiddleware(env env.Env, next http.Handler) http.Handler {
 		}
 
 		aCtx := authcontext.New()
+		if services.GetTLSMode() == services.TLSModeMesh {
+			aCtx.PeerIdentity = authcontext.PeerIdentityFromHeader(r.Header)
+		}
 		err := aCtx.UseJWTAuth(env.JWTSigningKey(), token, env.Audience())
 		if err != nil {
 			http.Error(w, "Failed to parse token", http.StatusUnauthorized)
@@ -97,6 +102,10 @@ func WithBearerAuthMiddleware(env env.Env, next http.Handler) http.Handler {
 			http.Error(w, "Invalid user", http.StatusUnauthorized)
 			return
 		}
+		if utils.GetClaimsType(aCtx.Claims) == utils.ServiceClaimType && !services.ServicePeerAllowed(aCtx.PeerIdentity) {
+			http.Error(w, "Service tokens are not accepted from this peer", http.StatusForbidden)
+			return
+		}
 
 		newCtx := authcontext.NewContext(r.Context(), aCtx)
 		next.ServeHTTP(w, r.WithContext(newCtx))
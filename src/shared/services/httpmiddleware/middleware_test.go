@@ -135,3 +135,55 @@ func TestWithBearerAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestWithBearerAuthMiddleware_MeshServicePeers(t *testing.T) {
+	viper.Set("jwt_signing_key", "jwt-key")
+	viper.Set("tls_mode", "mesh")
+	viper.Set("mesh_service_peers", []string{"spiffe://cluster.local/ns/plc/sa/api-service"})
+	defer viper.Set("tls_mode", "")
+	defer viper.Set("mesh_service_peers", []string{})
+	e := env.New("withpixie.ai")
+	serviceToken := testingutils.SignPBClaims(t, testingutils.GenerateTestServiceClaims(t, "api"), "jwt-key")
+
+	tests := []struct {
+		name         string
+		token        string
+		peer         string
+		expectedCode int
+	}{
+		{
+			name:         "service token from a service",
+			token:        serviceToken,
+			peer:         "spiffe://cluster.local/ns/plc/sa/api-service",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "service token from another peer",
+			token:        serviceToken,
+			peer:         "spiffe://cluster.local/ns/default/sa/default",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "user token from another peer",
+			token:        testingutils.GenerateTestJWTToken(t, "jwt-key"),
+			peer:         "spiffe://cluster.local/ns/default/sa/default",
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/users", nil)
+			require.NoError(t, err)
+			req.Header.Add("Authorization", "Bearer "+test.token)
+			req.Header.Add(authcontext.XFCCHeader, "Hash=abcd;URI="+test.peer)
+			rr := httptest.NewRecorder()
+
+			handler := httpmiddleware.WithBearerAuthMiddleware(e, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, test.expectedCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package httpmiddleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"px.dev/pixie/src/shared/services"
+)
+
+// RESTGatewayPathPrefix is the path under which the REST gateway serves GRPC methods.
+// A method is called with a POST to <prefix><package>.<Service>/<Method> with the JSON encoded request.
+const RESTGatewayPathPrefix = "/rpc/"
+
+type restMethod struct {
+	fullMethod string
+	reqType    reflect.Type
+	respType   reflect.Type
+}
+
+// restGateway translates JSON requests into unary GRPC calls.
+type restGateway struct {
+	grpcServer *grpc.Server
+
+	// The services are only known once they have been registered on the server, which usually
+	// happens after the middleware is created, so methods are resolved lazily.
+	mu      sync.Mutex
+	methods map[string]*restMethod
+}
+
+// WithRESTGateway serves JSON/REST requests for the unary methods of the given GRPC server under
+// RESTGatewayPathPrefix. All other requests are passed to next.
+//
+// The requests are run through grpcServer as regular gRPC calls, so they go through the same
+// interceptors (including auth) as any other call. Request headers, such as authorization, are
+// passed along as GRPC metadata.
+func WithRESTGateway(grpcServer *grpc.Server, next http.Handler) http.Handler {
+	g := &restGateway{
+		grpcServer: grpcServer,
+		methods:    make(map[string]*restMethod),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, RESTGatewayPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		g.serveHTTP(w, r)
+	})
+}
+
+func writeRESTError(w http.ResponseWriter, code codes.Code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(services.HTTPStatusFromCode(code))
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    code,
+		"message": message,
+	})
+}
+
+func (g *restGateway) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fullMethod := "/" + strings.TrimPrefix(r.URL.Path, RESTGatewayPathPrefix)
+	m, err := g.lookupMethod(fullMethod)
+	if err != nil {
+		writeRESTError(w, codes.Unimplemented, err.Error())
+		return
+	}
+
+	req := reflect.New(m.reqType.Elem()).Interface().(proto.Message)
+	if err := (&jsonpb.Unmarshaler{}).Unmarshal(r.Body, req); err != nil && err != io.EOF {
+		writeRESTError(w, codes.InvalidArgument, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	reqBytes, err := proto.Marshal(req)
+	if err != nil {
+		writeRESTError(w, codes.Internal, err.Error())
+		return
+	}
+
+	frame := make([]byte, 5, 5+len(reqBytes))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(reqBytes)))
+	frame = append(frame, reqBytes...)
+
+	grpcReq := toGRPCRequest(r, grpcContentType+"+proto", io.NopCloser(bytes.NewReader(frame)))
+	grpcReq.URL.Path = fullMethod
+	grpcReq.RequestURI = fullMethod
+	grpcReq.Header.Set("Te", "trailers")
+	// The response is decoded here, so make sure it isn't compressed.
+	grpcReq.Header.Del("Grpc-Encoding")
+	grpcReq.Header.Del("Grpc-Accept-Encoding")
+
+	rec := &restResponseRecorder{header: make(http.Header)}
+	g.grpcServer.ServeHTTP(rec, grpcReq)
+
+	code := codes.Unknown
+	if s := rec.header.Get("Grpc-Status"); s != "" {
+		if c, err := strconv.Atoi(s); err == nil {
+			code = codes.Code(c)
+		}
+	}
+	if code != codes.OK {
+		writeRESTError(w, code, rec.header.Get("Grpc-Message"))
+		return
+	}
+
+	resp := reflect.New(m.respType.Elem()).Interface().(proto.Message)
+	if err := rec.decodeMessage(resp); err != nil {
+		writeRESTError(w, codes.Internal, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := (&jsonpb.Marshaler{OrigName: true}).Marshal(w, resp); err != nil {
+		writeRESTError(w, codes.Internal, err.Error())
+	}
+}
+
+func (g *restGateway) lookupMethod(fullMethod string) (*restMethod, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if m, ok := g.methods[fullMethod]; ok {
+		return m, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed method %s", fullMethod)
+	}
+	serviceName, methodName := parts[0], parts[1]
+
+	info, ok := g.grpcServer.GetServiceInfo()[serviceName]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %s", serviceName)
+	}
+	found := false
+	for _, mi := range info.Methods {
+		if mi.Name != methodName {
+			continue
+		}
+		if mi.IsClientStream || mi.IsServerStream {
+			return nil, fmt.Errorf("streaming method %s is not supported", fullMethod)
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown method %s", fullMethod)
+	}
+
+	fileName, ok := info.Metadata.(string)
+	if !ok {
+		return nil, fmt.Errorf("no descriptor for service %s", serviceName)
+	}
+	fd, err := loadFileDescriptor(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, svc := range fd.Service {
+		if fmt.Sprintf("%s.%s", fd.GetPackage(), svc.GetName()) != serviceName {
+			continue
+		}
+		for _, md := range svc.Method {
+			if md.GetName() != methodName {
+				continue
+			}
+			reqType := proto.MessageType(strings.TrimPrefix(md.GetInputType(), "."))
+			respType := proto.MessageType(strings.TrimPrefix(md.GetOutputType(), "."))
+			if reqType == nil || respType == nil {
+				return nil, fmt.Errorf("unknown message types for method %s", fullMethod)
+			}
+			m := &restMethod{fullMethod: fullMethod, reqType: reqType, respType: respType}
+			g.methods[fullMethod] = m
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown method %s", fullMethod)
+}
+
+func loadFileDescriptor(fileName string) (*descriptor.FileDescriptorProto, error) {
+	gz := proto.FileDescriptor(fileName)
+	if gz == nil {
+		return nil, fmt.Errorf("no descriptor registered for %s", fileName)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fd := &descriptor.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fd); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
+
+// restResponseRecorder buffers the response of a GRPC call made through the REST gateway.
+type restResponseRecorder struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *restResponseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *restResponseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *restResponseRecorder) WriteHeader(int) {}
+
+func (r *restResponseRecorder) Flush() {}
+
+func (r *restResponseRecorder) decodeMessage(msg proto.Message) error {
+	b := r.body.Bytes()
+	if len(b) < 5 {
+		return errors.New("missing response message")
+	}
+	if b[0] != 0 {
+		return errors.New("compressed responses are not supported")
+	}
+	l := binary.BigEndian.Uint32(b[1:5])
+	if uint32(len(b)-5) < l {
+		return errors.New("truncated response message")
+	}
+	return proto.Unmarshal(b[5:5+l], msg)
+}
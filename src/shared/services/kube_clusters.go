@@ -0,0 +1,182 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/sercand/kuberesolver/v3"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/resolver"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const kubernetesResolverScheme = "kubernetes"
+
+// kubeClusterClient is a kuberesolver.K8sClient for a cluster loaded from a kubeconfig.
+type kubeClusterClient struct {
+	host       string
+	httpClient *http.Client
+}
+
+func (c *kubeClusterClient) GetRequest(url string) (*http.Request, error) {
+	if !strings.HasPrefix(url, c.host) {
+		url = fmt.Sprintf("%s/%s", c.host, url)
+	}
+	return http.NewRequest(http.MethodGet, url, nil)
+}
+
+func (c *kubeClusterClient) Do(req *http.Request) (*http.Response, error) {
+	return c.httpClient.Do(req)
+}
+
+func (c *kubeClusterClient) Host() string {
+	return c.host
+}
+
+func newKubeClusterClient(config *rest.Config) (*kubeClusterClient, error) {
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+	return &kubeClusterClient{
+		host:       strings.TrimSuffix(config.Host, "/"),
+		httpClient: httpClient,
+	}, nil
+}
+
+// loadKubeClusters creates a client for each context in the given kubeconfig files, keyed by context name.
+func loadKubeClusters(kubeconfigs []string) (map[string]kuberesolver.K8sClient, error) {
+	clusters := make(map[string]kuberesolver.K8sClient)
+	for _, path := range kubeconfigs {
+		cfg, err := clientcmd.LoadFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+		}
+		for name := range cfg.Contexts {
+			if _, ok := clusters[name]; ok {
+				return nil, fmt.Errorf("context %s in kubeconfig %s is defined more than once", name, path)
+			}
+			restConfig, err := clientcmd.NewNonInteractiveClientConfig(*cfg, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load context %s from kubeconfig %s: %w", name, path, err)
+			}
+			client, err := newKubeClusterClient(restConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create client for context %s: %w", name, err)
+			}
+			clusters[name] = client
+		}
+	}
+	return clusters, nil
+}
+
+// multiClusterResolverBuilder resolves targets of the form kubernetes://service.namespace@cluster:port
+// in the given cluster, and all other targets in the local cluster.
+type multiClusterResolverBuilder struct {
+	local    resolver.Builder
+	clusters map[string]resolver.Builder
+}
+
+// splitClusterTarget splits a target in a remote cluster into the name of the cluster and the
+// equivalent target within that cluster. Both kubernetes://service.namespace@cluster:port and
+// kubernetes:///service.namespace@cluster:port are accepted. Returns false if the target is local.
+func splitClusterTarget(target resolver.Target) (string, resolver.Target, bool) {
+	var name, cluster, port string
+	authority := target.Authority
+	if target.URL.User != nil {
+		// The service is parsed as the user info of the URL, and the cluster as its host.
+		name = target.URL.User.Username()
+		cluster = target.URL.Hostname()
+		port = target.URL.Port()
+		authority = ""
+	} else if i := strings.LastIndex(target.Endpoint, "@"); i >= 0 {
+		name = target.Endpoint[:i]
+		cluster = target.Endpoint[i+1:]
+		if host, p, err := net.SplitHostPort(cluster); err == nil {
+			cluster, port = host, p
+		}
+	} else {
+		return "", target, false
+	}
+
+	endpoint := name
+	if port != "" {
+		endpoint = net.JoinHostPort(name, port)
+	}
+	return cluster, resolver.Target{
+		Scheme:    target.Scheme,
+		Authority: authority,
+		Endpoint:  endpoint,
+		URL: url.URL{
+			Scheme: target.Scheme,
+			Host:   authority,
+			Path:   "/" + endpoint,
+		},
+	}, true
+}
+
+func (b *multiClusterResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	cluster, clusterTarget, ok := splitClusterTarget(target)
+	if !ok {
+		return b.local.Build(target, cc, opts)
+	}
+	rb, ok := b.clusters[cluster]
+	if !ok {
+		return nil, fmt.Errorf("target %s is in unknown cluster %q", target.URL.String(), cluster)
+	}
+	return rb.Build(clusterTarget, cc, opts)
+}
+
+func (b *multiClusterResolverBuilder) Scheme() string {
+	return kubernetesResolverScheme
+}
+
+// registerKubeResolverClusters makes the services in the clusters of the given kubeconfigs resolvable
+// as kubernetes://service.namespace@context:port, in addition to the services in the local cluster.
+func registerKubeResolverClusters(kubeconfigs []string) error {
+	if len(kubeconfigs) == 0 {
+		return nil
+	}
+	clients, err := loadKubeClusters(kubeconfigs)
+	if err != nil {
+		return err
+	}
+	b := &multiClusterResolverBuilder{
+		local:    kuberesolver.NewBuilder(nil, kubernetesResolverScheme),
+		clusters: make(map[string]resolver.Builder),
+	}
+	names := make([]string, 0, len(clients))
+	for name, client := range clients {
+		b.clusters[name] = kuberesolver.NewBuilder(client, kubernetesResolverScheme)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.WithField("clusters", names).Info("Resolving services in remote clusters")
+
+	// Registering a builder replaces the in-cluster builder registered for the same scheme.
+	resolver.Register(b)
+	return nil
+}
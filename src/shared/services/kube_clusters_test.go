@@ -0,0 +1,175 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/resolver"
+)
+
+func parseResolverTarget(t *testing.T, target string) resolver.Target {
+	// This mirrors how GRPC parses dial targets.
+	u, err := url.Parse(target)
+	require.NoError(t, err)
+	endpoint := u.Path
+	if endpoint == "" {
+		endpoint = u.Opaque
+	}
+	if len(endpoint) > 0 && endpoint[0] == '/' {
+		endpoint = endpoint[1:]
+	}
+	return resolver.Target{Scheme: u.Scheme, Authority: u.Host, Endpoint: endpoint, URL: *u}
+}
+
+func TestSplitClusterTarget(t *testing.T) {
+	tests := []struct {
+		target            string
+		isRemote          bool
+		expectedCluster   string
+		expectedAuthority string
+		expectedEndpoint  string
+	}{
+		{target: "kubernetes:///vzmgr-service.plc:51800"},
+		{target: "kubernetes://plc/vzmgr-service:51800"},
+		{
+			target:           "kubernetes://vzmgr-service.plc@prod-us:51800",
+			isRemote:         true,
+			expectedCluster:  "prod-us",
+			expectedEndpoint: "vzmgr-service.plc:51800",
+		},
+		{
+			target:           "kubernetes://vzmgr-service.plc@prod-us",
+			isRemote:         true,
+			expectedCluster:  "prod-us",
+			expectedEndpoint: "vzmgr-service.plc",
+		},
+		{
+			target:           "kubernetes:///vzmgr-service.plc@prod-us:grpc",
+			isRemote:         true,
+			expectedCluster:  "prod-us",
+			expectedEndpoint: "vzmgr-service.plc:grpc",
+		},
+		{
+			target:            "kubernetes://plc/vzmgr-service@prod-us:51800",
+			isRemote:          true,
+			expectedCluster:   "prod-us",
+			expectedAuthority: "plc",
+			expectedEndpoint:  "vzmgr-service:51800",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			target := parseResolverTarget(t, test.target)
+			cluster, clusterTarget, ok := splitClusterTarget(target)
+			assert.Equal(t, test.isRemote, ok)
+			if !test.isRemote {
+				assert.Equal(t, target, clusterTarget)
+				return
+			}
+			assert.Equal(t, test.expectedCluster, cluster)
+			assert.Equal(t, test.expectedAuthority, clusterTarget.Authority)
+			assert.Equal(t, test.expectedEndpoint, clusterTarget.Endpoint)
+		})
+	}
+}
+
+type fakeResolverBuilder struct {
+	targets []resolver.Target
+}
+
+func (b *fakeResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	b.targets = append(b.targets, target)
+	return nil, nil
+}
+
+func (b *fakeResolverBuilder) Scheme() string {
+	return kubernetesResolverScheme
+}
+
+func TestMultiClusterResolverBuilder(t *testing.T) {
+	local := &fakeResolverBuilder{}
+	remote := &fakeResolverBuilder{}
+	b := &multiClusterResolverBuilder{
+		local:    local,
+		clusters: map[string]resolver.Builder{"prod-us": remote},
+	}
+
+	_, err := b.Build(parseResolverTarget(t, "kubernetes:///vzmgr-service.plc:51800"), nil, resolver.BuildOptions{})
+	require.NoError(t, err)
+	_, err = b.Build(parseResolverTarget(t, "kubernetes://vzmgr-service.plc@prod-us:51800"), nil, resolver.BuildOptions{})
+	require.NoError(t, err)
+	_, err = b.Build(parseResolverTarget(t, "kubernetes://vzmgr-service.plc@prod-eu:51800"), nil, resolver.BuildOptions{})
+	assert.Error(t, err)
+
+	require.Len(t, local.targets, 1)
+	assert.Equal(t, "vzmgr-service.plc:51800", local.targets[0].Endpoint)
+	require.Len(t, remote.targets, 1)
+	assert.Equal(t, "vzmgr-service.plc:51800", remote.targets[0].Endpoint)
+}
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: us
+  cluster:
+    server: https://us.example.com:6443/
+- name: eu
+  cluster:
+    server: https://eu.example.com:6443
+users:
+- name: admin
+  user:
+    token: abc
+contexts:
+- name: prod-us
+  context:
+    cluster: us
+    user: admin
+- name: prod-eu
+  context:
+    cluster: eu
+    user: admin
+`
+
+func TestLoadKubeClusters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0600))
+
+	clusters, err := loadKubeClusters([]string{path})
+	require.NoError(t, err)
+	require.Len(t, clusters, 2)
+	assert.Equal(t, "https://us.example.com:6443", clusters["prod-us"].Host())
+	assert.Equal(t, "https://eu.example.com:6443", clusters["prod-eu"].Host())
+
+	req, err := clusters["prod-us"].GetRequest("api/v1/namespaces/plc/endpoints/vzmgr-service")
+	require.NoError(t, err)
+	assert.Equal(t, "https://us.example.com:6443/api/v1/namespaces/plc/endpoints/vzmgr-service", req.URL.String())
+
+	// The same context can't be loaded twice.
+	_, err = loadKubeClusters([]string{path, path})
+	assert.Error(t, err)
+}
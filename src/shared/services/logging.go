@@ -24,15 +24,21 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"github.com/zenazn/goji/web/mutil"
 
 	version "px.dev/pixie/src/shared/goversion"
+	"px.dev/pixie/src/shared/services/logscrub"
 )
 
 func init() {
 	if version.GetVersion().IsDev() {
 		log.SetReportCaller(true)
 	}
+
+	pflag.Bool("log_scrub", false, "Redact emails, tokens and IPs from the logs before they are written or shipped elsewhere")
+	pflag.StringSlice("log_scrub_field_policies", []string{}, "How specific log fields are scrubbed, as field=policy. The policy is one of detect (the default), redact, drop or keep")
 }
 
 // SetupServiceLogging sets up a consistent logging env for all services.
@@ -40,6 +46,15 @@ func SetupServiceLogging() {
 	// Setup logging.
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.InfoLevel)
+
+	if viper.GetBool("log_scrub") {
+		policies, err := logscrub.ParsePolicies(viper.GetStringSlice("log_scrub_field_policies"))
+		if err != nil {
+			log.WithError(err).Fatal("Invalid log scrub field policies")
+		}
+		// This has to run before any other hooks are added, so that they only ever see scrubbed entries.
+		log.AddHook(logscrub.NewHook(logscrub.New(policies)))
+	}
 }
 
 // HTTPLoggingMiddleware is a middleware function used for logging HTTP requests.
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package logscrub
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// Hook is a logrus hook that scrubs every log entry. Logrus runs the hooks in the order they were added, and
+// writes the entry out after all of them ran, so the hook has to be added before any hook that ships the entries
+// elsewhere (such as the sentry hook).
+type Hook struct {
+	s *Scrubber
+}
+
+// NewHook creates a new logrus hook which scrubs the entries with the given scrubber.
+func NewHook(s *Scrubber) *Hook {
+	return &Hook{s: s}
+}
+
+// Levels returns the valid log levels to hook.
+func (h *Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire scrubs the message and fields of the entry in place. Logrus hands the hooks a copy of the entry, so this
+// doesn't affect the entry that the log call was made with.
+func (h *Hook) Fire(entry *log.Entry) error {
+	entry.Message = h.s.ScrubString(MessageField, entry.Message)
+	for k, v := range entry.Data {
+		scrubbed, keep := h.s.ScrubField(k, v)
+		if !keep {
+			delete(entry.Data, k)
+			continue
+		}
+		entry.Data[k] = scrubbed
+	}
+	return nil
+}
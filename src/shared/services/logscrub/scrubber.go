@@ -0,0 +1,205 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package logscrub
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Policy is how the scrubber treats the value of a log field.
+type Policy string
+
+const (
+	// PolicyDetect replaces the personal data that is detected in the value, and keeps the rest of it.
+	PolicyDetect Policy = "detect"
+	// PolicyRedact replaces the whole value.
+	PolicyRedact Policy = "redact"
+	// PolicyDrop removes the field from the log entry.
+	PolicyDrop Policy = "drop"
+	// PolicyKeep leaves the value as is.
+	PolicyKeep Policy = "keep"
+)
+
+// The kinds of data that are redacted, used to label the redaction metrics.
+const (
+	KindEmail = "email"
+	KindToken = "token"
+	KindIP    = "ip"
+	KindField = "field"
+)
+
+// MessageField is the name the log message goes by in the redaction metrics.
+const MessageField = "msg"
+
+var redactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "log_scrub_redactions",
+	Help: "The number of values that were redacted from the service logs",
+}, []string{"kind", "field"})
+
+func init() {
+	prometheus.MustRegister(redactions)
+}
+
+// DefaultPolicies are the policies of the fields that only ever hold secrets or personal data.
+var DefaultPolicies = map[string]Policy{
+	"email":         PolicyRedact,
+	"user_email":    PolicyRedact,
+	"token":         PolicyRedact,
+	"access_token":  PolicyRedact,
+	"refresh_token": PolicyRedact,
+	"api_key":       PolicyRedact,
+	"password":      PolicyRedact,
+	"authorization": PolicyRedact,
+}
+
+var (
+	emailRegex = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	tokenRegex = regexp.MustCompile(
+		// JWTs.
+		`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*` +
+			// Pixie API and deploy keys.
+			`|px-(?:api|dep)-[0-9a-fA-F\-]{36}` +
+			// Bearer and basic credentials in auth headers.
+			`|(?i:bearer|basic) [A-Za-z0-9._~+/\-]+=*`)
+	ipv4Regex = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`)
+	// ipv6Regex finds candidates, which still have to parse as an IP to be redacted. This keeps timestamps,
+	// C++ scopes and the like from being redacted.
+	ipv6Regex = regexp.MustCompile(`(?i)[0-9a-f:]*:[0-9a-f]*:[0-9a-f:]*`)
+)
+
+// Scrubber redacts emails, tokens and IPs from log messages and fields.
+type Scrubber struct {
+	policies map[string]Policy
+}
+
+// New creates a scrubber which applies the given policies on top of the DefaultPolicies. Fields without a policy
+// are scrubbed with PolicyDetect.
+func New(policies map[string]Policy) *Scrubber {
+	p := make(map[string]Policy, len(DefaultPolicies)+len(policies))
+	for f, policy := range DefaultPolicies {
+		p[f] = policy
+	}
+	for f, policy := range policies {
+		p[f] = policy
+	}
+	return &Scrubber{policies: p}
+}
+
+// ParsePolicies parses field policies in the form field=policy, e.g. "cluster_name=keep".
+func ParsePolicies(specs []string) (map[string]Policy, error) {
+	policies := make(map[string]Policy, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid field policy %q, expected field=policy", spec)
+		}
+		p := Policy(parts[1])
+		switch p {
+		case PolicyDetect, PolicyRedact, PolicyDrop, PolicyKeep:
+		default:
+			return nil, fmt.Errorf("invalid policy %q for field %q", parts[1], parts[0])
+		}
+		policies[parts[0]] = p
+	}
+	return policies, nil
+}
+
+func redacted(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// ScrubString replaces the emails, tokens and IPs in str. The field is only used to label the redaction metrics.
+func (s *Scrubber) ScrubString(field, str string) string {
+	// Tokens go first, since a token may contain something that looks like an email or an IP.
+	str = replace(tokenRegex, str, KindToken, field, nil)
+	str = replace(emailRegex, str, KindEmail, field, nil)
+	str = replace(ipv4Regex, str, KindIP, field, nil)
+	return replace(ipv6Regex, str, KindIP, field, isIPv6)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIPv6(str string, start, end int) bool {
+	if start > 0 && isWordChar(str[start-1]) || end < len(str) && isWordChar(str[end]) {
+		return false
+	}
+	return net.ParseIP(str[start:end]) != nil
+}
+
+func replace(re *regexp.Regexp, str, kind, field string, valid func(str string, start, end int) bool) string {
+	var b strings.Builder
+	n, last := 0, 0
+	for _, loc := range re.FindAllStringIndex(str, -1) {
+		if valid != nil && !valid(str, loc[0], loc[1]) {
+			continue
+		}
+		b.WriteString(str[last:loc[0]])
+		b.WriteString(redacted(kind))
+		last = loc[1]
+		n++
+	}
+	if n == 0 {
+		return str
+	}
+	b.WriteString(str[last:])
+	redactions.WithLabelValues(kind, field).Add(float64(n))
+	return b.String()
+}
+
+// ScrubField applies the policy of the field to its value. It returns the scrubbed value, and whether the field
+// should be kept at all.
+func (s *Scrubber) ScrubField(field string, value interface{}) (interface{}, bool) {
+	policy, ok := s.policies[field]
+	if !ok {
+		policy = PolicyDetect
+	}
+
+	switch policy {
+	case PolicyKeep:
+		return value, true
+	case PolicyDrop:
+		redactions.WithLabelValues(KindField, field).Inc()
+		return nil, false
+	case PolicyRedact:
+		redactions.WithLabelValues(KindField, field).Inc()
+		return redacted(KindField), true
+	}
+
+	switch v := value.(type) {
+	case string:
+		return s.ScrubString(field, v), true
+	case error:
+		if scrubbed := s.ScrubString(field, v.Error()); scrubbed != v.Error() {
+			return scrubbed, true
+		}
+	case fmt.Stringer:
+		if scrubbed := s.ScrubString(field, v.String()); scrubbed != v.String() {
+			return scrubbed, true
+		}
+	}
+	// Numbers, bools and the like can't hold any personal data.
+	return value, true
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package msgbus
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const deadLetterSubjectPrefix = "DeadLetter."
+
+// The headers that describe why a message was dead-lettered.
+const (
+	// DeadLetterSubjectHeader is the subject that the message was originally published on.
+	DeadLetterSubjectHeader = "Pixie-Dead-Letter-Subject"
+	// DeadLetterConsumerHeader is the persistent name of the subscription that failed to handle the message.
+	DeadLetterConsumerHeader = "Pixie-Dead-Letter-Consumer"
+	// DeadLetterErrorHeader is the error of the last failed attempt to handle the message.
+	DeadLetterErrorHeader = "Pixie-Dead-Letter-Error"
+	// DeadLetterAttemptsHeader is the number of times the message was delivered before it was dead-lettered.
+	DeadLetterAttemptsHeader = "Pixie-Dead-Letter-Attempts"
+	// DeadLetterTimeHeader is when the message was dead-lettered, in RFC 3339 format.
+	DeadLetterTimeHeader = "Pixie-Dead-Letter-Time"
+)
+
+// DefaultDeadLetterMaxAttempts is the default number of times a message is delivered before it is dead-lettered.
+const DefaultDeadLetterMaxAttempts = 5
+
+// DeadLetterStream is the stream config for the messages that repeatedly failed to be handled.
+var DeadLetterStream = &nats.StreamConfig{
+	Name: "DeadLetterStream",
+	Subjects: []string{
+		deadLetterSubjectPrefix + ">",
+	},
+	MaxAge:   7 * 24 * time.Hour,
+	Replicas: 5,
+}
+
+// DeadLetterSubject returns the subject that the failed messages of the given subject are moved to.
+func DeadLetterSubject(subject string) string {
+	return deadLetterSubjectPrefix + subject
+}
+
+// FallibleMsgHandler is a function that processes a Msg, and returns an error if it failed to.
+type FallibleMsgHandler func(msg Msg) error
+
+// DeadLetter is a message that was moved to the dead-letter queue, along with why it was moved.
+type DeadLetter struct {
+	// Seq identifies the dead letter in the dead-letter queue.
+	Seq      uint64
+	Subject  string
+	Consumer string
+	Error    string
+	Attempts int
+	Time     time.Time
+	Data     []byte
+}
+
+// DeadLetterQueue moves the messages that a subscription repeatedly fails to handle to a dead-letter subject,
+// so that a poison message doesn't keep being redelivered and wedge the subscription. The dead-lettered messages
+// can be inspected, and replayed once the cause of the failures is fixed.
+type DeadLetterQueue struct {
+	js          nats.JetStreamContext
+	stream      string
+	maxAttempts int
+}
+
+// NewDeadLetterQueue creates a dead-letter queue, which dead-letters a message once it was delivered
+// maxAttempts times without being handled.
+func NewDeadLetterQueue(js nats.JetStreamContext, maxAttempts int) (*DeadLetterQueue, error) {
+	clusterSize := viper.GetInt("jetstream_cluster_size")
+	if DeadLetterStream.Replicas > clusterSize {
+		DeadLetterStream.Replicas = clusterSize
+	}
+	streamInfo, err := js.AddStream(DeadLetterStream)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterQueue{
+		js:          js,
+		stream:      streamInfo.Config.Name,
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// Handler wraps a handler for a persistent subscription with the given persistent name. Messages are acked
+// once they are handled successfully, and redelivered if handling fails or panics. A message that still
+// fails after the maximum number of attempts is moved to the dead-letter queue instead.
+func (q *DeadLetterQueue) Handler(persistentName string, cb FallibleMsgHandler) MsgHandler {
+	return func(m Msg) {
+		err := callHandler(cb, m)
+		if err == nil {
+			if err := m.Ack(); err != nil {
+				log.WithError(err).Error("Failed to ack message")
+			}
+			return
+		}
+
+		nm, ok := m.(*natsMessage)
+		if !ok {
+			log.WithError(err).Error("Failed to handle message")
+			return
+		}
+		attempts := 1
+		if md, mdErr := nm.Msg.Metadata(); mdErr == nil {
+			attempts = int(md.NumDelivered)
+		}
+		logger := log.WithField("subject", nm.Msg.Subject).WithField("consumer", persistentName).
+			WithField("attempts", attempts).WithError(err)
+		if attempts < q.maxAttempts {
+			logger.Info("Failed to handle message, it will be redelivered")
+			nak(m)
+			return
+		}
+
+		if dlErr := q.deadLetter(nm.Msg, persistentName, attempts, err); dlErr != nil {
+			logger.WithField("dead_letter_error", dlErr).Error("Failed to dead-letter message, it will be redelivered")
+			nak(m)
+			return
+		}
+		logger.Warn("Moved message that repeatedly failed to be handled to the dead-letter queue")
+		// Terminate the delivery, so that the message isn't redelivered even though it wasn't handled.
+		if err := nm.Msg.Term(); err != nil {
+			log.WithError(err).Error("Failed to terminate message")
+		}
+	}
+}
+
+// callHandler calls the handler, and turns a panic into an error so that a message which crashes its handler
+// is dead-lettered too.
+func callHandler(cb FallibleMsgHandler, m Msg) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return cb(m)
+}
+
+func (q *DeadLetterQueue) deadLetter(m *nats.Msg, persistentName string, attempts int, handlerErr error) error {
+	dl := nats.NewMsg(DeadLetterSubject(m.Subject))
+	dl.Data = m.Data
+	dl.Header.Set(DeadLetterSubjectHeader, m.Subject)
+	dl.Header.Set(DeadLetterConsumerHeader, persistentName)
+	dl.Header.Set(DeadLetterErrorHeader, handlerErr.Error())
+	dl.Header.Set(DeadLetterAttemptsHeader, strconv.Itoa(attempts))
+	dl.Header.Set(DeadLetterTimeHeader, time.Now().UTC().Format(time.RFC3339Nano))
+	_, err := q.js.PublishMsg(dl)
+	return err
+}
+
+func parseDeadLetter(m *nats.RawStreamMsg) *DeadLetter {
+	dl := &DeadLetter{
+		Seq:      m.Sequence,
+		Subject:  m.Header.Get(DeadLetterSubjectHeader),
+		Consumer: m.Header.Get(DeadLetterConsumerHeader),
+		Error:    m.Header.Get(DeadLetterErrorHeader),
+		Data:     m.Data,
+	}
+	if dl.Subject == "" {
+		dl.Subject = strings.TrimPrefix(m.Subject, deadLetterSubjectPrefix)
+	}
+	dl.Attempts, _ = strconv.Atoi(m.Header.Get(DeadLetterAttemptsHeader))
+	dl.Time, _ = time.Parse(time.RFC3339Nano, m.Header.Get(DeadLetterTimeHeader))
+	return dl
+}
+
+// List returns up to limit of the oldest dead letters of the given subject, or of all subjects if the subject
+// is empty.
+func (q *DeadLetterQueue) List(subject string, limit int) ([]*DeadLetter, error) {
+	info, err := q.js.StreamInfo(q.stream)
+	if err != nil {
+		return nil, err
+	}
+	var dls []*DeadLetter
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq && seq > 0 && len(dls) < limit; seq++ {
+		m, err := q.js.GetMsg(q.stream, seq)
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			// The dead letter was replayed or deleted.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if subject != "" && m.Subject != DeadLetterSubject(subject) {
+			continue
+		}
+		dls = append(dls, parseDeadLetter(m))
+	}
+	return dls, nil
+}
+
+// Get returns the dead letter with the given sequence number.
+func (q *DeadLetterQueue) Get(seq uint64) (*DeadLetter, error) {
+	m, err := q.js.GetMsg(q.stream, seq)
+	if err != nil {
+		return nil, err
+	}
+	return parseDeadLetter(m), nil
+}
+
+// Replay republishes the dead letter on its original subject, and removes it from the dead-letter queue. The
+// message is delivered to every subscription of the subject again, not just to the one that failed.
+func (q *DeadLetterQueue) Replay(seq uint64) error {
+	dl, err := q.Get(seq)
+	if err != nil {
+		return err
+	}
+	if _, err := q.js.Publish(dl.Subject, dl.Data); err != nil {
+		return err
+	}
+	return q.Delete(seq)
+}
+
+// Delete discards the dead letter with the given sequence number.
+func (q *DeadLetterQueue) Delete(seq uint64) error {
+	return q.js.DeleteMsg(q.stream, seq)
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package msgbus_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+var deadLetterTestStreamCfg = &nats.StreamConfig{
+	Name:     "dlqtest",
+	Subjects: []string{"dlqtest.>"},
+	MaxAge:   2 * time.Minute,
+	Replicas: 3,
+	Storage:  nats.MemoryStorage,
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js := msgbus.MustConnectJetStream(nc)
+	s, err := msgbus.NewJetStreamStreamer(nc, js, deadLetterTestStreamCfg)
+	require.NoError(t, err)
+	dlq, err := msgbus.NewDeadLetterQueue(js, 3)
+	require.NoError(t, err)
+
+	handled := make(chan string, 10)
+	attempts := make(map[string]int)
+	sub, err := s.PersistentSubscribe("dlqtest.a", "indexer", dlq.Handler("indexer", func(m msgbus.Msg) error {
+		d := string(m.Data())
+		attempts[d]++
+		switch d {
+		case "poison":
+			return errors.New("cannot handle poison")
+		case "panic":
+			panic("cannot handle panic")
+		case "flaky":
+			if attempts[d] < 2 {
+				return errors.New("flaky failure")
+			}
+		}
+		handled <- d
+		return nil
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sub.Close()) }()
+
+	for _, d := range []string{"poison", "flaky", "panic", "ok"} {
+		require.NoError(t, s.Publish("dlqtest.a", []byte(d)))
+	}
+
+	// The poison messages shouldn't keep the other messages from being handled.
+	var got []string
+	for len(got) < 2 {
+		select {
+		case d := <-handled:
+			got = append(got, d)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for messages to be handled")
+		}
+	}
+	assert.ElementsMatch(t, []string{"flaky", "ok"}, got)
+
+	var dls []*msgbus.DeadLetter
+	require.Eventually(t, func() bool {
+		dls, err = dlq.List("", 10)
+		require.NoError(t, err)
+		return len(dls) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	byData := make(map[string]*msgbus.DeadLetter)
+	for _, dl := range dls {
+		assert.Equal(t, "dlqtest.a", dl.Subject)
+		assert.Equal(t, "indexer", dl.Consumer)
+		assert.Equal(t, 3, dl.Attempts)
+		assert.False(t, dl.Time.IsZero())
+		byData[string(dl.Data)] = dl
+	}
+	require.Contains(t, byData, "poison")
+	require.Contains(t, byData, "panic")
+	assert.Equal(t, "cannot handle poison", byData["poison"].Error)
+	assert.Equal(t, "handler panicked: cannot handle panic", byData["panic"].Error)
+
+	// The dead-lettered messages aren't redelivered.
+	select {
+	case d := <-handled:
+		t.Fatalf("Unexpectedly handled %s", d)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	dls, err = dlq.List("dlqtest.b", 10)
+	require.NoError(t, err)
+	assert.Empty(t, dls)
+
+	require.NoError(t, dlq.Delete(byData["panic"].Seq))
+	dls, err = dlq.List("dlqtest.a", 10)
+	require.NoError(t, err)
+	require.Len(t, dls, 1)
+	assert.Equal(t, "poison", string(dls[0].Data))
+}
+
+func TestDeadLetterQueue_Replay(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js := msgbus.MustConnectJetStream(nc)
+	s, err := msgbus.NewJetStreamStreamer(nc, js, deadLetterTestStreamCfg)
+	require.NoError(t, err)
+	dlq, err := msgbus.NewDeadLetterQueue(js, 1)
+	require.NoError(t, err)
+
+	fixed := make(chan bool, 1)
+	handled := make(chan string, 10)
+	sub, err := s.PersistentSubscribe("dlqtest.a", "indexer", dlq.Handler("indexer", func(m msgbus.Msg) error {
+		select {
+		case <-fixed:
+			fixed <- true
+		default:
+			return errors.New("not fixed yet")
+		}
+		handled <- string(m.Data())
+		return nil
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sub.Close()) }()
+
+	require.NoError(t, s.Publish("dlqtest.a", []byte("abc")))
+
+	var dls []*msgbus.DeadLetter
+	require.Eventually(t, func() bool {
+		dls, err = dlq.List("dlqtest.a", 10)
+		require.NoError(t, err)
+		return len(dls) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Once the handler is fixed, replaying the dead letter delivers it again.
+	fixed <- true
+	require.NoError(t, dlq.Replay(dls[0].Seq))
+	select {
+	case d := <-handled:
+		assert.Equal(t, "abc", d)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for replayed message")
+	}
+
+	dls, err = dlq.List("", 10)
+	require.NoError(t, err)
+	assert.Empty(t, dls)
+
+	_, err = dlq.Get(1)
+	assert.Error(t, err)
+}
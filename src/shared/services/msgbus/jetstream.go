@@ -19,6 +19,7 @@
 package msgbus
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -55,6 +56,8 @@ func (s *persistentJetStreamSub) Close() error {
 // natsMessage implements msgbus.Msg interface for JetStream messages.
 type natsMessage struct {
 	*nats.Msg
+	// ctx carries the trace context of the message.
+	ctx context.Context
 }
 
 func (m *natsMessage) Data() []byte {
@@ -67,7 +70,9 @@ func (m *natsMessage) Ack() error {
 
 func wrapJetStreamMessageHandler(cb MsgHandler) nats.MsgHandler {
 	return func(m *nats.Msg) {
-		cb(&natsMessage{Msg: m})
+		ctx, span := startProcessSpan(m)
+		defer span.End()
+		cb(&natsMessage{Msg: m, ctx: ctx})
 	}
 }
 
@@ -127,8 +132,15 @@ func (s *jetStreamStreamer) PersistentSubscribe(subject, persistentName string,
 }
 
 func (s *jetStreamStreamer) Publish(subject string, data []byte) error {
-	return backoff.Retry(func() error {
-		pubFuture, err := s.js.PublishAsync(subject, data)
+	return s.PublishWithContext(context.Background(), subject, data)
+}
+
+func (s *jetStreamStreamer) PublishWithContext(ctx context.Context, subject string, data []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	span := startPublishSpan(ctx, msg)
+	err := backoff.Retry(func() error {
+		pubFuture, err := s.js.PublishMsgAsync(msg)
 		if err != nil {
 			return err
 		}
@@ -139,6 +151,8 @@ func (s *jetStreamStreamer) Publish(subject string, data []byte) error {
 			return err
 		}
 	}, s.bOpts)
+	endSpan(span, err)
+	return err
 }
 
 func (s *jetStreamStreamer) PeekLatestMessage(subject string) (Msg, error) {
@@ -156,7 +170,7 @@ func (s *jetStreamStreamer) PeekLatestMessage(subject string) (Msg, error) {
 	select {
 	case m, ok := <-dataCh:
 		if ok {
-			return &natsMessage{Msg: m}, nil
+			return &natsMessage{Msg: m, ctx: ContextFromNATSMsg(m)}, nil
 		}
 	case <-time.After(emptyQueueTimeout):
 		// This means the queue is considered empty, and we return no error but no element.
@@ -23,10 +23,38 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/shared/services"
 )
 
 func init() {
 	pflag.String("nats_url", "pl-nats", "The url of the nats message bus")
+	pflag.String("nats_creds", "", "The NATS credentials file to authenticate with, for NATS clusters that require it")
+	pflag.String("nats_tls_ca_cert", "", "The CA cert of the NATS servers. Defaults to the tls_ca_cert")
+	pflag.String("nats_tls_cert", "", "The TLS cert to present to NATS. Defaults to the client_tls_cert")
+	pflag.String("nats_tls_key", "", "The TLS key to present to NATS. Defaults to the client_tls_key")
+}
+
+func stringFlagOrDefault(name string, defaultName string) string {
+	if v := viper.GetString(name); v != "" {
+		return v
+	}
+	return viper.GetString(defaultName)
+}
+
+// NATSConnectOptions returns the options to connect to the NATS message bus with. By default, NATS is
+// reached with the service's own TLS certs, which can be overridden for NATS clusters managed outside of Pixie.
+func NATSConnectOptions() []nats.Option {
+	var opts []nats.Option
+	if creds := viper.GetString("nats_creds"); creds != "" {
+		opts = append(opts, nats.UserCredentials(creds))
+	}
+	if !services.SSLEnabled() {
+		return opts
+	}
+	return append(opts,
+		nats.ClientCert(stringFlagOrDefault("nats_tls_cert", "client_tls_cert"), stringFlagOrDefault("nats_tls_key", "client_tls_key")),
+		nats.RootCAs(stringFlagOrDefault("nats_tls_ca_cert", "tls_ca_cert")))
 }
 
 // MustConnectNATS attempts to connect to the NATS message bus.
@@ -34,20 +62,14 @@ func MustConnectNATS() *nats.Conn {
 	var nc *nats.Conn
 	var err error
 	natsURL := viper.GetString("nats_url")
-	if viper.GetBool("disable_ssl") {
-		nc, err = nats.Connect(natsURL)
-	} else {
-		nc, err = nats.Connect(natsURL,
-			nats.ClientCert(viper.GetString("client_tls_cert"), viper.GetString("client_tls_key")),
-			nats.RootCAs(viper.GetString("tls_ca_cert")))
-	}
+	nc, err = nats.Connect(natsURL, NATSConnectOptions()...)
 
-	if err != nil && !viper.GetBool("disable_ssl") {
+	if err != nil && services.SSLEnabled() {
 		log.WithError(err).
 			WithField("nats_url", natsURL).
-			WithField("client_tls_cert", viper.GetString("client_tls_cert")).
-			WithField("client_tls_key", viper.GetString("client_tls_key")).
-			WithField("tls_ca_cert", viper.GetString("tls_ca_cert")).
+			WithField("client_tls_cert", stringFlagOrDefault("nats_tls_cert", "client_tls_cert")).
+			WithField("client_tls_key", stringFlagOrDefault("nats_tls_key", "client_tls_key")).
+			WithField("tls_ca_cert", stringFlagOrDefault("nats_tls_ca_cert", "tls_ca_cert")).
 			Fatal("Failed to connect to NATS")
 	} else if err != nil {
 		log.WithError(err).WithField("nats_url", natsURL).Fatal("Failed to connect to NATS")
@@ -19,6 +19,8 @@
 package msgbus_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/nats-io/nats.go"
@@ -26,6 +28,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"px.dev/pixie/src/shared/services/msgbus"
 	"px.dev/pixie/src/utils/testingutils"
 )
 
@@ -46,3 +49,20 @@ func TestMustConnectNATS(t *testing.T) {
 	natsMsg := <-ch
 	assert.Equal(t, natsMsg.Data, msg)
 }
+
+func TestNATSConnectOptions(t *testing.T) {
+	viper.Set("disable_ssl", true)
+	viper.Set("nats_creds", "")
+	assert.Empty(t, msgbus.NATSConnectOptions())
+
+	creds := filepath.Join(t.TempDir(), "nats.creds")
+	require.NoError(t, os.WriteFile(creds, []byte("-----BEGIN NATS USER JWT-----\neyJ0eXAiOiJKV1QifQ.e30.c2ln\n------END NATS USER JWT------\n"), 0o600))
+	viper.Set("nats_creds", creds)
+	defer viper.Set("nats_creds", "")
+	opts := nats.GetDefaultOptions()
+	for _, o := range msgbus.NATSConnectOptions() {
+		require.NoError(t, o(&opts))
+	}
+	assert.NotNil(t, opts.UserJWT)
+	assert.False(t, opts.Secure)
+}
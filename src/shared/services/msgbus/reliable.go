@@ -0,0 +1,397 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package msgbus
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/shared/services/clock"
+)
+
+// IdempotencyKeyHeader holds the idempotency key of a message. It is the header that JetStream dedupes published
+// messages on, so a message that is published again after its ack was lost is only stored once, as long as it is
+// published again within the duplicate window of the stream.
+const IdempotencyKeyHeader = nats.MsgIdHdr
+
+// DefaultDedupeWindow is how long a subscriber remembers the idempotency keys of the messages that it handled.
+const DefaultDedupeWindow = 10 * time.Minute
+
+// maxDedupeKeys bounds the memory used to remember handled messages, regardless of the dedupe window.
+const maxDedupeKeys = 100000
+
+// DefaultMaxPendingPublishes is the default number of messages that a ReliablePublisher holds while they are waiting
+// to be stored by JetStream.
+const DefaultMaxPendingPublishes = 10000
+
+// How long the publisher waits between attempts to publish a message, at most.
+const maxPublishRetryInterval = 5 * time.Second
+
+// ErrPublisherFull is returned when a message is published while the publisher already holds the most pending
+// messages that it can.
+var ErrPublisherFull = errors.New("too many messages are pending publish")
+
+// ErrPublisherClosed is returned when a message is published after the publisher is closed.
+var ErrPublisherClosed = errors.New("publisher is closed")
+
+var (
+	reliablePublishCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "msgbus_reliable_publishes",
+			Help: "The number of attempts to publish a message with an idempotency key, by outcome.",
+		},
+		[]string{"outcome"},
+	)
+	reliablePendingGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "msgbus_reliable_pending_publishes",
+			Help: "The number of messages that are waiting to be stored by JetStream.",
+		},
+	)
+	reliableDeliveryCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "msgbus_reliable_deliveries",
+			Help: "The number of messages with an idempotency key that were delivered to a subscriber, by outcome.",
+		},
+		[]string{"outcome"},
+	)
+)
+
+// IdempotencyKey returns the idempotency key of the message, or an empty string if it doesn't have one.
+func IdempotencyKey(m Msg) string {
+	nm, ok := m.(*natsMessage)
+	if !ok || nm.Msg.Header == nil {
+		return ""
+	}
+	return nm.Msg.Header.Get(IdempotencyKeyHeader)
+}
+
+// ReliablePublisher publishes messages with at-least-once delivery. Each message is assigned an idempotency key,
+// and is held by the publisher until JetStream has stored it, retrying for as long as it takes. Retries reuse the
+// idempotency key, so JetStream and the subscribers can discard the copies of a message that was stored more than
+// once.
+type ReliablePublisher struct {
+	js         nats.JetStreamContext
+	maxPending int
+
+	mu      sync.Mutex
+	pending *list.List
+	closed  bool
+	// wake is signaled when a message is added, and emptied is closed and replaced when the last one is published.
+	wake    chan struct{}
+	emptied chan struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewReliablePublisher creates a ReliablePublisher that holds at most maxPending messages that are waiting to be
+// published.
+func NewReliablePublisher(js nats.JetStreamContext, maxPending int) *ReliablePublisher {
+	p := &ReliablePublisher{
+		js:         js,
+		maxPending: maxPending,
+		pending:    list.New(),
+		wake:       make(chan struct{}, 1),
+		emptied:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+// Publish queues the data to be published on the subject, and returns the idempotency key of the message.
+func (p *ReliablePublisher) Publish(subject string, data []byte) (string, error) {
+	key := uuid.Must(uuid.NewV4()).String()
+	return key, p.PublishWithKey(subject, key, data)
+}
+
+// PublishWithKey queues the data to be published on the subject with the given idempotency key. Callers that
+// publish the same update more than once, such as after a restart, can derive the key from the update so that it
+// is still only handled once.
+func (p *ReliablePublisher) PublishWithKey(subject, key string, data []byte) error {
+	m := nats.NewMsg(subject)
+	m.Data = data
+	m.Header.Set(IdempotencyKeyHeader, key)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+	if p.pending.Len() >= p.maxPending {
+		return ErrPublisherFull
+	}
+	p.pending.PushBack(m)
+	reliablePendingGauge.Inc()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the number of messages that haven't been stored by JetStream yet.
+func (p *ReliablePublisher) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pending.Len()
+}
+
+// Flush waits until all of the messages that were queued so far are stored by JetStream, or the context is done.
+func (p *ReliablePublisher) Flush(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if p.pending.Len() == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		emptied := p.emptied
+		p.mu.Unlock()
+
+		select {
+		case <-emptied:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close stops the publisher. Messages that weren't published yet are dropped, so callers that need them to be
+// delivered should Flush first.
+func (p *ReliablePublisher) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.done)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := p.pending.Len(); n > 0 {
+		log.WithField("count", n).Warn("Dropping messages that weren't published before the publisher was closed")
+		reliablePendingGauge.Sub(float64(n))
+		p.pending.Init()
+	}
+}
+
+func (p *ReliablePublisher) next() *list.Element {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pending.Front()
+}
+
+func (p *ReliablePublisher) run() {
+	defer p.wg.Done()
+
+	bOpts := backoff.NewExponentialBackOff()
+	bOpts.InitialInterval = publishRetryInterval
+	bOpts.MaxInterval = maxPublishRetryInterval
+	bOpts.MaxElapsedTime = 0
+
+	for {
+		e := p.next()
+		if e == nil {
+			select {
+			case <-p.done:
+				return
+			case <-p.wake:
+				continue
+			}
+		}
+
+		m := e.Value.(*nats.Msg)
+		ack, err := p.js.PublishMsg(m)
+		if err != nil {
+			reliablePublishCounter.With(prometheus.Labels{"outcome": "retry"}).Inc()
+			log.WithError(err).WithField("subject", m.Subject).Debug("Failed to publish message, retrying")
+			select {
+			case <-p.done:
+				return
+			case <-time.After(bOpts.NextBackOff()):
+			}
+			continue
+		}
+		bOpts.Reset()
+
+		outcome := "success"
+		if ack.Duplicate {
+			outcome = "duplicate"
+		}
+		reliablePublishCounter.With(prometheus.Labels{"outcome": outcome}).Inc()
+
+		p.mu.Lock()
+		p.pending.Remove(e)
+		reliablePendingGauge.Dec()
+		if p.pending.Len() == 0 {
+			close(p.emptied)
+			p.emptied = make(chan struct{})
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Deduper remembers the idempotency keys of the messages that were handled successfully, so that the copies of a
+// message that are delivered again are skipped. Keys are remembered for the dedupe window, and only in memory, so
+// handlers should still tolerate the rare duplicate, such as one that is delivered after a restart.
+type Deduper struct {
+	window time.Duration
+	clock  clock.Clock
+
+	mu sync.Mutex
+	// handled maps the keys to their elements in order, which holds the keys from oldest to newest.
+	handled map[string]*list.Element
+	order   *list.List
+}
+
+type handledKey struct {
+	key       string
+	handledAt time.Time
+}
+
+// NewDeduper creates a Deduper that remembers the handled messages for the given window.
+func NewDeduper(window time.Duration) *Deduper {
+	return NewDeduperWithClock(window, clock.New())
+}
+
+// NewDeduperWithClock creates a Deduper that uses the given clock.
+func NewDeduperWithClock(window time.Duration, clk clock.Clock) *Deduper {
+	return &Deduper{
+		window:  window,
+		clock:   clk,
+		handled: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (d *Deduper) expire(now time.Time) {
+	for e := d.order.Front(); e != nil; e = d.order.Front() {
+		hk := e.Value.(*handledKey)
+		if now.Sub(hk.handledAt) < d.window && d.order.Len() <= maxDedupeKeys {
+			return
+		}
+		d.order.Remove(e)
+		delete(d.handled, hk.key)
+	}
+}
+
+func (d *Deduper) seen(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(d.clock.Now())
+	_, ok := d.handled[key]
+	return ok
+}
+
+func (d *Deduper) markHandled(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.handled[key]; ok {
+		return
+	}
+	d.handled[key] = d.order.PushBack(&handledKey{key: key, handledAt: d.clock.Now()})
+	d.expire(d.clock.Now())
+}
+
+// Handler wraps the handler so that it is skipped for messages that were already handled. Messages without an
+// idempotency key are always handled.
+func (d *Deduper) Handler(cb FallibleMsgHandler) FallibleMsgHandler {
+	return func(m Msg) error {
+		key := IdempotencyKey(m)
+		if key == "" {
+			return cb(m)
+		}
+		if d.seen(key) {
+			reliableDeliveryCounter.With(prometheus.Labels{"outcome": "duplicate"}).Inc()
+			return nil
+		}
+		if err := cb(m); err != nil {
+			reliableDeliveryCounter.With(prometheus.Labels{"outcome": "failed"}).Inc()
+			return err
+		}
+		reliableDeliveryCounter.With(prometheus.Labels{"outcome": "handled"}).Inc()
+		d.markHandled(key)
+		return nil
+	}
+}
+
+// ReliableSubscriber subscribes to messages with at-least-once delivery. A message is only acked once it is
+// handled successfully, and is redelivered otherwise. Copies of messages that were already handled are skipped.
+// If a dead-letter queue is given, the messages that keep failing are moved to it instead of being redelivered
+// forever.
+type ReliableSubscriber struct {
+	streamer     Streamer
+	dlq          *DeadLetterQueue
+	dedupeWindow time.Duration
+}
+
+// NewReliableSubscriber creates a ReliableSubscriber. The dead-letter queue may be nil.
+func NewReliableSubscriber(streamer Streamer, dlq *DeadLetterQueue, dedupeWindow time.Duration) *ReliableSubscriber {
+	return &ReliableSubscriber{
+		streamer:     streamer,
+		dlq:          dlq,
+		dedupeWindow: dedupeWindow,
+	}
+}
+
+// Subscribe creates a persistent subscription on the subject, which calls the handler once for each message.
+func (s *ReliableSubscriber) Subscribe(subject, persistentName string, cb FallibleMsgHandler) (PersistentSub, error) {
+	handler := NewDeduper(s.dedupeWindow).Handler(cb)
+	if s.dlq != nil {
+		return s.streamer.PersistentSubscribe(subject, persistentName, s.dlq.Handler(persistentName, handler))
+	}
+	return s.streamer.PersistentSubscribe(subject, persistentName, func(m Msg) {
+		if err := callHandler(handler, m); err != nil {
+			log.WithError(err).WithField("subject", subject).WithField("consumer", persistentName).
+				Info("Failed to handle message, it will be redelivered")
+			nak(m)
+			return
+		}
+		if err := m.Ack(); err != nil {
+			log.WithError(err).Error("Failed to ack message")
+		}
+	})
+}
+
+// nak asks for the message to be redelivered now, rather than once its ack times out.
+func nak(m Msg) {
+	nm, ok := m.(*natsMessage)
+	if !ok {
+		return
+	}
+	if err := nm.Msg.Nak(); err != nil {
+		log.WithError(err).Error("Failed to nak message")
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package msgbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+func newReliableTestStreamCfg() *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:     "reliabletest",
+		Subjects: []string{"reliabletest.>"},
+		MaxAge:   2 * time.Minute,
+		Replicas: 3,
+		Storage:  nats.MemoryStorage,
+		// Keep the duplicate window short, so that the subscribers have to dedupe the messages published again
+		// after it.
+		Duplicates: 100 * time.Millisecond,
+	}
+}
+
+func TestReliablePublisher_RetriesUntilStored(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js := msgbus.MustConnectJetStream(nc)
+
+	p := msgbus.NewReliablePublisher(js, msgbus.DefaultMaxPendingPublishes)
+	defer p.Close()
+
+	// There is no stream to store the message in yet, so the publisher holds on to it.
+	key, err := p.Publish("reliabletest.a", []byte("abc"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, key)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Flush(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 1, p.Pending())
+
+	s, err := msgbus.NewJetStreamStreamer(nc, js, newReliableTestStreamCfg())
+	require.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, p.Flush(ctx))
+	assert.Equal(t, 0, p.Pending())
+
+	m, err := s.PeekLatestMessage("reliabletest.a")
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	assert.Equal(t, "abc", string(m.Data()))
+	assert.Equal(t, key, msgbus.IdempotencyKey(m))
+}
+
+func TestReliablePublisher_Full(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js := msgbus.MustConnectJetStream(nc)
+
+	p := msgbus.NewReliablePublisher(js, 1)
+	_, err := p.Publish("reliabletest.a", []byte("abc"))
+	require.NoError(t, err)
+	_, err = p.Publish("reliabletest.a", []byte("def"))
+	assert.ErrorIs(t, err, msgbus.ErrPublisherFull)
+
+	p.Close()
+	assert.Equal(t, 0, p.Pending())
+	_, err = p.Publish("reliabletest.a", []byte("def"))
+	assert.ErrorIs(t, err, msgbus.ErrPublisherClosed)
+}
+
+func TestReliableSubscriber(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js := msgbus.MustConnectJetStream(nc)
+	s, err := msgbus.NewJetStreamStreamer(nc, js, newReliableTestStreamCfg())
+	require.NoError(t, err)
+	p := msgbus.NewReliablePublisher(js, msgbus.DefaultMaxPendingPublishes)
+	defer p.Close()
+
+	handled := make(chan string, 10)
+	failed := false
+	sub, err := msgbus.NewReliableSubscriber(s, nil, msgbus.DefaultDedupeWindow).Subscribe("reliabletest.a", "indexer",
+		func(m msgbus.Msg) error {
+			d := string(m.Data())
+			if d == "flaky" && !failed {
+				failed = true
+				return errors.New("flaky failure")
+			}
+			handled <- d
+			return nil
+		})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sub.Close()) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, p.PublishWithKey("reliabletest.a", "key1", []byte("abc")))
+	require.NoError(t, p.PublishWithKey("reliabletest.a", "key2", []byte("flaky")))
+	require.NoError(t, p.Flush(ctx))
+	// Publish the first message again after the duplicate window of the stream, so that it is stored twice.
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, p.PublishWithKey("reliabletest.a", "key1", []byte("abc")))
+	require.NoError(t, p.PublishWithKey("reliabletest.a", "key3", []byte("def")))
+	require.NoError(t, p.Flush(ctx))
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case d := <-handled:
+			got = append(got, d)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for messages to be handled")
+		}
+	}
+	assert.ElementsMatch(t, []string{"abc", "flaky", "def"}, got)
+
+	select {
+	case d := <-handled:
+		t.Fatalf("Unexpectedly handled %s again", d)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDeduper_Window(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js := msgbus.MustConnectJetStream(nc)
+	s, err := msgbus.NewJetStreamStreamer(nc, js, newReliableTestStreamCfg())
+	require.NoError(t, err)
+	p := msgbus.NewReliablePublisher(js, msgbus.DefaultMaxPendingPublishes)
+	defer p.Close()
+
+	_, err = p.Publish("reliabletest.a", []byte("abc"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, p.Flush(ctx))
+	m, err := s.PeekLatestMessage("reliabletest.a")
+	require.NoError(t, err)
+	require.NotNil(t, m)
+
+	calls := 0
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	handler := msgbus.NewDeduperWithClock(time.Minute, clk).Handler(func(m msgbus.Msg) error {
+		calls++
+		return nil
+	})
+
+	require.NoError(t, handler(m))
+	require.NoError(t, handler(m))
+	assert.Equal(t, 1, calls)
+
+	// The message is handled again once it is older than the dedupe window.
+	clk.Advance(time.Minute)
+	require.NoError(t, handler(m))
+	assert.Equal(t, 2, calls)
+}
@@ -19,6 +19,7 @@
 package msgbus
 
 import (
+	"context"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -90,6 +91,10 @@ type Streamer interface {
 	// Publish publishes the data to the specific subject.
 	Publish(subject string, data []byte) error
 
+	// PublishWithContext publishes the data to the specific subject, with the trace context and baggage of the
+	// context. The handler of the message can get them with MsgContext.
+	PublishWithContext(ctx context.Context, subject string, data []byte) error
+
 	// PeekLatestMessage returns the last message published on a subject. If no messages
 	// exist for the subject method returns `nil`.
 	//
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package msgbus
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "px.dev/pixie/src/shared/services/msgbus"
+
+// headerCarrier lets the trace context and baggage be carried in the headers of a NATS message.
+type headerCarrier nats.Header
+
+func (c headerCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	nats.Header(c).Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectContext adds the trace context and baggage of the context to the headers of the message.
+func InjectContext(ctx context.Context, msg *nats.Msg) {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(msg.Header))
+}
+
+// ContextFromNATSMsg returns a context with the trace context and baggage in the headers of the message.
+func ContextFromNATSMsg(msg *nats.Msg) context.Context {
+	ctx := context.Background()
+	if msg == nil || msg.Header == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(msg.Header))
+}
+
+func messagingAttributes(subject string, operation attribute.KeyValue) trace.SpanStartOption {
+	return trace.WithAttributes(
+		semconv.MessagingSystem("nats"),
+		semconv.MessagingDestinationName(subject),
+		operation,
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startPublishSpan starts the span of a message that is published on the subject, and adds its trace context to
+// the message.
+func startPublishSpan(ctx context.Context, msg *nats.Msg) trace.Span {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, msg.Subject+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer), messagingAttributes(msg.Subject, semconv.MessagingOperationPublish))
+	InjectContext(ctx, msg)
+	return span
+}
+
+// startProcessSpan starts the span of the handling of the message, as a child of the span that published it.
+func startProcessSpan(msg *nats.Msg) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ContextFromNATSMsg(msg), msg.Subject+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer), messagingAttributes(msg.Subject, semconv.MessagingOperationProcess))
+}
+
+// PublishWithContext publishes the data on the subject, with the trace context and baggage of the context, so that
+// the handling of the message is part of the same trace.
+func PublishWithContext(ctx context.Context, nc *nats.Conn, subject string, data []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	span := startPublishSpan(ctx, msg)
+	err := nc.PublishMsg(msg)
+	endSpan(span, err)
+	return err
+}
+
+// TraceHandler wraps a handler of NATS messages, so that the handling of each message is traced, and is given the
+// context of the message.
+func TraceHandler(cb func(ctx context.Context, msg *nats.Msg)) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		ctx, span := startProcessSpan(msg)
+		defer span.End()
+		cb(ctx, msg)
+	}
+}
+
+// MsgContext returns the context of a message received from a Streamer, which carries the trace context and baggage
+// of its publisher.
+func MsgContext(m Msg) context.Context {
+	if nm, ok := m.(*natsMessage); ok && nm.ctx != nil {
+		return nm.ctx
+	}
+	return context.Background()
+}
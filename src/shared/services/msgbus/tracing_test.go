@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package msgbus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/tracing"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+// setupTestTracing records all of the spans that are started during the test.
+func setupTestTracing(t *testing.T) *tracetest.SpanRecorder {
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	tracing.Setup("test")
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	require.Failf(t, "missing span", "no span named %s", name)
+	return nil
+}
+
+func TestPublishWithContext(t *testing.T) {
+	recorder := setupTestTracing(t)
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	ctxCh := make(chan context.Context, 1)
+	sub, err := nc.Subscribe("abc", msgbus.TraceHandler(func(ctx context.Context, msg *nats.Msg) {
+		assert.Equal(t, []byte("123"), msg.Data)
+		ctxCh <- ctx
+	}))
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	ctx = tracing.WithRequestID(ctx, "req-1")
+	require.NoError(t, msgbus.PublishWithContext(ctx, nc, "abc", []byte("123")))
+	parent.End()
+
+	var handlerCtx context.Context
+	select {
+	case handlerCtx = <-ctxCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+	assert.Equal(t, "req-1", tracing.RequestID(handlerCtx))
+	assert.Equal(t, parent.SpanContext().TraceID(), trace.SpanContextFromContext(handlerCtx).TraceID())
+
+	assert.Eventually(t, func() bool {
+		return len(recorder.Ended()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	publish := findSpan(t, recorder, "abc publish")
+	process := findSpan(t, recorder, "abc process")
+	assert.Equal(t, trace.SpanKindProducer, publish.SpanKind())
+	assert.Equal(t, trace.SpanKindConsumer, process.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), publish.Parent().SpanID())
+	assert.Equal(t, publish.SpanContext().SpanID(), process.Parent().SpanID())
+}
+
+func TestJetStream_PublishWithContext(t *testing.T) {
+	setupTestTracing(t)
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+	js := msgbus.MustConnectJetStream(nc)
+	s, err := msgbus.NewJetStreamStreamer(nc, js, testStreamCfg)
+	require.NoError(t, err)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	ctx = tracing.WithRequestID(ctx, "req-1")
+	require.NoError(t, s.PublishWithContext(ctx, "abc", []byte("123")))
+	// Messages published without a context start a new trace.
+	require.NoError(t, s.Publish("abc", []byte("456")))
+	parent.End()
+
+	msgCh := make(chan msgbus.Msg, 2)
+	pSub, err := s.PersistentSubscribe("abc", "indexer", func(m msgbus.Msg) {
+		msgCh <- m
+		require.NoError(t, m.Ack())
+	})
+	require.NoError(t, err)
+	defer pSub.Close()
+
+	var msgs []msgbus.Msg
+	for len(msgs) < 2 {
+		select {
+		case m := <-msgCh:
+			msgs = append(msgs, m)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for messages")
+		}
+	}
+
+	assert.Equal(t, []byte("123"), msgs[0].Data())
+	msgCtx := msgbus.MsgContext(msgs[0])
+	assert.Equal(t, "req-1", tracing.RequestID(msgCtx))
+	assert.Equal(t, parent.SpanContext().TraceID(), trace.SpanContextFromContext(msgCtx).TraceID())
+
+	assert.Equal(t, []byte("456"), msgs[1].Data())
+	msgCtx = msgbus.MsgContext(msgs[1])
+	assert.Equal(t, "", tracing.RequestID(msgCtx))
+	assert.NotEqual(t, parent.SpanContext().TraceID(), trace.SpanContextFromContext(msgCtx).TraceID())
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"px.dev/pixie/src/shared/services/authcontext"
+)
+
+// setupOIDCFlags sets up flags for services that fetch their auth tokens using the OIDC
+// client credentials flow, and for servers that accept the tokens issued that way.
+func setupOIDCFlags() {
+	pflag.String("service_oidc_token_url", "", "The OIDC token endpoint used to fetch service tokens. Leave empty to use static JWTs.")
+	pflag.String("service_oidc_client_id", "", "The OIDC client ID for this service.")
+	pflag.String("service_oidc_client_secret", "", "The OIDC client secret for this service.")
+	pflag.StringSlice("service_oidc_scopes", []string{}, "The scopes to request with the OIDC service token.")
+	pflag.String("service_oidc_audience", "", "The audience of OIDC service tokens. Clients request it, and servers only accept tokens issued for it.")
+	pflag.String("service_oidc_issuer", "", "The expected issuer of OIDC service tokens.")
+	pflag.String("service_oidc_jwks_url", "", "The URL of the OIDC provider's JSON Web Key Set. Leave empty to only accept static JWTs.")
+}
+
+// checkOIDCFlags checks that the OIDC flags are complete for whichever OIDC auth is enabled.
+func checkOIDCFlags() {
+	if OIDCClientCredentialsEnabled() && len(viper.GetString("service_oidc_client_id")) == 0 {
+		log.Panicf("Flag --service_oidc_client_id or ENV %s_SERVICE_OIDC_CLIENT_ID is required when --service_oidc_token_url is set", envPrefix)
+	}
+	if OIDCVerificationEnabled() {
+		if len(viper.GetString("service_oidc_issuer")) == 0 {
+			log.Panicf("Flag --service_oidc_issuer or ENV %s_SERVICE_OIDC_ISSUER is required when --service_oidc_jwks_url is set", envPrefix)
+		}
+		if len(viper.GetString("service_oidc_audience")) == 0 {
+			log.Panicf("Flag --service_oidc_audience or ENV %s_SERVICE_OIDC_AUDIENCE is required when --service_oidc_jwks_url is set", envPrefix)
+		}
+	}
+}
+
+// OIDCClientCredentialsEnabled returns whether the service is configured to fetch tokens from an OIDC provider.
+func OIDCClientCredentialsEnabled() bool {
+	return viper.GetString("service_oidc_token_url") != ""
+}
+
+// OIDCVerificationEnabled returns whether the server is configured to accept tokens issued by an OIDC provider.
+func OIDCVerificationEnabled() bool {
+	return viper.GetString("service_oidc_jwks_url") != ""
+}
+
+// GetOIDCVerifier creates a verifier for OIDC service tokens using the OIDC server flags.
+func GetOIDCVerifier(ctx context.Context) (*authcontext.OIDCVerifier, error) {
+	return authcontext.NewOIDCVerifier(ctx,
+		viper.GetString("service_oidc_issuer"),
+		viper.GetString("service_oidc_jwks_url"),
+		viper.GetString("service_oidc_audience"))
+}
+
+// oidcCredentials attaches a bearer token fetched with the client credentials flow to every RPC.
+type oidcCredentials struct {
+	ts         oauth2.TokenSource
+	requireTLS bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c *oidcCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	// Calls that already carry a token, such as ones made on behalf of a user, keep it.
+	// Sending a second authorization header would leave the server to pick one.
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		return nil, nil
+	}
+	token, err := c.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"authorization": token.Type() + " " + token.AccessToken,
+	}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c *oidcCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// NewOIDCPerRPCCredentials creates gRPC credentials that fetch tokens from the given token endpoint.
+// Tokens are cached and only refreshed once they are close to expiry.
+func NewOIDCPerRPCCredentials(tokenURL, clientID, clientSecret string, scopes []string, audience string, requireTLS bool) credentials.PerRPCCredentials {
+	cfg := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       scopes,
+		AuthStyle:    oauth2.AuthStyleInHeader,
+	}
+	if audience != "" {
+		cfg.EndpointParams = map[string][]string{"audience": {audience}}
+	}
+	// The clientcredentials TokenSource already wraps itself in a ReuseTokenSource,
+	// so tokens are reused until they expire.
+	return &oidcCredentials{
+		ts:         cfg.TokenSource(context.Background()),
+		requireTLS: requireTLS,
+	}
+}
+
+// GetOIDCPerRPCCredentials creates gRPC credentials using the OIDC client flags.
+func GetOIDCPerRPCCredentials() credentials.PerRPCCredentials {
+	return NewOIDCPerRPCCredentials(
+		viper.GetString("service_oidc_token_url"),
+		viper.GetString("service_oidc_client_id"),
+		viper.GetString("service_oidc_client_secret"),
+		viper.GetStringSlice("service_oidc_scopes"),
+		viper.GetString("service_oidc_audience"),
+		SSLEnabled(),
+	)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestOIDCCredentials_GetRequestMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"service-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	creds := NewOIDCPerRPCCredentials(srv.URL, "client", "secret", nil, "pixie", false)
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer service-token"}, md)
+
+	// A call that already carries a token must not get a second authorization header.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "bearer user-token")
+	md, err = creds.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, md)
+}
+
+func TestCheckOIDCFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		flags  map[string]string
+		panics bool
+	}{
+		{name: "disabled"},
+		{
+			name:  "client",
+			flags: map[string]string{"service_oidc_token_url": "https://idp/token", "service_oidc_client_id": "client"},
+		},
+		{
+			name:   "client without ID",
+			flags:  map[string]string{"service_oidc_token_url": "https://idp/token"},
+			panics: true,
+		},
+		{
+			name: "server",
+			flags: map[string]string{
+				"service_oidc_jwks_url": "https://idp/jwks",
+				"service_oidc_issuer":   "https://idp",
+				"service_oidc_audience": "pixie",
+			},
+		},
+		{
+			name:   "server without issuer",
+			flags:  map[string]string{"service_oidc_jwks_url": "https://idp/jwks", "service_oidc_audience": "pixie"},
+			panics: true,
+		},
+		{
+			name:   "server without audience",
+			flags:  map[string]string{"service_oidc_jwks_url": "https://idp/jwks", "service_oidc_issuer": "https://idp"},
+			panics: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			for k, v := range tc.flags {
+				viper.Set(k, v)
+			}
+			if tc.panics {
+				assert.Panics(t, checkOIDCFlags)
+			} else {
+				assert.NotPanics(t, checkOIDCFlags)
+			}
+		})
+	}
+}
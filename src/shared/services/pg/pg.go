@@ -19,6 +19,7 @@
 package pg
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
@@ -32,10 +33,19 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/shared/services/retry"
 )
 
-const retryAttempts = 5
-const retryDelay = 1 * time.Second
+// connectRetryPolicy is the policy for retrying connecting to the database when a service starts, while the
+// database may still be starting up too.
+var connectRetryPolicy = retry.Policy{
+	InitialInterval: 1 * time.Second,
+	MaxAttempts:     6,
+	Notify: func(err error, next time.Duration) {
+		log.WithError(err).Errorf("failed to connect to DB, retrying in %s", next)
+	},
+}
 
 func init() {
 	pflag.Uint32("postgres_port", 5432, "The port for postgres database")
@@ -101,21 +111,10 @@ func MustCreateDefaultPostgresDB() *sqlx.DB {
 // variables/flags.
 func MustConnectDefaultPostgresDB() *sqlx.DB {
 	db := MustCreateDefaultPostgresDB()
-	var err error
-	for i := retryAttempts; i >= 0; i-- {
-		err = db.Ping()
-		if err == nil {
-			log.Info("Connected to Postgres")
-			break
-		}
-		if i > 0 {
-			log.WithError(err).Error("failed to connect to DB, retrying")
-			time.Sleep(retryDelay)
-		}
-	}
-
+	err := retry.Do(context.Background(), connectRetryPolicy, db.Ping)
 	if err != nil {
 		log.WithError(err).Fatalf("failed to initialized database connection")
 	}
+	log.Info("Connected to Postgres")
 	return db
 }
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"px.dev/pixie/src/shared/services/clock"
+)
+
+// Breaker is a circuit breaker for a single dependency. After a number of consecutive failures it
+// opens, and attempts to call the dependency are skipped until a cooldown has passed. Then a
+// single attempt is let through: if it succeeds the breaker closes, otherwise it stays open for
+// another cooldown.
+type Breaker struct {
+	mu        sync.Mutex
+	clock     clock.Clock
+	threshold int
+	cooldown  time.Duration
+
+	failures int
+	open     bool
+	openedAt time.Time
+	// probing is set while the single attempt after a cooldown is in flight.
+	probing bool
+}
+
+// NewBreaker creates a breaker which opens after threshold consecutive failures, for cooldown.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return NewBreakerWithClock(threshold, cooldown, clock.New())
+}
+
+// NewBreakerWithClock creates a breaker which measures its cooldown with the given clock.
+func NewBreakerWithClock(threshold int, cooldown time.Duration, c clock.Clock) *Breaker {
+	return &Breaker{
+		clock:     c,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns whether the dependency should be called.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || b.clock.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Success records a successful call to the dependency.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.open = false
+	b.probing = false
+}
+
+// Failure records a failed call to the dependency.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.open = true
+		b.openedAt = b.clock.Now()
+	}
+	b.probing = false
+}
+
+// Open returns whether the breaker is currently skipping calls to the dependency.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package retry
+
+import (
+	"sync"
+)
+
+// Budget limits retries to a fraction of the operations that share it. Each operation earns the
+// budget ratio tokens, and each retry spends one, so that while a dependency fails, the callers
+// send it at most 1+ratio times their normal load rather than multiplying it.
+type Budget struct {
+	mu        sync.Mutex
+	ratio     float64
+	maxTokens float64
+	tokens    float64
+
+	retries   int64
+	exhausted int64
+}
+
+// NewBudget creates a budget which allows ratio retries per operation. maxTokens caps how many
+// retries can be saved up while operations succeed, and is also the number of retries available
+// to begin with.
+func NewBudget(ratio float64, maxTokens float64) *Budget {
+	return &Budget{
+		ratio:     ratio,
+		maxTokens: maxTokens,
+		tokens:    maxTokens,
+	}
+}
+
+func (b *Budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+func (b *Budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		b.exhausted++
+		return false
+	}
+	b.tokens--
+	b.retries++
+	return true
+}
+
+// BudgetStats is a snapshot of the use of a Budget.
+type BudgetStats struct {
+	// Available is the number of retries that the budget currently allows.
+	Available float64
+	// Retries is the number of retries that the budget has allowed.
+	Retries int64
+	// Exhausted is the number of retries that the budget has refused.
+	Exhausted int64
+}
+
+// Stats returns how much of the budget has been used.
+func (b *Budget) Stats() BudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BudgetStats{
+		Available: b.tokens,
+		Retries:   b.retries,
+		Exhausted: b.exhausted,
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package retry retries operations with exponential backoff and jitter. Retries can be limited by
+// a Budget shared by all callers of a dependency, so that retries can't multiply the load on a
+// dependency that is struggling, and skipped by a Breaker while the dependency is known to be down.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"px.dev/pixie/src/shared/services/clock"
+)
+
+const (
+	defaultInitialInterval = 500 * time.Millisecond
+	defaultMultiplier      = 1.5
+	defaultMaxInterval     = 60 * time.Second
+	defaultJitter          = 0.5
+)
+
+var (
+	// ErrBudgetExhausted is returned when an operation failed, and its retry budget doesn't allow
+	// another attempt.
+	ErrBudgetExhausted = errors.New("retry budget exhausted")
+	// ErrCircuitOpen is the error of attempts that were skipped because the circuit breaker is open.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// Policy configures how an operation is retried. The zero value retries forever, starting at
+// 500ms between attempts and backing off to at most one minute.
+type Policy struct {
+	// InitialInterval is the time to wait before the first retry. Defaults to 500ms.
+	InitialInterval time.Duration
+	// Multiplier is the factor that the interval grows by with each retry. Defaults to 1.5.
+	Multiplier float64
+	// MaxInterval caps the time between retries. Defaults to one minute.
+	MaxInterval time.Duration
+	// DisableJitter turns off the randomization of the intervals, which otherwise vary by up to
+	// 50% so that callers that failed together don't retry together.
+	DisableJitter bool
+	// MaxElapsedTime stops retrying once this much time has passed since the first attempt. Zero
+	// means no limit.
+	MaxElapsedTime time.Duration
+	// MaxAttempts stops retrying after this many attempts, including the first. Zero means no limit.
+	MaxAttempts int
+
+	// Budget, if set, limits the retries of all the operations sharing it.
+	Budget *Budget
+	// Breaker, if set, skips attempts while the dependency that the operation calls is failing.
+	Breaker *Breaker
+
+	// Notify, if set, is called with the error of each failed attempt that will be retried, and
+	// the time until the next attempt.
+	Notify func(err error, next time.Duration)
+	// Clock is the clock that is waited on between attempts. Defaults to the real clock.
+	Clock clock.Clock
+}
+
+// Permanent wraps an error to stop retrying it. Do returns the wrapped error.
+func Permanent(err error) error {
+	return backoff.Permanent(err)
+}
+
+func (p *Policy) newBackOff(c clock.Clock) backoff.BackOff {
+	b := clock.NewExponentialBackOff(c)
+	b.InitialInterval = defaultInitialInterval
+	if p.InitialInterval > 0 {
+		b.InitialInterval = p.InitialInterval
+	}
+	b.Multiplier = defaultMultiplier
+	if p.Multiplier > 0 {
+		b.Multiplier = p.Multiplier
+	}
+	b.MaxInterval = defaultMaxInterval
+	if p.MaxInterval > 0 {
+		b.MaxInterval = p.MaxInterval
+	}
+	b.RandomizationFactor = defaultJitter
+	if p.DisableJitter {
+		b.RandomizationFactor = 0
+	}
+	b.MaxElapsedTime = p.MaxElapsedTime
+	b.Reset()
+
+	if p.MaxAttempts > 0 {
+		return backoff.WithMaxRetries(b, uint64(p.MaxAttempts-1))
+	}
+	return b
+}
+
+func (p *Policy) attempt(op func() error) error {
+	if p.Breaker == nil {
+		return op()
+	}
+	if !p.Breaker.Allow() {
+		return ErrCircuitOpen
+	}
+	err := op()
+	var permanent *backoff.PermanentError
+	switch {
+	case err == nil:
+		p.Breaker.Success()
+	case errors.As(err, &permanent):
+		// A permanent error is a problem with the request rather than the dependency.
+		p.Breaker.Success()
+	default:
+		p.Breaker.Failure()
+	}
+	return err
+}
+
+// Do calls op until it succeeds, returns a Permanent error, or the policy stops retrying. It
+// returns nil on success, the context's error if the context is done, and otherwise the error of
+// the last attempt.
+func Do(ctx context.Context, p Policy, op func() error) error {
+	c := p.Clock
+	if c == nil {
+		c = clock.New()
+	}
+	b := p.newBackOff(c)
+	timer := clock.NewBackoffTimer(c)
+	defer timer.Stop()
+
+	if p.Budget != nil {
+		p.Budget.deposit()
+	}
+	for {
+		err := p.attempt(op)
+		if err == nil {
+			return nil
+		}
+		var permanent *backoff.PermanentError
+		if errors.As(err, &permanent) {
+			return permanent.Err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			return err
+		}
+		if p.Budget != nil && !p.Budget.withdraw() {
+			return fmt.Errorf("%w: %v", ErrBudgetExhausted, err)
+		}
+		if p.Notify != nil {
+			p.Notify(err, next)
+		}
+
+		timer.Start(next)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
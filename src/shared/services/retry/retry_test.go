@@ -0,0 +1,240 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/shared/services/retry"
+)
+
+var errTest = errors.New("test error")
+
+// runWithClock runs Do in the background, advancing the fake clock past each wait between attempts
+// until Do returns. It returns the error from Do and the waits.
+func runWithClock(t *testing.T, ctx context.Context, c *clock.FakeClock, p retry.Policy, op func() error) (error, []time.Duration) {
+	var waits []time.Duration
+	waitCh := make(chan time.Duration)
+	p.Clock = c
+	p.Notify = func(err error, next time.Duration) {
+		waitCh <- next
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- retry.Do(ctx, p, op)
+	}()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err, waits
+		case next := <-waitCh:
+			waits = append(waits, next)
+			c.BlockUntil(1)
+			c.Advance(next)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for retries")
+		}
+	}
+}
+
+func failNTimes(n int) (func() error, *int) {
+	calls := 0
+	return func() error {
+		calls++
+		if calls <= n {
+			return errTest
+		}
+		return nil
+	}, &calls
+}
+
+func TestDo_BacksOffUntilSuccess(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	op, calls := failNTimes(3)
+
+	err, waits := runWithClock(t, context.Background(), c, retry.Policy{
+		InitialInterval: time.Second,
+		Multiplier:      2,
+		DisableJitter:   true,
+	}, op)
+	require.NoError(t, err)
+	assert.Equal(t, 4, *calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, waits)
+}
+
+func TestDo_MaxInterval(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	op, _ := failNTimes(4)
+
+	err, waits := runWithClock(t, context.Background(), c, retry.Policy{
+		InitialInterval: time.Second,
+		Multiplier:      3,
+		MaxInterval:     5 * time.Second,
+		DisableJitter:   true,
+	}, op)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second}, waits)
+}
+
+func TestDo_Jitter(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	op, _ := failNTimes(5)
+
+	err, waits := runWithClock(t, context.Background(), c, retry.Policy{
+		InitialInterval: time.Second,
+		Multiplier:      1,
+	}, op)
+	require.NoError(t, err)
+	for _, w := range waits {
+		assert.GreaterOrEqual(t, w, 500*time.Millisecond)
+		assert.LessOrEqual(t, w, 1500*time.Millisecond)
+	}
+}
+
+func TestDo_MaxAttempts(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	op, calls := failNTimes(10)
+
+	err, _ := runWithClock(t, context.Background(), c, retry.Policy{
+		InitialInterval: time.Second,
+		MaxAttempts:     3,
+	}, op)
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 3, *calls)
+}
+
+func TestDo_MaxElapsedTime(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	op, calls := failNTimes(10)
+
+	err, _ := runWithClock(t, context.Background(), c, retry.Policy{
+		InitialInterval: time.Second,
+		Multiplier:      1,
+		DisableJitter:   true,
+		MaxElapsedTime:  3500 * time.Millisecond,
+	}, op)
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 4, *calls)
+}
+
+func TestDo_Permanent(t *testing.T) {
+	calls := 0
+	err := retry.Do(context.Background(), retry.Policy{}, func() error {
+		calls++
+		return retry.Permanent(errTest)
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDo_ContextCanceled(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- retry.Do(ctx, retry.Policy{Clock: c}, func() error { return errTest })
+	}()
+	c.BlockUntil(1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-errCh)
+}
+
+func TestDo_Budget(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	budget := retry.NewBudget(0.5, 2)
+	op, calls := failNTimes(10)
+
+	// The budget starts full with two retries, so the retries run out on the third attempt.
+	err, _ := runWithClock(t, context.Background(), c, retry.Policy{
+		InitialInterval: time.Second,
+		Budget:          budget,
+	}, op)
+	assert.ErrorIs(t, err, retry.ErrBudgetExhausted)
+	assert.ErrorContains(t, err, errTest.Error())
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, retry.BudgetStats{Available: 0, Retries: 2, Exhausted: 1}, budget.Stats())
+
+	// Successful operations refill the budget, up to its maximum.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, retry.Do(context.Background(), retry.Policy{Budget: budget}, func() error { return nil }))
+	}
+	assert.Equal(t, 2.0, budget.Stats().Available)
+}
+
+func TestDo_Breaker(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	breaker := retry.NewBreakerWithClock(2, 10*time.Second, c)
+	op, calls := failNTimes(2)
+
+	// The breaker opens after two failures, so the attempts until the cooldown has passed are
+	// skipped. The attempt after the cooldown succeeds and closes the breaker.
+	err, waits := runWithClock(t, context.Background(), c, retry.Policy{
+		InitialInterval: 4 * time.Second,
+		Multiplier:      1,
+		DisableJitter:   true,
+		Breaker:         breaker,
+	}, op)
+	require.NoError(t, err)
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, 4, len(waits))
+	assert.False(t, breaker.Open())
+}
+
+func TestBreaker(t *testing.T) {
+	c := clock.NewFakeClock(time.Unix(0, 0))
+	b := retry.NewBreakerWithClock(3, time.Minute, c)
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.Allow())
+		b.Failure()
+	}
+	// A success resets the count of consecutive failures.
+	b.Success()
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.Allow())
+		b.Failure()
+	}
+	assert.True(t, b.Open())
+	assert.False(t, b.Allow())
+
+	// After the cooldown, a single attempt is let through.
+	c.Advance(time.Minute)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+
+	// If it fails, the breaker stays open for another cooldown.
+	b.Failure()
+	assert.True(t, b.Open())
+	assert.False(t, b.Allow())
+	c.Advance(time.Minute)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.False(t, b.Open())
+	assert.True(t, b.Allow())
+}
@@ -28,15 +28,20 @@ import (
 	grpc_logrus "github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 
 	// Enables gzip encoding for GRPC.
 	_ "google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/env"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/shared/services/versionz"
 )
 
 var logrusEntry *log.Entry
@@ -52,20 +57,44 @@ type GRPCServerOptions struct {
 	AuthMiddleware    func(context.Context, env.Env) (string, error) // Currently only used by cloud api-server.
 	GRPCServerOpts    []grpc.ServerOption
 	DisableMiddleware bool
+	// OIDCVerifier, if set, also accepts tokens that services obtained from an OIDC
+	// provider with the client credentials flow. If unset, it is created from the
+	// service_oidc flags when --service_oidc_jwks_url is set.
+	OIDCVerifier *authcontext.OIDCVerifier
+	// EnableGRPCWeb and EnableRESTGateway also serve the GRPC services to gRPC-Web and JSON/REST
+	// clients on the same port. They can also be turned on with the enable_grpc_web and
+	// enable_rest_gateway flags.
+	EnableGRPCWeb     bool
+	EnableRESTGateway bool
+	// Authorize, if set, is called once the caller is authenticated. It rejects the calls that the caller
+	// may not make, such as those that the scopes of its token don't allow. Errors without a status are
+	// returned as PermissionDenied.
+	Authorize func(*authcontext.AuthContext) error
 }
 
-func grpcUnaryInjectSession() grpc.UnaryServerInterceptor {
+// newSession creates the auth context of a GRPC call. When TLS is delegated to a service mesh, the mesh
+// authenticates the caller and forwards its identity in the metadata.
+func newSession(ctx context.Context, path string, trustMesh bool) *authcontext.AuthContext {
+	sCtx := authcontext.New()
+	sCtx.Path = path
+	if trustMesh {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			sCtx.PeerIdentity = authcontext.PeerIdentityFromMD(md)
+		}
+	}
+	return sCtx
+}
+
+func grpcUnaryInjectSession(trustMesh bool) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		sCtx := authcontext.New()
-		sCtx.Path = info.FullMethod
+		sCtx := newSession(ctx, info.FullMethod, trustMesh)
 		return handler(authcontext.NewContext(ctx, sCtx), req)
 	}
 }
 
-func grpcStreamInjectSession() grpc.StreamServerInterceptor {
+func grpcStreamInjectSession(trustMesh bool) grpc.StreamServerInterceptor {
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		sCtx := authcontext.New()
-		sCtx.Path = info.FullMethod
+		sCtx := newSession(stream.Context(), info.FullMethod, trustMesh)
 		wrapped := grpc_middleware.WrapServerStream(stream)
 		wrapped.WrappedContext = authcontext.NewContext(stream.Context(), sCtx)
 		return handler(srv, wrapped)
@@ -85,10 +114,18 @@ func createGRPCAuthFunc(env env.Env, opts *GRPCServerOptions) func(context.Conte
 		if _, ok := opts.DisableAuth[sCtx.Path]; ok {
 			return ctx, nil
 		}
+		// Clients check the version of a service before they call it, whether or not they have credentials for it.
+		if sCtx.Path == versionz.GetVersionMethod {
+			return ctx, nil
+		}
 
 		if opts.AuthMiddleware != nil {
 			token, err = opts.AuthMiddleware(ctx, env)
 			if err != nil {
+				// Errors that already have a status, such as denied permissions, are returned as is.
+				if _, ok := status.FromError(err); ok {
+					return nil, err
+				}
 				return nil, status.Errorf(codes.Internal, "Auth middleware failed: %v", err)
 			}
 		} else {
@@ -99,9 +136,25 @@ func createGRPCAuthFunc(env env.Env, opts *GRPCServerOptions) func(context.Conte
 		}
 
 		err = sCtx.UseJWTAuth(env.JWTSigningKey(), token, env.Audience())
+		if err != nil && opts.OIDCVerifier != nil {
+			err = sCtx.UseOIDCAuth(ctx, opts.OIDCVerifier, token)
+		}
 		if err != nil {
 			return nil, status.Errorf(codes.Unauthenticated, "invalid auth token: %v", err)
 		}
+		// A service token that leaked out of the cluster is only accepted from the services themselves.
+		if srvutils.GetClaimsType(sCtx.Claims) == srvutils.ServiceClaimType && !services.ServicePeerAllowed(sCtx.PeerIdentity) {
+			return nil, status.Errorf(codes.PermissionDenied, "service tokens are not accepted from peer %q", sCtx.PeerIdentity)
+		}
+
+		if opts.Authorize != nil {
+			if err := opts.Authorize(sCtx); err != nil {
+				if _, ok := status.FromError(err); ok {
+					return nil, err
+				}
+				return nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+		}
 		return ctx, nil
 	}
 }
@@ -127,18 +180,29 @@ func CreateGRPCServer(env env.Env, serverOpts *GRPCServerOptions) *grpc.Server {
 		grpc_logrus.WithLevels(codeToLevel),
 		grpc_logrus.WithDecider(logDecider),
 	}
+	if serverOpts.OIDCVerifier == nil && services.OIDCVerificationEnabled() {
+		verifier, err := services.GetOIDCVerifier(context.Background())
+		if err != nil {
+			log.WithError(err).Fatal("Failed to set up OIDC token verification")
+		}
+		serverOpts.OIDCVerifier = verifier
+	}
+
+	trustMesh := services.GetTLSMode() == services.TLSModeMesh
 	opts := []grpc.ServerOption{}
 	if !serverOpts.DisableMiddleware {
 		opts = append(opts,
 			grpc_middleware.WithUnaryServerChain(
+				otelgrpc.UnaryServerInterceptor(),
 				grpc_ctxtags.UnaryServerInterceptor(),
-				grpcUnaryInjectSession(),
+				grpcUnaryInjectSession(trustMesh),
 				grpc_logrus.UnaryServerInterceptor(logrusEntry, logrusOpts...),
 				grpc_auth.UnaryServerInterceptor(createGRPCAuthFunc(env, serverOpts)),
 			),
 			grpc_middleware.WithStreamServerChain(
+				otelgrpc.StreamServerInterceptor(),
 				grpc_ctxtags.StreamServerInterceptor(),
-				grpcStreamInjectSession(),
+				grpcStreamInjectSession(trustMesh),
 				grpc_logrus.StreamServerInterceptor(logrusEntry, logrusOpts...),
 				grpc_auth.StreamServerInterceptor(createGRPCAuthFunc(env, serverOpts)),
 			),
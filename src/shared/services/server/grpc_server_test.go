@@ -35,9 +35,12 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
+	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/env"
 	"px.dev/pixie/src/shared/services/server"
 	ping "px.dev/pixie/src/shared/services/testproto"
+	"px.dev/pixie/src/shared/services/versionz"
+	"px.dev/pixie/src/shared/services/versionz/versionzpb"
 	"px.dev/pixie/src/utils/testingutils"
 )
 
@@ -280,3 +283,133 @@ func TestGrpcServerUnary(t *testing.T) {
 		})
 	}
 }
+
+func TestGrpcServer_Authorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		expCode codes.Code
+	}{
+		{name: "allowed", path: "/px.common.PingService/Ping", expCode: codes.OK},
+		{name: "denied", path: "/px.common.PingService/Other", expCode: codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lis, cleanup := startTestGRPCServer(&server.GRPCServerOptions{
+				Authorize: func(sCtx *authcontext.AuthContext) error {
+					if sCtx.Claims == nil {
+						return status.Error(codes.Internal, "not authenticated")
+					}
+					if sCtx.Path != test.path {
+						return fmt.Errorf("%s isn't allowed", sCtx.Path)
+					}
+					return nil
+				},
+			})
+			defer cleanup(t)
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(),
+				"authorization", "bearer "+testingutils.GenerateTestJWTToken(t, "abc"))
+			_, err := makeTestRequest(ctx, t, lis)
+			assert.Equal(t, test.expCode, status.Code(err))
+		})
+	}
+}
+
+func TestGrpcServer_MeshPeerIdentity(t *testing.T) {
+	const xfcc = "Hash=abcd;URI=spiffe://cluster.local/ns/pl/sa/query-broker"
+	tests := []struct {
+		name     string
+		tlsMode  string
+		expected string
+	}{
+		{name: "mesh", tlsMode: "mesh", expected: "spiffe://cluster.local/ns/pl/sa/query-broker"},
+		{name: "headers are untrusted without the mesh", tlsMode: "disabled", expected: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("tls_mode", test.tlsMode)
+			defer viper.Set("tls_mode", "")
+
+			var peerIdentity string
+			lis, cleanup := startTestGRPCServer(&server.GRPCServerOptions{
+				AuthMiddleware: func(ctx context.Context, e env.Env) (string, error) {
+					aCtx, err := authcontext.FromContext(ctx)
+					if err != nil {
+						return "", err
+					}
+					peerIdentity = aCtx.PeerIdentity
+					return testingutils.GenerateTestJWTToken(t, "abc"), nil
+				},
+			})
+			defer cleanup(t)
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), authcontext.XFCCHeader, xfcc)
+			_, err := makeTestRequest(ctx, t, lis)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, peerIdentity)
+		})
+	}
+}
+
+func TestGrpcServer_MeshServicePeers(t *testing.T) {
+	const servicePeer = "spiffe://cluster.local/ns/plc/sa/api-service"
+	tests := []struct {
+		name    string
+		service bool
+		peer    string
+		expCode codes.Code
+	}{
+		{name: "service token from a service", service: true, peer: servicePeer, expCode: codes.OK},
+		{name: "service token from another peer", service: true, peer: "spiffe://cluster.local/ns/default/sa/default", expCode: codes.PermissionDenied},
+		{name: "service token without a peer", service: true, expCode: codes.PermissionDenied},
+		{name: "user token from another peer", peer: "spiffe://cluster.local/ns/default/sa/default", expCode: codes.OK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("tls_mode", "mesh")
+			viper.Set("mesh_service_peers", []string{servicePeer})
+			defer viper.Set("tls_mode", "")
+			defer viper.Set("mesh_service_peers", []string{})
+
+			lis, cleanup := startTestGRPCServer(nil)
+			defer cleanup(t)
+
+			token := testingutils.GenerateTestJWTToken(t, "abc")
+			if test.service {
+				token = testingutils.SignPBClaims(t, testingutils.GenerateTestServiceClaims(t, "api"), "abc")
+			}
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "bearer "+token)
+			if test.peer != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, authcontext.XFCCHeader, "Hash=abcd;URI="+test.peer)
+			}
+			_, err := makeTestRequest(ctx, t, lis)
+			assert.Equal(t, test.expCode, status.Code(err))
+		})
+	}
+}
+
+func TestGrpcServer_VersionWithoutAuth(t *testing.T) {
+	viper.Set("jwt_signing_key", "abc")
+	s := server.CreateGRPCServer(env.New("withpixie.ai"), &server.GRPCServerOptions{})
+	ping.RegisterPingServiceServer(s, &testserver{})
+	versionz.Register(s)
+	lis := bufconn.Listen(bufSize)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(createDialer(lis)), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The other methods still require auth.
+	_, err = ping.NewPingServiceClient(conn).Ping(ctx, &ping.PingRequest{Req: "hello"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	resp, err := versionzpb.NewVersionServiceClient(conn).GetVersion(ctx, &versionzpb.GetVersionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(versionz.CompatLevel), resp.CompatLevel)
+}
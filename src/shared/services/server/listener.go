@@ -0,0 +1,124 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// The names of the listeners that can be passed to the server with socket activation.
+	http2ListenerName   = "http2"
+	metricsListenerName = "metrics"
+
+	// The first file descriptor passed with socket activation, after stdin, stdout and stderr.
+	listenFDsStart = 3
+)
+
+var (
+	activated     map[string]net.Listener
+	activatedErr  error
+	activatedOnce sync.Once
+)
+
+// activatedListeners returns the listeners that were passed to the process with the systemd socket activation
+// protocol, keyed by name. The names come from LISTEN_FDNAMES, or default to the HTTP/2 listener followed by the
+// metrics listener.
+func activatedListeners(getenv func(string) string, startFD int) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener)
+	if getenv("LISTEN_FDS") == "" {
+		return listeners, nil
+	}
+	pid, err := strconv.Atoi(getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		// The listeners were meant for another process.
+		return listeners, nil
+	}
+	numFDs, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || numFDs < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+
+	names := []string{http2ListenerName, metricsListenerName}
+	if fdNames := getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	for i := 0; i < numFDs; i++ {
+		fd := startFD + i
+		if i >= len(names) {
+			return nil, fmt.Errorf("no name for activated listener with fd %d", fd)
+		}
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), names[i])
+		lis, err := net.FileListener(f)
+		// FileListener dups the fd, so the original is closed either way.
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("activated fd %d is not a listener: %w", fd, err)
+		}
+		listeners[names[i]] = lis
+	}
+	return listeners, nil
+}
+
+// reusePortControl sets SO_REUSEPORT on sockets before they are bound.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// listen returns the named listener if it was passed to the process with socket activation. Otherwise, it binds
+// a new listener on addr, with SO_REUSEPORT if reuse_port is set so that a new instance of the service can bind
+// the same port while this one drains its connections.
+func listen(name string, addr string) (net.Listener, error) {
+	activatedOnce.Do(func() {
+		activated, activatedErr = activatedListeners(os.Getenv, listenFDsStart)
+	})
+	if activatedErr != nil {
+		return nil, activatedErr
+	}
+	if lis, ok := activated[name]; ok {
+		log.WithField("listener", name).Info("Using listener passed with socket activation")
+		return lis, nil
+	}
+
+	lc := net.ListenConfig{}
+	if viper.GetBool("reuse_port") {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestReusePortControl(t *testing.T) {
+	lc := net.ListenConfig{Control: reusePortControl}
+	lis1, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis1.Close()
+
+	// A second listener can bind the same port, as a new instance of a service would during a handoff.
+	lis2, err := lc.Listen(context.Background(), "tcp", lis1.Addr().String())
+	require.NoError(t, err)
+	defer lis2.Close()
+
+	// Without SO_REUSEPORT, binding the port fails.
+	_, err = net.Listen("tcp", lis1.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestActivatedListeners(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	f, err := lis.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer f.Close()
+	// Pass the listener in a fresh fd, as the parent process would with socket activation.
+	fd, err := unix.Dup(int(f.Fd()))
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": metricsListenerName,
+	}
+	listeners, err := activatedListeners(func(k string) string { return env[k] }, fd)
+	require.NoError(t, err)
+	require.Contains(t, listeners, metricsListenerName)
+	defer listeners[metricsListenerName].Close()
+	assert.Equal(t, lis.Addr().String(), listeners[metricsListenerName].Addr().String())
+}
+
+func TestActivatedListeners_OtherProcess(t *testing.T) {
+	env := map[string]string{
+		"LISTEN_PID": strconv.Itoa(os.Getpid() + 1),
+		"LISTEN_FDS": "1",
+	}
+	listeners, err := activatedListeners(func(k string) string { return env[k] }, listenFDsStart)
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+}
@@ -22,7 +22,6 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -39,11 +38,25 @@ import (
 	"google.golang.org/grpc/reflection"
 
 	"px.dev/pixie/src/shared/services"
+	"px.dev/pixie/src/shared/services/channelz"
 	"px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/httpmiddleware"
+	"px.dev/pixie/src/shared/services/tracing"
+	"px.dev/pixie/src/shared/services/versionz"
+)
+
+const (
+	// channelzPath is where every service serves the summary of its GRPC connections.
+	channelzPath = "/debug/channelz"
+	// configPath is where every service serves its resolved configuration, with the secrets masked.
+	configPath = "/debug/config"
 )
 
 func isGRPCRequest(r *http.Request) bool {
-	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+	contentType := r.Header.Get("Content-Type")
+	// gRPC-Web requests are also sent over HTTP/2, but they need to be translated by the HTTP handler.
+	return r.ProtoMajor == 2 && strings.HasPrefix(contentType, "application/grpc") &&
+		!strings.HasPrefix(contentType, "application/grpc-web")
 }
 
 // PLServer is the services server component used across all Pixie Labs services.
@@ -51,6 +64,7 @@ func isGRPCRequest(r *http.Request) bool {
 type PLServer struct {
 	ch            chan bool
 	wg            *sync.WaitGroup
+	inFlight      *sync.WaitGroup
 	grpcServer    *grpc.Server
 	httpHandler   http.Handler
 	httpServer    *http.Server
@@ -66,18 +80,43 @@ func NewPLServer(env env.Env, httpHandler http.Handler, grpcServerOpts ...grpc.S
 // NewPLServerWithOptions creates a new PLServer.
 func NewPLServerWithOptions(env env.Env, httpHandler http.Handler, opts *GRPCServerOptions) *PLServer {
 	grpcServer := CreateGRPCServer(env, opts)
+	// gRPC-Web and REST requests are translated into GRPC calls, so they go through the same auth as GRPC.
+	if opts.EnableRESTGateway || viper.GetBool("enable_rest_gateway") {
+		httpHandler = httpmiddleware.WithRESTGateway(grpcServer, httpHandler)
+	}
+	if opts.EnableGRPCWeb || viper.GetBool("enable_grpc_web") {
+		httpHandler = httpmiddleware.WithGRPCWeb(grpcServer, httpHandler)
+	}
+	channelzHandler := channelz.Handler(env)
+	configHandler := services.ConfigDumpHandler()
 	// If it's a GRPC request we use the GRPC handler, otherwise forward to the regular HTTP(/2) handler.
 	muxHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if isGRPCRequest(r) {
 			grpcServer.ServeHTTP(w, r)
 			return
 		}
+		if r.URL.Path == channelzPath {
+			channelzHandler.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == configPath {
+			configHandler.ServeHTTP(w, r)
+			return
+		}
 		httpHandler.ServeHTTP(w, r)
 	})
-	wrappedHandler := services.HTTPLoggingMiddleware(muxHandler)
+	inFlight := &sync.WaitGroup{}
+	// Requests are tracked so that Stop can wait for them to finish before closing their connections.
+	trackedHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Done()
+		muxHandler.ServeHTTP(w, r)
+	})
+	wrappedHandler := services.HTTPLoggingMiddleware(trackedHandler)
 	s := &PLServer{
 		ch:          make(chan bool),
 		wg:          &sync.WaitGroup{},
+		inFlight:    inFlight,
 		grpcServer:  grpcServer,
 		httpHandler: wrappedHandler,
 	}
@@ -94,8 +133,10 @@ func (s *PLServer) serveHTTP2() {
 	defer s.wg.Done()
 	// Register GRPC reflection.
 	reflection.Register(s.grpcServer)
+	channelz.Register(s.grpcServer)
+	versionz.Register(s.grpcServer)
 
-	sslEnabled := !viper.GetBool("disable_ssl")
+	sslEnabled := services.SSLEnabled()
 	var tlsConfig *tls.Config
 	if sslEnabled {
 		var err error
@@ -114,7 +155,7 @@ func (s *PLServer) serveHTTP2() {
 		MaxHeaderBytes: 1 << 20,
 	}
 	log.WithField("addr", serverAddr).Print("Starting HTTP/2 server")
-	lis, err := net.Listen("tcp", serverAddr)
+	lis, err := listen(http2ListenerName, serverAddr)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to listen (grpc)")
 	}
@@ -150,7 +191,7 @@ func (s *PLServer) serveMetricsHTTP() {
 		MaxHeaderBytes: 1 << 20,
 	}
 	log.WithField("addr", serverAddr).Print("Starting HTTP metrics server")
-	lis, err := net.Listen("tcp", serverAddr)
+	lis, err := listen(metricsListenerName, serverAddr)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to listen (metrics_http)")
 	}
@@ -170,11 +211,18 @@ func (s *PLServer) Start() {
 	go s.serveMetricsHTTP()
 }
 
+func shutdownGracePeriod() time.Duration {
+	if d := viper.GetDuration("shutdown_grace_period"); d > 0 {
+		return d
+	}
+	return 5 * time.Second
+}
+
 func tryGracefulShutdown(s *http.Server) {
 	wait := make(chan bool)
 	go func() {
 		defer close(wait)
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod())
 		defer cancel()
 
 		if err := s.Shutdown(ctx); err != nil {
@@ -185,19 +233,37 @@ func tryGracefulShutdown(s *http.Server) {
 	<-wait
 }
 
-// Stop will gracefully shutdown underlying GRPC and HTTP servers.
+// waitForInFlight waits for the in-flight requests to finish, for at most the shutdown grace period.
+func (s *PLServer) waitForInFlight() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.inFlight.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownGracePeriod()):
+		log.Warn("Timed out waiting for in-flight requests to finish.")
+	}
+}
+
+// Stop will gracefully shutdown underlying GRPC and HTTP servers. The listeners are closed first, so that
+// another instance of the service sharing the ports can take over new connections, and then the in-flight
+// requests are given the shutdown grace period to finish before the GRPC server is stopped.
 func (s *PLServer) Stop() {
 	log.Info("Stopping servers.")
-	if s.grpcServer != nil {
-		go s.grpcServer.Stop()
-	}
 	if s.metricsServer != nil {
 		tryGracefulShutdown(s.metricsServer)
 	}
 	if s.httpServer != nil {
 		tryGracefulShutdown(s.httpServer)
 	}
+	s.waitForInFlight()
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
 	s.wg.Wait()
+	tracing.Shutdown()
 	log.Info("Waiting is complete")
 }
 
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"px.dev/pixie/src/shared/services/env"
+	ping "px.dev/pixie/src/shared/services/testproto"
+)
+
+type pingServer struct {
+	ping.UnimplementedPingServiceServer
+}
+
+func (s *pingServer) Ping(ctx context.Context, in *ping.PingRequest) (*ping.PingReply, error) {
+	return &ping.PingReply{Reply: "test reply"}, nil
+}
+
+func TestPLServer_GRPCWebOverHTTP2(t *testing.T) {
+	s := NewPLServerWithOptions(env.New("withpixie.ai"), http.NotFoundHandler(), &GRPCServerOptions{
+		DisableAuth:   map[string]bool{"/px.common.PingService/Ping": true},
+		EnableGRPCWeb: true,
+	})
+	ping.RegisterPingServiceServer(s.GRPCServer(), &pingServer{})
+
+	ts := httptest.NewServer(h2c.NewHandler(s.httpHandler, &http2.Server{}))
+	defer ts.Close()
+
+	msg, err := proto.Marshal(&ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+	body := &bytes.Buffer{}
+	body.WriteByte(0)
+	require.NoError(t, binary.Write(body, binary.BigEndian, uint32(len(msg))))
+	body.Write(msg)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/px.common.PingService/Ping", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+
+	// Send the request with prior knowledge of HTTP/2, as the proxy in front of the service does.
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 2, resp.ProtoMajor)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/grpc-web+proto", resp.Header.Get("Content-Type"))
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Greater(t, len(respBody), 5)
+	// The first frame holds the reply, and the last one holds the trailers.
+	assert.Equal(t, byte(0), respBody[0])
+	n := binary.BigEndian.Uint32(respBody[1:5])
+	reply := &ping.PingReply{}
+	require.NoError(t, proto.Unmarshal(respBody[5:5+n], reply))
+	assert.Equal(t, "test reply", reply.Reply)
+	assert.Contains(t, string(respBody[5+n:]), "grpc-status: 0")
+}
+
+func TestPLServer_ConfigDump(t *testing.T) {
+	// The config isn't reset, since the other tests rely on it.
+	viper.Set("jwt_signing_key", "abc")
+	viper.Set("http2_port", 50000)
+
+	s := NewPLServerWithOptions(env.New("withpixie.ai"), http.NotFoundHandler(), &GRPCServerOptions{})
+	rec := httptest.NewRecorder()
+	s.httpHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, configPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	cfg := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cfg))
+	assert.Equal(t, "<redacted>", cfg["jwt_signing_key"])
+	assert.Equal(t, float64(50000), cfg["http2_port"])
+}
@@ -23,7 +23,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sercand/kuberesolver/v3"
 	log "github.com/sirupsen/logrus"
@@ -35,10 +37,14 @@ import (
 	"google.golang.org/grpc/encoding/gzip"
 
 	version "px.dev/pixie/src/shared/goversion"
+	"px.dev/pixie/src/shared/services/tracing"
+	"px.dev/pixie/src/shared/services/versionz"
 )
 
 var (
 	commonSetup sync.Once
+	// serviceName is the name of the service, as given to SetupService.
+	serviceName string
 )
 
 func init() {
@@ -48,11 +54,18 @@ func init() {
 
 func setupCommonFlags() {
 	pflag.Bool("disable_ssl", false, "Disable SSL on the server")
+	pflag.String("tls_mode", "", "How the service secures its connections: pixie (Pixie's own mTLS certs), mesh (delegate mTLS to a service mesh such as Istio or Linkerd) or disabled. Defaults to pixie, or disabled if --disable_ssl is set")
+	pflag.StringSlice("mesh_service_peers", []string{}, "The mesh identities of the services (e.g. spiffe://cluster.local/ns/plc/sa/api-service) that may call this one with service tokens, when TLS is delegated to the mesh. Calls with service tokens from other peers are rejected")
+	pflag.String("mesh_ready_url", "", "The readiness endpoint of the service mesh sidecar, which the health checks of the service then include (e.g. http://localhost:15021/healthz/ready for Istio)")
 	pflag.Bool("disable_grpc_auth", false, "Disable auth on the GRPC server")
 	pflag.String("tls_ca_cert", "../certs/ca.crt", "The CA cert.")
 	pflag.String("jwt_signing_key", "", "The signing key used for JWTs")
 	pflag.String("pod_name", "<unknown>", "The pod name")
 	pflag.Bool("version", false, "Print the version and quit.")
+	pflag.Bool("dump_config", false, "Log the effective configuration, with secrets masked, on startup.")
+	pflag.StringSlice("remote_kubeconfigs", []string{}, "Kubeconfigs of remote clusters, whose services can then be dialed as kubernetes://service.namespace@context:port")
+	setupGCFlags()
+	setupOIDCFlags()
 }
 
 // SetupCommonFlags sets flags that are used by every service, even non GRPC servers.
@@ -61,12 +74,17 @@ func SetupCommonFlags() {
 }
 
 // SetupService configures basic flags and defaults required by all services.
-func SetupService(serviceName string, servicePortBase uint) {
+func SetupService(name string, servicePortBase uint) {
 	commonSetup.Do(setupCommonFlags)
+	serviceName = name
 	pflag.Uint("http2_port", servicePortBase, fmt.Sprintf("The port to run the %s HTTP/2 server", serviceName))
 	pflag.Uint("metrics_http_port", servicePortBase+1, fmt.Sprintf("The port to run the %s HTTP metrics server", serviceName))
 	pflag.String("server_tls_key", "../certs/server.key", "The TLS key to use.")
 	pflag.String("server_tls_cert", "../certs/server.crt", "The TLS certificate to use.")
+	pflag.Bool("enable_grpc_web", false, "Also serve the GRPC services to gRPC-Web clients on the HTTP/2 port")
+	pflag.Bool("enable_rest_gateway", false, "Also serve the unary GRPC methods as JSON/REST on the HTTP/2 port")
+	pflag.Bool("reuse_port", false, "Bind the server ports with SO_REUSEPORT, so that a new instance of the service can start serving on the same ports before this one stops")
+	pflag.Duration("shutdown_grace_period", 5*time.Second, "How long in-flight requests are given to finish when the server stops")
 
 	log.WithField("service", serviceName).
 		WithField("version", version.GetVersion().ToString()).
@@ -79,8 +97,16 @@ func PostFlagSetupAndParse() {
 
 	// Must call after all flags are setup.
 	viper.AutomaticEnv()
-	viper.SetEnvPrefix("PL")
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", nestedKeyEnvDelimiter))
 	viper.BindPFlags(pflag.CommandLine)
+
+	setupGC()
+	tracing.Setup(serviceName)
+
+	if err := registerKubeResolverClusters(viper.GetStringSlice("remote_kubeconfigs")); err != nil {
+		log.WithError(err).Fatal("Failed to set up resolution of services in remote clusters")
+	}
 }
 
 // CheckServiceFlags checks to make sure flag values are valid.
@@ -91,21 +117,34 @@ func CheckServiceFlags() {
 		os.Exit(0)
 	}
 
+	if viper.GetBool("dump_config") {
+		LogEffectiveConfig()
+	}
+
 	if len(viper.GetString("jwt_signing_key")) == 0 {
-		log.Panic("Flag --jwt_signing_key or ENV PL_JWT_SIGNING_KEY is required")
+		log.Panicf("Flag --jwt_signing_key or ENV %s_JWT_SIGNING_KEY is required", envPrefix)
 	}
 
-	if !viper.GetBool("disable_ssl") {
+	checkOIDCFlags()
+
+	if _, err := parseTLSMode(viper.GetString("tls_mode"), viper.GetBool("disable_ssl")); err != nil {
+		log.Panic(err.Error())
+	}
+	if GetTLSMode() == TLSModeMesh {
+		log.Info("TLS is delegated to the service mesh.")
+	}
+
+	if SSLEnabled() {
 		if len(viper.GetString("server_tls_key")) == 0 {
-			log.Panic("Flag --server_tls_key or ENV PL_SERVER_TLS_KEY is required when ssl is enabled")
+			log.Panicf("Flag --server_tls_key or ENV %s_SERVER_TLS_KEY is required when ssl is enabled", envPrefix)
 		}
 
 		if len(viper.GetString("server_tls_cert")) == 0 {
-			log.Panic("Flag --server_tls_cert or ENV PL_SERVER_TLS_CERT is required when ssl is enabled")
+			log.Panicf("Flag --server_tls_cert or ENV %s_SERVER_TLS_CERT is required when ssl is enabled", envPrefix)
 		}
 
 		if len(viper.GetString("tls_ca_cert")) == 0 {
-			log.Panic("Flag --tls_ca_cert or ENV PL_TLS_CA_CERT is required when ssl is enabled")
+			log.Panicf("Flag --tls_ca_cert or ENV %s_TLS_CA_CERT is required when ssl is enabled", envPrefix)
 		}
 	}
 
@@ -123,17 +162,17 @@ func SetupSSLClientFlags() {
 
 // CheckSSLClientFlags checks SSL client specific flags.
 func CheckSSLClientFlags() {
-	if !viper.GetBool("disable_ssl") {
+	if SSLEnabled() {
 		if len(viper.GetString("client_tls_key")) == 0 {
-			log.Panic("Flag --client_tls_key or ENV PL_CLIENT_TLS_KEY is required when ssl is enabled")
+			log.Panicf("Flag --client_tls_key or ENV %s_CLIENT_TLS_KEY is required when ssl is enabled", envPrefix)
 		}
 
 		if len(viper.GetString("client_tls_cert")) == 0 {
-			log.Panic("Flag --client_tls_cert or ENV PL_CLIENT_TLS_CERT is required when ssl is enabled")
+			log.Panicf("Flag --client_tls_cert or ENV %s_CLIENT_TLS_CERT is required when ssl is enabled", envPrefix)
 		}
 
 		if len(viper.GetString("tls_ca_cert")) == 0 {
-			log.Panic("Flag --tls_ca_cert or ENV PL_TLS_CA_CERT is required when ssl is enabled")
+			log.Panicf("Flag --tls_ca_cert or ENV %s_TLS_CA_CERT is required when ssl is enabled", envPrefix)
 		}
 	}
 }
@@ -142,9 +181,14 @@ func CheckSSLClientFlags() {
 func GetGRPCClientDialOpts() ([]grpc.DialOption, error) {
 	dialOpts := make([]grpc.DialOption, 0)
 	dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	dialOpts = append(dialOpts, versionz.DialOptions()...)
+	dialOpts = append(dialOpts, tracing.DialOptions()...)
 
-	if viper.GetBool("disable_ssl") {
+	if !SSLEnabled() {
 		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if OIDCClientCredentialsEnabled() {
+			dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(GetOIDCPerRPCCredentials()))
+		}
 		return dialOpts, nil
 	}
 
@@ -183,6 +227,9 @@ func GetGRPCClientDialOpts() ([]grpc.DialOption, error) {
 	creds := credentials.NewTLS(tlsConfig)
 	dialOpts = append(dialOpts, grpc.WithTransportCredentials(creds))
 	dialOpts = append(dialOpts, grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
+	if OIDCClientCredentialsEnabled() {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(GetOIDCPerRPCCredentials()))
+	}
 
 	return dialOpts, nil
 }
@@ -192,7 +239,9 @@ func GetGRPCClientDialOptsServerSideTLS(isInternal bool) ([]grpc.DialOption, err
 	dialOpts := make([]grpc.DialOption, 0)
 	dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
 
-	if viper.GetBool("disable_ssl") {
+	// The mesh only secures the traffic within the cluster, so servers outside of it are still dialed with TLS.
+	mode := GetTLSMode()
+	if mode == TLSModeDisabled || (mode == TLSModeMesh && isInternal) {
 		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 		return dialOpts, nil
 	}
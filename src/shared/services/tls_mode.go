@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// TLSMode is how a service secures its connections to other services.
+type TLSMode string
+
+const (
+	// TLSModePixie secures connections with Pixie's own mTLS certs.
+	TLSModePixie TLSMode = "pixie"
+	// TLSModeMesh delegates mTLS to a service mesh, such as Istio or Linkerd. The service itself serves and
+	// dials in plaintext, since the mesh sidecars encrypt the traffic, and it trusts the identity headers that
+	// the mesh forwards. The mesh must therefore replace the x-forwarded-client-cert and l5d-client-id headers
+	// that clients send (Istio's default SANITIZE_SET does), and reject plaintext connections that bypass the
+	// sidecar (e.g. with a STRICT PeerAuthentication).
+	TLSModeMesh TLSMode = "mesh"
+	// TLSModeDisabled doesn't secure connections at all.
+	TLSModeDisabled TLSMode = "disabled"
+)
+
+func parseTLSMode(mode string, disableSSL bool) (TLSMode, error) {
+	switch TLSMode(mode) {
+	case "":
+		// Services that predate the tls_mode flag are configured with disable_ssl.
+		if disableSSL {
+			return TLSModeDisabled, nil
+		}
+		return TLSModePixie, nil
+	case TLSModePixie, TLSModeMesh, TLSModeDisabled:
+		return TLSMode(mode), nil
+	}
+	return "", fmt.Errorf("invalid tls_mode %q, must be one of %s, %s or %s", mode, TLSModePixie, TLSModeMesh, TLSModeDisabled)
+}
+
+// GetTLSMode returns the TLS mode that the service is configured with. Invalid modes are rejected by
+// CheckServiceFlags, and are treated as the pixie mode here, so that a bad flag never silently disables TLS.
+func GetTLSMode() TLSMode {
+	mode, err := parseTLSMode(viper.GetString("tls_mode"), viper.GetBool("disable_ssl"))
+	if err != nil {
+		return TLSModePixie
+	}
+	return mode
+}
+
+// SSLEnabled returns whether the service terminates and originates TLS with its own certs.
+func SSLEnabled() bool {
+	return GetTLSMode() == TLSModePixie
+}
+
+// ServicePeerAllowed returns whether a call authenticated with a service token may come from the peer that the
+// mesh attested. Unless the mesh_service_peers flag lists the identities of the services, any peer is allowed.
+func ServicePeerAllowed(peerIdentity string) bool {
+	allowed := viper.GetStringSlice("mesh_service_peers")
+	if GetTLSMode() != TLSModeMesh || len(allowed) == 0 {
+		return true
+	}
+	for _, id := range allowed {
+		if id == peerIdentity {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTLSMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		tlsMode    string
+		disableSSL bool
+		expected   TLSMode
+		sslEnabled bool
+	}{
+		{name: "default", expected: TLSModePixie, sslEnabled: true},
+		{name: "disable_ssl", disableSSL: true, expected: TLSModeDisabled},
+		{name: "mesh", tlsMode: "mesh", expected: TLSModeMesh},
+		{name: "mode overrides disable_ssl", tlsMode: "pixie", disableSSL: true, expected: TLSModePixie, sslEnabled: true},
+		{name: "invalid mode keeps TLS", tlsMode: "bogus", disableSSL: true, expected: TLSModePixie, sslEnabled: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer viper.Reset()
+			viper.Set("tls_mode", test.tlsMode)
+			viper.Set("disable_ssl", test.disableSSL)
+			assert.Equal(t, test.expected, GetTLSMode())
+			assert.Equal(t, test.sslEnabled, SSLEnabled())
+		})
+	}
+}
+
+func TestParseTLSMode_Invalid(t *testing.T) {
+	_, err := parseTLSMode("istio", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package tracing
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// RequestIDKey is the baggage key that carries the request ID, so that it follows the request across the gRPC and
+// NATS hops between services.
+const RequestIDKey = "px.request_id"
+
+// How long Shutdown waits for the buffered spans to be exported.
+const shutdownTimeout = 5 * time.Second
+
+var provider *sdktrace.TracerProvider
+
+func init() {
+	pflag.String("otlp_traces_endpoint", "", "The OTLP gRPC endpoint (host:port) to export traces to. Traces aren't exported if unset, "+
+		"but the trace context is still propagated to the services that are called.")
+	pflag.Bool("otlp_traces_insecure", false, "Connect to the OTLP traces endpoint without TLS.")
+	pflag.Float64("trace_sample_ratio", 0.01, "The fraction of the traces started by this service that are sampled. "+
+		"Requests that are part of a trace keep the sampling decision of their caller.")
+}
+
+// Setup configures the propagation of trace context and baggage, and the exporting of the spans of the service when
+// an OTLP endpoint is configured. Must be called after the flags are parsed.
+func Setup(serviceName string) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	endpoint := viper.GetString("otlp_traces_endpoint")
+	if endpoint == "" {
+		return
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if viper.GetBool("otlp_traces_insecure") {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	// The exporter connects lazily, so this doesn't block on the endpoint being reachable.
+	exporter, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		log.WithError(err).Error("Failed to create trace exporter, traces will not be exported")
+		return
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(viper.GetFloat64("trace_sample_ratio")))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	log.WithField("endpoint", endpoint).Info("Exporting traces")
+}
+
+// Shutdown exports the remaining spans of the service, and stops exporting spans.
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("Failed to flush traces")
+	}
+}
+
+// DialOptions returns the dial options that start a span for each call of a client, and pass its trace context and
+// baggage to the server.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	}
+}
+
+// WithRequestID returns a copy of the context which carries the given request ID to the services that are called
+// with it.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	member, err := baggage.NewMember(RequestIDKey, requestID)
+	if err != nil {
+		log.WithError(err).WithField("request_id", requestID).Error("Invalid request ID")
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		log.WithError(err).WithField("request_id", requestID).Error("Failed to set request ID")
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// RequestID returns the request ID carried by the context, or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	return baggage.FromContext(ctx).Member(RequestIDKey).Value()
+}
+
+// TraceID returns the ID of the trace of the span in the context, or an empty string if there is none.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Inject returns the trace context and baggage of the context as a map, for messages that are passed along
+// without headers.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract returns a copy of the context with the trace context and baggage of a map created by Inject.
+func Extract(ctx context.Context, traceContext map[string]string) context.Context {
+	if len(traceContext) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(traceContext))
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"px.dev/pixie/src/shared/services/tracing"
+)
+
+func TestRequestID(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", tracing.RequestID(ctx))
+
+	ctx = tracing.WithRequestID(ctx, "req-1")
+	assert.Equal(t, "req-1", tracing.RequestID(ctx))
+
+	ctx = tracing.WithRequestID(ctx, "req-2")
+	assert.Equal(t, "req-2", tracing.RequestID(ctx))
+}
+
+func TestInjectExtract(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	defer otel.SetTextMapPropagator(prev)
+	tracing.Setup("test")
+
+	assert.Nil(t, tracing.Inject(context.Background()))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = tracing.WithRequestID(ctx, "req-1")
+
+	traceContext := tracing.Inject(ctx)
+	assert.Equal(t, map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"baggage":     "px.request_id=req-1",
+	}, traceContext)
+
+	extracted := tracing.Extract(context.Background(), traceContext)
+	assert.Equal(t, "req-1", tracing.RequestID(extracted))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tracing.TraceID(extracted))
+	assert.True(t, trace.SpanContextFromContext(extracted).IsRemote())
+
+	assert.Equal(t, "", tracing.TraceID(tracing.Extract(context.Background(), nil)))
+}
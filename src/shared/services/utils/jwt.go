@@ -66,6 +66,11 @@ func ProtoToToken(pb *jwtpb.JWTClaims) (jwt.Token, error) {
 		builder.Claim("ServiceID", m.ServiceClaims.ServiceID)
 	case *jwtpb.JWTClaims_ClusterClaims:
 		builder.Claim("ClusterID", m.ClusterClaims.ClusterID)
+		if m.ClusterClaims.RequesterUserID != "" {
+			builder.
+				Claim("RequesterOrgID", m.ClusterClaims.RequesterOrgID).
+				Claim("RequesterUserID", m.ClusterClaims.RequesterUserID)
+		}
 	default:
 		log.WithField("type", m).Error("Could not find claims type")
 	}
@@ -110,7 +115,9 @@ func TokenToProto(token jwt.Token) (*jwtpb.JWTClaims, error) {
 	case HasClusterClaims(token):
 		p.CustomClaims = &jwtpb.JWTClaims_ClusterClaims{
 			ClusterClaims: &jwtpb.ClusterJWTClaims{
-				ClusterID: GetClusterID(token),
+				ClusterID:       GetClusterID(token),
+				RequesterOrgID:  getStringClaim(token, "RequesterOrgID"),
+				RequesterUserID: getStringClaim(token, "RequesterUserID"),
 			},
 		}
 	}
@@ -224,6 +231,14 @@ func GetClusterID(t jwt.Token) string {
 	return clusterID.(string)
 }
 
+func getStringClaim(t jwt.Token, name string) string {
+	v, ok := t.PrivateClaims()[name].(string)
+	if !ok {
+		return ""
+	}
+	return v
+}
+
 // HasUserClaims checks if the custom claims include UserClaims.
 func HasUserClaims(t jwt.Token) bool {
 	claims := t.PrivateClaims()
@@ -194,6 +194,30 @@ func TestTokenToProto_Cluster(t *testing.T) {
 	assert.Equal(t, "cluster_id", customClaims.ClusterID)
 }
 
+func TestTokenToProto_ClusterWithRequester(t *testing.T) {
+	p := getStandardClaimsPb()
+	p.Scopes = []string{"cluster"}
+	p.CustomClaims = &jwtpb.JWTClaims_ClusterClaims{
+		ClusterClaims: &jwtpb.ClusterJWTClaims{
+			ClusterID:       "cluster_id",
+			RequesterOrgID:  "org_id",
+			RequesterUserID: "user_id",
+		},
+	}
+
+	token, err := utils.ProtoToToken(p)
+	require.NoError(t, err)
+	pb, err := utils.TokenToProto(token)
+	require.NoError(t, err)
+
+	// The token of a cluster stays one, even when it was issued to a user.
+	assert.Nil(t, pb.GetUserClaims())
+	customClaims := pb.GetClusterClaims()
+	assert.Equal(t, "cluster_id", customClaims.ClusterID)
+	assert.Equal(t, "org_id", customClaims.RequesterOrgID)
+	assert.Equal(t, "user_id", customClaims.RequesterUserID)
+}
+
 func TestTokenToProto_FailNoAudience(t *testing.T) {
 	builder := jwt.NewBuilder().
 		Expiration(time.Unix(100, 0)).
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package versionz serves the build info of a service, and checks that the services a client talks to were built
+// with a compatible version of the service protos, so that mixed-version deployments during an upgrade fail loudly
+// instead of silently misinterpreting each other's messages.
+package versionz
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	version "px.dev/pixie/src/shared/goversion"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/shared/services/versionz/versionzpb"
+)
+
+// CompatLevel is the compatibility level of the service protos. Bump it whenever a change to the protos breaks
+// services that were built at an earlier level.
+const CompatLevel = 1
+
+// MinCompatLevel is the oldest compatibility level of a peer that this build can still talk to. Raise it to
+// CompatLevel when bumping CompatLevel for a change that isn't backwards compatible.
+const MinCompatLevel = 1
+
+// GetVersionMethod is the full name of the GetVersion RPC. It doesn't require auth, so that clients can check
+// the version of a service before calling any of its other methods.
+const GetVersionMethod = "/px.services.VersionService/GetVersion"
+
+// How long the version of a peer is cached before it is checked again, since the peer may be upgraded.
+const peerVersionTTL = 5 * time.Minute
+
+// How long a failure to get the version of a peer is cached, so that an unreachable peer isn't asked for its
+// version on every call, but is checked again soon after it comes back.
+const peerVersionFailureTTL = 10 * time.Second
+
+// How long a version check may take. The check is shared by all the calls to a peer that are waiting on it, so it
+// doesn't use the deadline of any one of them.
+const fetchTimeout = 10 * time.Second
+
+func init() {
+	pflag.Bool("enforce_version_compat", false, "Fail the GRPC calls to services whose build is incompatible with this "+
+		"one, instead of only logging the incompatibility.")
+}
+
+// Info returns the build info of this service.
+func Info() *versionzpb.GetVersionResponse {
+	v := version.GetVersion()
+	buildTime, err := types.TimestampProto(v.BuildTime())
+	if err != nil {
+		buildTime = nil
+	}
+	return &versionzpb.GetVersionResponse{
+		GitSHA:         v.Revision(),
+		BuildStatus:    v.RevisionStatus(),
+		Semver:         v.ToString(),
+		BuildTime:      buildTime,
+		CompatLevel:    CompatLevel,
+		MinCompatLevel: MinCompatLevel,
+	}
+}
+
+// Server implements the VersionService.
+type Server struct{}
+
+// GetVersion returns the build info of this service.
+func (s *Server) GetVersion(ctx context.Context, req *versionzpb.GetVersionRequest) (*versionzpb.GetVersionResponse, error) {
+	return Info(), nil
+}
+
+// Register registers the VersionService to the given server.
+func Register(s *grpc.Server) {
+	versionzpb.RegisterVersionServiceServer(s, &Server{})
+}
+
+// CheckCompatible returns an error if a peer with the given build info can't talk to this build.
+func CheckCompatible(peer *versionzpb.GetVersionResponse) error {
+	if peer.CompatLevel < MinCompatLevel {
+		return fmt.Errorf("peer %s is at compat level %d, but this build requires at least %d",
+			peer.Semver, peer.CompatLevel, MinCompatLevel)
+	}
+	if CompatLevel < peer.MinCompatLevel {
+		return fmt.Errorf("peer %s requires compat level %d, but this build is at %d",
+			peer.Semver, peer.MinCompatLevel, CompatLevel)
+	}
+	return nil
+}
+
+type peerVersion struct {
+	// err is why the peer is incompatible, or nil if it is compatible.
+	err       error
+	checkedAt time.Time
+	ttl       time.Duration
+}
+
+func (pv *peerVersion) expired(now time.Time) bool {
+	return now.Sub(pv.checkedAt) >= pv.ttl
+}
+
+// Checker checks the version of the services that a client calls, the first time that each of them is called and
+// periodically after that. Incompatible peers are logged, and their calls fail if the enforce_version_compat flag
+// is set.
+type Checker struct {
+	clock clock.Clock
+
+	// inflight makes the concurrent calls to a peer whose version isn't cached wait on a single version check.
+	inflight singleflight.Group
+
+	mu    sync.Mutex
+	peers map[string]*peerVersion
+}
+
+// NewChecker creates a new Checker.
+func NewChecker() *Checker {
+	return NewCheckerWithClock(clock.New())
+}
+
+// NewCheckerWithClock creates a new Checker that uses the given clock.
+func NewCheckerWithClock(clk clock.Clock) *Checker {
+	return &Checker{
+		clock: clk,
+		peers: make(map[string]*peerVersion),
+	}
+}
+
+var defaultChecker = NewChecker()
+
+// DialOptions returns the dial options that check the versions of the peers of a client with the default Checker.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(defaultChecker.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(defaultChecker.StreamClientInterceptor()),
+	}
+}
+
+// check returns an error if the target of the connection is incompatible and compatibility is enforced.
+func (c *Checker) check(ctx context.Context, cc *grpc.ClientConn) error {
+	target := cc.Target()
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	pv, ok := c.peers[target]
+	c.mu.Unlock()
+
+	if !ok || pv.expired(now) {
+		v, _, _ := c.inflight.Do(target, func() (interface{}, error) {
+			return c.refresh(ctx, cc), nil
+		})
+		pv = v.(*peerVersion)
+	}
+
+	if pv.err != nil && viper.GetBool("enforce_version_compat") {
+		return status.Errorf(codes.FailedPrecondition, "incompatible peer %s: %v", target, pv.err)
+	}
+	return nil
+}
+
+// refresh gets the version of the target of the connection and caches it.
+func (c *Checker) refresh(ctx context.Context, cc *grpc.ClientConn) *peerVersion {
+	target := cc.Target()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+	defer cancel()
+
+	pv, err := c.fetch(ctx, cc)
+	if err != nil {
+		// The call itself will most likely fail for the same reason, so it is left to report the error, and the
+		// peer is treated as compatible until it is checked again.
+		log.WithError(err).WithField("target", target).Debug("Failed to get the version of peer")
+		pv = &peerVersion{checkedAt: c.clock.Now(), ttl: peerVersionFailureTTL}
+	}
+
+	c.mu.Lock()
+	c.peers[target] = pv
+	c.mu.Unlock()
+	return pv
+}
+
+func (c *Checker) fetch(ctx context.Context, cc *grpc.ClientConn) (*peerVersion, error) {
+	logger := log.WithField("target", cc.Target())
+	resp, err := versionzpb.NewVersionServiceClient(cc).GetVersion(ctx, &versionzpb.GetVersionRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		// The peer predates the VersionService, so its compatibility is unknown.
+		logger.Info("Peer doesn't report its version")
+		return &peerVersion{checkedAt: c.clock.Now(), ttl: peerVersionTTL}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pv := &peerVersion{
+		err:       CheckCompatible(resp),
+		checkedAt: c.clock.Now(),
+		ttl:       peerVersionTTL,
+	}
+	logger = logger.WithField("peer_version", resp.Semver).WithField("peer_git_sha", resp.GitSHA).
+		WithField("peer_compat_level", resp.CompatLevel)
+	if pv.err != nil {
+		logger.WithError(pv.err).Error("Peer was built with an incompatible version of the service protos")
+	} else {
+		logger.Debug("Peer is compatible")
+	}
+	return pv, nil
+}
+
+// UnaryClientInterceptor returns an interceptor that checks the version of the peer before unary calls.
+func (c *Checker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if method != GetVersionMethod {
+			if err := c.check(ctx, cc); err != nil {
+				return err
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that checks the version of the peer before streaming calls.
+func (c *Checker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := c.check(ctx, cc); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
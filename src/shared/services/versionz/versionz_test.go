@@ -0,0 +1,214 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package versionz_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/shared/services/clock"
+	ping "px.dev/pixie/src/shared/services/testproto"
+	"px.dev/pixie/src/shared/services/versionz"
+	"px.dev/pixie/src/shared/services/versionz/versionzpb"
+)
+
+type testserver struct {
+	ping.UnimplementedPingServiceServer
+}
+
+func (s *testserver) Ping(ctx context.Context, in *ping.PingRequest) (*ping.PingReply, error) {
+	return &ping.PingReply{Reply: "test reply"}, nil
+}
+
+// fakeVersionServer reports the given compat levels, and counts how often it is asked for them. If fail is set,
+// it fails instead, and if release is set, it waits for it to be closed before responding.
+type fakeVersionServer struct {
+	compatLevel    int32
+	minCompatLevel int32
+	fail           int32
+	release        chan struct{}
+	calls          int32
+}
+
+func (s *fakeVersionServer) GetVersion(ctx context.Context, req *versionzpb.GetVersionRequest) (*versionzpb.GetVersionResponse, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if s.release != nil {
+		<-s.release
+	}
+	if atomic.LoadInt32(&s.fail) == 1 {
+		return nil, status.Error(codes.Unavailable, "version unavailable")
+	}
+	return &versionzpb.GetVersionResponse{
+		Semver:         "0.1.0",
+		CompatLevel:    atomic.LoadInt32(&s.compatLevel),
+		MinCompatLevel: s.minCompatLevel,
+	}, nil
+}
+
+func startPingServer(t *testing.T, register func(*grpc.Server), checker *versionz.Checker) ping.PingServiceClient {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	ping.RegisterPingServiceServer(s, &testserver{})
+	if register != nil {
+		register(s)
+	}
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(checker.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(checker.StreamClientInterceptor()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return ping.NewPingServiceClient(conn)
+}
+
+func TestInfo(t *testing.T) {
+	info := versionz.Info()
+	assert.Equal(t, int32(versionz.CompatLevel), info.CompatLevel)
+	assert.Equal(t, int32(versionz.MinCompatLevel), info.MinCompatLevel)
+	assert.Equal(t, "0000000", info.GitSHA)
+	assert.NotEmpty(t, info.Semver)
+	assert.NotNil(t, info.BuildTime)
+	assert.NoError(t, versionz.CheckCompatible(info))
+}
+
+func TestCheckCompatible(t *testing.T) {
+	assert.NoError(t, versionz.CheckCompatible(&versionzpb.GetVersionResponse{
+		CompatLevel:    versionz.CompatLevel + 1,
+		MinCompatLevel: versionz.CompatLevel,
+	}))
+	assert.Error(t, versionz.CheckCompatible(&versionzpb.GetVersionResponse{
+		CompatLevel:    versionz.MinCompatLevel - 1,
+		MinCompatLevel: 0,
+	}))
+	assert.Error(t, versionz.CheckCompatible(&versionzpb.GetVersionResponse{
+		CompatLevel:    versionz.CompatLevel + 1,
+		MinCompatLevel: versionz.CompatLevel + 1,
+	}))
+}
+
+func TestChecker_Compatible(t *testing.T) {
+	viper.Set("enforce_version_compat", true)
+	defer viper.Set("enforce_version_compat", false)
+
+	client := startPingServer(t, versionz.Register, versionz.NewChecker())
+	resp, err := client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "test reply", resp.Reply)
+}
+
+func TestChecker_Incompatible(t *testing.T) {
+	vs := &fakeVersionServer{compatLevel: versionz.MinCompatLevel - 1}
+	register := func(s *grpc.Server) { versionzpb.RegisterVersionServiceServer(s, vs) }
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	client := startPingServer(t, register, versionz.NewCheckerWithClock(clk))
+
+	// Incompatible peers are only logged by default.
+	_, err := client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+
+	viper.Set("enforce_version_compat", true)
+	defer viper.Set("enforce_version_compat", false)
+	_, err = client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.PingServerStream(context.Background(), &ping.PingRequest{Req: "hello"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	// The version is cached.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&vs.calls))
+
+	// Once the peer is upgraded, its calls succeed after the cached version expires.
+	atomic.StoreInt32(&vs.compatLevel, versionz.CompatLevel)
+	clk.Advance(5 * time.Minute)
+	_, err = client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&vs.calls))
+}
+
+func TestChecker_ConcurrentCallsShareCheck(t *testing.T) {
+	vs := &fakeVersionServer{compatLevel: versionz.CompatLevel, release: make(chan struct{})}
+	register := func(s *grpc.Server) { versionzpb.RegisterVersionServiceServer(s, vs) }
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	client := startPingServer(t, register, versionz.NewCheckerWithClock(clk))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+			assert.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&vs.calls) > 0 }, 5*time.Second, 10*time.Millisecond)
+	// Give the other calls time to start waiting on the version check.
+	time.Sleep(100 * time.Millisecond)
+	close(vs.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&vs.calls))
+}
+
+func TestChecker_FailedCheckIsCachedBriefly(t *testing.T) {
+	viper.Set("enforce_version_compat", true)
+	defer viper.Set("enforce_version_compat", false)
+
+	vs := &fakeVersionServer{compatLevel: versionz.MinCompatLevel - 1, fail: 1}
+	register := func(s *grpc.Server) { versionzpb.RegisterVersionServiceServer(s, vs) }
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	client := startPingServer(t, register, versionz.NewCheckerWithClock(clk))
+
+	// A peer whose version can't be fetched isn't failed, and isn't asked again for a while.
+	_, err := client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+	_, err = client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&vs.calls))
+
+	// It is checked again well before a successful check would expire.
+	atomic.StoreInt32(&vs.fail, 0)
+	clk.Advance(10 * time.Second)
+	_, err = client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&vs.calls))
+}
+
+func TestChecker_PeerWithoutVersionService(t *testing.T) {
+	viper.Set("enforce_version_compat", true)
+	defer viper.Set("enforce_version_compat", false)
+
+	client := startPingServer(t, nil, versionz.NewChecker())
+	_, err := client.Ping(context.Background(), &ping.PingRequest{Req: "hello"})
+	require.NoError(t, err)
+}
@@ -47,6 +47,7 @@ var reasonToMessageMap = map[VizierReason]string{
 	NATSPodPending:               "NATS message bus pods are still pending. If this status persists, investigate failures on the Pending NATS pods in the Vizier namespace (default `pl`).",
 	NATSPodMissing:               "NATS message bus pods are missing. If this status persists, clobber and redeploy this Pixie instance.",
 	NATSPodFailed:                "NATS message bus pods have failed. Investigate failures on the Pending NATS pods in the Vizier namespace (default `pl`).",
+	ExternalNATSUnreachable:      "The operator cannot connect to the external NATS cluster. Check the URL, credentials and TLS settings under `nats.external` in the Vizier object, and that the NATS cluster is reachable from the Vizier namespace.",
 	EtcdPodsMissing:              "etcd pods are missing. If this status persists, clobber and redeploy this Pixie instance.",
 	EtcdPodsCrashing:             "etcd pods are in CrashLoopBackOff, likely due to loss of quorum. If this status persists, clobber and redeploy this Pixie instance.",
 	UnableToConnectToCloud:       "Failed to connect to Pixie Cloud. Please check the cloud address (and optional dev cloud namespace) in the Vizier object to ensure it is correct and accessible within your firewall and network configurations.",
@@ -58,7 +59,12 @@ var reasonToMessageMap = map[VizierReason]string{
 		"If this problem persists, clobber and re-deploy your Pixie instance",
 	PEMsHighFailureRate: "PEMs are experiencing a high crash rate. Your Pixie experience will be degraded while this occurs. If PEMs are getting OOMKilled, increase your PEM memory limits using the `pemMemoryLimit` flag.",
 	PEMsAllFailing:      "PEMs are all crashing. If PEMs are getting OOMKilled, increase your PEM memory limits using the `pemMemoryLimit` flag. Otherwise, consider filing a bug so someone can address your problem: https://github.com/pixie-io/pixie",
-	TLSCertsExpired:     "Service TLS certs are expired. If using the operator, the certs will be auto-regenerated. Otherwise, please redeploy Vizier.",
+	PodsOOMKilled: "Vizier pods are crashlooping because they are being OOMKilled. Increase the PEM memory limit using the `pemMemoryLimit` flag, enable `pemAutoscaling`, " +
+		"or let the operator raise the limit by enabling `crashRemediation.increasePEMMemory`.",
+	KernelHeadersMissing: "PEMs are crashlooping because the Linux headers for the kernel of their nodes could not be found. Install the kernel headers on the nodes, " +
+		"or limit the PEMs to the data sources that don't need them by enabling `crashRemediation.disableTracingWithoutKernelHeaders`.",
+	PodsCrashLooping: "Vizier pods are crashlooping. Investigate the failing pods in the Vizier namespace (default `pl`) using `kubectl describe` and `kubectl logs --previous`.",
+	TLSCertsExpired:  "Service TLS certs are expired. If using the operator, the certs will be auto-regenerated. Otherwise, please redeploy Vizier.",
 }
 
 // VizierReason is the reason that Vizier is in its current state.
@@ -120,6 +126,8 @@ const (
 	NATSPodMissing VizierReason = "NATSPodMissing"
 	// NATSPodFailed occurs when the nats pod failed to start up.
 	NATSPodFailed VizierReason = "NATSPodFailed"
+	// ExternalNATSUnreachable occurs when the Vizier uses an external NATS cluster that can't be connected to.
+	ExternalNATSUnreachable VizierReason = "ExternalNATSUnreachable"
 
 	// EtcdPodsMissing when the etcd pods are missing.
 	EtcdPodsMissing VizierReason = "EtcdPodsMissing"
@@ -143,6 +151,13 @@ const (
 	// PEMsAllFailing occurs when a all PEMs are failing.
 	PEMsAllFailing VizierReason = "PEMsAllFailing"
 
+	// PodsOOMKilled occurs when Vizier pods are crashlooping because they are OOMKilled.
+	PodsOOMKilled VizierReason = "PodsOOMKilled"
+	// KernelHeadersMissing occurs when PEMs are crashlooping because they can't find the Linux headers of their node.
+	KernelHeadersMissing VizierReason = "KernelHeadersMissing"
+	// PodsCrashLooping occurs when Vizier pods are crashlooping for a reason that the operator can't diagnose.
+	PodsCrashLooping VizierReason = "PodsCrashLooping"
+
 	// TLSCertsExpired occurs when the service TLS certs are expired or almost expired.
 	TLSCertsExpired VizierReason = "TLSCertsExpired"
 )
@@ -296,6 +296,19 @@ class StoreWithRowTimeAccounting {
     return times_.back().second;
   }
 
+  /**
+   * FirstBatchMaxTime returns the maximum time in the first batch of the store, i.e. the time the
+   * first batch can be expired at without expiring any newer rows.
+   * @return maximum time in the first batch, or -1 if there are no rows in the store or there is no
+   * time column.
+   */
+  int64_t FirstBatchMaxTime() const {
+    if (time_col_idx_ == -1 || times_.empty()) {
+      return -1;
+    }
+    return times_.front().second;
+  }
+
  private:
   BatchID LastBatchID() const { return first_batch_id_ + batches_.size() - 1; }
 
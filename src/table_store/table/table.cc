@@ -507,6 +507,78 @@ Status Table::ExpireBatch() {
   return ExpireHot();
 }
 
+StatusOr<bool> Table::ExpireColdBefore(Time time) {
+  absl::base_internal::SpinLockHolder cold_lock(&cold_lock_);
+  if (cold_store_->Size() == 0) {
+    return false;
+  }
+  auto batch_max_time = cold_store_->FirstBatchMaxTime();
+  if (batch_max_time == -1 || batch_max_time >= time) {
+    return false;
+  }
+  cold_store_->PopFront();
+  absl::base_internal::SpinLockHolder hot_lock(&hot_lock_);
+  batch_size_accountant_->ExpireColdBatch();
+  return true;
+}
+
+StatusOr<bool> Table::ExpireHotBefore(Time time) {
+  absl::base_internal::SpinLockHolder hot_lock(&hot_lock_);
+  if (hot_store_->Size() == 0) {
+    return false;
+  }
+  auto batch_max_time = hot_store_->FirstBatchMaxTime();
+  if (batch_max_time == -1 || batch_max_time >= time) {
+    return false;
+  }
+  hot_store_->PopFront();
+  batch_size_accountant_->ExpireHotBatch();
+  return true;
+}
+
+Status Table::ExpireBefore(Time time) {
+  int64_t num_expired = 0;
+  while (true) {
+    bool cold_empty;
+    {
+      absl::base_internal::SpinLockHolder cold_lock(&cold_lock_);
+      cold_empty = cold_store_->Size() == 0;
+    }
+    // Cold batches are always older than hot batches, so hot batches are only expired once all of
+    // the cold batches are gone.
+    bool expired;
+    if (!cold_empty) {
+      PX_ASSIGN_OR_RETURN(expired, ExpireColdBefore(time));
+    } else {
+      PX_ASSIGN_OR_RETURN(expired, ExpireHotBefore(time));
+    }
+    if (!expired) {
+      break;
+    }
+    ++num_expired;
+  }
+  if (num_expired == 0) {
+    return Status::OK();
+  }
+  {
+    absl::base_internal::SpinLockHolder lock(&stats_lock_);
+    batches_expired_ += num_expired;
+    metrics_.batches_expired_counter.Increment(num_expired);
+  }
+  return UpdateTableMetricGauges();
+}
+
+Status Table::ExpireByRetention() {
+  int64_t retention_ns = retention_ns_;
+  if (retention_ns <= 0) {
+    return Status::OK();
+  }
+  int64_t current_time_ns = std::chrono::duration_cast<std::chrono::nanoseconds>(
+                                std::chrono::system_clock::now().time_since_epoch())
+                                .count();
+  return ExpireBefore(current_time_ns - retention_ns);
+}
+
 Status Table::UpdateTableMetricGauges() {
   // Update table-level gauge values.
   auto stats = GetTableStats();
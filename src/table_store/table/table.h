@@ -22,6 +22,7 @@
 #include <arrow/array.h>
 #include <arrow/record_batch.h>
 #include <algorithm>
+#include <atomic>
 #include <deque>
 #include <memory>
 #include <optional>
@@ -301,6 +302,26 @@ class Table : public NotCopyable {
    */
   Status CompactHotToCold(arrow::MemoryPool* mem_pool);
 
+  /**
+   * Sets the maximum age of the data in the table. Data older than the retention is removed by
+   * ExpireByRetention. A non-positive retention (the default) keeps data until the table is full.
+   * @param retention_ns the maximum age of the data in nanoseconds.
+   */
+  void SetRetention(int64_t retention_ns) { retention_ns_ = retention_ns; }
+
+  /**
+   * Expires the batches that only contain rows older than the table's retention. Batches are
+   * expired whole, so a batch that still has rows within the retention is kept along with its
+   * older rows.
+   */
+  Status ExpireByRetention();
+
+  /**
+   * Expires the batches that only contain rows with a time before the given time.
+   * @param time the time before which batches are expired.
+   */
+  Status ExpireBefore(Time time);
+
  private:
   TableMetrics metrics_;
 
@@ -326,12 +347,15 @@ class Table : public NotCopyable {
   // accessed on a hot write.
   int64_t next_row_id_ ABSL_GUARDED_BY(hot_lock_) = 0;
   int64_t time_col_idx_ = -1;
+  std::atomic<int64_t> retention_ns_ = -1;
 
   Status WriteHot(internal::RecordOrRowBatch&& record_or_row_batch);
 
   Status ExpireBatch();
   Status ExpireHot();
   StatusOr<bool> ExpireCold();
+  StatusOr<bool> ExpireColdBefore(Time time);
+  StatusOr<bool> ExpireHotBefore(Time time);
   Status ExpireRowBatches(int64_t row_batch_size);
   Status CompactSingleBatchUnlocked(arrow::MemoryPool* mem_pool)
       ABSL_EXCLUSIVE_LOCKS_REQUIRED(cold_lock_) ABSL_EXCLUSIVE_LOCKS_REQUIRED(hot_lock_);
@@ -165,5 +165,12 @@ Status TableStore::RunCompaction(arrow::MemoryPool* mem_pool) {
   return Status::OK();
 }
 
+Status TableStore::ExpireByRetention() {
+  for (const auto& it : name_to_table_map_) {
+    PX_RETURN_IF_ERROR(it.second->ExpireByRetention());
+  }
+  return Status::OK();
+}
+
 }  // namespace table_store
 }  // namespace px
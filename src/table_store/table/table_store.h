@@ -167,6 +167,11 @@ class TableStore {
 
   Status RunCompaction(arrow::MemoryPool* mem_pool);
 
+  /**
+   * Expires the data in each table that is older than the table's retention.
+   */
+  Status ExpireByRetention();
+
  private:
   void RegisterTableName(const std::string& table_name, const types::TabletID& tablet_id,
                          const schema::Relation& table_relation,
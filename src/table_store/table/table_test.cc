@@ -20,6 +20,7 @@
 #include <arrow/array.h>
 #include <google/protobuf/text_format.h>
 #include <google/protobuf/util/message_differencer.h>
+#include <chrono>
 #include <random>
 #include <vector>
 
@@ -575,6 +576,60 @@ TEST(TableTest, find_rowid_from_time_first_greater_than_or_equal) {
             table.FindRowIDFromTimeFirstGreaterThanOrEqual(24));
 }
 
+TEST(TableTest, expire_before) {
+  schema::Relation rel(std::vector<types::DataType>({types::DataType::TIME64NS}),
+                       std::vector<std::string>({"time_"}));
+  std::shared_ptr<Table> table_ptr = Table::Create("test_table", rel);
+  Table& table = *table_ptr;
+
+  std::vector<std::vector<types::Time64NSValue>> time_batches = {{2, 3, 4}, {6, 8}, {9, 12}};
+  for (const auto& time_batch : time_batches) {
+    auto wrapper_batch = std::make_unique<types::ColumnWrapperRecordBatch>();
+    auto col_wrapper = std::make_shared<types::Time64NSValueColumnWrapper>(time_batch.size());
+    col_wrapper->Clear();
+    col_wrapper->AppendFromVector(time_batch);
+    wrapper_batch->push_back(col_wrapper);
+    EXPECT_OK(table.TransferRecordBatch(std::move(wrapper_batch)));
+  }
+
+  // Nothing is expired until every row in the first batch is before the time.
+  EXPECT_OK(table.ExpireBefore(4));
+  EXPECT_EQ(3, table.GetTableStats().num_batches);
+  EXPECT_EQ(0, table.GetTableStats().batches_expired);
+
+  // The second batch still has a row at time 8, so it is kept.
+  EXPECT_OK(table.ExpireBefore(8));
+  EXPECT_EQ(2, table.GetTableStats().num_batches);
+  EXPECT_EQ(1, table.GetTableStats().batches_expired);
+  EXPECT_EQ(3, table.FindRowIDFromTimeFirstGreaterThanOrEqual(0));
+
+  EXPECT_OK(table.ExpireBefore(13));
+  EXPECT_EQ(0, table.GetTableStats().num_batches);
+  EXPECT_EQ(3, table.GetTableStats().batches_expired);
+}
+
+TEST(TableTest, expire_by_retention) {
+  schema::Relation rel(std::vector<types::DataType>({types::DataType::TIME64NS}),
+                       std::vector<std::string>({"time_"}));
+  std::shared_ptr<Table> table_ptr = Table::Create("test_table", rel);
+  Table& table = *table_ptr;
+
+  auto wrapper_batch = std::make_unique<types::ColumnWrapperRecordBatch>();
+  auto col_wrapper = std::make_shared<types::Time64NSValueColumnWrapper>(2);
+  col_wrapper->Clear();
+  col_wrapper->AppendFromVector(std::vector<types::Time64NSValue>({1, 2}));
+  wrapper_batch->push_back(col_wrapper);
+  EXPECT_OK(table.TransferRecordBatch(std::move(wrapper_batch)));
+
+  // Without a retention the data is kept.
+  EXPECT_OK(table.ExpireByRetention());
+  EXPECT_EQ(1, table.GetTableStats().num_batches);
+
+  table.SetRetention(std::chrono::nanoseconds(std::chrono::hours(1)).count());
+  EXPECT_OK(table.ExpireByRetention());
+  EXPECT_EQ(0, table.GetTableStats().num_batches);
+}
+
 TEST(TableTest, find_rowid_from_time_first_greater_than_or_equal_with_compaction) {
   schema::Relation rel(std::vector<types::DataType>({types::DataType::TIME64NS}),
                        std::vector<std::string>({"time_"}));
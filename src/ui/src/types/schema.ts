@@ -23,6 +23,7 @@ export interface GQLQuery {
   cluster: GQLClusterInfo;
   clusterByName: GQLClusterInfo;
   clusters: Array<GQLClusterInfo>;
+  clusterStatuses: GQLClusterStatusPage;
   autocomplete: GQLAutocompleteResult;
   autocompleteField: GQLAutocompleteFieldResult;
   liveViews: Array<GQLLiveViewMetadata>;
@@ -39,6 +40,8 @@ export interface GQLQuery {
   retentionPluginConfig: GQLRetentionPluginConfig;
   retentionScripts: Array<GQLRetentionScript>;
   retentionScript: GQLDetailedRetentionScript;
+  savedQueries: Array<GQLSavedQuery>;
+  savedQuery: GQLSavedQuery;
 }
 
 export interface GQLMutation {
@@ -60,6 +63,7 @@ export interface GQLMutation {
   UpdateUserPermissions: GQLUserInfo;
   CreateOrg: string;
   UpdateOrgSettings: GQLOrgInfo;
+  UpdateOrgBranding: GQLOrgBranding;
   CreateInviteToken: string;
   RevokeAllInviteTokens: boolean;
   RemoveUserFromOrg: boolean;
@@ -67,6 +71,16 @@ export interface GQLMutation {
   UpdateRetentionScript: boolean;
   CreateRetentionScript: string;
   DeleteRetentionScript: boolean;
+  CreateSavedQuery: GQLSavedQuery;
+  UpdateSavedQuery: GQLSavedQuery;
+  DeleteSavedQuery: boolean;
+}
+
+export interface GQLSubscription {
+  clusterStatus: GQLClusterInfo;
+  clusterUpdates: GQLClusterInfo;
+  deploymentProgress: GQLDeploymentProgress;
+  scriptExecutions: GQLScriptExecution;
 }
 
 export interface GQLUserInfo {
@@ -90,6 +104,12 @@ export interface GQLOrgInfo {
   domainName: string;
   enableApprovals: boolean;
   idePaths: Array<GQLIDEPath>;
+  branding: GQLOrgBranding;
+}
+
+export interface GQLOrgBranding {
+  productName: string;
+  logoURL: string;
 }
 
 export interface GQLUserSettings {
@@ -240,6 +260,37 @@ export interface GQLClusterInfo {
   previousStatusTimeMs?: number;
 }
 
+export interface GQLClusterStatusSummary {
+  id: string;
+  status: GQLClusterStatus;
+  lastHeartbeatMs: number;
+  vizierVersion: string;
+  operatorVersion: string;
+  clusterVersion: string;
+  clusterName: string;
+  clusterUID: string;
+  numNodes: number;
+  numInstrumentedNodes: number;
+}
+
+export interface GQLClusterStatusCount {
+  status: GQLClusterStatus;
+  count: number;
+}
+
+export interface GQLClusterVersionCount {
+  vizierVersion: string;
+  count: number;
+}
+
+export interface GQLClusterStatusPage {
+  clusters: Array<GQLClusterStatusSummary>;
+  nextCursor: string;
+  totalCount: number;
+  statusCounts: Array<GQLClusterStatusCount>;
+  versionCounts: Array<GQLClusterVersionCount>;
+}
+
 export interface GQLUserInvite {
   email: string;
   inviteLink: string;
@@ -277,6 +328,11 @@ export interface GQLEditableOrgSettings {
   enableApprovals?: boolean;
 }
 
+export interface GQLEditableOrgBranding {
+  productName?: string;
+  logoURL?: string;
+}
+
 export interface GQLPlugin {
   name: string;
   id: string;
@@ -362,6 +418,78 @@ export interface GQLEditableRetentionScript {
   customExportURL?: string;
 }
 
+export enum GQLSavedQueryScope {
+  SQS_UNKNOWN = 'SQS_UNKNOWN',
+  SQS_USER = 'SQS_USER',
+  SQS_TEAM = 'SQS_TEAM',
+  SQS_ORG = 'SQS_ORG'
+}
+
+export interface GQLSavedQueryArg {
+  name: string;
+  value: string;
+}
+
+export interface GQLSavedQuery {
+  id: string;
+  ownerID: string;
+  name: string;
+  description: string;
+  pxl: string;
+  args: Array<GQLSavedQueryArg>;
+  visJSON: string;
+  scope: GQLSavedQueryScope;
+  memberIDs: Array<string>;
+  allowEdit: boolean;
+  createdAtMs: number;
+  updatedAtMs: number;
+}
+
+export interface GQLSavedQueryArgInput {
+  name: string;
+  value: string;
+}
+
+export interface GQLEditableSavedQuery {
+  name?: string;
+  description?: string;
+  pxl?: string;
+  args?: Array<GQLSavedQueryArgInput>;
+  visJSON?: string;
+  scope?: GQLSavedQueryScope;
+  memberIDs?: Array<string>;
+  allowEdit?: boolean;
+}
+
+export interface GQLDeploymentProgress {
+  clusterID: string;
+  status: GQLClusterStatus;
+  statusMessage: string;
+  vizierVersion: string;
+  numNodes: number;
+  numInstrumentedNodes: number;
+  done: boolean;
+}
+
+export enum GQLScriptExecutionState {
+  SES_UNKNOWN = 'SES_UNKNOWN',
+  SES_RUNNING = 'SES_RUNNING',
+  SES_SUCCEEDED = 'SES_SUCCEEDED',
+  SES_FAILED = 'SES_FAILED',
+  SES_CANCELLED = 'SES_CANCELLED'
+}
+
+export interface GQLScriptExecution {
+  requestID: string;
+  clusterID: string;
+  userID: string;
+  state: GQLScriptExecutionState;
+  mutation: boolean;
+  errorMessage: string;
+  startTimeMs: number;
+  endTimeMs?: number;
+}
+
 /*********************************
  *                               *
  *         TYPE RESOLVERS        *
@@ -375,9 +503,11 @@ export interface GQLEditableRetentionScript {
 export interface GQLResolver {
   Query?: GQLQueryTypeResolver;
   Mutation?: GQLMutationTypeResolver;
+  Subscription?: GQLSubscriptionTypeResolver;
   UserInfo?: GQLUserInfoTypeResolver;
   IDEPath?: GQLIDEPathTypeResolver;
   OrgInfo?: GQLOrgInfoTypeResolver;
+  OrgBranding?: GQLOrgBrandingTypeResolver;
   UserSettings?: GQLUserSettingsTypeResolver;
   UserAttributes?: GQLUserAttributesTypeResolver;
   APIKeyMetadata?: GQLAPIKeyMetadataTypeResolver;
@@ -392,6 +522,10 @@ export interface GQLResolver {
   K8sEvent?: GQLK8sEventTypeResolver;
   PodStatus?: GQLPodStatusTypeResolver;
   ClusterInfo?: GQLClusterInfoTypeResolver;
+  ClusterStatusSummary?: GQLClusterStatusSummaryTypeResolver;
+  ClusterStatusCount?: GQLClusterStatusCountTypeResolver;
+  ClusterVersionCount?: GQLClusterVersionCountTypeResolver;
+  ClusterStatusPage?: GQLClusterStatusPageTypeResolver;
   UserInvite?: GQLUserInviteTypeResolver;
   LiveViewMetadata?: GQLLiveViewMetadataTypeResolver;
   LiveViewContents?: GQLLiveViewContentsTypeResolver;
@@ -404,6 +538,10 @@ export interface GQLResolver {
   RetentionPluginConfig?: GQLRetentionPluginConfigTypeResolver;
   RetentionScript?: GQLRetentionScriptTypeResolver;
   DetailedRetentionScript?: GQLDetailedRetentionScriptTypeResolver;
+  SavedQueryArg?: GQLSavedQueryArgTypeResolver;
+  SavedQuery?: GQLSavedQueryTypeResolver;
+  DeploymentProgress?: GQLDeploymentProgressTypeResolver;
+  ScriptExecution?: GQLScriptExecutionTypeResolver;
 }
 export interface GQLQueryTypeResolver<TParent = any> {
   noop?: QueryToNoopResolver<TParent>;
@@ -416,6 +554,7 @@ export interface GQLQueryTypeResolver<TParent = any> {
   cluster?: QueryToClusterResolver<TParent>;
   clusterByName?: QueryToClusterByNameResolver<TParent>;
   clusters?: QueryToClustersResolver<TParent>;
+  clusterStatuses?: QueryToClusterStatusesResolver<TParent>;
   autocomplete?: QueryToAutocompleteResolver<TParent>;
   autocompleteField?: QueryToAutocompleteFieldResolver<TParent>;
   liveViews?: QueryToLiveViewsResolver<TParent>;
@@ -432,6 +571,8 @@ export interface GQLQueryTypeResolver<TParent = any> {
   retentionPluginConfig?: QueryToRetentionPluginConfigResolver<TParent>;
   retentionScripts?: QueryToRetentionScriptsResolver<TParent>;
   retentionScript?: QueryToRetentionScriptResolver<TParent>;
+  savedQueries?: QueryToSavedQueriesResolver<TParent>;
+  savedQuery?: QueryToSavedQueryResolver<TParent>;
 }
 
 export interface QueryToNoopResolver<TParent = any, TResult = any> {
@@ -483,6 +624,17 @@ export interface QueryToClustersResolver<TParent = any, TResult = any> {
   (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface QueryToClusterStatusesArgs {
+  statuses?: Array<GQLClusterStatus>;
+  vizierVersion?: string;
+  nameContains?: string;
+  pageSize?: number;
+  cursor?: string;
+}
+export interface QueryToClusterStatusesResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: QueryToClusterStatusesArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
 export interface QueryToAutocompleteArgs {
   input?: string;
   cursorPos?: number;
@@ -587,6 +739,20 @@ export interface QueryToRetentionScriptResolver<TParent = any, TResult = any> {
   (parent: TParent, args: QueryToRetentionScriptArgs, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface QueryToSavedQueriesArgs {
+  name?: string;
+}
+export interface QueryToSavedQueriesResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: QueryToSavedQueriesArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface QueryToSavedQueryArgs {
+  id: string;
+}
+export interface QueryToSavedQueryResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: QueryToSavedQueryArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
 export interface GQLMutationTypeResolver<TParent = any> {
   noop?: MutationToNoopResolver<TParent>;
   CreateCluster?: MutationToCreateClusterResolver<TParent>;
@@ -601,6 +767,7 @@ export interface GQLMutationTypeResolver<TParent = any> {
   UpdateUserPermissions?: MutationToUpdateUserPermissionsResolver<TParent>;
   CreateOrg?: MutationToCreateOrgResolver<TParent>;
   UpdateOrgSettings?: MutationToUpdateOrgSettingsResolver<TParent>;
+  UpdateOrgBranding?: MutationToUpdateOrgBrandingResolver<TParent>;
   CreateInviteToken?: MutationToCreateInviteTokenResolver<TParent>;
   RevokeAllInviteTokens?: MutationToRevokeAllInviteTokensResolver<TParent>;
   RemoveUserFromOrg?: MutationToRemoveUserFromOrgResolver<TParent>;
@@ -608,6 +775,9 @@ export interface GQLMutationTypeResolver<TParent = any> {
   UpdateRetentionScript?: MutationToUpdateRetentionScriptResolver<TParent>;
   CreateRetentionScript?: MutationToCreateRetentionScriptResolver<TParent>;
   DeleteRetentionScript?: MutationToDeleteRetentionScriptResolver<TParent>;
+  CreateSavedQuery?: MutationToCreateSavedQueryResolver<TParent>;
+  UpdateSavedQuery?: MutationToUpdateSavedQueryResolver<TParent>;
+  DeleteSavedQuery?: MutationToDeleteSavedQueryResolver<TParent>;
 }
 
 export interface MutationToNoopResolver<TParent = any, TResult = any> {
@@ -690,6 +860,14 @@ export interface MutationToUpdateOrgSettingsResolver<TParent = any, TResult = an
   (parent: TParent, args: MutationToUpdateOrgSettingsArgs, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface MutationToUpdateOrgBrandingArgs {
+  orgID: string;
+  branding: GQLEditableOrgBranding;
+}
+export interface MutationToUpdateOrgBrandingResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: MutationToUpdateOrgBrandingArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
 export interface MutationToCreateInviteTokenArgs {
   orgID: string;
 }
@@ -743,6 +921,64 @@ export interface MutationToDeleteRetentionScriptResolver<TParent = any, TResult
   (parent: TParent, args: MutationToDeleteRetentionScriptArgs, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface MutationToCreateSavedQueryArgs {
+  query: GQLEditableSavedQuery;
+}
+export interface MutationToCreateSavedQueryResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: MutationToCreateSavedQueryArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface MutationToUpdateSavedQueryArgs {
+  id: string;
+  query: GQLEditableSavedQuery;
+}
+export interface MutationToUpdateSavedQueryResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: MutationToUpdateSavedQueryArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface MutationToDeleteSavedQueryArgs {
+  id: string;
+}
+export interface MutationToDeleteSavedQueryResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: MutationToDeleteSavedQueryArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLSubscriptionTypeResolver<TParent = any> {
+  clusterStatus?: SubscriptionToClusterStatusResolver<TParent>;
+  clusterUpdates?: SubscriptionToClusterUpdatesResolver<TParent>;
+  deploymentProgress?: SubscriptionToDeploymentProgressResolver<TParent>;
+  scriptExecutions?: SubscriptionToScriptExecutionsResolver<TParent>;
+}
+
+export interface SubscriptionToClusterStatusArgs {
+  id: string;
+}
+export interface SubscriptionToClusterStatusResolver<TParent = any, TResult = any> {
+  resolve?: (parent: TParent, args: SubscriptionToClusterStatusArgs, context: any, info: GraphQLResolveInfo) => TResult | Promise<TResult>;
+  subscribe: (parent: TParent, args: SubscriptionToClusterStatusArgs, context: any, info: GraphQLResolveInfo) => AsyncIterator<TResult> | Promise<AsyncIterator<TResult>>;
+}
+
+export interface SubscriptionToClusterUpdatesResolver<TParent = any, TResult = any> {
+  resolve?: (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo) => TResult | Promise<TResult>;
+  subscribe: (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo) => AsyncIterator<TResult> | Promise<AsyncIterator<TResult>>;
+}
+
+export interface SubscriptionToDeploymentProgressArgs {
+  id: string;
+}
+export interface SubscriptionToDeploymentProgressResolver<TParent = any, TResult = any> {
+  resolve?: (parent: TParent, args: SubscriptionToDeploymentProgressArgs, context: any, info: GraphQLResolveInfo) => TResult | Promise<TResult>;
+  subscribe: (parent: TParent, args: SubscriptionToDeploymentProgressArgs, context: any, info: GraphQLResolveInfo) => AsyncIterator<TResult> | Promise<AsyncIterator<TResult>>;
+}
+
+export interface SubscriptionToScriptExecutionsArgs {
+  clusterID?: string;
+}
+export interface SubscriptionToScriptExecutionsResolver<TParent = any, TResult = any> {
+  resolve?: (parent: TParent, args: SubscriptionToScriptExecutionsArgs, context: any, info: GraphQLResolveInfo) => TResult | Promise<TResult>;
+  subscribe: (parent: TParent, args: SubscriptionToScriptExecutionsArgs, context: any, info: GraphQLResolveInfo) => AsyncIterator<TResult> | Promise<AsyncIterator<TResult>>;
+}
+
 export interface GQLUserInfoTypeResolver<TParent = any> {
   id?: UserInfoToIdResolver<TParent>;
   name?: UserInfoToNameResolver<TParent>;
@@ -800,6 +1036,7 @@ export interface GQLOrgInfoTypeResolver<TParent = any> {
   domainName?: OrgInfoToDomainNameResolver<TParent>;
   enableApprovals?: OrgInfoToEnableApprovalsResolver<TParent>;
   idePaths?: OrgInfoToIdePathsResolver<TParent>;
+  branding?: OrgInfoToBrandingResolver<TParent>;
 }
 
 export interface OrgInfoToIdResolver<TParent = any, TResult = any> {
@@ -822,6 +1059,23 @@ export interface OrgInfoToIdePathsResolver<TParent = any, TResult = any> {
   (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface OrgInfoToBrandingResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLOrgBrandingTypeResolver<TParent = any> {
+  productName?: OrgBrandingToProductNameResolver<TParent>;
+  logoURL?: OrgBrandingToLogoURLResolver<TParent>;
+}
+
+export interface OrgBrandingToProductNameResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface OrgBrandingToLogoURLResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
 export interface GQLUserSettingsTypeResolver<TParent = any> {
   analyticsOptout?: UserSettingsToAnalyticsOptoutResolver<TParent>;
   id?: UserSettingsToIdResolver<TParent>;
@@ -1184,6 +1438,113 @@ export interface ClusterInfoToPreviousStatusTimeMsResolver<TParent = any, TResul
   (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface GQLClusterStatusSummaryTypeResolver<TParent = any> {
+  id?: ClusterStatusSummaryToIdResolver<TParent>;
+  status?: ClusterStatusSummaryToStatusResolver<TParent>;
+  lastHeartbeatMs?: ClusterStatusSummaryToLastHeartbeatMsResolver<TParent>;
+  vizierVersion?: ClusterStatusSummaryToVizierVersionResolver<TParent>;
+  operatorVersion?: ClusterStatusSummaryToOperatorVersionResolver<TParent>;
+  clusterVersion?: ClusterStatusSummaryToClusterVersionResolver<TParent>;
+  clusterName?: ClusterStatusSummaryToClusterNameResolver<TParent>;
+  clusterUID?: ClusterStatusSummaryToClusterUIDResolver<TParent>;
+  numNodes?: ClusterStatusSummaryToNumNodesResolver<TParent>;
+  numInstrumentedNodes?: ClusterStatusSummaryToNumInstrumentedNodesResolver<TParent>;
+}
+
+export interface ClusterStatusSummaryToIdResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToStatusResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToLastHeartbeatMsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToVizierVersionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToOperatorVersionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToClusterVersionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToClusterNameResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToClusterUIDResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToNumNodesResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusSummaryToNumInstrumentedNodesResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLClusterStatusCountTypeResolver<TParent = any> {
+  status?: ClusterStatusCountToStatusResolver<TParent>;
+  count?: ClusterStatusCountToCountResolver<TParent>;
+}
+
+export interface ClusterStatusCountToStatusResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusCountToCountResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLClusterVersionCountTypeResolver<TParent = any> {
+  vizierVersion?: ClusterVersionCountToVizierVersionResolver<TParent>;
+  count?: ClusterVersionCountToCountResolver<TParent>;
+}
+
+export interface ClusterVersionCountToVizierVersionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterVersionCountToCountResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLClusterStatusPageTypeResolver<TParent = any> {
+  clusters?: ClusterStatusPageToClustersResolver<TParent>;
+  nextCursor?: ClusterStatusPageToNextCursorResolver<TParent>;
+  totalCount?: ClusterStatusPageToTotalCountResolver<TParent>;
+  statusCounts?: ClusterStatusPageToStatusCountsResolver<TParent>;
+  versionCounts?: ClusterStatusPageToVersionCountsResolver<TParent>;
+}
+
+export interface ClusterStatusPageToClustersResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusPageToNextCursorResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusPageToTotalCountResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusPageToStatusCountsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ClusterStatusPageToVersionCountsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
 export interface GQLUserInviteTypeResolver<TParent = any> {
   email?: UserInviteToEmailResolver<TParent>;
   inviteLink?: UserInviteToInviteLinkResolver<TParent>;
@@ -1474,3 +1835,160 @@ export interface DetailedRetentionScriptToCustomExportURLResolver<TParent = any,
 export interface DetailedRetentionScriptToIsPresetResolver<TParent = any, TResult = any> {
   (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
 }
+
+export interface GQLSavedQueryArgTypeResolver<TParent = any> {
+  name?: SavedQueryArgToNameResolver<TParent>;
+  value?: SavedQueryArgToValueResolver<TParent>;
+}
+
+export interface SavedQueryArgToNameResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryArgToValueResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLSavedQueryTypeResolver<TParent = any> {
+  id?: SavedQueryToIdResolver<TParent>;
+  ownerID?: SavedQueryToOwnerIDResolver<TParent>;
+  name?: SavedQueryToNameResolver<TParent>;
+  description?: SavedQueryToDescriptionResolver<TParent>;
+  pxl?: SavedQueryToPxlResolver<TParent>;
+  args?: SavedQueryToArgsResolver<TParent>;
+  visJSON?: SavedQueryToVisJSONResolver<TParent>;
+  scope?: SavedQueryToScopeResolver<TParent>;
+  memberIDs?: SavedQueryToMemberIDsResolver<TParent>;
+  allowEdit?: SavedQueryToAllowEditResolver<TParent>;
+  createdAtMs?: SavedQueryToCreatedAtMsResolver<TParent>;
+  updatedAtMs?: SavedQueryToUpdatedAtMsResolver<TParent>;
+}
+
+export interface SavedQueryToIdResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToOwnerIDResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToNameResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToDescriptionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToPxlResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToArgsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToVisJSONResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToScopeResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToMemberIDsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToAllowEditResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToCreatedAtMsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface SavedQueryToUpdatedAtMsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLDeploymentProgressTypeResolver<TParent = any> {
+  clusterID?: DeploymentProgressToClusterIDResolver<TParent>;
+  status?: DeploymentProgressToStatusResolver<TParent>;
+  statusMessage?: DeploymentProgressToStatusMessageResolver<TParent>;
+  vizierVersion?: DeploymentProgressToVizierVersionResolver<TParent>;
+  numNodes?: DeploymentProgressToNumNodesResolver<TParent>;
+  numInstrumentedNodes?: DeploymentProgressToNumInstrumentedNodesResolver<TParent>;
+  done?: DeploymentProgressToDoneResolver<TParent>;
+}
+
+export interface DeploymentProgressToClusterIDResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface DeploymentProgressToStatusResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface DeploymentProgressToStatusMessageResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface DeploymentProgressToVizierVersionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface DeploymentProgressToNumNodesResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface DeploymentProgressToNumInstrumentedNodesResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface DeploymentProgressToDoneResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLScriptExecutionTypeResolver<TParent = any> {
+  requestID?: ScriptExecutionToRequestIDResolver<TParent>;
+  clusterID?: ScriptExecutionToClusterIDResolver<TParent>;
+  userID?: ScriptExecutionToUserIDResolver<TParent>;
+  state?: ScriptExecutionToStateResolver<TParent>;
+  mutation?: ScriptExecutionToMutationResolver<TParent>;
+  errorMessage?: ScriptExecutionToErrorMessageResolver<TParent>;
+  startTimeMs?: ScriptExecutionToStartTimeMsResolver<TParent>;
+  endTimeMs?: ScriptExecutionToEndTimeMsResolver<TParent>;
+}
+
+export interface ScriptExecutionToRequestIDResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ScriptExecutionToClusterIDResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ScriptExecutionToUserIDResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ScriptExecutionToStateResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ScriptExecutionToMutationResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ScriptExecutionToErrorMessageResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ScriptExecutionToStartTimeMsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface ScriptExecutionToEndTimeMsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
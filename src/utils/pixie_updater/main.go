@@ -19,6 +19,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -31,6 +32,7 @@ import (
 	"k8s.io/client-go/rest"
 
 	"px.dev/pixie/src/shared/services"
+	"px.dev/pixie/src/shared/services/retry"
 	"px.dev/pixie/src/utils/shared/artifacts"
 	"px.dev/pixie/src/utils/shared/k8s"
 	yamlsutils "px.dev/pixie/src/utils/shared/yamls"
@@ -237,20 +239,16 @@ func main() {
 	log.Info("Done with update/install!")
 }
 
-func retryDeploy(clientset *kubernetes.Clientset, config *rest.Config, namespace string, yamlContents string) error {
-	tries := 12
-	var err error
-	for tries > 0 {
-		err = k8s.ApplyYAML(clientset, config, namespace, strings.NewReader(yamlContents), false)
-		if err == nil {
-			return nil
-		}
+// deployRetryPolicy is the policy for retrying YAML deploys, which may fail while the cluster settles.
+var deployRetryPolicy = retry.Policy{
+	InitialInterval: 5 * time.Second,
+	Multiplier:      1,
+	DisableJitter:   true,
+	MaxAttempts:     12,
+}
 
-		time.Sleep(5 * time.Second)
-		tries--
-	}
-	if tries == 0 {
-		return err
-	}
-	return nil
+func retryDeploy(clientset *kubernetes.Clientset, config *rest.Config, namespace string, yamlContents string) error {
+	return retry.Do(context.Background(), deployRetryPolicy, func() error {
+		return k8s.ApplyYAML(clientset, config, namespace, strings.NewReader(yamlContents), false)
+	})
 }
@@ -25,22 +25,62 @@ import (
 	"net/http"
 	"regexp"
 	"sort"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/shared/services/retry"
 	"px.dev/pixie/src/utils/shared/tar"
 	"px.dev/pixie/src/utils/shared/yamls"
 )
 
+// downloadRetryPolicy is the policy for retrying artifact downloads, which can fail transiently when the network or
+// the artifact storage is flaky.
+var downloadRetryPolicy = retry.Policy{
+	InitialInterval: 1 * time.Second,
+	MaxAttempts:     5,
+}
+
 func downloadFile(url string) (io.ReadCloser, error) {
-	// Get the data
-	resp, err := http.Get(url)
+	var body io.ReadCloser
+	err := retry.Do(context.Background(), downloadRetryPolicy, func() error {
+		resp, err := http.Get(url)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err := fmt.Errorf("failed to download artifact: %s", resp.Status)
+			// Only server errors and throttling are worth retrying.
+			if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+				return err
+			}
+			return retry.Permanent(err)
+		}
+		body = resp.Body
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	return body, nil
+}
+
+func getDownloadLink(ctx context.Context, client cloudpb.ArtifactTrackerClient, req *cloudpb.GetDownloadLinkRequest) (*cloudpb.GetDownloadLinkResponse, error) {
+	var resp *cloudpb.GetDownloadLinkResponse
+	err := retry.Do(ctx, downloadRetryPolicy, func() error {
+		var err error
+		resp, err = client.GetDownloadLink(ctx, req)
+		if err != nil && status.Code(err) != codes.Unavailable {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+	return resp, err
 }
 
 func downloadVizierYAMLs(conn *grpc.ClientConn, authToken, versionStr string, templated bool) (io.ReadCloser, error) {
@@ -58,7 +98,7 @@ func downloadVizierYAMLs(conn *grpc.ClientConn, authToken, versionStr string, te
 	ctxWithCreds := metadata.AppendToOutgoingContext(context.Background(), "authorization",
 		fmt.Sprintf("bearer %s", authToken))
 
-	resp, err := client.GetDownloadLink(ctxWithCreds, req)
+	resp, err := getDownloadLink(ctxWithCreds, client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -134,7 +174,7 @@ func FetchOperatorTemplates(conn *grpc.ClientConn, versionStr string) ([]*yamls.
 		ArtifactType: cloudpb.AT_CONTAINER_SET_TEMPLATE_YAMLS,
 	}
 
-	resp, err := client.GetDownloadLink(context.Background(), req)
+	resp, err := getDownloadLink(context.Background(), client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -200,6 +200,62 @@ func GenerateVizierCertYAMLs(namespace string) (string, error) {
 		return "", err
 	}
 
+	return vizierCertYAMLs(namespace, clientCert, clientKey, serverCert, serverKey, caCert)
+}
+
+// CSRSigner signs certificate signing requests with an external CA.
+type CSRSigner interface {
+	// SignCSR returns the PEM encoded cert that was issued for the PEM encoded CSR.
+	SignCSR(csr []byte) ([]byte, error)
+}
+
+// generateCSRAndKey generates a private key, and a PEM encoded CSR for a cert with the given DNS names.
+func generateCSRAndKey(dnsNames []string) ([]byte, []byte, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bitsize)
+	if err != nil {
+		return nil, nil, err
+	}
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  x509Name,
+		DNSNames: dnsNames,
+	}, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	csrData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})
+	keyData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	return csrData, keyData, nil
+}
+
+func signCSRAndKey(signer CSRSigner, dnsNames []string) ([]byte, []byte, error) {
+	csr, key, err := generateCSRAndKey(dnsNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := signer.SignCSR(csr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// GenerateVizierCertYAMLsWithSigner generates the yamls for vizier certs, which are signed by an external CA
+// instead of a generated one. caCert is the PEM encoded trust root of the external CA.
+func GenerateVizierCertYAMLsWithSigner(namespace string, signer CSRSigner, caCert []byte) (string, error) {
+	clientCert, clientKey, err := signCSRAndKey(signer, getVizierDNSNamesForNamespace(namespace))
+	if err != nil {
+		return "", err
+	}
+	serverCert, serverKey, err := signCSRAndKey(signer, getVizierDNSNamesForNamespace(namespace))
+	if err != nil {
+		return "", err
+	}
+
+	return vizierCertYAMLs(namespace, clientCert, clientKey, serverCert, serverKey, caCert)
+}
+
+func vizierCertYAMLs(namespace string, clientCert, clientKey, serverCert, serverKey, caCert []byte) (string, error) {
 	var yamls []string
 
 	proxyCert, err := k8s.CreateGenericSecretFromLiterals(namespace, "proxy-tls-certs", map[string]string{
@@ -98,7 +98,7 @@ func (o MockGCSObjectHandle) getObj() (*MockGCSObject, error) {
 	}
 	obj, ok := bkt.objects[o.name]
 	if !ok {
-		return nil, fmt.Errorf("object %q not found in bucket %q", o.name, o.bucketName)
+		return nil, fmt.Errorf("object %q not found in bucket %q: %w", o.name, o.bucketName, storage.ErrObjectNotExist)
 	}
 	return obj, nil
 }
@@ -48,12 +48,14 @@ class VizierFuncFactoryContext : public NotCopyable {
       const agent::BaseManager* agent_manager, const std::shared_ptr<MDSStub>& mds_stub,
       const std::shared_ptr<MDTPStub>& mdtp_stub,
       const std::shared_ptr<services::metadata::CronScriptStoreService::Stub>& cronscript_stub,
+      const std::shared_ptr<services::metadata::MetadataQueryStatsService::Stub>& querystats_stub,
       std::shared_ptr<::px::table_store::TableStore> table_store,
       std::function<void(grpc::ClientContext* ctx)> add_grpc_auth)
       : agent_manager_(agent_manager),
         mds_stub_(mds_stub),
         mdtp_stub_(mdtp_stub),
         cronscript_stub_(cronscript_stub),
+        querystats_stub_(querystats_stub),
         table_store_(table_store),
         add_auth_to_grpc_context_func_(add_grpc_auth) {}
   virtual ~VizierFuncFactoryContext() = default;
@@ -76,6 +78,10 @@ class VizierFuncFactoryContext : public NotCopyable {
     CHECK(cronscript_stub_ != nullptr);
     return cronscript_stub_;
   }
+  std::shared_ptr<services::metadata::MetadataQueryStatsService::Stub> querystats_stub() const {
+    CHECK(querystats_stub_ != nullptr);
+    return querystats_stub_;
+  }
 
   ::px::table_store::TableStore* table_store() const { return table_store_.get(); }
 
@@ -89,6 +95,7 @@ class VizierFuncFactoryContext : public NotCopyable {
   std::shared_ptr<MDSStub> mds_stub_ = nullptr;
   std::shared_ptr<MDTPStub> mdtp_stub_ = nullptr;
   std::shared_ptr<services::metadata::CronScriptStoreService::Stub> cronscript_stub_ = nullptr;
+  std::shared_ptr<services::metadata::MetadataQueryStatsService::Stub> querystats_stub_ = nullptr;
   std::shared_ptr<::px::table_store::TableStore> table_store_ = nullptr;
   std::function<void(grpc::ClientContext*)> add_auth_to_grpc_context_func_;
 };
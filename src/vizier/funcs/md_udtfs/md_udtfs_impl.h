@@ -28,6 +28,7 @@
 #include <vector>
 
 #include <absl/numeric/int128.h>
+#include <absl/strings/strip.h>
 #include <grpcpp/grpcpp.h>
 #include <magic_enum.hpp>
 
@@ -85,6 +86,20 @@ class UDTFWithCronscriptFactory : public carnot::udf::UDTFFactory {
   const VizierFuncFactoryContext& ctx_;
 };
 
+template <typename TUDTF>
+class UDTFWithQueryStatsFactory : public carnot::udf::UDTFFactory {
+ public:
+  UDTFWithQueryStatsFactory() = delete;
+  explicit UDTFWithQueryStatsFactory(const VizierFuncFactoryContext& ctx) : ctx_(ctx) {}
+
+  std::unique_ptr<carnot::udf::AnyUDTF> Make() override {
+    return std::make_unique<TUDTF>(ctx_.querystats_stub(), ctx_.add_auth_to_grpc_context_func());
+  }
+
+ private:
+  const VizierFuncFactoryContext& ctx_;
+};
+
 template <typename TUDTF>
 class UDTFWithRegistryFactory : public carnot::udf::UDTFFactory {
  public:
@@ -706,6 +721,85 @@ class GetDebugMDWithPrefix final : public carnot::udf::UDTF<GetDebugMDWithPrefix
   std::function<void(grpc::ClientContext*)> add_context_authentication_func_;
 };
 
+/**
+ * This UDTF fetches the restarts, OOMKills, terminations and readiness failures of containers
+ * over the last day.
+ */
+class GetContainerEvents final : public carnot::udf::UDTF<GetContainerEvents> {
+ public:
+  using MDSStub = vizier::services::metadata::MetadataService::Stub;
+  GetContainerEvents() = delete;
+  GetContainerEvents(std::shared_ptr<MDSStub> stub,
+                     std::function<void(grpc::ClientContext*)> add_context_authentication)
+      : stub_(stub), add_context_authentication_func_(add_context_authentication) {}
+
+  static constexpr auto Executor() { return carnot::udfspb::UDTFSourceExecutor::UDTF_ONE_KELVIN; }
+
+  static constexpr auto OutputRelation() {
+    return MakeArray(
+        ColInfo("time_", types::DataType::TIME64NS, types::PatternType::GENERAL,
+                "The time of the event"),
+        ColInfo("event_type", types::DataType::STRING, types::PatternType::GENERAL,
+                "The type of the event: RESTARTED, OOM_KILLED, TERMINATED or NOT_READY"),
+        ColInfo("pod", types::DataType::STRING, types::PatternType::GENERAL,
+                "The name of the pod, in the form <namespace>/<name>",
+                types::SemanticType::ST_POD_NAME),
+        ColInfo("container", types::DataType::STRING, types::PatternType::GENERAL,
+                "The name of the container", types::SemanticType::ST_CONTAINER_NAME),
+        ColInfo("container_id", types::DataType::STRING, types::PatternType::GENERAL,
+                "The id of the container"),
+        ColInfo("reason", types::DataType::STRING, types::PatternType::GENERAL,
+                "Why the container terminated, such as OOMKilled or Error"),
+        ColInfo("message", types::DataType::STRING, types::PatternType::GENERAL,
+                "The message for why the container terminated"),
+        ColInfo("exit_code", types::DataType::INT64, types::PatternType::GENERAL,
+                "The exit code of the container, for terminations"),
+        ColInfo("restart_count", types::DataType::INT64, types::PatternType::GENERAL,
+                "The number of restarts of the container after the event"));
+  }
+
+  Status Init(FunctionContext*) {
+    px::vizier::services::metadata::ContainerEventsRequest req;
+    resp_ = std::make_unique<px::vizier::services::metadata::ContainerEventsResponse>();
+
+    grpc::ClientContext ctx;
+    add_context_authentication_func_(&ctx);
+    auto s = stub_->GetContainerEvents(&ctx, req, resp_.get());
+    if (!s.ok()) {
+      return error::Internal("Failed to make RPC call to GetContainerEvents: $0",
+                             s.error_message());
+    }
+    return Status::OK();
+  }
+
+  bool NextRecord(FunctionContext*, RecordWriter* rw) {
+    if (resp_->events_size() == 0) {
+      return false;
+    }
+    const auto& event = resp_->events(idx_);
+
+    rw->Append<IndexOf("time_")>(event.time_ns());
+    rw->Append<IndexOf("event_type")>(
+        std::string(absl::StripPrefix(magic_enum::enum_name(event.type()), "CONTAINER_EVENT_")));
+    rw->Append<IndexOf("pod")>(event.pod_name());
+    rw->Append<IndexOf("container")>(event.container_name());
+    rw->Append<IndexOf("container_id")>(event.container_id());
+    rw->Append<IndexOf("reason")>(event.reason());
+    rw->Append<IndexOf("message")>(event.message());
+    rw->Append<IndexOf("exit_code")>(event.exit_code());
+    rw->Append<IndexOf("restart_count")>(event.restart_count());
+
+    ++idx_;
+    return idx_ < resp_->events_size();
+  }
+
+ private:
+  int idx_ = 0;
+  std::unique_ptr<px::vizier::services::metadata::ContainerEventsResponse> resp_;
+  std::shared_ptr<MDSStub> stub_;
+  std::function<void(grpc::ClientContext*)> add_context_authentication_func_;
+};
+
 /**
  * This UDTF dumps the debug information for all registered tables.
  */
@@ -990,6 +1084,87 @@ class GetCronScriptHistory final : public carnot::udf::UDTF<GetCronScriptHistory
   std::function<void(grpc::ClientContext*)> add_context_authentication_func_;
 };
 
+/**
+ * This UDTF fetches how often and how expensively each table and namespace was queried, to help
+ * size the table retention and decide which tracers to disable.
+ */
+class GetQueryStats final : public carnot::udf::UDTF<GetQueryStats> {
+ public:
+  using QueryStatsStub = vizier::services::metadata::MetadataQueryStatsService::Stub;
+  using QueryStatsResponse = vizier::services::metadata::GetQueryStatsResponse;
+  GetQueryStats() = delete;
+  explicit GetQueryStats(std::shared_ptr<QueryStatsStub> stub,
+                         std::function<void(grpc::ClientContext*)> add_context_authentication)
+      : stub_(stub), add_context_authentication_func_(std::move(add_context_authentication)) {}
+
+  static constexpr auto Executor() { return carnot::udfspb::UDTFSourceExecutor::UDTF_ONE_KELVIN; }
+
+  static constexpr auto OutputRelation() {
+    return MakeArray(
+        ColInfo("kind", types::DataType::STRING, types::PatternType::GENERAL,
+                "Whether the stats are of a table or a namespace"),
+        ColInfo("name", types::DataType::STRING, types::PatternType::GENERAL,
+                "The name of the table or namespace, empty for queries without a namespace"),
+        ColInfo("num_queries", types::DataType::INT64, types::PatternType::METRIC_COUNTER,
+                "The number of queries"),
+        ColInfo("num_failed", types::DataType::INT64, types::PatternType::METRIC_COUNTER,
+                "The number of queries that failed or were cancelled"),
+        ColInfo("total_exec_time_ns", types::DataType::INT64, types::PatternType::METRIC_COUNTER,
+                "The total execution time of the queries", types::SemanticType::ST_DURATION_NS),
+        ColInfo("max_exec_time_ns", types::DataType::INT64, types::PatternType::METRIC_GAUGE,
+                "The longest execution time of a query", types::SemanticType::ST_DURATION_NS),
+        ColInfo("bytes_processed", types::DataType::INT64, types::PatternType::METRIC_COUNTER,
+                "The number of bytes processed by the queries", types::SemanticType::ST_BYTES),
+        ColInfo("records_processed", types::DataType::INT64, types::PatternType::METRIC_COUNTER,
+                "The number of records processed by the queries"),
+        ColInfo("last_queried_at", types::DataType::TIME64NS, types::PatternType::GENERAL,
+                "When a query last finished"));
+  }
+
+  Status Init(FunctionContext*) {
+    px::vizier::services::metadata::GetQueryStatsRequest req;
+    resp_ = std::make_unique<QueryStatsResponse>();
+
+    grpc::ClientContext ctx;
+    add_context_authentication_func_(&ctx);
+    auto s = stub_->GetQueryStats(&ctx, req, resp_.get());
+    if (!s.ok()) {
+      return error::Internal("Failed to make RPC call to GetQueryStats: $0", s.error_message());
+    }
+    return Status::OK();
+  }
+
+  bool NextRecord(FunctionContext*, RecordWriter* rw) {
+    int num_tables = resp_->tables_size();
+    int total = num_tables + resp_->namespaces_size();
+    if (total == 0) {
+      return false;
+    }
+    bool is_table = idx_ < num_tables;
+    const auto& stats = is_table ? resp_->tables(idx_) : resp_->namespaces(idx_ - num_tables);
+
+    rw->Append<IndexOf("kind")>(is_table ? "table" : "namespace");
+    rw->Append<IndexOf("name")>(stats.name());
+    rw->Append<IndexOf("num_queries")>(stats.num_queries());
+    rw->Append<IndexOf("num_failed")>(stats.num_failed());
+    rw->Append<IndexOf("total_exec_time_ns")>(stats.total_exec_time_ns());
+    rw->Append<IndexOf("max_exec_time_ns")>(stats.max_exec_time_ns());
+    rw->Append<IndexOf("bytes_processed")>(stats.bytes_processed());
+    rw->Append<IndexOf("records_processed")>(stats.records_processed());
+    rw->Append<IndexOf("last_queried_at")>(types::Time64NSValue(
+        stats.last_queried_at().seconds() * 1000000000 + stats.last_queried_at().nanos()));
+
+    ++idx_;
+    return idx_ < total;
+  }
+
+ private:
+  int idx_ = 0;
+  std::unique_ptr<QueryStatsResponse> resp_;
+  std::shared_ptr<QueryStatsStub> stub_;
+  std::function<void(grpc::ClientContext*)> add_context_authentication_func_;
+};
+
 }  // namespace md
 }  // namespace funcs
 }  // namespace vizier
@@ -18,6 +18,13 @@
 
 #include "src/vizier/services/agent/pem/pem_manager.h"
 
+#include <string>
+#include <vector>
+
+#include <absl/container/flat_hash_map.h>
+#include <absl/strings/numbers.h>
+#include <absl/strings/str_split.h>
+
 #include "src/common/system/config.h"
 #include "src/vizier/services/agent/shared/manager/exec.h"
 #include "src/vizier/services/agent/shared/manager/manager.h"
@@ -43,10 +50,46 @@ DEFINE_int32(table_store_proc_exit_events_limit_bytes,
              gflags::Int32FromEnv("PL_TABLE_STORE_PROC_EXIT_EVENTS_LIMIT_BYTES", 10 * 1024 * 1024),
              "The maximum amount of data to store in the proc_exit_events table.");
 
+DEFINE_string(table_store_table_size_limits,
+              gflags::StringFromEnv("PL_TABLE_STORE_TABLE_SIZE_LIMITS_MB", ""),
+              "Comma separated list of table=MB pairs that set the maximum amount of data to store "
+              "in specific tables. The remaining data limit is split evenly across the other "
+              "tables. e.g. http_events=512,conn_stats=64");
+
+DEFINE_string(table_store_retention, gflags::StringFromEnv("PL_TABLE_STORE_RETENTION_S", ""),
+              "Comma separated list of table=seconds pairs that set the maximum age of the data "
+              "kept in specific tables. e.g. http_events=3600,conn_stats=86400");
+
+DEFINE_int64(table_store_default_retention,
+             gflags::Int64FromEnv("PL_TABLE_STORE_DEFAULT_RETENTION_S", 0),
+             "The maximum age in seconds of the data kept in tables without a retention in "
+             "--table_store_retention. Defaults to 0, which keeps data until the table is full.");
+
 namespace px {
 namespace vizier {
 namespace agent {
 
+namespace {
+
+// Parses a comma separated list of name=value pairs, where each value is a non-negative integer.
+StatusOr<absl::flat_hash_map<std::string, int64_t>> ParseTableValues(std::string_view flag_name,
+                                                                     std::string_view values) {
+  absl::flat_hash_map<std::string, int64_t> parsed;
+  for (std::string_view entry : absl::StrSplit(values, ',', absl::SkipWhitespace())) {
+    std::vector<std::string_view> parts = absl::StrSplit(entry, absl::MaxSplits('=', 1));
+    int64_t value;
+    if (parts.size() != 2 || parts[0].empty() || !absl::SimpleAtoi(parts[1], &value) ||
+        value < 0) {
+      return error::InvalidArgument("Invalid entry '$0' in --$1, expected table=value.", entry,
+                                    flag_name);
+    }
+    parsed[parts[0]] = value;
+  }
+  return parsed;
+}
+
+}  // namespace
+
 Status PEMManager::InitImpl() {
   PX_RETURN_IF_ERROR(InitClockConverters());
   StartNodeMemoryCollector();
@@ -99,10 +142,30 @@ Status PEMManager::InitSchemas() {
   const int64_t probe_status_table_size = FLAGS_table_store_stirling_error_limit_bytes / 2;
   const int64_t proc_exit_events_table_size = FLAGS_table_store_proc_exit_events_limit_bytes;
 
+  PX_ASSIGN_OR_RETURN(
+      auto table_size_limits_mb,
+      ParseTableValues("table_store_table_size_limits", FLAGS_table_store_table_size_limits));
+  PX_ASSIGN_OR_RETURN(auto table_retention_s,
+                      ParseTableValues("table_store_retention", FLAGS_table_store_retention));
+
+  // Tables with an explicit size limit are sized before any of the defaults are applied.
+  int64_t used_memory = 0;
+  int64_t num_sized_tables = 0;
+  for (const auto& relation_info : relation_info_vec) {
+    auto it = table_size_limits_mb.find(relation_info.name);
+    if (it != table_size_limits_mb.end()) {
+      used_memory += it->second * 1024 * 1024;
+      ++num_sized_tables;
+    }
+  }
+
   // Determine which of the four default tables are present
   bool has_http_events = false, has_stirling_error = false, has_probe_status = false,
        has_proc_exit_events = false;
   for (const auto& relation_info : relation_info_vec) {
+    if (table_size_limits_mb.contains(relation_info.name)) {
+      continue;
+    }
     if (relation_info.name == "http_events") {
       has_http_events = true;
     } else if (relation_info.name == "stirling_error") {
@@ -115,7 +178,6 @@ Status PEMManager::InitSchemas() {
   }
 
   // Calculate memory used by specific tables
-  int64_t used_memory = 0;
   if (has_http_events) {
     used_memory += http_table_size;
   }
@@ -134,14 +196,19 @@ Status PEMManager::InitSchemas() {
     return error::Internal("Table store data limit is too low to store the tables.");
   }
   const int64_t other_table_count =
-      num_tables - (has_http_events + has_stirling_error + has_probe_status + has_proc_exit_events);
+      num_tables - num_sized_tables -
+      (has_http_events + has_stirling_error + has_probe_status + has_proc_exit_events);
   const int64_t other_table_size =
       (other_table_count > 0) ? remaining_memory / other_table_count : 0;
 
   // Create tables with allocated sizes
   for (const auto& relation_info : relation_info_vec) {
     std::shared_ptr<table_store::Table> table_ptr;
-    if (relation_info.name == "http_events") {
+    auto size_limit_it = table_size_limits_mb.find(relation_info.name);
+    if (size_limit_it != table_size_limits_mb.end()) {
+      table_ptr = std::make_shared<table_store::Table>(relation_info.name, relation_info.relation,
+                                                       size_limit_it->second * 1024 * 1024);
+    } else if (relation_info.name == "http_events") {
       // Special case to set the max size of the http_events table differently from the other
       // tables. For now, the min cold batch size is set to 256kB to be consistent with previous
       // behaviour.
@@ -161,6 +228,17 @@ Status PEMManager::InitSchemas() {
                                                        other_table_size);
     }
 
+    int64_t retention_s = FLAGS_table_store_default_retention;
+    auto retention_it = table_retention_s.find(relation_info.name);
+    if (retention_it != table_retention_s.end()) {
+      retention_s = retention_it->second;
+    }
+    if (retention_s > 0) {
+      table_ptr->SetRetention(
+          std::chrono::duration_cast<std::chrono::nanoseconds>(std::chrono::seconds(retention_s))
+              .count());
+    }
+
     table_store()->AddTable(std::move(table_ptr), relation_info.name, relation_info.id);
     PX_RETURN_IF_ERROR(relation_info_manager()->AddRelationInfo(relation_info));
   }
@@ -95,6 +95,14 @@ std::shared_ptr<services::metadata::CronScriptStoreService::Stub> CreateCronScri
   return std::make_shared<services::metadata::CronScriptStoreService::Stub>(chan);
 }
 
+std::shared_ptr<services::metadata::MetadataQueryStatsService::Stub> CreateQueryStatsStub(
+    const std::shared_ptr<grpc::Channel>& chan) {
+  if (chan == nullptr) {
+    return nullptr;
+  }
+  return std::make_shared<services::metadata::MetadataQueryStatsService::Stub>(chan);
+}
+
 Manager::Manager(sole::uuid agent_id, std::string_view pod_name, std::string_view host_ip,
                  int grpc_server_port, services::shared::agent::AgentCapabilities capabilities,
                  services::shared::agent::AgentParameters parameters, std::string_view nats_url,
@@ -108,7 +116,8 @@ Manager::Manager(sole::uuid agent_id, std::string_view pod_name, std::string_vie
       relation_info_manager_(std::make_unique<RelationInfoManager>()),
       mds_channel_(grpc::CreateChannel(std::string(mds_url), grpc_channel_creds_)),
       func_context_(this, CreateMDSStub(mds_channel_), CreateMDTPStub(mds_channel_),
-                    CreateCronScriptStub(mds_channel_), table_store_,
+                    CreateCronScriptStub(mds_channel_), CreateQueryStatsStub(mds_channel_),
+                    table_store_,
                     [](grpc::ClientContext* ctx) { AddServiceTokenToClientContext(ctx); }),
       memory_metrics_(&GetMetricsRegistry(), "agent_id", agent_id.str()) {
   // Register Vizier specific and carnot builtin functions.
@@ -153,6 +162,10 @@ Status Manager::Init() {
 
   LOG(INFO) << "Hostname: " << info_.hostname;
 
+  if (!SSL::AgentNATSCredsFile().empty()) {
+    PX_RETURN_IF_ERROR(FetchAgentNATSCreds());
+  }
+
   // Set up the agent NATS connector.
   agent_nats_connector_ = std::make_unique<Manager::VizierNATSConnector>(
       nats_addr_, kAgentPubTopic /*pub_topic*/,
@@ -180,6 +193,36 @@ Status Manager::Init() {
   return InitImpl();
 }
 
+Status Manager::FetchAgentNATSCreds() {
+  auto stub = CreateMDSStub(mds_channel_);
+  services::metadata::AgentNATSCredentialsRequest req;
+  ToProto(info_.agent_id, req.mutable_agent_id());
+  req.set_k8s_update_selector(k8s_update_selector());
+
+  // The metadata service may still be starting up along with the agent.
+  grpc::Status s;
+  services::metadata::AgentNATSCredentialsResponse resp;
+  for (int attempt = 0; attempt < kAgentNATSCredsMaxAttempts; ++attempt) {
+    if (attempt > 0) {
+      std::this_thread::sleep_for(kAgentNATSCredsRetryPeriod);
+    }
+    grpc::ClientContext ctx;
+    AddServiceTokenToClientContext(&ctx);
+    ctx.set_deadline(std::chrono::system_clock::now() + kAgentNATSCredsTimeout);
+    s = stub->GetAgentNATSCredentials(&ctx, req, &resp);
+    if (s.ok()) {
+      return WriteFileFromString(SSL::AgentNATSCredsFile(), resp.creds());
+    }
+    if (s.error_code() != grpc::StatusCode::UNAVAILABLE &&
+        s.error_code() != grpc::StatusCode::DEADLINE_EXCEEDED) {
+      break;
+    }
+    LOG(WARNING) << "Failed to get the NATS credentials of the agent: " << s.error_message();
+  }
+  return error::ResourceUnavailable("Failed to get the NATS credentials of the agent: $0",
+                                    s.error_message());
+}
+
 Status Manager::Run() {
   running_ = true;
   dispatcher_->Run(px::event::Dispatcher::RunType::Block);
@@ -331,6 +374,8 @@ Status Manager::PostRegisterHook(uint32_t asid) {
     // the default pool.
     auto status = table_store()->RunCompaction(arrow::default_memory_pool());
     LOG_IF(ERROR, !status.ok()) << status.msg();
+    status = table_store()->ExpireByRetention();
+    LOG_IF(ERROR, !status.ok()) << status.msg();
     if (tablestore_compaction_timer_) {
       tablestore_compaction_timer_->EnableTimer(kTableStoreCompactionPeriod);
     }
@@ -69,6 +69,12 @@ constexpr auto kMemoryMetricsCollectPeriod = std::chrono::minutes(1);
 
 constexpr auto kMetricsPushPeriod = std::chrono::minutes(1);
 
+constexpr int kAgentNATSCredsMaxAttempts = 30;
+
+constexpr auto kAgentNATSCredsRetryPeriod = std::chrono::seconds(2);
+
+constexpr auto kAgentNATSCredsTimeout = std::chrono::seconds(10);
+
 // Generates a service bearer token for authenticated requests.
 std::string GenerateServiceToken();
 
@@ -152,6 +158,9 @@ class Manager : public BaseManager {
   std::unique_ptr<ResultSinkStub> ResultSinkStubGenerator(const std::string& remote_addr,
                                                           const std::string& ssl_targetname);
   void NATSMessageHandler(VizierNATSConnector::MsgType msg);
+  // Gets the NATS credentials of this agent from the metadata service, and stores them where the
+  // NATS connectors pick them up.
+  Status FetchAgentNATSCreds();
   Status RegisterBackgroundHelpers();
   Status PostRegisterHook(uint32_t asid);
   Status ReregisterHook();
@@ -32,6 +32,22 @@ DEFINE_string(client_tls_key,
 DEFINE_string(tls_ca_crt, gflags::StringFromEnv("PL_TLS_CA_CERT", "../../services/certs/ca.crt"),
               "The GRPC CA cert");
 
+DEFINE_string(nats_tls_ca_cert, gflags::StringFromEnv("PL_NATS_TLS_CA_CERT", ""),
+              "The CA cert of the NATS servers. Defaults to the GRPC CA cert");
+
+DEFINE_string(nats_tls_cert, gflags::StringFromEnv("PL_NATS_TLS_CERT", ""),
+              "The TLS cert to present to NATS. Defaults to the GRPC client TLS cert");
+
+DEFINE_string(nats_tls_key, gflags::StringFromEnv("PL_NATS_TLS_KEY", ""),
+              "The TLS key to present to NATS. Defaults to the GRPC client TLS key");
+
+DEFINE_string(nats_creds, gflags::StringFromEnv("PL_NATS_CREDS", ""),
+              "The NATS credentials file to authenticate with, for NATS clusters that require it");
+
+DEFINE_string(nats_agent_creds, gflags::StringFromEnv("PL_NATS_AGENT_CREDS", ""),
+              "Where to store the NATS credentials that the metadata service issues to this agent. If "
+              "set, they are used instead of --nats_creds");
+
 namespace px {
 namespace vizier {
 namespace agent {
@@ -55,15 +71,19 @@ std::shared_ptr<grpc::ChannelCredentials> SSL::DefaultGRPCClientCreds() {
 
 std::unique_ptr<NATSTLSConfig> SSL::DefaultNATSCreds() {
   auto tls_config = std::make_unique<NATSTLSConfig>();
+  tls_config->creds_file =
+      FLAGS_nats_agent_creds.empty() ? FLAGS_nats_creds : FLAGS_nats_agent_creds;
   if (!SSL::Enabled()) {
     return tls_config;
   }
-  tls_config->ca_cert = FLAGS_tls_ca_crt;
-  tls_config->tls_cert = FLAGS_client_tls_cert;
-  tls_config->tls_key = FLAGS_client_tls_key;
+  tls_config->ca_cert = FLAGS_nats_tls_ca_cert.empty() ? FLAGS_tls_ca_crt : FLAGS_nats_tls_ca_cert;
+  tls_config->tls_cert = FLAGS_nats_tls_cert.empty() ? FLAGS_client_tls_cert : FLAGS_nats_tls_cert;
+  tls_config->tls_key = FLAGS_nats_tls_key.empty() ? FLAGS_client_tls_key : FLAGS_nats_tls_key;
   return tls_config;
 }
 
+std::string SSL::AgentNATSCredsFile() { return FLAGS_nats_agent_creds; }
+
 std::shared_ptr<grpc::ServerCredentials> SSL::DefaultGRPCServerCreds() {
   if (!SSL::Enabled()) {
     return grpc::InsecureServerCredentials();
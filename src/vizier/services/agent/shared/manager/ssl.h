@@ -20,6 +20,7 @@
 
 #include <grpcpp/grpcpp.h>
 #include <memory>
+#include <string>
 
 #include "src/common/event/nats.h"
 
@@ -56,6 +57,12 @@ class SSL {
    * Returns the defaul creds for NATS.
    */
   static std::unique_ptr<px::event::NATSTLSConfig> DefaultNATSCreds();
+
+  /*
+   * Returns where the NATS credentials issued to the agent are stored, or empty if the agent uses
+   * the credentials of its component.
+   */
+  static std::string AgentNATSCredsFile();
 };
 
 }  // namespace agent
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"sync"
+	"time"
+)
+
+// maxPendingHeartbeats bounds the heartbeats that are waiting for an ack, since the acks of heartbeats that were
+// sent over a broken stream never arrive.
+const maxPendingHeartbeats = 64
+
+// connQualityTracker measures the quality of the connection to the cloud, so that the cloud can tell clusters with
+// a flaky network apart from unhealthy viziers. The round trip time is measured from when a heartbeat is sent until
+// its ack arrives.
+type connQualityTracker struct {
+	mu            sync.Mutex
+	hbSentAt      map[int64]time.Time
+	rtt           time.Duration
+	connectedOnce bool
+	numReconnects int64
+}
+
+func (t *connQualityTracker) heartbeatSent(seqNum int64, sentAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hbSentAt == nil {
+		t.hbSentAt = make(map[int64]time.Time)
+	}
+	if len(t.hbSentAt) >= maxPendingHeartbeats {
+		t.hbSentAt = make(map[int64]time.Time)
+	}
+	t.hbSentAt[seqNum] = sentAt
+}
+
+func (t *connQualityTracker) heartbeatAcked(seqNum int64, ackedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sentAt, ok := t.hbSentAt[seqNum]
+	if !ok {
+		return
+	}
+	delete(t.hbSentAt, seqNum)
+	t.rtt = ackedAt.Sub(sentAt)
+}
+
+// connected records that the bridge to the cloud was established. Every connection after the first one is a
+// reconnect.
+func (t *connQualityTracker) connected() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.connectedOnce {
+		t.numReconnects++
+	}
+	t.connectedOnce = true
+}
+
+// take returns the latest round trip time, and the number of reconnects since the last call to take.
+func (t *connQualityTracker) take() (time.Duration, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	numReconnects := t.numReconnects
+	t.numReconnects = 0
+	return t.rtt, numReconnects
+}
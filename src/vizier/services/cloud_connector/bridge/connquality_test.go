@@ -0,0 +1,70 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnQualityTracker_RTT(t *testing.T) {
+	tracker := &connQualityTracker{}
+	start := time.Unix(0, 0)
+
+	rtt, _ := tracker.take()
+	assert.Equal(t, time.Duration(0), rtt)
+
+	tracker.heartbeatSent(1, start)
+	tracker.heartbeatSent(2, start.Add(5*time.Second))
+	tracker.heartbeatAcked(2, start.Add(5*time.Second+30*time.Millisecond))
+	rtt, _ = tracker.take()
+	assert.Equal(t, 30*time.Millisecond, rtt)
+
+	// Acks of unknown or already acked heartbeats are ignored.
+	tracker.heartbeatAcked(2, start.Add(time.Minute))
+	tracker.heartbeatAcked(3, start.Add(time.Minute))
+	rtt, _ = tracker.take()
+	assert.Equal(t, 30*time.Millisecond, rtt)
+
+	// Heartbeats that are never acked don't pile up.
+	for i := int64(0); i < 2*maxPendingHeartbeats; i++ {
+		tracker.heartbeatSent(10+i, start)
+	}
+	assert.LessOrEqual(t, len(tracker.hbSentAt), maxPendingHeartbeats)
+}
+
+func TestConnQualityTracker_Reconnects(t *testing.T) {
+	tracker := &connQualityTracker{}
+
+	// The first connection isn't a reconnect.
+	tracker.connected()
+	_, numReconnects := tracker.take()
+	assert.Equal(t, int64(0), numReconnects)
+
+	tracker.connected()
+	tracker.connected()
+	_, numReconnects = tracker.take()
+	assert.Equal(t, int64(2), numReconnects)
+
+	// The count is reset after it is taken.
+	_, numReconnects = tracker.take()
+	assert.Equal(t, int64(0), numReconnects)
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
+)
+
+func init() {
+	pflag.Int("offline_buffer_max_messages", 5000, "The most messages that are buffered while Pixie Cloud is unreachable, to be replayed once it is reachable again. 0 disables the buffer")
+	pflag.Int("offline_buffer_max_bytes", 32*1024*1024, "The most bytes of messages that are buffered while Pixie Cloud is unreachable")
+}
+
+type bufferedMsg struct {
+	key  [sha256.Size]byte
+	msg  *vzconnpb.V2CBridgeMessage
+	size int
+}
+
+// offlineBuffer holds the heartbeats, metrics and status messages that can't be sent to the cloud right away, in
+// the order they were published. When the buffer is full, the oldest messages are evicted, since the newest
+// ones best reflect the current state of the vizier.
+type offlineBuffer struct {
+	maxMsgs  int
+	maxBytes int
+
+	mu      sync.Mutex
+	msgs    []*bufferedMsg
+	bytes   int
+	keys    map[[sha256.Size]byte]struct{}
+	evicted int64
+	// evictedSinceTake is the number of evicted messages since the last call to takeEvicted.
+	evictedSinceTake int64
+}
+
+func newOfflineBuffer(maxMsgs, maxBytes int) *offlineBuffer {
+	return &offlineBuffer{
+		maxMsgs:  maxMsgs,
+		maxBytes: maxBytes,
+		keys:     make(map[[sha256.Size]byte]struct{}),
+	}
+}
+
+// dedupKey identifies a message by its contents, so that a message that is published more than once while the
+// cloud is unreachable is only replayed once.
+func dedupKey(m *vzconnpb.V2CBridgeMessage) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(m.Topic))
+	h.Write([]byte{0})
+	h.Write([]byte(m.Msg.GetTypeUrl()))
+	h.Write([]byte{0})
+	h.Write(m.Msg.GetValue())
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// add appends a message to the buffer. It returns false if the message was not buffered, because it is already
+// in the buffer or is too large to ever fit.
+func (b *offlineBuffer) add(m *vzconnpb.V2CBridgeMessage) bool {
+	key := dedupKey(m)
+	size := len(m.Msg.GetValue())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.keys[key]; ok {
+		return false
+	}
+	if b.maxMsgs <= 0 || size > b.maxBytes {
+		b.logEvictionLocked(m.Topic)
+		return false
+	}
+	for len(b.msgs) >= b.maxMsgs || b.bytes+size > b.maxBytes {
+		oldest := b.msgs[0]
+		b.removeFrontLocked()
+		b.logEvictionLocked(oldest.msg.Topic)
+	}
+
+	b.msgs = append(b.msgs, &bufferedMsg{key: key, msg: m, size: size})
+	b.keys[key] = struct{}{}
+	b.bytes += size
+	return true
+}
+
+func (b *offlineBuffer) logEvictionLocked(topic string) {
+	if b.evicted%100 == 0 {
+		log.WithField("Topic", topic).
+			WithField("droppedCount", b.evicted).
+			Warn("Dropping message because the offline buffer is full")
+	}
+	b.evicted++
+	b.evictedSinceTake++
+}
+
+// takeEvicted returns the number of messages that were evicted since the last call to takeEvicted.
+func (b *offlineBuffer) takeEvicted() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	evicted := b.evictedSinceTake
+	b.evictedSinceTake = 0
+	return evicted
+}
+
+func (b *offlineBuffer) removeFrontLocked() {
+	front := b.msgs[0]
+	b.msgs[0] = nil
+	b.msgs = b.msgs[1:]
+	delete(b.keys, front.key)
+	b.bytes -= front.size
+}
+
+// peek returns the oldest message in the buffer, or nil if the buffer is empty.
+func (b *offlineBuffer) peek() *vzconnpb.V2CBridgeMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.msgs) == 0 {
+		return nil
+	}
+	return b.msgs[0].msg
+}
+
+// pop removes m from the buffer if it is still the oldest message. It may have been evicted since it was
+// peeked at.
+func (b *offlineBuffer) pop(m *vzconnpb.V2CBridgeMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.msgs) > 0 && b.msgs[0].msg == m {
+		b.removeFrontLocked()
+	}
+}
+
+func (b *offlineBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.msgs)
+}
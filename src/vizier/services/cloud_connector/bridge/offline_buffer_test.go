@@ -0,0 +1,123 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+)
+
+func makeBridgeMsg(t *testing.T, topic string, data string) *vzconnpb.V2CBridgeMessage {
+	anyMsg, err := types.MarshalAny(&cvmsgspb.VLogMessage{Data: []byte(data)})
+	require.NoError(t, err)
+	return &vzconnpb.V2CBridgeMessage{Topic: topic, Msg: anyMsg}
+}
+
+func drain(b *offlineBuffer) []*vzconnpb.V2CBridgeMessage {
+	var msgs []*vzconnpb.V2CBridgeMessage
+	for m := b.peek(); m != nil; m = b.peek() {
+		msgs = append(msgs, m)
+		b.pop(m)
+	}
+	return msgs
+}
+
+func TestOfflineBuffer_Order(t *testing.T) {
+	b := newOfflineBuffer(10, 1024)
+	m1 := makeBridgeMsg(t, HeartbeatTopic, "1")
+	m2 := makeBridgeMsg(t, "status", "2")
+	m3 := makeBridgeMsg(t, HeartbeatTopic, "3")
+	for _, m := range []*vzconnpb.V2CBridgeMessage{m1, m2, m3} {
+		assert.True(t, b.add(m))
+	}
+
+	assert.Equal(t, 3, b.len())
+	assert.Equal(t, []*vzconnpb.V2CBridgeMessage{m1, m2, m3}, drain(b))
+	assert.Equal(t, 0, b.len())
+	assert.Nil(t, b.peek())
+}
+
+func TestOfflineBuffer_Dedup(t *testing.T) {
+	b := newOfflineBuffer(10, 1024)
+	assert.True(t, b.add(makeBridgeMsg(t, "status", "a")))
+	assert.False(t, b.add(makeBridgeMsg(t, "status", "a")))
+	// The same contents on another topic are a different message.
+	assert.True(t, b.add(makeBridgeMsg(t, "other", "a")))
+	assert.Equal(t, 2, b.len())
+
+	// Once replayed, the message may be published again.
+	drain(b)
+	assert.True(t, b.add(makeBridgeMsg(t, "status", "a")))
+}
+
+func TestOfflineBuffer_EvictsOldest(t *testing.T) {
+	b := newOfflineBuffer(2, 1024)
+	m1 := makeBridgeMsg(t, "status", "1")
+	m2 := makeBridgeMsg(t, "status", "2")
+	m3 := makeBridgeMsg(t, "status", "3")
+	for _, m := range []*vzconnpb.V2CBridgeMessage{m1, m2, m3} {
+		assert.True(t, b.add(m))
+	}
+	assert.Equal(t, []*vzconnpb.V2CBridgeMessage{m2, m3}, drain(b))
+	assert.Equal(t, int64(1), b.takeEvicted())
+	assert.Equal(t, int64(0), b.takeEvicted())
+
+	// The evicted message is no longer considered a duplicate.
+	assert.True(t, b.add(m1))
+}
+
+func TestOfflineBuffer_MaxBytes(t *testing.T) {
+	small := makeBridgeMsg(t, "status", "aaaa")
+	size := len(small.Msg.Value)
+	b := newOfflineBuffer(10, 2*size)
+
+	m1 := makeBridgeMsg(t, "status", "bbbb")
+	m2 := makeBridgeMsg(t, "status", "cccc")
+	m3 := makeBridgeMsg(t, "status", "dddd")
+	for _, m := range []*vzconnpb.V2CBridgeMessage{m1, m2, m3} {
+		assert.True(t, b.add(m))
+	}
+	assert.False(t, b.add(makeBridgeMsg(t, "status", "this message is too large to fit")))
+	assert.Equal(t, []*vzconnpb.V2CBridgeMessage{m2, m3}, drain(b))
+}
+
+func TestOfflineBuffer_PopAfterEviction(t *testing.T) {
+	b := newOfflineBuffer(1, 1024)
+	m1 := makeBridgeMsg(t, "status", "1")
+	m2 := makeBridgeMsg(t, "status", "2")
+	b.add(m1)
+	assert.Equal(t, m1, b.peek())
+
+	// m1 is evicted between being peeked at and replayed, so popping it leaves m2 in place.
+	b.add(m2)
+	b.pop(m1)
+	assert.Equal(t, m2, b.peek())
+}
+
+func TestOfflineBuffer_Disabled(t *testing.T) {
+	b := newOfflineBuffer(0, 1024)
+	assert.False(t, b.add(makeBridgeMsg(t, "status", "1")))
+	assert.Equal(t, 0, b.len())
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/vizier/messages/messagespb"
+)
+
+// queryCountTracker counts the queries that the query broker finished since the previous heartbeat, so
+// that the cloud can track the query success rate of the cluster.
+type queryCountTracker struct {
+	mu        sync.Mutex
+	numTotal  int64
+	numFailed int64
+}
+
+func (t *queryCountTracker) handleMessage(msg *nats.Msg) {
+	record := &messagespb.QueryStatsRecord{}
+	err := proto.Unmarshal(msg.Data, record)
+	if err != nil {
+		log.WithError(err).Error("Failed to unmarshal query stats")
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.numTotal++
+	if record.Failed {
+		t.numFailed++
+	}
+}
+
+// take returns the number of queries, and of failed queries, since the last call to take.
+func (t *queryCountTracker) take() (int64, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	numTotal, numFailed := t.numTotal, t.numFailed
+	t.numTotal, t.numFailed = 0, 0
+	return numTotal, numFailed
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/vizier/messages/messagespb"
+)
+
+func TestQueryCountTracker_Take(t *testing.T) {
+	tracker := &queryCountTracker{}
+	for _, failed := range []bool{false, true, false} {
+		b, err := proto.Marshal(&messagespb.QueryStatsRecord{QueryName: "px/cluster", Failed: failed})
+		require.NoError(t, err)
+		tracker.handleMessage(&nats.Msg{Data: b})
+	}
+
+	numQueries, numFailed := tracker.take()
+	assert.Equal(t, int64(3), numQueries)
+	assert.Equal(t, int64(1), numFailed)
+
+	// The counts are reset after they are taken.
+	numQueries, numFailed = tracker.take()
+	assert.Equal(t, int64(0), numQueries)
+	assert.Equal(t, int64(0), numFailed)
+}
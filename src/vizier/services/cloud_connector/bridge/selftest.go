@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/shared/cvmsgspb"
+)
+
+// maxFailedSelfTests is the maximum number of failed node self-tests sent in a heartbeat.
+const maxFailedSelfTests = 10
+
+// selfTestTracker keeps the latest per-node self-test results published by the query broker,
+// so that they can be reported with the heartbeats.
+type selfTestTracker struct {
+	mu     sync.Mutex
+	matrix *cvmsgspb.SelfTestMatrix
+}
+
+func (t *selfTestTracker) handleMessage(msg *nats.Msg) {
+	matrix := &cvmsgspb.SelfTestMatrix{}
+	err := proto.Unmarshal(msg.Data, matrix)
+	if err != nil {
+		log.WithError(err).Error("Failed to unmarshal self-test results")
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.matrix = matrix
+}
+
+// summary returns the number of nodes that passed every self-test check, and the results of
+// the nodes that failed at least one of them. At most maxFailedSelfTests failures are returned.
+func (t *selfTestTracker) summary() (int32, []*cvmsgspb.NodeSelfTest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.matrix == nil {
+		return 0, nil
+	}
+
+	passed := int32(0)
+	var failed []*cvmsgspb.NodeSelfTest
+	for _, node := range t.matrix.Nodes {
+		if nodePassed(node) {
+			passed++
+			continue
+		}
+		failed = append(failed, node)
+	}
+
+	// Sort so that the same nodes are reported in every heartbeat.
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].Hostname < failed[j].Hostname
+	})
+	if len(failed) > maxFailedSelfTests {
+		failed = failed[:maxFailedSelfTests]
+	}
+	return passed, failed
+}
+
+func nodePassed(node *cvmsgspb.NodeSelfTest) bool {
+	for _, check := range node.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
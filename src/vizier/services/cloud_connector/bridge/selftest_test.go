@@ -0,0 +1,64 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/cvmsgspb"
+)
+
+func TestSelfTestTracker_Summary(t *testing.T) {
+	tracker := &selfTestTracker{}
+	passed, failed := tracker.summary()
+	assert.Equal(t, int32(0), passed)
+	assert.Nil(t, failed)
+
+	matrix := &cvmsgspb.SelfTestMatrix{}
+	for i := 0; i < 3; i++ {
+		matrix.Nodes = append(matrix.Nodes, &cvmsgspb.NodeSelfTest{
+			Hostname: fmt.Sprintf("passing-%d", i),
+			Checks:   []*cvmsgspb.SelfTestCheck{{Name: "http_tracing", Passed: true}},
+		})
+	}
+	for i := maxFailedSelfTests + 1; i > 0; i-- {
+		matrix.Nodes = append(matrix.Nodes, &cvmsgspb.NodeSelfTest{
+			Hostname: fmt.Sprintf("failing-%02d", i),
+			Checks: []*cvmsgspb.SelfTestCheck{
+				{Name: "process_stats", Passed: true},
+				{Name: "http_tracing", Passed: false},
+			},
+		})
+	}
+	b, err := proto.Marshal(matrix)
+	require.NoError(t, err)
+	tracker.handleMessage(&nats.Msg{Data: b})
+
+	passed, failed = tracker.summary()
+	assert.Equal(t, int32(3), passed)
+	require.Len(t, failed, maxFailedSelfTests)
+	assert.Equal(t, "failing-01", failed[0].Hostname)
+	assert.Equal(t, "failing-10", failed[maxFailedSelfTests-1].Hostname)
+}
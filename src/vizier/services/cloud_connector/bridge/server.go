@@ -29,7 +29,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
 	"github.com/gofrs/uuid"
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
@@ -43,10 +42,14 @@ import (
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
 	"px.dev/pixie/src/shared/cvmsgs"
 	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/retry"
+	"px.dev/pixie/src/shared/services/tracing"
 	vzstatus "px.dev/pixie/src/shared/status"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
@@ -136,6 +139,13 @@ const (
 // ErrRegistrationTimeout is the registration timeout error.
 var ErrRegistrationTimeout = errors.New("Registration timeout")
 
+// ErrRegionRedirect is returned when Pixie Cloud redirects the vizier to the VZConn of another region.
+var ErrRegionRedirect = errors.New("redirected to another Pixie Cloud region")
+
+// maxRegionFailures is the number of consecutive failures to connect to a redirected region before
+// the vizier falls back to its default cloud address.
+const maxRegionFailures = 3
+
 const upgradeJobName = "vizier-upgrade-job"
 
 // VizierInfo fetches information about Vizier.
@@ -169,6 +179,8 @@ type VizierHealthChecker interface {
 
 // Bridge is the NATS<->GRPC bridge.
 type Bridge struct {
+	// idMu protects the vizierID and assignedClusterName, which are set when the deployment is registered.
+	idMu                sync.Mutex
 	vizierID            uuid.UUID
 	assignedClusterName string
 	jwtSigningKey       string
@@ -180,8 +192,19 @@ type Bridge struct {
 	vzOperator   VizierOperatorInfo
 	vizChecker   VizierHealthChecker
 
+	// regionAddr is the address of the VZConn that the cloud redirected us to, if any.
+	regionAddr string
+	// redirectAddr is the address in the last registration ack that redirected us to another region.
+	redirectAddr string
+	// regionFailures is the number of consecutive failures to connect to the VZConn at regionAddr.
+	regionFailures int
+
 	hbSeqNum int64
 
+	// signer signs all outgoing messages for this session, across reconnects. Its key is derived from the
+	// registration credentials, and changes with the nonce that the cloud picks for each stream.
+	signer *bridgesig.Signer
+
 	nc     *nats.Conn
 	natsCh chan *nats.Msg
 	// There are a two sets of streams that we manage for the GRPC side. The incoming
@@ -208,10 +231,22 @@ type Bridge struct {
 	updateRunning atomic.Value // True if an update is running
 	updateFailed  bool         // True if an update has failed (sticky).
 
-	droppedMessagesBeforeResume int64 // Number of messages dropped before successful resume.
+	// offline holds the messages that couldn't be sent to the cloud right away. They are replayed, in order,
+	// once the bridge is up again.
+	offline *offlineBuffer
+	// bridging is whether HandleNATSBridging is running. It is only accessed by the goroutine that publishes
+	// to the bridge, which is either the offline collector or HandleNATSBridging, never both at once.
+	bridging bool
+	// hbBridgedCount is the number of heartbeats published while the bridge was up. Heartbeats are also
+	// generated while the cloud is unreachable, so the watchdog uses this to detect a dead stream.
+	hbBridgedCount int64
 
 	natsMetricsCh chan *nats.Msg
 	metricsCh     <-chan *messagespb.MetricsMessage // Channel is used to pass metrics from the scraper to the bridge.
+
+	selfTests selfTestTracker    // The latest node self-test results, sent with the heartbeats.
+	queries   queryCountTracker  // The number of queries finished since the last heartbeat.
+	conn      connQualityTracker // The quality of the connection to the cloud.
 }
 
 // New creates a cloud connector to cloud bridge.
@@ -227,6 +262,7 @@ func New(vizierID uuid.UUID, assignedClusterName string, jwtSigningKey string, d
 		vzInfo:              vzInfo,
 		vzOperator:          vzOperator,
 		hbSeqNum:            0,
+		signer:              bridgesig.NewSigner(nil),
 		nc:                  nc,
 		// Buffer NATS channels to make sure we don't back-pressure NATS
 		natsCh:            make(chan *nats.Msg, 5000),
@@ -239,6 +275,24 @@ func New(vizierID uuid.UUID, assignedClusterName string, jwtSigningKey string, d
 		wdWg:              sync.WaitGroup{},
 		natsMetricsCh:     make(chan *nats.Msg, 5000),
 		metricsCh:         metricsCh,
+		offline:           newOfflineBuffer(viper.GetInt("offline_buffer_max_messages"), viper.GetInt("offline_buffer_max_bytes")),
+	}
+}
+
+// HandoffState is the state of the bridge that is handed off to the cloud connector that takes over from this one.
+type HandoffState struct {
+	VizierID   string `json:"vizierID"`
+	VizierName string `json:"vizierName"`
+}
+
+// GetHandoffState returns the state of the bridge to hand off to the cloud connector that takes over from this
+// one, so that it doesn't have to register the deployment again.
+func (s *Bridge) GetHandoffState() *HandoffState {
+	s.idMu.Lock()
+	defer s.idMu.Unlock()
+	return &HandoffState{
+		VizierID:   s.vizierID.String(),
+		VizierName: s.assignedClusterName,
 	}
 }
 
@@ -248,14 +302,14 @@ func (s *Bridge) WatchDog() {
 	t := time.NewTicker(10 * time.Minute)
 
 	for {
-		lastHbSeq := atomic.LoadInt64(&s.hbSeqNum)
+		lastHbCount := atomic.LoadInt64(&s.hbBridgedCount)
 		select {
 		case <-s.quitCh:
 			log.Trace("Quitting watchdog")
 			return
 		case <-t.C:
-			currentHbSeqNum := atomic.LoadInt64(&s.hbSeqNum)
-			if currentHbSeqNum == lastHbSeq {
+			currentHbCount := atomic.LoadInt64(&s.hbBridgedCount)
+			if currentHbCount == lastHbCount {
 				log.Fatal("Heartbeat messages failed, assuming stream is dead. Killing self to restart...")
 			}
 		}
@@ -296,8 +350,10 @@ func (s *Bridge) RegisterDeployment() error {
 	}
 
 	// Get cluster ID and assign to secrets.
+	s.idMu.Lock()
 	s.vizierID = utils.UUIDFromProtoOrNil(resp.VizierID)
 	s.assignedClusterName = resp.VizierName
+	s.idMu.Unlock()
 
 	err = s.vzInfo.UpdateClusterID(s.vizierID.String())
 	if err != nil {
@@ -306,57 +362,69 @@ func (s *Bridge) RegisterDeployment() error {
 	return s.vzInfo.UpdateClusterName(resp.VizierName)
 }
 
-// RunStream manages starting and restarting the stream to VZConn.
-func (s *Bridge) RunStream() {
-	s.updateRunning.Store(false)
-
-	if s.vzConnClient == nil {
-		var vzClient vzconnpb.VZConnServiceClient
-		var err error
+// vzConnRetryPolicy is the policy for retrying connecting and registering with VZConn.
+var vzConnRetryPolicy = retry.Policy{
+	InitialInterval: 30 * time.Second,
+	Multiplier:      2,
+	MaxElapsedTime:  30 * time.Minute,
+}
 
-		connect := func() error {
-			log.Info("Connecting to VZConn in Pixie Cloud...")
-			vzClient, err = NewVZConnClient(s.vzOperator)
-			if err != nil {
-				log.WithError(err).Error(fmt.Sprintf("Failed to connect to Pixie Cloud. Please check your firewall settings and confirm that %s is correct and accessible from your cluster.", viper.GetString("cloud_addr")))
-			}
-			return err
-		}
+// ConnectVZConn connects to VZConn in Pixie Cloud, retrying with backoff. Replicas connect before they are elected,
+// so that they can take over the bridge right away.
+func ConnectVZConn(vzOperator VizierOperatorInfo) vzconnpb.VZConnServiceClient {
+	var vzClient vzconnpb.VZConnServiceClient
+	var err error
 
-		backOffOpts := backoff.NewExponentialBackOff()
-		backOffOpts.InitialInterval = 30 * time.Second
-		backOffOpts.Multiplier = 2
-		backOffOpts.MaxElapsedTime = 30 * time.Minute
-		err = backoff.Retry(connect, backOffOpts)
+	connect := func() error {
+		log.Info("Connecting to VZConn in Pixie Cloud...")
+		vzClient, err = NewVZConnClient(vzOperator)
 		if err != nil {
-			log.WithError(err).Fatal(fmt.Sprintf("Failed to connect to Pixie Cloud. Please check your firewall settings and confirm that %s is correct and accessible from your cluster.", viper.GetString("cloud_addr")))
+			log.WithError(err).Error(fmt.Sprintf("Failed to connect to Pixie Cloud. Please check your firewall settings and confirm that %s is correct and accessible from your cluster.", viper.GetString("cloud_addr")))
 		}
-		log.Info("Successfully connected to Pixie Cloud via VZConn")
-		s.vzConnClient = vzClient
+		return err
 	}
 
-	if s.nc == nil {
-		var nc *nats.Conn
-		var err error
+	err = retry.Do(context.Background(), vzConnRetryPolicy, connect)
+	if err != nil {
+		log.WithError(err).Fatal(fmt.Sprintf("Failed to connect to Pixie Cloud. Please check your firewall settings and confirm that %s is correct and accessible from your cluster.", viper.GetString("cloud_addr")))
+	}
+	log.Info("Successfully connected to Pixie Cloud via VZConn")
+	return vzClient
+}
 
-		connectNats := func() error {
-			log.Info("Connecting to NATS...")
-			nc, err = nats.Connect(viper.GetString("nats_url"),
-				nats.ClientCert(viper.GetString("client_tls_cert"), viper.GetString("client_tls_key")),
-				nats.RootCAs(viper.GetString("tls_ca_cert")))
-			return err
-		}
+// ConnectNATS connects to the Vizier's NATS, retrying with backoff.
+func ConnectNATS() *nats.Conn {
+	var nc *nats.Conn
+	var err error
 
-		backOffOpts := backoff.NewExponentialBackOff()
-		backOffOpts.InitialInterval = NATSBackoffInitialInterval
-		backOffOpts.Multiplier = NATSBackoffMultipler
-		backOffOpts.MaxElapsedTime = 10 * time.Minute
-		err = backoff.Retry(connectNats, backOffOpts)
-		if err != nil {
-			log.WithError(err).Fatal("Could not connect to NATS. Please check for the `pl-nats` pods in the namespace to confirm they are healthy and running.")
-		}
-		log.Info("Successfully connected to NATS")
-		s.nc = nc
+	connectNats := func() error {
+		log.Info("Connecting to NATS...")
+		nc, err = nats.Connect(viper.GetString("nats_url"), msgbus.NATSConnectOptions()...)
+		return err
+	}
+
+	err = retry.Do(context.Background(), retry.Policy{
+		InitialInterval: NATSBackoffInitialInterval,
+		Multiplier:      NATSBackoffMultipler,
+		MaxElapsedTime:  NATSBackoffMaxElapsedTime,
+	}, connectNats)
+	if err != nil {
+		log.WithError(err).Fatal("Could not connect to NATS. Please check for the `pl-nats` pods in the namespace to confirm they are healthy and running.")
+	}
+	log.Info("Successfully connected to NATS")
+	return nc
+}
+
+// RunStream manages starting and restarting the stream to VZConn.
+func (s *Bridge) RunStream() {
+	s.updateRunning.Store(false)
+
+	if s.vzConnClient == nil {
+		s.vzConnClient = ConnectVZConn(s.vzOperator)
+	}
+
+	if s.nc == nil {
+		s.nc = ConnectNATS()
 	}
 
 	s.nc.SetErrorHandler(func(conn *nats.Conn, subscription *nats.Subscription, err error) {
@@ -390,6 +458,30 @@ func (s *Bridge) RunStream() {
 		}
 	}()
 
+	log.WithField("topic", messagebus.SelfTestTopic).Trace("Subscribing to SelfTest topic on NATS")
+	selfTestSub, err := s.nc.Subscribe(messagebus.SelfTestTopic, s.selfTests.handleMessage)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to SelfTest topic on NATS. Please check for the `pl-nats` pods in the namespace to confirm they are healthy and running.")
+	}
+	defer func() {
+		err := selfTestSub.Unsubscribe()
+		if err != nil {
+			log.WithError(err).Error("Failed to unsubscribe from NATS self-test topic.")
+		}
+	}()
+
+	log.WithField("topic", messagebus.QueryStatsTopic).Trace("Subscribing to QueryStats topic on NATS")
+	queryStatsSub, err := s.nc.Subscribe(messagebus.QueryStatsTopic, s.queries.handleMessage)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to QueryStats topic on NATS. Please check for the `pl-nats` pods in the namespace to confirm they are healthy and running.")
+	}
+	defer func() {
+		err := queryStatsSub.Unsubscribe()
+		if err != nil {
+			log.WithError(err).Error("Failed to unsubscribe from NATS query stats topic.")
+		}
+	}()
+
 	// Check if there is an existing update job. If so, then set the status to "UPDATING".
 	_, err = s.vzInfo.GetJob(upgradeJobName)
 	if err != nil && !k8sErrors.IsNotFound(err) {
@@ -633,10 +725,10 @@ func (s *Bridge) handleMetricsMessage(msg *messagespb.MetricsMessage) error {
 	if err != nil {
 		return err
 	}
-	return s.publishBridgeCh(cvmsgs.VizierMetricsChannel, anyMsg)
+	return s.publishBridgeCh(context.Background(), cvmsgs.VizierMetricsChannel, anyMsg)
 }
 
-func (s *Bridge) doRegistrationHandshake(stream vzconnpb.VZConnService_NATSBridgeClient) error {
+func (s *Bridge) doRegistrationHandshake(stream vzconnpb.VZConnService_NATSBridgeClient, verifier *bridgesig.Verifier) error {
 	clusterInfo, err := s.vzInfo.GetVizierClusterInfo()
 	if err != nil {
 		log.WithError(err).Error("Unable to get k8s cluster info")
@@ -648,6 +740,9 @@ func (s *Bridge) doRegistrationHandshake(stream vzconnpb.VZConnService_NATSBridg
 		ClusterInfo: clusterInfo,
 	}
 
+	// The registration is signed with the key for the session, and the rest of the stream with the key for the
+	// nonce in the registerAck.
+	s.signer.SetKey(bridgesig.DeriveKey(s.jwtSigningKey, s.vizierID, s.sessionID, nil))
 	err = s.publishBridgeSync(stream, "register", regReq)
 	if err != nil {
 		return err
@@ -679,6 +774,15 @@ func (s *Bridge) doRegistrationHandshake(stream vzconnpb.VZConnService_NATSBridg
 				return errors.New("registration unsuccessful: " + err.Error())
 			}
 
+			if registerAck.RedirectAddr != "" {
+				log.WithField("region", registerAck.Region).
+					WithField("addr", registerAck.RedirectAddr).
+					Info("Pixie Cloud redirected vizier to another region")
+				s.redirectAddr = registerAck.RedirectAddr
+				return ErrRegionRedirect
+			}
+			s.signer.SetKey(verifier.Key())
+
 			if s.assignedClusterName == "" {
 				// Deliberately not returning the error. We don't want to kill a cluster
 				// in case something goes wrong in the update process.
@@ -693,6 +797,44 @@ func (s *Bridge) doRegistrationHandshake(stream vzconnpb.VZConnService_NATSBridg
 	}
 }
 
+// switchRegion connects to the VZConn of the region that the cloud redirected us to. The next registration
+// attempt goes through the new VZConn.
+func (s *Bridge) switchRegion(addr string) {
+	if addr == s.regionAddr {
+		return
+	}
+	vzClient, err := newVZConnClientForAddr(addr)
+	if err != nil {
+		log.WithError(err).WithField("addr", addr).Error("Failed to connect to redirected Pixie Cloud region")
+		s.handleRegionFailure()
+		return
+	}
+	s.vzConnClient = vzClient
+	s.regionAddr = addr
+	s.regionFailures = 0
+}
+
+// handleRegionFailure tracks failures to connect to a redirected region. If the region keeps failing, we
+// fall back to the default cloud address, which redirects us to a healthy region.
+func (s *Bridge) handleRegionFailure() {
+	if s.regionAddr == "" {
+		return
+	}
+	s.regionFailures++
+	if s.regionFailures < maxRegionFailures {
+		return
+	}
+	log.WithField("addr", s.regionAddr).Info("Redirected Pixie Cloud region is unavailable, falling back to the default cloud address")
+	vzClient, err := NewVZConnClient(s.vzOperator)
+	if err != nil {
+		log.WithError(err).Error("Failed to connect to the default Pixie Cloud address")
+		return
+	}
+	s.vzConnClient = vzClient
+	s.regionAddr = ""
+	s.regionFailures = 0
+}
+
 // StartStream starts the stream between the cloud connector and Vizier connector.
 func (s *Bridge) StartStream() error {
 	var stream vzconnpb.VZConnService_NATSBridgeClient
@@ -704,12 +846,25 @@ func (s *Bridge) StartStream() error {
 	done := make(chan bool)
 	defer close(done)
 
+	// Buffer the messages that are published until the bridge is up, so that they can be replayed once it is.
+	offlineDone := make(chan bool)
+	var offlineWg sync.WaitGroup
+	offlineWg.Add(1)
+	go func() {
+		defer offlineWg.Done()
+		s.collectOffline(offlineDone)
+	}()
+	var stopOffline sync.Once
+	stopCollectingOffline := func() {
+		stopOffline.Do(func() {
+			close(offlineDone)
+			offlineWg.Wait()
+		})
+	}
+	defer stopCollectingOffline()
+
 	// We backoff-retry the registration logic but immediately fail the core-logic.
-	backOffOpts := backoff.NewExponentialBackOff()
-	backOffOpts.InitialInterval = 30 * time.Second
-	backOffOpts.Multiplier = 2
-	backOffOpts.MaxElapsedTime = 30 * time.Minute
-	err := backoff.Retry(func() error {
+	err := retry.Do(context.Background(), vzConnRetryPolicy, func() error {
 		select {
 		case <-s.quitCh:
 			return nil
@@ -724,23 +879,35 @@ func (s *Bridge) StartStream() error {
 		if err != nil {
 			log.WithError(err).Error("Error starting grpc stream")
 			cancel()
+			s.handleRegionFailure()
 			return err
 		}
+		// Sequence numbers from the cloud restart with each stream, and its key is bound to the stream's nonce.
+		verifier := bridgesig.NewC2VVerifier(func(nonce []byte) []byte {
+			return bridgesig.DeriveKey(s.jwtSigningKey, s.vizierID, s.sessionID, nonce)
+		}, viper.GetBool("require_bridge_signatures"))
 		s.wg.Add(1)
-		go s.startStreamGRPCReader(stream, done)
+		go s.startStreamGRPCReader(stream, verifier, done)
 		s.wg.Add(1)
 		go s.startStreamGRPCWriter(stream, done)
 
 		// Need to do registration handshake before we allow any cvmsgs.
-		err = s.doRegistrationHandshake(stream)
+		err = s.doRegistrationHandshake(stream, verifier)
+		if err == ErrRegionRedirect {
+			cancel()
+			s.switchRegion(s.redirectAddr)
+			return err
+		}
 		if err != nil {
 			log.WithError(err).Error("Error doing registration handshake")
 			cancel()
+			s.handleRegionFailure()
 			return err
 		}
+		s.regionFailures = 0
 		log.Trace("Complete Vizier registration")
 		return nil
-	}, backOffOpts)
+	})
 
 	// Defer is placed after backoff because we re-assign the cancel inside the backoff retry.
 	defer cancel()
@@ -757,6 +924,8 @@ func (s *Bridge) StartStream() error {
 	default:
 	}
 
+	stopCollectingOffline()
+	s.conn.connected()
 	s.wg.Add(1)
 	err = s.HandleNATSBridging(stream, done)
 	if err != nil {
@@ -766,7 +935,7 @@ func (s *Bridge) StartStream() error {
 	return nil
 }
 
-func (s *Bridge) startStreamGRPCReader(stream vzconnpb.VZConnService_NATSBridgeClient, done chan bool) {
+func (s *Bridge) startStreamGRPCReader(stream vzconnpb.VZConnService_NATSBridgeClient, verifier *bridgesig.Verifier, done chan bool) {
 	defer s.wg.Done()
 	log.Trace("Starting GRPC reader stream")
 	defer log.Trace("Closing GRPC read stream")
@@ -795,6 +964,10 @@ func (s *Bridge) startStreamGRPCReader(stream vzconnpb.VZConnService_NATSBridgeC
 				log.WithError(err).Trace("Got a stream read error")
 				return
 			}
+			if err := verifier.VerifyC2V(msg); err != nil {
+				log.WithError(err).WithField("topic", msg.Topic).Error("Dropping unauthenticated message from cloud")
+				continue
+			}
 			s.grpcInCh <- msg
 		}
 	}
@@ -808,6 +981,8 @@ func (s *Bridge) startStreamGRPCWriter(stream vzconnpb.VZConnService_NATSBridgeC
 	sendMsg := func(m *vzconnpb.V2CBridgeMessage) {
 		// Pending message try to send it first.
 		if s.pendingGRPCOutMsg != nil {
+			// Re-sign, since the message may have been queued up for a previous stream.
+			s.signer.SignV2C(s.pendingGRPCOutMsg)
 			err := stream.Send(s.pendingGRPCOutMsg)
 			if err != nil {
 				log.WithError(err).Error("Error sending GRPC message")
@@ -818,6 +993,7 @@ func (s *Bridge) startStreamGRPCWriter(stream vzconnpb.VZConnService_NATSBridgeC
 
 		if m != nil {
 			// Write message to GRPC if it exists.
+			s.signer.SignV2C(m)
 			err := stream.Send(m)
 			if err != nil {
 				// Need to resend this message.
@@ -906,8 +1082,26 @@ func (s *Bridge) HandleNATSBridging(stream vzconnpb.VZConnService_NATSBridgeClie
 	log.Info("Starting NATS bridge.")
 	hbChan := s.generateHeartbeats(done)
 
+	s.bridging = true
+	defer func() {
+		s.bridging = false
+	}()
+
 	for {
+		// Replay the messages that were buffered while the cloud was unreachable, without holding up the
+		// messages that keep coming in.
+		var replayCh chan *vzconnpb.V2CBridgeMessage
+		replayMsg := s.offline.peek()
+		if replayMsg != nil {
+			replayCh = s.grpcOutCh
+		}
+
 		select {
+		case replayCh <- replayMsg:
+			s.offline.pop(replayMsg)
+			if s.offline.len() == 0 {
+				log.Info("Finished replaying buffered messages to Pixie Cloud")
+			}
 		case <-s.quitCh:
 			return nil
 		case <-done:
@@ -928,12 +1122,12 @@ func (s *Bridge) HandleNATSBridging(stream vzconnpb.VZConnService_NATSBridgeClie
 
 			if strings.HasPrefix(data.Subject, passthroughReplySubjectPrefix) {
 				// Passthrough message.
-				err = s.publishPTBridgeCh(topic, v2cMsg.Msg)
+				err = s.publishPTBridgeCh(msgbus.ContextFromNATSMsg(data), topic, v2cMsg.Msg)
 				if err != nil {
 					return err
 				}
 			} else {
-				err = s.publishBridgeCh(topic, v2cMsg.Msg)
+				err = s.publishBridgeCh(msgbus.ContextFromNATSMsg(data), topic, v2cMsg.Msg)
 				if err != nil {
 					return err
 				}
@@ -943,6 +1137,17 @@ func (s *Bridge) HandleNATSBridging(stream vzconnpb.VZConnService_NATSBridgeClie
 				return nil
 			}
 
+			if bridgeMsg.Topic == "VizierHeartbeatAck" {
+				ack := &cvmsgspb.VizierHeartbeatAck{}
+				err := types.UnmarshalAny(bridgeMsg.Msg, ack)
+				if err != nil {
+					log.WithError(err).Error("Could not unmarshal heartbeat ack")
+					continue
+				}
+				s.conn.heartbeatAcked(ack.SequenceNumber, time.Now())
+				continue
+			}
+
 			if bridgeMsg.Topic == "VizierUpdate" {
 				err := s.handleUpdateMessage(bridgeMsg.Msg)
 				if err != nil && !k8sErrors.IsAlreadyExists(err) {
@@ -987,7 +1192,8 @@ func (s *Bridge) HandleNATSBridging(stream vzconnpb.VZConnService_NATSBridgeClie
 				return err
 			}
 
-			err = s.nc.Publish(topic, b)
+			ctx := tracing.Extract(context.Background(), bridgeMsg.TraceContext)
+			err = msgbus.PublishWithContext(ctx, s.nc, topic, b)
 			if err != nil {
 				log.WithError(err).Error("Failed to publish")
 				return err
@@ -997,6 +1203,8 @@ func (s *Bridge) HandleNATSBridging(stream vzconnpb.VZConnService_NATSBridgeClie
 			if err != nil {
 				return err
 			}
+			s.conn.heartbeatSent(hbMsg.SequenceNumber, time.Now())
+			atomic.AddInt64(&s.hbBridgedCount, 1)
 
 		case natsMetricsMsg := <-s.natsMetricsCh:
 			metricsMsg := &messagespb.MetricsMessage{}
@@ -1024,6 +1232,54 @@ func (s *Bridge) HandleNATSBridging(stream vzconnpb.VZConnService_NATSBridgeClie
 	}
 }
 
+// collectOffline buffers the heartbeats, metrics and status messages that are published while the bridge is down,
+// until done is closed. Passthrough replies are dropped, since the requests they answer don't outlive the stream.
+func (s *Bridge) collectOffline(done chan bool) {
+	hbChan := s.generateHeartbeats(done)
+	for {
+		select {
+		case <-s.quitCh:
+			return
+		case <-done:
+			return
+		case data := <-s.natsCh:
+			if strings.HasPrefix(data.Subject, passthroughReplySubjectPrefix) {
+				continue
+			}
+			v2cMsg, topic, err := s.parseV2CNatsMsg(data)
+			if err != nil {
+				log.WithError(err).Error("Failed to parse message")
+				continue
+			}
+			err = s.publishBridgeCh(msgbus.ContextFromNATSMsg(data), topic, v2cMsg.Msg)
+			if err != nil {
+				log.WithError(err).Error("Failed to buffer message")
+			}
+		case hbMsg := <-hbChan:
+			err := s.publishProtoToBridgeCh(HeartbeatTopic, hbMsg)
+			if err != nil {
+				log.WithError(err).Error("Failed to buffer heartbeat")
+			}
+		case natsMetricsMsg := <-s.natsMetricsCh:
+			metricsMsg := &messagespb.MetricsMessage{}
+			err := proto.Unmarshal(natsMetricsMsg.Data, metricsMsg)
+			if err != nil {
+				log.WithError(err).Error("failed to unmarshal metrics message")
+				continue
+			}
+			err = s.handleMetricsMessage(metricsMsg)
+			if err != nil {
+				log.WithError(err).Error("failed to buffer metrics message")
+			}
+		case metricsMsg := <-s.metricsCh:
+			err := s.handleMetricsMessage(metricsMsg)
+			if err != nil {
+				log.WithError(err).Error("failed to buffer metrics message")
+			}
+		}
+	}
+}
+
 // Stop terminates the server. Don't reuse this server object after stop has been called.
 func (s *Bridge) Stop() {
 	close(s.quitCh)
@@ -1032,38 +1288,35 @@ func (s *Bridge) Stop() {
 	s.wdWg.Wait()
 }
 
-func (s *Bridge) publishBridgeCh(topic string, msg *types.Any) error {
+func (s *Bridge) publishBridgeCh(ctx context.Context, topic string, msg *types.Any) error {
 	wrappedReq := &vzconnpb.V2CBridgeMessage{
-		Topic:     topic,
-		SessionId: s.sessionID,
-		Msg:       msg,
+		Topic:        topic,
+		SessionId:    s.sessionID,
+		Msg:          msg,
+		TraceContext: tracing.Inject(ctx),
+	}
+
+	// Messages go through the buffer while it is being replayed, so that they reach the cloud in order.
+	if !s.bridging || s.offline.len() > 0 {
+		s.offline.add(wrappedReq)
+		return nil
 	}
 
 	// Don't stall the queue for regular message.
 	select {
 	case s.grpcOutCh <- wrappedReq:
-		if s.droppedMessagesBeforeResume > 0 {
-			log.WithField("Topic", wrappedReq.Topic).
-				WithField("droppedCount", s.droppedMessagesBeforeResume).
-				Info("Resuming messages again...")
-		}
-		s.droppedMessagesBeforeResume = 0
 	default:
-		if (s.droppedMessagesBeforeResume % 100) == 0 {
-			log.WithField("Topic", wrappedReq.Topic).
-				WithField("droppedCount", s.droppedMessagesBeforeResume).
-				Warn("Dropping message because of queue backoff")
-		}
-		s.droppedMessagesBeforeResume++
+		s.offline.add(wrappedReq)
 	}
 	return nil
 }
 
-func (s *Bridge) publishPTBridgeCh(topic string, msg *types.Any) error {
+func (s *Bridge) publishPTBridgeCh(ctx context.Context, topic string, msg *types.Any) error {
 	wrappedReq := &vzconnpb.V2CBridgeMessage{
-		Topic:     topic,
-		SessionId: s.sessionID,
-		Msg:       msg,
+		Topic:        topic,
+		SessionId:    s.sessionID,
+		Msg:          msg,
+		TraceContext: tracing.Inject(ctx),
 	}
 	s.ptOutCh <- wrappedReq
 	return nil
@@ -1075,7 +1328,7 @@ func (s *Bridge) publishProtoToBridgeCh(topic string, msg proto.Message) error {
 		return err
 	}
 
-	return s.publishBridgeCh(topic, anyMsg)
+	return s.publishBridgeCh(context.Background(), topic, anyMsg)
 }
 
 func (s *Bridge) publishBridgeSync(stream vzconnpb.VZConnService_NATSBridgeClient, topic string, msg proto.Message) error {
@@ -1089,6 +1342,7 @@ func (s *Bridge) publishBridgeSync(stream vzconnpb.VZConnService_NATSBridgeClien
 		SessionId: s.sessionID,
 		Msg:       anyMsg,
 	}
+	s.signer.SignV2C(wrappedReq)
 
 	if err := stream.Send(wrappedReq); err != nil {
 		return err
@@ -1147,6 +1401,10 @@ func (s *Bridge) generateHeartbeats(done <-chan bool) chan *cvmsgspb.VizierHeart
 			msg = operatorMessage
 		}
 
+		numSelfTestPassed, failedSelfTests := s.selfTests.summary()
+		numQueries, numFailedQueries := s.queries.take()
+		bridgeRTT, numReconnects := s.conn.take()
+
 		hbMsg := &cvmsgspb.VizierHeartbeat{
 			VizierID:                      utils.ProtoFromUUID(s.vizierID),
 			Time:                          time.Now().UnixNano(),
@@ -1160,6 +1418,13 @@ func (s *Bridge) generateHeartbeats(done <-chan bool) chan *cvmsgspb.VizierHeart
 			StatusMessage:                 msg,
 			DisableAutoUpdate:             viper.GetBool("disable_auto_update"),
 			OperatorVersion:               operatorVersion,
+			NumSelfTestPassedNodes:        numSelfTestPassed,
+			FailedNodeSelfTests:           failedSelfTests,
+			NumQueries:                    numQueries,
+			NumFailedQueries:              numFailedQueries,
+			BridgeRTTNs:                   bridgeRTT.Nanoseconds(),
+			NumBridgeReconnects:           numReconnects,
+			NumDroppedMessages:            s.offline.takeEvicted(),
 		}
 
 		// Only send the control plane pod statuses every 1 min.
@@ -31,6 +31,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
 	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
@@ -40,6 +41,7 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/cloud/vzconn/bridgesig"
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
 	"px.dev/pixie/src/shared/cvmsgspb"
@@ -56,9 +58,15 @@ type FakeVZConnServer struct {
 	msgQ   []*vzconnpb.V2CBridgeMessage
 	wg     *sync.WaitGroup
 	t      *testing.T
+
+	// jwtKey, if set, is the key that the stream must be signed with, as Pixie Cloud does.
+	jwtKey   string
+	nonce    []byte
+	signer   *bridgesig.Signer
+	verifier *bridgesig.Verifier
 }
 
-func marshalAndSend(srv vzconnpb.VZConnService_NATSBridgeServer, topic string, msg proto.Message) error {
+func (fs *FakeVZConnServer) marshalAndSend(srv vzconnpb.VZConnService_NATSBridgeServer, topic string, msg proto.Message) error {
 	var respAsAny *types.Any
 	var err error
 	if respAsAny, err = types.MarshalAny(msg); err != nil {
@@ -68,12 +76,46 @@ func marshalAndSend(srv vzconnpb.VZConnService_NATSBridgeServer, topic string, m
 		Topic: topic,
 		Msg:   respAsAny,
 	}
+	if fs.signer != nil {
+		if topic == "registerAck" {
+			outMsg.Nonce = fs.nonce
+		}
+		fs.signer.SignC2V(outMsg)
+	}
 	return srv.Send(outMsg)
 }
 
-func handleMsg(srv vzconnpb.VZConnService_NATSBridgeServer, msg *vzconnpb.V2CBridgeMessage) error {
+// verify checks the signature of a message from the vizier, and sets up the keys of the stream on registration.
+func (fs *FakeVZConnServer) verify(msg *vzconnpb.V2CBridgeMessage) error {
+	if fs.jwtKey == "" {
+		return nil
+	}
+	if msg.Topic != "register" {
+		return fs.verifier.VerifyV2C(msg)
+	}
+	regMsg := &cvmsgspb.RegisterVizierRequest{}
+	if err := types.UnmarshalAny(msg.Msg, regMsg); err != nil {
+		return err
+	}
+	vizierID := utils.UUIDFromProtoOrNil(regMsg.VizierID)
+	regKey := bridgesig.DeriveKey(fs.jwtKey, vizierID, msg.SessionId, nil)
+	if err := bridgesig.NewV2CVerifier(regKey, msg.SessionId, true).VerifyV2C(msg); err != nil {
+		return err
+	}
+	nonce, err := bridgesig.NewNonce()
+	if err != nil {
+		return err
+	}
+	key := bridgesig.DeriveKey(fs.jwtKey, vizierID, msg.SessionId, nonce)
+	fs.nonce = nonce
+	fs.signer = bridgesig.NewSigner(key)
+	fs.verifier = bridgesig.NewV2CVerifier(key, msg.SessionId, true)
+	return nil
+}
+
+func (fs *FakeVZConnServer) handleMsg(srv vzconnpb.VZConnService_NATSBridgeServer, msg *vzconnpb.V2CBridgeMessage) error {
 	if msg.Topic == "register" {
-		return marshalAndSend(srv, "registerAck", &cvmsgspb.RegisterVizierAck{Status: cvmsgspb.ST_OK})
+		return fs.marshalAndSend(srv, "registerAck", &cvmsgspb.RegisterVizierAck{Status: cvmsgspb.ST_OK})
 	}
 	if msg.Topic == "randomtopic" {
 		return nil
@@ -84,7 +126,7 @@ func handleMsg(srv vzconnpb.VZConnService_NATSBridgeServer, msg *vzconnpb.V2CBri
 		if err != nil {
 			return err
 		}
-		return marshalAndSend(srv, "randomtopicNeedsResponseAck", unmarshal)
+		return fs.marshalAndSend(srv, "randomtopicNeedsResponseAck", unmarshal)
 	}
 
 	return fmt.Errorf("Got unknown topic %s", msg.Topic)
@@ -119,8 +161,12 @@ func (fs *FakeVZConnServer) NATSBridge(srv vzconnpb.VZConnService_NATSBridgeServ
 			}
 			// Ignore heartbeats
 			if msg.Topic != bridge.HeartbeatTopic {
+				if err := fs.verify(msg); err != nil {
+					fs.t.Errorf("Error verifying: %+v", err)
+					return err
+				}
 				fs.msgQ = append(fs.msgQ, msg)
-				err = handleMsg(srv, msg)
+				err = fs.handleMsg(srv, msg)
 				if err != nil {
 					fs.t.Errorf("Error marshalling: %+v", err)
 					return err
@@ -465,6 +511,53 @@ func TestNATSGRPCBridgeTest_TestInboundNATSMessage(t *testing.T) {
 	assert.Equal(t, expectedNats, actualNats)
 }
 
+// Test that messages in both directions are signed with the key for the nonce that the cloud picked.
+func TestNATSGRPCBridgeTest_SignedStream(t *testing.T) {
+	viper.Set("require_bridge_signatures", true)
+	defer viper.Set("require_bridge_signatures", false)
+
+	ts, cleanup := makeTestState(t)
+	defer cleanup(t)
+	ts.vzServer.jwtKey = ts.jwt
+
+	// wait for registration
+	ts.wg.Add(1)
+
+	sessionID := time.Now().UnixNano()
+	b := bridge.New(ts.vzID, "", ts.jwt, "", sessionID, ts.vzClient, &FakeVZInfo{}, &FakeVZOperatorInfo{}, ts.nats, &FakeVZChecker{}, nil)
+	defer b.Stop()
+
+	go b.RunStream()
+	ts.wg.Wait()
+	require.NotEmpty(t, ts.vzServer.msgQ[0].Signature)
+
+	natsCh := make(chan *nats.Msg, 1)
+	natsSub, err := ts.nats.ChanSubscribe("c2v.*", natsCh)
+	require.NoError(t, err)
+	defer natsSub.Unsubscribe()
+
+	// The message is verified by the cloud, and the response by the vizier before it shows up in the NATS queue.
+	ts.wg.Add(1)
+	subany, err := types.MarshalAny(&cvmsgspb.VLogMessage{Data: []byte("Foobar")})
+	require.NoError(t, err)
+	v2cMsg := &cvmsgspb.V2CMessage{
+		VizierID:  ts.vzID.String(),
+		SessionId: sessionID,
+		Msg:       subany,
+	}
+	serializedBytes, err := v2cMsg.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, ts.nats.Publish("v2c.randomtopicNeedsResponse", serializedBytes))
+	ts.wg.Wait()
+
+	select {
+	case inboundNats := <-natsCh:
+		assert.Equal(t, "c2v.randomtopicNeedsResponseAck", inboundNats.Subject)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the signed response")
+	}
+}
+
 func TestNATSGRPCBridgeTest_TestRegisterDeployment(t *testing.T) {
 	ts, cleanup := makeTestState(t)
 	defer cleanup(t)
@@ -492,5 +585,6 @@ func TestNATSGRPCBridgeTest_TestRegisterDeployment(t *testing.T) {
 		require.NoError(t, err)
 		ts.wg.Done()
 		assert.Equal(t, "fakeName", vzInfo.lastClusterName)
+		assert.Equal(t, "fakeName", b.GetHandoffState().VizierName)
 	}()
 }
@@ -54,8 +54,6 @@ func getCloudAddrFromCRD(vzOperator VizierOperatorInfo) (string, error) {
 
 // NewVZConnClient creates a new vzconn RPC client stub.
 func NewVZConnClient(vzOperator VizierOperatorInfo) (vzconnpb.VZConnServiceClient, error) {
-	ctxBg := context.Background()
-
 	// Get the cloud address - first try the CRD, if it exists.
 	// If that fails, pull it from the environment for Viziers that are not
 	// running the operator yet.
@@ -63,6 +61,12 @@ func NewVZConnClient(vzOperator VizierOperatorInfo) (vzconnpb.VZConnServiceClien
 	if err != nil {
 		cloudAddr = viper.GetString("cloud_addr")
 	}
+	return newVZConnClientForAddr(cloudAddr)
+}
+
+// newVZConnClientForAddr creates a new vzconn RPC client stub for the VZConn at the given address.
+func newVZConnClientForAddr(cloudAddr string) (vzconnpb.VZConnServiceClient, error) {
+	ctxBg := context.Background()
 
 	isInternal := strings.Contains(cloudAddr, ".svc.cluster.local")
 
@@ -157,9 +157,28 @@ func (v *K8sVizierInfo) GetVizierClusterInfo() (*cvmsgspb.VizierClusterInfo, err
 		ClusterUID:    clusterUID,
 		ClusterName:   v.clusterName,
 		VizierVersion: version.GetVersion().ToString(),
+		Region:        v.getClusterRegion(),
 	}, nil
 }
 
+// getClusterRegion gets the cloud region that the cluster runs in, from the well-known labels of its nodes.
+// Returns an empty string if the region is unknown, such as for clusters that don't run in a cloud.
+func (v *K8sVizierInfo) getClusterRegion() string {
+	nodes, err := v.clientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{Limit: 1})
+	if err != nil {
+		log.WithError(err).Error("Failed to list nodes to get the cluster region")
+		return ""
+	}
+	if len(nodes.Items) == 0 {
+		return ""
+	}
+	labels := nodes.Items[0].Labels
+	if region, ok := labels[corev1.LabelTopologyRegion]; ok {
+		return region
+	}
+	return labels[corev1.LabelFailureDomainBetaRegion]
+}
+
 // GetClusterUID gets UID for the cluster, represented by the kube-system namespace UID.
 func (v *K8sVizierInfo) GetClusterUID() (string, error) {
 	ksNS, err := v.clientset.CoreV1().Namespaces().Get(context.Background(), "kube-system", metav1.GetOptions{})
@@ -20,19 +20,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/election"
 	"px.dev/pixie/src/shared/services/env"
@@ -48,7 +56,6 @@ import (
 
 func init() {
 	pflag.String("cluster_id", "", "The Cluster ID to use for Pixie Cloud")
-	pflag.String("nats_url", "pl-nats", "The URL of NATS")
 	pflag.Duration("max_expected_clock_skew", 2000, "Duration in ms of expected maximum clock skew in a cluster")
 	pflag.Duration("renew_period", 5000, "Duration in ms of the time to wait to renew lease")
 	pflag.String("pod_namespace", "pl", "The namespace this pod runs in.")
@@ -58,6 +65,7 @@ func init() {
 	pflag.String("vizier_name", "", "The name of the user's K8s cluster, assigned by Pixie cloud")
 	pflag.String("deploy_key", "", "The deploy key for the cluster")
 	pflag.Bool("disable_auto_update", false, "Whether auto-update should be disabled")
+	pflag.Bool("require_bridge_signatures", true, "Drop messages from Pixie Cloud that are not signed")
 	pflag.Duration("metrics_scrape_period", 15*time.Minute, "Period that the metrics scraper should run at.")
 }
 func newVzServiceClient() (vizierpb.VizierServiceClient, error) {
@@ -76,9 +84,94 @@ func newVzServiceClient() (vizierpb.VizierServiceClient, error) {
 	return vizierpb.NewVizierServiceClient(qbChannel), nil
 }
 
+// bridgeSingleton runs the bridge to Pixie Cloud on the cloud connector that is the leader. The other cloud
+// connectors stay connected to Pixie Cloud and NATS as warm standbys.
+type bridgeSingleton struct {
+	vizierID   uuid.UUID
+	vizierName string
+	deployKey  string
+	vzClient   vzconnpb.VZConnServiceClient
+	nc         *nats.Conn
+	vzInfo     *controllers.K8sVizierInfo
+	checker    *vizhealth.Checker
+
+	mu      sync.RWMutex
+	bridge  *controllers.Bridge
+	scraper vzmetrics.Scraper
+}
+
+func (b *bridgeSingleton) Promote(ctx context.Context, state []byte) error {
+	vizierID, vizierName := b.vizierID, b.vizierName
+	if len(state) > 0 && vizierID == uuid.Nil {
+		// The previous leader may have registered the deployment after this cloud connector started.
+		var handoff controllers.HandoffState
+		if err := json.Unmarshal(state, &handoff); err != nil {
+			return err
+		}
+		vizierID = uuid.FromStringOrNil(handoff.VizierID)
+		vizierName = handoff.VizierName
+	}
+
+	scraper := vzmetrics.NewScraper(viper.GetString("pod_namespace"), viper.GetDuration("metrics_scrape_period"))
+	go scraper.Run()
+
+	// We just use the current time in nanoseconds to mark the session ID. This will let the cloud side know that
+	// the cloud connector restarted. Clock skew might make this incorrect, but we mostly want this for debugging.
+	sessionID := time.Now().UnixNano()
+	svr := controllers.New(vizierID, vizierName, viper.GetString("jwt_signing_key"), b.deployKey, sessionID, b.vzClient, b.vzInfo, b.vzInfo, b.nc, b.checker, scraper.MetricsChannel())
+	go svr.RunStream()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bridge = svr
+	b.scraper = scraper
+	return nil
+}
+
+func (b *bridgeSingleton) Demote() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bridge.Stop()
+	b.scraper.Stop()
+	b.bridge = nil
+	b.scraper = nil
+}
+
+func (b *bridgeSingleton) Checkpoint() ([]byte, error) {
+	svr := b.getBridge()
+	if svr == nil {
+		return nil, nil
+	}
+	return json.Marshal(svr.GetHandoffState())
+}
+
+func (b *bridgeSingleton) getBridge() *controllers.Bridge {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.bridge
+}
+
+// DebugLog forwards the request to the bridge, if this cloud connector is the leader.
+func (b *bridgeSingleton) DebugLog(req *vizierpb.DebugLogRequest, srv vizierpb.VizierDebugService_DebugLogServer) error {
+	svr := b.getBridge()
+	if svr == nil {
+		return grpcstatus.Error(codes.Unavailable, "cloud connector is a standby")
+	}
+	return svr.DebugLog(req, srv)
+}
+
+// DebugPods forwards the request to the bridge, if this cloud connector is the leader.
+func (b *bridgeSingleton) DebugPods(req *vizierpb.DebugPodsRequest, srv vizierpb.VizierDebugService_DebugPodsServer) error {
+	svr := b.getBridge()
+	if svr == nil {
+		return grpcstatus.Error(codes.Unavailable, "cloud connector is a standby")
+	}
+	return svr.DebugPods(req, srv)
+}
+
 // Checks to see if the cloud connector has successfully assigned a cluster ID.
 type readinessCheck struct {
-	bridge *controllers.Bridge
+	bridge *bridgeSingleton
 }
 
 func (r *readinessCheck) Name() string {
@@ -86,7 +179,12 @@ func (r *readinessCheck) Name() string {
 }
 
 func (r *readinessCheck) Check() error {
-	s := r.bridge.GetStatus()
+	svr := r.bridge.getBridge()
+	if svr == nil {
+		// Standbys are ready to take over.
+		return nil
+	}
+	s := svr.GetStatus()
 	if s == "" {
 		return nil
 	}
@@ -126,30 +224,6 @@ func main() {
 		}
 	}
 
-	leaderMgr, err := election.NewK8sLeaderElectionMgr(
-		viper.GetString("pod_namespace"),
-		viper.GetDuration("max_expected_clock_skew"),
-		viper.GetDuration("renew_period"),
-		"cloud-conn-election",
-	)
-
-	if err != nil {
-		log.WithError(err).Fatal("Failed to connect to leader election manager.")
-	}
-	// Cancel callback causes leader to resign.
-	leaderCtx, cancel := context.WithCancel(context.Background())
-	err = leaderMgr.Campaign(leaderCtx)
-	if err != nil {
-		log.WithError(err).Fatal("Failed to become leader")
-	}
-
-	resign := func() {
-		log.Info("Resigning leadership")
-		cancel()
-	}
-	// Resign leadership after the server stops.
-	defer resign()
-
 	qbVzClient, err := newVzServiceClient()
 	if err != nil {
 		log.WithError(err).Fatal("Failed to init qb stub")
@@ -162,24 +236,61 @@ func main() {
 	go vzInfo.CleanupCronJob("etcd-defrag-job", 2*time.Hour, quitCh)
 	defer close(quitCh)
 
-	scraper := vzmetrics.NewScraper(viper.GetString("pod_namespace"), viper.GetDuration("metrics_scrape_period"))
-	go scraper.Run()
-	defer scraper.Stop()
+	// Connect to Pixie Cloud and NATS before campaigning, so that this replica can take over the bridge as soon
+	// as it is elected.
+	bridge := &bridgeSingleton{
+		vizierID:   vizierID,
+		vizierName: assignedClusterName,
+		deployKey:  deployKey,
+		vzClient:   controllers.ConnectVZConn(vzInfo),
+		nc:         controllers.ConnectNATS(),
+		vzInfo:     vzInfo,
+		checker:    checker,
+	}
 
-	// We just use the current time in nanoseconds to mark the session ID. This will let the cloud side know that
-	// the cloud connector restarted. Clock skew might make this incorrect, but we mostly want this for debugging.
-	sessionID := time.Now().UnixNano()
-	svr := controllers.New(vizierID, assignedClusterName, viper.GetString("jwt_signing_key"), deployKey, sessionID, nil, vzInfo, vzInfo, nil, checker, scraper.MetricsChannel())
-	go svr.RunStream()
-	defer svr.Stop()
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Fatal("Unable to get incluster kubeconfig")
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to create K8s client")
+	}
+	// The flags are durations in ms.
+	renewPeriod := viper.GetDuration("renew_period") * time.Millisecond
+	standby, err := election.NewWarmStandby(clientset, viper.GetString("pod_namespace"), "cloud-conn-election", bridge,
+		election.WithLeaseDurations(viper.GetDuration("max_expected_clock_skew")*time.Millisecond+renewPeriod, renewPeriod, renewPeriod/4))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to set up leader election")
+	}
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	standbyDone := make(chan struct{})
+	go func() {
+		defer close(standbyDone)
+		err := standby.Run(leaderCtx)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to run leader election")
+		}
+	}()
+	// Stop the bridge and resign leadership after the server stops, so that a standby takes over right away.
+	defer func() {
+		log.Info("Resigning leadership")
+		cancel()
+		<-standbyDone
+	}()
 
 	mux := http.NewServeMux()
 	// Set up healthz endpoint.
 	healthz.RegisterDefaultChecks(mux)
 	// Set up readyz endpoint.
-	healthz.InstallPathHandler(mux, "/readyz", &readinessCheck{svr})
+	healthz.InstallPathHandler(mux, "/readyz", &readinessCheck{bridge})
 
 	statusz.InstallPathHandler(mux, "/statusz", func() string {
+		// Standbys don't run the bridge, so they are healthy as long as they are running.
+		svr := bridge.getBridge()
+		if svr == nil {
+			return ""
+		}
 		// Check state of the bridge.
 		bridgeStatus := svr.GetStatus()
 		if bridgeStatus != "" {
@@ -200,7 +311,7 @@ func main() {
 	s := server.NewPLServer(e,
 		httpmiddleware.WithBearerAuthMiddleware(e, mux))
 
-	vizierpb.RegisterVizierDebugServiceServer(s.GRPCServer(), svr)
+	vizierpb.RegisterVizierDebugServiceServer(s.GRPCServer(), bridge)
 
 	s.Start()
 	s.StopOnInterrupt()
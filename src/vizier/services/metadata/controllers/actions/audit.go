@@ -0,0 +1,77 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/vizier/utils/datastore"
+)
+
+const actionAuditPrefix = "/actionAudit/"
+
+// auditRecordTTL is how long records are kept in the audit log.
+const auditRecordTTL = 7 * 24 * time.Hour
+
+// Datastore implements the AuditStore interface on a given Datastore.
+type Datastore struct {
+	ds datastore.MultiGetterSetterDeleterCloser
+}
+
+// NewDatastore wraps the datastore in an action audit store.
+func NewDatastore(ds datastore.MultiGetterSetterDeleterCloser) *Datastore {
+	return &Datastore{ds: ds}
+}
+
+// Audit records are keyed by timestamp first so that a prefix scan returns them in order.
+func getAuditRecordKey(r *AuditRecord) string {
+	return path.Join(actionAuditPrefix, fmt.Sprintf("%020d_%s", r.Timestamp.UnixNano(), r.ID))
+}
+
+// RecordAction saves the record in the audit log, from which it expires after auditRecordTTL.
+func (d *Datastore) RecordAction(r *AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return d.ds.SetWithTTL(getAuditRecordKey(r), string(b), auditRecordTTL)
+}
+
+// GetActions returns all records in the audit log, oldest first.
+func (d *Datastore) GetActions() ([]*AuditRecord, error) {
+	_, vals, err := d.ds.GetWithPrefix(actionAuditPrefix)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*AuditRecord, 0, len(vals))
+	for _, val := range vals {
+		r := &AuditRecord{}
+		if err := json.Unmarshal(val, r); err != nil {
+			log.WithError(err).Error("Failed to unmarshal action audit record")
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
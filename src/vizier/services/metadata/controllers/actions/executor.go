@@ -0,0 +1,187 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Request is a request from a script to perform an action on a Kubernetes resource.
+type Request struct {
+	// ScriptID is the ID of the script whose alert triggered the action.
+	ScriptID string `json:"scriptID"`
+	Type     Type   `json:"type"`
+	// Kind is the kind of resource to annotate. Only "Pod" and "Deployment" are supported.
+	Kind        string            `json:"kind,omitempty"`
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Replicas    int32             `json:"replicas,omitempty"`
+	// Reason is a human readable description of why the action was triggered.
+	Reason string `json:"reason,omitempty"`
+	// DryRun requests that the action is only validated by the API server.
+	DryRun bool `json:"dryRun,omitempty"`
+	// IssuedAt is when the request was signed.
+	IssuedAt time.Time `json:"issuedAt"`
+}
+
+// Result is the outcome of an action request.
+type Result struct {
+	ID       string `json:"id"`
+	Executed bool   `json:"executed"`
+	DryRun   bool   `json:"dryRun"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ErrRateLimited is returned when too many actions have been executed recently.
+var ErrRateLimited = errors.New("action rate limit exceeded")
+
+// AuditStore records every action that is attempted, whether or not it was executed.
+type AuditStore interface {
+	RecordAction(*AuditRecord) error
+}
+
+// AuditRecord is a single entry in the action audit log.
+type AuditRecord struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Request   *Request  `json:"request"`
+	Executed  bool      `json:"executed"`
+	DryRun    bool      `json:"dryRun"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Executor performs policy-guarded Kubernetes actions on behalf of scripts.
+type Executor struct {
+	clientset kubernetes.Interface
+	policy    *Policy
+	audit     AuditStore
+	limiter   *rateLimiter
+	nowFn     func() time.Time
+}
+
+// NewExecutor creates a new action executor.
+func NewExecutor(clientset kubernetes.Interface, policy *Policy, audit AuditStore) *Executor {
+	return &Executor{
+		clientset: clientset,
+		policy:    policy,
+		audit:     audit,
+		limiter:   &rateLimiter{limit: policy.MaxActionsPerMinute},
+		nowFn:     time.Now,
+	}
+}
+
+// Execute checks the request against the policy and performs the action. Every request is
+// recorded in the audit log, including the ones that are denied.
+func (e *Executor) Execute(ctx context.Context, req *Request) *Result {
+	dryRun := req.DryRun || e.policy.DryRun
+	now := e.nowFn()
+	res := &Result{
+		ID:     uuid.Must(uuid.NewV4()).String(),
+		DryRun: dryRun,
+	}
+
+	err := e.policy.Check(req)
+	if err == nil && !e.limiter.allow(now) {
+		err = ErrRateLimited
+	}
+	if err == nil {
+		err = e.perform(ctx, req, dryRun)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Executed = true
+	}
+
+	record := &AuditRecord{
+		ID:        res.ID,
+		Timestamp: now,
+		Request:   req,
+		Executed:  res.Executed,
+		DryRun:    dryRun,
+		Error:     res.Error,
+	}
+	if auditErr := e.audit.RecordAction(record); auditErr != nil {
+		log.WithError(auditErr).WithField("actionID", res.ID).Error("Failed to record action in audit log")
+	}
+
+	log.WithFields(log.Fields{
+		"actionID":  res.ID,
+		"type":      req.Type,
+		"namespace": req.Namespace,
+		"name":      req.Name,
+		"scriptID":  req.ScriptID,
+		"dryRun":    dryRun,
+		"executed":  res.Executed,
+	}).Info("Handled action request")
+	return res
+}
+
+func (e *Executor) perform(ctx context.Context, req *Request, dryRun bool) error {
+	var dryRunOpt []string
+	if dryRun {
+		dryRunOpt = []string{metav1.DryRunAll}
+	}
+
+	switch req.Type {
+	case DeletePod:
+		return e.clientset.CoreV1().Pods(req.Namespace).Delete(ctx, req.Name, metav1.DeleteOptions{DryRun: dryRunOpt})
+	case ScaleDeployment:
+		scale := &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Name: req.Name, Namespace: req.Namespace},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: req.Replicas},
+		}
+		_, err := e.clientset.AppsV1().Deployments(req.Namespace).UpdateScale(ctx, req.Name, scale, metav1.UpdateOptions{DryRun: dryRunOpt})
+		return err
+	case AnnotateResource:
+		if len(req.Annotations) == 0 {
+			return errors.New("annotate action requires at least one annotation")
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"annotations": req.Annotations},
+		})
+		if err != nil {
+			return err
+		}
+		opts := metav1.PatchOptions{DryRun: dryRunOpt}
+		switch req.Kind {
+		case "Pod":
+			_, err = e.clientset.CoreV1().Pods(req.Namespace).Patch(ctx, req.Name, types.MergePatchType, patch, opts)
+		case "Deployment":
+			_, err = e.clientset.AppsV1().Deployments(req.Namespace).Patch(ctx, req.Name, types.MergePatchType, patch, opts)
+		default:
+			err = fmt.Errorf("cannot annotate resources of kind %q", req.Kind)
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown action type %s", req.Type)
+	}
+}
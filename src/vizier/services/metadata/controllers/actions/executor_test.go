@@ -0,0 +1,180 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+func setupExecutor(t *testing.T, policy *Policy) (*Executor, *fake.Clientset, *Datastore) {
+	memFS := vfs.NewMem()
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: memFS,
+	})
+	require.NoError(t, err)
+	db := pebbledb.New(c, 3*time.Second)
+	t.Cleanup(func() { db.Close() })
+
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend-abc", Namespace: "default"},
+	})
+	audit := NewDatastore(db)
+	return NewExecutor(clientset, policy, audit), clientset, audit
+}
+
+func testPolicy() *Policy {
+	return &Policy{
+		AllowedActions:      []Type{DeletePod, AnnotateResource},
+		AllowedScripts:      []string{"approved-script"},
+		DeniedNamespaces:    []string{"kube-system"},
+		MaxActionsPerMinute: 2,
+	}
+}
+
+func TestExecutor_DeletePod(t *testing.T) {
+	e, clientset, audit := setupExecutor(t, testPolicy())
+
+	res := e.Execute(context.Background(), &Request{
+		ScriptID:  "approved-script",
+		Type:      DeletePod,
+		Namespace: "default",
+		Name:      "frontend-abc",
+	})
+	assert.True(t, res.Executed)
+	assert.Empty(t, res.Error)
+
+	_, err := clientset.CoreV1().Pods("default").Get(context.Background(), "frontend-abc", metav1.GetOptions{})
+	assert.Error(t, err)
+
+	records, err := audit.GetActions()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, res.ID, records[0].ID)
+	assert.True(t, records[0].Executed)
+}
+
+func TestExecutor_Annotate(t *testing.T) {
+	e, clientset, _ := setupExecutor(t, testPolicy())
+
+	res := e.Execute(context.Background(), &Request{
+		ScriptID:    "approved-script",
+		Type:        AnnotateResource,
+		Kind:        "Pod",
+		Namespace:   "default",
+		Name:        "frontend-abc",
+		Annotations: map[string]string{"px.dev/alert": "high-latency"},
+	})
+	require.Empty(t, res.Error)
+
+	pod, err := clientset.CoreV1().Pods("default").Get(context.Background(), "frontend-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "high-latency", pod.Annotations["px.dev/alert"])
+}
+
+func TestExecutor_Denied(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *Request
+	}{
+		{
+			name: "unapproved script",
+			req:  &Request{ScriptID: "other", Type: DeletePod, Namespace: "default", Name: "frontend-abc"},
+		},
+		{
+			name: "disallowed action",
+			req:  &Request{ScriptID: "approved-script", Type: ScaleDeployment, Namespace: "default", Name: "frontend", Replicas: 3},
+		},
+		{
+			name: "denied namespace",
+			req:  &Request{ScriptID: "approved-script", Type: DeletePod, Namespace: "kube-system", Name: "coredns"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, clientset, audit := setupExecutor(t, testPolicy())
+			res := e.Execute(context.Background(), test.req)
+			assert.False(t, res.Executed)
+			assert.NotEmpty(t, res.Error)
+			// Denied requests must never reach the API server.
+			for _, a := range clientset.Actions() {
+				assert.Equal(t, "get", a.GetVerb())
+			}
+
+			records, err := audit.GetActions()
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			assert.False(t, records[0].Executed)
+		})
+	}
+}
+
+func TestExecutor_RateLimit(t *testing.T) {
+	e, _, _ := setupExecutor(t, testPolicy())
+	now := time.Unix(1000, 0)
+	e.nowFn = func() time.Time { return now }
+
+	req := &Request{
+		ScriptID:    "approved-script",
+		Type:        AnnotateResource,
+		Kind:        "Pod",
+		Namespace:   "default",
+		Name:        "frontend-abc",
+		Annotations: map[string]string{"a": "b"},
+	}
+	assert.True(t, e.Execute(context.Background(), req).Executed)
+	assert.True(t, e.Execute(context.Background(), req).Executed)
+	res := e.Execute(context.Background(), req)
+	assert.False(t, res.Executed)
+	assert.Equal(t, ErrRateLimited.Error(), res.Error)
+
+	now = now.Add(time.Minute + time.Second)
+	assert.True(t, e.Execute(context.Background(), req).Executed)
+}
+
+func TestExecutor_PolicyDryRun(t *testing.T) {
+	policy := testPolicy()
+	policy.DryRun = true
+	e, _, audit := setupExecutor(t, policy)
+
+	res := e.Execute(context.Background(), &Request{
+		ScriptID:  "approved-script",
+		Type:      DeletePod,
+		Namespace: "default",
+		Name:      "frontend-abc",
+	})
+	assert.True(t, res.DryRun)
+
+	records, err := audit.GetActions()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.True(t, records[0].DryRun)
+}
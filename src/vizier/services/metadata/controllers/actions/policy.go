@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Type is the kind of Kubernetes action that a script may trigger.
+type Type string
+
+const (
+	// DeletePod deletes a single pod, which is then recreated by its controller.
+	DeletePod Type = "DeletePod"
+	// AnnotateResource adds or updates annotations on a pod or deployment.
+	AnnotateResource Type = "Annotate"
+	// ScaleDeployment changes the replica count of a deployment.
+	ScaleDeployment Type = "ScaleDeployment"
+)
+
+// Policy describes which actions are permitted. Anything not explicitly allowed is denied.
+type Policy struct {
+	// AllowedActions is the set of action types that may be executed.
+	AllowedActions []Type `json:"allowedActions"`
+	// AllowedScripts are the IDs of the scripts which have been approved to trigger actions.
+	AllowedScripts []string `json:"allowedScripts"`
+	// AllowedNamespaces restricts actions to the given namespaces. Empty means all namespaces,
+	// except those in DeniedNamespaces.
+	AllowedNamespaces []string `json:"allowedNamespaces"`
+	// DeniedNamespaces are never acted on, even if they appear in AllowedNamespaces.
+	DeniedNamespaces []string `json:"deniedNamespaces"`
+	// MinReplicas and MaxReplicas bound the replica count for scale actions.
+	MinReplicas int32 `json:"minReplicas"`
+	MaxReplicas int32 `json:"maxReplicas"`
+	// MaxActionsPerMinute limits how many actions may be executed per minute, across all scripts.
+	MaxActionsPerMinute int `json:"maxActionsPerMinute"`
+	// DryRun forces every action to be executed with server-side dry-run.
+	DryRun bool `json:"dryRun"`
+}
+
+// DefaultPolicy is a policy that denies all actions.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		DeniedNamespaces:    []string{"kube-system", "pl", "olm", "px-operator"},
+		MaxActionsPerMinute: 10,
+		DryRun:              true,
+	}
+}
+
+// LoadPolicy reads a YAML or JSON policy from the given file.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := DefaultPolicy()
+	if err := yaml.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("failed to parse action policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error describing why the request is not permitted by the policy, or nil if it is.
+func (p *Policy) Check(req *Request) error {
+	if !contains(p.AllowedActions, req.Type) {
+		return fmt.Errorf("action %s is not allowed", req.Type)
+	}
+	if !contains(p.AllowedScripts, req.ScriptID) {
+		return fmt.Errorf("script %s is not approved to trigger actions", req.ScriptID)
+	}
+	if contains(p.DeniedNamespaces, req.Namespace) {
+		return fmt.Errorf("namespace %s is denied", req.Namespace)
+	}
+	if len(p.AllowedNamespaces) > 0 && !contains(p.AllowedNamespaces, req.Namespace) {
+		return fmt.Errorf("namespace %s is not allowed", req.Namespace)
+	}
+	if req.Type == ScaleDeployment {
+		if req.Replicas < p.MinReplicas || (p.MaxReplicas > 0 && req.Replicas > p.MaxReplicas) {
+			return fmt.Errorf("replica count %d is outside of the allowed range [%d, %d]", req.Replicas, p.MinReplicas, p.MaxReplicas)
+		}
+	}
+	return nil
+}
+
+// rateLimiter is a simple sliding window limiter over the last minute.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	history []time.Time
+}
+
+func (r *rateLimiter) allow(now time.Time) bool {
+	if r.limit <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(r.history) && r.history[i].Before(cutoff) {
+		i++
+	}
+	r.history = r.history[i:]
+	if len(r.history) >= r.limit {
+		return false
+	}
+	r.history = append(r.history, now)
+	return true
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// MaxRequestAge is how long after it was signed an action request is still accepted.
+const MaxRequestAge = time.Minute
+
+// SignedRequest is the message published on RequestTopic. Only the script runner, which
+// shares the signing key with the metadata service, can produce a valid signature, so
+// the script ID in the request can be trusted.
+type SignedRequest struct {
+	// Request is the JSON encoded Request, kept as raw bytes so that the signature is
+	// computed over exactly what was sent.
+	Request   json.RawMessage `json:"request"`
+	Signature []byte          `json:"signature"`
+}
+
+func requestSignature(req []byte, signingKey string) []byte {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	// Bind the signature to the topic, so that it can't be replayed as another kind of message.
+	mac.Write([]byte(RequestTopic + "\n"))
+	mac.Write(req)
+	return mac.Sum(nil)
+}
+
+// SignRequest stamps the request with the current time and encodes it as a SignedRequest.
+func SignRequest(req *Request, signingKey string, now time.Time) ([]byte, error) {
+	req.IssuedAt = now
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&SignedRequest{
+		Request:   b,
+		Signature: requestSignature(b, signingKey),
+	})
+}
+
+// VerifyRequest decodes a SignedRequest, and returns the request if its signature is valid
+// and it was signed recently.
+func VerifyRequest(data []byte, signingKey string, now time.Time) (*Request, error) {
+	signed := &SignedRequest{}
+	if err := json.Unmarshal(data, signed); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(signed.Signature, requestSignature(signed.Request, signingKey)) {
+		return nil, errors.New("invalid action request signature")
+	}
+	req := &Request{}
+	if err := json.Unmarshal(signed.Request, req); err != nil {
+		return nil, err
+	}
+	if now.Sub(req.IssuedAt) > MaxRequestAge || req.IssuedAt.Sub(now) > MaxRequestAge {
+		return nil, errors.New("action request has expired")
+	}
+	return req, nil
+}
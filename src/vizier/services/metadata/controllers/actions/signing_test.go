@@ -0,0 +1,72 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signed, err := SignRequest(&Request{
+		ScriptID:  "approved-script",
+		Type:      DeletePod,
+		Namespace: "default",
+		Name:      "frontend-abc",
+	}, "key", now)
+	require.NoError(t, err)
+
+	req, err := VerifyRequest(signed, "key", now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, "approved-script", req.ScriptID)
+	assert.Equal(t, "frontend-abc", req.Name)
+
+	_, err = VerifyRequest(signed, "other-key", now)
+	assert.Error(t, err)
+
+	_, err = VerifyRequest(signed, "key", now.Add(MaxRequestAge+time.Second))
+	assert.Error(t, err)
+
+	// Changing the script ID invalidates the signature.
+	msg := &SignedRequest{}
+	require.NoError(t, json.Unmarshal(signed, msg))
+	msg.Request, err = json.Marshal(&Request{
+		ScriptID:  "other-script",
+		Type:      DeletePod,
+		Namespace: "default",
+		Name:      "frontend-abc",
+		IssuedAt:  now,
+	})
+	require.NoError(t, err)
+	tampered, err := json.Marshal(msg)
+	require.NoError(t, err)
+	_, err = VerifyRequest(tampered, "key", now)
+	assert.Error(t, err)
+
+	// So does leaving it out.
+	unsigned, err := json.Marshal(&Request{ScriptID: "approved-script", Type: DeletePod, IssuedAt: now})
+	require.NoError(t, err)
+	_, err = VerifyRequest(unsigned, "key", now)
+	assert.Error(t, err)
+}
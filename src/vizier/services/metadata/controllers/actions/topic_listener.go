@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestTopic is the topic on which the script runner publishes the action requests of alerting scripts.
+const RequestTopic = "ActionRequest"
+
+const actionTimeout = 30 * time.Second
+
+// SendMessageFn is the function the TopicListener uses to publish messages back to NATS.
+type SendMessageFn func(string, []byte) error
+
+// TopicListener handles action requests from the message bus.
+type TopicListener struct {
+	executor    *Executor
+	signingKey  string
+	sendMessage SendMessageFn
+}
+
+// NewTopicListener creates a new listener for action requests. Only requests signed with
+// signingKey are executed.
+func NewTopicListener(executor *Executor, signingKey string, sendMsgFn SendMessageFn) *TopicListener {
+	return &TopicListener{
+		executor:    executor,
+		signingKey:  signingKey,
+		sendMessage: sendMsgFn,
+	}
+}
+
+// Initialize handles any setup that needs to be done.
+func (t *TopicListener) Initialize() error {
+	return nil
+}
+
+// HandleMessage executes the requested action and, if the request expects a reply, responds with the result.
+func (t *TopicListener) HandleMessage(msg *nats.Msg) error {
+	var res *Result
+	req, err := VerifyRequest(msg.Data, t.signingKey, t.executor.nowFn())
+	if err != nil {
+		// Unauthenticated requests are not audited, so that they can't be used to flood the audit log.
+		log.WithError(err).Warn("Rejected action request")
+		res = &Result{Error: "rejected action request: " + err.Error()}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+		defer cancel()
+		res = t.executor.Execute(ctx, req)
+	}
+
+	if msg.Reply == "" {
+		return nil
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return t.sendMessage(msg.Reply, b)
+}
+
+// Stop stops the listener.
+func (t *TopicListener) Stop() {}
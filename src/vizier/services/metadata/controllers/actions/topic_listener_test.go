@@ -0,0 +1,71 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package actions
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicListener_RequiresSignature(t *testing.T) {
+	e, _, audit := setupExecutor(t, testPolicy())
+	now := time.Unix(1700000000, 0)
+	e.nowFn = func() time.Time { return now }
+
+	replies := make(map[string]*Result)
+	tl := NewTopicListener(e, "key", func(topic string, b []byte) error {
+		res := &Result{}
+		require.NoError(t, json.Unmarshal(b, res))
+		replies[topic] = res
+		return nil
+	})
+
+	req := &Request{
+		ScriptID:  "approved-script",
+		Type:      DeletePod,
+		Namespace: "default",
+		Name:      "frontend-abc",
+	}
+	unsigned, err := json.Marshal(req)
+	require.NoError(t, err)
+	require.NoError(t, tl.HandleMessage(&nats.Msg{Data: unsigned, Reply: "unsigned"}))
+
+	forged, err := SignRequest(req, "other-key", now)
+	require.NoError(t, err)
+	require.NoError(t, tl.HandleMessage(&nats.Msg{Data: forged, Reply: "forged"}))
+
+	signed, err := SignRequest(req, "key", now)
+	require.NoError(t, err)
+	require.NoError(t, tl.HandleMessage(&nats.Msg{Data: signed, Reply: "signed"}))
+
+	assert.False(t, replies["unsigned"].Executed)
+	assert.False(t, replies["forged"].Executed)
+	assert.True(t, replies["signed"].Executed)
+
+	// Only the authenticated request reached the executor, and so the audit log.
+	records, err := audit.GetActions()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, replies["signed"].ID, records[0].ID)
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	log "github.com/sirupsen/logrus"
 
+	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/k8s/metadatapb"
 	types "px.dev/pixie/src/shared/types/gotypes"
 	"px.dev/pixie/src/utils"
@@ -41,7 +42,10 @@ import (
 	"px.dev/pixie/src/vizier/utils/messagebus"
 )
 
-var agentRegCounter *prometheus.CounterVec
+var (
+	agentRegCounter       *prometheus.CounterVec
+	agentHeartbeatCounter *prometheus.CounterVec
+)
 
 func init() {
 	agentRegCounter = promauto.NewCounterVec(
@@ -52,6 +56,13 @@ func init() {
 		},
 		[]string{"agent_pod_name"},
 	)
+	agentHeartbeatCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "agent_heartbeats",
+			Help: "Number of heartbeats received from an agent.",
+		},
+		[]string{"agent_pod_name"},
+	)
 }
 
 // Store is the interface that a persistent datastore needs to implement for tracking
@@ -70,6 +81,9 @@ type Store interface {
 	GetAgentsDataInfo() (map[uuid.UUID]*messagespb.AgentDataInfo, error)
 	UpdateAgentDataInfo(agentID uuid.UUID, dataInfo *messagespb.AgentDataInfo) error
 
+	GetAgentSelfTests() ([]*cvmsgspb.NodeSelfTest, error)
+	UpdateAgentSelfTest(agentID uuid.UUID, result *cvmsgspb.NodeSelfTest) error
+
 	GetComputedSchema() (*storepb.ComputedSchema, error)
 	UpdateSchemas(agentID uuid.UUID, schemas []*storepb.TableInfo) error
 	PruneComputedSchema() error
@@ -133,6 +147,11 @@ type Manager interface {
 	// GetAgentIDForHostnamePair gets the agent for the given hostnamePair, if it exists.
 	GetAgentIDForHostnamePair(hnPair *HostnameIPPair) (string, error)
 
+	// UpdateAgentSelfTest stores the self-test result of an active agent.
+	UpdateAgentSelfTest(agentID uuid.UUID, result *cvmsgspb.NodeSelfTest) error
+	// GetAgentSelfTests gets the latest self-test result of every agent that has been tested.
+	GetAgentSelfTests() ([]*cvmsgspb.NodeSelfTest, error)
+
 	// GetServiceCIDR returns the service CIDR for the current cluster.
 	GetServiceCIDR() string
 	// GetPodCIDRs returns the PodCIDRs for the cluster.
@@ -175,6 +194,8 @@ type ManagerImpl struct {
 
 	// Prometheus counter to keep track of agent registrations.
 	agentRegCounter *prometheus.CounterVec
+	// Prometheus counter to keep track of agent heartbeats.
+	agentHeartbeatCounter *prometheus.CounterVec
 }
 
 // NewManager creates a new agent manager.
@@ -182,11 +203,12 @@ type ManagerImpl struct {
 // We need the cidr to get CIDR info right now.
 func NewManager(agtStore Store, cidr CIDRInfoProvider, conn *nats.Conn) *ManagerImpl {
 	Manager := &ManagerImpl{
-		agtStore:            agtStore,
-		cidr:                cidr,
-		conn:                conn,
-		agentUpdateTrackers: make(map[uuid.UUID]*agentUpdateTracker),
-		agentRegCounter:     agentRegCounter,
+		agtStore:              agtStore,
+		cidr:                  cidr,
+		conn:                  conn,
+		agentUpdateTrackers:   make(map[uuid.UUID]*agentUpdateTracker),
+		agentRegCounter:       agentRegCounter,
+		agentHeartbeatCounter: agentHeartbeatCounter,
 	}
 
 	return Manager
@@ -514,6 +536,9 @@ func (m *ManagerImpl) UpdateHeartbeat(agentID uuid.UUID) error {
 	if err != nil {
 		return err
 	}
+	if agent.Info != nil && agent.Info.HostInfo != nil {
+		m.agentHeartbeatCounter.With(prometheus.Labels{"agent_pod_name": agent.Info.HostInfo.PodName}).Inc()
+	}
 
 	return nil
 }
@@ -698,6 +723,25 @@ func (m *ManagerImpl) GetAgentIDForHostnamePair(hnPair *HostnameIPPair) (string,
 	return m.agtStore.GetAgentIDForHostnamePair(hnPair)
 }
 
+// UpdateAgentSelfTest stores the self-test result of an active agent.
+func (m *ManagerImpl) UpdateAgentSelfTest(agentID uuid.UUID, result *cvmsgspb.NodeSelfTest) error {
+	agt, err := m.agtStore.GetAgent(agentID)
+	if err != nil {
+		return err
+	}
+	// The agent may have expired while the self-test was running, in which case there is no
+	// point in keeping its result around.
+	if agt == nil {
+		return ErrAgentNotFound
+	}
+	return m.agtStore.UpdateAgentSelfTest(agentID, result)
+}
+
+// GetAgentSelfTests gets the latest self-test result of every agent that has been tested.
+func (m *ManagerImpl) GetAgentSelfTests() ([]*cvmsgspb.NodeSelfTest, error) {
+	return m.agtStore.GetAgentSelfTests()
+}
+
 // GetServiceCIDR returns the service CIDR for the current cluster.
 func (m *ManagerImpl) GetServiceCIDR() string {
 	return m.cidr.GetServiceCIDR()
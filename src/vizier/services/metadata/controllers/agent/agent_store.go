@@ -32,6 +32,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/k8s"
 	"px.dev/pixie/src/shared/k8s/metadatapb"
 	types "px.dev/pixie/src/shared/types/gotypes"
@@ -45,6 +46,7 @@ import (
 const (
 	agentKeyPrefix      = "/agent/"
 	agentDataInfoPrefix = "/agentDataInfo/"
+	agentSelfTestPrefix = "/agentSelfTest/"
 	asidKey             = "/asid"
 	computedSchemaKey   = "/computedSchema"
 )
@@ -52,6 +54,9 @@ const (
 // ErrNoComputedSchemas is an error indicating the lack of computedSchemas.
 var ErrNoComputedSchemas = errors.New("Could not find any computed schemas")
 
+// ErrAgentNotFound is an error indicating that the agent is not registered.
+var ErrAgentNotFound = errors.New("Agent does not exist")
+
 // HostnameIPPair is a unique identifies for a K8s node.
 type HostnameIPPair struct {
 	Hostname string
@@ -79,6 +84,10 @@ func getAgentDataInfoKey(agentID uuid.UUID) string {
 	return path.Join(agentDataInfoPrefix, agentID.String())
 }
 
+func getAgentSelfTestKey(agentID uuid.UUID) string {
+	return path.Join(agentSelfTestPrefix, agentID.String())
+}
+
 func getHostnamePairAgentKey(pair *HostnameIPPair) string {
 	return path.Join("/hostnameIP", fmt.Sprintf("%s-%s", pair.Hostname, pair.IP), "agent")
 }
@@ -190,7 +199,7 @@ func (a *Datastore) DeleteAgent(agentID uuid.UUID) error {
 		Hostname: hostname,
 		IP:       aPb.Info.HostInfo.HostIP,
 	}
-	delKeys := []string{getAgentKey(agentID), getHostnamePairAgentKey(hnPair), getPodNameToAgentIDKey(aPb.Info.HostInfo.PodName)}
+	delKeys := []string{getAgentKey(agentID), getHostnamePairAgentKey(hnPair), getPodNameToAgentIDKey(aPb.Info.HostInfo.PodName), getAgentSelfTestKey(agentID)}
 
 	// Info.Capabiltiies should never be nil with our new PEMs/Kelvin. If it is nil,
 	// this means that the protobuf we retrieved from etcd belongs to an older agent.
@@ -326,6 +335,42 @@ func (a *Datastore) UpdateAgentDataInfo(agentID uuid.UUID, dataInfo *messagespb.
 	return a.ds.Set(getAgentDataInfoKey(agentID), string(i))
 }
 
+// GetAgentSelfTests returns the latest self-test result of every agent that has been tested.
+func (a *Datastore) GetAgentSelfTests() ([]*cvmsgspb.NodeSelfTest, error) {
+	var results []*cvmsgspb.NodeSelfTest
+
+	keys, vals, err := a.ds.GetWithPrefix(agentSelfTestPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		// Filter out keys that aren't of the form /agentSelfTest/<uuid>.
+		splitKey := strings.Split(string(key), "/")
+		if len(splitKey) != 3 {
+			continue
+		}
+
+		pb := &cvmsgspb.NodeSelfTest{}
+		err = proto.Unmarshal(vals[i], pb)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, pb)
+	}
+	return results, nil
+}
+
+// UpdateAgentSelfTest stores the latest self-test result of the given agent.
+func (a *Datastore) UpdateAgentSelfTest(agentID uuid.UUID, result *cvmsgspb.NodeSelfTest) error {
+	i, err := result.Marshal()
+	if err != nil {
+		return errors.New("Unable to marshal agent self-test protobuf: " + err.Error())
+	}
+
+	return a.ds.Set(getAgentSelfTestKey(agentID), string(i))
+}
+
 // GetComputedSchema returns the raw CombinedComputedSchema.
 func (a *Datastore) GetComputedSchema() (*storepb.ComputedSchema, error) {
 	cSchemas, err := a.ds.Get(computedSchemaKey)
@@ -34,6 +34,7 @@ import (
 
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/shared/bloomfilterpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
 	k8s_metadatapb "px.dev/pixie/src/shared/k8s/metadatapb"
 	"px.dev/pixie/src/shared/metadatapb"
 	types "px.dev/pixie/src/shared/types/gotypes"
@@ -303,6 +304,39 @@ func TestUpdateAgentDelete(t *testing.T) {
 	assert.Equal(t, "", hostnameID)
 }
 
+func TestUpdateAgentSelfTest(t *testing.T) {
+	_, agtMgr, _, cleanup := setupManager(t)
+	defer cleanup()
+
+	u, err := uuid.FromString(testutils.ExistingAgentUUID)
+	require.NoError(t, err)
+	result := &cvmsgspb.NodeSelfTest{
+		AgentID:  utils.ProtoFromUUID(u),
+		Hostname: "testhost",
+		Checks: []*cvmsgspb.SelfTestCheck{
+			{Name: "http_tracing", Passed: true},
+		},
+		LastRunNS: 10,
+	}
+	err = agtMgr.UpdateAgentSelfTest(u, result)
+	require.NoError(t, err)
+
+	results, err := agtMgr.GetAgentSelfTests()
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, result, results[0])
+
+	// The result should go away along with the agent.
+	err = agtMgr.DeleteAgent(u)
+	require.NoError(t, err)
+	results, err = agtMgr.GetAgentSelfTests()
+	require.NoError(t, err)
+	assert.Len(t, results, 0)
+
+	err = agtMgr.UpdateAgentSelfTest(u, result)
+	assert.Equal(t, agent.ErrAgentNotFound, err)
+}
+
 func TestGetActiveAgents(t *testing.T) {
 	_, agtMgr, _, cleanup := setupManager(t)
 	defer cleanup()
@@ -29,6 +29,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"px.dev/pixie/src/common/base/statuspb"
+	"px.dev/pixie/src/shared/services/clock"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
@@ -81,6 +82,7 @@ type AgentTopicListener struct {
 	agtMgr      agent.Manager
 	tpMgr       *tracepoint.Manager
 	sendMessage SendMessageFn
+	clock       clock.Clock
 
 	// Map from agent ID -> the agentHandler that's responsible for handling that particular
 	// agent's messagespb.
@@ -93,6 +95,7 @@ type AgentHandler struct {
 	agtMgr agent.Manager
 	tpMgr  *tracepoint.Manager
 	atl    *AgentTopicListener
+	clock  clock.Clock
 
 	MsgChannel chan *nats.Msg
 	quitCh     chan struct{}
@@ -104,10 +107,17 @@ type AgentHandler struct {
 // NewAgentTopicListener creates a new agent topic listener.
 func NewAgentTopicListener(agtMgr agent.Manager, tpMgr *tracepoint.Manager,
 	sendMsgFn SendMessageFn) (*AgentTopicListener, error) {
+	return NewAgentTopicListenerWithClock(agtMgr, tpMgr, sendMsgFn, clock.New())
+}
+
+// NewAgentTopicListenerWithClock creates a new agent topic listener which uses the given clock to expire agents.
+func NewAgentTopicListenerWithClock(agtMgr agent.Manager, tpMgr *tracepoint.Manager,
+	sendMsgFn SendMessageFn, clk clock.Clock) (*AgentTopicListener, error) {
 	atl := &AgentTopicListener{
 		agtMgr:      agtMgr,
 		tpMgr:       tpMgr,
 		sendMessage: sendMsgFn,
+		clock:       clk,
 		agentMap:    &concurrentAgentMap{unsafeMap: make(map[uuid.UUID]*AgentHandler)},
 	}
 
@@ -191,6 +201,7 @@ func (a *AgentTopicListener) createAgentHandler(agentID uuid.UUID) *AgentHandler
 		agtMgr:     a.agtMgr,
 		tpMgr:      a.tpMgr,
 		atl:        a,
+		clock:      a.clock,
 		MsgChannel: make(chan *nats.Msg, 10),
 		quitCh:     make(chan struct{}),
 	}
@@ -319,7 +330,7 @@ func (ah *AgentHandler) processMessages() {
 		ah.wg.Done()
 	}()
 
-	timer := time.NewTimer(agentExpirationTimeout)
+	timer := ah.clock.NewTimer(agentExpirationTimeout)
 	for {
 		select {
 		case <-ah.quitCh: // Prioritize the quitChannel.
@@ -350,10 +361,10 @@ func (ah *AgentHandler) processMessages() {
 			}
 
 			if !timer.Stop() {
-				<-timer.C
+				<-timer.C()
 			}
 			timer.Reset(agentExpirationTimeout)
-		case <-timer.C:
+		case <-timer.C():
 			log.WithField("agentID", ah.id.String()).Info("AgentHandler timed out, deleting agent")
 			return
 		}
@@ -389,8 +400,8 @@ func (ah *AgentHandler) onAgentRegisterRequest(m *messagespb.RegisterAgentReques
 	// Create agent in agent manager.
 	agentInfo := &agentpb.Agent{
 		Info:            m.Info,
-		LastHeartbeatNS: time.Now().UnixNano(),
-		CreateTimeNS:    time.Now().UnixNano(),
+		LastHeartbeatNS: ah.clock.Now().UnixNano(),
+		CreateTimeNS:    ah.clock.Now().UnixNano(),
 		// This will be set if this is an agent trying to reregister.
 		ASID: m.ASID,
 	}
@@ -460,7 +471,7 @@ func (ah *AgentHandler) onAgentHeartbeat(m *messagespb.Heartbeat) {
 	resp := messagespb.VizierMessage{
 		Msg: &messagespb.VizierMessage_HeartbeatAck{
 			HeartbeatAck: &messagespb.HeartbeatAck{
-				Time: time.Now().UnixNano(),
+				Time: ah.clock.Now().UnixNano(),
 				UpdateInfo: &messagespb.MetadataUpdateInfo{
 					ServiceCIDR: ah.agtMgr.GetServiceCIDR(),
 					PodCIDRs:    ah.agtMgr.GetPodCIDRs(),
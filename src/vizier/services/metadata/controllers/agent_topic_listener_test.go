@@ -33,6 +33,7 @@ import (
 
 	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/shared/k8s/metadatapb"
+	"px.dev/pixie/src/shared/services/clock"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/metadata/controllers"
@@ -65,6 +66,10 @@ func assertSendMessageCalledWith(t *testing.T, expTopic string, expMsg messagesp
 }
 
 func setup(t *testing.T, sendMsgFn controllers.SendMessageFn) (*controllers.AgentTopicListener, *mock_agent.MockManager, *mock_tracepoint.MockStore, func()) {
+	return setupWithClock(t, sendMsgFn, clock.New())
+}
+
+func setupWithClock(t *testing.T, sendMsgFn controllers.SendMessageFn, clk clock.Clock) (*controllers.AgentTopicListener, *mock_agent.MockManager, *mock_tracepoint.MockStore, func()) {
 	ctrl := gomock.NewController(t)
 
 	mockAgtMgr := mock_agent.NewMockManager(ctrl)
@@ -82,7 +87,7 @@ func setup(t *testing.T, sendMsgFn controllers.SendMessageFn) (*controllers.Agen
 		Return([]*agentpb.Agent{agentInfo}, nil)
 
 	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
-	atl, _ := controllers.NewAgentTopicListener(mockAgtMgr, tracepointMgr, sendMsgFn)
+	atl, _ := controllers.NewAgentTopicListenerWithClock(mockAgtMgr, tracepointMgr, sendMsgFn, clk)
 
 	cleanup := func() {
 		ctrl.Finish()
@@ -586,3 +591,33 @@ func TestAgentStop(t *testing.T) {
 
 	atl.StopAgent(u)
 }
+
+func TestAgentExpiration(t *testing.T) {
+	u, err := uuid.FromString(testutils.UnhealthyKelvinAgentUUID)
+	require.NoError(t, err)
+
+	clk := clock.NewFakeClock(time.Unix(1700000000, 0))
+	sendMsg := func(topic string, b []byte) error { return nil }
+	_, mockAgtMgr, mockTracepointStore, cleanup := setupWithClock(t, sendMsg, clk)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	mockAgtMgr.
+		EXPECT().
+		DeleteAgent(u).
+		Return(nil)
+	mockTracepointStore.
+		EXPECT().
+		DeleteTracepointsForAgent(u).
+		DoAndReturn(func(uuid.UUID) error {
+			wg.Done()
+			return nil
+		})
+
+	// The existing agent's handler should be waiting on its expiration timer.
+	clk.BlockUntil(1)
+	clk.Advance(59 * time.Second)
+	clk.Advance(time.Second)
+	wg.Wait()
+}
@@ -0,0 +1,376 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package backfill
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/client/versioned"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+const (
+	// policyRefreshInterval is how often the policy is refetched.
+	policyRefreshInterval = 30 * time.Second
+	// scheduleInterval is how often the controller checks for backfills that timed out, so that waiting PEMs
+	// get their turn even if no messages arrive.
+	scheduleInterval = 5 * time.Second
+	// timeoutGrace is how long after its timeout a PEM has to report that it stopped backfilling, before its
+	// backfill is considered failed.
+	timeoutGrace = 30 * time.Second
+	// statusRetention is how long the status of a finished backfill is reported.
+	statusRetention = time.Hour
+)
+
+// AgentMessenger sends messages to the agents.
+type AgentMessenger interface {
+	GetActiveAgents() ([]*agentpb.Agent, error)
+	MessageAgents(agentIDs []uuid.UUID, msg []byte) error
+}
+
+// PolicyGetter returns the current backfill policy.
+type PolicyGetter func() (*Policy, error)
+
+// VizierPolicyGetter reads the policy from the Vizier CRD in the given namespace. If there is no Vizier CRD,
+// because Vizier was deployed without the operator, the default policy is used.
+func VizierPolicyGetter(vzClient versioned.Interface, namespace string) PolicyGetter {
+	return func() (*Policy, error) {
+		viziers, err := vzClient.PxV1alpha1().Viziers(namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if len(viziers.Items) == 0 {
+			return DefaultPolicy(), nil
+		}
+		return PolicyFromVizier(viziers.Items[0].Spec.Backfill), nil
+	}
+}
+
+type agentBackfill struct {
+	state        messagespb.BackfillState
+	bufferedNs   int64
+	backfilledNs int64
+	records      int64
+	message      string
+	requestedAt  time.Time
+	startedAt    time.Time
+	updatedAt    time.Time
+}
+
+func (b *agentBackfill) finished() bool {
+	return b.state != messagespb.BACKFILL_STATE_PENDING && b.state != messagespb.BACKFILL_STATE_IN_PROGRESS
+}
+
+// Controller decides when each restarted PEM may backfill its buffered data. PEMs ask to backfill after they
+// restart, and only the number of PEMs allowed by the policy backfill at a time, so that a rolling restart of
+// the PEMs doesn't spike the CPU of the whole cluster at once.
+type Controller struct {
+	agents    AgentMessenger
+	getPolicy PolicyGetter
+	now       func() time.Time
+
+	quitCh chan struct{}
+	once   sync.Once
+
+	mu              sync.Mutex
+	policy          *Policy
+	policyFetchedAt time.Time
+	backfills       map[uuid.UUID]*agentBackfill
+}
+
+// NewController creates a new backfill controller.
+func NewController(agents AgentMessenger, getPolicy PolicyGetter) *Controller {
+	return &Controller{
+		agents:    agents,
+		getPolicy: getPolicy,
+		now:       time.Now,
+		quitCh:    make(chan struct{}),
+		backfills: make(map[uuid.UUID]*agentBackfill),
+	}
+}
+
+// Start periodically gives waiting PEMs their turn, when the backfills of other PEMs time out.
+func (c *Controller) Start() {
+	go func() {
+		t := time.NewTicker(scheduleInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-c.quitCh:
+				return
+			case <-t.C:
+				c.mu.Lock()
+				c.schedule(c.now())
+				c.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// Initialize handles any setup that needs to be done.
+func (c *Controller) Initialize() error {
+	return nil
+}
+
+// HandleMessage handles a backfill request or status from a PEM.
+func (c *Controller) HandleMessage(msg *nats.Msg) error {
+	m := &messagespb.BackfillMessage{}
+	if err := m.Unmarshal(msg.Data); err != nil {
+		return err
+	}
+	return c.HandleBackfillMessage(m)
+}
+
+// HandleBackfillMessage handles a backfill request or status from a PEM.
+func (c *Controller) HandleBackfillMessage(m *messagespb.BackfillMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	switch msg := m.Msg.(type) {
+	case *messagespb.BackfillMessage_BackfillRequest:
+		c.onRequest(msg.BackfillRequest, now)
+	case *messagespb.BackfillMessage_BackfillStatus:
+		c.onStatus(msg.BackfillStatus, now)
+	default:
+		log.Error("Received empty BackfillMessage.")
+		return nil
+	}
+	c.schedule(now)
+	return nil
+}
+
+func (c *Controller) onRequest(r *messagespb.BackfillRequest, now time.Time) {
+	agentID, err := utils.UUIDFromProto(r.AgentID)
+	if err != nil {
+		log.WithError(err).Error("Received backfill request with invalid agent ID")
+		return
+	}
+	// A PEM that restarts again replaces its previous backfill.
+	b := &agentBackfill{
+		state:       messagespb.BACKFILL_STATE_PENDING,
+		bufferedNs:  r.BufferedNs,
+		requestedAt: now,
+		updatedAt:   now,
+	}
+	c.backfills[agentID] = b
+
+	if r.BufferedNs <= 0 {
+		c.skip(agentID, b, "nothing to backfill", now)
+	}
+}
+
+func (c *Controller) onStatus(s *messagespb.BackfillStatus, now time.Time) {
+	agentID, err := utils.UUIDFromProto(s.AgentID)
+	if err != nil {
+		log.WithError(err).Error("Received backfill status with invalid agent ID")
+		return
+	}
+	b, ok := c.backfills[agentID]
+	if !ok || b.finished() {
+		return
+	}
+	b.state = s.State
+	b.backfilledNs = s.BackfilledNs
+	b.records = s.Records
+	b.message = s.Message
+	b.updatedAt = now
+	if b.finished() {
+		log.WithField("agent", agentID).WithField("state", s.State).WithField("records", s.Records).
+			WithField("backfilled", time.Duration(s.BackfilledNs)).Info("PEM finished backfill")
+	}
+}
+
+// schedule fails the backfills that timed out or whose PEMs went away, and gives waiting PEMs their turn.
+// Must be called with the lock held.
+func (c *Controller) schedule(now time.Time) {
+	policy := c.currentPolicy(now)
+
+	var inProgress int
+	var pending []uuid.UUID
+	for id, b := range c.backfills {
+		switch {
+		case b.finished():
+			if now.Sub(b.updatedAt) > statusRetention {
+				delete(c.backfills, id)
+			}
+		case b.state == messagespb.BACKFILL_STATE_IN_PROGRESS:
+			if now.Sub(b.startedAt) > policy.Timeout+timeoutGrace {
+				c.fail(id, b, "the PEM did not report the end of its backfill before the timeout", now)
+				continue
+			}
+			inProgress++
+		default:
+			pending = append(pending, id)
+		}
+	}
+	if len(pending) == 0 && inProgress == 0 {
+		return
+	}
+
+	active, err := c.activeAgents()
+	if err != nil {
+		log.WithError(err).Error("Failed to get active agents for backfill")
+		return
+	}
+	for id, b := range c.backfills {
+		if !b.finished() && !active[id] {
+			if b.state == messagespb.BACKFILL_STATE_IN_PROGRESS {
+				inProgress--
+			}
+			c.fail(id, b, "the PEM is no longer active", now)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return c.backfills[pending[i]].requestedAt.Before(c.backfills[pending[j]].requestedAt)
+	})
+	for _, id := range pending {
+		b := c.backfills[id]
+		if b.finished() {
+			continue
+		}
+		if !policy.Enabled {
+			c.skip(id, b, "backfills are disabled", now)
+			continue
+		}
+		if policy.MaxConcurrentPEMs > 0 && inProgress >= policy.MaxConcurrentPEMs {
+			return
+		}
+		if err := c.send(id, policy.Directive()); err != nil {
+			log.WithError(err).WithField("agent", id).Error("Failed to let PEM backfill")
+			continue
+		}
+		b.state = messagespb.BACKFILL_STATE_IN_PROGRESS
+		b.startedAt = now
+		b.updatedAt = now
+		inProgress++
+	}
+}
+
+// skip tells the PEM to drop its buffered data.
+func (c *Controller) skip(agentID uuid.UUID, b *agentBackfill, reason string, now time.Time) {
+	if err := c.send(agentID, &messagespb.BackfillDirective{}); err != nil {
+		log.WithError(err).WithField("agent", agentID).Error("Failed to tell PEM to skip backfill")
+	}
+	b.state = messagespb.BACKFILL_STATE_SKIPPED
+	b.message = reason
+	b.updatedAt = now
+}
+
+func (c *Controller) fail(agentID uuid.UUID, b *agentBackfill, reason string, now time.Time) {
+	log.WithField("agent", agentID).WithField("reason", reason).Warn("PEM backfill failed")
+	b.state = messagespb.BACKFILL_STATE_FAILED
+	b.message = reason
+	b.updatedAt = now
+}
+
+func (c *Controller) currentPolicy(now time.Time) *Policy {
+	if c.policy != nil && now.Sub(c.policyFetchedAt) < policyRefreshInterval {
+		return c.policy
+	}
+	p, err := c.getPolicy()
+	if err != nil {
+		log.WithError(err).Error("Failed to get backfill policy")
+		if c.policy == nil {
+			return DefaultPolicy()
+		}
+		return c.policy
+	}
+	c.policy = p
+	c.policyFetchedAt = now
+	return p
+}
+
+func (c *Controller) activeAgents() (map[uuid.UUID]bool, error) {
+	agents, err := c.agents.GetActiveAgents()
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[uuid.UUID]bool)
+	for _, a := range agents {
+		active[utils.UUIDFromProtoOrNil(a.Info.AgentID)] = true
+	}
+	return active, nil
+}
+
+func (c *Controller) send(agentID uuid.UUID, directive *messagespb.BackfillDirective) error {
+	msg := &messagespb.VizierMessage{
+		Msg: &messagespb.VizierMessage_BackfillDirective{BackfillDirective: directive},
+	}
+	b, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.agents.MessageAgents([]uuid.UUID{agentID}, b)
+}
+
+// GetBackfillStatus returns the backfill policy, and the state of the backfill of each restarted PEM.
+func (c *Controller) GetBackfillStatus(ctx context.Context, req *metadatapb.GetBackfillStatusRequest) (*metadatapb.GetBackfillStatusResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	policy := c.currentPolicy(c.now())
+	resp := &metadatapb.GetBackfillStatusResponse{
+		Enabled:           policy.Enabled,
+		MaxAgeNs:          policy.MaxAge.Nanoseconds(),
+		MaxConcurrentPEMs: int32(policy.MaxConcurrentPEMs),
+	}
+
+	ids := make([]uuid.UUID, 0, len(c.backfills))
+	for id := range c.backfills {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return c.backfills[ids[i]].requestedAt.Before(c.backfills[ids[j]].requestedAt)
+	})
+	for _, id := range ids {
+		b := c.backfills[id]
+		updatedAt, _ := types.TimestampProto(b.updatedAt)
+		resp.Agents = append(resp.Agents, &metadatapb.GetBackfillStatusResponse_AgentBackfillStatus{
+			AgentID:      utils.ProtoFromUUID(id),
+			State:        b.state,
+			BufferedNs:   b.bufferedNs,
+			BackfilledNs: b.backfilledNs,
+			Records:      b.records,
+			Message:      b.message,
+			UpdatedAt:    updatedAt,
+		})
+	}
+	return resp, nil
+}
+
+// Stop stops the controller.
+func (c *Controller) Stop() {
+	c.once.Do(func() {
+		close(c.quitCh)
+	})
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package backfill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/operator/client/versioned/fake"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+type fakeMessenger struct {
+	agents   []*agentpb.Agent
+	sentTo   []uuid.UUID
+	messages []*messagespb.BackfillDirective
+}
+
+func (f *fakeMessenger) GetActiveAgents() ([]*agentpb.Agent, error) {
+	return f.agents, nil
+}
+
+func (f *fakeMessenger) MessageAgents(agentIDs []uuid.UUID, msg []byte) error {
+	vzMsg := &messagespb.VizierMessage{}
+	if err := vzMsg.Unmarshal(msg); err != nil {
+		return err
+	}
+	f.sentTo = append(f.sentTo, agentIDs...)
+	f.messages = append(f.messages, vzMsg.GetBackfillDirective())
+	return nil
+}
+
+func newAgent(id uuid.UUID) *agentpb.Agent {
+	return &agentpb.Agent{
+		Info: &agentpb.AgentInfo{AgentID: utils.ProtoFromUUID(id)},
+	}
+}
+
+func request(id uuid.UUID, buffered time.Duration) *messagespb.BackfillMessage {
+	return &messagespb.BackfillMessage{
+		Msg: &messagespb.BackfillMessage_BackfillRequest{
+			BackfillRequest: &messagespb.BackfillRequest{AgentID: utils.ProtoFromUUID(id), BufferedNs: buffered.Nanoseconds()},
+		},
+	}
+}
+
+func status(id uuid.UUID, state messagespb.BackfillState, records int64) *messagespb.BackfillMessage {
+	return &messagespb.BackfillMessage{
+		Msg: &messagespb.BackfillMessage_BackfillStatus{
+			BackfillStatus: &messagespb.BackfillStatus{AgentID: utils.ProtoFromUUID(id), State: state, Records: records},
+		},
+	}
+}
+
+func newController(t *testing.T, policy *v1alpha1.BackfillPolicy, agentIDs ...uuid.UUID) (*Controller, *fakeMessenger, *time.Time) {
+	messenger := &fakeMessenger{}
+	for _, id := range agentIDs {
+		messenger.agents = append(messenger.agents, newAgent(id))
+	}
+	vzClient := fake.NewSimpleClientset(&v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec:       v1alpha1.VizierSpec{Backfill: policy},
+	})
+	c := NewController(messenger, VizierPolicyGetter(vzClient, "pl"))
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	t.Cleanup(c.Stop)
+	return c, messenger, &now
+}
+
+func TestController_Disabled(t *testing.T) {
+	pemID := uuid.Must(uuid.NewV4())
+	c, messenger, _ := newController(t, nil, pemID)
+
+	require.NoError(t, c.HandleBackfillMessage(request(pemID, time.Minute)))
+	require.Len(t, messenger.messages, 1)
+	assert.Equal(t, pemID, messenger.sentTo[0])
+	assert.False(t, messenger.messages[0].Enabled)
+
+	resp, err := c.GetBackfillStatus(context.Background(), &metadatapb.GetBackfillStatusRequest{})
+	require.NoError(t, err)
+	assert.False(t, resp.Enabled)
+	require.Len(t, resp.Agents, 1)
+	assert.Equal(t, messagespb.BACKFILL_STATE_SKIPPED, resp.Agents[0].State)
+	assert.Equal(t, "backfills are disabled", resp.Agents[0].Message)
+}
+
+func TestController_LimitsConcurrentPEMs(t *testing.T) {
+	pem1 := uuid.Must(uuid.NewV4())
+	pem2 := uuid.Must(uuid.NewV4())
+	c, messenger, now := newController(t, &v1alpha1.BackfillPolicy{
+		Enabled:           true,
+		MaxAge:            &metav1.Duration{Duration: 10 * time.Minute},
+		MaxConcurrentPEMs: 1,
+	}, pem1, pem2)
+
+	require.NoError(t, c.HandleBackfillMessage(request(pem1, time.Minute)))
+	require.Len(t, messenger.messages, 1)
+	assert.Equal(t, pem1, messenger.sentTo[0])
+	assert.True(t, messenger.messages[0].Enabled)
+	assert.Equal(t, (10 * time.Minute).Nanoseconds(), messenger.messages[0].MaxAgeNs)
+	assert.Equal(t, (5 * time.Minute).Nanoseconds(), messenger.messages[0].TimeoutNs)
+
+	// The second PEM waits for the first one to finish.
+	*now = now.Add(time.Second)
+	require.NoError(t, c.HandleBackfillMessage(request(pem2, time.Minute)))
+	assert.Len(t, messenger.messages, 1)
+
+	*now = now.Add(time.Second)
+	require.NoError(t, c.HandleBackfillMessage(status(pem1, messagespb.BACKFILL_STATE_COMPLETED, 42)))
+	require.Len(t, messenger.messages, 2)
+	assert.Equal(t, pem2, messenger.sentTo[1])
+	assert.True(t, messenger.messages[1].Enabled)
+
+	resp, err := c.GetBackfillStatus(context.Background(), &metadatapb.GetBackfillStatusRequest{})
+	require.NoError(t, err)
+	assert.True(t, resp.Enabled)
+	assert.Equal(t, int32(1), resp.MaxConcurrentPEMs)
+	require.Len(t, resp.Agents, 2)
+	assert.Equal(t, utils.ProtoFromUUID(pem1), resp.Agents[0].AgentID)
+	assert.Equal(t, messagespb.BACKFILL_STATE_COMPLETED, resp.Agents[0].State)
+	assert.Equal(t, int64(42), resp.Agents[0].Records)
+	assert.Equal(t, utils.ProtoFromUUID(pem2), resp.Agents[1].AgentID)
+	assert.Equal(t, messagespb.BACKFILL_STATE_IN_PROGRESS, resp.Agents[1].State)
+}
+
+func TestController_TimedOutBackfillFreesSlot(t *testing.T) {
+	pem1 := uuid.Must(uuid.NewV4())
+	pem2 := uuid.Must(uuid.NewV4())
+	c, messenger, now := newController(t, &v1alpha1.BackfillPolicy{
+		Enabled:           true,
+		MaxConcurrentPEMs: 1,
+		Timeout:           &metav1.Duration{Duration: time.Minute},
+	}, pem1, pem2)
+
+	require.NoError(t, c.HandleBackfillMessage(request(pem1, time.Minute)))
+	*now = now.Add(time.Second)
+	require.NoError(t, c.HandleBackfillMessage(request(pem2, time.Minute)))
+	assert.Len(t, messenger.messages, 1)
+
+	*now = now.Add(time.Minute + timeoutGrace + time.Second)
+	c.mu.Lock()
+	c.schedule(*now)
+	c.mu.Unlock()
+	require.Len(t, messenger.messages, 2)
+	assert.Equal(t, pem2, messenger.sentTo[1])
+
+	// A late status from the timed out PEM is ignored.
+	require.NoError(t, c.HandleBackfillMessage(status(pem1, messagespb.BACKFILL_STATE_COMPLETED, 1)))
+	resp, err := c.GetBackfillStatus(context.Background(), &metadatapb.GetBackfillStatusRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Agents, 2)
+	assert.Equal(t, messagespb.BACKFILL_STATE_FAILED, resp.Agents[0].State)
+}
+
+func TestController_SkipsInactiveAndEmptyPEMs(t *testing.T) {
+	pem1 := uuid.Must(uuid.NewV4())
+	pem2 := uuid.Must(uuid.NewV4())
+	c, messenger, now := newController(t, &v1alpha1.BackfillPolicy{Enabled: true}, pem1)
+
+	// Nothing was buffered, so there is nothing to backfill.
+	require.NoError(t, c.HandleBackfillMessage(request(pem1, 0)))
+	require.Len(t, messenger.messages, 1)
+	assert.False(t, messenger.messages[0].Enabled)
+
+	// The PEM went away before it was its turn.
+	*now = now.Add(time.Second)
+	require.NoError(t, c.HandleBackfillMessage(request(pem2, time.Minute)))
+	assert.Len(t, messenger.messages, 1)
+
+	resp, err := c.GetBackfillStatus(context.Background(), &metadatapb.GetBackfillStatusRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Agents, 2)
+	assert.Equal(t, messagespb.BACKFILL_STATE_SKIPPED, resp.Agents[0].State)
+	assert.Equal(t, messagespb.BACKFILL_STATE_FAILED, resp.Agents[1].State)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package backfill
+
+import (
+	"time"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+)
+
+const (
+	defaultMaxConcurrentPEMs = 2
+	defaultTimeout           = 5 * time.Minute
+)
+
+// Policy decides whether and how far restarted PEMs backfill, and how many of them may do so at once.
+type Policy struct {
+	// Enabled specifies whether restarted PEMs backfill at all.
+	Enabled bool
+	// MaxAge is how far back PEMs backfill. 0 backfills all buffered data.
+	MaxAge time.Duration
+	// MaxConcurrentPEMs is how many PEMs may backfill at the same time. 0 means there is no limit.
+	MaxConcurrentPEMs int
+	// Timeout is how long a PEM may backfill before its turn is given to the next PEM.
+	Timeout time.Duration
+}
+
+// DefaultPolicy is the policy used when the Vizier does not configure backfills. PEMs don't backfill.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxConcurrentPEMs: defaultMaxConcurrentPEMs,
+		Timeout:           defaultTimeout,
+	}
+}
+
+// PolicyFromVizier converts the backfill policy of the Vizier CRD, filling in the defaults of unset fields.
+func PolicyFromVizier(bf *v1alpha1.BackfillPolicy) *Policy {
+	p := DefaultPolicy()
+	if bf == nil {
+		return p
+	}
+	p.Enabled = bf.Enabled
+	if bf.MaxAge != nil {
+		p.MaxAge = bf.MaxAge.Duration
+	}
+	if bf.MaxConcurrentPEMs > 0 {
+		p.MaxConcurrentPEMs = int(bf.MaxConcurrentPEMs)
+	}
+	if bf.Timeout != nil && bf.Timeout.Duration > 0 {
+		p.Timeout = bf.Timeout.Duration
+	}
+	return p
+}
+
+// Directive returns the directive that tells a PEM how to backfill once it is its turn.
+func (p *Policy) Directive() *messagespb.BackfillDirective {
+	if !p.Enabled {
+		return &messagespb.BackfillDirective{}
+	}
+	return &messagespb.BackfillDirective{
+		Enabled:   true,
+		MaxAgeNs:  p.MaxAge.Nanoseconds(),
+		TimeoutNs: p.Timeout.Nanoseconds(),
+	}
+}
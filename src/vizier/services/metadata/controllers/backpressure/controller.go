@@ -0,0 +1,207 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package backpressure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/client/versioned"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+// policyRefreshInterval is how often the policy is refetched.
+const policyRefreshInterval = 30 * time.Second
+
+// AgentMessenger sends messages to the agents.
+type AgentMessenger interface {
+	GetActiveAgents() ([]*agentpb.Agent, error)
+	MessageAgents(agentIDs []uuid.UUID, msg []byte) error
+}
+
+// PolicyGetter returns the current backpressure policy.
+type PolicyGetter func() (*Policy, error)
+
+// VizierPolicyGetter reads the policy from the Vizier CRD in the given namespace. If there is no Vizier CRD,
+// because Vizier was deployed without the operator, the default policy is used.
+func VizierPolicyGetter(vzClient versioned.Interface, namespace string) PolicyGetter {
+	return func() (*Policy, error) {
+		viziers, err := vzClient.PxV1alpha1().Viziers(namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if len(viziers.Items) == 0 {
+			return DefaultPolicy(), nil
+		}
+		return PolicyFromVizier(viziers.Items[0].Spec.Backpressure), nil
+	}
+}
+
+type reportKey struct {
+	path   string
+	source string
+}
+
+type report struct {
+	utilization float64
+	receivedAt  time.Time
+}
+
+// Controller collects the saturation reports of the data paths, and sends backpressure signals to the PEMs
+// when the policy says so. Signals expire on the PEMs after the report TTL, so they are resent while they
+// stay in effect.
+type Controller struct {
+	agents    AgentMessenger
+	getPolicy PolicyGetter
+	reportTTL time.Duration
+	now       func() time.Time
+
+	mu              sync.Mutex
+	policy          *Policy
+	policyFetchedAt time.Time
+	reports         map[reportKey]report
+	lastSignal      *messagespb.BackpressureSignal
+	lastSentAt      time.Time
+}
+
+// NewController creates a new backpressure controller. Reports that are older than reportTTL are ignored, and
+// the signals sent to the PEMs expire after the same duration.
+func NewController(agents AgentMessenger, getPolicy PolicyGetter, reportTTL time.Duration) *Controller {
+	return &Controller{
+		agents:    agents,
+		getPolicy: getPolicy,
+		reportTTL: reportTTL,
+		now:       time.Now,
+		reports:   make(map[reportKey]report),
+	}
+}
+
+// Initialize handles any setup that needs to be done.
+func (c *Controller) Initialize() error {
+	return nil
+}
+
+// HandleMessage records a saturation report and updates the PEMs if the signal changed.
+func (c *Controller) HandleMessage(msg *nats.Msg) error {
+	r := &messagespb.SaturationReport{}
+	if err := r.Unmarshal(msg.Data); err != nil {
+		return err
+	}
+	return c.HandleReport(r)
+}
+
+// HandleReport records a saturation report and updates the PEMs if the signal changed.
+func (c *Controller) HandleReport(r *messagespb.SaturationReport) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.reports[reportKey{path: r.Path, source: r.Source}] = report{utilization: r.Utilization, receivedAt: now}
+
+	saturation := make(map[string]float64)
+	for k, v := range c.reports {
+		if now.Sub(v.receivedAt) > c.reportTTL {
+			delete(c.reports, k)
+			continue
+		}
+		if v.utilization > saturation[k.path] {
+			saturation[k.path] = v.utilization
+		}
+	}
+
+	signal := c.currentPolicy(now).Evaluate(saturation)
+	signal.TTLNs = c.reportTTL.Nanoseconds()
+	if !c.shouldSend(signal, now) {
+		return nil
+	}
+	if err := c.send(signal); err != nil {
+		return err
+	}
+	if signal.Action != c.lastSignal.GetAction() {
+		log.WithField("action", signal.Action).WithField("saturatedPaths", signal.SaturatedPaths).Info("Backpressure signal changed")
+	}
+	c.lastSignal = signal
+	c.lastSentAt = now
+	return nil
+}
+
+func (c *Controller) currentPolicy(now time.Time) *Policy {
+	if c.policy != nil && now.Sub(c.policyFetchedAt) < policyRefreshInterval {
+		return c.policy
+	}
+	p, err := c.getPolicy()
+	if err != nil {
+		log.WithError(err).Error("Failed to get backpressure policy")
+		if c.policy == nil {
+			return DefaultPolicy()
+		}
+		return c.policy
+	}
+	c.policy = p
+	c.policyFetchedAt = now
+	return p
+}
+
+// shouldSend returns whether the signal should be sent to the PEMs: either it changed, or it is still in effect
+// and must be renewed before it expires on the PEMs.
+func (c *Controller) shouldSend(signal *messagespb.BackpressureSignal, now time.Time) bool {
+	if c.lastSignal == nil {
+		// The PEMs ingest normally until they are told otherwise.
+		return signal.Action != messagespb.BACKPRESSURE_ACTION_NONE
+	}
+	last := *c.lastSignal
+	last.TTLNs = signal.TTLNs
+	if !last.Equal(signal) {
+		return true
+	}
+	return signal.Action != messagespb.BACKPRESSURE_ACTION_NONE && now.Sub(c.lastSentAt) >= c.reportTTL/2
+}
+
+func (c *Controller) send(signal *messagespb.BackpressureSignal) error {
+	agents, err := c.agents.GetActiveAgents()
+	if err != nil {
+		return err
+	}
+	var pemIDs []uuid.UUID
+	for _, a := range agents {
+		if a.Info.Capabilities == nil || a.Info.Capabilities.CollectsData {
+			pemIDs = append(pemIDs, utils.UUIDFromProtoOrNil(a.Info.AgentID))
+		}
+	}
+
+	msg := &messagespb.VizierMessage{
+		Msg: &messagespb.VizierMessage_BackpressureSignal{BackpressureSignal: signal},
+	}
+	b, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.agents.MessageAgents(pemIDs, b)
+}
+
+// Stop stops the controller.
+func (c *Controller) Stop() {}
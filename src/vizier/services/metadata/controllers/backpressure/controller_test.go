@@ -0,0 +1,146 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package backpressure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/operator/client/versioned/fake"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+type fakeMessenger struct {
+	agents   []*agentpb.Agent
+	sentTo   [][]uuid.UUID
+	messages []*messagespb.BackpressureSignal
+}
+
+func (f *fakeMessenger) GetActiveAgents() ([]*agentpb.Agent, error) {
+	return f.agents, nil
+}
+
+func (f *fakeMessenger) MessageAgents(agentIDs []uuid.UUID, msg []byte) error {
+	vzMsg := &messagespb.VizierMessage{}
+	if err := vzMsg.Unmarshal(msg); err != nil {
+		return err
+	}
+	f.sentTo = append(f.sentTo, agentIDs)
+	f.messages = append(f.messages, vzMsg.GetBackpressureSignal())
+	return nil
+}
+
+func newAgent(id uuid.UUID, collectsData bool) *agentpb.Agent {
+	return &agentpb.Agent{
+		Info: &agentpb.AgentInfo{
+			AgentID:      utils.ProtoFromUUID(id),
+			Capabilities: &agentpb.AgentCapabilities{CollectsData: collectsData},
+		},
+	}
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p := PolicyFromVizier(&v1alpha1.BackpressurePolicy{
+		Enabled:           true,
+		LowPriorityTables: []string{"conn_stats"},
+	})
+
+	signal := p.Evaluate(map[string]float64{PathKelvin: 0.5, PathExport: 0.1})
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_NONE, signal.Action)
+
+	signal = p.Evaluate(map[string]float64{PathKelvin: 0.85, PathExport: 0.9})
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_REDUCE_SAMPLING, signal.Action)
+	assert.Equal(t, 0.5, signal.SamplingRatio)
+	assert.Equal(t, []string{PathExport, PathKelvin}, signal.SaturatedPaths)
+	assert.Empty(t, signal.PausedTables)
+
+	signal = p.Evaluate(map[string]float64{PathKelvin: 0.97})
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_PAUSE_TABLES, signal.Action)
+	assert.Equal(t, []string{"conn_stats"}, signal.PausedTables)
+
+	p.Enabled = false
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_NONE, p.Evaluate(map[string]float64{PathKelvin: 1}).Action)
+}
+
+func TestController_HandleReport(t *testing.T) {
+	pemID := uuid.Must(uuid.NewV4())
+	kelvinID := uuid.Must(uuid.NewV4())
+	messenger := &fakeMessenger{agents: []*agentpb.Agent{newAgent(pemID, true), newAgent(kelvinID, false)}}
+
+	vzClient := fake.NewSimpleClientset(&v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec: v1alpha1.VizierSpec{
+			Backpressure: &v1alpha1.BackpressurePolicy{Enabled: true, SamplingPercent: 25},
+		},
+	})
+	c := NewController(messenger, VizierPolicyGetter(vzClient, "pl"), 30*time.Second)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	// Nothing is sent while the paths are not saturated.
+	require.NoError(t, c.HandleReport(&messagespb.SaturationReport{Path: PathKelvin, Source: "qb-1", Utilization: 0.2}))
+	assert.Empty(t, messenger.messages)
+
+	// Only the PEMs are told to reduce sampling.
+	require.NoError(t, c.HandleReport(&messagespb.SaturationReport{Path: PathKelvin, Source: "qb-2", Utilization: 0.9}))
+	require.Len(t, messenger.messages, 1)
+	assert.Equal(t, []uuid.UUID{pemID}, messenger.sentTo[0])
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_REDUCE_SAMPLING, messenger.messages[0].Action)
+	assert.Equal(t, 0.25, messenger.messages[0].SamplingRatio)
+	assert.Equal(t, (30 * time.Second).Nanoseconds(), messenger.messages[0].TTLNs)
+
+	// The same signal is not resent until it has to be renewed.
+	now = now.Add(5 * time.Second)
+	require.NoError(t, c.HandleReport(&messagespb.SaturationReport{Path: PathKelvin, Source: "qb-2", Utilization: 0.9}))
+	assert.Len(t, messenger.messages, 1)
+	now = now.Add(15 * time.Second)
+	require.NoError(t, c.HandleReport(&messagespb.SaturationReport{Path: PathKelvin, Source: "qb-2", Utilization: 0.9}))
+	assert.Len(t, messenger.messages, 2)
+
+	// The PEMs are told to resume once the path drains.
+	require.NoError(t, c.HandleReport(&messagespb.SaturationReport{Path: PathKelvin, Source: "qb-2", Utilization: 0.1}))
+	require.Len(t, messenger.messages, 3)
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_NONE, messenger.messages[2].Action)
+}
+
+func TestController_ExpiresStaleReports(t *testing.T) {
+	messenger := &fakeMessenger{agents: []*agentpb.Agent{newAgent(uuid.Must(uuid.NewV4()), true)}}
+	policy := &Policy{Enabled: true, ReduceSamplingThreshold: 0.8, SamplingRatio: 0.5, PauseTablesThreshold: 0.95}
+	c := NewController(messenger, func() (*Policy, error) { return policy, nil }, 30*time.Second)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.HandleReport(&messagespb.SaturationReport{Path: PathExport, Source: "qb-1", Utilization: 0.99}))
+	require.Len(t, messenger.messages, 1)
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_REDUCE_SAMPLING, messenger.messages[0].Action)
+
+	// The saturated query broker stopped reporting, so its report no longer counts.
+	now = now.Add(time.Minute)
+	require.NoError(t, c.HandleReport(&messagespb.SaturationReport{Path: PathExport, Source: "qb-2", Utilization: 0.1}))
+	require.Len(t, messenger.messages, 2)
+	assert.Equal(t, messagespb.BACKPRESSURE_ACTION_NONE, messenger.messages[1].Action)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package backpressure
+
+import (
+	"sort"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+)
+
+// The data paths that consume the data of the PEMs.
+const (
+	// PathKelvin is the path from the PEMs through kelvin to the query broker.
+	PathKelvin = "kelvin"
+	// PathExport is the path from the query broker to the result sinks that export query results.
+	PathExport = "export"
+)
+
+// Policy decides which backpressure signal to send to the PEMs, based on how saturated each data path is.
+type Policy struct {
+	// Enabled specifies whether PEMs are sent backpressure signals at all.
+	Enabled bool
+	// ReduceSamplingThreshold is the saturation, from 0 to 1, above which PEMs reduce sampling.
+	ReduceSamplingThreshold float64
+	// SamplingRatio is the fraction of traced events that PEMs keep while sampling is reduced.
+	SamplingRatio float64
+	// PauseTablesThreshold is the saturation, from 0 to 1, above which PEMs also pause LowPriorityTables.
+	PauseTablesThreshold float64
+	// LowPriorityTables are the tables that are paused when a path is nearly full.
+	LowPriorityTables []string
+}
+
+// DefaultPolicy is the policy used when the Vizier does not configure backpressure. It never sends signals.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		ReduceSamplingThreshold: 0.8,
+		SamplingRatio:           0.5,
+		PauseTablesThreshold:    0.95,
+	}
+}
+
+// PolicyFromVizier converts the backpressure policy of the Vizier CRD, filling in the defaults of unset fields.
+func PolicyFromVizier(bp *v1alpha1.BackpressurePolicy) *Policy {
+	p := DefaultPolicy()
+	if bp == nil {
+		return p
+	}
+	p.Enabled = bp.Enabled
+	if bp.ReduceSamplingThresholdPercent > 0 {
+		p.ReduceSamplingThreshold = float64(bp.ReduceSamplingThresholdPercent) / 100
+	}
+	if bp.SamplingPercent > 0 {
+		p.SamplingRatio = float64(bp.SamplingPercent) / 100
+	}
+	if bp.PauseTablesThresholdPercent > 0 {
+		p.PauseTablesThreshold = float64(bp.PauseTablesThresholdPercent) / 100
+	}
+	p.LowPriorityTables = bp.LowPriorityTables
+	return p
+}
+
+// Evaluate returns the signal for the given saturation of each data path.
+func (p *Policy) Evaluate(saturation map[string]float64) *messagespb.BackpressureSignal {
+	signal := &messagespb.BackpressureSignal{Action: messagespb.BACKPRESSURE_ACTION_NONE}
+	if !p.Enabled {
+		return signal
+	}
+
+	var maxSaturation float64
+	for path, s := range saturation {
+		if s < p.ReduceSamplingThreshold {
+			continue
+		}
+		signal.SaturatedPaths = append(signal.SaturatedPaths, path)
+		if s > maxSaturation {
+			maxSaturation = s
+		}
+	}
+	if len(signal.SaturatedPaths) == 0 {
+		return signal
+	}
+	sort.Strings(signal.SaturatedPaths)
+
+	signal.Action = messagespb.BACKPRESSURE_ACTION_REDUCE_SAMPLING
+	signal.SamplingRatio = p.SamplingRatio
+	if maxSaturation >= p.PauseTablesThreshold && len(p.LowPriorityTables) > 0 {
+		signal.Action = messagespb.BACKPRESSURE_ACTION_PAUSE_TABLES
+		signal.PausedTables = p.LowPriorityTables
+	}
+	return signal
+}
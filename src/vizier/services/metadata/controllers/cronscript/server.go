@@ -23,6 +23,8 @@ import (
 	"sync"
 
 	"github.com/gofrs/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/utils"
@@ -115,6 +117,8 @@ func (s *Server) RecordExecutionResult(ctx context.Context, req *metadatapb.Reco
 		ScriptID:  req.GetScriptID(),
 		Timestamp: req.Timestamp,
 		Error:     req.GetError(),
+		BatchID:   req.BatchID,
+		Stage:     req.Stage,
 	}
 	if execStats := req.GetExecutionStats(); execStats != nil {
 		result.ExecutionTimeNs = execStats.ExecutionTimeNs
@@ -141,26 +145,52 @@ func (s *Server) GetAllExecutionResults(ctx context.Context, req *metadatapb.Get
 	}
 
 	for i, res := range results {
-		newResult := &metadatapb.GetAllExecutionResultsResponse_ExecutionResult{
-			ScriptID:  res.ScriptID,
-			Timestamp: res.Timestamp,
-		}
-		if res.Error != nil {
-			newResult.Result = &metadatapb.GetAllExecutionResultsResponse_ExecutionResult_Error{
-				Error: res.Error,
-			}
-		} else {
-			newResult.Result = &metadatapb.GetAllExecutionResultsResponse_ExecutionResult_ExecutionStats{
-				ExecutionStats: &metadatapb.ExecutionStats{
-					ExecutionTimeNs:   res.ExecutionTimeNs,
-					CompilationTimeNs: res.CompilationTimeNs,
-					BytesProcessed:    res.BytesProcessed,
-					RecordsProcessed:  res.RecordsProcessed,
-				},
-			}
+		resp.Results[i] = executionResultFromStore(res)
+	}
+	return resp, nil
+}
+
+// GetExecutionResult looks up the result of a single export batch of a cronscript by its batch ID.
+func (s *Server) GetExecutionResult(ctx context.Context, req *metadatapb.GetExecutionResultRequest) (*metadatapb.GetExecutionResultResponse, error) {
+	batchID := utils.UUIDFromProtoOrNil(req.BatchID)
+	if batchID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "batch ID is required")
+	}
+
+	results, err := s.ds.GetAllCronScriptResults()
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		if utils.UUIDFromProtoOrNil(res.BatchID) == batchID {
+			return &metadatapb.GetExecutionResultResponse{
+				Result: executionResultFromStore(res),
+			}, nil
 		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no result for batch %s", batchID.String())
+}
 
-		resp.Results[i] = newResult
+func executionResultFromStore(res *storepb.CronScriptResult) *metadatapb.GetAllExecutionResultsResponse_ExecutionResult {
+	newResult := &metadatapb.GetAllExecutionResultsResponse_ExecutionResult{
+		ScriptID:  res.ScriptID,
+		Timestamp: res.Timestamp,
+		BatchID:   res.BatchID,
+		Stage:     res.Stage,
 	}
-	return resp, nil
+	if res.Error != nil {
+		newResult.Result = &metadatapb.GetAllExecutionResultsResponse_ExecutionResult_Error{
+			Error: res.Error,
+		}
+	} else {
+		newResult.Result = &metadatapb.GetAllExecutionResultsResponse_ExecutionResult_ExecutionStats{
+			ExecutionStats: &metadatapb.ExecutionStats{
+				ExecutionTimeNs:   res.ExecutionTimeNs,
+				CompilationTimeNs: res.CompilationTimeNs,
+				BytesProcessed:    res.BytesProcessed,
+				RecordsProcessed:  res.RecordsProcessed,
+			},
+		}
+	}
+	return newResult
 }
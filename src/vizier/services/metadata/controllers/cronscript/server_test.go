@@ -26,12 +26,16 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/cronscript"
 	mock_cronscript "px.dev/pixie/src/vizier/services/metadata/controllers/cronscript/mock"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
 )
 
 func TestGetScripts(t *testing.T) {
@@ -137,3 +141,51 @@ func TestSetScripts(t *testing.T) {
 
 	assert.Equal(t, &metadatapb.SetScriptsResponse{}, resp)
 }
+
+func TestGetExecutionResult(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := mock_cronscript.NewMockStore(ctrl)
+
+	scriptID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	r1 := &storepb.CronScriptResult{
+		ScriptID:         scriptID,
+		BatchID:          utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000"),
+		Stage:            storepb.CRON_SCRIPT_EXPORT_STAGE_COMPLETE,
+		RecordsProcessed: 10,
+	}
+	r2 := &storepb.CronScriptResult{
+		ScriptID: scriptID,
+		BatchID:  utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440001"),
+		Stage:    storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY,
+		Error: &statuspb.Status{
+			ErrCode: statuspb.INTERNAL,
+			Msg:     "OTel export (carnot node_id=1) failed with error 'UNAVAILABLE'.",
+		},
+	}
+	mockStore.EXPECT().GetAllCronScriptResults().Return([]*storepb.CronScriptResult{r1, r2}, nil).Times(2)
+
+	s := cronscript.New(mockStore)
+
+	resp, err := s.GetExecutionResult(context.Background(), &metadatapb.GetExecutionResultRequest{
+		BatchID: utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440001"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &metadatapb.GetAllExecutionResultsResponse_ExecutionResult{
+		ScriptID: scriptID,
+		BatchID:  r2.BatchID,
+		Stage:    storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY,
+		Result: &metadatapb.GetAllExecutionResultsResponse_ExecutionResult_Error{
+			Error: r2.Error,
+		},
+	}, resp.Result)
+
+	_, err = s.GetExecutionResult(context.Background(), &metadatapb.GetExecutionResultRequest{
+		BatchID: utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440002"),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = s.GetExecutionResult(context.Background(), &metadatapb.GetExecutionResultRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
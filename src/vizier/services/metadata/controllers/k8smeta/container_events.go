@@ -0,0 +1,125 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package k8smeta
+
+import (
+	"fmt"
+	"time"
+
+	"px.dev/pixie/src/shared/k8s/metadatapb"
+	metadata_servicepb "px.dev/pixie/src/vizier/services/metadata/metadatapb"
+)
+
+const oomKilledReason = "OOMKilled"
+
+// ContainerEventStore handles storing and fetching the state transitions of containers.
+type ContainerEventStore interface {
+	// AddContainerEvents stores the given container events for 24h. Events are keyed by their time, pod and
+	// container, so adding the same event twice only stores it once.
+	AddContainerEvents(events []*metadata_servicepb.ContainerEvent) error
+	// FetchContainerEvents gets all stored container events that happened at or after the given time,
+	// ordered by time.
+	FetchContainerEvents(sinceNS int64) ([]*metadata_servicepb.ContainerEvent, error)
+}
+
+func terminationEventType(reason string, restarted bool) metadata_servicepb.ContainerEvent_EventType {
+	switch {
+	case reason == oomKilledReason:
+		return metadata_servicepb.CONTAINER_EVENT_OOM_KILLED
+	case restarted:
+		return metadata_servicepb.CONTAINER_EVENT_RESTARTED
+	default:
+		return metadata_servicepb.CONTAINER_EVENT_TERMINATED
+	}
+}
+
+// getContainerEvents compares the container statuses of the pod with the statuses from the pod's previous
+// update, and returns the state transitions of its containers. prevStatuses maps the container name to its
+// previous status, and is empty if the pod hasn't been seen before.
+func getContainerEvents(pod *metadatapb.Pod, prevStatuses map[string]*metadatapb.ContainerStatus) []*metadata_servicepb.ContainerEvent {
+	if pod.Status == nil {
+		return nil
+	}
+	podName := fmt.Sprintf("%s/%s", pod.Metadata.Namespace, pod.Metadata.Name)
+
+	var events []*metadata_servicepb.ContainerEvent
+	for _, c := range pod.Status.ContainerStatuses {
+		newEvent := func(t metadata_servicepb.ContainerEvent_EventType, timeNS int64) *metadata_servicepb.ContainerEvent {
+			return &metadata_servicepb.ContainerEvent{
+				TimeNS:        timeNS,
+				Type:          t,
+				PodUID:        pod.Metadata.UID,
+				PodName:       podName,
+				ContainerName: c.Name,
+				ContainerID:   c.ContainerID,
+				RestartCount:  c.RestartCount,
+			}
+		}
+
+		prev := prevStatuses[c.Name]
+		// If this is the first time we see the container, its last termination may or may not have been
+		// recorded already. Events are keyed by their time, so recording it again is harmless.
+		if t := c.LastTermination; t != nil && (prev == nil || c.RestartCount > prev.RestartCount) {
+			e := newEvent(terminationEventType(t.Reason, true), t.StopTimestampNS)
+			e.Reason = t.Reason
+			e.Message = t.Message
+			e.ExitCode = t.ExitCode
+			events = append(events, e)
+		}
+
+		if c.ContainerState == metadatapb.CONTAINER_STATE_TERMINATED &&
+			(prev == nil || prev.ContainerState != metadatapb.CONTAINER_STATE_TERMINATED) {
+			e := newEvent(terminationEventType(c.Reason, false), c.StopTimestampNS)
+			e.Reason = c.Reason
+			e.Message = c.Message
+			e.ExitCode = c.ExitCode
+			events = append(events, e)
+		}
+
+		// The container is still running, but has started failing its readiness probe.
+		if prev != nil && prev.Ready && !c.Ready &&
+			c.ContainerState == metadatapb.CONTAINER_STATE_RUNNING && c.StartTimestampNS == prev.StartTimestampNS {
+			events = append(events, newEvent(metadata_servicepb.CONTAINER_EVENT_NOT_READY, time.Now().UnixNano()))
+		}
+	}
+	return events
+}
+
+// updateContainerStatuses records the container statuses of the pod in the processor state, and returns the
+// container events since the pod's last update.
+func updateContainerStatuses(pod *metadatapb.Pod, state *ProcessorState) []*metadata_servicepb.ContainerEvent {
+	if pod.Metadata == nil {
+		return nil
+	}
+	uid := pod.Metadata.UID
+	events := getContainerEvents(pod, state.ContainerStatuses[uid])
+
+	if pod.Metadata.DeletionTimestampNS != 0 {
+		delete(state.ContainerStatuses, uid)
+		return events
+	}
+	statuses := make(map[string]*metadatapb.ContainerStatus)
+	if pod.Status != nil {
+		for _, c := range pod.Status.ContainerStatuses {
+			statuses[c.Name] = c
+		}
+	}
+	state.ContainerStatuses[uid] = statuses
+	return events
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package k8smeta
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/k8s/metadatapb"
+	metadata_servicepb "px.dev/pixie/src/vizier/services/metadata/metadatapb"
+)
+
+func podWithContainer(c *metadatapb.ContainerStatus) *metadatapb.Pod {
+	return &metadatapb.Pod{
+		Metadata: &metadatapb.ObjectMetadata{
+			Name:      "pod1",
+			Namespace: "pl",
+			UID:       "abcd",
+		},
+		Status: &metadatapb.PodStatus{
+			ContainerStatuses: []*metadatapb.ContainerStatus{c},
+		},
+	}
+}
+
+func TestUpdateContainerStatuses(t *testing.T) {
+	state := &ProcessorState{ContainerStatuses: make(map[string]map[string]*metadatapb.ContainerStatus)}
+
+	running := &metadatapb.ContainerStatus{
+		Name:             "app",
+		ContainerID:      "c1",
+		ContainerState:   metadatapb.CONTAINER_STATE_RUNNING,
+		StartTimestampNS: 5,
+		Ready:            true,
+	}
+	events := updateContainerStatuses(podWithContainer(running), state)
+	assert.Empty(t, events)
+
+	// The container fails its readiness probe.
+	notReady := *running
+	notReady.Ready = false
+	events = updateContainerStatuses(podWithContainer(&notReady), state)
+	require.Len(t, events, 1)
+	assert.Equal(t, metadata_servicepb.CONTAINER_EVENT_NOT_READY, events[0].Type)
+	assert.NotZero(t, events[0].TimeNS)
+	assert.Equal(t, "pl/pod1", events[0].PodName)
+
+	// The container is OOMKilled and restarted.
+	restarted := &metadatapb.ContainerStatus{
+		Name:             "app",
+		ContainerID:      "c2",
+		ContainerState:   metadatapb.CONTAINER_STATE_RUNNING,
+		StartTimestampNS: 20,
+		RestartCount:     1,
+		Ready:            true,
+		LastTermination: &metadatapb.ContainerTermination{
+			ExitCode:         137,
+			Reason:           "OOMKilled",
+			StartTimestampNS: 5,
+			StopTimestampNS:  10,
+		},
+	}
+	events = updateContainerStatuses(podWithContainer(restarted), state)
+	assert.Equal(t, []*metadata_servicepb.ContainerEvent{
+		{
+			TimeNS:        10,
+			Type:          metadata_servicepb.CONTAINER_EVENT_OOM_KILLED,
+			PodUID:        "abcd",
+			PodName:       "pl/pod1",
+			ContainerName: "app",
+			ContainerID:   "c2",
+			Reason:        "OOMKilled",
+			ExitCode:      137,
+			RestartCount:  1,
+		},
+	}, events)
+
+	// Updates without a state transition don't create events.
+	events = updateContainerStatuses(podWithContainer(restarted), state)
+	assert.Empty(t, events)
+
+	// The container exits with an error and isn't restarted.
+	terminated := *restarted
+	terminated.ContainerState = metadatapb.CONTAINER_STATE_TERMINATED
+	terminated.StopTimestampNS = 30
+	terminated.Reason = "Error"
+	terminated.ExitCode = 1
+	terminated.Ready = false
+	events = updateContainerStatuses(podWithContainer(&terminated), state)
+	assert.Equal(t, []*metadata_servicepb.ContainerEvent{
+		{
+			TimeNS:        30,
+			Type:          metadata_servicepb.CONTAINER_EVENT_TERMINATED,
+			PodUID:        "abcd",
+			PodName:       "pl/pod1",
+			ContainerName: "app",
+			ContainerID:   "c2",
+			Reason:        "Error",
+			ExitCode:      1,
+			RestartCount:  1,
+		},
+	}, events)
+
+	// Deleting the pod clears its state.
+	deleted := podWithContainer(&terminated)
+	deleted.Metadata.DeletionTimestampNS = 40
+	events = updateContainerStatuses(deleted, state)
+	assert.Empty(t, events)
+	assert.Empty(t, state.ContainerStatuses)
+}
+
+func TestUpdateContainerStatuses_RestartBeforeFirstUpdate(t *testing.T) {
+	state := &ProcessorState{ContainerStatuses: make(map[string]map[string]*metadatapb.ContainerStatus)}
+
+	// The first update of a pod includes the container's last termination, since it may not have been recorded.
+	events := updateContainerStatuses(podWithContainer(&metadatapb.ContainerStatus{
+		Name:           "app",
+		ContainerState: metadatapb.CONTAINER_STATE_RUNNING,
+		RestartCount:   3,
+		LastTermination: &metadatapb.ContainerTermination{
+			ExitCode:        2,
+			Reason:          "Error",
+			StopTimestampNS: 10,
+		},
+	}), state)
+	require.Len(t, events, 1)
+	assert.Equal(t, metadata_servicepb.CONTAINER_EVENT_RESTARTED, events[0].Type)
+	assert.Equal(t, int64(10), events[0].TimeNS)
+	assert.Equal(t, int32(2), events[0].ExitCode)
+}
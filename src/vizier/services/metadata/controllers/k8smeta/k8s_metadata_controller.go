@@ -53,19 +53,30 @@ func NewController(namespaces []string, updateCh chan *K8sResourceMessage) (*Con
 	if err != nil {
 		return nil, err
 	}
-	return NewControllerWithClientSet(namespaces, updateCh, clientset)
+	resolver, err := NewWorkloadResolver(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewControllerWithResolver(namespaces, updateCh, clientset, resolver)
 }
 
-// NewControllerWithClientSet creates a new Controller using the given Clientset.
+// NewControllerWithClientSet creates a new Controller using the given Clientset. Pod workloads are
+// resolved to the pod's direct owner.
 func NewControllerWithClientSet(namespaces []string, updateCh chan *K8sResourceMessage, clientset kubernetes.Interface) (*Controller, error) {
+	return NewControllerWithResolver(namespaces, updateCh, clientset, nil)
+}
+
+// NewControllerWithResolver creates a new Controller using the given Clientset, which resolves pod
+// workloads with the given resolver.
+func NewControllerWithResolver(namespaces []string, updateCh chan *K8sResourceMessage, clientset kubernetes.Interface, resolver *WorkloadResolver) (*Controller, error) {
 	mc := &Controller{quitCh: make(chan struct{}), updateCh: updateCh}
-	go mc.startWithClientSet(namespaces, clientset)
+	go mc.startWithClientSet(namespaces, clientset, resolver)
 
 	return mc, nil
 }
 
 // startWithClientSet starts the controller
-func (mc *Controller) startWithClientSet(namespaces []string, clientset kubernetes.Interface) {
+func (mc *Controller) startWithClientSet(namespaces []string, clientset kubernetes.Interface, resolver *WorkloadResolver) {
 	factory := informers.NewSharedInformerFactory(clientset, 12*time.Hour)
 
 	// Create a watcher for each resource.
@@ -79,7 +90,7 @@ func (mc *Controller) startWithClientSet(namespaces []string, clientset kubernet
 		namespacedFactories = append(namespacedFactories, factory)
 	}
 
-	startPodWatcher(mc.updateCh, mc.quitCh, namespacedFactories)
+	startPodWatcher(mc.updateCh, mc.quitCh, namespacedFactories, resolver)
 	startEndpointsWatcher(mc.updateCh, mc.quitCh, namespacedFactories)
 	startServiceWatcher(mc.updateCh, mc.quitCh, namespacedFactories)
 	startReplicaSetWatcher(mc.updateCh, mc.quitCh, namespacedFactories)
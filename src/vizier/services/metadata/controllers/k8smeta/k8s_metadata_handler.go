@@ -149,6 +149,8 @@ type ProcessorState struct {
 	NodeToIP map[string]string
 	// A map from pod name to its IP.
 	PodToIP map[string]string
+	// A map from pod UID to the last seen statuses of its containers, keyed by container name.
+	ContainerStatuses map[string]map[string]*metadatapb.ContainerStatus
 }
 
 // Handler handles any incoming k8s updates. It saves the update to the store for persistence, and
@@ -160,6 +162,8 @@ type Handler struct {
 	mds Store
 	// The store where pod label information is stored.
 	pls PodLabelStore
+	// The store where container events are stored.
+	ces ContainerEventStore
 	// The NATS connection on which to send messages on.
 	conn *nats.Conn
 	// Done channel, to stop processing metadata updates.
@@ -173,12 +177,18 @@ type Handler struct {
 }
 
 // NewHandler creates a new Handler.
-func NewHandler(updateCh <-chan *K8sResourceMessage, mds Store, pls PodLabelStore, conn *nats.Conn) *Handler {
+func NewHandler(updateCh <-chan *K8sResourceMessage, mds Store, pls PodLabelStore, ces ContainerEventStore, conn *nats.Conn) *Handler {
 	done := make(chan struct{})
 	leaderMsgs := make(map[string]*metadatapb.Endpoints)
 	handlerMap := make(map[string]UpdateProcessor)
-	state := ProcessorState{LeaderMsgs: leaderMsgs, PodCIDRs: make([]string, 0), NodeToIP: make(map[string]string), PodToIP: make(map[string]string)}
-	mh := &Handler{updateCh: updateCh, mds: mds, pls: pls, conn: conn, done: done, processHandlerMap: handlerMap, state: state}
+	state := ProcessorState{
+		LeaderMsgs:        leaderMsgs,
+		PodCIDRs:          make([]string, 0),
+		NodeToIP:          make(map[string]string),
+		PodToIP:           make(map[string]string),
+		ContainerStatuses: make(map[string]map[string]*metadatapb.ContainerStatus),
+	}
+	mh := &Handler{updateCh: updateCh, mds: mds, pls: pls, ces: ces, conn: conn, done: done, processHandlerMap: handlerMap, state: state}
 
 	// Register update processors.
 	mh.processHandlerMap["endpoints"] = &EndpointsUpdateProcessor{}
@@ -246,6 +256,13 @@ func (m *Handler) processUpdates() {
 				if err != nil {
 					log.WithError(err).Error("Failed to update pod labels state")
 				}
+				events := updateContainerStatuses(update.GetPod(), &m.state)
+				if len(events) > 0 {
+					err = m.ces.AddContainerEvents(events)
+					if err != nil {
+						log.WithError(err).Error("Failed to store container events")
+					}
+				}
 			}
 
 			// Persist the update in the data store.
@@ -1131,6 +1148,7 @@ func getResourceUpdateFromPod(pod *metadatapb.Pod, uv int64) *metadatapb.Resourc
 				Message:          pod.Status.Message,
 				Reason:           pod.Status.Reason,
 				OwnerReferences:  pod.Metadata.OwnerReferences,
+				Workload:         pod.Workload,
 			},
 		},
 	}
@@ -22,12 +22,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"path"
 	"strconv"
 	"strings"
 
 	"github.com/gogo/protobuf/proto"
 
+	metadata_servicepb "px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/utils/datastore"
 )
@@ -38,6 +40,7 @@ const (
 	topicVersionPrefix        = "/topicVersion"
 	labelPodUpdatePrefix      = "/labelPodUpdate" // labelPodUpdatePrefix/<namespace>/<labelKey>/<podName> -> <labelValue>
 	podLabelUpdatePrefix      = "/podLabelUpdate" // podLabelUpdatePrefix/<namespace>/<podName> -> [<labelKeys>]
+	containerEventPrefix      = "/containerEvent" // containerEventPrefix/<timeNS>/<podUID>/<containerName> -> <event>
 	// The topic for partial resource updates, which are not specific to a particular node.
 	unscopedTopic = "unscoped"
 )
@@ -79,6 +82,14 @@ func getNSPodUpdateKey(namespace string, podName string) string {
 	return path.Join(podLabelUpdatePrefix, namespace, podName)
 }
 
+func getContainerEventTimeKey(timeNS int64) string {
+	return path.Join(containerEventPrefix, fmt.Sprintf("%020d", timeNS))
+}
+
+func getContainerEventKey(e *metadata_servicepb.ContainerEvent) string {
+	return path.Join(getContainerEventTimeKey(e.TimeNS), e.PodUID, e.ContainerName)
+}
+
 func labelPodUpdateKeyToPodName(updateKey string) string {
 	keys := strings.Split(updateKey, "/")
 	return keys[len(keys)-1]
@@ -366,3 +377,36 @@ func (m *Datastore) FetchPodsWithLabels(namespace string, labels map[string]stri
 func (m *Datastore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
 	return m.ds.GetWithPrefix(prefix)
 }
+
+// AddContainerEvents stores the given container events for 24h.
+func (m *Datastore) AddContainerEvents(events []*metadata_servicepb.ContainerEvent) error {
+	for _, e := range events {
+		val, err := e.Marshal()
+		if err != nil {
+			return err
+		}
+		err = m.ds.SetWithTTL(getContainerEventKey(e), string(val), resourceUpdateTTL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchContainerEvents gets all container events that happened at or after the given time.
+func (m *Datastore) FetchContainerEvents(sinceNS int64) ([]*metadata_servicepb.ContainerEvent, error) {
+	_, vals, err := m.ds.GetWithRange(getContainerEventTimeKey(sinceNS), getContainerEventTimeKey(math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*metadata_servicepb.ContainerEvent, 0, len(vals))
+	for _, val := range vals {
+		e := &metadata_servicepb.ContainerEvent{}
+		if err := proto.Unmarshal(val, e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"px.dev/pixie/src/shared/k8s/metadatapb"
+	metadata_servicepb "px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
 )
@@ -443,3 +444,43 @@ func TestDataStore_FetchPodsWithLabels(t *testing.T) {
 	require.NoError(t, err)
 	assert.ElementsMatch(t, []string{"pod1", "pod2", "pod3"}, pods)
 }
+
+func TestDatastore_ContainerEvents(t *testing.T) {
+	_, mds, cleanup := setupMDSTest(t)
+	defer cleanup()
+
+	oom := &metadata_servicepb.ContainerEvent{
+		TimeNS:        10,
+		Type:          metadata_servicepb.CONTAINER_EVENT_OOM_KILLED,
+		PodUID:        "abcd",
+		PodName:       "pl/pod1",
+		ContainerName: "app",
+		Reason:        "OOMKilled",
+		ExitCode:      137,
+		RestartCount:  1,
+	}
+	notReady := &metadata_servicepb.ContainerEvent{
+		TimeNS:        20,
+		Type:          metadata_servicepb.CONTAINER_EVENT_NOT_READY,
+		PodUID:        "efgh",
+		PodName:       "pl/pod2",
+		ContainerName: "app",
+	}
+	err := mds.AddContainerEvents([]*metadata_servicepb.ContainerEvent{notReady, oom})
+	require.NoError(t, err)
+	// Adding the same event again doesn't duplicate it.
+	err = mds.AddContainerEvents([]*metadata_servicepb.ContainerEvent{oom})
+	require.NoError(t, err)
+
+	events, err := mds.FetchContainerEvents(0)
+	require.NoError(t, err)
+	assert.Equal(t, []*metadata_servicepb.ContainerEvent{oom, notReady}, events)
+
+	events, err = mds.FetchContainerEvents(11)
+	require.NoError(t, err)
+	assert.Equal(t, []*metadata_servicepb.ContainerEvent{notReady}, events)
+
+	events, err = mds.FetchContainerEvents(21)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
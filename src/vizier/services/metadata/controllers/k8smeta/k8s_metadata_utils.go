@@ -89,7 +89,8 @@ func startNamespaceWatcher(ch chan *K8sResourceMessage, quitCh <-chan struct{},
 	go inf.Run(quitCh)
 }
 
-func startPodWatcher(ch chan *K8sResourceMessage, quitCh <-chan struct{}, factories []informers.SharedInformerFactory) {
+func startPodWatcher(ch chan *K8sResourceMessage, quitCh <-chan struct{}, factories []informers.SharedInformerFactory, resolver *WorkloadResolver) {
+	podConverter := podConverterWithResolver(resolver)
 	for _, factory := range factories {
 		pods := factory.Core().V1().Pods()
 
@@ -149,14 +150,19 @@ func startDeploymentWatcher(ch chan *K8sResourceMessage, quitCh <-chan struct{},
 	}
 }
 
-func podConverter(obj interface{}) *K8sResourceMessage {
-	return &K8sResourceMessage{
-		ObjectType: "pods",
-		Object: &storepb.K8SResource{
-			Resource: &storepb.K8SResource_Pod{
-				Pod: k8s.PodToProto(obj.(*v1.Pod)),
+func podConverterWithResolver(resolver *WorkloadResolver) func(obj interface{}) *K8sResourceMessage {
+	return func(obj interface{}) *K8sResourceMessage {
+		pod := obj.(*v1.Pod)
+		pb := k8s.PodToProto(pod)
+		pb.Workload = resolver.Resolve(pod.Namespace, pod.OwnerReferences)
+		return &K8sResourceMessage{
+			ObjectType: "pods",
+			Object: &storepb.K8SResource{
+				Resource: &storepb.K8SResource_Pod{
+					Pod: pb,
+				},
 			},
-		},
+		}
 	}
 }
 
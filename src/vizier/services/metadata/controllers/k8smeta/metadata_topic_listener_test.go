@@ -29,6 +29,7 @@ import (
 
 	"px.dev/pixie/src/shared/k8s/metadatapb"
 	"px.dev/pixie/src/vizier/messages/messagespb"
+	metadata_servicepb "px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
 )
 
@@ -99,6 +100,14 @@ func (s *FakeStore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
 	return nil, nil, nil
 }
 
+func (s *FakeStore) AddContainerEvents(events []*metadata_servicepb.ContainerEvent) error {
+	return nil
+}
+
+func (s *FakeStore) FetchContainerEvents(sinceNS int64) ([]*metadata_servicepb.ContainerEvent, error) {
+	return nil, nil
+}
+
 func TestMetadataTopicListener_GetUpdatesInBatches(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -136,7 +145,7 @@ func TestMetadataTopicListener_GetUpdatesInBatches(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mds := &FakeStore{}
 			updateCh := make(chan *K8sResourceMessage)
-			mdh := NewHandler(updateCh, mds, mds, nil)
+			mdh := NewHandler(updateCh, mds, mds, mds, nil)
 			mdTL, err := NewMetadataTopicListener(mdh, func(topic string, b []byte) error {
 				return nil
 			})
@@ -176,7 +185,7 @@ func TestMetadataTopicListener_GetUpdatesInBatches(t *testing.T) {
 func TestMetadataTopicListener_ProcessAgentMessage(t *testing.T) {
 	mds := &FakeStore{}
 	updateCh := make(chan *K8sResourceMessage)
-	mdh := NewHandler(updateCh, mds, mds, nil)
+	mdh := NewHandler(updateCh, mds, mds, mds, nil)
 
 	sentUpdates := make([]*messagespb.VizierMessage, 0)
 	mdTL, err := NewMetadataTopicListener(mdh, func(topic string, b []byte) error {
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package k8smeta
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+
+	"px.dev/pixie/src/shared/k8s"
+	"px.dev/pixie/src/shared/k8s/metadatapb"
+)
+
+const (
+	// maxOwnerDepth bounds how many owners are followed when resolving a workload, in case of cycles
+	// or unexpectedly deep ownership chains.
+	maxOwnerDepth = 10
+	// ownerCacheTTL is how long the owner references of a resolved owner are cached.
+	ownerCacheTTL = 10 * time.Minute
+	// ownerLookupTimeout is the timeout for fetching a single owner from the K8s API.
+	ownerLookupTimeout = 5 * time.Second
+)
+
+type cachedOwners struct {
+	refs      []metav1.OwnerReference
+	expiresAt time.Time
+}
+
+// WorkloadResolver resolves the top-level workload that manages a pod, by following owner references
+// until it reaches an object that has no owner. Owners are fetched through the K8s metadata API, so
+// owners of any kind can be followed, including custom resources. If an owner cannot be fetched, for
+// example because the metadata service is not allowed to read it, that owner is treated as the workload.
+type WorkloadResolver struct {
+	client metadata.Interface
+	mapper meta.RESTMapper
+
+	mu    sync.Mutex
+	cache map[types.UID]*cachedOwners
+}
+
+// NewWorkloadResolver creates a WorkloadResolver which fetches owners using the given config.
+func NewWorkloadResolver(kubeConfig *rest.Config) (*WorkloadResolver, error) {
+	client, err := metadata.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	return NewWorkloadResolverWithClient(client, mapper), nil
+}
+
+// NewWorkloadResolverWithClient creates a WorkloadResolver using the given metadata client and mapper.
+func NewWorkloadResolverWithClient(client metadata.Interface, mapper meta.RESTMapper) *WorkloadResolver {
+	return &WorkloadResolver{
+		client: client,
+		mapper: mapper,
+		cache:  make(map[types.UID]*cachedOwners),
+	}
+}
+
+// Resolve returns the top-level workload for an object in the given namespace with the given owner
+// references. Returns nil if the object has no owners. A nil resolver returns the object's direct owner.
+func (r *WorkloadResolver) Resolve(namespace string, refs []metav1.OwnerReference) *metadatapb.OwnerReference {
+	ref := controllerRef(refs)
+	if ref == nil {
+		return nil
+	}
+	if r == nil {
+		return k8s.OwnerReferenceToProto(ref)
+	}
+
+	visited := make(map[types.UID]bool)
+	for depth := 0; depth < maxOwnerDepth && !visited[ref.UID]; depth++ {
+		visited[ref.UID] = true
+		owners, err := r.ownerReferences(namespace, ref)
+		if err != nil {
+			log.WithError(err).WithField("kind", ref.Kind).WithField("name", ref.Name).
+				Debug("Could not fetch owner, using it as the workload")
+			break
+		}
+		next := controllerRef(owners)
+		if next == nil {
+			break
+		}
+		ref = next
+	}
+	return k8s.OwnerReferenceToProto(ref)
+}
+
+// ownerReferences returns the owner references of the given owner, fetching them from the K8s API if
+// they are not cached.
+func (r *WorkloadResolver) ownerReferences(namespace string, ref *metav1.OwnerReference) ([]metav1.OwnerReference, error) {
+	now := time.Now()
+	r.mu.Lock()
+	if c, ok := r.cache[ref.UID]; ok && now.Before(c.expiresAt) {
+		r.mu.Unlock()
+		return c.refs, nil
+	}
+	r.mu.Unlock()
+
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := r.mapper.RESTMapping(gv.WithKind(ref.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ownerLookupTimeout)
+	defer cancel()
+
+	var obj *metav1.PartialObjectMetadata
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		obj, err = r.client.Resource(mapping.Resource).Get(ctx, ref.Name, metav1.GetOptions{})
+	} else {
+		obj, err = r.client.Resource(mapping.Resource).Namespace(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The name may have been reused by a different object since the reference was created.
+	if obj.UID != ref.UID {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uid, c := range r.cache {
+		if now.After(c.expiresAt) {
+			delete(r.cache, uid)
+		}
+	}
+	r.cache[ref.UID] = &cachedOwners{refs: obj.OwnerReferences, expiresAt: now.Add(ownerCacheTTL)}
+	return obj.OwnerReferences, nil
+}
+
+// controllerRef returns the owner reference which is the managing controller. If none of the owners
+// are marked as the controller, the first owner is returned.
+func controllerRef(refs []metav1.OwnerReference) *metav1.OwnerReference {
+	if len(refs) == 0 {
+		return nil
+	}
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller {
+			return &refs[i]
+		}
+	}
+	return &refs[0]
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package k8smeta
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	metadatafake "k8s.io/client-go/metadata/fake"
+
+	"px.dev/pixie/src/shared/k8s/metadatapb"
+)
+
+func ownerRef(apiVersion, kind, name, uid string) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		UID:        types.UID(uid),
+		Controller: &controller,
+	}
+}
+
+func ownerObject(apiVersion, kind, name, uid string, owners ...metav1.OwnerReference) runtime.Object {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: apiVersion, Kind: kind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "ns",
+			UID:             types.UID(uid),
+			OwnerReferences: owners,
+		},
+	}
+}
+
+func newTestWorkloadResolver(objs ...runtime.Object) *WorkloadResolver {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "ReplicaSet"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+		{Group: "batch", Version: "v1", Kind: "Job"},
+		{Group: "batch", Version: "v1", Kind: "CronJob"},
+		{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	scheme := metadatafake.NewTestScheme()
+	_ = metav1.AddMetaToScheme(scheme)
+	return NewWorkloadResolverWithClient(metadatafake.NewSimpleMetadataClient(scheme, objs...), mapper)
+}
+
+func TestWorkloadResolver_Resolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		objs     []runtime.Object
+		refs     []metav1.OwnerReference
+		expected *metadatapb.OwnerReference
+	}{
+		{
+			name:     "no owners",
+			expected: nil,
+		},
+		{
+			name: "deployment",
+			objs: []runtime.Object{
+				ownerObject("apps/v1", "ReplicaSet", "rs", "rs-uid", ownerRef("apps/v1", "Deployment", "dep", "dep-uid")),
+				ownerObject("apps/v1", "Deployment", "dep", "dep-uid"),
+			},
+			refs: []metav1.OwnerReference{ownerRef("apps/v1", "ReplicaSet", "rs", "rs-uid")},
+			expected: &metadatapb.OwnerReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "dep",
+				UID:        "dep-uid",
+				Controller: true,
+			},
+		},
+		{
+			name: "statefulset",
+			objs: []runtime.Object{
+				ownerObject("apps/v1", "StatefulSet", "sts", "sts-uid"),
+			},
+			refs: []metav1.OwnerReference{ownerRef("apps/v1", "StatefulSet", "sts", "sts-uid")},
+			expected: &metadatapb.OwnerReference{
+				APIVersion: "apps/v1",
+				Kind:       "StatefulSet",
+				Name:       "sts",
+				UID:        "sts-uid",
+				Controller: true,
+			},
+		},
+		{
+			name: "cronjob",
+			objs: []runtime.Object{
+				ownerObject("batch/v1", "Job", "job-123", "job-uid", ownerRef("batch/v1", "CronJob", "job", "cj-uid")),
+				ownerObject("batch/v1", "CronJob", "job", "cj-uid"),
+			},
+			refs: []metav1.OwnerReference{ownerRef("batch/v1", "Job", "job-123", "job-uid")},
+			expected: &metadatapb.OwnerReference{
+				APIVersion: "batch/v1",
+				Kind:       "CronJob",
+				Name:       "job",
+				UID:        "cj-uid",
+				Controller: true,
+			},
+		},
+		{
+			name: "custom resource",
+			objs: []runtime.Object{
+				ownerObject("apps/v1", "ReplicaSet", "rs", "rs-uid", ownerRef("argoproj.io/v1alpha1", "Rollout", "rollout", "rollout-uid")),
+				ownerObject("argoproj.io/v1alpha1", "Rollout", "rollout", "rollout-uid"),
+			},
+			refs: []metav1.OwnerReference{ownerRef("apps/v1", "ReplicaSet", "rs", "rs-uid")},
+			expected: &metadatapb.OwnerReference{
+				APIVersion: "argoproj.io/v1alpha1",
+				Kind:       "Rollout",
+				Name:       "rollout",
+				UID:        "rollout-uid",
+				Controller: true,
+			},
+		},
+		{
+			name: "unknown kind",
+			objs: []runtime.Object{
+				ownerObject("apps/v1", "ReplicaSet", "rs", "rs-uid", ownerRef("example.com/v1", "Widget", "widget", "widget-uid")),
+			},
+			refs: []metav1.OwnerReference{ownerRef("apps/v1", "ReplicaSet", "rs", "rs-uid")},
+			expected: &metadatapb.OwnerReference{
+				APIVersion: "example.com/v1",
+				Kind:       "Widget",
+				Name:       "widget",
+				UID:        "widget-uid",
+				Controller: true,
+			},
+		},
+		{
+			name: "missing owner",
+			refs: []metav1.OwnerReference{ownerRef("apps/v1", "ReplicaSet", "rs", "rs-uid")},
+			expected: &metadatapb.OwnerReference{
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       "rs",
+				UID:        "rs-uid",
+				Controller: true,
+			},
+		},
+		{
+			name: "prefers controller",
+			objs: []runtime.Object{
+				ownerObject("apps/v1", "StatefulSet", "sts", "sts-uid"),
+			},
+			refs: []metav1.OwnerReference{
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "cm", UID: "cm-uid"},
+				ownerRef("apps/v1", "StatefulSet", "sts", "sts-uid"),
+			},
+			expected: &metadatapb.OwnerReference{
+				APIVersion: "apps/v1",
+				Kind:       "StatefulSet",
+				Name:       "sts",
+				UID:        "sts-uid",
+				Controller: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestWorkloadResolver(test.objs...)
+			assert.Equal(t, test.expected, r.Resolve("ns", test.refs))
+		})
+	}
+}
+
+func TestWorkloadResolver_NilResolver(t *testing.T) {
+	var r *WorkloadResolver
+	workload := r.Resolve("ns", []metav1.OwnerReference{ownerRef("apps/v1", "ReplicaSet", "rs", "rs-uid")})
+	assert.Equal(t, &metadatapb.OwnerReference{
+		APIVersion: "apps/v1",
+		Kind:       "ReplicaSet",
+		Name:       "rs",
+		UID:        "rs-uid",
+		Controller: true,
+	}, workload)
+}
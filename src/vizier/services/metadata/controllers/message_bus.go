@@ -22,9 +22,15 @@ import (
 	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 
+	"px.dev/pixie/src/vizier/services/metadata/controllers/actions"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/backfill"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/backpressure"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/k8smeta"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/protocoltracer"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/querystats"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
+	"px.dev/pixie/src/vizier/utils/messagebus"
 )
 
 const updateAgentTopic = "UpdateAgent"
@@ -51,9 +57,14 @@ type MessageBusController struct {
 }
 
 // NewMessageBusController creates a new controller for handling NATS messages.
+// actionExecutor, bpController, bfController, qsController and ptController may be nil, in which case action
+// requests, saturation reports, backfill requests, query stats and protocol tracer acks are not handled.
+// Action requests are only executed if they were signed with actionSigningKey.
 func NewMessageBusController(conn *nats.Conn, agtMgr agent.Manager,
 	tpMgr *tracepoint.Manager, k8smetaHandler *k8smeta.Handler,
-	isLeader *bool) (*MessageBusController, error) {
+	actionExecutor *actions.Executor, actionSigningKey string, bpController *backpressure.Controller,
+	bfController *backfill.Controller, qsController *querystats.Controller,
+	ptController *protocoltracer.Controller, isLeader *bool) (*MessageBusController, error) {
 	ch := make(chan *nats.Msg, 8192)
 	listeners := make(map[string]TopicListener)
 	subscriptions := make([]*nats.Subscription, 0)
@@ -66,7 +77,8 @@ func NewMessageBusController(conn *nats.Conn, agtMgr agent.Manager,
 		subscriptions: subscriptions,
 	}
 
-	err := mc.registerListeners(agtMgr, tpMgr, k8smetaHandler)
+	err := mc.registerListeners(agtMgr, tpMgr, k8smetaHandler, actionExecutor, actionSigningKey, bpController, bfController,
+		qsController, ptController)
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +121,9 @@ func (mc *MessageBusController) handleMessages() {
 	}
 }
 
-func (mc *MessageBusController) registerListeners(agtMgr agent.Manager, tpMgr *tracepoint.Manager, k8smetaHandler *k8smeta.Handler) error {
+func (mc *MessageBusController) registerListeners(agtMgr agent.Manager, tpMgr *tracepoint.Manager, k8smetaHandler *k8smeta.Handler,
+	actionExecutor *actions.Executor, actionSigningKey string, bpController *backpressure.Controller,
+	bfController *backfill.Controller, qsController *querystats.Controller, ptController *protocoltracer.Controller) error {
 	// Register AgentTopicListener.
 	atl, err := NewAgentTopicListener(agtMgr, tpMgr, mc.sendMessage)
 	if err != nil {
@@ -134,6 +148,46 @@ func (mc *MessageBusController) registerListeners(agtMgr agent.Manager, tpMgr *t
 		return err
 	}
 
+	// Register the action listener, if actions are enabled.
+	if actionExecutor != nil {
+		err = mc.registerListener(actions.RequestTopic, actions.NewTopicListener(actionExecutor, actionSigningKey, mc.sendMessage))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Register the backpressure controller, which listens to the saturation reports of the query brokers.
+	if bpController != nil {
+		err = mc.registerListener(messagebus.SaturationReportTopic, bpController)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Register the backfill controller, which listens to the backfill requests and statuses of the PEMs.
+	if bfController != nil {
+		err = mc.registerListener(messagebus.BackfillTopic, bfController)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Register the query stats controller, which listens to the stats of the queries that the query brokers ran.
+	if qsController != nil {
+		err = mc.registerListener(messagebus.QueryStatsTopic, qsController)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Register the protocol tracer controller, which listens to the PEMs' acks of protocol tracer updates.
+	if ptController != nil {
+		err = mc.registerListener(messagebus.ProtocolTracerTopic, ptController)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
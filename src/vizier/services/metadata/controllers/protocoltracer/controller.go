@@ -0,0 +1,377 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package protocoltracer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/client/versioned"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+	"px.dev/pixie/src/vizier/utils/protocoltracers"
+)
+
+const (
+	// configRefreshInterval is how often the protocol tracers of the Vizier CRD are refetched.
+	configRefreshInterval = 30 * time.Second
+	// syncInterval is how often the controller checks for PEMs that haven't acknowledged the current protocols,
+	// such as newly registered PEMs.
+	syncInterval = 10 * time.Second
+	// resendInterval is how long a PEM has to acknowledge an update, before it is sent again.
+	resendInterval = 30 * time.Second
+)
+
+// AgentMessenger sends messages to the agents.
+type AgentMessenger interface {
+	GetActiveAgents() ([]*agentpb.Agent, error)
+	MessageAgents(agentIDs []uuid.UUID, msg []byte) error
+}
+
+// OverrideStore persists the protocol tracers that were set at runtime.
+type OverrideStore interface {
+	GetOverrides() (map[string]bool, error)
+	SetOverrides(protocols map[string]bool) error
+}
+
+// ConfigGetter returns the protocol tracers that are configured for the Vizier.
+type ConfigGetter func() (map[string]bool, error)
+
+// VizierConfigGetter reads the protocol tracers from the Vizier CRD in the given namespace. If there is no Vizier
+// CRD, because Vizier was deployed without the operator, no protocol tracers are configured.
+func VizierConfigGetter(vzClient versioned.Interface, namespace string) ConfigGetter {
+	return func() (map[string]bool, error) {
+		viziers, err := vzClient.PxV1alpha1().Viziers(namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if len(viziers.Items) == 0 {
+			return map[string]bool{}, nil
+		}
+		return viziers.Items[0].Spec.ProtocolTracers, nil
+	}
+}
+
+type agentTracers struct {
+	hostname string
+	sentAt   time.Time
+	// The protocols that the PEM last acknowledged, or nil if it never did.
+	acked   map[string]bool
+	ackErr  string
+	ackedAt time.Time
+}
+
+func (a *agentTracers) acknowledged(protocols map[string]bool) bool {
+	return a.acked != nil && sameProtocols(a.acked, protocols)
+}
+
+func sameProtocols(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, enabled := range a {
+		if other, ok := b[p]; !ok || other != enabled {
+			return false
+		}
+	}
+	return true
+}
+
+func copyProtocols(protocols map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(protocols))
+	for p, enabled := range protocols {
+		c[p] = enabled
+	}
+	return c
+}
+
+// Controller enables and disables the protocol tracers of the PEMs at runtime. The protocols that the PEMs trace
+// are configured in the Vizier CRD, and can be overridden with SetProtocolTracers. The controller sends the
+// protocols to every PEM, and sends them again until the PEM acknowledges them.
+type Controller struct {
+	agents    AgentMessenger
+	store     OverrideStore
+	getConfig ConfigGetter
+	now       func() time.Time
+
+	quitCh chan struct{}
+	once   sync.Once
+
+	mu              sync.Mutex
+	config          map[string]bool
+	configFetchedAt time.Time
+	overrides       map[string]bool
+	agentTracers    map[uuid.UUID]*agentTracers
+}
+
+// NewController creates a new protocol tracer controller, with the overrides that were previously set.
+func NewController(agents AgentMessenger, store OverrideStore, getConfig ConfigGetter) (*Controller, error) {
+	overrides, err := store.GetOverrides()
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{
+		agents:       agents,
+		store:        store,
+		getConfig:    getConfig,
+		now:          time.Now,
+		quitCh:       make(chan struct{}),
+		overrides:    overrides,
+		agentTracers: make(map[uuid.UUID]*agentTracers),
+	}, nil
+}
+
+// Start periodically sends the protocols to the PEMs that haven't acknowledged them.
+func (c *Controller) Start() {
+	go func() {
+		t := time.NewTicker(syncInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-c.quitCh:
+				return
+			case <-t.C:
+				c.mu.Lock()
+				c.sync(c.now())
+				c.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// Initialize handles any setup that needs to be done.
+func (c *Controller) Initialize() error {
+	return nil
+}
+
+// HandleMessage handles an acknowledgment from a PEM.
+func (c *Controller) HandleMessage(msg *nats.Msg) error {
+	ack := &messagespb.ProtocolTracerAck{}
+	if err := ack.Unmarshal(msg.Data); err != nil {
+		return err
+	}
+	c.HandleAck(ack)
+	return nil
+}
+
+// HandleAck records that a PEM applied the protocols in the acknowledgment.
+func (c *Controller) HandleAck(ack *messagespb.ProtocolTracerAck) {
+	agentID, err := utils.UUIDFromProto(ack.AgentID)
+	if err != nil {
+		log.WithError(err).Error("Received protocol tracer ack with invalid agent ID")
+		return
+	}
+	if ack.Error != "" {
+		log.WithField("agent", agentID).WithField("error", ack.Error).Warn("PEM failed to apply protocol tracers")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	a, ok := c.agentTracers[agentID]
+	if !ok {
+		a = &agentTracers{}
+		c.agentTracers[agentID] = a
+	}
+	a.acked = copyProtocols(ack.Protocols)
+	a.ackErr = ack.Error
+	a.ackedAt = c.now()
+}
+
+// protocols returns whether the PEMs should trace each protocol, from the Vizier CRD and the overrides. Must be
+// called with the lock held.
+func (c *Controller) protocols(now time.Time) map[string]bool {
+	if c.config == nil || now.Sub(c.configFetchedAt) >= configRefreshInterval {
+		config, err := c.getConfig()
+		if err != nil {
+			log.WithError(err).Error("Failed to get protocol tracer config")
+		} else {
+			c.config = copyProtocols(config)
+			c.configFetchedAt = now
+		}
+	}
+
+	protocols := make(map[string]bool)
+	for p, enabled := range c.config {
+		if !protocoltracers.IsKnown(p) {
+			continue
+		}
+		protocols[p] = enabled
+	}
+	for p, enabled := range c.overrides {
+		protocols[p] = enabled
+	}
+	return protocols
+}
+
+// sync sends the protocols to the PEMs that haven't acknowledged them, and forgets the PEMs that went away. Must
+// be called with the lock held.
+func (c *Controller) sync(now time.Time) {
+	protocols := c.protocols(now)
+
+	agents, err := c.agents.GetActiveAgents()
+	if err != nil {
+		log.WithError(err).Error("Failed to get active agents for protocol tracers")
+		return
+	}
+	active := make(map[uuid.UUID]bool)
+	var pending []uuid.UUID
+	for _, agent := range agents {
+		if !agent.Info.GetCapabilities().GetCollectsData() {
+			continue
+		}
+		agentID := utils.UUIDFromProtoOrNil(agent.Info.AgentID)
+		active[agentID] = true
+
+		a, ok := c.agentTracers[agentID]
+		if !ok {
+			a = &agentTracers{}
+			c.agentTracers[agentID] = a
+		}
+		a.hostname = agent.Info.HostInfo.GetHostname()
+		// A PEM that never acknowledged an update is sent the protocols even if none are configured, since it may
+		// have been sent protocols before the metadata service restarted.
+		if a.acknowledged(protocols) || now.Sub(a.sentAt) < resendInterval {
+			continue
+		}
+		pending = append(pending, agentID)
+	}
+	for agentID := range c.agentTracers {
+		if !active[agentID] {
+			delete(c.agentTracers, agentID)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	msg := &messagespb.VizierMessage{
+		Msg: &messagespb.VizierMessage_ProtocolTracerUpdate{
+			ProtocolTracerUpdate: &messagespb.ProtocolTracerUpdate{Protocols: protocols},
+		},
+	}
+	b, err := msg.Marshal()
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal protocol tracer update")
+		return
+	}
+	if err := c.agents.MessageAgents(pending, b); err != nil {
+		log.WithError(err).Error("Failed to send protocol tracer update")
+		return
+	}
+	for _, agentID := range pending {
+		c.agentTracers[agentID].sentAt = now
+	}
+}
+
+// SetProtocolTracers overrides whether the PEMs trace the given protocols, and sends the change to the PEMs.
+func (c *Controller) SetProtocolTracers(ctx context.Context, req *metadatapb.SetProtocolTracersRequest) (*metadatapb.SetProtocolTracersResponse, error) {
+	for p, mode := range req.Protocols {
+		if !protocoltracers.IsKnown(p) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown protocol %q", p)
+		}
+		if _, ok := metadatapb.ProtocolTracerMode_name[int32(mode)]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid mode for protocol %q", p)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	overrides := copyProtocols(c.overrides)
+	for p, mode := range req.Protocols {
+		switch mode {
+		case metadatapb.PROTOCOL_TRACER_MODE_ENABLED:
+			overrides[p] = true
+		case metadatapb.PROTOCOL_TRACER_MODE_DISABLED:
+			overrides[p] = false
+		default:
+			delete(overrides, p)
+		}
+	}
+	if err := c.store.SetOverrides(overrides); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to save protocol tracers: %s", err.Error())
+	}
+	c.overrides = overrides
+
+	// Send the change to all of the PEMs right away, instead of waiting for the next sync.
+	for _, a := range c.agentTracers {
+		a.sentAt = time.Time{}
+	}
+	c.sync(c.now())
+	return &metadatapb.SetProtocolTracersResponse{}, nil
+}
+
+// GetProtocolTracerStatus returns the protocols that the PEMs should trace, and which PEMs acknowledged them.
+func (c *Controller) GetProtocolTracerStatus(ctx context.Context, req *metadatapb.GetProtocolTracerStatusRequest) (*metadatapb.GetProtocolTracerStatusResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	protocols := c.protocols(c.now())
+	resp := &metadatapb.GetProtocolTracerStatusResponse{
+		Protocols: protocols,
+		Overrides: copyProtocols(c.overrides),
+	}
+
+	ids := make([]uuid.UUID, 0, len(c.agentTracers))
+	for id := range c.agentTracers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		hi, hj := c.agentTracers[ids[i]].hostname, c.agentTracers[ids[j]].hostname
+		if hi != hj {
+			return hi < hj
+		}
+		return ids[i].String() < ids[j].String()
+	})
+	for _, id := range ids {
+		a := c.agentTracers[id]
+		agentStatus := &metadatapb.GetProtocolTracerStatusResponse_AgentProtocolTracerStatus{
+			AgentID:      utils.ProtoFromUUID(id),
+			Hostname:     a.hostname,
+			Acknowledged: a.acknowledged(protocols),
+			Protocols:    copyProtocols(a.acked),
+			Error:        a.ackErr,
+		}
+		if a.acked != nil {
+			agentStatus.AcknowledgedAt, _ = types.TimestampProto(a.ackedAt)
+		}
+		resp.Agents = append(resp.Agents, agentStatus)
+	}
+	return resp, nil
+}
+
+// Stop stops the controller.
+func (c *Controller) Stop() {
+	c.once.Do(func() {
+		close(c.quitCh)
+	})
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package protocoltracer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/operator/client/versioned/fake"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+type fakeMessenger struct {
+	agents   []*agentpb.Agent
+	sentTo   [][]uuid.UUID
+	messages []*messagespb.ProtocolTracerUpdate
+}
+
+func (f *fakeMessenger) GetActiveAgents() ([]*agentpb.Agent, error) {
+	return f.agents, nil
+}
+
+func (f *fakeMessenger) MessageAgents(agentIDs []uuid.UUID, msg []byte) error {
+	vzMsg := &messagespb.VizierMessage{}
+	if err := vzMsg.Unmarshal(msg); err != nil {
+		return err
+	}
+	f.sentTo = append(f.sentTo, agentIDs)
+	f.messages = append(f.messages, vzMsg.GetProtocolTracerUpdate())
+	return nil
+}
+
+func newAgent(id uuid.UUID, hostname string, collectsData bool) *agentpb.Agent {
+	return &agentpb.Agent{
+		Info: &agentpb.AgentInfo{
+			AgentID:      utils.ProtoFromUUID(id),
+			HostInfo:     &agentpb.HostInfo{Hostname: hostname},
+			Capabilities: &agentpb.AgentCapabilities{CollectsData: collectsData},
+		},
+	}
+}
+
+func ack(id uuid.UUID, protocols map[string]bool) *messagespb.ProtocolTracerAck {
+	return &messagespb.ProtocolTracerAck{AgentID: utils.ProtoFromUUID(id), Protocols: protocols}
+}
+
+func newStore(t *testing.T) *Datastore {
+	db, err := pebble.Open("test", &pebble.Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	ds := pebbledb.New(db, 3*time.Second)
+	t.Cleanup(func() {
+		require.NoError(t, ds.Close())
+	})
+	return NewDatastore(ds)
+}
+
+func newController(t *testing.T, store OverrideStore, config map[string]bool, agents ...*agentpb.Agent) (*Controller, *fakeMessenger, *time.Time) {
+	messenger := &fakeMessenger{agents: agents}
+	vzClient := fake.NewSimpleClientset(&v1alpha1.Vizier{
+		ObjectMeta: metav1.ObjectMeta{Name: "pixie", Namespace: "pl"},
+		Spec:       v1alpha1.VizierSpec{ProtocolTracers: config},
+	})
+	c, err := NewController(messenger, store, VizierConfigGetter(vzClient, "pl"))
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	t.Cleanup(c.Stop)
+	return c, messenger, &now
+}
+
+func (c *Controller) syncAt(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sync(now)
+}
+
+func TestController_SendsConfigUntilAcknowledged(t *testing.T) {
+	pem1 := uuid.Must(uuid.NewV4())
+	pem2 := uuid.Must(uuid.NewV4())
+	kelvin := uuid.Must(uuid.NewV4())
+	c, messenger, now := newController(t, newStore(t), map[string]bool{"dns": false},
+		newAgent(pem1, "node-a", true), newAgent(pem2, "node-b", true), newAgent(kelvin, "node-a", false))
+
+	c.syncAt(*now)
+	require.Len(t, messenger.messages, 1)
+	assert.ElementsMatch(t, []uuid.UUID{pem1, pem2}, messenger.sentTo[0])
+	assert.Equal(t, map[string]bool{"dns": false}, messenger.messages[0].Protocols)
+
+	c.HandleAck(ack(pem1, map[string]bool{"dns": false}))
+
+	// The update isn't sent again before the PEMs had time to acknowledge it.
+	*now = now.Add(time.Second)
+	c.syncAt(*now)
+	assert.Len(t, messenger.messages, 1)
+
+	*now = now.Add(resendInterval)
+	c.syncAt(*now)
+	require.Len(t, messenger.messages, 2)
+	assert.Equal(t, []uuid.UUID{pem2}, messenger.sentTo[1])
+
+	resp, err := c.GetProtocolTracerStatus(context.Background(), &metadatapb.GetProtocolTracerStatusRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"dns": false}, resp.Protocols)
+	assert.Empty(t, resp.Overrides)
+	require.Len(t, resp.Agents, 2)
+	assert.Equal(t, utils.ProtoFromUUID(pem1), resp.Agents[0].AgentID)
+	assert.Equal(t, "node-a", resp.Agents[0].Hostname)
+	assert.True(t, resp.Agents[0].Acknowledged)
+	assert.NotNil(t, resp.Agents[0].AcknowledgedAt)
+	assert.Equal(t, "node-b", resp.Agents[1].Hostname)
+	assert.False(t, resp.Agents[1].Acknowledged)
+	assert.Nil(t, resp.Agents[1].AcknowledgedAt)
+}
+
+func TestController_SetProtocolTracers(t *testing.T) {
+	pem := uuid.Must(uuid.NewV4())
+	store := newStore(t)
+	c, messenger, _ := newController(t, store, map[string]bool{"dns": false, "http": true}, newAgent(pem, "node-a", true))
+
+	c.syncAt(c.now())
+	c.HandleAck(ack(pem, map[string]bool{"dns": false, "http": true}))
+
+	// The overrides take precedence over the Vizier CRD, and are sent to the PEMs right away.
+	_, err := c.SetProtocolTracers(context.Background(), &metadatapb.SetProtocolTracersRequest{
+		Protocols: map[string]metadatapb.ProtocolTracerMode{
+			"dns":   metadatapb.PROTOCOL_TRACER_MODE_ENABLED,
+			"kafka": metadatapb.PROTOCOL_TRACER_MODE_DISABLED,
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, messenger.messages, 2)
+	assert.Equal(t, map[string]bool{"dns": true, "http": true, "kafka": false}, messenger.messages[1].Protocols)
+
+	// Overrides set back to the default fall back to the Vizier CRD.
+	_, err = c.SetProtocolTracers(context.Background(), &metadatapb.SetProtocolTracersRequest{
+		Protocols: map[string]metadatapb.ProtocolTracerMode{"dns": metadatapb.PROTOCOL_TRACER_MODE_DEFAULT},
+	})
+	require.NoError(t, err)
+	require.Len(t, messenger.messages, 3)
+	assert.Equal(t, map[string]bool{"dns": false, "http": true, "kafka": false}, messenger.messages[2].Protocols)
+
+	// The overrides outlive the controller.
+	restarted, _, _ := newController(t, store, map[string]bool{"dns": false, "http": true})
+	resp, err := restarted.GetProtocolTracerStatus(context.Background(), &metadatapb.GetProtocolTracerStatusRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"kafka": false}, resp.Overrides)
+	assert.Equal(t, map[string]bool{"dns": false, "http": true, "kafka": false}, resp.Protocols)
+}
+
+func TestController_SetProtocolTracers_UnknownProtocol(t *testing.T) {
+	c, messenger, _ := newController(t, newStore(t), nil, newAgent(uuid.Must(uuid.NewV4()), "node-a", true))
+
+	_, err := c.SetProtocolTracers(context.Background(), &metadatapb.SetProtocolTracersRequest{
+		Protocols: map[string]metadatapb.ProtocolTracerMode{"smtp": metadatapb.PROTOCOL_TRACER_MODE_ENABLED},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Empty(t, messenger.messages)
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package protocoltracer
+
+import (
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/utils/datastore"
+)
+
+const protocolTracerOverridesKey = "/protocolTracerOverrides"
+
+// Datastore implements the OverrideStore interface on a given Datastore.
+type Datastore struct {
+	ds datastore.MultiGetterSetterDeleterCloser
+}
+
+// NewDatastore wraps the datastore in a protocol tracer override store.
+func NewDatastore(ds datastore.MultiGetterSetterDeleterCloser) *Datastore {
+	return &Datastore{ds: ds}
+}
+
+// GetOverrides returns the runtime overrides of the protocol tracers.
+func (d *Datastore) GetOverrides() (map[string]bool, error) {
+	b, err := d.ds.Get(protocolTracerOverridesKey)
+	if err != nil {
+		return nil, err
+	}
+	overrides := &storepb.ProtocolTracerOverrides{}
+	if err := overrides.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	if overrides.Protocols == nil {
+		return map[string]bool{}, nil
+	}
+	return overrides.Protocols, nil
+}
+
+// SetOverrides replaces the runtime overrides of the protocol tracers.
+func (d *Datastore) SetOverrides(protocols map[string]bool) error {
+	b, err := (&storepb.ProtocolTracerOverrides{Protocols: protocols}).Marshal()
+	if err != nil {
+		return err
+	}
+	return d.ds.Set(protocolTracerOverridesKey, string(b))
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package querystats
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+)
+
+// maxEntries bounds the number of tables and namespaces that stats are kept for. Namespaces come from the
+// arguments of the queries, so there is no other bound on them. When it is reached, the entry that was
+// queried the longest time ago is evicted.
+const maxEntries = 1000
+
+type stats struct {
+	numQueries       int64
+	numFailed        int64
+	totalExecTimeNs  int64
+	maxExecTimeNs    int64
+	bytesProcessed   int64
+	recordsProcessed int64
+	lastQueriedAt    time.Time
+}
+
+func (s *stats) add(r *messagespb.QueryStatsRecord, at time.Time) {
+	s.numQueries++
+	if r.Failed {
+		s.numFailed++
+	}
+	s.totalExecTimeNs += r.ExecTimeNs
+	if r.ExecTimeNs > s.maxExecTimeNs {
+		s.maxExecTimeNs = r.ExecTimeNs
+	}
+	s.bytesProcessed += r.BytesProcessed
+	s.recordsProcessed += r.RecordsProcessed
+	if at.After(s.lastQueriedAt) {
+		s.lastQueriedAt = at
+	}
+}
+
+// Controller aggregates the stats of the finished queries that the query brokers publish, per table and
+// per namespace, and serves them to the query stats view.
+type Controller struct {
+	now   func() time.Time
+	since time.Time
+
+	mu         sync.Mutex
+	tables     map[string]*stats
+	namespaces map[string]*stats
+}
+
+// NewController creates a new query stats controller.
+func NewController() *Controller {
+	return &Controller{
+		now:        time.Now,
+		since:      time.Now(),
+		tables:     make(map[string]*stats),
+		namespaces: make(map[string]*stats),
+	}
+}
+
+// Initialize handles any setup that needs to be done.
+func (c *Controller) Initialize() error {
+	return nil
+}
+
+// HandleMessage records the stats of a finished query.
+func (c *Controller) HandleMessage(msg *nats.Msg) error {
+	r := &messagespb.QueryStatsRecord{}
+	if err := r.Unmarshal(msg.Data); err != nil {
+		return err
+	}
+	c.HandleRecord(r)
+	return nil
+}
+
+// HandleRecord records the stats of a finished query.
+func (c *Controller) HandleRecord(r *messagespb.QueryStatsRecord) {
+	at := c.now()
+	if r.EndTimeNs > 0 {
+		at = time.Unix(0, r.EndTimeNs)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range r.Tables {
+		addRecord(c.tables, t, r, at)
+	}
+	if len(r.Namespaces) == 0 {
+		addRecord(c.namespaces, "", r, at)
+	}
+	for _, ns := range r.Namespaces {
+		addRecord(c.namespaces, ns, r, at)
+	}
+}
+
+func addRecord(m map[string]*stats, name string, r *messagespb.QueryStatsRecord, at time.Time) {
+	s, ok := m[name]
+	if !ok {
+		if len(m) >= maxEntries {
+			evictOldest(m)
+		}
+		s = &stats{}
+		m[name] = s
+	}
+	s.add(r, at)
+}
+
+func evictOldest(m map[string]*stats) {
+	oldest := ""
+	var oldestAt time.Time
+	for name, s := range m {
+		if oldestAt.IsZero() || s.lastQueriedAt.Before(oldestAt) {
+			oldest = name
+			oldestAt = s.lastQueriedAt
+		}
+	}
+	log.WithField("name", oldest).Debug("Evicting query stats")
+	delete(m, oldest)
+}
+
+func toProto(m map[string]*stats) []*metadatapb.QueryStats {
+	res := make([]*metadatapb.QueryStats, 0, len(m))
+	for name, s := range m {
+		lastQueriedAt, _ := types.TimestampProto(s.lastQueriedAt)
+		res = append(res, &metadatapb.QueryStats{
+			Name:             name,
+			NumQueries:       s.numQueries,
+			NumFailed:        s.numFailed,
+			TotalExecTimeNs:  s.totalExecTimeNs,
+			MaxExecTimeNs:    s.maxExecTimeNs,
+			BytesProcessed:   s.bytesProcessed,
+			RecordsProcessed: s.recordsProcessed,
+			LastQueriedAt:    lastQueriedAt,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].NumQueries != res[j].NumQueries {
+			return res[i].NumQueries > res[j].NumQueries
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// GetQueryStats returns the query stats per table and per namespace.
+func (c *Controller) GetQueryStats(ctx context.Context, req *metadatapb.GetQueryStatsRequest) (*metadatapb.GetQueryStatsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	since, _ := types.TimestampProto(c.since)
+	return &metadatapb.GetQueryStatsResponse{
+		Since:      since,
+		Tables:     toProto(c.tables),
+		Namespaces: toProto(c.namespaces),
+	}, nil
+}
+
+// Stop stops the controller.
+func (c *Controller) Stop() {}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package querystats
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+)
+
+func byName(stats []*metadatapb.QueryStats) map[string]*metadatapb.QueryStats {
+	m := make(map[string]*metadatapb.QueryStats)
+	for _, s := range stats {
+		m[s.Name] = s
+	}
+	return m
+}
+
+func TestController_AggregatesPerTableAndNamespace(t *testing.T) {
+	c := NewController()
+	end := time.Unix(0, 1000)
+
+	msg, err := (&messagespb.QueryStatsRecord{
+		QueryName:        "px/http_data",
+		Tables:           []string{"http_events", "process_stats"},
+		Namespaces:       []string{"default"},
+		ExecTimeNs:       100,
+		BytesProcessed:   1000,
+		RecordsProcessed: 10,
+		EndTimeNs:        end.UnixNano(),
+	}).Marshal()
+	require.NoError(t, err)
+	require.NoError(t, c.HandleMessage(&nats.Msg{Data: msg}))
+	c.HandleRecord(&messagespb.QueryStatsRecord{
+		QueryName:        "px/cluster",
+		Tables:           []string{"http_events"},
+		Failed:           true,
+		ExecTimeNs:       300,
+		BytesProcessed:   500,
+		RecordsProcessed: 5,
+		EndTimeNs:        end.Add(time.Second).UnixNano(),
+	})
+
+	resp, err := c.GetQueryStats(context.Background(), &metadatapb.GetQueryStatsRequest{})
+	require.NoError(t, err)
+
+	require.Len(t, resp.Tables, 2)
+	// The most queried table comes first.
+	assert.Equal(t, "http_events", resp.Tables[0].Name)
+	tables := byName(resp.Tables)
+	assert.Equal(t, int64(2), tables["http_events"].NumQueries)
+	assert.Equal(t, int64(1), tables["http_events"].NumFailed)
+	assert.Equal(t, int64(400), tables["http_events"].TotalExecTimeNs)
+	assert.Equal(t, int64(300), tables["http_events"].MaxExecTimeNs)
+	assert.Equal(t, int64(1500), tables["http_events"].BytesProcessed)
+	assert.Equal(t, int64(15), tables["http_events"].RecordsProcessed)
+	assert.Equal(t, end.Add(time.Second).Unix(), tables["http_events"].LastQueriedAt.Seconds)
+	assert.Equal(t, int64(1), tables["process_stats"].NumQueries)
+	assert.Equal(t, int64(0), tables["process_stats"].NumFailed)
+
+	// The query that was not scoped to a namespace is counted under the empty name.
+	namespaces := byName(resp.Namespaces)
+	require.Len(t, namespaces, 2)
+	assert.Equal(t, int64(1), namespaces["default"].NumQueries)
+	assert.Equal(t, int64(1000), namespaces["default"].BytesProcessed)
+	assert.Equal(t, int64(1), namespaces[""].NumQueries)
+	assert.Equal(t, int64(1), namespaces[""].NumFailed)
+}
+
+func TestController_EvictsLeastRecentlyQueried(t *testing.T) {
+	c := NewController()
+	for i := 0; i < maxEntries; i++ {
+		c.HandleRecord(&messagespb.QueryStatsRecord{
+			Namespaces: []string{fmt.Sprintf("ns-%d", i)},
+			EndTimeNs:  int64(i + 1),
+		})
+	}
+	// Query the first namespace again, so that the second one is the least recently queried.
+	c.HandleRecord(&messagespb.QueryStatsRecord{Namespaces: []string{"ns-0"}, EndTimeNs: int64(maxEntries + 1)})
+	c.HandleRecord(&messagespb.QueryStatsRecord{Namespaces: []string{"new"}, EndTimeNs: int64(maxEntries + 2)})
+
+	resp, err := c.GetQueryStats(context.Background(), &metadatapb.GetQueryStatsRequest{})
+	require.NoError(t, err)
+	namespaces := byName(resp.Namespaces)
+	assert.Len(t, namespaces, maxEntries)
+	assert.Contains(t, namespaces, "new")
+	assert.Contains(t, namespaces, "ns-0")
+	assert.NotContains(t, namespaces, "ns-1")
+	assert.Equal(t, int64(2), namespaces["ns-0"].NumQueries)
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/gofrs/uuid"
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
+	"github.com/nats-io/nkeys"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -48,6 +49,7 @@ import (
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/services/shared/agentpb"
 	"px.dev/pixie/src/vizier/utils/datastore"
+	"px.dev/pixie/src/vizier/utils/messagebus"
 )
 
 // UnhealthyAgentThreshold is the amount of time where an agent is considered unhealthy if
@@ -59,8 +61,11 @@ type Server struct {
 	env    metadataenv.MetadataEnv
 	ds     datastore.MultiGetterSetterDeleterCloser
 	pls    k8smeta.PodLabelStore
+	ces    k8smeta.ContainerEventStore
 	agtMgr agent.Manager
 	tpMgr  *tracepoint.Manager
+	// natsAccount signs the NATS users of the agents. Agents share the NATS credentials of their component if nil.
+	natsAccount nkeys.KeyPair
 	// The current cursor that is actively running the GetAgentsUpdate stream. Only one GetAgentsUpdate
 	// stream should be running at a time.
 	getAgentsCursor uuid.UUID
@@ -68,16 +73,22 @@ type Server struct {
 }
 
 // NewServer creates GRPC handlers.
-func NewServer(env metadataenv.MetadataEnv, ds datastore.MultiGetterSetterDeleterCloser, pls k8smeta.PodLabelStore, agtMgr agent.Manager, tpMgr *tracepoint.Manager) *Server {
+func NewServer(env metadataenv.MetadataEnv, ds datastore.MultiGetterSetterDeleterCloser, pls k8smeta.PodLabelStore, ces k8smeta.ContainerEventStore, agtMgr agent.Manager, tpMgr *tracepoint.Manager) *Server {
 	return &Server{
 		env:    env,
 		ds:     ds,
 		pls:    pls,
+		ces:    ces,
 		agtMgr: agtMgr,
 		tpMgr:  tpMgr,
 	}
 }
 
+// SetNATSAccount sets the NATS account that signs the users of the agents.
+func (s *Server) SetNATSAccount(account nkeys.KeyPair) {
+	s.natsAccount = account
+}
+
 func convertToRelationMap(computedSchema *storepb.ComputedSchema) (*schemapb.Schema, error) {
 	schemas := computedSchema.Tables
 	respSchemaPb := &schemapb.Schema{}
@@ -350,6 +361,72 @@ func (s *Server) GetWithPrefixKey(ctx context.Context, req *metadatapb.WithPrefi
 	return resp, nil
 }
 
+// GetContainerEvents returns the restarts, terminations and readiness failures of containers since the given time.
+func (s *Server) GetContainerEvents(ctx context.Context, req *metadatapb.ContainerEventsRequest) (*metadatapb.ContainerEventsResponse, error) {
+	events, err := s.ces.FetchContainerEvents(req.SinceNS)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch container events: %v", err)
+	}
+	return &metadatapb.ContainerEventsResponse{Events: events}, nil
+}
+
+// UpdateAgentSelfTest stores the self-test result of a single agent.
+func (s *Server) UpdateAgentSelfTest(ctx context.Context, req *metadatapb.UpdateAgentSelfTestRequest) (*metadatapb.UpdateAgentSelfTestResponse, error) {
+	if req.Result == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing self-test result")
+	}
+	agentID, err := utils.UUIDFromProto(req.Result.AgentID)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid agent ID: %v", err)
+	}
+	err = s.agtMgr.UpdateAgentSelfTest(agentID, req.Result)
+	if errors.Is(err, agent.ErrAgentNotFound) {
+		return nil, status.Errorf(codes.NotFound, "agent %s is not registered", agentID)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to store self-test result: %v", err)
+	}
+	return &metadatapb.UpdateAgentSelfTestResponse{}, nil
+}
+
+// GetAgentSelfTests returns the latest self-test result of every agent that has been tested.
+func (s *Server) GetAgentSelfTests(ctx context.Context, req *metadatapb.AgentSelfTestsRequest) (*metadatapb.AgentSelfTestsResponse, error) {
+	results, err := s.agtMgr.GetAgentSelfTests()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch self-test results: %v", err)
+	}
+	return &metadatapb.AgentSelfTestsResponse{Results: results}, nil
+}
+
+// GetAgentNATSCredentials issues the NATS credentials of a starting agent, with a user that may only subscribe to
+// the agent's own topics. The agent ID must not belong to a registered agent, so that the credentials can't be used
+// to listen in on the messages of another agent.
+func (s *Server) GetAgentNATSCredentials(ctx context.Context, req *metadatapb.AgentNATSCredentialsRequest) (*metadatapb.AgentNATSCredentialsResponse, error) {
+	if s.natsAccount == nil {
+		return nil, status.Error(codes.Unimplemented, "agents use the NATS credentials of their component")
+	}
+	agentID, err := utils.UUIDFromProto(req.AgentID)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid agent ID: %v", err)
+	}
+	agents, err := s.agtMgr.GetActiveAgents()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch agents: %v", err)
+	}
+	for _, a := range agents {
+		if utils.UUIDFromProtoOrNil(a.Info.AgentID) == agentID {
+			return nil, status.Errorf(codes.AlreadyExists, "agent %s is already registered", agentID)
+		}
+	}
+
+	creds, err := messagebus.NewAgentNATSCreds(s.natsAccount, agentID, req.K8SUpdateSelector)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to create NATS credentials: %v", err)
+	}
+	log.WithField("agent_id", agentID).Info("Issued NATS credentials to agent")
+	return &metadatapb.AgentNATSCredentialsResponse{Creds: string(creds)}, nil
+}
+
 // ConvertLabelsToPods fetches all the pods in the PodLabelStore that match the labels described in the input tp,
 // and then convert the LabelSelector to a PodProcess.
 func (s *Server) ConvertLabelsToPods(tp *logicalpb.TracepointDeployment) error {
@@ -32,13 +32,17 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
@@ -46,6 +50,7 @@ import (
 	"px.dev/pixie/src/carnot/planner/dynamic_tracing/ir/logicalpb"
 	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/shared/bloomfilterpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
 
 	sharedmetadatapb "px.dev/pixie/src/shared/metadatapb"
 	"px.dev/pixie/src/shared/services/env"
@@ -55,6 +60,7 @@ import (
 	"px.dev/pixie/src/utils/testingutils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/metadata/controllers"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
 	mock_agent "px.dev/pixie/src/vizier/services/metadata/controllers/agent/mock"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/testutils"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
@@ -166,7 +172,7 @@ func TestGetAgentInfo(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, nil, mockAgtMgr, nil)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, nil)
 
 	req := metadatapb.AgentInfoRequest{}
 
@@ -212,7 +218,7 @@ func TestGetAgentInfoGetActiveAgentsFailed(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, nil, mockAgtMgr, nil)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, nil)
 
 	req := metadatapb.AgentInfoRequest{}
 
@@ -241,7 +247,7 @@ func TestGetSchemas(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, nil, mockAgtMgr, nil)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, nil)
 
 	req := metadatapb.SchemaRequest{}
 
@@ -349,7 +355,7 @@ func Test_Server_RegisterTracepoint(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, tracepointMgr)
 
 	reqs := []*metadatapb.RegisterTracepointRequest_TracepointRequest{
 		{
@@ -474,7 +480,7 @@ func Test_Server_RegisterTracepoint_Exists(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, tracepointMgr)
 
 	reqs := []*metadatapb.RegisterTracepointRequest_TracepointRequest{
 		{
@@ -659,7 +665,7 @@ func Test_Server_GetTracepointInfo(t *testing.T) {
 				t.Fatal("Failed to create api environment.")
 			}
 
-			s := controllers.NewServer(env, nil, nil, mockAgtMgr, tracepointMgr)
+			s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, tracepointMgr)
 			req := metadatapb.GetTracepointInfoRequest{
 				IDs: []*uuidpb.UUID{utils.ProtoFromUUID(tID)},
 			}
@@ -717,7 +723,7 @@ func Test_Server_RemoveTracepoint(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, tracepointMgr)
 
 	req := metadatapb.RemoveTracepointRequest{
 		Names: []string{"test1", "test2"},
@@ -903,7 +909,7 @@ func TestGetAgentUpdates(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	srv := controllers.NewServer(mdEnv, nil, nil, mockAgtMgr, nil)
+	srv := controllers.NewServer(mdEnv, nil, nil, nil, mockAgtMgr, nil)
 
 	env := env.New("withpixie.ai")
 	s := server.CreateGRPCServer(env, &server.GRPCServerOptions{})
@@ -1064,7 +1070,7 @@ func Test_Server_UpdateConfig(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, tracepointMgr)
 
 	req := metadatapb.UpdateConfigRequest{
 		AgentPodName: "pl/pem-1234",
@@ -1105,7 +1111,7 @@ func Test_Server_ConvertLabelsToPods(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, pls, nil, nil)
+	s := controllers.NewServer(env, nil, pls, nil, nil, nil)
 
 	program := &logicalpb.TracepointDeployment{}
 	err = proto.UnmarshalText(testutils.TDLabelSelectorPb, program)
@@ -1121,3 +1127,123 @@ func Test_Server_ConvertLabelsToPods(t *testing.T) {
 
 	assert.True(t, proto.Equal(program, expected), fmt.Sprintf("expect: %s\nactual: %s", expected, program))
 }
+
+func Test_Server_GetContainerEvents(t *testing.T) {
+	ces := &testutils.InMemoryContainerEventStore{}
+	oom := &metadatapb.ContainerEvent{
+		TimeNS:        10,
+		Type:          metadatapb.CONTAINER_EVENT_OOM_KILLED,
+		PodUID:        "abcd",
+		PodName:       "pl/pod1",
+		ContainerName: "app",
+		ExitCode:      137,
+	}
+	restart := &metadatapb.ContainerEvent{
+		TimeNS:        20,
+		Type:          metadatapb.CONTAINER_EVENT_RESTARTED,
+		PodUID:        "efgh",
+		PodName:       "pl/pod2",
+		ContainerName: "app",
+		ExitCode:      1,
+	}
+	err := ces.AddContainerEvents([]*metadatapb.ContainerEvent{oom, restart})
+	require.NoError(t, err)
+
+	env, err := metadataenv.New("vizier")
+	require.NoError(t, err)
+	s := controllers.NewServer(env, nil, nil, ces, nil, nil)
+
+	resp, err := s.GetContainerEvents(context.Background(), &metadatapb.ContainerEventsRequest{SinceNS: 15})
+	require.NoError(t, err)
+	assert.Equal(t, []*metadatapb.ContainerEvent{restart}, resp.Events)
+}
+
+func Test_Server_UpdateAgentSelfTest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+
+	agentID := uuid.Must(uuid.NewV4())
+	result := &cvmsgspb.NodeSelfTest{
+		AgentID:  utils.ProtoFromUUID(agentID),
+		Hostname: "node-1",
+		Checks: []*cvmsgspb.SelfTestCheck{
+			{Name: "http_tracing", Passed: false, Message: "no HTTP requests were traced"},
+		},
+	}
+	missingID := uuid.Must(uuid.NewV4())
+	missing := &cvmsgspb.NodeSelfTest{AgentID: utils.ProtoFromUUID(missingID)}
+
+	mockAgtMgr.
+		EXPECT().
+		UpdateAgentSelfTest(agentID, result).
+		Return(nil)
+	mockAgtMgr.
+		EXPECT().
+		UpdateAgentSelfTest(missingID, missing).
+		Return(agent.ErrAgentNotFound)
+
+	env, err := metadataenv.New("vizier")
+	require.NoError(t, err)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, nil)
+
+	_, err = s.UpdateAgentSelfTest(context.Background(), &metadatapb.UpdateAgentSelfTestRequest{Result: result})
+	require.NoError(t, err)
+
+	_, err = s.UpdateAgentSelfTest(context.Background(), &metadatapb.UpdateAgentSelfTestRequest{Result: missing})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = s.UpdateAgentSelfTest(context.Background(), &metadatapb.UpdateAgentSelfTestRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_Server_GetAgentNATSCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+
+	registeredID := uuid.Must(uuid.NewV4())
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return([]*agentpb.Agent{{Info: &agentpb.AgentInfo{AgentID: utils.ProtoFromUUID(registeredID)}}}, nil).
+		AnyTimes()
+
+	env, err := metadataenv.New("vizier")
+	require.NoError(t, err)
+	s := controllers.NewServer(env, nil, nil, nil, mockAgtMgr, nil)
+
+	agentID := uuid.Must(uuid.NewV4())
+	req := &metadatapb.AgentNATSCredentialsRequest{AgentID: utils.ProtoFromUUID(agentID), K8SUpdateSelector: "10.0.0.1"}
+	_, err = s.GetAgentNATSCredentials(context.Background(), req)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	account, err := nkeys.CreateAccount()
+	require.NoError(t, err)
+	s.SetNATSAccount(account)
+
+	resp, err := s.GetAgentNATSCredentials(context.Background(), req)
+	require.NoError(t, err)
+	userJWT, err := nkeys.ParseDecoratedJWT([]byte(resp.Creds))
+	require.NoError(t, err)
+	claims, err := jwt.DecodeUserClaims(userJWT)
+	require.NoError(t, err)
+	accountKey, err := account.PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, accountKey, claims.Issuer)
+	assert.ElementsMatch(t, []string{"Agent/" + agentID.String(), "K8sUpdates/10.0.0.1", "_INBOX.>"}, []string(claims.Sub.Allow))
+
+	// The credentials of a running agent can't be requested again.
+	_, err = s.GetAgentNATSCredentials(context.Background(), &metadatapb.AgentNATSCredentialsRequest{
+		AgentID:           utils.ProtoFromUUID(registeredID),
+		K8SUpdateSelector: "10.0.0.2",
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// Selectors can't match the topics of other agents.
+	_, err = s.GetAgentNATSCredentials(context.Background(), &metadatapb.AgentNATSCredentialsRequest{
+		AgentID:           utils.ProtoFromUUID(agentID),
+		K8SUpdateSelector: "*",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -20,7 +20,10 @@ package testutils
 
 import (
 	"path"
+	"sort"
 	"strings"
+
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 )
 
 // InMemoryPodLabelStore implements the PodLabelStore interface for testing.
@@ -97,3 +100,39 @@ func (s *InMemoryPodLabelStore) FetchPodsWithLabels(namespace string, labels map
 func (s *InMemoryPodLabelStore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
 	return nil, nil, nil
 }
+
+// InMemoryContainerEventStore implements the ContainerEventStore interface for testing.
+type InMemoryContainerEventStore struct {
+	Events []*metadatapb.ContainerEvent
+}
+
+// AddContainerEvents stores the given container events, replacing any event with the same time, pod and container.
+func (s *InMemoryContainerEventStore) AddContainerEvents(events []*metadatapb.ContainerEvent) error {
+	for _, e := range events {
+		replaced := false
+		for i, existing := range s.Events {
+			if existing.TimeNS == e.TimeNS && existing.PodUID == e.PodUID && existing.ContainerName == e.ContainerName {
+				s.Events[i] = e
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.Events = append(s.Events, e)
+		}
+	}
+	sort.SliceStable(s.Events, func(i, j int) bool {
+		return s.Events[i].TimeNS < s.Events[j].TimeNS
+	})
+	return nil
+}
+
+// FetchContainerEvents gets all container events at or after the given time.
+func (s *InMemoryContainerEventStore) FetchContainerEvents(sinceNS int64) ([]*metadatapb.ContainerEvent, error) {
+	var events []*metadatapb.ContainerEvent
+	for _, e := range s.Events {
+		if e.TimeNS >= sinceNS {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
@@ -32,6 +32,7 @@ import (
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/carnot/planner/dynamic_tracing/ir/logicalpb"
 	"px.dev/pixie/src/common/base/statuspb"
+	"px.dev/pixie/src/shared/services/clock"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
@@ -71,6 +72,7 @@ type Store interface {
 type Manager struct {
 	ts     Store
 	agtMgr agentMessenger
+	clock  clock.Clock
 
 	done chan struct{}
 	once sync.Once
@@ -78,9 +80,15 @@ type Manager struct {
 
 // NewManager creates a new tracepoint manager.
 func NewManager(ts Store, agtMgr agentMessenger, ttlReaperDuration time.Duration) *Manager {
+	return NewManagerWithClock(ts, agtMgr, ttlReaperDuration, clock.New())
+}
+
+// NewManagerWithClock creates a new tracepoint manager which uses the given clock to expire tracepoints.
+func NewManagerWithClock(ts Store, agtMgr agentMessenger, ttlReaperDuration time.Duration, clk clock.Clock) *Manager {
 	tm := &Manager{
 		ts:     ts,
 		agtMgr: agtMgr,
+		clock:  clk,
 		done:   make(chan struct{}),
 	}
 
@@ -89,13 +97,13 @@ func NewManager(ts Store, agtMgr agentMessenger, ttlReaperDuration time.Duration
 }
 
 func (m *Manager) watchForTracepointExpiry(ttlReaperDuration time.Duration) {
-	ticker := time.NewTicker(ttlReaperDuration)
+	ticker := m.clock.NewTicker(ttlReaperDuration)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-m.done:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			m.terminateExpiredTracepoints()
 		}
 	}
@@ -114,7 +122,7 @@ func (m *Manager) terminateExpiredTracepoints() {
 		return
 	}
 
-	now := time.Now()
+	now := m.clock.Now()
 
 	// Lookup for tracepoints that still have an active ttl
 	tpActive := make(map[uuid.UUID]bool)
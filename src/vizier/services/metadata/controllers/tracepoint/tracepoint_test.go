@@ -31,6 +31,7 @@ import (
 
 	"px.dev/pixie/src/carnot/planner/dynamic_tracing/ir/logicalpb"
 	"px.dev/pixie/src/common/base/statuspb"
+	"px.dev/pixie/src/shared/services/clock"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	mock_agent "px.dev/pixie/src/vizier/services/metadata/controllers/agent/mock"
@@ -676,6 +677,9 @@ func TestTTLExpiration(t *testing.T) {
 	tpID3 := uuid.Must(uuid.NewV4())
 	tpID4 := uuid.Must(uuid.NewV4())
 
+	now := time.Unix(1700000000, 0)
+	clk := clock.NewFakeClock(now)
+
 	mockTracepointStore.
 		EXPECT().
 		GetTracepoints().
@@ -703,9 +707,9 @@ func TestTTLExpiration(t *testing.T) {
 			tpID3,
 			tpID4,
 		}, []time.Time{
-			time.Now().Add(1 * time.Hour),
-			time.Now().Add(-1 * time.Minute),
-			time.Now().Add(-1 * time.Hour),
+			now.Add(1 * time.Hour),
+			now.Add(30 * time.Second),
+			now.Add(-1 * time.Hour),
 		}, nil)
 
 	mockTracepointStore.
@@ -754,9 +758,13 @@ func TestTTLExpiration(t *testing.T) {
 		Times(2).
 		DoAndReturn(msgHandler)
 
-	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 25*time.Millisecond)
+	tracepointMgr := tracepoint.NewManagerWithClock(mockTracepointStore, mockAgtMgr, time.Minute, clk)
 	defer tracepointMgr.Close()
 
+	// tpID3 expires before the reaper runs.
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+
 	wg.Wait()
 	assert.Contains(t, seenDeletions, tpID2.String())
 	assert.Contains(t, seenDeletions, tpID3.String())
@@ -19,6 +19,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
@@ -30,6 +31,7 @@ import (
 
 	"github.com/cockroachdb/pebble"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -37,29 +39,42 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
+	"px.dev/pixie/src/operator/client/versioned"
 	version "px.dev/pixie/src/shared/goversion"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/election"
 	"px.dev/pixie/src/shared/services/healthz"
 	"px.dev/pixie/src/shared/services/httpmiddleware"
 	"px.dev/pixie/src/shared/services/metrics"
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/pg"
 	"px.dev/pixie/src/shared/services/server"
 	"px.dev/pixie/src/vizier/services/metadata/controllers"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/actions"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/backfill"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/backpressure"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/cronscript"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/k8smeta"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/protocoltracer"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/querystats"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
 	"px.dev/pixie/src/vizier/services/metadata/metadataenv"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/utils/datastore"
 	"px.dev/pixie/src/vizier/utils/datastore/etcd"
 	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+	"px.dev/pixie/src/vizier/utils/datastore/pgdb"
 )
 
 const (
 	// pebbledbTTLDuration represents how often we evict from pebble.
 	pebbledbTTLDuration = 1 * time.Minute
+	// pgdbTTLDuration represents how often we evict from postgres.
+	pgdbTTLDuration = 1 * time.Minute
 	// pebbleOpenDir is where the files live in the directory.
 	pebbleOpenDir = "/metadata/pebble_20220209"
 	// metadataBaseMount is the base volume mount if we are running a PVC backed metadata.
@@ -72,9 +87,13 @@ func init() {
 	pflag.Duration("max_expected_clock_skew", 2000, "Duration in ms of expected maximum clock skew in a cluster")
 	pflag.Duration("renew_period", 5000, "Duration in ms of the time to wait to renew lease")
 	pflag.String("pod_namespace", "pl", "The namespace this pod runs in. Used for leader elections")
-	pflag.String("nats_url", "pl-nats", "The URL of NATS")
 	pflag.Bool("use_etcd_operator", false, "Whether the etcd operator should be used instead of the persistent version.")
+	pflag.Bool("use_postgres", false, "Whether an external postgres database, configured by the postgres_* flags, should be used instead of the persistent version.")
 	pflag.StringSlice("metadata_namespaces", []string{v1.NamespaceAll}, "The list of namespaces to watch for metadata.")
+	pflag.Bool("enable_actions", false, "Whether scripts may trigger Kubernetes actions. Requires the pl-vizier-metadata-actions role.")
+	pflag.String("actions_policy_file", "", "Path to the policy which guards script triggered actions. If unset, all actions are denied.")
+	pflag.String("nats_account_seed", "", "Path to the seed of the NATS account, with which each agent is issued a NATS user that may only subscribe to its own topics.")
+	pflag.Duration("backpressure_report_ttl", 30*time.Second, "How long saturation reports are considered, and how long backpressure signals stay in effect on the PEMs.")
 
 	// Metadata flags are set using the env vars in pl-cluster-config.
 	// We historically set PL_ETCD_OPERATOR_ENABLED but not PL_USE_ETCD_OPERATOR in the configmap.
@@ -87,7 +106,7 @@ func init() {
 func mustInitEtcdDatastore() (*etcd.DataStore, func()) {
 	log.Infof("Using etcd: %s for metadata", viper.GetString("md_etcd_server"))
 	var tlsConfig *tls.Config
-	if !viper.GetBool("disable_ssl") {
+	if services.SSLEnabled() {
 		var err error
 		tlsConfig, err = etcdTLSConfig()
 		if err != nil {
@@ -145,6 +164,15 @@ func mustInitPebbleDatastore() *pebbledb.DataStore {
 	return pebbledb.New(pebbleDb, pebbledbTTLDuration)
 }
 
+func mustInitPostgresDatastore() *pgdb.DataStore {
+	db := pg.MustConnectDefaultPostgresDB()
+	ds, err := pgdb.New(db, pgdbTTLDuration)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to set up the postgres metadata store. Please check that the postgres user may create tables in the database")
+	}
+	return ds
+}
+
 func etcdTLSConfig() (*tls.Config, error) {
 	tlsCert := viper.GetString("client_tls_cert")
 	tlsKey := viper.GetString("client_tls_key")
@@ -159,6 +187,69 @@ func etcdTLSConfig() (*tls.Config, error) {
 	return tlsInfo.ClientConfig()
 }
 
+func mustInitActionExecutor(audit actions.AuditStore) *actions.Executor {
+	policy := actions.DefaultPolicy()
+	if path := viper.GetString("actions_policy_file"); path != "" {
+		var err error
+		policy, err = actions.LoadPolicy(path)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load action policy")
+		}
+	}
+
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to get in-cluster config for actions")
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create clientset for actions")
+	}
+	log.WithField("dryRun", policy.DryRun).Info("Script triggered actions are enabled")
+	return actions.NewExecutor(clientset, policy, audit)
+}
+
+func mustInitBackpressureController(agtMgr agent.Manager) *backpressure.Controller {
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to get in-cluster config for backpressure")
+	}
+	vzClient, err := versioned.NewForConfig(kubeConfig)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create Vizier CRD client for backpressure")
+	}
+	getPolicy := backpressure.VizierPolicyGetter(vzClient, viper.GetString("pod_namespace"))
+	return backpressure.NewController(agtMgr, getPolicy, viper.GetDuration("backpressure_report_ttl"))
+}
+
+func mustInitBackfillController(agtMgr agent.Manager) *backfill.Controller {
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to get in-cluster config for backfill")
+	}
+	vzClient, err := versioned.NewForConfig(kubeConfig)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create Vizier CRD client for backfill")
+	}
+	return backfill.NewController(agtMgr, backfill.VizierPolicyGetter(vzClient, viper.GetString("pod_namespace")))
+}
+
+func mustInitProtocolTracerController(agtMgr agent.Manager, store protocoltracer.OverrideStore) *protocoltracer.Controller {
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to get in-cluster config for protocol tracers")
+	}
+	vzClient, err := versioned.NewForConfig(kubeConfig)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create Vizier CRD client for protocol tracers")
+	}
+	c, err := protocoltracer.NewController(agtMgr, store, protocoltracer.VizierConfigGetter(vzClient, viper.GetString("pod_namespace")))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load protocol tracer overrides")
+	}
+	return c
+}
+
 func main() {
 	services.SetupService("metadata", 50400)
 	services.SetupSSLClientFlags()
@@ -173,13 +264,7 @@ func main() {
 
 	var nc *nats.Conn
 	var err error
-	if viper.GetBool("disable_ssl") {
-		nc, err = nats.Connect(viper.GetString("nats_url"))
-	} else {
-		nc, err = nats.Connect(viper.GetString("nats_url"),
-			nats.ClientCert(viper.GetString("client_tls_cert"), viper.GetString("client_tls_key")),
-			nats.RootCAs(viper.GetString("tls_ca_cert")))
-	}
+	nc, err = nats.Connect(viper.GetString("nats_url"), msgbus.NATSConnectOptions()...)
 
 	if err != nil {
 		log.WithError(err).Fatal("Could not connect to NATS. Please check for the `pl-nats` pods in the namespace to confirm they are healthy and running.")
@@ -224,10 +309,13 @@ func main() {
 
 	var dataStore datastore.MultiGetterSetterDeleterCloser
 	var cleanupFunc func()
-	if viper.GetBool("use_etcd_operator") {
+	switch {
+	case viper.GetBool("use_postgres"):
+		dataStore = mustInitPostgresDatastore()
+	case viper.GetBool("use_etcd_operator"):
 		dataStore, cleanupFunc = mustInitEtcdDatastore()
 		defer cleanupFunc()
-	} else {
+	default:
 		dataStore = mustInitPebbleDatastore()
 	}
 	defer dataStore.Close()
@@ -235,7 +323,7 @@ func main() {
 	k8sMds := k8smeta.NewDatastore(dataStore)
 	// Listen for K8s metadata updates.
 	updateCh := make(chan *k8smeta.K8sResourceMessage)
-	mdh := k8smeta.NewHandler(updateCh, k8sMds, k8sMds, nc)
+	mdh := k8smeta.NewHandler(updateCh, k8sMds, k8sMds, k8sMds, nc)
 
 	namespaces := viper.GetStringSlice("metadata_namespaces")
 	if len(namespaces) == 0 {
@@ -270,8 +358,24 @@ func main() {
 	tracepointMgr := tracepoint.NewManager(tds, agtMgr, 30*time.Second)
 	defer tracepointMgr.Close()
 
+	var actionExecutor *actions.Executor
+	if viper.GetBool("enable_actions") {
+		actionExecutor = mustInitActionExecutor(actions.NewDatastore(dataStore))
+	}
+
+	bfController := mustInitBackfillController(agtMgr)
+	bfController.Start()
+	defer bfController.Stop()
+
+	qsController := querystats.NewController()
+
+	ptController := mustInitProtocolTracerController(agtMgr, protocoltracer.NewDatastore(dataStore))
+	ptController.Start()
+	defer ptController.Stop()
+
 	mc, err := controllers.NewMessageBusController(nc, agtMgr, tracepointMgr,
-		mdh, &isLeader)
+		mdh, actionExecutor, viper.GetString("jwt_signing_key"), mustInitBackpressureController(agtMgr), bfController,
+		qsController, ptController, &isLeader)
 
 	if err != nil {
 		log.WithError(err).Fatal("Failed to connect to message bus")
@@ -287,7 +391,18 @@ func main() {
 	healthz.RegisterDefaultChecks(mux)
 	metrics.MustRegisterMetricsHandlerNoDefaultMetrics(mux)
 
-	svr := controllers.NewServer(env, dataStore, k8sMds, agtMgr, tracepointMgr)
+	svr := controllers.NewServer(env, dataStore, k8sMds, k8sMds, agtMgr, tracepointMgr)
+	if path := viper.GetString("nats_account_seed"); path != "" {
+		seed, err := os.ReadFile(path)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to read the NATS account seed")
+		}
+		account, err := nkeys.FromSeed(bytes.TrimSpace(seed))
+		if err != nil {
+			log.WithError(err).Fatal("Invalid NATS account seed")
+		}
+		svr.SetNATSAccount(account)
+	}
 
 	csDs := cronscript.NewDatastore(dataStore)
 	cronScriptSvr := cronscript.New(csDs)
@@ -304,6 +419,9 @@ func main() {
 	metadatapb.RegisterMetadataTracepointServiceServer(s.GRPCServer(), svr)
 	metadatapb.RegisterMetadataConfigServiceServer(s.GRPCServer(), svr)
 	metadatapb.RegisterCronScriptStoreServiceServer(s.GRPCServer(), cronScriptSvr)
+	metadatapb.RegisterMetadataBackfillServiceServer(s.GRPCServer(), bfController)
+	metadatapb.RegisterMetadataQueryStatsServiceServer(s.GRPCServer(), qsController)
+	metadatapb.RegisterMetadataProtocolTracerServiceServer(s.GRPCServer(), ptController)
 
 	s.Start()
 	s.StopOnInterrupt()
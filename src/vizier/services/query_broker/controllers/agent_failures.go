@@ -0,0 +1,265 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/carnot/planpb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/query_broker/tracker"
+)
+
+var queryAgentFailureCounter = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "query_agent_failures",
+		Help: "The number of agents that failed while running a query, by whether their part of the query was retried or left out.",
+	},
+	[]string{"outcome"},
+)
+
+// How often the agents of a running query are checked for failures.
+const agentFailureCheckInterval = time.Second
+
+func init() {
+	pflag.Int("query_agent_max_retries", 1, "The most failed agents per query whose part of the query is retried on the agent "+
+		"that replaces them. The data of any other failed agents is left out of the results.")
+	pflag.Duration("query_agent_replacement_timeout", 30*time.Second, "How long to wait for a failed agent to be "+
+		"replaced before leaving its data out of the query results.")
+}
+
+// AgentFailureMonitor watches the PEMs that a query was dispatched to. When a PEM fails while the query is running,
+// its sub-plan is re-dispatched to the PEM that replaces it on the same host, as long as the sub-plan is safe to run
+// again. Otherwise, or if no replacement registers in time, the failed PEM's partition of the data is left out of the
+// results, instead of failing the query.
+type AgentFailureMonitor struct {
+	queryID            uuid.UUID
+	natsConn           *nats.Conn
+	agentsTracker      AgentsTracker
+	analyze            bool
+	maxRetries         int
+	replacementTimeout time.Duration
+	clock              clock.Clock
+
+	mu sync.Mutex
+	// plans holds the sub-plans of the PEMs that the query is currently running on.
+	plans   map[uuid.UUID]*planpb.Plan
+	hostIPs map[uuid.UUID]string
+	// dispatched holds every agent that the query was sent to, so that they aren't chosen as replacements.
+	dispatched map[uuid.UUID]bool
+	// failedAt holds when each failed agent that is waiting for a replacement was first found missing.
+	failedAt map[uuid.UUID]time.Time
+	failures []*vizierpb.AgentFailure
+	retries  int
+}
+
+// NewAgentFailureMonitor creates a monitor for the PEMs in the plan map of the given query.
+func NewAgentFailureMonitor(queryID uuid.UUID, natsConn *nats.Conn, agentsTracker AgentsTracker, planMap map[uuid.UUID]*planpb.Plan,
+	analyze bool, maxRetries int, replacementTimeout time.Duration) *AgentFailureMonitor {
+	return NewAgentFailureMonitorWithClock(queryID, natsConn, agentsTracker, planMap, analyze, maxRetries, replacementTimeout, clock.New())
+}
+
+// NewAgentFailureMonitorWithClock creates a monitor for the PEMs in the plan map of the given query, which uses the
+// given clock.
+func NewAgentFailureMonitorWithClock(queryID uuid.UUID, natsConn *nats.Conn, agentsTracker AgentsTracker, planMap map[uuid.UUID]*planpb.Plan,
+	analyze bool, maxRetries int, replacementTimeout time.Duration, clk clock.Clock) *AgentFailureMonitor {
+	m := &AgentFailureMonitor{
+		queryID:            queryID,
+		natsConn:           natsConn,
+		agentsTracker:      agentsTracker,
+		analyze:            analyze,
+		maxRetries:         maxRetries,
+		replacementTimeout: replacementTimeout,
+		clock:              clk,
+		plans:              make(map[uuid.UUID]*planpb.Plan),
+		hostIPs:            make(map[uuid.UUID]string),
+		dispatched:         make(map[uuid.UUID]bool),
+		failedAt:           make(map[uuid.UUID]time.Time),
+	}
+
+	info := agentsTracker.GetAgentInfo()
+	ds := info.DistributedState()
+	for _, carnotInfo := range ds.CarnotInfo {
+		agentID := utils.UUIDFromProtoOrNil(carnotInfo.AgentID)
+		plan, ok := planMap[agentID]
+		// Kelvins produce the results of the query, so the query can't continue without them.
+		if !ok || !carnotInfo.HasDataStore || carnotInfo.AcceptsRemoteSources {
+			continue
+		}
+		m.plans[agentID] = plan
+		m.hostIPs[agentID] = info.AgentHostIP(agentID)
+	}
+	for agentID := range planMap {
+		m.dispatched[agentID] = true
+	}
+	return m
+}
+
+// subPlanRetryable returns whether the sub-plan of an agent can be run again on another agent without changing the
+// results or having side effects: it must only send its results to other agents, rather than to the query broker,
+// and must not run UDTFs or export data.
+func subPlanRetryable(plan *planpb.Plan) bool {
+	for _, fragment := range plan.Nodes {
+		for _, node := range fragment.Nodes {
+			switch node.Op.OpType {
+			case planpb.UDTF_SOURCE_OPERATOR, planpb.OTEL_EXPORT_SINK_OPERATOR:
+				return false
+			case planpb.GRPC_SINK_OPERATOR:
+				if node.Op.GetGRPCSinkOp().GetOutputTable() != nil {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Run checks for failed agents until the context is done.
+func (m *AgentFailureMonitor) Run(ctx context.Context) {
+	ticker := m.clock.NewTicker(agentFailureCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			m.Check()
+		}
+	}
+}
+
+// Check looks for PEMs of the query that are no longer registered, and either re-dispatches their sub-plans to their
+// replacements, or leaves their partitions out of the query.
+func (m *AgentFailureMonitor) Check() {
+	info := m.agentsTracker.GetAgentInfo()
+	if info == nil {
+		return
+	}
+	ds := info.DistributedState()
+	present := make(map[uuid.UUID]bool)
+	for _, carnotInfo := range ds.CarnotInfo {
+		// Only PEMs can replace a failed PEM.
+		if carnotInfo.HasDataStore && !carnotInfo.AcceptsRemoteSources {
+			present[utils.UUIDFromProtoOrNil(carnotInfo.AgentID)] = true
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var missing []uuid.UUID
+	for agentID := range m.plans {
+		if !present[agentID] {
+			missing = append(missing, agentID)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].String() < missing[j].String() })
+
+	now := m.clock.Now()
+	for _, agentID := range missing {
+		failedAt, ok := m.failedAt[agentID]
+		if !ok {
+			failedAt = now
+			m.failedAt[agentID] = now
+			log.WithField("query_id", m.queryID).WithField("agent_id", agentID).Info("Agent failed while running query")
+		}
+
+		plan := m.plans[agentID]
+		if m.retries < m.maxRetries && subPlanRetryable(plan) {
+			if replacementID, ok := m.findReplacement(info, present, m.hostIPs[agentID]); ok {
+				err := LaunchQuery(m.queryID, m.natsConn, map[uuid.UUID]*planpb.Plan{replacementID: plan}, m.analyze)
+				if err == nil {
+					m.retries++
+					m.dispatched[replacementID] = true
+					m.plans[replacementID] = plan
+					m.hostIPs[replacementID] = m.hostIPs[agentID]
+					m.resolve(agentID, replacementID)
+					continue
+				}
+				log.WithField("query_id", m.queryID).WithField("agent_id", replacementID).WithError(err).
+					Error("Failed to retry query on replacement agent")
+			}
+			if now.Sub(failedAt) < m.replacementTimeout {
+				continue
+			}
+		}
+		m.resolve(agentID, uuid.Nil)
+	}
+}
+
+// findReplacement returns a PEM on the given host that the query hasn't been dispatched to yet.
+func (m *AgentFailureMonitor) findReplacement(info tracker.AgentsInfo, present map[uuid.UUID]bool, hostIP string) (uuid.UUID, bool) {
+	if hostIP == "" {
+		return uuid.Nil, false
+	}
+	var candidates []uuid.UUID
+	for agentID := range present {
+		if !m.dispatched[agentID] && info.AgentHostIP(agentID) == hostIP {
+			candidates = append(candidates, agentID)
+		}
+	}
+	if len(candidates) == 0 {
+		return uuid.Nil, false
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].String() < candidates[j].String() })
+	return candidates[0], true
+}
+
+// resolve records how the failure of the agent was handled. A nil retry ID means that its partition was left out.
+func (m *AgentFailureMonitor) resolve(agentID uuid.UUID, retryID uuid.UUID) {
+	delete(m.plans, agentID)
+	delete(m.hostIPs, agentID)
+	delete(m.failedAt, agentID)
+
+	failure := &vizierpb.AgentFailure{AgentID: agentID.String()}
+	logger := log.WithField("query_id", m.queryID).WithField("agent_id", agentID)
+	if retryID == uuid.Nil {
+		queryAgentFailureCounter.With(prometheus.Labels{"outcome": "absent"}).Inc()
+		logger.Info("Leaving the data of the failed agent out of the query")
+	} else {
+		failure.RetryAgentID = retryID.String()
+		queryAgentFailureCounter.With(prometheus.Labels{"outcome": "retried"}).Inc()
+		logger.WithField("retry_agent_id", retryID).Info("Retried query on the replacement of the failed agent")
+	}
+	m.failures = append(m.failures, failure)
+}
+
+// Failures returns the failed agents of the query that were handled so far, in the order they were handled.
+func (m *AgentFailureMonitor) Failures() []*vizierpb.AgentFailure {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.failures) == 0 {
+		return nil
+	}
+	failures := make([]*vizierpb.AgentFailure, len(m.failures))
+	copy(failures, m.failures)
+	return failures
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/carnot/planner/distributedpb"
+	"px.dev/pixie/src/carnot/planpb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+	"px.dev/pixie/src/vizier/services/query_broker/tracker"
+)
+
+var (
+	failurePEM1ID        = uuid.Must(uuid.FromString("11111111-1de9-4ab1-ae6a-0ba08c8c676c"))
+	failurePEM2ID        = uuid.Must(uuid.FromString("22222222-1de9-4ab1-ae6a-0ba08c8c676c"))
+	failureKelvinID      = uuid.Must(uuid.FromString("33333333-1de9-4ab1-ae6a-0ba08c8c676c"))
+	failureReplacementID = uuid.Must(uuid.FromString("44444444-1de9-4ab1-ae6a-0ba08c8c676c"))
+)
+
+func makeSubPlan(sink *planpb.GRPCSinkOperator) *planpb.Plan {
+	return &planpb.Plan{
+		Nodes: []*planpb.PlanFragment{
+			{
+				Nodes: []*planpb.PlanNode{
+					{
+						Op: &planpb.Operator{
+							OpType: planpb.MEMORY_SOURCE_OPERATOR,
+							Op:     &planpb.Operator_MemSourceOp{MemSourceOp: &planpb.MemorySourceOperator{Name: "http_events"}},
+						},
+					},
+					{
+						Op: &planpb.Operator{
+							OpType: planpb.GRPC_SINK_OPERATOR,
+							Op:     &planpb.Operator_GRPCSinkOp{GRPCSinkOp: sink},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// makeAgentsInfo creates the agents info for the given agents, where the PEMs are mapped to their host IPs.
+func makeAgentsInfo(pems map[uuid.UUID]string, kelvins ...uuid.UUID) tracker.AgentsInfo {
+	ds := &distributedpb.DistributedState{}
+	for id := range pems {
+		ds.CarnotInfo = append(ds.CarnotInfo, &distributedpb.CarnotInfo{
+			AgentID:       utils.ProtoFromUUID(id),
+			HasDataStore:  true,
+			ProcessesData: true,
+		})
+	}
+	for _, id := range kelvins {
+		ds.CarnotInfo = append(ds.CarnotInfo, &distributedpb.CarnotInfo{
+			AgentID:              utils.ProtoFromUUID(id),
+			ProcessesData:        true,
+			AcceptsRemoteSources: true,
+		})
+	}
+	return tracker.NewTestAgentsInfoWithHostIPs(ds, pems)
+}
+
+func TestAgentFailureMonitor(t *testing.T) {
+	retryablePlan := makeSubPlan(&planpb.GRPCSinkOperator{
+		Destination: &planpb.GRPCSinkOperator_GRPCSourceID{GRPCSourceID: 1},
+	})
+	resultPlan := makeSubPlan(&planpb.GRPCSinkOperator{
+		Destination: &planpb.GRPCSinkOperator_OutputTable{
+			OutputTable: &planpb.GRPCSinkOperator_ResultTable{TableName: "out"},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		plan       *planpb.Plan
+		maxRetries int
+		// Whether the replacement of PEM 1 registers after it fails.
+		replaced bool
+		// The failures after PEM 1 fails, and after the replacement timeout passes.
+		expectedFailures      []*vizierpb.AgentFailure
+		expectedTimedOut      []*vizierpb.AgentFailure
+		expectRetryDispatched bool
+	}{
+		{
+			name:       "retried on replacement",
+			plan:       retryablePlan,
+			maxRetries: 1,
+			replaced:   true,
+			expectedFailures: []*vizierpb.AgentFailure{
+				{AgentID: failurePEM1ID.String(), RetryAgentID: failureReplacementID.String()},
+			},
+			expectedTimedOut: []*vizierpb.AgentFailure{
+				{AgentID: failurePEM1ID.String(), RetryAgentID: failureReplacementID.String()},
+			},
+			expectRetryDispatched: true,
+		},
+		{
+			name:             "absent without replacement",
+			plan:             retryablePlan,
+			maxRetries:       1,
+			replaced:         false,
+			expectedFailures: nil,
+			expectedTimedOut: []*vizierpb.AgentFailure{
+				{AgentID: failurePEM1ID.String()},
+			},
+		},
+		{
+			name:       "absent if retries are disabled",
+			plan:       retryablePlan,
+			maxRetries: 0,
+			replaced:   true,
+			expectedFailures: []*vizierpb.AgentFailure{
+				{AgentID: failurePEM1ID.String()},
+			},
+			expectedTimedOut: []*vizierpb.AgentFailure{
+				{AgentID: failurePEM1ID.String()},
+			},
+		},
+		{
+			name:       "absent if the plan sends results to the query broker",
+			plan:       resultPlan,
+			maxRetries: 1,
+			replaced:   true,
+			expectedFailures: []*vizierpb.AgentFailure{
+				{AgentID: failurePEM1ID.String()},
+			},
+			expectedTimedOut: []*vizierpb.AgentFailure{
+				{AgentID: failurePEM1ID.String()},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nc, cleanup := testingutils.MustStartTestNATS(t)
+			defer cleanup()
+			sub, err := nc.SubscribeSync(fmt.Sprintf("Agent/%s", failureReplacementID))
+			require.NoError(t, err)
+
+			queryID := uuid.Must(uuid.NewV4())
+			planMap := map[uuid.UUID]*planpb.Plan{
+				failurePEM1ID:   test.plan,
+				failurePEM2ID:   test.plan,
+				failureKelvinID: retryablePlan,
+			}
+			at := &fakeAgentsTracker{
+				agentsInfo: makeAgentsInfo(map[uuid.UUID]string{
+					failurePEM1ID: "10.0.0.1",
+					failurePEM2ID: "10.0.0.2",
+				}, failureKelvinID),
+			}
+			clk := clock.NewFakeClock(time.Unix(0, 0))
+			m := controllers.NewAgentFailureMonitorWithClock(queryID, nc, at, planMap, false, test.maxRetries, 30*time.Second, clk)
+
+			m.Check()
+			assert.Nil(t, m.Failures())
+
+			// PEM 1 fails, and the Kelvin is missing too, which isn't handled by the monitor.
+			pems := map[uuid.UUID]string{failurePEM2ID: "10.0.0.2"}
+			if test.replaced {
+				pems[failureReplacementID] = "10.0.0.1"
+			}
+			at.agentsInfo = makeAgentsInfo(pems)
+
+			m.Check()
+			assert.Equal(t, test.expectedFailures, m.Failures())
+
+			clk.Advance(30 * time.Second)
+			m.Check()
+			assert.Equal(t, test.expectedTimedOut, m.Failures())
+
+			msg, err := sub.NextMsg(100 * time.Millisecond)
+			if !test.expectRetryDispatched {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			vzMsg := &messagespb.VizierMessage{}
+			require.NoError(t, vzMsg.Unmarshal(msg.Data))
+			req := vzMsg.GetExecuteQueryRequest()
+			require.NotNil(t, req)
+			assert.Equal(t, queryID, utils.UUIDFromProtoOrNil(req.QueryID))
+			assert.Equal(t, test.plan, req.Plan)
+		})
+	}
+}
+
+func TestAgentFailureMonitor_MaxRetries(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	plan := makeSubPlan(&planpb.GRPCSinkOperator{
+		Destination: &planpb.GRPCSinkOperator_GRPCSourceID{GRPCSourceID: 1},
+	})
+	planMap := map[uuid.UUID]*planpb.Plan{
+		failurePEM1ID: plan,
+		failurePEM2ID: plan,
+	}
+	at := &fakeAgentsTracker{
+		agentsInfo: makeAgentsInfo(map[uuid.UUID]string{
+			failurePEM1ID: "10.0.0.1",
+			failurePEM2ID: "10.0.0.2",
+		}),
+	}
+	m := controllers.NewAgentFailureMonitorWithClock(uuid.Must(uuid.NewV4()), nc, at, planMap, false, 1, 30*time.Second,
+		clock.NewFakeClock(time.Unix(0, 0)))
+
+	// Both PEMs fail and are replaced, but only one of them can be retried.
+	replacement2ID := uuid.Must(uuid.FromString("55555555-1de9-4ab1-ae6a-0ba08c8c676c"))
+	at.agentsInfo = makeAgentsInfo(map[uuid.UUID]string{
+		failureReplacementID: "10.0.0.1",
+		replacement2ID:       "10.0.0.2",
+	})
+	m.Check()
+	assert.Equal(t, []*vizierpb.AgentFailure{
+		{AgentID: failurePEM1ID.String(), RetryAgentID: failureReplacementID.String()},
+		{AgentID: failurePEM2ID.String()},
+	}, m.Failures())
+
+	// The replacement fails as well.
+	at.agentsInfo = makeAgentsInfo(map[uuid.UUID]string{
+		replacement2ID: "10.0.0.2",
+	})
+	m.Check()
+	assert.Equal(t, []*vizierpb.AgentFailure{
+		{AgentID: failurePEM1ID.String(), RetryAgentID: failureReplacementID.String()},
+		{AgentID: failurePEM2ID.String()},
+		{AgentID: failureReplacementID.String()},
+	}, m.Failures())
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/yaml"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/shared/services/authcontext"
+)
+
+// ErrQueryQueueFull occurs when a script can't run because all of the slots are taken, and too many scripts are
+// already waiting for one.
+var ErrQueryQueueFull = status.Error(codes.ResourceExhausted, "too many scripts are running, and the queue of scripts waiting to run is full")
+
+var queryAdmissionCounter = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "query_admissions",
+		Help: "The number of scripts that asked to run, by result (admitted, queued or rejected).",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	pflag.Int("max_concurrent_queries", 0, "The most scripts that run at once. Scripts beyond it wait in a queue. 0 disables the limit.")
+	pflag.Int("max_concurrent_queries_per_user", 0, "The most scripts of a single user that run at once, so that one user "+
+		"can't take up all of the slots. 0 disables the limit.")
+	pflag.Int("max_queued_queries", 100, "The most scripts that wait for a slot to run, before new scripts are rejected.")
+	pflag.Duration("max_query_queue_time", 30*time.Second, "How long a script waits for a slot to run, before it is rejected. "+
+		"0 waits until the script is cancelled.")
+	pflag.Duration("max_query_execution_time", 0, "How long a script may run, before it is cancelled. 0 disables the limit.")
+	pflag.Int64("max_query_result_bytes", 0, "The most bytes of results that a script may return, before it is cancelled. "+
+		"0 disables the limit.")
+	pflag.String("query_limit_overrides_file", "", "Path to a YAML file with the limits of specific orgs and users, which "+
+		"take precedence over the max_* flags.")
+}
+
+// QueryLimits are the limits on the scripts that the query broker runs, so that heavy scripts can't starve the rest
+// of the cluster.
+type QueryLimits struct {
+	// MaxConcurrent is the most scripts that run at once. 0 means no limit.
+	MaxConcurrent int
+	// MaxConcurrentPerUser is the most scripts of a single user that run at once. 0 means no limit. Scripts that
+	// weren't made by a user, like cron scripts, only count towards MaxConcurrent.
+	MaxConcurrentPerUser int
+	// MaxQueued is the most scripts that wait for a slot to run.
+	MaxQueued int
+	// MaxQueueTime is how long a script waits for a slot to run. 0 means that it waits until it's cancelled.
+	MaxQueueTime time.Duration
+	// MaxExecutionTime is how long a script may run. 0 means no limit.
+	MaxExecutionTime time.Duration
+	// MaxResultBytes is the most bytes of results that a script may return. 0 means no limit.
+	MaxResultBytes int64
+	// Overrides are the limits of specific orgs and users.
+	Overrides QueryLimitOverrides
+}
+
+// QueryLimitOverrides are the limits of specific orgs and users, keyed by their IDs. The limits of a user take
+// precedence over the limits of their org, which take precedence over the QueryLimits.
+type QueryLimitOverrides struct {
+	Orgs  map[string]RequesterLimits `json:"orgs"`
+	Users map[string]RequesterLimits `json:"users"`
+}
+
+// RequesterLimits are the limits of the scripts of an org or user. Unset limits are inherited, and 0 means no limit.
+type RequesterLimits struct {
+	// MaxConcurrent is the most scripts of the org or user that run at once. For a user, it replaces
+	// MaxConcurrentPerUser.
+	MaxConcurrent *int `json:"maxConcurrent"`
+	// MaxExecutionTime is how long a script of the org or user may run.
+	MaxExecutionTime *Duration `json:"maxExecutionTime"`
+	// MaxResultBytes is the most bytes of results that a script of the org or user may return.
+	MaxResultBytes *int64 `json:"maxResultBytes"`
+}
+
+// Duration is a time.Duration that is written as a string, like "1m30s", in the query limit overrides.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses the duration from a string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// LoadQueryLimitOverrides reads the limits of specific orgs and users from a YAML or JSON file.
+func LoadQueryLimitOverrides(path string) (QueryLimitOverrides, error) {
+	var o QueryLimitOverrides
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return o, err
+	}
+	if err := yaml.Unmarshal(b, &o); err != nil {
+		return o, fmt.Errorf("failed to parse query limit overrides %s: %w", path, err)
+	}
+	return o, nil
+}
+
+// requester is the org and user that a script is run for, which are empty if it wasn't made by a user.
+type requester struct {
+	orgID  string
+	userID string
+}
+
+// requesterOf returns who a script is run for, from the verified claims of the request. Requests from Pixie Cloud
+// carry the user that their cluster token was issued to.
+func requesterOf(ctx context.Context) requester {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil || sCtx.Claims == nil {
+		return requester{}
+	}
+	if c := sCtx.Claims.GetUserClaims(); c != nil {
+		return requester{orgID: c.OrgID, userID: c.UserID}
+	}
+	c := sCtx.Claims.GetClusterClaims()
+	return requester{orgID: c.GetRequesterOrgID(), userID: c.GetRequesterUserID()}
+}
+
+// forRequester returns the execution time and result size limits of the scripts of the requester.
+func (l *QueryLimits) forRequester(r requester) (maxExecutionTime time.Duration, maxResultBytes int64) {
+	maxExecutionTime, maxResultBytes = l.MaxExecutionTime, l.MaxResultBytes
+	apply := func(o RequesterLimits) {
+		if o.MaxExecutionTime != nil {
+			maxExecutionTime = o.MaxExecutionTime.Duration
+		}
+		if o.MaxResultBytes != nil {
+			maxResultBytes = *o.MaxResultBytes
+		}
+	}
+	if r.orgID != "" {
+		apply(l.Overrides.Orgs[r.orgID])
+	}
+	if r.userID != "" {
+		apply(l.Overrides.Users[r.userID])
+	}
+	return maxExecutionTime, maxResultBytes
+}
+
+// QueryAdmission decides when scripts may run under the QueryLimits. Scripts that can't run yet wait in a queue,
+// and are admitted in order as slots free up, skipping the scripts of orgs and users that are at their own limit.
+type QueryAdmission struct {
+	limits QueryLimits
+
+	mu            sync.Mutex
+	running       int
+	runningByOrg  map[string]int
+	runningByUser map[string]int
+	// queue holds the scripts that wait for a slot, oldest first.
+	queue *list.List
+}
+
+type queryWaiter struct {
+	requester requester
+	admitted  chan struct{}
+}
+
+// NewQueryAdmission creates a new QueryAdmission.
+func NewQueryAdmission(limits QueryLimits) *QueryAdmission {
+	return &QueryAdmission{
+		limits:        limits,
+		runningByOrg:  make(map[string]int),
+		runningByUser: make(map[string]int),
+		queue:         list.New(),
+	}
+}
+
+func (a *QueryAdmission) canRunLocked(r requester) bool {
+	if a.limits.MaxConcurrent > 0 && a.running >= a.limits.MaxConcurrent {
+		return false
+	}
+	if r.orgID != "" {
+		if max := a.limits.Overrides.Orgs[r.orgID].MaxConcurrent; max != nil && *max > 0 && a.runningByOrg[r.orgID] >= *max {
+			return false
+		}
+	}
+	if r.userID != "" {
+		max := a.limits.MaxConcurrentPerUser
+		if o := a.limits.Overrides.Users[r.userID].MaxConcurrent; o != nil {
+			max = *o
+		}
+		if max > 0 && a.runningByUser[r.userID] >= max {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *QueryAdmission) startLocked(r requester) {
+	a.running++
+	if r.orgID != "" {
+		a.runningByOrg[r.orgID]++
+	}
+	if r.userID != "" {
+		a.runningByUser[r.userID]++
+	}
+}
+
+// admit waits until a script of the requester may run, and returns the func that frees its slot once it's done.
+func (a *QueryAdmission) admit(ctx context.Context, r requester) (func(), error) {
+	release := func() { a.release(r) }
+
+	a.mu.Lock()
+	if a.canRunLocked(r) {
+		a.startLocked(r)
+		a.mu.Unlock()
+		queryAdmissionCounter.With(prometheus.Labels{"result": "admitted"}).Inc()
+		return release, nil
+	}
+	if a.queue.Len() >= a.limits.MaxQueued {
+		a.mu.Unlock()
+		queryAdmissionCounter.With(prometheus.Labels{"result": "rejected"}).Inc()
+		return nil, ErrQueryQueueFull
+	}
+	w := &queryWaiter{requester: r, admitted: make(chan struct{})}
+	e := a.queue.PushBack(w)
+	a.mu.Unlock()
+	queryAdmissionCounter.With(prometheus.Labels{"result": "queued"}).Inc()
+
+	var timeout <-chan time.Time
+	if a.limits.MaxQueueTime > 0 {
+		t := time.NewTimer(a.limits.MaxQueueTime)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case <-w.admitted:
+		return release, nil
+	case <-ctx.Done():
+		err = status.FromContextError(ctx.Err()).Err()
+	case <-timeout:
+		queryAdmissionCounter.With(prometheus.Labels{"result": "rejected"}).Inc()
+		err = status.Errorf(codes.ResourceExhausted, "timed out after %s waiting for a slot to run the script", a.limits.MaxQueueTime)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-w.admitted:
+		// The script was admitted as it gave up, so its slot goes to the next script.
+		a.releaseLocked(r)
+	default:
+		a.queue.Remove(e)
+	}
+	return nil, err
+}
+
+func (a *QueryAdmission) release(r requester) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.releaseLocked(r)
+}
+
+func decrementRunning(running map[string]int, id string) {
+	if id == "" {
+		return
+	}
+	running[id]--
+	if running[id] == 0 {
+		delete(running, id)
+	}
+}
+
+func (a *QueryAdmission) releaseLocked(r requester) {
+	a.running--
+	decrementRunning(a.runningByOrg, r.orgID)
+	decrementRunning(a.runningByUser, r.userID)
+
+	for e := a.queue.Front(); e != nil; {
+		if a.limits.MaxConcurrent > 0 && a.running >= a.limits.MaxConcurrent {
+			return
+		}
+		next := e.Next()
+		w := e.Value.(*queryWaiter)
+		if a.canRunLocked(w.requester) {
+			a.queue.Remove(e)
+			a.startLocked(w.requester)
+			close(w.admitted)
+		}
+		e = next
+	}
+}
+
+// resultLimitConsumer cancels the script once its results are larger than the limit, and passes them on to the
+// wrapped consumer until then.
+type resultLimitConsumer struct {
+	c        QueryResultConsumer
+	maxBytes int64
+	size     int64
+}
+
+func newResultLimitConsumer(c QueryResultConsumer, maxBytes int64) *resultLimitConsumer {
+	return &resultLimitConsumer{c: c, maxBytes: maxBytes}
+}
+
+func (r *resultLimitConsumer) Consume(result *vizierpb.ExecuteScriptResponse) error {
+	if batch := result.GetData().GetBatch(); batch != nil {
+		r.size += int64(batch.Size())
+		if r.size > r.maxBytes {
+			return status.Errorf(codes.ResourceExhausted, "the results of the script are larger than the limit of %s",
+				humanize.IBytes(uint64(r.maxBytes)))
+		}
+	}
+	return r.c.Consume(result)
+}
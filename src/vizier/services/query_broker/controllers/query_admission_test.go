@@ -0,0 +1,314 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	mock_vizierpb "px.dev/pixie/src/api/proto/vizierpb/mock"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/jwtpb"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+// blockingQueryExecutor runs until it's finished by the test, or its context is done.
+type blockingQueryExecutor struct {
+	ctx  context.Context
+	done chan struct{}
+}
+
+func (q *blockingQueryExecutor) Run(ctx context.Context, req *vizierpb.ExecuteScriptRequest, consumer controllers.QueryResultConsumer) error {
+	q.ctx = ctx
+	return nil
+}
+
+func (q *blockingQueryExecutor) Wait() error {
+	select {
+	case <-q.done:
+		return nil
+	case <-q.ctx.Done():
+		return q.ctx.Err()
+	}
+}
+
+func (q *blockingQueryExecutor) QueryID() uuid.UUID {
+	return uuid.Nil
+}
+
+type queryAdmissionTest struct {
+	t      *testing.T
+	server *controllers.Server
+	// started receives the executor of each script once it was admitted.
+	started chan *blockingQueryExecutor
+}
+
+func newQueryAdmissionTest(t *testing.T, limits controllers.QueryLimits) *queryAdmissionTest {
+	qt := &queryAdmissionTest{t: t, started: make(chan *blockingQueryExecutor, 10)}
+	queryExecFactory := func(*controllers.Server, controllers.MutationExecFactory) controllers.QueryExecutor {
+		q := &blockingQueryExecutor{done: make(chan struct{})}
+		qt.started <- q
+		return q
+	}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, &fakeDataPrivacy{}, nil, nil, nil, nil, nil, queryExecFactory)
+	require.NoError(t, err)
+	s.SetQueryAdmission(controllers.NewQueryAdmission(limits))
+	qt.server = s
+	return qt
+}
+
+// execute runs a script for the user of the org "org" in the background, and returns the channel that receives its
+// error. The script isn't made by a user if the user is empty.
+func (qt *queryAdmissionTest) execute(user string) chan error {
+	if user == "" {
+		return qt.executeFor("", "")
+	}
+	return qt.executeFor("org", user)
+}
+
+// executeFor runs a script for the user of the org in the background, like it was proxied by Pixie Cloud with a
+// cluster token that names the user.
+func (qt *queryAdmissionTest) executeFor(org, user string) chan error {
+	ctrl := gomock.NewController(qt.t)
+	srv := mock_vizierpb.NewMockVizierService_ExecuteScriptServer(ctrl)
+	sCtx := authcontext.New()
+	sCtx.Claims = &jwtpb.JWTClaims{
+		Scopes: []string{"cluster"},
+		CustomClaims: &jwtpb.JWTClaims_ClusterClaims{
+			ClusterClaims: &jwtpb.ClusterJWTClaims{
+				ClusterID:       "test",
+				RequesterOrgID:  org,
+				RequesterUserID: user,
+			},
+		},
+	}
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+	srv.EXPECT().Send(gomock.Any()).Return(nil).AnyTimes()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- qt.server.ExecuteScript(&vizierpb.ExecuteScriptRequest{QueryStr: "import px"}, srv)
+	}()
+	return errCh
+}
+
+func (qt *queryAdmissionTest) expectStarted() *blockingQueryExecutor {
+	select {
+	case q := <-qt.started:
+		return q
+	case <-time.After(5 * time.Second):
+		qt.t.Fatal("Timed out waiting for the script to start")
+		return nil
+	}
+}
+
+func (qt *queryAdmissionTest) expectNotStarted() {
+	select {
+	case <-qt.started:
+		qt.t.Fatal("The script started before a slot was free")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectQueryError(t *testing.T, errCh chan error, code codes.Code) {
+	select {
+	case err := <-errCh:
+		assert.Equal(t, code, status.Code(err), err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the script to finish")
+	}
+}
+
+func TestQueryAdmission_Queue(t *testing.T) {
+	qt := newQueryAdmissionTest(t, controllers.QueryLimits{MaxConcurrent: 1, MaxQueued: 1, MaxQueueTime: 5 * time.Second})
+
+	first := qt.execute("user1")
+	running := qt.expectStarted()
+	second := qt.execute("user2")
+	qt.expectNotStarted()
+
+	// The queue is full.
+	expectQueryError(t, qt.execute("user3"), codes.ResourceExhausted)
+
+	close(running.done)
+	expectQueryError(t, first, codes.OK)
+	close(qt.expectStarted().done)
+	expectQueryError(t, second, codes.OK)
+}
+
+func TestQueryAdmission_QueueTimeout(t *testing.T) {
+	qt := newQueryAdmissionTest(t, controllers.QueryLimits{MaxConcurrent: 1, MaxQueued: 1, MaxQueueTime: 50 * time.Millisecond})
+
+	first := qt.execute("user1")
+	running := qt.expectStarted()
+	expectQueryError(t, qt.execute("user1"), codes.ResourceExhausted)
+
+	// The slot of the script that timed out isn't taken.
+	close(running.done)
+	expectQueryError(t, first, codes.OK)
+	third := qt.execute("user1")
+	close(qt.expectStarted().done)
+	expectQueryError(t, third, codes.OK)
+}
+
+func TestQueryAdmission_PerUser(t *testing.T) {
+	qt := newQueryAdmissionTest(t, controllers.QueryLimits{MaxConcurrentPerUser: 1, MaxQueued: 10, MaxQueueTime: 5 * time.Second})
+
+	first := qt.execute("user1")
+	running := qt.expectStarted()
+	second := qt.execute("user1")
+	qt.expectNotStarted()
+
+	// Other users, and the scripts that weren't made by a user, aren't held up by the user at their limit.
+	other := qt.execute("user2")
+	close(qt.expectStarted().done)
+	expectQueryError(t, other, codes.OK)
+	internal := qt.execute("")
+	close(qt.expectStarted().done)
+	expectQueryError(t, internal, codes.OK)
+
+	close(running.done)
+	expectQueryError(t, first, codes.OK)
+	close(qt.expectStarted().done)
+	expectQueryError(t, second, codes.OK)
+}
+
+func TestQueryAdmission_Overrides(t *testing.T) {
+	one := 1
+	three := 3
+	qt := newQueryAdmissionTest(t, controllers.QueryLimits{
+		MaxConcurrentPerUser: 1,
+		MaxQueued:            10,
+		MaxQueueTime:         5 * time.Second,
+		Overrides: controllers.QueryLimitOverrides{
+			Orgs:  map[string]controllers.RequesterLimits{"small-org": {MaxConcurrent: &one}},
+			Users: map[string]controllers.RequesterLimits{"power-user": {MaxConcurrent: &three}},
+		},
+	})
+
+	// The org limit holds up the other users of the org.
+	first := qt.executeFor("small-org", "user1")
+	running := qt.expectStarted()
+	second := qt.executeFor("small-org", "user2")
+	qt.expectNotStarted()
+
+	// The users with an override may run more scripts than MaxConcurrentPerUser.
+	var power []chan error
+	for i := 0; i < 3; i++ {
+		power = append(power, qt.executeFor("org", "power-user"))
+		close(qt.expectStarted().done)
+	}
+	for _, errCh := range power {
+		expectQueryError(t, errCh, codes.OK)
+	}
+
+	close(running.done)
+	expectQueryError(t, first, codes.OK)
+	close(qt.expectStarted().done)
+	expectQueryError(t, second, codes.OK)
+}
+
+func TestQueryAdmission_OverrideExecutionTime(t *testing.T) {
+	short := controllers.Duration{Duration: 50 * time.Millisecond}
+	qt := newQueryAdmissionTest(t, controllers.QueryLimits{
+		MaxExecutionTime: time.Hour,
+		Overrides: controllers.QueryLimitOverrides{
+			Orgs: map[string]controllers.RequesterLimits{"org": {MaxExecutionTime: &short}},
+		},
+	})
+
+	errCh := qt.execute("user1")
+	qt.expectStarted()
+	expectQueryError(t, errCh, codes.ResourceExhausted)
+}
+
+func TestLoadQueryLimitOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+orgs:
+  org1:
+    maxConcurrent: 2
+    maxExecutionTime: 1m30s
+users:
+  user1:
+    maxResultBytes: 1024
+`), 0o600))
+
+	o, err := controllers.LoadQueryLimitOverrides(path)
+	require.NoError(t, err)
+	require.Contains(t, o.Orgs, "org1")
+	assert.Equal(t, 2, *o.Orgs["org1"].MaxConcurrent)
+	assert.Equal(t, 90*time.Second, o.Orgs["org1"].MaxExecutionTime.Duration)
+	assert.Nil(t, o.Orgs["org1"].MaxResultBytes)
+	require.Contains(t, o.Users, "user1")
+	assert.Equal(t, int64(1024), *o.Users["user1"].MaxResultBytes)
+
+	require.NoError(t, os.WriteFile(path, []byte("orgs: {org1: {maxExecutionTime: soon}}"), 0o600))
+	_, err = controllers.LoadQueryLimitOverrides(path)
+	assert.Error(t, err)
+}
+
+func TestQueryAdmission_ExecutionTime(t *testing.T) {
+	qt := newQueryAdmissionTest(t, controllers.QueryLimits{MaxExecutionTime: 50 * time.Millisecond})
+
+	errCh := qt.execute("user1")
+	qt.expectStarted()
+	expectQueryError(t, errCh, codes.ResourceExhausted)
+}
+
+func TestQueryAdmission_ResultBytes(t *testing.T) {
+	queryID := uuid.Must(uuid.NewV4())
+	results := buildExecuteScriptSuccessResponses(queryID)
+	queryExecFactory := func(*controllers.Server, controllers.MutationExecFactory) controllers.QueryExecutor {
+		return &fakeQueryExecutor{ResultsToSend: results, queryID: queryID}
+	}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, &fakeDataPrivacy{}, nil, nil, nil, nil, nil, queryExecFactory)
+	require.NoError(t, err)
+	s.SetQueryAdmission(controllers.NewQueryAdmission(controllers.QueryLimits{MaxResultBytes: 1}))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := mock_vizierpb.NewMockVizierService_ExecuteScriptServer(ctrl)
+	srv.EXPECT().Context().Return(authcontext.NewContext(context.Background(), authcontext.New())).AnyTimes()
+	var resps []*vizierpb.ExecuteScriptResponse
+	srv.EXPECT().
+		Send(gomock.Any()).
+		DoAndReturn(func(arg *vizierpb.ExecuteScriptResponse) error {
+			resps = append(resps, arg)
+			return nil
+		}).
+		AnyTimes()
+
+	err = s.ExecuteScript(&vizierpb.ExecuteScriptRequest{QueryStr: "import px"}, srv)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// The results before the first row batch are still sent.
+	assert.Less(t, len(resps), len(results))
+}
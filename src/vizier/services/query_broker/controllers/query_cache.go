@@ -0,0 +1,261 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/pflag"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/shared/services/clock"
+)
+
+var queryCacheLookupCounter = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "query_cache_lookups",
+		Help: "The number of lookups of script results in the query cache, by result (hit or miss).",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	pflag.Duration("query_cache_ttl", 0, "How long the results of scripts are cached, so that repeated executions of a script "+
+		"with the same args return the cached results instead of running the script again. 0 disables the cache.")
+	pflag.Int64("query_cache_max_bytes", 256*1024*1024, "The most bytes of script results that are cached.")
+}
+
+// QueryCache caches the results of scripts, keyed by the normalized script, its args and configs, and the time
+// window the script ran in. The windows are as long as the TTL, so a script with relative time args returns
+// fresh results at least once per TTL. Mutations, resumed queries, and scripts that export data or write to a
+// result sink are never cached.
+type QueryCache struct {
+	ttl      time.Duration
+	maxBytes int64
+	clock    clock.Clock
+
+	mu sync.Mutex
+	// entries holds the elements of order by key.
+	entries map[string]*list.Element
+	// order holds the entries from oldest to newest. Since all entries have the same TTL, they also expire
+	// in this order.
+	order *list.List
+	bytes int64
+}
+
+type queryCacheEntry struct {
+	key       string
+	responses []*vizierpb.ExecuteScriptResponse
+	size      int64
+	expiresAt time.Time
+}
+
+// NewQueryCache creates a new QueryCache.
+func NewQueryCache(ttl time.Duration, maxBytes int64) *QueryCache {
+	return NewQueryCacheWithClock(ttl, maxBytes, clock.New())
+}
+
+// NewQueryCacheWithClock creates a new QueryCache which uses the given clock to pick the time window and expire
+// the entries.
+func NewQueryCacheWithClock(ttl time.Duration, maxBytes int64, clk clock.Clock) *QueryCache {
+	return &QueryCache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		clock:    clk,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// normalizeScript drops the comments, blank lines and trailing whitespace from a PxL script, so that
+// scripts that only differ in formatting share their cache entries.
+func normalizeScript(script string) string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func hashString(h hash.Hash, s string) {
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(len(s)))
+	h.Write(l[:])
+	h.Write([]byte(s))
+}
+
+func hashInt(h hash.Hash, i int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(i))
+	h.Write(b[:])
+}
+
+// key returns the cache key of the request, or false if the results of the request can't be cached.
+func (c *QueryCache) key(req *vizierpb.ExecuteScriptRequest) (string, bool) {
+	if req.Mutation || req.QueryID != "" || req.Configs.GetResultSinkConfig() != nil {
+		return "", false
+	}
+	script := normalizeScript(req.QueryStr)
+	// Exports are side effects of running the script, which replaying the results would skip.
+	if req.Configs.GetOTelEndpointConfig() != nil || strings.Contains(script, "px.export") {
+		return "", false
+	}
+
+	h := sha256.New()
+	hashString(h, script)
+	hashInt(h, int64(len(req.ExecFuncs)))
+	for _, f := range req.ExecFuncs {
+		hashString(h, f.FuncName)
+		hashString(h, f.OutputTablePrefix)
+		args := make([]*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue, len(f.ArgValues))
+		copy(args, f.ArgValues)
+		sort.Slice(args, func(i, j int) bool { return args[i].Name < args[j].Name })
+		hashInt(h, int64(len(args)))
+		for _, arg := range args {
+			hashString(h, arg.Name)
+			hashString(h, arg.Value)
+		}
+	}
+
+	if plugin := req.Configs.GetPluginConfig(); plugin != nil {
+		hashInt(h, plugin.StartTimeNs)
+		hashInt(h, plugin.EndTimeNs)
+	} else {
+		hashInt(h, -1)
+	}
+
+	hashInt(h, c.clock.Now().Truncate(c.ttl).UnixNano())
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// removeExpiredLocked drops the entries that expired.
+func (c *QueryCache) removeExpiredLocked(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		if e.Value.(*queryCacheEntry).expiresAt.After(now) {
+			return
+		}
+		c.removeLocked(e)
+	}
+}
+
+func (c *QueryCache) removeLocked(e *list.Element) {
+	entry := c.order.Remove(e).(*queryCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *QueryCache) get(key string) []*vizierpb.ExecuteScriptResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeExpiredLocked(c.clock.Now())
+	e, ok := c.entries[key]
+	if !ok {
+		queryCacheLookupCounter.With(prometheus.Labels{"result": "miss"}).Inc()
+		return nil
+	}
+	queryCacheLookupCounter.With(prometheus.Labels{"result": "hit"}).Inc()
+	return e.Value.(*queryCacheEntry).responses
+}
+
+func (c *QueryCache) put(key string, responses []*vizierpb.ExecuteScriptResponse, size int64) {
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	c.removeExpiredLocked(now)
+	if e, ok := c.entries[key]; ok {
+		// Another execution of the same script finished first.
+		c.removeLocked(e)
+	}
+	for c.bytes+size > c.maxBytes {
+		c.removeLocked(c.order.Front())
+	}
+
+	c.entries[key] = c.order.PushBack(&queryCacheEntry{
+		key:       key,
+		responses: responses,
+		size:      size,
+		expiresAt: now.Add(c.ttl),
+	})
+	c.bytes += size
+}
+
+// queryCacheConsumer records the results of a script for the query cache, and passes them on to the wrapped
+// consumer.
+type queryCacheConsumer struct {
+	c        QueryResultConsumer
+	maxBytes int64
+
+	responses []*vizierpb.ExecuteScriptResponse
+	size      int64
+	// tooLarge is set once the results no longer fit in the cache.
+	tooLarge bool
+}
+
+func newQueryCacheConsumer(c QueryResultConsumer, maxBytes int64) *queryCacheConsumer {
+	return &queryCacheConsumer{c: c, maxBytes: maxBytes}
+}
+
+func (q *queryCacheConsumer) Consume(result *vizierpb.ExecuteScriptResponse) error {
+	// The progress of the query is meaningless once it finished.
+	if result.Progress == nil && !q.tooLarge {
+		// The consumers down the line may modify the result, so keep a copy of it.
+		resp := proto.Clone(result).(*vizierpb.ExecuteScriptResponse)
+		q.size += int64(resp.Size())
+		if q.size > q.maxBytes {
+			q.tooLarge = true
+			q.responses = nil
+		} else {
+			q.responses = append(q.responses, resp)
+		}
+	}
+	return q.c.Consume(result)
+}
+
+// replayCachedResults sends cached results to the consumer, as the results of a new query.
+func replayCachedResults(responses []*vizierpb.ExecuteScriptResponse, consumer QueryResultConsumer) error {
+	queryID := uuid.Must(uuid.NewV4()).String()
+	for _, cached := range responses {
+		resp := proto.Clone(cached).(*vizierpb.ExecuteScriptResponse)
+		resp.QueryID = queryID
+		if err := consumer.Consume(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	mock_vizierpb "px.dev/pixie/src/api/proto/vizierpb/mock"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+type queryCacheTest struct {
+	t       *testing.T
+	clock   *clock.FakeClock
+	server  *controllers.Server
+	queryID uuid.UUID
+	// numRuns is the number of scripts that were actually run.
+	numRuns   int
+	waitError error
+}
+
+func newQueryCacheTest(t *testing.T, maxBytes int64) *queryCacheTest {
+	qt := &queryCacheTest{
+		t:       t,
+		clock:   clock.NewFakeClock(time.Unix(0, 0)),
+		queryID: uuid.Must(uuid.NewV4()),
+	}
+	queryExecFactory := func(*controllers.Server, controllers.MutationExecFactory) controllers.QueryExecutor {
+		qt.numRuns++
+		return &fakeQueryExecutor{
+			ResultsToSend: buildExecuteScriptSuccessResponses(qt.queryID),
+			WaitError:     qt.waitError,
+			queryID:       qt.queryID,
+		}
+	}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, &fakeDataPrivacy{}, nil, nil, nil, nil, nil, queryExecFactory)
+	require.NoError(t, err)
+	s.SetQueryCache(controllers.NewQueryCacheWithClock(time.Minute, maxBytes, qt.clock))
+	qt.server = s
+	return qt
+}
+
+func (qt *queryCacheTest) execute(req *vizierpb.ExecuteScriptRequest) ([]*vizierpb.ExecuteScriptResponse, error) {
+	ctrl := gomock.NewController(qt.t)
+	defer ctrl.Finish()
+	srv := mock_vizierpb.NewMockVizierService_ExecuteScriptServer(ctrl)
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+
+	var resps []*vizierpb.ExecuteScriptResponse
+	srv.EXPECT().
+		Send(gomock.Any()).
+		DoAndReturn(func(arg *vizierpb.ExecuteScriptResponse) error {
+			resps = append(resps, arg)
+			return nil
+		}).
+		AnyTimes()
+
+	err := qt.server.ExecuteScript(req, srv)
+	return resps, err
+}
+
+func scriptRequest(script string, args map[string]string) *vizierpb.ExecuteScriptRequest {
+	req := &vizierpb.ExecuteScriptRequest{QueryStr: script}
+	if args == nil {
+		return req
+	}
+	f := &vizierpb.ExecuteScriptRequest_FuncToExecute{FuncName: "main", OutputTablePrefix: "main"}
+	for k, v := range args {
+		f.ArgValues = append(f.ArgValues, &vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{Name: k, Value: v})
+	}
+	req.ExecFuncs = []*vizierpb.ExecuteScriptRequest_FuncToExecute{f}
+	return req
+}
+
+func TestQueryCache_Hit(t *testing.T) {
+	qt := newQueryCacheTest(t, 1024*1024)
+
+	first, err := qt.execute(scriptRequest("import px\n\ndef main(start):\n  return px.DataFrame('http_events')\n",
+		map[string]string{"start": "-5m", "svc": "a"}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, qt.numRuns)
+	assert.Equal(t, buildExecuteScriptSuccessResponses(qt.queryID), first)
+
+	// Only differs in formatting and the order of the args.
+	second, err := qt.execute(scriptRequest("# A comment.\nimport px\ndef main(start):  \n  return px.DataFrame('http_events')",
+		map[string]string{"svc": "a", "start": "-5m"}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, qt.numRuns)
+	require.Len(t, second, len(first))
+
+	// The cached results are returned as the results of a new query.
+	newQueryID := second[0].QueryID
+	assert.NotEqual(t, qt.queryID.String(), newQueryID)
+	for i := range first {
+		assert.Equal(t, newQueryID, second[i].QueryID)
+		second[i].QueryID = first[i].QueryID
+		assert.Equal(t, first[i], second[i])
+	}
+}
+
+func TestQueryCache_Miss(t *testing.T) {
+	qt := newQueryCacheTest(t, 1024*1024)
+	_, err := qt.execute(scriptRequest("import px", map[string]string{"start": "-5m"}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		req       *vizierpb.ExecuteScriptRequest
+		cacheable bool
+	}{
+		{
+			name:      "other args",
+			req:       scriptRequest("import px", map[string]string{"start": "-10m"}),
+			cacheable: true,
+		},
+		{
+			name:      "other script",
+			req:       scriptRequest("import pxtrace", map[string]string{"start": "-5m"}),
+			cacheable: true,
+		},
+		{
+			name: "mutation",
+			req: &vizierpb.ExecuteScriptRequest{
+				QueryStr: "import px",
+				Mutation: true,
+			},
+		},
+		{
+			name: "export",
+			req:  scriptRequest("import px\npx.export(df, px.otel.Data())", nil),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := qt.numRuns
+			_, err := qt.execute(test.req)
+			require.NoError(t, err)
+			assert.Equal(t, before+1, qt.numRuns)
+
+			_, err = qt.execute(test.req)
+			require.NoError(t, err)
+			if test.cacheable {
+				assert.Equal(t, before+1, qt.numRuns)
+			} else {
+				assert.Equal(t, before+2, qt.numRuns)
+			}
+		})
+	}
+}
+
+func TestQueryCache_Expires(t *testing.T) {
+	qt := newQueryCacheTest(t, 1024*1024)
+	req := scriptRequest("import px", nil)
+
+	_, err := qt.execute(req)
+	require.NoError(t, err)
+	_, err = qt.execute(req)
+	require.NoError(t, err)
+	assert.Equal(t, 1, qt.numRuns)
+
+	qt.clock.Advance(time.Minute)
+	_, err = qt.execute(req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, qt.numRuns)
+}
+
+func TestQueryCache_FailedQueryNotCached(t *testing.T) {
+	qt := newQueryCacheTest(t, 1024*1024)
+	qt.waitError = fmt.Errorf("an error")
+	req := scriptRequest("import px", nil)
+
+	_, err := qt.execute(req)
+	require.Error(t, err)
+
+	qt.waitError = nil
+	_, err = qt.execute(req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, qt.numRuns)
+}
+
+func TestQueryCache_MaxBytes(t *testing.T) {
+	// The results don't fit in the cache.
+	qt := newQueryCacheTest(t, 16)
+	req := scriptRequest("import px", nil)
+
+	resps, err := qt.execute(req)
+	require.NoError(t, err)
+	assert.Equal(t, buildExecuteScriptSuccessResponses(qt.queryID), resps)
+	_, err = qt.execute(req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, qt.numRuns)
+}
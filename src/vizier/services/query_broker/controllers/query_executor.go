@@ -46,6 +46,7 @@ import (
 
 var queryExecTimeSummary *prometheus.SummaryVec
 var queryExecNumPEMSummary *prometheus.SummaryVec
+var queryExecResultCounter *prometheus.CounterVec
 
 func init() {
 	queryExecTimeSummary = promauto.NewSummaryVec(
@@ -64,6 +65,13 @@ func init() {
 		},
 		[]string{"script_name"},
 	)
+	queryExecResultCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "query_exec_results",
+			Help: "The number of queries that finished, by result. Queries that were cancelled or invalid are not failures of Vizier, and are counted separately.",
+		},
+		[]string{"result"},
+	)
 	pflag.String("cloud_addr", "vzconn-service.plc.svc:51600", "The Pixie Cloud service url (load balancer/list is ok)")
 }
 
@@ -115,6 +123,12 @@ type QueryExecutorImpl struct {
 	queryName string
 	// numPEMsQueried is stored so that the prometheus metric is only updated if the query succeeded.
 	numPEMsQueried int
+	// progress tracks the progress of the query, if the request asked for it to be streamed.
+	progress *queryProgressTracker
+	// stats collects the tables, namespaces and cost of the query, for the query stats.
+	stats *queryStatsRecorder
+	// agentFailures handles the PEMs that fail while the query is running, and is reported in the execution stats.
+	agentFailures *AgentFailureMonitor
 }
 
 // NewQueryExecutorFromServer creates a new QueryExecutor using the properties of a query broker server.
@@ -184,6 +198,10 @@ func (q *QueryExecutorImpl) Run(ctx context.Context, req *vizierpb.ExecuteScript
 	if q.queryName == "" {
 		q.queryName = "unnamed"
 	}
+	if req.StreamProgress {
+		q.progress = newQueryProgressTracker()
+	}
+	q.stats = newQueryStatsRecorder(req, q.queryName)
 
 	resultCh := make(chan *vizierpb.ExecuteScriptResponse)
 
@@ -195,9 +213,29 @@ func (q *QueryExecutorImpl) Run(ctx context.Context, req *vizierpb.ExecuteScript
 	return nil
 }
 
+// queryResult returns the result label of a query that finished with the given error.
+func queryResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case strings.Contains(err.Error(), "InvalidArgument"):
+		return "invalid"
+	default:
+		return "error"
+	}
+}
+
 // Wait waits for the query to finish or error.
 func (q *QueryExecutorImpl) Wait() error {
 	err := q.eg.Wait()
+	queryExecResultCounter.With(prometheus.Labels{"result": queryResult(err)}).Inc()
+	if q.stats != nil {
+		if pubErr := q.stats.publish(q.natsConn, err, time.Since(q.startTime), time.Now()); pubErr != nil {
+			log.WithField("query_id", q.queryID).WithError(pubErr).Error("Failed to publish query stats")
+		}
+	}
 	if err == nil {
 		d := time.Since(q.startTime)
 		queryExecTimeSummary.With(prometheus.Labels{"script_name": q.queryName}).Observe(float64(d.Milliseconds()))
@@ -264,9 +302,18 @@ func (q *QueryExecutorImpl) runConsumer(ctx context.Context, resultCh <-chan *vi
 			if !ok {
 				return nil
 			}
+			if stats := result.GetData().GetExecutionStats(); stats != nil && q.agentFailures != nil {
+				stats.AgentFailures = q.agentFailures.Failures()
+			}
 			if err := consumer.Consume(result); err != nil {
 				return err
 			}
+			q.stats.update(result)
+			if q.progress != nil && q.progress.update(result, time.Now()) {
+				if err := consumer.Consume(q.progress.response(q.queryID)); err != nil {
+					return err
+				}
+			}
 		}
 	}
 }
@@ -500,6 +547,7 @@ func (q *QueryExecutorImpl) prepareScript(ctx context.Context, resultCh chan<- *
 	if err != nil {
 		return err
 	}
+	q.stats.setPlan(planMap)
 
 	if err := q.sendTableRelationResponses(ctx, resultCh, tableNameToIDMap, planMap); err != nil {
 		return err
@@ -518,7 +566,14 @@ func (q *QueryExecutorImpl) prepareScript(ctx context.Context, resultCh chan<- *
 	if err != nil {
 		return err
 	}
+	q.agentFailures = NewAgentFailureMonitor(q.queryID, q.natsConn, q.agentsTracker, planMap, planOpts.Analyze,
+		viper.GetInt("query_agent_max_retries"), viper.GetDuration("query_agent_replacement_timeout"))
+	go q.agentFailures.Run(ctx)
 
+	if q.progress != nil {
+		q.progress.setPlan(planMap, tableNameToIDMap)
+		return q.sendResponse(ctx, resultCh, q.progress.response(q.queryID))
+	}
 	return nil
 }
 
@@ -527,6 +582,10 @@ func (q *QueryExecutorImpl) runScript(ctx context.Context, resultCh chan<- *vizi
 	q.startTime = time.Now()
 	log.WithField("query_id", q.queryID).WithField("query_name", q.queryName).Infof("Running script")
 
+	// Stops the agent failure monitor once the results are streamed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	if req.QueryID == "" {
 		if err := q.prepareScript(ctx, resultCh, req); err != nil {
 			return err
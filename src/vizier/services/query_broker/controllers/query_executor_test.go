@@ -22,6 +22,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 
@@ -31,6 +32,7 @@ import (
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/mock/gomock"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -39,9 +41,11 @@ import (
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/carnot/planpb"
 	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/query_broker/controllers"
 	mock_controllers "px.dev/pixie/src/vizier/services/query_broker/controllers/mock"
 	"px.dev/pixie/src/vizier/services/query_broker/tracker"
+	"px.dev/pixie/src/vizier/utils/messagebus"
 )
 
 const singleAgentDistributedState = `
@@ -305,6 +309,12 @@ func (f *fakeResultForwarder) StreamResults(ctx context.Context, queryID uuid.UU
 	f.QueryStreamed = queryID
 
 	for _, expectedResult := range f.ClientResultsToSend {
+		// Like the real forwarder, name the tables of the batches by their IDs.
+		if b := expectedResult.GetData().GetBatch(); b != nil {
+			if id, ok := f.TableIDMap[b.TableID]; ok {
+				b.TableID = id
+			}
+		}
 		select {
 		case <-ctx.Done():
 			return nil
@@ -348,6 +358,7 @@ type queryExecTestCase struct {
 	StreamResultsErr           error
 	StreamResultsCallExpected  bool
 	MutExecFactory             controllers.MutationExecFactory
+	ExpectedProgress           []*vizierpb.QueryProgress
 }
 
 type testConsumer struct {
@@ -416,7 +427,7 @@ func runTestCase(t *testing.T, test *queryExecTestCase) {
 	assert.Equal(t, test.QueryExecExpectedRunError, queryExec.Run(context.Background(), test.Req, consumer))
 	assert.Equal(t, test.QueryExecExpectedWaitError, queryExec.Wait())
 
-	require.Equalf(t, len(test.ExpectedResps)+len(test.TableNames), len(consumer.results), "query executor sent incorrect number of results to consumer")
+	require.Equalf(t, len(test.ExpectedResps)+len(test.TableNames)+len(test.ExpectedProgress), len(consumer.results), "query executor sent incorrect number of results to consumer")
 
 	actualTableNames := make(map[string]bool)
 	for _, result := range consumer.results {
@@ -430,6 +441,7 @@ func runTestCase(t *testing.T, test *queryExecTestCase) {
 	}
 
 	idx := 0
+	var progress []*vizierpb.QueryProgress
 	for _, result := range consumer.results {
 		if result.GetData() != nil {
 			// Ignore resp.QueryID field
@@ -437,7 +449,11 @@ func runTestCase(t *testing.T, test *queryExecTestCase) {
 			assert.Equal(t, test.ExpectedResps[idx].Result, result.Result)
 			idx++
 		}
+		if result.Progress != nil {
+			progress = append(progress, result.Progress)
+		}
 	}
+	assert.Equal(t, test.ExpectedProgress, progress)
 
 	if test.StreamResultsCallExpected {
 		assert.NotEqualf(t, uuid.Nil, rf.QueryStreamed, "Expected StreamResults to be called but it wasn't")
@@ -457,6 +473,8 @@ func TestQueryExecutor(t *testing.T) {
 		buildResumeQueryTestCase(t),
 		buildResumeQueryBadQueryIDTestCase(t),
 		buildMutationFailedQueryTestCase(t),
+		buildStreamProgressTestCase(t),
+		buildStreamProgressStaggeredAgentsTestCase(t),
 	}
 
 	for _, test := range tests {
@@ -464,6 +482,55 @@ func TestQueryExecutor(t *testing.T) {
 	}
 }
 
+func TestQueryExecutor_PublishesQueryStats(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	statsCh := make(chan *nats.Msg, 1)
+	sub, err := nc.ChanSubscribe(messagebus.QueryStatsTopic, statsCh)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sub.Unsubscribe()) }()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	test := buildSimpleSuccessTestCase(t)
+	test.Req.QueryName = "px/pod"
+	test.Req.ExecFuncs = []*vizierpb.ExecuteScriptRequest_FuncToExecute{
+		{
+			FuncName: "pod",
+			ArgValues: []*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{
+				{Name: "pod", Value: "pl/vizier-query-broker"},
+				{Name: "start_time", Value: "-5m"},
+			},
+		},
+	}
+
+	at := &fakeAgentsTracker{agentsInfo: tracker.NewTestAgentsInfo(test.PlannerState.DistributedState)}
+	rf := &fakeResultForwarder{ClientResultsToSend: test.ResultForwarderResps}
+	planner := mock_controllers.NewMockPlanner(ctrl)
+	planner.EXPECT().Plan(gomock.Any()).Return(test.ExpectedPlannerResult, nil)
+
+	queryExec := controllers.NewQueryExecutor("qb_address", "qb_hostname", at, &fakeDataPrivacy{}, nc, nil, nil, rf, planner, nil)
+	require.NoError(t, queryExec.Run(context.Background(), test.Req, newTestConsumer(nil)))
+	require.NoError(t, queryExec.Wait())
+
+	select {
+	case msg := <-statsCh:
+		record := &messagespb.QueryStatsRecord{}
+		require.NoError(t, record.Unmarshal(msg.Data))
+		assert.Equal(t, "px/pod", record.QueryName)
+		assert.Equal(t, []string{"table1"}, record.Tables)
+		assert.Equal(t, []string{"pl"}, record.Namespaces)
+		assert.False(t, record.Failed)
+		assert.Equal(t, int64(4521), record.BytesProcessed)
+		assert.Equal(t, int64(4), record.RecordsProcessed)
+		assert.NotZero(t, record.EndTimeNs)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the query stats")
+	}
+}
+
 func buildPlannerState(t *testing.T, plannerStateStr string) *distributedpb.LogicalPlannerState {
 	plannerStatePB := new(distributedpb.LogicalPlannerState)
 	if err := proto.UnmarshalText(plannerStateStr, plannerStatePB); err != nil {
@@ -529,6 +596,50 @@ func buildSimpleSuccessTestCase(t *testing.T) queryExecTestCase {
 	}
 }
 
+func buildStreamProgressTestCase(t *testing.T) queryExecTestCase {
+	test := buildSimpleSuccessTestCase(t)
+	test.Name = "stream progress"
+	test.Req.StreamProgress = true
+
+	batchSize := int64(test.ResultForwarderResps[0].GetData().Batch.Size())
+	test.ExpectedProgress = []*vizierpb.QueryProgress{
+		{AgentsTotal: 2, TablesTotal: 2},
+		{AgentsTotal: 2, TablesTotal: 2, RowsReceived: 10, BytesReceived: batchSize},
+		{AgentsTotal: 2, AgentsCompleted: 2, TablesTotal: 2, RowsReceived: 10, BytesReceived: batchSize},
+	}
+	return test
+}
+
+func buildStreamProgressStaggeredAgentsTestCase(t *testing.T) queryExecTestCase {
+	test := buildSimpleSuccessTestCase(t)
+	test.Name = "stream progress of agents that finish at different times"
+	test.Req.StreamProgress = true
+
+	eos := func(tableName string) *vizierpb.ExecuteScriptResponse {
+		return &vizierpb.ExecuteScriptResponse{
+			Result: &vizierpb.ExecuteScriptResponse_Data{
+				Data: &vizierpb.QueryData{
+					Batch: &vizierpb.RowBatchData{TableID: tableName, Eos: true},
+				},
+			},
+		}
+	}
+	agent1Done := eos("agent1_table")
+	agent2Done := eos("agent2_table")
+	stats := test.ResultForwarderResps[1]
+	test.ResultForwarderResps = []*vizierpb.ExecuteScriptResponse{agent1Done, agent2Done, stats}
+	test.ExpectedResps = []*vizierpb.ExecuteScriptResponse{agent1Done, agent2Done, stats}
+
+	batchSize := int64((&vizierpb.RowBatchData{TableID: uuid.Nil.String(), Eos: true}).Size())
+	test.ExpectedProgress = []*vizierpb.QueryProgress{
+		{AgentsTotal: 2, TablesTotal: 2},
+		{AgentsTotal: 2, AgentsCompleted: 1, TablesTotal: 2, TablesCompleted: 1, BytesReceived: batchSize},
+		{AgentsTotal: 2, AgentsCompleted: 2, TablesTotal: 2, TablesCompleted: 2, BytesReceived: 2 * batchSize},
+		{AgentsTotal: 2, AgentsCompleted: 2, TablesTotal: 2, TablesCompleted: 2, BytesReceived: 2 * batchSize},
+	}
+	return test
+}
+
 func buildPlannerErrorTestCase(t *testing.T) queryExecTestCase {
 	errResp := &vizierpb.ExecuteScriptResponse{
 		Status: &vizierpb.Status{
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/carnot/planpb"
+)
+
+// queryProgressInterval is the minimum time between the progress updates that are sent while rows are received.
+const queryProgressInterval = time.Second
+
+// queryProgressTracker tracks the progress of a query from the responses that are sent to its consumer.
+type queryProgressTracker struct {
+	mu       sync.Mutex
+	progress vizierpb.QueryProgress
+	// The IDs of the result tables of the query, which are known once the query is planned.
+	tableIDs map[string]bool
+	agents   map[uuid.UUID]*agentProgress
+	lastSent time.Time
+}
+
+// agentProgress tracks whether all of the results of an agent were received.
+type agentProgress struct {
+	// The result tables that the agent sends to the query broker, which haven't ended yet.
+	remainingTables map[string]bool
+	// The agents that the agent sends its results to.
+	downstream []uuid.UUID
+	// Whether the agent sends any results, to the query broker or to other agents.
+	sendsResults bool
+	done         bool
+}
+
+func newQueryProgressTracker() *queryProgressTracker {
+	return &queryProgressTracker{
+		tableIDs: make(map[string]bool),
+		agents:   make(map[uuid.UUID]*agentProgress),
+	}
+}
+
+// setPlan records the agents and result tables of the planned query. Resumed queries aren't planned again, so they
+// only report the rows and bytes that were received.
+func (p *queryProgressTracker) setPlan(planMap map[uuid.UUID]*planpb.Plan, tableNameToIDMap map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.AgentsTotal = int64(len(planMap))
+	p.progress.TablesTotal = int64(len(tableNameToIDMap))
+	for _, id := range tableNameToIDMap {
+		p.tableIDs[id] = true
+	}
+
+	// The agents that receive the results of other agents, by the IDs of their GRPC sources.
+	sourceAgents := make(map[uint64][]uuid.UUID)
+	for agentID, plan := range planMap {
+		forEachPlanNode(plan, func(node *planpb.PlanNode) {
+			if node.Op.OpType == planpb.GRPC_SOURCE_OPERATOR {
+				sourceAgents[node.Id] = append(sourceAgents[node.Id], agentID)
+			}
+		})
+	}
+	for agentID, plan := range planMap {
+		agent := &agentProgress{remainingTables: make(map[string]bool)}
+		forEachPlanNode(plan, func(node *planpb.PlanNode) {
+			if node.Op.OpType != planpb.GRPC_SINK_OPERATOR {
+				return
+			}
+			sink := node.Op.GetGRPCSinkOp()
+			if output := sink.GetOutputTable(); output != nil {
+				agent.remainingTables[tableNameToIDMap[output.TableName]] = true
+				agent.sendsResults = true
+				return
+			}
+			for _, downstream := range sourceAgents[sink.GetGRPCSourceID()] {
+				if downstream != agentID {
+					agent.downstream = append(agent.downstream, downstream)
+					agent.sendsResults = true
+				}
+			}
+		})
+		p.agents[agentID] = agent
+	}
+}
+
+func forEachPlanNode(plan *planpb.Plan, f func(*planpb.PlanNode)) {
+	for _, fragment := range plan.Nodes {
+		for _, node := range fragment.Nodes {
+			f(node)
+		}
+	}
+}
+
+// tableDoneLocked records that a result table ended, and marks the agents whose results have all been received as
+// done. An agent is done once the result tables that it sends to the query broker have ended, and the agents that it
+// sends results to are done, since those can't end their results before the results of their upstream agents end.
+func (p *queryProgressTracker) tableDoneLocked(tableID string) {
+	for _, agent := range p.agents {
+		delete(agent.remainingTables, tableID)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, agent := range p.agents {
+			if agent.done || !agent.sendsResults || len(agent.remainingTables) > 0 {
+				continue
+			}
+			done := true
+			for _, d := range agent.downstream {
+				done = done && p.agents[d].done
+			}
+			if done {
+				agent.done = true
+				p.progress.AgentsCompleted++
+				changed = true
+			}
+		}
+	}
+}
+
+// update updates the progress with a response that was sent to the consumer, and returns whether the new progress
+// should be sent as well. Progress is sent when a table or the query completes, and otherwise at most once per
+// queryProgressInterval.
+func (p *queryProgressTracker) update(resp *vizierpb.ExecuteScriptResponse, now time.Time) bool {
+	data := resp.GetData()
+	if data == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	send := false
+	if b := data.Batch; b != nil {
+		p.progress.RowsReceived += b.NumRows
+		p.progress.BytesReceived += int64(b.Size())
+		if b.Eos && p.tableIDs[b.TableID] {
+			p.progress.TablesCompleted++
+			p.tableDoneLocked(b.TableID)
+			send = true
+		}
+		send = send || now.Sub(p.lastSent) >= queryProgressInterval
+	}
+	if data.ExecutionStats != nil {
+		// The execution stats are only sent once all agents are done.
+		p.progress.AgentsCompleted = p.progress.AgentsTotal
+		send = true
+	}
+	if send {
+		p.lastSent = now
+	}
+	return send
+}
+
+// response returns a response with the current progress.
+func (p *queryProgressTracker) response(queryID uuid.UUID) *vizierpb.ExecuteScriptResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	progress := p.progress
+	return &vizierpb.ExecuteScriptResponse{
+		QueryID:  queryID.String(),
+		Progress: &progress,
+	}
+}
@@ -554,6 +554,22 @@ func (f *QueryResultForwarderImpl) StreamResults(ctx context.Context, queryID uu
 	}
 }
 
+// BufferUtilization returns how full the fullest result buffer of the active queries is, from 0 to 1. Full buffers
+// mean that the agents produce results faster than the consumers of the queries can take them.
+func (f *QueryResultForwarderImpl) BufferUtilization() float64 {
+	f.activeQueriesMutex.Lock()
+	defer f.activeQueriesMutex.Unlock()
+
+	var utilization float64
+	for _, aq := range f.activeQueries {
+		u := float64(len(aq.queryResultCh)) / float64(cap(aq.queryResultCh))
+		if u > utilization {
+			utilization = u
+		}
+	}
+	return utilization
+}
+
 // GetProducerCtx returns the producer context for the query, so producers can check for that context being cancelled.
 func (f *QueryResultForwarderImpl) GetProducerCtx(queryID uuid.UUID) (context.Context, error) {
 	f.activeQueriesMutex.Lock()
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/carnot/planpb"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+// namespaceArgs are the script arguments that scope a query to a namespace, mapped to whether their value is of
+// the form <namespace>/<name>.
+var namespaceArgs = map[string]bool{
+	"namespace": false,
+	"pod":       true,
+	"service":   true,
+}
+
+// queryStatsRecorder collects the stats of a query, which attribute its cost to the tables that it reads from and
+// the namespaces that it is scoped to.
+type queryStatsRecorder struct {
+	mu     sync.Mutex
+	record messagespb.QueryStatsRecord
+}
+
+func newQueryStatsRecorder(req *vizierpb.ExecuteScriptRequest, queryName string) *queryStatsRecorder {
+	r := &queryStatsRecorder{}
+	r.record.QueryName = queryName
+
+	namespaces := make(map[string]bool)
+	for _, f := range req.ExecFuncs {
+		for _, arg := range f.ArgValues {
+			qualified, ok := namespaceArgs[arg.Name]
+			if !ok || arg.Value == "" {
+				continue
+			}
+			ns := arg.Value
+			if qualified {
+				idx := strings.Index(ns, "/")
+				if idx <= 0 {
+					continue
+				}
+				ns = ns[:idx]
+			}
+			namespaces[ns] = true
+		}
+	}
+	r.record.Namespaces = sortedKeys(namespaces)
+	return r
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setPlan records the tables that the planned query reads from. Resumed queries aren't planned again, so they
+// aren't recorded.
+func (r *queryStatsRecorder) setPlan(planMap map[uuid.UUID]*planpb.Plan) {
+	tables := make(map[string]bool)
+	for _, plan := range planMap {
+		for _, fragment := range plan.Nodes {
+			for _, node := range fragment.Nodes {
+				if node.Op.OpType == planpb.MEMORY_SOURCE_OPERATOR {
+					tables[node.Op.GetMemSourceOp().Name] = true
+				}
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.Tables = sortedKeys(tables)
+}
+
+// update records the execution stats of the query, if the response has them.
+func (r *queryStatsRecorder) update(resp *vizierpb.ExecuteScriptResponse) {
+	stats := resp.GetData().GetExecutionStats()
+	if stats == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.BytesProcessed = stats.BytesProcessed
+	r.record.RecordsProcessed = stats.RecordsProcessed
+}
+
+// publish sends the stats of the finished query to the metadata service.
+func (r *queryStatsRecorder) publish(nc *nats.Conn, queryErr error, execTime time.Duration, end time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if nc == nil || len(r.record.Tables) == 0 {
+		return nil
+	}
+	r.record.Failed = queryErr != nil
+	r.record.ExecTimeNs = execTime.Nanoseconds()
+	r.record.EndTimeNs = end.UnixNano()
+
+	b, err := r.record.Marshal()
+	if err != nil {
+		return err
+	}
+	return nc.Publish(messagebus.QueryStatsTopic, b)
+}
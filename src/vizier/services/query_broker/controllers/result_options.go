@@ -0,0 +1,346 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+// maxDownsampleBufferedRows is the number of rows of a table that are held back for down-sampling. Tables
+// that reach it before the end of their window or stream are down-sampled in chunks of this many rows.
+const maxDownsampleBufferedRows = 1 << 20
+
+// resultOptionsConsumer deduplicates and down-samples the row batches of the results, as requested in the
+// ResultOptions of the script, and passes them on to the wrapped consumer.
+type resultOptionsConsumer struct {
+	c    QueryResultConsumer
+	opts *vizierpb.ExecuteScriptRequest_ResultOptions
+
+	tables map[string]*resultTable
+}
+
+// resultTable is the state of a table of the results.
+type resultTable struct {
+	// seen holds the keys of the rows that were already sent, if rows are deduplicated.
+	seen map[string]struct{}
+	// timeCol is the index of the time column of the table, or -1 if the table isn't down-sampled.
+	timeCol int
+	// seriesCols are the indexes of the columns that identify a series.
+	seriesCols []int
+
+	buffered     []*vizierpb.RowBatchData
+	bufferedRows int64
+}
+
+func validateResultOptions(opts *vizierpb.ExecuteScriptRequest_ResultOptions) error {
+	if opts.GetMaxPointsPerSeries() < 0 {
+		return status.Error(codes.InvalidArgument, "max_points_per_series must not be negative")
+	}
+	return nil
+}
+
+func newResultOptionsConsumer(c QueryResultConsumer, opts *vizierpb.ExecuteScriptRequest_ResultOptions) *resultOptionsConsumer {
+	return &resultOptionsConsumer{
+		c:      c,
+		opts:   opts,
+		tables: make(map[string]*resultTable),
+	}
+}
+
+func (r *resultOptionsConsumer) newResultTable(rel *vizierpb.Relation) *resultTable {
+	t := &resultTable{timeCol: -1}
+	if r.opts.DeduplicateRows {
+		t.seen = make(map[string]struct{})
+	}
+	if r.opts.MaxPointsPerSeries == 0 {
+		return t
+	}
+	seriesNames := make(map[string]bool, len(r.opts.SeriesColumns))
+	for _, name := range r.opts.SeriesColumns {
+		seriesNames[name] = true
+	}
+	for i, col := range rel.GetColumns() {
+		// Prefer the conventional time_ column if there is more than one time column.
+		if col.ColumnType == vizierpb.TIME64NS && (t.timeCol == -1 || col.ColumnName == "time_") {
+			t.timeCol = i
+		}
+		if len(seriesNames) > 0 {
+			if seriesNames[col.ColumnName] {
+				t.seriesCols = append(t.seriesCols, i)
+			}
+			continue
+		}
+		switch col.ColumnType {
+		case vizierpb.STRING, vizierpb.BOOLEAN, vizierpb.UINT128:
+			t.seriesCols = append(t.seriesCols, i)
+		}
+	}
+	return t
+}
+
+func (r *resultOptionsConsumer) Consume(result *vizierpb.ExecuteScriptResponse) error {
+	if md := result.GetMetaData(); md != nil {
+		r.tables[md.ID] = r.newResultTable(md.Relation)
+	}
+	data := result.GetData()
+	if data == nil || data.Batch == nil {
+		return r.c.Consume(result)
+	}
+	t, ok := r.tables[data.Batch.TableID]
+	if !ok {
+		return status.Errorf(codes.Internal, "received row batch for unknown table %s", data.Batch.TableID)
+	}
+
+	batch := data.Batch
+	if t.seen != nil {
+		batch = t.deduplicate(batch)
+	}
+	if t.timeCol >= 0 {
+		t.buffered = append(t.buffered, batch)
+		t.bufferedRows += batch.NumRows
+		if !batch.Eow && !batch.Eos && t.bufferedRows < maxDownsampleBufferedRows {
+			batch = nil
+		} else {
+			batch = t.downsample(r.opts.MaxPointsPerSeries)
+			t.buffered = nil
+			t.bufferedRows = 0
+		}
+	}
+
+	// Batches that ended up empty are only needed to mark the end of a window or stream.
+	if batch != nil && (batch.NumRows > 0 || batch.Eow || batch.Eos) {
+		data.Batch = batch
+		return r.c.Consume(result)
+	}
+	if data.ExecutionStats == nil && result.Status == nil {
+		return nil
+	}
+	data.Batch = nil
+	return r.c.Consume(result)
+}
+
+func (t *resultTable) deduplicate(batch *vizierpb.RowBatchData) *vizierpb.RowBatchData {
+	allCols := make([]int, len(batch.Cols))
+	for i := range allCols {
+		allCols[i] = i
+	}
+	rows := make([]int, 0, batch.NumRows)
+	for i := 0; i < int(batch.NumRows); i++ {
+		key := rowKey(batch.Cols, allCols, i)
+		if _, ok := t.seen[key]; ok {
+			continue
+		}
+		t.seen[key] = struct{}{}
+		rows = append(rows, i)
+	}
+	if len(rows) == int(batch.NumRows) {
+		return batch
+	}
+	return selectRows(batch, rows)
+}
+
+// downsample merges the buffered batches and keeps at most maxPoints rows of each series, evenly spaced in
+// time. The order of the kept rows is preserved.
+func (t *resultTable) downsample(maxPoints int64) *vizierpb.RowBatchData {
+	batch := concatBatches(t.buffered)
+	series := make(map[string][]int)
+	for i := 0; i < int(batch.NumRows); i++ {
+		key := rowKey(batch.Cols, t.seriesCols, i)
+		series[key] = append(series[key], i)
+	}
+
+	times := batch.Cols[t.timeCol].GetTime64NsData().GetData()
+	var rows []int
+	for _, seriesRows := range series {
+		if int64(len(seriesRows)) <= maxPoints {
+			rows = append(rows, seriesRows...)
+			continue
+		}
+		sort.SliceStable(seriesRows, func(i, j int) bool {
+			return times[seriesRows[i]] < times[seriesRows[j]]
+		})
+		if maxPoints == 1 {
+			rows = append(rows, seriesRows[len(seriesRows)-1])
+			continue
+		}
+		last := int64(len(seriesRows) - 1)
+		for i := int64(0); i < maxPoints; i++ {
+			rows = append(rows, seriesRows[i*last/(maxPoints-1)])
+		}
+	}
+	if len(rows) == int(batch.NumRows) {
+		return batch
+	}
+	sort.Ints(rows)
+	return selectRows(batch, rows)
+}
+
+// rowKey encodes the values of the given columns of a row, so that rows with equal values have equal keys.
+func rowKey(cols []*vizierpb.Column, colIdxs []int, row int) string {
+	var sb strings.Builder
+	var buf [binary.MaxVarintLen64]byte
+	putInt := func(v int64) {
+		n := binary.PutVarint(buf[:], v)
+		sb.Write(buf[:n])
+	}
+	for _, idx := range colIdxs {
+		switch c := cols[idx].ColData.(type) {
+		case *vizierpb.Column_BooleanData:
+			if c.BooleanData.Data[row] {
+				sb.WriteByte(1)
+			} else {
+				sb.WriteByte(0)
+			}
+		case *vizierpb.Column_Int64Data:
+			putInt(c.Int64Data.Data[row])
+		case *vizierpb.Column_Uint128Data:
+			putInt(int64(c.Uint128Data.Data[row].High))
+			putInt(int64(c.Uint128Data.Data[row].Low))
+		case *vizierpb.Column_Time64NsData:
+			putInt(c.Time64NsData.Data[row])
+		case *vizierpb.Column_Float64Data:
+			putInt(int64(math.Float64bits(c.Float64Data.Data[row])))
+		case *vizierpb.Column_StringData:
+			// Strings are length prefixed, so that values can't run into each other.
+			putInt(int64(len(c.StringData.Data[row])))
+			sb.Write(c.StringData.Data[row])
+		}
+	}
+	return sb.String()
+}
+
+// selectRows returns a batch with the given rows of the batch.
+func selectRows(batch *vizierpb.RowBatchData, rows []int) *vizierpb.RowBatchData {
+	out := &vizierpb.RowBatchData{
+		TableID: batch.TableID,
+		Cols:    make([]*vizierpb.Column, len(batch.Cols)),
+		NumRows: int64(len(rows)),
+		Eow:     batch.Eow,
+		Eos:     batch.Eos,
+	}
+	for i, col := range batch.Cols {
+		out.Cols[i] = &vizierpb.Column{}
+		switch c := col.ColData.(type) {
+		case *vizierpb.Column_BooleanData:
+			d := make([]bool, len(rows))
+			for j, row := range rows {
+				d[j] = c.BooleanData.Data[row]
+			}
+			out.Cols[i].ColData = &vizierpb.Column_BooleanData{BooleanData: &vizierpb.BooleanColumn{Data: d}}
+		case *vizierpb.Column_Int64Data:
+			d := make([]int64, len(rows))
+			for j, row := range rows {
+				d[j] = c.Int64Data.Data[row]
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Int64Data{Int64Data: &vizierpb.Int64Column{Data: d}}
+		case *vizierpb.Column_Uint128Data:
+			d := make([]*vizierpb.UInt128, len(rows))
+			for j, row := range rows {
+				d[j] = c.Uint128Data.Data[row]
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Uint128Data{Uint128Data: &vizierpb.UInt128Column{Data: d}}
+		case *vizierpb.Column_Time64NsData:
+			d := make([]int64, len(rows))
+			for j, row := range rows {
+				d[j] = c.Time64NsData.Data[row]
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Time64NsData{Time64NsData: &vizierpb.Time64NSColumn{Data: d}}
+		case *vizierpb.Column_Float64Data:
+			d := make([]float64, len(rows))
+			for j, row := range rows {
+				d[j] = c.Float64Data.Data[row]
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Float64Data{Float64Data: &vizierpb.Float64Column{Data: d}}
+		case *vizierpb.Column_StringData:
+			d := make([][]byte, len(rows))
+			for j, row := range rows {
+				d[j] = c.StringData.Data[row]
+			}
+			out.Cols[i].ColData = &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: d}}
+		}
+	}
+	return out
+}
+
+// concatBatches merges batches of the same table into one batch, which ends a window or stream if the last
+// batch does.
+func concatBatches(batches []*vizierpb.RowBatchData) *vizierpb.RowBatchData {
+	if len(batches) == 1 {
+		return batches[0]
+	}
+	last := batches[len(batches)-1]
+	out := &vizierpb.RowBatchData{
+		TableID: last.TableID,
+		Cols:    make([]*vizierpb.Column, len(last.Cols)),
+		Eow:     last.Eow,
+		Eos:     last.Eos,
+	}
+	for i, col := range last.Cols {
+		out.Cols[i] = &vizierpb.Column{}
+		switch col.ColData.(type) {
+		case *vizierpb.Column_BooleanData:
+			var d []bool
+			for _, b := range batches {
+				d = append(d, b.Cols[i].GetBooleanData().GetData()...)
+			}
+			out.Cols[i].ColData = &vizierpb.Column_BooleanData{BooleanData: &vizierpb.BooleanColumn{Data: d}}
+		case *vizierpb.Column_Int64Data:
+			var d []int64
+			for _, b := range batches {
+				d = append(d, b.Cols[i].GetInt64Data().GetData()...)
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Int64Data{Int64Data: &vizierpb.Int64Column{Data: d}}
+		case *vizierpb.Column_Uint128Data:
+			var d []*vizierpb.UInt128
+			for _, b := range batches {
+				d = append(d, b.Cols[i].GetUint128Data().GetData()...)
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Uint128Data{Uint128Data: &vizierpb.UInt128Column{Data: d}}
+		case *vizierpb.Column_Time64NsData:
+			var d []int64
+			for _, b := range batches {
+				d = append(d, b.Cols[i].GetTime64NsData().GetData()...)
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Time64NsData{Time64NsData: &vizierpb.Time64NSColumn{Data: d}}
+		case *vizierpb.Column_Float64Data:
+			var d []float64
+			for _, b := range batches {
+				d = append(d, b.Cols[i].GetFloat64Data().GetData()...)
+			}
+			out.Cols[i].ColData = &vizierpb.Column_Float64Data{Float64Data: &vizierpb.Float64Column{Data: d}}
+		case *vizierpb.Column_StringData:
+			var d [][]byte
+			for _, b := range batches {
+				d = append(d, b.Cols[i].GetStringData().GetData()...)
+			}
+			out.Cols[i].ColData = &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: d}}
+		}
+	}
+	for _, b := range batches {
+		out.NumRows += b.NumRows
+	}
+	return out
+}
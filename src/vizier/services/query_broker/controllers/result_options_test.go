@@ -0,0 +1,151 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	mock_vizierpb "px.dev/pixie/src/api/proto/vizierpb/mock"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+func timeSeriesBatch(times []int64, services []string, values []float64, eos bool) *vizierpb.RowBatchData {
+	svcs := make([][]byte, len(services))
+	for i, s := range services {
+		svcs[i] = []byte(s)
+	}
+	return &vizierpb.RowBatchData{
+		TableID: "table",
+		Cols: []*vizierpb.Column{
+			{ColData: &vizierpb.Column_Time64NsData{Time64NsData: &vizierpb.Time64NSColumn{Data: times}}},
+			{ColData: &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: svcs}}},
+			{ColData: &vizierpb.Column_Float64Data{Float64Data: &vizierpb.Float64Column{Data: values}}},
+		},
+		NumRows: int64(len(times)),
+		Eos:     eos,
+	}
+}
+
+// runWithResultOptions executes a script that returns the given batches of a time series table, and returns the
+// batches that are sent to the client.
+func runWithResultOptions(t *testing.T, opts *vizierpb.ExecuteScriptRequest_ResultOptions, batches ...*vizierpb.RowBatchData) ([]*vizierpb.RowBatchData, error) {
+	queryID := uuid.Must(uuid.NewV4())
+	results := []*vizierpb.ExecuteScriptResponse{
+		{
+			QueryID: queryID.String(),
+			Result: &vizierpb.ExecuteScriptResponse_MetaData{
+				MetaData: &vizierpb.QueryMetadata{
+					Name: "output",
+					ID:   "table",
+					Relation: &vizierpb.Relation{
+						Columns: []*vizierpb.Relation_ColumnInfo{
+							{ColumnName: "time_", ColumnType: vizierpb.TIME64NS},
+							{ColumnName: "service", ColumnType: vizierpb.STRING},
+							{ColumnName: "latency", ColumnType: vizierpb.FLOAT64},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, b := range batches {
+		results = append(results, &vizierpb.ExecuteScriptResponse{
+			QueryID: queryID.String(),
+			Result: &vizierpb.ExecuteScriptResponse_Data{
+				Data: &vizierpb.QueryData{Batch: b},
+			},
+		})
+	}
+
+	qe := &fakeQueryExecutor{
+		ResultsToSend: results,
+		queryID:       queryID,
+	}
+	queryExecFactory := func(*controllers.Server, controllers.MutationExecFactory) controllers.QueryExecutor {
+		return qe
+	}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, &fakeDataPrivacy{}, nil, nil, nil, nil, nil, queryExecFactory)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := mock_vizierpb.NewMockVizierService_ExecuteScriptServer(ctrl)
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+
+	var sent []*vizierpb.RowBatchData
+	srv.EXPECT().
+		Send(gomock.Any()).
+		DoAndReturn(func(arg *vizierpb.ExecuteScriptResponse) error {
+			if b := arg.GetData().GetBatch(); b != nil {
+				sent = append(sent, b)
+			}
+			return nil
+		}).
+		AnyTimes()
+
+	err = s.ExecuteScript(&vizierpb.ExecuteScriptRequest{
+		QueryStr:      "success",
+		ResultOptions: opts,
+	}, srv)
+	return sent, err
+}
+
+func TestExecuteScript_DeduplicateRows(t *testing.T) {
+	sent, err := runWithResultOptions(t, &vizierpb.ExecuteScriptRequest_ResultOptions{DeduplicateRows: true},
+		timeSeriesBatch([]int64{1, 1, 2}, []string{"a", "a", "a"}, []float64{1, 1, 1}, false),
+		timeSeriesBatch([]int64{1, 2}, []string{"a", "a"}, []float64{1, 1}, false),
+		timeSeriesBatch([]int64{2, 3}, []string{"a", "b"}, []float64{1, 1}, true),
+	)
+	require.NoError(t, err)
+
+	// The second batch only has duplicates, so it isn't sent.
+	assert.Equal(t, []*vizierpb.RowBatchData{
+		timeSeriesBatch([]int64{1, 2}, []string{"a", "a"}, []float64{1, 1}, false),
+		timeSeriesBatch([]int64{3}, []string{"b"}, []float64{1}, true),
+	}, sent)
+}
+
+func TestExecuteScript_MaxPointsPerSeries(t *testing.T) {
+	sent, err := runWithResultOptions(t, &vizierpb.ExecuteScriptRequest_ResultOptions{MaxPointsPerSeries: 3},
+		timeSeriesBatch([]int64{1, 2, 3, 1, 2}, []string{"a", "a", "a", "b", "b"}, []float64{1, 2, 3, 10, 20}, false),
+		timeSeriesBatch([]int64{4, 5, 3}, []string{"a", "a", "b"}, []float64{4, 5, 30}, true),
+	)
+	require.NoError(t, err)
+
+	// The batches are held back until the end of the stream. Series a is down-sampled to its first, middle and
+	// last point, and series b is kept as is.
+	assert.Equal(t, []*vizierpb.RowBatchData{
+		timeSeriesBatch([]int64{1, 3, 1, 2, 5, 3}, []string{"a", "a", "b", "b", "a", "b"}, []float64{1, 3, 10, 20, 5, 30}, true),
+	}, sent)
+}
+
+func TestExecuteScript_InvalidResultOptions(t *testing.T) {
+	_, err := runWithResultOptions(t, &vizierpb.ExecuteScriptRequest_ResultOptions{MaxPointsPerSeries: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+func init() {
+	pflag.StringSlice("result_sink_schemes", []string{}, "The URL schemes of the result sinks that scripts may write their results to, "+
+		"for example gs or kafka+https. Scripts can't use result sinks if this is empty.")
+}
+
+// ResultSink receives the row batches of a script's results in place of the client, for example to
+// export large results directly to an object store.
+type ResultSink interface {
+	// WriteBatch writes a row batch of the given table of the query's results.
+	WriteBatch(ctx context.Context, queryID string, tableName string, batch *vizierpb.RowBatchData) error
+	// Close flushes the results written to the sink. queryErr is the error that the query failed with, if any,
+	// in which case the sink may discard the partial results.
+	Close(queryErr error) error
+}
+
+// ResultSinkFactory creates a ResultSink from the URL and options of a result sink config.
+type ResultSinkFactory func(ctx context.Context, u *url.URL, options map[string]string) (ResultSink, error)
+
+var resultSinkFactories = map[string]ResultSinkFactory{
+	gcsResultSinkScheme:        newGCSResultSink,
+	kafkaRESTResultSinkScheme:  newKafkaRESTResultSink,
+	kafkaRESTSResultSinkScheme: newKafkaRESTResultSink,
+}
+
+// RegisterResultSink registers the factory for result sinks with the given URL scheme, replacing any existing
+// factory for the scheme. It should only be called during initialization.
+func RegisterResultSink(scheme string, factory ResultSinkFactory) {
+	resultSinkFactories[scheme] = factory
+}
+
+// ResultSinkSchemes returns the URL schemes of all registered result sinks.
+func ResultSinkSchemes() []string {
+	schemes := make([]string, 0, len(resultSinkFactories))
+	for scheme := range resultSinkFactories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func resultSinkSchemeEnabled(scheme string) bool {
+	for _, s := range viper.GetStringSlice("result_sink_schemes") {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// NewResultSink creates the ResultSink described by the given config.
+func NewResultSink(ctx context.Context, config *vizierpb.Configs_ResultSinkConfig) (ResultSink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid result sink URL: %v", err)
+	}
+	factory, ok := resultSinkFactories[u.Scheme]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported result sink scheme %q, expected one of %v", u.Scheme, ResultSinkSchemes())
+	}
+	if !resultSinkSchemeEnabled(u.Scheme) {
+		return nil, status.Errorf(codes.PermissionDenied, "result sinks with scheme %q are not enabled on this cluster", u.Scheme)
+	}
+	return factory(ctx, u, config.Options)
+}
+
+// resultSinkConsumer writes the row batches of the results to a ResultSink, and passes everything else,
+// such as the table metadata and execution stats, on to the wrapped consumer.
+type resultSinkConsumer struct {
+	ctx  context.Context
+	c    QueryResultConsumer
+	sink ResultSink
+	// busy records the time spent writing to the sink. It may be nil.
+	busy *busyTracker
+
+	tableNames map[string]string
+}
+
+func newResultSinkConsumer(ctx context.Context, c QueryResultConsumer, sink ResultSink, busy *busyTracker) *resultSinkConsumer {
+	return &resultSinkConsumer{
+		ctx:        ctx,
+		c:          c,
+		sink:       sink,
+		busy:       busy,
+		tableNames: make(map[string]string),
+	}
+}
+
+func (r *resultSinkConsumer) Consume(result *vizierpb.ExecuteScriptResponse) error {
+	if md := result.GetMetaData(); md != nil {
+		r.tableNames[md.ID] = md.Name
+	}
+	data := result.GetData()
+	if data == nil || data.Batch == nil {
+		return r.c.Consume(result)
+	}
+
+	tableName, ok := r.tableNames[data.Batch.TableID]
+	if !ok {
+		return status.Errorf(codes.Internal, "received row batch for unknown table %s", data.Batch.TableID)
+	}
+	start := time.Now()
+	err := r.sink.WriteBatch(r.ctx, result.QueryID, tableName, data.Batch)
+	if r.busy != nil {
+		r.busy.track(start)
+	}
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to write results to result sink: %v", err)
+	}
+	if data.ExecutionStats == nil && result.Status == nil {
+		return nil
+	}
+	data.Batch = nil
+	return r.c.Consume(result)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/gogo/protobuf/jsonpb"
+	"google.golang.org/api/option"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+const gcsResultSinkScheme = "gs"
+
+// gcsResultSink streams the results of a query to GCS, with one object per table at
+// <prefix>/<query_id>/<table_name>.json. Each line of an object is a row batch encoded as JSON.
+//
+// The sink uses the application default credentials of the query broker, unless the
+// "credentials_file" option is set.
+type gcsResultSink struct {
+	client *storage.Client
+	bucket string
+	prefix string
+
+	// ctx is the context of all uploads. Cancelling it aborts the uploads.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	writers map[string]*storage.Writer
+}
+
+// splitGCSResultSinkURL splits a gs://bucket/prefix URL into the bucket and the object prefix.
+func splitGCSResultSinkURL(u *url.URL) (string, string, error) {
+	if u.Host == "" {
+		return "", "", errors.New("result sink URL must be of the form gs://bucket/prefix")
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+func newGCSResultSink(ctx context.Context, u *url.URL, options map[string]string) (ResultSink, error) {
+	bucket, prefix, err := splitGCSResultSinkURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []option.ClientOption
+	if f, ok := options["credentials_file"]; ok {
+		opts = append(opts, option.WithCredentialsFile(f))
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	uploadCtx, cancel := context.WithCancel(ctx)
+	return &gcsResultSink{
+		client:  client,
+		bucket:  bucket,
+		prefix:  prefix,
+		ctx:     uploadCtx,
+		cancel:  cancel,
+		writers: make(map[string]*storage.Writer),
+	}, nil
+}
+
+func (s *gcsResultSink) objectName(queryID string, tableName string) string {
+	return path.Join(s.prefix, queryID, tableName+".json")
+}
+
+func (s *gcsResultSink) WriteBatch(ctx context.Context, queryID string, tableName string, batch *vizierpb.RowBatchData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.writers[tableName]
+	if !ok {
+		w = s.client.Bucket(s.bucket).Object(s.objectName(queryID, tableName)).NewWriter(s.ctx)
+		w.ContentType = "application/x-ndjson"
+		s.writers[tableName] = w
+	}
+	m := jsonpb.Marshaler{}
+	if err := m.Marshal(w, batch); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte("\n"))
+	return err
+}
+
+func (s *gcsResultSink) Close(queryErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.client.Close()
+
+	if queryErr != nil {
+		// Cancelling the uploads makes sure that objects with partial results are never created.
+		s.cancel()
+		return nil
+	}
+	defer s.cancel()
+
+	var closeErr error
+	for tableName, w := range s.writers {
+		if err := w.Close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("failed to upload results of table %s: %w", tableName, err)
+		}
+	}
+	return closeErr
+}
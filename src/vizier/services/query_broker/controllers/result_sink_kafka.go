@@ -0,0 +1,166 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+const (
+	kafkaRESTResultSinkScheme  = "kafka+http"
+	kafkaRESTSResultSinkScheme = "kafka+https"
+
+	kafkaRESTContentType = "application/vnd.kafka.json.v2+json"
+	kafkaRESTTimeout     = 30 * time.Second
+	// Options with this prefix are sent as HTTP headers to the REST proxy, for example for authorization.
+	kafkaRESTHeaderOptionPrefix = "header."
+)
+
+// kafkaRESTResultSink produces the results of a query to a Kafka topic through a Kafka REST proxy,
+// with one record per row batch. The URL kafka+https://proxy:8082/topic produces to the topic
+// "topic" through the proxy at https://proxy:8082. Records are keyed by the query ID, so that the
+// row batches of a query stay in order.
+type kafkaRESTResultSink struct {
+	client   *http.Client
+	topicURL string
+	headers  http.Header
+}
+
+// kafkaRESTRecordValue is the value of each record produced by the kafkaRESTResultSink.
+type kafkaRESTRecordValue struct {
+	QueryID   string          `json:"query_id"`
+	TableName string          `json:"table_name"`
+	Batch     json.RawMessage `json:"batch"`
+}
+
+type kafkaRESTRecord struct {
+	Key   string               `json:"key"`
+	Value kafkaRESTRecordValue `json:"value"`
+}
+
+type kafkaRESTProduceRequest struct {
+	Records []kafkaRESTRecord `json:"records"`
+}
+
+type kafkaRESTProduceResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func newKafkaRESTResultSink(ctx context.Context, u *url.URL, options map[string]string) (ResultSink, error) {
+	topic := path.Base(u.Path)
+	if u.Host == "" || topic == "." || topic == "/" {
+		return nil, errors.New("result sink URL must be of the form kafka+https://rest-proxy:port/topic")
+	}
+	proxyURL := url.URL{
+		Scheme: strings.TrimPrefix(u.Scheme, "kafka+"),
+		Host:   u.Host,
+		Path:   path.Join(path.Dir(u.Path), "topics", topic),
+	}
+
+	headers := make(http.Header)
+	for k, v := range options {
+		if !strings.HasPrefix(k, kafkaRESTHeaderOptionPrefix) {
+			return nil, fmt.Errorf("unknown Kafka result sink option %q", k)
+		}
+		headers.Set(strings.TrimPrefix(k, kafkaRESTHeaderOptionPrefix), v)
+	}
+
+	return &kafkaRESTResultSink{
+		client:   &http.Client{Timeout: kafkaRESTTimeout},
+		topicURL: proxyURL.String(),
+		headers:  headers,
+	}, nil
+}
+
+func (s *kafkaRESTResultSink) WriteBatch(ctx context.Context, queryID string, tableName string, batch *vizierpb.RowBatchData) error {
+	m := jsonpb.Marshaler{}
+	b, err := m.MarshalToString(batch)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(&kafkaRESTProduceRequest{
+		Records: []kafkaRESTRecord{
+			{
+				Key: queryID,
+				Value: kafkaRESTRecordValue{
+					QueryID:   queryID,
+					TableName: tableName,
+					Batch:     json.RawMessage(b),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.topicURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k := range s.headers {
+		req.Header.Set(k, s.headers.Get(k))
+	}
+	req.Header.Set("Content-Type", kafkaRESTContentType)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka REST proxy returned %s: %s", resp.Status, respBody)
+	}
+	var produceResp kafkaRESTProduceResponse
+	if err := json.Unmarshal(respBody, &produceResp); err != nil {
+		return fmt.Errorf("invalid response from Kafka REST proxy: %w", err)
+	}
+	for _, o := range produceResp.Offsets {
+		if o.ErrorCode != nil {
+			return fmt.Errorf("failed to produce record: %s", o.Error)
+		}
+	}
+	return nil
+}
+
+// Close is a no-op, since the records are produced as soon as they are written.
+func (s *kafkaRESTResultSink) Close(queryErr error) error {
+	return nil
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	mock_vizierpb "px.dev/pixie/src/api/proto/vizierpb/mock"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+type fakeResultSink struct {
+	batches  map[string][]*vizierpb.RowBatchData
+	closed   bool
+	queryErr error
+}
+
+func (s *fakeResultSink) WriteBatch(ctx context.Context, queryID string, tableName string, batch *vizierpb.RowBatchData) error {
+	s.batches[tableName] = append(s.batches[tableName], batch)
+	return nil
+}
+
+func (s *fakeResultSink) Close(queryErr error) error {
+	s.closed = true
+	s.queryErr = queryErr
+	return nil
+}
+
+func TestNewResultSink(t *testing.T) {
+	controllers.RegisterResultSink("fake", func(context.Context, *url.URL, map[string]string) (controllers.ResultSink, error) {
+		return &fakeResultSink{}, nil
+	})
+	viper.Set("result_sink_schemes", []string{"fake"})
+	defer viper.Set("result_sink_schemes", []string{})
+
+	sink, err := controllers.NewResultSink(context.Background(), &vizierpb.Configs_ResultSinkConfig{URL: "fake://results"})
+	require.NoError(t, err)
+	assert.NotNil(t, sink)
+
+	_, err = controllers.NewResultSink(context.Background(), &vizierpb.Configs_ResultSinkConfig{URL: "gs://bucket/results"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = controllers.NewResultSink(context.Background(), &vizierpb.Configs_ResultSinkConfig{URL: "s3://bucket/results"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestExecuteScript_ResultSink(t *testing.T) {
+	queryID := uuid.Must(uuid.NewV4())
+	sink := &fakeResultSink{batches: make(map[string][]*vizierpb.RowBatchData)}
+	controllers.RegisterResultSink("fake", func(context.Context, *url.URL, map[string]string) (controllers.ResultSink, error) {
+		return sink, nil
+	})
+	viper.Set("result_sink_schemes", []string{"fake"})
+	defer viper.Set("result_sink_schemes", []string{})
+
+	metadata := &vizierpb.ExecuteScriptResponse{
+		QueryID: queryID.String(),
+		Result: &vizierpb.ExecuteScriptResponse_MetaData{
+			MetaData: &vizierpb.QueryMetadata{
+				Name: "output",
+				ID:   "execute_unused",
+			},
+		},
+	}
+	stats := &vizierpb.ExecuteScriptResponse{
+		QueryID: queryID.String(),
+		Result: &vizierpb.ExecuteScriptResponse_Data{
+			Data: &vizierpb.QueryData{
+				ExecutionStats: &vizierpb.QueryExecutionStats{
+					RecordsProcessed: 2,
+				},
+			},
+		},
+	}
+	batches := buildExecuteScriptSuccessResponses(queryID)
+	results := append([]*vizierpb.ExecuteScriptResponse{metadata}, batches...)
+	results = append(results, stats)
+
+	qe := &fakeQueryExecutor{
+		ResultsToSend: results,
+		queryID:       queryID,
+	}
+	queryExecFactory := func(*controllers.Server, controllers.MutationExecFactory) controllers.QueryExecutor {
+		return qe
+	}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, &fakeDataPrivacy{}, nil, nil, nil, nil, nil, queryExecFactory)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := mock_vizierpb.NewMockVizierService_ExecuteScriptServer(ctrl)
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+
+	var resps []*vizierpb.ExecuteScriptResponse
+	srv.EXPECT().
+		Send(gomock.Any()).
+		DoAndReturn(func(arg *vizierpb.ExecuteScriptResponse) error {
+			resps = append(resps, arg)
+			return nil
+		}).
+		AnyTimes()
+
+	err = s.ExecuteScript(&vizierpb.ExecuteScriptRequest{
+		QueryStr: "success",
+		Configs: &vizierpb.Configs{
+			ResultSinkConfig: &vizierpb.Configs_ResultSinkConfig{URL: "fake://results"},
+		},
+	}, srv)
+	require.NoError(t, err)
+
+	// Only the metadata and stats are sent to the client, the row batches go to the sink.
+	assert.Equal(t, []*vizierpb.ExecuteScriptResponse{metadata, stats}, resps)
+	require.Len(t, sink.batches["output"], 2)
+	assert.Equal(t, batches[0].GetData().Batch, sink.batches["output"][0])
+	assert.Equal(t, batches[1].GetData().Batch, sink.batches["output"][1])
+	assert.True(t, sink.closed)
+	assert.NoError(t, sink.queryErr)
+}
+
+func TestKafkaRESTResultSink(t *testing.T) {
+	var reqs []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/kafka/topics/results", r.URL.Path)
+		assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &req))
+		reqs = append(reqs, req)
+		_, _ = w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer srv.Close()
+
+	viper.Set("result_sink_schemes", []string{"kafka+http"})
+	defer viper.Set("result_sink_schemes", []string{})
+
+	sink, err := controllers.NewResultSink(context.Background(), &vizierpb.Configs_ResultSinkConfig{
+		URL:     strings.Replace(srv.URL, "http://", "kafka+http://", 1) + "/kafka/results",
+		Options: map[string]string{"header.Authorization": "Bearer abc"},
+	})
+	require.NoError(t, err)
+
+	err = sink.WriteBatch(context.Background(), "query", "output", &vizierpb.RowBatchData{
+		TableID: "table",
+		NumRows: 1,
+		Eos:     true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Close(nil))
+
+	require.Len(t, reqs, 1)
+	assert.Equal(t, map[string]interface{}{
+		"records": []interface{}{
+			map[string]interface{}{
+				"key": "query",
+				"value": map[string]interface{}{
+					"query_id":   "query",
+					"table_name": "output",
+					"batch": map[string]interface{}{
+						"tableId": "table",
+						"numRows": "1",
+						"eos":     true,
+					},
+				},
+			},
+		},
+	}, reqs[0])
+}
+
+func TestKafkaRESTResultSink_ProduceError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"offsets":[{"error_code":40403,"error":"topic not found"}]}`))
+	}))
+	defer srv.Close()
+
+	viper.Set("result_sink_schemes", []string{"kafka+http"})
+	defer viper.Set("result_sink_schemes", []string{})
+
+	sink, err := controllers.NewResultSink(context.Background(), &vizierpb.Configs_ResultSinkConfig{
+		URL: strings.Replace(srv.URL, "http://", "kafka+http://", 1) + "/results",
+	})
+	require.NoError(t, err)
+
+	err = sink.WriteBatch(context.Background(), "query", "output", &vizierpb.RowBatchData{TableID: "table"})
+	assert.EqualError(t, err, "failed to produce record: topic not found")
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+// The data paths that the query broker reports the saturation of. They must match the paths known to the
+// backpressure controller of the metadata service.
+const (
+	saturationPathKelvin = "kelvin"
+	saturationPathExport = "export"
+)
+
+// bufferUtilizer is implemented by result forwarders that can report how full their buffers are.
+type bufferUtilizer interface {
+	BufferUtilization() float64
+}
+
+// busyTracker measures the fraction of time that is spent in an operation. Concurrent operations are added up,
+// so the fraction is capped at 1.
+type busyTracker struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	busy  time.Duration
+	since time.Time
+}
+
+func newBusyTracker() *busyTracker {
+	return &busyTracker{now: time.Now, since: time.Now()}
+}
+
+// track records an operation that started at the given time and just ended.
+func (b *busyTracker) track(start time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.busy += b.now().Sub(start)
+}
+
+// utilization returns the busy fraction since the last call.
+func (b *busyTracker) utilization() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	elapsed := now.Sub(b.since)
+	busy := b.busy
+	b.busy = 0
+	b.since = now
+	if elapsed <= 0 {
+		return 0
+	}
+	u := float64(busy) / float64(elapsed)
+	if u > 1 {
+		return 1
+	}
+	return u
+}
+
+// saturationReports returns the current saturation of the kelvin and export paths.
+func (s *Server) saturationReports(source string) []*messagespb.SaturationReport {
+	var reports []*messagespb.SaturationReport
+	if f, ok := s.resultForwarder.(bufferUtilizer); ok {
+		reports = append(reports, &messagespb.SaturationReport{
+			Path:        saturationPathKelvin,
+			Source:      source,
+			Utilization: f.BufferUtilization(),
+		})
+	}
+	reports = append(reports, &messagespb.SaturationReport{
+		Path:        saturationPathExport,
+		Source:      source,
+		Utilization: s.exportTracker.utilization(),
+	})
+	return reports
+}
+
+// RunSaturationReporter periodically publishes the saturation of the paths that consume PEM data to the metadata
+// service, which uses them to apply backpressure to the PEMs. It returns when the server is closed.
+func (s *Server) RunSaturationReporter(interval time.Duration, source string) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.healthcheckQuitCh:
+			return
+		case <-t.C:
+			for _, r := range s.saturationReports(source) {
+				b, err := r.Marshal()
+				if err != nil {
+					log.WithError(err).Error("Failed to marshal saturation report")
+					continue
+				}
+				if err := s.natsConn.Publish(messagebus.SaturationReportTopic, b); err != nil {
+					log.WithError(err).Error("Failed to publish saturation report")
+				}
+			}
+		}
+	}
+}
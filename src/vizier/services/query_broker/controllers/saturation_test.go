@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/carnot/carnotpb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+func TestQueryResultForwarder_BufferUtilization(t *testing.T) {
+	f := controllers.NewQueryResultForwarder().(*controllers.QueryResultForwarderImpl)
+	assert.Equal(t, 0.0, f.BufferUtilization())
+
+	queryID := uuid.Must(uuid.NewV4())
+	require.NoError(t, f.RegisterQuery(queryID, map[string]string{"foo": "123"}, 0, nil, ""))
+	defer f.ProducerCancelStream(queryID, nil)
+
+	// Nothing consumes the results, so they pile up in the buffer of the query.
+	for i := 0; i < 256; i++ {
+		err := f.ForwardQueryResult(context.Background(), &carnotpb.TransferResultChunkRequest{
+			QueryID: utils.ProtoFromUUID(queryID),
+		})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 0.25, f.BufferUtilization())
+}
+
+func TestServer_RunSaturationReporter(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	ch := make(chan *nats.Msg, 10)
+	sub, err := nc.ChanSubscribe(messagebus.SaturationReportTopic, ch)
+	require.NoError(t, err)
+	defer func() { _ = sub.Unsubscribe() }()
+
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, &fakeDataPrivacy{}, controllers.NewQueryResultForwarder(),
+		nil, nil, nc, nil, nil)
+	require.NoError(t, err)
+	go s.RunSaturationReporter(10*time.Millisecond, "vizier-query-broker-0")
+	defer s.Close()
+
+	paths := make(map[string]bool)
+	for len(paths) < 2 {
+		select {
+		case msg := <-ch:
+			r := &messagespb.SaturationReport{}
+			require.NoError(t, r.Unmarshal(msg.Data))
+			assert.Equal(t, "vizier-query-broker-0", r.Source)
+			assert.Equal(t, 0.0, r.Utilization)
+			paths[r.Path] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for saturation reports")
+		}
+	}
+	assert.Equal(t, map[string]bool{"kelvin": true, "export": true}, paths)
+}
@@ -84,10 +84,17 @@ type Server struct {
 	mdtp            metadatapb.MetadataTracepointServiceClient
 	mdconf          metadatapb.MetadataConfigServiceClient
 	resultForwarder QueryResultForwarder
+	// exportTracker measures how busy the result sinks are, to report the saturation of the export path.
+	exportTracker *busyTracker
 
 	planner Planner
 
 	queryExecFactory QueryExecutorFactory
+
+	// queryCache caches the results of scripts, if set.
+	queryCache *QueryCache
+	// queryAdmission limits the scripts that run at once, and their execution time and results, if set.
+	queryAdmission *QueryAdmission
 }
 
 // QueryExecutorFactory creates a new QueryExecutor.
@@ -131,12 +138,24 @@ func NewServerWithForwarderAndPlanner(env querybrokerenv.QueryBrokerEnv,
 		planner:           planner,
 		queryExecFactory:  queryExecFactory,
 		healthcheckQuitCh: make(chan struct{}),
+		exportTracker:     newBusyTracker(),
 	}
 	s.hcStatus.Store(fmt.Errorf("no healthcheck has run yet"))
 	go s.runHealthcheck()
 	return s, nil
 }
 
+// SetQueryCache enables caching the results of scripts in the given cache.
+func (s *Server) SetQueryCache(c *QueryCache) {
+	s.queryCache = c
+}
+
+// SetQueryAdmission makes the server wait for the given admission control before running scripts, and
+// enforce its limits on them.
+func (s *Server) SetQueryAdmission(a *QueryAdmission) {
+	s.queryAdmission = a
+}
+
 // Close frees the planner memory in the server.
 func (s *Server) Close() {
 	s.healthcheckQuitOnce.Do(func() { close(s.healthcheckQuitCh) })
@@ -308,6 +327,9 @@ func (e *encryptConsumer) Consume(result *vizierpb.ExecuteScriptResponse) error
 // ExecuteScript executes the script and sends results through the gRPC stream.
 func (s *Server) ExecuteScript(req *vizierpb.ExecuteScriptRequest, srv vizierpb.VizierService_ExecuteScriptServer) error {
 	ctx := context.WithValue(srv.Context(), execStartKey, time.Now())
+	if err := validateResultOptions(req.ResultOptions); err != nil {
+		return err
+	}
 
 	var consumer QueryResultConsumer
 	consumer = &executeServerConsumer{
@@ -320,13 +342,83 @@ func (s *Server) ExecuteScript(req *vizierpb.ExecuteScriptRequest, srv vizierpb.
 		}
 		consumer = c
 	}
+	var sink ResultSink
+	if req.Configs.GetResultSinkConfig() != nil {
+		var err error
+		sink, err = NewResultSink(ctx, req.Configs.ResultSinkConfig)
+		if err != nil {
+			return err
+		}
+		// The sink consumer wraps any encryption, since only results sent to the client need to be encrypted.
+		consumer = newResultSinkConsumer(ctx, consumer, sink, s.exportTracker)
+	}
+	if req.ResultOptions != nil {
+		// The result options apply to both the client and any result sink.
+		consumer = newResultOptionsConsumer(consumer, req.ResultOptions)
+	}
+
+	var cacheKey string
+	var cacheConsumer *queryCacheConsumer
+	if s.queryCache != nil {
+		if key, ok := s.queryCache.key(req); ok {
+			if cached := s.queryCache.get(key); cached != nil {
+				return replayCachedResults(cached, consumer)
+			}
+			// The cache records the results before any result options are applied, so that they can be
+			// replayed with other options.
+			cacheKey = key
+			cacheConsumer = newQueryCacheConsumer(consumer, s.queryCache.maxBytes)
+			consumer = cacheConsumer
+		}
+	}
+
+	execCtx := ctx
+	var maxExecutionTime time.Duration
+	if s.queryAdmission != nil {
+		r := requesterOf(ctx)
+		release, err := s.queryAdmission.admit(ctx, r)
+		if err != nil {
+			if sink != nil {
+				_ = sink.Close(err)
+			}
+			return err
+		}
+		defer release()
+		var maxResultBytes int64
+		maxExecutionTime, maxResultBytes = s.queryAdmission.limits.forRequester(r)
+		if maxResultBytes > 0 {
+			// The limit applies to the results of the query, before any of them are dropped by the result options.
+			consumer = newResultLimitConsumer(consumer, maxResultBytes)
+		}
+		if maxExecutionTime > 0 {
+			var cancel context.CancelFunc
+			execCtx, cancel = context.WithTimeout(ctx, maxExecutionTime)
+			defer cancel()
+		}
+	}
+
 	queryExec := s.queryExecFactory(s, NewMutationExecutor)
-	if err := queryExec.Run(ctx, req, consumer); err != nil {
+	if err := queryExec.Run(execCtx, req, consumer); err != nil {
+		if sink != nil {
+			_ = sink.Close(err)
+		}
 		return err
 	}
 	log.Infof("Launched query: %s", queryExec.QueryID())
 
-	return queryExec.Wait()
+	err := queryExec.Wait()
+	if err != nil && execCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		err = status.Errorf(codes.ResourceExhausted, "the script ran longer than the limit of %s", maxExecutionTime)
+	}
+	if sink != nil {
+		if closeErr := sink.Close(err); closeErr != nil && err == nil {
+			err = status.Errorf(codes.Unavailable, "failed to write results to result sink: %v", closeErr)
+		}
+	}
+	if err == nil && cacheConsumer != nil && !cacheConsumer.tooLarge {
+		s.queryCache.put(cacheKey, cacheConsumer.responses, cacheConsumer.size)
+	}
+	return err
 }
 
 // GenerateOTelScript generates an OTel script for the given DataFrame script.
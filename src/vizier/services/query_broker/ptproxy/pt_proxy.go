@@ -37,6 +37,8 @@ import (
 
 	"px.dev/pixie/src/api/proto/vizierpb"
 	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/tracing"
 )
 
 // PassthroughRequestChannel is the NATS channel over which stream API requests are sent.
@@ -123,7 +125,8 @@ func (s *PassThroughProxy) handleMessage(msg *nats.Msg) error {
 	}
 
 	if req.GetCancelReq() == nil {
-		err = s.handleRequest(req)
+		// The request continues the trace of the cloud request that it was proxied from.
+		err = s.handleRequest(msgbus.ContextFromNATSMsg(msg), req)
 	} else {
 		err = s.handleCancel(req)
 	}
@@ -131,7 +134,7 @@ func (s *PassThroughProxy) handleMessage(msg *nats.Msg) error {
 	return err
 }
 
-func (s *PassThroughProxy) handleRequest(req *cvmsgspb.C2VAPIStreamRequest) error {
+func (s *PassThroughProxy) handleRequest(ctx context.Context, req *cvmsgspb.C2VAPIStreamRequest) error {
 	log.Trace("Handling C2VAPIStreamRequest")
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -140,7 +143,7 @@ func (s *PassThroughProxy) handleRequest(req *cvmsgspb.C2VAPIStreamRequest) erro
 		log.WithField("RequestID", req.RequestID).Info("Request with ID already exists")
 	} else {
 		// Start go-routine to handle request.
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, cancel := context.WithCancel(ctx)
 		ctx = metadata.AppendToOutgoingContext(ctx, "authorization",
 			fmt.Sprintf("bearer %s", req.Token))
 
@@ -174,7 +177,10 @@ func (s *PassThroughProxy) handleCancel(req *cvmsgspb.C2VAPIStreamRequest) error
 func (s *PassThroughProxy) runRequest(reqState *RequestState, msg *cvmsgspb.C2VAPIStreamRequest) {
 	defer s.cleanupRequest(reqState)
 
-	log.WithField("type", reflect.TypeOf(msg.Msg)).Info("Got passthrough request")
+	log.WithField("type", reflect.TypeOf(msg.Msg)).
+		WithField("request_id", reqState.requestID).
+		WithField("trace_id", tracing.TraceID(reqState.ctx)).
+		Info("Got passthrough request")
 	var stream Stream
 	switch msg.Msg.(type) {
 	case *cvmsgspb.C2VAPIStreamRequest_ExecReq:
@@ -185,20 +191,20 @@ func (s *PassThroughProxy) runRequest(reqState *RequestState, msg *cvmsgspb.C2VA
 		resp, err := s.vzClient.GenerateOTelScript(reqState.ctx, msg.GetGenerateOTelScriptReq())
 		if err != nil {
 			v2cResp := formatStatusMessage(reqState.requestID, status.Code(err), err.Error())
-			s.sendMessage(reqState.requestID, v2cResp)
+			s.sendMessage(reqState.ctx, reqState.requestID, v2cResp)
 			return
 		}
 		// Wrap message in V2CAPIStreamResponse.
-		s.sendMessage(reqState.requestID, &cvmsgspb.V2CAPIStreamResponse{
+		s.sendMessage(reqState.ctx, reqState.requestID, &cvmsgspb.V2CAPIStreamResponse{
 			RequestID: reqState.requestID,
 			Msg: &cvmsgspb.V2CAPIStreamResponse_GenerateOTelScriptResp{
 				GenerateOTelScriptResp: resp,
 			},
 		})
-		s.sendMessage(reqState.requestID, formatStatusMessage(reqState.requestID, codes.OK, ""))
+		s.sendMessage(reqState.ctx, reqState.requestID, formatStatusMessage(reqState.requestID, codes.OK, ""))
 		return
 	default:
-		s.sendMessage(reqState.requestID, formatStatusMessage(reqState.requestID, codes.InvalidArgument, fmt.Sprintf("Unknown request type %s", reflect.TypeOf(msg.Msg))))
+		s.sendMessage(reqState.ctx, reqState.requestID, formatStatusMessage(reqState.requestID, codes.InvalidArgument, fmt.Sprintf("Unknown request type %s", reflect.TypeOf(msg.Msg))))
 		log.Error("Unhandled message type")
 		return
 	}
@@ -214,22 +220,22 @@ func (s *PassThroughProxy) runRequest(reqState *RequestState, msg *cvmsgspb.C2VA
 		if err != nil && err == io.EOF {
 			log.Trace("Stream has closed (Read)")
 			v2cResp := formatStatusMessage(reqState.requestID, codes.OK, "")
-			s.sendMessage(reqState.requestID, v2cResp)
+			s.sendMessage(reqState.ctx, reqState.requestID, v2cResp)
 			return
 		}
 		if err != nil && (errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled) {
 			log.Trace("Stream has been cancelled")
 			v2cResp := formatStatusMessage(reqState.requestID, codes.Canceled, "")
-			s.sendMessage(reqState.requestID, v2cResp)
+			s.sendMessage(reqState.ctx, reqState.requestID, v2cResp)
 			return
 		}
 		if err != nil {
 			v2cResp := formatStatusMessage(reqState.requestID, status.Code(err), err.Error())
-			s.sendMessage(reqState.requestID, v2cResp)
+			s.sendMessage(reqState.ctx, reqState.requestID, v2cResp)
 			return
 		}
 		log.Trace("Sending response message from stream")
-		s.sendMessage(reqState.requestID, msg)
+		s.sendMessage(reqState.ctx, reqState.requestID, msg)
 	}
 }
 
@@ -245,7 +251,7 @@ func formatStatusMessage(reqID string, code codes.Code, message string) *cvmsgsp
 	}
 }
 
-func (s *PassThroughProxy) sendMessage(reqID string, msg *cvmsgspb.V2CAPIStreamResponse) {
+func (s *PassThroughProxy) sendMessage(ctx context.Context, reqID string, msg *cvmsgspb.V2CAPIStreamResponse) {
 	topic := fmt.Sprintf("v2c.reply-%s", reqID)
 	// Wrap message in V2C message.
 	reqAnyMsg, err := types.MarshalAny(msg)
@@ -262,13 +268,13 @@ func (s *PassThroughProxy) sendMessage(reqID string, msg *cvmsgspb.V2CAPIStreamR
 		return
 	}
 
-	err = s.nc.Publish(topic, b)
+	err = msgbus.PublishWithContext(ctx, s.nc, topic, b)
 	// If the err is a max payload, let's try to propagate it up, otherwise nats errors
 	// mean something is broken with nats and retrying can be catastrophic.limit
 	if err != nil && err == nats.ErrMaxPayload {
 		errResp := formatStatusMessage(reqID, codes.Internal, "Large data batch rejected "+
 			"by passthrough proxy limits. The Pixie team is currently working on this. In the meantime, please add a head() to your query to avoid the problem.")
-		s.sendMessage(reqID, errResp)
+		s.sendMessage(ctx, reqID, errResp)
 	} else if err != nil {
 		log.WithError(err).Error("Failed to publish message")
 	}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -39,12 +40,14 @@ import (
 	"px.dev/pixie/src/shared/services/healthz"
 	"px.dev/pixie/src/shared/services/httpmiddleware"
 	"px.dev/pixie/src/shared/services/metrics"
+	"px.dev/pixie/src/shared/services/msgbus"
 	"px.dev/pixie/src/shared/services/server"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/query_broker/controllers"
 	"px.dev/pixie/src/vizier/services/query_broker/ptproxy"
 	"px.dev/pixie/src/vizier/services/query_broker/querybrokerenv"
 	scriptrunner "px.dev/pixie/src/vizier/services/query_broker/script_runner"
+	"px.dev/pixie/src/vizier/services/query_broker/selftest"
 	"px.dev/pixie/src/vizier/services/query_broker/tracker"
 )
 
@@ -60,6 +63,8 @@ func init() {
 	pflag.String("mds_port", "50400", "The querybroker service port")
 	pflag.String("pod_namespace", "pl", "The namespace this pod runs in.")
 	pflag.StringArray("cron_script_sources", scriptrunner.DefaultSources, "Where to find cron scripts (cloud, configmaps)")
+	pflag.Duration("saturation_report_interval", 10*time.Second, "How often to report the saturation of kelvin and the result exports to the metadata service, "+
+		"which uses them to apply backpressure to the PEMs. Should be well below the metadata service's backpressure_report_ttl.")
 }
 
 // NewVizierServiceClient creates a new vz RPC client stub.
@@ -147,13 +152,7 @@ func main() {
 
 	// Connect to NATS.
 	var natsConn *nats.Conn
-	if viper.GetBool("disable_ssl") {
-		natsConn, err = nats.Connect("pl-nats")
-	} else {
-		natsConn, err = nats.Connect("pl-nats",
-			nats.ClientCert(viper.GetString("client_tls_cert"), viper.GetString("client_tls_key")),
-			nats.RootCAs(viper.GetString("tls_ca_cert")))
-	}
+	natsConn, err = nats.Connect(viper.GetString("nats_url"), msgbus.NATSConnectOptions()...)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to connect to NATS.")
 	}
@@ -176,6 +175,30 @@ func main() {
 		log.WithError(err).Fatal("Failed to initialize GRPC server funcs.")
 	}
 	defer svr.Close()
+	if ttl := viper.GetDuration("query_cache_ttl"); ttl > 0 {
+		svr.SetQueryCache(controllers.NewQueryCache(ttl, viper.GetInt64("query_cache_max_bytes")))
+	}
+	queryLimits := controllers.QueryLimits{
+		MaxConcurrent:        viper.GetInt("max_concurrent_queries"),
+		MaxConcurrentPerUser: viper.GetInt("max_concurrent_queries_per_user"),
+		MaxQueued:            viper.GetInt("max_queued_queries"),
+		MaxQueueTime:         viper.GetDuration("max_query_queue_time"),
+		MaxExecutionTime:     viper.GetDuration("max_query_execution_time"),
+		MaxResultBytes:       viper.GetInt64("max_query_result_bytes"),
+	}
+	if path := viper.GetString("query_limit_overrides_file"); path != "" {
+		queryLimits.Overrides, err = controllers.LoadQueryLimitOverrides(path)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load the query limit overrides")
+		}
+	}
+	svr.SetQueryAdmission(controllers.NewQueryAdmission(queryLimits))
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to get hostname")
+	}
+	go svr.RunSaturationReporter(viper.GetDuration("saturation_report_interval"), hostname)
 
 	// For query broker we bump up the max message size since resuls might be larger than 4mb.
 	maxMsgSize := grpc.MaxRecvMsgSize(8 * 1024 * 1024)
@@ -215,6 +238,8 @@ func main() {
 		viper.GetStringSlice("cron_script_sources"),
 	)
 	sr := scriptrunner.New(csClient, vzServiceClient, viper.GetString("jwt_signing_key"), sources...)
+	// Action requests are only executed if the metadata service has actions enabled.
+	sr.SetActionPublisher(natsConn.Publish)
 
 	// Load the scripts and start the background sync.
 	go func() {
@@ -224,6 +249,11 @@ func main() {
 		}
 	}()
 
+	// Start the PEM self-test.
+	st := selftest.New(mdsClient, vzServiceClient, natsConn, viper.GetString("jwt_signing_key"))
+	st.Start()
+	defer st.Stop()
+
 	s.Start()
 	s.StopOnInterrupt()
 }
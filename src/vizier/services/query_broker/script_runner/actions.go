@@ -0,0 +1,127 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scriptrunner
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/shared/scripts"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/actions"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+)
+
+// PublishFn publishes a message to the message bus.
+type PublishFn func(subject string, data []byte) error
+
+// actionExporter turns the rows of the actions table of a script into action requests, which it signs
+// and publishes to the metadata service.
+type actionExporter struct {
+	config     *scripts.ActionsConfig
+	publish    PublishFn
+	signingKey string
+	clock      clock.Clock
+	scriptID   uuid.UUID
+
+	// tableID and columns are set once the metadata of the actions table has been received.
+	tableID string
+	columns []string
+}
+
+func newActionExporter(config *scripts.ActionsConfig, publish PublishFn, signingKey string, clk clock.Clock, scriptID uuid.UUID) (*actionExporter, error) {
+	if config.Table == "" {
+		return nil, &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY, msg: "actions config has no table"}
+	}
+	if publish == nil {
+		return nil, &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY, msg: "script triggered actions are not enabled"}
+	}
+	return &actionExporter{
+		config:     config,
+		publish:    publish,
+		signingKey: signingKey,
+		clock:      clk,
+		scriptID:   scriptID,
+	}, nil
+}
+
+// handleMetadata records the ID of the actions table, if md describes it.
+func (a *actionExporter) handleMetadata(md *vizierpb.QueryMetadata) {
+	if md.Name != a.config.Table {
+		return
+	}
+	a.tableID = md.ID
+	a.columns = nil
+	for _, col := range md.Relation.GetColumns() {
+		a.columns = append(a.columns, col.ColumnName)
+	}
+}
+
+// handleBatch publishes an action request for every row of the batch, if it belongs to the actions table.
+func (a *actionExporter) handleBatch(batch *vizierpb.RowBatchData) error {
+	if a.tableID == "" || batch.TableID != a.tableID {
+		return nil
+	}
+	for _, row := range rowsFromBatch(a.columns, batch) {
+		req, err := actionRequestFromRow(row)
+		if err != nil {
+			return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY, msg: err.Error()}
+		}
+		// The script ID is set here rather than by the script, and is covered by the signature.
+		req.ScriptID = a.scriptID.String()
+		b, err := actions.SignRequest(req, a.signingKey, a.clock.Now())
+		if err != nil {
+			return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY, msg: fmt.Sprintf("failed to sign action request: %v", err)}
+		}
+		if err := a.publish(actions.RequestTopic, b); err != nil {
+			return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY, msg: fmt.Sprintf("failed to publish action request: %v", err)}
+		}
+	}
+	return nil
+}
+
+// actionRequestFromRow converts a row of the actions table into an action request.
+func actionRequestFromRow(row map[string]interface{}) (*actions.Request, error) {
+	str := func(col string) string {
+		s, _ := row[col].(string)
+		return s
+	}
+	req := &actions.Request{
+		Type:      actions.Type(str("type")),
+		Kind:      str("kind"),
+		Namespace: str("namespace"),
+		Name:      str("name"),
+		Reason:    str("reason"),
+	}
+	if req.Type == "" || req.Namespace == "" || req.Name == "" {
+		return nil, fmt.Errorf("action rows need type, namespace and name columns")
+	}
+	if replicas, ok := row["replicas"].(int64); ok {
+		req.Replicas = int32(replicas)
+	}
+	if annotations := str("annotations"); annotations != "" {
+		if err := json.Unmarshal([]byte(annotations), &req.Annotations); err != nil {
+			return nil, fmt.Errorf("invalid annotations %q: %v", annotations, err)
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scriptrunner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/actions"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+)
+
+func actionsTestResponses() []*vizierpb.ExecuteScriptResponse {
+	return []*vizierpb.ExecuteScriptResponse{
+		{
+			Result: &vizierpb.ExecuteScriptResponse_MetaData{
+				MetaData: &vizierpb.QueryMetadata{
+					Name: "restarts",
+					ID:   "table1",
+					Relation: &vizierpb.Relation{
+						Columns: []*vizierpb.Relation_ColumnInfo{
+							{ColumnName: "type"},
+							{ColumnName: "namespace"},
+							{ColumnName: "name"},
+							{ColumnName: "reason"},
+						},
+					},
+				},
+			},
+		},
+		{
+			Result: &vizierpb.ExecuteScriptResponse_Data{
+				Data: &vizierpb.QueryData{
+					Batch: &vizierpb.RowBatchData{
+						TableID: "table1",
+						NumRows: 1,
+						Cols: []*vizierpb.Column{
+							{ColData: &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: [][]byte{[]byte("DeletePod")}}}},
+							{ColData: &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: [][]byte{[]byte("default")}}}},
+							{ColData: &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: [][]byte{[]byte("frontend-abc")}}}},
+							{ColData: &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: [][]byte{[]byte("OOM loop")}}}},
+						},
+					},
+				},
+			},
+		},
+		{
+			Result: &vizierpb.ExecuteScriptResponse_Data{
+				Data: &vizierpb.QueryData{
+					ExecutionStats: &vizierpb.QueryExecutionStats{
+						Timing:           &vizierpb.QueryTimingInfo{},
+						RecordsProcessed: 1,
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestScriptRunner_Actions(t *testing.T) {
+	script := &cvmsgspb.CronScript{
+		ID:         utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		Script:     "px.display(df, 'restarts')",
+		FrequencyS: 5,
+		Configs: `actionsConfig:
+  table: restarts
+`,
+	}
+	id := uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")
+	clk := clock.NewFakeClock(time.Unix(1700000000, 0))
+
+	t.Run("publishes signed requests", func(t *testing.T) {
+		var published [][]byte
+		r := newRunner(script, &fakeVizierServiceClient{responses: actionsTestResponses()}, "test", id, &fakeCronStore{}, clk)
+		r.publishAction = func(subject string, data []byte) error {
+			require.Equal(t, actions.RequestTopic, subject)
+			published = append(published, data)
+			return nil
+		}
+
+		result := r.executeScript(context.Background(), clk.Now(), clk.Now().Add(5*time.Second))
+		require.NotNil(t, result)
+		require.Equal(t, storepb.CRON_SCRIPT_EXPORT_STAGE_COMPLETE, result.Stage)
+		require.Len(t, published, 1)
+
+		req, err := actions.VerifyRequest(published[0], "test", clk.Now())
+		require.NoError(t, err)
+		require.Equal(t, id.String(), req.ScriptID)
+		require.Equal(t, actions.DeletePod, req.Type)
+		require.Equal(t, "default", req.Namespace)
+		require.Equal(t, "frontend-abc", req.Name)
+		require.Equal(t, "OOM loop", req.Reason)
+		require.True(t, clk.Now().Equal(req.IssuedAt))
+	})
+
+	t.Run("fails without a publisher", func(t *testing.T) {
+		r := newRunner(script, &fakeVizierServiceClient{responses: actionsTestResponses()}, "test", id, &fakeCronStore{}, clk)
+
+		result := r.executeScript(context.Background(), clk.Now(), clk.Now().Add(5*time.Second))
+		require.NotNil(t, result)
+		require.Equal(t, storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY, result.Stage)
+		require.NotNil(t, result.GetError())
+	})
+}
@@ -91,6 +91,19 @@ func (source *CloudSource) Stop() {
 	source.stop()
 }
 
+// ReportExecution sends the result of a run of a script to the cloud, which keeps the execution history of the script.
+func (source *CloudSource) ReportExecution(result *cvmsgspb.CronScriptExecutionResult) {
+	data, err := marshalV2C(result)
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal cron script execution result")
+		return
+	}
+	err = source.nc.Publish(CronScriptExecutionResultChannel, data)
+	if err != nil {
+		log.WithError(err).Error("Failed to publish cron script execution result")
+	}
+}
+
 func (source *CloudSource) executeInOrder(sID uuid.UUID, timestamp int64, exec func()) {
 	source.updateTimeMu.Lock()
 	defer source.updateTimeMu.Unlock()
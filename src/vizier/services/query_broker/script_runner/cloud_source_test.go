@@ -761,6 +761,34 @@ func countAllMessages(updatesCh chan *cvmsgspb.CronScriptUpdate) int {
 	}
 }
 
+func TestCloudScriptsSource_ReportExecution(t *testing.T) {
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+
+	resultCh := make(chan *nats.Msg, 1)
+	sub, err := nc.ChanSubscribe(CronScriptExecutionResultChannel, resultCh)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, sub.Unsubscribe())
+	}()
+
+	expected := &cvmsgspb.CronScriptExecutionResult{
+		ScriptID:   utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		DurationNs: 1000,
+		Attempts:   2,
+		Error:      "Internal",
+	}
+	source := NewCloudSource(nc, &fakeCronStore{}, "test")
+	source.ReportExecution(expected)
+
+	msg := requireReceiveWithin(t, resultCh, time.Second)
+	v2cMsg := &cvmsgspb.V2CMessage{}
+	require.NoError(t, proto.Unmarshal(msg.Data, v2cMsg))
+	result := &cvmsgspb.CronScriptExecutionResult{}
+	require.NoError(t, types.UnmarshalAny(v2cMsg.Msg, result))
+	require.Equal(t, expected, result)
+}
+
 func sendUpdates(t *testing.T, nc *nats.Conn, updates []*cvmsgspb.CronScriptUpdate) {
 	for _, update := range updates {
 		updateMsg, err := types.MarshalAny(update)
@@ -816,6 +844,10 @@ func (s *stubCronScriptStore) GetAllExecutionResults(_ context.Context, _ *metad
 	return s.GetAllExecutionResultsResponse, s.GetAllExecutionResultsError
 }
 
+func (s *stubCronScriptStore) GetExecutionResult(_ context.Context, _ *metadatapb.GetExecutionResultRequest, _ ...grpc.CallOption) (*metadatapb.GetExecutionResultResponse, error) {
+	return &metadatapb.GetExecutionResultResponse{}, nil
+}
+
 func setupChecksumSubscription(t *testing.T, nc *nats.Conn, cloudScripts map[string]*cvmsgspb.CronScript) (*nats.Subscription, chan struct{}) {
 	gotChecksumReq := make(chan struct{}, 1)
 	checksumSub, err := nc.Subscribe(CronScriptChecksumRequestChannel, func(msg *nats.Msg) {
@@ -178,6 +178,10 @@ func (s *fakeCronStore) GetAllExecutionResults(ctx context.Context, req *metadat
 	return &metadatapb.GetAllExecutionResultsResponse{}, nil
 }
 
+func (s *fakeCronStore) GetExecutionResult(ctx context.Context, req *metadatapb.GetExecutionResultRequest, opts ...grpc.CallOption) (*metadatapb.GetExecutionResultResponse, error) {
+	return &metadatapb.GetExecutionResultResponse{}, nil
+}
+
 type fakeExecuteScriptClient struct {
 	// The error to send if not nil. The informer does not send responses if this is not nil.
 	err       error
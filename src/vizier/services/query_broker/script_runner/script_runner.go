@@ -22,6 +22,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"regexp"
 	"sync"
 	"time"
 
@@ -41,9 +43,11 @@ import (
 	"px.dev/pixie/src/shared/cvmsgs"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/shared/scripts"
+	"px.dev/pixie/src/shared/services/clock"
 	svcutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/utils/messagebus"
 )
 
@@ -60,8 +64,12 @@ var (
 	CronScriptUpdatesChannel = messagebus.C2VTopic(cvmsgs.CronScriptUpdatesChannel)
 	// CronScriptUpdatesResponseChannel is the NATS channel that script updates are published to.
 	CronScriptUpdatesResponseChannel = messagebus.V2CTopic(cvmsgs.CronScriptUpdatesResponseChannel)
+	// CronScriptExecutionResultChannel is the NATS channel that the results of cron script runs are published to.
+	CronScriptExecutionResultChannel = messagebus.V2CTopic(cvmsgs.CronScriptExecutionResultChannel)
 	natsWaitTimeout                  = 2 * time.Minute
 	defaultOTelTimeoutS              = int64(5)
+	// defaultRetryBackoff is the delay before the first retry of a failed run, if the retry policy doesn't specify one.
+	defaultRetryBackoff = 5 * time.Second
 )
 
 // ScriptRunner tracks registered cron scripts and runs them according to schedule.
@@ -78,6 +86,10 @@ type ScriptRunner struct {
 	updatesCh  chan *cvmsgspb.CronScriptUpdate
 	baseCtx    context.Context
 	sources    []Source
+	reporters  []ExecutionReporter
+	clock      clock.Clock
+	// publishAction publishes the action requests of scripts that have an actions config.
+	publishAction PublishFn
 }
 
 // New creates a new script runner.
@@ -88,6 +100,12 @@ func New(
 	scriptSources ...Source,
 ) *ScriptRunner {
 	baseCtx, cancel := context.WithCancel(context.Background())
+	var reporters []ExecutionReporter
+	for _, source := range scriptSources {
+		if reporter, ok := source.(ExecutionReporter); ok {
+			reporters = append(reporters, reporter)
+		}
+	}
 	return &ScriptRunner{
 		csClient:   csClient,
 		vzClient:   vzClient,
@@ -100,9 +118,17 @@ func New(
 		updatesCh:  make(chan *cvmsgspb.CronScriptUpdate, 4096),
 		baseCtx:    baseCtx,
 		sources:    scriptSources,
+		reporters:  reporters,
+		clock:      clock.New(),
 	}
 }
 
+// SetActionPublisher enables script triggered actions, which are published with the given function.
+// It must be called before SyncScripts.
+func (s *ScriptRunner) SetActionPublisher(publish PublishFn) {
+	s.publishAction = publish
+}
+
 // Stop performs any necessary cleanup before shutdown.
 func (s *ScriptRunner) Stop() {
 	s.once.Do(func() {
@@ -160,7 +186,9 @@ func (s *ScriptRunner) upsertScript(id uuid.UUID, script *cvmsgspb.CronScript) {
 		v.stop()
 		delete(s.runnerMap, id)
 	}
-	r := newRunner(script, s.vzClient, s.signingKey, id, s.csClient)
+	r := newRunner(script, s.vzClient, s.signingKey, id, s.csClient, s.clock)
+	r.reporters = s.reporters
+	r.publishAction = s.publishAction
 	s.runnerMap[id] = r
 	go r.start()
 }
@@ -182,10 +210,16 @@ type runner struct {
 	config     *scripts.Config
 
 	lastRun time.Time
+	clock   clock.Clock
 
 	csClient   metadatapb.CronScriptStoreServiceClient
 	vzClient   vizierpb.VizierServiceClient
 	signingKey string
+	reporters  []ExecutionReporter
+	// httpClient is used to send the results of scripts which export to a webhook.
+	httpClient *http.Client
+	// publishAction is used to publish the action requests of scripts which have an actions config.
+	publishAction PublishFn
 
 	done chan struct{}
 	once sync.Once
@@ -193,7 +227,7 @@ type runner struct {
 	scriptID uuid.UUID
 }
 
-func newRunner(script *cvmsgspb.CronScript, vzClient vizierpb.VizierServiceClient, signingKey string, id uuid.UUID, csClient metadatapb.CronScriptStoreServiceClient) *runner {
+func newRunner(script *cvmsgspb.CronScript, vzClient vizierpb.VizierServiceClient, signingKey string, id uuid.UUID, csClient metadatapb.CronScriptStoreServiceClient, clk clock.Clock) *runner {
 	// Parse config YAML into struct.
 	var config scripts.Config
 	err := yaml.Unmarshal([]byte(script.Configs), &config)
@@ -210,6 +244,8 @@ func newRunner(script *cvmsgspb.CronScript, vzClient vizierpb.VizierServiceClien
 		signingKey: signingKey,
 		config:     &config,
 		scriptID:   id,
+		clock:      clk,
+		httpClient: http.DefaultClient,
 	}
 }
 
@@ -245,6 +281,75 @@ func VizierStatusToStatus(s *vizierpb.Status) (*statuspb.Status, error) {
 	}, nil
 }
 
+// exportBatchIDHeader is the header that carries the ID of the export batch to the plugin endpoint,
+// so that the exported data can be traced back to the run of the script that produced it.
+const exportBatchIDHeader = "px-export-batch-id"
+
+// otelExportErrorRegex matches the errors that Carnot returns when an OTel export fails, and captures
+// the gRPC code that the plugin endpoint returned.
+var otelExportErrorRegex = regexp.MustCompile(`OTel export \(carnot node_id=\d+\) failed with error '(\w+)'`)
+
+// exportStageForError returns the stage that an export batch failed at, given the error message of
+// the script execution.
+func exportStageForError(msg string) storepb.CronScriptExportStage {
+	matches := otelExportErrorRegex.FindStringSubmatch(msg)
+	if matches == nil {
+		return storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY
+	}
+	switch matches[1] {
+	case "UNAVAILABLE", "DEADLINE_EXCEEDED":
+		// The data never reached the plugin endpoint.
+		return storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY
+	default:
+		return storepb.CRON_SCRIPT_EXPORT_STAGE_ACK
+	}
+}
+
+func (r *runner) recordResult(ctx context.Context, req *metadatapb.RecordExecutionResultRequest) {
+	if req.Stage != storepb.CRON_SCRIPT_EXPORT_STAGE_COMPLETE {
+		log.WithField("script_id", r.scriptID).
+			WithField("batch_id", utils.UUIDFromProtoOrNil(req.BatchID)).
+			WithField("stage", req.Stage).
+			Info("Cron script export batch failed")
+	}
+	_, err := r.csClient.RecordExecutionResult(ctx, req)
+	if err != nil {
+		grpcStatus, ok := status.FromError(err)
+		if !ok || grpcStatus.Code() != codes.Unavailable {
+			log.WithError(err).Error("Error while recording cron script execution result")
+		}
+	}
+}
+
+// retryBackoff returns how long to wait before retrying a run that failed on the given attempt.
+func retryBackoff(policy *cvmsgspb.CronScriptRetryPolicy, attempt int) time.Duration {
+	backoff := defaultRetryBackoff
+	if policy.InitialBackoffS > 0 {
+		backoff = time.Duration(policy.InitialBackoffS) * time.Second
+	}
+	maxBackoff := time.Duration(policy.MaxBackoffS) * time.Second
+	if policy.ExponentialBackoff {
+		for i := 1; i < attempt; i++ {
+			backoff *= 2
+			if maxBackoff > 0 && backoff >= maxBackoff {
+				break
+			}
+		}
+	}
+	if maxBackoff > 0 && backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func (r *runner) reportExecution(result *cvmsgspb.CronScriptExecutionResult) {
+	for _, reporter := range r.reporters {
+		reporter.ReportExecution(result)
+	}
+}
+
+// runScript runs the script once for the given period, and retries it according to the retry policy of the
+// script if it fails. Retries delay the next scheduled run of the script.
 func (r *runner) runScript(scriptPeriod time.Duration) {
 	claims := svcutils.GenerateJWTForService("query_broker", "vizier")
 	token, _ := svcutils.SignJWTClaims(claims, r.signingKey)
@@ -254,21 +359,110 @@ func (r *runner) runScript(scriptPeriod time.Duration) {
 	ctx = metadata.AppendToOutgoingContext(ctx, "authorization",
 		fmt.Sprintf("bearer %s", token))
 
+	// We set the time 1 second in the past to cover colletor latency and request latencies
+	// which can cause data overlaps or cause data to be missed.
+	startTime := r.lastRun.Add(-time.Second)
+	endTime := startTime.Add(scriptPeriod)
+	r.lastRun = r.clock.Now()
+
+	runStart := r.clock.Now()
+	maxRetries := int(r.cronScript.RetryPolicy.GetMaxRetries())
+	attempts := 0
+	var result *metadatapb.RecordExecutionResultRequest
+retryLoop:
+	for {
+		attempts++
+		result = r.executeScript(ctx, startTime, endTime)
+		if result != nil {
+			r.recordResult(ctx, result)
+		}
+		if result.GetError() == nil || attempts > maxRetries {
+			break
+		}
+		select {
+		case <-r.done:
+			break retryLoop
+		case <-r.clock.After(retryBackoff(r.cronScript.RetryPolicy, attempts)):
+		}
+	}
+
+	runStartPb, err := types.TimestampProto(runStart)
+	if err != nil {
+		log.WithError(err).Error("Error while creating timestamp proto")
+	}
+	execResult := &cvmsgspb.CronScriptExecutionResult{
+		ScriptID:   utils.ProtoFromUUID(r.scriptID),
+		StartTime:  runStartPb,
+		DurationNs: r.clock.Since(runStart).Nanoseconds(),
+		Attempts:   int32(attempts),
+		Succeeded:  result.GetError() == nil,
+	}
+	if st := result.GetError(); st != nil {
+		execResult.Error = st.Msg
+	}
+	r.reportExecution(execResult)
+}
+
+// executeScript runs a single attempt of the script for the given time range, and returns its result, or nil
+// if the script finished without a result.
+func (r *runner) executeScript(ctx context.Context, startTime time.Time, endTime time.Time) *metadatapb.RecordExecutionResultRequest {
+	batchID := uuid.Must(uuid.NewV4())
+
 	var otelEndpoint *vizierpb.Configs_OTelEndpointConfig
 	if r.config != nil && r.config.OtelEndpointConfig != nil {
+		headers := make(map[string]string, len(r.config.OtelEndpointConfig.Headers)+1)
+		for k, v := range r.config.OtelEndpointConfig.Headers {
+			headers[k] = v
+		}
+		headers[exportBatchIDHeader] = batchID.String()
 		otelEndpoint = &vizierpb.Configs_OTelEndpointConfig{
 			URL:      r.config.OtelEndpointConfig.URL,
-			Headers:  r.config.OtelEndpointConfig.Headers,
+			Headers:  headers,
 			Insecure: r.config.OtelEndpointConfig.Insecure,
 			Timeout:  defaultOTelTimeoutS,
 		}
 	}
 
-	// We set the time 1 second in the past to cover colletor latency and request latencies
-	// which can cause data overlaps or cause data to be missed.
-	startTime := r.lastRun.Add(-time.Second)
-	endTime := startTime.Add(scriptPeriod)
-	r.lastRun = time.Now()
+	tsPb, err := types.TimestampProto(startTime)
+	if err != nil {
+		log.WithError(err).Error("Error while creating timestamp proto")
+	}
+	result := &metadatapb.RecordExecutionResultRequest{
+		ScriptID:  utils.ProtoFromUUID(r.scriptID),
+		Timestamp: tsPb,
+		BatchID:   utils.ProtoFromUUID(batchID),
+	}
+	exportFailed := func(err error) *metadatapb.RecordExecutionResultRequest {
+		result.Stage = storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY
+		if expErr, ok := err.(*exportError); ok {
+			result.Stage = expErr.stage
+		}
+		result.Result = &metadatapb.RecordExecutionResultRequest_Error{
+			Error: &statuspb.Status{
+				ErrCode: statuspb.INTERNAL,
+				Msg:     err.Error(),
+			},
+		}
+		return result
+	}
+
+	// Scripts which export to a webhook stream their results back to the runner, which sends them on
+	// to the webhook, rather than exporting them from Carnot.
+	var webhook *webhookExporter
+	if r.config != nil && r.config.WebhookConfig != nil {
+		webhook, err = newWebhookExporter(r.config.WebhookConfig, r.httpClient, r.clock, r.scriptID, batchID)
+		if err != nil {
+			return exportFailed(err)
+		}
+	}
+	var actionExp *actionExporter
+	if r.config != nil && r.config.ActionsConfig != nil {
+		actionExp, err = newActionExporter(r.config.ActionsConfig, r.publishAction, r.signingKey, r.clock, r.scriptID)
+		if err != nil {
+			return exportFailed(err)
+		}
+	}
+
 	execScriptClient, err := r.vzClient.ExecuteScript(ctx, &vizierpb.ExecuteScriptRequest{
 		QueryStr: r.cronScript.Script,
 		Configs: &vizierpb.Configs{
@@ -282,7 +476,15 @@ func (r *runner) runScript(scriptPeriod time.Duration) {
 	})
 	if err != nil {
 		log.WithError(err).Error("Failed to execute cronscript")
-		return
+		grpcStatus, _ := status.FromError(err)
+		result.Stage = storepb.CRON_SCRIPT_EXPORT_STAGE_EXECUTION
+		result.Result = &metadatapb.RecordExecutionResultRequest_Error{
+			Error: &statuspb.Status{
+				ErrCode: statuspb.Code(grpcStatus.Code()),
+				Msg:     grpcStatus.Message(),
+			},
+		}
+		return result
 	}
 	for {
 		resp, err := execScriptClient.Recv()
@@ -291,86 +493,71 @@ func (r *runner) runScript(scriptPeriod time.Duration) {
 		}
 		if err != nil {
 			grpcStatus, _ := status.FromError(err)
-
-			tsPb, err := types.TimestampProto(startTime)
-			if err != nil {
-				log.WithError(err).Error("Error while creating timestamp proto")
-			}
-
-			_, err = r.csClient.RecordExecutionResult(ctx, &metadatapb.RecordExecutionResultRequest{
-				ScriptID:  utils.ProtoFromUUID(r.scriptID),
-				Timestamp: tsPb,
-				Result: &metadatapb.RecordExecutionResultRequest_Error{
-					Error: &statuspb.Status{
-						ErrCode: statuspb.Code(grpcStatus.Code()),
-						Msg:     grpcStatus.Message(),
-					},
+			result.Stage = exportStageForError(grpcStatus.Message())
+			result.Result = &metadatapb.RecordExecutionResultRequest_Error{
+				Error: &statuspb.Status{
+					ErrCode: statuspb.Code(grpcStatus.Code()),
+					Msg:     grpcStatus.Message(),
 				},
-			})
-			if err != nil {
-				grpcStatus, ok := status.FromError(err)
-				if !ok || grpcStatus.Code() != codes.Unavailable {
-					log.WithError(err).Error("Error while recording cron script execution error")
-				}
 			}
-			break
+			return result
 		}
 
 		if vzStatus := resp.GetStatus(); vzStatus != nil {
-			tsPb, err := types.TimestampProto(startTime)
-			if err != nil {
-				log.WithError(err).Error("Error while creating timestamp proto")
-			}
 			st, err := VizierStatusToStatus(vzStatus)
 			if err != nil {
 				log.WithError(err).Error("Error converting status")
 			}
-
-			_, err = r.csClient.RecordExecutionResult(ctx, &metadatapb.RecordExecutionResultRequest{
-				ScriptID:  utils.ProtoFromUUID(r.scriptID),
-				Timestamp: tsPb,
-				Result: &metadatapb.RecordExecutionResultRequest_Error{
-					Error: st,
-				},
-			})
-			if err != nil {
-				grpcStatus, ok := status.FromError(err)
-				if !ok || grpcStatus.Code() != codes.Unavailable {
-					log.WithError(err).Error("Error while recording cron script execution error")
-				}
+			result.Stage = exportStageForError(vzStatus.Message)
+			result.Result = &metadatapb.RecordExecutionResultRequest_Error{
+				Error: st,
 			}
-			break
+			return result
+		}
+		if md := resp.GetMetaData(); md != nil {
+			if webhook != nil {
+				webhook.handleMetadata(md)
+			}
+			if actionExp != nil {
+				actionExp.handleMetadata(md)
+			}
+			continue
 		}
 		if data := resp.GetData(); data != nil {
-			tsPb, err := types.TimestampProto(startTime)
-			if err != nil {
-				log.WithError(err).Error("Error while creating timestamp proto")
+			if batch := data.GetBatch(); batch != nil && webhook != nil {
+				if err := webhook.handleBatch(ctx, batch); err != nil {
+					return exportFailed(err)
+				}
+			}
+			if batch := data.GetBatch(); batch != nil && actionExp != nil {
+				if err := actionExp.handleBatch(batch); err != nil {
+					return exportFailed(err)
+				}
 			}
 			stats := data.GetExecutionStats()
 			if stats == nil {
 				continue
 			}
-			_, err = r.csClient.RecordExecutionResult(ctx, &metadatapb.RecordExecutionResultRequest{
-				ScriptID:  utils.ProtoFromUUID(r.scriptID),
-				Timestamp: tsPb,
-				Result: &metadatapb.RecordExecutionResultRequest_ExecutionStats{
-					ExecutionStats: &metadatapb.ExecutionStats{
-						ExecutionTimeNs:   stats.Timing.ExecutionTimeNs,
-						CompilationTimeNs: stats.Timing.CompilationTimeNs,
-						BytesProcessed:    stats.BytesProcessed,
-						RecordsProcessed:  stats.RecordsProcessed,
-					},
-				},
-			})
-			if err != nil {
-				grpcStatus, ok := status.FromError(err)
-				if !ok || grpcStatus.Code() != codes.Unavailable {
-					log.WithError(err).Error("Error recording execution stats")
+			if webhook != nil {
+				if err := webhook.flush(ctx); err != nil {
+					return exportFailed(err)
 				}
 			}
-			break
+			// The execution stats are only sent once the query has finished, which means that every
+			// export to the plugin endpoint was acknowledged.
+			result.Stage = storepb.CRON_SCRIPT_EXPORT_STAGE_COMPLETE
+			result.Result = &metadatapb.RecordExecutionResultRequest_ExecutionStats{
+				ExecutionStats: &metadatapb.ExecutionStats{
+					ExecutionTimeNs:   stats.Timing.ExecutionTimeNs,
+					CompilationTimeNs: stats.Timing.CompilationTimeNs,
+					BytesProcessed:    stats.BytesProcessed,
+					RecordsProcessed:  stats.RecordsProcessed,
+				},
+			}
+			return result
 		}
 	}
+	return nil
 }
 
 func (r *runner) start() {
@@ -378,8 +565,8 @@ func (r *runner) start() {
 		return
 	}
 	scriptPeriod := time.Duration(r.cronScript.FrequencyS) * time.Second
-	ticker := time.NewTicker(scriptPeriod)
-	r.lastRun = time.Now()
+	ticker := r.clock.NewTicker(scriptPeriod)
+	r.lastRun = r.clock.Now()
 
 	go func() {
 		defer ticker.Stop()
@@ -387,7 +574,7 @@ func (r *runner) start() {
 			select {
 			case <-r.done:
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				r.runScript(scriptPeriod)
 			}
 		}
@@ -37,8 +37,10 @@ import (
 	"px.dev/pixie/src/carnot/planner/compilerpb"
 	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/clock"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
 )
 
 func TestScriptRunner_SyncScripts(t *testing.T) {
@@ -375,6 +377,7 @@ func TestScriptRunner_StoreResults(t *testing.T) {
 		execScriptResponses []*vizierpb.ExecuteScriptResponse
 		// We only test the Result part.
 		expectedExecutionResult *metadatapb.RecordExecutionResultRequest
+		expectedStage           storepb.CronScriptExportStage
 		err                     error
 	}{
 		{
@@ -405,6 +408,7 @@ func TestScriptRunner_StoreResults(t *testing.T) {
 					},
 				},
 			},
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_COMPLETE,
 		},
 		{
 			name: "handles non-compiler error",
@@ -424,6 +428,7 @@ func TestScriptRunner_StoreResults(t *testing.T) {
 					},
 				},
 			},
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY,
 		},
 		{
 			name: "handles compiler error",
@@ -465,6 +470,27 @@ func TestScriptRunner_StoreResults(t *testing.T) {
 					},
 				},
 			},
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY,
+		},
+		{
+			name: "handles export error",
+			execScriptResponses: []*vizierpb.ExecuteScriptResponse{
+				{
+					Status: &vizierpb.Status{
+						Code:    9, // INTERNAL
+						Message: "OTel export (carnot node_id=5) failed with error 'UNAUTHENTICATED'. Details: invalid key",
+					},
+				},
+			},
+			expectedExecutionResult: &metadatapb.RecordExecutionResultRequest{
+				Result: &metadatapb.RecordExecutionResultRequest_Error{
+					Error: &statuspb.Status{
+						ErrCode: statuspb.INTERNAL,
+						Msg:     "OTel export (carnot node_id=5) failed with error 'UNAUTHENTICATED'. Details: invalid key",
+					},
+				},
+			},
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_ACK,
 		},
 		{
 			name: "handles grpc error",
@@ -477,6 +503,7 @@ func TestScriptRunner_StoreResults(t *testing.T) {
 					},
 				},
 			},
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY,
 		},
 	}
 	for _, test := range tests {
@@ -493,8 +520,11 @@ func TestScriptRunner_StoreResults(t *testing.T) {
 
 			id := uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")
 			fvs := &fakeVizierServiceClient{responses: test.execScriptResponses, err: test.err}
-			Runner := newRunner(script, fvs, "test", id, fcs)
+			clk := clock.NewFakeClock(time.Unix(1700000000, 0))
+			Runner := newRunner(script, fvs, "test", id, fcs, clk)
 			Runner.start()
+			clk.BlockUntil(1)
+			clk.Advance(time.Second)
 
 			result := requireReceiveWithin(t, receivedResultRequestCh, 10*time.Second)
 
@@ -504,6 +534,169 @@ func TestScriptRunner_StoreResults(t *testing.T) {
 			require.Equal(t, utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"), result.ScriptID)
 			require.Equal(t, test.expectedExecutionResult.GetError(), result.GetError())
 			require.Equal(t, test.expectedExecutionResult.GetExecutionStats(), result.GetExecutionStats())
+			require.Equal(t, test.expectedStage, result.Stage)
+			require.NotEqual(t, uuid.Nil, utils.UUIDFromProtoOrNil(result.BatchID))
+		})
+	}
+}
+
+func TestExportStageForError(t *testing.T) {
+	tests := []struct {
+		msg           string
+		expectedStage storepb.CronScriptExportStage
+	}{
+		{
+			msg:           "Table 'foo' not found",
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY,
+		},
+		{
+			msg:           "OTel export (carnot node_id=1) failed with error 'UNAVAILABLE'. Details: connection refused",
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY,
+		},
+		{
+			msg:           "OTel export (carnot node_id=1) failed with error 'DEADLINE_EXCEEDED'. Details: ",
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY,
+		},
+		{
+			msg:           "OTel export (carnot node_id=1) failed with error 'PERMISSION_DENIED'. Details: ",
+			expectedStage: storepb.CRON_SCRIPT_EXPORT_STAGE_ACK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.msg, func(t *testing.T) {
+			require.Equal(t, test.expectedStage, exportStageForError(test.msg))
+		})
+	}
+}
+
+type fakeExecutionReporter struct {
+	results chan *cvmsgspb.CronScriptExecutionResult
+}
+
+func (r *fakeExecutionReporter) ReportExecution(result *cvmsgspb.CronScriptExecutionResult) {
+	r.results <- result
+}
+
+func TestScriptRunner_RetryPolicy(t *testing.T) {
+	tests := []struct {
+		name                string
+		execScriptResponses []*vizierpb.ExecuteScriptResponse
+		retryPolicy         *cvmsgspb.CronScriptRetryPolicy
+		expectedAttempts    int32
+		expectedSucceeded   bool
+	}{
+		{
+			name: "does not retry successful runs",
+			execScriptResponses: []*vizierpb.ExecuteScriptResponse{
+				{
+					Result: &vizierpb.ExecuteScriptResponse_Data{
+						Data: &vizierpb.QueryData{
+							ExecutionStats: &vizierpb.QueryExecutionStats{
+								Timing: &vizierpb.QueryTimingInfo{},
+							},
+						},
+					},
+				},
+			},
+			retryPolicy:       &cvmsgspb.CronScriptRetryPolicy{MaxRetries: 2},
+			expectedAttempts:  1,
+			expectedSucceeded: true,
+		},
+		{
+			name: "does not retry without a retry policy",
+			execScriptResponses: []*vizierpb.ExecuteScriptResponse{
+				{Status: &vizierpb.Status{Code: 13, Message: "Internal"}},
+			},
+			expectedAttempts:  1,
+			expectedSucceeded: false,
+		},
+		{
+			name: "retries failed runs",
+			execScriptResponses: []*vizierpb.ExecuteScriptResponse{
+				{Status: &vizierpb.Status{Code: 13, Message: "Internal"}},
+			},
+			retryPolicy:       &cvmsgspb.CronScriptRetryPolicy{MaxRetries: 2, ExponentialBackoff: true},
+			expectedAttempts:  3,
+			expectedSucceeded: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receivedResultRequestCh := make(chan *metadatapb.RecordExecutionResultRequest, 10)
+			fcs := &fakeCronStore{scripts: make(map[uuid.UUID]*cvmsgspb.CronScript), receivedResultRequestCh: receivedResultRequestCh}
+
+			script := &cvmsgspb.CronScript{
+				ID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				Script:      "px.display()",
+				FrequencyS:  3600,
+				RetryPolicy: test.retryPolicy,
+			}
+
+			id := uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")
+			fvs := &fakeVizierServiceClient{responses: test.execScriptResponses}
+			clk := clock.NewFakeClock(time.Unix(1700000000, 0))
+			reporter := &fakeExecutionReporter{results: make(chan *cvmsgspb.CronScriptExecutionResult, 1)}
+			Runner := newRunner(script, fvs, "test", id, fcs, clk)
+			Runner.reporters = []ExecutionReporter{reporter}
+			Runner.start()
+			defer Runner.stop()
+			clk.BlockUntil(1)
+			clk.Advance(time.Hour)
+
+			for i := int32(1); i < test.expectedAttempts; i++ {
+				requireReceiveWithin(t, receivedResultRequestCh, 10*time.Second)
+				// Wait for the backoff before the retry.
+				clk.BlockUntil(2)
+				clk.Advance(retryBackoff(test.retryPolicy, int(i)))
+			}
+
+			result := requireReceiveWithin(t, reporter.results, 10*time.Second)
+			require.Equal(t, utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"), result.ScriptID)
+			require.Equal(t, test.expectedAttempts, result.Attempts)
+			require.Equal(t, test.expectedSucceeded, result.Succeeded)
+			if !test.expectedSucceeded {
+				require.Equal(t, "Internal", result.Error)
+			}
+			require.Len(t, receivedResultRequestCh, 1)
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *cvmsgspb.CronScriptRetryPolicy
+		attempt  int
+		expected time.Duration
+	}{
+		{
+			name:     "default backoff",
+			policy:   &cvmsgspb.CronScriptRetryPolicy{MaxRetries: 3},
+			attempt:  3,
+			expected: 5 * time.Second,
+		},
+		{
+			name:     "fixed backoff",
+			policy:   &cvmsgspb.CronScriptRetryPolicy{MaxRetries: 3, InitialBackoffS: 10},
+			attempt:  2,
+			expected: 10 * time.Second,
+		},
+		{
+			name:     "exponential backoff",
+			policy:   &cvmsgspb.CronScriptRetryPolicy{MaxRetries: 5, InitialBackoffS: 10, ExponentialBackoff: true},
+			attempt:  3,
+			expected: 40 * time.Second,
+		},
+		{
+			name:     "capped exponential backoff",
+			policy:   &cvmsgspb.CronScriptRetryPolicy{MaxRetries: 5, InitialBackoffS: 10, MaxBackoffS: 30, ExponentialBackoff: true},
+			attempt:  4,
+			expected: 30 * time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, retryBackoff(test.policy, test.attempt))
 		})
 	}
 }
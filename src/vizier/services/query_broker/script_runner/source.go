@@ -33,3 +33,9 @@ type Source interface {
 	// This method must not be called before Start.
 	Stop()
 }
+
+// ExecutionReporter is implemented by sources that report the results of the runs of their scripts.
+type ExecutionReporter interface {
+	// ReportExecution reports the result of a run of a script, including its retries.
+	ReportExecution(result *cvmsgspb.CronScriptExecutionResult)
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scriptrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/shared/scripts"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+)
+
+const (
+	defaultWebhookBatchSize = 500
+	webhookRequestTimeout   = 10 * time.Second
+	webhookRetryBackoff     = time.Second
+)
+
+// exportError is an error which happened while exporting results to a webhook or as actions, along with the stage
+// of the export that failed.
+type exportError struct {
+	stage storepb.CronScriptExportStage
+	msg   string
+}
+
+func (e *exportError) Error() string {
+	return e.msg
+}
+
+type webhookTable struct {
+	name    string
+	columns []string
+	rows    []map[string]interface{}
+}
+
+// webhookExporter collects the rows of a single run of a script, and POSTs them to the webhook
+// endpoint in batches.
+type webhookExporter struct {
+	config   *scripts.WebhookConfig
+	tmpl     *template.Template
+	client   *http.Client
+	clock    clock.Clock
+	scriptID uuid.UUID
+	batchID  uuid.UUID
+
+	// tables maps the ID of each table in the results to its name, columns and pending rows.
+	tables map[string]*webhookTable
+}
+
+func newWebhookExporter(config *scripts.WebhookConfig, client *http.Client, clk clock.Clock, scriptID uuid.UUID, batchID uuid.UUID) (*webhookExporter, error) {
+	tmpl, err := scripts.ParseWebhookPayloadTemplate(config.PayloadTemplate)
+	if err != nil {
+		return nil, &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY, msg: fmt.Sprintf("invalid webhook payload template: %v", err)}
+	}
+	return &webhookExporter{
+		config:   config,
+		tmpl:     tmpl,
+		client:   client,
+		clock:    clk,
+		scriptID: scriptID,
+		batchID:  batchID,
+		tables:   make(map[string]*webhookTable),
+	}, nil
+}
+
+func (w *webhookExporter) batchSize() int {
+	if w.config.BatchSize <= 0 {
+		return defaultWebhookBatchSize
+	}
+	return w.config.BatchSize
+}
+
+// handleMetadata registers a table of the results.
+func (w *webhookExporter) handleMetadata(md *vizierpb.QueryMetadata) {
+	table := &webhookTable{name: md.Name}
+	for _, col := range md.Relation.GetColumns() {
+		table.columns = append(table.columns, col.ColumnName)
+	}
+	w.tables[md.ID] = table
+}
+
+// handleBatch adds the rows of the batch to its table, and sends any full batches to the webhook.
+func (w *webhookExporter) handleBatch(ctx context.Context, batch *vizierpb.RowBatchData) error {
+	table, ok := w.tables[batch.TableID]
+	if !ok {
+		return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY, msg: fmt.Sprintf("received data for unknown table %s", batch.TableID)}
+	}
+	table.rows = append(table.rows, rowsFromBatch(table.columns, batch)...)
+	for len(table.rows) >= w.batchSize() {
+		if err := w.send(ctx, table.name, table.rows[:w.batchSize()]); err != nil {
+			return err
+		}
+		table.rows = table.rows[w.batchSize():]
+	}
+	return nil
+}
+
+// flush sends the remaining rows of every table to the webhook.
+func (w *webhookExporter) flush(ctx context.Context) error {
+	for _, table := range w.tables {
+		if len(table.rows) == 0 {
+			continue
+		}
+		if err := w.send(ctx, table.name, table.rows); err != nil {
+			return err
+		}
+		table.rows = nil
+	}
+	return nil
+}
+
+// send POSTs a batch of rows to the webhook, retrying failed requests up to the configured number of times.
+func (w *webhookExporter) send(ctx context.Context, tableName string, rows []map[string]interface{}) error {
+	body, err := scripts.RenderWebhookPayload(w.tmpl, &scripts.WebhookPayload{
+		ScriptID: w.scriptID.String(),
+		BatchID:  w.batchID.String(),
+		Table:    tableName,
+		Rows:     rows,
+	})
+	if err != nil {
+		return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_QUERY, msg: fmt.Sprintf("failed to render webhook payload: %v", err)}
+	}
+
+	var lastErr *exportError
+	for attempt := 0; attempt <= w.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return lastErr
+			case <-w.clock.After(webhookRetryBackoff * time.Duration(attempt)):
+			}
+		}
+		lastErr = w.post(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+func (w *webhookExporter) post(ctx context.Context, body []byte) *exportError {
+	ctx, cancel := context.WithTimeout(ctx, webhookRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY, msg: fmt.Sprintf("failed to create webhook request: %v", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.config.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(exportBatchIDHeader, w.batchID.String())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_DELIVERY, msg: fmt.Sprintf("webhook request failed: %v", err)}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &exportError{stage: storepb.CRON_SCRIPT_EXPORT_STAGE_ACK, msg: fmt.Sprintf("webhook returned status %d", resp.StatusCode)}
+	}
+	return nil
+}
+
+// rowsFromBatch converts a columnar row batch into rows keyed by column name.
+func rowsFromBatch(columns []string, batch *vizierpb.RowBatchData) []map[string]interface{} {
+	rows := make([]map[string]interface{}, batch.NumRows)
+	for i := range rows {
+		rows[i] = make(map[string]interface{}, len(batch.Cols))
+	}
+	for c, col := range batch.Cols {
+		name := fmt.Sprintf("col_%d", c)
+		if c < len(columns) {
+			name = columns[c]
+		}
+		for i := range rows {
+			rows[i][name] = columnValue(col, i)
+		}
+	}
+	return rows
+}
+
+func columnValue(col *vizierpb.Column, i int) interface{} {
+	switch c := col.ColData.(type) {
+	case *vizierpb.Column_BooleanData:
+		return c.BooleanData.Data[i]
+	case *vizierpb.Column_Int64Data:
+		return c.Int64Data.Data[i]
+	case *vizierpb.Column_Uint128Data:
+		b := make([]byte, 16)
+		binary.BigEndian.PutUint64(b, c.Uint128Data.Data[i].High)
+		binary.BigEndian.PutUint64(b[8:], c.Uint128Data.Data[i].Low)
+		return uuid.FromBytesOrNil(b).String()
+	case *vizierpb.Column_Time64NsData:
+		return c.Time64NsData.Data[i]
+	case *vizierpb.Column_Float64Data:
+		return c.Float64Data.Data[i]
+	case *vizierpb.Column_StringData:
+		return string(c.StringData.Data[i])
+	default:
+		return nil
+	}
+}
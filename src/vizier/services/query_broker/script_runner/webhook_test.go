@@ -0,0 +1,153 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package scriptrunner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+)
+
+func webhookTestResponses() []*vizierpb.ExecuteScriptResponse {
+	return []*vizierpb.ExecuteScriptResponse{
+		{
+			Result: &vizierpb.ExecuteScriptResponse_MetaData{
+				MetaData: &vizierpb.QueryMetadata{
+					Name: "http_events",
+					ID:   "table1",
+					Relation: &vizierpb.Relation{
+						Columns: []*vizierpb.Relation_ColumnInfo{
+							{ColumnName: "service"},
+							{ColumnName: "latency_ns"},
+						},
+					},
+				},
+			},
+		},
+		{
+			Result: &vizierpb.ExecuteScriptResponse_Data{
+				Data: &vizierpb.QueryData{
+					Batch: &vizierpb.RowBatchData{
+						TableID: "table1",
+						NumRows: 3,
+						Cols: []*vizierpb.Column{
+							{ColData: &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: [][]byte{[]byte("a"), []byte("b"), []byte("c")}}}},
+							{ColData: &vizierpb.Column_Int64Data{Int64Data: &vizierpb.Int64Column{Data: []int64{1, 2, 3}}}},
+						},
+					},
+				},
+			},
+		},
+		{
+			Result: &vizierpb.ExecuteScriptResponse_Data{
+				Data: &vizierpb.QueryData{
+					ExecutionStats: &vizierpb.QueryExecutionStats{
+						Timing:           &vizierpb.QueryTimingInfo{},
+						RecordsProcessed: 3,
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestScriptRunner_Webhook(t *testing.T) {
+	tests := []struct {
+		name           string
+		statusCode     int
+		expectedStage  storepb.CronScriptExportStage
+		expectedBodies int
+	}{
+		{
+			name:           "sends batches",
+			statusCode:     http.StatusOK,
+			expectedStage:  storepb.CRON_SCRIPT_EXPORT_STAGE_COMPLETE,
+			expectedBodies: 2,
+		},
+		{
+			name:           "rejected by webhook",
+			statusCode:     http.StatusForbidden,
+			expectedStage:  storepb.CRON_SCRIPT_EXPORT_STAGE_ACK,
+			expectedBodies: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bodies := make(chan map[string]interface{}, 10)
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "Bearer abcd", r.Header.Get("Authorization"))
+				require.NotEmpty(t, r.Header.Get(exportBatchIDHeader))
+				b, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				var body map[string]interface{}
+				require.NoError(t, json.Unmarshal(b, &body))
+				bodies <- body
+				w.WriteHeader(test.statusCode)
+			}))
+			defer server.Close()
+
+			script := &cvmsgspb.CronScript{
+				ID:         utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				Script:     "px.display()",
+				FrequencyS: 5,
+				Configs: `webhookConfig:
+  url: ` + server.URL + `
+  headers:
+    Authorization: Bearer abcd
+  payloadTemplate: '{"table": {{json .Table}}, "events": {{json .Rows}}}'
+  batchSize: 2
+`,
+			}
+			id := uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")
+			fvs := &fakeVizierServiceClient{responses: webhookTestResponses()}
+			clk := clock.NewFakeClock(time.Unix(1700000000, 0))
+			r := newRunner(script, fvs, "test", id, &fakeCronStore{}, clk)
+			r.httpClient = server.Client()
+
+			result := r.executeScript(context.Background(), clk.Now(), clk.Now().Add(5*time.Second))
+			require.NotNil(t, result)
+			require.Equal(t, test.expectedStage, result.Stage)
+			require.Len(t, bodies, test.expectedBodies)
+
+			body := <-bodies
+			require.Equal(t, "http_events", body["table"])
+			require.Equal(t, []interface{}{
+				map[string]interface{}{"service": "a", "latency_ns": float64(1)},
+				map[string]interface{}{"service": "b", "latency_ns": float64(2)},
+			}, body["events"])
+			if test.expectedBodies > 1 {
+				body = <-bodies
+				require.Len(t, body["events"], 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/clock"
+	svcutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+const (
+	// CheckProcessStats verifies that the PEM collects process stats on its node.
+	CheckProcessStats = "process_stats"
+	// CheckConnTracing verifies that the socket tracer sees connections on the PEM's node.
+	CheckConnTracing = "conn_tracing"
+	// CheckHTTPTracing verifies that HTTP requests on the PEM's node are traced end-to-end, from
+	// the socket tracer through the PEM's tables to the query results.
+	CheckHTTPTracing = "http_tracing"
+
+	// The PxL script that counts the records each PEM collected for every checked table.
+	// The hostname of the executing PEM is used to attribute the records to a node.
+	selfTestScript = `
+import px
+
+def node_counts(table, check):
+    df = px.DataFrame(table=table, start_time='-%[1]dm')
+    df.hostname = px._exec_hostname()
+    df = df.groupby('hostname').agg(count=('time_', px.count))
+    df.check = check
+    return df[['hostname', 'check', 'count']]
+
+df = node_counts('process_stats', '%[2]s')
+df = df.append(node_counts('conn_stats', '%[3]s'))
+df = df.append(node_counts('http_events', '%[4]s'))
+px.display(df, 'self_test')
+`
+
+	defaultWarmup        = 5 * time.Minute
+	defaultRerunInterval = 30 * time.Minute
+	defaultCheckInterval = time.Minute
+	scriptTimeout        = 30 * time.Second
+)
+
+// checks is the list of checks run against each PEM, in the order they are reported.
+var checks = []struct {
+	name  string
+	table string
+}{
+	{CheckProcessStats, "process_stats"},
+	{CheckConnTracing, "conn_stats"},
+	{CheckHTTPTracing, "http_events"},
+}
+
+// Runner periodically runs a self-test against every PEM that has been up long enough to have
+// collected data. The test checks that each node actually produces data for the core tables, so that
+// a Vizier that is deployed but silently not tracing on some nodes is visible. Results are stored in
+// the metadata service and published to the cloud connector, which reports them to the cloud.
+//
+// The HTTP check relies on the HTTP traffic that is already present on the node, such as kubelet
+// probes. Nodes that serve no HTTP traffic at all will fail it.
+type Runner struct {
+	mdsClient  metadatapb.MetadataServiceClient
+	vzClient   vizierpb.VizierServiceClient
+	nc         *nats.Conn
+	signingKey string
+	clock      clock.Clock
+
+	// How long a PEM must have been registered before it is tested.
+	warmup time.Duration
+	// How often a PEM that has already been tested is tested again.
+	rerunInterval time.Duration
+	// How often to look for PEMs that are due for a test.
+	checkInterval time.Duration
+
+	// The latest result for every PEM, keyed by agent ID.
+	results map[string]*cvmsgspb.NodeSelfTest
+
+	quitCh chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+// New creates a new self-test runner. Start must be called to begin testing.
+func New(mdsClient metadatapb.MetadataServiceClient, vzClient vizierpb.VizierServiceClient, nc *nats.Conn, signingKey string) *Runner {
+	return &Runner{
+		mdsClient:     mdsClient,
+		vzClient:      vzClient,
+		nc:            nc,
+		signingKey:    signingKey,
+		clock:         clock.New(),
+		warmup:        defaultWarmup,
+		rerunInterval: defaultRerunInterval,
+		checkInterval: defaultCheckInterval,
+		results:       make(map[string]*cvmsgspb.NodeSelfTest),
+		quitCh:        make(chan struct{}),
+	}
+}
+
+// Start loads the results of previous runs from the metadata service and starts testing PEMs
+// in the background.
+func (r *Runner) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ctx, cancel := r.newContext()
+		err := r.loadResults(ctx)
+		cancel()
+		if err != nil {
+			log.WithError(err).Warn("Failed to load previous self-test results, all PEMs will be retested")
+		}
+
+		ticker := r.clock.NewTicker(r.checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.quitCh:
+				return
+			case <-ticker.C():
+				ctx, cancel := r.newContext()
+				err := r.runOnce(ctx)
+				cancel()
+				if err != nil {
+					log.WithError(err).Error("Failed to run self-test")
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the runner and waits for any in-flight test to finish.
+func (r *Runner) Stop() {
+	r.once.Do(func() {
+		close(r.quitCh)
+	})
+	r.wg.Wait()
+}
+
+func (r *Runner) newContext() (context.Context, context.CancelFunc) {
+	claims := svcutils.GenerateJWTForService("query_broker", "vizier")
+	token, _ := svcutils.SignJWTClaims(claims, r.signingKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), scriptTimeout)
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", token))
+	return ctx, cancel
+}
+
+func (r *Runner) loadResults(ctx context.Context) error {
+	resp, err := r.mdsClient.GetAgentSelfTests(ctx, &metadatapb.AgentSelfTestsRequest{})
+	if err != nil {
+		return err
+	}
+	for _, res := range resp.Results {
+		r.results[utils.UUIDFromProtoOrNil(res.AgentID).String()] = res
+	}
+	return nil
+}
+
+// runOnce tests all of the PEMs that are due for a test and publishes the latest results.
+func (r *Runner) runOnce(ctx context.Context) error {
+	resp, err := r.mdsClient.GetAgentInfo(ctx, &metadatapb.AgentInfoRequest{})
+	if err != nil {
+		return err
+	}
+
+	now := r.clock.Now()
+	active := make(map[string]bool)
+	var due []*agentpb.Agent
+	for _, md := range resp.Info {
+		agt := md.Agent
+		if agt == nil || agt.Info == nil || agt.Info.Capabilities == nil || !agt.Info.Capabilities.CollectsData {
+			continue
+		}
+		// Unhealthy PEMs are already surfaced through the agent status, and wouldn't be able to
+		// answer the self-test query anyway.
+		if md.Status == nil || md.Status.State != agentpb.AGENT_STATE_HEALTHY {
+			continue
+		}
+		agentID := utils.UUIDFromProtoOrNil(agt.Info.AgentID).String()
+		active[agentID] = true
+
+		if now.Sub(time.Unix(0, agt.CreateTimeNS)) < r.warmup {
+			continue
+		}
+		if prev, ok := r.results[agentID]; ok && now.Sub(time.Unix(0, prev.LastRunNS)) < r.rerunInterval {
+			continue
+		}
+		due = append(due, agt)
+	}
+
+	for agentID := range r.results {
+		if !active[agentID] {
+			delete(r.results, agentID)
+		}
+	}
+
+	if len(due) > 0 {
+		counts, err := r.queryCounts(ctx)
+		if err != nil {
+			return err
+		}
+		for _, agt := range due {
+			res := buildResult(agt, counts[agt.Info.HostInfo.Hostname], r.warmup, now)
+			_, err := r.mdsClient.UpdateAgentSelfTest(ctx, &metadatapb.UpdateAgentSelfTestRequest{Result: res})
+			if status.Code(err) == codes.NotFound {
+				// The agent went away while we were testing it.
+				continue
+			}
+			if err != nil {
+				log.WithError(err).WithField("hostname", agt.Info.HostInfo.Hostname).Error("Failed to store self-test result")
+			}
+			r.results[utils.UUIDFromProtoOrNil(agt.Info.AgentID).String()] = res
+		}
+	}
+
+	return r.publishResults()
+}
+
+// buildResult turns the per-table record counts collected on a node into the node's self-test result.
+func buildResult(agt *agentpb.Agent, counts map[string]int64, window time.Duration, now time.Time) *cvmsgspb.NodeSelfTest {
+	res := &cvmsgspb.NodeSelfTest{
+		AgentID:   agt.Info.AgentID,
+		Hostname:  agt.Info.HostInfo.Hostname,
+		LastRunNS: now.UnixNano(),
+	}
+	for _, c := range checks {
+		check := &cvmsgspb.SelfTestCheck{
+			Name:   c.name,
+			Passed: counts[c.name] > 0,
+		}
+		if !check.Passed {
+			check.Message = fmt.Sprintf("no %s records were collected on this node in the last %s", c.table, window)
+		}
+		res.Checks = append(res.Checks, check)
+	}
+	return res
+}
+
+// queryCounts runs the self-test script and returns the number of records collected for each
+// check, keyed by the hostname of the PEM that collected them.
+func (r *Runner) queryCounts(ctx context.Context) (map[string]map[string]int64, error) {
+	script := fmt.Sprintf(selfTestScript, int(r.warmup.Minutes()), CheckProcessStats, CheckConnTracing, CheckHTTPTracing)
+	stream, err := r.vzClient.ExecuteScript(ctx, &vizierpb.ExecuteScriptRequest{
+		QueryStr:  script,
+		QueryName: "self_test",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]map[string]int64)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return counts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.Status != nil && resp.Status.Code != int32(codes.OK) {
+			return nil, fmt.Errorf("self-test script failed: %s", resp.Status.Message)
+		}
+		batch := resp.GetData().GetBatch()
+		if batch == nil || batch.NumRows == 0 {
+			continue
+		}
+		err = addBatchCounts(counts, batch)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func addBatchCounts(counts map[string]map[string]int64, batch *vizierpb.RowBatchData) error {
+	if len(batch.Cols) != 3 {
+		return fmt.Errorf("expected 3 columns in self-test results, got %d", len(batch.Cols))
+	}
+	hostnames := batch.Cols[0].GetStringData()
+	names := batch.Cols[1].GetStringData()
+	values := batch.Cols[2].GetInt64Data()
+	if hostnames == nil || names == nil || values == nil {
+		return errors.New("unexpected column types in self-test results")
+	}
+	for i := int64(0); i < batch.NumRows; i++ {
+		hostname := string(hostnames.Data[i])
+		if _, ok := counts[hostname]; !ok {
+			counts[hostname] = make(map[string]int64)
+		}
+		counts[hostname][string(names.Data[i])] += values.Data[i]
+	}
+	return nil
+}
+
+// publishResults sends the latest result of every PEM to the cloud connector.
+func (r *Runner) publishResults() error {
+	matrix := &cvmsgspb.SelfTestMatrix{}
+	for _, res := range r.results {
+		matrix.Nodes = append(matrix.Nodes, res)
+	}
+	b, err := proto.Marshal(matrix)
+	if err != nil {
+		return err
+	}
+	return r.nc.Publish(messagebus.SelfTestTopic, b)
+}
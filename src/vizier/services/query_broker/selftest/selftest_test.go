@@ -0,0 +1,192 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package selftest
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/mock/gomock"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	mock_vizierpb "px.dev/pixie/src/api/proto/vizierpb/mock"
+	"px.dev/pixie/src/shared/cvmsgspb"
+	"px.dev/pixie/src/shared/services/clock"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	mock_metadatapb "px.dev/pixie/src/vizier/services/metadata/metadatapb/mock"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+	"px.dev/pixie/src/vizier/utils/messagebus"
+)
+
+func makeAgent(hostname string, createTime time.Time, collectsData bool) *metadatapb.AgentMetadata {
+	return &metadatapb.AgentMetadata{
+		Agent: &agentpb.Agent{
+			Info: &agentpb.AgentInfo{
+				AgentID:      utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+				HostInfo:     &agentpb.HostInfo{Hostname: hostname},
+				Capabilities: &agentpb.AgentCapabilities{CollectsData: collectsData},
+			},
+			CreateTimeNS: createTime.UnixNano(),
+		},
+		Status: &agentpb.AgentStatus{State: agentpb.AGENT_STATE_HEALTHY},
+	}
+}
+
+func stringCol(vals ...string) *vizierpb.Column {
+	data := make([][]byte, len(vals))
+	for i, v := range vals {
+		data[i] = []byte(v)
+	}
+	return &vizierpb.Column{ColData: &vizierpb.Column_StringData{StringData: &vizierpb.StringColumn{Data: data}}}
+}
+
+func int64Col(vals ...int64) *vizierpb.Column {
+	return &vizierpb.Column{ColData: &vizierpb.Column_Int64Data{Int64Data: &vizierpb.Int64Column{Data: vals}}}
+}
+
+func TestRunner_RunOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+	msgCh := make(chan *nats.Msg, 1)
+	sub, err := nc.ChanSubscribe(messagebus.SelfTestTopic, msgCh)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, sub.Unsubscribe())
+	}()
+
+	now := time.Unix(0, 0).Add(24 * time.Hour)
+	tested := makeAgent("node-1", now.Add(-10*time.Minute), true)
+	warmingUp := makeAgent("node-2", now.Add(-time.Minute), true)
+	kelvin := makeAgent("kelvin", now.Add(-10*time.Minute), false)
+
+	mdsClient := mock_metadatapb.NewMockMetadataServiceClient(ctrl)
+	mdsClient.EXPECT().
+		GetAgentInfo(gomock.Any(), &metadatapb.AgentInfoRequest{}).
+		Return(&metadatapb.AgentInfoResponse{
+			Info: []*metadatapb.AgentMetadata{tested, warmingUp, kelvin},
+		}, nil)
+
+	stream := mock_vizierpb.NewMockVizierService_ExecuteScriptClient(ctrl)
+	gomock.InOrder(
+		stream.EXPECT().Recv().Return(&vizierpb.ExecuteScriptResponse{
+			Result: &vizierpb.ExecuteScriptResponse_Data{
+				Data: &vizierpb.QueryData{
+					Batch: &vizierpb.RowBatchData{
+						Cols: []*vizierpb.Column{
+							stringCol("node-1", "node-1", "node-2"),
+							stringCol(CheckProcessStats, CheckConnTracing, CheckHTTPTracing),
+							int64Col(10, 5, 3),
+						},
+						NumRows: 3,
+					},
+				},
+			},
+		}, nil),
+		stream.EXPECT().Recv().Return(nil, io.EOF),
+	)
+	vzClient := mock_vizierpb.NewMockVizierServiceClient(ctrl)
+	vzClient.EXPECT().ExecuteScript(gomock.Any(), gomock.Any()).Return(stream, nil)
+
+	expected := &cvmsgspb.NodeSelfTest{
+		AgentID:  tested.Agent.Info.AgentID,
+		Hostname: "node-1",
+		Checks: []*cvmsgspb.SelfTestCheck{
+			{Name: CheckProcessStats, Passed: true},
+			{Name: CheckConnTracing, Passed: true},
+			{Name: CheckHTTPTracing, Passed: false, Message: "no http_events records were collected on this node in the last 5m0s"},
+		},
+		LastRunNS: now.UnixNano(),
+	}
+	mdsClient.EXPECT().
+		UpdateAgentSelfTest(gomock.Any(), &metadatapb.UpdateAgentSelfTestRequest{Result: expected}).
+		Return(&metadatapb.UpdateAgentSelfTestResponse{}, nil)
+
+	r := New(mdsClient, vzClient, nc, "signing_key")
+	r.clock = clock.NewFakeClock(now)
+	err = r.runOnce(context.Background())
+	require.NoError(t, err)
+
+	select {
+	case msg := <-msgCh:
+		matrix := &cvmsgspb.SelfTestMatrix{}
+		require.NoError(t, proto.Unmarshal(msg.Data, matrix))
+		require.Len(t, matrix.Nodes, 1)
+		assert.Equal(t, expected, matrix.Nodes[0])
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for self-test results")
+	}
+}
+
+func TestRunner_RunOnceSkipsRecentlyTested(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+
+	now := time.Unix(0, 0).Add(24 * time.Hour)
+	tested := makeAgent("node-1", now.Add(-10*time.Minute), true)
+
+	mdsClient := mock_metadatapb.NewMockMetadataServiceClient(ctrl)
+	mdsClient.EXPECT().
+		GetAgentInfo(gomock.Any(), &metadatapb.AgentInfoRequest{}).
+		Return(&metadatapb.AgentInfoResponse{
+			Info: []*metadatapb.AgentMetadata{tested},
+		}, nil)
+	gone := &cvmsgspb.NodeSelfTest{
+		AgentID:   utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+		LastRunNS: now.Add(-time.Minute).UnixNano(),
+	}
+	mdsClient.EXPECT().
+		GetAgentSelfTests(gomock.Any(), &metadatapb.AgentSelfTestsRequest{}).
+		Return(&metadatapb.AgentSelfTestsResponse{
+			Results: []*cvmsgspb.NodeSelfTest{
+				{
+					AgentID:   tested.Agent.Info.AgentID,
+					Hostname:  "node-1",
+					LastRunNS: now.Add(-time.Minute).UnixNano(),
+				},
+				gone,
+			},
+		}, nil)
+
+	// The vizier client must not be called, since the only PEM was tested a minute ago.
+	vzClient := mock_vizierpb.NewMockVizierServiceClient(ctrl)
+
+	r := New(mdsClient, vzClient, nc, "signing_key")
+	r.clock = clock.NewFakeClock(now)
+	require.NoError(t, r.loadResults(context.Background()))
+	require.NoError(t, r.runOnce(context.Background()))
+
+	// Results of agents that are no longer active are dropped.
+	assert.Len(t, r.results, 1)
+	assert.Contains(t, r.results, utils.UUIDFromProtoOrNil(tested.Agent.Info.AgentID).String())
+}
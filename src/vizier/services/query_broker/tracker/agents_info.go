@@ -41,6 +41,8 @@ type AgentsInfo interface {
 	ClearPendingState()
 	UpdateAgentsInfo(update *metadatapb.AgentUpdatesResponse) error
 	DistributedState() distributedpb.DistributedState
+	// AgentHostIP returns the IP of the host that the agent runs on, or an empty string if the agent is unknown.
+	AgentHostIP(agentID uuid.UUID) string
 }
 
 // AgentsInfoImpl implements AgentsInfo to track information about the distributed state of the system.
@@ -50,6 +52,10 @@ type AgentsInfoImpl struct {
 	dsMutex sync.Mutex
 
 	pendingDs *distributedpb.DistributedState
+
+	// The host IPs of the agents, which are promoted along with ds.
+	hostIPs        map[uuid.UUID]string
+	pendingHostIPs map[uuid.UUID]string
 }
 
 // NewAgentsInfo creates an empty agents info.
@@ -60,6 +66,7 @@ func NewAgentsInfo() AgentsInfo {
 			SchemaInfo: []*distributedpb.SchemaInfo{},
 			CarnotInfo: []*distributedpb.CarnotInfo{},
 		},
+		pendingHostIPs: make(map[uuid.UUID]string),
 	}
 }
 
@@ -71,6 +78,15 @@ func NewTestAgentsInfo(ds *distributedpb.DistributedState) AgentsInfo {
 	}
 }
 
+// NewTestAgentsInfoWithHostIPs creates an agents info from a passed in distributed state and agent host IPs.
+func NewTestAgentsInfoWithHostIPs(ds *distributedpb.DistributedState, hostIPs map[uuid.UUID]string) AgentsInfo {
+	return &AgentsInfoImpl{
+		ds:        *(ds),
+		pendingDs: nil,
+		hostIPs:   hostIPs,
+	}
+}
+
 // ClearPendingState clears the pending agents info state (the upcoming version).
 func (a *AgentsInfoImpl) ClearPendingState() {
 	log.Infof("Clearing distributed state")
@@ -78,6 +94,7 @@ func (a *AgentsInfoImpl) ClearPendingState() {
 		SchemaInfo: []*distributedpb.SchemaInfo{},
 		CarnotInfo: []*distributedpb.CarnotInfo{},
 	}
+	a.pendingHostIPs = make(map[uuid.UUID]string)
 }
 
 // UpdateAgentsInfo creates a new agent info.
@@ -130,6 +147,7 @@ func (a *AgentsInfoImpl) UpdateAgentsInfo(update *metadatapb.AgentUpdatesRespons
 				kelvinGRPCAddress := agent.Info.IPAddress
 				carnotInfoMap[agentUUID] = makeKelvinCarnotInfo(agentUUID, kelvinGRPCAddress, agent.ASID)
 			}
+			a.pendingHostIPs[agentUUID] = agent.Info.GetHostInfo().GetHostIP()
 		}
 		// case 2: agent data info update
 		dataInfo := agentUpdate.GetDataInfo()
@@ -151,6 +169,7 @@ func (a *AgentsInfoImpl) UpdateAgentsInfo(update *metadatapb.AgentUpdatesRespons
 		if agentUpdate.GetDeleted() {
 			deletedAgents++
 			delete(carnotInfoMap, agentUUID)
+			delete(a.pendingHostIPs, agentUUID)
 		}
 	}
 
@@ -169,6 +188,10 @@ func (a *AgentsInfoImpl) UpdateAgentsInfo(update *metadatapb.AgentUpdatesRespons
 	if update.EndOfVersion {
 		a.dsMutex.Lock()
 		a.ds = *(a.pendingDs)
+		a.hostIPs = make(map[uuid.UUID]string, len(a.pendingHostIPs))
+		for id, ip := range a.pendingHostIPs {
+			a.hostIPs[id] = ip
+		}
 		a.dsMutex.Unlock()
 	}
 
@@ -184,6 +207,13 @@ func (a *AgentsInfoImpl) DistributedState() distributedpb.DistributedState {
 	return a.ds
 }
 
+// AgentHostIP returns the IP of the host that the agent runs on, as of the current distributed state.
+func (a *AgentsInfoImpl) AgentHostIP(agentID uuid.UUID) string {
+	a.dsMutex.Lock()
+	defer a.dsMutex.Unlock()
+	return a.hostIPs[agentID]
+}
+
 func makeAgentCarnotInfo(agentID uuid.UUID, asid uint32, agentMetadata *distributedpb.MetadataInfo) *distributedpb.CarnotInfo {
 	return &distributedpb.CarnotInfo{
 		QueryBrokerAddress:   agentID.String(),
@@ -269,6 +269,8 @@ func TestAgentsInfo_UpdateAgentsInfo(t *testing.T) {
 	assert.Equal(t, 2, len(agentsMap))
 	assert.Equal(t, expectedPEM1Info, agentsMap[uuids[0]])
 	assert.Equal(t, expectedKelvinInfo, agentsMap[uuids[1]])
+	assert.Equal(t, "127.0.0.1", agentsInfo.AgentHostIP(uuids[0]))
+	assert.Equal(t, "127.0.0.1", agentsInfo.AgentHostIP(uuids[1]))
 
 	// Update agent 1, and add table metadata for another agent,
 	// create an agent, and delete an agent.
@@ -339,6 +341,9 @@ func TestAgentsInfo_UpdateAgentsInfo(t *testing.T) {
 	assert.Equal(t, expectedPEM1Info, agentsMap[uuids[0]])
 	// Agent 3 should be created.
 	assert.Equal(t, expectedPEM2Info, agentsMap[uuids[2]])
+	// Agent 2 was deleted, so its host is no longer known.
+	assert.Equal(t, "", agentsInfo.AgentHostIP(uuids[1]))
+	assert.Equal(t, "127.0.0.1", agentsInfo.AgentHostIP(uuids[2]))
 
 	// Test the case where the schema is updated to be fully empty.
 	err = agentsInfo.UpdateAgentsInfo(&metadatapb.AgentUpdatesResponse{
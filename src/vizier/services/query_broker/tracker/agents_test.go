@@ -22,6 +22,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/gofrs/uuid"
 	"github.com/golang/mock/gomock"
 
 	"px.dev/pixie/src/carnot/planner/distributedpb"
@@ -45,6 +46,11 @@ func (a *fakeAgentsInfo) DistributedState() distributedpb.DistributedState {
 	return distributedpb.DistributedState{}
 }
 
+// AgentHostIP implementation for fake agents info.
+func (a *fakeAgentsInfo) AgentHostIP(agentID uuid.UUID) string {
+	return ""
+}
+
 func (a *fakeAgentsInfo) UpdateAgentsInfo(update *metadatapb.AgentUpdatesResponse) error {
 	if len(update.AgentUpdates) > 0 || len(update.AgentSchemas) > 0 {
 		a.wg.Done()
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pgdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+// The keys are stored as bytea, so that they are ordered by their bytes like in the other datastores, regardless
+// of the collation of the database. Expiry times are computed by the database, so that the clocks of the
+// vizier and the database don't need to agree.
+const schema = `
+CREATE TABLE IF NOT EXISTS metadata_kv (
+  key bytea PRIMARY KEY,
+  value bytea NOT NULL,
+  expires_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS metadata_kv_expires_at_idx ON metadata_kv (expires_at) WHERE expires_at IS NOT NULL;
+`
+
+// notExpired is the condition that a row has not expired yet. Expired rows are only deleted periodically, so
+// all reads need to filter them out.
+const notExpired = `(expires_at IS NULL OR expires_at > now())`
+
+// DataStore wraps a postgres database for use as a KVStore.
+type DataStore struct {
+	db *sqlx.DB
+
+	done chan struct{}
+	once sync.Once
+}
+
+// New creates a new postgres backed KVStore, creating its table if it doesn't exist yet. The DataStore takes
+// ownership of the database connection, and closes it when the DataStore is closed.
+func New(db *sqlx.DB, ttlReaperDuration time.Duration) (*DataStore, error) {
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("failed to create metadata table: %w", err)
+	}
+
+	wrap := &DataStore{
+		db:   db,
+		done: make(chan struct{}),
+	}
+
+	go wrap.ttlWatcher(ttlReaperDuration)
+
+	return wrap, nil
+}
+
+func (w *DataStore) ttlWatcher(ttlReaperDuration time.Duration) {
+	ticker := time.NewTicker(ttlReaperDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			_, err := w.db.Exec(`DELETE FROM metadata_kv WHERE expires_at <= now()`)
+			if err != nil {
+				log.WithError(err).Error("Failed to delete expired keys")
+			}
+		}
+	}
+}
+
+// Set puts the given key and value in the datastore.
+func (w *DataStore) Set(key string, value string) error {
+	query := `INSERT INTO metadata_kv (key, value, expires_at) VALUES ($1, $2, NULL)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = NULL`
+	_, err := w.db.Exec(query, []byte(key), []byte(value))
+	return err
+}
+
+// SetWithTTL puts the given key and value into the datastore with a TTL.
+// Once the TTL expires the datastore is expected to delete the given key and value.
+func (w *DataStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	query := `INSERT INTO metadata_kv (key, value, expires_at) VALUES ($1, $2, now() + make_interval(secs => $3))
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`
+	_, err := w.db.Exec(query, []byte(key), []byte(value), ttl.Seconds())
+	return err
+}
+
+// Get gets the value for the given key from the datastore.
+func (w *DataStore) Get(key string) ([]byte, error) {
+	var value []byte
+	query := `SELECT value FROM metadata_kv WHERE key = $1 AND ` + notExpired
+	err := w.db.QueryRow(query, []byte(key)).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// GetWithRange gets all keys and values within the given range.
+// Treats this as [from, to) i.e. includes the key from, but excludes the key to.
+func (w *DataStore) GetWithRange(from string, to string) ([]string, [][]byte, error) {
+	query := `SELECT key, value FROM metadata_kv WHERE key >= $1 AND key < $2 AND ` + notExpired + ` ORDER BY key`
+	rows, err := w.db.Query(query, []byte(from), []byte(to))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	var values [][]byte
+	for rows.Next() {
+		var key, value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, string(key))
+		values = append(values, value)
+	}
+	return keys, values, rows.Err()
+}
+
+// GetWithPrefix gets all keys and values with the given prefix.
+func (w *DataStore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
+	ub := pebbledb.KeyUpperBound([]byte(prefix))
+	if ub == nil {
+		return nil, nil, fmt.Errorf("unsupported prefix: %x", prefix)
+	}
+	return w.GetWithRange(prefix, string(ub))
+}
+
+// Delete deletes the value for the given key from the datastore.
+func (w *DataStore) Delete(key string) error {
+	_, err := w.db.Exec(`DELETE FROM metadata_kv WHERE key = $1`, []byte(key))
+	return err
+}
+
+// DeleteAll deletes all of the given keys and corresponding values in the datastore if they exist.
+func (w *DataStore) DeleteAll(keys []string) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, key := range keys {
+		if _, err := tx.Exec(`DELETE FROM metadata_kv WHERE key = $1`, []byte(key)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteWithPrefix deletes all keys and values with the given prefix.
+func (w *DataStore) DeleteWithPrefix(prefix string) error {
+	ub := pebbledb.KeyUpperBound([]byte(prefix))
+	if ub == nil {
+		return fmt.Errorf("unsupported prefix: %x", prefix)
+	}
+	_, err := w.db.Exec(`DELETE FROM metadata_kv WHERE key >= $1 AND key < $2`, []byte(prefix), ub)
+	return err
+}
+
+// Close stops the TTL watcher, and closes the underlying database connection.
+// All other operations will fail after calling Close.
+func (w *DataStore) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.db.Close()
+	})
+	return err
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pgdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/services/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+var db *sqlx.DB
+
+func testMain(m *testing.M) error {
+	testDB, teardown, err := pgtest.SetupTestDB(nil)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+// newTestDataStore creates an empty datastore. It isn't closed, since that would close the shared connection.
+func newTestDataStore(t *testing.T, ttlReaperDuration time.Duration) *DataStore {
+	ds, err := New(db, ttlReaperDuration)
+	require.NoError(t, err)
+	db.MustExec(`DELETE FROM metadata_kv`)
+	t.Cleanup(func() { close(ds.done) })
+	return ds
+}
+
+func TestDataStore(t *testing.T) {
+	ds := newTestDataStore(t, time.Hour)
+	for _, k := range []string{"jam1", "key1", "key2", "key3", "key9", "lim1"} {
+		require.NoError(t, ds.Set(k, "val-"+k))
+	}
+
+	v, err := ds.Get("key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val-key1", string(v))
+
+	require.NoError(t, ds.Set("key1", "val1.1"))
+	v, err = ds.Get("key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1.1", string(v))
+
+	v, err = ds.Get("nonexistent")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	keys, vals, err := ds.GetWithRange("key1", "key4")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key1", "key2", "key3"}, keys)
+	assert.Equal(t, [][]byte{[]byte("val1.1"), []byte("val-key2"), []byte("val-key3")}, vals)
+
+	keys, _, err = ds.GetWithPrefix("key")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key1", "key2", "key3", "key9"}, keys)
+
+	keys, vals, err = ds.GetWithPrefix("nonexistent")
+	require.NoError(t, err)
+	assert.Nil(t, keys)
+	assert.Nil(t, vals)
+
+	require.NoError(t, ds.DeleteAll([]string{"key1", "key3", "nonexistent"}))
+	keys, _, err = ds.GetWithPrefix("key")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key2", "key9"}, keys)
+
+	require.NoError(t, ds.DeleteWithPrefix("key"))
+	require.NoError(t, ds.Delete("lim1"))
+	keys, _, err = ds.GetWithPrefix("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jam1"}, keys)
+}
+
+func TestDataStore_KeysOrderedByBytes(t *testing.T) {
+	ds := newTestDataStore(t, time.Hour)
+	for _, k := range []string{"a/b", "A/b", "a/\xffb", "a/B"} {
+		require.NoError(t, ds.Set(k, "v"))
+	}
+
+	keys, _, err := ds.GetWithPrefix("a/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/B", "a/b", "a/\xffb"}, keys)
+}
+
+func TestDataStore_SetWithTTL(t *testing.T) {
+	ds := newTestDataStore(t, 100*time.Millisecond)
+
+	require.NoError(t, ds.SetWithTTL("timed1", "limited1", time.Second))
+	require.NoError(t, ds.SetWithTTL("timed2", "limited2", time.Second))
+	// Resets the TTL.
+	require.NoError(t, ds.SetWithTTL("timed2", "limited2", time.Hour))
+	require.NoError(t, ds.SetWithTTL("timed3", "limited3", time.Second))
+	// Clears the TTL.
+	require.NoError(t, ds.Set("timed3", "forever"))
+
+	v, err := ds.Get("timed1")
+	require.NoError(t, err)
+	assert.Equal(t, "limited1", string(v))
+
+	assert.Eventually(t, func() bool {
+		var count int
+		require.NoError(t, db.Get(&count, `SELECT count(*) FROM metadata_kv`))
+		return count == 2
+	}, 10*time.Second, 100*time.Millisecond)
+
+	keys, vals, err := ds.GetWithPrefix("timed")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"timed2", "timed3"}, keys)
+	assert.Equal(t, [][]byte{[]byte("limited2"), []byte("forever")}, vals)
+}
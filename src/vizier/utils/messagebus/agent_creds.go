@@ -0,0 +1,92 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package messagebus
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+const (
+	// agentUpdateTopic is the topic that agents register and heartbeat on.
+	agentUpdateTopic = "UpdateAgent"
+	// missingMetadataRequestTopic is the topic that agents request the K8s metadata updates they missed on.
+	missingMetadataRequestTopic = "MissingMetadataRequests"
+	// k8sUpdateTopicPrefix is the prefix of the topics that the K8s metadata updates are sent to agents on.
+	k8sUpdateTopicPrefix = "K8sUpdates"
+)
+
+// AgentNATSPermissions returns the permissions of the NATS user of an agent. Agents may only publish their
+// updates and replies, and only subscribe to their own topic, the K8s metadata updates of their selector, and the
+// replies to their requests.
+func AgentNATSPermissions(agentID uuid.UUID, k8sUpdateSelector string) jwt.Permissions {
+	p := jwt.Permissions{}
+	p.Pub.Allow.Add(
+		agentUpdateTopic,
+		missingMetadataRequestTopic,
+		MetricsTopic,
+		BackfillTopic,
+		ProtocolTracerTopic,
+		"_INBOX.>",
+	)
+	p.Sub.Allow.Add(
+		AgentUUIDTopic(agentID),
+		path.Join(k8sUpdateTopicPrefix, k8sUpdateSelector),
+		"_INBOX.>",
+	)
+	return p
+}
+
+// validK8sUpdateSelector returns whether the selector, such as the host IP of a PEM, names a single topic without
+// wildcards, so that it can't be used to subscribe to the K8s metadata updates of other agents.
+func validK8sUpdateSelector(selector string) bool {
+	return selector != "" && !strings.ContainsAny(selector, "*> \t\r\n")
+}
+
+// NewAgentNATSCreds returns the NATS credentials file of a new user for the given agent, signed by the account.
+func NewAgentNATSCreds(account nkeys.KeyPair, agentID uuid.UUID, k8sUpdateSelector string) ([]byte, error) {
+	if !validK8sUpdateSelector(k8sUpdateSelector) {
+		return nil, fmt.Errorf("invalid K8s update selector %q", k8sUpdateSelector)
+	}
+	userKP, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, err
+	}
+	userKey, err := userKP.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	userSeed, err := userKP.Seed()
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.NewUserClaims(userKey)
+	claims.Name = "agent-" + agentID.String()
+	claims.Permissions = AgentNATSPermissions(agentID, k8sUpdateSelector)
+	userJWT, err := claims.Encode(account)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.FormatUserConfig(userJWT, userSeed)
+}
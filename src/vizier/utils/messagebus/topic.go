@@ -34,6 +34,23 @@ const (
 	v2cTopicPrefix = "v2c"
 	// MetricsTopic is the topic name for prometheus metrics being sent from an agent to cloud connector.
 	MetricsTopic = "Metrics"
+	// SaturationReportTopic is the topic name for reports on how saturated the consumers of PEM data are, sent to the
+	// metadata service so that it can apply backpressure to the PEMs.
+	SaturationReportTopic = "SaturationReport"
+	// SelfTestTopic is the topic name for the per-node self-test results sent from the query broker to cloud connector.
+	SelfTestTopic = "SelfTest"
+	// BackfillTopic is the topic name for the backfill requests and statuses that restarted PEMs send to the metadata
+	// service, which decides when each PEM may backfill.
+	BackfillTopic = "Backfill"
+	// ProtocolTracerTopic is the topic name for the acknowledgments that PEMs send to the metadata service once they
+	// applied a change to the protocols that they trace.
+	ProtocolTracerTopic = "ProtocolTracer"
+	// QueryStatsTopic is the topic name for the stats of the finished queries, sent from the query broker to the
+	// metadata service which aggregates them per table and namespace.
+	QueryStatsTopic = "QueryStats"
+	// CrashDiagnosticsTopic is the topic name for the diagnostic bundles of crashlooping pods, sent from the operator
+	// to cloud connector when the Vizier consents to uploading them.
+	CrashDiagnosticsTopic = "CrashDiagnostics"
 )
 
 // V2CTopic returns the topic used in the Vizier NATS domain to send messages from Vizier to Cloud.
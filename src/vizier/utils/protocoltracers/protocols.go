@@ -0,0 +1,46 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package protocoltracers
+
+// Protocols are the names of the protocols that the PEMs trace, which can be enabled and disabled at runtime.
+// Each one corresponds to a --stirling_enable_<protocol>_tracing flag of the PEM.
+var Protocols = []string{
+	"amqp",
+	"cass",
+	"dns",
+	"http",
+	"http2",
+	"kafka",
+	"mongodb",
+	"mux",
+	"mysql",
+	"nats",
+	"pgsql",
+	"redis",
+}
+
+// IsKnown returns whether the PEMs can trace the given protocol.
+func IsKnown(protocol string) bool {
+	for _, p := range Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}